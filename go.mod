@@ -5,9 +5,6 @@ go 1.24
 require (
 	github.com/gorilla/mux v1.8.1
 	github.com/tcaine/twamp v0.0.0-20241030214341-bede25f26bb1
-)
-
-require (
-	golang.org/x/net v0.38.0 // indirect
-	golang.org/x/sys v0.31.0 // indirect
+	golang.org/x/net v0.38.0
+	golang.org/x/sys v0.31.0
 )
@@ -0,0 +1,639 @@
+package api
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A minimal ACME (RFC 8555) client that obtains and renews the API's
+// certificate for TLS_AUTOCERT_DOMAINS, from Let's Encrypt by default. The CA's
+// challenges are answered with tls-alpn-01 (RFC 8737) on the API listener
+// itself, which must then be reachable on port 443, or with http-01 on
+// TLS_AUTOCERT_HTTP_ADDR, which must be reachable on port 80.
+const (
+	ACME_LETS_ENCRYPT_URL  = "https://acme-v02.api.letsencrypt.org/directory"
+	ACME_DEFAULT_CACHE_DIR = "acme"
+	ACME_TLS_ALPN_PROTO    = "acme-tls/1"
+	ACME_HTTP_PATH         = "/.well-known/acme-challenge/"
+	ACME_BAD_NONCE         = "urn:ietf:params:acme:error:badNonce"
+
+	ACME_RENEW_BEFORE   = 30 * 24 * time.Hour // Renew once the certificate expires within this
+	ACME_CHECK_INTERVAL = 12 * time.Hour      // Between renewal checks
+	ACME_RETRY_INTERVAL = time.Hour           // After a failed order
+	ACME_POLL_INTERVAL  = 2 * time.Second
+	ACME_POLL_TIMEOUT   = 2 * time.Minute // Of an authorization or order to become valid
+	ACME_TIMEOUT        = 30 * time.Second
+	ACME_MAX_RESPONSE   = 1 << 20
+)
+
+// idPeAcmeIdentifier is the critical extension of a tls-alpn-01 challenge
+// certificate, holding the SHA-256 of the key authorization
+var idPeAcmeIdentifier = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 31}
+
+// acmeManager holds the certificate of TLS_AUTOCERT_DOMAINS and renews it.
+// The account and certificate are cached in TLS_AUTOCERT_CACHE_DIR across
+// restarts, so that the CA's rate limits are not hit.
+type acmeManager struct {
+	domains      []string
+	email        string
+	directoryURL string
+	cacheDir     string
+	httpAddr     string // Of http-01 challenges; tls-alpn-01 without
+
+	// Used only by the renewal goroutine
+	client     *http.Client
+	accountKey *ecdsa.PrivateKey
+	kid        string // Account URL, once registered
+	dir        acmeDirectory
+	nonce      string
+
+	mu         sync.Mutex
+	cert       *tls.Certificate
+	alpnCerts  map[string]*tls.Certificate // tls-alpn-01 challenge certificates by domain
+	httpTokens map[string]string           // http-01 key authorizations by token
+}
+
+type acmeDirectory struct {
+	NewNonce   string `json:"newNonce"`
+	NewAccount string `json:"newAccount"`
+	NewOrder   string `json:"newOrder"`
+}
+
+type acmeOrder struct {
+	Status         string       `json:"status"`
+	Authorizations []string     `json:"authorizations"`
+	Finalize       string       `json:"finalize"`
+	Certificate    string       `json:"certificate"`
+	Error          *acmeProblem `json:"error"`
+}
+
+type acmeAuthorization struct {
+	Status     string `json:"status"`
+	Identifier struct {
+		Value string `json:"value"`
+	} `json:"identifier"`
+	Challenges []acmeChallenge `json:"challenges"`
+}
+
+type acmeChallenge struct {
+	Type   string       `json:"type"`
+	URL    string       `json:"url"`
+	Token  string       `json:"token"`
+	Status string       `json:"status"`
+	Error  *acmeProblem `json:"error"`
+}
+
+// acmeProblem is an RFC 7807 problem document of the CA
+type acmeProblem struct {
+	Type   string `json:"type"`
+	Detail string `json:"detail"`
+}
+
+func (p *acmeProblem) Error() string {
+	return fmt.Sprintf("%s (%s)", p.Detail, p.Type)
+}
+
+// newACMEManager reads the TLS_AUTOCERT settings and the cached account key
+// and certificate
+func newACMEManager(domains string) (*acmeManager, error) {
+	m := &acmeManager{
+		email:        os.Getenv("TLS_AUTOCERT_EMAIL"),
+		directoryURL: os.Getenv("TLS_AUTOCERT_DIRECTORY_URL"),
+		cacheDir:     os.Getenv("TLS_AUTOCERT_CACHE_DIR"),
+		httpAddr:     os.Getenv("TLS_AUTOCERT_HTTP_ADDR"),
+		client:       &http.Client{Timeout: ACME_TIMEOUT},
+		alpnCerts:    make(map[string]*tls.Certificate),
+		httpTokens:   make(map[string]string),
+	}
+	var err error
+	if m.domains, err = splitDomains(domains); err != nil {
+		return nil, err
+	}
+	if m.directoryURL == "" {
+		m.directoryURL = ACME_LETS_ENCRYPT_URL
+	}
+	if m.cacheDir == "" {
+		m.cacheDir = ACME_DEFAULT_CACHE_DIR
+	}
+	if err := os.MkdirAll(m.cacheDir, 0o700); err != nil {
+		return nil, err
+	}
+	if m.accountKey, err = loadOrCreateKey(filepath.Join(m.cacheDir, "account.key")); err != nil {
+		return nil, err
+	}
+	if cert, err := tls.LoadX509KeyPair(m.certFiles()); err == nil && coversDomains(cert.Leaf, m.domains) {
+		m.cert = &cert
+		log.Printf("Loaded cached certificate for %s, valid until %s", strings.Join(m.domains, ", "), cert.Leaf.NotAfter.Format(time.RFC3339))
+	}
+	return m, nil
+}
+
+// splitDomains parses the comma-separated hostnames of TLS_AUTOCERT_DOMAINS
+func splitDomains(v string) ([]string, error) {
+	var domains []string
+	for _, d := range strings.Split(v, ",") {
+		if d = strings.ToLower(strings.TrimSpace(d)); d == "" {
+			continue
+		}
+		if err := checkHostname(d); err != nil || net.ParseIP(d) != nil || strings.Contains(d, "*") {
+			return nil, fmt.Errorf("%q is not a hostname", d)
+		}
+		domains = append(domains, d)
+	}
+	if len(domains) == 0 {
+		return nil, fmt.Errorf("no domains given")
+	}
+	return domains, nil
+}
+
+// coversDomains reports whether leaf is valid for all domains
+func coversDomains(leaf *x509.Certificate, domains []string) bool {
+	if leaf == nil {
+		return false
+	}
+	for _, d := range domains {
+		if leaf.VerifyHostname(d) != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// certFiles are the cached certificate chain and its key
+func (m *acmeManager) certFiles() (string, string) {
+	return filepath.Join(m.cacheDir, "certificate.pem"), filepath.Join(m.cacheDir, "certificate.key")
+}
+
+// loadOrCreateKey reads a PEM EC private key, creating it if the file does not exist
+func loadOrCreateKey(file string) (*ecdsa.PrivateKey, error) {
+	raw, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		keyPEM, err := encodeECKey(key)
+		if err != nil {
+			return nil, err
+		}
+		return key, os.WriteFile(file, keyPEM, 0o600)
+	}
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(raw)
+	if block == nil || block.Type != "EC PRIVATE KEY" {
+		return nil, fmt.Errorf("%s: no EC PRIVATE KEY found", file)
+	}
+	return x509.ParseECPrivateKey(block.Bytes)
+}
+
+func encodeECKey(key *ecdsa.PrivateKey) ([]byte, error) {
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), nil
+}
+
+// GetCertificate is a tls.Config.GetCertificate serving tls-alpn-01
+// challenge certificates to the CA and the obtained certificate to everyone else
+func (m *acmeManager) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, proto := range hello.SupportedProtos {
+		if proto == ACME_TLS_ALPN_PROTO {
+			if cert := m.alpnCerts[strings.ToLower(hello.ServerName)]; cert != nil {
+				return cert, nil
+			}
+			return nil, fmt.Errorf("no tls-alpn-01 challenge pending for %q", hello.ServerName)
+		}
+	}
+	if m.cert == nil {
+		return nil, fmt.Errorf("no certificate for %s obtained yet", strings.Join(m.domains, ", "))
+	}
+	return m.cert, nil
+}
+
+// GetConfigForClient returns a tls.Config.GetConfigForClient that negotiates
+// acme-tls/1 with the CA, without asking it for a client certificate
+func (m *acmeManager) GetConfigForClient(base *tls.Config) func(*tls.ClientHelloInfo) (*tls.Config, error) {
+	return func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+		for _, proto := range hello.SupportedProtos {
+			if proto == ACME_TLS_ALPN_PROTO {
+				c := base.Clone()
+				c.NextProtos = []string{ACME_TLS_ALPN_PROTO}
+				c.ClientAuth = tls.NoClientCert
+				c.GetConfigForClient = nil
+				return c, nil
+			}
+		}
+		return nil, nil
+	}
+}
+
+// start answers http-01 challenges on TLS_AUTOCERT_HTTP_ADDR, if set, and
+// obtains and renews the certificate in the background
+func (m *acmeManager) start() {
+	if m.httpAddr != "" {
+		go func() {
+			err := http.ListenAndServe(m.httpAddr, http.HandlerFunc(m.serveHTTPChallenge))
+			log.Printf("ACME http-01 listener on %s failed: %v", m.httpAddr, err)
+		}()
+	}
+	go func() {
+		for {
+			wait := ACME_CHECK_INTERVAL
+			if m.needsRenewal(time.Now()) {
+				if err := m.obtain(); err != nil {
+					log.Printf("Obtaining certificate for %s failed: %v", strings.Join(m.domains, ", "), err)
+					wait = ACME_RETRY_INTERVAL
+				}
+			}
+			time.Sleep(wait)
+		}
+	}()
+}
+
+// needsRenewal reports whether there is no certificate or it expires soon
+func (m *acmeManager) needsRenewal(now time.Time) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.cert == nil || m.cert.Leaf.NotAfter.Sub(now) < ACME_RENEW_BEFORE
+}
+
+// serveHTTPChallenge answers the CA's requests for http-01 key authorizations
+func (m *acmeManager) serveHTTPChallenge(w http.ResponseWriter, r *http.Request) {
+	token, ok := strings.CutPrefix(r.URL.Path, ACME_HTTP_PATH)
+	m.mu.Lock()
+	keyAuth := m.httpTokens[token]
+	m.mu.Unlock()
+	if !ok || keyAuth == "" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain")
+	io.WriteString(w, keyAuth)
+}
+
+// obtain orders a certificate for all domains and caches it
+func (m *acmeManager) obtain() error {
+	if m.dir.NewOrder == "" {
+		if err := m.getDirectory(); err != nil {
+			return fmt.Errorf("directory %s: %w", m.directoryURL, err)
+		}
+	}
+	if m.kid == "" {
+		if err := m.register(); err != nil {
+			return fmt.Errorf("account: %w", err)
+		}
+	}
+
+	ids := make([]map[string]string, len(m.domains))
+	for i, d := range m.domains {
+		ids[i] = map[string]string{"type": "dns", "value": d}
+	}
+	var order acmeOrder
+	header, err := m.postJSON(m.dir.NewOrder, map[string]interface{}{"identifiers": ids}, &order)
+	if err != nil {
+		return fmt.Errorf("order: %w", err)
+	}
+	orderURL := header.Get("Location")
+	for _, authzURL := range order.Authorizations {
+		if err := m.authorize(authzURL); err != nil {
+			return err
+		}
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: m.domains[0]},
+		DNSNames: m.domains,
+	}, key)
+	if err != nil {
+		return err
+	}
+	if _, err := m.postJSON(order.Finalize, map[string]string{"csr": base64.RawURLEncoding.EncodeToString(csr)}, &order); err != nil {
+		return fmt.Errorf("finalize: %w", err)
+	}
+	if err := m.poll(orderURL, &order, func() string { return order.Status }); err != nil {
+		return fmt.Errorf("order: %w", err)
+	}
+	if order.Status != "valid" {
+		if order.Error != nil {
+			return fmt.Errorf("order is %s: %w", order.Status, order.Error)
+		}
+		return fmt.Errorf("order is %s", order.Status)
+	}
+
+	_, chainPEM, err := m.post(order.Certificate, nil)
+	if err != nil {
+		return fmt.Errorf("certificate: %w", err)
+	}
+	keyPEM, err := encodeECKey(key)
+	if err != nil {
+		return err
+	}
+	cert, err := tls.X509KeyPair(chainPEM, keyPEM)
+	if err != nil {
+		return fmt.Errorf("certificate: %w", err)
+	}
+	certFile, keyFile := m.certFiles()
+	if err := os.WriteFile(keyFile, keyPEM, 0o600); err != nil {
+		return err
+	}
+	if err := os.WriteFile(certFile, chainPEM, 0o600); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	m.cert = &cert
+	m.mu.Unlock()
+	log.Printf("Obtained certificate for %s, valid until %s", strings.Join(m.domains, ", "), cert.Leaf.NotAfter.Format(time.RFC3339))
+	return nil
+}
+
+// authorize answers the challenge of one pending authorization and waits
+// for the CA to validate it
+func (m *acmeManager) authorize(url string) error {
+	var authz acmeAuthorization
+	if _, err := m.postJSON(url, nil, &authz); err != nil {
+		return fmt.Errorf("authorization: %w", err)
+	}
+	if authz.Status == "valid" {
+		return nil
+	}
+	domain := authz.Identifier.Value
+	want := "tls-alpn-01"
+	if m.httpAddr != "" {
+		want = "http-01"
+	}
+	var challenge *acmeChallenge
+	for i := range authz.Challenges {
+		if authz.Challenges[i].Type == want {
+			challenge = &authz.Challenges[i]
+		}
+	}
+	if challenge == nil {
+		return fmt.Errorf("%s: the CA offers no %s challenge", domain, want)
+	}
+
+	keyAuth := challenge.Token + "." + acmeThumbprint(&m.accountKey.PublicKey)
+	m.mu.Lock()
+	if want == "http-01" {
+		m.httpTokens[challenge.Token] = keyAuth
+	} else {
+		cert, err := acmeChallengeCert(domain, keyAuth)
+		if err != nil {
+			m.mu.Unlock()
+			return err
+		}
+		m.alpnCerts[domain] = cert
+	}
+	m.mu.Unlock()
+	defer func() {
+		m.mu.Lock()
+		delete(m.httpTokens, challenge.Token)
+		delete(m.alpnCerts, domain)
+		m.mu.Unlock()
+	}()
+
+	if _, err := m.postJSON(challenge.URL, struct{}{}, nil); err != nil {
+		return fmt.Errorf("%s: %s challenge: %w", domain, want, err)
+	}
+	if err := m.poll(url, &authz, func() string { return authz.Status }); err != nil {
+		return fmt.Errorf("%s: %w", domain, err)
+	}
+	if authz.Status == "valid" {
+		return nil
+	}
+	for _, c := range authz.Challenges {
+		if c.Error != nil {
+			return fmt.Errorf("%s: %s challenge failed: %w", domain, c.Type, c.Error)
+		}
+	}
+	return fmt.Errorf("%s: authorization is %s", domain, authz.Status)
+}
+
+// poll fetches url into v until status is neither pending nor processing
+func (m *acmeManager) poll(url string, v interface{}, status func() string) error {
+	deadline := time.Now().Add(ACME_POLL_TIMEOUT)
+	for {
+		if _, err := m.postJSON(url, nil, v); err != nil {
+			return err
+		}
+		if s := status(); s != "pending" && s != "processing" {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("still %s after %s", status(), ACME_POLL_TIMEOUT)
+		}
+		time.Sleep(ACME_POLL_INTERVAL)
+	}
+}
+
+func (m *acmeManager) getDirectory() error {
+	resp, err := m.client.Get(m.directoryURL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, ACME_MAX_RESPONSE)).Decode(&m.dir)
+}
+
+// register creates the account of the account key, or finds the existing one
+func (m *acmeManager) register() error {
+	account := map[string]interface{}{"termsOfServiceAgreed": true}
+	if m.email != "" {
+		account["contact"] = []string{"mailto:" + m.email}
+	}
+	header, err := m.postJSON(m.dir.NewAccount, account, nil)
+	if err != nil {
+		return err
+	}
+	if m.kid = header.Get("Location"); m.kid == "" {
+		return fmt.Errorf("the CA returned no account URL")
+	}
+	return nil
+}
+
+// postJSON is post decoding the response into out, if not nil
+func (m *acmeManager) postJSON(url string, payload, out interface{}) (http.Header, error) {
+	header, body, err := m.post(url, payload)
+	if err != nil || out == nil {
+		return header, err
+	}
+	return header, json.Unmarshal(body, out)
+}
+
+// post sends payload to url as a JWS signed with the account key, or a
+// POST-as-GET with a nil payload, retrying once with a fresh nonce
+func (m *acmeManager) post(url string, payload interface{}) (http.Header, []byte, error) {
+	for attempt := 0; ; attempt++ {
+		header, body, err := m.postOnce(url, payload)
+		var problem *acmeProblem
+		if attempt == 0 && errors.As(err, &problem) && problem.Type == ACME_BAD_NONCE {
+			continue
+		}
+		return header, body, err
+	}
+}
+
+func (m *acmeManager) postOnce(url string, payload interface{}) (http.Header, []byte, error) {
+	if m.nonce == "" {
+		resp, err := m.client.Head(m.dir.NewNonce)
+		if err != nil {
+			return nil, nil, fmt.Errorf("nonce: %w", err)
+		}
+		resp.Body.Close()
+		if m.nonce = resp.Header.Get("Replay-Nonce"); m.nonce == "" {
+			return nil, nil, fmt.Errorf("nonce: the CA returned none")
+		}
+	}
+	protected := map[string]interface{}{"alg": "ES256", "nonce": m.nonce, "url": url}
+	if m.kid == "" {
+		protected["jwk"] = acmeJWK(&m.accountKey.PublicKey)
+	} else {
+		protected["kid"] = m.kid
+	}
+	m.nonce = ""
+	jws, err := acmeSign(m.accountKey, protected, payload)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(jws))
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("Content-Type", "application/jose+json")
+	req.Header.Set("User-Agent", "network-test-api/"+API_VERSION)
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	m.nonce = resp.Header.Get("Replay-Nonce")
+	body, err := io.ReadAll(io.LimitReader(resp.Body, ACME_MAX_RESPONSE))
+	if err != nil {
+		return nil, nil, err
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		problem := &acmeProblem{}
+		if json.Unmarshal(body, problem) != nil || problem.Type == "" {
+			return nil, nil, fmt.Errorf("HTTP %d", resp.StatusCode)
+		}
+		return nil, nil, problem
+	}
+	return resp.Header, body, nil
+}
+
+// acmeSign returns the flattened JWS of payload, an empty payload for nil
+func acmeSign(key *ecdsa.PrivateKey, protected map[string]interface{}, payload interface{}) ([]byte, error) {
+	rawProtected, err := json.Marshal(protected)
+	if err != nil {
+		return nil, err
+	}
+	encodedPayload := ""
+	if payload != nil {
+		rawPayload, err := json.Marshal(payload)
+		if err != nil {
+			return nil, err
+		}
+		encodedPayload = base64.RawURLEncoding.EncodeToString(rawPayload)
+	}
+	encodedProtected := base64.RawURLEncoding.EncodeToString(rawProtected)
+	digest := sha256.Sum256([]byte(encodedProtected + "." + encodedPayload))
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	if err != nil {
+		return nil, err
+	}
+	// ES256 signatures are R and S as 32-byte big-endian integers (RFC 7518)
+	signature := make([]byte, 64)
+	r.FillBytes(signature[:32])
+	s.FillBytes(signature[32:])
+	return json.Marshal(map[string]string{
+		"protected": encodedProtected,
+		"payload":   encodedPayload,
+		"signature": base64.RawURLEncoding.EncodeToString(signature),
+	})
+}
+
+// acmeJWK is the JSON Web Key of a P-256 public key
+func acmeJWK(pub *ecdsa.PublicKey) map[string]string {
+	x, y := make([]byte, 32), make([]byte, 32)
+	pub.X.FillBytes(x)
+	pub.Y.FillBytes(y)
+	return map[string]string{
+		"crv": "P-256",
+		"kty": "EC",
+		"x":   base64.RawURLEncoding.EncodeToString(x),
+		"y":   base64.RawURLEncoding.EncodeToString(y),
+	}
+}
+
+// acmeThumbprint is the RFC 7638 thumbprint of the account key, its JWK's
+// members in lexicographic order without whitespace
+func acmeThumbprint(pub *ecdsa.PublicKey) string {
+	jwk := acmeJWK(pub)
+	sum := sha256.Sum256([]byte(fmt.Sprintf(`{"crv":"P-256","kty":"EC","x":"%s","y":"%s"}`, jwk["x"], jwk["y"])))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// acmeChallengeCert is the self-signed tls-alpn-01 certificate of domain
+func acmeChallengeCert(domain, keyAuth string) (*tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256([]byte(keyAuth))
+	value, err := asn1.Marshal(sum[:])
+	if err != nil {
+		return nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:    serial,
+		Subject:         pkix.Name{CommonName: domain},
+		DNSNames:        []string{domain},
+		NotBefore:       now.Add(-time.Hour),
+		NotAfter:        now.Add(24 * time.Hour),
+		ExtraExtensions: []pkix.Extension{{Id: idPeAcmeIdentifier, Critical: true, Value: value}},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, nil
+}
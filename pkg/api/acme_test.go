@@ -0,0 +1,61 @@
+package api
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"testing"
+)
+
+func TestACMESign(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	protected := map[string]interface{}{"alg": "ES256", "nonce": "n1", "url": "https://ca.example/acme/order"}
+	for _, payload := range []interface{}{map[string]string{"csr": "abc"}, nil} {
+		raw, err := acmeSign(key, protected, payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var jws map[string]string
+		if err := json.Unmarshal(raw, &jws); err != nil {
+			t.Fatal(err)
+		}
+		if payload == nil && jws["payload"] != "" {
+			t.Errorf("expected an empty payload for POST-as-GET, got %q", jws["payload"])
+		}
+		signature, err := base64.RawURLEncoding.DecodeString(jws["signature"])
+		if err != nil || len(signature) != 64 {
+			t.Fatalf("expected a 64-byte ES256 signature, got %d bytes (%v)", len(signature), err)
+		}
+		digest := sha256.Sum256([]byte(jws["protected"] + "." + jws["payload"]))
+		r, s := new(big.Int).SetBytes(signature[:32]), new(big.Int).SetBytes(signature[32:])
+		if !ecdsa.Verify(&key.PublicKey, digest[:], r, s) {
+			t.Error("expected the signature to verify")
+		}
+	}
+}
+
+func TestACMEThumbprint(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// encoding/json sorts map keys, which gives the RFC 7638 member order
+	canonical, _ := json.Marshal(acmeJWK(&key.PublicKey))
+	sum := sha256.Sum256(canonical)
+	if got, want := acmeThumbprint(&key.PublicKey), base64.RawURLEncoding.EncodeToString(sum[:]); got != want {
+		t.Errorf("expected thumbprint %s, got %s", want, got)
+	}
+
+	// Coordinates with leading zero bytes keep their 32 bytes
+	jwk := acmeJWK(&ecdsa.PublicKey{Curve: elliptic.P256(), X: big.NewInt(1), Y: big.NewInt(2)})
+	if x, _ := base64.RawURLEncoding.DecodeString(jwk["x"]); len(x) != 32 {
+		t.Errorf("expected a 32-byte x coordinate, got %d bytes", len(x))
+	}
+}
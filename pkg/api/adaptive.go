@@ -0,0 +1,291 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"network-test-api/pkg/nettest"
+)
+
+// Adaptive UDP rate search defaults
+const (
+	BANDWIDTH_MODE_FIXED    = "fixed"
+	BANDWIDTH_MODE_ADAPTIVE = "adaptive"
+	BANDWIDTH_MODE_RAMP     = "ramp"
+
+	ADAPTIVE_TRIAL_SEC       = 2                      // Length of each rate trial
+	ADAPTIVE_TRIAL_GAP       = 500 * time.Millisecond // Pause so the server can return to listening
+	ADAPTIVE_CONVERGENCE     = 0.05                   // Stop once the good/bad bracket is within 5%
+	ADAPTIVE_MIN_BANDWIDTH   = 100 * 1000             // 100 kbit/s floor
+	DEFAULT_ADAPTIVE_MAXLOSS = 1.0                    // Percent
+)
+
+// parseBandwidthMode validates the request's bandwidth mode, defaulting to fixed
+func parseBandwidthMode(s string) (string, error) {
+	switch mode := strings.ToLower(s); mode {
+	case "", BANDWIDTH_MODE_FIXED:
+		return BANDWIDTH_MODE_FIXED, nil
+	case BANDWIDTH_MODE_ADAPTIVE, BANDWIDTH_MODE_RAMP:
+		return mode, nil
+	}
+	return "", fmt.Errorf("invalid bandwidth_mode %q (expected fixed, adaptive or ramp)", s)
+}
+
+// searchesRate reports whether a bandwidth_mode runs UDP rate trials instead
+// of a single test
+func searchesRate(mode string) bool {
+	return strings.EqualFold(mode, BANDWIDTH_MODE_ADAPTIVE) || strings.EqualFold(mode, BANDWIDTH_MODE_RAMP)
+}
+
+// iperf3BandwidthMode checks bandwidth_mode and ramp_step, which only its
+// rate searches use. ramp_step defaults to the bandwidth.
+func (v *requestValidator) iperf3BandwidthMode(req RunRequest) {
+	mode, err := parseBandwidthMode(req.BandwidthMode)
+	if err != nil {
+		v.fail("bandwidth_mode", req.BandwidthMode, "must be fixed, adaptive or ramp")
+		return
+	}
+	if mode != BANDWIDTH_MODE_FIXED && (!strings.EqualFold(req.Protocol, "UDP") || req.Reverse) {
+		v.fail("bandwidth_mode", req.BandwidthMode, "requires protocol UDP without reverse")
+	}
+	switch step := req.RampStep; {
+	case mode != BANDWIDTH_MODE_RAMP:
+		if step.Set {
+			v.fail("ramp_step", step, "only applies to ramp bandwidth_mode")
+		}
+	case !step.Set && req.Bandwidth.Set && req.Bandwidth.bps() <= 0:
+		v.fail("ramp_step", nil, "must be positive; it defaults to the bandwidth, which is 0")
+	case step.Set && step.bps() <= 0:
+		v.fail("ramp_step", step, "must be positive")
+	}
+}
+
+// trialRateLimit is the highest rate in bit/s a rate search may pick for the
+// request: the lower of its API key's and profile's max_bandwidth, 0 for no limit
+func trialRateLimit(req RunRequest, profile *Profile) float64 {
+	max := req.apiKey.maxBandwidth()
+	if profile != nil && profile.Limits.MaxBandwidth > 0 && (max == 0 || profile.Limits.MaxBandwidth < max) {
+		max = profile.Limits.MaxBandwidth
+	}
+	return float64(max) * 1e6
+}
+
+// rateSearch picks the rate of each trial from the loss of the ones before
+type rateSearch interface {
+	target() float64 // Rate for the next trial in bit/s
+	observe(lossPercent, maxLossPercent float64)
+	Converged() bool
+	sustainable() float64 // Highest rate within the loss target so far, 0 for none
+	limit(max float64)    // Never pick a rate above max bit/s (0 = no limit)
+}
+
+// adaptiveRate searches for the highest rate whose loss stays within the target.
+//
+// Until loss is seen the rate doubles each trial. The first lossy trial backs
+// off to just below the rate that was actually delivered; from then on the
+// search bisects between the best clean rate and the lowest lossy one, so a
+// clean trial re-probes upwards and a lossy one backs off again. With a Max
+// the rate never goes above it, and a clean trial at Max ends the search.
+type adaptiveRate struct {
+	Rate float64 // Rate for the next trial in bit/s
+	Good float64 // Highest rate that stayed within the loss target (0 = none yet)
+	Bad  float64 // Lowest rate that exceeded the loss target (0 = none yet)
+	Max  float64 // Highest rate the caller may send (0 = no limit)
+}
+
+// observe records a trial at the current rate and picks the next rate
+func (a *adaptiveRate) observe(lossPercent, maxLossPercent float64) {
+	if lossPercent <= maxLossPercent {
+		if a.Rate > a.Good {
+			a.Good = a.Rate
+		}
+	} else if a.Bad == 0 || a.Rate < a.Bad {
+		a.Bad = a.Rate
+	}
+
+	switch {
+	case a.Bad == 0:
+		a.Rate *= 2
+	case a.Good == 0:
+		a.Rate = a.Bad * (1 - lossPercent/100) * 0.9
+	default:
+		a.Rate = (a.Good + a.Bad) / 2
+	}
+	if a.Rate < ADAPTIVE_MIN_BANDWIDTH {
+		a.Rate = ADAPTIVE_MIN_BANDWIDTH
+	}
+	if a.Max > 0 && a.Rate > a.Max {
+		a.Rate = a.Max
+	}
+}
+
+// Converged reports whether the good/bad bracket is narrow enough to stop, or
+// the rate was clean at the limit
+func (a *adaptiveRate) Converged() bool {
+	if a.Max > 0 && a.Good >= a.Max {
+		return true
+	}
+	return a.Good > 0 && a.Bad > 0 && (a.Bad-a.Good)/a.Bad <= ADAPTIVE_CONVERGENCE
+}
+
+func (a *adaptiveRate) target() float64      { return a.Rate }
+func (a *adaptiveRate) sustainable() float64 { return a.Good }
+
+func (a *adaptiveRate) limit(max float64) {
+	a.Max = max
+	if max > 0 && a.Rate > max {
+		a.Rate = max
+	}
+}
+
+// rampRate steps the rate up by a fixed amount from the start until a trial
+// exceeds the loss target, like fixed-rate tests run by hand at rising rates.
+// The answer is only as fine as the step, but no rate above the first lossy
+// one is ever sent. With a Max the last step is cut short at it, and a clean
+// trial at Max ends the ramp.
+type rampRate struct {
+	Rate float64 // Rate for the next trial in bit/s
+	Step float64
+	Good float64 // Rate of the last clean trial (0 = none yet)
+	Bad  float64 // Rate of the first lossy trial, which ends the ramp (0 = none yet)
+	Max  float64 // Highest rate the caller may send (0 = no limit)
+}
+
+func (r *rampRate) observe(lossPercent, maxLossPercent float64) {
+	if lossPercent > maxLossPercent {
+		r.Bad = r.Rate
+		return
+	}
+	r.Good = r.Rate
+	r.Rate += r.Step
+	if r.Max > 0 && r.Rate > r.Max {
+		r.Rate = r.Max
+	}
+}
+
+// Converged reports whether a trial has exceeded the loss target, or the
+// ramp was clean at the limit
+func (r *rampRate) Converged() bool {
+	return r.Bad > 0 || (r.Max > 0 && r.Good >= r.Max)
+}
+
+func (r *rampRate) target() float64      { return r.Rate }
+func (r *rampRate) sustainable() float64 { return r.Good }
+
+func (r *rampRate) limit(max float64) {
+	r.Max = max
+	if max > 0 && r.Rate > max {
+		r.Rate = max
+	}
+}
+
+// AdaptiveTrial is one fixed-rate iperf3 run within an adaptive test
+type AdaptiveTrial struct {
+	TargetMbps   float64 `json:"target_mbps"`
+	AchievedMbps float64 `json:"achieved_mbps"`
+	LossPercent  float64 `json:"loss_percent"`
+	JitterMs     float64 `json:"jitter_ms"`
+	WithinTarget bool    `json:"within_target"`
+}
+
+// AdaptiveResult summarises the rate search
+type AdaptiveResult struct {
+	SustainableMbps float64         `json:"sustainable_mbps"`    // Highest target rate within max_loss (0 if none)
+	AchievedMbps    float64         `json:"achieved_mbps"`       // Rate the trial at sustainable_mbps delivered
+	StepMbps        float64         `json:"step_mbps,omitempty"` // Ramp mode: increase between trials
+	MaxLossPercent  float64         `json:"max_loss_percent"`
+	LimitMbps       float64         `json:"limit_mbps,omitempty"` // API key or profile max_bandwidth no trial went above
+	Converged       bool            `json:"converged"`
+	Trials          []AdaptiveTrial `json:"trials"`
+	Error           string          `json:"error,omitempty"` // Set when a later trial failed and the search stopped early
+
+	Duration  float64             `json:"-"`
+	Dial      *nettest.DialReport `json:"-"` // Control connection of the first trial
+	SentBytes int64               `json:"-"`
+	StartedAt time.Time           `json:"-"`
+	Series    []SeriesPoint       `json:"-"` // Throughput across all trials, offset from StartedAt
+}
+
+// Run back-to-back UDP trials within the duration budget, with rate picking
+// each one's rate from the loss the server reports after the one before and
+// keeping it at or below maxRate bit/s (0 = no limit).
+func adaptiveIperf3Test(ctx context.Context, host string, port, duration, parallel int, rate rateSearch, maxRate, maxLossPercent float64, payload nettest.PayloadEntropy, family string, bind *nettest.SourceBinding, auth *nettest.Iperf3Auth) (*AdaptiveResult, error) {
+	trials := duration / ADAPTIVE_TRIAL_SEC
+	if trials < 1 {
+		trials = 1
+	}
+	result := &AdaptiveResult{MaxLossPercent: maxLossPercent, LimitMbps: maxRate / 1e6}
+	rate.limit(maxRate)
+	if ramp, ok := rate.(*rampRate); ok {
+		result.StepMbps = ramp.Step / 1e6
+	}
+
+	start := time.Now()
+	result.StartedAt = start
+	for i := 0; i < trials && !rate.Converged(); i++ {
+		if i > 0 {
+			time.Sleep(ADAPTIVE_TRIAL_GAP)
+		}
+
+		trialStart := time.Now()
+		target := rate.target()
+		client := nettest.NewIperf3Client(host,
+			nettest.WithPort(port),
+			nettest.WithDuration(ADAPTIVE_TRIAL_SEC*time.Second),
+			nettest.WithParallel(parallel),
+			nettest.WithProtocol("UDP"),
+			nettest.WithBandwidth(int64(target)),
+			nettest.WithPayload(payload),
+			nettest.WithFamily(family),
+			nettest.WithSource(bind),
+			nettest.WithAuth(auth),
+		)
+		res, err := client.Run(ctx)
+		client.Close()
+		if ctx.Err() != nil {
+			return nil, canceledError(ctx)
+		}
+
+		if err == nil && !res.ReceiverReport {
+			err = fmt.Errorf("server did not report UDP loss")
+		}
+		if err != nil {
+			if i == 0 {
+				return nil, err
+			}
+			result.Error = fmt.Sprintf("trial %d: %v", i+1, err)
+			break
+		}
+
+		trial := AdaptiveTrial{
+			TargetMbps:   target / 1e6,
+			AchievedMbps: res.BandwidthMbps,
+			LossPercent:  res.LossPercent,
+			JitterMs:     res.JitterMs,
+			WithinTarget: res.LossPercent <= maxLossPercent,
+		}
+		result.Trials = append(result.Trials, trial)
+		if result.Dial == nil {
+			result.Dial = res.Dial
+		}
+		result.SentBytes += res.SentBytes
+		offset := trialStart.Sub(start).Seconds()
+		for _, p := range res.Series {
+			p.T += offset
+			result.Series = append(result.Series, p)
+		}
+		logf(ctx, "iperf3 rate search: trial %d at %.2f Mbps - %.2f%% loss", i+1, trial.TargetMbps, trial.LossPercent)
+
+		rate.observe(res.LossPercent, maxLossPercent)
+		if trial.WithinTarget && rate.sustainable() == target {
+			result.AchievedMbps = trial.AchievedMbps
+		}
+	}
+
+	result.Duration = time.Since(start).Seconds()
+	result.SustainableMbps = rate.sustainable() / 1e6
+	result.Converged = rate.Converged()
+	return result, nil
+}
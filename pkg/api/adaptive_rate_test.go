@@ -0,0 +1,217 @@
+package api
+
+import (
+	"math"
+	"testing"
+)
+
+// simulateLoss models a bottleneck: everything above capacity is dropped
+func simulateLoss(rate, capacity float64) float64 {
+	if rate <= capacity {
+		return 0
+	}
+	return (rate - capacity) / rate * 100
+}
+
+func TestAdaptiveRate_ProbesUpWithoutLoss(t *testing.T) {
+	a := &adaptiveRate{Rate: 10e6}
+	a.observe(0, 1)
+
+	if a.Rate != 20e6 {
+		t.Errorf("Expected rate to double to 20e6, got %v", a.Rate)
+	}
+	if a.Good != 10e6 {
+		t.Errorf("Expected good rate 10e6, got %v", a.Good)
+	}
+}
+
+func TestAdaptiveRate_BacksOffBelowDeliveredRate(t *testing.T) {
+	a := &adaptiveRate{Rate: 100e6}
+	a.observe(50, 1)
+
+	// Delivered ~50 Mbit/s, back off to 90% of that
+	if math.Abs(a.Rate-45e6) > 1 {
+		t.Errorf("Expected back-off to 45e6, got %v", a.Rate)
+	}
+	if a.Bad != 100e6 {
+		t.Errorf("Expected bad rate 100e6, got %v", a.Bad)
+	}
+}
+
+func TestAdaptiveRate_BisectsAfterBracket(t *testing.T) {
+	a := &adaptiveRate{Rate: 80e6, Bad: 100e6}
+	a.observe(0, 1)
+
+	if a.Rate != 90e6 {
+		t.Errorf("Expected bisected rate 90e6, got %v", a.Rate)
+	}
+}
+
+func TestAdaptiveRate_RespectsFloor(t *testing.T) {
+	a := &adaptiveRate{Rate: 200 * 1000}
+	a.observe(99, 1)
+
+	if a.Rate != ADAPTIVE_MIN_BANDWIDTH {
+		t.Errorf("Expected rate floor %d, got %v", ADAPTIVE_MIN_BANDWIDTH, a.Rate)
+	}
+}
+
+func TestAdaptiveRate_ConvergesOnCapacity(t *testing.T) {
+	for _, tc := range []struct {
+		start, capacity float64
+	}{
+		{100e6, 37e6},  // Start above capacity
+		{5e6, 230e6},   // Start well below capacity
+		{50e6, 50.2e6}, // Start just below capacity
+	} {
+		a := &adaptiveRate{Rate: tc.start}
+		trials := 0
+		for ; trials < 20 && !a.Converged(); trials++ {
+			a.observe(simulateLoss(a.Rate, tc.capacity*1.005), 1)
+		}
+
+		if !a.Converged() {
+			t.Errorf("Expected convergence for capacity %v, stopped at good=%v bad=%v", tc.capacity, a.Good, a.Bad)
+			continue
+		}
+		if a.Good > tc.capacity*1.02 || a.Good < tc.capacity*0.9 {
+			t.Errorf("Expected sustainable rate near %v, got %v after %d trials", tc.capacity, a.Good, trials)
+		}
+	}
+}
+
+func TestAdaptiveRate_StopsAtLimit(t *testing.T) {
+	a := &adaptiveRate{Rate: 40e6, Max: 100e6}
+	var sent []float64
+	for trials := 0; trials < 20 && !a.Converged(); trials++ {
+		sent = append(sent, a.Rate)
+		a.observe(simulateLoss(a.Rate, 1e9), 1)
+	}
+
+	// 40 and 80 double as usual, 160 is clamped to the 100 Mbit/s key limit
+	if len(sent) != 3 || sent[2] != 100e6 {
+		t.Errorf("Expected 3 trials ending at the 100e6 limit, got %v", sent)
+	}
+	for _, rate := range sent {
+		if rate > a.Max {
+			t.Errorf("Expected no trial above the limit, got %v", rate)
+		}
+	}
+	if !a.Converged() || a.Good != 100e6 {
+		t.Errorf("Expected convergence at the limit, got good=%v bad=%v", a.Good, a.Bad)
+	}
+}
+
+func TestAdaptiveRate_BisectsBelowLimit(t *testing.T) {
+	a := &adaptiveRate{Rate: 80e6, Max: 100e6}
+	trials := 0
+	for ; trials < 20 && !a.Converged(); trials++ {
+		if a.Rate > a.Max {
+			t.Fatalf("Expected no trial above the limit, got %v", a.Rate)
+		}
+		a.observe(simulateLoss(a.Rate, 90e6*1.005), 1)
+	}
+
+	if !a.Converged() || a.Good > 90e6*1.02 || a.Good < 90e6*0.9 {
+		t.Errorf("Expected convergence near 90e6 below the limit, got good=%v bad=%v after %d trials", a.Good, a.Bad, trials)
+	}
+}
+
+// limitedRateLimit is trialRateLimit with an API key and a profile of the
+// given max_bandwidth, or none for 0
+func limitedRateLimit(keyMax, profileMax int) float64 {
+	var req RunRequest
+	var profile *Profile
+	if keyMax > 0 {
+		req.apiKey = &APIKey{MaxBandwidth: keyMax}
+	}
+	if profileMax > 0 {
+		profile = &Profile{Limits: ProfileLimits{MaxBandwidth: profileMax}}
+	}
+	return trialRateLimit(req, profile)
+}
+
+func TestTrialRateLimit(t *testing.T) {
+	for _, tc := range []struct {
+		keyMax, profileMax int
+		want               float64
+	}{
+		{0, 0, 0},
+		{200, 0, 200e6},
+		{0, 50, 50e6},
+		{200, 50, 50e6},
+		{30, 50, 30e6},
+	} {
+		if got := limitedRateLimit(tc.keyMax, tc.profileMax); got != tc.want {
+			t.Errorf("trialRateLimit(%d, %d) = %v, want %v", tc.keyMax, tc.profileMax, got, tc.want)
+		}
+	}
+}
+
+func TestAdaptiveRate_StopsAtProfileLimit(t *testing.T) {
+	a := &adaptiveRate{Rate: 20e6, Max: limitedRateLimit(500, 60)}
+	for trials := 0; trials < 20 && !a.Converged(); trials++ {
+		if a.Rate > 60e6 {
+			t.Fatalf("Expected no trial above the 60 Mbit/s profile limit, got %v", a.Rate)
+		}
+		a.observe(0, 1)
+	}
+
+	if a.Good != 60e6 {
+		t.Errorf("Expected the search to end clean at the profile limit, got good=%v", a.Good)
+	}
+}
+
+func TestRampRate_StepsToFirstLoss(t *testing.T) {
+	r := &rampRate{Rate: 50e6, Step: 50e6}
+	var sent []float64
+	for trials := 0; trials < 20 && !r.Converged(); trials++ {
+		sent = append(sent, r.Rate)
+		r.observe(simulateLoss(r.Rate, 230e6), 1)
+	}
+
+	// 50, 100, 150, 200 clean; 250 loses 8%
+	if len(sent) != 5 || sent[4] != 250e6 {
+		t.Errorf("Expected 5 trials ending at 250e6, got %v", sent)
+	}
+	if r.Good != 200e6 || r.Bad != 250e6 {
+		t.Errorf("Expected the ramp to stop between 200e6 and 250e6, got good=%v bad=%v", r.Good, r.Bad)
+	}
+}
+
+func TestRampRate_LossOnFirstTrial(t *testing.T) {
+	r := &rampRate{Rate: 100e6, Step: 10e6}
+	r.observe(5, 1)
+
+	if !r.Converged() || r.Good != 0 || r.Rate != 100e6 {
+		t.Errorf("Expected no sustainable rate after a lossy first trial, got good=%v rate=%v", r.Good, r.Rate)
+	}
+}
+
+func TestRampRate_StopsAtLimit(t *testing.T) {
+	r := &rampRate{Rate: 50e6, Step: 40e6, Max: limitedRateLimit(150, 0)}
+	var sent []float64
+	for trials := 0; trials < 20 && !r.Converged(); trials++ {
+		sent = append(sent, r.Rate)
+		r.observe(simulateLoss(r.Rate, 1e9), 1)
+	}
+
+	// 50, 90 and 130 step as usual, 170 is cut short at the 150 Mbit/s limit
+	if len(sent) != 4 || sent[3] != 150e6 {
+		t.Errorf("Expected 4 trials ending at the 150e6 limit, got %v", sent)
+	}
+	if !r.Converged() || r.Good != 150e6 || r.Bad != 0 {
+		t.Errorf("Expected the ramp to stop clean at the limit, got good=%v bad=%v", r.Good, r.Bad)
+	}
+}
+
+func TestRampRate_LossBelowLimit(t *testing.T) {
+	r := &rampRate{Rate: 50e6, Step: 50e6, Max: 500e6}
+	for trials := 0; trials < 20 && !r.Converged(); trials++ {
+		r.observe(simulateLoss(r.Rate, 230e6), 1)
+	}
+
+	if r.Good != 200e6 || r.Bad != 250e6 {
+		t.Errorf("Expected a limit above capacity not to change the ramp, got good=%v bad=%v", r.Good, r.Bad)
+	}
+}
@@ -0,0 +1,447 @@
+package api
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/smtp"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Alerts: a schedule with an alert checks every result against thresholds and
+// notifies once the schedule breaches them for several runs in a row, then
+// once more when it is back within them. A firing alert is not notified again
+// while it keeps firing. Notices go through the webhook delivery queue, so
+// they are retried, listed and dead-lettered like result webhooks.
+const (
+	ALERT_EVENT_FIRING   = "alert.firing"
+	ALERT_EVENT_RESOLVED = "alert.resolved"
+
+	ALERT_STATE_OK     = "ok"
+	ALERT_STATE_FIRING = "firing"
+
+	ALERT_NOTIFY_WEBHOOK = "webhook" // JSON AlertPayload, signed like result webhooks
+	ALERT_NOTIFY_SLACK   = "slack"   // Slack-compatible incoming webhook: {"text": ...}
+	ALERT_NOTIFY_EMAIL   = "email"   // Plain-text mail through ALERT_SMTP_ADDR
+
+	DEFAULT_ALERT_CONSECUTIVE   = 3
+	DEFAULT_ALERT_RECOVER_AFTER = 1
+	MAX_ALERT_RUNS              = 100
+	MAX_ALERT_THRESHOLDS        = 20
+	MAX_ALERT_NOTIFY            = 10
+)
+
+// AlertThreshold bounds one metric of a result; either bound or both can be set
+type AlertThreshold struct {
+	Metric string   `json:"metric"`          // Path as result diffs compare it, e.g. rtt_avg_ms
+	Above  *float64 `json:"above,omitempty"` // Breached by values above this
+	Below  *float64 `json:"below,omitempty"` // Breached by values below this
+}
+
+// AlertNotify is where notices of an alert go
+type AlertNotify struct {
+	Type string   `json:"type"`          // webhook, slack or email
+	URL  string   `json:"url,omitempty"` // Of webhook and slack
+	To   []string `json:"to,omitempty"`  // Recipients of email
+}
+
+// Alert is the alert configuration of a schedule
+type Alert struct {
+	Thresholds     []AlertThreshold `json:"thresholds"`
+	Consecutive    int              `json:"consecutive"`     // Breaching runs in a row that fire the alert
+	RecoverAfter   int              `json:"recover_after"`   // Runs in a row within thresholds that resolve it
+	IgnoreFailures bool             `json:"ignore_failures"` // Leave failed runs out instead of counting them as breaches
+	Notify         []AlertNotify    `json:"notify"`
+}
+
+// AlertBreach is a threshold one run breached, or its error
+type AlertBreach struct {
+	Metric string   `json:"metric,omitempty"`
+	Value  *float64 `json:"value,omitempty"`
+	Above  *float64 `json:"above,omitempty"`
+	Below  *float64 `json:"below,omitempty"`
+	Error  string   `json:"error,omitempty"` // The run failed
+}
+
+// AlertState is where a schedule's alert stands
+type AlertState struct {
+	State         string        `json:"state"`           // ok or firing
+	Since         *time.Time    `json:"since,omitempty"` // Firing since
+	Breaching     int           `json:"breaching_runs"`  // Runs in a row that breached a threshold
+	Recovered     int           `json:"recovered_runs"`  // Runs in a row within thresholds while firing
+	LastBreaches  []AlertBreach `json:"last_breaches,omitempty"`
+	Notifications int           `json:"notifications"` // Firing and resolved notices sent
+}
+
+// AlertNotice is the firing or resolved notice of an alert
+type AlertNotice struct {
+	Event      string        `json:"-"`
+	ScheduleID string        `json:"schedule_id"`
+	Type       string        `json:"type"`
+	Target     string        `json:"target"`
+	State      string        `json:"state"` // firing or ok
+	Since      time.Time     `json:"since"` // When the alert fired
+	ResolvedAt *time.Time    `json:"resolved_at,omitempty"`
+	Runs       int           `json:"runs"`               // Runs in a row that fired or resolved it
+	Breaches   []AlertBreach `json:"breaches,omitempty"` // Of the last breaching run
+	ResultID   string        `json:"result_id,omitempty"`
+}
+
+// AlertPayload is the JSON body POSTed to webhook notify targets
+type AlertPayload struct {
+	Event      string       `json:"event"`
+	DeliveryID string       `json:"delivery_id"`
+	Alert      *AlertNotice `json:"alert"`
+}
+
+// alertSMTP holds the ALERT_SMTP_* settings of email notices
+type alertSMTP struct {
+	addr, from, username, password string
+}
+
+var alertMail alertSMTP
+
+// loadAlertSMTP reads ALERT_SMTP_ADDR, ALERT_SMTP_FROM, ALERT_SMTP_USERNAME and ALERT_SMTP_PASSWORD
+func loadAlertSMTP(getenv func(string) string) (alertSMTP, error) {
+	cfg := alertSMTP{addr: getenv("ALERT_SMTP_ADDR"), from: getenv("ALERT_SMTP_FROM"), username: getenv("ALERT_SMTP_USERNAME"), password: getenv("ALERT_SMTP_PASSWORD")}
+	if cfg.addr == "" {
+		return cfg, nil
+	}
+	if _, _, err := net.SplitHostPort(cfg.addr); err != nil {
+		return cfg, fmt.Errorf("invalid ALERT_SMTP_ADDR %q (expected host:port)", cfg.addr)
+	}
+	if _, err := mail.ParseAddress(cfg.from); err != nil {
+		return cfg, fmt.Errorf("invalid ALERT_SMTP_FROM %q (expected the sender address of alert mail)", cfg.from)
+	}
+	return cfg, nil
+}
+
+// configureAlerts applies ALERT_SMTP_* settings at startup
+func configureAlerts() {
+	cfg, err := loadAlertSMTP(os.Getenv)
+	if err != nil {
+		log.Fatalf("Alert configuration failed: %v", err)
+	}
+	alertMail = cfg
+}
+
+// validateAlert checks an alert of a schedule of testType and fills in its defaults
+func validateAlert(testType string, a *Alert) error {
+	v := &requestValidator{}
+	metrics := make(map[string]bool)
+	var known []string
+	for _, m := range resultMetrics[testType] {
+		metrics[m.Path] = true
+		known = append(known, m.Path)
+	}
+	switch {
+	case len(a.Thresholds) == 0:
+		v.fail("alert.thresholds", nil, "is required")
+	case len(a.Thresholds) > MAX_ALERT_THRESHOLDS:
+		v.fail("alert.thresholds", nil, "must list at most %d thresholds", MAX_ALERT_THRESHOLDS)
+	}
+	for i, t := range a.Thresholds {
+		field := fmt.Sprintf("alert.thresholds[%d]", i)
+		if !metrics[t.Metric] {
+			v.fail(field+".metric", t.Metric, "must be a metric of %s results: %s", testType, strings.Join(known, ", "))
+		}
+		if t.Above == nil && t.Below == nil {
+			v.fail(field, nil, "must set above, below or both")
+		}
+	}
+	if a.Consecutive == 0 {
+		a.Consecutive = DEFAULT_ALERT_CONSECUTIVE
+	}
+	if a.RecoverAfter == 0 {
+		a.RecoverAfter = DEFAULT_ALERT_RECOVER_AFTER
+	}
+	v.between("alert.consecutive", int64(a.Consecutive), 1, MAX_ALERT_RUNS, " runs")
+	v.between("alert.recover_after", int64(a.RecoverAfter), 1, MAX_ALERT_RUNS, " runs")
+
+	switch {
+	case len(a.Notify) == 0:
+		v.fail("alert.notify", nil, "is required")
+	case len(a.Notify) > MAX_ALERT_NOTIFY:
+		v.fail("alert.notify", nil, "must list at most %d targets", MAX_ALERT_NOTIFY)
+	}
+	for i := range a.Notify {
+		n := &a.Notify[i]
+		field := fmt.Sprintf("alert.notify[%d]", i)
+		n.Type = strings.ToLower(n.Type)
+		switch n.Type {
+		case ALERT_NOTIFY_WEBHOOK, ALERT_NOTIFY_SLACK:
+			if u, err := url.Parse(n.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				v.fail(field+".url", n.URL, "must be an absolute http or https URL")
+			}
+		case ALERT_NOTIFY_EMAIL:
+			if alertMail.addr == "" {
+				v.fail(field+".type", n.Type, "needs ALERT_SMTP_ADDR")
+			}
+			if len(n.To) == 0 {
+				v.fail(field+".to", nil, "is required")
+			}
+			for j, to := range n.To {
+				if _, err := mail.ParseAddress(to); err != nil {
+					v.fail(fmt.Sprintf("%s.to[%d]", field, j), to, "is not a mail address")
+				}
+			}
+		default:
+			v.fail(field+".type", n.Type, "must be %s, %s or %s", ALERT_NOTIFY_WEBHOOK, ALERT_NOTIFY_SLACK, ALERT_NOTIFY_EMAIL)
+		}
+	}
+	if len(v.fields) == 0 {
+		return nil
+	}
+	return &codedError{ERR_VALIDATION, &ValidationError{Fields: v.fields}}
+}
+
+// breaches checks a run's metrics, or its error, against the thresholds. A
+// metric the result does not have breaches nothing. ok is false for a run the
+// alert leaves out: a failure with ignore_failures.
+func (a *Alert) breaches(metrics map[string]float64, runErr error) (breaches []AlertBreach, ok bool) {
+	if runErr != nil {
+		if a.IgnoreFailures {
+			return nil, false
+		}
+		return []AlertBreach{{Error: runErr.Error()}}, true
+	}
+	for _, t := range a.Thresholds {
+		v, found := metrics[t.Metric]
+		if !found {
+			continue
+		}
+		if (t.Above != nil && v > *t.Above) || (t.Below != nil && v < *t.Below) {
+			breaches = append(breaches, AlertBreach{Metric: t.Metric, Value: &v, Above: t.Above, Below: t.Below})
+		}
+	}
+	return breaches, true
+}
+
+// observe counts one evaluated run and returns the event it triggers, or "":
+// firing once Consecutive runs in a row breached, resolved once RecoverAfter
+// runs in a row did not
+func (a *Alert) observe(st *AlertState, breaches []AlertBreach, now time.Time) string {
+	if len(breaches) > 0 {
+		st.Breaching++
+		st.Recovered = 0
+		st.LastBreaches = breaches
+		if st.State != ALERT_STATE_FIRING && st.Breaching >= a.Consecutive {
+			st.State = ALERT_STATE_FIRING
+			st.Since = &now
+			return ALERT_EVENT_FIRING
+		}
+		return ""
+	}
+	st.Breaching = 0
+	if st.State != ALERT_STATE_FIRING {
+		return ""
+	}
+	if st.Recovered++; st.Recovered < a.RecoverAfter {
+		return ""
+	}
+	st.State = ALERT_STATE_OK
+	st.Since = nil
+	st.Recovered = 0
+	return ALERT_EVENT_RESOLVED
+}
+
+// checkAlert evaluates the outcome of a run against the schedule's alert and
+// returns the notice to send, if any. Called with the store lock held.
+func (s *Schedule) checkAlert(data map[string]interface{}, runErr error) *AlertNotice {
+	if s.Alert == nil {
+		return nil
+	}
+	var metrics map[string]float64
+	resultID, _ := data["id"].(string)
+	if runErr == nil {
+		stored, ok := resultStore.Get(resultID)
+		if !ok {
+			return nil // Not stored: nothing to check
+		}
+		metrics = summarizeResult(stored).Metrics
+	}
+	breaches, ok := s.Alert.breaches(metrics, runErr)
+	if !ok {
+		return nil
+	}
+	st := s.AlertState
+	since := st.Since
+	now := time.Now().UTC()
+	event := s.Alert.observe(st, breaches, now)
+	if event == "" {
+		return nil
+	}
+	st.Notifications++
+	n := &AlertNotice{
+		Event:      event,
+		ScheduleID: s.ID,
+		Type:       s.Type,
+		Target:     s.Target,
+		State:      st.State,
+		Breaches:   st.LastBreaches,
+		ResultID:   resultID,
+	}
+	if event == ALERT_EVENT_FIRING {
+		n.Since, n.Runs = now, st.Breaching
+	} else {
+		n.Since, n.ResolvedAt, n.Runs = *since, &now, s.Alert.RecoverAfter
+	}
+	return n
+}
+
+// summary is the one-line text of a notice, for Slack and mail
+func (n *AlertNotice) summary() string {
+	subject := fmt.Sprintf("%s test of %s (schedule %s)", n.Type, n.Target, n.ScheduleID)
+	runs := fmt.Sprintf("%d runs", n.Runs)
+	if n.Runs == 1 {
+		runs = "1 run"
+	}
+	if n.Event == ALERT_EVENT_RESOLVED {
+		return fmt.Sprintf("[RESOLVED] %s: within thresholds for %s, after firing since %s", subject, runs, n.Since.Format(time.RFC3339))
+	}
+	var reasons []string
+	for _, b := range n.Breaches {
+		switch {
+		case b.Error != "":
+			reasons = append(reasons, "run failed: "+b.Error)
+		case b.Above != nil && *b.Value > *b.Above:
+			reasons = append(reasons, fmt.Sprintf("%s %.4g above %g", b.Metric, *b.Value, *b.Above))
+		default:
+			reasons = append(reasons, fmt.Sprintf("%s %.4g below %g", b.Metric, *b.Value, *b.Below))
+		}
+	}
+	return fmt.Sprintf("[FIRING] %s: %s, %s in a row", subject, strings.Join(reasons, ", "), runs)
+}
+
+// notifyAlert queues a notice to every notify target of an alert
+func notifyAlert(a *Alert, n *AlertNotice) {
+	log.Printf("Schedule %s alert %s", n.ScheduleID, n.State)
+	for _, target := range a.Notify {
+		d := &Delivery{URL: target.URL, Event: n.Event, ResultID: n.ResultID, ScheduleID: n.ScheduleID}
+		var payload func(*Delivery) ([]byte, error)
+		switch target.Type {
+		case ALERT_NOTIFY_WEBHOOK:
+			payload = func(d *Delivery) ([]byte, error) {
+				return json.Marshal(AlertPayload{Event: d.Event, DeliveryID: d.ID, Alert: n})
+			}
+		case ALERT_NOTIFY_SLACK:
+			payload = func(*Delivery) ([]byte, error) {
+				return json.Marshal(map[string]string{"text": n.summary()})
+			}
+		case ALERT_NOTIFY_EMAIL:
+			d.URL = "mailto:" + strings.Join(target.To, ",")
+			payload = func(d *Delivery) ([]byte, error) {
+				return alertMessage(alertMail.from, target.To, d.ID, n), nil
+			}
+		}
+		if _, err := deliveryStore.enqueue(d, payload); err != nil {
+			log.Printf("Alert of schedule %s not queued to %s: %v", n.ScheduleID, d.URL, err)
+		}
+	}
+}
+
+// alertMessage is the mail of a notice, with the summary as its subject
+func alertMessage(from string, to []string, deliveryID string, n *AlertNotice) []byte {
+	body, _ := json.MarshalIndent(n, "", "  ")
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&b, "Subject: %s\r\n", n.summary())
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().UTC().Format(time.RFC1123Z))
+	fmt.Fprintf(&b, "Message-ID: <%s@network-test-api>\r\n", deliveryID)
+	b.WriteString("MIME-Version: 1.0\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n")
+	b.WriteString(n.summary() + "\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(string(body), "\n", "\r\n") + "\r\n")
+	return []byte(b.String())
+}
+
+// mailAttempt sends a mailto: delivery through ALERT_SMTP_ADDR, with STARTTLS
+// when the server offers it, within WEBHOOK_TIMEOUT
+func mailAttempt(d *Delivery) DeliveryAttempt {
+	attempt := DeliveryAttempt{At: time.Now().UTC()}
+	err := sendMail(alertMail, strings.Split(strings.TrimPrefix(d.URL, "mailto:"), ","), d.payload)
+	attempt.DurationMs = float64(time.Since(attempt.At).Microseconds()) / 1000
+	if err != nil {
+		attempt.Error = err.Error()
+	}
+	return attempt
+}
+
+func sendMail(cfg alertSMTP, to []string, msg []byte) error {
+	conn, err := checkedDialContext(webhookConfig.Timeout)(context.Background(), "tcp", cfg.addr)
+	if err != nil {
+		return err
+	}
+	_ = conn.SetDeadline(time.Now().Add(webhookConfig.Timeout))
+	host, _, _ := net.SplitHostPort(cfg.addr)
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		_ = conn.Close()
+		return err
+	}
+	defer func() { _ = c.Close() }()
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if cfg.username != "" {
+		if err := c.Auth(smtp.PlainAuth("", cfg.username, cfg.password, host)); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(cfg.from); err != nil {
+		return err
+	}
+	for _, rcpt := range to {
+		if err := c.Rcpt(rcpt); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+func alertList(w http.ResponseWriter, r *http.Request) {
+	state := strings.ToLower(r.URL.Query().Get("state"))
+	switch state {
+	case "", ALERT_STATE_OK, ALERT_STATE_FIRING:
+	default:
+		jsonResponse(w, ApiResponse{
+			Status: "error",
+			Error:  fmt.Sprintf("invalid state %q (expected ok or firing)", state),
+		}, http.StatusBadRequest)
+		return
+	}
+	list := []*Schedule{}
+	for _, s := range scheduleStore.List() {
+		if s.Alert != nil && (state == "" || s.AlertState.State == state) {
+			list = append(list, s)
+		}
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].AlertState.State == ALERT_STATE_FIRING && list[j].AlertState.State != ALERT_STATE_FIRING
+	})
+	jsonResponse(w, ApiResponse{
+		Status: "ok",
+		Data:   list,
+	}, http.StatusOK)
+}
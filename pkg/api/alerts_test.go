@@ -0,0 +1,74 @@
+package api
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func float(v float64) *float64 {
+	return &v
+}
+
+func TestAlertBreaches(t *testing.T) {
+	a := &Alert{Thresholds: []AlertThreshold{
+		{Metric: "loss_percent", Above: float(1)},
+		{Metric: "bandwidth_mbps", Below: float(100), Above: float(1000)},
+		{Metric: "jitter_ms", Above: float(5)},
+	}}
+	breaches, ok := a.breaches(map[string]float64{"loss_percent": 4.2, "bandwidth_mbps": 80, "jitter_ms": 5}, nil)
+	if !ok || len(breaches) != 2 {
+		t.Fatalf("Expected loss and bandwidth breached, got %+v", breaches)
+	}
+	if breaches[0].Metric != "loss_percent" || *breaches[0].Value != 4.2 || breaches[1].Metric != "bandwidth_mbps" {
+		t.Errorf("Unexpected breaches %+v", breaches)
+	}
+
+	// A metric the result lacks breaches nothing
+	if breaches, _ := a.breaches(map[string]float64{}, nil); len(breaches) != 0 {
+		t.Errorf("Expected no breaches without metrics, got %+v", breaches)
+	}
+
+	// A failed run breaches the alert unless failures are ignored
+	if breaches, ok := a.breaches(nil, errors.New("connection refused")); !ok || len(breaches) != 1 || breaches[0].Error != "connection refused" {
+		t.Errorf("Expected the failure as a breach, got %+v", breaches)
+	}
+	a.IgnoreFailures = true
+	if _, ok := a.breaches(nil, errors.New("connection refused")); ok {
+		t.Error("Expected an ignored failure to be left out")
+	}
+}
+
+func TestAlertFiresAfterConsecutiveBreaches(t *testing.T) {
+	a := &Alert{Consecutive: 3, RecoverAfter: 2}
+	st := &AlertState{State: ALERT_STATE_OK}
+	now := time.Date(2026, 1, 15, 10, 0, 0, 0, time.UTC)
+	breach := []AlertBreach{{Metric: "loss_percent", Value: float(4)}}
+
+	// Breaches that do not last long enough reset
+	for _, runs := range [][]AlertBreach{breach, breach, nil, breach, breach} {
+		if event := a.observe(st, runs, now); event != "" {
+			t.Fatalf("Expected no event yet, got %s", event)
+		}
+	}
+	if event := a.observe(st, breach, now); event != ALERT_EVENT_FIRING || st.Since == nil {
+		t.Fatalf("Expected the alert to fire on the third breach in a row, got %q", event)
+	}
+
+	// A firing alert is not notified again while it keeps breaching
+	if event := a.observe(st, breach, now); event != "" {
+		t.Errorf("Expected no second firing notice, got %s", event)
+	}
+
+	// It resolves after recover_after runs within the thresholds, as a row
+	if event := a.observe(st, nil, now); event != "" {
+		t.Errorf("Expected no event after one good run, got %s", event)
+	}
+	if event := a.observe(st, breach, now); event != "" || st.Recovered != 0 {
+		t.Errorf("Expected a breach to restart the recovery, got %q (%d)", event, st.Recovered)
+	}
+	a.observe(st, nil, now)
+	if event := a.observe(st, nil, now); event != ALERT_EVENT_RESOLVED || st.State != ALERT_STATE_OK || st.Since != nil {
+		t.Errorf("Expected the alert to resolve, got %q in %+v", event, st)
+	}
+}
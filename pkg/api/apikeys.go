@@ -0,0 +1,273 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// API keys from API_KEYS_FILE and API_KEYS. Once any is configured, every
+// endpoint but the public ones requires an X-API-Key header, and each key's
+// requests, tests and bandwidth are limited as configured.
+const (
+	API_KEY_HEADER = "X-API-Key"
+
+	ERR_RATE_LIMITED   = "ERR_RATE_LIMITED"
+	ERR_QUOTA_EXCEEDED = "ERR_QUOTA_EXCEEDED"
+
+	API_KEY_QUOTA_WINDOW = time.Hour // Of tests_per_hour
+)
+
+// publicPaths answer without a key: health checks and the documentation
+var publicPaths = map[string]bool{"/health": true, "/": true, "/openapi.json": true}
+
+// APIKey is a client's key and its limits; zero limits are unlimited
+type APIKey struct {
+	Key               string `json:"key"`
+	RequestsPerMinute int    `json:"requests_per_minute,omitempty"` // Of any endpoint, with bursts of as many
+	TestsPerHour      int    `json:"tests_per_hour,omitempty"`      // Client runs and scheduled runs started
+	MaxBandwidth      int    `json:"max_bandwidth,omitempty"`       // Mbit/s of iperf3 and TWAMP available mode tests
+
+	name     string
+	mu       sync.Mutex
+	tokens   float64     // Requests left in the bucket
+	refilled time.Time   // Last update of tokens
+	tests    []time.Time // Test starts within API_KEY_QUOTA_WINDOW, oldest first
+}
+
+// APIKeyStore holds the configured keys by name
+type APIKeyStore struct {
+	Keys map[string]*APIKey `json:"keys"`
+
+	byHash      map[[sha256.Size]byte]*APIKey
+	localBypass bool // Requests from loopback addresses need no key
+}
+
+var apiKeys = &APIKeyStore{Keys: map[string]*APIKey{}, localBypass: true}
+
+// loadAPIKeys reads a keys file of the form {"keys": {"name": {"key": "...", "tests_per_hour": 100}}}
+func loadAPIKeys(file string) (*APIKeyStore, error) {
+	info, err := os.Stat(file)
+	if err != nil {
+		return nil, err
+	}
+	if info.Mode().Perm()&0o077 != 0 {
+		warnf(nil, "API keys file %s is accessible by other users (mode %v)", file, info.Mode().Perm())
+	}
+	raw, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	store := &APIKeyStore{}
+	if err := json.Unmarshal(raw, store); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", file, err)
+	}
+	if store.Keys == nil {
+		store.Keys = map[string]*APIKey{}
+	}
+	return store, nil
+}
+
+// add registers the key under name, checking its limits
+func (s *APIKeyStore) add(name string, k *APIKey) error {
+	switch {
+	case k.Key == "":
+		return fmt.Errorf("API key %q has no key", name)
+	case k.RequestsPerMinute < 0 || k.TestsPerHour < 0 || k.MaxBandwidth < 0:
+		return fmt.Errorf("API key %q has a negative limit", name)
+	}
+	if s.byHash == nil {
+		s.byHash = make(map[[sha256.Size]byte]*APIKey)
+	}
+	hash := sha256.Sum256([]byte(k.Key))
+	if other, ok := s.byHash[hash]; ok {
+		return fmt.Errorf("API keys %q and %q are the same key", other.name, name)
+	}
+	k.name = name
+	k.tokens = float64(k.RequestsPerMinute)
+	s.Keys[name] = k
+	s.byHash[hash] = k
+	return nil
+}
+
+// enabled reports whether requests need a key
+func (s *APIKeyStore) enabled() bool {
+	return len(s.byHash) > 0
+}
+
+// lookup finds a key by its value. Keys are compared by their SHA-256, so the
+// lookup takes no longer for a nearly right key.
+func (s *APIKeyStore) lookup(key string) *APIKey {
+	if key == "" {
+		return nil
+	}
+	return s.byHash[sha256.Sum256([]byte(key))]
+}
+
+// configureAPIKeys loads API_KEYS_FILE and the name=key pairs of API_KEYS, if set
+func configureAPIKeys() {
+	store := &APIKeyStore{Keys: map[string]*APIKey{}, localBypass: true}
+	if file := os.Getenv("API_KEYS_FILE"); file != "" {
+		loaded, err := loadAPIKeys(file)
+		if err != nil {
+			log.Fatalf("Loading API keys failed: %v", err)
+		}
+		for name, k := range loaded.Keys {
+			if err := store.add(name, k); err != nil {
+				log.Fatalf("Loading API keys failed: %v", err)
+			}
+		}
+	}
+	for _, entry := range strings.Split(os.Getenv("API_KEYS"), ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		name, key, ok := strings.Cut(entry, "=")
+		if !ok || name == "" {
+			log.Fatalf("Invalid API_KEYS entry %q (expected name=key)", entry)
+		}
+		if _, exists := store.Keys[name]; exists {
+			log.Fatalf("API key %q is set in both API_KEYS_FILE and API_KEYS", name)
+		}
+		if err := store.add(name, &APIKey{Key: key}); err != nil {
+			log.Fatalf("Invalid API_KEYS: %v", err)
+		}
+	}
+	if v := os.Getenv("API_KEYS_LOCAL_BYPASS"); v != "" {
+		bypass, err := strconv.ParseBool(v)
+		if err != nil {
+			log.Fatalf("Invalid API_KEYS_LOCAL_BYPASS %q (expected true or false)", v)
+		}
+		store.localBypass = bypass
+	}
+	apiKeys = store
+	if store.enabled() {
+		log.Printf("Requests need one of %d API keys in %s", len(store.Keys), API_KEY_HEADER)
+	}
+}
+
+// Name is the key's name in API_KEYS_FILE or API_KEYS, empty without a key
+func (k *APIKey) Name() string {
+	if k == nil {
+		return ""
+	}
+	return k.name
+}
+
+// allow takes a request from the key's bucket, which refills at
+// requests_per_minute; when empty it returns how long until the next one
+func (k *APIKey) allow(now time.Time) (time.Duration, bool) {
+	if k == nil || k.RequestsPerMinute == 0 {
+		return 0, true
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	rate := float64(k.RequestsPerMinute) / 60 // Per second
+	if !k.refilled.IsZero() {
+		k.tokens = math.Min(float64(k.RequestsPerMinute), k.tokens+now.Sub(k.refilled).Seconds()*rate)
+	}
+	k.refilled = now
+	if k.tokens < 1 {
+		return time.Duration((1 - k.tokens) / rate * float64(time.Second)), false
+	}
+	k.tokens--
+	return 0, true
+}
+
+// takeTest counts a test start against tests_per_hour, failing with
+// ERR_QUOTA_EXCEEDED once the last hour has used them all
+func (k *APIKey) takeTest(now time.Time) error {
+	if k == nil || k.TestsPerHour == 0 {
+		return nil
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	expired := 0
+	for expired < len(k.tests) && now.Sub(k.tests[expired]) >= API_KEY_QUOTA_WINDOW {
+		expired++
+	}
+	k.tests = k.tests[expired:]
+	if len(k.tests) >= k.TestsPerHour {
+		retry := k.tests[0].Add(API_KEY_QUOTA_WINDOW).Sub(now)
+		return &codedError{ERR_QUOTA_EXCEEDED, fmt.Errorf("API key %s used its %d tests per hour; the next one is available in %s", k.name, k.TestsPerHour, retry.Round(time.Second))}
+	}
+	k.tests = append(k.tests, now)
+	return nil
+}
+
+// maxBandwidth is the key's max_bandwidth, 0 when unlimited
+func (k *APIKey) maxBandwidth() int {
+	if k == nil {
+		return 0
+	}
+	return k.MaxBandwidth
+}
+
+// checkLimits checks a request against the key's max_bandwidth
+func (k *APIKey) checkLimits(req RunRequest) error {
+	if max := k.maxBandwidth(); max == 0 || !req.Bandwidth.exceeds(max) {
+		return nil
+	}
+	return fmt.Errorf("bandwidth %s exceeds API key %s limit of %d", req.Bandwidth, k.name, k.MaxBandwidth)
+}
+
+type apiKeyContextKey struct{}
+
+// apiKeyFrom returns the key a request was authenticated with, nil for
+// public and local requests or without keys
+func apiKeyFrom(r *http.Request) *APIKey {
+	k, _ := r.Context().Value(apiKeyContextKey{}).(*APIKey)
+	return k
+}
+
+// isLocalRequest reports whether a request comes from a loopback address
+func isLocalRequest(r *http.Request) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// apiKeyAuth requires a configured API key on every route but publicPaths
+// and, unless API_KEYS_LOCAL_BYPASS=false, local requests, and applies its
+// requests_per_minute
+func apiKeyAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		store := apiKeys
+		if !store.enabled() || publicPaths[unversionedPath(r.URL.Path)] || (store.localBypass && isLocalRequest(r)) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		k := store.lookup(r.Header.Get(API_KEY_HEADER))
+		if k == nil {
+			w.Header().Set("WWW-Authenticate", `APIKey header="`+API_KEY_HEADER+`"`)
+			jsonResponse(w, ApiResponse{
+				Status: "error",
+				Error:  "invalid or missing API key (send it in " + API_KEY_HEADER + ")",
+			}, http.StatusUnauthorized)
+			return
+		}
+		if wait, ok := k.allow(time.Now()); !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			jsonResponse(w, ApiResponse{
+				Status: "error",
+				Error:  fmt.Sprintf("API key %s is limited to %d requests per minute", k.name, k.RequestsPerMinute),
+				Code:   ERR_RATE_LIMITED,
+			}, http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apiKeyContextKey{}, k)))
+	})
+}
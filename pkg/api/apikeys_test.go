@@ -0,0 +1,76 @@
+package api
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAPIKeyAllow(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	k := &APIKey{RequestsPerMinute: 3, tokens: 3}
+
+	// A full bucket allows a burst of requests_per_minute
+	for i := 0; i < 3; i++ {
+		if _, ok := k.allow(start); !ok {
+			t.Fatalf("expected request %d of the burst to be allowed", i+1)
+		}
+	}
+	wait, ok := k.allow(start)
+	if ok {
+		t.Fatal("expected the fourth request to be limited")
+	}
+	if wait != 20*time.Second {
+		t.Errorf("expected a wait of 20s at 3 requests per minute, got %v", wait)
+	}
+
+	if _, ok := k.allow(start.Add(20 * time.Second)); !ok {
+		t.Error("expected a request to be allowed once a token refilled")
+	}
+
+	// The bucket never holds more than requests_per_minute
+	later := start.Add(time.Hour)
+	for i := 0; i < 3; i++ {
+		k.allow(later)
+	}
+	if _, ok := k.allow(later); ok {
+		t.Error("expected the bucket to refill to at most 3 requests")
+	}
+
+	unlimited := &APIKey{}
+	for i := 0; i < 1000; i++ {
+		if _, ok := unlimited.allow(start); !ok {
+			t.Fatal("expected a key without requests_per_minute to be unlimited")
+		}
+	}
+}
+
+func TestAPIKeyTakeTest(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	k := &APIKey{TestsPerHour: 2, name: "ci"}
+
+	if err := k.takeTest(start); err != nil {
+		t.Fatalf("expected the first test to be allowed, got %v", err)
+	}
+	if err := k.takeTest(start.Add(10 * time.Minute)); err != nil {
+		t.Fatalf("expected the second test to be allowed, got %v", err)
+	}
+	err := k.takeTest(start.Add(30 * time.Minute))
+	if errorCode(err) != ERR_QUOTA_EXCEEDED {
+		t.Fatalf("expected the third test within the hour to exceed the quota, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "available in 30m0s") {
+		t.Errorf("expected the next test in 30m, when the first leaves the window, got %v", err)
+	}
+	if len(k.tests) != 2 {
+		t.Errorf("expected a refused test not to count, got %d tests", len(k.tests))
+	}
+
+	// The window slides: an hour after the first test, one more is available
+	if err := k.takeTest(start.Add(time.Hour)); err != nil {
+		t.Errorf("expected a test once the first left the window, got %v", err)
+	}
+	if err := k.takeTest(start.Add(time.Hour + time.Minute)); err == nil {
+		t.Error("expected the quota to be used up again")
+	}
+}
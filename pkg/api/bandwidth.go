@@ -0,0 +1,102 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Bandwidth is a request's rate in Mbit/s: a number, or a string with a K, M
+// or G suffix like iperf3 -b, e.g. "500K" or "2.5M". Set tells an explicit 0,
+// no limit for TCP iperf3 tests, from none.
+type Bandwidth struct {
+	Mbps float64
+	Set  bool
+}
+
+// Multipliers from the suffixes of a bandwidth string to Mbit/s
+var bandwidthUnits = map[byte]float64{'k': 1e-3, 'm': 1, 'g': 1e3}
+
+// parseBandwidth reads a bandwidth string; without a suffix it is in Mbit/s,
+// like the number form
+func parseBandwidth(s string) (float64, error) {
+	number, unit := strings.TrimSpace(s), 1.0
+	if number != "" {
+		if u, ok := bandwidthUnits[number[len(number)-1]|0x20]; ok {
+			number, unit = number[:len(number)-1], u
+		}
+	}
+	n, err := strconv.ParseFloat(number, 64)
+	if err != nil || math.IsNaN(n) || math.IsInf(n, 0) {
+		return 0, fmt.Errorf("%q is not Mbit/s or a rate such as 500K or 2.5M", s)
+	}
+	return n * unit, nil
+}
+
+// mbps is a bandwidth set to a whole number of Mbit/s
+func mbps(n int) Bandwidth {
+	return Bandwidth{Mbps: float64(n), Set: true}
+}
+
+func (b *Bandwidth) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		*b = Bandwidth{}
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		if err := json.Unmarshal(data, &b.Mbps); err != nil {
+			return fmt.Errorf("must be a number or a string such as 2.5M")
+		}
+		b.Set = true
+		return nil
+	}
+	n, err := parseBandwidth(s)
+	if err != nil {
+		return err
+	}
+	*b = Bandwidth{Mbps: n, Set: true}
+	return nil
+}
+
+// MarshalJSON writes Mbit/s, or null when not set so a stored request keeps
+// its default
+func (b Bandwidth) MarshalJSON() ([]byte, error) {
+	if !b.Set {
+		return []byte("null"), nil
+	}
+	return json.Marshal(b.Mbps)
+}
+
+func (b Bandwidth) String() string {
+	if b.unlimited() {
+		return "unlimited"
+	}
+	return strconv.FormatFloat(b.Mbps, 'g', -1, 64) + "M"
+}
+
+// unlimited reports an explicit bandwidth of 0
+func (b Bandwidth) unlimited() bool {
+	return b.Set && b.Mbps == 0
+}
+
+// bps is the bandwidth in bits per second
+func (b Bandwidth) bps() int64 {
+	return int64(math.Round(b.Mbps * 1e6))
+}
+
+// exceeds reports whether the bandwidth is above a limit in Mbit/s; no limit
+// is above any
+func (b Bandwidth) exceeds(max int) bool {
+	return b.unlimited() || b.Mbps > float64(max)
+}
+
+// iperf3Bandwidth checks the bandwidth of an iperf3 request: no limit only
+// for TCP, where nothing is paced
+func (v *requestValidator) iperf3Bandwidth(req RunRequest) {
+	if req.Bandwidth.unlimited() && !strings.EqualFold(req.Protocol, "TCP") {
+		v.fail("bandwidth", req.Bandwidth, "0 (unlimited) requires protocol TCP")
+	}
+}
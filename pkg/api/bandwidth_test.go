@@ -0,0 +1,50 @@
+package api
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+)
+
+func TestParseBandwidth(t *testing.T) {
+	for s, want := range map[string]float64{"2.5M": 2.5, "500K": 0.5, "500k": 0.5, "1G": 1000, "40": 40, " 10m ": 10, "0": 0} {
+		if got, err := parseBandwidth(s); err != nil || math.Abs(got-want) > 1e-12 {
+			t.Errorf("parseBandwidth(%q) = %v, %v, want %v", s, got, err, want)
+		}
+	}
+	for _, s := range []string{"", "M", "fast", "2.5T", "NaN", "Inf"} {
+		if _, err := parseBandwidth(s); err == nil {
+			t.Errorf("Expected %q to be rejected", s)
+		}
+	}
+}
+
+func TestBandwidthUnmarshal(t *testing.T) {
+	var req struct {
+		Bandwidth Bandwidth `json:"bandwidth"`
+	}
+	for body, want := range map[string]Bandwidth{
+		`{}`:                    {},
+		`{"bandwidth": null}`:   {},
+		`{"bandwidth": 0}`:      {0, true},
+		`{"bandwidth": 2.5}`:    {2.5, true},
+		`{"bandwidth": "500K"}`: {0.5, true},
+	} {
+		req.Bandwidth = Bandwidth{}
+		if err := json.Unmarshal([]byte(body), &req); err != nil || req.Bandwidth != want {
+			t.Errorf("%s: got %+v, %v, want %+v", body, req.Bandwidth, err, want)
+		}
+	}
+	if err := json.Unmarshal([]byte(`{"bandwidth": true}`), &req); err == nil {
+		t.Error("Expected a boolean bandwidth to be rejected")
+	}
+}
+
+func TestBandwidthExceeds(t *testing.T) {
+	if (Bandwidth{}).unlimited() || !(Bandwidth{Set: true}).unlimited() {
+		t.Error("Expected only an explicit 0 to be unlimited")
+	}
+	if !(Bandwidth{Set: true}).exceeds(100) || (Bandwidth{99.5, true}).exceeds(100) || !(Bandwidth{100.5, true}).exceeds(100) {
+		t.Error("Expected unlimited and 100.5 Mbit/s, not 99.5, to exceed 100")
+	}
+}
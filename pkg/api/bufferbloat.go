@@ -0,0 +1,604 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	mathrand "math/rand"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tcaine/twamp"
+
+	"network-test-api/pkg/nettest"
+	"network-test-api/pkg/stats"
+)
+
+// Bufferbloat tests (latency under load): one stream of TWAMP or ping probes
+// runs through the whole test, first without load for the idle baseline, then
+// while iperf3 saturates the link towards server_host in each direction. The
+// rise of the median RTT under load over the idle one grades the queueing the
+// load causes along the path.
+const (
+	BUFFERBLOAT_PROBE_TWAMP = "twamp"
+	BUFFERBLOAT_PROBE_PING  = "ping"
+
+	DEFAULT_BUFFERBLOAT_DURATION  = 10 // Seconds of load per direction
+	MIN_BUFFERBLOAT_DURATION      = 5
+	MAX_BUFFERBLOAT_DURATION      = 60
+	DEFAULT_BUFFERBLOAT_IDLE      = 5 // Seconds of probes before the first load
+	MAX_BUFFERBLOAT_IDLE          = 30
+	DEFAULT_BUFFERBLOAT_PARALLEL  = 4
+	DEFAULT_BUFFERBLOAT_BANDWIDTH = 10000 // Mbit/s, so the pacing of the iperf3 client stays above most links
+	DEFAULT_BUFFERBLOAT_INTERVAL  = 0.1   // Seconds between probes
+	MAX_BUFFERBLOAT_INTERVAL      = 1
+
+	BUFFERBLOAT_WARMUP = 2 * time.Second // Start of each load left out, while the queue fills
+	BUFFERBLOAT_SETTLE = 2 * time.Second // Pause between loads, while the queue drains
+)
+
+// bufferbloatGrades grade the median latency increase under load in
+// milliseconds; the rest are F
+var bufferbloatGrades = []struct {
+	grade string
+	below float64
+}{
+	{"A+", 5},
+	{"A", 30},
+	{"B", 60},
+	{"C", 200},
+	{"D", 400},
+}
+
+// BufferbloatProbe describes the probes of a bufferbloat test
+type BufferbloatProbe struct {
+	Type        string              `json:"type"` // twamp or ping
+	Host        string              `json:"host"`
+	Address     string              `json:"address,omitempty"`  // Ping only, as the target resolved
+	Port        int                 `json:"port,omitempty"`     // TWAMP-Control port, or UDP port of UDP pings
+	Protocol    string              `json:"protocol,omitempty"` // Ping only: icmp or udp
+	Socket      string              `json:"socket,omitempty"`   // Ping only: raw, datagram or udp
+	IntervalSec float64             `json:"interval_sec"`
+	Dial        *nettest.DialReport `json:"dial,omitempty"` // TWAMP-Control connection
+}
+
+// BufferbloatLatency is the RTT of the probes sent within one window of a
+// bufferbloat test
+type BufferbloatLatency struct {
+	StartSec    float64      `json:"start_sec"` // Since the first probe
+	EndSec      float64      `json:"end_sec"`
+	Sent        int          `json:"sent"`
+	Received    int          `json:"received"`
+	LossPercent float64      `json:"loss_percent"`
+	RTTMinMs    float64      `json:"rtt_min_ms"`
+	RTTAvgMs    float64      `json:"rtt_avg_ms"`
+	RTTMaxMs    float64      `json:"rtt_max_ms"`
+	RTTStddevMs float64      `json:"rtt_stddev_ms"`
+	Percentiles *Percentiles `json:"percentiles_ms,omitempty"` // Without them when no probe was answered
+}
+
+// BufferbloatLoad is one load of a bufferbloat test and the latency under it
+type BufferbloatLoad struct {
+	ThroughputMbps    float64             `json:"throughput_mbps"`
+	Retransmits       int                 `json:"retransmits,omitempty"`
+	DurationSec       float64             `json:"duration_sec"`
+	Latency           *BufferbloatLatency `json:"latency"`
+	LatencyIncreaseMs *float64            `json:"latency_increase_ms,omitempty"` // Median under load minus the idle median, unless no probe was answered
+	P95IncreaseMs     *float64            `json:"p95_increase_ms,omitempty"`
+	Grade             string              `json:"grade"`
+}
+
+// bloatProbe is one probe of a bufferbloat test
+type bloatProbe struct {
+	sent     time.Time
+	rttMs    float64
+	answered bool
+}
+
+// bloatProbes probes continuously for a bufferbloat test
+type bloatProbes struct {
+	prober   pingProber
+	interval time.Duration
+	progress *JobProgress
+
+	stop     chan struct{} // Closed to stop sending
+	answered chan struct{} // Closed on the first answer
+	done     chan struct{} // Closed once probes and err are final
+	probes   []bloatProbe
+	err      error
+	finished sync.Once
+}
+
+func newBloatProbes(prober pingProber, interval time.Duration, progress *JobProgress) *bloatProbes {
+	return &bloatProbes{
+		prober:   prober,
+		interval: interval,
+		progress: progress,
+		stop:     make(chan struct{}),
+		answered: make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// run sends a probe every interval until stop is closed, then waits up to
+// PING_TIMEOUT for the last answers. Answers after PING_TIMEOUT count as lost,
+// as in ping tests.
+func (b *bloatProbes) run() {
+	defer close(b.done)
+	answered := 0
+	start := time.Now()
+	next := time.NewTimer(0)
+	defer next.Stop()
+	tick, stop := next.C, b.stop
+	var wait <-chan time.Time
+	for {
+		select {
+		case <-tick:
+			seq := len(b.probes)
+			b.probes = append(b.probes, bloatProbe{sent: time.Now()})
+			if err := b.prober.send(seq); err != nil {
+				b.err = fmt.Errorf("sending probe %d: %v", seq, err)
+				return
+			}
+			next.Reset(time.Until(start.Add(time.Duration(seq+1) * b.interval)))
+		case <-stop:
+			tick, stop = nil, nil
+			wait = time.After(PING_TIMEOUT)
+			if answered == len(b.probes) {
+				return
+			}
+		case a, ok := <-b.prober.answers():
+			if !ok {
+				if stop != nil {
+					b.err = errors.New("probe socket closed")
+				}
+				return
+			}
+			if a.seq >= len(b.probes) || (a.status != PING_STATUS_REPLY && a.status != PING_STATUS_PORT_UNREACHABLE) {
+				continue // Not ours, or an error from a router on the way
+			}
+			probe := &b.probes[a.seq]
+			rtt := a.at.Sub(probe.sent)
+			if probe.answered || rtt > PING_TIMEOUT {
+				continue
+			}
+			probe.answered, probe.rttMs = true, float64(rtt.Nanoseconds())/1e6
+			if answered++; answered == 1 {
+				close(b.answered)
+			}
+			b.progress.add(SeriesPoint{T: probe.sent.Sub(start).Seconds(), Value: probe.rttMs})
+			if wait != nil && answered == len(b.probes) {
+				return
+			}
+		case <-wait:
+			return
+		}
+	}
+}
+
+// finish stops the probes and returns them once the last answers are in
+func (b *bloatProbes) finish() ([]bloatProbe, error) {
+	b.finished.Do(func() {
+		close(b.stop)
+		<-b.done
+		b.prober.close()
+		for range b.prober.answers() {
+			// Drained, so no reader blocks on a full channel
+		}
+	})
+	return b.probes, b.err
+}
+
+// twampProber sends TWAMP test packets as pings and matches the reflected
+// sender sequence numbers; its RTT includes the reflector's turnaround
+type twampProber struct {
+	test    *twamp.TwampTest
+	base    uint32 // Session sequence number of probe 0
+	reading bool
+	results chan pingAnswer
+}
+
+func newTWAMPProber(test *twamp.TwampTest) *twampProber {
+	return &twampProber{test: test, results: make(chan pingAnswer, 64)}
+}
+
+func (p *twampProber) send(seq int) error {
+	wire, err := p.test.SendProbe()
+	if err != nil {
+		return err
+	}
+	if !p.reading {
+		// Sequence numbers continue from any earlier test on the session,
+		// so the reader starts once the first probe fixed the base
+		p.base, p.reading = wire-uint32(seq), true
+		_ = p.test.GetConnection().SetReadDeadline(time.Time{})
+		go p.read()
+	}
+	return nil
+}
+
+func (p *twampProber) answers() <-chan pingAnswer { return p.results }
+
+func (p *twampProber) close() {
+	if !p.reading {
+		close(p.results)
+		return
+	}
+	_ = p.test.GetConnection().SetReadDeadline(time.Now())
+}
+
+// read delivers the replies until the read deadline set by close
+func (p *twampProber) read() {
+	defer close(p.results)
+	conn := p.test.GetConnection()
+	buf := make([]byte, TWAMP_BASE_PACKET_SIZE+p.test.GetSession().GetConfig().Padding+64)
+	for {
+		n, err := conn.Read(buf)
+		at := time.Now()
+		if err != nil {
+			var netErr net.Error
+			if (errors.As(err, &netErr) && netErr.Timeout()) || errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
+		wire, err := twamp.ParseSenderSequence(buf[:n])
+		if err != nil {
+			continue
+		}
+		p.results <- pingAnswer{seq: int(wire - p.base), status: PING_STATUS_REPLY, at: at}
+	}
+}
+
+// summarizeBloatWindow computes the latency of the probes sent from from until to
+func summarizeBloatWindow(probes []bloatProbe, origin, from, to time.Time) *BufferbloatLatency {
+	w := &BufferbloatLatency{StartSec: from.Sub(origin).Seconds(), EndSec: to.Sub(origin).Seconds()}
+	var rtts []float64
+	for _, p := range probes {
+		if p.sent.Before(from) || !p.sent.Before(to) {
+			continue
+		}
+		w.Sent++
+		if p.answered {
+			rtts = append(rtts, p.rttMs)
+		}
+	}
+	w.Received = len(rtts)
+	if w.Sent > 0 {
+		w.LossPercent = 100 * float64(w.Sent-w.Received) / float64(w.Sent)
+	}
+	w.RTTMinMs, w.RTTAvgMs, w.RTTMaxMs, w.RTTStddevMs = rttStats(rtts)
+	if len(rtts) > 0 {
+		sort.Float64s(rtts)
+		p := stats.TailPercentiles(rtts)
+		w.Percentiles = &p
+	}
+	return w
+}
+
+// bufferbloatGrade grades a median latency increase in milliseconds
+func bufferbloatGrade(increaseMs float64) string {
+	for _, g := range bufferbloatGrades {
+		if increaseMs < g.below {
+			return g.grade
+		}
+	}
+	return "F"
+}
+
+// gradeLoad compares the latency of a load with the idle baseline. A load
+// under which no probe was answered grades F.
+func (l *BufferbloatLoad) gradeLoad(idle *BufferbloatLatency) {
+	if l.Latency.Percentiles == nil {
+		l.Grade = "F"
+		return
+	}
+	median := math.Max(0, l.Latency.Percentiles.P50-idle.Percentiles.P50)
+	p95 := math.Max(0, l.Latency.Percentiles.P95-idle.Percentiles.P95)
+	l.LatencyIncreaseMs, l.P95IncreaseMs = &median, &p95
+	l.Grade = bufferbloatGrade(median)
+}
+
+// worseGrade returns the worse of two grades
+func worseGrade(a, b string) string {
+	rank := func(grade string) int {
+		for i, g := range bufferbloatGrades {
+			if g.grade == grade {
+				return i
+			}
+		}
+		return len(bufferbloatGrades)
+	}
+	if rank(b) > rank(a) {
+		return b
+	}
+	return a
+}
+
+// validateBufferbloat checks the probe and the bounds of a bufferbloat request
+func validateBufferbloat(req *RunRequest) error {
+	switch req.Probe = strings.ToLower(req.Probe); req.Probe {
+	case "":
+		req.Probe = BUFFERBLOAT_PROBE_TWAMP
+	case BUFFERBLOAT_PROBE_TWAMP, BUFFERBLOAT_PROBE_PING:
+	default:
+		return fmt.Errorf("invalid probe %q (expected twamp or ping)", req.Probe)
+	}
+	switch req.Direction = strings.ToLower(req.Direction); req.Direction {
+	case "":
+		req.Direction = NDT7_DIRECTION_BOTH
+	case TRANSFER_DOWNLOAD, TRANSFER_UPLOAD, NDT7_DIRECTION_BOTH:
+	default:
+		return fmt.Errorf("invalid direction %q (expected download, upload or both)", req.Direction)
+	}
+	switch {
+	case req.ServerHost == "":
+		return fmt.Errorf("server_host is required")
+	case req.Duration < MIN_BUFFERBLOAT_DURATION || req.Duration > MAX_BUFFERBLOAT_DURATION:
+		return fmt.Errorf("duration must be between %d and %d seconds", MIN_BUFFERBLOAT_DURATION, MAX_BUFFERBLOAT_DURATION)
+	case req.IdleDuration < 1 || req.IdleDuration > MAX_BUFFERBLOAT_IDLE:
+		return fmt.Errorf("idle_duration must be between 1 and %d seconds", MAX_BUFFERBLOAT_IDLE)
+	case req.Parallel < 1 || req.Parallel > MAX_IPERF3_PARALLEL:
+		return fmt.Errorf("parallel must be between 1 and %d", MAX_IPERF3_PARALLEL)
+	case req.Interval < MIN_PING_INTERVAL || req.Interval > MAX_BUFFERBLOAT_INTERVAL:
+		return fmt.Errorf("interval must be between %g and %d seconds", MIN_PING_INTERVAL, MAX_BUFFERBLOAT_INTERVAL)
+	}
+	return nil
+}
+
+// runBufferbloat applies defaults to a decoded request, runs the bufferbloat test and records the result.
+// Errors come with the HTTP status to report them with.
+func runBufferbloat(req RunRequest, profile *Profile) (map[string]interface{}, int, error) {
+	if req.ServerPort == 0 {
+		req.ServerPort = 5201
+	}
+	if req.Duration == 0 {
+		req.Duration = DEFAULT_BUFFERBLOAT_DURATION
+	}
+	if req.IdleDuration == 0 {
+		req.IdleDuration = DEFAULT_BUFFERBLOAT_IDLE
+	}
+	if req.Parallel == 0 {
+		req.Parallel = DEFAULT_BUFFERBLOAT_PARALLEL
+	}
+	if req.Interval == 0 {
+		req.Interval = DEFAULT_BUFFERBLOAT_INTERVAL
+	}
+	if req.ProbeHost == "" {
+		req.ProbeHost = req.ServerHost
+	}
+	if !req.Bandwidth.Set {
+		req.Bandwidth = mbps(DEFAULT_BUFFERBLOAT_BANDWIDTH)
+		if max := req.apiKey.maxBandwidth(); max > 0 && float64(max) < req.Bandwidth.Mbps {
+			req.Bandwidth = mbps(max)
+		}
+		if profile != nil && profile.Limits.MaxBandwidth > 0 && float64(profile.Limits.MaxBandwidth) < req.Bandwidth.Mbps {
+			req.Bandwidth = mbps(profile.Limits.MaxBandwidth)
+		}
+	}
+	if err := checkProfileLimits(req, profile); err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	err := validateBufferbloat(&req)
+	if err == nil && req.Probe == BUFFERBLOAT_PROBE_TWAMP && req.ProbePort == 0 {
+		req.ProbePort = 862
+	}
+	if err == nil {
+		req.AddressFamily, err = parseAddressFamily(req.AddressFamily)
+	}
+	if err == nil && req.AddressFamily == nettest.FAMILY_COMPARE {
+		err = fmt.Errorf("address_family compare is not available for bufferbloat tests; run ipv4 and ipv6 separately")
+	}
+	var auth *nettest.Iperf3Auth
+	if err == nil {
+		auth, err = iperf3AuthFor(req)
+	}
+	if err == nil {
+		err = validateLockWait(&req)
+	}
+	if err == nil {
+		err = validateCallbackURL(req.CallbackURL)
+	}
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	directions := ndt7Directions(req.Direction)
+
+	releaseSlot, status, err := acquireTestSlot(TEST_TYPE_BUFFERBLOAT, req)
+	if err != nil {
+		return nil, status, err
+	}
+	defer releaseSlot()
+
+	lock, release, status, err := lockTest(TEST_TYPE_BUFFERBLOAT, req, true)
+	if err != nil {
+		return nil, status, err
+	}
+	defer release()
+
+	logf(req.ctx, "Bufferbloat test: %s:%d (probe=%s %s, direction=%s, %ds load, %d streams, idle=%ds, interval=%gs, family=%s)",
+		req.ServerHost, req.ServerPort, req.Probe, req.ProbeHost, req.Direction, req.Duration, req.Parallel, req.IdleDuration, req.Interval, req.AddressFamily)
+
+	cancel := withTestTimeout(&req)
+	defer cancel()
+	ctx := req.runContext()
+	started := time.Now()
+
+	prober, probe, closeProber, err := openBloatProber(ctx, req)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	defer closeProber()
+
+	interval := time.Duration(req.Interval * float64(time.Second))
+	req.progress.start("rtt_ms", int(time.Duration(req.IdleDuration+len(directions)*req.Duration)*time.Second/interval))
+	probes := newBloatProbes(prober, interval, req.progress)
+	origin := time.Now()
+	go probes.run()
+	defer func() { _, _ = probes.finish() }()
+
+	// Idle baseline
+	select {
+	case <-time.After(time.Duration(req.IdleDuration) * time.Second):
+	case <-probes.done:
+	case <-ctx.Done():
+		return nil, http.StatusInternalServerError, canceledError(ctx)
+	}
+	idleEnd := time.Now()
+	var idleErr error
+	select {
+	case <-probes.done:
+		_, idleErr = probes.finish()
+	default:
+	}
+	if idleErr == nil {
+		select {
+		case <-probes.answered:
+		default:
+			idleErr = fmt.Errorf("no probe answered in %ds", req.IdleDuration)
+		}
+	}
+	if idleErr != nil {
+		return nil, http.StatusInternalServerError, twampError(ctx, "Idle baseline failed", idleErr)
+	}
+
+	type window struct{ from, to time.Time }
+	loads := make(map[string]*BufferbloatLoad, len(directions))
+	windows := make(map[string]window, len(directions))
+	var dial *nettest.DialReport
+	for i, direction := range directions {
+		if i > 0 {
+			select {
+			case <-time.After(BUFFERBLOAT_SETTLE):
+			case <-ctx.Done():
+				return nil, http.StatusInternalServerError, canceledError(ctx)
+			}
+		}
+		result, err := nettest.RunTest(ctx, req.ServerHost, req.ServerPort,
+			nettest.WithDuration(time.Duration(req.Duration)*time.Second),
+			nettest.WithParallel(req.Parallel),
+			nettest.WithReverse(direction == TRANSFER_DOWNLOAD),
+			nettest.WithBandwidth(req.Bandwidth.bps()),
+			nettest.WithFamily(req.AddressFamily),
+			nettest.WithAuth(auth),
+			nettest.WithPhaseFunc(func(phase string) { testPhase(ctx, phase) }),
+		)
+		if ctx.Err() != nil {
+			err = canceledError(ctx)
+		}
+		if err != nil {
+			return nil, http.StatusInternalServerError, twampError(ctx, fmt.Sprintf("Bufferbloat %s load failed", direction), err)
+		}
+		if dial == nil {
+			dial = result.Dial
+		}
+		loads[direction] = &BufferbloatLoad{
+			ThroughputMbps: result.BandwidthMbps,
+			Retransmits:    result.Retransmits,
+			DurationSec:    result.Duration,
+		}
+		windows[direction] = window{result.StartedAt.Add(BUFFERBLOAT_WARMUP), result.StartedAt.Add(time.Duration(result.Duration * float64(time.Second)))}
+	}
+
+	samples, err := probes.finish()
+	if err != nil {
+		return nil, http.StatusInternalServerError, twampError(ctx, "Latency probes failed", err)
+	}
+	idle := summarizeBloatWindow(samples, origin, origin, idleEnd)
+	data := map[string]interface{}{
+		"server":    req.ServerHost,
+		"port":      req.ServerPort,
+		"direction": req.Direction,
+		"parallel":  req.Parallel,
+		"bandwidth": req.Bandwidth,
+		"probe":     probe,
+		"idle":      idle,
+		"dial":      dial,
+	}
+	grade := bufferbloatGrade(0)
+	increase := 0.0
+	for _, direction := range directions {
+		load, w := loads[direction], windows[direction]
+		load.Latency = summarizeBloatWindow(samples, origin, w.from, w.to)
+		load.gradeLoad(idle)
+		grade = worseGrade(grade, load.Grade)
+		if load.LatencyIncreaseMs != nil {
+			increase = math.Max(increase, *load.LatencyIncreaseMs)
+		}
+		data[direction] = load
+	}
+	data["grade"] = grade
+	data["latency_increase_ms"] = increase
+	data["duration_sec"] = time.Since(started).Seconds()
+	if profile != nil {
+		data["profile"] = profile.Name
+	}
+	data["lock"] = lock
+
+	recordResult(TEST_TYPE_BUFFERBLOAT, req, started, data)
+	notifyCallback(req.CallbackURL, data)
+
+	return data, http.StatusOK, nil
+}
+
+// openBloatProber sets up the probes of a bufferbloat request: a TWAMP test
+// session at probe_host, or pings over ICMP with UDP as the fallback
+func openBloatProber(ctx context.Context, req RunRequest) (pingProber, *BufferbloatProbe, func(), error) {
+	probe := &BufferbloatProbe{Type: req.Probe, Host: req.ProbeHost, Port: req.ProbePort, IntervalSec: req.Interval}
+	if req.Probe == BUFFERBLOAT_PROBE_PING {
+		port := req.ProbePort
+		if port == 0 {
+			port = DEFAULT_UDP_PING_PORT
+		}
+		dst, err := resolveUDP(req.ProbeHost, port, req.AddressFamily)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("Resolving the probe host failed: %v", err)
+		}
+		probe.Address = dst.IP.String()
+		if req.ProbePort == 0 {
+			icmp, err := openICMPProber(dst.IP, DEFAULT_PING_TTL, DEFAULT_PING_SIZE)
+			if err == nil {
+				probe.Protocol, probe.Socket = PING_PROTOCOL_ICMP, icmp.socket()
+				return icmp, probe, func() {}, nil
+			}
+			logf(ctx, "Bufferbloat test: no ICMP socket, falling back to UDP: %v", err)
+		}
+		probe.Protocol, probe.Socket, probe.Port = PING_PROTOCOL_UDP, PING_SOCKET_UDP, port
+		return newUDPProber(dst, DEFAULT_PING_TTL, DEFAULT_PING_SIZE), probe, func() {}, nil
+	}
+
+	controlConn, dial, err := nettest.DialControlFrom(ctx, req.ProbeHost, req.ProbePort, req.AddressFamily, 5*time.Second, nil)
+	if err != nil {
+		return nil, nil, nil, twampError(ctx, "Probe connect failed", err)
+	}
+	probe.Dial = dial
+	conn, err := twamp.NewClient().ConnectConn(controlConn)
+	if err != nil {
+		_ = controlConn.Close()
+		return nil, nil, nil, twampError(ctx, "Probe connect failed", err)
+	}
+	session, err := conn.CreateSession(twamp.TwampSessionConfig{
+		ReceiverPort: nettest.TWAMP_RECEIVER_PORT,
+		SenderPort:   nettest.TWAMP_SENDER_PORT_MIN + mathrand.Intn(nettest.TWAMP_SENDER_PORT_MAX-nettest.TWAMP_SENDER_PORT_MIN),
+		Timeout:      5,
+	})
+	if err != nil {
+		_ = conn.Close()
+		return nil, nil, nil, twampError(ctx, "Probe session failed", err)
+	}
+	test, err := session.CreateTest()
+	if err != nil {
+		_ = session.Stop()
+		_ = conn.Close()
+		return nil, nil, nil, twampError(ctx, "Probe test creation failed", err)
+	}
+	return newTWAMPProber(test), probe, func() {
+		_ = session.Stop()
+		_ = conn.Close()
+	}, nil
+}
@@ -0,0 +1,94 @@
+package api
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestBufferbloatGrade(t *testing.T) {
+	tests := []struct {
+		increaseMs float64
+		expected   string
+	}{
+		{0, "A+"},
+		{4.9, "A+"},
+		{5, "A"},
+		{29.9, "A"},
+		{30, "B"},
+		{60, "C"},
+		{199, "C"},
+		{200, "D"},
+		{400, "F"},
+		{2500, "F"},
+	}
+	for _, tt := range tests {
+		if got := bufferbloatGrade(tt.increaseMs); got != tt.expected {
+			t.Errorf("bufferbloatGrade(%v): expected %s, got %s", tt.increaseMs, tt.expected, got)
+		}
+	}
+}
+
+func TestWorseGrade(t *testing.T) {
+	tests := []struct {
+		a, b, expected string
+	}{
+		{"A+", "A+", "A+"},
+		{"A+", "C", "C"},
+		{"D", "A", "D"},
+		{"B", "F", "F"},
+		{"F", "A+", "F"},
+	}
+	for _, tt := range tests {
+		if got := worseGrade(tt.a, tt.b); got != tt.expected {
+			t.Errorf("worseGrade(%s, %s): expected %s, got %s", tt.a, tt.b, tt.expected, got)
+		}
+	}
+}
+
+func TestSummarizeBloatWindow(t *testing.T) {
+	origin := time.Date(2026, 1, 15, 10, 0, 0, 0, time.UTC)
+	var probes []bloatProbe
+	for i := 0; i < 20; i++ {
+		rtt := 10.0
+		if i >= 10 {
+			rtt = 50 // Under load
+		}
+		probes = append(probes, bloatProbe{
+			sent:     origin.Add(time.Duration(i) * 100 * time.Millisecond),
+			rttMs:    rtt,
+			answered: i != 15,
+		})
+	}
+
+	idle := summarizeBloatWindow(probes, origin, origin, origin.Add(time.Second))
+	if idle.Sent != 10 || idle.Received != 10 || idle.LossPercent != 0 {
+		t.Errorf("Expected 10 of 10 idle probes answered, got %d of %d (%v%% lost)", idle.Received, idle.Sent, idle.LossPercent)
+	}
+	if idle.Percentiles == nil || idle.Percentiles.P50 != 10 {
+		t.Fatalf("Expected an idle median of 10 ms, got %+v", idle.Percentiles)
+	}
+
+	// The window starts at its first probe and ends before the probe sent at its end
+	load := summarizeBloatWindow(probes, origin, origin.Add(time.Second), origin.Add(1900*time.Millisecond))
+	if load.StartSec != 1 || load.EndSec != 1.9 {
+		t.Errorf("Expected the window from 1 s to 1.9 s, got %v to %v", load.StartSec, load.EndSec)
+	}
+	if load.Sent != 9 || load.Received != 8 {
+		t.Errorf("Expected 8 of 9 probes answered under load, got %d of %d", load.Received, load.Sent)
+	}
+	if math.Abs(load.LossPercent-100.0/9) > 1e-9 {
+		t.Errorf("Expected %.2f%% lost, got %v", 100.0/9, load.LossPercent)
+	}
+	if load.Percentiles == nil || load.Percentiles.P50-idle.Percentiles.P50 != 40 {
+		t.Errorf("Expected the median to rise by 40 ms, got %+v", load.Percentiles)
+	}
+	if bufferbloatGrade(load.Percentiles.P50-idle.Percentiles.P50) != "B" {
+		t.Errorf("Expected a 40 ms increase to grade B")
+	}
+
+	empty := summarizeBloatWindow(probes, origin, origin.Add(time.Hour), origin.Add(2*time.Hour))
+	if empty.Sent != 0 || empty.LossPercent != 0 || empty.Percentiles != nil {
+		t.Errorf("Expected an empty window without loss or percentiles, got %+v", empty)
+	}
+}
@@ -0,0 +1,48 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Canceled tests: a synchronous run ends when its HTTP client disconnects, an
+// asynchronous one with POST /jobs/{id}/cancel. iperf3 and TWAMP tests close
+// their sockets at once; other tests run to completion.
+const ERR_CANCELED = "ERR_CANCELED"
+
+var errJobCanceled = errors.New("job canceled")
+
+// runContext returns the context that ends the request's test, or one that never ends
+func (req *RunRequest) runContext() context.Context {
+	if req.ctx == nil {
+		return context.Background()
+	}
+	return req.ctx
+}
+
+// canceledError reports a test ended by ctx, ERR_TIMEOUT when its deadline
+// passed (see withTestTimeout)
+func canceledError(ctx context.Context) error {
+	cause := context.Cause(ctx)
+	var timeout *testTimeoutError
+	if errors.As(cause, &timeout) {
+		return &codedError{ERR_TIMEOUT, timeout}
+	}
+	if errors.Is(cause, context.Canceled) {
+		cause = errors.New("client disconnected")
+	}
+	return &codedError{ERR_CANCELED, fmt.Errorf("test canceled: %v", cause)}
+}
+
+// twampError is the error of a TWAMP step: a cancellation or timeout, of
+// which the step only saw the closed connection, or the step's own error
+func twampError(ctx context.Context, step string, err error) error {
+	if ctx.Err() != nil {
+		return canceledError(ctx)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %v", step, err)
+	}
+	return nil
+}
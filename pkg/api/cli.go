@@ -0,0 +1,368 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+)
+
+// Command line mode: with arguments, the binary runs one test and exits
+// instead of serving the API, e.g. network-test-api iperf3 --host iperf.he.net
+// --duration 10 --json. The test goes through the profile defaults,
+// validation and runner of its POST endpoint, and its flags are the fields
+// of that endpoint's body.
+const (
+	CLI_EXIT_OK     = 0
+	CLI_EXIT_FAILED = 1 // The test failed
+	CLI_EXIT_USAGE  = 2 // Invalid arguments or configuration
+
+	CLI_OUTPUT_TEXT  = "text"
+	CLI_SERVE        = "serve"
+	CLI_NAME         = "network-test-api"
+	CLI_DEFAULT_LOGS = "warn" // Test logs are left out of the output unless --verbose or LOG_LEVEL
+)
+
+// cliBodies are the body schemas of the run endpoints, whose fields are the
+// flags of each test type
+var cliBodies = map[string]string{
+	TEST_TYPE_IPERF3:      "Iperf3Request",
+	TEST_TYPE_TWAMP:       "TwampRequest",
+	TEST_TYPE_TRANSFER:    "TransferRequest",
+	TEST_TYPE_S3:          "S3Request",
+	TEST_TYPE_SSH:         "SSHRequest",
+	TEST_TYPE_PMTU:        "PMTURequest",
+	TEST_TYPE_STUN:        "STUNRequest",
+	TEST_TYPE_NAT64:       "NAT64Request",
+	TEST_TYPE_PING:        "PingRequest",
+	TEST_TYPE_TRACEROUTE:  "TracerouteRequest",
+	TEST_TYPE_OWAMP:       "OwampRequest",
+	TEST_TYPE_TLS:         "TLSRequest",
+	TEST_TYPE_NDT7:        "NDT7Request",
+	TEST_TYPE_BUFFERBLOAT: "BufferbloatRequest",
+	TEST_TYPE_RPM:         "RPMRequest",
+	TEST_TYPE_TCP_CONNECT: "TCPConnectRequest",
+	TEST_TYPE_HTTP:        "HTTPRequest",
+}
+
+// Shorter names of test types and flags
+var (
+	cliTypeAliases = map[string]string{"iperf": TEST_TYPE_IPERF3, "tcp": TEST_TYPE_TCP_CONNECT}
+	cliFlagAliases = map[string]string{"server_host": "host", "server_port": "port"}
+	// Webhook deliveries are retried after the process would have exited
+	cliSkippedFields = map[string]bool{"callback_url": true}
+)
+
+// isCLI reports whether the arguments ask for a test rather than the server
+func isCLI(args []string) bool {
+	return len(args) > 0 && args[0] != CLI_SERVE
+}
+
+// runCLI runs the test of the arguments and returns the exit code
+func runCLI(args []string, stdout, stderr io.Writer) int {
+	registerRunners()
+	if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		cliUsage(stdout)
+		return CLI_EXIT_OK
+	}
+	name := strings.ReplaceAll(strings.ToLower(args[0]), "-", "_")
+	if alias, ok := cliTypeAliases[name]; ok {
+		name = alias
+	}
+	runner, ok := lookupRunner(name)
+	if !ok {
+		fmt.Fprintf(stderr, "Unknown test %q (expected %s); see %s help\n", args[0], runnerNames(), CLI_NAME)
+		return CLI_EXIT_USAGE
+	}
+
+	fs := flag.NewFlagSet(CLI_NAME+" "+name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fields := make(map[string]interface{})
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "Usage: %s %s [flags] [server_host]\n\nRuns one %s test like POST to its run endpoint and prints its result.\n\nFlags:\n", CLI_NAME, name, name)
+		fs.PrintDefaults()
+	}
+	for _, f := range cliFields(name) {
+		addCLIFlag(fs, fields, f)
+	}
+	body := fs.String("body", "", "JSON request body, or @file to read it from; flags override its fields")
+	output := fs.String("output", CLI_OUTPUT_TEXT, "text, json, csv or junit")
+	asJSON := fs.Bool("json", false, "Print the JSON response, like --output json")
+	verbose := fs.Bool("verbose", false, "Log the test's progress to stderr")
+	// Flags may follow the host, as in twamp 192.0.2.1 --count 100
+	var positional []string
+	for rest := args[1:]; ; rest = fs.Args()[1:] {
+		if err := fs.Parse(rest); err != nil {
+			if err == flag.ErrHelp {
+				return CLI_EXIT_OK
+			}
+			return CLI_EXIT_USAGE
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		positional = append(positional, fs.Arg(0))
+	}
+	if *asJSON {
+		*output = OUTPUT_JSON
+	}
+	switch *output {
+	case CLI_OUTPUT_TEXT, OUTPUT_JSON, OUTPUT_CSV, OUTPUT_JUNIT:
+	default:
+		fmt.Fprintf(stderr, "Invalid --output %q (expected text, json, csv or junit)\n", *output)
+		return CLI_EXIT_USAGE
+	}
+	if len(positional) > 1 {
+		fmt.Fprintf(stderr, "Unexpected arguments %q\n", positional[1:])
+		return CLI_EXIT_USAGE
+	}
+	if len(positional) == 1 {
+		if _, set := fields["server_host"]; !set {
+			fields["server_host"] = positional[0]
+		}
+	}
+	raw, err := cliBody(*body, fields)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return CLI_EXIT_USAGE
+	}
+
+	if os.Getenv("LOG_LEVEL") == "" {
+		level := CLI_DEFAULT_LOGS
+		if *verbose {
+			level = "info"
+		}
+		_ = os.Setenv("LOG_LEVEL", level)
+	}
+	configureCLI()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	data, status := map[string]interface{}(nil), http.StatusBadRequest
+	req, err := decodeRequestBody(raw)
+	var profile *Profile
+	if err == nil {
+		req, profile, err = withProfileDefaults(req, raw)
+	}
+	if err == nil {
+		err = validateRunRequest(runner, req)
+	}
+	if err == nil {
+		data, status, err = runner.Run(ctx, req, profile)
+	}
+	writeCLIResult(stdout, stderr, *output, name, requestHost(req), data, status, err)
+	var ve *ValidationError
+	if errors.As(err, &ve) {
+		return CLI_EXIT_USAGE
+	}
+	if err != nil {
+		return CLI_EXIT_FAILED
+	}
+	return CLI_EXIT_OK
+}
+
+// configureCLI applies the settings a test reads; the server's own, such as
+// its listener, webhooks, exporters and result history, are left out
+func configureCLI() {
+	loadConfig()
+	configureLogging()
+	configureProfiles()
+	configureSecrets()
+	configureKnownHosts()
+	configureRootStores()
+	configureNDT7()
+	configureRPM()
+	configureCoordination()
+	configureTunnels()
+	configureTestTimeout()
+	configureTargetPolicy()
+}
+
+func cliUsage(w io.Writer) {
+	names := make([]string, 0, len(testRunners))
+	for _, r := range testRunners {
+		names = append(names, r.Name())
+	}
+	sort.Strings(names)
+	fmt.Fprintf(w, "Usage:\n  %s [%s]            Serve the API\n  %s <test> [flags] [host]  Run one test and exit\n\n", CLI_NAME, CLI_SERVE, CLI_NAME)
+	fmt.Fprintf(w, "Tests: %s (iperf is iperf3, tcp tcp_connect)\n\n", strings.Join(names, ", "))
+	fmt.Fprintf(w, "Run %s <test> -h for the flags of a test. The exit code is 0 when the test succeeded, %d when it failed and %d for invalid arguments or requests.\n", CLI_NAME, CLI_EXIT_FAILED, CLI_EXIT_USAGE)
+}
+
+// cliFields are the documented body fields of a test type
+func cliFields(testType string) []apiField {
+	for _, schema := range apiSchemas {
+		if schema.Name == cliBodies[testType] {
+			return schema.Fields
+		}
+	}
+	return nil
+}
+
+// runRequestTypes maps the JSON names of RunRequest's fields to their types
+func runRequestTypes() map[string]reflect.Type {
+	types := make(map[string]reflect.Type)
+	t := reflect.TypeOf(RunRequest{})
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			types[name] = t.Field(i).Type
+		}
+	}
+	return types
+}
+
+// addCLIFlag adds the flag of a body field, dashed, e.g. --server-port; only
+// the flags given become fields of the request, so profile defaults apply
+func addCLIFlag(fs *flag.FlagSet, fields map[string]interface{}, f apiField) {
+	t, ok := runRequestTypes()[f.Name]
+	if !ok || cliSkippedFields[f.Name] {
+		return
+	}
+	usage := f.Description
+	if f.Required {
+		usage += " (required)"
+	}
+	if f.Default != "" {
+		usage += " (default: " + f.Default + ")"
+	}
+	set := func(s string) error {
+		v, err := cliValue(t, s)
+		if err == nil {
+			fields[f.Name] = v
+		}
+		return err
+	}
+	names := []string{strings.ReplaceAll(f.Name, "_", "-")}
+	if alias, ok := cliFlagAliases[f.Name]; ok {
+		names = append(names, alias)
+	}
+	for i, name := range names {
+		if i > 0 {
+			usage = "Short for --" + names[0]
+		}
+		if t.Kind() == reflect.Bool {
+			fs.BoolFunc(name, usage, set)
+		} else {
+			fs.Func(name, usage, set)
+		}
+	}
+}
+
+// cliValue converts a flag to the JSON value of a field of type t: numbers
+// and booleans parsed, lists comma-separated, bandwidths as given, other
+// types JSON
+func cliValue(t reflect.Type, s string) (interface{}, error) {
+	if t == reflect.TypeOf(Bandwidth{}) {
+		return s, nil
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return s, nil
+	case reflect.Bool:
+		return strconv.ParseBool(s)
+	case reflect.Int, reflect.Int64:
+		return strconv.ParseInt(s, 10, 64)
+	case reflect.Float64:
+		return strconv.ParseFloat(s, 64)
+	case reflect.Slice:
+		switch t.Elem().Kind() {
+		case reflect.String:
+			return strings.Split(s, ","), nil
+		case reflect.Int:
+			var list []int64
+			for _, item := range strings.Split(s, ",") {
+				n, err := strconv.ParseInt(strings.TrimSpace(item), 10, 64)
+				if err != nil {
+					return nil, err
+				}
+				list = append(list, n)
+			}
+			return list, nil
+		}
+	}
+	if !json.Valid([]byte(s)) {
+		return nil, fmt.Errorf("expected JSON")
+	}
+	return json.RawMessage(s), nil
+}
+
+// cliBody merges the flags' fields over the --body object
+func cliBody(body string, fields map[string]interface{}) ([]byte, error) {
+	merged := make(map[string]interface{})
+	if body != "" {
+		raw := []byte(body)
+		if file, ok := strings.CutPrefix(body, "@"); ok {
+			var err error
+			if raw, err = os.ReadFile(file); err != nil {
+				return nil, fmt.Errorf("reading --body: %v", err)
+			}
+		}
+		if err := json.Unmarshal(raw, &merged); err != nil {
+			return nil, fmt.Errorf("invalid --body: %v", err)
+		}
+	}
+	for k, v := range fields {
+		merged[k] = v
+	}
+	return json.Marshal(merged)
+}
+
+// writeCLIResult prints the outcome of a test in output: the response of the
+// run endpoint for json, its CSV or JUnit export, or its metrics for text
+func writeCLIResult(stdout, stderr io.Writer, output, testType, name string, data map[string]interface{}, status int, err error) {
+	switch output {
+	case OUTPUT_JSON:
+		resp := ApiResponse{Status: "ok", Data: data}
+		if err != nil {
+			resp = ApiResponse{Status: "error", Data: validationData(err), Error: err.Error(), Code: errorCode(err)}
+		}
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		_ = enc.Encode(resp)
+		return
+	case OUTPUT_CSV:
+		_ = writeCSV(stdout, runCases(testType, name, data, status, err))
+		return
+	case OUTPUT_JUNIT:
+		_ = writeJUnit(stdout, runCases(testType, name, data, status, err))
+		return
+	}
+
+	if err != nil {
+		var ve *ValidationError
+		if errors.As(err, &ve) {
+			// Named by their flags
+			fmt.Fprintf(stderr, "%s: invalid request\n", testType)
+			for _, fe := range ve.Fields {
+				fmt.Fprintf(stderr, "  --%s %s\n", strings.ReplaceAll(fe.Field, "_", "-"), fe.Message)
+			}
+			return
+		}
+		if code := errorCode(err); code != "" {
+			fmt.Fprintf(stderr, "%s %s failed: %s %v\n", testType, name, code, err)
+		} else {
+			fmt.Fprintf(stderr, "%s %s failed: %v\n", testType, name, err)
+		}
+		return
+	}
+	for _, c := range runCases(testType, name, data, status, nil) {
+		fmt.Fprintf(stdout, "%s %s: %s in %.1f s\n", c.Type, c.Name, MESH_STATUS_OK, c.DurationSec)
+		tw := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+		for _, m := range c.Metrics {
+			fmt.Fprintf(tw, "  %s\t%s\n", m.Path, csvFloat(m.Value))
+		}
+		_ = tw.Flush()
+	}
+}
@@ -0,0 +1,62 @@
+package api
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestCLIValue(t *testing.T) {
+	cases := []struct {
+		t    reflect.Type
+		flag string
+		want string
+	}{
+		{reflect.TypeOf(""), "iperf.he.net", `"iperf.he.net"`},
+		{reflect.TypeOf(0), "10", `10`},
+		{reflect.TypeOf(0.0), "2.5", `2.5`},
+		{reflect.TypeOf(false), "true", `true`},
+		{reflect.TypeOf([]string{}), "db1:5432,db2:5432", `["db1:5432","db2:5432"]`},
+		{reflect.TypeOf([]int{}), "0, 500,1400", `[0,500,1400]`},
+		{reflect.TypeOf([]TwampSessionSpec{}), `[{"name":"voice","dscp":46}]`, `[{"name":"voice","dscp":46}]`},
+	}
+	for _, c := range cases {
+		v, err := cliValue(c.t, c.flag)
+		if err != nil {
+			t.Errorf("Unexpected error for %q as %v: %v", c.flag, c.t, err)
+			continue
+		}
+		if got, _ := json.Marshal(v); string(got) != c.want {
+			t.Errorf("Expected %s for %q as %v, got %s", c.want, c.flag, c.t, got)
+		}
+	}
+}
+
+func TestCLIValue_Invalid(t *testing.T) {
+	for _, c := range []struct {
+		t    reflect.Type
+		flag string
+	}{
+		{reflect.TypeOf(0), "ten"},
+		{reflect.TypeOf(false), "maybe"},
+		{reflect.TypeOf([]int{}), "1,x"},
+		{reflect.TypeOf([]TwampSessionSpec{}), "dscp=46"},
+	} {
+		if _, err := cliValue(c.t, c.flag); err == nil {
+			t.Errorf("Expected error for %q as %v", c.flag, c.t)
+		}
+	}
+}
+
+func TestCLIBody_FlagsOverrideBody(t *testing.T) {
+	raw, err := cliBody(`{"server_host":"a","duration":5}`, map[string]interface{}{"server_host": "b"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if string(raw) != `{"duration":5,"server_host":"b"}` {
+		t.Errorf("Expected the flag over the body, got %s", raw)
+	}
+	if _, err := cliBody(`[1]`, nil); err == nil {
+		t.Errorf("Expected error for a body that is not an object")
+	}
+}
@@ -0,0 +1,313 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Every setting is an environment variable, which CONFIG_FILE can set as
+// well: a JSON object whose keys are the variable names in lower case,
+// nested objects joining their keys with "_", so {"tls": {"cert_file": ...}}
+// sets TLS_CERT_FILE. The environment wins over the file, so a deployment
+// can override a shared file one variable at a time.
+const CONFIG_REDACTED = "********"
+
+// How a file value becomes an environment value
+const (
+	configString = iota // A string, number or boolean
+	configList          // An array of strings, joined with commas
+	configPairs         // An object of names to strings, as name=value pairs
+	configJSON          // Any JSON, kept as JSON text
+)
+
+// configSetting is a variable the agent reads
+type configSetting struct {
+	Name   string
+	Kind   int
+	Secret bool // Redacted by GET /config
+}
+
+var configSettings = []configSetting{
+	{Name: "LISTEN_ADDR"},
+	{Name: "AGENT_ID"},
+	{Name: "TLS_CERT_FILE"},
+	{Name: "TLS_KEY_FILE"},
+	{Name: "TLS_MIN_VERSION"},
+	{Name: "TLS_CLIENT_CA_FILE"},
+	{Name: "TLS_CLIENT_AUTH"},
+	{Name: "TLS_AUTOCERT_DOMAINS", Kind: configList},
+	{Name: "TLS_AUTOCERT_EMAIL"},
+	{Name: "TLS_AUTOCERT_CACHE_DIR"},
+	{Name: "TLS_AUTOCERT_DIRECTORY_URL"},
+	{Name: "TLS_AUTOCERT_HTTP_ADDR"},
+	{Name: "TLS_ROOT_STORES", Kind: configPairs},
+	{Name: "NDT7_LOCATE_URL"},
+	{Name: "RPM_CONFIG_URL"},
+	{Name: "ADMIN_TOKEN", Secret: true},
+	{Name: "API_KEYS_FILE"},
+	{Name: "API_KEYS", Kind: configPairs, Secret: true},
+	{Name: "API_KEYS_LOCAL_BYPASS"},
+	{Name: "TARGET_POLICY_FILE"},
+	{Name: "ALLOWED_TARGETS", Kind: configList},
+	{Name: "BLOCKED_TARGETS", Kind: configList},
+	{Name: "BLOCK_PRIVATE_TARGETS"},
+	{Name: "PROFILES_FILE"},
+	{Name: "PROFILES", Kind: configJSON},
+	{Name: "MAX_CONCURRENT_TESTS"},
+	{Name: "TEST_QUEUE_MODE"},
+	{Name: "TEST_TIMEOUT_MAX"},
+	{Name: "SHUTDOWN_GRACE_PERIOD"},
+	{Name: "RESULTS_FILE"},
+	{Name: "RESULTS_MAX"},
+	{Name: "SECRETS_FILE"},
+	{Name: "SSH_KNOWN_HOSTS"},
+	{Name: "TUNNELS_FILE"},
+	{Name: "NETEM_INTERFACES", Kind: configList},
+	{Name: "COORDINATOR_URL"},
+	{Name: "COORDINATOR_API_KEY", Secret: true},
+	{Name: "MESH_PEERS", Kind: configList},
+	{Name: "MESH_PEERS_DNS"},
+	{Name: "MESH_PEERS_SCHEME"},
+	{Name: "MESH_PEERS_API_KEY", Secret: true},
+	{Name: "WEBHOOK_MAX_ATTEMPTS"},
+	{Name: "WEBHOOK_BACKOFF"},
+	{Name: "WEBHOOK_MAX_BACKOFF"},
+	{Name: "WEBHOOK_TIMEOUT"},
+	{Name: "WEBHOOK_SECRET", Secret: true},
+	{Name: "ALERT_SMTP_ADDR"},
+	{Name: "ALERT_SMTP_FROM"},
+	{Name: "ALERT_SMTP_USERNAME"},
+	{Name: "ALERT_SMTP_PASSWORD", Secret: true},
+	{Name: "ESMOND_URL"},
+	{Name: "ESMOND_API_KEY", Secret: true},
+	{Name: "ESMOND_SOURCE"},
+	{Name: "INFLUX_URL"},
+	{Name: "INFLUX_ORG"},
+	{Name: "INFLUX_BUCKET"},
+	{Name: "INFLUX_TOKEN", Secret: true},
+	{Name: "INFLUX_MEASUREMENT"},
+	{Name: "OTEL_SDK_DISABLED"},
+	{Name: "OTEL_EXPORTER_OTLP_ENDPOINT"},
+	{Name: "OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"},
+	{Name: "OTEL_EXPORTER_OTLP_METRICS_ENDPOINT"},
+	{Name: "OTEL_EXPORTER_OTLP_PROTOCOL"},
+	{Name: "OTEL_EXPORTER_OTLP_HEADERS", Secret: true},
+	{Name: "OTEL_SERVICE_NAME"},
+	{Name: "OTEL_RESOURCE_ATTRIBUTES"},
+	{Name: "OTEL_METRIC_EXPORT_INTERVAL"},
+	{Name: "LOG_LEVEL"},
+	{Name: "LOG_FORMAT"},
+	{Name: "LEGACY_API_SUNSET"},
+}
+
+// configFile is CONFIG_FILE, and configFromFile the variables it set
+var (
+	configFile     string
+	configFromFile = map[string]bool{}
+)
+
+// lookupSetting returns the registered setting called name
+func lookupSetting(name string) (configSetting, bool) {
+	for _, s := range configSettings {
+		if s.Name == name {
+			return s, true
+		}
+	}
+	return configSetting{}, false
+}
+
+// loadConfig reads CONFIG_FILE, if set, into the variables the environment
+// does not set. It runs before any setting is read.
+func loadConfig() {
+	configFile = os.Getenv("CONFIG_FILE")
+	if configFile == "" {
+		return
+	}
+	info, err := os.Stat(configFile)
+	if err != nil {
+		log.Fatalf("Loading CONFIG_FILE failed: %v", err)
+	}
+	raw, err := os.ReadFile(configFile)
+	if err != nil {
+		log.Fatalf("Loading CONFIG_FILE failed: %v", err)
+	}
+	values, err := parseConfig(raw)
+	if err != nil {
+		log.Fatalf("Loading CONFIG_FILE failed: %v", err)
+	}
+
+	overridden := 0
+	for name, v := range values {
+		if s, _ := lookupSetting(name); s.Secret && info.Mode().Perm()&0o077 != 0 {
+			log.Printf("Warning: config file %s sets %s and is accessible by other users (mode %v)", configFile, name, info.Mode().Perm())
+		}
+		if _, set := os.LookupEnv(name); set {
+			overridden++
+			continue
+		}
+		os.Setenv(name, v)
+		configFromFile[name] = true
+	}
+	log.Printf("Loaded %d settings from %s (%d overridden by the environment)", len(values), configFile, overridden)
+}
+
+// parseConfig flattens a config file into environment values by variable name
+func parseConfig(raw []byte) (map[string]string, error) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var doc map[string]interface{}
+	if err := dec.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("parse: %w", err)
+	}
+	values := make(map[string]string)
+	if err := flattenConfig("", doc, values); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// flattenConfig adds the settings under obj, whose keys extend prefix
+func flattenConfig(prefix string, obj map[string]interface{}, values map[string]string) error {
+	for key, v := range obj {
+		name := strings.ToUpper(key)
+		if prefix != "" {
+			name = prefix + "_" + name
+		}
+		if s, ok := lookupSetting(name); ok {
+			value, err := configValue(s, v)
+			if err != nil {
+				return fmt.Errorf("%s: %w", key, err)
+			}
+			if _, dup := values[name]; dup {
+				return fmt.Errorf("%s is set twice", name)
+			}
+			values[name] = value
+			continue
+		}
+		nested, ok := v.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("unknown setting %s", name)
+		}
+		if err := flattenConfig(name, nested, values); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// configValue converts a file value into the variable's text
+func configValue(s configSetting, v interface{}) (string, error) {
+	switch s.Kind {
+	case configList:
+		items, ok := v.([]interface{})
+		if !ok {
+			break
+		}
+		texts := make([]string, len(items))
+		for i, item := range items {
+			text, ok := configScalar(item)
+			if !ok {
+				return "", fmt.Errorf("expected a list of strings")
+			}
+			texts[i] = text
+		}
+		return strings.Join(texts, ","), nil
+	case configPairs:
+		pairs, ok := v.(map[string]interface{})
+		if !ok {
+			break
+		}
+		texts := make([]string, 0, len(pairs))
+		for name, item := range pairs {
+			text, ok := configScalar(item)
+			if !ok {
+				return "", fmt.Errorf("expected an object of strings")
+			}
+			texts = append(texts, name+"="+text)
+		}
+		sort.Strings(texts)
+		return strings.Join(texts, ","), nil
+	case configJSON:
+		if text, ok := v.(string); ok {
+			return text, nil
+		}
+		raw, err := json.Marshal(v)
+		return string(raw), err
+	}
+	text, ok := configScalar(v)
+	if !ok {
+		return "", fmt.Errorf("expected a string, number or boolean")
+	}
+	return text, nil
+}
+
+// configScalar is the text of a string, number or boolean
+func configScalar(v interface{}) (string, bool) {
+	switch v := v.(type) {
+	case string:
+		return v, true
+	case json.Number:
+		return v.String(), true
+	case bool:
+		return fmt.Sprint(v), true
+	}
+	return "", false
+}
+
+// ConfigEntry is a setting as GET /config reports it
+type ConfigEntry struct {
+	Name   string `json:"name"`
+	Value  string `json:"value,omitempty"`  // Omitted when unset; secrets are redacted
+	Source string `json:"source"`           // env, file or default
+	Secret bool   `json:"secret,omitempty"` // Whether value is redacted
+}
+
+// ConfigReport is the effective configuration
+type ConfigReport struct {
+	File     string        `json:"file,omitempty"` // CONFIG_FILE
+	Settings []ConfigEntry `json:"settings"`
+}
+
+// redactSetting hides a secret value, keeping the names of name=value pairs
+func redactSetting(s configSetting, v string) string {
+	if !s.Secret || v == "" {
+		return v
+	}
+	if s.Kind != configPairs {
+		return CONFIG_REDACTED
+	}
+	pairs := strings.Split(v, ",")
+	for i, pair := range pairs {
+		if name, _, ok := strings.Cut(strings.TrimSpace(pair), "="); ok {
+			pairs[i] = name + "=" + CONFIG_REDACTED
+		} else {
+			pairs[i] = CONFIG_REDACTED
+		}
+	}
+	return strings.Join(pairs, ",")
+}
+
+func configGet(w http.ResponseWriter, r *http.Request) {
+	report := ConfigReport{File: configFile, Settings: make([]ConfigEntry, 0, len(configSettings))}
+	for _, s := range configSettings {
+		entry := ConfigEntry{Name: s.Name, Source: "default", Secret: s.Secret}
+		if v, set := os.LookupEnv(s.Name); set {
+			entry.Value = redactSetting(s, v)
+			entry.Source = "env"
+			if configFromFile[s.Name] {
+				entry.Source = "file"
+			}
+		}
+		report.Settings = append(report.Settings, entry)
+	}
+	jsonResponse(w, ApiResponse{
+		Status: "ok",
+		Data:   report,
+	}, http.StatusOK)
+}
@@ -0,0 +1,74 @@
+package api
+
+import (
+	"testing"
+)
+
+// testEnv is a getenv for the load*Config functions, reading vars
+func testEnv(vars map[string]string) func(string) string {
+	return func(key string) string { return vars[key] }
+}
+
+func TestParseConfig(t *testing.T) {
+	raw := []byte(`{
+		"listen_addr": ":8443",
+		"tls": {"cert_file": "/etc/tls.pem", "autocert": {"domains": ["a.example.net", "b.example.net"]}},
+		"api_keys": {"noc": "k2", "ci": "k1"},
+		"api_keys_file": "/etc/keys.json",
+		"max_concurrent_tests": 2,
+		"api_keys_local_bypass": false,
+		"profiles": {"profiles": [{"name": "all", "targets": ["*"]}]}
+	}`)
+	values, err := parseConfig(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"LISTEN_ADDR":           ":8443",
+		"TLS_CERT_FILE":         "/etc/tls.pem",
+		"TLS_AUTOCERT_DOMAINS":  "a.example.net,b.example.net",
+		"API_KEYS":              "ci=k1,noc=k2",
+		"API_KEYS_FILE":         "/etc/keys.json",
+		"MAX_CONCURRENT_TESTS":  "2",
+		"API_KEYS_LOCAL_BYPASS": "false",
+		"PROFILES":              `{"profiles":[{"name":"all","targets":["*"]}]}`,
+	}
+	if len(values) != len(want) {
+		t.Errorf("expected %d settings, got %v", len(want), values)
+	}
+	for name, v := range want {
+		if values[name] != v {
+			t.Errorf("expected %s=%q, got %q", name, v, values[name])
+		}
+	}
+}
+
+func TestParseConfigErrors(t *testing.T) {
+	for _, raw := range []string{
+		`{"listen_adr": ":8080"}`,
+		`{"tls": {"cert": "/etc/tls.pem"}}`,
+		`{"listen_addr": [":8080"]}`,
+		`{"tls": {"autocert": {"domains": [{"name": "a.example.net"}]}}}`,
+		`{"listen_addr": ":8080", "listen": {"addr": ":8081"}}`,
+		`listen_addr: ":8080"`,
+	} {
+		if _, err := parseConfig([]byte(raw)); err == nil {
+			t.Errorf("expected %s to be rejected", raw)
+		}
+	}
+}
+
+func TestRedactSetting(t *testing.T) {
+	keys, _ := lookupSetting("API_KEYS")
+	if got := redactSetting(keys, "ci=k1, noc=k2"); got != "ci=********,noc=********" {
+		t.Errorf("expected the key names to be kept, got %q", got)
+	}
+	token, _ := lookupSetting("ADMIN_TOKEN")
+	if got := redactSetting(token, "secret"); got != CONFIG_REDACTED {
+		t.Errorf("expected the token to be redacted, got %q", got)
+	}
+	addr, _ := lookupSetting("LISTEN_ADDR")
+	if got := redactSetting(addr, ":8080"); got != ":8080" {
+		t.Errorf("expected LISTEN_ADDR to be shown, got %q", got)
+	}
+}
@@ -0,0 +1,487 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Bandwidth-heavy tests take a lease on the resources they load, so agents
+// sharing a server or an uplink run them one at a time, and every test takes
+// one on its server_host:port so an agent never runs two against it at once
+const (
+	LOCK_LEASE_TTL      = 30 * time.Second // Renewed while the test runs; frees the lock if the agent dies
+	LOCK_RENEW_INTERVAL = 10 * time.Second
+	LOCK_POLL_INTERVAL  = time.Second
+	MAX_LOCK_LEASE_TTL  = 10 * time.Minute
+
+	DEFAULT_LOCK_WAIT = 60  // Seconds to wait for busy resources
+	MAX_LOCK_WAIT     = 600 // Seconds
+
+	LOCK_RESOURCE_SERVER = "server:"
+	LOCK_RESOURCE_UPLINK = "uplink:"
+	LOCK_RESOURCE_TARGET = "target:" // server_host:port, only ever locked on this agent
+)
+
+// Lease is a lock held on a set of resources until released or expired
+type Lease struct {
+	Token      string    `json:"token"`
+	Holder     string    `json:"holder"`
+	Test       string    `json:"test,omitempty"`
+	Resources  []string  `json:"resources"`
+	AcquiredAt time.Time `json:"acquired_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+
+	ttl time.Duration
+}
+
+// LockRequest is the body of POST /locks
+type LockRequest struct {
+	Resources []string `json:"resources"`
+	Holder    string   `json:"holder"`
+	Test      string   `json:"test"`
+	TTLSec    int      `json:"ttl_sec"` // Lease lifetime without renewal (default: 30)
+}
+
+// LockInfo describes the lock a test ran under, returned as data.lock
+type LockInfo struct {
+	Resources   []string `json:"resources"`
+	Coordinator string   `json:"coordinator"` // local, or the coordinator URL
+	WaitedMs    float64  `json:"waited_ms"`
+}
+
+// LockManager grants all-or-nothing leases on named resources
+type LockManager struct {
+	mu         sync.Mutex
+	byToken    map[string]*Lease
+	byResource map[string]string // Resource -> token
+}
+
+// NewLockManager creates a manager with no leases
+func NewLockManager() *LockManager {
+	return &LockManager{byToken: make(map[string]*Lease), byResource: make(map[string]string)}
+}
+
+var lockManager = NewLockManager()
+
+// expire drops leases that were not renewed in time
+func (m *LockManager) expire(now time.Time) {
+	for token, l := range m.byToken {
+		if now.Before(l.ExpiresAt) {
+			continue
+		}
+		for _, r := range l.Resources {
+			delete(m.byResource, r)
+		}
+		delete(m.byToken, token)
+	}
+}
+
+// Acquire grants a lease on all resources, or returns the lease holding one of them
+func (m *LockManager) Acquire(lr LockRequest, ttl time.Duration, now time.Time) (granted, conflict *Lease) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.expire(now)
+	for _, r := range lr.Resources {
+		if token, held := m.byResource[r]; held {
+			c := *m.byToken[token]
+			return nil, &c
+		}
+	}
+	l := &Lease{
+		Token:      newResultID(),
+		Holder:     lr.Holder,
+		Test:       lr.Test,
+		Resources:  lr.Resources,
+		AcquiredAt: now,
+		ExpiresAt:  now.Add(ttl),
+		ttl:        ttl,
+	}
+	m.byToken[l.Token] = l
+	for _, r := range l.Resources {
+		m.byResource[r] = l.Token
+	}
+	c := *l
+	return &c, nil
+}
+
+// Renew extends a lease that has not expired yet by its TTL
+func (m *LockManager) Renew(token string, now time.Time) (*Lease, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.expire(now)
+	l, ok := m.byToken[token]
+	if !ok {
+		return nil, false
+	}
+	l.ExpiresAt = now.Add(l.ttl)
+	c := *l
+	return &c, true
+}
+
+// Release frees the resources of a lease
+func (m *LockManager) Release(token string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	l, ok := m.byToken[token]
+	if !ok {
+		return false
+	}
+	for _, r := range l.Resources {
+		delete(m.byResource, r)
+	}
+	delete(m.byToken, token)
+	return true
+}
+
+// List returns the current leases, oldest first
+func (m *LockManager) List(now time.Time) []*Lease {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.expire(now)
+	list := make([]*Lease, 0, len(m.byToken))
+	for _, l := range m.byToken {
+		c := *l
+		list = append(list, &c)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].AcquiredAt.Before(list[j].AcquiredAt) })
+	return list
+}
+
+// lockBackend is where test leases are taken: this agent's own LockManager,
+// or a coordinator shared by several agents
+type lockBackend interface {
+	acquire(lr LockRequest) (granted, conflict *Lease, err error)
+	renew(token string) error
+	release(token string) error
+	name() string
+}
+
+type localLocks struct{ m *LockManager }
+
+func (b localLocks) acquire(lr LockRequest) (*Lease, *Lease, error) {
+	granted, conflict := b.m.Acquire(lr, LOCK_LEASE_TTL, time.Now().UTC())
+	return granted, conflict, nil
+}
+
+func (b localLocks) renew(token string) error {
+	if _, ok := b.m.Renew(token, time.Now().UTC()); !ok {
+		return fmt.Errorf("lease %s expired", token)
+	}
+	return nil
+}
+
+func (b localLocks) release(token string) error {
+	b.m.Release(token)
+	return nil
+}
+
+func (b localLocks) name() string { return "local" }
+
+// remoteLocks takes leases from another agent's /locks endpoints
+type remoteLocks struct {
+	url    string
+	apiKey string // COORDINATOR_API_KEY, for a coordinator with API keys
+	client *http.Client
+}
+
+// leaseResponse is an ApiResponse carrying a lease
+type leaseResponse struct {
+	Status string `json:"status"`
+	Data   *Lease `json:"data"`
+	Error  string `json:"error"`
+}
+
+func (b remoteLocks) call(method, path string, body interface{}) (int, *leaseResponse, error) {
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			return 0, nil, err
+		}
+	}
+	req, err := http.NewRequest(method, b.url+path, &buf)
+	if err != nil {
+		return 0, nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if b.apiKey != "" {
+		req.Header.Set(API_KEY_HEADER, b.apiKey)
+	}
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	var lr leaseResponse
+	if err := json.NewDecoder(resp.Body).Decode(&lr); err != nil {
+		return resp.StatusCode, nil, fmt.Errorf("decode coordinator response: %v", err)
+	}
+	return resp.StatusCode, &lr, nil
+}
+
+func (b remoteLocks) acquire(lr LockRequest) (*Lease, *Lease, error) {
+	lr.TTLSec = int(LOCK_LEASE_TTL / time.Second)
+	status, resp, err := b.call(http.MethodPost, "/locks", lr)
+	switch {
+	case err != nil:
+		return nil, nil, err
+	case status == http.StatusOK:
+		return resp.Data, nil, nil
+	case status == http.StatusConflict:
+		return nil, resp.Data, nil
+	}
+	return nil, nil, fmt.Errorf("coordinator returned %d: %s", status, resp.Error)
+}
+
+func (b remoteLocks) renew(token string) error {
+	status, resp, err := b.call(http.MethodPost, "/locks/"+token+"/renew", nil)
+	if err == nil && status != http.StatusOK {
+		err = fmt.Errorf("coordinator returned %d: %s", status, resp.Error)
+	}
+	return err
+}
+
+func (b remoteLocks) release(token string) error {
+	_, _, err := b.call(http.MethodDelete, "/locks/"+token, nil)
+	return err
+}
+
+func (b remoteLocks) name() string { return b.url }
+
+var (
+	testLocks lockBackend = localLocks{lockManager}
+	agentID               = defaultAgentID()
+)
+
+func defaultAgentID() string {
+	if id := os.Getenv("AGENT_ID"); id != "" {
+		return id
+	}
+	if host, err := os.Hostname(); err == nil {
+		return host
+	}
+	return "agent"
+}
+
+// configureCoordination points test locks at COORDINATOR_URL when it is set
+func configureCoordination() {
+	url := strings.TrimRight(os.Getenv("COORDINATOR_URL"), "/")
+	if url == "" {
+		return
+	}
+	testLocks = remoteLocks{url: url, apiKey: os.Getenv("COORDINATOR_API_KEY"), client: checkedHTTPClient(5 * time.Second)}
+	log.Printf("Coordinating heavy tests through %s as %s", url, agentID)
+}
+
+// lockResources names the resources a heavy test to req's target loads
+func lockResources(req RunRequest) []string {
+	resources := []string{LOCK_RESOURCE_SERVER + strings.ToLower(req.ServerHost)}
+	if req.Uplink != "" {
+		resources = append(resources, LOCK_RESOURCE_UPLINK+req.Uplink)
+	}
+	return resources
+}
+
+// targetResource names the server_host:port a test runs against
+func targetResource(req RunRequest) string {
+	return LOCK_RESOURCE_TARGET + net.JoinHostPort(strings.ToLower(req.ServerHost), strconv.Itoa(req.ServerPort))
+}
+
+// validateLockWait checks the request's lock_wait, defaulting it
+func validateLockWait(req *RunRequest) error {
+	if req.LockWait == 0 {
+		req.LockWait = DEFAULT_LOCK_WAIT
+	}
+	if req.LockWait < 0 || req.LockWait > MAX_LOCK_WAIT {
+		return fmt.Errorf("lock_wait must be between 1 and %d seconds", MAX_LOCK_WAIT)
+	}
+	return nil
+}
+
+// lockTest serializes a test with the others to the same server_host:port on
+// this agent, unless req.AllowConcurrent, and heavy tests also take the lock on
+// their server and uplink from testLocks. Both waits share req.LockWait seconds,
+// and the leases are renewed until the returned release func is called.
+// Errors come with the HTTP status to report them with; with nothing to lock
+// the LockInfo is nil.
+func lockTest(testType string, req RunRequest, heavy bool) (*LockInfo, func(), int, error) {
+	test := fmt.Sprintf("%s to %s", testType, net.JoinHostPort(req.ServerHost, strconv.Itoa(req.ServerPort)))
+	start := time.Now()
+	deadline := start.Add(time.Duration(req.LockWait) * time.Second)
+
+	var info *LockInfo
+	var releases []func()
+	release := func() {
+		for i := len(releases) - 1; i >= 0; i-- {
+			releases[i]()
+		}
+	}
+	take := func(b lockBackend, resources []string) (int, error) {
+		lease, status, err := waitForLease(req.runContext(), b, LockRequest{Resources: resources, Holder: agentID, Test: test}, req.LockWait, deadline)
+		if err != nil {
+			return status, err
+		}
+		if info == nil {
+			info = &LockInfo{Coordinator: b.name()}
+		} else {
+			info.Coordinator = b.name()
+		}
+		info.Resources = append(info.Resources, lease.Resources...)
+		releases = append(releases, keepLease(b, lease.Token))
+		return http.StatusOK, nil
+	}
+
+	// Target first, so tests waiting for a busy target hold no coordinated lock
+	if !req.AllowConcurrent {
+		if status, err := take(localLocks{lockManager}, []string{targetResource(req)}); err != nil {
+			return nil, nil, status, err
+		}
+	}
+	if heavy {
+		if status, err := take(testLocks, lockResources(req)); err != nil {
+			release()
+			return nil, nil, status, err
+		}
+	}
+	if info != nil {
+		info.WaitedMs = float64(time.Since(start).Microseconds()) / 1000
+	}
+	return info, release, http.StatusOK, nil
+}
+
+// waitForLease polls b until it grants lr, the deadline passes or ctx ends
+func waitForLease(ctx context.Context, b lockBackend, lr LockRequest, wait int, deadline time.Time) (*Lease, int, error) {
+	for {
+		lease, conflict, err := b.acquire(lr)
+		if err != nil {
+			return nil, http.StatusServiceUnavailable, fmt.Errorf("coordinator unavailable: %v", err)
+		}
+		if lease != nil {
+			return lease, http.StatusOK, nil
+		}
+		if !time.Now().Add(LOCK_POLL_INTERVAL).Before(deadline) {
+			return nil, http.StatusConflict, fmt.Errorf("resources busy after waiting %ds: %s held by %s (%s)",
+				wait, strings.Join(conflict.Resources, ", "), conflict.Holder, conflict.Test)
+		}
+		select {
+		case <-ctx.Done():
+			return nil, http.StatusConflict, canceledError(ctx)
+		case <-time.After(LOCK_POLL_INTERVAL):
+		}
+	}
+}
+
+// keepLease renews a lease in the background; the returned func stops renewal and releases it
+func keepLease(b lockBackend, token string) func() {
+	stop := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(LOCK_RENEW_INTERVAL)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				if err := b.renew(token); err != nil {
+					log.Printf("Renewing test lock %s failed: %v", token, err)
+				}
+			}
+		}
+	}()
+	return func() {
+		close(stop)
+		if err := b.release(token); err != nil {
+			log.Printf("Releasing test lock %s failed: %v", token, err)
+		}
+	}
+}
+
+func lockNotFound(w http.ResponseWriter, token string) {
+	jsonResponse(w, ApiResponse{
+		Status: "error",
+		Error:  fmt.Sprintf("lock %s not found", token),
+	}, http.StatusNotFound)
+}
+
+func lockList(w http.ResponseWriter, r *http.Request) {
+	jsonResponse(w, ApiResponse{
+		Status: "ok",
+		Data:   lockManager.List(time.Now().UTC()),
+	}, http.StatusOK)
+}
+
+func lockAcquire(w http.ResponseWriter, r *http.Request) {
+	var lr LockRequest
+	if err := json.NewDecoder(r.Body).Decode(&lr); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	ttl := LOCK_LEASE_TTL
+	if lr.TTLSec != 0 {
+		ttl = time.Duration(lr.TTLSec) * time.Second
+	}
+	var err error
+	switch {
+	case len(lr.Resources) == 0:
+		err = fmt.Errorf("resources is required")
+	case lr.Holder == "":
+		err = fmt.Errorf("holder is required")
+	case ttl <= 0 || ttl > MAX_LOCK_LEASE_TTL:
+		err = fmt.Errorf("ttl_sec must be between 1 and %d", int(MAX_LOCK_LEASE_TTL/time.Second))
+	}
+	if err != nil {
+		jsonResponse(w, ApiResponse{
+			Status: "error",
+			Error:  err.Error(),
+		}, http.StatusBadRequest)
+		return
+	}
+
+	granted, conflict := lockManager.Acquire(lr, ttl, time.Now().UTC())
+	if conflict != nil {
+		jsonResponse(w, ApiResponse{
+			Status: "error",
+			Data:   conflict,
+			Error:  fmt.Sprintf("%s held by %s", strings.Join(conflict.Resources, ", "), conflict.Holder),
+		}, http.StatusConflict)
+		return
+	}
+	jsonResponse(w, ApiResponse{
+		Status: "ok",
+		Data:   granted,
+	}, http.StatusOK)
+}
+
+func lockRenew(w http.ResponseWriter, r *http.Request) {
+	token := mux.Vars(r)["token"]
+	lease, ok := lockManager.Renew(token, time.Now().UTC())
+	if !ok {
+		lockNotFound(w, token)
+		return
+	}
+	jsonResponse(w, ApiResponse{
+		Status: "ok",
+		Data:   lease,
+	}, http.StatusOK)
+}
+
+func lockRelease(w http.ResponseWriter, r *http.Request) {
+	token := mux.Vars(r)["token"]
+	if !lockManager.Release(token) {
+		lockNotFound(w, token)
+		return
+	}
+	jsonResponse(w, ApiResponse{Status: "ok"}, http.StatusOK)
+}
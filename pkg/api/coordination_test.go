@@ -0,0 +1,69 @@
+package api
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLockSharedUplinkConflicts(t *testing.T) {
+	m := NewLockManager()
+	now := time.Date(2026, 1, 15, 10, 0, 0, 0, time.UTC)
+	ttl := 30 * time.Second
+
+	a, _ := m.Acquire(LockRequest{Holder: "agent-a", Resources: []string{"server:iperf-1", "uplink:fra1"}}, ttl, now)
+	if a == nil {
+		t.Fatalf("Expected first lock to be granted")
+	}
+
+	// Different server, same uplink
+	b, conflict := m.Acquire(LockRequest{Holder: "agent-b", Resources: []string{"server:iperf-2", "uplink:fra1"}}, ttl, now)
+	if b != nil || conflict == nil || conflict.Holder != "agent-a" {
+		t.Errorf("Expected conflict with agent-a on the shared uplink")
+	}
+
+	// Nothing of the failed request may stay locked
+	c, _ := m.Acquire(LockRequest{Holder: "agent-c", Resources: []string{"server:iperf-2"}}, ttl, now)
+	if c == nil {
+		t.Errorf("Expected server:iperf-2 to be free after a failed all-or-nothing acquire")
+	}
+
+	m.Release(a.Token)
+	b, _ = m.Acquire(LockRequest{Holder: "agent-b", Resources: []string{"uplink:fra1"}}, ttl, now)
+	if b == nil {
+		t.Errorf("Expected uplink to be free after release")
+	}
+}
+
+func TestLockLeaseExpires(t *testing.T) {
+	m := NewLockManager()
+	now := time.Date(2026, 1, 15, 10, 0, 0, 0, time.UTC)
+	ttl := 30 * time.Second
+
+	m.Acquire(LockRequest{Holder: "agent-a", Resources: []string{"server:iperf-1"}}, ttl, now)
+	if l, _ := m.Acquire(LockRequest{Holder: "agent-b", Resources: []string{"server:iperf-1"}}, ttl, now.Add(ttl-time.Second)); l != nil {
+		t.Errorf("Expected lease to hold before its TTL")
+	}
+	if l, _ := m.Acquire(LockRequest{Holder: "agent-b", Resources: []string{"server:iperf-1"}}, ttl, now.Add(ttl)); l == nil {
+		t.Errorf("Expected lease of a dead agent to expire after its TTL")
+	}
+}
+
+func TestLockTargetResource(t *testing.T) {
+	if got := targetResource(RunRequest{ServerHost: "IPERF.example.net", ServerPort: 5201}); got != "target:iperf.example.net:5201" {
+		t.Errorf("Expected target:iperf.example.net:5201, got %s", got)
+	}
+	if got := targetResource(RunRequest{ServerHost: "2001:db8::1", ServerPort: 862}); got != "target:[2001:db8::1]:862" {
+		t.Errorf("Expected target:[2001:db8::1]:862, got %s", got)
+	}
+
+	// Same host, different ports: an iperf3 and a TWAMP server may share a host
+	m := NewLockManager()
+	now := time.Date(2026, 1, 15, 10, 0, 0, 0, time.UTC)
+	m.Acquire(LockRequest{Holder: "agent-a", Resources: []string{targetResource(RunRequest{ServerHost: "perf-1", ServerPort: 5201})}}, 30*time.Second, now)
+	if l, _ := m.Acquire(LockRequest{Holder: "agent-a", Resources: []string{targetResource(RunRequest{ServerHost: "perf-1", ServerPort: 862})}}, 30*time.Second, now); l == nil {
+		t.Errorf("Expected a test to another port of the same host to run")
+	}
+	if l, _ := m.Acquire(LockRequest{Holder: "agent-a", Resources: []string{targetResource(RunRequest{ServerHost: "PERF-1", ServerPort: 5201})}}, 30*time.Second, now); l != nil {
+		t.Errorf("Expected a second test to the same host and port to wait")
+	}
+}
@@ -0,0 +1,45 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"network-test-api/pkg/nettest"
+)
+
+// parseAddressFamily validates the request's address family, defaulting to auto
+func parseAddressFamily(s string) (string, error) {
+	switch family := strings.ToLower(s); family {
+	case "":
+		return nettest.FAMILY_AUTO, nil
+	case nettest.FAMILY_AUTO, nettest.FAMILY_IPV4, nettest.FAMILY_IPV6, nettest.FAMILY_COMPARE:
+		return family, nil
+	}
+	return "", fmt.Errorf("invalid address_family %q (expected auto, ipv4, ipv6 or compare)", s)
+}
+
+// ipVersionFamily is the address_family of an ip_version, 4, 6 or auto as a
+// number or a string, "" when none is set
+func ipVersionFamily(version json.RawMessage) (string, error) {
+	if len(version) == 0 || string(version) == "null" {
+		return "", nil
+	}
+	switch strings.ToLower(strings.Trim(string(version), `"`)) {
+	case "4":
+		return nettest.FAMILY_IPV4, nil
+	case "6":
+		return nettest.FAMILY_IPV6, nil
+	case nettest.FAMILY_AUTO:
+		return nettest.FAMILY_AUTO, nil
+	}
+	return "", fmt.Errorf("invalid ip_version %s (expected 4, 6 or auto)", version)
+}
+
+// applyIPVersion maps a request's ip_version onto address_family, which it
+// overrides. An invalid one is left for validateRunRequest to report.
+func applyIPVersion(req *RunRequest) {
+	if family, err := ipVersionFamily(req.IPVersion); err == nil && family != "" {
+		req.AddressFamily = family
+	}
+}
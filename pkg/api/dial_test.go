@@ -0,0 +1,62 @@
+package api
+
+import (
+	"encoding/json"
+	"testing"
+
+	"network-test-api/pkg/nettest"
+)
+
+func TestParseAddressFamily(t *testing.T) {
+	family, err := parseAddressFamily("")
+	if err != nil || family != nettest.FAMILY_AUTO {
+		t.Errorf("Expected default auto, got %q (%v)", family, err)
+	}
+
+	family, err = parseAddressFamily("IPv6")
+	if err != nil || family != nettest.FAMILY_IPV6 {
+		t.Errorf("Expected ipv6, got %q (%v)", family, err)
+	}
+
+	if _, err := parseAddressFamily("ipx"); err == nil {
+		t.Error("Expected error for invalid address family")
+	}
+}
+
+func TestApplyIPVersion(t *testing.T) {
+	tests := []struct {
+		body    string
+		want    string
+		wantErr bool
+	}{
+		{`{}`, "", false},
+		{`{"address_family": "compare"}`, "compare", false},
+		{`{"ip_version": 4}`, nettest.FAMILY_IPV4, false},
+		{`{"ip_version": "6"}`, nettest.FAMILY_IPV6, false},
+		{`{"ip_version": "AUTO", "address_family": "ipv4"}`, nettest.FAMILY_AUTO, false}, // ip_version wins
+		{`{"ip_version": null, "address_family": "ipv6"}`, nettest.FAMILY_IPV6, false},
+		{`{"ip_version": 5, "address_family": "ipv6"}`, nettest.FAMILY_IPV6, true},
+		{`{"ip_version": "ipv4"}`, "", true},
+		{`{"ip_version": "x"}`, "", true},
+	}
+	for _, tt := range tests {
+		var req RunRequest
+		if err := json.Unmarshal([]byte(tt.body), &req); err != nil {
+			t.Fatalf("Failed to decode %s: %v", tt.body, err)
+		}
+		applyIPVersion(&req)
+		if req.AddressFamily != tt.want {
+			t.Errorf("Expected address family %q for %s, got %q", tt.want, tt.body, req.AddressFamily)
+		}
+
+		v := &requestValidator{}
+		v.ipVersion(req.IPVersion)
+		fields := v.fields
+		switch {
+		case tt.wantErr && (len(fields) != 1 || fields[0].Field != "ip_version"):
+			t.Errorf("Expected an ip_version field error for %s, got %+v", tt.body, fields)
+		case !tt.wantErr && len(fields) > 0:
+			t.Errorf("Expected %s to be valid, got %+v", tt.body, fields)
+		}
+	}
+}
@@ -0,0 +1,6 @@
+// Package api is the network test agent: the HTTP API and command line mode,
+// the test types behind them, the result, job and schedule stores and the
+// exports to webhooks, archives and metrics systems. It drives the clients of
+// pkg/nettest and the analysis of pkg/stats and pkg/twampstats; Main is all the
+// network-test-api binary runs.
+package api
@@ -0,0 +1,151 @@
+package api
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"network-test-api/pkg/nettest"
+)
+
+// Dual-stack runs repeat an iperf3 or TWAMP test over IPv4 and IPv6 and compare the two
+const (
+	DUAL_STACK_SEQUENTIAL = "sequential" // IPv4 first, then IPv6
+	DUAL_STACK_CONCURRENT = "concurrent" // Both at once, for tests that do not load the path
+)
+
+// parseDualStack validates dual_stack; empty means a single run
+func parseDualStack(s string) (string, error) {
+	switch mode := strings.ToLower(s); mode {
+	case "", DUAL_STACK_SEQUENTIAL, DUAL_STACK_CONCURRENT:
+		return mode, nil
+	}
+	return "", fmt.Errorf("invalid dual_stack %q (expected sequential or concurrent)", s)
+}
+
+// validateDualStack checks the fields of a dual-stack request. concurrentOK
+// says whether the test is light enough to run over both families at once.
+func validateDualStack(req *RunRequest, concurrentOK bool) error {
+	mode, err := parseDualStack(req.DualStack)
+	if err != nil {
+		return err
+	}
+	req.DualStack = mode
+	if req.DualStackThreshold == 0 {
+		req.DualStackThreshold = DEFAULT_DIFF_THRESHOLD
+	}
+	switch {
+	case req.AddressFamily != "" && strings.ToLower(req.AddressFamily) != nettest.FAMILY_AUTO:
+		return fmt.Errorf("dual_stack runs over ipv4 and ipv6; leave address_family unset")
+	case net.ParseIP(req.ServerHost) != nil:
+		return fmt.Errorf("dual_stack needs a host name with IPv4 and IPv6 addresses, not an IP address")
+	case mode == DUAL_STACK_CONCURRENT && !concurrentOK:
+		return fmt.Errorf("concurrent dual_stack is only available for TWAMP full mode; other tests would compete for the path")
+	case req.DualStackThreshold < 0:
+		return fmt.Errorf("dual_stack_threshold must be a non-negative percentage")
+	}
+	return validateLockWait(req)
+}
+
+// dualStackRun is the outcome of one family's run
+type dualStackRun struct {
+	data   map[string]interface{}
+	status int
+	err    error
+}
+
+// entry is the run's result data, or its error in the same shape as an error response
+func (r dualStackRun) entry() map[string]interface{} {
+	if r.err != nil {
+		entry := map[string]interface{}{"error": r.err.Error()}
+		if code := errorCode(r.err); code != "" {
+			entry["code"] = code
+		}
+		return entry
+	}
+	return r.data
+}
+
+// storedRun returns the stored copy of a successful run, for comparison
+func (r dualStackRun) storedRun() (*StoredResult, bool) {
+	if r.err != nil {
+		return nil, false
+	}
+	id, _ := r.data["id"].(string)
+	return resultStore.Get(id)
+}
+
+// runDualStack runs an already defaulted request over IPv4 and IPv6 with run and
+// compares the IPv6 result against the IPv4 one. Each run is stored on its own;
+// the target stays locked from the first run to the last, so no other test to it
+// runs in between.
+func runDualStack(testType string, run func(RunRequest, *Profile) (map[string]interface{}, int, error), req RunRequest, profile *Profile, concurrentOK bool) (map[string]interface{}, int, error) {
+	if err := validateDualStack(&req, concurrentOK); err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	lock, release, status, err := lockTest(testType, req, false)
+	if err != nil {
+		return nil, status, err
+	}
+	defer release()
+
+	logf(req.ctx, "Dual-stack %s test: %s:%d (%s)", testType, req.ServerHost, req.ServerPort, req.DualStack)
+
+	start := time.Now()
+	familyRequest := func(family string) RunRequest {
+		r := req
+		r.DualStack, r.AddressFamily, r.AllowConcurrent = "", family, true
+		r.progress = nil // Samples of the two runs would interleave
+		return r
+	}
+	var v4, v6 dualStackRun
+	if req.DualStack == DUAL_STACK_CONCURRENT {
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			v4.data, v4.status, v4.err = run(familyRequest(nettest.FAMILY_IPV4), profile)
+		}()
+		go func() {
+			defer wg.Done()
+			v6.data, v6.status, v6.err = run(familyRequest(nettest.FAMILY_IPV6), profile)
+		}()
+		wg.Wait()
+	} else {
+		v4.data, v4.status, v4.err = run(familyRequest(nettest.FAMILY_IPV4), profile)
+		if v4.status == http.StatusBadRequest {
+			// The IPv6 request is the same, so it would be rejected too
+			return nil, v4.status, v4.err
+		}
+		v6.data, v6.status, v6.err = run(familyRequest(nettest.FAMILY_IPV6), profile)
+	}
+	if v4.err != nil && v6.err != nil {
+		return nil, v4.status, fmt.Errorf("ipv4: %v; ipv6: %v", v4.err, v6.err)
+	}
+
+	data := map[string]interface{}{
+		"server":       req.ServerHost,
+		"port":         req.ServerPort,
+		"type":         testType,
+		"dual_stack":   req.DualStack,
+		"duration_sec": time.Since(start).Seconds(),
+		"ipv4":         v4.entry(),
+		"ipv6":         v6.entry(),
+	}
+	base, ok4 := v4.storedRun()
+	compare, ok6 := v6.storedRun()
+	if ok4 && ok6 {
+		diff := diffResults(base, compare, req.DualStackThreshold)
+		data["comparison"] = diff
+		data["ipv6_parity"] = diff.Summary.Regressions == 0
+	}
+	if profile != nil {
+		data["profile"] = profile.Name
+	}
+	data["lock"] = lock
+	return data, http.StatusOK, nil
+}
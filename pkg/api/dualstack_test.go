@@ -0,0 +1,70 @@
+package api
+
+import (
+	"testing"
+
+	"network-test-api/pkg/nettest"
+)
+
+// checkDualStackTarget validates a dual_stack run of mode to host with validateDualStack
+func checkDualStackTarget(host, family, mode string, concurrentOK bool) error {
+	req := RunRequest{ServerHost: host, AddressFamily: family, DualStack: mode}
+	return validateDualStack(&req, concurrentOK)
+}
+
+func TestParseDualStack(t *testing.T) {
+	mode, err := parseDualStack("")
+	if err != nil || mode != "" {
+		t.Errorf("Expected empty mode for a single run, got %q (%v)", mode, err)
+	}
+
+	mode, err = parseDualStack("Concurrent")
+	if err != nil || mode != DUAL_STACK_CONCURRENT {
+		t.Errorf("Expected concurrent, got %q (%v)", mode, err)
+	}
+
+	if _, err := parseDualStack("parallel"); err == nil {
+		t.Error("Expected error for unknown dual_stack mode")
+	}
+}
+
+func TestDualStackThreshold(t *testing.T) {
+	req := RunRequest{ServerHost: "iperf.example.com", DualStack: DUAL_STACK_SEQUENTIAL}
+	if err := validateDualStack(&req, false); err != nil {
+		t.Fatalf("Expected the default threshold to be accepted, got %v", err)
+	}
+	if req.DualStackThreshold != DEFAULT_DIFF_THRESHOLD {
+		t.Errorf("Expected the default threshold %v, got %v", DEFAULT_DIFF_THRESHOLD, req.DualStackThreshold)
+	}
+
+	req = RunRequest{ServerHost: "iperf.example.com", DualStack: DUAL_STACK_SEQUENTIAL, DualStackThreshold: -5}
+	if err := validateDualStack(&req, false); err == nil {
+		t.Error("Expected error for a negative dual_stack_threshold")
+	}
+}
+
+func TestDualStackTarget(t *testing.T) {
+	if err := checkDualStackTarget("iperf.example.com", "", DUAL_STACK_SEQUENTIAL, false); err != nil {
+		t.Errorf("Expected host name to be accepted, got %v", err)
+	}
+	if err := checkDualStackTarget("iperf.example.com", "auto", DUAL_STACK_SEQUENTIAL, false); err != nil {
+		t.Errorf("Expected address_family auto to be accepted, got %v", err)
+	}
+
+	for _, host := range []string{"192.0.2.10", "2001:db8::10"} {
+		if err := checkDualStackTarget(host, "", DUAL_STACK_SEQUENTIAL, false); err == nil {
+			t.Errorf("Expected error for IP literal %s", host)
+		}
+	}
+
+	if err := checkDualStackTarget("iperf.example.com", nettest.FAMILY_IPV6, DUAL_STACK_SEQUENTIAL, false); err == nil {
+		t.Error("Expected error for a fixed address_family")
+	}
+
+	if err := checkDualStackTarget("twamp.example.com", "", DUAL_STACK_CONCURRENT, false); err == nil {
+		t.Error("Expected error for concurrent runs of a test that loads the path")
+	}
+	if err := checkDualStackTarget("twamp.example.com", "", DUAL_STACK_CONCURRENT, true); err != nil {
+		t.Errorf("Expected concurrent TWAMP full mode to be accepted, got %v", err)
+	}
+}
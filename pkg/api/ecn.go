@@ -0,0 +1,50 @@
+package api
+
+import (
+	"strings"
+
+	"network-test-api/pkg/nettest"
+)
+
+// iperf3ECN checks that an iperf3 request with ecn set can negotiate ECN
+func (v *requestValidator) iperf3ECN(req RunRequest) {
+	switch {
+	case !req.ECN:
+	case !nettest.ECNSupported:
+		v.fail("ecn", true, "is only available on Linux agents")
+	case !strings.EqualFold(req.Protocol, "TCP"):
+		v.fail("ecn", true, "requires protocol TCP; use TWAMP loss mode with ecn for UDP")
+	default:
+		// Linux has no per-socket switch; the SYN asks for ECN when the sysctl says so
+		if setting, ok := nettest.TCPECNSetting(); ok && !nettest.TCPECNRequests(setting) {
+			v.fail("ecn", true, "needs net.ipv4.tcp_ecn=1 on the agent to request ECN (currently %d)", setting)
+		}
+	}
+}
+
+// twampECN checks that a TWAMP request with ecn set can read reply codepoints
+func (v *requestValidator) twampECN(req RunRequest, mode string) {
+	switch {
+	case !req.ECN:
+	case !nettest.ECNSupported:
+		v.fail("ecn", true, "is only available on Linux agents")
+	case mode != TWAMP_MODE_LOSS:
+		v.fail("ecn", true, "is only available in loss mode")
+	}
+}
+
+// twampTOS checks that the tos of a TWAMP or OWAMP request leaves the ECN
+// bits alone; its range is checked with every request's
+func (v *requestValidator) twampTOS(tos int) {
+	if tos > 0 && tos <= 255 && tos&nettest.ECN_MASK != 0 {
+		v.fail("tos", tos, "must leave the two ECN bits clear; use ecn in loss mode to mark probes")
+	}
+}
+
+// applyTOS leaves the code point of a TWAMP or OWAMP request's tos in dscp. A
+// tos overrides dscp, which may come from a profile.
+func applyTOS(req *RunRequest) {
+	if req.TOS > 0 {
+		req.DSCP = req.TOS >> 2
+	}
+}
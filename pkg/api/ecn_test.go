@@ -0,0 +1,38 @@
+package api
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTwampTOS(t *testing.T) {
+	tests := []struct {
+		req      RunRequest
+		wantErr  string
+		wantDSCP int
+	}{
+		{RunRequest{}, "", 0},
+		{RunRequest{DSCP: 46}, "", 46},
+		{RunRequest{TOS: 184}, "", 46},           // EF as a TOS byte
+		{RunRequest{DSCP: 10, TOS: 104}, "", 26}, // tos wins over a profile's dscp
+		{RunRequest{TOS: 185}, "ECN bits", 0},
+		{RunRequest{TOS: 257}, "", 0}, // Out of range, reported by the check of every request
+	}
+	for _, tt := range tests {
+		v := &requestValidator{}
+		v.twampTOS(tt.req.TOS)
+		got := fieldMessages(v)
+		switch {
+		case tt.wantErr == "" && got != "":
+			t.Errorf("Expected %+v to be valid, got %s", tt.req, got)
+		case tt.wantErr != "" && !strings.Contains(got, tt.wantErr):
+			t.Errorf("Expected an error containing %q for %+v, got %q", tt.wantErr, tt.req, got)
+		case got == "" && tt.req.TOS <= 255:
+			req := tt.req
+			applyTOS(&req)
+			if req.DSCP != tt.wantDSCP {
+				t.Errorf("Expected DSCP %d for %+v, got %d", tt.wantDSCP, tt.req, req.DSCP)
+			}
+		}
+	}
+}
@@ -0,0 +1,370 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// perfSONAR archive export: with ESMOND_URL set, every stored iperf3 and
+// TWAMP result is written to an esmond measurement archive under the event
+// types pScheduler uses, so the dashboards reading that archive show these
+// tests too. Each result is one delivery of the webhook queue, retried and
+// dead-lettered like result webhooks.
+const (
+	ESMOND_EVENT_ARCHIVE = "esmond.archive"
+
+	ESMOND_SUBJECT_TYPE = "point-to-point"
+	MAX_ESMOND_RESPONSE = 1 << 20
+)
+
+// Event types of the archive
+const (
+	ESMOND_THROUGHPUT         = "throughput"
+	ESMOND_PACKET_RETRANSMITS = "packet-retransmits"
+	ESMOND_PACKET_COUNT_SENT  = "packet-count-sent"
+	ESMOND_PACKET_COUNT_LOST  = "packet-count-lost"
+	ESMOND_PACKET_LOSS_RATE   = "packet-loss-rate"
+	ESMOND_HISTOGRAM_OWDELAY  = "histogram-owdelay"
+	ESMOND_HISTOGRAM_RTT      = "histogram-rtt"
+)
+
+// esmondSummaries are the summaries the archive keeps of each event type, as
+// pScheduler registers them
+var esmondSummaries = map[string][]EsmondSummary{
+	ESMOND_THROUGHPUT:        {{"average", "86400"}},
+	ESMOND_PACKET_LOSS_RATE:  {{"aggregation", "3600"}, {"aggregation", "86400"}},
+	ESMOND_HISTOGRAM_OWDELAY: {{"aggregation", "3600"}, {"statistics", "0"}, {"statistics", "3600"}},
+	ESMOND_HISTOGRAM_RTT:     {{"statistics", "0"}},
+}
+
+// EsmondConfig is the archive results are exported to, from ESMOND_* environment variables
+type EsmondConfig struct {
+	URL    string // Archive URL; nothing is exported without it
+	APIKey string // Sent as "Authorization: Token <key>"
+	Source string // Address of this agent as source and measurement agent
+}
+
+var esmondConfig EsmondConfig
+
+// loadEsmondConfig reads ESMOND_URL, ESMOND_API_KEY and ESMOND_SOURCE
+func loadEsmondConfig(getenv func(string) string) (EsmondConfig, error) {
+	cfg := EsmondConfig{URL: getenv("ESMOND_URL"), APIKey: getenv("ESMOND_API_KEY"), Source: getenv("ESMOND_SOURCE")}
+	if cfg.URL == "" {
+		return cfg, nil
+	}
+	u, err := url.Parse(cfg.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return cfg, fmt.Errorf("invalid ESMOND_URL %q (expected the http or https URL of an archive, e.g. https://archive.example.net/esmond/perfsonar/archive/)", cfg.URL)
+	}
+	// esmond redirects the URL without its trailing slash, which drops a POST body
+	if !strings.HasSuffix(cfg.URL, "/") {
+		cfg.URL += "/"
+	}
+	if cfg.Source == "" {
+		if cfg.Source, err = os.Hostname(); err != nil {
+			return cfg, fmt.Errorf("ESMOND_SOURCE is not set and the hostname is unknown: %w", err)
+		}
+	}
+	return cfg, nil
+}
+
+// configureEsmond applies ESMOND_* settings at startup
+func configureEsmond() {
+	cfg, err := loadEsmondConfig(os.Getenv)
+	if err != nil {
+		log.Fatalf("Archive configuration failed: %v", err)
+	}
+	esmondConfig = cfg
+}
+
+// EsmondSummary is a summary the archive computes of an event type
+type EsmondSummary struct {
+	Type   string `json:"summary-type"`
+	Window string `json:"summary-window"` // Seconds; 0 summarizes each value on its own
+}
+
+// EsmondEventType is an event type of a metadata record
+type EsmondEventType struct {
+	Type      string          `json:"event-type"`
+	Summaries []EsmondSummary `json:"summaries,omitempty"`
+}
+
+// EsmondMetadata describes a measurement: its endpoints, tool and event types
+type EsmondMetadata struct {
+	SubjectType      string            `json:"subject-type"`
+	Source           string            `json:"source"`
+	Destination      string            `json:"destination"`
+	InputSource      string            `json:"input-source"`
+	InputDestination string            `json:"input-destination"`
+	MeasurementAgent string            `json:"measurement-agent"`
+	ToolName         string            `json:"tool-name"`
+	Protocol         string            `json:"ip-transport-protocol,omitempty"`
+	TimeDuration     int               `json:"time-duration,omitempty"` // Seconds, of throughput tests
+	EventTypes       []EsmondEventType `json:"event-types"`
+}
+
+// EsmondValue is the value of one event type at a time
+type EsmondValue struct {
+	EventType string      `json:"event-type"`
+	Value     interface{} `json:"val"`
+}
+
+// EsmondRecord is a metadata record and the values of a result under it
+type EsmondRecord struct {
+	Metadata  EsmondMetadata `json:"metadata"`
+	Timestamp int64          `json:"ts"`
+	Values    []EsmondValue  `json:"values"`
+}
+
+// esmondEndpoint is a measurement endpoint by address and by the name it was given as
+type esmondEndpoint struct {
+	address string
+	name    string
+}
+
+// add appends a value and registers its event type in the metadata
+func (rec *EsmondRecord) add(eventType string, value interface{}) {
+	rec.Metadata.EventTypes = append(rec.Metadata.EventTypes, EsmondEventType{Type: eventType, Summaries: esmondSummaries[eventType]})
+	rec.Values = append(rec.Values, EsmondValue{EventType: eventType, Value: value})
+}
+
+func newEsmondRecord(r *StoredResult, src, dst esmondEndpoint, protocol string) *EsmondRecord {
+	return &EsmondRecord{
+		Metadata: EsmondMetadata{
+			SubjectType:      ESMOND_SUBJECT_TYPE,
+			Source:           src.address,
+			Destination:      dst.address,
+			InputSource:      src.name,
+			InputDestination: dst.name,
+			MeasurementAgent: esmondConfig.Source,
+			ToolName:         "network-test-api/" + r.Type,
+			Protocol:         protocol,
+			EventTypes:       []EsmondEventType{},
+		},
+		Timestamp: r.StartedAt.Unix(),
+	}
+}
+
+// esmondRemote is the target of a result, by the address its control connection reached
+func esmondRemote(r *StoredResult) esmondEndpoint {
+	remote := esmondEndpoint{address: r.Target, name: r.Target}
+	if dial, ok := r.Data["dial"].(map[string]interface{}); ok {
+		remote.address, _ = dial["address"].(string)
+	}
+	if host, _, err := net.SplitHostPort(remote.address); err == nil {
+		remote.address = host
+	}
+	if remote.address == "" {
+		remote.address = r.Target
+	}
+	return remote
+}
+
+// esmondHistogram keys the counts of a histogram by the lower bound of each bucket
+func esmondHistogram(h *Histogram) map[string]int {
+	buckets := make(map[string]int, len(h.Buckets))
+	for _, b := range h.Buckets {
+		// Rounded to a nanosecond, so bucket bounds such as 0.30000000000000004 read 0.3
+		buckets[strconv.FormatFloat(math.Round(b.Lower*1e6)/1e6, 'f', -1, 64)] += b.Count
+	}
+	return buckets
+}
+
+// esmondLoss is the packet-loss-rate value of lost out of sent
+func esmondLoss(lost, sent int) map[string]int {
+	return map[string]int{"numerator": lost, "denominator": sent}
+}
+
+// esmondRecords maps a stored result to the archive records it is written as;
+// results of other types, and TWAMP modes without probe loss, have none
+func esmondRecords(r *StoredResult) []EsmondRecord {
+	local := esmondEndpoint{address: esmondConfig.Source, name: esmondConfig.Source}
+	remote := esmondRemote(r)
+	switch r.Type {
+	case TEST_TYPE_IPERF3:
+		return esmondIperf3(r, local, remote)
+	case TEST_TYPE_TWAMP:
+		return esmondTwamp(r, local, remote)
+	}
+	return nil
+}
+
+// esmondIperf3 records the throughput of an iperf3 test from its sender to its receiver
+func esmondIperf3(r *StoredResult, local, remote esmondEndpoint) []EsmondRecord {
+	mbps, ok := metricValue(r.Data, "bandwidth_mbps")
+	if !ok {
+		return nil
+	}
+	protocol, _ := r.Data["protocol"].(string)
+	src, dst := local, remote
+	if _, reverse := r.Data["received_bytes"]; reverse {
+		src, dst = remote, local
+	}
+	rec := newEsmondRecord(r, src, dst, strings.ToLower(protocol))
+	if duration, ok := metricValue(r.Data, "duration_sec"); ok {
+		rec.Metadata.TimeDuration = int(math.Round(duration))
+	}
+
+	rec.add(ESMOND_THROUGHPUT, int64(math.Round(mbps*1e6)))
+	if retransmits, ok := metricValue(r.Data, "retransmits"); ok {
+		rec.add(ESMOND_PACKET_RETRANSMITS, int(retransmits))
+	}
+	if packets, ok := metricValue(r.Data, "packets"); ok && packets > 0 {
+		lost, _ := metricValue(r.Data, "lost_packets")
+		rec.add(ESMOND_PACKET_COUNT_SENT, int(packets))
+		rec.add(ESMOND_PACKET_COUNT_LOST, int(lost))
+		rec.add(ESMOND_PACKET_LOSS_RATE, esmondLoss(int(lost), int(packets)))
+	}
+	return []EsmondRecord{*rec}
+}
+
+// esmondTwamp records the loss and RTT of a TWAMP test towards its target, and
+// with synced clocks the one-way delay of each direction
+func esmondTwamp(r *StoredResult, local, remote esmondEndpoint) []EsmondRecord {
+	probes, ok := metricValue(r.Data, "probes")
+	loss, lok := metricValue(r.Data, "loss_percent")
+	if !ok || !lok || probes <= 0 {
+		return nil
+	}
+	var latency struct {
+		Histograms *LatencyHistograms `json:"histogram_ms"`
+		Sync       struct {
+			BothSynced bool `json:"both_synced"`
+		} `json:"sync_status"`
+	}
+	if body, err := json.Marshal(r.Data); err == nil {
+		_ = json.Unmarshal(body, &latency)
+	}
+	histograms := latency.Histograms
+	if histograms == nil {
+		histograms = &LatencyHistograms{}
+	}
+	synced := latency.Sync.BothSynced
+
+	// TWAMP loss is round-trip loss; it is kept with the forward direction, as twping's is
+	sent := int(probes)
+	lost := int(math.Round(probes * loss / 100))
+	forward := newEsmondRecord(r, local, remote, "udp")
+	forward.add(ESMOND_PACKET_COUNT_SENT, sent)
+	forward.add(ESMOND_PACKET_COUNT_LOST, lost)
+	forward.add(ESMOND_PACKET_LOSS_RATE, esmondLoss(lost, sent))
+	if histograms.RTT != nil {
+		forward.add(ESMOND_HISTOGRAM_RTT, esmondHistogram(histograms.RTT))
+	}
+	if synced && histograms.ForwardDelay != nil {
+		forward.add(ESMOND_HISTOGRAM_OWDELAY, esmondHistogram(histograms.ForwardDelay))
+	}
+	records := []EsmondRecord{*forward}
+	if synced && histograms.ReverseDelay != nil {
+		reverse := newEsmondRecord(r, remote, local, "udp")
+		reverse.add(ESMOND_HISTOGRAM_OWDELAY, esmondHistogram(histograms.ReverseDelay))
+		records = append(records, *reverse)
+	}
+	return records
+}
+
+// exportEsmond queues the archive records of a stored result when ESMOND_URL is set
+func exportEsmond(r *StoredResult) {
+	if esmondConfig.URL == "" {
+		return
+	}
+	records := esmondRecords(r)
+	if len(records) == 0 {
+		return
+	}
+	d := &Delivery{URL: esmondConfig.URL, Event: ESMOND_EVENT_ARCHIVE, ResultID: r.ID}
+	if _, err := deliveryStore.enqueue(d, func(*Delivery) ([]byte, error) { return json.Marshal(records) }); err != nil {
+		log.Printf("Archive export of result %s not queued: %v", r.ID, err)
+	}
+}
+
+// esmondAttempt writes the records of an archive delivery: each metadata record
+// is POSTed to the archive, which answers with the existing one when it
+// matches, and the values are PUT to the metadata's URI
+func esmondAttempt(d *Delivery) DeliveryAttempt {
+	attempt := DeliveryAttempt{At: time.Now().UTC()}
+	status, err := archiveEsmond(esmondConfig, d.URL, d.payload)
+	attempt.DurationMs = float64(time.Since(attempt.At).Microseconds()) / 1000
+	attempt.StatusCode = status
+	if err != nil {
+		attempt.Error = err.Error()
+	}
+	return attempt
+}
+
+func archiveEsmond(cfg EsmondConfig, archiveURL string, payload []byte) (int, error) {
+	var records []EsmondRecord
+	if err := json.Unmarshal(payload, &records); err != nil {
+		return 0, fmt.Errorf("decode archive records: %w", err)
+	}
+	base, err := url.Parse(archiveURL)
+	if err != nil {
+		return 0, err
+	}
+	client := checkedHTTPClient(webhookConfig.Timeout)
+	var status int
+	for _, rec := range records {
+		var created struct {
+			URI string `json:"uri"`
+		}
+		if status, err = esmondRequest(client, cfg, http.MethodPost, archiveURL, rec.Metadata, &created); err != nil {
+			return status, err
+		}
+		if created.URI == "" {
+			return status, fmt.Errorf("archive returned no metadata uri")
+		}
+		ref, err := url.Parse(created.URI)
+		if err != nil {
+			return status, fmt.Errorf("archive returned an invalid metadata uri %q", created.URI)
+		}
+		data := map[string]interface{}{
+			"data": []map[string]interface{}{{"ts": rec.Timestamp, "val": rec.Values}},
+		}
+		if status, err = esmondRequest(client, cfg, http.MethodPut, base.ResolveReference(ref).String(), data, nil); err != nil {
+			return status, err
+		}
+	}
+	return status, nil
+}
+
+// esmondRequest sends body as JSON, decoding the response into out when it is not nil
+func esmondRequest(client *http.Client, cfg EsmondConfig, method, target string, body, out interface{}) (int, error) {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return 0, err
+	}
+	req, err := http.NewRequest(method, target, bytes.NewReader(payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "network-test-api/"+API_VERSION)
+	if cfg.APIKey != "" {
+		req.Header.Set("Authorization", "Token "+cfg.APIKey)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("archive returned %s for %s %s", resp.Status, method, target)
+	}
+	if out != nil {
+		if err := json.NewDecoder(io.LimitReader(resp.Body, MAX_ESMOND_RESPONSE)).Decode(out); err != nil {
+			return resp.StatusCode, fmt.Errorf("decode archive response: %w", err)
+		}
+	}
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,50 @@
+package api
+
+import (
+	"testing"
+
+	"network-test-api/pkg/stats"
+)
+
+func TestEsmondHistogram_KeysByLowerBound(t *testing.T) {
+	h := stats.NewHistogram([]float64{0.31, 0.35, 0.42, 1.05}, 0.1)
+	got := esmondHistogram(h)
+
+	want := map[string]int{"0.3": 2, "0.4": 1, "1": 1}
+	if len(got) != len(want) {
+		t.Fatalf("Expected buckets %v, got %v", want, got)
+	}
+	for k, n := range want {
+		if got[k] != n {
+			t.Errorf("Expected %d samples in bucket %q, got %d (%v)", n, k, got[k], got)
+		}
+	}
+}
+
+func TestEsmondHistogram_Empty(t *testing.T) {
+	if got := esmondHistogram(stats.NewHistogram(nil, 1)); len(got) != 0 {
+		t.Errorf("Expected no buckets, got %v", got)
+	}
+}
+
+func TestLoadEsmondConfig(t *testing.T) {
+	cfg, err := loadEsmondConfig(testEnv(map[string]string{
+		"ESMOND_URL":    "https://archive.example.net/esmond/perfsonar/archive",
+		"ESMOND_SOURCE": "agent-1.example.net",
+	}))
+	if err != nil || cfg.URL != "https://archive.example.net/esmond/perfsonar/archive/" {
+		t.Errorf("Expected the URL with a trailing slash, got %q (%v)", cfg.URL, err)
+	}
+	if cfg.Source != "agent-1.example.net" {
+		t.Errorf("Expected ESMOND_SOURCE agent-1.example.net, got %q", cfg.Source)
+	}
+
+	if cfg, err := loadEsmondConfig(testEnv(nil)); err != nil || cfg.URL != "" {
+		t.Errorf("Expected archiving to be off without ESMOND_URL, got %+v (%v)", cfg, err)
+	}
+	for _, bad := range []string{"archive.example.net", "ftp://archive.example.net/", "http://"} {
+		if _, err := loadEsmondConfig(testEnv(map[string]string{"ESMOND_URL": bad})); err == nil {
+			t.Errorf("Expected error for ESMOND_URL %q", bad)
+		}
+	}
+}
@@ -0,0 +1,222 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+)
+
+// Flent data file format (version 4, as written by flent 1.x and 2.x)
+const (
+	FLENT_FORMAT_VERSION = 4
+	FLENT_STEP_SIZE      = 0.2 // Seconds between x_values, Flent's default
+	FLENT_TIME_FORMAT    = "2006-01-02T15:04:05.000000"
+
+	// Series names used by Flent's tcp_upload, tcp_download and tcp_bidirectional
+	// tests; reusing them lets the stock plots (totals, ping, box_totals, ...) apply
+	FLENT_SERIES_UPLOAD   = "TCP upload"
+	FLENT_SERIES_DOWNLOAD = "TCP download"
+	FLENT_SERIES_PING     = "Ping (ms) ICMP"
+)
+
+// FlentRawValue is one sample in a Flent raw_values series
+type FlentRawValue struct {
+	T   float64 `json:"t"` // Unix time in seconds
+	Val float64 `json:"val"`
+}
+
+// FlentData is a Flent data file (.flent)
+type FlentData struct {
+	Metadata  map[string]interface{}     `json:"metadata"`
+	Version   int                        `json:"version"`
+	XValues   []float64                  `json:"x_values"`
+	Results   map[string][]*float64      `json:"results"` // Aligned to x_values, null where no sample
+	RawValues map[string][]FlentRawValue `json:"raw_values"`
+}
+
+// flentSeriesName maps a stored result to the Flent series it represents
+func flentSeriesName(r *StoredResult) (name, units string) {
+	if r.Type == TEST_TYPE_TWAMP {
+		return FLENT_SERIES_PING, "ms"
+	}
+	if _, reverse := r.Data["received_bytes"]; reverse {
+		return FLENT_SERIES_DOWNLOAD, "Mbits/s"
+	}
+	return FLENT_SERIES_UPLOAD, "Mbits/s"
+}
+
+// storedSeries extracts the time series points of a stored result
+func storedSeries(data map[string]interface{}) ([]SeriesPoint, bool) {
+	series, ok := data["series"].(map[string]interface{})
+	if !ok {
+		return nil, false
+	}
+	raw, ok := series["points"].([]interface{})
+	if !ok {
+		return nil, false
+	}
+	points := make([]SeriesPoint, 0, len(raw))
+	for _, p := range raw {
+		m, ok := p.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		t, tok := m["t_sec"].(float64)
+		v, vok := m["value"].(float64)
+		if tok && vok {
+			points = append(points, SeriesPoint{T: t, Value: v})
+		}
+	}
+	return points, true
+}
+
+// flentTestName picks the Flent test whose plots match the exported series
+func flentTestName(results map[string][]*float64) string {
+	_, up := results[FLENT_SERIES_UPLOAD]
+	_, down := results[FLENT_SERIES_DOWNLOAD]
+	switch {
+	case up && down:
+		return "tcp_bidirectional"
+	case down:
+		return "tcp_download"
+	case up:
+		return "tcp_upload"
+	}
+	return "ping"
+}
+
+// buildFlentData merges the series of results into one Flent data file.
+// Series are aligned on their start times, so a TWAMP run taken during an
+// iperf3 run shows latency under load.
+func buildFlentData(results []*StoredResult, step float64) (*FlentData, error) {
+	t0 := results[0].StartedAt
+	for _, r := range results[1:] {
+		if r.StartedAt.Before(t0) {
+			t0 = r.StartedAt
+		}
+	}
+
+	type series struct {
+		id     string
+		offset float64
+		points []SeriesPoint
+	}
+	byName := make(map[string]series)
+	seriesMeta := make(map[string]interface{})
+	var hosts []string
+	var ids []string
+	length := 0.0
+	for _, r := range results {
+		name, units := flentSeriesName(r)
+		if _, dup := byName[name]; dup {
+			return nil, fmt.Errorf("results %s and %s both map to the Flent series %q", byName[name].id, r.ID, name)
+		}
+		points, ok := storedSeries(r.Data)
+		if !ok {
+			return nil, fmt.Errorf("result %s has no time series (run the test with \"series\": true)", r.ID)
+		}
+
+		s := series{id: r.ID, offset: r.StartedAt.Sub(t0).Seconds(), points: points}
+		byName[name] = s
+		if n := len(points); n > 0 {
+			length = math.Max(length, s.offset+points[n-1].T)
+		}
+		seriesMeta[name] = map[string]interface{}{
+			"UNITS":     units,
+			"RUNNER":    r.Type,
+			"RESULT_ID": r.ID,
+		}
+		if !containsString(hosts, r.Target) {
+			hosts = append(hosts, r.Target)
+		}
+		ids = append(ids, r.ID)
+	}
+
+	slots := int(math.Ceil(length/step)) + 1
+	data := &FlentData{
+		Version:   FLENT_FORMAT_VERSION,
+		XValues:   make([]float64, slots),
+		Results:   make(map[string][]*float64),
+		RawValues: make(map[string][]FlentRawValue),
+	}
+	for i := range data.XValues {
+		data.XValues[i] = math.Round(float64(i)*step*1000) / 1000
+	}
+
+	start := float64(t0.UnixNano()) / 1e9
+	for name, s := range byName {
+		values := make([]*float64, slots)
+		raw := make([]FlentRawValue, 0, len(s.points))
+		for _, p := range s.points {
+			t := s.offset + p.T
+			v := p.Value
+			values[int(math.Round(t/step))] = &v
+			raw = append(raw, FlentRawValue{T: start + t, Val: v})
+		}
+		data.Results[name] = values
+		data.RawValues[name] = raw
+	}
+
+	name := flentTestName(data.Results)
+	data.Metadata = map[string]interface{}{
+		"NAME":          name,
+		"TITLE":         strings.Join(hosts, ", "),
+		"HOST":          hosts[0],
+		"HOSTS":         hosts,
+		"TIME":          t0.UTC().Format(FLENT_TIME_FORMAT),
+		"T0":            t0.UTC().Format(FLENT_TIME_FORMAT),
+		"LENGTH":        int(math.Ceil(length)),
+		"TOTAL_LENGTH":  int(math.Ceil(length)),
+		"STEP_SIZE":     step,
+		"DATA_FILENAME": fmt.Sprintf("%s-%s.flent", name, t0.UTC().Format("2006-01-02T150405")),
+		"NOTE":          fmt.Sprintf("Exported by network-test-api %s from results %s", API_VERSION, strings.Join(ids, ", ")),
+		"SERIES_META":   seriesMeta,
+	}
+	return data, nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func resultFlent(w http.ResponseWriter, r *http.Request) {
+	var results []*StoredResult
+	for _, id := range strings.Split(r.URL.Query().Get("ids"), ",") {
+		if id = strings.TrimSpace(id); id == "" {
+			continue
+		}
+		result, ok := lookupResult(w, id)
+		if !ok {
+			return
+		}
+		results = append(results, result)
+	}
+	if len(results) == 0 {
+		jsonResponse(w, ApiResponse{
+			Status: "error",
+			Error:  "ids is required (comma-separated result IDs)",
+		}, http.StatusBadRequest)
+		return
+	}
+
+	data, err := buildFlentData(results, FLENT_STEP_SIZE)
+	if err != nil {
+		jsonResponse(w, ApiResponse{
+			Status: "error",
+			Error:  err.Error(),
+		}, http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", data.Metadata["DATA_FILENAME"]))
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(data)
+}
@@ -0,0 +1,91 @@
+package api
+
+import (
+	"testing"
+	"time"
+)
+
+// seriesResult is a stored result of testType whose series holds points, as
+// decoded from the result store
+func seriesResult(id, testType string, started time.Time, points []SeriesPoint) *StoredResult {
+	raw := make([]interface{}, len(points))
+	for i, p := range points {
+		raw[i] = map[string]interface{}{"t_sec": p.T, "value": p.Value}
+	}
+	return &StoredResult{
+		ID:        id,
+		Type:      testType,
+		Target:    "netperf.example.net",
+		StartedAt: started,
+		Data:      map[string]interface{}{"series": map[string]interface{}{"points": raw}},
+	}
+}
+
+func TestFlentSeriesAlignment(t *testing.T) {
+	t0 := time.Date(2026, 10, 14, 9, 0, 0, 0, time.UTC)
+	results := []*StoredResult{
+		seriesResult("r1", TEST_TYPE_IPERF3, t0, []SeriesPoint{{T: 1, Value: 94}, {T: 2, Value: 96}, {T: 3, Value: 95}}),
+		// TWAMP run started 0.45 s after the iperf3 run, last probe at 3.0 s
+		seriesResult("r2", TEST_TYPE_TWAMP, t0.Add(450*time.Millisecond), []SeriesPoint{{T: 0, Value: 30}, {T: 1, Value: 42}, {T: 2, Value: 55}, {T: 3, Value: 51}}),
+	}
+	data, err := buildFlentData(results, 0.2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	throughput, ping := data.Results[FLENT_SERIES_UPLOAD], data.Results[FLENT_SERIES_PING]
+
+	if len(data.XValues) != 19 || len(ping) != 19 {
+		t.Errorf("Expected 19 slots, got %d", len(data.XValues))
+	}
+	if throughput[5] == nil || *throughput[5] != 94 {
+		t.Errorf("Expected throughput 94 at x=1.0")
+	}
+	if ping[2] == nil || *ping[2] != 30 {
+		t.Errorf("Expected ping 30 at x=0.4 (0.45 rounded to the grid)")
+	}
+	if ping[17] == nil || *ping[17] != 51 {
+		t.Errorf("Expected last ping sample at x=3.4")
+	}
+
+	set := 0
+	for _, v := range ping {
+		if v != nil {
+			set++
+		}
+	}
+	if set != 4 {
+		t.Errorf("Expected 4 ping values, got %d", set)
+	}
+	if data.Metadata["NAME"] != "tcp_upload" {
+		t.Errorf("Expected the tcp_upload test, got %v", data.Metadata["NAME"])
+	}
+}
+
+func TestFlentSeriesRequired(t *testing.T) {
+	r := &StoredResult{ID: "r1", Type: TEST_TYPE_TWAMP, Data: map[string]interface{}{}}
+	if _, err := buildFlentData([]*StoredResult{r}, FLENT_STEP_SIZE); err == nil {
+		t.Error("Expected error for a result without a time series")
+	}
+}
+
+func TestFlentTestName(t *testing.T) {
+	tests := []struct {
+		series []string
+		want   string
+	}{
+		{[]string{"TCP upload", "Ping (ms) ICMP"}, "tcp_upload"},
+		{[]string{"TCP download"}, "tcp_download"},
+		{[]string{"TCP upload", "TCP download", "Ping (ms) ICMP"}, "tcp_bidirectional"},
+		{[]string{"Ping (ms) ICMP"}, "ping"},
+	}
+
+	for _, tt := range tests {
+		results := make(map[string][]*float64)
+		for _, s := range tt.series {
+			results[s] = nil
+		}
+		if got := flentTestName(results); got != tt.want {
+			t.Errorf("%v: expected %s, got %s", tt.series, tt.want, got)
+		}
+	}
+}
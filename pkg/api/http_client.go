@@ -0,0 +1,328 @@
+package api
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"sync"
+	"time"
+
+	"network-test-api/pkg/nettest"
+)
+
+// HTTP(S) request timing and throughput test. Unlike the transfer test, which
+// dials through the control connection logic and speaks HTTP/1.1, it lets Go's
+// HTTP client dial, negotiate HTTP/2 and report each phase through httptrace,
+// as a browser or an application on the agent would see it.
+
+// HTTPTimings are the phases of an HTTP test in milliseconds
+type HTTPTimings struct {
+	DNSMs      float64 `json:"dns_ms"`           // Name resolution, 0 for an IP address
+	ConnectMs  float64 `json:"connect_ms"`       // TCP connect of the connection used
+	TLSMs      float64 `json:"tls_ms,omitempty"` // HTTPS handshake
+	RequestMs  float64 `json:"request_ms"`       // Writing the request, including an upload body
+	ServerMs   float64 `json:"server_ms"`        // From the request written to the first response byte
+	TTFBMs     float64 `json:"ttfb_ms"`          // From the start to the first response byte
+	TransferMs float64 `json:"transfer_ms"`      // The phase goodput is measured over
+	TotalMs    float64 `json:"total_ms"`
+}
+
+// httpTrace records the moments httptrace reports for one request. With
+// Happy Eyeballs several connects may run; the one that succeeds is kept.
+type httpTrace struct {
+	mu                               sync.Mutex
+	start                            time.Time
+	dnsStart, dnsDone                time.Time
+	connectStart                     map[string]time.Time
+	connectFrom, connectDone         time.Time
+	tlsStart, tlsDone                time.Time
+	gotConn, wroteRequest, firstByte time.Time
+	address                          string
+}
+
+func newHTTPTrace() *httpTrace {
+	return &httpTrace{start: time.Now(), connectStart: map[string]time.Time{}}
+}
+
+// clientTrace returns the hooks that fill in t
+func (t *httpTrace) clientTrace() *httptrace.ClientTrace {
+	now := func(field *time.Time) {
+		t.mu.Lock()
+		*field = time.Now()
+		t.mu.Unlock()
+	}
+	return &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) { now(&t.dnsStart) },
+		DNSDone:  func(httptrace.DNSDoneInfo) { now(&t.dnsDone) },
+		ConnectStart: func(_, addr string) {
+			t.mu.Lock()
+			t.connectStart[addr] = time.Now()
+			t.mu.Unlock()
+		},
+		ConnectDone: func(_, addr string, err error) {
+			t.mu.Lock()
+			if err == nil && t.connectDone.IsZero() {
+				t.connectFrom, t.connectDone, t.address = t.connectStart[addr], time.Now(), addr
+			}
+			t.mu.Unlock()
+		},
+		TLSHandshakeStart:    func() { now(&t.tlsStart) },
+		TLSHandshakeDone:     func(tls.ConnectionState, error) { now(&t.tlsDone) },
+		GotConn:              func(httptrace.GotConnInfo) { now(&t.gotConn) },
+		WroteRequest:         func(httptrace.WroteRequestInfo) { now(&t.wroteRequest) },
+		GotFirstResponseByte: func() { now(&t.firstByte) },
+	}
+}
+
+// timings returns the phases recorded, with the transfer phase from
+// phaseStart to phaseEnd and the test ending at end
+func (t *httpTrace) timings(phaseStart, phaseEnd, end time.Time) HTTPTimings {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	timings := HTTPTimings{
+		DNSMs:      sinceMs(t.dnsStart, t.dnsDone),
+		ConnectMs:  sinceMs(t.connectFrom, t.connectDone),
+		RequestMs:  sinceMs(t.gotConn, t.wroteRequest),
+		ServerMs:   sinceMs(t.wroteRequest, t.firstByte),
+		TTFBMs:     sinceMs(t.start, t.firstByte),
+		TransferMs: sinceMs(phaseStart, phaseEnd),
+		TotalMs:    sinceMs(t.start, end),
+	}
+	if !t.tlsStart.IsZero() {
+		timings.TLSMs = sinceMs(t.tlsStart, t.tlsDone)
+	}
+	return timings
+}
+
+// HTTPResult is the outcome of an HTTP test
+type HTTPResult struct {
+	URL         string      `json:"url"` // Without password
+	Direction   string      `json:"direction"`
+	Protocol    string      `json:"protocol"` // HTTP/1.1 or HTTP/2.0
+	StatusCode  int         `json:"status_code"`
+	Address     string      `json:"address"` // Address connected to
+	Family      string      `json:"family"`
+	Bytes       int64       `json:"bytes"`
+	Truncated   bool        `json:"truncated"` // Download stopped at size before the end of the body
+	GoodputMbps float64     `json:"goodput_mbps"`
+	TLSVersion  string      `json:"tls_version,omitempty"`
+	TLS         *TLSReport  `json:"tls,omitempty"` // Certificate check (https only)
+	Timings     HTTPTimings `json:"timings"`
+
+	startedAt time.Time
+}
+
+// httpDialNetwork is the network Go's dialer resolves and connects on for an
+// address family; tcp races both families
+func httpDialNetwork(family string) string {
+	switch family {
+	case nettest.FAMILY_IPV4:
+		return "tcp4"
+	case nettest.FAMILY_IPV6:
+		return "tcp6"
+	}
+	return "tcp"
+}
+
+// httpRequest downloads or uploads with one request on a fresh connection
+func httpRequest(ctx context.Context, u *url.URL, req RunRequest, payload nettest.PayloadEntropy) (*HTTPResult, error) {
+	trace := newHTTPTrace()
+	result := &HTTPResult{URL: u.Redacted(), Direction: req.Direction, startedAt: trace.start}
+	checker := newTLSChecker(req)
+
+	// The transport dials without the request's deadline, so take the test's
+	var bind *nettest.SourceBinding
+	dialer := bind.Dialer("tcp", 0)
+	dialer.Deadline, _ = ctx.Deadline()
+	network := httpDialNetwork(req.AddressFamily)
+	transport := &http.Transport{
+		Proxy: nil, // Measure the path to the server itself
+		DialContext: func(ctx context.Context, _, address string) (net.Conn, error) {
+			host, _, _ := net.SplitHostPort(address)
+			return dialer.DialContext(nettest.WithDialedName(ctx, host), network, address)
+		},
+		TLSClientConfig:    checker.config(u.Hostname()),
+		ForceAttemptHTTP2:  true,
+		DisableKeepAlives:  true,
+		DisableCompression: true, // Count the bytes on the wire
+	}
+	defer transport.CloseIdleConnections()
+	client := &http.Client{
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse // A redirect would time a second connection
+		},
+	}
+
+	method, body := http.MethodGet, io.Reader(nil)
+	if req.Direction == TRANSFER_UPLOAD {
+		method, body = req.Method, newPayloadReader(payload, req.Size)
+	}
+	httpReq, err := http.NewRequestWithContext(httptrace.WithClientTrace(ctx, trace.clientTrace()), method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		httpReq.ContentLength = req.Size
+		httpReq.Header.Set("Content-Type", "application/octet-stream")
+	}
+	httpReq.Header.Set("User-Agent", "network-test-api/"+API_VERSION)
+
+	resp, err := client.Do(httpReq)
+	result.TLS = checker.Report()
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	result.Protocol = resp.Proto
+	result.StatusCode = resp.StatusCode
+	if resp.TLS != nil {
+		result.TLSVersion = tls.VersionName(resp.TLS.Version)
+	}
+	if resp.StatusCode >= 300 {
+		if loc := resp.Header.Get("Location"); loc != "" {
+			return nil, fmt.Errorf("server returned %s redirecting to %s; request that URL directly", resp.Status, loc)
+		}
+		return nil, fmt.Errorf("server returned %s", resp.Status)
+	}
+
+	var phaseStart, phaseEnd time.Time
+	if req.Direction == TRANSFER_UPLOAD {
+		// As in the transfer test, the response bounds the upload rather than
+		// the local socket buffer draining
+		result.Bytes = req.Size
+		if _, _, err := readBody(resp.Body, 0); err != nil {
+			return nil, fmt.Errorf("reading response: %w", err)
+		}
+		trace.mu.Lock()
+		phaseStart, phaseEnd = trace.gotConn, trace.firstByte
+		trace.mu.Unlock()
+	} else {
+		result.Bytes, result.Truncated, err = readBody(resp.Body, req.Size)
+		if err != nil {
+			return nil, fmt.Errorf("download failed after %d bytes: %w", result.Bytes, err)
+		}
+		trace.mu.Lock()
+		phaseStart = trace.firstByte
+		trace.mu.Unlock()
+		phaseEnd = time.Now()
+	}
+
+	result.Timings = trace.timings(phaseStart, phaseEnd, time.Now())
+	result.GoodputMbps = goodputMbps(result.Bytes, phaseEnd.Sub(phaseStart))
+	trace.mu.Lock()
+	result.Address = trace.address
+	trace.mu.Unlock()
+	if host, _, err := net.SplitHostPort(result.Address); err == nil {
+		if ip := net.ParseIP(host); ip != nil {
+			result.Family = nettest.IPFamily(ip)
+		}
+	}
+	return result, nil
+}
+
+// validateHTTP checks and defaults the fields of an HTTP test
+func validateHTTP(u *url.URL, req *RunRequest) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("unsupported url scheme %q (expected http or https)", u.Scheme)
+	}
+	if req.Series {
+		return fmt.Errorf("series is not available for HTTP tests")
+	}
+	return validateTransfer(req)
+}
+
+// runHTTP applies defaults to a decoded request, runs the HTTP test and records the result.
+// Errors come with the HTTP status to report them with.
+func runHTTP(req RunRequest, profile *Profile) (map[string]interface{}, int, error) {
+	u, port, err := parseTransferURL(req.URL)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	req.ServerHost, req.ServerPort = u.Hostname(), port
+	if req.Duration == 0 {
+		req.Duration = DEFAULT_TRANSFER_DURATION
+	}
+	if err := checkProfileLimits(req, profile); err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	payload, err := nettest.ParsePayloadEntropy(req.Payload)
+	if err == nil {
+		err = validateHTTP(u, &req)
+	}
+	if err == nil {
+		err = validateRootStore(&req)
+	}
+	if err == nil {
+		req.AddressFamily, err = parseAddressFamily(req.AddressFamily)
+	}
+	if err == nil && req.AddressFamily == nettest.FAMILY_COMPARE {
+		err = fmt.Errorf("address_family compare is not available for HTTP tests; run ipv4 and ipv6 separately")
+	}
+	if err == nil {
+		err = validateLockWait(&req)
+	}
+	if err == nil {
+		err = validateCallbackURL(req.CallbackURL)
+	}
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	lock, release, status, err := lockTest(TEST_TYPE_HTTP, req, true)
+	if err != nil {
+		return nil, status, err
+	}
+	defer release()
+
+	logf(req.ctx, "HTTP test: %s %s (size=%d, %ds limit, family=%s)", req.Direction, u.Redacted(), req.Size, req.Duration, req.AddressFamily)
+
+	ctx, cancel := context.WithTimeout(req.runContext(), time.Duration(req.Duration)*time.Second)
+	defer cancel()
+	result, err := httpRequest(ctx, u, req, payload)
+	if err != nil {
+		if req.runContext().Err() != nil {
+			return nil, http.StatusInternalServerError, canceledError(req.runContext())
+		}
+		if ctx.Err() != nil {
+			err = fmt.Errorf("request did not finish within %ds: %v", req.Duration, err)
+		}
+		return nil, http.StatusInternalServerError, fmt.Errorf("HTTP test failed: %v", err)
+	}
+
+	data := map[string]interface{}{
+		"server":       req.ServerHost,
+		"port":         req.ServerPort,
+		"url":          result.URL,
+		"direction":    result.Direction,
+		"protocol":     result.Protocol,
+		"status_code":  result.StatusCode,
+		"address":      result.Address,
+		"family":       result.Family,
+		"bytes":        result.Bytes,
+		"truncated":    result.Truncated,
+		"goodput_mbps": result.GoodputMbps,
+		"duration_sec": result.Timings.TotalMs / 1000,
+		"timings":      result.Timings,
+	}
+	if result.TLSVersion != "" {
+		data["tls_version"] = result.TLSVersion
+	}
+	if result.TLS != nil {
+		data["tls"] = result.TLS
+	}
+	if profile != nil {
+		data["profile"] = profile.Name
+	}
+	data["lock"] = lock
+
+	recordResult(TEST_TYPE_HTTP, req, result.startedAt, data)
+	notifyCallback(req.CallbackURL, data)
+
+	return data, http.StatusOK, nil
+}
@@ -0,0 +1,146 @@
+package api
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"network-test-api/pkg/nettest"
+)
+
+// timedGet requests url through a fresh HTTP/2-capable transport, as
+// httpRequest does, and returns the trace, timings and protocol
+func timedGet(t *testing.T, url string) (*httpTrace, HTTPTimings, string) {
+	t.Helper()
+	trace := newHTTPTrace()
+	transport := &http.Transport{
+		Proxy:             nil,
+		TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+		ForceAttemptHTTP2: true,
+		DisableKeepAlives: true,
+	}
+	defer transport.CloseIdleConnections()
+	ctx := httptrace.WithClientTrace(context.Background(), trace.clientTrace())
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := (&http.Client{Transport: transport}).Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if _, err := io.Copy(io.Discard, resp.Body); err != nil {
+		t.Fatal(err)
+	}
+	trace.mu.Lock()
+	phaseStart := trace.firstByte
+	trace.mu.Unlock()
+	end := time.Now()
+	return trace, trace.timings(phaseStart, end, end), resp.Proto
+}
+
+func TestHTTPTrace_HTTPS(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(20 * time.Millisecond) // Server time before the first byte
+		_, _ = w.Write(make([]byte, 256<<10))
+	}))
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+
+	// By name, so the request resolves it
+	url := strings.Replace(server.URL, "127.0.0.1", "localhost", 1)
+	trace, timings, proto := timedGet(t, url)
+
+	if proto != "HTTP/2.0" {
+		t.Errorf("expected HTTP/2 to be negotiated over TLS, got %s", proto)
+	}
+	if trace.dnsStart.IsZero() || trace.dnsDone.Before(trace.dnsStart) {
+		t.Error("expected localhost to be resolved through the DNS hooks")
+	}
+	if trace.address != server.Listener.Addr().String() {
+		t.Errorf("expected the address connected to to be %s, got %q", server.Listener.Addr(), trace.address)
+	}
+	if timings.ConnectMs <= 0 || timings.TLSMs <= 0 || timings.TTFBMs <= 0 || timings.TransferMs <= 0 {
+		t.Errorf("expected connect, TLS, TTFB and transfer timings, got %+v", timings)
+	}
+	if timings.ServerMs < 20 {
+		t.Errorf("expected server_ms to include the server's 20ms, got %v", timings.ServerMs)
+	}
+	if timings.TTFBMs < timings.DNSMs+timings.ConnectMs+timings.TLSMs+timings.ServerMs {
+		t.Errorf("expected ttfb_ms to cover the phases before the first byte, got %+v", timings)
+	}
+	if timings.TotalMs < timings.TTFBMs+timings.TransferMs-0.01 {
+		t.Errorf("expected total_ms to cover ttfb_ms and transfer_ms, got %+v", timings)
+	}
+}
+
+func TestHTTPTrace_PlainHTTPByAddress(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	_, timings, proto := timedGet(t, server.URL)
+	if proto != "HTTP/1.1" {
+		t.Errorf("expected HTTP/1.1 without TLS, got %s", proto)
+	}
+	if timings.DNSMs != 0 {
+		t.Errorf("expected no name resolution for an IP address, got %v", timings.DNSMs)
+	}
+	if timings.TLSMs != 0 {
+		t.Errorf("expected no TLS timing for http, got %v", timings.TLSMs)
+	}
+	if timings.ConnectMs <= 0 {
+		t.Errorf("expected a connect timing, got %+v", timings)
+	}
+}
+
+func TestHTTPTrace_KeepsSuccessfulConnect(t *testing.T) {
+	trace := newHTTPTrace()
+	hooks := trace.clientTrace()
+	hooks.ConnectStart("tcp", "[2001:db8::1]:443")
+	hooks.ConnectStart("tcp", "192.0.2.1:443")
+	hooks.ConnectDone("tcp", "[2001:db8::1]:443", context.Canceled)
+	hooks.ConnectDone("tcp", "192.0.2.1:443", nil)
+	if trace.address != "192.0.2.1:443" {
+		t.Errorf("expected the connection that succeeded, got %q", trace.address)
+	}
+	if !trace.connectFrom.Equal(trace.connectStart["192.0.2.1:443"]) {
+		t.Error("expected connect_ms to start at the winning attempt")
+	}
+}
+
+func TestHTTPDialNetwork(t *testing.T) {
+	for family, want := range map[string]string{nettest.FAMILY_AUTO: "tcp", nettest.FAMILY_IPV4: "tcp4", nettest.FAMILY_IPV6: "tcp6"} {
+		if got := httpDialNetwork(family); got != want {
+			t.Errorf("httpDialNetwork(%s): expected %s, got %s", family, want, got)
+		}
+	}
+}
+
+func TestResultMetrics_DiffEveryTiming(t *testing.T) {
+	for testType, timings := range map[string]interface{}{TEST_TYPE_TRANSFER: TransferTimings{}, TEST_TYPE_HTTP: HTTPTimings{}} {
+		diffed := map[string]bool{}
+		for _, m := range resultMetrics[testType] {
+			if name, ok := strings.CutPrefix(m.Path, "timings."); ok {
+				diffed[name] = true
+			}
+		}
+		rt := reflect.TypeOf(timings)
+		for i := 0; i < rt.NumField(); i++ {
+			name, _, _ := strings.Cut(rt.Field(i).Tag.Get("json"), ",")
+			if !diffed[name] {
+				t.Errorf("%s: timings.%s is not diffed", testType, name)
+			}
+		}
+	}
+}
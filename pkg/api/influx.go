@@ -0,0 +1,174 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// InfluxDB export: with INFLUX_URL set, every stored result is written as one
+// line of InfluxDB line protocol through the v2 write API, its metrics the
+// fields and its agent, type, target, protocol and direction the tags. Each
+// write is a delivery of the webhook queue, retried and dead-lettered like
+// result webhooks.
+const (
+	INFLUX_EVENT_WRITE = "influx.write"
+
+	DEFAULT_INFLUX_MEASUREMENT = "network_test"
+)
+
+// InfluxConfig is the bucket results are written to, from INFLUX_* environment variables
+type InfluxConfig struct {
+	URL         string // Write endpoint with org, bucket and precision; nothing is written without it
+	Token       string // Sent as "Authorization: Token <token>"
+	Measurement string
+}
+
+var influxConfig InfluxConfig
+
+// loadInfluxConfig reads INFLUX_URL, INFLUX_ORG, INFLUX_BUCKET, INFLUX_TOKEN and INFLUX_MEASUREMENT
+func loadInfluxConfig(getenv func(string) string) (InfluxConfig, error) {
+	cfg := InfluxConfig{Token: getenv("INFLUX_TOKEN"), Measurement: getenv("INFLUX_MEASUREMENT")}
+	base := getenv("INFLUX_URL")
+	if base == "" {
+		return cfg, nil
+	}
+	u, err := url.Parse(base)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return cfg, fmt.Errorf("invalid INFLUX_URL %q (expected the http or https URL of an InfluxDB server, e.g. http://influxdb:8086)", base)
+	}
+	org, bucket := getenv("INFLUX_ORG"), getenv("INFLUX_BUCKET")
+	if org == "" || bucket == "" {
+		return cfg, fmt.Errorf("INFLUX_ORG and INFLUX_BUCKET are required with INFLUX_URL")
+	}
+	if cfg.Measurement == "" {
+		cfg.Measurement = DEFAULT_INFLUX_MEASUREMENT
+	}
+	u.Path = strings.TrimRight(u.Path, "/") + "/api/v2/write"
+	u.RawQuery = url.Values{"org": {org}, "bucket": {bucket}, "precision": {"ns"}}.Encode()
+	cfg.URL = u.String()
+	return cfg, nil
+}
+
+// configureInflux applies INFLUX_* settings at startup
+func configureInflux() {
+	cfg, err := loadInfluxConfig(os.Getenv)
+	if err != nil {
+		log.Fatalf("InfluxDB configuration failed: %v", err)
+	}
+	influxConfig = cfg
+}
+
+// Escaping of the line protocol: measurements escape commas and spaces, tag
+// keys and values equals signs as well, and string fields quotes and backslashes
+var (
+	influxMeasurementEscaper = strings.NewReplacer(",", `\,`, " ", `\ `)
+	influxTagEscaper         = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+	influxStringEscaper      = strings.NewReplacer(`"`, `\"`, `\`, `\\`)
+)
+
+// influxTags are the tags of a result, empty ones left out
+func influxTags(r *StoredResult) map[string]string {
+	tags := map[string]string{
+		"agent":  agentID,
+		"type":   r.Type,
+		"target": r.Target,
+	}
+	if protocol, ok := r.Data["protocol"].(string); ok {
+		tags["protocol"] = strings.ToLower(protocol)
+	}
+	direction, _ := r.Data["direction"].(string)
+	if r.Type == TEST_TYPE_IPERF3 {
+		// iperf3 reports the bytes of the side that measured: received with reverse
+		direction = "upload"
+		if _, reverse := r.Data["received_bytes"]; reverse {
+			direction = "download"
+		}
+	}
+	if direction != "" {
+		tags["direction"] = direction
+	}
+	for k, v := range tags {
+		if v == "" {
+			delete(tags, k)
+		}
+	}
+	return tags
+}
+
+// influxLine formats a result as a line: its comparable metrics are the fields,
+// named by their path, with its ID as a string field
+func influxLine(r *StoredResult, measurement string) string {
+	var b strings.Builder
+	b.WriteString(influxMeasurementEscaper.Replace(measurement))
+
+	tags := influxTags(r)
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys) // The order InfluxDB stores them in, which writes fastest
+	for _, k := range keys {
+		fmt.Fprintf(&b, ",%s=%s", influxTagEscaper.Replace(k), influxTagEscaper.Replace(tags[k]))
+	}
+
+	fmt.Fprintf(&b, ` result_id="%s"`, influxStringEscaper.Replace(r.ID))
+	for _, m := range resultMetrics[r.Type] {
+		v, ok := metricValue(r.Data, m.Path)
+		if !ok || math.IsNaN(v) || math.IsInf(v, 0) {
+			continue
+		}
+		fmt.Fprintf(&b, ",%s=%s", influxTagEscaper.Replace(m.Path), strconv.FormatFloat(v, 'f', -1, 64))
+	}
+	fmt.Fprintf(&b, " %d\n", r.StartedAt.UnixNano())
+	return b.String()
+}
+
+// exportInflux queues the write of a stored result when INFLUX_URL is set
+func exportInflux(r *StoredResult) {
+	if influxConfig.URL == "" {
+		return
+	}
+	line := influxLine(r, influxConfig.Measurement)
+	d := &Delivery{URL: influxConfig.URL, Event: INFLUX_EVENT_WRITE, ResultID: r.ID}
+	if _, err := deliveryStore.enqueue(d, func(*Delivery) ([]byte, error) { return []byte(line), nil }); err != nil {
+		log.Printf("InfluxDB write of result %s not queued: %v", r.ID, err)
+	}
+}
+
+// influxAttempt POSTs the line of a write delivery to the write endpoint
+func influxAttempt(d *Delivery) DeliveryAttempt {
+	attempt := DeliveryAttempt{At: time.Now().UTC()}
+	req, err := http.NewRequest(http.MethodPost, d.URL, bytes.NewReader(d.payload))
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	req.Header.Set("User-Agent", "network-test-api/"+API_VERSION)
+	if influxConfig.Token != "" {
+		req.Header.Set("Authorization", "Token "+influxConfig.Token)
+	}
+
+	client := checkedHTTPClient(webhookConfig.Timeout)
+	resp, err := client.Do(req)
+	attempt.DurationMs = float64(time.Since(attempt.At).Microseconds()) / 1000
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	_ = resp.Body.Close()
+	attempt.StatusCode = resp.StatusCode
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		attempt.Error = fmt.Sprintf("InfluxDB returned %s", resp.Status)
+	}
+	return attempt
+}
@@ -0,0 +1,47 @@
+package api
+
+import (
+	"testing"
+	"time"
+)
+
+// withAgentID sets agentID for the test
+func withAgentID(t *testing.T, id string) {
+	t.Helper()
+	saved := agentID
+	agentID = id
+	t.Cleanup(func() { agentID = saved })
+}
+
+func TestInfluxLine_SortsTags(t *testing.T) {
+	withAgentID(t, "fra1")
+	r := &StoredResult{
+		ID:        "1d9cb97159106d3d",
+		Type:      TEST_TYPE_IPERF3,
+		Target:    "iperf.he.net",
+		StartedAt: time.Unix(0, 1768471200000000000),
+		Data: map[string]interface{}{
+			"protocol":       "TCP",
+			"bandwidth_mbps": 94.2,
+			"sent_bytes":     117750000.0,
+			"dial":           map[string]interface{}{"connect_ms": 8.4},
+		},
+	}
+	got := influxLine(r, "network_test")
+
+	want := `network_test,agent=fra1,direction=upload,protocol=tcp,target=iperf.he.net,type=iperf3 result_id="1d9cb97159106d3d",bandwidth_mbps=94.2,sent_bytes=117750000,dial.connect_ms=8.4 1768471200000000000` + "\n"
+	if got != want {
+		t.Errorf("Expected\n%q\ngot\n%q", want, got)
+	}
+}
+
+func TestInfluxLine_Escapes(t *testing.T) {
+	withAgentID(t, "")
+	r := &StoredResult{ID: `id"\`, Type: TEST_TYPE_TWAMP, Target: "lab host,a=b", StartedAt: time.Unix(0, 1)}
+	got := influxLine(r, "net test,x")
+
+	want := `net\ test\,x,target=lab\ host\,a\=b,type=twamp result_id="id\"\\" 1` + "\n"
+	if got != want {
+		t.Errorf("Expected\n%q\ngot\n%q", want, got)
+	}
+}
@@ -0,0 +1,324 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"network-test-api/pkg/nettest"
+)
+
+// iperf3Options maps the fields of a defaulted iperf3 request onto nettest
+// options. The payload, family, source binding and login runIperf3 resolves
+// from the request are added by the caller.
+func iperf3Options(req RunRequest) []nettest.Option {
+	ctx, progress := req.runContext(), req.progress
+	return []nettest.Option{
+		nettest.WithDuration(time.Duration(req.Duration) * time.Second),
+		nettest.WithParallel(req.Parallel),
+		nettest.WithProtocol(req.Protocol),
+		nettest.WithReverse(req.Reverse),
+		nettest.WithBandwidth(req.Bandwidth.bps()),
+		nettest.WithPacingTimer(time.Duration(req.PacingTimer) * time.Microsecond),
+		nettest.WithECN(req.ECN),
+		nettest.WithBytes(req.NumBytes),
+		nettest.WithBlockCount(req.BlockCount),
+		nettest.WithOmit(time.Duration(req.Omit) * time.Second),
+		nettest.WithCongestion(req.Congestion),
+		nettest.WithWindow(req.WindowSize),
+		nettest.WithZeroCopy(req.ZeroCopy),
+		nettest.WithTCPInfo(req.TCPInfo),
+		nettest.WithPhaseFunc(func(phase string) { testPhase(ctx, phase) }),
+		nettest.WithIntervalFunc(func(interval nettest.Iperf3Interval) {
+			progress.add(SeriesPoint{T: interval.Start, Value: interval.BandwidthMbps})
+		}),
+	}
+}
+
+// runIperf3 applies defaults to a decoded request, runs the test and records the result.
+// Errors come with the HTTP status to report them with.
+func runIperf3(req RunRequest, profile *Profile) (map[string]interface{}, int, error) {
+	// Defaults
+	if req.ServerPort == 0 {
+		req.ServerPort = 5201
+	}
+	if err := validateTunnel(req); err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	if req.DualStack != "" {
+		return runDualStack(TEST_TYPE_IPERF3, runIperf3, req, profile, false)
+	}
+	defaultIperf3TransferDuration(&req, profile)
+	if req.Duration == 0 {
+		req.Duration = DEFAULT_IPERF3_DURATION
+	}
+	if req.Parallel == 0 {
+		req.Parallel = 1
+	}
+	if req.Protocol == "" {
+		req.Protocol = "TCP"
+	}
+	if !req.Bandwidth.Set {
+		req.Bandwidth = mbps(100) // Default: 100 Mbit/s
+		if max := req.apiKey.maxBandwidth(); max > 0 && float64(max) < req.Bandwidth.Mbps {
+			req.Bandwidth = mbps(max)
+		}
+	}
+	if err := checkProfileLimits(req, profile); err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	payload, err := nettest.ParsePayloadEntropy(req.Payload)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	seriesOpts, err := parseSeriesOptions(req.Series, req.SeriesMaxPoints, req.SeriesDownsample)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	family, err := parseAddressFamily(req.AddressFamily)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	bind, family, err := nettest.ParseSourceBindingIn(req.Netns, req.SourceAddress, req.Interface, family)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	auth, err := iperf3AuthFor(req)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	if err := validateLockWait(&req); err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	if err := validateCallbackURL(req.CallbackURL); err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	var predictedMbps float64
+	var predictionLowerBound bool
+	if req.PredictionID != "" {
+		var status int
+		predictedMbps, predictionLowerBound, status, err = storedPrediction(req)
+		if err != nil {
+			return nil, status, err
+		}
+	}
+	mode, err := parseBandwidthMode(req.BandwidthMode)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	if mode != BANDWIDTH_MODE_FIXED && req.MaxLoss == 0 {
+		req.MaxLoss = DEFAULT_ADAPTIVE_MAXLOSS
+	}
+	if mode == BANDWIDTH_MODE_RAMP && !req.RampStep.Set {
+		req.RampStep = req.Bandwidth
+	}
+
+	releaseSlot, status, err := acquireTestSlot(TEST_TYPE_IPERF3, req)
+	if err != nil {
+		return nil, status, err
+	}
+	defer releaseSlot()
+
+	lock, release, status, err := lockTest(TEST_TYPE_IPERF3, req, true)
+	if err != nil {
+		return nil, status, err
+	}
+	defer release()
+
+	var tunnel *TunnelReport
+	if req.Tunnel != "" {
+		var closeTunnel func()
+		tunnel, closeTunnel, status, err = openTunnel(req, family)
+		if err != nil {
+			return nil, status, err
+		}
+		defer closeTunnel()
+	}
+
+	cancel := withTestTimeout(&req)
+	defer cancel()
+
+	// After the lock, so no coordinated test loads the path during the idle baseline
+	var preflight *PreflightResult
+	if req.Preflight {
+		preflight, err = preflightCheck(req.ServerHost, req.ServerPort, family, bind)
+		if err != nil {
+			return nil, http.StatusInternalServerError, err
+		}
+	}
+
+	if mode != BANDWIDTH_MODE_FIXED {
+		return iperfAdaptiveRun(req, mode, profile, payload, family, bind, auth, seriesOpts, lock, preflight, tunnel)
+	}
+
+	logf(req.ctx, "iperf3 test: %s:%d (%s, %ds, %d streams, reverse=%v, bandwidth=%s, payload=%s, family=%s, ecn=%v)",
+		req.ServerHost, req.ServerPort, req.Protocol, req.Duration, req.Parallel, req.Reverse, req.Bandwidth, payload, family, req.ECN)
+
+	// Run native iperf3 test
+	req.progress.start("mbps", req.Duration)
+	opts := append(iperf3Options(req), nettest.WithPayload(payload), nettest.WithFamily(family), nettest.WithSource(bind), nettest.WithAuth(auth))
+	result, err := nettest.RunTest(req.runContext(), req.ServerHost, req.ServerPort, opts...)
+	if ctx := req.runContext(); ctx.Err() != nil {
+		err = canceledError(ctx)
+	}
+
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	// Return results
+	data := map[string]interface{}{
+		"server":         result.Server,
+		"port":           result.Port,
+		"protocol":       result.Protocol,
+		"duration_sec":   result.Duration,
+		"bandwidth_mbps": result.BandwidthMbps,
+		"dial":           result.Dial,
+	}
+	if bind != nil {
+		data["source"] = bind
+	}
+
+	if req.Reverse {
+		data["received_bytes"] = result.ReceivedBytes
+	} else {
+		data["sent_bytes"] = result.SentBytes
+	}
+
+	if result.HasRetransmits {
+		data["retransmits"] = result.Retransmits
+		data["stream_retransmits"] = result.StreamRetransmits
+	}
+	if result.TargetBytes > 0 {
+		data["target_bytes"] = result.TargetBytes
+		data["target_reached"] = result.TargetReached
+	}
+	if result.OmitSec > 0 {
+		data["omit_sec"] = result.OmitSec
+		data["omitted_bytes"] = result.OmittedBytes
+	}
+	if result.SenderCongestion != "" {
+		data["sender_tcp_congestion"] = result.SenderCongestion
+	}
+	if result.ReceiverCongestion != "" {
+		data["receiver_tcp_congestion"] = result.ReceiverCongestion
+	}
+	if result.SocketBuffers != nil {
+		data["socket_buffers"] = result.SocketBuffers
+	}
+	if req.ZeroCopy {
+		data["zerocopy"] = result.ZeroCopy
+	}
+	if result.TCPInfo != nil {
+		data["tcp_info"] = result.TCPInfo
+	}
+	data["intervals"] = result.Intervals
+	data["streams"] = result.Streams
+
+	if result.ReceiverReport {
+		data["packets"] = result.Packets
+		data["lost_packets"] = result.LostPackets
+		data["loss_percent"] = result.LossPercent
+		data["jitter_ms"] = result.JitterMs
+		if req.Reverse {
+			data["out_of_order_packets"] = result.OutOfOrder
+		}
+	}
+	if result.Protocol == "UDP" && !req.Reverse {
+		data["packets_sent"] = result.PacketsSent
+	}
+	if result.ServerResults != nil {
+		data["server_results"] = result.ServerResults
+	}
+	if result.Pacing != nil {
+		data["pacing"] = result.Pacing
+	}
+
+	if seriesOpts.Enabled {
+		data["series"] = buildSeries("mbps", result.Series, seriesOpts)
+		if result.RetransmitSeries != nil {
+			data["retransmit_series"] = buildSeries("retransmits", result.RetransmitSeries, seriesOpts)
+		}
+	}
+	if profile != nil {
+		data["profile"] = profile.Name
+	}
+	data["lock"] = lock
+	if preflight != nil {
+		data["preflight"] = preflight
+	}
+	if result.MTU != nil {
+		data["mtu"] = result.MTU
+	}
+	if result.ECN != nil {
+		data["ecn"] = result.ECN
+	}
+	if tunnel != nil {
+		data["tunnel"] = tunnel.iperf3(result)
+	}
+	if req.PredictionID != "" {
+		check := checkPrediction(req.PredictionID, predictedMbps, predictionLowerBound, req.Parallel, result.BandwidthMbps)
+		if check.BelowPrediction {
+			logf(req.ctx, "iperf3 test: %.1f Mbit/s is %.0f%% of the %.1f Mbit/s predicted by result %s",
+				check.ActualMbps, check.AchievedPercent, check.PredictedMbps, req.PredictionID)
+		}
+		data["prediction"] = check
+	}
+
+	recordResult(TEST_TYPE_IPERF3, req, result.StartedAt, data)
+	notifyCallback(req.CallbackURL, data)
+
+	return data, http.StatusOK, nil
+}
+
+// Run an adaptive or ramp UDP rate search for an already validated request
+func iperfAdaptiveRun(req RunRequest, mode string, profile *Profile, payload nettest.PayloadEntropy, family string, bind *nettest.SourceBinding, auth *nettest.Iperf3Auth, seriesOpts SeriesOptions, lock *LockInfo, preflight *PreflightResult, tunnel *TunnelReport) (map[string]interface{}, int, error) {
+	logf(req.ctx, "iperf3 %s test: %s:%d (%ds budget, %d streams, start=%s, max_loss=%.2f%%, payload=%s, family=%s)",
+		mode, req.ServerHost, req.ServerPort, req.Duration, req.Parallel, req.Bandwidth, req.MaxLoss, payload, family)
+
+	var search rateSearch = &adaptiveRate{Rate: float64(req.Bandwidth.bps())}
+	if mode == BANDWIDTH_MODE_RAMP {
+		search = &rampRate{Rate: float64(req.Bandwidth.bps()), Step: float64(req.RampStep.bps())}
+	}
+	result, err := adaptiveIperf3Test(req.runContext(), req.ServerHost, req.ServerPort, req.Duration, req.Parallel, search, trialRateLimit(req, profile), req.MaxLoss, payload, family, bind, auth)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	data := map[string]interface{}{
+		"server":         req.ServerHost,
+		"port":           req.ServerPort,
+		"protocol":       "UDP",
+		"bandwidth_mode": mode,
+		"duration_sec":   result.Duration,
+		"sent_bytes":     result.SentBytes,
+		"bandwidth_mbps": result.SustainableMbps,
+		"dial":           result.Dial,
+		mode:             result,
+	}
+	if bind != nil {
+		data["source"] = bind
+	}
+
+	if seriesOpts.Enabled {
+		data["series"] = buildSeries("mbps", result.Series, seriesOpts)
+	}
+	if profile != nil {
+		data["profile"] = profile.Name
+	}
+	data["lock"] = lock
+	if preflight != nil {
+		data["preflight"] = preflight
+	}
+	if tunnel != nil {
+		dialFamily := family
+		if result.Dial != nil {
+			dialFamily = result.Dial.Family
+		}
+		data["tunnel"] = tunnel.udp(result.SustainableMbps, dialFamily, 0)
+	}
+
+	recordResult(TEST_TYPE_IPERF3, req, result.StartedAt, data)
+	notifyCallback(req.CallbackURL, data)
+
+	return data, http.StatusOK, nil
+}
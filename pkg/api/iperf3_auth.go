@@ -0,0 +1,41 @@
+package api
+
+import (
+	"fmt"
+	"strings"
+
+	"network-test-api/pkg/nettest"
+)
+
+// iperf3 authentication (--username, --rsa-public-key-path). The credentials
+// come from SECRETS_FILE, like those of S3 and SSH tests.
+const (
+	iperf3CredentialsPublicKey = "rsa_public_key" // PEM public key of the server's key pair
+	iperf3CredentialsPadding   = "rsa_padding"    // oaep (default) or pkcs1, as the server's --use-pkcs1-padding
+)
+
+var iperf3CredentialFields = []string{"username", "password", iperf3CredentialsPublicKey}
+
+// iperf3AuthFor looks up the request's credentials, nil when it has none
+func iperf3AuthFor(req RunRequest) (*nettest.Iperf3Auth, error) {
+	if req.Credentials == "" {
+		return nil, nil
+	}
+	secret, err := secretStore.Lookup(req.Credentials, iperf3CredentialFields...)
+	if err != nil {
+		return nil, err
+	}
+	var pkcs1 bool
+	switch strings.ToLower(secret[iperf3CredentialsPadding]) {
+	case "", "oaep":
+	case "pkcs1":
+		pkcs1 = true
+	default:
+		return nil, fmt.Errorf("credentials %q: invalid %s %q (expected oaep or pkcs1)", req.Credentials, iperf3CredentialsPadding, secret[iperf3CredentialsPadding])
+	}
+	auth, err := nettest.NewIperf3Auth(secret["username"], secret["password"], secret[iperf3CredentialsPublicKey], pkcs1)
+	if err != nil {
+		return nil, fmt.Errorf("credentials %q: %s: %v", req.Credentials, iperf3CredentialsPublicKey, err)
+	}
+	return auth, nil
+}
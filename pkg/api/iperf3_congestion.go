@@ -0,0 +1,41 @@
+package api
+
+import (
+	"regexp"
+	"strings"
+
+	"network-test-api/pkg/nettest"
+)
+
+// Kernel congestion control names are at most 15 characters (TCP_CA_NAME_MAX)
+var congestionNamePattern = regexp.MustCompile(`^[a-z0-9_]{1,15}$`)
+
+// iperf3Congestion checks the congestion control algorithm of an iperf3
+// request, on a socket of its own, before any stream asks for it
+func (v *requestValidator) iperf3Congestion(req RunRequest) {
+	switch {
+	case req.Congestion == "":
+	case !nettest.TCPInfoSupported:
+		v.fail("congestion", req.Congestion, "is only available on Linux agents")
+	case !strings.EqualFold(req.Protocol, "TCP"):
+		v.fail("congestion", req.Congestion, "requires protocol TCP")
+	case !congestionNamePattern.MatchString(req.Congestion):
+		v.fail("congestion", req.Congestion, "must be an algorithm name such as cubic, bbr or reno")
+	default:
+		if err := nettest.CheckCongestion(req.Congestion); err != nil {
+			v.fail("congestion", req.Congestion, "is not available on this agent: %v", err)
+		}
+	}
+}
+
+// iperf3TCPInfo checks tcp_info, which samples the sending streams of TCP
+// uploads
+func (v *requestValidator) iperf3TCPInfo(req RunRequest) {
+	switch {
+	case !req.TCPInfo:
+	case !nettest.TCPInfoSupported:
+		v.fail("tcp_info", true, "is only available on Linux agents")
+	case !strings.EqualFold(req.Protocol, "TCP") || req.Reverse:
+		v.fail("tcp_info", true, "requires protocol TCP without reverse")
+	}
+}
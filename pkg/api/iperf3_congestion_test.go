@@ -0,0 +1,67 @@
+package api
+
+import (
+	"strings"
+	"testing"
+
+	"network-test-api/pkg/nettest"
+)
+
+func TestIperf3Congestion(t *testing.T) {
+	tests := []struct {
+		congestion string
+		protocol   string
+		wantErr    string
+	}{
+		{"", "UDP", ""},
+		{"cubic", "TCP", ""},
+		{"reno", "tcp", ""},
+		{"nope", "TCP", "not available on this agent"},
+		{"cubic", "UDP", "requires protocol TCP"},
+		{"BBR", "TCP", "must be an algorithm name"},
+		{"a_very_long_algorithm", "TCP", "must be an algorithm name"},
+	}
+	for _, tt := range tests {
+		if !nettest.TCPInfoSupported && tt.congestion != "" {
+			tt.wantErr = "only available on Linux"
+		}
+		v := &requestValidator{}
+		v.iperf3Congestion(RunRequest{Congestion: tt.congestion, Protocol: tt.protocol})
+		got := fieldMessages(v)
+		switch {
+		case tt.wantErr == "" && got != "":
+			t.Errorf("Expected %q over %s to be valid, got %s", tt.congestion, tt.protocol, got)
+		case tt.wantErr != "" && !strings.Contains(got, tt.wantErr):
+			t.Errorf("Expected an error containing %q for %q over %s, got %q", tt.wantErr, tt.congestion, tt.protocol, got)
+		}
+	}
+}
+
+func TestIperf3TCPInfo(t *testing.T) {
+	tests := []struct {
+		tcpInfo  bool
+		protocol string
+		reverse  bool
+		wantErr  string
+	}{
+		{false, "UDP", true, ""},
+		{true, "TCP", false, ""},
+		{true, "tcp", false, ""},
+		{true, "UDP", false, "requires protocol TCP"},
+		{true, "TCP", true, "without reverse"},
+	}
+	for _, tt := range tests {
+		if !nettest.TCPInfoSupported && tt.tcpInfo {
+			tt.wantErr = "only available on Linux"
+		}
+		v := &requestValidator{}
+		v.iperf3TCPInfo(RunRequest{TCPInfo: tt.tcpInfo, Protocol: tt.protocol, Reverse: tt.reverse})
+		got := fieldMessages(v)
+		switch {
+		case tt.wantErr == "" && got != "":
+			t.Errorf("Expected tcp_info %v over %s, reverse %v to be valid, got %s", tt.tcpInfo, tt.protocol, tt.reverse, got)
+		case tt.wantErr != "" && !strings.Contains(got, tt.wantErr):
+			t.Errorf("Expected an error containing %q for tcp_info over %s, reverse %v, got %q", tt.wantErr, tt.protocol, tt.reverse, got)
+		}
+	}
+}
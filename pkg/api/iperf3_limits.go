@@ -0,0 +1,51 @@
+package api
+
+import "strings"
+
+// Time-limited iperf3 tests run for duration seconds (iperf3 -t)
+const DEFAULT_IPERF3_DURATION = 5 // Seconds
+
+// Transfer-limited iperf3 tests (iperf3 -n and -k) end once the amount is moved;
+// duration then only bounds how long that may take
+const DEFAULT_IPERF3_TRANSFER_TIME_LIMIT = 60 // Seconds
+
+// iperf3Transfer checks that num_bytes and block_count, when set, are the only
+// limit of the test
+func (v *requestValidator) iperf3Transfer(req RunRequest) {
+	switch {
+	case req.NumBytes > 0 && req.BlockCount > 0:
+		v.fail("block_count", req.BlockCount, "cannot be combined with num_bytes")
+	case req.NumBytes > 0 && searchesRate(req.BandwidthMode):
+		v.fail("num_bytes", req.NumBytes, "does not apply to adaptive or ramp bandwidth_mode")
+	case req.BlockCount > 0 && searchesRate(req.BandwidthMode):
+		v.fail("block_count", req.BlockCount, "does not apply to adaptive or ramp bandwidth_mode")
+	}
+}
+
+// defaultIperf3TransferDuration defaults the duration of a transfer-limited
+// test to its time limit, within the profile's
+func defaultIperf3TransferDuration(req *RunRequest, profile *Profile) {
+	if req.Duration != 0 || (req.NumBytes == 0 && req.BlockCount == 0) {
+		return
+	}
+	req.Duration = DEFAULT_IPERF3_TRANSFER_TIME_LIMIT
+	if profile != nil && profile.Limits.MaxDuration > 0 && profile.Limits.MaxDuration < req.Duration {
+		req.Duration = profile.Limits.MaxDuration
+	}
+}
+
+// Omitted warm-up of iperf3 TCP tests (iperf3 -O), run on top of the duration
+const MAX_IPERF3_OMIT = 60 // Seconds
+
+// iperf3Omit checks the omit seconds of an iperf3 request
+func (v *requestValidator) iperf3Omit(req RunRequest) {
+	switch {
+	case req.Omit == 0:
+	case req.Omit < 0 || req.Omit > MAX_IPERF3_OMIT:
+		v.fail("omit", req.Omit, "must be between 1 and %d seconds", MAX_IPERF3_OMIT)
+	case !strings.EqualFold(req.Protocol, "TCP"):
+		v.fail("omit", req.Omit, "requires protocol TCP; UDP streams have no slow start to skip")
+	case req.NumBytes > 0 || req.BlockCount > 0:
+		v.fail("omit", req.Omit, "does not apply to num_bytes or block_count tests")
+	}
+}
@@ -0,0 +1,101 @@
+package api
+
+import (
+	"strings"
+	"testing"
+)
+
+// fieldMessages lists the invalid fields a validator collected as "field message"
+func fieldMessages(v *requestValidator) string {
+	messages := make([]string, len(v.fields))
+	for i, f := range v.fields {
+		messages[i] = f.Field + " " + f.Message
+	}
+	return strings.Join(messages, "; ")
+}
+
+func TestIperf3Transfer(t *testing.T) {
+	tests := []struct {
+		req     RunRequest
+		wantErr string
+	}{
+		{RunRequest{}, ""},
+		{RunRequest{NumBytes: 1e8}, ""},
+		{RunRequest{BlockCount: 10, BandwidthMode: "fixed"}, ""},
+		{RunRequest{NumBytes: 1, BlockCount: 1}, "block_count cannot be combined with num_bytes"},
+		{RunRequest{NumBytes: 1, BandwidthMode: "Adaptive"}, "num_bytes does not apply to adaptive"},
+		{RunRequest{BlockCount: 1, BandwidthMode: "ramp"}, "block_count does not apply to adaptive or ramp"},
+	}
+	for _, tt := range tests {
+		v := &requestValidator{}
+		v.iperf3Transfer(tt.req)
+		got := fieldMessages(v)
+		switch {
+		case tt.wantErr == "" && got != "":
+			t.Errorf("Expected %+v to be valid, got %s", tt.req, got)
+		case tt.wantErr != "" && !strings.Contains(got, tt.wantErr):
+			t.Errorf("Expected an error containing %q for %+v, got %q", tt.wantErr, tt.req, got)
+		}
+	}
+}
+
+func TestDefaultIperf3TransferDuration(t *testing.T) {
+	tests := []struct {
+		req   RunRequest
+		limit int
+		want  int
+	}{
+		{RunRequest{}, 0, 0},                            // Time-limited test, left to the usual default
+		{RunRequest{NumBytes: 1e8}, 0, 60},              // Time limit defaulted
+		{RunRequest{NumBytes: 1e8}, 20, 20},             // Within the profile
+		{RunRequest{BlockCount: 10, Duration: 5}, 0, 5}, // An explicit limit is kept
+	}
+	for _, tt := range tests {
+		req := tt.req
+		var profile *Profile
+		if tt.limit > 0 {
+			profile = &Profile{Limits: ProfileLimits{MaxDuration: tt.limit}}
+		}
+		defaultIperf3TransferDuration(&req, profile)
+		if req.Duration != tt.want {
+			t.Errorf("Expected duration %d for %+v, got %d", tt.want, tt.req, req.Duration)
+		}
+	}
+}
+
+func TestIperf3Omit(t *testing.T) {
+	tests := []struct {
+		req     RunRequest
+		wantErr string
+	}{
+		{RunRequest{Protocol: "UDP"}, ""},
+		{RunRequest{Protocol: "TCP", Omit: 3}, ""},
+		{RunRequest{Protocol: "tcp", Omit: 60}, ""},
+		{RunRequest{Protocol: "TCP", Omit: -1}, "between 1 and 60"},
+		{RunRequest{Protocol: "TCP", Omit: 61}, "between 1 and 60"},
+		{RunRequest{Protocol: "UDP", Omit: 2}, "requires protocol TCP"},
+		{RunRequest{Protocol: "TCP", Omit: 2, NumBytes: 1e6}, "num_bytes or block_count"},
+	}
+	for _, tt := range tests {
+		v := &requestValidator{}
+		v.iperf3Omit(tt.req)
+		got := fieldMessages(v)
+		switch {
+		case tt.wantErr == "" && got != "":
+			t.Errorf("Expected %+v to be valid, got %s", tt.req, got)
+		case tt.wantErr != "" && !strings.Contains(got, tt.wantErr):
+			t.Errorf("Expected an error containing %q for %+v, got %q", tt.wantErr, tt.req, got)
+		}
+	}
+}
+
+func TestIperf3CombinedFields_ListedTogether(t *testing.T) {
+	// num_bytes with block_count and omit over UDP are reported in one response
+	req := RunRequest{Protocol: "UDP", NumBytes: 1e6, BlockCount: 10, Omit: 100}
+	v := &requestValidator{}
+	v.iperf3Transfer(req)
+	v.iperf3Omit(req)
+	if len(v.fields) != 2 || v.fields[0].Field != "block_count" || v.fields[1].Field != "omit" {
+		t.Errorf("Expected block_count and omit to be listed together, got %+v", v.fields)
+	}
+}
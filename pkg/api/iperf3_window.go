@@ -0,0 +1,40 @@
+package api
+
+import (
+	"strings"
+
+	"network-test-api/pkg/nettest"
+)
+
+// Socket buffer sizes of iperf3 data streams (iperf3 -w)
+const (
+	MIN_IPERF3_WINDOW = 4096      // Bytes
+	MAX_IPERF3_WINDOW = 512 << 20 // iperf3's own limit
+)
+
+// Longest pacing timer of iperf3 tests in microseconds
+const MAX_PACING_TIMER = 1000000
+
+// iperf3Window checks the window_size of an iperf3 request
+func (v *requestValidator) iperf3Window(req RunRequest) {
+	switch {
+	case req.WindowSize == 0:
+	case !nettest.SocketBuffersSupported:
+		v.fail("window_size", req.WindowSize, "is only available on Linux agents")
+	case req.WindowSize < MIN_IPERF3_WINDOW || req.WindowSize > MAX_IPERF3_WINDOW:
+		v.fail("window_size", req.WindowSize, "must be between %d and %d bytes", MIN_IPERF3_WINDOW, MAX_IPERF3_WINDOW)
+	case searchesRate(req.BandwidthMode):
+		v.fail("window_size", req.WindowSize, "does not apply to adaptive or ramp bandwidth_mode")
+	}
+}
+
+// iperf3ZeroCopy checks zerocopy, which only TCP uploads send with
+func (v *requestValidator) iperf3ZeroCopy(req RunRequest) {
+	switch {
+	case !req.ZeroCopy:
+	case !nettest.ZeroCopySupported:
+		v.fail("zerocopy", true, "is only available on Linux agents")
+	case !strings.EqualFold(req.Protocol, "TCP") || req.Reverse:
+		v.fail("zerocopy", true, "requires protocol TCP without reverse")
+	}
+}
@@ -0,0 +1,60 @@
+package api
+
+import (
+	"testing"
+
+	"network-test-api/pkg/nettest"
+)
+
+func TestIperf3Window(t *testing.T) {
+	tests := []struct {
+		window  int
+		mode    string
+		wantErr bool
+	}{
+		{0, "", false}, // Not set: autotuning
+		{4096, "", false},
+		{4 << 20, "fixed", false},
+		{512 << 20, "", false},
+		{4095, "", true},
+		{512<<20 + 1, "", true},
+		{-1, "", true},
+		{4 << 20, "ADAPTIVE", true},
+		{4 << 20, "ramp", true},
+	}
+	for _, tt := range tests {
+		if !nettest.SocketBuffersSupported && tt.window != 0 {
+			tt.wantErr = true // Only available on Linux
+		}
+		v := &requestValidator{}
+		v.iperf3Window(RunRequest{WindowSize: tt.window, BandwidthMode: tt.mode})
+		if (len(v.fields) > 0) != tt.wantErr {
+			t.Errorf("window_size %d, mode %q: expected error %v, got %+v", tt.window, tt.mode, tt.wantErr, v.fields)
+		}
+	}
+}
+
+func TestIperf3ZeroCopy(t *testing.T) {
+	tests := []struct {
+		zeroCopy bool
+		protocol string
+		reverse  bool
+		wantErr  bool
+	}{
+		{false, "UDP", true, false}, // Not set
+		{true, "TCP", false, false},
+		{true, "tcp", false, false},
+		{true, "UDP", false, true},
+		{true, "TCP", true, true}, // The server sends downloads
+	}
+	for _, tt := range tests {
+		if !nettest.ZeroCopySupported && tt.zeroCopy {
+			tt.wantErr = true // Only available on Linux
+		}
+		v := &requestValidator{}
+		v.iperf3ZeroCopy(RunRequest{ZeroCopy: tt.zeroCopy, Protocol: tt.protocol, Reverse: tt.reverse})
+		if (len(v.fields) > 0) != tt.wantErr {
+			t.Errorf("zerocopy %v over %s, reverse %v: expected error %v, got %+v", tt.zeroCopy, tt.protocol, tt.reverse, tt.wantErr, v.fields)
+		}
+	}
+}
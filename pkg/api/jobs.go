@@ -0,0 +1,401 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/tcaine/twamp"
+
+	"network-test-api/pkg/nettest"
+)
+
+// Jobs run a test request in the background for callers that cannot hold the
+// HTTP request open for the whole test (POST /<test>/client/run?async=true)
+const MAX_FINISHED_JOBS = 1000
+
+// Job states
+const (
+	JOB_STATE_RUNNING   = "running"
+	JOB_STATE_COMPLETED = "completed"
+	JOB_STATE_FAILED    = "failed"
+	JOB_STATE_CANCELED  = "canceled"
+)
+
+// Job is one asynchronous test run
+type Job struct {
+	ID         string                 `json:"id"`
+	Type       string                 `json:"type"`
+	Target     string                 `json:"target"`
+	State      string                 `json:"state"`
+	CreatedAt  time.Time              `json:"created_at"`
+	FinishedAt *time.Time             `json:"finished_at,omitempty"`
+	ElapsedSec float64                `json:"elapsed_sec"`
+	Progress   *JobProgressReport     `json:"progress,omitempty"`  // Partial results while running
+	ResultID   string                 `json:"result_id,omitempty"` // Stored result, see GET /results/{id}
+	Result     map[string]interface{} `json:"result,omitempty"`    // The response data a synchronous run returns
+	Error      string                 `json:"error,omitempty"`
+	Code       string                 `json:"code,omitempty"`
+	HTTPStatus int                    `json:"http_status,omitempty"` // Status a synchronous run would have failed with
+
+	progress *JobProgress
+	cancel   context.CancelCauseFunc
+}
+
+// JobProgress collects the samples a running test produced so far. Tests that
+// support it are handed one through RunRequest; a nil JobProgress ignores them.
+type JobProgress struct {
+	mu       sync.Mutex
+	unit     string
+	expected int
+	points   []SeriesPoint
+	probes   []ProbeEvent  // TWAMP replies in full, see GET /jobs/{id}/probes
+	runs     int           // Calls of start, see GET /jobs/{id}/stream
+	finished bool          // The job has its outcome
+	changed  chan struct{} // Closed at the next change, for streams waiting on one
+}
+
+// JobProgressReport is a snapshot of a JobProgress
+type JobProgressReport struct {
+	Unit            string        `json:"unit"`                       // mbps for iperf3, rtt_ms for TWAMP
+	Samples         int           `json:"samples"`                    // Per-second throughput samples or replies so far
+	ExpectedSamples int           `json:"expected_samples,omitempty"` // Samples a complete run takes
+	PercentComplete float64       `json:"percent_complete,omitempty"`
+	Latest          *SeriesPoint  `json:"latest,omitempty"`
+	Points          []SeriesPoint `json:"points,omitempty"` // All samples so far, only in GET /jobs/{id}
+}
+
+// start announces the unit and, when known, the number of samples of a complete
+// run; tests call it once they are past validation
+func (p *JobProgress) start(unit string, expected int) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.unit, p.expected, p.points, p.probes = unit, expected, nil, nil
+	p.runs++
+	p.notify()
+}
+
+// add records a sample
+func (p *JobProgress) add(point SeriesPoint) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.points = append(p.points, point)
+	p.notify()
+}
+
+// finish marks the job's outcome recorded
+func (p *JobProgress) finish() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.finished = true
+	p.notify()
+}
+
+// notify wakes the streams waiting for a change; the caller holds p.mu
+func (p *JobProgress) notify() {
+	if p.changed != nil {
+		close(p.changed)
+		p.changed = nil
+	}
+}
+
+// report snapshots the progress, with all points when full is set
+func (p *JobProgress) report(full bool) *JobProgressReport {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.unit == "" {
+		return nil
+	}
+	r := &JobProgressReport{Unit: p.unit, Samples: len(p.points), ExpectedSamples: p.expected}
+	if p.expected > 0 {
+		r.PercentComplete = math.Min(100, 100*float64(len(p.points))/float64(p.expected))
+	}
+	if n := len(p.points); n > 0 {
+		latest := p.points[n-1]
+		r.Latest = &latest
+		if full {
+			r.Points = append([]SeriesPoint(nil), p.points...)
+		}
+	}
+	return r
+}
+
+// probeProgress reports the network RTT of each TWAMP reply to p, and the
+// reply itself for GET /jobs/{id}/probes, or is nil without one
+func probeProgress(p *JobProgress, start time.Time) twamp.TwampTestCallbackFunction {
+	if p == nil {
+		return nil
+	}
+	var loss probeLoss
+	return func(r *twamp.TwampResults) {
+		timing := nettest.ComputeProbeTiming(start, r)
+		sentAt := r.SentTimestamp
+		if sentAt.IsZero() {
+			sentAt = r.SenderTimestamp
+		}
+		p.add(SeriesPoint{T: sentAt.Sub(start).Seconds(), Value: float64(timing.NetworkRTT.Nanoseconds()) / 1e6})
+		loss.reply(r)
+		p.addProbe(newProbeEvent(r, timing, sentAt, loss))
+	}
+}
+
+// JobStore holds running jobs and the most recent finished ones
+type JobStore struct {
+	mu       sync.Mutex
+	max      int
+	byID     map[string]*Job
+	finished []string // Finished job IDs, oldest first
+}
+
+// NewJobStore creates an empty store keeping up to max finished jobs
+func NewJobStore(max int) *JobStore {
+	return &JobStore{max: max, byID: make(map[string]*Job)}
+}
+
+var jobStore = NewJobStore(MAX_FINISHED_JOBS)
+
+// snapshot returns a copy safe to encode outside the store lock; full includes
+// the result and every progress point
+func (j *Job) snapshot(now time.Time, full bool) *Job {
+	c := *j
+	end := now
+	if j.FinishedAt != nil {
+		end = *j.FinishedAt
+	}
+	c.ElapsedSec = end.Sub(j.CreatedAt).Seconds()
+	if j.State == JOB_STATE_RUNNING {
+		c.Progress = j.progress.report(full)
+	}
+	if !full {
+		c.Result = nil
+	}
+	return &c
+}
+
+// Start runs req with run in the background and returns the new job
+func (s *JobStore) Start(runner TestRunner, req RunRequest, profile *Profile, done func()) *Job {
+	job := &Job{
+		ID:        newResultID(),
+		Type:      runner.Name(),
+		Target:    requestHost(req),
+		State:     JOB_STATE_RUNNING,
+		CreatedAt: time.Now().UTC(),
+		progress:  &JobProgress{},
+	}
+	req.progress = job.progress
+	req.jobID = job.ID
+	var ctx context.Context
+	ctx, job.cancel = context.WithCancelCause(linkRequest(linkTrace(drainer.Context(), req.ctx), req.ctx))
+
+	s.mu.Lock()
+	s.byID[job.ID] = job
+	snapshot := job.snapshot(job.CreatedAt, false)
+	s.mu.Unlock()
+
+	go func() {
+		defer done()
+		logf(ctx, "Job %s: %s test of %s", job.ID, job.Type, job.Target)
+		data, status, err := runner.Run(ctx, req, profile)
+		if err != nil {
+			warnf(ctx, "Job %s failed: %v", job.ID, err)
+		}
+		s.finish(job, data, status, err)
+		job.cancel(nil)
+	}()
+	return snapshot
+}
+
+// finish records the outcome of a job and evicts the oldest finished jobs beyond max
+func (s *JobStore) finish(job *Job, data map[string]interface{}, status int, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now().UTC()
+	job.FinishedAt = &now
+	if err != nil {
+		job.State = JOB_STATE_FAILED
+		if errorCode(err) == ERR_CANCELED {
+			job.State = JOB_STATE_CANCELED
+		}
+		job.Error = err.Error()
+		job.Code = errorCode(err)
+		job.HTTPStatus = status
+	} else {
+		job.State = JOB_STATE_COMPLETED
+		job.Result = data
+		if id, ok := data["id"].(string); ok {
+			job.ResultID = id
+		}
+	}
+	job.progress.finish()
+	s.finished = append(s.finished, job.ID)
+	for len(s.finished) > s.max {
+		delete(s.byID, s.finished[0])
+		s.finished = s.finished[1:]
+	}
+}
+
+// lookup returns the job itself, whose progress GET /jobs/{id}/stream follows
+func (s *JobStore) lookup(id string) (*Job, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, ok := s.byID[id]
+	return job, ok
+}
+
+// Get returns a full copy of a job by ID
+func (s *JobStore) Get(id string) (*Job, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, ok := s.byID[id]
+	if !ok {
+		return nil, false
+	}
+	return job.snapshot(time.Now().UTC(), true), true
+}
+
+// Cancel stops a running job; it turns canceled once its test has closed its
+// connections. Jobs that already finished cannot be canceled.
+func (s *JobStore) Cancel(id string) (*Job, int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, ok := s.byID[id]
+	if !ok {
+		return nil, http.StatusNotFound, fmt.Errorf("job %s not found", id)
+	}
+	if job.State != JOB_STATE_RUNNING {
+		return nil, http.StatusConflict, fmt.Errorf("job %s is already %s", id, job.State)
+	}
+	job.cancel(errJobCanceled)
+	return job.snapshot(time.Now().UTC(), false), http.StatusAccepted, nil
+}
+
+// List returns summaries of the jobs in state (all when empty), oldest first
+func (s *JobStore) List(state string) []*Job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now().UTC()
+	list := make([]*Job, 0, len(s.byID))
+	for _, job := range s.byID {
+		if state == "" || job.State == state {
+			list = append(list, job.snapshot(now, false))
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.Before(list[j].CreatedAt) })
+	return list
+}
+
+// runTestRequest runs a decoded test request and writes its response, or with
+// ?async=true starts it as a job and answers 202 with the job right away
+func runTestRequest(w http.ResponseWriter, r *http.Request, runner TestRunner, req RunRequest, profile *Profile) {
+	output, err := resultOutput(r)
+	if err != nil {
+		jsonResponse(w, ApiResponse{
+			Status: "error",
+			Error:  err.Error(),
+		}, http.StatusBadRequest)
+		return
+	}
+	async := false
+	if v := r.URL.Query().Get("async"); v != "" {
+		if async, err = strconv.ParseBool(v); err != nil {
+			jsonResponse(w, ApiResponse{
+				Status: "error",
+				Error:  fmt.Sprintf("invalid async %q (expected true or false)", v),
+			}, http.StatusBadRequest)
+			return
+		}
+	}
+	if err := validateRunRequest(runner, req); err != nil {
+		writeRunResponse(w, output, runner.Name(), requestHost(req), nil, http.StatusBadRequest, err)
+		return
+	}
+	req.apiKey = apiKeyFrom(r)
+	if err := req.apiKey.checkLimits(req); err != nil {
+		writeRunResponse(w, output, runner.Name(), requestHost(req), nil, http.StatusBadRequest, err) // Before it counts; defaults are checked again
+		return
+	}
+	end, err := drainer.begin()
+	if err != nil {
+		writeRunResponse(w, output, runner.Name(), requestHost(req), nil, http.StatusServiceUnavailable, err)
+		return
+	}
+	if err := req.apiKey.takeTest(time.Now()); err != nil {
+		end()
+		writeRunResponse(w, output, runner.Name(), requestHost(req), nil, http.StatusTooManyRequests, err)
+		return
+	}
+	if !async {
+		defer end()
+		data, status, err := runner.Run(r.Context(), req, profile)
+		writeRunResponse(w, output, runner.Name(), requestHost(req), data, status, err)
+		return
+	}
+
+	req.ctx = r.Context() // The job's test continues the request's trace and logs its ID
+	job := jobStore.Start(runner, req, profile, end)
+	w.Header().Set("Location", versionedPath(r, "/jobs/"+job.ID))
+	jsonResponse(w, ApiResponse{
+		Status: "ok",
+		Data:   job,
+	}, http.StatusAccepted)
+}
+
+func jobList(w http.ResponseWriter, r *http.Request) {
+	state := r.URL.Query().Get("state")
+	switch state {
+	case "", JOB_STATE_RUNNING, JOB_STATE_COMPLETED, JOB_STATE_FAILED, JOB_STATE_CANCELED:
+	default:
+		jsonResponse(w, ApiResponse{
+			Status: "error",
+			Error:  fmt.Sprintf("invalid state %q (expected %s, %s, %s or %s)", state, JOB_STATE_RUNNING, JOB_STATE_COMPLETED, JOB_STATE_FAILED, JOB_STATE_CANCELED),
+		}, http.StatusBadRequest)
+		return
+	}
+	jsonResponse(w, ApiResponse{
+		Status: "ok",
+		Data:   jobStore.List(state),
+	}, http.StatusOK)
+}
+
+func jobGet(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	job, ok := jobStore.Get(id)
+	if !ok {
+		jsonResponse(w, ApiResponse{
+			Status: "error",
+			Error:  fmt.Sprintf("job %s not found", id),
+		}, http.StatusNotFound)
+		return
+	}
+	jsonResponse(w, ApiResponse{
+		Status: "ok",
+		Data:   job,
+	}, http.StatusOK)
+}
+
+func jobCancel(w http.ResponseWriter, r *http.Request) {
+	job, status, err := jobStore.Cancel(mux.Vars(r)["id"])
+	if err != nil {
+		jsonResponse(w, ApiResponse{
+			Status: "error",
+			Error:  err.Error(),
+		}, status)
+		return
+	}
+	jsonResponse(w, ApiResponse{
+		Status: "ok",
+		Data:   job,
+	}, status)
+}
@@ -0,0 +1,249 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/tcaine/twamp"
+
+	"network-test-api/pkg/nettest"
+)
+
+// GET /jobs/{id}/probes upgrades to a WebSocket pushing every reply of an
+// asynchronous TWAMP job as it arrives: a start message per run, a probe
+// message per reply with its timestamps, RTT and one-way delays, and a done
+// message with the finished job before the server closes. Sending
+// {"action":"cancel"} cancels the job, e.g. once loss_percent spikes.
+
+// ProbeEvent is one TWAMP reply as GET /jobs/{id}/probes pushes it. One-way
+// delays are wall-clock derived, see the twamp result's forward_delay_*_ms.
+type ProbeEvent struct {
+	Seq                 uint32    `json:"seq"`
+	SentAt              time.Time `json:"sent_at"`               // T1, sender clock
+	ReflectorReceivedAt time.Time `json:"reflector_received_at"` // T2, reflector clock
+	ReflectorSentAt     time.Time `json:"reflector_sent_at"`     // T3, reflector clock
+	ReceivedAt          time.Time `json:"received_at"`           // T4, sender clock
+
+	RTTMs              float64 `json:"rtt_ms"`
+	NetworkRTTMs       float64 `json:"network_rtt_ms"` // RTT without the reflector's turnaround
+	TurnaroundMs       float64 `json:"turnaround_ms"`
+	ForwardRawMs       float64 `json:"forward_delay_raw_ms"` // Includes the clock offset
+	ReverseRawMs       float64 `json:"reverse_delay_raw_ms"`
+	ForwardCorrectedMs float64 `json:"forward_delay_corrected_ms"` // Assuming a symmetric path
+	ReverseCorrectedMs float64 `json:"reverse_delay_corrected_ms"`
+	ClockStep          bool    `json:"clock_step,omitempty"` // A clock stepped, the timings are unreliable
+	Duplicate          bool    `json:"duplicate,omitempty"`
+
+	Replies     int     `json:"replies"`      // Distinct replies so far
+	LossPercent float64 `json:"loss_percent"` // Of the probes up to the highest sequence number replied to
+}
+
+// probeLoss tallies the replies of a run for the running loss_percent
+type probeLoss struct {
+	maxSeq  uint32
+	replies int
+}
+
+// reply counts r unless it duplicates an earlier reply
+func (l *probeLoss) reply(r *twamp.TwampResults) {
+	if r.IsDuplicate {
+		return
+	}
+	l.replies++
+	if r.SenderSeqNum > l.maxSeq {
+		l.maxSeq = r.SenderSeqNum
+	}
+}
+
+// percent is the loss among the probes sent up to the latest one replied to.
+// Replies overtaken by a later one count as lost until they arrive.
+func (l probeLoss) percent() float64 {
+	if l.replies == 0 {
+		return 0
+	}
+	expected := float64(l.maxSeq) + 1
+	return 100 * (expected - float64(l.replies)) / expected
+}
+
+func durationMs(d time.Duration) float64 {
+	return float64(d.Nanoseconds()) / 1e6
+}
+
+// newProbeEvent describes reply r sent at sentAt, with the loss after it
+func newProbeEvent(r *twamp.TwampResults, timing nettest.ProbeTiming, sentAt time.Time, loss probeLoss) ProbeEvent {
+	offset := (timing.RawForward - timing.RawReverse) / 2
+	return ProbeEvent{
+		Seq:                 r.SenderSeqNum,
+		SentAt:              sentAt.UTC(),
+		ReflectorReceivedAt: r.ReceiveTimestamp.UTC(),
+		ReflectorSentAt:     r.Timestamp.UTC(),
+		ReceivedAt:          r.FinishedTimestamp.UTC(),
+		RTTMs:               durationMs(timing.RTT),
+		NetworkRTTMs:        durationMs(timing.NetworkRTT),
+		TurnaroundMs:        durationMs(timing.Turnaround),
+		ForwardRawMs:        durationMs(timing.RawForward),
+		ReverseRawMs:        durationMs(timing.RawReverse),
+		ForwardCorrectedMs:  durationMs(timing.RawForward - offset),
+		ReverseCorrectedMs:  durationMs(timing.RawReverse + offset),
+		ClockStep:           timing.SenderStep || timing.ReflectorStep,
+		Duplicate:           r.IsDuplicate,
+		Replies:             loss.replies,
+		LossPercent:         loss.percent(),
+	}
+}
+
+// addProbe records a TWAMP reply
+func (p *JobProgress) addProbe(event ProbeEvent) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.probes = append(p.probes, event)
+	p.notify()
+}
+
+// probeUpdate is what a probe socket has not sent yet of a JobProgress
+type probeUpdate struct {
+	run      int
+	expected int
+	probes   []ProbeEvent
+	finished bool
+}
+
+// probesSince returns the probes of run from index from on, or all probes of
+// the current run if it is another, and a channel closed at the next change
+func (p *JobProgress) probesSince(run, from int) (probeUpdate, <-chan struct{}) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.changed == nil {
+		p.changed = make(chan struct{})
+	}
+	if run != p.runs || from > len(p.probes) {
+		from = 0
+	}
+	u := probeUpdate{run: p.runs, expected: p.expected, finished: p.finished}
+	u.probes = append([]ProbeEvent(nil), p.probes[from:]...)
+	return u, p.changed
+}
+
+// probeMessage is a message of GET /jobs/{id}/probes, in either direction
+type probeMessage struct {
+	Type   string      `json:"type,omitempty"` // start, probe, canceled, error or done
+	Action string      `json:"action,omitempty"`
+	Data   interface{} `json:"data,omitempty"`
+	Error  string      `json:"error,omitempty"`
+}
+
+func (c *wsConn) writeJSON(v interface{}) error {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return c.WriteText(raw)
+}
+
+// readProbeActions handles the messages of a probe socket's client until it
+// goes away, then closes gone
+func readProbeActions(ws *wsConn, id string, gone chan<- struct{}) {
+	defer close(gone)
+	for {
+		raw, err := ws.ReadMessage()
+		if err != nil {
+			return
+		}
+		var msg probeMessage
+		if err := json.Unmarshal(raw, &msg); err != nil {
+			_ = ws.writeJSON(probeMessage{Type: "error", Error: fmt.Sprintf("invalid message: %v", err)})
+			continue
+		}
+		switch msg.Action {
+		case "cancel":
+			job, _, err := jobStore.Cancel(id)
+			if err != nil {
+				_ = ws.writeJSON(probeMessage{Type: "error", Error: err.Error()})
+				continue
+			}
+			_ = ws.writeJSON(probeMessage{Type: "canceled", Data: job})
+		default:
+			_ = ws.writeJSON(probeMessage{Type: "error", Error: fmt.Sprintf("invalid action %q (expected cancel)", msg.Action)})
+		}
+	}
+}
+
+func jobProbes(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	job, ok := jobStore.lookup(id)
+	if !ok {
+		jsonResponse(w, ApiResponse{
+			Status: "error",
+			Error:  fmt.Sprintf("job %s not found", id),
+		}, http.StatusNotFound)
+		return
+	}
+	if job.Type != TEST_TYPE_TWAMP {
+		jsonResponse(w, ApiResponse{
+			Status: "error",
+			Error:  fmt.Sprintf("job %s is a %s test, probes are only sent for %s jobs", id, job.Type, TEST_TYPE_TWAMP),
+		}, http.StatusBadRequest)
+		return
+	}
+	ws, status, err := wsUpgrade(w, r)
+	if err != nil {
+		jsonResponse(w, ApiResponse{
+			Status: "error",
+			Error:  err.Error(),
+		}, status)
+		return
+	}
+
+	gone := make(chan struct{})
+	go readProbeActions(ws, id, gone)
+
+	keepalive := time.NewTicker(JOB_STREAM_KEEPALIVE)
+	defer keepalive.Stop()
+	run, sent := 0, 0
+	for {
+		u, changed := job.progress.probesSince(run, sent)
+		if u.run != run {
+			run, sent = u.run, 0
+			start := map[string]interface{}{"run": run}
+			if u.expected > 0 {
+				start["expected_probes"] = u.expected
+			}
+			if ws.writeJSON(probeMessage{Type: "start", Data: start}) != nil {
+				ws.Close(WS_CLOSE_NORMAL, "")
+				return
+			}
+		}
+		for _, probe := range u.probes {
+			sent++
+			if ws.writeJSON(probeMessage{Type: "probe", Data: probe}) != nil {
+				ws.Close(WS_CLOSE_NORMAL, "")
+				return
+			}
+		}
+		if u.finished {
+			if final, ok := jobStore.Get(id); ok {
+				_ = ws.writeJSON(probeMessage{Type: "done", Data: final})
+			}
+			ws.Close(WS_CLOSE_NORMAL, "job finished")
+			return
+		}
+
+		select {
+		case <-changed:
+		case <-keepalive.C:
+			if ws.Ping() != nil {
+				ws.Close(WS_CLOSE_NORMAL, "")
+				return
+			}
+		case <-gone:
+			ws.Close(WS_CLOSE_NORMAL, "")
+			return
+		}
+	}
+}
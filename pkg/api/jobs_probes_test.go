@@ -0,0 +1,39 @@
+package api
+
+import (
+	"math"
+	"testing"
+
+	"github.com/tcaine/twamp"
+)
+
+func TestWSAcceptKey(t *testing.T) {
+	// Example handshake of RFC 6455 section 1.3
+	if got := wsAcceptKey("dGhlIHNhbXBsZSBub25jZQ=="); got != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Errorf("expected s3pPLMBiTxaQ9kYGzzhZRbK+xOo=, got %s", got)
+	}
+}
+
+func TestProbeLoss(t *testing.T) {
+	var l probeLoss
+	if l.percent() != 0 {
+		t.Errorf("expected no loss before the first reply, got %.1f%%", l.percent())
+	}
+
+	l.reply(&twamp.TwampResults{SenderSeqNum: 0})
+	l.reply(&twamp.TwampResults{SenderSeqNum: 1})
+	l.reply(&twamp.TwampResults{SenderSeqNum: 1, IsDuplicate: true}) // Duplicates are no replies
+	if l.replies != 2 || l.percent() != 0 {
+		t.Errorf("expected 2 replies without loss, got %d with %.1f%%", l.replies, l.percent())
+	}
+
+	l.reply(&twamp.TwampResults{SenderSeqNum: 4}) // 2 and 3 lost, or still on their way
+	if want := 40.0; math.Abs(l.percent()-want) > 1e-9 {
+		t.Errorf("expected %.1f%% loss, got %.1f%%", want, l.percent())
+	}
+
+	l.reply(&twamp.TwampResults{SenderSeqNum: 3}) // Overtaken by 4
+	if want := 20.0; math.Abs(l.percent()-want) > 1e-9 {
+		t.Errorf("expected %.1f%% loss, got %.1f%%", want, l.percent())
+	}
+}
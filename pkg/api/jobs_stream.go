@@ -0,0 +1,144 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// GET /jobs/{id}/stream sends a job's progress as Server-Sent Events: a start
+// event with the unit, a sample event per interval or probe as the test
+// produces it, and a done event with the finished job. Sample IDs are
+// <run>:<n>, so a client reconnecting with Last-Event-ID resumes after them.
+const JOB_STREAM_KEEPALIVE = 15 * time.Second
+
+// progressUpdate is what a stream has not sent yet of a JobProgress
+type progressUpdate struct {
+	run      int
+	unit     string
+	expected int
+	from     int // Index of the first of points
+	points   []SeriesPoint
+	finished bool
+}
+
+// since returns the points of run from index from on, or all points of the
+// current run if it is another, and a channel closed at the next change
+func (p *JobProgress) since(run, from int) (progressUpdate, <-chan struct{}) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.changed == nil {
+		p.changed = make(chan struct{})
+	}
+	if run != p.runs || from > len(p.points) {
+		from = 0
+	}
+	u := progressUpdate{run: p.runs, unit: p.unit, expected: p.expected, from: from, finished: p.finished}
+	u.points = append([]SeriesPoint(nil), p.points[from:]...)
+	return u, p.changed
+}
+
+// parseLastEventID reads the <run>:<n> ID of the last sample a client received
+func parseLastEventID(id string) (run, sent int) {
+	r, n, ok := strings.Cut(id, ":")
+	if !ok {
+		return 0, 0
+	}
+	run, err := strconv.Atoi(r)
+	if err != nil {
+		return 0, 0
+	}
+	if sent, err = strconv.Atoi(n); err != nil || sent < 0 {
+		return 0, 0
+	}
+	return run, sent
+}
+
+// writeEvent writes one Server-Sent Event with a JSON data field
+func writeEvent(w http.ResponseWriter, event, id string, data interface{}) error {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	if id != "" {
+		_, err = fmt.Fprintf(w, "event: %s\nid: %s\ndata: %s\n\n", event, id, raw)
+	} else {
+		_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, raw)
+	}
+	return err
+}
+
+func jobStream(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	job, ok := jobStore.lookup(id)
+	if !ok {
+		jsonResponse(w, ApiResponse{
+			Status: "error",
+			Error:  fmt.Sprintf("job %s not found", id),
+		}, http.StatusNotFound)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		jsonResponse(w, ApiResponse{
+			Status: "error",
+			Error:  "streaming not supported",
+		}, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // Keep reverse proxies from holding events back
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepalive := time.NewTicker(JOB_STREAM_KEEPALIVE)
+	defer keepalive.Stop()
+	run, sent := parseLastEventID(r.Header.Get("Last-Event-ID"))
+	for {
+		u, changed := job.progress.since(run, sent)
+		if u.run != run || (u.from == 0 && sent > 0) {
+			run, sent = u.run, 0
+			if u.unit != "" {
+				start := map[string]interface{}{"unit": u.unit}
+				if u.expected > 0 {
+					start["expected_samples"] = u.expected
+				}
+				if writeEvent(w, "start", "", start) != nil {
+					return
+				}
+			}
+		}
+		for _, point := range u.points {
+			sent++
+			if writeEvent(w, "sample", fmt.Sprintf("%d:%d", run, sent), point) != nil {
+				return
+			}
+		}
+		if u.finished {
+			if final, ok := jobStore.Get(id); ok {
+				_ = writeEvent(w, "done", "", final)
+			}
+			flusher.Flush()
+			return
+		}
+		flusher.Flush()
+
+		select {
+		case <-changed:
+		case <-keepalive.C:
+			if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
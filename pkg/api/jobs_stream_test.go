@@ -0,0 +1,61 @@
+package api
+
+import (
+	"testing"
+)
+
+// streamFrom is the index of the first sample since sends to a client that
+// last received sample from of run, on a job started runs times and holding
+// points samples of its current run
+func streamFrom(run, from, runs, points int) int {
+	p := &JobProgress{}
+	for i := 0; i < runs; i++ {
+		p.start("mbps", 10)
+	}
+	for i := 0; i < points; i++ {
+		p.add(SeriesPoint{T: float64(i + 1), Value: 94})
+	}
+	u, _ := p.since(run, from)
+	if len(u.points) != points-u.from {
+		return -1
+	}
+	return u.from
+}
+
+func TestParseLastEventID(t *testing.T) {
+	tests := []struct {
+		id        string
+		run, sent int
+	}{
+		{"1:14", 1, 14},
+		{"2:0", 2, 0},
+		{"", 0, 0},   // First connect
+		{"14", 0, 0}, // Not one of ours
+		{"a:b", 0, 0},
+		{"1:-3", 0, 0},
+	}
+	for _, tt := range tests {
+		if run, sent := parseLastEventID(tt.id); run != tt.run || sent != tt.sent {
+			t.Errorf("Last-Event-ID %q: expected %d:%d, got %d:%d", tt.id, tt.run, tt.sent, run, sent)
+		}
+	}
+}
+
+func TestStreamResumes(t *testing.T) {
+	tests := []struct {
+		name                    string
+		run, from, runs, points int
+		want                    int
+	}{
+		{"first connect", 0, 0, 1, 5, 0},
+		{"reconnect", 1, 3, 1, 5, 3},
+		{"caught up", 1, 5, 1, 5, 5},
+		{"test restarted", 1, 3, 2, 1, 0},
+		{"ID past the samples", 1, 9, 1, 5, 0},
+	}
+	for _, tt := range tests {
+		if got := streamFrom(tt.run, tt.from, tt.runs, tt.points); got != tt.want {
+			t.Errorf("%s: expected to send from sample %d, got %d", tt.name, tt.want, got)
+		}
+	}
+}
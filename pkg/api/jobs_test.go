@@ -0,0 +1,72 @@
+package api
+
+import (
+	"errors"
+	"testing"
+)
+
+// testJob adds a running job to s
+func testJob(s *JobStore, id string) *Job {
+	job := &Job{ID: id, State: JOB_STATE_RUNNING, progress: &JobProgress{}}
+	s.byID[id] = job
+	return job
+}
+
+func TestJobStoreKeepsRunningJobs(t *testing.T) {
+	s := NewJobStore(2)
+	testJob(s, "running")
+	for _, id := range []string{"a", "b", "c"} {
+		s.finish(testJob(s, id), map[string]interface{}{}, 200, nil)
+	}
+	if _, ok := s.byID["running"]; !ok {
+		t.Errorf("Expected a running job never to be evicted")
+	}
+	if _, ok := s.byID["a"]; ok {
+		t.Errorf("Expected the oldest finished job to be evicted")
+	}
+	if len(s.byID) != 3 {
+		t.Errorf("Expected 3 jobs, got %d", len(s.byID))
+	}
+}
+
+func TestJobPercentComplete(t *testing.T) {
+	tests := []struct {
+		samples, expected int
+		want              float64
+	}{
+		{0, 10, 0},
+		{5, 10, 50},
+		{11, 10, 100}, // iperf3 adds a short final interval
+		{3, 0, 0},
+	}
+	for _, tt := range tests {
+		p := &JobProgress{}
+		p.start("mbps", tt.expected)
+		for i := 0; i < tt.samples; i++ {
+			p.add(SeriesPoint{T: float64(i), Value: 1})
+		}
+		if got := p.report(false).PercentComplete; got != tt.want {
+			t.Errorf("Expected %.0f%% for %d of %d samples, got %.0f", tt.want, tt.samples, tt.expected, got)
+		}
+	}
+}
+
+func TestJobStateOfCanceledTest(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{nil, JOB_STATE_COMPLETED},
+		{errors.New("connection refused"), JOB_STATE_FAILED},
+		{&codedError{ERR_UNREACHABLE, errors.New("no route to host")}, JOB_STATE_FAILED},
+		{&codedError{ERR_CANCELED, errJobCanceled}, JOB_STATE_CANCELED},
+	}
+	for _, tt := range tests {
+		s := NewJobStore(10)
+		job := testJob(s, "job")
+		s.finish(job, map[string]interface{}{}, 200, tt.err)
+		if job.State != tt.want {
+			t.Errorf("Expected %s for %v, got %s", tt.want, tt.err, job.State)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// iperf3 and TWAMP tests take one of MAX_CONCURRENT_TESTS slots before their
+// locks, so bandwidth tests to different targets do not saturate the agent
+// and skew each other's results. Excess tests wait in FIFO order or are
+// refused with 429, as TEST_QUEUE_MODE says.
+const (
+	TEST_QUEUE_FIFO   = "fifo"
+	TEST_QUEUE_REJECT = "reject"
+
+	ERR_BUSY = "ERR_BUSY"
+)
+
+// TestSlot is a running or queued test, as GET /status lists it
+type TestSlot struct {
+	Test      string     `json:"test"`
+	JobID     string     `json:"job_id,omitempty"` // Asynchronous tests only
+	QueuedAt  time.Time  `json:"queued_at"`
+	StartedAt *time.Time `json:"started_at,omitempty"` // Running tests only
+	Position  int        `json:"position,omitempty"`   // 1 for the next queued test to start
+
+	ready chan struct{} // Closed when the slot is granted
+}
+
+// TestLimiter grants at most max slots at once, in request order (no limit when max is 0)
+type TestLimiter struct {
+	mu      sync.Mutex
+	max     int
+	mode    string
+	running []*TestSlot
+	queued  []*TestSlot
+}
+
+// NewTestLimiter creates a limiter of max slots whose excess tests queue or are refused
+func NewTestLimiter(max int, mode string) *TestLimiter {
+	return &TestLimiter{max: max, mode: mode}
+}
+
+var testLimiter = NewTestLimiter(0, TEST_QUEUE_FIFO)
+
+// configureTestLimiter reads MAX_CONCURRENT_TESTS and TEST_QUEUE_MODE, if set
+func configureTestLimiter() {
+	max := 0
+	if v := os.Getenv("MAX_CONCURRENT_TESTS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			log.Fatalf("Invalid MAX_CONCURRENT_TESTS %q (expected a non-negative integer)", v)
+		}
+		max = n
+	}
+	mode := strings.ToLower(os.Getenv("TEST_QUEUE_MODE"))
+	switch mode {
+	case "":
+		mode = TEST_QUEUE_FIFO
+	case TEST_QUEUE_FIFO, TEST_QUEUE_REJECT:
+	default:
+		log.Fatalf("Invalid TEST_QUEUE_MODE %q (expected fifo or reject)", mode)
+	}
+	testLimiter = NewTestLimiter(max, mode)
+	if max > 0 {
+		log.Printf("Running at most %d iperf3 and TWAMP tests at once (%s)", max, mode)
+	}
+}
+
+// start moves slot to running; the caller holds l.mu
+func (l *TestLimiter) start(slot *TestSlot, now time.Time) {
+	slot.StartedAt = &now
+	l.running = append(l.running, slot)
+	close(slot.ready)
+}
+
+// Acquire takes a slot for test, waiting behind the queued tests when all are
+// taken in fifo mode until one frees or ctx ends. Errors come with the HTTP
+// status to report them with; the returned func frees the slot.
+func (l *TestLimiter) Acquire(ctx context.Context, test, jobID string) (func(), int, error) {
+	l.mu.Lock()
+	now := time.Now().UTC()
+	slot := &TestSlot{Test: test, JobID: jobID, QueuedAt: now, ready: make(chan struct{})}
+	switch {
+	case l.max == 0 || (len(l.running) < l.max && len(l.queued) == 0):
+		l.start(slot, now)
+	case l.mode == TEST_QUEUE_REJECT:
+		l.mu.Unlock()
+		return nil, http.StatusTooManyRequests, &codedError{ERR_BUSY, fmt.Errorf("all %d test slots are in use (MAX_CONCURRENT_TESTS), try again later", l.max)}
+	default:
+		l.queued = append(l.queued, slot)
+	}
+	l.mu.Unlock()
+
+	select {
+	case <-slot.ready:
+		return func() { l.release(slot) }, http.StatusOK, nil
+	case <-ctx.Done():
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if slot.StartedAt != nil {
+		// Granted while ctx ended
+		l.releaseLocked(slot)
+	} else {
+		l.queued = removeSlot(l.queued, slot)
+	}
+	return nil, http.StatusConflict, canceledError(ctx)
+}
+
+func (l *TestLimiter) release(slot *TestSlot) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.releaseLocked(slot)
+}
+
+// releaseLocked frees slot and starts queued tests in its place
+func (l *TestLimiter) releaseLocked(slot *TestSlot) {
+	l.running = removeSlot(l.running, slot)
+	now := time.Now().UTC()
+	for len(l.queued) > 0 && len(l.running) < l.max {
+		next := l.queued[0]
+		l.queued = l.queued[1:]
+		l.start(next, now)
+	}
+}
+
+func removeSlot(slots []*TestSlot, slot *TestSlot) []*TestSlot {
+	for i, s := range slots {
+		if s == slot {
+			return append(slots[:i:i], slots[i+1:]...)
+		}
+	}
+	return slots
+}
+
+// LimiterStatus is the data of GET /status
+type LimiterStatus struct {
+	MaxConcurrent int         `json:"max_concurrent"` // 0 for no limit
+	QueueMode     string      `json:"queue_mode"`
+	Running       []*TestSlot `json:"running"`
+	Queued        []*TestSlot `json:"queued"`
+	Draining      bool        `json:"draining"` // Shutting down, starting no new tests
+}
+
+// Status snapshots the running tests, oldest first, and the queue in order
+func (l *TestLimiter) Status() *LimiterStatus {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	status := &LimiterStatus{
+		MaxConcurrent: l.max,
+		QueueMode:     l.mode,
+		Running:       make([]*TestSlot, 0, len(l.running)),
+		Queued:        make([]*TestSlot, 0, len(l.queued)),
+	}
+	for _, s := range l.running {
+		c := *s
+		status.Running = append(status.Running, &c)
+	}
+	for i, s := range l.queued {
+		c := *s
+		c.Position = i + 1
+		status.Queued = append(status.Queued, &c)
+	}
+	return status
+}
+
+// acquireTestSlot takes a slot of testLimiter for req's test
+func acquireTestSlot(testType string, req RunRequest) (func(), int, error) {
+	test := fmt.Sprintf("%s to %s", testType, net.JoinHostPort(req.ServerHost, strconv.Itoa(req.ServerPort)))
+	return testLimiter.Acquire(req.runContext(), test, req.jobID)
+}
+
+func limiterStatus(w http.ResponseWriter, r *http.Request) {
+	status := testLimiter.Status()
+	status.Draining = drainer.Draining()
+	jsonResponse(w, ApiResponse{
+		Status: "ok",
+		Data:   status,
+	}, http.StatusOK)
+}
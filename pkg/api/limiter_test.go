@@ -0,0 +1,105 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// waitQueued waits until n tests are queued
+func waitQueued(t *testing.T, l *TestLimiter, n int) {
+	t.Helper()
+	for i := 0; i < 100; i++ {
+		if len(l.Status().Queued) == n {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("expected %d queued tests", n)
+}
+
+func TestLimiterStartsQueuedTestsInOrder(t *testing.T) {
+	l := NewTestLimiter(1, TEST_QUEUE_FIFO)
+	release, _, err := l.Acquire(context.Background(), "first", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	started := make(chan string, 2)
+	for i, test := range []string{"second", "third"} {
+		go func(test string) {
+			release, _, err := l.Acquire(context.Background(), test, "")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			started <- test
+			release()
+		}(test)
+		waitQueued(t, l, i+1) // Queued one after the other
+	}
+
+	status := l.Status()
+	if status.Queued[0].Test != "second" || status.Queued[0].Position != 1 || status.Queued[1].Position != 2 {
+		t.Errorf("expected second at position 1 and third at 2, got %+v %+v", status.Queued[0], status.Queued[1])
+	}
+
+	release()
+	for _, want := range []string{"second", "third"} {
+		if got := <-started; got != want {
+			t.Errorf("expected %s to start next, got %s", want, got)
+		}
+	}
+}
+
+func TestLimiterRejectsWhenFull(t *testing.T) {
+	l := NewTestLimiter(2, TEST_QUEUE_REJECT)
+	for i := 0; i < 2; i++ {
+		if _, _, err := l.Acquire(context.Background(), "iperf3", ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, status, err := l.Acquire(context.Background(), "twamp", "")
+	if errorCode(err) != ERR_BUSY || status != http.StatusTooManyRequests {
+		t.Errorf("expected %s with 429, got %v with %d", ERR_BUSY, err, status)
+	}
+}
+
+func TestLimiterUnlimited(t *testing.T) {
+	l := NewTestLimiter(0, TEST_QUEUE_FIFO)
+	for i := 0; i < 10; i++ {
+		if _, _, err := l.Acquire(context.Background(), "iperf3", ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if running := len(l.Status().Running); running != 10 {
+		t.Errorf("expected 10 running tests, got %d", running)
+	}
+}
+
+func TestLimiterCanceledTestLeavesQueue(t *testing.T) {
+	l := NewTestLimiter(1, TEST_QUEUE_FIFO)
+	release, _, _ := l.Acquire(context.Background(), "first", "")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		_, _, err := l.Acquire(ctx, "canceled", "")
+		done <- err
+	}()
+	waitQueued(t, l, 1)
+	cancel()
+	if err := <-done; errorCode(err) != ERR_CANCELED {
+		t.Errorf("expected %s, got %v", ERR_CANCELED, err)
+	}
+	if queued := len(l.Status().Queued); queued != 0 {
+		t.Errorf("expected an empty queue, got %d", queued)
+	}
+
+	// The slot goes straight to the next test instead
+	release()
+	if _, _, err := l.Acquire(context.Background(), "next", ""); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,231 @@
+package api
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// The API listener: plain HTTP on LISTEN_ADDR by default, or HTTPS with a
+// certificate from TLS_CERT_FILE and TLS_KEY_FILE or obtained from an ACME CA
+// for TLS_AUTOCERT_DOMAINS, optionally requiring client certificates signed
+// by TLS_CLIENT_CA_FILE.
+const (
+	DEFAULT_LISTEN_ADDR = ":8080"
+
+	TLS_RELOAD_INTERVAL = 10 * time.Second // Between checks of TLS_CERT_FILE and TLS_KEY_FILE for a renewed certificate
+
+	TLS_CLIENT_AUTH_REQUIRE       = "require"               // Every connection presents a client certificate
+	TLS_CLIENT_AUTH_EXCEPT_PUBLIC = "require-except-public" // Only requests to publicPaths may come without one
+)
+
+// apiListener is where and how the API is served
+type apiListener struct {
+	addr       string
+	tls        *tls.Config // nil for plain HTTP
+	acme       *acmeManager
+	clientAuth string // TLS_CLIENT_AUTH with TLS_CLIENT_CA_FILE, empty without
+}
+
+// String is the listener's scheme and address, for the startup log
+func (l *apiListener) String() string {
+	if l.tls == nil {
+		return "http://" + l.addr
+	}
+	return "https://" + l.addr
+}
+
+// configureListener reads LISTEN_ADDR and the TLS settings
+func configureListener() *apiListener {
+	l := &apiListener{addr: os.Getenv("LISTEN_ADDR")}
+	if l.addr == "" {
+		l.addr = DEFAULT_LISTEN_ADDR
+	}
+	certFile, keyFile := os.Getenv("TLS_CERT_FILE"), os.Getenv("TLS_KEY_FILE")
+	domains := os.Getenv("TLS_AUTOCERT_DOMAINS")
+	caFile := os.Getenv("TLS_CLIENT_CA_FILE")
+	switch {
+	case (certFile == "") != (keyFile == ""):
+		log.Fatalf("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	case certFile != "" && domains != "":
+		log.Fatalf("TLS_CERT_FILE and TLS_AUTOCERT_DOMAINS cannot be set together")
+	case certFile == "" && domains == "":
+		if caFile != "" {
+			log.Fatalf("TLS_CLIENT_CA_FILE needs TLS_CERT_FILE or TLS_AUTOCERT_DOMAINS")
+		}
+		return l
+	}
+
+	l.tls = &tls.Config{MinVersion: tls.VersionTLS12}
+	switch v := os.Getenv("TLS_MIN_VERSION"); v {
+	case "", "1.2":
+	case "1.3":
+		l.tls.MinVersion = tls.VersionTLS13
+	default:
+		log.Fatalf("Invalid TLS_MIN_VERSION %q (expected 1.2 or 1.3)", v)
+	}
+
+	if certFile != "" {
+		reloader, err := newCertReloader(certFile, keyFile)
+		if err != nil {
+			log.Fatalf("Loading TLS certificate failed: %v", err)
+		}
+		l.tls.GetCertificate = reloader.GetCertificate
+	} else {
+		m, err := newACMEManager(domains)
+		if err != nil {
+			log.Fatalf("Configuring TLS_AUTOCERT_DOMAINS failed: %v", err)
+		}
+		l.acme = m
+		l.tls.GetCertificate = m.GetCertificate
+		l.tls.GetConfigForClient = m.GetConfigForClient(l.tls)
+	}
+
+	if caFile != "" {
+		pool, count, err := loadRootStore(caFile)
+		if err != nil {
+			log.Fatalf("Loading TLS_CLIENT_CA_FILE failed: %v", err)
+		}
+		l.tls.ClientCAs = pool
+		l.clientAuth = os.Getenv("TLS_CLIENT_AUTH")
+		switch l.clientAuth {
+		case "", TLS_CLIENT_AUTH_REQUIRE:
+			l.clientAuth = TLS_CLIENT_AUTH_REQUIRE
+			l.tls.ClientAuth = tls.RequireAndVerifyClientCert
+		case TLS_CLIENT_AUTH_EXCEPT_PUBLIC:
+			l.tls.ClientAuth = tls.VerifyClientCertIfGiven
+		default:
+			log.Fatalf("Invalid TLS_CLIENT_AUTH %q (expected %s or %s)", l.clientAuth, TLS_CLIENT_AUTH_REQUIRE, TLS_CLIENT_AUTH_EXCEPT_PUBLIC)
+		}
+		log.Printf("Client certificates of %d CAs in %s are required (%s)", count, caFile, l.clientAuth)
+	}
+	return l
+}
+
+// serve runs the API on the listener until it fails, or until SIGTERM or
+// SIGINT shut it down gracefully
+func (l *apiListener) serve(handler http.Handler) error {
+	if l.clientAuth != "" {
+		handler = clientCertAuth(handler)
+	}
+	srv := &http.Server{
+		Addr:        l.addr,
+		Handler:     handler,
+		TLSConfig:   l.tls,
+		BaseContext: func(net.Listener) context.Context { return drainer.Context() },
+	}
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	stopped := make(chan struct{})
+	go func() {
+		sig := <-signals
+		log.Printf("Received %s, shutting down", sig)
+		drainer.shutdown(srv, signals)
+		close(stopped)
+	}()
+
+	var err error
+	if l.tls == nil {
+		err = srv.ListenAndServe()
+	} else {
+		if l.acme != nil {
+			l.acme.start()
+		}
+		err = srv.ListenAndServeTLS("", "")
+	}
+	if !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	<-stopped
+	return nil
+}
+
+// clientCertAuth refuses requests without a verified client certificate,
+// which TLS_CLIENT_AUTH=require-except-public only asks for, other than to
+// publicPaths
+func clientCertAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if (r.TLS == nil || len(r.TLS.VerifiedChains) == 0) && !publicPaths[unversionedPath(r.URL.Path)] {
+			jsonResponse(w, ApiResponse{
+				Status: "error",
+				Error:  "a client certificate signed by TLS_CLIENT_CA_FILE is required",
+			}, http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// certReloader serves the certificate of TLS_CERT_FILE and TLS_KEY_FILE,
+// loading it again once either file changes, so that a renewed certificate
+// is picked up without a restart
+type certReloader struct {
+	certFile, keyFile string
+
+	mu       sync.Mutex
+	cert     *tls.Certificate
+	modTimes [2]time.Time // Of certFile and keyFile when cert was loaded
+	checked  time.Time
+}
+
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	c := &certReloader{certFile: certFile, keyFile: keyFile}
+	if err := c.load(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// load reads both files; it fails when they do not hold a matching pair
+func (c *certReloader) load() error {
+	modTimes, err := c.stat()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return err
+	}
+	c.cert, c.modTimes = &cert, modTimes
+	return nil
+}
+
+// stat returns the modification times of the certificate and key files
+func (c *certReloader) stat() ([2]time.Time, error) {
+	var times [2]time.Time
+	for i, file := range []string{c.certFile, c.keyFile} {
+		info, err := os.Stat(file)
+		if err != nil {
+			return times, err
+		}
+		times[i] = info.ModTime()
+	}
+	return times, nil
+}
+
+// GetCertificate is a tls.Config.GetCertificate checking the files for a new
+// certificate at most every TLS_RELOAD_INTERVAL. A failed reload, e.g. while
+// the files are being replaced, keeps the current certificate.
+func (c *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if now := time.Now(); now.Sub(c.checked) >= TLS_RELOAD_INTERVAL {
+		c.checked = now
+		if modTimes, err := c.stat(); err == nil && modTimes != c.modTimes {
+			if err := c.load(); err != nil {
+				log.Printf("Reloading TLS certificate failed, keeping the current one: %v", err)
+			} else {
+				log.Printf("Reloaded TLS certificate from %s", c.certFile)
+			}
+		}
+	}
+	return c.cert, nil
+}
@@ -0,0 +1,218 @@
+package api
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Structured logging: every log line goes through log/slog, as text or JSON
+// (LOG_FORMAT) from LOG_LEVEL up. Each request gets an ID, the client's
+// X-Request-Id or a generated one, returned in that header and in JSON
+// responses as request_id; each test run gets one too, its job's ID when it
+// runs as a job. The lines a test logs carry both, so the logs of concurrent
+// tests can be told apart.
+const (
+	REQUEST_ID_HEADER = "X-Request-Id"
+	MAX_REQUEST_ID    = 128 // Longer client IDs are replaced by a generated one
+
+	LOG_FORMAT_TEXT = "text"
+	LOG_FORMAT_JSON = "json"
+)
+
+// LoggingConfig is the output of the logger, from LOG_* environment variables
+type LoggingConfig struct {
+	Level  slog.Level
+	Format string // text or json
+}
+
+var logLevels = map[string]slog.Level{
+	"debug": slog.LevelDebug,
+	"info":  slog.LevelInfo,
+	"warn":  slog.LevelWarn,
+	"error": slog.LevelError,
+}
+
+// loadLoggingConfig reads LOG_LEVEL (debug, info, warn or error, default info)
+// and LOG_FORMAT (text or json, default text)
+func loadLoggingConfig(getenv func(string) string) (LoggingConfig, error) {
+	cfg := LoggingConfig{Level: slog.LevelInfo, Format: LOG_FORMAT_TEXT}
+	if s := getenv("LOG_LEVEL"); s != "" {
+		level, ok := logLevels[strings.ToLower(s)]
+		if !ok {
+			return cfg, fmt.Errorf("invalid LOG_LEVEL %q (expected debug, info, warn or error)", s)
+		}
+		cfg.Level = level
+	}
+	switch s := strings.ToLower(getenv("LOG_FORMAT")); s {
+	case "":
+	case LOG_FORMAT_TEXT, LOG_FORMAT_JSON:
+		cfg.Format = s
+	default:
+		return cfg, fmt.Errorf("invalid LOG_FORMAT %q (expected %s or %s)", getenv("LOG_FORMAT"), LOG_FORMAT_TEXT, LOG_FORMAT_JSON)
+	}
+	return cfg, nil
+}
+
+// configureLogging applies LOG_* settings at startup; the log package's
+// output goes through the same handler from then on
+func configureLogging() {
+	cfg, err := loadLoggingConfig(os.Getenv)
+	if err != nil {
+		// No logger is configured yet to fail through
+		fmt.Fprintf(os.Stderr, "Logging configuration failed: %v\n", err)
+		os.Exit(1)
+	}
+	opts := &slog.HandlerOptions{Level: cfg.Level}
+	var h slog.Handler = slog.NewTextHandler(os.Stderr, opts)
+	if cfg.Format == LOG_FORMAT_JSON {
+		h = slog.NewJSONHandler(os.Stderr, opts)
+	}
+	slog.SetDefault(slog.New(contextHandler{h}))
+}
+
+// logIDs are the IDs a context's log lines carry
+type logIDs struct {
+	requestID string
+	testID    string
+}
+
+type logIDsKey struct{}
+
+func logIDsFrom(ctx context.Context) logIDs {
+	if ctx == nil {
+		return logIDs{}
+	}
+	ids, _ := ctx.Value(logIDsKey{}).(logIDs)
+	return ids
+}
+
+// withRequestID gives ctx the ID of a request
+func withRequestID(ctx context.Context, id string) context.Context {
+	ids := logIDsFrom(ctx)
+	ids.requestID = id
+	return context.WithValue(ctx, logIDsKey{}, ids)
+}
+
+// withTestID gives ctx the ID of a test run, keeping its request's
+func withTestID(ctx context.Context, id string) context.Context {
+	ids := logIDsFrom(ctx)
+	ids.testID = id
+	return context.WithValue(ctx, logIDsKey{}, ids)
+}
+
+// linkRequest gives ctx the request ID of from, so the lines of a job carry
+// the ID of the request that started it
+func linkRequest(ctx, from context.Context) context.Context {
+	if id := logIDsFrom(from).requestID; id != "" {
+		return withRequestID(ctx, id)
+	}
+	return ctx
+}
+
+// contextHandler adds the request and test IDs of a line's context, and its
+// trace when traced, to the line
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	ids := logIDsFrom(ctx)
+	if ids.requestID != "" {
+		r.AddAttrs(slog.String("request_id", ids.requestID))
+	}
+	if ids.testID != "" {
+		r.AddAttrs(slog.String("test_id", ids.testID))
+	}
+	if span := spanFromContext(ctx); span != nil {
+		r.AddAttrs(slog.String("trace_id", hex.EncodeToString(span.traceID[:])))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
+
+// logf logs a line of the request or test of ctx, which may be nil
+func logf(ctx context.Context, format string, args ...interface{}) {
+	logAt(ctx, slog.LevelInfo, format, args...)
+}
+
+// warnf logs a warning of the request or test of ctx
+func warnf(ctx context.Context, format string, args ...interface{}) {
+	logAt(ctx, slog.LevelWarn, format, args...)
+}
+
+// errorf logs an error of the request or test of ctx
+func errorf(ctx context.Context, format string, args ...interface{}) {
+	logAt(ctx, slog.LevelError, format, args...)
+}
+
+// debugf logs a detail of the request or test of ctx, left out below LOG_LEVEL=debug
+func debugf(ctx context.Context, format string, args ...interface{}) {
+	logAt(ctx, slog.LevelDebug, format, args...)
+}
+
+func logAt(ctx context.Context, level slog.Level, format string, args ...interface{}) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	logger := slog.Default()
+	if !logger.Enabled(ctx, level) {
+		return
+	}
+	logger.Log(ctx, level, fmt.Sprintf(format, args...))
+}
+
+// validRequestID accepts the IDs clients commonly send, UUIDs and the like:
+// letters, digits and . _ : - of at most MAX_REQUEST_ID
+func validRequestID(id string) bool {
+	if id == "" || len(id) > MAX_REQUEST_ID {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '.', c == '_', c == ':', c == '-':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// requestIDs gives every request an ID, returned in X-Request-Id, and logs
+// each request at debug level
+func requestIDs(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(REQUEST_ID_HEADER)
+		if !validRequestID(id) {
+			id = newResultID()
+		}
+		w.Header().Set(REQUEST_ID_HEADER, id)
+		ctx := withRequestID(r.Context(), id)
+
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r.WithContext(ctx))
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		slog.DebugContext(ctx, "Request",
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", rec.status),
+			slog.Float64("duration_ms", float64(time.Since(start).Microseconds())/1000),
+		)
+	})
+}
@@ -0,0 +1,43 @@
+package api
+
+import (
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestValidRequestID(t *testing.T) {
+	for _, id := range []string{"7c1e0c5a9b2f4d3e", "3f2504e0-4f89-11d3-9a0c-0305e82c3301", "lb.eu-west:1_42"} {
+		if !validRequestID(id) {
+			t.Errorf("Expected request ID %q to be kept", id)
+		}
+	}
+	for _, id := range []string{"", "two words", "id\nWith-Newline", `"quoted"`, strings.Repeat("a", 129)} {
+		if validRequestID(id) {
+			t.Errorf("Expected request ID %q to be replaced", id)
+		}
+	}
+}
+
+func TestLoadLoggingConfig(t *testing.T) {
+	cases := map[string]slog.Level{"": slog.LevelInfo, "debug": slog.LevelDebug, "WARN": slog.LevelWarn, "error": slog.LevelError}
+	for s, want := range cases {
+		cfg, err := loadLoggingConfig(testEnv(map[string]string{"LOG_LEVEL": s}))
+		if err != nil || cfg.Level != want {
+			t.Errorf("Expected LOG_LEVEL %q to be %v, got %v (%v)", s, want, cfg.Level, err)
+		}
+	}
+	for _, bad := range []string{"trace", "warning", "0"} {
+		if _, err := loadLoggingConfig(testEnv(map[string]string{"LOG_LEVEL": bad})); err == nil {
+			t.Errorf("Expected error for LOG_LEVEL %q", bad)
+		}
+	}
+
+	cfg, err := loadLoggingConfig(testEnv(map[string]string{"LOG_FORMAT": "JSON"}))
+	if err != nil || cfg.Format != LOG_FORMAT_JSON {
+		t.Errorf("Expected LOG_FORMAT json, got %q (%v)", cfg.Format, err)
+	}
+	if _, err := loadLoggingConfig(testEnv(map[string]string{"LOG_FORMAT": "logfmt"})); err == nil {
+		t.Error("Expected error for LOG_FORMAT logfmt")
+	}
+}
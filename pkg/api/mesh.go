@@ -0,0 +1,326 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Mesh runs: one test template against each of a list of targets, a few at a
+// time, answered with a matrix of the key metrics of every target. Each test is
+// an ordinary test of its type, stored and delivered on its own.
+const (
+	TEST_TYPE_MESH = "mesh" // Job type of an asynchronous mesh run; not a test type
+
+	MESH_STATUS_OK    = "ok"
+	MESH_STATUS_ERROR = "error"
+
+	MAX_MESH_TARGETS      = 100
+	DEFAULT_MESH_PARALLEL = 4
+	MAX_MESH_PARALLEL     = 16
+)
+
+// MeshRequest is the body of POST /mesh/run
+type MeshRequest struct {
+	Type     string          `json:"type"`     // Test type of every test
+	Targets  []string        `json:"targets"`  // server_host of each test, or its url or endpoint
+	Request  json.RawMessage `json:"request"`  // Template of every test, without the target
+	Parallel int             `json:"parallel"` // Tests at a time (default: 4)
+}
+
+// MeshResult is the row of one target in the matrix
+type MeshResult struct {
+	Target      string             `json:"target"`
+	Status      string             `json:"status"`              // ok or error
+	ResultID    string             `json:"result_id,omitempty"` // Stored result of the test, in GET /results/{id}
+	Metrics     map[string]float64 `json:"metrics,omitempty"`   // The metrics of the test type that the result has
+	Error       string             `json:"error,omitempty"`
+	Code        string             `json:"code,omitempty"`
+	HTTPStatus  int                `json:"http_status,omitempty"` // The test alone would have been answered with
+	DurationSec float64            `json:"duration_sec"`
+}
+
+// meshTest is the prepared test of one target
+type meshTest struct {
+	target  string
+	req     RunRequest
+	profile *Profile
+}
+
+// meshPlan is a validated mesh run. It is a TestRunner so that ?async=true
+// runs it as a job, but it is not registered as a test type.
+type meshPlan struct {
+	runner   TestRunner
+	parallel int
+	tests    []meshTest
+}
+
+// meshTargetField is the request field a mesh target fills in for a test type
+func meshTargetField(testType string) string {
+	switch testType {
+	case TEST_TYPE_TRANSFER, TEST_TYPE_HTTP, TEST_TYPE_RPM:
+		return "url"
+	case TEST_TYPE_S3:
+		return "endpoint"
+	}
+	return "server_host"
+}
+
+// meshTestBody is the request body of the test of one target: the template
+// with the target's field filled in
+func meshTestBody(template map[string]json.RawMessage, field, target string) []byte {
+	fields := make(map[string]json.RawMessage, len(template)+1)
+	for k, v := range template {
+		fields[k] = v
+	}
+	fields[field], _ = json.Marshal(target)
+	body, _ := json.Marshal(fields) // Every value is valid JSON already
+	return body
+}
+
+// newMeshPlan decodes and validates the test of every target with the
+// client's API key, so that nothing runs unless every test would be accepted
+func newMeshPlan(mr MeshRequest, key *APIKey) (*meshPlan, error) {
+	testType := strings.ToLower(mr.Type)
+	runner, ok := lookupRunner(testType)
+	switch {
+	case !ok:
+		return nil, invalidTestType(mr.Type)
+	case testType == TEST_TYPE_TCP_CONNECT:
+		return nil, fmt.Errorf("tcp_connect tests take a list of targets of their own; run one with all of them")
+	case len(mr.Targets) == 0:
+		return nil, fmt.Errorf("targets is required")
+	case len(mr.Targets) > MAX_MESH_TARGETS:
+		return nil, fmt.Errorf("targets must list at most %d targets", MAX_MESH_TARGETS)
+	}
+	plan := &meshPlan{runner: runner, parallel: mr.Parallel}
+	if plan.parallel == 0 {
+		plan.parallel = DEFAULT_MESH_PARALLEL
+	}
+	if plan.parallel < 1 || plan.parallel > MAX_MESH_PARALLEL {
+		return nil, fmt.Errorf("parallel must be between 1 and %d", MAX_MESH_PARALLEL)
+	}
+
+	var template map[string]json.RawMessage
+	if len(mr.Request) > 0 {
+		if err := json.Unmarshal(mr.Request, &template); err != nil {
+			return nil, fmt.Errorf("request must be a JSON object")
+		}
+	}
+	field := meshTargetField(testType)
+	if _, ok := template[field]; ok {
+		return nil, fmt.Errorf("request must not set %s; targets fills it in", field)
+	}
+	var fields []FieldError
+	seen := make(map[string]bool) // Template errors, reported once for all targets
+	for i, target := range mr.Targets {
+		targetField := fmt.Sprintf("targets[%d]", i)
+		if target == "" {
+			fields = append(fields, FieldError{Field: targetField, Message: "is required"})
+			continue
+		}
+		body := meshTestBody(template, field, target)
+		req, err := decodeRequestBody(body)
+		var ve *ValidationError
+		if errors.As(err, &ve) {
+			for _, f := range ve.Fields {
+				if f.Field = "request." + f.Field; !seen[f.Field] {
+					seen[f.Field] = true
+					fields = append(fields, f)
+				}
+			}
+			continue
+		}
+		req, profile, err := withProfileDefaults(req, body)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", targetField, err)
+		}
+		req.apiKey = key
+		if err := key.checkLimits(req); err != nil {
+			return nil, fmt.Errorf("%s: %v", targetField, err)
+		}
+		if err := validateRunRequest(runner, req); errors.As(err, &ve) {
+			for _, f := range ve.Fields {
+				if f.Field == field {
+					f.Field = targetField
+				} else if f.Field = "request." + f.Field; seen[f.Field] {
+					continue
+				}
+				seen[f.Field] = true
+				fields = append(fields, f)
+			}
+		}
+		plan.tests = append(plan.tests, meshTest{target: target, req: req, profile: profile})
+	}
+	if len(fields) > 0 {
+		return nil, &codedError{ERR_VALIDATION, &ValidationError{Fields: fields}}
+	}
+	return plan, nil
+}
+
+func (p *meshPlan) Name() string {
+	return TEST_TYPE_MESH
+}
+
+func (p *meshPlan) Validate(v *requestValidator, req RunRequest) {}
+
+// label names the targets of the run in job listings and logs
+func (p *meshPlan) label() string {
+	if len(p.tests) == 1 {
+		return p.tests[0].target
+	}
+	return fmt.Sprintf("%s and %d more", p.tests[0].target, len(p.tests)-1)
+}
+
+// Run runs the test of every target, parallel at a time. A test that fails
+// is a row of the matrix, not an error of the run; only a canceled run fails.
+func (p *meshPlan) Run(ctx context.Context, req RunRequest, _ *Profile) (map[string]interface{}, int, error) {
+	testType := p.runner.Name()
+	logf(ctx, "Mesh run: %s tests of %d targets (parallel=%d)", testType, len(p.tests), p.parallel)
+
+	started := time.Now()
+	req.progress.start("duration_sec", len(p.tests))
+	results := make([]*MeshResult, len(p.tests))
+	slots := make(chan struct{}, p.parallel)
+	var wg sync.WaitGroup
+	for i, t := range p.tests {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+			results[i] = p.runTest(ctx, t)
+			req.progress.add(SeriesPoint{T: time.Since(started).Seconds(), Value: results[i].DurationSec})
+		}()
+	}
+	wg.Wait()
+	if ctx.Err() != nil {
+		return nil, http.StatusInternalServerError, canceledError(ctx)
+	}
+
+	succeeded := 0
+	columns := map[string]bool{}
+	for _, r := range results {
+		if r.Status == MESH_STATUS_OK {
+			succeeded++
+		}
+		for path := range r.Metrics {
+			columns[path] = true
+		}
+	}
+	data := map[string]interface{}{
+		"type":         testType,
+		"targets":      len(results),
+		"succeeded":    succeeded,
+		"failed":       len(results) - succeeded,
+		"parallel":     p.parallel,
+		"metrics":      meshColumns(testType, columns),
+		"results":      results,
+		"duration_sec": time.Since(started).Seconds(),
+	}
+	return data, http.StatusOK, nil
+}
+
+// runTest runs the test of one target, counted against the client's quota
+// like a test of its own
+func (p *meshPlan) runTest(ctx context.Context, t meshTest) *MeshResult {
+	r := &MeshResult{Target: t.target}
+	started := time.Now()
+	var data map[string]interface{}
+	status := http.StatusTooManyRequests
+	err := t.req.apiKey.takeTest(started)
+	if err == nil {
+		data, status, err = p.runner.Run(ctx, t.req, t.profile)
+	}
+	r.DurationSec = time.Since(started).Seconds()
+	if err != nil {
+		r.Status, r.Error, r.Code, r.HTTPStatus = MESH_STATUS_ERROR, err.Error(), errorCode(err), status
+		return r
+	}
+	r.Status = MESH_STATUS_OK
+	r.ResultID, _ = data["id"].(string)
+	if stored, ok := resultStore.Get(r.ResultID); ok {
+		r.Metrics = summarizeResult(stored).Metrics
+	}
+	return r
+}
+
+// meshColumns orders the metrics found in the rows the way the test type
+// lists them, for the columns of the matrix
+func meshColumns(testType string, found map[string]bool) []string {
+	columns := []string{}
+	for _, m := range resultMetrics[testType] {
+		if found[m.Path] {
+			columns = append(columns, m.Path)
+			delete(found, m.Path)
+		}
+	}
+	rest := make([]string, 0, len(found))
+	for path := range found {
+		rest = append(rest, path)
+	}
+	sort.Strings(rest)
+	return append(columns, rest...)
+}
+
+func meshRun(w http.ResponseWriter, r *http.Request) {
+	var mr MeshRequest
+	if err := json.NewDecoder(r.Body).Decode(&mr); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	output, err := resultOutput(r)
+	if err != nil {
+		jsonResponse(w, ApiResponse{
+			Status: "error",
+			Error:  err.Error(),
+		}, http.StatusBadRequest)
+		return
+	}
+	async := false
+	if v := r.URL.Query().Get("async"); v != "" {
+		if async, err = strconv.ParseBool(v); err != nil {
+			jsonResponse(w, ApiResponse{
+				Status: "error",
+				Error:  fmt.Sprintf("invalid async %q (expected true or false)", v),
+			}, http.StatusBadRequest)
+			return
+		}
+	}
+	plan, err := newMeshPlan(mr, apiKeyFrom(r))
+	if err != nil {
+		writeRunResponse(w, output, TEST_TYPE_MESH, "", nil, http.StatusBadRequest, err)
+		return
+	}
+	end, err := drainer.begin()
+	if err != nil {
+		writeRunResponse(w, output, plan.Name(), plan.label(), nil, http.StatusServiceUnavailable, err)
+		return
+	}
+	if !async {
+		defer end()
+		data, status, err := plan.Run(r.Context(), RunRequest{}, nil)
+		writeRunResponse(w, output, plan.Name(), plan.label(), data, status, err)
+		return
+	}
+
+	job := jobStore.Start(plan, RunRequest{ServerHost: plan.label()}, nil, end)
+	w.Header().Set("Location", versionedPath(r, "/jobs/"+job.ID))
+	jsonResponse(w, ApiResponse{
+		Status: "ok",
+		Data:   job,
+	}, http.StatusAccepted)
+}
@@ -0,0 +1,53 @@
+package api
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestMeshTargetField(t *testing.T) {
+	tests := map[string]string{
+		"ping":             "server_host",
+		"iperf3":           "server_host",
+		TEST_TYPE_TRANSFER: "url",
+		TEST_TYPE_HTTP:     "url",
+		TEST_TYPE_RPM:      "url",
+		TEST_TYPE_S3:       "endpoint",
+	}
+	for testType, expected := range tests {
+		if got := meshTargetField(testType); got != expected {
+			t.Errorf("%s: expected %s, got %s", testType, expected, got)
+		}
+	}
+}
+
+func TestMeshTestBody(t *testing.T) {
+	var template map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(`{"count": 20, "dscp": 46, "address_family": "ipv6"}`), &template); err != nil {
+		t.Fatal(err)
+	}
+	var req struct {
+		ServerHost    string `json:"server_host"`
+		Count         int    `json:"count"`
+		DSCP          int    `json:"dscp"`
+		AddressFamily string `json:"address_family"`
+	}
+	if err := json.Unmarshal(meshTestBody(template, "server_host", "edge1.example.net"), &req); err != nil {
+		t.Fatal(err)
+	}
+	if req.ServerHost != "edge1.example.net" || req.Count != 20 || req.DSCP != 46 || req.AddressFamily != "ipv6" {
+		t.Errorf("Expected the template aimed at edge1.example.net, got %+v", req)
+	}
+
+	// The template is shared by every target and must stay untouched
+	_ = meshTestBody(template, "server_host", "edge2.example.net")
+	if _, ok := template["server_host"]; ok {
+		t.Error("Expected the template not to be modified")
+	}
+
+	// A target that needs escaping stays one JSON string
+	var body map[string]string
+	if err := json.Unmarshal(meshTestBody(nil, "url", `https://example.net/a"b`), &body); err != nil || body["url"] != `https://example.net/a"b` {
+		t.Errorf("Expected the escaped url, got %v (%v)", body, err)
+	}
+}
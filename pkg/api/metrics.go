@@ -0,0 +1,300 @@
+package api
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Exposition formats served by /metrics
+const (
+	OPENMETRICS_CONTENT_TYPE = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+	PROMETHEUS_CONTENT_TYPE  = "text/plain; version=0.0.4; charset=utf-8"
+
+	METRICS_PREFIX = "network_test_"
+)
+
+// exportedMetric is a stored result field observed into a histogram per server
+type exportedMetric struct {
+	Name    string
+	Help    string
+	Type    string // Test type the field belongs to
+	Path    string // Dotted path into the result data
+	Buckets []float64
+
+	NeedsReplies bool // Skip tests that lost every probe, whose delay fields are all zero
+}
+
+var exportedMetrics = []exportedMetric{
+	{"iperf3_bandwidth_mbps", "iperf3 throughput per test in Mbit/s", TEST_TYPE_IPERF3, "bandwidth_mbps",
+		[]float64{1, 10, 50, 100, 250, 500, 1000, 2500, 10000}, false},
+	{"iperf3_loss_percent", "iperf3 UDP loss per test in percent", TEST_TYPE_IPERF3, "loss_percent",
+		[]float64{0, 0.1, 0.5, 1, 2, 5, 10, 25}, false},
+	{"twamp_rtt_avg_milliseconds", "TWAMP average network RTT per test in milliseconds", TEST_TYPE_TWAMP, "rtt_avg_ms",
+		[]float64{1, 2, 5, 10, 20, 50, 100, 200, 500, 1000}, true},
+	{"twamp_rtt_max_milliseconds", "TWAMP maximum network RTT per test in milliseconds", TEST_TYPE_TWAMP, "rtt_max_ms",
+		[]float64{1, 2, 5, 10, 20, 50, 100, 200, 500, 1000}, true},
+	{"twamp_rtt_p99_milliseconds", "TWAMP 99th percentile network RTT per test in milliseconds", TEST_TYPE_TWAMP, "percentiles_ms.rtt.p99",
+		[]float64{1, 2, 5, 10, 20, 50, 100, 200, 500, 1000}, true},
+	{"twamp_loss_percent", "TWAMP loss per test in percent", TEST_TYPE_TWAMP, "loss_percent",
+		[]float64{0, 0.1, 0.5, 1, 2, 5, 10, 25}, false},
+	{"twamp_reordered_percent", "TWAMP reordered replies per test in percent", TEST_TYPE_TWAMP, "reordered_percent",
+		[]float64{0, 0.1, 0.5, 1, 2, 5, 10, 25}, false},
+	{"transfer_goodput_mbps", "File transfer goodput per test in Mbit/s", TEST_TYPE_TRANSFER, "goodput_mbps",
+		[]float64{1, 10, 50, 100, 250, 500, 1000, 2500, 10000}, false},
+	{"s3_upload_mbps", "S3 multipart upload throughput per test in Mbit/s", TEST_TYPE_S3, "upload.throughput_mbps",
+		[]float64{1, 10, 50, 100, 250, 500, 1000, 2500, 10000}, false},
+	{"s3_download_mbps", "S3 ranged download throughput per test in Mbit/s", TEST_TYPE_S3, "download.throughput_mbps",
+		[]float64{1, 10, 50, 100, 250, 500, 1000, 2500, 10000}, false},
+	{"ssh_goodput_mbps", "SSH file transfer goodput per test in Mbit/s", TEST_TYPE_SSH, "goodput_mbps",
+		[]float64{1, 10, 50, 100, 250, 500, 1000, 2500, 10000}, false},
+	{"ssh_setup_milliseconds", "SSH connection setup (dial, key exchange, authentication) per test in milliseconds", TEST_TYPE_SSH, "timings.setup_ms",
+		[]float64{10, 25, 50, 100, 250, 500, 1000, 2500, 5000}, false},
+	{"pmtu_largest_passing_bytes", "Largest DF-set packet through the path per test in bytes", TEST_TYPE_PMTU, "largest_passing",
+		[]float64{576, 1200, 1280, 1360, 1400, 1420, 1450, 1480, 1492, 1500, 9000}, false},
+	{"owamp_delay_avg_milliseconds", "OWAMP average one-way delay per test in milliseconds", TEST_TYPE_OWAMP, "delay_avg_ms",
+		[]float64{1, 2, 5, 10, 20, 50, 100, 200, 500, 1000}, true},
+	{"owamp_loss_percent", "OWAMP one-way loss per test in percent", TEST_TYPE_OWAMP, "loss_percent",
+		[]float64{0, 0.1, 0.5, 1, 2, 5, 10, 25}, false},
+	{"tls_handshake_milliseconds", "TLS handshake, ClientHello to Finished, per test in milliseconds", TEST_TYPE_TLS, "timings.handshake_ms",
+		[]float64{10, 25, 50, 100, 250, 500, 1000, 2500, 5000}, false},
+	{"tls_certificate_days_to_expiry", "Days until the first certificate of the chain expires per TLS test", TEST_TYPE_TLS, "tls.days_to_expiry",
+		[]float64{0, 7, 14, 30, 60, 90, 180, 365}, false},
+	{"ndt7_download_mbps", "NDT7 download throughput per test in Mbit/s", TEST_TYPE_NDT7, "download.throughput_mbps",
+		[]float64{1, 10, 25, 50, 100, 250, 500, 1000, 2500}, false},
+	{"ndt7_upload_mbps", "NDT7 upload throughput per test in Mbit/s", TEST_TYPE_NDT7, "upload.throughput_mbps",
+		[]float64{1, 10, 25, 50, 100, 250, 500, 1000, 2500}, false},
+	{"bufferbloat_latency_increase_milliseconds", "Largest median RTT increase under load per bufferbloat test in milliseconds", TEST_TYPE_BUFFERBLOAT, "latency_increase_ms",
+		[]float64{1, 5, 10, 30, 60, 100, 200, 400, 1000}, false},
+	{"rpm_score", "Responsiveness under working conditions per RPM test in round trips per minute", TEST_TYPE_RPM, "rpm",
+		[]float64{100, 200, 400, 800, 1000, 1500, 2000, 3000, 6000}, false},
+	{"tcp_connect_reachable_percent", "Targets that accepted the connect per TCP connect test in percent", TEST_TYPE_TCP_CONNECT, "reachable_percent",
+		[]float64{0, 10, 25, 50, 75, 90, 99, 100}, false},
+}
+
+// exemplar links an observation to the stored result it came from
+type exemplar struct {
+	TestID string
+	Value  float64
+	Time   time.Time
+}
+
+// histogram keeps per-bucket (non-cumulative) counts and the latest exemplar of each bucket
+type histogram struct {
+	buckets   []float64
+	counts    []uint64    // len(buckets)+1, the last is +Inf
+	exemplars []*exemplar // Same layout as counts
+	sum       float64
+	count     uint64
+	created   time.Time
+}
+
+func newHistogram(buckets []float64, now time.Time) *histogram {
+	return &histogram{
+		buckets:   buckets,
+		counts:    make([]uint64, len(buckets)+1),
+		exemplars: make([]*exemplar, len(buckets)+1),
+		created:   now,
+	}
+}
+
+// observe adds a value to the first bucket whose upper bound holds it
+func (h *histogram) observe(value float64, ex *exemplar) {
+	i := sort.SearchFloat64s(h.buckets, value)
+	h.counts[i]++
+	h.exemplars[i] = ex
+	h.sum += value
+	h.count++
+}
+
+// runCounter counts stored results per test type and server
+type runCounter struct {
+	value    uint64
+	exemplar *exemplar
+	created  time.Time
+}
+
+// MetricsRegistry accumulates exported metrics as results are recorded
+type MetricsRegistry struct {
+	mu         sync.Mutex
+	histograms map[string]map[string]*histogram // Metric name -> server -> histogram
+	runs       map[[2]string]*runCounter        // {type, server}
+}
+
+// NewMetricsRegistry creates an empty registry
+func NewMetricsRegistry() *MetricsRegistry {
+	return &MetricsRegistry{
+		histograms: make(map[string]map[string]*histogram),
+		runs:       make(map[[2]string]*runCounter),
+	}
+}
+
+var metricsRegistry = NewMetricsRegistry()
+
+// Observe records the exported fields of a stored result, with its ID as exemplar
+func (m *MetricsRegistry) Observe(r *StoredResult) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	loss, _ := metricValue(r.Data, "loss_percent")
+	key := [2]string{r.Type, r.Target}
+	c := m.runs[key]
+	if c == nil {
+		c = &runCounter{created: r.CreatedAt}
+		m.runs[key] = c
+	}
+	c.value++
+	c.exemplar = &exemplar{TestID: r.ID, Value: 1, Time: r.CreatedAt}
+
+	for _, em := range exportedMetrics {
+		if em.Type != r.Type || (em.NeedsReplies && loss >= 100) {
+			continue
+		}
+		v, ok := metricValue(r.Data, em.Path)
+		if !ok {
+			continue
+		}
+		byServer := m.histograms[em.Name]
+		if byServer == nil {
+			byServer = make(map[string]*histogram)
+			m.histograms[em.Name] = byServer
+		}
+		h := byServer[r.Target]
+		if h == nil {
+			h = newHistogram(em.Buckets, r.CreatedAt)
+			byServer[r.Target] = h
+		}
+		h.observe(v, &exemplar{TestID: r.ID, Value: v, Time: r.CreatedAt})
+	}
+}
+
+// escapeLabelValue escapes a label value for the text exposition formats
+func escapeLabelValue(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func formatTimestamp(t time.Time) string {
+	return strconv.FormatFloat(float64(t.UnixNano())/1e9, 'f', 3, 64)
+}
+
+// formatExemplar renders an OpenMetrics exemplar suffix for a sample line
+func formatExemplar(ex *exemplar) string {
+	if ex == nil {
+		return ""
+	}
+	return fmt.Sprintf(` # {test_id="%s"} %s %s`, escapeLabelValue(ex.TestID), formatFloat(ex.Value), formatTimestamp(ex.Time))
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Write renders all metrics; openMetrics adds exemplars, _created samples and # EOF
+func (m *MetricsRegistry) Write(w io.Writer, openMetrics bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ex := func(e *exemplar) string {
+		if openMetrics {
+			return formatExemplar(e)
+		}
+		return ""
+	}
+
+	runs := METRICS_PREFIX + "runs"
+	if openMetrics {
+		fmt.Fprintf(w, "# TYPE %s counter\n# HELP %s Stored test results.\n", runs, runs)
+	} else {
+		fmt.Fprintf(w, "# HELP %s_total Stored test results.\n# TYPE %s_total counter\n", runs, runs)
+	}
+	keys := make([][2]string, 0, len(m.runs))
+	for k := range m.runs {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i][0] != keys[j][0] {
+			return keys[i][0] < keys[j][0]
+		}
+		return keys[i][1] < keys[j][1]
+	})
+	for _, k := range keys {
+		c := m.runs[k]
+		labels := fmt.Sprintf(`type="%s",server="%s"`, escapeLabelValue(k[0]), escapeLabelValue(k[1]))
+		fmt.Fprintf(w, "%s_total{%s} %d%s\n", runs, labels, c.value, ex(c.exemplar))
+		if openMetrics {
+			fmt.Fprintf(w, "%s_created{%s} %s\n", runs, labels, formatTimestamp(c.created))
+		}
+	}
+
+	for _, em := range exportedMetrics {
+		byServer := m.histograms[em.Name]
+		if len(byServer) == 0 {
+			continue
+		}
+		name := METRICS_PREFIX + em.Name
+		if openMetrics {
+			fmt.Fprintf(w, "# TYPE %s histogram\n# HELP %s %s.\n", name, name, em.Help)
+		} else {
+			fmt.Fprintf(w, "# HELP %s %s.\n# TYPE %s histogram\n", name, em.Help, name)
+		}
+		for _, server := range sortedKeys(byServer) {
+			h := byServer[server]
+			labels := fmt.Sprintf(`server="%s"`, escapeLabelValue(server))
+			var cumulative uint64
+			for i := range h.counts {
+				le := math.Inf(1)
+				if i < len(h.buckets) {
+					le = h.buckets[i]
+				}
+				cumulative += h.counts[i]
+				fmt.Fprintf(w, "%s_bucket{%s,le=\"%s\"} %d%s\n", name, labels, formatFloat(le), cumulative, ex(h.exemplars[i]))
+			}
+			fmt.Fprintf(w, "%s_count{%s} %d\n", name, labels, h.count)
+			fmt.Fprintf(w, "%s_sum{%s} %s\n", name, labels, formatFloat(h.sum))
+			if openMetrics {
+				fmt.Fprintf(w, "%s_created{%s} %s\n", name, labels, formatTimestamp(h.created))
+			}
+		}
+	}
+
+	if openMetrics {
+		fmt.Fprint(w, "# EOF\n")
+	}
+}
+
+// wantsOpenMetrics reports whether the scraper accepts the OpenMetrics format
+func wantsOpenMetrics(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "application/openmetrics-text")
+}
+
+func metricsHandler(w http.ResponseWriter, r *http.Request) {
+	openMetrics := wantsOpenMetrics(r)
+	if openMetrics {
+		w.Header().Set("Content-Type", OPENMETRICS_CONTENT_TYPE)
+	} else {
+		w.Header().Set("Content-Type", PROMETHEUS_CONTENT_TYPE)
+	}
+	w.WriteHeader(http.StatusOK)
+	metricsRegistry.Write(w, openMetrics)
+}
@@ -0,0 +1,44 @@
+package api
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHistogramBucket(t *testing.T) {
+	buckets := []float64{1, 2, 5, 10}
+
+	tests := []struct {
+		value float64
+		want  int
+	}{
+		{0.5, 0},
+		{1, 0}, // Upper bounds are inclusive (le)
+		{1.01, 1},
+		{10, 3},
+		{11, 4}, // +Inf
+	}
+
+	for _, tt := range tests {
+		h := newHistogram(buckets, time.Time{})
+		h.observe(tt.value, nil)
+		if got := h.counts[tt.want]; got != 1 {
+			t.Errorf("%v: expected bucket %d, got counts %v", tt.value, tt.want, h.counts)
+		}
+	}
+}
+
+func TestFormatExemplar(t *testing.T) {
+	ts := time.Unix(1768473000, 412000000)
+
+	got := formatExemplar(&exemplar{TestID: "1d9cb97159106d3d", Value: 48.2, Time: ts})
+	want := ` # {test_id="1d9cb97159106d3d"} 48.2 1768473000.412`
+	if got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+
+	if got := formatExemplar(&exemplar{TestID: `a"b`, Value: 1, Time: ts}); !strings.Contains(got, `test_id="a\"b"`) {
+		t.Errorf("Expected escaped quote in %q", got)
+	}
+}
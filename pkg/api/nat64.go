@@ -0,0 +1,284 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"network-test-api/pkg/nettest"
+)
+
+// NAT64/DNS64 detection (RFC 7050) and reachability of IPv4-only targets through it
+const (
+	DEFAULT_NAT64_PORT    = 443 // Any TCP listener on the target works
+	NAT64_CONNECT_TIMEOUT = 5 * time.Second
+
+	NAT64_PREFIX_SOURCE_DNS64   = "dns64"      // Learned from the AAAA records of ipv4only.arpa
+	NAT64_PREFIX_SOURCE_ASSUMED = "well_known" // No DNS64, 64:ff9b::/96 tried on an IPv6 route
+
+	NAT64_PATH_IPV6  = "ipv6"  // Native AAAA record
+	NAT64_PATH_NAT64 = "nat64" // AAAA record synthesized by DNS64
+	NAT64_PATH_IPV4  = "ipv4"
+	NAT64_PATH_NONE  = "none"
+)
+
+// 464XLAT CLAT source addresses (RFC 7335)
+var clatIPv4Range = &net.IPNet{IP: net.IPv4(192, 0, 0, 0), Mask: net.CIDRMask(29, 32)}
+
+// NAT64Prefix is a translation prefix the agent's resolver synthesizes addresses with
+type NAT64Prefix struct {
+	Prefix    string `json:"prefix"`
+	WellKnown bool   `json:"well_known"` // 64:ff9b::/96
+	Source    string `json:"source"`     // dns64 or well_known
+}
+
+// NAT64Report is the outcome of a NAT64/DNS64 test
+type NAT64Report struct {
+	IPv4Route         bool                `json:"ipv4_route"`
+	IPv6Route         bool                `json:"ipv6_route"`
+	IPv6Only          bool                `json:"ipv6_only"` // No IPv4 route other than a CLAT
+	CLAT              bool                `json:"clat"`      // IPv4 source in 192.0.0.0/29: 464XLAT translates it
+	DNS64             bool                `json:"dns64"`
+	DNS64LookupMs     float64             `json:"dns64_lookup_ms"`
+	Prefixes          []NAT64Prefix       `json:"prefixes,omitempty"`
+	TargetIPv4        []string            `json:"target_ipv4,omitempty"`
+	TargetIPv6        []string            `json:"target_ipv6,omitempty"`        // Native AAAA records
+	TargetSynthesized []string            `json:"target_synthesized,omitempty"` // AAAA records DNS64 made up
+	IPv4Only          bool                `json:"ipv4_only"`
+	NAT64Address      string              `json:"nat64_address,omitempty"`
+	NAT64Reachable    bool                `json:"nat64_reachable"`
+	NAT64ConnectMs    float64             `json:"nat64_connect_ms,omitempty"`
+	NAT64Error        string              `json:"nat64_error,omitempty"`
+	IPv4ConnectMs     float64             `json:"ipv4_connect_ms,omitempty"` // Direct IPv4, for the translation overhead
+	IPv4Error         string              `json:"ipv4_error,omitempty"`
+	Path              string              `json:"path"` // How other tests reach the target
+	Dial              *nettest.DialReport `json:"dial,omitempty"`
+}
+
+// localRoute reports whether the kernel has a route for the family, and the source
+// address it would use; connecting a UDP socket sends nothing
+func localRoute(network, address string) (net.IP, bool) {
+	conn, err := net.Dial(network, address)
+	if err != nil {
+		return nil, false
+	}
+	defer func() { _ = conn.Close() }()
+	return conn.LocalAddr().(*net.UDPAddr).IP, true
+}
+
+// nat64Path names how a dial reached the target
+func nat64Path(dial *nettest.DialReport) string {
+	switch {
+	case dial == nil || dial.Family == "":
+		return NAT64_PATH_NONE
+	case dial.NAT64:
+		return NAT64_PATH_NAT64
+	case dial.Family == nettest.FAMILY_IPV6:
+		return NAT64_PATH_IPV6
+	}
+	return NAT64_PATH_IPV4
+}
+
+// validateNAT64 checks a NAT64 test request
+func validateNAT64(req RunRequest) error {
+	switch {
+	case req.ServerHost == "":
+		return fmt.Errorf("server_host is required")
+	case req.ServerPort < 1 || req.ServerPort > 65535:
+		return fmt.Errorf("invalid server_port %d", req.ServerPort)
+	case req.AddressFamily != "" && req.AddressFamily != nettest.FAMILY_AUTO:
+		return fmt.Errorf("address_family is not available for NAT64 tests; they check both families")
+	}
+	return nil
+}
+
+// runNAT64 applies defaults to a decoded request, runs the NAT64/DNS64 test and records the result.
+// Errors come with the HTTP status to report them with.
+func runNAT64(req RunRequest, profile *Profile) (map[string]interface{}, int, error) {
+	if req.ServerPort == 0 {
+		req.ServerPort = DEFAULT_NAT64_PORT
+	}
+	if err := checkProfileLimits(req, profile); err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	err := validateNAT64(req)
+	if err == nil {
+		err = validateLockWait(&req)
+	}
+	if err == nil {
+		err = validateCallbackURL(req.CallbackURL)
+	}
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	lock, release, status, err := lockTest(TEST_TYPE_NAT64, req, false)
+	if err != nil {
+		return nil, status, err
+	}
+	defer release()
+
+	logf(req.ctx, "NAT64 test: %s:%d", req.ServerHost, req.ServerPort)
+
+	started := time.Now()
+	report, err := nat64Test(req)
+	if err != nil {
+		return nil, http.StatusInternalServerError, fmt.Errorf("NAT64 test failed: %v", err)
+	}
+
+	data := map[string]interface{}{
+		"server":          req.ServerHost,
+		"port":            req.ServerPort,
+		"ipv4_route":      report.IPv4Route,
+		"ipv6_route":      report.IPv6Route,
+		"ipv6_only":       report.IPv6Only,
+		"clat":            report.CLAT,
+		"dns64":           report.DNS64,
+		"dns64_lookup_ms": report.DNS64LookupMs,
+		"ipv4_only":       report.IPv4Only,
+		"nat64_reachable": report.NAT64Reachable,
+		"path":            report.Path,
+		"duration_sec":    time.Since(started).Seconds(),
+	}
+	if len(report.Prefixes) > 0 {
+		data["prefixes"] = report.Prefixes
+	}
+	if len(report.TargetIPv4) > 0 {
+		data["target_ipv4"] = report.TargetIPv4
+	}
+	if len(report.TargetIPv6) > 0 {
+		data["target_ipv6"] = report.TargetIPv6
+	}
+	if len(report.TargetSynthesized) > 0 {
+		data["target_synthesized"] = report.TargetSynthesized
+	}
+	if report.NAT64Address != "" {
+		data["nat64_address"] = report.NAT64Address
+	}
+	if report.NAT64ConnectMs > 0 {
+		data["nat64_connect_ms"] = report.NAT64ConnectMs
+	}
+	if report.NAT64Error != "" {
+		data["nat64_error"] = report.NAT64Error
+	}
+	if report.IPv4ConnectMs > 0 {
+		data["ipv4_connect_ms"] = report.IPv4ConnectMs
+	}
+	if report.IPv4Error != "" {
+		data["ipv4_error"] = report.IPv4Error
+	}
+	if report.Dial != nil {
+		data["dial"] = report.Dial
+	}
+	if profile != nil {
+		data["profile"] = profile.Name
+	}
+	data["lock"] = lock
+
+	recordResult(TEST_TYPE_NAT64, req, started, data)
+	notifyCallback(req.CallbackURL, data)
+
+	return data, http.StatusOK, nil
+}
+
+// nat64Test detects DNS64, connects to the target's IPv4 address through the NAT64
+// prefix and directly, and dials it the way other tests do to report the path taken
+func nat64Test(req RunRequest) (*NAT64Report, error) {
+	report := &NAT64Report{Path: NAT64_PATH_NONE}
+	// Documentation addresses: any default route covers them
+	var v4src net.IP
+	v4src, report.IPv4Route = localRoute("udp4", "192.0.2.1:9")
+	_, report.IPv6Route = localRoute("udp6", "[2001:db8::1]:9")
+	report.CLAT = report.IPv4Route && clatIPv4Range.Contains(v4src)
+	report.IPv6Only = report.IPv6Route && (!report.IPv4Route || report.CLAT)
+
+	ctx, cancel := context.WithTimeout(context.Background(), nettest.NAT64_LOOKUP_TIMEOUT)
+	defer cancel()
+	prefixes, elapsed, err := nettest.DetectNAT64Prefixes(ctx)
+	if err != nil {
+		warnf(req.ctx, "NAT64 test: %s lookup failed: %v", nettest.NAT64_DETECT_NAME, err)
+	}
+	report.DNS64LookupMs = float64(elapsed.Microseconds()) / 1000
+	report.DNS64 = len(prefixes) > 0
+	nettest.SetNAT64Prefixes(prefixes)
+	source := NAT64_PREFIX_SOURCE_DNS64
+	if len(prefixes) == 0 && report.IPv6Route {
+		prefixes = []*net.IPNet{nettest.NAT64WellKnownPrefix}
+		source = NAT64_PREFIX_SOURCE_ASSUMED
+	}
+	for _, p := range prefixes {
+		report.Prefixes = append(report.Prefixes, NAT64Prefix{Prefix: p.String(),
+			WellKnown: p.String() == nettest.NAT64WellKnownPrefix.String(), Source: source})
+	}
+
+	// The target's records, AAAA ones split into native and synthesized
+	var v4, v6 []net.IP
+	if ip := net.ParseIP(req.ServerHost); ip == nil {
+		v4, _ = net.DefaultResolver.LookupIP(ctx, "ip4", req.ServerHost)
+		v6, _ = net.DefaultResolver.LookupIP(ctx, "ip6", req.ServerHost)
+		if len(v4) == 0 && len(v6) == 0 {
+			return nil, fmt.Errorf("no addresses for %s", req.ServerHost)
+		}
+	} else if ip.To4() != nil {
+		v4 = []net.IP{ip}
+	} else {
+		v6 = []net.IP{ip}
+	}
+	for _, ip := range v6 {
+		if nettest.NAT64Embedded(ip) != nil {
+			report.TargetSynthesized = append(report.TargetSynthesized, ip.String())
+		} else {
+			report.TargetIPv6 = append(report.TargetIPv6, ip.String())
+		}
+	}
+	for _, ip := range v4 {
+		report.TargetIPv4 = append(report.TargetIPv4, ip.String())
+	}
+	report.IPv4Only = len(report.TargetIPv6) == 0
+
+	port := fmt.Sprintf("%d", req.ServerPort)
+	if len(v4) > 0 && len(prefixes) > 0 && report.IPv6Route {
+		// Synthesized locally, as RFC 7050 has clients do for IPv4 literals
+		address := net.JoinHostPort(nettest.NAT64Synthesize(prefixes[0], v4[0]).String(), port)
+		report.NAT64Address = address
+		report.NAT64ConnectMs, err = nat64Connect(req.ServerHost, address)
+		if err == nil {
+			report.NAT64Reachable = true
+		} else {
+			report.NAT64Error = err.Error()
+		}
+	}
+	if len(v4) > 0 && report.IPv4Route {
+		report.IPv4ConnectMs, err = nat64Connect(req.ServerHost, net.JoinHostPort(v4[0].String(), port))
+		if err != nil {
+			report.IPv4Error = err.Error()
+		}
+	}
+
+	conn, dial, err := nettest.DialControl(req.ServerHost, req.ServerPort, nettest.FAMILY_AUTO, NAT64_CONNECT_TIMEOUT)
+	if err == nil {
+		_ = conn.Close()
+	}
+	report.Dial = dial
+	report.Path = nat64Path(dial)
+	if report.Path == NAT64_PATH_NAT64 && report.NAT64Address == "" {
+		report.NAT64Address = dial.Address
+		report.NAT64Reachable = true
+		report.NAT64ConnectMs = dial.ConnectMs
+	}
+	return report, nil
+}
+
+// nat64Connect opens and closes a TCP connection to an address of host, returning the connect time
+func nat64Connect(host, address string) (float64, error) {
+	var bind *nettest.SourceBinding
+	start := time.Now()
+	conn, err := bind.Dialer("tcp", NAT64_CONNECT_TIMEOUT).DialContext(nettest.WithDialedName(context.Background(), host), "tcp", address)
+	if err != nil {
+		return 0, err
+	}
+	_ = conn.Close()
+	return float64(time.Since(start).Microseconds()) / 1000, nil
+}
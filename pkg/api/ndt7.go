@@ -0,0 +1,459 @@
+package api
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"network-test-api/pkg/nettest"
+)
+
+// NDT7 speed tests (the M-Lab ndt7 protocol): a download and an upload of
+// about 10 seconds each over a WebSocket to an ndt-server, the nearest of the
+// M-Lab pool unless server_host names one. The server sends its TCP_INFO of
+// the connection as it goes, which min_rtt_ms and the retransmissions come from.
+const (
+	NDT7_SUBPROTOCOL    = "net.measurementlab.ndt.v7"
+	NDT7_DOWNLOAD_PATH  = "/ndt/v7/download"
+	NDT7_UPLOAD_PATH    = "/ndt/v7/upload"
+	NDT7_PROTOCOL_WSS   = "wss"
+	NDT7_PROTOCOL_WS    = "ws"
+	NDT7_DIRECTION_BOTH = "both"
+
+	DEFAULT_NDT7_LOCATE_URL = "https://locate.measurementlab.net/v2/nearest/ndt/ndt7"
+
+	NDT7_UPLOAD_DURATION = 10 * time.Second // The server ends the download after as long
+	NDT7_TIMEOUT         = 15 * time.Second // Per direction, from the connect
+	NDT7_DIAL_TIMEOUT    = 10 * time.Second
+	NDT7_LOCATE_TIMEOUT  = 10 * time.Second
+	NDT7_CLOSE_WAIT      = 3 * time.Second // For the server's close frame after the upload
+	NDT7_MIN_MESSAGE     = 1 << 13         // First upload message size
+	NDT7_MAX_MESSAGE     = 1 << 20         // Upload messages double up to this size
+	NDT7_MESSAGE_SCALE   = 16              // Double once this many messages' worth was sent
+	NDT7_MAX_READ        = 1 << 24         // Largest message the protocol allows
+)
+
+// ndt7LocateURL is the M-Lab Locate API endpoint asked for the nearest server,
+// and ndt7LocateClient the client that asks it
+var (
+	ndt7LocateURL    = DEFAULT_NDT7_LOCATE_URL
+	ndt7LocateClient = checkedHTTPClient(0) // Bounded by NDT7_LOCATE_TIMEOUT
+)
+
+// configureNDT7 reads NDT7_LOCATE_URL, if set
+func configureNDT7() {
+	v := os.Getenv("NDT7_LOCATE_URL")
+	if v == "" {
+		return
+	}
+	if u, err := url.Parse(v); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		log.Fatalf("Invalid NDT7_LOCATE_URL %q (expected an http or https URL)", v)
+	}
+	ndt7LocateURL = v
+	log.Printf("NDT7 servers are located with %s", ndt7LocateURL)
+}
+
+// NDT7Server is the server the Locate API chose
+type NDT7Server struct {
+	Machine string `json:"machine"`
+	City    string `json:"city,omitempty"`
+	Country string `json:"country,omitempty"`
+}
+
+// NDT7Result is one direction of an NDT7 test
+type NDT7Result struct {
+	ThroughputMbps    float64 `json:"throughput_mbps"`      // Of the bytes the receiving end counted
+	Bytes             int64   `json:"bytes"`                // Received by the agent (download) or the server (upload)
+	SentBytes         int64   `json:"sent_bytes,omitempty"` // Upload only: message bytes the agent wrote
+	DurationSec       float64 `json:"duration_sec"`
+	MinRTTMs          float64 `json:"min_rtt_ms,omitempty"`         // Lowest RTT of the connection, from the server's TCP_INFO
+	RTTMs             float64 `json:"rtt_ms,omitempty"`             // Smoothed RTT at the last measurement
+	RTTVarMs          float64 `json:"rtt_var_ms,omitempty"`         // Its variation
+	RetransmitPercent float64 `json:"retransmit_percent,omitempty"` // Download only: bytes the server retransmitted of those it sent
+	Measurements      int     `json:"measurements"`                 // Measurement messages the server sent
+	ClientAddress     string  `json:"client_address,omitempty"`     // The agent's address as the server saw it
+	UUID              string  `json:"uuid,omitempty"`               // Of the connection, as the server records it
+}
+
+// ndt7Measurement is a measurement message of the server
+type ndt7Measurement struct {
+	ConnectionInfo *struct {
+		Client string
+		Server string
+		UUID   string
+	}
+	TCPInfo *struct {
+		BytesAcked    int64
+		BytesReceived int64
+		BytesSent     int64
+		BytesRetrans  int64
+		ElapsedTime   int64 // Microseconds since the connection was accepted
+		MinRTT        int64 // Microseconds, as are RTT and RTTVar
+		RTT           int64
+		RTTVar        int64
+	}
+}
+
+// observe takes in a measurement message; the last TCP_INFO wins
+func (r *NDT7Result) observe(raw []byte) {
+	var m ndt7Measurement
+	if err := json.Unmarshal(raw, &m); err != nil {
+		return // Messages of later protocol versions may differ
+	}
+	r.Measurements++
+	if c := m.ConnectionInfo; c != nil {
+		r.ClientAddress, r.UUID = c.Client, c.UUID
+	}
+	if t := m.TCPInfo; t != nil {
+		r.MinRTTMs = float64(t.MinRTT) / 1000
+		r.RTTMs = float64(t.RTT) / 1000
+		r.RTTVarMs = float64(t.RTTVar) / 1000
+		if t.BytesSent > 0 {
+			r.RetransmitPercent = float64(t.BytesRetrans) / float64(t.BytesSent) * 100
+		}
+		if t.BytesReceived > 0 && t.ElapsedTime > 0 {
+			r.Bytes = t.BytesReceived
+			r.DurationSec = float64(t.ElapsedTime) / 1e6
+		}
+	}
+}
+
+// ndt7Throughput is the Mbit/s of bytes in seconds
+func ndt7Throughput(bytes int64, seconds float64) float64 {
+	if seconds <= 0 {
+		return 0
+	}
+	return float64(bytes) * 8 / seconds / 1e6
+}
+
+// ndt7DefaultPort is the port of URLs of protocol without one
+func ndt7DefaultPort(protocol string) int {
+	if protocol == NDT7_PROTOCOL_WS {
+		return 80
+	}
+	return 443
+}
+
+// ndt7Directions lists the directions a request runs, download first
+func ndt7Directions(direction string) []string {
+	switch direction {
+	case TRANSFER_DOWNLOAD:
+		return []string{TRANSFER_DOWNLOAD}
+	case TRANSFER_UPLOAD:
+		return []string{TRANSFER_UPLOAD}
+	}
+	return []string{TRANSFER_DOWNLOAD, TRANSFER_UPLOAD}
+}
+
+// validateNDT7 checks the direction and protocol of an NDT7 request
+func validateNDT7(req *RunRequest) error {
+	switch req.Direction = strings.ToLower(req.Direction); req.Direction {
+	case "":
+		req.Direction = NDT7_DIRECTION_BOTH
+	case TRANSFER_DOWNLOAD, TRANSFER_UPLOAD, NDT7_DIRECTION_BOTH:
+	default:
+		return fmt.Errorf("invalid direction %q (expected download, upload or both)", req.Direction)
+	}
+	switch req.Protocol = strings.ToLower(req.Protocol); req.Protocol {
+	case "":
+		req.Protocol = NDT7_PROTOCOL_WSS
+	case NDT7_PROTOCOL_WSS, NDT7_PROTOCOL_WS:
+	default:
+		return fmt.Errorf("invalid protocol %q (expected wss or ws)", req.Protocol)
+	}
+	switch {
+	case req.ServerHost == "" && req.ServerPort != 0:
+		return fmt.Errorf("server_port needs server_host; located servers come with their URLs")
+	case req.Protocol == NDT7_PROTOCOL_WS && (req.RootStore != "" || req.TLSSkipVerify):
+		return fmt.Errorf("root_store and tls_skip_verify are only used with protocol wss")
+	}
+	return validateRootStore(req)
+}
+
+// runNDT7 applies defaults to a decoded request, runs the NDT7 test and records the result.
+// Errors come with the HTTP status to report them with.
+func runNDT7(req RunRequest, profile *Profile) (map[string]interface{}, int, error) {
+	if err := checkProfileLimits(req, profile); err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	err := validateNDT7(&req)
+	if err == nil {
+		req.AddressFamily, err = parseAddressFamily(req.AddressFamily)
+	}
+	if err == nil && req.AddressFamily == nettest.FAMILY_COMPARE {
+		err = fmt.Errorf("address_family compare is not available for NDT7 tests; run ipv4 and ipv6 separately")
+	}
+	if err == nil {
+		err = validateLockWait(&req)
+	}
+	if err == nil {
+		err = validateCallbackURL(req.CallbackURL)
+	}
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	ctx := req.runContext()
+	started := time.Now()
+	urls := map[string]*url.URL{}
+	var located *NDT7Server
+	if req.ServerHost == "" {
+		located, urls, err = ndt7Locate(ctx, req.Protocol)
+		if err != nil {
+			return nil, http.StatusInternalServerError, twampError(ctx, "Locating an NDT7 server failed", err)
+		}
+		u := urls[TRANSFER_DOWNLOAD]
+		req.ServerHost = u.Hostname()
+		// Held to the same target checks as a server_host given
+		v := &requestValidator{}
+		v.host("server_host", req.ServerHost, req.ServerHost)
+		if len(v.fields) > 0 {
+			return nil, http.StatusForbidden, fmt.Errorf("located server %s %s", req.ServerHost, v.fields[0].Message)
+		}
+	} else {
+		if req.ServerPort == 0 {
+			req.ServerPort = ndt7DefaultPort(req.Protocol)
+		}
+		host := net.JoinHostPort(req.ServerHost, strconv.Itoa(req.ServerPort))
+		urls[TRANSFER_DOWNLOAD] = &url.URL{Scheme: req.Protocol, Host: host, Path: NDT7_DOWNLOAD_PATH}
+		urls[TRANSFER_UPLOAD] = &url.URL{Scheme: req.Protocol, Host: host, Path: NDT7_UPLOAD_PATH}
+	}
+	if req.ServerPort == 0 {
+		req.ServerPort, _ = strconv.Atoi(urls[TRANSFER_DOWNLOAD].Port())
+		if req.ServerPort == 0 {
+			req.ServerPort = ndt7DefaultPort(req.Protocol)
+		}
+	}
+
+	lock, release, status, err := lockTest(TEST_TYPE_NDT7, req, true)
+	if err != nil {
+		return nil, status, err
+	}
+	defer release()
+
+	logf(req.ctx, "NDT7 test: %s://%s:%d (direction=%s, family=%s)",
+		req.Protocol, req.ServerHost, req.ServerPort, req.Direction, req.AddressFamily)
+
+	checker := newTLSChecker(req)
+	data := map[string]interface{}{
+		"server":    req.ServerHost,
+		"port":      req.ServerPort,
+		"protocol":  req.Protocol,
+		"direction": req.Direction,
+	}
+	for _, direction := range ndt7Directions(req.Direction) {
+		result, dial, err := ndt7Test(ctx, req, checker, urls[direction], direction)
+		if err != nil {
+			return nil, http.StatusInternalServerError, twampError(ctx, fmt.Sprintf("NDT7 %s failed", direction), err)
+		}
+		data[direction] = result
+		if _, ok := data["dial"]; !ok {
+			data["dial"] = dial
+		}
+	}
+	data["duration_sec"] = time.Since(started).Seconds()
+	if located != nil {
+		data["located"] = located
+	}
+	if report := checker.Report(); report != nil {
+		data["tls"] = report
+	}
+	if profile != nil {
+		data["profile"] = profile.Name
+	}
+	data["lock"] = lock
+
+	recordResult(TEST_TYPE_NDT7, req, started, data)
+	notifyCallback(req.CallbackURL, data)
+
+	return data, http.StatusOK, nil
+}
+
+// ndt7Locate asks the Locate API for the nearest server and returns it with
+// its download and upload URLs, which carry access tokens
+func ndt7Locate(ctx context.Context, protocol string) (*NDT7Server, map[string]*url.URL, error) {
+	ctx, cancel := context.WithTimeout(ctx, NDT7_LOCATE_TIMEOUT)
+	defer cancel()
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, ndt7LocateURL, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	httpReq.Header.Set("User-Agent", "network-test-api/"+API_VERSION)
+	resp, err := ndt7LocateClient.Do(httpReq)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("locate API answered %s", resp.Status)
+	}
+	var located struct {
+		Results []struct {
+			Machine  string `json:"machine"`
+			Location struct {
+				City    string `json:"city"`
+				Country string `json:"country"`
+			} `json:"location"`
+			URLs map[string]string `json:"urls"`
+		} `json:"results"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&located); err != nil {
+		return nil, nil, fmt.Errorf("invalid locate API response: %v", err)
+	}
+	for _, r := range located.Results {
+		urls := map[string]*url.URL{}
+		for direction, path := range map[string]string{TRANSFER_DOWNLOAD: NDT7_DOWNLOAD_PATH, TRANSFER_UPLOAD: NDT7_UPLOAD_PATH} {
+			if u, err := url.Parse(r.URLs[protocol+"://"+path]); err == nil && u.Host != "" {
+				urls[direction] = u
+			}
+		}
+		if len(urls) == 2 {
+			return &NDT7Server{Machine: r.Machine, City: r.Location.City, Country: r.Location.Country}, urls, nil
+		}
+	}
+	return nil, nil, fmt.Errorf("locate API returned no server with %s URLs", protocol)
+}
+
+// ndt7Test runs one direction over a new connection to u
+func ndt7Test(ctx context.Context, req RunRequest, checker *tlsChecker, u *url.URL, direction string) (*NDT7Result, *nettest.DialReport, error) {
+	port, _ := strconv.Atoi(u.Port())
+	if port == 0 {
+		port = ndt7DefaultPort(u.Scheme)
+	}
+	conn, dial, err := nettest.DialControlFrom(ctx, u.Hostname(), port, req.AddressFamily, NDT7_DIAL_TIMEOUT, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("connect failed: %v", err)
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(NDT7_TIMEOUT))
+	stop := context.AfterFunc(ctx, func() { _ = conn.Close() })
+	defer stop()
+
+	if u.Scheme == NDT7_PROTOCOL_WSS {
+		tlsConn := tls.Client(conn, checker.config(u.Hostname()))
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			return nil, dial, fmt.Errorf("TLS handshake failed: %v", err)
+		}
+		conn = tlsConn
+	}
+	ws, err := wsHandshake(conn, u, NDT7_SUBPROTOCOL)
+	if err != nil {
+		return nil, dial, fmt.Errorf("WebSocket handshake failed: %v", err)
+	}
+	if direction == TRANSFER_UPLOAD {
+		result, err := ndt7Upload(ws)
+		return result, dial, err
+	}
+	result, err := ndt7Download(ws)
+	return result, dial, err
+}
+
+// ndt7Download counts the server's messages until it closes the connection
+func ndt7Download(ws *wsClient) (*NDT7Result, error) {
+	result := &NDT7Result{}
+	var received int64
+	start := time.Now()
+	for {
+		op, n, text, err := ws.readMessage(NDT7_MAX_READ)
+		if errors.Is(err, errWSClosed) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		received += n
+		if op == WS_OP_TEXT {
+			result.observe(text)
+		}
+	}
+	// The agent's own count: TCP_INFO of the sending side has no BytesReceived
+	result.Bytes = received
+	result.DurationSec = time.Since(start).Seconds()
+	result.ThroughputMbps = ndt7Throughput(result.Bytes, result.DurationSec)
+	return result, nil
+}
+
+// ndt7NextSize doubles the upload message size once the bytes sent reach
+// NDT7_MESSAGE_SCALE messages of it, as the reference client does
+func ndt7NextSize(size int, sent int64) int {
+	if size < NDT7_MAX_MESSAGE && sent >= int64(size)*NDT7_MESSAGE_SCALE {
+		return size * 2
+	}
+	return size
+}
+
+// ndt7Upload sends binary messages of growing size for NDT7_UPLOAD_DURATION
+// while reading the server's measurements, then closes the connection
+func ndt7Upload(ws *wsClient) (*NDT7Result, error) {
+	result := &NDT7Result{}
+	var mu sync.Mutex
+	readDone := make(chan error, 1)
+	go func() {
+		for {
+			op, _, text, err := ws.readMessage(NDT7_MAX_READ)
+			if err != nil {
+				readDone <- err
+				return
+			}
+			if op == WS_OP_TEXT {
+				mu.Lock()
+				result.observe(text)
+				mu.Unlock()
+			}
+		}
+	}()
+
+	payload := nettest.NewPayloadGenerator(nettest.PayloadRandom).StreamBuffer(NDT7_MAX_MESSAGE)
+	defer nettest.ReleaseBuffer(payload)
+	size, sent := NDT7_MIN_MESSAGE, int64(0)
+	start := time.Now()
+	closed := false
+	for !closed && time.Since(start) < NDT7_UPLOAD_DURATION {
+		select {
+		case err := <-readDone:
+			if !errors.Is(err, errWSClosed) {
+				return nil, err
+			}
+			closed = true // The server ends uploads after 10 seconds too
+			continue
+		default:
+		}
+		if err := ws.writeMessage(WS_OP_BINARY, payload[:size]); err != nil {
+			return nil, err
+		}
+		sent += int64(size)
+		size = ndt7NextSize(size, sent)
+	}
+	elapsed := time.Since(start)
+	if !closed {
+		if err := ws.close(); err != nil {
+			return nil, err
+		}
+		select {
+		case <-readDone:
+		case <-time.After(NDT7_CLOSE_WAIT):
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	result.SentBytes = sent
+	result.RetransmitPercent = 0 // Of the server's few bytes sent, not the upload
+	if result.Bytes == 0 {
+		// Without the server's count, take what the agent sent
+		result.Bytes, result.DurationSec = sent, elapsed.Seconds()
+	}
+	result.ThroughputMbps = ndt7Throughput(result.Bytes, result.DurationSec)
+	return result, nil
+}
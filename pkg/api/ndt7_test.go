@@ -0,0 +1,72 @@
+package api
+
+import (
+	"bytes"
+	"math"
+	"testing"
+)
+
+func TestWSMask(t *testing.T) {
+	// The masked "Hello" of RFC 6455 section 5.7
+	key := [4]byte{0x37, 0xfa, 0x21, 0x3d}
+	b := []byte("Hello")
+	wsMask(b, key)
+	if expected := []byte{0x7f, 0x9f, 0x4d, 0x51, 0x58}; !bytes.Equal(b, expected) {
+		t.Errorf("Expected % x, got % x", expected, b)
+	}
+	wsMask(b, key)
+	if string(b) != "Hello" {
+		t.Errorf("Expected masking twice to restore the payload, got %q", b)
+	}
+}
+
+func TestNDT7NextSize(t *testing.T) {
+	size, sent := NDT7_MIN_MESSAGE, int64(0)
+	for i := 0; i < NDT7_MESSAGE_SCALE-1; i++ {
+		sent += int64(size)
+		size = ndt7NextSize(size, sent)
+	}
+	if size != NDT7_MIN_MESSAGE {
+		t.Fatalf("Expected the size to stay at %d before 16 messages, got %d", NDT7_MIN_MESSAGE, size)
+	}
+	sent += int64(size)
+	if size = ndt7NextSize(size, sent); size != 2*NDT7_MIN_MESSAGE {
+		t.Fatalf("Expected the size to double after 16 messages, got %d", size)
+	}
+	for i := 0; i < 1000; i++ {
+		sent += int64(size)
+		size = ndt7NextSize(size, sent)
+	}
+	if size != NDT7_MAX_MESSAGE {
+		t.Errorf("Expected the size to stop at %d, got %d", NDT7_MAX_MESSAGE, size)
+	}
+}
+
+func TestNDT7Observe(t *testing.T) {
+	r := &NDT7Result{}
+	r.observe([]byte(`{"ConnectionInfo": {"Client": "192.0.2.10:51234", "Server": "198.51.100.7:443", "UUID": "ndt-1"}}`))
+	r.observe([]byte(`{"AppInfo": {"ElapsedTime": 250000, "NumBytes": 1000}, "TCPInfo": {"BytesSent": 200000, "BytesRetrans": 1000, "BytesReceived": 0, "ElapsedTime": 260000, "MinRTT": 11620, "RTT": 14350, "RTTVar": 2100}}`))
+	r.observe([]byte(`not json`))
+
+	if r.Measurements != 2 {
+		t.Errorf("Expected 2 measurements, got %d", r.Measurements)
+	}
+	if r.ClientAddress != "192.0.2.10:51234" || r.UUID != "ndt-1" {
+		t.Errorf("Expected the connection info to be kept, got %q and %q", r.ClientAddress, r.UUID)
+	}
+	if r.MinRTTMs != 11.62 || r.RTTMs != 14.35 || r.RTTVarMs != 2.1 {
+		t.Errorf("Expected min RTT 11.62 ms, RTT 14.35 ms and variation 2.1 ms, got %v, %v and %v", r.MinRTTMs, r.RTTMs, r.RTTVarMs)
+	}
+	if math.Abs(r.RetransmitPercent-0.5) > 1e-9 {
+		t.Errorf("Expected 0.5%% retransmitted, got %v", r.RetransmitPercent)
+	}
+	if r.Bytes != 0 {
+		t.Errorf("Expected no received bytes from a download measurement, got %d", r.Bytes)
+	}
+
+	// Upload: the server's received bytes and elapsed time replace the agent's count
+	r.observe([]byte(`{"TCPInfo": {"BytesReceived": 50000000, "ElapsedTime": 10000000, "MinRTT": 11800, "RTT": 62400}}`))
+	if r.Bytes != 50000000 || r.DurationSec != 10 {
+		t.Errorf("Expected 50000000 bytes in 10 s, got %d in %v", r.Bytes, r.DurationSec)
+	}
+}
@@ -0,0 +1,307 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Lab impairment emulation with tc/netem, for checking that tests detect what
+// was injected. Bounded so a typo cannot cut the agent off for long.
+const (
+	MAX_NETEM_DELAY_MS  = 5000
+	MAX_NETEM_RATE_MBIT = 10000
+	MIN_NETEM_RATE_MBIT = 0.1
+
+	DEFAULT_NETEM_DURATION = 300  // Seconds until an impairment clears itself
+	MAX_NETEM_DURATION     = 3600 // Seconds
+
+	TC_TIMEOUT = 5 * time.Second
+)
+
+// Impairment is a netem qdisc applied to an interface by this agent
+type Impairment struct {
+	Interface   string    `json:"interface"`
+	DelayMs     float64   `json:"delay_ms"`
+	JitterMs    float64   `json:"jitter_ms"`
+	LossPercent float64   `json:"loss_percent"`
+	RateMbit    float64   `json:"rate_mbit"`    // 0 leaves the rate unlimited
+	DurationSec int       `json:"duration_sec"` // Cleared automatically after this (default: 300)
+	AppliedAt   time.Time `json:"applied_at"`
+	ExpiresAt   time.Time `json:"expires_at"`
+	Command     string    `json:"command"`
+
+	timer *time.Timer
+}
+
+// validate checks the bounds of a requested impairment, defaulting its duration
+func (imp *Impairment) validate() error {
+	if imp.DurationSec == 0 {
+		imp.DurationSec = DEFAULT_NETEM_DURATION
+	}
+	switch {
+	case imp.DelayMs < 0 || imp.DelayMs > MAX_NETEM_DELAY_MS:
+		return fmt.Errorf("delay_ms must be between 0 and %d", MAX_NETEM_DELAY_MS)
+	case imp.JitterMs < 0 || imp.JitterMs > imp.DelayMs:
+		return fmt.Errorf("jitter_ms must be between 0 and delay_ms")
+	case imp.LossPercent < 0 || imp.LossPercent > 100:
+		return fmt.Errorf("loss_percent must be between 0 and 100")
+	case imp.RateMbit != 0 && (imp.RateMbit < MIN_NETEM_RATE_MBIT || imp.RateMbit > MAX_NETEM_RATE_MBIT):
+		return fmt.Errorf("rate_mbit must be between %g and %d, or 0 for unlimited", MIN_NETEM_RATE_MBIT, MAX_NETEM_RATE_MBIT)
+	case imp.DurationSec < 0 || imp.DurationSec > MAX_NETEM_DURATION:
+		return fmt.Errorf("duration_sec must be between 1 and %d", MAX_NETEM_DURATION)
+	case imp.DelayMs == 0 && imp.LossPercent == 0 && imp.RateMbit == 0:
+		return fmt.Errorf("at least one of delay_ms, loss_percent and rate_mbit is required")
+	}
+	return nil
+}
+
+// netemArgs builds the tc arguments replacing the root qdisc of dev with imp
+func netemArgs(dev string, imp *Impairment) []string {
+	args := []string{"qdisc", "replace", "dev", dev, "root", "netem"}
+	if imp.DelayMs > 0 {
+		args = append(args, "delay", formatTC(imp.DelayMs)+"ms")
+		if imp.JitterMs > 0 {
+			args = append(args, formatTC(imp.JitterMs)+"ms")
+		}
+	}
+	if imp.LossPercent > 0 {
+		args = append(args, "loss", formatTC(imp.LossPercent)+"%")
+	}
+	if imp.RateMbit > 0 {
+		args = append(args, "rate", formatTC(imp.RateMbit*1000)+"kbit")
+	}
+	return args
+}
+
+func formatTC(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// runTC executes tc with a hard timeout, returning its output in the error
+func runTC(args ...string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), TC_TIMEOUT)
+	defer cancel()
+
+	out, err := exec.CommandContext(ctx, "tc", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("tc %s: %v: %s", strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// ImpairmentStore tracks the impairments this agent applied, so only those are cleared
+type ImpairmentStore struct {
+	mu      sync.Mutex
+	byIface map[string]*Impairment
+	allowed map[string]bool // From NETEM_INTERFACES; empty disables impairments
+}
+
+var impairmentStore = &ImpairmentStore{byIface: make(map[string]*Impairment), allowed: make(map[string]bool)}
+
+// Apply replaces the interface's root qdisc with imp and schedules its removal
+func (s *ImpairmentStore) Apply(dev string, imp *Impairment) (*Impairment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	args := netemArgs(dev, imp)
+	if err := runTC(args...); err != nil {
+		return nil, err
+	}
+	if old := s.byIface[dev]; old != nil {
+		old.timer.Stop()
+	}
+	imp.Interface = dev
+	imp.Command = "tc " + strings.Join(args, " ")
+	imp.AppliedAt = time.Now().UTC()
+	imp.ExpiresAt = imp.AppliedAt.Add(time.Duration(imp.DurationSec) * time.Second)
+	imp.timer = time.AfterFunc(time.Until(imp.ExpiresAt), func() { s.expire(dev, imp) })
+	s.byIface[dev] = imp
+	log.Printf("Impairment applied: %s (for %ds)", imp.Command, imp.DurationSec)
+	return imp.snapshot(), nil
+}
+
+// Clear removes the impairment this agent applied to dev
+func (s *ImpairmentStore) Clear(dev string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	imp := s.byIface[dev]
+	if imp == nil {
+		return false, nil
+	}
+	if err := s.remove(dev); err != nil {
+		return true, err
+	}
+	imp.timer.Stop()
+	return true, nil
+}
+
+// expire clears imp when its duration ends, unless it was replaced meanwhile
+func (s *ImpairmentStore) expire(dev string, imp *Impairment) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.byIface[dev] != imp {
+		return
+	}
+	if err := s.remove(dev); err != nil {
+		errorf(nil, "Clearing expired impairment on %s failed: %v", dev, err)
+	}
+}
+
+func (s *ImpairmentStore) remove(dev string) error {
+	if err := runTC("qdisc", "del", "dev", dev, "root"); err != nil {
+		return err
+	}
+	delete(s.byIface, dev)
+	log.Printf("Impairment cleared on %s", dev)
+	return nil
+}
+
+// List returns the active impairments by interface name
+func (s *ImpairmentStore) List() []*Impairment {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := make([]*Impairment, 0, len(s.byIface))
+	for _, imp := range s.byIface {
+		list = append(list, imp.snapshot())
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Interface < list[j].Interface })
+	return list
+}
+
+func (imp *Impairment) snapshot() *Impairment {
+	c := *imp
+	c.timer = nil
+	return &c
+}
+
+// configureImpairments reads the interfaces impairments may be applied to from NETEM_INTERFACES
+func configureImpairments() {
+	for _, name := range strings.Split(os.Getenv("NETEM_INTERFACES"), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			impairmentStore.allowed[name] = true
+		}
+	}
+	if len(impairmentStore.allowed) > 0 && os.Getenv("ADMIN_TOKEN") == "" {
+		warnf(nil, "NETEM_INTERFACES is set but ADMIN_TOKEN is not; impairment endpoints stay disabled")
+	}
+}
+
+// adminAuth guards admin endpoints with the ADMIN_TOKEN bearer token; without
+// ADMIN_TOKEN they are disabled
+func adminAuth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := os.Getenv("ADMIN_TOKEN")
+		if token == "" {
+			jsonResponse(w, ApiResponse{
+				Status: "error",
+				Error:  "admin endpoints are disabled (set ADMIN_TOKEN)",
+			}, http.StatusForbidden)
+			return
+		}
+		given := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+			jsonResponse(w, ApiResponse{
+				Status: "error",
+				Error:  "invalid or missing admin token",
+			}, http.StatusUnauthorized)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// impairmentInterface resolves the {interface} of a request, reporting why it cannot be impaired
+func impairmentInterface(w http.ResponseWriter, r *http.Request) (string, bool) {
+	dev := mux.Vars(r)["interface"]
+	if !impairmentStore.allowed[dev] {
+		jsonResponse(w, ApiResponse{
+			Status: "error",
+			Error:  fmt.Sprintf("interface %s is not in NETEM_INTERFACES", dev),
+		}, http.StatusForbidden)
+		return "", false
+	}
+	if _, err := net.InterfaceByName(dev); err != nil {
+		jsonResponse(w, ApiResponse{
+			Status: "error",
+			Error:  fmt.Sprintf("interface %s not found", dev),
+		}, http.StatusNotFound)
+		return "", false
+	}
+	return dev, true
+}
+
+func impairmentList(w http.ResponseWriter, r *http.Request) {
+	jsonResponse(w, ApiResponse{
+		Status: "ok",
+		Data:   impairmentStore.List(),
+	}, http.StatusOK)
+}
+
+func impairmentApply(w http.ResponseWriter, r *http.Request) {
+	dev, ok := impairmentInterface(w, r)
+	if !ok {
+		return
+	}
+	var imp Impairment
+	if err := json.NewDecoder(r.Body).Decode(&imp); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := imp.validate(); err != nil {
+		jsonResponse(w, ApiResponse{
+			Status: "error",
+			Error:  err.Error(),
+		}, http.StatusBadRequest)
+		return
+	}
+
+	applied, err := impairmentStore.Apply(dev, &imp)
+	if err != nil {
+		jsonResponse(w, ApiResponse{
+			Status: "error",
+			Error:  err.Error(),
+		}, http.StatusInternalServerError)
+		return
+	}
+	jsonResponse(w, ApiResponse{
+		Status: "ok",
+		Data:   applied,
+	}, http.StatusOK)
+}
+
+func impairmentClear(w http.ResponseWriter, r *http.Request) {
+	dev, ok := impairmentInterface(w, r)
+	if !ok {
+		return
+	}
+	found, err := impairmentStore.Clear(dev)
+	if !found {
+		jsonResponse(w, ApiResponse{
+			Status: "error",
+			Error:  fmt.Sprintf("no impairment applied to %s", dev),
+		}, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		jsonResponse(w, ApiResponse{
+			Status: "error",
+			Error:  err.Error(),
+		}, http.StatusInternalServerError)
+		return
+	}
+	jsonResponse(w, ApiResponse{Status: "ok"}, http.StatusOK)
+}
@@ -0,0 +1,25 @@
+package api
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNetemArgs(t *testing.T) {
+	tests := []struct {
+		name string
+		imp  *Impairment
+		want string
+	}{
+		{"delay with jitter", &Impairment{DelayMs: 20, JitterMs: 2}, "qdisc replace dev veth0 root netem delay 20ms 2ms"},
+		{"loss only", &Impairment{LossPercent: 0.5}, "qdisc replace dev veth0 root netem loss 0.5%"},
+		{"fractional rate", &Impairment{RateMbit: 0.5}, "qdisc replace dev veth0 root netem rate 500kbit"},
+		{"all", &Impairment{DelayMs: 25.5, LossPercent: 1, RateMbit: 100}, "qdisc replace dev veth0 root netem delay 25.5ms loss 1% rate 100000kbit"},
+	}
+
+	for _, tt := range tests {
+		if got := strings.Join(netemArgs("veth0", tt.imp), " "); got != tt.want {
+			t.Errorf("%s: expected %q, got %q", tt.name, tt.want, got)
+		}
+	}
+}
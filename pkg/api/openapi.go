@@ -0,0 +1,797 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// The API is described once, by apiTags and apiOperations in openapi_spec.go
+// and apiSchemas in openapi_schemas.go. buildOpenAPI turns them into the OpenAPI 3.0 document
+// served at GET /openapi.json, and the HTML documentation at / is rendered
+// from that document.
+const OPENAPI_VERSION = "3.0.3"
+
+// apiTag groups operations, as the HTML documentation's sections
+type apiTag struct {
+	Name        string // Anchor of the section
+	Title       string
+	Description string // Markdown: `code` spans only
+}
+
+// apiField is a documented schema property, query or path parameter. Type is
+// string, integer, number, boolean, object or date-time, []<type> for arrays,
+// map[string]<type> for objects of one value type, <type>|<type> for either,
+// *<type> for a type or null, or the name of one of apiSchemas. Default is written as in the docs and
+// becomes the schema default when it parses as Type.
+type apiField struct {
+	Name        string
+	Type        string
+	Required    bool
+	Default     string
+	Description string
+}
+
+// apiSchema is a named schema of request bodies and response data
+type apiSchema struct {
+	Name        string
+	Description string
+	Fields      []apiField
+	Run         bool // Body of a client run endpoint, merged into RunRequest
+}
+
+// apiOperation documents one route
+type apiOperation struct {
+	Method      string
+	Path        string
+	OperationID string // The handler's name
+	Tag         string
+	Description string
+	Params      []apiField // Path and query parameters, path ones by their {name}
+	ExamplePath string     // Path and query of the example request
+	Body        string     // apiSchemas name of the JSON request body
+	BodyExample string
+	Optional    bool // The body may be left out
+	Run         bool // Client run endpoint: ?async=true answers 202 with the job
+	Output      bool // Answers CSV or JUnit XML too, as ?output or Accept picks; implied by Run
+	Admin       bool // Requires Authorization: Bearer ADMIN_TOKEN
+
+	Status          int    // Success status (default: 200)
+	Response        string // Type of data in the response envelope, or of the whole ContentType response
+	ContentType     string // Response without the envelope, e.g. text/event-stream
+	ResponseExample string
+
+	Tip *OpenAPITip // Shown below the example response
+}
+
+// OpenAPIDoc is an OpenAPI 3.0 document, with the subset of the
+// specification this API needs
+type OpenAPIDoc struct {
+	OpenAPI    string                                  `json:"openapi"`
+	Info       OpenAPIInfo                             `json:"info"`
+	Servers    []OpenAPIServer                         `json:"servers"`
+	Tags       []OpenAPITag                            `json:"tags"`
+	Paths      map[string]map[string]*OpenAPIOperation `json:"paths"`
+	Components OpenAPIComponents                       `json:"components"`
+	Security   []map[string][]string                   `json:"security,omitempty"`
+
+	operations []*OpenAPIOperation // In documentation order, for the HTML view
+}
+
+type OpenAPIInfo struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Version     string `json:"version"`
+}
+
+// OpenAPIServer is a base URL of the paths, relative to the document's
+type OpenAPIServer struct {
+	URL         string `json:"url"`
+	Description string `json:"description,omitempty"`
+}
+
+type OpenAPITag struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	DisplayName string `json:"x-displayName,omitempty"`
+}
+
+type OpenAPIOperation struct {
+	OperationID string                      `json:"operationId"`
+	Tags        []string                    `json:"tags"`
+	Description string                      `json:"description"`
+	Parameters  []*OpenAPIParameter         `json:"parameters,omitempty"`
+	RequestBody *OpenAPIRequestBody         `json:"requestBody,omitempty"`
+	Responses   map[string]*OpenAPIResponse `json:"responses"`
+	Security    []map[string][]string       `json:"security,omitempty"`
+	Tip         *OpenAPITip                 `json:"x-tip,omitempty"`
+
+	method, path string
+	status       int // Success status, the response the HTML view shows
+}
+
+// OpenAPITip is a note on an operation, such as how its metric is measured
+type OpenAPITip struct {
+	Title string `json:"title"`
+	Text  string `json:"text"`
+}
+
+type OpenAPIParameter struct {
+	Name        string         `json:"name"`
+	In          string         `json:"in"`
+	Description string         `json:"description,omitempty"`
+	Required    bool           `json:"required,omitempty"`
+	Schema      *OpenAPISchema `json:"schema"`
+	Example     string         `json:"example,omitempty"`
+}
+
+type OpenAPIRequestBody struct {
+	Required bool                         `json:"required,omitempty"`
+	Content  map[string]*OpenAPIMediaType `json:"content"`
+}
+
+type OpenAPIMediaType struct {
+	Schema  *OpenAPISchema  `json:"schema"`
+	Example json.RawMessage `json:"example,omitempty"`
+}
+
+type OpenAPIResponse struct {
+	Description string                       `json:"description"`
+	Content     map[string]*OpenAPIMediaType `json:"content,omitempty"`
+}
+
+type OpenAPISchema struct {
+	Ref                  string                    `json:"$ref,omitempty"`
+	Type                 string                    `json:"type,omitempty"`
+	Format               string                    `json:"format,omitempty"`
+	Description          string                    `json:"description,omitempty"`
+	Default              interface{}               `json:"default,omitempty"`
+	Items                *OpenAPISchema            `json:"items,omitempty"`
+	Properties           map[string]*OpenAPISchema `json:"properties,omitempty"`
+	AdditionalProperties *OpenAPISchema            `json:"additionalProperties,omitempty"`
+	Required             []string                  `json:"required,omitempty"`
+	OneOf                []*OpenAPISchema          `json:"oneOf,omitempty"`
+	AllOf                []*OpenAPISchema          `json:"allOf,omitempty"`
+	Nullable             bool                      `json:"nullable,omitempty"`
+
+	order []string // Properties in documentation order
+}
+
+type OpenAPIComponents struct {
+	Schemas         map[string]*OpenAPISchema         `json:"schemas"`
+	SecuritySchemes map[string]map[string]interface{} `json:"securitySchemes"`
+}
+
+var (
+	apiSpecOnce sync.Once
+	apiSpec     *OpenAPIDoc
+)
+
+// openAPI returns the document, built on first use
+func openAPI() *OpenAPIDoc {
+	apiSpecOnce.Do(func() {
+		apiSpec = buildOpenAPI()
+	})
+	return apiSpec
+}
+
+// schemaRef is the $ref of one of apiSchemas
+func schemaRef(name string) string {
+	return "#/components/schemas/" + name
+}
+
+// typeSchema is the schema of an apiField Type
+func typeSchema(t string) *OpenAPISchema {
+	if before, after, ok := strings.Cut(t, "|"); ok {
+		return &OpenAPISchema{OneOf: []*OpenAPISchema{typeSchema(before), typeSchema(after)}}
+	}
+	switch {
+	case t == "":
+		return &OpenAPISchema{} // Any value
+	case strings.HasPrefix(t, "*"):
+		s := typeSchema(t[1:])
+		if s.Ref != "" {
+			s = &OpenAPISchema{AllOf: []*OpenAPISchema{s}}
+		}
+		s.Nullable = true
+		return s
+	case strings.HasPrefix(t, "[]"):
+		return &OpenAPISchema{Type: "array", Items: typeSchema(t[2:])}
+	case strings.HasPrefix(t, "map[string]"):
+		return &OpenAPISchema{Type: "object", AdditionalProperties: typeSchema(strings.TrimPrefix(t, "map[string]"))}
+	case t == "date-time":
+		return &OpenAPISchema{Type: "string", Format: "date-time"}
+	case t == "string" || t == "integer" || t == "number" || t == "boolean" || t == "object":
+		return &OpenAPISchema{Type: t}
+	}
+	return &OpenAPISchema{Ref: schemaRef(t)}
+}
+
+// fieldSchema is the schema of a field, its default converted to its type.
+// Defaults that do not parse as one, such as "862 (udp), 5201 (tcp)", are
+// kept in the description.
+func fieldSchema(f apiField) *OpenAPISchema {
+	s := typeSchema(f.Type)
+	if s.Ref != "" && f.Description != "" {
+		s = &OpenAPISchema{AllOf: []*OpenAPISchema{s}} // $ref siblings are ignored in OpenAPI 3.0
+	}
+	s.Description = f.Description
+	if f.Default == "" {
+		return s
+	}
+	var def interface{}
+	var err error
+	switch s.Type {
+	case "integer":
+		def, err = strconv.ParseInt(f.Default, 10, 64)
+	case "number":
+		def, err = strconv.ParseFloat(f.Default, 64)
+	case "boolean":
+		def, err = strconv.ParseBool(f.Default)
+	case "string":
+		def = f.Default
+	default:
+		err = fmt.Errorf("no default of type %q", f.Type)
+	}
+	if err != nil {
+		s.Description = strings.TrimSpace(fmt.Sprintf("%s (default: %s)", s.Description, f.Default))
+		return s
+	}
+	s.Default = def
+	return s
+}
+
+// objectSchema is the schema of an object with fields
+func objectSchema(description string, fields []apiField) *OpenAPISchema {
+	s := &OpenAPISchema{Type: "object", Description: description, Properties: make(map[string]*OpenAPISchema)}
+	for _, f := range fields {
+		s.Properties[f.Name] = fieldSchema(f)
+		s.order = append(s.order, f.Name)
+		if f.Required {
+			s.Required = append(s.Required, f.Name)
+		}
+	}
+	return s
+}
+
+// runRequestFields returns the JSON names of RunRequest's fields, which all
+// marshal without omitempty, and their zero values
+func runRequestFields() map[string]interface{} {
+	raw, err := json.Marshal(RunRequest{})
+	if err != nil {
+		return nil
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return nil
+	}
+	return fields
+}
+
+// runRequestSchema generates the RunRequest schema from RunRequest's fields,
+// each documented as the first run endpoint body listing it. Fields no
+// endpoint documents yet are typed from their zero value.
+func runRequestSchema() *OpenAPISchema {
+	fields := runRequestFields()
+	var documented []apiField
+	seen := make(map[string]bool)
+	for _, schema := range apiSchemas {
+		if !schema.Run {
+			continue
+		}
+		for _, f := range schema.Fields {
+			if _, ok := fields[f.Name]; ok && !seen[f.Name] {
+				seen[f.Name] = true
+				f.Required = false // Only for some tests
+				documented = append(documented, f)
+			}
+		}
+	}
+	var rest []string
+	for name := range fields {
+		if !seen[name] {
+			rest = append(rest, name)
+		}
+	}
+	sort.Strings(rest)
+	for _, name := range rest {
+		f := apiField{Name: name}
+		switch fields[name].(type) {
+		case string:
+			f.Type = "string"
+		case float64:
+			f.Type = "number"
+		case bool:
+			f.Type = "boolean"
+		}
+		documented = append(documented, f)
+	}
+	return objectSchema("Body of the client run endpoints, with the fields of every test; each endpoint's own schema lists those it reads", documented)
+}
+
+// envelope is the ApiResponse schema with data of type t
+func envelope(t string) *OpenAPISchema {
+	fields := []apiField{{Name: "status", Type: "string", Required: true, Description: "ok"}}
+	if t != "" {
+		fields = append(fields, apiField{Name: "data", Type: t})
+	}
+	fields = append(fields, apiField{Name: "request_id", Type: "string", Description: "As in the X-Request-Id response header"})
+	return objectSchema("", fields)
+}
+
+// exampleJSON is an example as OpenAPI embeds it: JSON as is, other text as a string
+func exampleJSON(example string) json.RawMessage {
+	if example == "" {
+		return nil
+	}
+	if json.Valid([]byte(example)) {
+		return json.RawMessage(example)
+	}
+	raw, _ := json.Marshal(example)
+	return raw
+}
+
+// pathExamples splits an example request path into the values of its path
+// and query parameters, e.g. /jobs/af20ef46b0c8a787?state=running
+func pathExamples(template, example string) map[string]string {
+	values := make(map[string]string)
+	p, query, _ := strings.Cut(example, "?")
+	names := strings.Split(template, "/")
+	for i, v := range strings.Split(p, "/") {
+		if i < len(names) && strings.HasPrefix(names[i], "{") {
+			values[strings.Trim(names[i], "{}")] = v
+		}
+	}
+	for _, pair := range strings.Split(query, "&") {
+		if name, v, ok := strings.Cut(pair, "="); ok {
+			values[name] = v
+		}
+	}
+	return values
+}
+
+func buildOpenAPI() *OpenAPIDoc {
+	doc := &OpenAPIDoc{
+		OpenAPI: OPENAPI_VERSION,
+		Info: OpenAPIInfo{
+			Title:       "Network Test API",
+			Description: "API for network performance testing with native iperf3 protocol support",
+			Version:     API_VERSION,
+		},
+		// Paths are relative to the version; the unversioned aliases are deprecated
+		Servers: []OpenAPIServer{
+			{URL: API_PATH_PREFIX, Description: "API version " + API_PATH_VERSION},
+			{URL: "/", Description: "Deprecated unversioned paths, answered with Deprecation and Link headers"},
+		},
+		Paths: make(map[string]map[string]*OpenAPIOperation),
+		// An API key, or none when the agent has no keys configured
+		Security: []map[string][]string{{"apiKey": {}}, {}},
+		Components: OpenAPIComponents{
+			Schemas: map[string]*OpenAPISchema{"RunRequest": runRequestSchema()},
+			SecuritySchemes: map[string]map[string]interface{}{
+				"adminToken": {"type": "http", "scheme": "bearer", "description": "ADMIN_TOKEN of the agent"},
+				"apiKey":     {"type": "apiKey", "in": "header", "name": API_KEY_HEADER, "description": "Key from API_KEYS_FILE or API_KEYS; needed on all but the public endpoints once keys are configured"},
+			},
+		},
+	}
+	for _, tag := range apiTags {
+		doc.Tags = append(doc.Tags, OpenAPITag{Name: tag.Name, Description: tag.Description, DisplayName: tag.Title})
+	}
+	for _, schema := range apiSchemas {
+		doc.Components.Schemas[schema.Name] = objectSchema(schema.Description, schema.Fields)
+	}
+	for name, v := range apiSchemaTypes {
+		for _, field := range undocumentedFields(v, doc.Components.Schemas[name]) {
+			log.Printf("OpenAPI: schema %s does not document field %s", name, field)
+		}
+	}
+
+	for _, op := range apiOperations {
+		o := &OpenAPIOperation{
+			OperationID: op.OperationID,
+			Tags:        []string{op.Tag},
+			Description: op.Description,
+			Responses:   make(map[string]*OpenAPIResponse),
+			Tip:         op.Tip,
+			method:      op.Method,
+			path:        op.Path,
+			status:      op.Status,
+		}
+		if o.status == 0 {
+			o.status = http.StatusOK
+		}
+		examples := pathExamples(op.Path, op.ExamplePath)
+		for _, p := range op.Params {
+			param := &OpenAPIParameter{Name: p.Name, In: "query", Description: p.Description, Required: p.Required, Schema: fieldSchema(p), Example: examples[p.Name]}
+			param.Schema.Description = ""
+			if strings.Contains(op.Path, "{"+p.Name+"}") {
+				param.In, param.Required = "path", true
+			}
+			o.Parameters = append(o.Parameters, param)
+		}
+		for _, segment := range strings.Split(op.Path, "/") {
+			if name := strings.Trim(segment, "{}"); name != segment && !hasParam(o.Parameters, name) {
+				log.Printf("OpenAPI: %s %s does not document path parameter %s", op.Method, op.Path, name)
+			}
+		}
+		if op.Run {
+			o.Parameters = append(o.Parameters, &OpenAPIParameter{
+				Name: "async", In: "query", Schema: &OpenAPISchema{Type: "boolean", Default: false},
+				Description: "Run the test in the background and answer 202 with the job, see GET /jobs/{id}",
+			})
+		}
+		if op.Run || op.Output {
+			o.Parameters = append(o.Parameters, &OpenAPIParameter{
+				Name: "output", In: "query", Schema: &OpenAPISchema{Type: "string", Default: OUTPUT_JSON},
+				Description: "Response format: json, csv with a row per result, or junit, JUnit XML with a test case per result for CI systems; without it, Accept: text/csv or application/xml picks them",
+			})
+		}
+		if op.Body != "" {
+			o.RequestBody = &OpenAPIRequestBody{
+				Required: !op.Optional,
+				Content: map[string]*OpenAPIMediaType{
+					"application/json": {Schema: &OpenAPISchema{Ref: schemaRef(op.Body)}, Example: exampleJSON(op.BodyExample)},
+				},
+			}
+		}
+
+		success := &OpenAPIResponse{Description: http.StatusText(o.status)}
+		switch {
+		case o.status == http.StatusSwitchingProtocols:
+			success.Description = "Switching Protocols to a WebSocket"
+		case op.ContentType != "":
+			success.Content = map[string]*OpenAPIMediaType{op.ContentType: {Schema: typeSchema(op.Response), Example: exampleJSON(op.ResponseExample)}}
+		default:
+			success.Content = map[string]*OpenAPIMediaType{"application/json": {Schema: envelope(op.Response), Example: exampleJSON(op.ResponseExample)}}
+		}
+		if success.Content != nil && (op.Run || op.Output) {
+			success.Content["text/csv"] = &OpenAPIMediaType{Schema: &OpenAPISchema{Type: "string"}}
+			success.Content["application/xml"] = &OpenAPIMediaType{Schema: &OpenAPISchema{Type: "string"}}
+		}
+		o.Responses[strconv.Itoa(o.status)] = success
+		if op.Run {
+			o.Responses["202"] = &OpenAPIResponse{
+				Description: "Started as an asynchronous job (async=true)",
+				Content:     map[string]*OpenAPIMediaType{"application/json": {Schema: envelope("Job")}},
+			}
+		}
+		o.Responses["default"] = &OpenAPIResponse{
+			Description: "Error",
+			Content:     map[string]*OpenAPIMediaType{"application/json": {Schema: &OpenAPISchema{Ref: schemaRef("Error")}}},
+		}
+		if op.Admin {
+			o.Security = []map[string][]string{{"adminToken": {}, "apiKey": {}}, {"adminToken": {}}}
+		}
+
+		if doc.Paths[op.Path] == nil {
+			doc.Paths[op.Path] = make(map[string]*OpenAPIOperation)
+		}
+		doc.Paths[op.Path][strings.ToLower(op.Method)] = o
+		doc.operations = append(doc.operations, o)
+	}
+	return doc
+}
+
+// undocumentedFields returns the JSON fields of v's type that schema lacks.
+// Fields with omitempty only count when set, so v should set them.
+func undocumentedFields(v interface{}, schema *OpenAPISchema) []string {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return []string{err.Error()}
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return []string{err.Error()}
+	}
+	var missing []string
+	for name := range fields {
+		if schema == nil || schema.Properties[name] == nil {
+			missing = append(missing, name)
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+func hasParam(params []*OpenAPIParameter, name string) bool {
+	for _, p := range params {
+		if p.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func openAPIHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*") // For hosted viewers and code generators
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(openAPI())
+}
+
+// markdownHTML escapes s for HTML, turning `code` spans into <code>
+func markdownHTML(s string) string {
+	parts := strings.Split(html.EscapeString(s), "`")
+	var b strings.Builder
+	for i, part := range parts {
+		if i%2 == 1 && i < len(parts)-1 {
+			b.WriteString("<code>" + part + "</code>")
+			continue
+		}
+		if i%2 == 1 {
+			b.WriteString("`") // Unpaired
+		}
+		b.WriteString(part)
+	}
+	return b.String()
+}
+
+// resolve follows a schema's $ref, or that of the allOf wrapping one
+func (doc *OpenAPIDoc) resolve(s *OpenAPISchema) *OpenAPISchema {
+	if len(s.AllOf) == 1 {
+		s = s.AllOf[0]
+	}
+	if s.Ref != "" {
+		if target := doc.Components.Schemas[strings.TrimPrefix(s.Ref, schemaRef(""))]; target != nil {
+			return target
+		}
+	}
+	return s
+}
+
+// typeLabel names a schema's type for the HTML view
+func typeLabel(s *OpenAPISchema) string {
+	switch {
+	case s.Nullable:
+		t := *s
+		t.Nullable = false
+		return typeLabel(&t) + " or null"
+	case len(s.AllOf) == 1:
+		return typeLabel(s.AllOf[0])
+	case s.Ref != "":
+		return strings.TrimPrefix(s.Ref, schemaRef(""))
+	case len(s.OneOf) > 0:
+		labels := make([]string, len(s.OneOf))
+		for i, alt := range s.OneOf {
+			labels[i] = typeLabel(alt)
+		}
+		return strings.Join(labels, " or ")
+	case s.Type == "array":
+		return "array of " + typeLabel(s.Items)
+	case s.Format != "":
+		return s.Format
+	case s.Type == "":
+		return "any"
+	}
+	return s.Type
+}
+
+// defaultLabel is a schema's default for the HTML view
+func defaultLabel(s *OpenAPISchema) string {
+	if s.Default == nil {
+		return "-"
+	}
+	return `<span class="param-default">` + html.EscapeString(fmt.Sprint(s.Default)) + `</span>`
+}
+
+// writeParamRow writes one row of a parameters table
+func writeParamRow(b *strings.Builder, name string, s *OpenAPISchema, required bool, description string) {
+	requirement := `<span class="param-optional">optional</span>`
+	if required {
+		requirement = `<span class="param-required">required</span>`
+	}
+	fmt.Fprintf(b, `
+                        <tr>
+                            <td><span class="param-name">%s</span></td>
+                            <td><span class="param-type">%s</span></td>
+                            <td>%s</td>
+                            <td>%s</td>
+                            <td>%s</td>
+                        </tr>`, html.EscapeString(name), html.EscapeString(typeLabel(s)), requirement, defaultLabel(s), markdownHTML(description))
+}
+
+const paramsTableHead = `
+                <table class="params-table">
+                    <thead>
+                        <tr>
+                            <th>Parameter</th>
+                            <th>Type</th>
+                            <th>Required</th>
+                            <th>Default</th>
+                            <th>Description</th>
+                        </tr>
+                    </thead>
+                    <tbody>`
+
+const tableFoot = `
+                    </tbody>
+                </table>
+`
+
+// exampleCurl is the example request of o: a curl command with the example
+// path and query parameter values and request body
+func exampleCurl(o *OpenAPIOperation) string {
+	path := o.path
+	var query []string
+	for _, p := range o.Parameters {
+		switch {
+		case p.Example == "":
+		case p.In == "path":
+			path = strings.ReplaceAll(path, "{"+p.Name+"}", p.Example)
+		default:
+			query = append(query, p.Name+"="+p.Example)
+		}
+	}
+	url := "https://your-api.com" + API_PATH_PREFIX + path
+	if len(query) > 0 {
+		url = `"` + url + "?" + strings.Join(query, "&") + `"`
+	}
+	var body json.RawMessage
+	if o.RequestBody != nil {
+		body = o.RequestBody.Content["application/json"].Example
+	}
+	switch {
+	case body != nil:
+		var indented bytes.Buffer
+		if err := json.Indent(&indented, body, "  ", "  "); err != nil {
+			indented.Write(body)
+		}
+		return fmt.Sprintf("curl -X %s %s \\\n  -H \"Content-Type: application/json\" \\\n  -d '%s'", o.method, url, indented.String())
+	case o.method == http.MethodGet:
+		return "curl " + url
+	}
+	return fmt.Sprintf("curl -X %s %s", o.method, url)
+}
+
+// renderOperation writes the HTML documentation of one operation
+func (doc *OpenAPIDoc) renderOperation(b *strings.Builder, o *OpenAPIOperation, id string) {
+	fmt.Fprintf(b, `
+        <section class="endpoint"%s>
+            <div class="endpoint-header">
+                <span class="method method-%s">%s</span>
+                <span class="path">%s</span>
+            </div>
+            <div class="endpoint-body">
+                <p class="description">%s</p>
+`, id, strings.ToLower(o.method), o.method, html.EscapeString(API_PATH_PREFIX+o.path), markdownHTML(o.Description))
+
+	if len(o.Parameters) > 0 {
+		in := make(map[string]bool)
+		for _, p := range o.Parameters {
+			in[p.In] = true
+		}
+		title := "Parameters"
+		switch {
+		case !in["path"]:
+			title = "Query Parameters"
+		case !in["query"]:
+			title = "Path Parameters"
+		}
+		fmt.Fprintf(b, `
+                <h3 class="section-title">%s</h3>`+paramsTableHead, title)
+		for _, p := range o.Parameters {
+			writeParamRow(b, p.Name, p.Schema, p.Required, p.Description)
+		}
+		b.WriteString(tableFoot)
+	}
+	if o.RequestBody != nil {
+		body := doc.resolve(o.RequestBody.Content["application/json"].Schema)
+		b.WriteString(`
+                <h3 class="section-title">Request Parameters</h3>` + paramsTableHead)
+		required := make(map[string]bool)
+		for _, name := range body.Required {
+			required[name] = true
+		}
+		for _, name := range body.order {
+			writeParamRow(b, name, body.Properties[name], required[name], body.Properties[name].Description)
+		}
+		b.WriteString(tableFoot)
+	}
+	fmt.Fprintf(b, `
+                <h3 class="section-title">Example Request</h3>
+                <div class="code-block">
+                    <pre>%s</pre>
+                </div>
+`, html.EscapeString(exampleCurl(o)))
+
+	response := o.Responses[strconv.Itoa(o.status)]
+	var media *OpenAPIMediaType
+	for _, m := range response.Content {
+		media = m
+	}
+	if media == nil {
+		b.WriteString(`
+            </div>
+        </section>
+`)
+		return
+	}
+	b.WriteString(`
+                <div class="response-section">`)
+	data := media.Schema
+	if data.Properties["data"] != nil {
+		data = data.Properties["data"]
+	}
+	if data = doc.resolve(data); data.Type == "array" && data.Items != nil {
+		data = doc.resolve(data.Items)
+	}
+	if len(data.order) > 0 {
+		b.WriteString(`
+                    <h3 class="section-title">Response Fields</h3>
+                    <table class="params-table">
+                        <thead>
+                            <tr>
+                                <th>Field</th>
+                                <th>Type</th>
+                                <th>Description</th>
+                            </tr>
+                        </thead>
+                        <tbody>`)
+		for _, name := range data.order {
+			field := data.Properties[name]
+			fmt.Fprintf(b, `
+                            <tr><td><span class="param-name">%s</span></td><td><span class="param-type">%s</span></td><td>%s</td></tr>`,
+				html.EscapeString(name), html.EscapeString(typeLabel(field)), markdownHTML(field.Description))
+		}
+		b.WriteString(`
+                        </tbody>
+                    </table>
+`)
+	}
+	if media.Example != nil {
+		example := string(media.Example)
+		var indented bytes.Buffer
+		if json.Indent(&indented, media.Example, "", "  ") == nil {
+			example = indented.String()
+		}
+		var text string
+		if json.Unmarshal(media.Example, &text) == nil {
+			example = text // Not a JSON response
+		}
+		fmt.Fprintf(b, `
+                    <h3 class="section-title">Example Response</h3>
+                    <div class="code-block">
+                        <pre>%s</pre>
+                    </div>
+`, html.EscapeString(example))
+	}
+	if o.Tip != nil {
+		fmt.Fprintf(b, `
+                    <div class="tip">
+                        <div class="tip-title">%s</div>
+                        %s
+                    </div>
+`, html.EscapeString(o.Tip.Title), markdownHTML(o.Tip.Text))
+	}
+	b.WriteString(`                </div>
+            </div>
+        </section>
+`)
+}
+
+// renderHTML returns the navigation and the sections of the HTML documentation
+func (doc *OpenAPIDoc) renderHTML() (nav, sections string) {
+	var n, b strings.Builder
+	for _, tag := range doc.Tags {
+		fmt.Fprintf(&n, "\n            <li><a href=\"#%s\">%s</a></li>", tag.Name, html.EscapeString(tag.DisplayName))
+		fmt.Fprintf(&b, `
+        <h2 class="tag-title" id="%s">%s</h2>
+`, tag.Name, html.EscapeString(tag.DisplayName))
+		if tag.Description != "" {
+			fmt.Fprintf(&b, "        <p class=\"tag-description\">%s</p>\n", markdownHTML(tag.Description))
+		}
+		for _, o := range doc.operations {
+			if o.Tags[0] == tag.Name {
+				doc.renderOperation(&b, o, fmt.Sprintf(` id="%s"`, o.OperationID))
+			}
+		}
+	}
+	return n.String(), b.String()
+}
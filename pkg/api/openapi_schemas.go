@@ -0,0 +1,1956 @@
+package api
+
+import "network-test-api/pkg/nettest"
+
+// Request bodies and response data of the API. Schemas named after a Go type
+// mirror its JSON fields, see apiSchemaTypes; the descriptions are its comments.
+
+var apiSchemas = []apiSchema{
+	// Client run request bodies, merged into RunRequest
+	{Name: "Iperf3Request", Description: "Body of POST /iperf/client/run", Run: true, Fields: []apiField{
+		{Name: "server_host", Type: "string", Required: true, Description: "iperf3 server hostname or IP"},
+		{Name: "server_port", Type: "integer", Default: "5201", Description: "iperf3 server port"},
+		{Name: "duration", Type: "integer", Default: "5", Description: "Test duration in seconds"},
+		{Name: "parallel", Type: "integer", Default: "1", Description: "Number of parallel streams"},
+		{Name: "protocol", Type: "string", Default: "TCP", Description: "Protocol to use: TCP or UDP"},
+		{Name: "reverse", Type: "boolean", Default: "false", Description: "Reverse mode (download instead of upload)"},
+		{Name: "bandwidth", Type: "number|string", Default: "100", Description: "Bandwidth limit in Mbit/s, or a rate with a K, M or G suffix such as \"500K\" or \"2.5M\"; 0 for no limit (TCP only), which turns pacing off"},
+		{Name: "payload", Type: "string", Default: "random", Description: "Payload entropy: random, compressible or zero"},
+		{Name: "preflight", Type: "boolean", Default: "false", Description: "TCP-probe the control port first; abort with code ERR_UNREACHABLE if it fails and report the idle RTT as preflight"},
+		{Name: "ecn", Type: "boolean", Default: "false", Description: "TCP only, Linux agents with net.ipv4.tcp_ecn=1: negotiate ECN on the streams and report it as ecn"},
+		{Name: "bandwidth_mode", Type: "string", Default: "fixed", Description: "fixed; adaptive to search for the highest UDP rate within max_loss by doubling and bisecting, or ramp to step the rate up by ramp_step until a trial exceeds it"},
+		{Name: "max_loss", Type: "number", Default: "1.0", Description: "Adaptive and ramp mode loss target in percent"},
+		{Name: "ramp_step", Type: "number|string", Description: "Ramp mode: rate in Mbit/s, or such as \"500K\", added after each trial within max_loss (default: bandwidth)"},
+		{Name: "num_bytes", Type: "integer", Description: "Stop once this many bytes moved on all streams, like iperf3 -n; duration then limits the test (default: 60). Not with block_count or adaptive mode"},
+		{Name: "block_count", Type: "integer", Description: "Stop once this many blocks of the block size (128 KiB TCP, 1460 bytes UDP) moved, like iperf3 -k"},
+		{Name: "omit", Type: "integer", Description: "TCP only: seconds run before duration and left out of the results, like iperf3 -O (default: 0, max: 60)"},
+		{Name: "congestion", Type: "string", Description: "TCP only: congestion control algorithm of both ends, e.g. cubic, bbr or reno, like iperf3 -C (Linux)"},
+		{Name: "window_size", Type: "integer", Description: "SO_SNDBUF and SO_RCVBUF of the data streams in bytes, 4096 to 536870912, like iperf3 -w; disables buffer autotuning (Linux)"},
+		{Name: "pacing_timer", Type: "integer", Default: "1000", Description: "Granularity of the token bucket pacing the sending streams to bandwidth in microseconds, up to 1000000, like iperf3 --pacing-timer; sent to the server for reverse tests"},
+		{Name: "zerocopy", Type: "boolean", Default: "false", Description: "Send the blocks of TCP uploads with sendfile, like iperf3 -Z, sparing the agent a copy per write on fast links (Linux)"},
+		{Name: "tcp_info", Type: "boolean", Default: "false", Description: "TCP uploads: report each stream's cwnd, ssthresh, RTT, pacing and delivery rate and retransmitted bytes from TCP_INFO every second and at the end, like ss -ti (Linux)"},
+		{Name: "credentials", Type: "string", Description: "SECRETS_FILE entry with username, password and rsa_public_key for servers that require a login; a refused login fails with code ERR_AUTH_FAILED"},
+		{Name: "series", Type: "boolean", Default: "false", Description: "Include a time series (iperf3: per-second throughput, TWAMP: per-probe RTT)"},
+		{Name: "series_max_points", Type: "integer", Default: "300", Description: "Maximum number of series points returned"},
+		{Name: "series_downsample", Type: "string", Default: "mean", Description: "How to cap a longer series: mean, min, max or none (truncate)"},
+		{Name: "address_family", Type: "string", Default: "auto", Description: "Control connection family: auto (Happy Eyeballs), ipv4, ipv6 or compare (connect over both, keep the faster)"},
+		{Name: "ip_version", Type: "integer|string", Description: "4, 6 or auto: the same as address_family ipv4, ipv6 or auto, which it overrides"},
+		{Name: "source_address", Type: "string", Description: "Local IP address to send the test from; address_family follows its family"},
+		{Name: "interface", Type: "string", Description: "Interface or VRF device to bind the test's sockets to with SO_BINDTODEVICE (Linux)"},
+		{Name: "netns", Type: "string", Description: "Network namespace to open the test's sockets in: a name of ip netns or /proc/<pid>/ns/net; interface and source_address are those of the namespace, and server_host is resolved from it with the agent's /etc/resolv.conf name servers (Linux)"},
+		{Name: "dual_stack", Type: "string", Description: "sequential: run over IPv4, then IPv6, and compare the results"},
+		{Name: "dual_stack_threshold", Type: "number", Default: "10", Description: "Percent by which an IPv6 metric may be worse than IPv4 before it counts as a regression"},
+		{Name: "tunnel", Type: "string", Description: "Name of a TUNNELS_FILE tunnel (VXLAN, Geneve, GRE or an existing interface) to run the test through; server_host must be routed through it. Not with dual_stack"},
+		{Name: "profile", Type: "string", Description: "Named profile to apply instead of the one matching server_host (see GET /profiles)"},
+		{Name: "uplink", Type: "string", Description: "Shared uplink name; heavy tests on the same uplink run one at a time across agents"},
+		{Name: "lock_wait", Type: "integer", Default: "60", Description: "Seconds to wait for the target, server or uplink lock when another test holds it (max 600)"},
+		{Name: "timeout_sec", Type: "integer", Description: "Hard deadline of the test from connect to results exchange, after which it fails with code ERR_TIMEOUT (default and max: TEST_TIMEOUT_MAX, 3600)"},
+		{Name: "allow_concurrent", Type: "boolean", Default: "false", Description: "Run even while another test to the same server_host:port is running on this agent"},
+		{Name: "callback_url", Type: "string", Description: "URL to POST the stored result to, retried with backoff and HMAC-signed when WEBHOOK_SECRET is set"},
+		{Name: "prediction_id", Type: "string", Description: "ID of a stored TWAMP full mode result; the TCP result is checked against its tcp_prediction (TCP only)"},
+	}},
+	{Name: "TwampRequest", Description: "Body of POST /twamp/client/run", Run: true, Fields: []apiField{
+		{Name: "server_host", Type: "string", Required: true, Description: "TWAMP server hostname or IP"},
+		{Name: "server_port", Type: "integer", Default: "862", Description: "TWAMP control port"},
+		{Name: "count", Type: "integer", Default: "10", Description: "Number of test probes to send (10000 in loss mode); trains in capacity mode (default 50), streams in available mode (default 12)"},
+		{Name: "padding", Type: "integer", Default: "0", Description: "Padding bytes to add to test packets (1400 in capacity and available mode)"},
+		{Name: "series", Type: "boolean", Default: "false", Description: "Include a time series (iperf3: per-second throughput, TWAMP: per-probe RTT)"},
+		{Name: "series_max_points", Type: "integer", Default: "300", Description: "Maximum number of series points returned"},
+		{Name: "series_downsample", Type: "string", Default: "mean", Description: "How to cap a longer series: mean, min, max or none (truncate)"},
+		{Name: "address_family", Type: "string", Default: "auto", Description: "Control connection family: auto (Happy Eyeballs), ipv4, ipv6 or compare (connect over both, keep the faster)"},
+		{Name: "ip_version", Type: "integer|string", Description: "4, 6 or auto: the same as address_family ipv4, ipv6 or auto, which it overrides"},
+		{Name: "source_address", Type: "string", Description: "Local IP address to send the test from; address_family follows its family"},
+		{Name: "interface", Type: "string", Description: "Interface or VRF device to bind the test's sockets to with SO_BINDTODEVICE (Linux)"},
+		{Name: "netns", Type: "string", Description: "Network namespace to open the test's sockets in: a name of ip netns or /proc/<pid>/ns/net; interface and source_address are those of the namespace, and server_host is resolved from it with the agent's /etc/resolv.conf name servers (Linux)"},
+		{Name: "dual_stack", Type: "string", Description: "sequential or concurrent (full mode only): run over IPv4 and IPv6 and compare the results"},
+		{Name: "dual_stack_threshold", Type: "number", Default: "10", Description: "Percent by which an IPv6 metric may be worse than IPv4 before it counts as a regression"},
+		{Name: "tunnel", Type: "string", Description: "Name of a TUNNELS_FILE tunnel (VXLAN, Geneve, GRE or an existing interface) to run the test through; server_host must be routed through it. Not with dual_stack"},
+		{Name: "dscp", Type: "integer", Default: "0", Description: "DSCP code point for test packets (0-63, e.g. 46 for EF)"},
+		{Name: "tos", Type: "integer", Description: "DSCP as a TOS byte (0-255 with the ECN bits clear, e.g. 184 for EF); overrides dscp"},
+		{Name: "mode", Type: "string", Default: "full", Description: "Measurement mode: full (per-probe delay and jitter), loss (loss and reordering counters only, for high probe rates), capacity (link capacity from packet-train dispersion), available (available bandwidth from one-way delay trends) or sweep (a full mode run per padding_sizes entry, compared by size)"},
+		{Name: "rate", Type: "integer", Default: "1000", Description: "Probe rate in packets/s for loss mode (1-20000)"},
+		{Name: "ecn", Type: "boolean", Default: "false", Description: "Loss mode only, Linux agents: send probes as ECT(0) and count the ECN codepoints of the replies as ecn"},
+		{Name: "train_length", Type: "integer", Default: "2", Description: "Probes per back-to-back train in capacity mode (2-32), or per stream in available mode (25-500, default 100)"},
+		{Name: "histogram_bucket_ms", Type: "number", Description: "Full mode: bucket width in milliseconds (0.001-10000) of the RTT and one-way delay histograms returned as histogram_ms (default: none)"},
+		{Name: "padding_sizes", Type: "[]integer", Description: "Sweep mode: padding bytes to run full mode with, one run per size (up to 16, default: 0, 500 and 1400)"},
+		{Name: "include_raw", Type: "boolean", Default: "false", Description: "Full mode: return every probe with its T1-T4 timestamps, delays and TTLs as raw, lost probes included"},
+		{Name: "twamp_light", Type: "boolean", Default: "false", Description: "Full mode: send the probes straight to the reflector's UDP port at server_port, without TWAMP-Control (RFC 5357 Appendix I)"},
+		{Name: "sessions", Type: "[]TwampSessionSpec", Description: "Full mode: run up to 8 test sessions at once over one control connection, each with its own dscp and padding, which replace the request's"},
+		{Name: "bandwidth", Type: "number|string", Description: "Highest stream rate in Mbit/s, or a rate such as \"2.5M\", in available mode (default: the measured capacity)"},
+		{Name: "profile", Type: "string", Description: "Named profile to apply instead of the one matching server_host (see GET /profiles)"},
+		{Name: "uplink", Type: "string", Description: "Shared uplink name locked with the server in loss mode"},
+		{Name: "lock_wait", Type: "integer", Default: "60", Description: "Seconds to wait for the target lock, and the server lock in loss mode, when another test holds them (max 600)"},
+		{Name: "timeout_sec", Type: "integer", Description: "Hard deadline of the test from connect to results exchange, after which it fails with code ERR_TIMEOUT (default and max: TEST_TIMEOUT_MAX, 3600)"},
+		{Name: "allow_concurrent", Type: "boolean", Default: "false", Description: "Run even while another test to the same server_host:port is running on this agent"},
+		{Name: "callback_url", Type: "string", Description: "URL to POST the stored result to, retried with backoff and HMAC-signed when WEBHOOK_SECRET is set"},
+	}},
+	{Name: "TransferRequest", Description: "Body of POST /transfer/client/run", Run: true, Fields: []apiField{
+		{Name: "url", Type: "string", Required: true, Description: "http, https or ftp URL of the file; FTP credentials go in the URL (anonymous otherwise)"},
+		{Name: "direction", Type: "string", Default: "download", Description: "download or upload"},
+		{Name: "size", Type: "integer", Description: "Bytes to upload (default 10 MiB), or to stop a download after (default: whole file)"},
+		{Name: "method", Type: "string", Default: "PUT", Description: "HTTP upload method: PUT or POST"},
+		{Name: "duration", Type: "integer", Default: "60", Description: "Seconds the whole transfer may take (max 600)"},
+		{Name: "payload", Type: "string", Default: "random", Description: "Upload payload entropy: random, compressible or zero"},
+		{Name: "address_family", Type: "string", Default: "auto", Description: "Connection family: auto (Happy Eyeballs), ipv4, ipv6 or compare"},
+		{Name: "profile", Type: "string", Description: "Named profile to apply instead of the one matching the URL host"},
+		{Name: "uplink", Type: "string", Description: "Shared uplink name; heavy tests on the same uplink run one at a time across agents"},
+		{Name: "lock_wait", Type: "integer", Default: "60", Description: "Seconds to wait for the target, server or uplink lock when another test holds it (max 600)"},
+		{Name: "allow_concurrent", Type: "boolean", Default: "false", Description: "Run even while another test to the same host and port is running on this agent"},
+		{Name: "root_store", Type: "string", Default: "system", Description: "Root store to validate the https certificate chain against: system or a TLS_ROOT_STORES name"},
+		{Name: "tls_skip_verify", Type: "boolean", Default: "false", Description: "Run the test even when the chain does not validate or is revoked, reporting why in tls"},
+		{Name: "callback_url", Type: "string", Description: "URL to POST the stored result to, retried with backoff and HMAC-signed when WEBHOOK_SECRET is set"},
+	}},
+	{Name: "S3Request", Description: "Body of POST /s3/client/run", Run: true, Fields: []apiField{
+		{Name: "endpoint", Type: "string", Required: true, Description: "http or https URL of the S3 API, e.g. https://s3.eu-west-1.amazonaws.com"},
+		{Name: "bucket", Type: "string", Required: true, Description: "Bucket to upload to"},
+		{Name: "credentials", Type: "string", Required: true, Description: "Name of a SECRETS_FILE entry with access_key_id, secret_access_key and optionally session_token and region"},
+		{Name: "key", Type: "string", Description: "Object key (default: a random key under network-test-api/)"},
+		{Name: "region", Type: "string", Default: "us-east-1", Description: "Signing region; defaults to the credentials' region"},
+		{Name: "size", Type: "integer", Default: "67108864", Description: "Object size in bytes (max 10 GiB)"},
+		{Name: "part_size", Type: "integer", Default: "8388608", Description: "Part size in bytes, 5 MiB to 1 GiB"},
+		{Name: "parallel", Type: "integer", Default: "4", Description: "Parts in flight (max 16)"},
+		{Name: "virtual_host", Type: "boolean", Default: "false", Description: "Address the bucket as a subdomain of the endpoint instead of the path"},
+		{Name: "keep_object", Type: "boolean", Default: "false", Description: "Leave the object in the bucket instead of deleting it"},
+		{Name: "duration", Type: "integer", Default: "120", Description: "Seconds the whole test may take (max 600)"},
+		{Name: "payload", Type: "string", Default: "random", Description: "Upload payload entropy: random, compressible or zero"},
+		{Name: "address_family", Type: "string", Default: "auto", Description: "Connection family: auto (Happy Eyeballs), ipv4, ipv6 or compare"},
+		{Name: "profile", Type: "string", Description: "Named profile to apply instead of the one matching the endpoint host"},
+		{Name: "uplink", Type: "string", Description: "Shared uplink name; heavy tests on the same uplink run one at a time across agents"},
+		{Name: "lock_wait", Type: "integer", Default: "60", Description: "Seconds to wait for the target, server or uplink lock when another test holds it (max 600)"},
+		{Name: "allow_concurrent", Type: "boolean", Default: "false", Description: "Run even while another test to the same host and port is running on this agent"},
+		{Name: "root_store", Type: "string", Default: "system", Description: "Root store to validate the https certificate chain against: system or a TLS_ROOT_STORES name"},
+		{Name: "tls_skip_verify", Type: "boolean", Default: "false", Description: "Run the test even when the chain does not validate or is revoked, reporting why in tls"},
+		{Name: "callback_url", Type: "string", Description: "URL to POST the stored result to, retried with backoff and HMAC-signed when WEBHOOK_SECRET is set"},
+	}},
+	{Name: "SSHRequest", Description: "Body of POST /ssh/client/run", Run: true, Fields: []apiField{
+		{Name: "server_host", Type: "string", Required: true, Description: "SSH server hostname or IP address"},
+		{Name: "server_port", Type: "integer", Default: "22", Description: "SSH server port"},
+		{Name: "credentials", Type: "string", Required: true, Description: "Name of a SECRETS_FILE entry with username and private_key and/or password"},
+		{Name: "protocol", Type: "string", Default: "scp", Description: "Transfer protocol: scp or sftp"},
+		{Name: "direction", Type: "string", Default: "upload", Description: "upload or download"},
+		{Name: "remote_path", Type: "string", Description: "File to download (required) or upload to (default: /dev/null)"},
+		{Name: "size", Type: "integer", Description: "Bytes to upload (default: 10485760, max 10 GiB), or to stop a download after (default: whole file)"},
+		{Name: "host_key_fingerprint", Type: "string", Description: "Expected SHA256 host key fingerprint as ssh-keygen -l prints it; the test fails on a mismatch"},
+		{Name: "insecure_skip_host_key", Type: "boolean", Default: "false", Description: "Log in even when the host key is neither pinned nor listed in SSH_KNOWN_HOSTS, reporting host_key_verified false"},
+		{Name: "duration", Type: "integer", Default: "60", Description: "Seconds the whole test may take (max 600)"},
+		{Name: "payload", Type: "string", Default: "random", Description: "Upload payload entropy: random, compressible or zero"},
+		{Name: "address_family", Type: "string", Default: "auto", Description: "Connection family: auto (Happy Eyeballs), ipv4, ipv6 or compare"},
+		{Name: "profile", Type: "string", Description: "Named profile to apply instead of the one matching server_host"},
+		{Name: "uplink", Type: "string", Description: "Shared uplink name; heavy tests on the same uplink run one at a time across agents"},
+		{Name: "lock_wait", Type: "integer", Default: "60", Description: "Seconds to wait for the target, server or uplink lock when another test holds it (max 600)"},
+		{Name: "allow_concurrent", Type: "boolean", Default: "false", Description: "Run even while another test to the same host and port is running on this agent"},
+		{Name: "callback_url", Type: "string", Description: "URL to POST the stored result to, retried with backoff and HMAC-signed when WEBHOOK_SECRET is set"},
+	}},
+	{Name: "PMTURequest", Description: "Body of POST /pmtu/client/run and POST /mtu/client/run", Run: true, Fields: []apiField{
+		{Name: "server_host", Type: "string", Required: true, Description: "TWAMP server (udp), TCP server (tcp) or any host answering ping (icmp): hostname or IP address"},
+		{Name: "server_port", Type: "integer", Default: "862 (udp), 5201 (tcp)", Description: "TWAMP control port, or any listening TCP port; not used with icmp"},
+		{Name: "protocol", Type: "string", Default: "udp", Description: "udp (TWAMP test packets to a reflector), tcp (full-sized segments) or icmp (echo requests, needs root or CAP_NET_RAW)"},
+		{Name: "max_size", Type: "integer", Default: "1500", Description: "Largest IP packet size probed in bytes (576-9216), capped at the route MTU"},
+		{Name: "dscp", Type: "integer", Default: "0", Description: "DSCP code point of the UDP probes (0-63)"},
+		{Name: "address_family", Type: "string", Default: "auto", Description: "Connection family: auto (Happy Eyeballs), ipv4 or ipv6"},
+		{Name: "profile", Type: "string", Description: "Named profile to apply instead of the one matching server_host"},
+		{Name: "lock_wait", Type: "integer", Default: "60", Description: "Seconds to wait for the target lock when another test holds it (max 600)"},
+		{Name: "allow_concurrent", Type: "boolean", Default: "false", Description: "Run even while another test to the same host and port is running on this agent"},
+		{Name: "callback_url", Type: "string", Description: "URL to POST the stored result to, retried with backoff and HMAC-signed when WEBHOOK_SECRET is set"},
+	}},
+	{Name: "STUNRequest", Description: "Body of POST /stun/client/run", Run: true, Fields: []apiField{
+		{Name: "server_host", Type: "string", Required: true, Description: "STUN server hostname or IP address; an RFC 5780 server with an alternate address enables the mapping and filtering tests"},
+		{Name: "server_port", Type: "integer", Default: "3478", Description: "STUN server UDP port"},
+		{Name: "stun_servers", Type: "[]string", Description: "Up to 4 more STUN servers (host or host:port) asked for the public address from the same socket"},
+		{Name: "address_family", Type: "string", Default: "auto", Description: "Family to test: auto (first resolved address), ipv4 or ipv6"},
+		{Name: "profile", Type: "string", Description: "Named profile to apply instead of the one matching server_host"},
+		{Name: "lock_wait", Type: "integer", Default: "60", Description: "Seconds to wait for the target lock when another test holds it (max 600)"},
+		{Name: "allow_concurrent", Type: "boolean", Default: "false", Description: "Run even while another test to the same host and port is running on this agent"},
+		{Name: "callback_url", Type: "string", Description: "URL to POST the stored result to, retried with backoff and HMAC-signed when WEBHOOK_SECRET is set"},
+	}},
+	{Name: "NAT64Request", Description: "Body of POST /nat64/client/run", Run: true, Fields: []apiField{
+		{Name: "server_host", Type: "string", Required: true, Description: "Target: an IPv4-only host name, an IPv4 literal, or any host to see the path to it"},
+		{Name: "server_port", Type: "integer", Default: "443", Description: "Any TCP port listening on the target"},
+		{Name: "profile", Type: "string", Description: "Named profile to apply instead of the one matching server_host"},
+		{Name: "lock_wait", Type: "integer", Default: "60", Description: "Seconds to wait for the target lock when another test holds it (max 600)"},
+		{Name: "allow_concurrent", Type: "boolean", Default: "false", Description: "Run even while another test to the same host and port is running on this agent"},
+		{Name: "callback_url", Type: "string", Description: "URL to POST the stored result to, retried with backoff and HMAC-signed when WEBHOOK_SECRET is set"},
+	}},
+	{Name: "PingRequest", Description: "Body of POST /ping/client/run", Run: true, Fields: []apiField{
+		{Name: "server_host", Type: "string", Required: true, Description: "Host name or address to ping"},
+		{Name: "protocol", Type: "string", Description: "icmp, udp or echo (numbered, timestamped datagrams to a UDP echo responder); when omitted ICMP is used if the agent may open an ICMP socket, UDP otherwise"},
+		{Name: "count", Type: "integer", Default: "10", Description: "Probes to send (max 1000)"},
+		{Name: "interval", Type: "number", Default: "1", Description: "Seconds between probes (0.01-60)"},
+		{Name: "packet_size", Type: "integer", Default: "56", Description: "Payload bytes per probe, after the ICMP or UDP header (max 65000; at least 24 with echo)"},
+		{Name: "ttl", Type: "integer", Default: "64", Description: "TTL or hop limit of the probes (1-255)"},
+		{Name: "server_port", Type: "integer", Default: "33434 (udp), 7 (echo)", Description: "UDP destination port; with udp a closed port answers with port unreachable, which counts as a reply"},
+		{Name: "address_family", Type: "string", Default: "auto", Description: "auto, ipv4 or ipv6"},
+		{Name: "profile", Type: "string", Description: "Named profile to apply instead of the one matching server_host"},
+		{Name: "lock_wait", Type: "integer", Default: "60", Description: "Seconds to wait for the target lock when another test holds it (max 600)"},
+		{Name: "allow_concurrent", Type: "boolean", Default: "false", Description: "Run even while another test to the same host and port is running on this agent"},
+		{Name: "callback_url", Type: "string", Description: "URL to POST the stored result to, retried with backoff and HMAC-signed when WEBHOOK_SECRET is set"},
+	}},
+	{Name: "TracerouteRequest", Description: "Body of POST /traceroute/client/run", Run: true, Fields: []apiField{
+		{Name: "server_host", Type: "string", Required: true, Description: "Host name or address to trace the path to"},
+		{Name: "protocol", Type: "string", Default: "udp", Description: "udp (datagrams to consecutive ports), icmp (echo requests) or tcp (SYNs to server_port)"},
+		{Name: "max_hops", Type: "integer", Default: "30", Description: "Highest TTL probed (max 64)"},
+		{Name: "probes_per_hop", Type: "integer", Default: "3", Description: "Probes sent at each TTL (max 10)"},
+		{Name: "server_port", Type: "integer", Default: "33434 (udp), 80 (tcp)", Description: "First UDP destination port, or the TCP port; not used with icmp"},
+		{Name: "no_dns", Type: "boolean", Default: "false", Description: "Skip reverse DNS lookups of the hops"},
+		{Name: "address_family", Type: "string", Default: "auto", Description: "auto, ipv4 or ipv6"},
+		{Name: "profile", Type: "string", Description: "Named profile to apply instead of the one matching server_host"},
+		{Name: "lock_wait", Type: "integer", Default: "60", Description: "Seconds to wait for the target lock when another test holds it (max 600)"},
+		{Name: "allow_concurrent", Type: "boolean", Default: "false", Description: "Run even while another test to the same host and port is running on this agent"},
+		{Name: "callback_url", Type: "string", Description: "URL to POST the stored result to, retried with backoff and HMAC-signed when WEBHOOK_SECRET is set"},
+	}},
+
+	{Name: "OwampRequest", Description: "Body of POST /owamp/client/run", Run: true, Fields: []apiField{
+		{Name: "server_host", Type: "string", Required: true, Description: "owampd hostname or IP"},
+		{Name: "server_port", Type: "integer", Default: "861", Description: "OWAMP control port"},
+		{Name: "count", Type: "integer", Default: "100", Description: "Test packets to send (max 10000)"},
+		{Name: "interval", Type: "number", Default: "0.1", Description: "Seconds between packets (0.001-10)"},
+		{Name: "padding", Type: "integer", Default: "0", Description: "Padding bytes to add to test packets"},
+		{Name: "dscp", Type: "integer", Default: "0", Description: "DSCP code point for test packets (0-63, e.g. 46 for EF), also requested in the Type-P Descriptor"},
+		{Name: "tos", Type: "integer", Description: "DSCP as a TOS byte (0-255 with the ECN bits clear, e.g. 184 for EF); overrides dscp"},
+		{Name: "address_family", Type: "string", Default: "auto", Description: "Control connection family: auto (Happy Eyeballs), ipv4 or ipv6; test packets follow it"},
+		{Name: "source_address", Type: "string", Description: "Local IP address to send the test from; address_family follows its family"},
+		{Name: "interface", Type: "string", Description: "Interface or VRF device to bind the test's sockets to with SO_BINDTODEVICE (Linux)"},
+		{Name: "netns", Type: "string", Description: "Network namespace to open the test's sockets in: a name of ip netns or /proc/<pid>/ns/net; interface and source_address are those of the namespace, and server_host is resolved from it with the agent's /etc/resolv.conf name servers (Linux)"},
+		{Name: "profile", Type: "string", Description: "Named profile to apply instead of the one matching server_host"},
+		{Name: "lock_wait", Type: "integer", Default: "60", Description: "Seconds to wait for the target lock when another test holds it (max 600)"},
+		{Name: "timeout_sec", Type: "integer", Description: "Hard deadline of the test from connect to the fetched records, after which it fails with code ERR_TIMEOUT (default and max: TEST_TIMEOUT_MAX, 3600)"},
+		{Name: "allow_concurrent", Type: "boolean", Default: "false", Description: "Run even while another test to the same host and port is running on this agent"},
+		{Name: "callback_url", Type: "string", Description: "URL to POST the stored result to, retried with backoff and HMAC-signed when WEBHOOK_SECRET is set"},
+	}},
+
+	{Name: "TLSRequest", Description: "Body of POST /tls/client/run", Run: true, Fields: []apiField{
+		{Name: "server_host", Type: "string", Required: true, Description: "TLS server hostname or IP address"},
+		{Name: "server_port", Type: "integer", Default: "443", Description: "TCP port of the TLS server"},
+		{Name: "server_name", Type: "string", Default: "server_host", Description: "Name sent as SNI and the certificate is checked for, to test one virtual host by address"},
+		{Name: "alpn", Type: "[]string", Default: "h2, http/1.1", Description: "Protocols offered with ALPN (at most 8)"},
+		{Name: "tls_versions", Type: "[]string", Description: "Versions to try one handshake each, pinned to that version: 1.0, 1.1, 1.2 or 1.3"},
+		{Name: "root_store", Type: "string", Default: "system", Description: "Root store to validate the chain against: system or a TLS_ROOT_STORES name"},
+		{Name: "tls_skip_verify", Type: "boolean", Default: "false", Description: "Run the test even when the chain does not validate or is revoked, reporting why in tls"},
+		{Name: "address_family", Type: "string", Default: "auto", Description: "Connection family: auto (Happy Eyeballs), ipv4 or ipv6"},
+		{Name: "profile", Type: "string", Description: "Named profile to apply instead of the one matching server_host"},
+		{Name: "lock_wait", Type: "integer", Default: "60", Description: "Seconds to wait for the target lock when another test holds it (max 600)"},
+		{Name: "allow_concurrent", Type: "boolean", Default: "false", Description: "Run even while another test to the same host and port is running on this agent"},
+		{Name: "callback_url", Type: "string", Description: "URL to POST the stored result to, retried with backoff and HMAC-signed when WEBHOOK_SECRET is set"},
+	}},
+
+	{Name: "NDT7Request", Description: "Body of POST /ndt7/client/run", Run: true, Fields: []apiField{
+		{Name: "server_host", Type: "string", Description: "ndt-server hostname or IP address (default: the nearest M-Lab server, from the Locate API at NDT7_LOCATE_URL)"},
+		{Name: "server_port", Type: "integer", Default: "443 (wss), 80 (ws)", Description: "Port of the ndt-server; only with server_host"},
+		{Name: "protocol", Type: "string", Default: "wss", Description: "wss (WebSocket over TLS) or ws"},
+		{Name: "direction", Type: "string", Default: "both", Description: "download, upload or both, download first"},
+		{Name: "root_store", Type: "string", Default: "system", Description: "Root store to validate the wss certificate chain against: system or a TLS_ROOT_STORES name"},
+		{Name: "tls_skip_verify", Type: "boolean", Default: "false", Description: "Run the test even when the chain does not validate, reporting why in tls"},
+		{Name: "address_family", Type: "string", Default: "auto", Description: "Connection family: auto (Happy Eyeballs), ipv4 or ipv6"},
+		{Name: "profile", Type: "string", Description: "Named profile to apply instead of the one matching server_host"},
+		{Name: "uplink", Type: "string", Description: "Shared uplink name; heavy tests on the same uplink run one at a time across agents"},
+		{Name: "lock_wait", Type: "integer", Default: "60", Description: "Seconds to wait for the target, server or uplink lock when another test holds it (max 600)"},
+		{Name: "allow_concurrent", Type: "boolean", Default: "false", Description: "Run even while another test to the same host and port is running on this agent"},
+		{Name: "callback_url", Type: "string", Description: "URL to POST the stored result to, retried with backoff and HMAC-signed when WEBHOOK_SECRET is set"},
+	}},
+
+	{Name: "BufferbloatRequest", Description: "Body of POST /bufferbloat/client/run", Run: true, Fields: []apiField{
+		{Name: "server_host", Type: "string", Required: true, Description: "iperf3 server hostname or IP that loads the link"},
+		{Name: "server_port", Type: "integer", Default: "5201", Description: "iperf3 server port"},
+		{Name: "direction", Type: "string", Default: "both", Description: "Loads to apply: download, upload or both, download first"},
+		{Name: "duration", Type: "integer", Default: "10", Description: "Seconds of load per direction (5-60); the first 2 are left out of the loaded latency"},
+		{Name: "parallel", Type: "integer", Default: "4", Description: "TCP streams of each load (max 128)"},
+		{Name: "bandwidth", Type: "number|string", Default: "10000", Description: "Pacing limit of each load in Mbit/s, or a rate such as \"2.5M\", above the link so the load saturates it; 0 for none; capped by the API key and profile limits"},
+		{Name: "credentials", Type: "string", Description: "SECRETS_FILE entry with the iperf3 username, password and public_key, for servers with authentication"},
+		{Name: "probe", Type: "string", Default: "twamp", Description: "Latency probes: twamp (a TWAMP test session) or ping (ICMP echo, UDP without ICMP sockets)"},
+		{Name: "probe_host", Type: "string", Default: "server_host", Description: "TWAMP server or ping target"},
+		{Name: "probe_port", Type: "integer", Default: "862 (twamp)", Description: "TWAMP-Control port, or with ping a UDP port to probe instead of ICMP"},
+		{Name: "interval", Type: "number", Default: "0.1", Description: "Seconds between probes (0.01-1)"},
+		{Name: "idle_duration", Type: "integer", Default: "5", Description: "Seconds of probes without load before the first load, the idle baseline (max 30)"},
+		{Name: "address_family", Type: "string", Default: "auto", Description: "auto, ipv4 or ipv6, for the load and the probes"},
+		{Name: "profile", Type: "string", Description: "Named profile to apply instead of the one matching server_host"},
+		{Name: "uplink", Type: "string", Description: "Shared uplink name; heavy tests on the same uplink run one at a time across agents"},
+		{Name: "lock_wait", Type: "integer", Default: "60", Description: "Seconds to wait for the target, server or uplink lock when another test holds it (max 600)"},
+		{Name: "timeout_sec", Type: "integer", Description: "Hard deadline of the test, after which it fails with code ERR_TIMEOUT (default and max: TEST_TIMEOUT_MAX, 3600)"},
+		{Name: "allow_concurrent", Type: "boolean", Default: "false", Description: "Run even while another test to the same host and port is running on this agent"},
+		{Name: "callback_url", Type: "string", Description: "URL to POST the stored result to, retried with backoff and HMAC-signed when WEBHOOK_SECRET is set"},
+	}},
+
+	{Name: "RPMRequest", Description: "Body of POST /rpm/client/run", Run: true, Fields: []apiField{
+		{Name: "url", Type: "string", Default: "RPM_CONFIG_URL, else Apple's networkQuality configuration", Description: "https URL of a networkQuality configuration naming the small and large download and the upload URLs"},
+		{Name: "direction", Type: "string", Default: "both", Description: "Load to generate: download, upload or both at once"},
+		{Name: "duration", Type: "integer", Default: "20", Description: "Seconds of load (5-60); probes start once the goodput is saturated, or at half the duration"},
+		{Name: "parallel", Type: "integer", Default: "1", Description: "Load-generating connections per direction to start with; 4 more are added each second the goodput still grew (max 16)"},
+		{Name: "interval", Type: "number", Default: "0.1", Description: "Seconds between probes, one foreign and one self probe each (0.01-1)"},
+		{Name: "root_store", Type: "string", Default: "system", Description: "Root store to validate the certificate chains against: system or a TLS_ROOT_STORES name"},
+		{Name: "tls_skip_verify", Type: "boolean", Default: "false", Description: "Run the test even when the chain does not validate, reporting why in tls"},
+		{Name: "address_family", Type: "string", Default: "auto", Description: "Connection family: auto (Happy Eyeballs), ipv4 or ipv6"},
+		{Name: "profile", Type: "string", Description: "Named profile to apply instead of the one matching the host of url"},
+		{Name: "uplink", Type: "string", Description: "Shared uplink name; heavy tests on the same uplink run one at a time across agents"},
+		{Name: "lock_wait", Type: "integer", Default: "60", Description: "Seconds to wait for the target, server or uplink lock when another test holds it (max 600)"},
+		{Name: "timeout_sec", Type: "integer", Description: "Hard deadline of the test, after which it fails with code ERR_TIMEOUT (default and max: TEST_TIMEOUT_MAX, 3600)"},
+		{Name: "allow_concurrent", Type: "boolean", Default: "false", Description: "Run even while another test to the same host and port is running on this agent"},
+		{Name: "callback_url", Type: "string", Description: "URL to POST the stored result to, retried with backoff and HMAC-signed when WEBHOOK_SECRET is set"},
+	}},
+
+	{Name: "TCPConnectRequest", Description: "Body of POST /tcp/connect/run", Run: true, Fields: []apiField{
+		{Name: "targets", Type: "[]string", Required: true, Description: "host:port pairs to connect to, once each (at most 256); IPv6 addresses in brackets"},
+		{Name: "connect_timeout", Type: "number", Default: "3", Description: "Seconds per connect, name resolution included (0.1-30)"},
+		{Name: "parallel", Type: "integer", Default: "16", Description: "Connects at a time (max 64)"},
+		{Name: "address_family", Type: "string", Default: "auto", Description: "Connection family: auto (Happy Eyeballs), ipv4 or ipv6"},
+		{Name: "profile", Type: "string", Description: "Named profile to apply"},
+		{Name: "timeout_sec", Type: "integer", Description: "Hard deadline of the test, after which it fails with code ERR_TIMEOUT (default and max: TEST_TIMEOUT_MAX, 3600)"},
+		{Name: "callback_url", Type: "string", Description: "URL to POST the stored result to, retried with backoff and HMAC-signed when WEBHOOK_SECRET is set"},
+	}},
+
+	{Name: "HTTPRequest", Description: "Body of POST /http/client/run", Run: true, Fields: []apiField{
+		{Name: "url", Type: "string", Required: true, Description: "http or https URL to request"},
+		{Name: "direction", Type: "string", Default: "download", Description: "download or upload"},
+		{Name: "size", Type: "integer", Description: "Bytes to upload (default 10 MiB), or to stop a download after (default: whole body)"},
+		{Name: "method", Type: "string", Default: "PUT", Description: "Upload method: PUT or POST"},
+		{Name: "duration", Type: "integer", Default: "60", Description: "Seconds the whole request may take (max 600)"},
+		{Name: "payload", Type: "string", Default: "random", Description: "Upload payload entropy: random, compressible or zero"},
+		{Name: "address_family", Type: "string", Default: "auto", Description: "Connection family: auto (Happy Eyeballs), ipv4 or ipv6"},
+		{Name: "profile", Type: "string", Description: "Named profile to apply instead of the one matching the URL host"},
+		{Name: "uplink", Type: "string", Description: "Shared uplink name; heavy tests on the same uplink run one at a time across agents"},
+		{Name: "lock_wait", Type: "integer", Default: "60", Description: "Seconds to wait for the target, server or uplink lock when another test holds it (max 600)"},
+		{Name: "allow_concurrent", Type: "boolean", Default: "false", Description: "Run even while another test to the same host and port is running on this agent"},
+		{Name: "root_store", Type: "string", Default: "system", Description: "Root store to validate the https certificate chain against: system or a TLS_ROOT_STORES name"},
+		{Name: "tls_skip_verify", Type: "boolean", Default: "false", Description: "Run the test even when the chain does not validate or is revoked, reporting why in tls"},
+		{Name: "callback_url", Type: "string", Description: "URL to POST the stored result to, retried with backoff and HMAC-signed when WEBHOOK_SECRET is set"},
+	}},
+
+	// Client run response data
+	{Name: "Iperf3Response", Description: "Data of a POST /iperf/client/run response", Fields: []apiField{
+		{Name: "id", Type: "string", Description: "Result ID for GET /results/{id} and diffs"},
+		{Name: "profile", Type: "string", Description: "Name of the profile applied to the request, if any"},
+		{Name: "lock", Type: "LockInfo", Description: "Coordination lock the test ran under: resources, coordinator and waited_ms"},
+		{Name: "callback", Type: "WebhookCallback", Description: "With callback_url: url and delivery_id for GET /webhooks/deliveries/{id}"},
+		{Name: "preflight", Type: "PreflightResult", Description: "With preflight: true, idle TCP connect RTT to the control port (rtt_min_ms, rtt_avg_ms, rtt_max_ms over 3 probes)"},
+		{Name: "mtu", Type: "MTUReport", Description: "UDP upload only: path MTU feedback - frag_needed sends, clamped_datagram_bytes, route_mtu, tcp_mss, inferred effective_mtu and silent_drop_suspected"},
+		{Name: "ecn", Type: "TCPECNReport", Description: "With ecn: streams, negotiated_streams, negotiated, retransmits; uploads add ce_marks, ce_percent and ce_observed from ECE feedback, downloads markings_survived (received segments carried ECT)"},
+		{Name: "tunnel", Type: "TunnelReport", Description: "With tunnel: name, type, interface, created, remote, mtu, overhead_bytes, inner/outer_packet_bytes, payload_mbps, inner_mbps, outer_mbps and efficiency_percent"},
+		{Name: "prediction", Type: "PredictionCheck", Description: "With prediction_id: predicted_mbps (per-flow prediction times parallel), actual_mbps, achieved_percent, lower_bound, and below_prediction when under 50% of the prediction"},
+		{Name: "server", Type: "string", Description: "Target server hostname"},
+		{Name: "port", Type: "integer", Description: "Target server port"},
+		{Name: "protocol", Type: "string", Description: "Protocol used (TCP/UDP)"},
+		{Name: "bandwidth_mode", Type: "string", Description: "adaptive or ramp in those modes"},
+		{Name: "duration_sec", Type: "number", Description: "Actual test duration in seconds"},
+		{Name: "sent_bytes", Type: "integer", Description: "Total bytes sent (upload mode)"},
+		{Name: "received_bytes", Type: "integer", Description: "Total bytes received (reverse/download mode)"},
+		{Name: "bandwidth_mbps", Type: "number", Description: "Measured bandwidth in Mbps (adaptive mode: sustainable rate found)"},
+		{Name: "target_bytes", Type: "integer", Description: "With num_bytes or block_count: the amount to move, and target_reached, whether it moved before duration ran out"},
+		{Name: "target_reached", Type: "boolean", Description: "Whether target_bytes moved before duration ran out"},
+		{Name: "omit_sec", Type: "number", Description: "With omit: the seconds left out at the start, and omitted_bytes, the bytes moved in them"},
+		{Name: "omitted_bytes", Type: "integer", Description: "Bytes moved within omit_sec, left out of the results"},
+		{Name: "socket_buffers", Type: "Iperf3SocketBuffers", Description: "With window_size: requested, sndbuf_actual and rcvbuf_actual, the sizes the kernel granted, and limited when capped by wmem_max or rmem_max"},
+		{Name: "zerocopy", Type: "boolean", Description: "With zerocopy: whether every stream sent with sendfile; false when a stream fell back to plain writes"},
+		{Name: "tcp_info", Type: "TCPInfoReport", Description: "With tcp_info: TCP_INFO samples of each sending stream every second and at the end of the transfer"},
+		{Name: "retransmits", Type: "integer", Description: "TCP retransmits on all streams, with stream_retransmits per stream (TCP_INFO on uploads, server-reported on downloads)"},
+		{Name: "stream_retransmits", Type: "[]integer", Description: "TCP retransmits per stream"},
+		{Name: "streams", Type: "[]Iperf3Stream", Description: "Per stream: id, local address, bytes, bandwidth_mbps and, for TCP, retransmits and TCP_INFO rtt_ms, so an imbalance across parallel streams, such as from ECMP hashing, shows (not in adaptive mode)"},
+		{Name: "intervals", Type: "[]Iperf3Interval", Description: "Per-second start, end, bytes, bandwidth_mbps and (TCP uploads) retransmits, with streams per stream when parallel is above 1 and omitted within omit (not in adaptive mode)"},
+		{Name: "loss_percent", Type: "number", Description: "Receiver-measured UDP loss, by the server on uploads and the agent on downloads; packets, lost_packets and jitter_ms alongside (UDP only)"},
+		{Name: "packets", Type: "integer", Description: "UDP: datagrams the receiver expected"},
+		{Name: "lost_packets", Type: "integer", Description: "UDP: datagrams the receiver missed"},
+		{Name: "jitter_ms", Type: "number", Description: "UDP: jitter the receiver measured"},
+		{Name: "packets_sent", Type: "integer", Description: "Datagrams sent (UDP upload); UDP downloads report out_of_order_packets instead"},
+		{Name: "out_of_order_packets", Type: "integer", Description: "UDP download: datagrams received out of order"},
+		{Name: "server_results", Type: "Iperf3ServerReport", Description: "Server's own view from the results exchange: role, bytes, bandwidth_mbps, cpu_util_percent, retransmits or UDP counters, and streams"},
+		{Name: "pacing", Type: "PacingReport", Description: "Forward tests: timer_us, requested_mbps, achieved_mbps, accuracy_percent and interval_error_percent of the pacing (not in adaptive mode)"},
+		{Name: "adaptive", Type: "AdaptiveResult", Description: "Rate search summary and per-trial results (adaptive mode only)"},
+		{Name: "ramp", Type: "AdaptiveResult", Description: "Rate ramp summary and per-trial results (ramp mode only)"},
+		{Name: "dial", Type: "DialReport", Description: "Control connection family, address and connect time, with every attempt made"},
+		{Name: "source", Type: "SourceBinding", Description: "With source_address, interface or netns: the address, interface and namespace the test was bound to"},
+		{Name: "series", Type: "Series", Description: "Per-second throughput in Mbps (only when series=true); TCP uploads add retransmit_series, retransmits per second"},
+		{Name: "retransmit_series", Type: "Series", Description: "TCP uploads with series: retransmits per second"},
+		{Name: "sender_tcp_congestion", Type: "string", Description: "TCP congestion control the sending end ran, when known"},
+		{Name: "receiver_tcp_congestion", Type: "string", Description: "TCP congestion control the receiving end ran, when known"},
+	}},
+	{Name: "TwampResponse", Description: "Data of a POST /twamp/client/run response", Fields: []apiField{
+		{Name: "id", Type: "string", Description: "Result ID for GET /results/{id} and diffs"},
+		{Name: "profile", Type: "string", Description: "Name of the profile applied to the request, if any"},
+		{Name: "lock", Type: "LockInfo", Description: "Loss mode only: coordination lock the test ran under (resources, coordinator, waited_ms)"},
+		{Name: "callback", Type: "WebhookCallback", Description: "With callback_url: url and delivery_id for GET /webhooks/deliveries/{id}"},
+		{Name: "server", Type: "string", Description: "Target server hostname"},
+		{Name: "local_endpoint", Type: "string", Description: "Local test endpoint (IP:port)"},
+		{Name: "remote_endpoint", Type: "string", Description: "Remote test endpoint (IP:port)"},
+		{Name: "dial", Type: "DialReport", Description: "Control connection family, address and connect time, with every attempt made"},
+		{Name: "source", Type: "SourceBinding", Description: "With source_address, interface or netns: the address, interface and namespace the test was bound to"},
+		{Name: "dscp", Type: "integer", Description: "DSCP the probes were sent with, as applied to the socket"},
+		{Name: "mode", Type: "string", Description: "Measurement mode used (full, loss, capacity, available or sweep); loss mode returns sent, received, lost, duplicates, reordered, reordered_percent, loss_bursts, rate_pps, achieved_rate_pps and duration_sec instead of the delay fields, capacity mode a capacity object, available mode an available object and sweep mode steps and summary"},
+		{Name: "probes", Type: "integer", Description: "Number of probes sent"},
+		{Name: "sent", Type: "integer", Description: "Loss mode: probes sent"},
+		{Name: "received", Type: "integer", Description: "Loss mode: distinct replies"},
+		{Name: "lost", Type: "integer", Description: "Loss mode: probes without a reply"},
+		{Name: "duplicates", Type: "integer", Description: "Full and loss mode: replies to an answered probe"},
+		{Name: "reordered", Type: "integer", Description: "Full and loss mode: replies arriving after a later probe's"},
+		{Name: "reordered_percent", Type: "number", Description: "Full and loss mode: reordered replies per reply"},
+		{Name: "reordering", Type: "Reordering", Description: "Full and loss mode: how many sequence numbers behind the reordered replies arrived"},
+		{Name: "loss_bursts", Type: "LossBursts", Description: "Full and loss mode: runs of consecutive lost probes and the Gilbert-Elliott loss model fitted to them"},
+		{Name: "rate_pps", Type: "integer", Description: "Loss mode: requested probe rate"},
+		{Name: "achieved_rate_pps", Type: "number", Description: "Loss mode: probe rate reached"},
+		{Name: "duration_sec", Type: "number", Description: "Loss mode: time spent probing in seconds"},
+		{Name: "loss_percent", Type: "number", Description: "Packet loss percentage"},
+		{Name: "rtt_min_ms", Type: "number", Description: "Minimum network RTT in milliseconds, without reflector processing"},
+		{Name: "rtt_max_ms", Type: "number", Description: "Maximum network RTT in milliseconds"},
+		{Name: "rtt_avg_ms", Type: "number", Description: "Average network RTT in milliseconds"},
+		{Name: "rtt_stddev_ms", Type: "number", Description: "Network RTT standard deviation in milliseconds"},
+		{Name: "rtt_median_ms", Type: "number", Description: "Median network RTT in milliseconds"},
+		{Name: "rtt_mad_ms", Type: "number", Description: "Median absolute deviation of the network RTT in milliseconds"},
+		{Name: "estimated_clock_offset_ms", Type: "number", Description: "Estimated clock offset between sender and reflector"},
+		{Name: "clock_steps", Type: "TwampClockSteps", Description: "Probes excluded due to sender/reflector clock steps (sender_step_probes, reflector_step_probes, excluded_probes, max_step_ms)"},
+		{Name: "sync_status", Type: "TwampSyncStatus", Description: "Clock sync status (sender_synced, reflector_synced, both_synced)"},
+		{Name: "forward_delay_raw_ms", Type: "map[string]number", Description: "Raw forward delay (min, max, avg, median, mad)"},
+		{Name: "forward_delay_corrected_ms", Type: "map[string]number", Description: "Corrected forward delay (min, max, avg, median, mad)"},
+		{Name: "forward_jitter_ms", Type: "number", Description: "Forward path jitter (max - min)"},
+		{Name: "reverse_delay_raw_ms", Type: "map[string]number", Description: "Raw reverse delay (min, max, avg, median, mad)"},
+		{Name: "reverse_delay_corrected_ms", Type: "map[string]number", Description: "Corrected reverse delay (min, max, avg, median, mad)"},
+		{Name: "reverse_jitter_ms", Type: "number", Description: "Reverse path jitter (max - min)"},
+		{Name: "ecn", Type: "UDPECNReport", Description: "With ecn: reply counts per codepoint (not_ect, ect0, ect1, ce), ce_percent, bleached_percent, ce_observed and markings_survived"},
+		{Name: "tunnel", Type: "TunnelReport", Description: "With tunnel: name, type, interface, created, remote, mtu, overhead_bytes, inner/outer_packet_bytes and efficiency_percent; loss mode adds payload_mbps, inner_mbps and outer_mbps at the achieved rate"},
+		{Name: "percentiles_ms", Type: "LatencyPercentiles", Description: "Full mode: p50, p90, p95, p99 and p99_9 of the network RTT and the raw one-way delays"},
+		{Name: "histogram_ms", Type: "LatencyHistograms", Description: "Full mode with histogram_bucket_ms: the probes binned by network RTT and raw one-way delay"},
+		{Name: "tcp_prediction", Type: "TCPPrediction", Description: "Full mode: single-flow TCP throughput from RTT, loss and MSS (mathis_mbps, padhye_mbps, predicted_mbps, with loss_upper_bound when no probe was lost)"},
+		{Name: "capacity", Type: "CapacityResult", Description: "Capacity mode: bottleneck capacity from packet trains"},
+		{Name: "available", Type: "AvailableResult", Description: "Available mode: available bandwidth from probe streams"},
+		{Name: "steps", Type: "[]SweepStep", Description: "Sweep mode: latency and loss of each padding size, in the order swept"},
+		{Name: "summary", Type: "SweepSummary", Description: "Sweep mode: size dependent loss and the RTT growth with the packet size"},
+		{Name: "series", Type: "Series", Description: "Per-probe network RTT in ms (only when series=true)"},
+		{Name: "raw", Type: "[]TwampRawProbe", Description: "Full mode with include_raw: every probe sent, by sequence number"},
+		{Name: "twamp_light", Type: "boolean", Description: "The probes went to a TWAMP Light reflector, without a control session"},
+		{Name: "sessions", Type: "[]TwampSessionResult", Description: "Full mode with sessions: the result of each session, in the order requested, instead of the delay fields"},
+		{Name: "rtt_raw_ms", Type: "map[string]number", Description: "Raw RTT including reflector turnaround (min, max, avg, stddev)"},
+		{Name: "reflector_turnaround_ms", Type: "map[string]number", Description: "Reflector processing time T3-T2 (min, max, avg, median, mad)"},
+		{Name: "forward_ipdv_ms", Type: "map[string]number", Description: "RFC 3393 IP Packet Delay Variation (min, max, avg, mean_abs)"},
+		{Name: "reverse_ipdv_ms", Type: "map[string]number", Description: "RFC 3393 IP Packet Delay Variation (min, max, avg, mean_abs)"},
+		{Name: "hops", Type: "TwampHops", Description: "Hop counts derived from TTL (forward/reverse with min, max, avg)"},
+	}},
+	{Name: "TransferResponse", Description: "Data of a POST /transfer/client/run response", Fields: []apiField{
+		{Name: "id", Type: "string", Description: "Result ID for GET /results/{id} and diffs"},
+		{Name: "profile", Type: "string", Description: "Name of the profile applied to the request, if any"},
+		{Name: "lock", Type: "LockInfo", Description: "Coordination lock the test ran under: resources, coordinator and waited_ms"},
+		{Name: "callback", Type: "WebhookCallback", Description: "With callback_url: url and delivery_id for GET /webhooks/deliveries/{id}"},
+		{Name: "server", Type: "string", Description: "Host of the URL"},
+		{Name: "port", Type: "integer", Description: "Port of the URL, or the scheme's default"},
+		{Name: "url", Type: "string", Description: "URL transferred, with any password masked"},
+		{Name: "scheme", Type: "string", Description: "http, https or ftp"},
+		{Name: "direction", Type: "string", Description: "download or upload"},
+		{Name: "protocol", Type: "string", Description: "HTTP version, or FTP"},
+		{Name: "status_code", Type: "integer", Description: "HTTP status, or the FTP transfer reply code"},
+		{Name: "bytes", Type: "integer", Description: "Payload bytes transferred"},
+		{Name: "truncated", Type: "boolean", Description: "The download stopped at size before the end of the file"},
+		{Name: "goodput_mbps", Type: "number", Description: "Payload bytes over the transfer phase in Mbit/s"},
+		{Name: "duration_sec", Type: "number", Description: "Total time of the test in seconds"},
+		{Name: "timings", Type: "TransferTimings", Description: "Phases in ms: dial_ms (dns_ms and connect_ms), tls_ms, login_ms, data_connect_ms, request_ms, ttfb_ms, transfer_ms and total_ms"},
+		{Name: "tls_version", Type: "string", Description: "Negotiated TLS version (https only)"},
+		{Name: "tls", Type: "TLSReport", Description: "Certificate check (https only): version, cipher_suite, verified, verify_error, trust_anchor, days_to_expiry, chain and stapled ocsp status"},
+		{Name: "dial", Type: "DialReport", Description: "Connection family, address and connect time, with every attempt made"},
+	}},
+	{Name: "S3Response", Description: "Data of a POST /s3/client/run response", Fields: []apiField{
+		{Name: "id", Type: "string", Description: "Result ID for GET /results/{id} and diffs"},
+		{Name: "profile", Type: "string", Description: "Name of the profile applied to the request, if any"},
+		{Name: "lock", Type: "LockInfo", Description: "Coordination lock the test ran under: resources, coordinator and waited_ms"},
+		{Name: "callback", Type: "WebhookCallback", Description: "With callback_url: url and delivery_id for GET /webhooks/deliveries/{id}"},
+		{Name: "server", Type: "string", Description: "Host of the endpoint"},
+		{Name: "port", Type: "integer", Description: "Port of the endpoint, or the scheme's default"},
+		{Name: "endpoint", Type: "string", Description: "Endpoint URL"},
+		{Name: "bucket", Type: "string", Description: "Bucket written to"},
+		{Name: "key", Type: "string", Description: "Object key used"},
+		{Name: "region", Type: "string", Description: "Region the requests were signed for"},
+		{Name: "size", Type: "integer", Description: "Object size in bytes"},
+		{Name: "part_size", Type: "integer", Description: "Part size in bytes"},
+		{Name: "part_count", Type: "integer", Description: "Number of parts"},
+		{Name: "parallel", Type: "integer", Description: "Parts transferred at once"},
+		{Name: "upload", Type: "S3PhaseResult", Description: "Multipart upload: bytes, duration_ms, aggregate throughput_mbps, latency_ms statistics and per-part results"},
+		{Name: "download", Type: "S3PhaseResult", Description: "Ranged GETs of the same parts, in the same format"},
+		{Name: "requests", Type: "S3RequestTiming", Description: "create_ms, complete_ms and delete_ms of the requests around the parts"},
+		{Name: "kept", Type: "boolean", Description: "The object was left in the bucket (keep_object)"},
+		{Name: "connections", Type: "integer", Description: "Connections opened for the test"},
+		{Name: "duration_sec", Type: "number", Description: "Total time of the test in seconds"},
+		{Name: "tls_version", Type: "string", Description: "Negotiated TLS version (https only)"},
+		{Name: "tls", Type: "TLSReport", Description: "Certificate check of the first connection (https only): version, cipher_suite, verified, verify_error, trust_anchor, days_to_expiry, chain and stapled ocsp status"},
+		{Name: "dial", Type: "DialReport", Description: "Family, address and connect time of the first connection"},
+	}},
+	{Name: "SSHResponse", Description: "Data of a POST /ssh/client/run response", Fields: []apiField{
+		{Name: "id", Type: "string", Description: "Result ID for GET /results/{id} and diffs"},
+		{Name: "profile", Type: "string", Description: "Name of the profile applied to the request, if any"},
+		{Name: "lock", Type: "LockInfo", Description: "Coordination lock the test ran under: resources, coordinator and waited_ms"},
+		{Name: "callback", Type: "WebhookCallback", Description: "With callback_url: url and delivery_id for GET /webhooks/deliveries/{id}"},
+		{Name: "server", Type: "string", Description: "SSH server hostname"},
+		{Name: "port", Type: "integer", Description: "SSH server port"},
+		{Name: "protocol", Type: "string", Description: "scp or sftp"},
+		{Name: "direction", Type: "string", Description: "upload or download"},
+		{Name: "remote_path", Type: "string", Description: "File written or read on the server"},
+		{Name: "bytes", Type: "integer", Description: "File bytes transferred"},
+		{Name: "truncated", Type: "boolean", Description: "The download stopped at size before the end of the file"},
+		{Name: "goodput_mbps", Type: "number", Description: "File bytes over transfer_ms in Mbit/s"},
+		{Name: "timings", Type: "SSHTimings", Description: "dial_ms, kex_ms, auth_ms, setup_ms (the three together), channel_ms, transfer_ms and total_ms"},
+		{Name: "ssh", Type: "SSHInfo", Description: "server_version, kex, host_key_type, host_key_fingerprint, host_key_verified, cipher, mac, auth_method and rekeys"},
+		{Name: "duration_sec", Type: "number", Description: "Total time of the test in seconds"},
+		{Name: "dial", Type: "DialReport", Description: "Family, address and connect time of the connection"},
+	}},
+	{Name: "PMTUResponse", Description: "Data of a POST /pmtu/client/run response", Fields: []apiField{
+		{Name: "id", Type: "string", Description: "Result ID for GET /results/{id} and diffs"},
+		{Name: "profile", Type: "string", Description: "Name of the profile applied to the request, if any"},
+		{Name: "lock", Type: "LockInfo", Description: "Coordination lock the test ran under: resources, coordinator and waited_ms"},
+		{Name: "callback", Type: "WebhookCallback", Description: "With callback_url: url and delivery_id for GET /webhooks/deliveries/{id}"},
+		{Name: "server", Type: "string", Description: "Target hostname"},
+		{Name: "port", Type: "integer", Description: "TWAMP-Control or TCP port probed; left out with icmp"},
+		{Name: "protocol", Type: "string", Description: "udp, tcp or icmp"},
+		{Name: "family", Type: "string", Description: "ipv4 or ipv6"},
+		{Name: "address", Type: "string", Description: "IP address probed"},
+		{Name: "route_mtu", Type: "integer", Description: "The kernel's MTU for the route before probing"},
+		{Name: "max_size", Type: "integer", Description: "Largest size probed"},
+		{Name: "probes", Type: "[]PMTUProbe", Description: "Probed sizes, largest first: size, result (pass, frag_needed or no_reply), reported_mtu and from"},
+		{Name: "largest_passing", Type: "integer", Description: "Largest IP packet size that got through"},
+		{Name: "smallest_failing", Type: "integer", Description: "Smallest size above largest_passing that did not (0 if max_size passed)"},
+		{Name: "icmp_feedback", Type: "boolean", Description: "A failing size drew ICMP fragmentation-needed / packet-too-big"},
+		{Name: "reported_mtu", Type: "integer", Description: "Smallest MTU announced by the ICMP feedback"},
+		{Name: "blackhole", Type: "boolean", Description: "A size above largest_passing failed without any ICMP feedback"},
+		{Name: "tcp_mss", Type: "integer", Description: "MSS of a plain TCP connection to the server"},
+		{Name: "mss_mtu", Type: "integer", Description: "Packet size that MSS produces"},
+		{Name: "mss_clamped", Type: "boolean", Description: "mss_mtu is below max_size: the MSS was clamped on the path, or the server's MTU is smaller"},
+		{Name: "mss_exceeds_path", Type: "boolean", Description: "Full TCP segments exceed largest_passing and the path sends no ICMP, so bulk TCP stalls"},
+		{Name: "bottleneck", Type: "PMTUBottleneck", Description: "With ICMP feedback: the hop and router where fragmentation begins, left out when it stays unknown"},
+		{Name: "duration_sec", Type: "number", Description: "Total time of the test in seconds"},
+		{Name: "dial", Type: "DialReport", Description: "Family, address and connect time of the first connection; left out with icmp"},
+	}},
+	{Name: "STUNResponse", Description: "Data of a POST /stun/client/run response", Fields: []apiField{
+		{Name: "id", Type: "string", Description: "Result ID for GET /results/{id} and diffs"},
+		{Name: "profile", Type: "string", Description: "Name of the profile applied to the request, if any"},
+		{Name: "lock", Type: "LockInfo", Description: "Coordination lock the test ran under: resources, coordinator and waited_ms"},
+		{Name: "callback", Type: "WebhookCallback", Description: "With callback_url: url and delivery_id for GET /webhooks/deliveries/{id}"},
+		{Name: "server", Type: "string", Description: "STUN server hostname"},
+		{Name: "port", Type: "integer", Description: "STUN server port"},
+		{Name: "family", Type: "string", Description: "ipv4 or ipv6"},
+		{Name: "server_address", Type: "string", Description: "Address of server_host the requests went to"},
+		{Name: "local_address", Type: "string", Description: "Source address and port of the test socket"},
+		{Name: "public_address", Type: "string", Description: "Address and port the server saw the requests come from"},
+		{Name: "rtt_ms", Type: "number", Description: "Round-trip time of the first Binding request"},
+		{Name: "udp_blocked", Type: "boolean", Description: "No Binding response came back at all"},
+		{Name: "behind_nat", Type: "boolean", Description: "public_address differs from local_address"},
+		{Name: "port_preserved", Type: "boolean", Description: "The NAT kept the local port"},
+		{Name: "mapping", Type: "string", Description: "Mapping behavior: endpoint_independent, address_dependent, address_and_port_dependent, dependent or unknown"},
+		{Name: "filtering", Type: "string", Description: "Filtering behavior: endpoint_independent, address_dependent, address_and_port_dependent or unknown"},
+		{Name: "nat_type", Type: "string", Description: "Classic NAT type: open_internet, udp_firewall, full_cone, restricted_cone, port_restricted_cone, cone, symmetric, udp_blocked or unknown"},
+		{Name: "hairpinning", Type: "boolean", Description: "Behind a NAT: a request to the agent's own public address was looped back"},
+		{Name: "rfc5780", Type: "boolean", Description: "The server announced an alternate address for the behavior tests"},
+		{Name: "other_address", Type: "string", Description: "The server's alternate address"},
+		{Name: "servers", Type: "[]STUNServerMapping", Description: "Per stun_servers entry: server, address, public_address, rtt_ms or error"},
+		{Name: "duration_sec", Type: "number", Description: "Total time of the test in seconds"},
+	}},
+	{Name: "NAT64Response", Description: "Data of a POST /nat64/client/run response", Fields: []apiField{
+		{Name: "id", Type: "string", Description: "Result ID for GET /results/{id} and diffs"},
+		{Name: "profile", Type: "string", Description: "Name of the profile applied to the request, if any"},
+		{Name: "lock", Type: "LockInfo", Description: "Coordination lock the test ran under: resources, coordinator and waited_ms"},
+		{Name: "callback", Type: "WebhookCallback", Description: "With callback_url: url and delivery_id for GET /webhooks/deliveries/{id}"},
+		{Name: "server", Type: "string", Description: "IPv4-only target hostname"},
+		{Name: "port", Type: "integer", Description: "Target TCP port"},
+		{Name: "ipv4_route", Type: "boolean", Description: "The agent has an IPv4 route"},
+		{Name: "ipv6_route", Type: "boolean", Description: "The agent has an IPv6 route"},
+		{Name: "ipv6_only", Type: "boolean", Description: "IPv6 route and no IPv4 one, other than through a CLAT"},
+		{Name: "clat", Type: "boolean", Description: "The IPv4 source address is in 192.0.0.0/29 (464XLAT)"},
+		{Name: "dns64", Type: "boolean", Description: "The resolver synthesized AAAA records for ipv4only.arpa"},
+		{Name: "dns64_lookup_ms", Type: "number", Description: "Time of that lookup"},
+		{Name: "prefixes", Type: "[]NAT64Prefix", Description: "NAT64 prefixes tried: prefix, well_known and source (dns64, or well_known when assumed)"},
+		{Name: "target_ipv4", Type: "[]string", Description: "The target's A records"},
+		{Name: "target_ipv6", Type: "[]string", Description: "The target's native AAAA records"},
+		{Name: "target_synthesized", Type: "[]string", Description: "AAAA records of the target inside a NAT64 prefix"},
+		{Name: "ipv4_only", Type: "boolean", Description: "The target has no native IPv6 address"},
+		{Name: "nat64_address", Type: "string", Description: "The target's IPv4 address synthesized in the first prefix"},
+		{Name: "nat64_reachable", Type: "boolean", Description: "A TCP connection through the prefix succeeded"},
+		{Name: "nat64_connect_ms", Type: "number", Description: "Its connect time; nat64_error when it failed"},
+		{Name: "nat64_error", Type: "string", Description: "Why the connection through the prefix failed"},
+		{Name: "ipv4_connect_ms", Type: "number", Description: "Connect time directly over IPv4 with an IPv4 route; ipv4_error when it failed"},
+		{Name: "ipv4_error", Type: "string", Description: "Why the direct IPv4 connection failed"},
+		{Name: "path", Type: "string", Description: "How other tests reach the target: ipv6, nat64, ipv4 or none"},
+		{Name: "duration_sec", Type: "number", Description: "Total time of the test in seconds"},
+		{Name: "dial", Type: "DialReport", Description: "The connection made the way other tests dial, with nat64 and ipv4_address when translated"},
+	}},
+	{Name: "PingResponse", Description: "Data of a POST /ping/client/run response", Fields: []apiField{
+		{Name: "id", Type: "string", Description: "Result ID for GET /results/{id} and diffs"},
+		{Name: "profile", Type: "string", Description: "Name of the profile applied to the request, if any"},
+		{Name: "lock", Type: "LockInfo", Description: "Coordination lock the test ran under: resources, coordinator and waited_ms"},
+		{Name: "callback", Type: "WebhookCallback", Description: "With callback_url: url and delivery_id for GET /webhooks/deliveries/{id}"},
+		{Name: "server", Type: "string", Description: "Target hostname"},
+		{Name: "protocol", Type: "string", Description: "icmp, udp or echo"},
+		{Name: "socket", Type: "string", Description: "raw, datagram (unprivileged ICMP) or udp"},
+		{Name: "fallback_reason", Type: "string", Description: "Why no ICMP socket could be opened, when the test fell back to UDP"},
+		{Name: "family", Type: "string", Description: "ipv4 or ipv6"},
+		{Name: "address", Type: "string", Description: "Address pinged"},
+		{Name: "port", Type: "integer", Description: "UDP destination port"},
+		{Name: "packet_size", Type: "integer", Description: "ICMP payload or UDP datagram size in bytes"},
+		{Name: "ttl", Type: "integer", Description: "TTL or hop limit of the probes"},
+		{Name: "interval_sec", Type: "number", Description: "Time between probes in seconds"},
+		{Name: "transmitted", Type: "integer", Description: "Probes sent"},
+		{Name: "received", Type: "integer", Description: "Probes answered by the target"},
+		{Name: "errors", Type: "integer", Description: "Probes answered with time exceeded or unreachable by a router"},
+		{Name: "duplicates", Type: "integer", Description: "Extra replies to probes already answered"},
+		{Name: "loss_percent", Type: "number", Description: "Percentage of probes the target did not answer"},
+		{Name: "rtt_min_ms", Type: "number", Description: "Lowest round trip time"},
+		{Name: "rtt_avg_ms", Type: "number", Description: "Mean round trip time"},
+		{Name: "rtt_max_ms", Type: "number", Description: "Highest round trip time"},
+		{Name: "rtt_stddev_ms", Type: "number", Description: "Standard deviation of the round trip times"},
+		{Name: "rtt_median_ms", Type: "number", Description: "Median round trip time"},
+		{Name: "rtt_mad_ms", Type: "number", Description: "Median absolute deviation of the round trip times"},
+		{Name: "probes", Type: "[]PingProbe", Description: "Per probe: seq, status (reply, port_unreachable, ttl_exceeded, unreachable or timeout), rtt_ms, ttl of the reply and from for router errors"},
+		{Name: "duration_sec", Type: "number", Description: "Total time of the test in seconds"},
+	}},
+	{Name: "TracerouteResponse", Description: "Data of a POST /traceroute/client/run response", Fields: []apiField{
+		{Name: "id", Type: "string", Description: "Result ID for GET /results/{id} and diffs"},
+		{Name: "profile", Type: "string", Description: "Name of the profile applied to the request, if any"},
+		{Name: "lock", Type: "LockInfo", Description: "Coordination lock the test ran under: resources, coordinator and waited_ms"},
+		{Name: "callback", Type: "WebhookCallback", Description: "With callback_url: url and delivery_id for GET /webhooks/deliveries/{id}"},
+		{Name: "server", Type: "string", Description: "Target hostname"},
+		{Name: "protocol", Type: "string", Description: "udp, icmp or tcp"},
+		{Name: "socket", Type: "string", Description: "raw, or recverr for UDP without a raw ICMP socket"},
+		{Name: "fallback_reason", Type: "string", Description: "Why no raw ICMP socket could be opened, when UDP errors were read from the probe sockets"},
+		{Name: "family", Type: "string", Description: "ipv4 or ipv6"},
+		{Name: "address", Type: "string", Description: "Address traced to"},
+		{Name: "port", Type: "integer", Description: "First UDP destination port, or the TCP port"},
+		{Name: "max_hops", Type: "integer", Description: "Highest TTL probed"},
+		{Name: "probes_per_hop", Type: "integer", Description: "Probes sent per TTL"},
+		{Name: "reached", Type: "boolean", Description: "The target answered"},
+		{Name: "hop_count", Type: "integer", Description: "Hops probed; the path length when reached"},
+		{Name: "rtt_avg_ms", Type: "number", Description: "Mean round trip time to the target, when reached"},
+		{Name: "hops", Type: "[]TraceHop", Description: "Per TTL, with its probes: seq, status (ttl_exceeded, reply, port_unreachable, unreachable or timeout), rtt_ms and from"},
+		{Name: "duration_sec", Type: "number", Description: "Total time of the test in seconds"},
+	}},
+	{Name: "OwampResponse", Description: "Data of a POST /owamp/client/run response", Fields: []apiField{
+		{Name: "id", Type: "string", Description: "Result ID for GET /results/{id} and diffs"},
+		{Name: "profile", Type: "string", Description: "Name of the profile applied to the request, if any"},
+		{Name: "lock", Type: "LockInfo", Description: "Coordination lock the test ran under: resources, coordinator and waited_ms"},
+		{Name: "callback", Type: "WebhookCallback", Description: "With callback_url: url and delivery_id for GET /webhooks/deliveries/{id}"},
+		{Name: "server", Type: "string", Description: "owampd hostname"},
+		{Name: "port", Type: "integer", Description: "OWAMP control port"},
+		{Name: "dial", Type: "DialReport", Description: "The control connection made the way other tests dial, with nat64 and ipv4_address when translated"},
+		{Name: "source", Type: "SourceBinding", Description: "With source_address, interface or netns: the address, interface and namespace the test was bound to"},
+		{Name: "local_endpoint", Type: "string", Description: "Address the test packets were sent from"},
+		{Name: "remote_endpoint", Type: "string", Description: "Address the server received them on"},
+		{Name: "dscp", Type: "integer", Description: "DSCP the test packets were sent with"},
+		{Name: "padding", Type: "integer", Description: "Padding bytes of the test packets"},
+		{Name: "interval_sec", Type: "number", Description: "Time between packets in seconds"},
+		{Name: "sent", Type: "integer", Description: "Test packets sent"},
+		{Name: "received", Type: "integer", Description: "Distinct packets the server received within the 2 second loss timeout"},
+		{Name: "lost", Type: "integer", Description: "Packets the server did not receive in time"},
+		{Name: "loss_percent", Type: "number", Description: "One-way loss in percent"},
+		{Name: "duplicates", Type: "integer", Description: "Extra copies of packets already received"},
+		{Name: "reordered", Type: "integer", Description: "Packets received after one with a higher sequence number"},
+		{Name: "reordered_percent", Type: "number", Description: "Share of the received packets that arrived reordered"},
+		{Name: "reordering", Type: "Reordering", Description: "Reordering distances, as in TWAMP loss mode"},
+		{Name: "loss_bursts", Type: "LossBursts", Description: "Runs of consecutive lost packets and the Gilbert-Elliott model fitted to them"},
+		{Name: "delay_min_ms", Type: "number", Description: "Lowest one-way delay, receive time less send time"},
+		{Name: "delay_avg_ms", Type: "number", Description: "Mean one-way delay"},
+		{Name: "delay_max_ms", Type: "number", Description: "Highest one-way delay"},
+		{Name: "delay_stddev_ms", Type: "number", Description: "Standard deviation of the one-way delays"},
+		{Name: "percentiles_ms", Type: "Percentiles", Description: "p50, p90, p95, p99 and p99_9 of the one-way delays"},
+		{Name: "jitter_ms", Type: "number", Description: "Mean absolute delay variation between consecutive packets (RFC 3393 IPDV)"},
+		{Name: "ipdv_ms", Type: "map[string]number", Description: "Lowest and highest delay variation between consecutive packets (min, max)"},
+		{Name: "hops", Type: "map[string]integer", Description: "Forward hops from the TTL the server received the packets with (min, max)"},
+		{Name: "sync_status", Type: "OwampSyncStatus", Description: "Clock sync status (sender_synced, receiver_synced, both_synced); the delays are true one-way delays when both_synced"},
+		{Name: "finished", Type: "boolean", Description: "The server reported the session complete"},
+		{Name: "duration_sec", Type: "number", Description: "Total time of the test in seconds"},
+	}},
+	{Name: "TLSResponse", Description: "Data of a POST /tls/client/run response", Fields: []apiField{
+		{Name: "id", Type: "string", Description: "Result ID for GET /results/{id} and diffs"},
+		{Name: "profile", Type: "string", Description: "Name of the profile applied to the request, if any"},
+		{Name: "lock", Type: "LockInfo", Description: "Coordination lock the test ran under: resources, coordinator and waited_ms"},
+		{Name: "callback", Type: "WebhookCallback", Description: "With callback_url: url and delivery_id for GET /webhooks/deliveries/{id}"},
+		{Name: "server", Type: "string", Description: "Target hostname"},
+		{Name: "port", Type: "integer", Description: "TCP port of the TLS server"},
+		{Name: "server_name", Type: "string", Description: "Name sent as SNI"},
+		{Name: "dial", Type: "DialReport", Description: "Family, address and connect time of the connection, with every attempt made"},
+		{Name: "version", Type: "string", Description: "Negotiated TLS version, e.g. TLS 1.3"},
+		{Name: "cipher_suite", Type: "string", Description: "Negotiated cipher suite"},
+		{Name: "alpn", Type: "string", Description: "Protocol the server selected with ALPN, empty if it selected none"},
+		{Name: "alpn_offered", Type: "[]string", Description: "Protocols offered"},
+		{Name: "timings", Type: "TLSTimings", Description: "Name lookup, TCP connect and TLS handshake times"},
+		{Name: "tls", Type: "TLSReport", Description: "Certificate check: verified, verify_error, trust_anchor, days_to_expiry, chain with subject, issuer, SANs and expiry, and stapled ocsp status"},
+		{Name: "versions", Type: "[]TLSVersionProbe", Description: "With tls_versions: the handshake pinned to each version, in the order requested"},
+		{Name: "duration_sec", Type: "number", Description: "Total time of the test in seconds"},
+	}},
+	{Name: "NDT7Response", Description: "Data of a POST /ndt7/client/run response", Fields: []apiField{
+		{Name: "id", Type: "string", Description: "Result ID for GET /results/{id} and diffs"},
+		{Name: "profile", Type: "string", Description: "Name of the profile applied to the request, if any"},
+		{Name: "lock", Type: "LockInfo", Description: "Coordination lock the test ran under: resources, coordinator and waited_ms"},
+		{Name: "callback", Type: "WebhookCallback", Description: "With callback_url: url and delivery_id for GET /webhooks/deliveries/{id}"},
+		{Name: "server", Type: "string", Description: "ndt-server hostname"},
+		{Name: "port", Type: "integer", Description: "Port of the ndt-server"},
+		{Name: "protocol", Type: "string", Description: "wss or ws"},
+		{Name: "direction", Type: "string", Description: "download, upload or both"},
+		{Name: "located", Type: "NDT7Server", Description: "Without server_host: the M-Lab machine the Locate API chose, with its city and country"},
+		{Name: "dial", Type: "DialReport", Description: "Family, address and connect time of the first connection, with every attempt made"},
+		{Name: "tls", Type: "TLSReport", Description: "Certificate check of the first connection (wss only): verified, verify_error, trust_anchor, days_to_expiry and chain"},
+		{Name: "download", Type: "NDT7Result", Description: "Throughput the agent received, with the server's min RTT and retransmissions"},
+		{Name: "upload", Type: "NDT7Result", Description: "Throughput the server received, with its min RTT"},
+		{Name: "duration_sec", Type: "number", Description: "Total time of the test in seconds"},
+	}},
+
+	{Name: "BufferbloatResponse", Description: "Data of a POST /bufferbloat/client/run response", Fields: []apiField{
+		{Name: "id", Type: "string", Description: "Result ID for GET /results/{id} and diffs"},
+		{Name: "profile", Type: "string", Description: "Name of the profile applied to the request, if any"},
+		{Name: "lock", Type: "LockInfo", Description: "Coordination lock the test ran under: resources, coordinator and waited_ms"},
+		{Name: "callback", Type: "WebhookCallback", Description: "With callback_url: url and delivery_id for GET /webhooks/deliveries/{id}"},
+		{Name: "server", Type: "string", Description: "iperf3 server hostname"},
+		{Name: "port", Type: "integer", Description: "iperf3 server port"},
+		{Name: "direction", Type: "string", Description: "download, upload or both"},
+		{Name: "parallel", Type: "integer", Description: "TCP streams of each load"},
+		{Name: "bandwidth", Type: "number", Description: "Pacing limit of each load in Mbit/s, 0 for none"},
+		{Name: "probe", Type: "BufferbloatProbe", Description: "The probes: type, host, port, ping protocol and socket, interval, and the TWAMP-Control dial"},
+		{Name: "dial", Type: "DialReport", Description: "Family, address and connect time of the first iperf3 control connection"},
+		{Name: "idle", Type: "BufferbloatLatency", Description: "Latency of the probes sent before the first load"},
+		{Name: "download", Type: "BufferbloatLoad", Description: "The download load and the latency under it"},
+		{Name: "upload", Type: "BufferbloatLoad", Description: "The upload load and the latency under it"},
+		{Name: "latency_increase_ms", Type: "number", Description: "Largest median RTT increase of the loads over the idle median"},
+		{Name: "grade", Type: "string", Description: "Worst grade of the loads: A+, A, B, C, D or F"},
+		{Name: "duration_sec", Type: "number", Description: "Total time of the test in seconds"},
+	}},
+
+	{Name: "RPMResponse", Description: "Data of a POST /rpm/client/run response", Fields: []apiField{
+		{Name: "id", Type: "string", Description: "Result ID for GET /results/{id} and diffs"},
+		{Name: "profile", Type: "string", Description: "Name of the profile applied to the request, if any"},
+		{Name: "lock", Type: "LockInfo", Description: "Coordination lock the test ran under: resources, coordinator and waited_ms"},
+		{Name: "callback", Type: "WebhookCallback", Description: "With callback_url: url and delivery_id for GET /webhooks/deliveries/{id}"},
+		{Name: "config_url", Type: "string", Description: "The networkQuality configuration the URLs came from"},
+		{Name: "server", Type: "string", Description: "Host of the large download URL, or the configuration's test_endpoint"},
+		{Name: "port", Type: "integer"},
+		{Name: "direction", Type: "string", Description: "download, upload or both"},
+		{Name: "rpm", Type: "number", Description: "Round trips per minute under working conditions, from the trimmed means of the probes"},
+		{Name: "saturated", Type: "boolean", Description: "Whether the goodput stopped growing before half the duration"},
+		{Name: "working_after_sec", Type: "number", Description: "When the probes started, since the load did"},
+		{Name: "foreign", Type: "RPMProbes", Description: "Probes on fresh connections: TCP connect, TLS handshake and a small GET"},
+		{Name: "self", Type: "RPMProbes", Description: "Small GETs on the load-generating connections"},
+		{Name: "download", Type: "RPMLoad", Description: "The download load under working conditions"},
+		{Name: "upload", Type: "RPMLoad", Description: "The upload load under working conditions"},
+		{Name: "dial", Type: "DialReport", Description: "Family, address and connect time of the first load-generating connection"},
+		{Name: "tls", Type: "TLSReport", Description: "Certificate check of the first connection: verified, verify_error, trust_anchor, days_to_expiry and chain"},
+		{Name: "duration_sec", Type: "number", Description: "Total time of the test in seconds"},
+	}},
+
+	{Name: "TCPConnectResponse", Description: "Data of a POST /tcp/connect/run response", Fields: []apiField{
+		{Name: "id", Type: "string", Description: "Result ID for GET /results/{id} and diffs"},
+		{Name: "profile", Type: "string", Description: "Name of the profile applied to the request, if any"},
+		{Name: "callback", Type: "WebhookCallback", Description: "With callback_url: url and delivery_id for GET /webhooks/deliveries/{id}"},
+		{Name: "server", Type: "string", Description: "The host all targets share; left out when they name several"},
+		{Name: "targets", Type: "integer", Description: "Targets tried"},
+		{Name: "reachable", Type: "integer", Description: "Targets that accepted the connect"},
+		{Name: "unreachable", Type: "integer", Description: "Targets that did not"},
+		{Name: "reachable_percent", Type: "number"},
+		{Name: "parallel", Type: "integer"},
+		{Name: "connect_timeout", Type: "number", Description: "Seconds per connect"},
+		{Name: "results", Type: "[]TCPConnectResult", Description: "One per target, in the order of targets"},
+		{Name: "duration_sec", Type: "number", Description: "Total time of the test in seconds"},
+	}},
+
+	{Name: "HTTPResponse", Description: "Data of a POST /http/client/run response", Fields: []apiField{
+		{Name: "id", Type: "string", Description: "Result ID for GET /results/{id} and diffs"},
+		{Name: "profile", Type: "string", Description: "Name of the profile applied to the request, if any"},
+		{Name: "lock", Type: "LockInfo", Description: "Coordination lock the test ran under: resources, coordinator and waited_ms"},
+		{Name: "callback", Type: "WebhookCallback", Description: "With callback_url: url and delivery_id for GET /webhooks/deliveries/{id}"},
+		{Name: "server", Type: "string", Description: "Host of the URL"},
+		{Name: "port", Type: "integer", Description: "Port of the URL, or the scheme's default"},
+		{Name: "url", Type: "string", Description: "URL requested, with any password masked"},
+		{Name: "direction", Type: "string", Description: "download or upload"},
+		{Name: "protocol", Type: "string", Description: "HTTP version of the response: HTTP/1.1 or HTTP/2.0"},
+		{Name: "status_code", Type: "integer", Description: "HTTP status"},
+		{Name: "address", Type: "string", Description: "Address the connection went to"},
+		{Name: "family", Type: "string", Description: "ipv4 or ipv6"},
+		{Name: "bytes", Type: "integer", Description: "Body bytes transferred"},
+		{Name: "truncated", Type: "boolean", Description: "The download stopped at size before the end of the body"},
+		{Name: "goodput_mbps", Type: "number", Description: "Body bytes over the transfer phase in Mbit/s"},
+		{Name: "duration_sec", Type: "number", Description: "Total time of the test in seconds"},
+		{Name: "timings", Type: "HTTPTimings", Description: "Phases in ms from httptrace: dns_ms, connect_ms, tls_ms, request_ms, server_ms, ttfb_ms, transfer_ms and total_ms"},
+		{Name: "tls_version", Type: "string", Description: "Negotiated TLS version (https only)"},
+		{Name: "tls", Type: "TLSReport", Description: "Certificate check (https only): version, cipher_suite, verified, verify_error, trust_anchor, days_to_expiry, chain and stapled ocsp status"},
+	}},
+
+	// Other bodies and responses, and the objects nested in them
+	{Name: "AdaptiveResult", Description: "Summarises the rate search", Fields: []apiField{
+		{Name: "sustainable_mbps", Type: "number", Description: "Highest target rate within max_loss (0 if none)"},
+		{Name: "achieved_mbps", Type: "number", Description: "Rate the trial at sustainable_mbps delivered"},
+		{Name: "step_mbps", Type: "number", Description: "Ramp mode: rate added between trials"},
+		{Name: "max_loss_percent", Type: "number"},
+		{Name: "limit_mbps", Type: "number", Description: "API key or profile max_bandwidth no trial went above"},
+		{Name: "converged", Type: "boolean", Description: "Adaptive mode: the bracket narrowed to 5% or a trial at limit_mbps stayed within max_loss; ramp mode: a trial exceeded max_loss or one at limit_mbps stayed within it"},
+		{Name: "trials", Type: "[]AdaptiveTrial"},
+		{Name: "error", Type: "string", Description: "Set when a later trial failed and the search stopped early"},
+	}},
+	{Name: "AdaptiveTrial", Description: "One fixed-rate iperf3 run within an adaptive test", Fields: []apiField{
+		{Name: "target_mbps", Type: "number"},
+		{Name: "achieved_mbps", Type: "number"},
+		{Name: "loss_percent", Type: "number"},
+		{Name: "jitter_ms", Type: "number"},
+		{Name: "within_target", Type: "boolean"},
+	}},
+	{Name: "Aggregate", Description: "Data of GET /results/aggregate", Fields: []apiField{
+		{Name: "target", Type: "string", Description: "target filter, empty for all"},
+		{Name: "window", Type: "string", Description: "Look-back window, as a Go duration"},
+		{Name: "from", Type: "date-time", Description: "Window start"},
+		{Name: "to", Type: "date-time", Description: "Window end"},
+		{Name: "runs", Type: "integer", Description: "Number of runs in the window"},
+		{Name: "types", Type: "map[string]TypeAggregate", Description: "Per test type"},
+	}},
+	{Name: "Alert", Description: "The alert of a schedule: thresholds its results are checked against, and where notices go", Fields: []apiField{
+		{Name: "thresholds", Type: "[]AlertThreshold", Required: true, Description: "A run breaches the alert when it breaches any of them (at most 20)"},
+		{Name: "consecutive", Type: "integer", Description: "Breaching runs in a row that fire the alert (default: 3, max 100)"},
+		{Name: "recover_after", Type: "integer", Description: "Runs in a row within the thresholds that resolve a firing alert (default: 1, max 100)"},
+		{Name: "ignore_failures", Type: "boolean", Description: "Leave failed runs out; by default a failed run breaches the alert"},
+		{Name: "notify", Type: "[]AlertNotify", Required: true, Description: "Where the firing and resolved notices go (at most 10)"},
+	}},
+	{Name: "AlertBreach", Description: "A threshold one run breached, or the error of a failed run", Fields: []apiField{
+		{Name: "metric", Type: "string"},
+		{Name: "value", Type: "number", Description: "Of the metric in the run's result"},
+		{Name: "above", Type: "number"},
+		{Name: "below", Type: "number"},
+		{Name: "error", Type: "string", Description: "Set when the run failed"},
+	}},
+	{Name: "AlertNotice", Description: "The firing or resolved notice of an alert", Fields: []apiField{
+		{Name: "schedule_id", Type: "string"},
+		{Name: "type", Type: "string", Description: "Test type of the schedule"},
+		{Name: "target", Type: "string"},
+		{Name: "state", Type: "string", Description: "firing or ok"},
+		{Name: "since", Type: "date-time", Description: "When the alert fired"},
+		{Name: "resolved_at", Type: "date-time", Description: "Resolved notices only"},
+		{Name: "runs", Type: "integer", Description: "Runs in a row that fired or resolved the alert"},
+		{Name: "breaches", Type: "[]AlertBreach", Description: "Of the last run that breached the alert"},
+		{Name: "result_id", Type: "string", Description: "Stored result of the run that fired or resolved the alert; omitted for a failed run"},
+	}},
+	{Name: "AlertNotify", Description: "Where the notices of an alert go", Fields: []apiField{
+		{Name: "type", Type: "string", Required: true, Description: "webhook (AlertPayload), slack (a Slack-compatible {\"text\": ...} payload) or email (needs ALERT_SMTP_ADDR)"},
+		{Name: "url", Type: "string", Description: "Webhook or Slack incoming webhook URL"},
+		{Name: "to", Type: "[]string", Description: "Recipients of email"},
+	}},
+	{Name: "AlertPayload", Description: "The JSON body POSTed to webhook notify targets of alerts", Fields: []apiField{
+		{Name: "event", Type: "string", Description: "alert.firing or alert.resolved"},
+		{Name: "delivery_id", Type: "string"},
+		{Name: "alert", Type: "AlertNotice"},
+	}},
+	{Name: "AlertState", Description: "Where the alert of a schedule stands", Fields: []apiField{
+		{Name: "state", Type: "string", Description: "ok or firing"},
+		{Name: "since", Type: "date-time", Description: "When a firing alert fired"},
+		{Name: "breaching_runs", Type: "integer", Description: "Runs in a row that breached the alert"},
+		{Name: "recovered_runs", Type: "integer", Description: "Runs in a row within the thresholds while firing"},
+		{Name: "last_breaches", Type: "[]AlertBreach", Description: "Of the last run that breached the alert"},
+		{Name: "notifications", Type: "integer", Description: "Firing and resolved notices sent"},
+	}},
+	{Name: "AlertThreshold", Description: "Bounds of one metric of a result; set above, below or both", Fields: []apiField{
+		{Name: "metric", Type: "string", Required: true, Description: "A metric of the test type as result diffs compare it, e.g. rtt_avg_ms or percentiles_ms.rtt.p95"},
+		{Name: "above", Type: "number", Description: "Values above this breach it"},
+		{Name: "below", Type: "number", Description: "Values below this breach it"},
+	}},
+	{Name: "AvailableResult", Description: "The outcome of an available mode TWAMP run", Fields: []apiField{
+		{Name: "capacity_mbps", Type: "number", Description: "Forward capacity from packet pairs"},
+		{Name: "baseline_rtt_ms", Type: "number", Description: "Lowest RTT of the idle packet pairs"},
+		{Name: "available_mbps", Type: "number", Description: "Middle of the final range"},
+		{Name: "available_low_mbps", Type: "number"},
+		{Name: "available_high_mbps", Type: "number"},
+		{Name: "grey_low_mbps", Type: "number", Description: "Rates with inconclusive trends"},
+		{Name: "grey_high_mbps", Type: "number"},
+		{Name: "headroom_percent", Type: "number", Description: "Available bandwidth as a share of the capacity"},
+		{Name: "utilization_percent", Type: "number"},
+		{Name: "max_rate_mbps", Type: "number", Description: "Upper end of the search: the capacity, or bandwidth if lower"},
+		{Name: "stream_length", Type: "integer"},
+		{Name: "packet_bytes", Type: "integer"},
+		{Name: "streams", Type: "[]AvailableStream"},
+		{Name: "sender_limited", Type: "boolean", Description: "Some stream left well below its target rate"},
+		{Name: "duration_sec", Type: "number"},
+	}},
+	{Name: "AvailableStream", Description: "One probe stream of the search", Fields: []apiField{
+		{Name: "rate_mbps", Type: "number", Description: "Target rate"},
+		{Name: "achieved_mbps", Type: "number", Description: "Rate the probes actually left at"},
+		{Name: "loss_percent", Type: "number"},
+		{Name: "pct", Type: "number"},
+		{Name: "pdt", Type: "number"},
+		{Name: "owd_increase_ms", Type: "number", Description: "Median one-way delay of the last group minus the first"},
+		{Name: "trend", Type: "string"},
+	}},
+	{Name: "BaselineComparison", Description: "Data of GET /results/compare", Fields: []apiField{
+		{Name: "result", Type: "ResultRef", Description: "The result compared: the one named by id, or the latest of the target"},
+		{Name: "window", Type: "string", Description: "Baseline window, as a Go duration"},
+		{Name: "from", Type: "date-time", Description: "Baseline window start"},
+		{Name: "to", Type: "date-time", Description: "Baseline window end, the time of the result"},
+		{Name: "baseline_runs", Type: "integer", Description: "Earlier results of the same target and type in the window"},
+		{Name: "sigma", Type: "number", Description: "Standard deviations from the median that make a change significant"},
+		{Name: "threshold_percent", Type: "number", Description: "Change from the median that makes it significant as well"},
+		{Name: "metrics", Type: "[]BaselineMetric"},
+		{Name: "summary", Type: "ResultDiffSummary", Description: "Counts of significant regressions, improvements and other changes"},
+		{Name: "regressed", Type: "boolean", Description: "Whether some metric regressed significantly"},
+	}},
+	{Name: "BaselineMetric", Description: "Compares one metric of a result against its baseline", Fields: []apiField{
+		{Name: "metric", Type: "string"},
+		{Name: "better", Type: "string", Description: "higher or lower; omitted when neither is better"},
+		{Name: "value", Type: "number", Description: "Of the compared result"},
+		{Name: "runs", Type: "integer", Description: "Baseline results with this metric"},
+		{Name: "median", Type: "number", Description: "Of the baseline; null without one"},
+		{Name: "stddev", Type: "number", Description: "Population standard deviation of the baseline"},
+		{Name: "delta", Type: "number", Description: "Value minus median"},
+		{Name: "delta_percent", Type: "number", Description: "Omitted when the median is 0"},
+		{Name: "score", Type: "number", Description: "Delta in standard deviations; omitted when the baseline does not vary"},
+		{Name: "change", Type: "string", Description: "improved, regressed or changed when significant, normal when not, insufficient with fewer than 5 baseline runs"},
+		{Name: "significant", Type: "boolean"},
+	}},
+	{Name: "BufferbloatLatency", Description: "RTT of the probes sent within one window of a bufferbloat test", Fields: []apiField{
+		{Name: "start_sec", Type: "number", Description: "Start of the window since the first probe"},
+		{Name: "end_sec", Type: "number"},
+		{Name: "sent", Type: "integer"},
+		{Name: "received", Type: "integer", Description: "Probes answered within 2 seconds"},
+		{Name: "loss_percent", Type: "number"},
+		{Name: "rtt_min_ms", Type: "number"},
+		{Name: "rtt_avg_ms", Type: "number"},
+		{Name: "rtt_max_ms", Type: "number"},
+		{Name: "rtt_stddev_ms", Type: "number"},
+		{Name: "percentiles_ms", Type: "Percentiles", Description: "p50, p90, p95, p99 and p99_9 of the RTTs; omitted when no probe was answered"},
+	}},
+	{Name: "BufferbloatLoad", Description: "One iperf3 load of a bufferbloat test and the latency under it", Fields: []apiField{
+		{Name: "throughput_mbps", Type: "number"},
+		{Name: "retransmits", Type: "integer", Description: "TCP retransmits of the load's streams"},
+		{Name: "duration_sec", Type: "number"},
+		{Name: "latency", Type: "BufferbloatLatency", Description: "Of the probes sent under load, after the first 2 seconds"},
+		{Name: "latency_increase_ms", Type: "number", Description: "Median RTT under load less the idle median; omitted when no probe was answered under load"},
+		{Name: "p95_increase_ms", Type: "number", Description: "The same of the 95th percentiles"},
+		{Name: "grade", Type: "string", Description: "A+ (below 5 ms), A (30), B (60), C (200), D (400) or F; F as well when no probe was answered"},
+	}},
+	{Name: "BufferbloatProbe", Description: "The latency probes of a bufferbloat test", Fields: []apiField{
+		{Name: "type", Type: "string", Description: "twamp or ping"},
+		{Name: "host", Type: "string"},
+		{Name: "address", Type: "string", Description: "Ping only: the address the host resolved to"},
+		{Name: "port", Type: "integer", Description: "TWAMP-Control port, or the UDP port of UDP pings"},
+		{Name: "protocol", Type: "string", Description: "Ping only: icmp or udp"},
+		{Name: "socket", Type: "string", Description: "Ping only: raw, datagram or udp"},
+		{Name: "interval_sec", Type: "number"},
+		{Name: "dial", Type: "DialReport", Description: "TWAMP only: the control connection"},
+	}},
+	{Name: "CapacityEstimate", Description: "Summarizes the per-train capacity samples of one direction", Fields: []apiField{
+		{Name: "capacity_mbps", Type: "number", Description: "Mode of the samples"},
+		{Name: "median_mbps", Type: "number"},
+		{Name: "p25_mbps", Type: "number"},
+		{Name: "p75_mbps", Type: "number"},
+		{Name: "mode_samples", Type: "integer", Description: "Samples in the modal bin"},
+	}},
+	{Name: "CapacityResult", Description: "The outcome of a capacity mode TWAMP run", Fields: []apiField{
+		{Name: "trains", Type: "integer"},
+		{Name: "train_length", Type: "integer"},
+		{Name: "packet_bytes", Type: "integer", Description: "IP packet size the dispersion is computed with"},
+		{Name: "valid_trains", Type: "integer", Description: "Complete, in order and with increasing timestamps"},
+		{Name: "forward", Type: "CapacityEstimate", Description: "From the reflector's receive timestamps"},
+		{Name: "round_trip", Type: "CapacityEstimate", Description: "From local reply arrival, the narrower of both directions"},
+		{Name: "min_rtt_ms", Type: "number", Description: "Lowest RTT of a train's first probe, sent into an idle path"},
+		{Name: "send_dispersion_us", Type: "number", Description: "Median time to put one train on the wire"},
+		{Name: "sender_limited", Type: "boolean", Description: "Capacity may be higher than measured"},
+		{Name: "duration_sec", Type: "number"},
+	}},
+	{Name: "ConfigEntry", Description: "A setting as GET /config reports it", Fields: []apiField{
+		{Name: "name", Type: "string", Description: "Environment variable"},
+		{Name: "value", Type: "string", Description: "Omitted when unset; secrets are redacted"},
+		{Name: "source", Type: "string", Description: "env, file or default"},
+		{Name: "secret", Type: "boolean", Description: "Whether value is redacted"},
+	}},
+	{Name: "ConfigReport", Description: "The effective configuration", Fields: []apiField{
+		{Name: "file", Type: "string", Description: "CONFIG_FILE"},
+		{Name: "settings", Type: "[]ConfigEntry"},
+	}},
+	{Name: "Delivery", Description: "Tracks one event sent to one callback URL", Fields: []apiField{
+		{Name: "id", Type: "string"},
+		{Name: "url", Type: "string"},
+		{Name: "event", Type: "string", Description: "result.created, alert.firing, alert.resolved, esmond.archive or influx.write"},
+		{Name: "result_id", Type: "string", Description: "Result delivered, or of the run an alert notice is about"},
+		{Name: "schedule_id", Type: "string", Description: "Alert notices only: the schedule of the alert"},
+		{Name: "status", Type: "string"},
+		{Name: "attempts", Type: "[]DeliveryAttempt"},
+		{Name: "next_attempt", Type: "date-time"},
+		{Name: "created_at", Type: "date-time"},
+		{Name: "delivered_at", Type: "date-time"},
+	}},
+	{Name: "DeliveryAttempt", Description: "One POST of a webhook payload", Fields: []apiField{
+		{Name: "at", Type: "date-time"},
+		{Name: "status_code", Type: "integer"},
+		{Name: "error", Type: "string"},
+		{Name: "duration_ms", Type: "number"},
+	}},
+	{Name: "DialAttempt", Description: "One connection attempt made while dialing a control connection", Fields: []apiField{
+		{Name: "family", Type: "string"},
+		{Name: "address", Type: "string"},
+		{Name: "connect_ms", Type: "number", Description: "Time to connect or fail (omitted when canceled)"},
+		{Name: "error", Type: "string"},
+		{Name: "won", Type: "boolean"},
+	}},
+	{Name: "DialReport", Description: "Describes how a control connection was established", Fields: []apiField{
+		{Name: "mode", Type: "string", Description: "Requested address_family"},
+		{Name: "family", Type: "string", Description: "Winning family (ipv4 or ipv6)"},
+		{Name: "address", Type: "string"},
+		{Name: "resolve_ms", Type: "number", Description: "Name resolution before the first attempt"},
+		{Name: "connect_ms", Type: "number"},
+		{Name: "attempts", Type: "[]DialAttempt"},
+		{Name: "nat64", Type: "boolean", Description: "Address lies in a NAT64 prefix: the target is reached over IPv4 through a translator"},
+		{Name: "ipv4_address", Type: "string", Description: "The IPv4 address it translates to"},
+	}},
+	{Name: "EchoServerConfig", Description: "The body of POST /echo/server/start", Fields: []apiField{
+		{Name: "address", Type: "string", Description: "Address to listen on (default: all)"},
+		{Name: "port", Type: "integer", Default: "7", Description: "UDP port"},
+	}},
+	{Name: "EchoServerStatus", Description: "The state of the UDP echo responder in GET /echo/server", Fields: []apiField{
+		{Name: "running", Type: "boolean"},
+		{Name: "listen", Type: "string"},
+		{Name: "config", Type: "EchoServerConfig"},
+		{Name: "started_at", Type: "date-time"},
+		{Name: "stopped_at", Type: "date-time"},
+		{Name: "last_packet_at", Type: "date-time"},
+		{Name: "packets_echoed", Type: "integer"},
+		{Name: "packets_discarded", Type: "integer", Description: "Datagrams that were not echo probe requests, replies included, so two responders never bounce packets between them"},
+	}},
+	{Name: "Error", Description: "Response of a failed request", Fields: []apiField{
+		{Name: "status", Type: "string", Required: true, Description: "error"},
+		{Name: "error", Type: "string", Required: true, Description: "What went wrong"},
+		{Name: "code", Type: "string", Description: "ERR_VALIDATION, ERR_UNREACHABLE, ERR_AUTH_FAILED, ERR_CANCELED, ERR_TIMEOUT, ERR_BUSY, ERR_RATE_LIMITED, ERR_QUOTA_EXCEEDED or ERR_SHUTTING_DOWN, where the cause is known"},
+		{Name: "data", Description: "Details of some errors, e.g. the conflicting lease of POST /locks, or {\"fields\": [FieldError]} with ERR_VALIDATION"},
+		{Name: "request_id", Type: "string", Description: "As in the X-Request-Id response header, to find the request's log lines"},
+	}},
+	{Name: "FieldError", Description: "One invalid field of a request", Fields: []apiField{
+		{Name: "field", Type: "string", Required: true, Description: "JSON name, e.g. stun_servers[1]"},
+		{Name: "value", Description: "The value sent, left out for missing fields"},
+		{Name: "message", Type: "string", Required: true, Description: "What is wrong with it, e.g. must be between 1 and 128"},
+	}},
+	{Name: "FlentData", Description: "A Flent data file (.flent)", Fields: []apiField{
+		{Name: "metadata", Type: "map[string]"},
+		{Name: "version", Type: "integer"},
+		{Name: "x_values", Type: "[]number"},
+		{Name: "results", Type: "map[string][]*number", Description: "Aligned to x_values, null where no sample"},
+		{Name: "raw_values", Type: "map[string][]FlentRawValue"},
+	}},
+	{Name: "FlentRawValue", Description: "One sample in a Flent raw_values series", Fields: []apiField{
+		{Name: "t", Type: "number", Description: "Unix time in seconds"},
+		{Name: "val", Type: "number"},
+	}},
+	{Name: "GilbertElliott", Description: "The two-state loss model fitted to a loss pattern by the burst and gap split of RFC 3611: a burst runs from a loss to a loss with fewer than 16 probes received between any two and holds at least two losses; the rest is gap", Fields: []apiField{
+		{Name: "p", Type: "number", Description: "Per probe probability of moving from the good (gap) to the bad (burst) state"},
+		{Name: "r", Type: "number", Description: "Per probe probability of moving from the bad to the good state"},
+		{Name: "loss_good", Type: "number", Description: "Loss probability in the good state, the gap density"},
+		{Name: "loss_bad", Type: "number", Description: "Loss probability in the bad state, the burst density"},
+		{Name: "bursts", Type: "integer", Description: "Bursts found"},
+	}},
+	{Name: "Histogram", Description: "A sparse fixed-width histogram: only buckets holding samples are listed, in ascending order", Fields: []apiField{
+		{Name: "bucket_width", Type: "number"},
+		{Name: "buckets", Type: "[]HistogramBucket"},
+	}},
+	{Name: "HistogramBucket", Description: "Counts the samples from lower up to lower plus the bucket width", Fields: []apiField{
+		{Name: "lower", Type: "number"},
+		{Name: "count", Type: "integer"},
+	}},
+	{Name: "Impairment", Description: "A netem qdisc applied to an interface by this agent", Fields: []apiField{
+		{Name: "interface", Type: "string"},
+		{Name: "delay_ms", Type: "number"},
+		{Name: "jitter_ms", Type: "number"},
+		{Name: "loss_percent", Type: "number"},
+		{Name: "rate_mbit", Type: "number", Description: "0 leaves the rate unlimited"},
+		{Name: "duration_sec", Type: "integer", Default: "300", Description: "Cleared automatically after this"},
+		{Name: "applied_at", Type: "date-time"},
+		{Name: "expires_at", Type: "date-time"},
+		{Name: "command", Type: "string"},
+	}},
+	{Name: "ImpairmentRequest", Description: "Body of PUT /admin/impairments/{interface}", Fields: []apiField{
+		{Name: "delay_ms", Type: "number", Description: "Added delay (max 5000)"},
+		{Name: "jitter_ms", Type: "number", Description: "Delay variation, at most delay_ms"},
+		{Name: "loss_percent", Type: "number", Description: "Random packet loss (0-100)"},
+		{Name: "rate_mbit", Type: "number", Description: "Rate limit in Mbit/s (0.1-10000, 0 for none)"},
+		{Name: "duration_sec", Type: "integer", Default: "300", Description: "Seconds until the impairment clears itself (max 3600)"},
+	}},
+	{Name: "Iperf3Interval", Description: "One reporting interval of an iperf3 test, like the intervals of iperf3's JSON output", Fields: []apiField{
+		{Name: "start", Type: "number", Description: "Seconds from the start of data transfer"},
+		{Name: "end", Type: "number"},
+		{Name: "bytes", Type: "integer"},
+		{Name: "bandwidth_mbps", Type: "number"},
+		{Name: "retransmits", Type: "integer", Description: "TCP uploads, from TCP_INFO"},
+		{Name: "streams", Type: "[]Iperf3IntervalStream", Description: "Per stream, with parallel streams"},
+		{Name: "omitted", Type: "boolean", Description: "Within the omit period, left out of the results"},
+	}},
+	{Name: "Iperf3IntervalStream", Description: "One stream's share of an interval", Fields: []apiField{
+		{Name: "bytes", Type: "integer"},
+		{Name: "bandwidth_mbps", Type: "number"},
+		{Name: "retransmits", Type: "integer"},
+	}},
+	{Name: "Iperf3ServerReport", Description: "The server's side of a test as it reported it at EXCHANGE_RESULTS: the receiver of an upload, the sender of a download", Fields: []apiField{
+		{Name: "role", Type: "string", Description: "receiver or sender"},
+		{Name: "bytes", Type: "integer"},
+		{Name: "bandwidth_mbps", Type: "number"},
+		{Name: "cpu_util_percent", Type: "number"},
+		{Name: "retransmits", Type: "integer", Description: "TCP sender that could read TCP_INFO"},
+		{Name: "packets", Type: "integer", Description: "UDP: datagrams sent, or highest sequence seen by a receiver"},
+		{Name: "lost_packets", Type: "integer", Description: "UDP receiver only, as are loss_percent and jitter_ms"},
+		{Name: "loss_percent", Type: "number"},
+		{Name: "jitter_ms", Type: "number"},
+		{Name: "streams", Type: "[]Iperf3ServerStream"},
+	}},
+	{Name: "Iperf3ServerStream", Description: "One stream of the server's report, matched to ours by iperf3 stream ID", Fields: []apiField{
+		{Name: "id", Type: "integer"},
+		{Name: "bytes", Type: "integer"},
+		{Name: "bandwidth_mbps", Type: "number"},
+		{Name: "retransmits", Type: "integer"},
+		{Name: "packets", Type: "integer"},
+		{Name: "lost_packets", Type: "integer"},
+		{Name: "jitter_ms", Type: "number"},
+	}},
+	{Name: "Iperf3Stream", Description: "One stream's totals over an iperf3 test", Fields: []apiField{
+		{Name: "id", Type: "integer", Description: "iperf3 stream ID, as in server_results"},
+		{Name: "local", Type: "string", Description: "Local address and port, the only part of the 5-tuple that differs between parallel streams"},
+		{Name: "bytes", Type: "integer"},
+		{Name: "bandwidth_mbps", Type: "number"},
+		{Name: "retransmits", Type: "integer", Description: "TCP, when known, as in stream_retransmits"},
+		{Name: "rtt_ms", Type: "number", Description: "TCP on Linux: smoothed RTT from TCP_INFO at the end of the transfer; on downloads the receiver's estimate"},
+		{Name: "rttvar_ms", Type: "number", Description: "TCP uploads on Linux: variation of rtt_ms"},
+	}},
+	{Name: "TCPInfoReport", Description: "TCP_INFO of the sending streams of an iperf3 upload over the test", Fields: []apiField{
+		{Name: "streams", Type: "[]TCPInfoStream"},
+	}},
+	{Name: "TCPInfoStream", Description: "One stream's TCP_INFO samples", Fields: []apiField{
+		{Name: "id", Type: "integer", Description: "iperf3 stream ID, as in streams"},
+		{Name: "samples", Type: "[]TCPInfoSnapshot", Description: "One per interval, including those within omit"},
+		{Name: "final", Type: "TCPInfoSnapshot", Description: "At the end of the transfer, before the streams close"},
+	}},
+	{Name: "TCPInfoSnapshot", Description: "A sending TCP stream's state as TCP_INFO reported it, the fields ss -ti shows", Fields: []apiField{
+		{Name: "t", Type: "number", Description: "Seconds from the start of data transfer"},
+		{Name: "cwnd", Type: "integer", Description: "Congestion window in segments"},
+		{Name: "ssthresh", Type: "integer", Description: "Slow start threshold in segments; absent while the stream is still in its first slow start"},
+		{Name: "mss", Type: "integer", Description: "Sender MSS in bytes"},
+		{Name: "rtt_ms", Type: "number", Description: "Smoothed RTT"},
+		{Name: "rttvar_ms", Type: "number"},
+		{Name: "min_rtt_ms", Type: "number", Description: "Lowest RTT seen (kernel 4.6 and later)"},
+		{Name: "pacing_rate_mbps", Type: "number", Description: "Rate the kernel paces the stream to; absent while unlimited"},
+		{Name: "delivery_rate_mbps", Type: "number", Description: "Most recent delivery rate estimate (kernel 4.9 and later)"},
+		{Name: "unacked", Type: "integer", Description: "Segments in flight"},
+		{Name: "bytes_retrans", Type: "integer", Description: "Bytes retransmitted so far (kernel 4.19 and later)"},
+		{Name: "retransmits", Type: "integer", Description: "Segments retransmitted so far"},
+	}},
+	{Name: "Iperf3SocketBuffers", Description: "Buffer sizes of the data streams as the kernel granted them", Fields: []apiField{
+		{Name: "requested", Type: "integer", Description: "window_size"},
+		{Name: "sndbuf_actual", Type: "integer", Description: "SO_SNDBUF"},
+		{Name: "rcvbuf_actual", Type: "integer", Description: "SO_RCVBUF"},
+		{Name: "limited", Type: "boolean", Description: "Granted less than requested, capped by net.core.wmem_max or rmem_max"},
+	}},
+	{Name: "Job", Description: "One asynchronous test run", Fields: []apiField{
+		{Name: "id", Type: "string", Description: "Job ID"},
+		{Name: "type", Type: "string", Description: "Test type"},
+		{Name: "target", Type: "string", Description: "Host tested"},
+		{Name: "state", Type: "string", Description: "running, completed, failed or canceled"},
+		{Name: "created_at", Type: "date-time"},
+		{Name: "finished_at", Type: "date-time"},
+		{Name: "elapsed_sec", Type: "number", Description: "Time since the job started, or its run time once finished"},
+		{Name: "progress", Type: "JobProgressReport", Description: "Running iperf3 and TWAMP jobs: unit (mbps or rtt_ms), samples, expected_samples, percent_complete, latest and points so far"},
+		{Name: "result_id", Type: "string", Description: "Stored result of a completed job"},
+		{Name: "result", Type: "map[string]", Description: "Response data of a completed job, as a synchronous request returns it"},
+		{Name: "error", Type: "string", Description: "Why a failed job failed, with code and the http_status a synchronous request would have returned"},
+		{Name: "code", Type: "string"},
+		{Name: "http_status", Type: "integer", Description: "Status a synchronous run would have failed with"},
+	}},
+	{Name: "JobProgressReport", Description: "Partial results of a running iperf3 or TWAMP job", Fields: []apiField{
+		{Name: "unit", Type: "string", Description: "mbps for iperf3, rtt_ms for TWAMP"},
+		{Name: "samples", Type: "integer", Description: "Per-second throughput samples or replies so far"},
+		{Name: "expected_samples", Type: "integer", Description: "Samples a complete run takes"},
+		{Name: "percent_complete", Type: "number"},
+		{Name: "latest", Type: "SeriesPoint"},
+		{Name: "points", Type: "[]SeriesPoint", Description: "All samples so far, only in GET /jobs/{id}"},
+	}},
+	{Name: "LatencyHistograms", Description: "Bins the probes of a full mode TWAMP run by delay in milliseconds, returned as data.histogram_ms", Fields: []apiField{
+		{Name: "rtt", Type: "Histogram"},
+		{Name: "forward_delay", Type: "Histogram", Description: "Raw T2-T1, shifted by the clock offset"},
+		{Name: "reverse_delay", Type: "Histogram", Description: "Raw T4-T3, shifted by the clock offset"},
+	}},
+	{Name: "LatencyPercentiles", Description: "The tail percentiles of a full mode TWAMP run in milliseconds, returned as data.percentiles_ms", Fields: []apiField{
+		{Name: "rtt", Type: "Percentiles"},
+		{Name: "forward_delay", Type: "Percentiles", Description: "Raw T2-T1: absolute values are only meaningful when both clocks are synced"},
+		{Name: "reverse_delay", Type: "Percentiles", Description: "Raw T4-T3: absolute values are only meaningful when both clocks are synced"},
+	}},
+	{Name: "Lease", Description: "A lock held on a set of resources until released or expired", Fields: []apiField{
+		{Name: "token", Type: "string", Description: "Lease token for renew and release"},
+		{Name: "holder", Type: "string"},
+		{Name: "test", Type: "string"},
+		{Name: "resources", Type: "[]string"},
+		{Name: "acquired_at", Type: "date-time"},
+		{Name: "expires_at", Type: "date-time", Description: "Expiry unless renewed"},
+	}},
+	{Name: "LimiterStatus", Description: "The data of GET /status", Fields: []apiField{
+		{Name: "max_concurrent", Type: "integer", Description: "0 for no limit"},
+		{Name: "queue_mode", Type: "string"},
+		{Name: "running", Type: "*[]TestSlot"},
+		{Name: "queued", Type: "*[]TestSlot"},
+		{Name: "draining", Type: "boolean", Description: "Whether the agent is shutting down, refusing new tests with 503 and ERR_SHUTTING_DOWN"},
+	}},
+	{Name: "LockInfo", Description: "Describes the lock a test ran under, returned as data.lock", Fields: []apiField{
+		{Name: "resources", Type: "[]string"},
+		{Name: "coordinator", Type: "string", Description: "local, or the coordinator URL"},
+		{Name: "waited_ms", Type: "number"},
+	}},
+	{Name: "LockRequest", Description: "The body of POST /locks", Fields: []apiField{
+		{Name: "resources", Type: "[]string", Required: true, Description: "Resources locked all-or-nothing"},
+		{Name: "holder", Type: "string", Required: true, Description: "Agent taking the lock (AGENT_ID)"},
+		{Name: "test", Type: "string", Description: "Description of the test, shown to waiting agents"},
+		{Name: "ttl_sec", Type: "integer", Default: "30", Description: "Lease lifetime without renewal (max 600)"},
+	}},
+	{Name: "LossBursts", Description: "Describes runs of consecutive lost probes and the loss pattern they form", Fields: []apiField{
+		{Name: "count", Type: "integer", Description: "Runs of consecutive lost probes, the loss episodes"},
+		{Name: "max_length", Type: "integer", Description: "Longest run"},
+		{Name: "mean_length", Type: "number", Description: "Lost probes per run"},
+		{Name: "burst_ratio", Type: "number", Description: "Mean run length over that of random loss at the same rate (ITU-T G.113): 1 for random loss, above 1 for bursty loss, 0 without loss or when every probe was lost"},
+		{Name: "gilbert_elliott", Type: "GilbertElliott", Description: "Two-state loss model fitted by the RFC 3611 burst and gap split"},
+	}},
+	{Name: "MTUReport", Description: "The path MTU seen by a forward UDP test, returned as data.mtu", Fields: []apiField{
+		{Name: "datagram_bytes", Type: "integer", Description: "UDP payload size the test started with"},
+		{Name: "datagram_ip_bytes", Type: "integer", Description: "Including IP and UDP headers"},
+		{Name: "clamped_datagram_bytes", Type: "integer"},
+		{Name: "frag_needed", Type: "integer", Description: "Sends refused after ICMP fragmentation-needed / packet-too-big"},
+		{Name: "route_mtu", Type: "integer"},
+		{Name: "tcp_mss", Type: "integer", Description: "Of the control connection, lowered by MSS clamping"},
+		{Name: "effective_mtu", Type: "integer"},
+		{Name: "silent_drop_suspected", Type: "boolean"},
+	}},
+	{Name: "MeshRequest", Description: "Body of POST /mesh/run", Fields: []apiField{
+		{Name: "type", Type: "string", Required: true, Description: "Test type of every test: iperf3, twamp, transfer, s3, ssh, pmtu, stun, nat64, ping, traceroute, owamp, tls, ndt7, bufferbloat, rpm or http"},
+		{Name: "targets", Type: "[]string", Required: true, Description: "The server_host of each test, or its url for transfer, http and rpm and its endpoint for s3 (at most 100)"},
+		{Name: "request", Type: "RunRequest", Description: "Template of every test: the body of the type's run endpoint without the target"},
+		{Name: "parallel", Type: "integer", Default: "4", Description: "Tests at a time (max 16)"},
+	}},
+	{Name: "MeshResponse", Description: "Data of a POST /mesh/run response", Fields: []apiField{
+		{Name: "type", Type: "string"},
+		{Name: "targets", Type: "integer", Description: "Tests run"},
+		{Name: "succeeded", Type: "integer"},
+		{Name: "failed", Type: "integer"},
+		{Name: "parallel", Type: "integer"},
+		{Name: "metrics", Type: "[]string", Description: "Columns of the matrix: the metrics of the test type any row has, in the order result diffs compare them"},
+		{Name: "results", Type: "[]MeshResult", Description: "Rows of the matrix, one per target, in the order of targets"},
+		{Name: "duration_sec", Type: "number", Description: "Total time of the run in seconds"},
+	}},
+	{Name: "MeshResult", Description: "The test of one target of a mesh run", Fields: []apiField{
+		{Name: "target", Type: "string"},
+		{Name: "status", Type: "string", Description: "ok or error"},
+		{Name: "result_id", Type: "string", Description: "Stored result of the test, for GET /results/{id}"},
+		{Name: "metrics", Type: "map[string]number", Description: "Key metrics of the result, by path"},
+		{Name: "error", Type: "string"},
+		{Name: "code", Type: "string"},
+		{Name: "http_status", Type: "integer", Description: "Status the test alone would have been answered with"},
+		{Name: "duration_sec", Type: "number"},
+	}},
+	{Name: "MetricAggregate", Description: "Summarises one metric over the runs in a window", Fields: []apiField{
+		{Name: "count", Type: "integer"},
+		{Name: "mean", Type: "number"},
+		{Name: "min", Type: "number"},
+		{Name: "max", Type: "number"},
+		{Name: "stddev", Type: "number"},
+		{Name: "mad", Type: "number", Description: "Median absolute deviation from p50"},
+		{Name: "p50", Type: "number"},
+		{Name: "p90", Type: "number"},
+		{Name: "p95", Type: "number"},
+		{Name: "p99", Type: "number"},
+	}},
+	{Name: "MetricDiff", Description: "Compares one metric between two results", Fields: []apiField{
+		{Name: "metric", Type: "string"},
+		{Name: "better", Type: "string"},
+		{Name: "base", Type: "*number"},
+		{Name: "compare", Type: "*number"},
+		{Name: "delta", Type: "number"},
+		{Name: "delta_percent", Type: "number", Description: "Omitted when the base value is 0"},
+		{Name: "change", Type: "string", Description: "improved, regressed, changed, unchanged or missing"},
+		{Name: "exceeds_threshold", Type: "boolean"},
+	}},
+	{Name: "NAT64Prefix", Description: "A translation prefix the agent's resolver synthesizes addresses with", Fields: []apiField{
+		{Name: "prefix", Type: "string"},
+		{Name: "well_known", Type: "boolean", Description: "64:ff9b::/96"},
+		{Name: "source", Type: "string", Description: "dns64 or well_known"},
+	}},
+	{Name: "NDT7Result", Description: "One direction of an NDT7 test", Fields: []apiField{
+		{Name: "throughput_mbps", Type: "number", Description: "Of the bytes the receiving end counted: the agent for downloads, the server's TCP_INFO for uploads"},
+		{Name: "bytes", Type: "integer", Description: "Received by the agent (download) or the server (upload)"},
+		{Name: "sent_bytes", Type: "integer", Description: "Upload only: message bytes the agent wrote"},
+		{Name: "duration_sec", Type: "number"},
+		{Name: "min_rtt_ms", Type: "number", Description: "Lowest RTT of the connection, from the server's TCP_INFO"},
+		{Name: "rtt_ms", Type: "number", Description: "Smoothed RTT at the last measurement"},
+		{Name: "rtt_var_ms", Type: "number"},
+		{Name: "retransmit_percent", Type: "number", Description: "Download only: bytes the server retransmitted of those it sent"},
+		{Name: "measurements", Type: "integer", Description: "Measurement messages the server sent"},
+		{Name: "client_address", Type: "string", Description: "The agent's address as the server saw it"},
+		{Name: "uuid", Type: "string", Description: "Of the connection, as M-Lab records it"},
+	}},
+	{Name: "NDT7Server", Description: "The M-Lab server the Locate API chose", Fields: []apiField{
+		{Name: "machine", Type: "string"},
+		{Name: "city", Type: "string"},
+		{Name: "country", Type: "string"},
+	}},
+	{Name: "OCSPStaple", Description: "The OCSP response the server stapled to the handshake, if any", Fields: []apiField{
+		{Name: "stapled", Type: "boolean"},
+		{Name: "status", Type: "string", Description: "good, revoked or unknown"},
+		{Name: "produced_at", Type: "date-time"},
+		{Name: "this_update", Type: "date-time"},
+		{Name: "next_update", Type: "date-time"},
+		{Name: "revoked_at", Type: "date-time"},
+		{Name: "error", Type: "string", Description: "Why the response was not usable"},
+	}},
+	{Name: "OwampSyncStatus", Description: "Clock synchronization of sender and receiver, from the error estimates of the send and receive timestamps", Fields: []apiField{
+		{Name: "sender_synced", Type: "boolean"},
+		{Name: "receiver_synced", Type: "boolean", Description: "Every receive timestamp was synchronized"},
+		{Name: "both_synced", Type: "boolean"},
+		{Name: "sender_error_estimate", Type: "TwampErrorEstimate"},
+		{Name: "receiver_error_estimate", Type: "TwampErrorEstimate", Description: "The largest of the receive timestamps"},
+	}},
+	{Name: "PMTUBottleneck", Description: "The router that reported a smaller MTU, found with DF-set echo requests of increasing TTL", Fields: []apiField{
+		{Name: "hop", Type: "integer", Description: "Hop number of the router, as traceroute counts it"},
+		{Name: "router", Type: "string", Description: "Address the fragmentation-needed / packet-too-big came from"},
+		{Name: "mtu", Type: "integer", Description: "MTU of the router's next hop, as it reported"},
+		{Name: "size", Type: "integer", Description: "Packet size the path was probed with: the smallest frag_needed size"},
+	}},
+	{Name: "PMTUProbe", Description: "The outcome of one probed packet size", Fields: []apiField{
+		{Name: "size", Type: "integer", Description: "IP packet size, headers included"},
+		{Name: "result", Type: "string"},
+		{Name: "reported_mtu", Type: "integer", Description: "MTU learned from the ICMP feedback"},
+		{Name: "from", Type: "string", Description: "Router that sent the feedback (icmp only)"},
+	}},
+	{Name: "PacingReport", Description: "How closely the sending streams of a forward iperf3 test kept to bandwidth, returned as data.pacing", Fields: []apiField{
+		{Name: "timer_us", Type: "integer", Description: "pacing_timer the token bucket waited in"},
+		{Name: "requested_mbps", Type: "number", Description: "bandwidth"},
+		{Name: "achieved_mbps", Type: "number", Description: "bandwidth_mbps"},
+		{Name: "accuracy_percent", Type: "number", Description: "achieved_mbps as a percentage of requested_mbps; well below 100 when the path or host could not keep up"},
+		{Name: "interval_error_percent", Type: "number", Description: "Mean deviation of the per-second rates from requested_mbps, in percent of it"},
+	}},
+	{Name: "PauseRequest", Description: "The optional body of POST /schedules/{id}/pause", Fields: []apiField{
+		{Name: "duration", Type: "string", Description: "Resume automatically after this duration (e.g. 2h); without it the schedule stays paused until resumed"},
+		{Name: "reason", Type: "string", Description: "Note shown in listings while paused"},
+	}},
+	{Name: "Peer", Description: "An agent of the mesh, from MESH_PEERS or MESH_PEERS_DNS", Fields: []apiField{
+		{Name: "name", Type: "string", Description: "Host of the URL, which the other peers test towards; host:port when several peers share a host"},
+		{Name: "url", Type: "string", Description: "Base URL of the peer's API"},
+	}},
+	{Name: "PeerMeshRequest", Description: "Body of POST /peers/mesh/run", Fields: []apiField{
+		{Name: "type", Type: "string", Required: true, Description: "Test type of every test: twamp or ping"},
+		{Name: "request", Type: "RunRequest", Description: "Template of every test: the body of the type's run endpoint without server_host; server_port is also the port of the responder"},
+		{Name: "peers", Type: "[]string", Description: "Names of the peers to include, at least 2 (default: all, at most 32)"},
+		{Name: "parallel", Type: "integer", Default: "4", Description: "Tests at a time across all peers (max 16)"},
+	}},
+	{Name: "PeerMeshResponse", Description: "Data of a POST /peers/mesh/run response", Fields: []apiField{
+		{Name: "type", Type: "string"},
+		{Name: "peers", Type: "[]PeerStatus", Description: "Every peer, with its health and responder"},
+		{Name: "pairs", Type: "integer", Description: "Ordered pairs of peers tested"},
+		{Name: "succeeded", Type: "integer"},
+		{Name: "failed", Type: "integer"},
+		{Name: "parallel", Type: "integer"},
+		{Name: "metrics", Type: "[]string", Description: "The metrics of the test type any pair has, in the order result diffs compare them"},
+		{Name: "matrix", Type: "map[string]object", Description: "Metrics of each pair that succeeded, by source and then destination peer name"},
+		{Name: "results", Type: "[]PeerMeshResult", Description: "One per ordered pair, by source and then destination"},
+		{Name: "duration_sec", Type: "number", Description: "Total time of the run in seconds"},
+	}},
+	{Name: "PeerMeshResult", Description: "The test of one ordered pair of peers", Fields: []apiField{
+		{Name: "source", Type: "string", Description: "Peer that ran the client side"},
+		{Name: "destination", Type: "string", Description: "Peer whose responder it tested towards"},
+		{Name: "status", Type: "string", Description: "ok or error"},
+		{Name: "result_id", Type: "string", Description: "Stored result on the source, for its GET /results/{id}"},
+		{Name: "metrics", Type: "map[string]number", Description: "Key metrics of the result, by path"},
+		{Name: "error", Type: "string"},
+		{Name: "code", Type: "string"},
+		{Name: "http_status", Type: "integer", Description: "Status the source answered the test with"},
+		{Name: "duration_sec", Type: "number"},
+	}},
+	{Name: "PeerStatus", Description: "A peer and whether it answers", Fields: []apiField{
+		{Name: "name", Type: "string"},
+		{Name: "url", Type: "string"},
+		{Name: "status", Type: "string", Description: "healthy, draining or unreachable, from its GET /health"},
+		{Name: "responder", Type: "string", Description: "Agent mesh runs: started (and stopped again), running (already, and left so) or failed"},
+		{Name: "error", Type: "string"},
+	}},
+	{Name: "Percentiles", Description: "The tail percentiles latency SLAs are written against", Fields: []apiField{
+		{Name: "p50", Type: "number"},
+		{Name: "p90", Type: "number"},
+		{Name: "p95", Type: "number"},
+		{Name: "p99", Type: "number"},
+		{Name: "p99_9", Type: "number"},
+	}},
+	{Name: "PingProbe", Description: "The outcome of one probe", Fields: []apiField{
+		{Name: "seq", Type: "integer"},
+		{Name: "status", Type: "string"},
+		{Name: "rtt_ms", Type: "number"},
+		{Name: "ttl", Type: "integer", Description: "TTL the reply arrived with, ICMP over IPv4 only"},
+		{Name: "from", Type: "string", Description: "Router that sent an error back"},
+	}},
+	{Name: "PredictionCheck", Description: "Compares an iperf3 TCP result with a stored TCP prediction, returned as data.prediction", Fields: []apiField{
+		{Name: "result_id", Type: "string", Description: "TWAMP result the prediction came from"},
+		{Name: "predicted_mbps", Type: "number", Description: "Per-flow prediction times the parallel streams"},
+		{Name: "actual_mbps", Type: "number"},
+		{Name: "achieved_percent", Type: "number"},
+		{Name: "lower_bound", Type: "boolean", Description: "The prediction assumed the worst loss consistent with no loss seen"},
+		{Name: "below_prediction", Type: "boolean", Description: "Achieved less than PREDICTION_SHORTFALL_PERCENT of the prediction"},
+	}},
+	{Name: "PreflightResult", Description: "The idle baseline measured before the test, returned as data.preflight", Fields: []apiField{
+		{Name: "method", Type: "string", Description: "tcp_connect: handshake time to the control port"},
+		{Name: "address", Type: "string"},
+		{Name: "family", Type: "string"},
+		{Name: "probes", Type: "integer"},
+		{Name: "replies", Type: "integer"},
+		{Name: "rtt_min_ms", Type: "number"},
+		{Name: "rtt_avg_ms", Type: "number"},
+		{Name: "rtt_max_ms", Type: "number"},
+	}},
+	{Name: "ProbeEvent", Description: "One TWAMP reply as GET /jobs/{id}/probes pushes it", Fields: []apiField{
+		{Name: "seq", Type: "integer"},
+		{Name: "sent_at", Type: "date-time", Description: "T1, sender clock"},
+		{Name: "reflector_received_at", Type: "date-time", Description: "T2, reflector clock"},
+		{Name: "reflector_sent_at", Type: "date-time", Description: "T3, reflector clock"},
+		{Name: "received_at", Type: "date-time", Description: "T4, sender clock"},
+		{Name: "rtt_ms", Type: "number"},
+		{Name: "network_rtt_ms", Type: "number", Description: "RTT without the reflector's turnaround"},
+		{Name: "turnaround_ms", Type: "number"},
+		{Name: "forward_delay_raw_ms", Type: "number", Description: "Includes the clock offset"},
+		{Name: "reverse_delay_raw_ms", Type: "number"},
+		{Name: "forward_delay_corrected_ms", Type: "number", Description: "Assuming a symmetric path"},
+		{Name: "reverse_delay_corrected_ms", Type: "number"},
+		{Name: "clock_step", Type: "boolean", Description: "A clock stepped, the timings are unreliable"},
+		{Name: "duplicate", Type: "boolean"},
+		{Name: "replies", Type: "integer", Description: "Distinct replies so far"},
+		{Name: "loss_percent", Type: "number", Description: "Of the probes up to the highest sequence number replied to"},
+	}},
+	{Name: "Profile", Description: "Holds per-site request defaults and limits", Fields: []apiField{
+		{Name: "name", Type: "string"},
+		{Name: "targets", Type: "[]string"},
+		{Name: "defaults", Type: "RunRequest"},
+		{Name: "limits", Type: "ProfileLimits"},
+	}},
+	{Name: "ProfileLimits", Description: "Caps what requests against a profile's targets may ask for (0 = no limit)", Fields: []apiField{
+		{Name: "max_duration", Type: "integer", Description: "Seconds"},
+		{Name: "max_parallel", Type: "integer", Description: "Streams"},
+		{Name: "max_bandwidth", Type: "integer", Description: "Mbit/s"},
+		{Name: "max_count", Type: "integer", Description: "TWAMP probes"},
+	}},
+	{Name: "ProfileSet", Description: "The ordered list of configured profiles", Fields: []apiField{
+		{Name: "profiles", Type: "*[]Profile"},
+	}},
+	{Name: "RPMLoad", Description: "The load of one direction of an RPM test, under working conditions", Fields: []apiField{
+		{Name: "throughput_mbps", Type: "number"},
+		{Name: "bytes", Type: "integer", Description: "Received (download) or written (upload) while the probes ran"},
+		{Name: "connections", Type: "integer", Description: "Load-generating connections at the end"},
+	}},
+	{Name: "RPMProbes", Description: "Probes of one kind of an RPM test, as trimmed means of the fastest 95% in milliseconds", Fields: []apiField{
+		{Name: "probes", Type: "integer", Description: "Probes completed"},
+		{Name: "failed", Type: "integer", Description: "Probes that failed or did not complete within 2 seconds of the end"},
+		{Name: "tcp_ms", Type: "number", Description: "Foreign probes only: TCP connect"},
+		{Name: "tls_ms", Type: "number", Description: "Foreign probes only: TLS handshake"},
+		{Name: "http_ms", Type: "number", Description: "From the request on the connection to the end of the response"},
+	}},
+	{Name: "ReflectorSessionInfo", Description: "Describes one test session negotiated with the reflector", Fields: []apiField{
+		{Name: "sid", Type: "string"},
+		{Name: "client", Type: "string", Description: "TWAMP-Control peer"},
+		{Name: "sender_port", Type: "integer"},
+		{Name: "receiver_port", Type: "integer", Description: "Port the reflector listens on"},
+		{Name: "padding_bytes", Type: "integer"},
+		{Name: "dscp", Type: "integer"},
+		{Name: "state", Type: "string"},
+		{Name: "created_at", Type: "date-time"},
+		{Name: "last_packet_at", Type: "date-time"},
+		{Name: "packets_reflected", Type: "integer"},
+		{Name: "packets_discarded", Type: "integer", Description: "Too short, or from another host than the client"},
+	}},
+	{Name: "ReorderDistance", Description: "Counts the reordered replies that arrived distance sequence numbers behind the highest one received before them", Fields: []apiField{
+		{Name: "distance", Type: "integer"},
+		{Name: "count", Type: "integer"},
+	}},
+	{Name: "Reordering", Description: "The distribution of reordering distances; without loss a reply's distance is its RFC 4737 reordering extent", Fields: []apiField{
+		{Name: "max_distance", Type: "integer", Description: "Largest distance, 0 without reordering"},
+		{Name: "distances", Type: "[]ReorderDistance", Description: "Reordered replies per distance, ascending, distances seen only"},
+	}},
+	{Name: "ResultDiff", Description: "The structured comparison of two stored results", Fields: []apiField{
+		{Name: "base", Type: "ResultRef", Description: "Baseline result (id1) reference"},
+		{Name: "compare", Type: "ResultRef", Description: "Compared result (id2) reference"},
+		{Name: "threshold_percent", Type: "number", Description: "Highlight threshold used"},
+		{Name: "metrics", Type: "[]MetricDiff", Description: "Per metric: base, compare, delta, delta_percent, change (improved/regressed/changed/unchanged/missing), exceeds_threshold"},
+		{Name: "summary", Type: "ResultDiffSummary", Description: "Counts of regressions, improvements and other changes beyond the threshold"},
+	}},
+	{Name: "ResultDiffSummary", Description: "Counts highlighted metrics", Fields: []apiField{
+		{Name: "regressions", Type: "integer", Description: "Regressed beyond the threshold"},
+		{Name: "improvements", Type: "integer", Description: "Improved beyond the threshold"},
+		{Name: "changed", Type: "integer", Description: "Beyond the threshold without a better direction"},
+	}},
+	{Name: "ResultList", Description: "Data of GET /results", Fields: []apiField{
+		{Name: "total", Type: "integer", Description: "Results matching the filters, beyond limit too"},
+		{Name: "results", Type: "[]ResultSummary", Description: "Newest first"},
+	}},
+	{Name: "ResultRef", Description: "Identifies a stored result without its data", Fields: []apiField{
+		{Name: "id", Type: "string"},
+		{Name: "type", Type: "string"},
+		{Name: "target", Type: "string"},
+		{Name: "created_at", Type: "date-time"},
+	}},
+	{Name: "ResultSummary", Description: "A stored result as GET /results lists it: its parameters and the metrics /results/aggregate and the diff compare, without the rest of its data", Fields: []apiField{
+		{Name: "id", Type: "string"},
+		{Name: "type", Type: "string"},
+		{Name: "target", Type: "string"},
+		{Name: "created_at", Type: "date-time"},
+		{Name: "params", Type: "map[string]"},
+		{Name: "metrics", Type: "map[string]number"},
+	}},
+	{Name: "S3PartResult", Description: "The timing of one part request", Fields: []apiField{
+		{Name: "part_number", Type: "integer"},
+		{Name: "bytes", Type: "integer"},
+		{Name: "duration_ms", Type: "number"},
+		{Name: "latency_ms", Type: "number", Description: "PUT: body written to response; GET: request start to first byte"},
+		{Name: "throughput_mbps", Type: "number"},
+	}},
+	{Name: "S3PhaseResult", Description: "Summarises the parts of an upload or download", Fields: []apiField{
+		{Name: "bytes", Type: "integer"},
+		{Name: "duration_ms", Type: "number", Description: "First part started to last part done"},
+		{Name: "throughput_mbps", Type: "number", Description: "Aggregate over all parts in flight"},
+		{Name: "latency_ms", Type: "*MetricAggregate"},
+		{Name: "parts", Type: "[]S3PartResult"},
+	}},
+	{Name: "S3RequestTiming", Description: "The latencies of the requests around the parts in milliseconds", Fields: []apiField{
+		{Name: "create_ms", Type: "number", Description: "CreateMultipartUpload"},
+		{Name: "complete_ms", Type: "number", Description: "CompleteMultipartUpload"},
+		{Name: "delete_ms", Type: "number"},
+	}},
+	{Name: "SSHInfo", Description: "Describes the negotiated connection", Fields: []apiField{
+		{Name: "server_version", Type: "string"},
+		{Name: "kex", Type: "string"},
+		{Name: "host_key_type", Type: "string"},
+		{Name: "host_key_fingerprint", Type: "string", Description: "SHA256, as ssh-keygen -l prints it"},
+		{Name: "host_key_verified", Type: "boolean", Description: "Matched host_key_fingerprint or SSH_KNOWN_HOSTS"},
+		{Name: "cipher", Type: "string"},
+		{Name: "mac", Type: "string"},
+		{Name: "auth_method", Type: "string", Description: "publickey or password"},
+		{Name: "rekeys", Type: "integer"},
+	}},
+	{Name: "SSHTimings", Description: "The phases of an SSH transfer in milliseconds", Fields: []apiField{
+		{Name: "dial_ms", Type: "number", Description: "Name resolution and TCP connect"},
+		{Name: "dns_ms", Type: "number", Description: "Name resolution part of dial_ms"},
+		{Name: "connect_ms", Type: "number", Description: "TCP connect of the connection used"},
+		{Name: "kex_ms", Type: "number", Description: "Version exchange and key exchange"},
+		{Name: "auth_ms", Type: "number", Description: "User authentication"},
+		{Name: "setup_ms", Type: "number", Description: "Dial, key exchange and authentication: the cost of each new connection"},
+		{Name: "channel_ms", Type: "number", Description: "Opening the session, starting scp or sftp and opening the file"},
+		{Name: "transfer_ms", Type: "number", Description: "The phase goodput is measured over"},
+		{Name: "total_ms", Type: "number"},
+	}},
+	{Name: "STUNServerMapping", Description: "The public address one STUN server saw", Fields: []apiField{
+		{Name: "server", Type: "string"},
+		{Name: "address", Type: "string"},
+		{Name: "public_address", Type: "string"},
+		{Name: "rtt_ms", Type: "number"},
+		{Name: "error", Type: "string"},
+	}},
+	{Name: "Schedule", Description: "A test request run every Interval until paused or deleted", Fields: []apiField{
+		{Name: "id", Type: "string", Description: "Schedule ID"},
+		{Name: "type", Type: "string"},
+		{Name: "target", Type: "string"},
+		{Name: "interval", Type: "string"},
+		{Name: "request", Type: "RunRequest"},
+		{Name: "state", Type: "string", Description: "active or paused"},
+		{Name: "paused_at", Type: "date-time"},
+		{Name: "paused_until", Type: "date-time", Description: "When a timed pause ends (paused schedules only)"},
+		{Name: "pause_reason", Type: "string", Description: "Reason given when pausing"},
+		{Name: "running", Type: "boolean", Description: "Whether a run is in progress"},
+		{Name: "created_at", Type: "date-time"},
+		{Name: "next_run", Type: "date-time", Description: "Next run time (active schedules only); the first run is immediate"},
+		{Name: "last_run", Type: "date-time"},
+		{Name: "last_result_id", Type: "string", Description: "Stored result ID of the last successful run"},
+		{Name: "last_error", Type: "string", Description: "Error of the last run, if it failed"},
+		{Name: "runs", Type: "integer", Description: "Number of completed runs"},
+		{Name: "failures", Type: "integer"},
+		{Name: "api_key", Type: "string", Description: "Name of the API key that created it, whose tests_per_hour its runs count against"},
+		{Name: "alert", Type: "Alert", Description: "With its defaults filled in; omitted without an alert"},
+		{Name: "alert_state", Type: "AlertState"},
+	}},
+	{Name: "ScheduleRequest", Description: "The body of POST /schedules", Fields: []apiField{
+		{Name: "type", Type: "string", Required: true, Description: "Test type: iperf3, twamp, transfer, s3, ssh, pmtu, stun, nat64, ping, traceroute, owamp, tls, ndt7, bufferbloat, rpm, tcp_connect or http"},
+		{Name: "interval", Type: "string", Required: true, Description: "Time between runs as a duration (e.g. 5m, 1h), at least 1m"},
+		{Name: "request", Type: "RunRequest", Required: true, Description: "Body of POST /iperf/client/run or /twamp/client/run; server_host is required"},
+		{Name: "alert", Type: "Alert", Description: "Notify when the results breach thresholds for several runs in a row, and when they recover"},
+	}},
+	{Name: "Series", Description: "The time series returned alongside the aggregate results", Fields: []apiField{
+		{Name: "unit", Type: "string"},
+		{Name: "points", Type: "[]SeriesPoint"},
+		{Name: "total_points", Type: "integer", Description: "Raw samples before capping"},
+		{Name: "downsampled", Type: "boolean"},
+		{Name: "truncated", Type: "boolean"},
+	}},
+	{Name: "SeriesPoint", Description: "A single sample of a test time series", Fields: []apiField{
+		{Name: "t_sec", Type: "number", Description: "Offset from test start in seconds"},
+		{Name: "value", Type: "number", Description: "Sample value in the series unit"},
+		{Name: "count", Type: "integer", Description: "Raw samples merged into this point when downsampled"},
+	}},
+	{Name: "SourceBinding", Description: "Pins a test's connections to a source address and/or an interface, so multi-homed agents control the egress path, and opens them in a network namespace", Fields: []apiField{
+		{Name: "address", Type: "string", Description: "source_address"},
+		{Name: "interface", Type: "string", Description: "interface, bound with SO_BINDTODEVICE"},
+		{Name: "namespace", Type: "string", Description: "netns"},
+	}},
+	{Name: "StoredResult", Description: "A completed test with the data returned to the caller", Fields: []apiField{
+		{Name: "id", Type: "string", Description: "Result ID"},
+		{Name: "type", Type: "string", Description: "Test type (iperf3, twamp, transfer, s3, ssh, pmtu, stun, nat64, ping, traceroute, owamp, tls, ndt7, bufferbloat, rpm, tcp_connect or http)"},
+		{Name: "target", Type: "string", Description: "Test target host"},
+		{Name: "started_at", Type: "date-time", Description: "Origin of the result's time series"},
+		{Name: "created_at", Type: "date-time", Description: "When the test completed"},
+		{Name: "params", Type: "map[string]", Description: "The request fields the test ran with"},
+		{Name: "data", Type: "map[string]", Description: "The test response data"},
+	}},
+	{Name: "SweepStep", Description: "The run of one padding size in sweep mode", Fields: []apiField{
+		{Name: "padding", Type: "integer"},
+		{Name: "packet_bytes", Type: "integer", Description: "IP packet size of the probes"},
+		{Name: "id", Type: "string", Description: "Stored full mode result of the run"},
+		{Name: "loss_percent", Type: "number"},
+		{Name: "rtt_min_ms", Type: "number"},
+		{Name: "rtt_avg_ms", Type: "number"},
+		{Name: "rtt_max_ms", Type: "number"},
+		{Name: "rtt_p95_ms", Type: "number"},
+		{Name: "error", Type: "string", Description: "Set when the run failed, with its code"},
+		{Name: "code", Type: "string"},
+	}},
+	{Name: "SweepSummary", Description: "Compares the steps of a sweep", Fields: []apiField{
+		{Name: "size_dependent_loss", Type: "boolean", Description: "A larger size lost at least 5 percentage points more than the smallest"},
+		{Name: "first_lossy_packet_bytes", Type: "integer", Description: "Smallest packet size with size dependent loss"},
+		{Name: "rtt_increase_ms", Type: "number", Description: "Minimum RTT of the largest size over that of the smallest"},
+		{Name: "serialization_us_per_byte", Type: "number", Description: "Least-squares slope of the minimum RTT over the packet size"},
+	}},
+	{Name: "TCPConnectResult", Description: "The connect to one target of a TCP connect test", Fields: []apiField{
+		{Name: "target", Type: "string", Description: "As requested"},
+		{Name: "host", Type: "string"},
+		{Name: "port", Type: "integer"},
+		{Name: "status", Type: "string", Description: "open, refused (reset), timeout (no answer, as behind a dropping firewall), unreachable (ICMP host or network unreachable), resolve_failed or error"},
+		{Name: "reachable", Type: "boolean", Description: "Whether the connect succeeded"},
+		{Name: "connect_ms", Type: "number", Description: "Connect time of the attempt that succeeded"},
+		{Name: "dial", Type: "DialReport", Description: "Every address tried, with the time and error of each; left out when the name did not resolve"},
+		{Name: "error", Type: "string"},
+	}},
+	{Name: "TCPECNReport", Description: "Describes ECN on the data streams of an iperf3 TCP test", Fields: []apiField{
+		{Name: "streams", Type: "integer"},
+		{Name: "negotiated_streams", Type: "integer"},
+		{Name: "negotiated", Type: "boolean", Description: "Every stream negotiated ECN"},
+		{Name: "ce_marks", Type: "integer", Description: "Segments the server echoed a CE mark for (uploads)"},
+		{Name: "ce_percent", Type: "number", Description: "CE marks per acknowledged segment"},
+		{Name: "ce_observed", Type: "boolean", Description: "ECE feedback came back (uploads)"},
+		{Name: "markings_survived", Type: "boolean", Description: "ECT reached the far end, if that can be told"},
+		{Name: "retransmits", Type: "integer"},
+	}},
+	{Name: "TCPPrediction", Description: "The single-flow TCP throughput a TWAMP full mode run predicts, returned as data.tcp_prediction", Fields: []apiField{
+		{Name: "mss_bytes", Type: "integer", Description: "Of the TWAMP control connection, or the default for the address family"},
+		{Name: "mss_measured", Type: "boolean"},
+		{Name: "rtt_ms", Type: "number"},
+		{Name: "rto_ms", Type: "number"},
+		{Name: "loss_percent", Type: "number", Description: "Loss the models were evaluated at"},
+		{Name: "loss_upper_bound", Type: "boolean", Description: "No probe was lost; the prediction is a lower bound"},
+		{Name: "mathis_mbps", Type: "number", Description: "MSS / RTT * C / sqrt(p)"},
+		{Name: "padhye_mbps", Type: "number", Description: "Including retransmission timeouts"},
+		{Name: "predicted_mbps", Type: "number", Description: "The lower of both models"},
+		{Name: "probes_considered", Type: "integer"},
+	}},
+	{Name: "TLSCertificate", Description: "Describes one certificate of the chain the server presented", Fields: []apiField{
+		{Name: "subject", Type: "string"},
+		{Name: "issuer", Type: "string"},
+		{Name: "serial_number", Type: "string", Description: "Hex"},
+		{Name: "not_before", Type: "date-time"},
+		{Name: "not_after", Type: "date-time"},
+		{Name: "days_to_expiry", Type: "integer", Description: "Negative once expired"},
+		{Name: "dns_names", Type: "[]string"},
+		{Name: "is_ca", Type: "boolean"},
+		{Name: "key_type", Type: "string", Description: "e.g. RSA 2048, ECDSA P-256, Ed25519"},
+		{Name: "signature_algorithm", Type: "string"},
+		{Name: "sha256_fingerprint", Type: "string", Description: "Hex, of the DER certificate"},
+	}},
+	{Name: "TLSReport", Description: "The handshake and certificate check of a TLS connection", Fields: []apiField{
+		{Name: "version", Type: "string"},
+		{Name: "cipher_suite", Type: "string"},
+		{Name: "server_name", Type: "string"},
+		{Name: "root_store", Type: "string"},
+		{Name: "verified", Type: "boolean", Description: "The chain validates for server_name and is not revoked"},
+		{Name: "verify_error", Type: "string"},
+		{Name: "trust_anchor", Type: "string", Description: "Root the chain validated to"},
+		{Name: "days_to_expiry", Type: "integer", Description: "Of the presented certificate expiring first"},
+		{Name: "chain", Type: "[]TLSCertificate", Description: "As presented, leaf first"},
+		{Name: "ocsp", Type: "OCSPStaple"},
+	}},
+	{Name: "TLSTimings", Description: "Splits the time to an established TLS connection", Fields: []apiField{
+		{Name: "dns_ms", Type: "number", Description: "Name resolution"},
+		{Name: "connect_ms", Type: "number", Description: "TCP handshake of the connection that won"},
+		{Name: "handshake_ms", Type: "number", Description: "ClientHello to the server's Finished"},
+		{Name: "total_ms", Type: "number"},
+	}},
+	{Name: "TLSVersionProbe", Description: "The outcome of a handshake pinned to one TLS version", Fields: []apiField{
+		{Name: "version", Type: "string", Description: "As tls_versions names it, e.g. 1.2"},
+		{Name: "supported", Type: "boolean", Description: "The handshake completed at this version"},
+		{Name: "cipher_suite", Type: "string"},
+		{Name: "alpn", Type: "string"},
+		{Name: "connect_ms", Type: "number"},
+		{Name: "handshake_ms", Type: "number"},
+		{Name: "failure", Type: "string", Description: "alert or version when the server refused the version; reset, closed or timeout when the connection broke off, which points to a middlebox; or error"},
+		{Name: "error", Type: "string"},
+	}},
+	{Name: "TestSlot", Description: "A running or queued test, as GET /status lists it", Fields: []apiField{
+		{Name: "test", Type: "string"},
+		{Name: "job_id", Type: "string", Description: "Asynchronous tests only"},
+		{Name: "queued_at", Type: "date-time"},
+		{Name: "started_at", Type: "date-time", Description: "Running tests only"},
+		{Name: "position", Type: "integer", Description: "1 for the next queued test to start"},
+	}},
+	{Name: "TraceHop", Description: "One TTL of a traceroute", Fields: []apiField{
+		{Name: "ttl", Type: "integer"},
+		{Name: "address", Type: "string", Description: "Responder that answered most probes"},
+		{Name: "name", Type: "string", Description: "Its reverse DNS name"},
+		{Name: "addresses", Type: "[]string", Description: "All responders, when probes were answered by several (ECMP)"},
+		{Name: "sent", Type: "integer"},
+		{Name: "received", Type: "integer"},
+		{Name: "loss_percent", Type: "number"},
+		{Name: "rtt_min_ms", Type: "number"},
+		{Name: "rtt_avg_ms", Type: "number"},
+		{Name: "rtt_max_ms", Type: "number"},
+		{Name: "rtt_stddev_ms", Type: "number"},
+		{Name: "probes", Type: "[]PingProbe"},
+	}},
+	{Name: "HTTPTimings", Description: "The phases of an HTTP test in milliseconds, from httptrace", Fields: []apiField{
+		{Name: "dns_ms", Type: "number", Description: "DNSStart to DNSDone, 0 for an IP address"},
+		{Name: "connect_ms", Type: "number", Description: "ConnectStart to ConnectDone of the connection used"},
+		{Name: "tls_ms", Type: "number", Description: "TLSHandshakeStart to TLSHandshakeDone (https only)"},
+		{Name: "request_ms", Type: "number", Description: "GotConn to WroteRequest: writing the request, including an upload body"},
+		{Name: "server_ms", Type: "number", Description: "WroteRequest to GotFirstResponseByte: the server's time to answer"},
+		{Name: "ttfb_ms", Type: "number", Description: "From the start to the first response byte"},
+		{Name: "transfer_ms", Type: "number", Description: "The phase goodput is measured over"},
+		{Name: "total_ms", Type: "number"},
+	}},
+	{Name: "TransferTimings", Description: "The phases of a transfer in milliseconds from its start", Fields: []apiField{
+		{Name: "dial_ms", Type: "number", Description: "Name resolution and TCP connect"},
+		{Name: "dns_ms", Type: "number", Description: "Name resolution part of dial_ms"},
+		{Name: "connect_ms", Type: "number", Description: "TCP connect of the connection used"},
+		{Name: "tls_ms", Type: "number", Description: "HTTPS handshake"},
+		{Name: "login_ms", Type: "number", Description: "FTP greeting and login"},
+		{Name: "data_connect_ms", Type: "number", Description: "FTP passive data connection"},
+		{Name: "request_ms", Type: "number", Description: "Writing the request, including an upload body"},
+		{Name: "ttfb_ms", Type: "number", Description: "From the start to the first response byte"},
+		{Name: "transfer_ms", Type: "number", Description: "The phase goodput is measured over"},
+		{Name: "total_ms", Type: "number"},
+	}},
+	{Name: "TunnelReport", Description: "Describes the tunnel a test ran through and what the encapsulation cost", Fields: []apiField{
+		{Name: "name", Type: "string"},
+		{Name: "type", Type: "string", Description: "Kernel link kind"},
+		{Name: "interface", Type: "string"},
+		{Name: "created", Type: "boolean", Description: "Built by the agent for the test"},
+		{Name: "remote", Type: "string"},
+		{Name: "mtu", Type: "integer"},
+		{Name: "overhead_bytes", Type: "integer", Description: "Outer headers added to every inner packet"},
+		{Name: "inner_packet_bytes", Type: "integer", Description: "Full-sized test packet inside the tunnel"},
+		{Name: "outer_packet_bytes", Type: "integer", Description: "The same packet on the underlay"},
+		{Name: "payload_mbps", Type: "number", Description: "What the test measured"},
+		{Name: "inner_mbps", Type: "number", Description: "With inner IP and transport headers"},
+		{Name: "outer_mbps", Type: "number", Description: "With the encapsulation, as the underlay carries it"},
+		{Name: "efficiency_percent", Type: "number", Description: "Payload share of the outer bytes"},
+	}},
+	{Name: "TwampClockSteps", Description: "Probes a TWAMP test excluded because a clock stepped", Fields: []apiField{
+		{Name: "sender_step_probes", Type: "integer"},
+		{Name: "reflector_step_probes", Type: "integer"},
+		{Name: "excluded_probes", Type: "integer"},
+		{Name: "max_step_ms", Type: "number"},
+	}},
+	{Name: "TwampErrorEstimate", Description: "An RFC 4656 error estimate, decoded", Fields: []apiField{
+		{Name: "synced", Type: "boolean"},
+		{Name: "unavailable", Type: "boolean"},
+		{Name: "scale", Type: "integer"},
+		{Name: "multiplier", Type: "integer"},
+		{Name: "error_seconds", Type: "number"},
+		{Name: "error_ms", Type: "number"},
+		{Name: "raw_value_hex", Type: "string"},
+	}},
+	{Name: "TwampHops", Description: "Hop counts derived from the TTL of the probes and replies", Fields: []apiField{
+		{Name: "forward", Type: "map[string]number", Description: "min, max and avg"},
+		{Name: "reverse", Type: "map[string]number", Description: "min, max and avg"},
+	}},
+	{Name: "TwampRawProbe", Description: "One probe of a full mode run as include_raw returns it; lost probes only have seq and lost", Fields: []apiField{
+		{Name: "seq", Type: "integer"},
+		{Name: "lost", Type: "boolean"},
+		{Name: "sent_at", Type: "date-time", Description: "T1, sender clock"},
+		{Name: "reflector_received_at", Type: "date-time", Description: "T2, reflector clock"},
+		{Name: "reflector_sent_at", Type: "date-time", Description: "T3, reflector clock"},
+		{Name: "received_at", Type: "date-time", Description: "T4, sender clock"},
+		{Name: "rtt_ms", Type: "number", Description: "T4-T1 on the monotonic clock"},
+		{Name: "network_rtt_ms", Type: "number", Description: "RTT without the reflector's turnaround"},
+		{Name: "forward_delay_raw_ms", Type: "number", Description: "T2-T1, includes the clock offset"},
+		{Name: "reverse_delay_raw_ms", Type: "number", Description: "T4-T3"},
+		{Name: "sender_ttl", Type: "integer", Description: "TTL the probe reached the reflector with, sent as 255"},
+		{Name: "received_ttl", Type: "integer", Description: "TTL the reply arrived with"},
+		{Name: "clock_step", Type: "boolean", Description: "A clock stepped: excluded from the statistics"},
+		{Name: "duplicate", Type: "boolean", Description: "A further reply to an answered probe"},
+	}},
+	{Name: "TwampServerConfig", Description: "The body of POST /twamp/server/start", Fields: []apiField{
+		{Name: "address", Type: "string", Description: "Address to listen on (default: all)"},
+		{Name: "port", Type: "integer", Default: "862", Description: "TWAMP-Control TCP port"},
+		{Name: "max_sessions", Type: "integer", Default: "16", Description: "Concurrent test sessions, and control connections (max 256)"},
+		{Name: "servwait_sec", Type: "integer", Default: "900", Description: "Idle control connection timeout (max 3600)"},
+		{Name: "refwait_sec", Type: "integer", Default: "900", Description: "Test session inactivity timeout (max 3600)"},
+	}},
+	{Name: "TwampServerStatus", Description: "The state of the reflector in GET /twamp/server", Fields: []apiField{
+		{Name: "running", Type: "boolean"},
+		{Name: "listen", Type: "string"},
+		{Name: "config", Type: "TwampServerConfig"},
+		{Name: "started_at", Type: "date-time"},
+		{Name: "stopped_at", Type: "date-time"},
+		{Name: "control_connections", Type: "integer"},
+		{Name: "connections_total", Type: "integer"},
+		{Name: "sessions_total", Type: "integer"},
+		{Name: "sessions_rejected", Type: "integer", Description: "Refused at max_sessions"},
+		{Name: "packets_reflected", Type: "integer"},
+		{Name: "sessions", Type: "*[]ReflectorSessionInfo"},
+	}},
+	{Name: "TwampSessionResult", Description: "One session of a full mode run with sessions: the full mode fields of TwampResponse for its probes, or error and code when it failed", Fields: []apiField{
+		{Name: "name", Type: "string", Description: "The session's name, if given"},
+		{Name: "dscp", Type: "integer", Description: "DSCP the session's probes were sent with, as applied to the socket"},
+		{Name: "padding", Type: "integer", Description: "Padding of the session's probes in bytes"},
+		{Name: "local_endpoint", Type: "string", Description: "Local test endpoint (IP:port)"},
+		{Name: "remote_endpoint", Type: "string", Description: "Remote test endpoint (IP:port)"},
+		{Name: "loss_percent", Type: "number"},
+		{Name: "rtt_avg_ms", Type: "number"},
+		{Name: "percentiles_ms", Type: "LatencyPercentiles"},
+		{Name: "error", Type: "string", Description: "The session's run failed"},
+		{Name: "code", Type: "string"},
+	}},
+	{Name: "TwampSessionSpec", Description: "One test session of a full mode run with sessions", Fields: []apiField{
+		{Name: "name", Type: "string", Description: "Label returned with the session's result"},
+		{Name: "dscp", Type: "integer", Default: "0", Description: "DSCP code point of the session's probes (0-63), also sent as its Type-P Descriptor"},
+		{Name: "padding", Type: "integer", Default: "0", Description: "Padding of the session's probes in bytes"},
+	}},
+	{Name: "TwampSyncStatus", Description: "Clock synchronization of sender and reflector, from the TWAMP error estimates", Fields: []apiField{
+		{Name: "sender_synced", Type: "boolean"},
+		{Name: "reflector_synced", Type: "boolean"},
+		{Name: "both_synced", Type: "boolean"},
+		{Name: "sender_error_estimate", Type: "TwampErrorEstimate"},
+		{Name: "reflector_error_estimate", Type: "TwampErrorEstimate"},
+	}},
+	{Name: "TypeAggregate", Description: "Holds the metric summaries for one test type", Fields: []apiField{
+		{Name: "runs", Type: "integer"},
+		{Name: "first", Type: "date-time"},
+		{Name: "last", Type: "date-time"},
+		{Name: "metrics", Type: "map[string]MetricAggregate"},
+	}},
+	{Name: "UDPECNReport", Description: "Counts the ECN codepoints of reflected TWAMP probes, all sent as ECT(0)", Fields: []apiField{
+		{Name: "sent_codepoint", Type: "string"},
+		{Name: "replies", Type: "integer", Description: "Replies whose codepoint could be read"},
+		{Name: "not_ect", Type: "integer"},
+		{Name: "ect0", Type: "integer"},
+		{Name: "ect1", Type: "integer"},
+		{Name: "ce", Type: "integer"},
+		{Name: "ce_percent", Type: "number"},
+		{Name: "bleached_percent", Type: "number", Description: "Replies arriving as Not-ECT"},
+		{Name: "ce_observed", Type: "boolean"},
+		{Name: "markings_survived", Type: "boolean", Description: "Every reply still carried ECT or CE"},
+	}},
+	{Name: "WebhookCallback", Description: "The webhook delivery queued for a result", Fields: []apiField{
+		{Name: "url", Type: "string", Description: "callback_url"},
+		{Name: "delivery_id", Type: "string", Description: "See GET /webhooks/deliveries/{id}"},
+	}},
+	{Name: "WebhookPayload", Description: "The JSON body POSTed to callback URLs", Fields: []apiField{
+		{Name: "event", Type: "string"},
+		{Name: "delivery_id", Type: "string"},
+		{Name: "result", Type: "*StoredResult"},
+	}},
+}
+
+// apiSchemaTypes are the Go types the schemas of the same name mirror. When
+// the document is built, fields a type marshals that its schema lacks are
+// logged.
+var apiSchemaTypes = map[string]interface{}{
+	"AdaptiveResult":       AdaptiveResult{},
+	"AdaptiveTrial":        AdaptiveTrial{},
+	"Alert":                Alert{},
+	"AlertBreach":          AlertBreach{Metric: "rtt_avg_ms", Value: new(float64), Above: new(float64), Below: new(float64), Error: "timeout"},
+	"AlertNotice":          AlertNotice{Breaches: []AlertBreach{}, ResultID: "1d9cb97159106d3d"},
+	"AlertNotify":          AlertNotify{URL: "https://hooks.example.com/alerts", To: []string{"noc@example.com"}},
+	"AlertPayload":         AlertPayload{},
+	"AlertState":           AlertState{LastBreaches: []AlertBreach{{}}},
+	"AlertThreshold":       AlertThreshold{Above: new(float64), Below: new(float64)},
+	"AvailableResult":      AvailableResult{},
+	"AvailableStream":      AvailableStream{},
+	"BaselineComparison":   BaselineComparison{},
+	"BaselineMetric":       BaselineMetric{Better: "lower", DeltaPercent: new(float64), Score: new(float64)},
+	"BufferbloatLatency":   BufferbloatLatency{Percentiles: &Percentiles{}},
+	"BufferbloatLoad":      BufferbloatLoad{Retransmits: 1, LatencyIncreaseMs: new(float64), P95IncreaseMs: new(float64)},
+	"BufferbloatProbe":     BufferbloatProbe{Address: "192.0.2.1", Port: 862, Protocol: "icmp", Socket: "raw", Dial: &nettest.DialReport{}},
+	"CapacityEstimate":     CapacityEstimate{},
+	"CapacityResult":       CapacityResult{},
+	"ConfigEntry":          ConfigEntry{},
+	"ConfigReport":         ConfigReport{},
+	"Delivery":             Delivery{ResultID: "1d9cb97159106d3d", ScheduleID: "5f0c2a9e7b1d4c36"},
+	"DeliveryAttempt":      DeliveryAttempt{},
+	"DialAttempt":          nettest.DialAttempt{},
+	"DialReport":           nettest.DialReport{},
+	"EchoServerConfig":     EchoServerConfig{},
+	"EchoServerStatus":     EchoServerStatus{},
+	"FieldError":           FieldError{Value: 0},
+	"FlentData":            FlentData{},
+	"FlentRawValue":        FlentRawValue{},
+	"GilbertElliott":       GilbertElliott{},
+	"Histogram":            Histogram{},
+	"HistogramBucket":      HistogramBucket{},
+	"Impairment":           Impairment{},
+	"Iperf3Interval":       nettest.Iperf3Interval{},
+	"Iperf3IntervalStream": nettest.Iperf3IntervalStream{},
+	"Iperf3ServerReport":   nettest.Iperf3ServerReport{},
+	"Iperf3ServerStream":   nettest.Iperf3ServerStream{},
+	"Iperf3SocketBuffers":  nettest.Iperf3SocketBuffers{},
+	"Iperf3Stream":         nettest.Iperf3Stream{},
+	"Job":                  Job{},
+	"JobProgressReport":    JobProgressReport{},
+	"LatencyHistograms":    LatencyHistograms{},
+	"LatencyPercentiles":   LatencyPercentiles{},
+	"Lease":                Lease{},
+	"LimiterStatus":        LimiterStatus{},
+	"LockInfo":             LockInfo{},
+	"LockRequest":          LockRequest{},
+	"LossBursts":           LossBursts{},
+	"MTUReport":            nettest.MTUReport{},
+	"MeshRequest":          MeshRequest{},
+	"MeshResult":           MeshResult{ResultID: "1d9cb97159106d3d", Metrics: map[string]float64{}, Error: "x", Code: ERR_TIMEOUT, HTTPStatus: 500},
+	"MetricAggregate":      MetricAggregate{},
+	"MetricDiff":           MetricDiff{},
+	"NAT64Prefix":          NAT64Prefix{},
+	"NDT7Result":           NDT7Result{SentBytes: 1, MinRTTMs: 1, RTTMs: 1, RTTVarMs: 1, RetransmitPercent: 1, ClientAddress: "192.0.2.10:51234", UUID: "ndt"},
+	"NDT7Server":           NDT7Server{City: "Frankfurt", Country: "DE"},
+	"OCSPStaple":           OCSPStaple{},
+	"PMTUBottleneck":       PMTUBottleneck{},
+	"PMTUProbe":            PMTUProbe{},
+	"PacingReport":         nettest.PacingReport{},
+	"PauseRequest":         PauseRequest{},
+	"Peer":                 Peer{},
+	"PeerMeshRequest":      PeerMeshRequest{},
+	"PeerMeshResult":       PeerMeshResult{ResultID: "1d9cb97159106d3d", Metrics: map[string]float64{}, Error: "x", Code: ERR_TIMEOUT, HTTPStatus: 500},
+	"PeerStatus":           PeerStatus{Responder: PEER_RESPONDER_STARTED, Error: "x"},
+	"Percentiles":          Percentiles{},
+	"PingProbe":            PingProbe{},
+	"PredictionCheck":      PredictionCheck{},
+	"PreflightResult":      PreflightResult{},
+	"ProbeEvent":           ProbeEvent{},
+	"Profile":              Profile{},
+	"ProfileLimits":        ProfileLimits{},
+	"ProfileSet":           ProfileSet{},
+	"RPMLoad":              RPMLoad{},
+	"RPMProbes":            RPMProbes{TCPMs: 1, TLSMs: 1},
+	"ReflectorSessionInfo": ReflectorSessionInfo{},
+	"ReorderDistance":      ReorderDistance{},
+	"Reordering":           Reordering{},
+	"ResultDiff":           ResultDiff{},
+	"ResultDiffSummary":    ResultDiffSummary{},
+	"ResultRef":            ResultRef{},
+	"ResultSummary":        ResultSummary{},
+	"S3PartResult":         S3PartResult{},
+	"S3PhaseResult":        S3PhaseResult{},
+	"S3RequestTiming":      S3RequestTiming{},
+	"SSHInfo":              SSHInfo{},
+	"SSHTimings":           SSHTimings{},
+	"STUNServerMapping":    STUNServerMapping{},
+	"Schedule":             Schedule{APIKey: "ci", Alert: &Alert{}, AlertState: &AlertState{}},
+	"ScheduleRequest":      ScheduleRequest{},
+	"Series":               Series{},
+	"SeriesPoint":          SeriesPoint{},
+	"SourceBinding":        nettest.SourceBinding{},
+	"StoredResult":         StoredResult{},
+	"SweepStep":            SweepStep{Error: "timeout", Code: ERR_TIMEOUT},
+	"SweepSummary":         SweepSummary{FirstLossyPacketBytes: 1469},
+	"TCPConnectResult":     TCPConnectResult{ConnectMs: 1, Dial: &nettest.DialReport{}, Error: "connection refused"},
+	"TCPECNReport":         nettest.TCPECNReport{},
+	"TCPPrediction":        TCPPrediction{},
+	"TLSCertificate":       TLSCertificate{},
+	"TLSReport":            TLSReport{},
+	"TLSTimings":           TLSTimings{},
+	"TLSVersionProbe":      TLSVersionProbe{CipherSuite: "TLS_AES_128_GCM_SHA256", ALPN: "h2", HandshakeMs: 1, Failure: TLS_FAILURE_RESET, Error: "reset"},
+	"TestSlot":             TestSlot{},
+	"TraceHop":             TraceHop{},
+	"TransferTimings":      TransferTimings{},
+	"HTTPTimings":          HTTPTimings{},
+	"TunnelReport":         TunnelReport{},
+	"TwampRawProbe":        TwampRawProbe{TwampRawReply: &TwampRawReply{ClockStep: true, Duplicate: true}},
+	"TwampServerConfig":    TwampServerConfig{},
+	"TwampServerStatus":    TwampServerStatus{},
+	"TwampSessionSpec":     TwampSessionSpec{},
+	"TypeAggregate":        TypeAggregate{},
+	"UDPECNReport":         nettest.UDPECNReport{},
+	"WebhookPayload":       WebhookPayload{},
+}
@@ -0,0 +1,950 @@
+package api
+
+import "net/http"
+
+// apiTags are the sections of the documentation, in order
+var apiTags = []apiTag{
+	{Name: "iperf", Title: "iperf3 Bandwidth Test"},
+	{Name: "twamp", Title: "TWAMP Test"},
+	{Name: "transfer", Title: "File Transfer Test"},
+	{Name: "http", Title: "HTTP Timing Test"},
+	{Name: "s3", Title: "Object Storage Test"},
+	{Name: "ssh", Title: "SSH Transfer Test"},
+	{Name: "pmtu", Title: "Path MTU Test"},
+	{Name: "stun", Title: "NAT / STUN Test"},
+	{Name: "nat64", Title: "NAT64 / DNS64 Test"},
+	{Name: "ping", Title: "Ping Test"},
+	{Name: "traceroute", Title: "Traceroute"},
+	{Name: "owamp", Title: "OWAMP One-Way Test"},
+	{Name: "tls", Title: "TLS Handshake Test"},
+	{Name: "ndt7", Title: "NDT7 Speed Test"},
+	{Name: "bufferbloat", Title: "Bufferbloat Test"},
+	{Name: "rpm", Title: "RPM Responsiveness Test"},
+	{Name: "tcp-connect", Title: "TCP Connect Test"},
+	{Name: "mesh", Title: "Mesh Runs", Description: "Run one test template against many targets in one request, a few at a time, and get the key metrics of every target back as a matrix. Each test is stored and delivered like a test of its own; one that fails is a row with its error, not a failure of the run."},
+	{Name: "peers", Title: "Agent Mesh", Description: "Have several instances of this API test each other: every peer in `MESH_PEERS` or found through `MESH_PEERS_DNS` runs the client side towards every other, with the responder started on each for the run, and the results come back as a site-to-site matrix. `MESH_PEERS_API_KEY` is sent to peers with API keys."},
+	{Name: "twamp-server", Title: "TWAMP Reflector", Description: "Run the agent as a TWAMP reflector: a TWAMP-Control server on TCP port 862 and an RFC 5357 Session-Reflector that timestamps and echoes test packets, so perfSONAR or another instance of this API can measure towards it. Only unauthenticated mode is offered."},
+	{Name: "echo-server", Title: "UDP Echo Responder", Description: "Run the agent as the responder of ping tests with protocol echo, where neither TWAMP nor ICMP gets through: it sends every echo probe back to where it came from, marked as a reply, and drops every other datagram."},
+	{Name: "results", Title: "Stored Results", Description: "Every successful test returns its result ID as `data.id` and is stored with its request parameters, so runs can be listed, compared before and after a change, aggregated over a time window and exported as Flent data files. `RESULTS_FILE` persists the results across restarts and `RESULTS_MAX` sets how many are kept (default: 1000)."},
+	{Name: "jobs", Title: "Asynchronous Jobs", Description: "Add `?async=true` to any client run endpoint to start the test in the background: the request answers `202 Accepted` with a job ID at once, and `GET /jobs/{id}` polls it. Running iperf3 and TWAMP jobs report partial results, per-second throughput or per-probe RTT so far, in `progress`; finished jobs carry the response data a synchronous request returns, or its error and HTTP status."},
+	{Name: "schedules", Title: "Schedules", Description: "Run a test request at a fixed interval, for recurring tests and background monitors. The request is re-resolved against the target's profile on every run. A schedule with an `alert` notifies a webhook, a Slack-compatible webhook or mail recipients when its results breach thresholds for several runs in a row, and again when they recover."},
+	{Name: "locks", Title: "Coordination Locks", Description: "iperf3 and TWAMP `mode: loss` tests lock their server, and their uplink when the request sets `uplink`, so two bandwidth-heavy tests do not spoil each other's measurements. Agents started with `COORDINATOR_URL` take these leases from the agent it points to."},
+	{Name: "webhooks", Title: "Webhook Deliveries", Description: "Requests with `callback_url` have their stored result POSTed there once the test completes, retried with backoff up to `WEBHOOK_MAX_ATTEMPTS` times. Deliveries that exhausted their retries are dead until redelivered."},
+	{Name: "impairments", Title: "Impairments", Description: "Add delay, jitter, loss and a rate limit to a lab interface with tc/netem. Disabled unless `ADMIN_TOKEN` is set; only interfaces listed in `NETEM_INTERFACES` are touched."},
+	{Name: "metrics", Title: "Metrics"},
+	{Name: "profiles", Title: "Profiles"},
+	{Name: "config", Title: "Configuration", Description: "Settings are environment variables, which a JSON `CONFIG_FILE` can set as well; the environment wins over the file."},
+	{Name: "status", Title: "Test Status"},
+	{Name: "health", Title: "Health Check"},
+	{Name: "docs", Title: "Documentation"},
+}
+
+// apiOperations document every route, in documentation order
+var apiOperations = []apiOperation{
+	{
+		Method:      http.MethodPost,
+		Path:        "/iperf/client/run",
+		OperationID: "iperfClientRun",
+		Tag:         "iperf",
+		Description: "Run an iperf3 bandwidth test to a target iperf3 server. Uses native iperf3 protocol implementation - compatible with any standard iperf3 server (e.g., iperf.he.net).",
+		Body:        "Iperf3Request",
+		BodyExample: `{"server_host": "iperf.example.com", "server_port": 5201, "duration": 10, "parallel": 4, "protocol": "TCP"}`,
+		Run:         true,
+		Response:    "Iperf3Response",
+		ResponseExample: `{
+  "status": "ok",
+  "data": {
+    "server": "iperf.he.net",
+    "port": 5201,
+    "protocol": "TCP",
+    "duration_sec": 10.0,
+    "sent_bytes": 1250000000,
+    "bandwidth_mbps": 1000.0
+  }
+}`,
+	},
+	{
+		Method:      http.MethodPost,
+		Path:        "/twamp/client/run",
+		OperationID: "twampClientRun",
+		Tag:         "twamp",
+		Description: "Run a TWAMP (Two-Way Active Measurement Protocol) latency test to measure round-trip time, one-way delays, jitter, and packet loss. Compatible with perfSONAR twampd servers.",
+		Body:        "TwampRequest",
+		BodyExample: `{"server_host": "twamp.example.com", "server_port": 862, "count": 20}`,
+		Run:         true,
+		Response:    "TwampResponse",
+		ResponseExample: `{
+  "status": "ok",
+  "data": {
+    "server": "twamp.example.com",
+    "local_endpoint": "192.168.1.100:19234",
+    "remote_endpoint": "203.0.113.50:18760",
+    "probes": 20,
+    "loss_percent": 0.0,
+    "rtt_min_ms": 28.5,
+    "rtt_max_ms": 35.2,
+    "rtt_avg_ms": 31.8,
+    "rtt_stddev_ms": 1.2,
+    "rtt_median_ms": 31.6,
+    "rtt_mad_ms": 0.7,
+    "reflector_turnaround_ms": {"min": 0.05, "max": 0.15, "avg": 0.08, "median": 0.08, "mad": 0.02},
+    "estimated_clock_offset_ms": 0.15,
+    "sync_status": {"sender_synced": true, "reflector_synced": true, "both_synced": true},
+    "forward_delay_raw_ms": {"min": 14.1, "max": 17.8, "avg": 15.9, "median": 15.8, "mad": 0.4},
+    "forward_delay_corrected_ms": {"min": 14.25, "max": 17.6, "avg": 15.9, "median": 15.8, "mad": 0.35},
+    "forward_ipdv_ms": {"min": -1.2, "max": 1.5, "avg": 0.01, "mean_abs": 0.45},
+    "forward_jitter_ms": 0.52,
+    "reverse_delay_raw_ms": {"min": 14.2, "max": 17.6, "avg": 15.9, "median": 15.85, "mad": 0.4},
+    "reverse_delay_corrected_ms": {"min": 14.25, "max": 17.6, "avg": 15.9, "median": 15.8, "mad": 0.35},
+    "reverse_ipdv_ms": {"min": -1.1, "max": 1.3, "avg": -0.02, "mean_abs": 0.42},
+    "reverse_jitter_ms": 0.48,
+    "percentiles_ms": {"rtt": {"p50": 31.6, "p90": 33.4, "p95": 34.1, "p99": 35.0, "p99_9": 35.18}, "forward_delay": {"p50": 15.8, "p90": 16.9, "p95": 17.2, "p99": 17.7, "p99_9": 17.79}, "reverse_delay": {"p50": 15.85, "p90": 16.8, "p95": 17.1, "p99": 17.5, "p99_9": 17.59}},
+    "hops": {"forward": {"min": 10, "max": 10, "avg": 10}, "reverse": {"min": 10, "max": 10, "avg": 10}}
+  }
+}`,
+		Tip: &OpenAPITip{
+			Title: "Jitter Measurement (RFC 3393 & RFC 3550)",
+			Text:  "Jitter is calculated using RFC-compliant methods. IPDV (IP Packet Delay Variation, RFC 3393) measures the difference in delay between consecutive packets - clock offset cancels out, giving true one-way delay variation. The jitter value uses RFC 3550's exponentially smoothed mean absolute IPDV. Hop counts are derived from TTL values.",
+		},
+	},
+	{
+		Method:          http.MethodPost,
+		Path:            "/transfer/client/run",
+		OperationID:     "transferClientRun",
+		Tag:             "transfer",
+		Description:     "Download or upload a file over HTTP(S) or FTP and report goodput and phase timings, for CDNs and customer file servers where iperf3 is not an option.",
+		Body:            "TransferRequest",
+		BodyExample:     `{"url": "https://cdn.example.com/100MB.bin", "size": 52428800}`,
+		Run:             true,
+		Response:        "TransferResponse",
+		ResponseExample: `{"status": "ok", "data": {"url": "https://cdn.example.com/100MB.bin", "direction": "download", "protocol": "HTTP/1.1", "status_code": 200, "bytes": 52428800, "truncated": true, "goodput_mbps": 412.7, "timings": {"dial_ms": 14.2, "dns_ms": 2.1, "connect_ms": 12, "tls_ms": 27.9, "request_ms": 0.1, "ttfb_ms": 58.3, "transfer_ms": 1016.3, "total_ms": 1074.6}}}`,
+		Tip: &OpenAPITip{
+			Title: "Goodput",
+			Text:  "Downloads are timed from the first response byte to the end of the body; uploads from the connection being ready to the server's response, so the local socket buffer does not inflate the rate. Redirects are not followed, since they would time a second connection.",
+		},
+	},
+	{
+		Method:          http.MethodPost,
+		Path:            "/http/client/run",
+		OperationID:     "httpClientRun",
+		Tag:             "http",
+		Description:     "Make one HTTP(S) request with Go's HTTP client, HTTP/2 where the server offers it, and report DNS, TCP connect, TLS handshake, server time and time to first byte from httptrace, then the goodput of the body, to hold against iperf3 on the same path. Results are stored as type http.",
+		Body:            "HTTPRequest",
+		BodyExample:     `{"url": "https://cdn.example.com/100MB.bin", "size": 52428800}`,
+		Run:             true,
+		Response:        "HTTPResponse",
+		ResponseExample: `{"status": "ok", "data": {"url": "https://cdn.example.com/100MB.bin", "direction": "download", "protocol": "HTTP/2.0", "status_code": 200, "address": "203.0.113.10:443", "family": "ipv4", "bytes": 52428800, "truncated": true, "goodput_mbps": 405.3, "timings": {"dns_ms": 2.1, "connect_ms": 12, "tls_ms": 27.9, "request_ms": 0.1, "server_ms": 15.8, "ttfb_ms": 58.3, "transfer_ms": 1034.9, "total_ms": 1120.4}}}`,
+	},
+	{
+		Method:          http.MethodPost,
+		Path:            "/s3/client/run",
+		OperationID:     "s3ClientRun",
+		Tag:             "s3",
+		Description:     "Multipart upload an object to S3-compatible storage (AWS S3, MinIO, Ceph RGW), download it again with ranged GETs and report per-part and aggregate throughput plus request latencies.",
+		Body:            "S3Request",
+		BodyExample:     `{"endpoint": "https://minio.example.com:9000", "bucket": "nettest", "credentials": "minio-lab", "size": 268435456, "parallel": 8}`,
+		Run:             true,
+		Response:        "S3Response",
+		ResponseExample: `{"status": "ok", "data": {"bucket": "nettest", "part_count": 32, "upload": {"bytes": 268435456, "throughput_mbps": 842.1, "latency_ms": {"p50": 18.4, "p95": 41.2}}, "download": {"bytes": 268435456, "throughput_mbps": 1630.5, "latency_ms": {"p50": 6.1, "p95": 12.9}}, "requests": {"create_ms": 9.8, "complete_ms": 35.2, "delete_ms": 7.4}}}`,
+		Tip: &OpenAPITip{
+			Title: "Credentials",
+			Text:  "Keys are never sent in the request: credentials names an entry of the SECRETS_FILE the agent was started with. Requests are signed with AWS Signature Version 4; part bodies are sent as UNSIGNED-PAYLOAD, so use https outside the lab.",
+		},
+	},
+	{
+		Method:          http.MethodPost,
+		Path:            "/ssh/client/run",
+		OperationID:     "sshClientRun",
+		Tag:             "ssh",
+		Description:     "Upload or download a file over SSH with scp or sftp, for links that only allow SSH. Key exchange and authentication are timed separately from the bulk transfer, so connection setup cost and throughput can be told apart.",
+		Body:            "SSHRequest",
+		BodyExample:     `{"server_host": "backup.example.com", "credentials": "backup-ssh", "protocol": "sftp", "direction": "upload", "remote_path": "/srv/scratch/nettest.bin", "size": 104857600}`,
+		Run:             true,
+		Response:        "SSHResponse",
+		ResponseExample: `{"status": "ok", "data": {"protocol": "sftp", "direction": "upload", "bytes": 104857600, "goodput_mbps": 412.7, "timings": {"dial_ms": 11.8, "kex_ms": 24.6, "auth_ms": 13.1, "setup_ms": 49.5, "channel_ms": 24.9, "transfer_ms": 2032.6, "total_ms": 2108.4}, "ssh": {"server_version": "SSH-2.0-OpenSSH_9.6", "kex": "curve25519-sha256", "cipher": "aes128-gcm@openssh.com", "auth_method": "publickey"}}}`,
+		Tip: &OpenAPITip{
+			Title: "Credentials and Host Keys",
+			Text:  "Keys and passwords are never sent in the request: credentials names an entry of the SECRETS_FILE the agent was started with. The host key must match host_key_fingerprint (or the entry's host_key_fingerprint) or, without one, a key the SSH_KNOWN_HOSTS file lists for the server; otherwise the test fails before any credentials are sent, unless insecure_skip_host_key is set.",
+		},
+	},
+	{
+		Method:          http.MethodPost,
+		Path:            "/pmtu/client/run",
+		OperationID:     "pmtuClientRun",
+		Tag:             "pmtu",
+		Description:     "Probe the path with DF-set packets at the sizes tunnels and access links commonly cut the MTU to, then bisect to the largest size that gets through. Sizes that vanish without ICMP feedback reveal PMTUD blackholes, and the server's MSS shows clamping or segments too large for the path: a frequent cause of slow VPNs. When routers do send feedback, TTL-limited echo requests find the hop where fragmentation begins.",
+		Body:            "PMTURequest",
+		BodyExample:     `{"server_host": "twamp.example.com"}`,
+		Run:             true,
+		Response:        "PMTUResponse",
+		ResponseExample: `{"status": "ok", "data": {"protocol": "udp", "family": "ipv4", "route_mtu": 1500, "largest_passing": 1420, "smallest_failing": 1421, "icmp_feedback": false, "blackhole": true, "tcp_mss": 1448, "mss_mtu": 1500, "mss_clamped": false, "mss_exceeds_path": true}}`,
+		Tip: &OpenAPITip{
+			Title: "Linux Only",
+			Text:  "ICMP feedback and TCP acknowledgements are read from socket state only Linux exposes, so other agents reject the test. Each size costs up to a second (udp, icmp) or two (tcp) when it fails, so a blackholed path takes 10-20 seconds. Protocol icmp and locating the bottleneck need a raw ICMP socket (root or CAP_NET_RAW); without one the bottleneck is left out.",
+		},
+	},
+	{
+		Method:          http.MethodPost,
+		Path:            "/mtu/client/run",
+		OperationID:     "mtuClientRun",
+		Tag:             "pmtu",
+		Description:     "The same path MTU test as POST /pmtu/client/run, under the name most MTU tools go by.",
+		Body:            "PMTURequest",
+		BodyExample:     `{"server_host": "vpn-gw.example.com", "protocol": "icmp"}`,
+		Run:             true,
+		Response:        "PMTUResponse",
+		ResponseExample: `{"status": "ok", "data": {"protocol": "icmp", "family": "ipv4", "address": "203.0.113.50", "route_mtu": 1500, "largest_passing": 1420, "smallest_failing": 1421, "icmp_feedback": true, "reported_mtu": 1420, "blackhole": false, "bottleneck": {"hop": 4, "router": "198.51.100.9", "mtu": 1420, "size": 1421}}}`,
+	},
+	{
+		Method:          http.MethodPost,
+		Path:            "/stun/client/run",
+		OperationID:     "stunClientRun",
+		Tag:             "stun",
+		Description:     "Ask STUN servers for the agent's public address and run the RFC 5780 behavior tests: whether the NAT mapping depends on the destination, which sources may send back through it, and whether it loops traffic to its own public address back in. A symmetric NAT or blocked UDP explains why TWAMP Light and QUIC fail from a site while TCP tests pass.",
+		Body:            "STUNRequest",
+		BodyExample:     `{"server_host": "stun.example.com", "stun_servers": ["stun2.example.net:3478"]}`,
+		Run:             true,
+		Response:        "STUNResponse",
+		ResponseExample: `{"status": "ok", "data": {"family": "ipv4", "local_address": "192.168.1.20:51324", "public_address": "203.0.113.5:51324", "behind_nat": true, "port_preserved": true, "mapping": "endpoint_independent", "filtering": "address_and_port_dependent", "nat_type": "port_restricted_cone", "hairpinning": false, "rfc5780": true}}`,
+		Tip: &OpenAPITip{
+			Title: "Server Support",
+			Text:  "Most public STUN servers only answer Binding requests: mapping then comes from comparing the public address several stun_servers saw, and filtering stays unknown. Run an RFC 5780 server with two addresses (such as coturn with an alternate address configured) to classify filtering too.",
+		},
+	},
+	{
+		Method:          http.MethodPost,
+		Path:            "/nat64/client/run",
+		OperationID:     "nat64ClientRun",
+		Tag:             "nat64",
+		Description:     "Find out whether the agent sits behind DNS64/NAT64: the translation prefix is learned from the AAAA records of ipv4only.arpa (RFC 7050), the IPv4-only target is connected to through it and directly, and the target is dialed as other tests do to report the path they take. Dials of every test carry nat64 and ipv4_address when they went through a translator.",
+		Body:            "NAT64Request",
+		BodyExample:     `{"server_host": "ipv4only.example.com"}`,
+		Run:             true,
+		Response:        "NAT64Response",
+		ResponseExample: `{"status": "ok", "data": {"ipv4_route": false, "ipv6_route": true, "ipv6_only": true, "dns64": true, "prefixes": [{"prefix": "64:ff9b::/96", "well_known": true, "source": "dns64"}], "target_ipv4": ["198.51.100.20"], "ipv4_only": true, "nat64_address": "[64:ff9b::c633:6414]:443", "nat64_reachable": true, "nat64_connect_ms": 23.8, "path": "nat64"}}`,
+	},
+	{
+		Method:          http.MethodPost,
+		Path:            "/ping/client/run",
+		OperationID:     "pingClientRun",
+		Tag:             "ping",
+		Description:     "Ping a host with ICMP echo requests at a fixed interval and report loss and RTT min/avg/max/stddev along with every probe. ICMP needs a raw socket (root or CAP_NET_RAW) or, on Linux, an unprivileged ICMP socket allowed by net.ipv4.ping_group_range; without either the test falls back to UDP datagrams to a closed port, whose port unreachable answers time the round trip. Protocol echo sends numbered, timestamped datagrams to a UDP echo responder instead, the agent's own (POST /echo/server/start) or any RFC 862 echo server, where neither TWAMP nor ICMP gets through.",
+		Body:            "PingRequest",
+		BodyExample:     `{"server_host": "192.0.2.10", "count": 3, "interval": 0.2}`,
+		Run:             true,
+		Response:        "PingResponse",
+		ResponseExample: `{"status": "ok", "data": {"protocol": "icmp", "socket": "datagram", "family": "ipv4", "address": "192.0.2.10", "packet_size": 56, "ttl": 64, "transmitted": 3, "received": 3, "errors": 0, "duplicates": 0, "loss_percent": 0, "rtt_min_ms": 11.2, "rtt_avg_ms": 11.9, "rtt_max_ms": 12.8, "rtt_stddev_ms": 0.66, "rtt_median_ms": 11.7, "rtt_mad_ms": 0.5, "probes": [{"seq": 0, "status": "reply", "rtt_ms": 12.8, "ttl": 57}, {"seq": 1, "status": "reply", "rtt_ms": 11.2, "ttl": 57}, {"seq": 2, "status": "reply", "rtt_ms": 11.7, "ttl": 57}]}}`,
+	},
+	{
+		Method:          http.MethodPost,
+		Path:            "/traceroute/client/run",
+		OperationID:     "tracerouteClientRun",
+		Tag:             "traceroute",
+		Description:     "Trace the path to a host: probes are sent with TTL 1, 2, 3 and so on, and each router on the way answers with ICMP time exceeded until the target itself answers. Reports every hop's address, reverse DNS name, loss and RTT statistics, the real path that the TTL-based hop estimate of TWAMP only approximates. ICMP and TCP probes need root or CAP_NET_RAW for the raw socket their answers arrive on; UDP probes work without on Linux.",
+		Body:            "TracerouteRequest",
+		BodyExample:     `{"server_host": "198.51.100.7", "probes_per_hop": 2}`,
+		Run:             true,
+		Response:        "TracerouteResponse",
+		ResponseExample: `{"status": "ok", "data": {"protocol": "udp", "socket": "raw", "family": "ipv4", "address": "198.51.100.7", "port": 33434, "reached": true, "hop_count": 2, "rtt_avg_ms": 9.8, "hops": [{"ttl": 1, "address": "192.0.2.1", "name": "gw.example.net", "sent": 2, "received": 2, "loss_percent": 0, "rtt_min_ms": 0.4, "rtt_avg_ms": 0.5, "rtt_max_ms": 0.6, "rtt_stddev_ms": 0.1, "probes": [{"seq": 0, "status": "ttl_exceeded", "rtt_ms": 0.6, "from": "192.0.2.1"}, {"seq": 1, "status": "ttl_exceeded", "rtt_ms": 0.4, "from": "192.0.2.1"}]}, {"ttl": 2, "address": "198.51.100.7", "sent": 2, "received": 2, "loss_percent": 0, "rtt_min_ms": 9.6, "rtt_avg_ms": 9.8, "rtt_max_ms": 10, "rtt_stddev_ms": 0.2, "probes": [{"seq": 0, "status": "port_unreachable", "rtt_ms": 10, "from": "198.51.100.7"}, {"seq": 1, "status": "port_unreachable", "rtt_ms": 9.6, "from": "198.51.100.7"}]}]}}`,
+	},
+	{
+		Method:          http.MethodPost,
+		Path:            "/owamp/client/run",
+		OperationID:     "owampClientRun",
+		Tag:             "owamp",
+		Description:     "Measure one-way delay and loss towards a perfSONAR owampd (RFC 4656): a receive session is requested over OWAMP-Control on port 861, the agent sends the test packets at a fixed interval, and the server's records of them are fetched with Fetch-Session. Each delay is the receive time less the send time, so it is a true one-way delay when both clocks are synchronized, which sync_status tells from the records' error estimates; TWAMP only infers one-way delays by assuming a symmetric path. Only unauthenticated mode is offered.",
+		Body:            "OwampRequest",
+		BodyExample:     `{"server_host": "owamp.example.net", "count": 100, "interval": 0.1}`,
+		Run:             true,
+		Response:        "OwampResponse",
+		ResponseExample: `{"status": "ok", "data": {"server": "owamp.example.net", "port": 861, "local_endpoint": "192.0.2.10:41822", "remote_endpoint": "198.51.100.7:8817", "dscp": 0, "padding": 0, "interval_sec": 0.1, "sent": 100, "received": 99, "lost": 1, "loss_percent": 1, "duplicates": 0, "reordered": 0, "reordered_percent": 0, "delay_min_ms": 11.82, "delay_avg_ms": 12.36, "delay_max_ms": 14.9, "delay_stddev_ms": 0.41, "percentiles_ms": {"p50": 12.3, "p90": 12.8, "p95": 13.1, "p99": 14.2, "p99_9": 14.83}, "jitter_ms": 0.22, "ipdv_ms": {"min": -1.9, "max": 2.4}, "hops": {"min": 9, "max": 9}, "sync_status": {"sender_synced": true, "receiver_synced": true, "both_synced": true}, "finished": true, "duration_sec": 13.4}}`,
+	},
+	{
+		Method:          http.MethodPost,
+		Path:            "/tls/client/run",
+		OperationID:     "tlsClientRun",
+		Tag:             "tls",
+		Description:     "Connect to a TLS server and time the handshake apart from the name lookup and the TCP connect, reporting the negotiated version, cipher suite and ALPN protocol and the certificate chain: subject, issuer, SANs and expiry of each certificate, whether it validates against root_store, and the stapled OCSP status. tls_versions repeats the handshake pinned to each version; a version the server refuses fails with an alert, while a reset, a close without an alert or a timeout points to a middlebox interfering with the ClientHello.",
+		Body:            "TLSRequest",
+		BodyExample:     `{"server_host": "www.example.net", "tls_versions": ["1.2", "1.3"]}`,
+		Run:             true,
+		Response:        "TLSResponse",
+		ResponseExample: `{"status": "ok", "data": {"server": "www.example.net", "port": 443, "server_name": "www.example.net", "version": "TLS 1.3", "cipher_suite": "TLS_AES_128_GCM_SHA256", "alpn": "h2", "alpn_offered": ["h2", "http/1.1"], "timings": {"dns_ms": 3.1, "connect_ms": 11.8, "handshake_ms": 24.6, "total_ms": 39.7}, "tls": {"version": "TLS 1.3", "cipher_suite": "TLS_AES_128_GCM_SHA256", "server_name": "www.example.net", "root_store": "system", "verified": true, "trust_anchor": "CN=ISRG Root X1,O=Internet Security Research Group,C=US", "days_to_expiry": 29, "chain": [{"subject": "CN=www.example.net", "issuer": "CN=R11,O=Let's Encrypt,C=US", "serial_number": "04a1b8c2f3", "not_before": "2026-08-14T08:12:40Z", "not_after": "2026-11-12T08:12:39Z", "days_to_expiry": 29, "dns_names": ["www.example.net", "example.net"], "is_ca": false, "key_type": "ECDSA P-256", "signature_algorithm": "SHA256-RSA", "sha256_fingerprint": "6f1c0e5a9b2d"}], "ocsp": {"stapled": false}}, "versions": [{"version": "1.2", "supported": true, "cipher_suite": "TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256", "alpn": "h2", "connect_ms": 11.6, "handshake_ms": 36.2}, {"version": "1.3", "supported": true, "cipher_suite": "TLS_AES_128_GCM_SHA256", "alpn": "h2", "connect_ms": 11.9, "handshake_ms": 24.1}], "duration_sec": 0.15}}`,
+	},
+	{
+		Method:          http.MethodPost,
+		Path:            "/ndt7/client/run",
+		OperationID:     "ndt7ClientRun",
+		Tag:             "ndt7",
+		Description:     "Run an NDT7 speed test, the M-Lab ndt7 protocol over a WebSocket: a download and an upload of about 10 seconds each, reporting the throughput and the minimum RTT and retransmissions from the server's TCP_INFO. Without server_host, the nearest server of the public M-Lab pool is asked for with the Locate API, for when no iperf3 server of one's own is at hand.",
+		Body:            "NDT7Request",
+		BodyExample:     `{"direction": "both"}`,
+		Run:             true,
+		Response:        "NDT7Response",
+		ResponseExample: `{"status": "ok", "data": {"server": "ndt-mlab1-fra05.mlab-oti.measurement-lab.org", "port": 443, "protocol": "wss", "direction": "both", "located": {"machine": "mlab1-fra05.mlab-oti.measurement-lab.org", "city": "Frankfurt", "country": "DE"}, "download": {"throughput_mbps": 412.7, "bytes": 516120576, "duration_sec": 10.004, "min_rtt_ms": 11.62, "rtt_ms": 14.35, "rtt_var_ms": 1.21, "retransmit_percent": 0.42, "measurements": 40, "client_address": "192.0.2.10:51234", "uuid": "ndt-k8wq2_1728918000_0000000000A1B2C3"}, "upload": {"throughput_mbps": 38.1, "bytes": 47644672, "sent_bytes": 48234496, "duration_sec": 10.003, "min_rtt_ms": 11.8, "rtt_ms": 62.4, "rtt_var_ms": 8.7, "measurements": 40, "client_address": "192.0.2.10:51236", "uuid": "ndt-k8wq2_1728918000_0000000000A1B2C4"}, "duration_sec": 21.3}}`,
+	},
+	{
+		Method:          http.MethodPost,
+		Path:            "/bufferbloat/client/run",
+		OperationID:     "bufferbloatClientRun",
+		Tag:             "bufferbloat",
+		Description:     "Measure latency under load: TWAMP (or ping) probes run through the whole test, first without load for the idle baseline, then while an iperf3 TCP load saturates the link towards server_host in each direction. Each load reports its throughput, the latency under it and the increase of the median RTT over the idle median, graded A+ to F; the worst grade is the test's.",
+		Body:            "BufferbloatRequest",
+		BodyExample:     `{"server_host": "iperf.example.net", "probe": "twamp", "duration": 10}`,
+		Run:             true,
+		Response:        "BufferbloatResponse",
+		ResponseExample: `{"status": "ok", "data": {"server": "iperf.example.net", "port": 5201, "direction": "both", "parallel": 4, "bandwidth": 10000, "probe": {"type": "twamp", "host": "iperf.example.net", "port": 862, "interval_sec": 0.1}, "idle": {"start_sec": 0, "end_sec": 5, "sent": 50, "received": 50, "loss_percent": 0, "rtt_min_ms": 11.2, "rtt_avg_ms": 11.9, "rtt_max_ms": 13.4, "rtt_stddev_ms": 0.4, "percentiles_ms": {"p50": 11.8, "p90": 12.4, "p95": 12.7, "p99": 13.3, "p99_9": 13.4}}, "download": {"throughput_mbps": 481.2, "retransmits": 312, "duration_sec": 10, "latency": {"start_sec": 7.6, "end_sec": 15.6, "sent": 80, "received": 80, "loss_percent": 0, "rtt_min_ms": 14.1, "rtt_avg_ms": 38.5, "rtt_max_ms": 61.2, "rtt_stddev_ms": 9.8, "percentiles_ms": {"p50": 37.9, "p90": 51.3, "p95": 55.0, "p99": 60.1, "p99_9": 61.2}}, "latency_increase_ms": 26.1, "p95_increase_ms": 42.3, "grade": "A"}, "upload": {"throughput_mbps": 38.4, "retransmits": 95, "duration_sec": 10, "latency": {"start_sec": 20.1, "end_sec": 28.1, "sent": 80, "received": 78, "loss_percent": 2.5, "rtt_min_ms": 40.3, "rtt_avg_ms": 142.6, "rtt_max_ms": 211.8, "rtt_stddev_ms": 31.2, "percentiles_ms": {"p50": 139.4, "p90": 180.2, "p95": 192.5, "p99": 208.9, "p99_9": 211.8}}, "latency_increase_ms": 127.6, "p95_increase_ms": 179.8, "grade": "C"}, "latency_increase_ms": 127.6, "grade": "C", "duration_sec": 33.4}}`,
+	},
+	{
+		Method:          http.MethodPost,
+		Path:            "/rpm/client/run",
+		OperationID:     "rpmClientRun",
+		Tag:             "rpm",
+		Description:     "Measure responsiveness under working conditions with the IETF IPPM method networkQuality implements: HTTP/2 load-generating connections to the server of a networkQuality configuration saturate the link, more added each second until the goodput stops growing; then foreign probes on fresh connections and self probes on the loaded ones time their round trips. The RPM score is the round trips per minute of their trimmed means.",
+		Body:            "RPMRequest",
+		BodyExample:     `{"direction": "both", "duration": 20}`,
+		Run:             true,
+		Response:        "RPMResponse",
+		ResponseExample: `{"status": "ok", "data": {"config_url": "https://mensura.cdn-apple.com/api/v1/gm/config", "server": "mensura.cdn-apple.com", "port": 443, "direction": "both", "rpm": 868, "saturated": true, "working_after_sec": 7.0, "foreign": {"probes": 128, "failed": 0, "tcp_ms": 31.4, "tls_ms": 36.2, "http_ms": 34.9}, "self": {"probes": 130, "failed": 0, "http_ms": 104.1}, "download": {"throughput_mbps": 412.7, "bytes": 671088640, "connections": 9}, "upload": {"throughput_mbps": 38.2, "bytes": 62117888, "connections": 9}, "duration_sec": 21.6}}`,
+	},
+	{
+		Method:          http.MethodPost,
+		Path:            "/tcp/connect/run",
+		OperationID:     "tcpConnectRun",
+		Tag:             "tcp-connect",
+		Description:     "Check that services are reachable at all before heavier tests: one TCP connect to each host:port target, a few at a time, reporting the connect time or why it failed (refused, timeout, unreachable or resolve_failed). Connections are closed as soon as they are up; nothing is sent.",
+		Body:            "TCPConnectRequest",
+		BodyExample:     `{"targets": ["iperf.example.net:5201", "iperf.example.net:862", "198.51.100.7:443"], "connect_timeout": 2}`,
+		Run:             true,
+		Response:        "TCPConnectResponse",
+		ResponseExample: `{"status": "ok", "data": {"targets": 3, "reachable": 2, "unreachable": 1, "reachable_percent": 66.7, "parallel": 16, "connect_timeout": 2, "results": [{"target": "iperf.example.net:5201", "host": "iperf.example.net", "port": 5201, "status": "open", "reachable": true, "connect_ms": 11.8}, {"target": "iperf.example.net:862", "host": "iperf.example.net", "port": 862, "status": "refused", "reachable": false, "error": "dial tcp 203.0.113.10:862: connect: connection refused"}, {"target": "198.51.100.7:443", "host": "198.51.100.7", "port": 443, "status": "open", "reachable": true, "connect_ms": 24.3}], "duration_sec": 0.03}}`,
+	},
+	{
+		Method:          http.MethodPost,
+		Path:            "/mesh/run",
+		OperationID:     "meshRun",
+		Tag:             "mesh",
+		Description:     "Run the request template against every target, parallel at a time. Every test is validated before any runs: an invalid one fails the whole request with its index in targets. Each test counts against the API key's tests_per_hour.",
+		Body:            "MeshRequest",
+		BodyExample:     `{"type": "ping", "targets": ["edge1.example.net", "edge2.example.net", "edge3.example.net"], "request": {"count": 20}}`,
+		Run:             true,
+		Response:        "MeshResponse",
+		ResponseExample: `{"status": "ok", "data": {"type": "ping", "targets": 3, "succeeded": 2, "failed": 1, "parallel": 4, "metrics": ["rtt_avg_ms", "loss_percent"], "results": [{"target": "edge1.example.net", "status": "ok", "result_id": "1d9cb97159106d3d", "metrics": {"rtt_avg_ms": 11.9, "loss_percent": 0}, "duration_sec": 19.1}, {"target": "edge2.example.net", "status": "ok", "result_id": "5be1c07d2a94f316", "metrics": {"rtt_avg_ms": 48.2, "loss_percent": 5}, "duration_sec": 19.2}, {"target": "edge3.example.net", "status": "error", "error": "lookup edge3.example.net: no such host", "http_status": 500, "duration_sec": 0.01}], "duration_sec": 19.2}}`,
+	},
+	{
+		Method:          http.MethodGet,
+		Path:            "/peers",
+		OperationID:     "peerList",
+		Tag:             "peers",
+		Description:     "The peers of agent mesh runs, looked up again in MESH_PEERS_DNS, with the health of each. Returns 404 without MESH_PEERS or MESH_PEERS_DNS and 502 when the DNS lookup fails",
+		Response:        "[]PeerStatus",
+		ResponseExample: `{"status": "ok", "data": [{"name": "agent-fra1.example.net", "url": "http://agent-fra1.example.net:8080", "status": "healthy"}, {"name": "agent-ams1.example.net", "url": "http://agent-ams1.example.net:8080", "status": "healthy"}, {"name": "agent-lon1.example.net", "url": "http://agent-lon1.example.net:8080", "status": "unreachable", "error": "dial tcp 198.51.100.30:8080: i/o timeout"}]}`,
+	},
+	{
+		Method:          http.MethodPost,
+		Path:            "/peers/mesh/run",
+		OperationID:     "peerMeshRun",
+		Tag:             "peers",
+		Description:     "Run a TWAMP or ping test between every ordered pair of peers, parallel at a time. The TWAMP reflector, or the UDP echo responder of ping protocol echo, is started on every peer first, and stopped again where this run started it. A pair whose source or destination is down, or whose test fails, is a row with its error.",
+		Body:            "PeerMeshRequest",
+		BodyExample:     `{"type": "twamp", "request": {"count": 100, "dscp": 46}}`,
+		Run:             true,
+		Response:        "PeerMeshResponse",
+		ResponseExample: `{"status": "ok", "data": {"type": "twamp", "peers": [{"name": "agent-fra1.example.net", "url": "http://agent-fra1.example.net:8080", "status": "healthy", "responder": "started"}, {"name": "agent-ams1.example.net", "url": "http://agent-ams1.example.net:8080", "status": "healthy", "responder": "running"}], "pairs": 2, "succeeded": 2, "failed": 0, "parallel": 4, "metrics": ["rtt_avg_ms", "loss_percent"], "matrix": {"agent-fra1.example.net": {"agent-ams1.example.net": {"rtt_avg_ms": 8.4, "loss_percent": 0}}, "agent-ams1.example.net": {"agent-fra1.example.net": {"rtt_avg_ms": 8.6, "loss_percent": 1}}}, "results": [{"source": "agent-fra1.example.net", "destination": "agent-ams1.example.net", "status": "ok", "result_id": "1d9cb97159106d3d", "metrics": {"rtt_avg_ms": 8.4, "loss_percent": 0}, "duration_sec": 101.2}, {"source": "agent-ams1.example.net", "destination": "agent-fra1.example.net", "status": "ok", "result_id": "7a0f3c2d9e8b1a64", "metrics": {"rtt_avg_ms": 8.6, "loss_percent": 1}, "duration_sec": 101.3}], "duration_sec": 101.4}}`,
+	},
+	{
+		Method:      http.MethodPost,
+		Path:        "/twamp/server/start",
+		OperationID: "reflectorStart",
+		Tag:         "twamp-server",
+		Description: "Start the TWAMP reflector. A reflector already running returns 409; a listener that cannot be opened, for example port 862 without CAP_NET_BIND_SERVICE, returns 500",
+		Body:        "TwampServerConfig",
+		BodyExample: `{"port": 862, "max_sessions": 16}`,
+		Optional:    true,
+		Response:    "TwampServerStatus",
+		ResponseExample: `{
+  "status": "ok",
+  "data": {
+    "running": true,
+    "listen": "[::]:862",
+    "control_connections": 1,
+    "sessions_total": 12,
+    "packets_reflected": 1100,
+    "sessions": [
+      {"sid": "c0a80a05ed0f5c2a41f3b9ce8d21a7e4", "client": "192.168.10.20:51544", "receiver_port": 18760, "dscp": 46, "state": "reflecting", "packets_reflected": 40}
+    ]
+  }
+}`,
+	},
+	{
+		Method:          http.MethodPost,
+		Path:            "/twamp/server/stop",
+		OperationID:     "reflectorStop",
+		Tag:             "twamp-server",
+		Description:     "Stop the reflector, closing its control connections and sessions, and return its final counters. Returns 409 when it is not running",
+		Response:        "TwampServerStatus",
+		ResponseExample: `{"status": "ok", "data": {"running": false, "listen": "[::]:862", "started_at": "2026-01-15T10:00:00Z", "stopped_at": "2026-01-15T11:00:00Z", "control_connections": 0, "connections_total": 12, "sessions_total": 12, "sessions_rejected": 0, "packets_reflected": 1100}}`,
+	},
+	{
+		Method:          http.MethodGet,
+		Path:            "/twamp/server",
+		OperationID:     "reflectorStatus",
+		Tag:             "twamp-server",
+		Description:     "Reflector status, counters and the open test sessions",
+		Response:        "TwampServerStatus",
+		ResponseExample: `{"status": "ok", "data": {"running": true, "listen": "[::]:862", "control_connections": 1, "connections_total": 12, "sessions_total": 12, "sessions_rejected": 0, "packets_reflected": 1100, "sessions": [{"sid": "c0a80a05ed0f5c2a41f3b9ce8d21a7e4", "client": "192.168.10.20:51544", "sender_port": 19204, "receiver_port": 18760, "padding_bytes": 0, "dscp": 46, "state": "reflecting", "created_at": "2026-01-15T10:30:00Z", "last_packet_at": "2026-01-15T10:30:04Z", "packets_reflected": 40, "packets_discarded": 0}]}}`,
+	},
+	{
+		Method:          http.MethodPost,
+		Path:            "/echo/server/start",
+		OperationID:     "echoServerStart",
+		Tag:             "echo-server",
+		Description:     "Start the UDP echo responder. A responder already running returns 409; a socket that cannot be opened, for example port 7 without CAP_NET_BIND_SERVICE, returns 500",
+		Body:            "EchoServerConfig",
+		BodyExample:     `{"port": 7}`,
+		Optional:        true,
+		Response:        "EchoServerStatus",
+		ResponseExample: `{"status": "ok", "data": {"running": true, "listen": "[::]:7", "config": {"address": "", "port": 7}, "started_at": "2026-01-15T10:00:00Z", "packets_echoed": 0, "packets_discarded": 0}}`,
+	},
+	{
+		Method:          http.MethodPost,
+		Path:            "/echo/server/stop",
+		OperationID:     "echoServerStop",
+		Tag:             "echo-server",
+		Description:     "Stop the responder and return its final counters. Returns 409 when it is not running",
+		Response:        "EchoServerStatus",
+		ResponseExample: `{"status": "ok", "data": {"running": false, "listen": "[::]:7", "config": {"address": "", "port": 7}, "started_at": "2026-01-15T10:00:00Z", "stopped_at": "2026-01-15T11:00:00Z", "last_packet_at": "2026-01-15T10:59:58Z", "packets_echoed": 36000, "packets_discarded": 3}}`,
+	},
+	{
+		Method:          http.MethodGet,
+		Path:            "/echo/server",
+		OperationID:     "echoServerStatus",
+		Tag:             "echo-server",
+		Description:     "Responder status and counters",
+		Response:        "EchoServerStatus",
+		ResponseExample: `{"status": "ok", "data": {"running": true, "listen": "[::]:7", "config": {"address": "", "port": 7}, "started_at": "2026-01-15T10:00:00Z", "last_packet_at": "2026-01-15T10:30:04Z", "packets_echoed": 18000, "packets_discarded": 3}}`,
+	},
+	{
+		Method:      http.MethodGet,
+		Path:        "/results",
+		OperationID: "resultList",
+		Tag:         "results",
+		Description: "List stored results newest first, with the request params and metrics of each. RESULTS_FILE persists results across restarts; RESULTS_MAX sets how many are kept (default 1000)",
+		Params: []apiField{
+			{Name: "target", Type: "string", Description: "Only include runs against this server_host"},
+			{Name: "type", Type: "string", Description: "Only include runs of this test type"},
+			{Name: "from", Type: "string", Description: "Only include runs that completed at or after this RFC 3339 time"},
+			{Name: "to", Type: "string", Description: "Only include runs that completed before this RFC 3339 time"},
+			{Name: "limit", Type: "integer", Description: "Most runs returned (default 100, max 1000); total counts all that match"},
+		},
+		ExamplePath:     "/results?target=iperf.example.net&from=2026-01-15T00:00:00Z",
+		Output:          true,
+		Response:        "ResultList",
+		ResponseExample: `{"status": "ok", "data": {"total": 214, "results": [{"id": "1d9cb97159106d3d", "type": "iperf3", "target": "iperf.example.net", "created_at": "2026-01-15T10:30:05Z", "params": {"server_host": "iperf.example.net", "duration": 5, "protocol": "TCP"}, "metrics": {"bandwidth_mbps": 94.1, "retransmits": 3}}]}}`,
+	},
+	{
+		Method:      http.MethodGet,
+		Path:        "/results/{id}",
+		OperationID: "resultGet",
+		Tag:         "results",
+		Description: "Fetch a stored test result by the id returned in a test response, with the request params it ran with",
+		Params: []apiField{
+			{Name: "id", Type: "string", Description: "Result ID"},
+		},
+		ExamplePath: "/results/1d9cb97159106d3d",
+		Output:      true,
+		Response:    "StoredResult",
+		ResponseExample: `{
+  "status": "ok",
+  "data": {
+    "id": "1d9cb97159106d3d",
+    "type": "iperf3",
+    "target": "iperf.he.net",
+    "started_at": "2026-01-15T10:30:00Z",
+    "created_at": "2026-01-15T10:30:05Z",
+    "params": {"server_host": "iperf.he.net", "duration": 5, "protocol": "TCP"},
+    "data": {"id": "1d9cb97159106d3d", "server": "iperf.he.net", "port": 5201, "protocol": "TCP", "duration_sec": 5.0, "bandwidth_mbps": 94.1, "retransmits": 3}
+  }
+}`,
+	},
+	{
+		Method:      http.MethodGet,
+		Path:        "/results/aggregate",
+		OperationID: "resultAggregate",
+		Tag:         "results",
+		Description: "Mean, percentiles, min and max per metric over stored runs in a time window",
+		Params: []apiField{
+			{Name: "target", Type: "string", Description: "Only include runs against this server_host"},
+			{Name: "type", Type: "string", Description: "Only include iperf3, twamp, transfer, s3, ssh, pmtu, stun, nat64, ping, traceroute, owamp, tls, ndt7, bufferbloat, rpm or tcp_connect runs"},
+			{Name: "window", Type: "string", Default: "24h", Description: "Look-back window (e.g. 90m, 24h, 7d)"},
+		},
+		ExamplePath:     "/results/aggregate?target=iperf.he.net&window=24h",
+		Response:        "Aggregate",
+		ResponseExample: `{"status": "ok", "data": {"target": "iperf.he.net", "window": "24h0m0s", "runs": 24, "types": {"iperf3": {"runs": 24, "metrics": {"bandwidth_mbps": {"count": 24, "mean": 91.4, "min": 62.0, "max": 99.1, "stddev": 8.2, "p50": 94.0, "p90": 98.2, "p95": 98.7, "p99": 99.0}}}}}}`,
+	},
+	{
+		Method:      http.MethodGet,
+		Path:        "/results/compare",
+		OperationID: "resultCompare",
+		Tag:         "results",
+		Description: "Compare the latest result of a target, or the result named by id, against the median and standard deviation of its earlier results of the same type in a window, flagging the metrics that changed significantly",
+		Params: []apiField{
+			{Name: "target", Type: "string", Description: "The latest result of this server_host is compared; required without id"},
+			{Name: "type", Type: "string", Description: "With target: the latest result of this test type"},
+			{Name: "id", Type: "string", Description: "Compare this result instead of the latest"},
+			{Name: "window", Type: "string", Default: "7d", Description: "Baseline window before the result (e.g. 24h, 7d)"},
+			{Name: "sigma", Type: "number", Default: "3", Description: "Standard deviations from the median a significant change is at least"},
+			{Name: "threshold", Type: "number", Default: "10", Description: "Percentage change from the median a significant change is at least"},
+		},
+		ExamplePath:     "/results/compare?target=iperf.he.net&window=7d",
+		Response:        "BaselineComparison",
+		ResponseExample: `{"status": "ok", "data": {"result": {"id": "1d9cb97159106d3d", "type": "iperf3", "target": "iperf.he.net", "created_at": "2026-01-15T10:00:00Z"}, "window": "168h0m0s", "from": "2026-01-08T10:00:00Z", "to": "2026-01-15T10:00:00Z", "baseline_runs": 42, "sigma": 3, "threshold_percent": 10, "metrics": [{"metric": "bandwidth_mbps", "better": "higher", "value": 61.8, "runs": 42, "median": 94.0, "stddev": 3.1, "delta": -32.2, "delta_percent": -34.3, "score": -10.4, "change": "regressed", "significant": true}], "summary": {"regressions": 1, "improvements": 0, "changed": 0}, "regressed": true}}`,
+	},
+	{
+		Method:      http.MethodGet,
+		Path:        "/results/flent",
+		OperationID: "resultFlent",
+		Tag:         "results",
+		Description: "Export the time series of stored results as a Flent data file, aligned on their start times (e.g. an iperf3 run plus a concurrent TWAMP run for latency under load)",
+		Params: []apiField{
+			{Name: "ids", Type: "string", Required: true, Description: "Comma-separated result IDs of runs made with series: true (at most one upload, one download and one TWAMP result)"},
+		},
+		ExamplePath:     "/results/flent?ids=1d9cb97159106d3d,38907f90594d486c",
+		Response:        "FlentData",
+		ContentType:     "application/json",
+		ResponseExample: `{"metadata": {"NAME": "tcp_upload", "HOSTS": ["iperf.he.net"], "LENGTH": 10, "STEP_SIZE": 0.2}, "version": 4, "x_values": [0, 0.2, 0.4], "results": {"TCP upload": [null, null, 94.1], "Ping (ms) ICMP": [31.8, null, null]}, "raw_values": {"TCP upload": [{"t": 1768473000.4, "val": 94.1}], "Ping (ms) ICMP": [{"t": 1768473000.0, "val": 31.8}]}}`,
+	},
+	{
+		Method:      http.MethodGet,
+		Path:        "/results/{id1}/diff/{id2}",
+		OperationID: "resultDiff",
+		Tag:         "results",
+		Description: "Compare two stored results of the same type with absolute and percentage deltas per metric",
+		Params: []apiField{
+			{Name: "id1", Type: "string", Description: "Baseline result ID"},
+			{Name: "id2", Type: "string", Description: "Compared result ID"},
+			{Name: "threshold", Type: "number", Default: "10", Description: "Percentage change at which a metric is highlighted"},
+		},
+		ExamplePath: "/results/1d9cb97159106d3d/diff/38907f90594d486c?threshold=5",
+		Response:    "ResultDiff",
+		ResponseExample: `{
+  "status": "ok",
+  "data": {
+    "base": {"id": "1d9cb97159106d3d", "type": "iperf3", "target": "iperf.he.net", "created_at": "2026-01-10T09:12:03Z"},
+    "compare": {"id": "38907f90594d486c", "type": "iperf3", "target": "iperf.he.net", "created_at": "2026-01-10T11:40:27Z"},
+    "threshold_percent": 5,
+    "metrics": [
+      {"metric": "bandwidth_mbps", "better": "higher", "base": 94.1, "compare": 71.3, "delta": -22.8, "delta_percent": -24.2, "change": "regressed", "exceeds_threshold": true}
+    ],
+    "summary": {"regressions": 1, "improvements": 0, "changed": 0}
+  }
+}`,
+	},
+	{
+		Method:      http.MethodGet,
+		Path:        "/jobs/{id}",
+		OperationID: "jobGet",
+		Tag:         "jobs",
+		Description: "Poll a test started with ?async=true on any client run endpoint. Running iperf3 and TWAMP jobs report partial results in progress; finished jobs carry the response data a synchronous request returns, or its error and HTTP status",
+		Params: []apiField{
+			{Name: "id", Type: "string", Description: "Job ID"},
+		},
+		ExamplePath: "/jobs/af20ef46b0c8a787",
+		Response:    "Job",
+		ResponseExample: `{
+  "status": "ok",
+  "data": {
+    "id": "af20ef46b0c8a787",
+    "type": "iperf3",
+    "target": "iperf.example.com",
+    "state": "running",
+    "created_at": "2026-01-15T10:30:00Z",
+    "elapsed_sec": 4.2,
+    "progress": {
+      "unit": "mbps",
+      "samples": 4,
+      "expected_samples": 10,
+      "percent_complete": 40,
+      "latest": {"t_sec": 3, "value": 93.8},
+      "points": [{"t_sec": 0, "value": 91.2}, {"t_sec": 1, "value": 94.0}, {"t_sec": 2, "value": 93.5}, {"t_sec": 3, "value": 93.8}]
+    }
+  }
+}`,
+	},
+	{
+		Method:      http.MethodGet,
+		Path:        "/jobs",
+		OperationID: "jobList",
+		Tag:         "jobs",
+		Description: "List asynchronous jobs, oldest first, without results and progress points. The most recent 1000 finished jobs are kept",
+		Params: []apiField{
+			{Name: "state", Type: "string", Description: "Only include jobs in this state: running, completed, failed or canceled"},
+		},
+		Response:        "[]Job",
+		ResponseExample: `{"status": "ok", "data": [{"id": "af20ef46b0c8a787", "type": "iperf3", "target": "iperf.example.com", "state": "running", "created_at": "2026-01-15T10:30:00Z", "elapsed_sec": 4.2, "progress": {"unit": "mbps", "samples": 4, "expected_samples": 10, "percent_complete": 40, "latest": {"t_sec": 3, "value": 93.8}}}]}`,
+	},
+	{
+		Method:      http.MethodGet,
+		Path:        "/jobs/{id}/stream",
+		OperationID: "jobStream",
+		Tag:         "jobs",
+		Description: "Follow a job live as Server-Sent Events: start (unit, expected_samples), a sample event per progress point as the test produces it, and done with the finished job. Sample IDs are <run>:<n>; reconnecting with Last-Event-ID resumes after the last one received",
+		Params: []apiField{
+			{Name: "id", Type: "string", Description: "Job ID"},
+		},
+		ExamplePath: "/jobs/af20ef46b0c8a787/stream",
+		Response:    "string",
+		ContentType: "text/event-stream",
+		ResponseExample: `event: start
+data: {"expected_samples":60,"unit":"mbps"}
+
+event: sample
+id: 1:1
+data: {"t_sec":0,"value":91.2}
+
+event: done
+data: {"id":"af20ef46b0c8a787","state":"completed",...}
+
+`,
+	},
+	{
+		Method:      http.MethodGet,
+		Path:        "/jobs/{id}/probes",
+		OperationID: "jobProbes",
+		Tag:         "jobs",
+		Description: "WebSocket pushing every reply of a TWAMP job as it arrives: a start message per run, a probe message per reply with its T1-T4 timestamps, rtt_ms, network_rtt_ms, raw and corrected one-way delays and the running loss_percent, and done with the finished job before the server closes. Send {\"action\": \"cancel\"} to cancel the job, e.g. once loss spikes. 400 for other job types, 426 for requests without a WebSocket handshake",
+		Params: []apiField{
+			{Name: "id", Type: "string", Description: "Job ID"},
+		},
+		ExamplePath: "/jobs/af20ef46b0c8a787/probes",
+		Status:      http.StatusSwitchingProtocols,
+	},
+	{
+		Method:      http.MethodPost,
+		Path:        "/jobs/{id}/cancel",
+		OperationID: "jobCancel",
+		Tag:         "jobs",
+		Description: "Cancel a running job: iperf3 and TWAMP tests close their sockets at once and the job turns canceled with code ERR_CANCELED; other tests run to completion. Answers 202 with the job, 409 for finished jobs. Synchronous iperf3 and TWAMP runs are canceled the same way when the HTTP client disconnects",
+		Params: []apiField{
+			{Name: "id", Type: "string", Description: "Job ID"},
+		},
+		ExamplePath:     "/jobs/af20ef46b0c8a787/cancel",
+		Status:          http.StatusAccepted,
+		Response:        "Job",
+		ResponseExample: `{"status": "ok", "data": {"id": "af20ef46b0c8a787", "type": "iperf3", "target": "iperf.example.com", "state": "running", "created_at": "2026-01-15T10:30:00Z", "elapsed_sec": 4.2}}`,
+	},
+	{
+		Method:      http.MethodPost,
+		Path:        "/schedules",
+		OperationID: "scheduleCreate",
+		Tag:         "schedules",
+		Description: "Schedule a test request to run at a fixed interval. The first run is immediate",
+		Body:        "ScheduleRequest",
+		BodyExample: `{"type": "twamp", "interval": "5m", "request": {"server_host": "twamp.example.com", "count": 50}}`,
+		Status:      http.StatusCreated,
+		Response:    "Schedule",
+		ResponseExample: `{
+  "status": "ok",
+  "data": {
+    "id": "5f0c2a9e7b1d4c36",
+    "type": "twamp",
+    "target": "twamp.example.com",
+    "interval": "5m0s",
+    "state": "paused",
+    "paused_at": "2026-01-15T10:30:00Z",
+    "paused_until": "2026-01-15T12:30:00Z",
+    "pause_reason": "router maintenance",
+    "running": false,
+    "last_result_id": "1d9cb97159106d3d",
+    "runs": 12,
+    "failures": 0
+  }
+}`,
+	},
+	{
+		Method:          http.MethodGet,
+		Path:            "/schedules",
+		OperationID:     "scheduleList",
+		Tag:             "schedules",
+		Description:     "List schedules, oldest first, with their state (active or paused), next run and last result",
+		Response:        "[]Schedule",
+		ResponseExample: `{"status": "ok", "data": [{"id": "5f0c2a9e7b1d4c36", "type": "twamp", "target": "twamp.example.com", "state": "paused", "paused_until": "2026-01-15T12:30:00Z", "pause_reason": "router maintenance", "last_result_id": "1d9cb97159106d3d", "runs": 12}]}`,
+	},
+	{
+		Method:      http.MethodGet,
+		Path:        "/schedules/{id}",
+		OperationID: "scheduleGet",
+		Tag:         "schedules",
+		Description: "Fetch one schedule",
+		Params: []apiField{
+			{Name: "id", Type: "string", Description: "Schedule ID"},
+		},
+		ExamplePath:     "/schedules/5f0c2a9e7b1d4c36",
+		Response:        "Schedule",
+		ResponseExample: `{"status": "ok", "data": {"id": "5f0c2a9e7b1d4c36", "type": "twamp", "target": "twamp.example.com", "interval": "5m0s", "request": {"server_host": "twamp.example.com", "count": 50}, "state": "active", "running": false, "created_at": "2026-01-15T10:00:00Z", "next_run": "2026-01-15T10:35:00Z", "last_run": "2026-01-15T10:30:00Z", "last_result_id": "1d9cb97159106d3d", "runs": 7, "failures": 0}}`,
+	},
+	{
+		Method:      http.MethodDelete,
+		Path:        "/schedules/{id}",
+		OperationID: "scheduleDelete",
+		Tag:         "schedules",
+		Description: "Remove a schedule; a run in progress still completes",
+		Params: []apiField{
+			{Name: "id", Type: "string", Description: "Schedule ID"},
+		},
+		ExamplePath:     "/schedules/5f0c2a9e7b1d4c36",
+		ResponseExample: `{"status": "ok"}`,
+	},
+	{
+		Method:      http.MethodPost,
+		Path:        "/schedules/{id}/pause",
+		OperationID: "schedulePause",
+		Tag:         "schedules",
+		Description: "Pause a schedule without deleting it, e.g. during maintenance on its target. A run in progress completes. Pausing a paused schedule replaces its pause duration and reason",
+		Params: []apiField{
+			{Name: "id", Type: "string", Description: "Schedule ID"},
+		},
+		ExamplePath:     "/schedules/5f0c2a9e7b1d4c36/pause",
+		Body:            "PauseRequest",
+		BodyExample:     `{"duration": "2h", "reason": "router maintenance"}`,
+		Optional:        true,
+		Response:        "Schedule",
+		ResponseExample: `{"status": "ok", "data": {"id": "5f0c2a9e7b1d4c36", "state": "paused", "paused_at": "2026-01-15T10:30:00Z", "paused_until": "2026-01-15T12:30:00Z", "pause_reason": "router maintenance"}}`,
+	},
+	{
+		Method:      http.MethodPost,
+		Path:        "/schedules/{id}/resume",
+		OperationID: "scheduleResume",
+		Tag:         "schedules",
+		Description: "Re-activate a paused schedule. Runs missed while paused are not replayed: if a run became due during the pause it starts at once",
+		Params: []apiField{
+			{Name: "id", Type: "string", Description: "Schedule ID"},
+		},
+		ExamplePath:     "/schedules/5f0c2a9e7b1d4c36/resume",
+		Response:        "Schedule",
+		ResponseExample: `{"status": "ok", "data": {"id": "5f0c2a9e7b1d4c36", "type": "twamp", "target": "twamp.example.com", "interval": "5m0s", "request": {"server_host": "twamp.example.com", "count": 50}, "state": "active", "running": false, "created_at": "2026-01-15T10:00:00Z", "next_run": "2026-01-15T10:35:00Z", "last_run": "2026-01-15T10:30:00Z", "last_result_id": "1d9cb97159106d3d", "runs": 7, "failures": 0}}`,
+	},
+	{
+		Method:      http.MethodGet,
+		Path:        "/alerts",
+		OperationID: "alertList",
+		Tag:         "schedules",
+		Description: "List the schedules with an alert, firing ones first, with where each alert stands",
+		Params: []apiField{
+			{Name: "state", Type: "string", Description: "Only alerts in this state: ok or firing"},
+		},
+		ExamplePath:     "/alerts?state=firing",
+		Response:        "[]Schedule",
+		ResponseExample: `{"status": "ok", "data": [{"id": "5f0c2a9e7b1d4c36", "type": "twamp", "target": "twamp.example.com", "interval": "5m0s", "request": {"server_host": "twamp.example.com", "count": 50}, "state": "active", "running": false, "created_at": "2026-01-15T10:00:00Z", "next_run": "2026-01-15T10:35:00Z", "last_run": "2026-01-15T10:30:00Z", "last_result_id": "1d9cb97159106d3d", "runs": 7, "failures": 0, "alert": {"thresholds": [{"metric": "loss_percent", "above": 1}], "consecutive": 3, "recover_after": 1, "ignore_failures": false, "notify": [{"type": "slack", "url": "https://hooks.slack.com/services/T000/B000/XXXX"}]}, "alert_state": {"state": "firing", "since": "2026-01-15T10:30:04Z", "breaching_runs": 3, "recovered_runs": 0, "last_breaches": [{"metric": "loss_percent", "value": 4.2, "above": 1}], "notifications": 1}}]}`,
+	},
+	{
+		Method:          http.MethodPost,
+		Path:            "/locks",
+		OperationID:     "lockAcquire",
+		Tag:             "locks",
+		Description:     "Acquire a lease on all of resources at once (server:<host>, uplink:<name>). Returns 409 with the lease holding one of them as data",
+		Body:            "LockRequest",
+		BodyExample:     `{"resources": ["server:iperf.example.net", "uplink:fra1-transit"], "holder": "agent-fra1", "test": "iperf3 to iperf.example.net"}`,
+		Response:        "Lease",
+		ResponseExample: `{"status": "ok", "data": {"token": "04ccbd3ed225cfbf", "holder": "agent-fra1", "resources": ["server:iperf.example.net", "uplink:fra1-transit"], "acquired_at": "2026-01-15T10:00:00Z", "expires_at": "2026-01-15T10:00:30Z"}}`,
+	},
+	{
+		Method:          http.MethodGet,
+		Path:            "/locks",
+		OperationID:     "lockList",
+		Tag:             "locks",
+		Description:     "List the leases held on this agent's lock manager",
+		Response:        "[]Lease",
+		ResponseExample: `{"status": "ok", "data": [{"token": "04ccbd3ed225cfbf", "holder": "agent-fra1", "test": "iperf3 to iperf.example.net", "resources": ["server:iperf.example.net", "uplink:fra1-transit"], "acquired_at": "2026-01-15T10:00:00Z", "expires_at": "2026-01-15T10:00:30Z"}]}`,
+	},
+	{
+		Method:      http.MethodPost,
+		Path:        "/locks/{token}/renew",
+		OperationID: "lockRenew",
+		Tag:         "locks",
+		Description: "Extend a lease by its TTL. Expired or unknown tokens return 404",
+		Params: []apiField{
+			{Name: "token", Type: "string", Description: "Lease token"},
+		},
+		ExamplePath:     "/locks/04ccbd3ed225cfbf/renew",
+		Response:        "Lease",
+		ResponseExample: `{"status": "ok", "data": {"token": "04ccbd3ed225cfbf", "holder": "agent-fra1", "test": "iperf3 to iperf.example.net", "resources": ["server:iperf.example.net", "uplink:fra1-transit"], "acquired_at": "2026-01-15T10:00:00Z", "expires_at": "2026-01-15T10:00:40Z"}}`,
+	},
+	{
+		Method:      http.MethodDelete,
+		Path:        "/locks/{token}",
+		OperationID: "lockRelease",
+		Tag:         "locks",
+		Description: "Release a lease. Expired or unknown tokens return 404",
+		Params: []apiField{
+			{Name: "token", Type: "string", Description: "Lease token"},
+		},
+		ExamplePath:     "/locks/04ccbd3ed225cfbf",
+		ResponseExample: `{"status": "ok"}`,
+	},
+	{
+		Method:      http.MethodGet,
+		Path:        "/webhooks/deliveries",
+		OperationID: "deliveryList",
+		Tag:         "webhooks",
+		Description: "List result webhook deliveries, oldest first, with every attempt",
+		Params: []apiField{
+			{Name: "status", Type: "string", Description: "Only deliveries in this state: pending, delivered or dead"},
+			{Name: "result_id", Type: "string", Description: "Only deliveries of this stored result"},
+		},
+		ExamplePath:     "/webhooks/deliveries?status=pending",
+		Response:        "[]Delivery",
+		ResponseExample: `{"status": "ok", "data": [{"id": "59d05e48d27df0ba", "url": "https://hooks.example.com/results", "event": "result.created", "result_id": "1d9cb97159106d3d", "status": "pending", "attempts": [{"at": "2026-01-15T10:00:01Z", "status_code": 503, "error": "callback returned 503 Service Unavailable", "duration_ms": 41.2}], "next_attempt": "2026-01-15T10:00:03Z", "created_at": "2026-01-15T10:00:01Z"}]}`,
+	},
+	{
+		Method:      http.MethodGet,
+		Path:        "/webhooks/deliveries/{id}",
+		OperationID: "deliveryGet",
+		Tag:         "webhooks",
+		Description: "Fetch one delivery",
+		Params: []apiField{
+			{Name: "id", Type: "string", Description: "Delivery ID"},
+		},
+		ExamplePath:     "/webhooks/deliveries/59d05e48d27df0ba",
+		Response:        "Delivery",
+		ResponseExample: `{"status": "ok", "data": {"id": "59d05e48d27df0ba", "url": "https://hooks.example.com/results", "event": "result.created", "result_id": "1d9cb97159106d3d", "status": "pending", "attempts": [{"at": "2026-01-15T10:00:01Z", "status_code": 503, "error": "callback returned 503 Service Unavailable", "duration_ms": 41.2}], "next_attempt": "2026-01-15T10:00:03Z", "created_at": "2026-01-15T10:00:01Z"}}`,
+	},
+	{
+		Method:      http.MethodPost,
+		Path:        "/webhooks/deliveries/{id}/redeliver",
+		OperationID: "deliveryRedeliver",
+		Tag:         "webhooks",
+		Description: "Start a new round of WEBHOOK_MAX_ATTEMPTS attempts for a dead delivery, with the same delivery ID and body. Deliveries that are not dead return 409",
+		Params: []apiField{
+			{Name: "id", Type: "string", Description: "Delivery ID"},
+		},
+		ExamplePath:     "/webhooks/deliveries/59d05e48d27df0ba/redeliver",
+		Response:        "Delivery",
+		ResponseExample: `{"status": "ok", "data": {"id": "59d05e48d27df0ba", "url": "https://hooks.example.com/results", "event": "result.created", "result_id": "1d9cb97159106d3d", "status": "pending", "attempts": [{"at": "2026-01-15T10:00:01Z", "status_code": 503, "error": "callback returned 503 Service Unavailable", "duration_ms": 41.2}], "next_attempt": "2026-01-15T11:00:00Z", "created_at": "2026-01-15T10:00:01Z"}}`,
+	},
+	{
+		Method:          http.MethodGet,
+		Path:            "/webhooks/dead-letter",
+		OperationID:     "deliveryDeadLetter",
+		Tag:             "webhooks",
+		Description:     "List deliveries that exhausted their retries",
+		Response:        "[]Delivery",
+		ResponseExample: `{"status": "ok", "data": [{"id": "59d05e48d27df0ba", "url": "https://hooks.example.com/results", "event": "result.created", "result_id": "1d9cb97159106d3d", "status": "dead", "attempts": [{"at": "2026-01-15T10:00:01Z", "status_code": 503, "error": "callback returned 503 Service Unavailable", "duration_ms": 41.2}], "created_at": "2026-01-15T10:00:01Z"}]}`,
+	},
+	{
+		Method:          http.MethodGet,
+		Path:            "/admin/impairments",
+		OperationID:     "impairmentList",
+		Tag:             "impairments",
+		Description:     "List the active impairments",
+		Admin:           true,
+		Response:        "[]Impairment",
+		ResponseExample: `{"status": "ok", "data": [{"interface": "veth-lab", "delay_ms": 20, "jitter_ms": 2, "loss_percent": 1, "rate_mbit": 0, "duration_sec": 300, "applied_at": "2026-01-15T10:00:00Z", "expires_at": "2026-01-15T10:05:00Z", "command": "tc qdisc replace dev veth-lab root netem delay 20ms 2ms loss 1%"}]}`,
+	},
+	{
+		Method:      http.MethodPut,
+		Path:        "/admin/impairments/{interface}",
+		OperationID: "impairmentApply",
+		Tag:         "impairments",
+		Description: "Apply or replace the impairment of an interface, replacing its root qdisc until duration_sec passes. At least one of delay_ms, loss_percent and rate_mbit is required; a failing tc returns 500 with its output",
+		Params: []apiField{
+			{Name: "interface", Type: "string", Description: "Interface listed in NETEM_INTERFACES"},
+		},
+		ExamplePath:     "/admin/impairments/veth-lab",
+		Body:            "ImpairmentRequest",
+		BodyExample:     `{"delay_ms": 20, "jitter_ms": 2, "loss_percent": 1}`,
+		Admin:           true,
+		Response:        "Impairment",
+		ResponseExample: `{"status": "ok", "data": {"interface": "veth-lab", "delay_ms": 20, "jitter_ms": 2, "loss_percent": 1, "rate_mbit": 0, "duration_sec": 300, "applied_at": "2026-01-15T10:00:00Z", "expires_at": "2026-01-15T10:05:00Z", "command": "tc qdisc replace dev veth-lab root netem delay 20ms 2ms loss 1%"}}`,
+	},
+	{
+		Method:      http.MethodDelete,
+		Path:        "/admin/impairments/{interface}",
+		OperationID: "impairmentClear",
+		Tag:         "impairments",
+		Description: "Clear the impairment this agent applied to an interface, putting the kernel's default qdisc back. Interfaces without one return 404",
+		Params: []apiField{
+			{Name: "interface", Type: "string", Description: "Interface listed in NETEM_INTERFACES"},
+		},
+		ExamplePath:     "/admin/impairments/veth-lab",
+		Admin:           true,
+		ResponseExample: `{"status": "ok"}`,
+	},
+	{
+		Method:          http.MethodGet,
+		Path:            "/metrics",
+		OperationID:     "metricsHandler",
+		Tag:             "metrics",
+		Description:     "Prometheus metrics from stored results: a runs counter and per-server histograms of the main metric of each test type. With Accept: application/openmetrics-text the OpenMetrics format is returned, with test_id exemplars that link buckets to GET /results/{id}",
+		Response:        "string",
+		ContentType:     "text/plain; version=0.0.4",
+		ResponseExample: `network_test_twamp_rtt_avg_milliseconds_bucket{server="twamp.example.com",le="50"} 41 # {test_id="1d9cb97159106d3d"} 48.2 1768473000.412`,
+	},
+	{
+		Method:          http.MethodGet,
+		Path:            "/profiles",
+		OperationID:     "profilesList",
+		Tag:             "profiles",
+		Description:     "List target profiles loaded from PROFILES_FILE (defaults and limits applied to matching server_host values)",
+		Response:        "ProfileSet",
+		ResponseExample: `{"status": "ok", "data": {"profiles": [{"name": "dc-lab", "targets": ["*.lab.example.net", "10.20.0.0/16"], "defaults": {"duration": 30, "dscp": 46}, "limits": {"max_duration": 60}}]}}`,
+	},
+	{
+		Method:          http.MethodGet,
+		Path:            "/config",
+		OperationID:     "configGet",
+		Tag:             "config",
+		Description:     "The effective value and source of every setting: the environment, `CONFIG_FILE` or the built-in default. Secrets such as `ADMIN_TOKEN` and the keys of `API_KEYS` are redacted.",
+		Response:        "ConfigReport",
+		ResponseExample: `{"status": "ok", "data": {"file": "/etc/network-test-api/config.json", "settings": [{"name": "LISTEN_ADDR", "value": ":8443", "source": "file"}, {"name": "API_KEYS", "value": "ci=********", "source": "env", "secret": true}, {"name": "MAX_CONCURRENT_TESTS", "source": "default"}]}}`,
+	},
+	{
+		Method:      http.MethodGet,
+		Path:        "/status",
+		OperationID: "limiterStatus",
+		Tag:         "status",
+		Description: "The iperf3 and TWAMP tests running and queued. With `MAX_CONCURRENT_TESTS` set, at most that many run at once; excess tests wait for a slot in FIFO order, or with `TEST_QUEUE_MODE=reject` fail at once with `429` and code ERR_BUSY.",
+		Response:    "LimiterStatus",
+		ResponseExample: `{
+  "status": "ok",
+  "data": {
+    "max_concurrent": 2,
+    "queue_mode": "fifo",
+    "running": [
+      {"test": "iperf3 to iperf.example.net:5201", "job_id": "af20ef46b0c8a787", "queued_at": "2026-01-15T10:30:00Z", "started_at": "2026-01-15T10:30:00Z"},
+      {"test": "twamp to twamp.example.net:862", "queued_at": "2026-01-15T10:30:02Z", "started_at": "2026-01-15T10:30:02Z"}
+    ],
+    "queued": [
+      {"test": "iperf3 to iperf2.example.net:5201", "job_id": "24027b2ba0b446a9", "queued_at": "2026-01-15T10:30:05Z", "position": 1}
+    ],
+    "draining": false
+  }
+}`,
+	},
+	{
+		Method:          http.MethodGet,
+		Path:            "/health",
+		OperationID:     "health",
+		Tag:             "health",
+		Description:     "Health check endpoint; answers 503 with status draining while the agent shuts down",
+		ResponseExample: `{"status": "healthy"}`,
+	},
+	{
+		Method:      http.MethodGet,
+		Path:        "/openapi.json",
+		OperationID: "openAPIHandler",
+		Tag:         "docs",
+		Description: "This document: the OpenAPI 3.0 description of the API, for generating clients and validating requests and responses",
+		Response:    "object",
+		ContentType: "application/json",
+	},
+	{
+		Method:      http.MethodGet,
+		Path:        "/",
+		OperationID: "handleRoot",
+		Tag:         "docs",
+		Description: "The HTML documentation rendered from the OpenAPI document. With Content-Type: application/json the OpenAPI document is returned in the response envelope instead",
+		Response:    "string",
+		ContentType: "text/html",
+	},
+}
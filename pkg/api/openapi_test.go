@@ -0,0 +1,52 @@
+package api
+
+import (
+	"testing"
+)
+
+func TestTypeSchema(t *testing.T) {
+	s := typeSchema("[]Job")
+	if s.Type != "array" || s.Items.Ref != "#/components/schemas/Job" {
+		t.Errorf("expected an array of Job refs, got %+v", s)
+	}
+
+	s = typeSchema("map[string][]*number")
+	if s.Type != "object" || s.AdditionalProperties.Type != "array" {
+		t.Fatalf("expected an object of arrays, got %+v", s)
+	}
+	if item := s.AdditionalProperties.Items; item.Type != "number" || !item.Nullable {
+		t.Errorf("expected nullable number items, got %+v", item)
+	}
+
+	// $ref siblings are ignored, so a nullable ref is wrapped
+	s = typeSchema("*StoredResult")
+	if s.Ref != "" || len(s.AllOf) != 1 || s.AllOf[0].Ref != "#/components/schemas/StoredResult" || !s.Nullable {
+		t.Errorf("expected a nullable allOf of the StoredResult ref, got %+v", s)
+	}
+
+	s = typeSchema("string|[]string")
+	if len(s.OneOf) != 2 || s.OneOf[0].Type != "string" || s.OneOf[1].Type != "array" {
+		t.Errorf("expected oneOf string and array, got %+v", s)
+	}
+
+	if s := typeSchema("date-time"); s.Type != "string" || s.Format != "date-time" {
+		t.Errorf("expected a date-time string, got %+v", s)
+	}
+}
+
+func TestPathExamples(t *testing.T) {
+	got := pathExamples("/results/{id1}/diff/{id2}", "/results/1d9cb97159106d3d/diff/7a3e0c2b91f4d658?threshold=10")
+	want := map[string]string{"id1": "1d9cb97159106d3d", "id2": "7a3e0c2b91f4d658", "threshold": "10"}
+	if len(got) != len(want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	for name, v := range want {
+		if got[name] != v {
+			t.Errorf("expected %s=%s, got %q", name, v, got[name])
+		}
+	}
+
+	if got := pathExamples("/jobs", ""); len(got) != 0 {
+		t.Errorf("expected no values without an example, got %v", got)
+	}
+}
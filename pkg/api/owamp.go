@@ -0,0 +1,630 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/tcaine/twamp"
+
+	"network-test-api/pkg/nettest"
+	"network-test-api/pkg/stats"
+)
+
+// OWAMP (RFC 4656): one-way delay taken by the receiver. The agent asks an
+// owampd over OWAMP-Control to receive a test session, sends the test packets
+// itself and fetches the receiver's records of them with Fetch-Session, so each
+// packet's delay is its receive time less its send time, read on two clocks.
+// With both clocks synchronized, as the error estimates of the records tell,
+// these are true one-way delays rather than the halves of a round trip TWAMP
+// infers from the symmetric-path assumption. Only unauthenticated mode is
+// offered, as for TWAMP.
+const (
+	OWAMP_DEFAULT_PORT = 861
+
+	DEFAULT_OWAMP_COUNT    = 100
+	MAX_OWAMP_COUNT        = 10000
+	DEFAULT_OWAMP_INTERVAL = 0.1
+	MIN_OWAMP_INTERVAL     = 0.001
+	MAX_OWAMP_INTERVAL     = 10
+
+	OWAMP_LOSS_TIMEOUT     = 2 * time.Second  // Packets arriving later are lost, owping's default
+	OWAMP_START_DELAY      = time.Second      // From Request-Session to the first packet, for the receiver to get ready
+	OWAMP_CONTROL_TIMEOUT  = 10 * time.Second // Per OWAMP-Control read
+	OWAMP_STOP_WAIT        = time.Second      // For the server's own Stop-Sessions
+	OWAMP_BASE_PACKET_SIZE = 14               // Unauthenticated test packet without padding
+
+	owampRecordSize = 25
+)
+
+// OWAMP-Control commands
+const (
+	owampRequestSession = 1
+	owampStartSessions  = 2
+	owampStopSessions   = 3
+	owampFetchSession   = 4
+)
+
+// owampSession is the test session requested of the receiver
+type owampSession struct {
+	sender     net.IP
+	receiver   net.IP
+	senderPort int
+	count      uint32
+	padding    int
+	dscp       int
+	start      time.Time
+	interval   time.Duration
+	timeout    time.Duration
+}
+
+// encode builds the Request-Session message of the session (RFC 4656 section
+// 3.5) with one fixed-interval schedule slot. The agent sends, the server
+// receives and chooses the port and SID. The DSCP goes in the six bits after
+// the two leading zero bits of the Type-P Descriptor, as owping puts it.
+func (s owampSession) encode() []byte {
+	msg := make([]byte, 112+16+16)
+	msg[0] = owampRequestSession
+	ipvn, sender, receiver := byte(4), s.sender.To4(), s.receiver.To4()
+	if sender == nil || receiver == nil {
+		ipvn, sender, receiver = 6, s.sender.To16(), s.receiver.To16()
+	}
+	msg[1] = ipvn
+	msg[2] = 0 // Conf-Sender: the agent sends
+	msg[3] = 1 // Conf-Receiver: the server receives
+	binary.BigEndian.PutUint32(msg[4:8], 1)
+	binary.BigEndian.PutUint32(msg[8:12], s.count)
+	binary.BigEndian.PutUint16(msg[12:14], uint16(s.senderPort))
+	copy(msg[16:32], sender)
+	copy(msg[32:48], receiver)
+	binary.BigEndian.PutUint32(msg[64:68], uint32(s.padding))
+	putNTPTime(msg[68:76], s.start)
+	putNTPDuration(msg[76:84], s.timeout)
+	binary.BigEndian.PutUint32(msg[84:88], uint32(s.dscp)<<24)
+	msg[112] = 1 // Slot type: fixed interval
+	putNTPDuration(msg[120:128], s.interval)
+	return msg
+}
+
+// putNTPDuration encodes d as the seconds and fraction of an RFC 4656 timestamp
+func putNTPDuration(b []byte, d time.Duration) {
+	binary.BigEndian.PutUint32(b, uint32(d/time.Second))
+	binary.BigEndian.PutUint32(b[4:], uint32((uint64(d%time.Second)<<32)/1e9))
+}
+
+// owampAcceptError describes a nonzero Accept field of an OWAMP-Control reply
+func owampAcceptError(accept byte, what string) error {
+	switch accept {
+	case 0:
+		return nil
+	case 1:
+		return fmt.Errorf("the server refused the %s", what)
+	case 2:
+		return fmt.Errorf("the server refused the %s: internal error", what)
+	case 3:
+		return fmt.Errorf("the server refused the %s: not supported", what)
+	case 4:
+		return fmt.Errorf("the server refused the %s: permanent resource limitation", what)
+	case 5:
+		return fmt.Errorf("the server refused the %s: temporary resource limitation", what)
+	}
+	return fmt.Errorf("the server refused the %s (accept %d)", what, accept)
+}
+
+// owampRead reads n bytes of OWAMP-Control messages
+func owampRead(conn net.Conn, n int, timeout time.Duration) ([]byte, error) {
+	buf := make([]byte, n)
+	_ = conn.SetReadDeadline(time.Now().Add(timeout))
+	_, err := io.ReadFull(conn, buf)
+	return buf, err
+}
+
+// padded16 rounds n up to the 16-byte blocks OWAMP-Control messages come in
+func padded16(n int) int {
+	return (n + 15) / 16 * 16
+}
+
+// encodeOwampStop builds the Stop-Sessions message that ends the session at
+// (before) sequence number next, without skip ranges
+func encodeOwampStop(sid []byte, next uint32) []byte {
+	msg := make([]byte, 16+24+16)
+	msg[0] = owampStopSessions
+	binary.BigEndian.PutUint32(msg[4:8], 1)
+	copy(msg[16:32], sid)
+	binary.BigEndian.PutUint32(msg[32:36], next)
+	return msg
+}
+
+// encodeOwampFetch builds the Fetch-Session message asking for every record
+// of the session
+func encodeOwampFetch(sid []byte) []byte {
+	msg := make([]byte, 48)
+	msg[0] = owampFetchSession
+	binary.BigEndian.PutUint32(msg[12:16], math.MaxUint32)
+	copy(msg[16:32], sid)
+	return msg
+}
+
+// owampRecord is the receiver's record of one test packet (RFC 4656 section 3.8)
+type owampRecord struct {
+	seq       uint32
+	sendError uint16
+	recvError uint16
+	sent      time.Time
+	received  time.Time
+	ttl       int
+	lost      bool // Not received within the loss timeout
+}
+
+// parseOwampRecord decodes a 25-byte record; lost packets have a zero receive
+// timestamp
+func parseOwampRecord(b []byte) owampRecord {
+	r := owampRecord{
+		seq:       binary.BigEndian.Uint32(b[0:4]),
+		sendError: binary.BigEndian.Uint16(b[4:6]),
+		recvError: binary.BigEndian.Uint16(b[6:8]),
+		sent:      getNTPTime(b[8:16]),
+		ttl:       int(b[24]),
+	}
+	if binary.BigEndian.Uint64(b[16:24]) == 0 {
+		r.lost = true
+	} else {
+		r.received = getNTPTime(b[16:24])
+	}
+	return r
+}
+
+// owampRun is what the test session produced
+type owampRun struct {
+	dial     *nettest.DialReport
+	local    string // Address the packets were sent from
+	remote   string // Address the server received them on
+	dscp     int    // Applied to the packets
+	sent     uint32
+	errorEst uint16 // Error estimate of the send timestamps
+	finished bool   // The server considers the session complete
+	records  []owampRecord
+}
+
+// owampTest requests a test session of the server, sends its packets and
+// fetches the server's records of them
+func owampTest(ctx context.Context, req RunRequest, bind *nettest.SourceBinding) (*owampRun, error) {
+	controlConn, dial, err := nettest.DialControlFrom(ctx, req.ServerHost, req.ServerPort, req.AddressFamily, 5*time.Second, bind)
+	if err != nil {
+		return nil, twampError(ctx, "Connect failed", err)
+	}
+	defer func() { _ = controlConn.Close() }()
+	stopControl := context.AfterFunc(ctx, func() { _ = controlConn.Close() })
+	defer stopControl()
+
+	// The greeting, mode selection and Server-Start are those TWAMP took over
+	if _, err := twamp.NewClient().ConnectConn(controlConn); err != nil {
+		return nil, twampError(ctx, "Connect failed", err)
+	}
+	local := controlConn.LocalAddr().(*net.TCPAddr)
+	remote := controlConn.RemoteAddr().(*net.TCPAddr)
+
+	var udp *net.UDPConn
+	err = bind.InNamespace(func() error {
+		var err error
+		udp, err = net.ListenUDP("udp", &net.UDPAddr{IP: local.IP, Zone: local.Zone})
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Opening the test socket failed: %v", err)
+	}
+	defer func() { _ = udp.Close() }()
+	stopUDP := context.AfterFunc(ctx, func() { _ = udp.Close() })
+	defer stopUDP()
+	if err := bind.BindConn(udp); err != nil {
+		return nil, fmt.Errorf("Binding to interface %s failed: %v", req.Interface, err)
+	}
+	// Sent with TTL 255, so the TTL the server records tells the hops
+	if err := prepareReflector(udp, 0); err != nil {
+		return nil, fmt.Errorf("Preparing the test socket failed: %v", err)
+	}
+	tos, err := nettest.SetProbeTOS(udp, req.DSCP<<2)
+	if err != nil {
+		return nil, fmt.Errorf("Setting DSCP %d failed: %v", req.DSCP, err)
+	}
+
+	interval := time.Duration(req.Interval * float64(time.Second))
+	session := owampSession{
+		sender:     local.IP,
+		receiver:   remote.IP,
+		senderPort: udp.LocalAddr().(*net.UDPAddr).Port,
+		count:      uint32(req.Count),
+		padding:    req.Padding,
+		dscp:       req.DSCP,
+		start:      time.Now().Add(OWAMP_START_DELAY),
+		interval:   interval,
+		timeout:    OWAMP_LOSS_TIMEOUT,
+	}
+	if _, err := controlConn.Write(session.encode()); err != nil {
+		return nil, twampError(ctx, "Session failed", err)
+	}
+	accept, err := owampRead(controlConn, 48, OWAMP_CONTROL_TIMEOUT)
+	if err == nil {
+		err = owampAcceptError(accept[0], "session")
+	}
+	if err != nil {
+		return nil, twampError(ctx, "Session failed", err)
+	}
+	dst := &net.UDPAddr{IP: remote.IP, Port: int(binary.BigEndian.Uint16(accept[2:4])), Zone: remote.Zone}
+	sid := accept[4:20]
+
+	start := make([]byte, 32)
+	start[0] = owampStartSessions
+	if _, err := controlConn.Write(start); err != nil {
+		return nil, twampError(ctx, "Start failed", err)
+	}
+	ack, err := owampRead(controlConn, 32, OWAMP_CONTROL_TIMEOUT)
+	if err == nil {
+		err = owampAcceptError(ack[0], "start of the session")
+	}
+	if err != nil {
+		return nil, twampError(ctx, "Start failed", err)
+	}
+
+	// Packets follow the requested schedule, which the receiver times the
+	// loss timeout by
+	pkt := make([]byte, OWAMP_BASE_PACKET_SIZE+req.Padding)
+	if _, err := rand.Read(pkt[OWAMP_BASE_PACKET_SIZE:]); err != nil {
+		return nil, fmt.Errorf("generating padding: %w", err)
+	}
+	errorEstimate := nettest.CalculateErrorEstimate()
+	timer := time.NewTimer(time.Until(session.start))
+	defer timer.Stop()
+	var sent uint32
+	for ; sent < session.count; sent++ {
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return nil, canceledError(ctx)
+		}
+		encodeLightProbe(pkt, sent, time.Now(), errorEstimate)
+		if _, err := udp.WriteTo(pkt, dst); err != nil {
+			return nil, twampError(ctx, "Test run failed", fmt.Errorf("sending packet %d: %w", sent, err))
+		}
+		timer.Reset(time.Until(session.start.Add(time.Duration(sent+1) * interval)))
+	}
+	timer.Reset(OWAMP_LOSS_TIMEOUT)
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+		return nil, canceledError(ctx)
+	}
+
+	if _, err := controlConn.Write(encodeOwampStop(sid, sent)); err != nil {
+		return nil, twampError(ctx, "Stop failed", err)
+	}
+	readOwampStop(controlConn)
+
+	if _, err := controlConn.Write(encodeOwampFetch(sid)); err != nil {
+		return nil, twampError(ctx, "Fetch failed", err)
+	}
+	records, finished, err := readOwampRecords(controlConn, sent)
+	if err != nil {
+		return nil, twampError(ctx, "Fetch failed", err)
+	}
+	return &owampRun{
+		dial:     dial,
+		local:    udp.LocalAddr().String(),
+		remote:   dst.String(),
+		dscp:     tos >> 2,
+		sent:     sent,
+		errorEst: errorEstimate,
+		finished: finished,
+		records:  records,
+	}, nil
+}
+
+// readOwampStop reads the Stop-Sessions message owampd answers one with, if
+// the server sends it
+func readOwampStop(conn net.Conn) {
+	msg, err := owampRead(conn, 16, OWAMP_STOP_WAIT)
+	if err != nil || msg[0] != owampStopSessions {
+		return
+	}
+	for i := uint32(0); i < binary.BigEndian.Uint32(msg[4:8]); i++ {
+		desc, err := owampRead(conn, 24, OWAMP_CONTROL_TIMEOUT)
+		if err != nil {
+			return
+		}
+		if _, err := owampRead(conn, int(binary.BigEndian.Uint32(desc[20:24]))*8, OWAMP_CONTROL_TIMEOUT); err != nil {
+			return
+		}
+	}
+	_, _ = owampRead(conn, 16, OWAMP_CONTROL_TIMEOUT)
+}
+
+// readOwampRecords reads the reply to Fetch-Session: the Fetch-Ack, the
+// session's Request-Session, its skip ranges and the records of sent packets
+func readOwampRecords(conn net.Conn, sent uint32) ([]owampRecord, bool, error) {
+	ack, err := owampRead(conn, 32, OWAMP_CONTROL_TIMEOUT)
+	if err != nil {
+		return nil, false, err
+	}
+	if err := owampAcceptError(ack[0], "fetch"); err != nil {
+		return nil, false, err
+	}
+	finished := ack[1] != 0
+	skips := binary.BigEndian.Uint32(ack[8:12])
+	count := binary.BigEndian.Uint32(ack[12:16])
+	// Duplicates add records, but not without bound
+	if uint64(count) > 4*uint64(sent)+16 || uint64(skips) > uint64(sent)+1 {
+		return nil, false, fmt.Errorf("the server reports %d records and %d skip ranges of %d packets", count, skips, sent)
+	}
+
+	request, err := owampRead(conn, 112, OWAMP_CONTROL_TIMEOUT)
+	if err != nil {
+		return nil, false, err
+	}
+	slots := binary.BigEndian.Uint32(request[4:8])
+	if slots > MAX_OWAMP_COUNT {
+		return nil, false, fmt.Errorf("the server echoed %d schedule slots", slots)
+	}
+	if _, err := owampRead(conn, int(slots)*16+16, OWAMP_CONTROL_TIMEOUT); err != nil {
+		return nil, false, err
+	}
+	if _, err := owampRead(conn, padded16(int(skips)*8)+16, OWAMP_CONTROL_TIMEOUT); err != nil {
+		return nil, false, err
+	}
+	raw, err := owampRead(conn, padded16(int(count)*owampRecordSize)+16, OWAMP_CONTROL_TIMEOUT)
+	if err != nil {
+		return nil, false, err
+	}
+	records := make([]owampRecord, 0, count)
+	for i := 0; i < int(count); i++ {
+		records = append(records, parseOwampRecord(raw[i*owampRecordSize:]))
+	}
+	return records, finished, nil
+}
+
+// OwampReport summarises the records of a test session
+type OwampReport struct {
+	Received         uint64
+	LossPercent      float64
+	Duplicates       uint64
+	Reordered        uint64
+	ReorderedPercent float64
+	Reordering       stats.Reordering
+	LossBursts       stats.LossBursts
+
+	Delay       *stats.Summary // One-way delays in ms, nil without received packets
+	Percentiles Percentiles
+	JitterMs    float64 // Mean absolute IPDV of consecutive packets (RFC 3393)
+	IPDVMinMs   float64
+	IPDVMaxMs   float64
+	HopsMin     int
+	HopsMax     int
+
+	ReceiverError uint16 // Largest error estimate of the receive timestamps
+	ReceiverSync  bool   // Every receive timestamp was synchronized
+}
+
+// summarizeOwamp computes loss and delay statistics from the records of sent
+// packets. Records come in sequence order; the order of receive times is the
+// order of arrival that reordering is counted by.
+func summarizeOwamp(records []owampRecord, sent uint32) OwampReport {
+	var r OwampReport
+	arrived := make([]owampRecord, 0, len(records))
+	for _, rec := range records {
+		if rec.seq < sent && !rec.lost {
+			arrived = append(arrived, rec)
+		}
+	}
+	sort.SliceStable(arrived, func(i, j int) bool { return arrived[i].received.Before(arrived[j].received) })
+
+	counter := stats.NewLossCounter(int(sent))
+	delays := make(map[uint32]float64, len(arrived))
+	r.ReceiverSync = len(arrived) > 0
+	r.HopsMin = math.MaxInt
+	var receiverErr float64
+	for _, rec := range arrived {
+		counter.Observe(rec.seq)
+		if _, ok := delays[rec.seq]; ok {
+			continue // Duplicate
+		}
+		delays[rec.seq] = float64(rec.received.Sub(rec.sent).Nanoseconds()) / 1e6
+		hops := 255 - rec.ttl
+		r.HopsMin, r.HopsMax = min(r.HopsMin, hops), max(r.HopsMax, hops)
+		info := nettest.ParseErrorEstimate(rec.recvError)
+		r.ReceiverSync = r.ReceiverSync && info.Synced
+		if e := info.ErrorSeconds; e < 0 || (receiverErr >= 0 && e > receiverErr) {
+			receiverErr, r.ReceiverError = e, rec.recvError
+		}
+	}
+	r.Received = counter.Received()
+	if sent > 0 {
+		r.LossPercent = float64(uint64(sent)-r.Received) / float64(sent) * 100
+	}
+	r.Duplicates = counter.Duplicates()
+	r.Reordered = counter.Reordered()
+	r.ReorderedPercent = reorderedPercent(counter)
+	r.Reordering = counter.Reordering()
+	r.LossBursts = counter.Bursts(sent)
+	if len(delays) == 0 {
+		r.HopsMin = 0
+		return r
+	}
+
+	values := make([]float64, 0, len(delays))
+	var ipdvs []float64
+	for seq := uint32(0); seq < sent; seq++ {
+		d, ok := delays[seq]
+		if !ok {
+			continue
+		}
+		values = append(values, d)
+		if seq == 0 {
+			continue
+		}
+		if prev, ok := delays[seq-1]; ok {
+			ipdvs = append(ipdvs, d-prev)
+		}
+	}
+	r.Delay = stats.Summarize(values)
+	sort.Float64s(values)
+	r.Percentiles = stats.TailPercentiles(values)
+	if len(ipdvs) > 0 {
+		r.IPDVMinMs, r.IPDVMaxMs = ipdvs[0], ipdvs[0]
+		var sum float64
+		for _, v := range ipdvs {
+			sum += math.Abs(v)
+			r.IPDVMinMs, r.IPDVMaxMs = min(r.IPDVMinMs, v), max(r.IPDVMaxMs, v)
+		}
+		r.JitterMs = sum / float64(len(ipdvs))
+	}
+	return r
+}
+
+// errorEstimateReport describes an error estimate as full mode TWAMP does
+func errorEstimateReport(raw uint16) map[string]interface{} {
+	info := nettest.ParseErrorEstimate(raw)
+	return map[string]interface{}{
+		"synced":        info.Synced,
+		"unavailable":   info.Unavailable,
+		"scale":         info.Scale,
+		"multiplier":    info.Multiplier,
+		"error_seconds": info.ErrorSeconds,
+		"error_ms":      info.ErrorSeconds * 1000,
+		"raw_value_hex": fmt.Sprintf("0x%04X", raw),
+	}
+}
+
+// validateOwamp checks the bounds of an OWAMP request
+func validateOwamp(req RunRequest) error {
+	switch {
+	case req.ServerHost == "":
+		return fmt.Errorf("server_host is required")
+	case req.Count < 1 || req.Count > MAX_OWAMP_COUNT:
+		return fmt.Errorf("count must be between 1 and %d", MAX_OWAMP_COUNT)
+	case req.Interval < MIN_OWAMP_INTERVAL || req.Interval > MAX_OWAMP_INTERVAL:
+		return fmt.Errorf("interval must be between %g and %d seconds", MIN_OWAMP_INTERVAL, MAX_OWAMP_INTERVAL)
+	case req.Padding < 0 || req.Padding > MAX_TWAMP_PADDING:
+		return fmt.Errorf("padding must be between 0 and %d bytes", MAX_TWAMP_PADDING)
+	}
+	return nil
+}
+
+// runOwamp applies defaults to a decoded request, runs the OWAMP test and records the result.
+// Errors come with the HTTP status to report them with.
+func runOwamp(req RunRequest, profile *Profile) (map[string]interface{}, int, error) {
+	if req.ServerPort == 0 {
+		req.ServerPort = OWAMP_DEFAULT_PORT
+	}
+	if req.Count == 0 {
+		req.Count = DEFAULT_OWAMP_COUNT
+	}
+	if req.Interval == 0 {
+		req.Interval = DEFAULT_OWAMP_INTERVAL
+	}
+	if err := checkProfileLimits(req, profile); err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	err := validateOwamp(req)
+	if err == nil {
+		req.AddressFamily, err = parseAddressFamily(req.AddressFamily)
+	}
+	if err == nil && req.AddressFamily == nettest.FAMILY_COMPARE {
+		err = fmt.Errorf("address_family compare is not available for OWAMP tests; run ipv4 and ipv6 separately")
+	}
+	var bind *nettest.SourceBinding
+	if err == nil {
+		bind, req.AddressFamily, err = nettest.ParseSourceBindingIn(req.Netns, req.SourceAddress, req.Interface, req.AddressFamily)
+	}
+	if err == nil {
+		err = validateLockWait(&req)
+	}
+	if err == nil {
+		err = validateCallbackURL(req.CallbackURL)
+	}
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	applyTOS(&req)
+
+	releaseSlot, status, err := acquireTestSlot(TEST_TYPE_OWAMP, req)
+	if err != nil {
+		return nil, status, err
+	}
+	defer releaseSlot()
+
+	lock, release, status, err := lockTest(TEST_TYPE_OWAMP, req, false)
+	if err != nil {
+		return nil, status, err
+	}
+	defer release()
+
+	logf(req.ctx, "OWAMP test: %s:%d (%d packets, interval=%gs, padding=%d, family=%s)",
+		req.ServerHost, req.ServerPort, req.Count, req.Interval, req.Padding, req.AddressFamily)
+
+	cancel := withTestTimeout(&req)
+	defer cancel()
+	started := time.Now()
+	run, err := owampTest(req.runContext(), req, bind)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	report := summarizeOwamp(run.records, run.sent)
+
+	senderSync := nettest.ParseErrorEstimate(run.errorEst).Synced
+	data := map[string]interface{}{
+		"server":            req.ServerHost,
+		"port":              req.ServerPort,
+		"dial":              run.dial,
+		"local_endpoint":    run.local,
+		"remote_endpoint":   run.remote,
+		"dscp":              run.dscp,
+		"padding":           req.Padding,
+		"interval_sec":      req.Interval,
+		"sent":              run.sent,
+		"received":          report.Received,
+		"lost":              uint64(run.sent) - report.Received,
+		"loss_percent":      report.LossPercent,
+		"duplicates":        report.Duplicates,
+		"reordered":         report.Reordered,
+		"reordered_percent": report.ReorderedPercent,
+		"reordering":        report.Reordering,
+		"loss_bursts":       report.LossBursts,
+		"sync_status": map[string]interface{}{
+			"sender_synced":           senderSync,
+			"receiver_synced":         report.ReceiverSync,
+			"both_synced":             senderSync && report.ReceiverSync,
+			"sender_error_estimate":   errorEstimateReport(run.errorEst),
+			"receiver_error_estimate": errorEstimateReport(report.ReceiverError),
+		},
+		"finished":     run.finished,
+		"duration_sec": time.Since(started).Seconds(),
+	}
+	if report.Delay != nil {
+		data["delay_min_ms"] = report.Delay.Min
+		data["delay_avg_ms"] = report.Delay.Mean
+		data["delay_max_ms"] = report.Delay.Max
+		data["delay_stddev_ms"] = report.Delay.StdDev
+		data["percentiles_ms"] = report.Percentiles
+		data["jitter_ms"] = report.JitterMs
+		data["ipdv_ms"] = map[string]float64{"min": report.IPDVMinMs, "max": report.IPDVMaxMs}
+		data["hops"] = map[string]int{"min": report.HopsMin, "max": report.HopsMax}
+	}
+	if bind != nil {
+		data["source"] = bind
+	}
+	if profile != nil {
+		data["profile"] = profile.Name
+	}
+	data["lock"] = lock
+
+	recordResult(TEST_TYPE_OWAMP, req, started, data)
+	notifyCallback(req.CallbackURL, data)
+
+	return data, http.StatusOK, nil
+}
@@ -0,0 +1,108 @@
+package api
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+	"time"
+)
+
+// owampRecordBytes encodes a record as owampd sends it; a zero received
+// time marks the packet lost
+func owampRecordBytes(seq uint32, sent, received time.Time, ttl byte) []byte {
+	b := make([]byte, 25)
+	binary.BigEndian.PutUint32(b[0:4], seq)
+	binary.BigEndian.PutUint16(b[4:6], 0x8001)
+	binary.BigEndian.PutUint16(b[6:8], 0x8c03)
+	putNTPTime(b[8:16], sent)
+	if !received.IsZero() {
+		putNTPTime(b[16:24], received)
+	}
+	b[24] = ttl
+	return b
+}
+
+func TestNTPDuration(t *testing.T) {
+	b := make([]byte, 8)
+	putNTPDuration(b, 2500*time.Millisecond)
+	if s := binary.BigEndian.Uint32(b[0:4]); s != 2 {
+		t.Errorf("Expected 2 seconds, got %d", s)
+	}
+	if f := binary.BigEndian.Uint32(b[4:8]); f != 1<<31 {
+		t.Errorf("Expected half a second as fraction 0x80000000, got %#x", f)
+	}
+}
+
+func TestParseOwampRecord(t *testing.T) {
+	sent := time.Date(2026, 10, 14, 9, 0, 0, 125000000, time.UTC)
+	received := sent.Add(12500 * time.Microsecond)
+
+	r := parseOwampRecord(owampRecordBytes(42, sent, received, 246))
+	if r.seq != 42 || r.lost || r.ttl != 246 {
+		t.Errorf("Expected seq 42 received with TTL 246, got %+v", r)
+	}
+	if r.sendError != 0x8001 || r.recvError != 0x8c03 {
+		t.Errorf("Expected error estimates 0x8001 and 0x8c03, got %#x and %#x", r.sendError, r.recvError)
+	}
+	if d := r.received.Sub(r.sent); d < 12499*time.Microsecond || d > 12501*time.Microsecond {
+		t.Errorf("Expected a 12.5ms delay, got %v", d)
+	}
+
+	if r := parseOwampRecord(owampRecordBytes(43, sent, time.Time{}, 255)); !r.lost || !r.received.IsZero() {
+		t.Errorf("Expected a zero receive timestamp to mark the packet lost, got %+v", r)
+	}
+}
+
+func TestSummarizeOwamp(t *testing.T) {
+	start := time.Date(2026, 10, 14, 9, 0, 0, 0, time.UTC)
+	delay := []time.Duration{10, 12, 0, 11, 15, 10}
+	var records []owampRecord
+	for seq, d := range delay {
+		sent := start.Add(time.Duration(seq) * 100 * time.Millisecond)
+		received := time.Time{}
+		if d != 0 {
+			received = sent.Add(d * time.Millisecond)
+		}
+		records = append(records, parseOwampRecord(owampRecordBytes(uint32(seq), sent, received, 250)))
+	}
+	// Packet 4 arrives after packet 5, and packet 1 twice
+	records[4].received = records[5].received.Add(time.Millisecond)
+	dup := records[1]
+	dup.received = dup.received.Add(5 * time.Millisecond)
+	records = append(records, dup)
+
+	r := summarizeOwamp(records, 6)
+	if r.Received != 5 || r.LossPercent < 16.6 || r.LossPercent > 16.7 {
+		t.Errorf("Expected 5 of 6 received (16.7%% loss), got %d (%.2f%%)", r.Received, r.LossPercent)
+	}
+	if r.Duplicates != 1 {
+		t.Errorf("Expected 1 duplicate, got %d", r.Duplicates)
+	}
+	if r.Reordered != 1 {
+		t.Errorf("Expected packet 4 reordered, got %d reordered", r.Reordered)
+	}
+	// 10, 12, 11, 111 and 10ms: the first copy's 12ms for packet 1
+	if r.Delay == nil || r.Delay.Count != 5 || math.Abs(r.Delay.Mean-30.8) > 0.001 {
+		t.Errorf("Expected 5 delays averaging 30.8ms, got %+v", r.Delay)
+	}
+	// Delayed past packet 5, packet 4 took 111ms. The loss of packet 2 leaves
+	// the pairs 0-1 (+2ms), 3-4 (+100ms) and 4-5 (-101ms).
+	if math.Abs(r.IPDVMinMs+101) > 0.001 || math.Abs(r.IPDVMaxMs-100) > 0.001 {
+		t.Errorf("Expected IPDV from -101 to 100ms, got %.3f to %.3f", r.IPDVMinMs, r.IPDVMaxMs)
+	}
+	if math.Abs(r.JitterMs-203.0/3) > 0.001 {
+		t.Errorf("Expected jitter %.3fms, got %.3f", 203.0/3, r.JitterMs)
+	}
+}
+
+func TestSummarizeOwampAllLost(t *testing.T) {
+	start := time.Date(2026, 10, 14, 9, 0, 0, 0, time.UTC)
+	records := []owampRecord{
+		parseOwampRecord(owampRecordBytes(0, start, time.Time{}, 255)),
+		parseOwampRecord(owampRecordBytes(1, start.Add(time.Second), time.Time{}, 255)),
+	}
+	r := summarizeOwamp(records, 2)
+	if r.Received != 0 || r.LossPercent != 100 || r.Delay != nil || r.JitterMs != 0 {
+		t.Errorf("Expected total loss without delays, got %+v", r)
+	}
+}
@@ -0,0 +1,633 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Agent meshes: several instances of this API test each other, every agent
+// against every other one, in both directions. The agent that gets the request
+// coordinates: it finds its peers in MESH_PEERS or MESH_PEERS_DNS, starts the
+// responder of the test type on each one, has every peer run the client side
+// towards every other, and stops the responders it started again.
+const (
+	TEST_TYPE_PEER_MESH = "peer_mesh" // Job type of an asynchronous agent mesh run; not a test type
+
+	PEER_STATUS_HEALTHY     = "healthy"
+	PEER_STATUS_DRAINING    = "draining"
+	PEER_STATUS_UNREACHABLE = "unreachable"
+
+	PEER_RESPONDER_STARTED = "started" // By this run, and stopped when it ends
+	PEER_RESPONDER_RUNNING = "running" // Already; left running
+	PEER_RESPONDER_FAILED  = "failed"
+
+	MAX_MESH_PEERS             = 32
+	DEFAULT_PEER_MESH_PARALLEL = 4
+	MAX_PEER_MESH_PARALLEL     = 16
+	PEER_CONTROL_TIMEOUT       = 5 * time.Second // Health checks and responder starts and stops
+)
+
+// Peer is an agent of the mesh
+type Peer struct {
+	Name string `json:"name"` // Host of the URL, which the other agents test towards
+	URL  string `json:"url"`
+}
+
+// PeerStatus is a peer in GET /peers and in agent mesh results
+type PeerStatus struct {
+	Peer
+	Status    string `json:"status"`              // healthy, draining or unreachable
+	Responder string `json:"responder,omitempty"` // started, running or failed
+	Error     string `json:"error,omitempty"`
+}
+
+// PeerMeshRequest is the body of POST /peers/mesh/run
+type PeerMeshRequest struct {
+	Type     string          `json:"type"`     // twamp or ping
+	Request  json.RawMessage `json:"request"`  // Template of every test, without server_host
+	Peers    []string        `json:"peers"`    // Names of the peers to include (default: all)
+	Parallel int             `json:"parallel"` // Tests at a time across all agents (default: 4)
+}
+
+// PeerMeshResult is the test of one ordered pair of peers
+type PeerMeshResult struct {
+	Source      string             `json:"source"`              // Peer that ran the client side
+	Destination string             `json:"destination"`         // Peer whose responder it tested towards
+	Status      string             `json:"status"`              // ok or error
+	ResultID    string             `json:"result_id,omitempty"` // Stored on the source, in its GET /results/{id}
+	Metrics     map[string]float64 `json:"metrics,omitempty"`
+	Error       string             `json:"error,omitempty"`
+	Code        string             `json:"code,omitempty"`
+	HTTPStatus  int                `json:"http_status,omitempty"` // Status the source answered the test with
+	DurationSec float64            `json:"duration_sec"`
+}
+
+// peerSettings are the MESH_PEERS* settings
+type peerSettings struct {
+	static []string // MESH_PEERS
+	dns    string   // MESH_PEERS_DNS
+	scheme string   // MESH_PEERS_SCHEME, of the URLs MESH_PEERS_DNS finds
+	apiKey string   // MESH_PEERS_API_KEY
+}
+
+var (
+	meshPeers  peerSettings
+	peerClient = checkedHTTPClient(0) // Bounded by the context of each call
+	errNoPeers = errors.New("no peers configured (set MESH_PEERS or MESH_PEERS_DNS)")
+	errPeerDNS = errors.New("MESH_PEERS_DNS did not resolve")
+)
+
+// configurePeers reads the peers of agent mesh runs
+func configurePeers() {
+	meshPeers = peerSettings{dns: os.Getenv("MESH_PEERS_DNS"), scheme: os.Getenv("MESH_PEERS_SCHEME"), apiKey: os.Getenv("MESH_PEERS_API_KEY")}
+	for _, p := range strings.Split(os.Getenv("MESH_PEERS"), ",") {
+		if p = strings.TrimRight(strings.TrimSpace(p), "/"); p != "" {
+			meshPeers.static = append(meshPeers.static, p)
+		}
+	}
+	if meshPeers.scheme == "" {
+		meshPeers.scheme = "http"
+	}
+	if len(meshPeers.static) > 0 || meshPeers.dns != "" {
+		log.Printf("Agent mesh peers: %d listed, DNS %q", len(meshPeers.static), meshPeers.dns)
+	}
+}
+
+// discoverPeers returns the listed peers and those MESH_PEERS_DNS resolves
+// to, looked up again on every call: the targets of an SRV name starting with
+// "_", or every address of a host:port
+func discoverPeers(ctx context.Context, s peerSettings) ([]Peer, error) {
+	urls := append([]string(nil), s.static...)
+	if s.dns != "" {
+		found, err := resolvePeers(ctx, s.dns, s.scheme)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", errPeerDNS, err)
+		}
+		urls = append(urls, found...)
+	}
+	if len(urls) == 0 {
+		return nil, errNoPeers
+	}
+	return peersFromURLs(urls)
+}
+
+func resolvePeers(ctx context.Context, name, scheme string) ([]string, error) {
+	var urls []string
+	if strings.HasPrefix(name, "_") {
+		_, records, err := net.DefaultResolver.LookupSRV(ctx, "", "", name)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range records {
+			urls = append(urls, scheme+"://"+net.JoinHostPort(strings.TrimSuffix(r.Target, "."), strconv.Itoa(int(r.Port))))
+		}
+		return urls, nil
+	}
+	host, port, err := net.SplitHostPort(name)
+	if err != nil {
+		return nil, fmt.Errorf("must be an SRV name or host:port")
+	}
+	addrs, err := net.DefaultResolver.LookupHost(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range addrs {
+		urls = append(urls, scheme+"://"+net.JoinHostPort(a, port))
+	}
+	return urls, nil
+}
+
+// peersFromURLs names each peer by the host of its URL, or by host:port when
+// several peers share a host, and drops duplicates
+func peersFromURLs(urls []string) ([]Peer, error) {
+	var peers []Peer
+	hosts := make(map[string]int)
+	seen := make(map[string]bool)
+	for _, raw := range urls {
+		u, err := url.Parse(raw)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+			return nil, fmt.Errorf("invalid peer URL %q (expected http:// or https:// with a host)", raw)
+		}
+		base := u.Scheme + "://" + u.Host + strings.TrimRight(u.Path, "/")
+		if seen[base] {
+			continue
+		}
+		seen[base] = true
+		hosts[u.Hostname()]++
+		peers = append(peers, Peer{Name: u.Hostname(), URL: base})
+	}
+	for i, p := range peers {
+		if hosts[p.Name] > 1 {
+			u, _ := url.Parse(p.URL)
+			peers[i].Name = u.Host
+		}
+	}
+	return peers, nil
+}
+
+// peerResponse is an ApiResponse of another agent, with its data left raw
+type peerResponse struct {
+	Status string          `json:"status"`
+	Data   json.RawMessage `json:"data"`
+	Error  string          `json:"error"`
+	Code   string          `json:"code"`
+}
+
+// call sends a request to a peer's API and decodes its response
+func (p Peer) call(ctx context.Context, method, path string, body interface{}) (int, *peerResponse, error) {
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			return 0, nil, err
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, method, p.URL+path, &buf)
+	if err != nil {
+		return 0, nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if meshPeers.apiKey != "" {
+		req.Header.Set(API_KEY_HEADER, meshPeers.apiKey)
+	}
+	resp, err := peerClient.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	var pr peerResponse
+	if err := json.NewDecoder(resp.Body).Decode(&pr); err != nil {
+		return resp.StatusCode, nil, fmt.Errorf("decode response of %s: %v", p.Name, err)
+	}
+	return resp.StatusCode, &pr, nil
+}
+
+// health checks whether a peer answers GET /health
+func (p Peer) health(ctx context.Context) PeerStatus {
+	ctx, cancel := context.WithTimeout(ctx, PEER_CONTROL_TIMEOUT)
+	defer cancel()
+	st := PeerStatus{Peer: p, Status: PEER_STATUS_UNREACHABLE}
+	status, resp, err := p.call(ctx, http.MethodGet, "/health", nil)
+	switch {
+	case err != nil:
+		st.Error = err.Error()
+	case status == http.StatusOK:
+		st.Status = PEER_STATUS_HEALTHY
+	case resp.Status == PEER_STATUS_DRAINING:
+		st.Status = PEER_STATUS_DRAINING
+	default:
+		st.Error = fmt.Sprintf("health check returned %d", status)
+	}
+	return st
+}
+
+// peerHealth checks every peer at once
+func peerHealth(ctx context.Context, peers []Peer) []*PeerStatus {
+	statuses := make([]*PeerStatus, len(peers))
+	var wg sync.WaitGroup
+	for i, p := range peers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			st := p.health(ctx)
+			statuses[i] = &st
+		}()
+	}
+	wg.Wait()
+	return statuses
+}
+
+// peerResponder is the responder a test type's client side needs on the
+// destination, with the configuration to start it with; an empty path means
+// none. The port is the request's server_port, so client and responder agree.
+func peerResponder(testType string, req RunRequest) (string, interface{}) {
+	switch {
+	case testType == TEST_TYPE_TWAMP:
+		return "/twamp/server", TwampServerConfig{Port: req.ServerPort}
+	case testType == TEST_TYPE_PING && strings.ToLower(req.Protocol) == PING_PROTOCOL_ECHO:
+		return "/echo/server", EchoServerConfig{Port: req.ServerPort}
+	}
+	return "", nil
+}
+
+// peerRunPaths are the client run endpoints of the test types agent meshes run
+var peerRunPaths = map[string]string{
+	TEST_TYPE_TWAMP: "/twamp/client/run",
+	TEST_TYPE_PING:  "/ping/client/run",
+}
+
+// peerMeshTest is the prepared test of one ordered pair
+type peerMeshTest struct {
+	source, destination int // Indexes into the plan's peers
+	body                []byte
+}
+
+// peerMeshPlan is a validated agent mesh run. Like meshPlan it is a
+// TestRunner only so that ?async=true runs it as a job.
+type peerMeshPlan struct {
+	testType  string
+	peers     []Peer
+	parallel  int
+	responder string // Path of the responder to start on every peer, or ""
+	config    interface{}
+	tests     []peerMeshTest
+}
+
+// newPeerMeshPlan picks the peers and builds the test of every ordered pair,
+// each checked against this agent's validation first
+func newPeerMeshPlan(pr PeerMeshRequest, peers []Peer) (*peerMeshPlan, error) {
+	testType := strings.ToLower(pr.Type)
+	_, ok := peerRunPaths[testType]
+	runner, _ := lookupRunner(testType)
+	switch {
+	case !ok:
+		return nil, fmt.Errorf("invalid type %q (expected %s or %s)", pr.Type, TEST_TYPE_TWAMP, TEST_TYPE_PING)
+	case pr.Parallel < 0 || pr.Parallel > MAX_PEER_MESH_PARALLEL:
+		return nil, fmt.Errorf("parallel must be between 1 and %d", MAX_PEER_MESH_PARALLEL)
+	}
+	if len(pr.Peers) > 0 {
+		byName := make(map[string]Peer, len(peers))
+		for _, p := range peers {
+			byName[p.Name] = p
+		}
+		var picked []Peer
+		for _, name := range pr.Peers {
+			p, ok := byName[name]
+			if !ok {
+				return nil, fmt.Errorf("unknown peer %q (see GET /peers)", name)
+			}
+			picked = append(picked, p)
+		}
+		peers = picked
+	}
+	switch {
+	case len(peers) < 2:
+		return nil, fmt.Errorf("an agent mesh needs at least 2 peers, got %d", len(peers))
+	case len(peers) > MAX_MESH_PEERS:
+		return nil, fmt.Errorf("an agent mesh takes at most %d peers, got %d", MAX_MESH_PEERS, len(peers))
+	}
+
+	var template map[string]json.RawMessage
+	if len(pr.Request) > 0 {
+		if err := json.Unmarshal(pr.Request, &template); err != nil {
+			return nil, fmt.Errorf("request must be a JSON object")
+		}
+	}
+	if _, ok := template["server_host"]; ok {
+		return nil, fmt.Errorf("request must not set server_host; every peer tests towards every other")
+	}
+
+	plan := &peerMeshPlan{testType: testType, peers: peers, parallel: pr.Parallel}
+	if plan.parallel == 0 {
+		plan.parallel = DEFAULT_PEER_MESH_PARALLEL
+	}
+	var fields []FieldError
+	seen := make(map[string]bool)
+	bodies := make([][]byte, len(peers)) // Of the tests towards each peer
+	for dst, d := range peers {
+		body := meshTestBody(template, "server_host", peerHost(d))
+		var req RunRequest
+		if err := json.Unmarshal(body, &req); err != nil {
+			return nil, fmt.Errorf("invalid request: %v", err)
+		}
+		if dst == 0 {
+			plan.responder, plan.config = peerResponder(testType, req)
+		}
+		var ve *ValidationError
+		if err := validateRunRequest(runner, req); errors.As(err, &ve) {
+			for _, f := range ve.Fields {
+				if f.Field == "server_host" {
+					f.Field, f.Value = "peers", d.Name
+				} else if f.Field = "request." + f.Field; seen[f.Field] {
+					continue
+				}
+				seen[f.Field] = true
+				fields = append(fields, f)
+			}
+		}
+		bodies[dst] = body
+	}
+	for src := range peers {
+		for dst := range peers {
+			if src != dst {
+				plan.tests = append(plan.tests, peerMeshTest{source: src, destination: dst, body: bodies[dst]})
+			}
+		}
+	}
+	if len(fields) > 0 {
+		return nil, &codedError{ERR_VALIDATION, &ValidationError{Fields: fields}}
+	}
+	return plan, nil
+}
+
+// peerHost is the host other agents test towards a peer with
+func peerHost(p Peer) string {
+	u, _ := url.Parse(p.URL)
+	return u.Hostname()
+}
+
+func (p *peerMeshPlan) Name() string {
+	return TEST_TYPE_PEER_MESH
+}
+
+func (p *peerMeshPlan) Validate(v *requestValidator, req RunRequest) {}
+
+// label names the peers of the run in job listings
+func (p *peerMeshPlan) label() string {
+	return fmt.Sprintf("%d peers", len(p.peers))
+}
+
+// Run starts the responders, runs the test of every ordered pair, parallel at
+// a time, and stops the responders it started. A pair whose test fails is a
+// row of the matrix; only a canceled run fails.
+func (p *peerMeshPlan) Run(ctx context.Context, req RunRequest, _ *Profile) (map[string]interface{}, int, error) {
+	logf(ctx, "Agent mesh: %s tests between %d peers (parallel=%d)", p.testType, len(p.peers), p.parallel)
+	started := time.Now()
+
+	peers := peerHealth(ctx, p.peers)
+	if p.responder != "" {
+		p.startResponders(ctx, peers)
+		defer p.stopResponders(peers)
+	}
+
+	req.progress.start("duration_sec", len(p.tests))
+	results := make([]*PeerMeshResult, len(p.tests))
+	slots := make(chan struct{}, p.parallel)
+	var wg sync.WaitGroup
+	for i, t := range p.tests {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+			results[i] = p.runTest(ctx, t, peers)
+			req.progress.add(SeriesPoint{T: time.Since(started).Seconds(), Value: results[i].DurationSec})
+		}()
+	}
+	wg.Wait()
+	if ctx.Err() != nil {
+		return nil, http.StatusInternalServerError, canceledError(ctx)
+	}
+
+	succeeded := 0
+	columns := map[string]bool{}
+	matrix := make(map[string]map[string]map[string]float64, len(p.peers))
+	for _, r := range results {
+		if r.Status != MESH_STATUS_OK {
+			continue
+		}
+		succeeded++
+		for path := range r.Metrics {
+			columns[path] = true
+		}
+		if matrix[r.Source] == nil {
+			matrix[r.Source] = make(map[string]map[string]float64)
+		}
+		matrix[r.Source][r.Destination] = r.Metrics
+	}
+	data := map[string]interface{}{
+		"type":         p.testType,
+		"peers":        peers,
+		"pairs":        len(results),
+		"succeeded":    succeeded,
+		"failed":       len(results) - succeeded,
+		"parallel":     p.parallel,
+		"metrics":      meshColumns(p.testType, columns),
+		"matrix":       matrix,
+		"results":      results,
+		"duration_sec": time.Since(started).Seconds(),
+	}
+	return data, http.StatusOK, nil
+}
+
+// startResponders starts the responder on every healthy peer; one that is
+// already running is used as it is
+func (p *peerMeshPlan) startResponders(ctx context.Context, peers []*PeerStatus) {
+	var wg sync.WaitGroup
+	for _, st := range peers {
+		if st.Status != PEER_STATUS_HEALTHY {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, PEER_CONTROL_TIMEOUT)
+			defer cancel()
+			status, resp, err := st.call(ctx, http.MethodPost, p.responder+"/start", p.config)
+			switch {
+			case err != nil:
+				st.Responder, st.Error = PEER_RESPONDER_FAILED, err.Error()
+			case status == http.StatusOK:
+				st.Responder = PEER_RESPONDER_STARTED
+			case status == http.StatusConflict:
+				st.Responder = PEER_RESPONDER_RUNNING
+			default:
+				st.Responder, st.Error = PEER_RESPONDER_FAILED, fmt.Sprintf("starting the responder returned %d: %s", status, resp.Error)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// stopResponders stops the responders this run started, even when it was
+// canceled
+func (p *peerMeshPlan) stopResponders(peers []*PeerStatus) {
+	var wg sync.WaitGroup
+	for _, st := range peers {
+		if st.Responder != PEER_RESPONDER_STARTED {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), PEER_CONTROL_TIMEOUT)
+			defer cancel()
+			if status, _, err := st.call(ctx, http.MethodPost, p.responder+"/stop", nil); err != nil || status != http.StatusOK {
+				log.Printf("Agent mesh: stopping the responder of %s failed: %d %v", st.Name, status, err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// runTest has the source of a pair run the test towards the destination
+func (p *peerMeshPlan) runTest(ctx context.Context, t peerMeshTest, peers []*PeerStatus) *PeerMeshResult {
+	src, dst := peers[t.source], peers[t.destination]
+	r := &PeerMeshResult{Source: src.Name, Destination: dst.Name, Status: MESH_STATUS_ERROR}
+	started := time.Now()
+	defer func() { r.DurationSec = time.Since(started).Seconds() }()
+	switch {
+	case src.Status != PEER_STATUS_HEALTHY:
+		r.Error = fmt.Sprintf("source %s is %s", src.Name, src.Status)
+		return r
+	case dst.Status != PEER_STATUS_HEALTHY:
+		r.Error = fmt.Sprintf("destination %s is %s", dst.Name, dst.Status)
+		return r
+	case dst.Responder == PEER_RESPONDER_FAILED:
+		r.Error = fmt.Sprintf("responder of %s did not start: %s", dst.Name, dst.Error)
+		return r
+	}
+
+	status, resp, err := src.call(ctx, http.MethodPost, peerRunPaths[p.testType], json.RawMessage(t.body))
+	if err != nil {
+		r.Error = err.Error()
+		return r
+	}
+	if status != http.StatusOK {
+		r.Error, r.Code, r.HTTPStatus = resp.Error, resp.Code, status
+		return r
+	}
+	var data map[string]interface{}
+	if err := json.Unmarshal(resp.Data, &data); err != nil {
+		r.Error = fmt.Sprintf("decode result of %s: %v", src.Name, err)
+		return r
+	}
+	r.Status = MESH_STATUS_OK
+	r.ResultID, _ = data["id"].(string)
+	r.Metrics = make(map[string]float64)
+	for _, m := range resultMetrics[p.testType] {
+		if v, ok := metricValue(data, m.Path); ok {
+			r.Metrics[m.Path] = v
+		}
+	}
+	return r
+}
+
+// peerError answers a failed peer discovery: 404 without peers configured,
+// 502 when the DNS lookup failed, 400 for an invalid URL
+func peerError(w http.ResponseWriter, err error) {
+	status := http.StatusBadRequest
+	switch {
+	case errors.Is(err, errNoPeers):
+		status = http.StatusNotFound
+	case errors.Is(err, errPeerDNS):
+		status = http.StatusBadGateway
+	}
+	jsonResponse(w, ApiResponse{
+		Status: "error",
+		Error:  err.Error(),
+	}, status)
+}
+
+func peerList(w http.ResponseWriter, r *http.Request) {
+	peers, err := discoverPeers(r.Context(), meshPeers)
+	if err != nil {
+		peerError(w, err)
+		return
+	}
+	jsonResponse(w, ApiResponse{
+		Status: "ok",
+		Data:   peerHealth(r.Context(), peers),
+	}, http.StatusOK)
+}
+
+func peerMeshRun(w http.ResponseWriter, r *http.Request) {
+	var pr PeerMeshRequest
+	if err := json.NewDecoder(r.Body).Decode(&pr); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	output, err := resultOutput(r)
+	if err != nil {
+		jsonResponse(w, ApiResponse{
+			Status: "error",
+			Error:  err.Error(),
+		}, http.StatusBadRequest)
+		return
+	}
+	async := false
+	if v := r.URL.Query().Get("async"); v != "" {
+		if async, err = strconv.ParseBool(v); err != nil {
+			jsonResponse(w, ApiResponse{
+				Status: "error",
+				Error:  fmt.Sprintf("invalid async %q (expected true or false)", v),
+			}, http.StatusBadRequest)
+			return
+		}
+	}
+	peers, err := discoverPeers(r.Context(), meshPeers)
+	if err != nil {
+		peerError(w, err)
+		return
+	}
+	plan, err := newPeerMeshPlan(pr, peers)
+	if err != nil {
+		writeRunResponse(w, output, TEST_TYPE_PEER_MESH, "", nil, http.StatusBadRequest, err)
+		return
+	}
+	end, err := drainer.begin()
+	if err != nil {
+		writeRunResponse(w, output, plan.Name(), plan.label(), nil, http.StatusServiceUnavailable, err)
+		return
+	}
+	if !async {
+		defer end()
+		data, status, err := plan.Run(r.Context(), RunRequest{}, nil)
+		writeRunResponse(w, output, plan.Name(), plan.label(), data, status, err)
+		return
+	}
+
+	job := jobStore.Start(plan, RunRequest{ServerHost: plan.label()}, nil, end)
+	w.Header().Set("Location", versionedPath(r, "/jobs/"+job.ID))
+	jsonResponse(w, ApiResponse{
+		Status: "ok",
+		Data:   job,
+	}, http.StatusAccepted)
+}
@@ -0,0 +1,44 @@
+package api
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestPeersFromURLs(t *testing.T) {
+	peers, err := peersFromURLs([]string{
+		"http://agent-fra1.example.net:8080",
+		"https://agent-ams1.example.net/api/",
+		"http://agent-fra1.example.net:8080",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Peer{
+		{Name: "agent-fra1.example.net", URL: "http://agent-fra1.example.net:8080"},
+		{Name: "agent-ams1.example.net", URL: "https://agent-ams1.example.net/api"},
+	}
+	if fmt.Sprint(peers) != fmt.Sprint(expected) {
+		t.Errorf("Expected %v, got %v", expected, peers)
+	}
+
+	// Agents on one host are told apart by their ports
+	peers, err = peersFromURLs([]string{"http://10.0.0.1:8080", "http://10.0.0.1:8081", "http://[2001:db8::1]:8080"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{"10.0.0.1:8080", "10.0.0.1:8081", "2001:db8::1"}
+	for i, p := range peers {
+		if p.Name != names[i] {
+			t.Errorf("Peer %d: expected name %s, got %s", i, names[i], p.Name)
+		}
+	}
+}
+
+func TestPeersFromURLsInvalid(t *testing.T) {
+	for _, raw := range []string{"agent-fra1.example.net:8080", "ftp://agent-fra1.example.net", "http://", "http://%zz"} {
+		if _, err := peersFromURLs([]string{raw}); err == nil {
+			t.Errorf("%s: expected an error", raw)
+		}
+	}
+}
@@ -0,0 +1,721 @@
+package api
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	mathrand "math/rand"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"golang.org/x/net/ipv4"
+
+	"network-test-api/pkg/nettest"
+	"network-test-api/pkg/stats"
+)
+
+// Ping tests: ICMP echo where the agent may open ICMP sockets, UDP datagrams
+// to a port otherwise, or probes of our own to a UDP echo responder
+const (
+	PING_PROTOCOL_ICMP = "icmp" // Echo requests on a raw or unprivileged datagram ICMP socket
+	PING_PROTOCOL_UDP  = "udp"  // A datagram per probe; a reply or port unreachable both mean it arrived
+	PING_PROTOCOL_ECHO = "echo" // Numbered, timestamped datagrams a UDP echo responder sends back, see udp_echo.go
+
+	PING_SOCKET_RAW      = "raw"      // Needs root or CAP_NET_RAW
+	PING_SOCKET_DATAGRAM = "datagram" // Linux and macOS without privileges, within net.ipv4.ping_group_range
+	PING_SOCKET_UDP      = "udp"
+
+	DEFAULT_PING_COUNT    = 10
+	MAX_PING_COUNT        = 1000
+	DEFAULT_PING_INTERVAL = 1.0  // Seconds between probes
+	MIN_PING_INTERVAL     = 0.01 // Seconds
+	MAX_PING_INTERVAL     = 60   // Seconds
+	DEFAULT_PING_SIZE     = 56   // Payload bytes, as ping(8) sends
+	MAX_PING_SIZE         = 65000
+	DEFAULT_PING_TTL      = 64
+	DEFAULT_UDP_PING_PORT = 33434 // First traceroute port, normally closed
+
+	PING_TIMEOUT = 2 * time.Second // A probe without an answer by then is lost
+
+	PING_STATUS_REPLY            = "reply"
+	PING_STATUS_PORT_UNREACHABLE = "port_unreachable" // UDP probe refused by the target, which still means it arrived
+	PING_STATUS_TTL_EXCEEDED     = "ttl_exceeded"     // A router on the way dropped it at ttl 0
+	PING_STATUS_UNREACHABLE      = "unreachable"      // A router reported the target unreachable
+	PING_STATUS_TIMEOUT          = "timeout"
+
+	icmpEchoHeader = 8
+)
+
+// ICMP message types (RFC 792, RFC 4443)
+const (
+	icmpv4EchoReply       = 0
+	icmpv4Unreachable     = 3
+	icmpv4FragNeeded      = 4 // Code of unreachable: DF set, but the next hop's MTU is smaller
+	icmpv4EchoRequest     = 8
+	icmpv4TimeExceeded    = 11
+	icmpv6Unreachable     = 1
+	icmpv6PacketTooBig    = 2
+	icmpv6TimeExceeded    = 3
+	icmpv6EchoRequest     = 128
+	icmpv6EchoReply       = 129
+	ipv6FixedHeaderLength = 40
+
+	ipProtoICMP   = 1
+	ipProtoTCP    = 6
+	ipProtoUDP    = 17
+	ipProtoICMPv6 = 58
+)
+
+// PingProbe is the outcome of one probe
+type PingProbe struct {
+	Seq    int     `json:"seq"`
+	Status string  `json:"status"`
+	RTTMs  float64 `json:"rtt_ms,omitempty"`
+	TTL    int     `json:"ttl,omitempty"`  // TTL the reply arrived with, ICMP over IPv4 only
+	From   string  `json:"from,omitempty"` // Router that sent an error back
+}
+
+// PingReport is the outcome of a ping test
+type PingReport struct {
+	Protocol       string      `json:"protocol"`
+	Socket         string      `json:"socket"`
+	FallbackReason string      `json:"fallback_reason,omitempty"` // Why ICMP was not used
+	Family         string      `json:"family"`
+	Address        string      `json:"address"`
+	Port           int         `json:"port,omitempty"` // UDP and echo only
+	PacketSize     int         `json:"packet_size"`
+	TTL            int         `json:"ttl"`
+	IntervalSec    float64     `json:"interval_sec"`
+	Transmitted    int         `json:"transmitted"`
+	Received       int         `json:"received"`
+	Errors         int         `json:"errors"`     // ttl_exceeded and unreachable answers
+	Duplicates     int         `json:"duplicates"` // Extra replies to an answered probe
+	LossPercent    float64     `json:"loss_percent"`
+	RTTMinMs       float64     `json:"rtt_min_ms"`
+	RTTAvgMs       float64     `json:"rtt_avg_ms"`
+	RTTMaxMs       float64     `json:"rtt_max_ms"`
+	RTTStddevMs    float64     `json:"rtt_stddev_ms"`
+	RTTMedianMs    float64     `json:"rtt_median_ms"`
+	RTTMADMs       float64     `json:"rtt_mad_ms"` // Median absolute deviation
+	Probes         []PingProbe `json:"probes"`
+}
+
+// summarize counts the probes and computes the RTT statistics of those that arrived
+func (r *PingReport) summarize() {
+	r.Transmitted = len(r.Probes)
+	var rtts []float64
+	for _, p := range r.Probes {
+		switch p.Status {
+		case PING_STATUS_REPLY, PING_STATUS_PORT_UNREACHABLE:
+			r.Received++
+			rtts = append(rtts, p.RTTMs)
+		case PING_STATUS_TTL_EXCEEDED, PING_STATUS_UNREACHABLE:
+			r.Errors++
+		}
+	}
+	if r.Transmitted > 0 {
+		r.LossPercent = 100 * float64(r.Transmitted-r.Received) / float64(r.Transmitted)
+	}
+	r.RTTMinMs, r.RTTAvgMs, r.RTTMaxMs, r.RTTStddevMs = rttStats(rtts)
+	r.RTTMedianMs, r.RTTMADMs = stats.Median(rtts), stats.MAD(rtts)
+}
+
+// rttStats returns the minimum, mean, maximum and population standard deviation,
+// by Welford's algorithm, of round trip times
+func rttStats(rtts []float64) (lo, mean, hi, stddev float64) {
+	if len(rtts) == 0 {
+		return 0, 0, 0, 0
+	}
+	lo, hi = rtts[0], rtts[0]
+	var w stats.Welford
+	for _, rtt := range rtts {
+		lo, hi = math.Min(lo, rtt), math.Max(hi, rtt)
+		w.Add(rtt)
+	}
+	return lo, w.Mean(), hi, w.StdDev()
+}
+
+// pingAnswer is a reply or error matched to a probe
+type pingAnswer struct {
+	seq    int
+	status string
+	ttl    int
+	from   string
+	at     time.Time
+}
+
+// pingProber sends numbered probes and delivers what comes back
+type pingProber interface {
+	send(seq int) error
+	answers() <-chan pingAnswer
+	close()
+}
+
+// icmpEcho encodes an echo request with a payload of size bytes
+func icmpEcho(v6 bool, id, seq, size int) []byte {
+	b := make([]byte, icmpEchoHeader+size)
+	b[0] = icmpv4EchoRequest
+	if v6 {
+		b[0] = icmpv6EchoRequest
+	}
+	binary.BigEndian.PutUint16(b[4:6], uint16(id))
+	binary.BigEndian.PutUint16(b[6:8], uint16(seq))
+	for i := icmpEchoHeader; i < len(b); i++ {
+		b[i] = byte(i)
+	}
+	if !v6 {
+		// The kernel computes the ICMPv6 checksum, which covers a pseudo-header
+		binary.BigEndian.PutUint16(b[2:4], internetChecksum(b))
+	}
+	return b
+}
+
+// internetChecksum is the ones' complement sum of RFC 1071
+func internetChecksum(b []byte) uint16 {
+	var sum uint32
+	for i := 0; i+1 < len(b); i += 2 {
+		sum += uint32(b[i])<<8 | uint32(b[i+1])
+	}
+	if len(b)%2 == 1 {
+		sum += uint32(b[len(b)-1]) << 8
+	}
+	for sum>>16 != 0 {
+		sum = sum&0xffff + sum>>16
+	}
+	return ^uint16(sum)
+}
+
+// icmpQuote is an ICMP message about a probe: an echo reply, or an error quoting
+// the probe's IP header and the first 8 bytes of its ICMP, UDP or TCP header
+type icmpQuote struct {
+	status string
+	proto  int    // IP protocol of the probe
+	dst    net.IP // Destination of the probe; nil for echo replies
+	header []byte // First 8 bytes of the probe's header; for echo replies the reply's own
+}
+
+// icmpStatus classifies an ICMP message type as a probe status
+func icmpStatus(typ, code byte, v6 bool) (string, bool) {
+	switch {
+	case !v6 && typ == icmpv4EchoReply, v6 && typ == icmpv6EchoReply:
+		return PING_STATUS_REPLY, true
+	case !v6 && typ == icmpv4TimeExceeded, v6 && typ == icmpv6TimeExceeded:
+		return PING_STATUS_TTL_EXCEEDED, true
+	case !v6 && typ == icmpv4Unreachable && code == 3, v6 && typ == icmpv6Unreachable && code == 4:
+		return PING_STATUS_PORT_UNREACHABLE, true
+	case !v6 && typ == icmpv4Unreachable, v6 && typ == icmpv6Unreachable:
+		return PING_STATUS_UNREACHABLE, true
+	}
+	return "", false
+}
+
+// parseICMPQuote decodes an echo reply, time exceeded or unreachable message
+func parseICMPQuote(b []byte, v6 bool) (icmpQuote, bool) {
+	if !v6 && len(b) > 0 && b[0]>>4 == 4 {
+		// Raw IPv4 sockets may deliver the IP header
+		ihl := int(b[0]&0x0f) * 4
+		if len(b) < ihl {
+			return icmpQuote{}, false
+		}
+		b = b[ihl:]
+	}
+	if len(b) < icmpEchoHeader {
+		return icmpQuote{}, false
+	}
+	status, ok := icmpStatus(b[0], b[1], v6)
+	if !ok {
+		return icmpQuote{}, false
+	}
+	if status == PING_STATUS_REPLY {
+		proto := ipProtoICMP
+		if v6 {
+			proto = ipProtoICMPv6
+		}
+		return icmpQuote{status: status, proto: proto, header: b[:icmpEchoHeader]}, true
+	}
+
+	return parseQuotedProbe(status, b[icmpEchoHeader:], v6)
+}
+
+// parseQuotedProbe decodes the probe an ICMP error quotes after its 8 byte header
+func parseQuotedProbe(status string, inner []byte, v6 bool) (icmpQuote, bool) {
+	q := icmpQuote{status: status}
+	headerLen := ipv6FixedHeaderLength
+	if v6 {
+		if len(inner) < headerLen {
+			return icmpQuote{}, false
+		}
+		q.proto, q.dst = int(inner[6]), net.IP(inner[24:40])
+	} else {
+		if len(inner) < 20 {
+			return icmpQuote{}, false
+		}
+		headerLen = int(inner[0]&0x0f) * 4
+		q.proto, q.dst = int(inner[9]), net.IP(inner[16:20])
+	}
+	if len(inner) < headerLen+icmpEchoHeader {
+		return icmpQuote{}, false
+	}
+	q.header = inner[headerLen : headerLen+icmpEchoHeader]
+	return q, true
+}
+
+// echoSeq returns the sequence number of the echo request a message is about.
+// Unless checkID is false (datagram sockets, where the kernel owns the ID and
+// filters replies), messages for other IDs are ignored.
+func echoSeq(q icmpQuote, v6 bool, id int, checkID bool) (int, bool) {
+	proto, echoRequest := ipProtoICMP, byte(icmpv4EchoRequest)
+	if v6 {
+		proto, echoRequest = ipProtoICMPv6, icmpv6EchoRequest
+	}
+	if q.proto != proto || (q.status != PING_STATUS_REPLY && q.header[0] != echoRequest) {
+		return 0, false
+	}
+	if checkID && int(binary.BigEndian.Uint16(q.header[4:6])) != id&0xffff {
+		return 0, false
+	}
+	return int(binary.BigEndian.Uint16(q.header[6:8])), true
+}
+
+// parseICMPAnswer matches an ICMP message to one of our echo requests: the echo
+// reply itself, or a time exceeded or unreachable error quoting the request
+func parseICMPAnswer(b []byte, v6 bool, id int, checkID bool) (int, string, bool) {
+	q, ok := parseICMPQuote(b, v6)
+	if !ok {
+		return 0, "", false
+	}
+	seq, ok := echoSeq(q, v6, id, checkID)
+	if !ok {
+		return 0, "", false
+	}
+	if q.status == PING_STATUS_PORT_UNREACHABLE {
+		q.status = PING_STATUS_UNREACHABLE // Only UDP probes can reach a closed port
+	}
+	return seq, q.status, true
+}
+
+// icmpProber pings over one ICMP socket
+type icmpProber struct {
+	conn    net.PacketConn
+	p4      *ipv4.PacketConn // IPv4 only, for the TTL of replies
+	dst     net.Addr
+	v6      bool
+	raw     bool
+	id      int
+	size    int
+	results chan pingAnswer
+}
+
+// openICMPProber opens a raw ICMP socket, or an unprivileged datagram one where
+// raw sockets are not permitted
+func openICMPProber(ip net.IP, ttl, size int) (*icmpProber, error) {
+	v6 := ip.To4() == nil
+	network, local := "ip4:icmp", "0.0.0.0"
+	if v6 {
+		network, local = "ip6:ipv6-icmp", "::"
+	}
+	p := &icmpProber{v6: v6, raw: true, id: mathrand.Intn(0x10000), size: size, results: make(chan pingAnswer, 64)}
+	conn, err := net.ListenPacket(network, local)
+	if err == nil {
+		p.dst = &net.IPAddr{IP: ip}
+	} else {
+		rawErr := err
+		if conn, err = listenICMPDatagram(v6); err != nil {
+			return nil, fmt.Errorf("raw ICMP socket: %v; datagram ICMP socket: %v", rawErr, err)
+		}
+		p.raw = false
+		p.dst = &net.UDPAddr{IP: ip}
+	}
+	p.conn = conn
+
+	if v6 {
+		err = setIPv6HopLimit(conn.(syscall.Conn), ttl)
+	} else {
+		p.p4 = ipv4.NewPacketConn(conn)
+		if err = p.p4.SetTTL(ttl); err == nil {
+			// Reply TTLs are a nicety; not all platforms report them
+			_ = p.p4.SetControlMessage(ipv4.FlagTTL, true)
+		}
+	}
+	if err != nil && ttl != DEFAULT_PING_TTL {
+		conn.Close()
+		return nil, fmt.Errorf("setting ttl: %v", err)
+	}
+	go p.read()
+	return p, nil
+}
+
+func (p *icmpProber) socket() string {
+	if p.raw {
+		return PING_SOCKET_RAW
+	}
+	return PING_SOCKET_DATAGRAM
+}
+
+func (p *icmpProber) send(seq int) error {
+	_, err := p.conn.WriteTo(icmpEcho(p.v6, p.id, seq, p.size), p.dst)
+	return err
+}
+
+func (p *icmpProber) answers() <-chan pingAnswer { return p.results }
+
+func (p *icmpProber) close() { p.conn.Close() }
+
+// read delivers the answers to our probes until the socket is closed
+func (p *icmpProber) read() {
+	defer close(p.results)
+	buf := make([]byte, icmpEchoHeader+p.size+1024)
+	for {
+		var n, ttl int
+		var from net.Addr
+		var err error
+		if p.p4 != nil {
+			var cm *ipv4.ControlMessage
+			n, cm, from, err = p.p4.ReadFrom(buf)
+			if cm != nil {
+				ttl = cm.TTL
+			}
+		} else {
+			n, from, err = p.conn.ReadFrom(buf)
+		}
+		at := time.Now()
+		if err != nil {
+			return
+		}
+		seq, status, ok := parseICMPAnswer(buf[:n], p.v6, p.id, p.raw)
+		if !ok {
+			continue
+		}
+		a := pingAnswer{seq: seq, status: status, at: at}
+		if status == PING_STATUS_REPLY {
+			a.ttl = ttl
+		} else {
+			a.from = addrIP(from)
+		}
+		p.results <- a
+	}
+}
+
+// addrIP returns the IP of a packet source address
+func addrIP(addr net.Addr) string {
+	switch a := addr.(type) {
+	case *net.IPAddr:
+		return a.IP.String()
+	case *net.UDPAddr:
+		return a.IP.String()
+	}
+	return ""
+}
+
+// udpProber sends each probe from its own socket, so an error the kernel reports
+// on a socket belongs to exactly one probe
+type udpProber struct {
+	dst     *net.UDPAddr
+	ttl     int
+	size    int
+	wg      sync.WaitGroup
+	results chan pingAnswer
+}
+
+func newUDPProber(dst *net.UDPAddr, ttl, size int) *udpProber {
+	return &udpProber{dst: dst, ttl: ttl, size: size, results: make(chan pingAnswer, 64)}
+}
+
+func (p *udpProber) send(seq int) error {
+	network := "udp4"
+	if p.dst.IP.To4() == nil {
+		network = "udp6"
+	}
+	conn, err := net.DialUDP(network, nil, p.dst)
+	if err != nil {
+		return err
+	}
+	if network == "udp4" {
+		err = ipv4.NewConn(conn).SetTTL(p.ttl)
+	} else {
+		err = setIPv6HopLimit(conn, p.ttl)
+	}
+	if err != nil && p.ttl != DEFAULT_PING_TTL {
+		conn.Close()
+		return fmt.Errorf("setting ttl: %v", err)
+	}
+	payload := make([]byte, p.size)
+	binary.BigEndian.PutUint16(payload[:min(2, p.size)], uint16(seq))
+	if _, err := conn.Write(payload); err != nil {
+		conn.Close()
+		return err
+	}
+
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		defer conn.Close()
+		_ = conn.SetReadDeadline(time.Now().Add(PING_TIMEOUT))
+		buf := make([]byte, p.size+1024)
+		_, err := conn.Read(buf)
+		a := pingAnswer{seq: seq, status: PING_STATUS_REPLY, at: time.Now()}
+		switch {
+		case err == nil:
+		case errors.Is(err, syscall.ECONNREFUSED):
+			a.status = PING_STATUS_PORT_UNREACHABLE
+		case errors.Is(err, syscall.EHOSTUNREACH), errors.Is(err, syscall.ENETUNREACH):
+			a.status = PING_STATUS_UNREACHABLE
+		default:
+			return // Timed out
+		}
+		p.results <- a
+	}()
+	return nil
+}
+
+func (p *udpProber) answers() <-chan pingAnswer { return p.results }
+
+func (p *udpProber) close() {
+	go func() {
+		p.wg.Wait()
+		close(p.results)
+	}()
+}
+
+// runPingProbes sends count probes interval apart and collects what comes back
+// until every probe is answered or PING_TIMEOUT passed after the last one
+func runPingProbes(p pingProber, count int, interval time.Duration, progress *JobProgress) ([]PingProbe, int, error) {
+	probes := make([]PingProbe, count)
+	sent := make([]time.Time, count)
+	answered := 0
+	duplicates := 0
+
+	start := time.Now()
+	next := time.NewTimer(0)
+	defer next.Stop()
+	var done <-chan time.Time
+	seq := 0
+	for {
+		select {
+		case <-next.C:
+			sent[seq] = time.Now()
+			probes[seq] = PingProbe{Seq: seq, Status: PING_STATUS_TIMEOUT}
+			if err := p.send(seq); err != nil {
+				return probes[:seq+1], duplicates, fmt.Errorf("sending probe %d: %v", seq, err)
+			}
+			seq++
+			if seq < count {
+				next.Reset(time.Until(start.Add(time.Duration(seq) * interval)))
+			} else {
+				done = time.After(PING_TIMEOUT)
+			}
+		case a, ok := <-p.answers():
+			if !ok {
+				return probes[:seq], duplicates, nil
+			}
+			if a.seq >= seq || a.at.Sub(sent[a.seq]) > PING_TIMEOUT {
+				continue // Not ours, or too late to count
+			}
+			probe := &probes[a.seq]
+			if probe.Status != PING_STATUS_TIMEOUT {
+				duplicates++
+				continue
+			}
+			rtt := a.at.Sub(sent[a.seq])
+			*probe = PingProbe{Seq: a.seq, Status: a.status, TTL: a.ttl, From: a.from}
+			if a.status == PING_STATUS_REPLY || a.status == PING_STATUS_PORT_UNREACHABLE {
+				probe.RTTMs = float64(rtt.Nanoseconds()) / 1e6
+				progress.add(SeriesPoint{T: sent[a.seq].Sub(start).Seconds(), Value: probe.RTTMs})
+			}
+			answered++
+			if answered == count {
+				return probes, duplicates, nil
+			}
+		case <-done:
+			return probes, duplicates, nil
+		}
+	}
+}
+
+// validatePing checks the protocol and bounds of a ping request
+func validatePing(req *RunRequest) error {
+	switch req.Protocol = strings.ToLower(req.Protocol); req.Protocol {
+	case "", PING_PROTOCOL_ICMP, PING_PROTOCOL_UDP, PING_PROTOCOL_ECHO:
+	default:
+		return fmt.Errorf("invalid protocol %q (expected icmp, udp or echo, or omit it to fall back to udp when ICMP sockets are not permitted)", req.Protocol)
+	}
+	switch {
+	case req.ServerHost == "":
+		return fmt.Errorf("server_host is required")
+	case req.Count < 1 || req.Count > MAX_PING_COUNT:
+		return fmt.Errorf("count must be between 1 and %d", MAX_PING_COUNT)
+	case req.Interval < MIN_PING_INTERVAL || req.Interval > MAX_PING_INTERVAL:
+		return fmt.Errorf("interval must be between %g and %d seconds", MIN_PING_INTERVAL, MAX_PING_INTERVAL)
+	case req.PacketSize < 0 || req.PacketSize > MAX_PING_SIZE:
+		return fmt.Errorf("packet_size must be between 0 and %d bytes", MAX_PING_SIZE)
+	case req.TTL < 1 || req.TTL > 255:
+		return fmt.Errorf("ttl must be between 1 and 255")
+	case req.ServerPort != 0 && req.Protocol != PING_PROTOCOL_UDP && req.Protocol != PING_PROTOCOL_ECHO:
+		return fmt.Errorf("server_port is only used with protocol udp or echo")
+	case req.PacketSize < ECHO_HEADER_SIZE && req.Protocol == PING_PROTOCOL_ECHO:
+		return fmt.Errorf("packet_size must be at least %d bytes with protocol echo", ECHO_HEADER_SIZE)
+	}
+	return nil
+}
+
+// runPing applies defaults to a decoded request, runs the ping test and records the result.
+// Errors come with the HTTP status to report them with.
+func runPing(req RunRequest, profile *Profile) (map[string]interface{}, int, error) {
+	if req.Count == 0 {
+		req.Count = DEFAULT_PING_COUNT
+	}
+	if req.Interval == 0 {
+		req.Interval = DEFAULT_PING_INTERVAL
+	}
+	if req.PacketSize == 0 {
+		req.PacketSize = DEFAULT_PING_SIZE
+	}
+	if req.TTL == 0 {
+		req.TTL = DEFAULT_PING_TTL
+	}
+	if err := checkProfileLimits(req, profile); err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	err := validatePing(&req)
+	if err == nil {
+		req.AddressFamily, err = parseAddressFamily(req.AddressFamily)
+	}
+	if err == nil && req.AddressFamily == nettest.FAMILY_COMPARE {
+		err = fmt.Errorf("address_family compare is not available for ping tests; run ipv4 and ipv6 separately")
+	}
+	if err == nil {
+		err = validateLockWait(&req)
+	}
+	if err == nil {
+		err = validateCallbackURL(req.CallbackURL)
+	}
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	lock, release, status, err := lockTest(TEST_TYPE_PING, req, false)
+	if err != nil {
+		return nil, status, err
+	}
+	defer release()
+
+	protocol := req.Protocol
+	if protocol == "" {
+		protocol = "auto"
+	}
+	logf(req.ctx, "Ping test: %s %s (count=%d, interval=%gs, size=%d, ttl=%d, family=%s)",
+		protocol, req.ServerHost, req.Count, req.Interval, req.PacketSize, req.TTL, req.AddressFamily)
+
+	started := time.Now()
+	req.progress.start("rtt_ms", req.Count)
+	report, err := pingTest(req)
+	if err != nil {
+		return nil, http.StatusInternalServerError, fmt.Errorf("Ping test failed: %v", err)
+	}
+
+	data := map[string]interface{}{
+		"server":        req.ServerHost,
+		"protocol":      report.Protocol,
+		"socket":        report.Socket,
+		"family":        report.Family,
+		"address":       report.Address,
+		"packet_size":   report.PacketSize,
+		"ttl":           report.TTL,
+		"interval_sec":  report.IntervalSec,
+		"transmitted":   report.Transmitted,
+		"received":      report.Received,
+		"errors":        report.Errors,
+		"duplicates":    report.Duplicates,
+		"loss_percent":  report.LossPercent,
+		"rtt_min_ms":    report.RTTMinMs,
+		"rtt_avg_ms":    report.RTTAvgMs,
+		"rtt_max_ms":    report.RTTMaxMs,
+		"rtt_stddev_ms": report.RTTStddevMs,
+		"rtt_median_ms": report.RTTMedianMs,
+		"rtt_mad_ms":    report.RTTMADMs,
+		"probes":        report.Probes,
+		"duration_sec":  time.Since(started).Seconds(),
+	}
+	if report.Port != 0 {
+		data["port"] = report.Port
+	}
+	if report.FallbackReason != "" {
+		data["fallback_reason"] = report.FallbackReason
+	}
+	if profile != nil {
+		data["profile"] = profile.Name
+	}
+	data["lock"] = lock
+
+	recordResult(TEST_TYPE_PING, req, started, data)
+	notifyCallback(req.CallbackURL, data)
+
+	return data, http.StatusOK, nil
+}
+
+// pingTest resolves the target and pings it over ICMP, or UDP when asked to or
+// when ICMP sockets cannot be opened and no protocol was given, or sends echo
+// probes to a UDP echo responder
+func pingTest(req RunRequest) (*PingReport, error) {
+	port := req.ServerPort
+	if port == 0 && req.Protocol == PING_PROTOCOL_ECHO {
+		port = DEFAULT_ECHO_PORT
+	} else if port == 0 {
+		port = DEFAULT_UDP_PING_PORT
+	}
+	dst, err := resolveUDP(req.ServerHost, port, req.AddressFamily)
+	if err != nil {
+		return nil, err
+	}
+	report := &PingReport{
+		Family:      nettest.IPFamily(dst.IP),
+		Address:     dst.IP.String(),
+		PacketSize:  req.PacketSize,
+		TTL:         req.TTL,
+		IntervalSec: req.Interval,
+	}
+
+	var prober pingProber
+	var echo *echoProber
+	if req.Protocol == PING_PROTOCOL_ECHO {
+		if echo, err = newEchoProber(dst, req.TTL, req.PacketSize); err != nil {
+			return nil, err
+		}
+		prober = echo
+		report.Protocol, report.Socket, report.Port = PING_PROTOCOL_ECHO, PING_SOCKET_UDP, port
+	} else if req.Protocol != PING_PROTOCOL_UDP {
+		icmp, err := openICMPProber(dst.IP, req.TTL, req.PacketSize)
+		switch {
+		case err == nil:
+			prober = icmp
+			report.Protocol, report.Socket = PING_PROTOCOL_ICMP, icmp.socket()
+		case req.Protocol == PING_PROTOCOL_ICMP:
+			return nil, fmt.Errorf("%v (run with CAP_NET_RAW, allow the agent's group in net.ipv4.ping_group_range, or use protocol udp)", err)
+		default:
+			logf(req.ctx, "Ping test: no ICMP socket, falling back to UDP: %v", err)
+			report.FallbackReason = err.Error()
+		}
+	}
+	if prober == nil {
+		prober = newUDPProber(dst, req.TTL, req.PacketSize)
+		report.Protocol, report.Socket, report.Port = PING_PROTOCOL_UDP, PING_SOCKET_UDP, port
+	}
+
+	probes, duplicates, err := runPingProbes(prober, req.Count, time.Duration(req.Interval*float64(time.Second)), req.progress)
+	prober.close()
+	if err != nil {
+		return nil, err
+	}
+	report.Probes = probes
+	report.Duplicates = duplicates
+	report.summarize()
+	if echo != nil && report.Received == 0 && echo.refused.Load() > 0 {
+		return nil, fmt.Errorf("port %d unreachable: no UDP echo responder at %s", port, report.Address)
+	}
+	return report, nil
+}
@@ -0,0 +1,53 @@
+//go:build linux
+
+package api
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// listenICMPDatagram opens an unprivileged ICMP echo socket, which Linux permits to
+// groups within net.ipv4.ping_group_range. The kernel assigns the echo ID and only
+// delivers replies to it; errors from routers on the way are not delivered.
+func listenICMPDatagram(v6 bool) (net.PacketConn, error) {
+	domain, proto := unix.AF_INET, unix.IPPROTO_ICMP
+	var sa unix.Sockaddr = &unix.SockaddrInet4{}
+	if v6 {
+		domain, proto = unix.AF_INET6, unix.IPPROTO_ICMPV6
+		sa = &unix.SockaddrInet6{}
+	}
+	fd, err := unix.Socket(domain, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC, proto)
+	if err != nil {
+		return nil, os.NewSyscallError("socket", err)
+	}
+	if err := unix.Bind(fd, sa); err != nil {
+		unix.Close(fd)
+		return nil, os.NewSyscallError("bind", err)
+	}
+	f := os.NewFile(uintptr(fd), "icmp")
+	defer f.Close() // FilePacketConn duplicates the descriptor
+	return net.FilePacketConn(f)
+}
+
+// setIPv6HopLimit sets the hop limit of unicast packets sent on an IPv6 socket
+func setIPv6HopLimit(conn syscall.Conn, hops int) error {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var serr error
+	if err := raw.Control(func(fd uintptr) {
+		serr = unix.SetsockoptInt(int(fd), unix.IPPROTO_IPV6, unix.IPV6_UNICAST_HOPS, hops)
+	}); err != nil {
+		return err
+	}
+	if serr != nil {
+		return fmt.Errorf("IPV6_UNICAST_HOPS: %v", serr)
+	}
+	return nil
+}
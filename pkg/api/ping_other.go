@@ -0,0 +1,20 @@
+//go:build !linux
+
+package api
+
+import (
+	"errors"
+	"net"
+	"syscall"
+)
+
+// Unprivileged ICMP sockets and the IPv6 hop limit are only used on Linux; elsewhere
+// ping needs a raw socket or falls back to UDP, and IPv6 probes keep the default hop limit.
+
+func listenICMPDatagram(v6 bool) (net.PacketConn, error) {
+	return nil, errors.New("unprivileged ICMP sockets are only supported on Linux")
+}
+
+func setIPv6HopLimit(conn syscall.Conn, hops int) error {
+	return errors.New("setting the IPv6 hop limit is only supported on Linux")
+}
@@ -0,0 +1,124 @@
+package api
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+)
+
+// echo builds an ICMP echo message of the given type
+func echo(typ byte, id, seq int) []byte {
+	b := make([]byte, 8)
+	b[0] = typ
+	binary.BigEndian.PutUint16(b[4:6], uint16(id))
+	binary.BigEndian.PutUint16(b[6:8], uint16(seq))
+	return b
+}
+
+func TestPingSummarize(t *testing.T) {
+	r := &PingReport{Probes: []PingProbe{
+		{Seq: 0, Status: "reply", RTTMs: 10},
+		{Seq: 1, Status: "timeout"},
+		{Seq: 2, Status: "reply", RTTMs: 20},
+		{Seq: 3, Status: "ttl_exceeded"},
+		{Seq: 4, Status: "port_unreachable", RTTMs: 30},
+	}}
+	r.summarize()
+	if r.Transmitted != 5 || r.Received != 3 || r.Errors != 1 {
+		t.Errorf("Expected 5 transmitted, 3 received and 1 error, got %d, %d and %d", r.Transmitted, r.Received, r.Errors)
+	}
+	if r.LossPercent != 40 {
+		t.Errorf("Expected 40%% loss, got %v", r.LossPercent)
+	}
+	if r.RTTMinMs != 10 || r.RTTAvgMs != 20 || r.RTTMaxMs != 30 {
+		t.Errorf("Expected min/avg/max 10/20/30, got %v/%v/%v", r.RTTMinMs, r.RTTAvgMs, r.RTTMaxMs)
+	}
+	if want := math.Sqrt(200.0 / 3); math.Abs(r.RTTStddevMs-want) > 1e-9 {
+		t.Errorf("Expected stddev %v, got %v", want, r.RTTStddevMs)
+	}
+	if r.RTTMedianMs != 20 || r.RTTMADMs != 10 {
+		t.Errorf("Expected median 20 and MAD 10, got %v and %v", r.RTTMedianMs, r.RTTMADMs)
+	}
+}
+
+func TestPingSummarizeAllLost(t *testing.T) {
+	r := &PingReport{Probes: []PingProbe{{Seq: 0, Status: "timeout"}, {Seq: 1, Status: "timeout"}}}
+	r.summarize()
+	if r.LossPercent != 100 || r.Received != 0 || r.RTTAvgMs != 0 || r.RTTStddevMs != 0 {
+		t.Errorf("Expected 100%% loss and no RTT, got %v%% loss, avg %v, stddev %v", r.LossPercent, r.RTTAvgMs, r.RTTStddevMs)
+	}
+}
+
+func TestInternetChecksum(t *testing.T) {
+	// RFC 1071 section 3 example
+	b := []byte{0x00, 0x01, 0xf2, 0x03, 0xf4, 0xf5, 0xf6, 0xf7}
+	if got := internetChecksum(b); got != ^uint16(0xddf2) {
+		t.Errorf("Expected 0x%04x, got 0x%04x", ^uint16(0xddf2), got)
+	}
+
+	// A message with its checksum filled in sums to zero
+	msg := echo(8, 0x1234, 7)
+	msg = append(msg, 'a', 'b', 'c')
+	binary.BigEndian.PutUint16(msg[2:4], internetChecksum(msg))
+	if got := internetChecksum(msg); got != 0 {
+		t.Errorf("Expected a verifying checksum of 0, got 0x%04x", got)
+	}
+}
+
+func TestParseICMPAnswerEchoReply(t *testing.T) {
+	seq, status, ok := parseICMPAnswer(echo(0, 0x1234, 7), false, 0x1234, true)
+	if !ok || seq != 7 || status != "reply" {
+		t.Errorf("Expected reply to seq 7, got %v %d %q", ok, seq, status)
+	}
+	if _, _, ok := parseICMPAnswer(echo(0, 0x4321, 7), false, 0x1234, true); ok {
+		t.Errorf("Expected a reply for another ID to be ignored")
+	}
+	if _, _, ok := parseICMPAnswer(echo(0, 0x4321, 7), false, 0x1234, false); !ok {
+		t.Errorf("Expected any ID to match without the ID check")
+	}
+	if _, _, ok := parseICMPAnswer(echo(8, 0x1234, 7), false, 0x1234, true); ok {
+		t.Errorf("Expected our own echo request to be ignored")
+	}
+
+	// With the IPv4 header a raw socket may deliver
+	header := make([]byte, 20)
+	header[0] = 0x45
+	if seq, _, ok := parseICMPAnswer(append(header, echo(0, 0x1234, 9)...), false, 0x1234, true); !ok || seq != 9 {
+		t.Errorf("Expected reply to seq 9 behind an IPv4 header, got %v %d", ok, seq)
+	}
+
+	if seq, status, ok := parseICMPAnswer(echo(129, 0x1234, 3), true, 0x1234, true); !ok || seq != 3 || status != "reply" {
+		t.Errorf("Expected ICMPv6 reply to seq 3, got %v %d %q", ok, seq, status)
+	}
+}
+
+func TestParseICMPAnswerErrors(t *testing.T) {
+	inner := make([]byte, 20)
+	inner[0], inner[9] = 0x45, 1
+	msg := append(make([]byte, 8), inner...)
+	msg = append(msg, echo(8, 0x1234, 5)...)
+	msg[0] = 11
+	seq, status, ok := parseICMPAnswer(msg, false, 0x1234, true)
+	if !ok || seq != 5 || status != "ttl_exceeded" {
+		t.Errorf("Expected ttl_exceeded for seq 5, got %v %d %q", ok, seq, status)
+	}
+	msg[0] = 3
+	if _, status, _ := parseICMPAnswer(msg, false, 0x1234, true); status != "unreachable" {
+		t.Errorf("Expected unreachable, got %q", status)
+	}
+
+	v6 := append(make([]byte, 8+40), echo(128, 0x1234, 6)...)
+	v6[0], v6[8+6] = 3, 58
+	if seq, status, ok := parseICMPAnswer(v6, true, 0x1234, true); !ok || seq != 6 || status != "ttl_exceeded" {
+		t.Errorf("Expected ICMPv6 time exceeded for seq 6, got %v %d %q", ok, seq, status)
+	}
+
+	// Errors quoting something other than an echo request, or truncated, are ignored
+	if _, _, ok := parseICMPAnswer(msg[:30], false, 0x1234, true); ok {
+		t.Errorf("Expected a truncated error to be ignored")
+	}
+	msg[28] = 0
+	if _, _, ok := parseICMPAnswer(msg, false, 0x1234, true); ok {
+		t.Errorf("Expected an error quoting an echo reply to be ignored")
+	}
+}
@@ -0,0 +1,709 @@
+package api
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	mathrand "math/rand"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/tcaine/twamp"
+	"golang.org/x/net/ipv4"
+
+	"network-test-api/pkg/nettest"
+)
+
+// Path MTU discovery tests: DF-set probes at the sizes tunnels and access links
+// commonly cut the MTU to, finding the largest packet that gets through
+const (
+	PMTU_PROTOCOL_UDP  = "udp"  // TWAMP test packets reflected by the server
+	PMTU_PROTOCOL_TCP  = "tcp"  // Full-sized segments to any TCP listener
+	PMTU_PROTOCOL_ICMP = "icmp" // Echo requests on a raw ICMP socket, answered by the host itself
+
+	DEFAULT_PMTU_UDP_PORT = 862
+	DEFAULT_PMTU_TCP_PORT = 5201
+	DEFAULT_PMTU_MAX_SIZE = 1500
+	MAX_PMTU_SIZE         = 9216 // Common jumbo frame limit
+	MIN_PMTU_SIZE_IPV4    = 576  // Every IPv4 host accepts datagrams of this size (RFC 791)
+	MIN_PMTU_SIZE_IPV6    = 1280 // Minimum link MTU of IPv6 (RFC 8200)
+
+	PMTU_UDP_PROBES   = 3 // Per size, so a single lost packet is not taken for a size limit
+	PMTU_UDP_WAIT     = time.Second
+	PMTU_TCP_SEGMENTS = 4 // Full segments written per size
+	PMTU_TCP_WAIT     = 2 * time.Second
+	PMTU_TCP_POLL     = 20 * time.Millisecond
+	PMTU_DIAL_TIMEOUT = 5 * time.Second
+	PMTU_ECHO_TTL     = 64
+	PMTU_MAX_HOPS     = 30 // TTLs tried when locating the router that reports the MTU
+
+	PMTU_RESULT_PASS        = "pass"
+	PMTU_RESULT_FRAG_NEEDED = "frag_needed" // ICMP fragmentation-needed / packet-too-big came back
+	PMTU_RESULT_NO_REPLY    = "no_reply"    // Dropped without feedback, or lost
+)
+
+// pmtuStrategicSizes are probed from the top down before bisecting
+var pmtuStrategicSizes = []int{
+	1500, // Ethernet
+	1492, // PPPoE
+	1480, // IP-in-IP, 6in4
+	1476, // GRE
+	1450, // VXLAN
+	1440, // IPsec ESP in tunnel mode
+	1420, // WireGuard
+	1400, // Common VPN client default
+	1380,
+	1360, // IPsec over NAT-T with AES-CBC
+	1280, // IPv6 minimum
+	1200, // QUIC minimum
+	576,  // IPv4 minimum
+}
+
+// PMTUProbe is the outcome of one probed packet size
+type PMTUProbe struct {
+	Size        int    `json:"size"` // IP packet size, headers included
+	Result      string `json:"result"`
+	ReportedMTU int    `json:"reported_mtu,omitempty"` // MTU learned from the ICMP feedback
+	From        string `json:"from,omitempty"`         // Router that sent the feedback, protocol icmp only
+}
+
+// PMTUBottleneck is the router where packets of the smallest frag_needed size stop
+type PMTUBottleneck struct {
+	Hop    int    `json:"hop"`           // Hop number of the router, as traceroute counts it
+	Router string `json:"router"`        // Address the fragmentation-needed / packet-too-big came from
+	MTU    int    `json:"mtu,omitempty"` // MTU of its next hop, as it reported
+	Size   int    `json:"size"`          // Packet size the path was probed with
+}
+
+// PMTUReport is the outcome of a path MTU test
+type PMTUReport struct {
+	Protocol        string      `json:"protocol"`
+	Family          string      `json:"family"`
+	Address         string      `json:"address"`             // IP address probed
+	RouteMTU        int         `json:"route_mtu,omitempty"` // Kernel's MTU for the route before probing
+	MaxSize         int         `json:"max_size"`            // Largest size probed
+	Probes          []PMTUProbe `json:"probes"`
+	LargestPassing  int         `json:"largest_passing"`
+	SmallestFailing int         `json:"smallest_failing,omitempty"`
+	ICMPFeedback    bool        `json:"icmp_feedback"` // A failing size drew fragmentation-needed / packet-too-big
+	ReportedMTU     int         `json:"reported_mtu,omitempty"`
+	Blackhole       bool        `json:"blackhole"`         // A size above largest_passing failed without any ICMP feedback
+	TCPMSS          int         `json:"tcp_mss,omitempty"` // MSS the server accepted on a plain TCP connection
+	MSSMTU          int         `json:"mss_mtu,omitempty"` // Packet size that MSS produces
+	MSSClamped      bool        `json:"mss_clamped"`       // The MSS implies a smaller packet than max_size
+	MSSExceedsPath  bool        `json:"mss_exceeds_path"`  // Full TCP segments would exceed the path and stall without ICMP
+
+	Bottleneck *PMTUBottleneck `json:"bottleneck,omitempty"` // Where fragmentation-needed came from, if it came back
+}
+
+// pmtuSizes returns the strategic sizes between min and max, plus max itself, largest first
+func pmtuSizes(max, min int) []int {
+	sizes := []int{max}
+	for _, size := range pmtuStrategicSizes {
+		if size < max && size >= min {
+			sizes = append(sizes, size)
+		}
+	}
+	return sizes
+}
+
+// pmtuSearch probes sizes in order until one passes, then bisects between it and
+// the smallest failing size above it. Probes are returned in the order sent.
+func pmtuSearch(sizes []int, probe func(size int) (PMTUProbe, error)) ([]PMTUProbe, error) {
+	var probes []PMTUProbe
+	pass, fail := 0, 0
+	for _, size := range sizes {
+		p, err := probe(size)
+		if err != nil {
+			return probes, err
+		}
+		probes = append(probes, p)
+		if p.Result == PMTU_RESULT_PASS {
+			pass = size
+			break
+		}
+		fail = size
+	}
+	if pass == 0 || fail == 0 {
+		return probes, nil
+	}
+	for fail-pass > 1 {
+		size := (pass + fail) / 2
+		p, err := probe(size)
+		if err != nil {
+			return probes, err
+		}
+		probes = append(probes, p)
+		if p.Result == PMTU_RESULT_PASS {
+			pass = size
+		} else {
+			fail = size
+		}
+	}
+	return probes, nil
+}
+
+// summarize derives the verdicts from the probes and the MSS
+func (r *PMTUReport) summarize() {
+	for _, p := range r.Probes {
+		if p.Result == PMTU_RESULT_PASS && p.Size > r.LargestPassing {
+			r.LargestPassing = p.Size
+		}
+	}
+	for _, p := range r.Probes {
+		if p.Result == PMTU_RESULT_PASS || p.Size < r.LargestPassing {
+			continue
+		}
+		if r.SmallestFailing == 0 || p.Size < r.SmallestFailing {
+			r.SmallestFailing = p.Size
+		}
+		switch p.Result {
+		case PMTU_RESULT_FRAG_NEEDED:
+			r.ICMPFeedback = true
+			if p.ReportedMTU > 0 && (r.ReportedMTU == 0 || p.ReportedMTU < r.ReportedMTU) {
+				r.ReportedMTU = p.ReportedMTU
+			}
+		case PMTU_RESULT_NO_REPLY:
+			r.Blackhole = r.LargestPassing > 0
+		}
+	}
+	if r.MSSMTU > 0 {
+		// TCP sends no larger segments than the route allows either
+		segment := r.MSSMTU
+		if r.RouteMTU > 0 && r.RouteMTU < segment {
+			segment = r.RouteMTU
+		}
+		r.MSSClamped = r.MSSMTU < r.MaxSize
+		r.MSSExceedsPath = r.SmallestFailing > 0 && segment > r.LargestPassing && !r.ICMPFeedback
+	}
+}
+
+// validatePMTU checks the protocol and size bounds of a path MTU request
+func validatePMTU(req *RunRequest) error {
+	switch req.Protocol = strings.ToLower(req.Protocol); req.Protocol {
+	case "":
+		req.Protocol = PMTU_PROTOCOL_UDP
+	case PMTU_PROTOCOL_UDP, PMTU_PROTOCOL_TCP, PMTU_PROTOCOL_ICMP:
+	default:
+		return fmt.Errorf("invalid protocol %q (expected udp, tcp or icmp)", req.Protocol)
+	}
+	switch {
+	case !nettest.PMTUSupported:
+		return fmt.Errorf("path MTU tests are only available on Linux agents")
+	case req.ServerHost == "":
+		return fmt.Errorf("server_host is required")
+	case req.MaxSize < MIN_PMTU_SIZE_IPV4 || req.MaxSize > MAX_PMTU_SIZE:
+		return fmt.Errorf("max_size must be between %d and %d bytes", MIN_PMTU_SIZE_IPV4, MAX_PMTU_SIZE)
+	case req.Protocol == PMTU_PROTOCOL_TCP && req.DSCP != 0:
+		return fmt.Errorf("dscp is only available with protocol udp")
+	case req.Protocol == PMTU_PROTOCOL_ICMP && req.ServerPort != 0:
+		return fmt.Errorf("server_port is only used with protocol udp or tcp")
+	case req.DSCP < 0 || req.DSCP > 63:
+		return fmt.Errorf("dscp must be between 0 and 63")
+	}
+	return nil
+}
+
+// runPMTU applies defaults to a decoded request, runs the path MTU test and records the result.
+// Errors come with the HTTP status to report them with.
+func runPMTU(req RunRequest, profile *Profile) (map[string]interface{}, int, error) {
+	if req.ServerPort == 0 {
+		switch strings.ToLower(req.Protocol) {
+		case PMTU_PROTOCOL_TCP:
+			req.ServerPort = DEFAULT_PMTU_TCP_PORT
+		case PMTU_PROTOCOL_ICMP:
+		default:
+			req.ServerPort = DEFAULT_PMTU_UDP_PORT
+		}
+	}
+	if req.MaxSize == 0 {
+		req.MaxSize = DEFAULT_PMTU_MAX_SIZE
+	}
+	if err := checkProfileLimits(req, profile); err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	err := validatePMTU(&req)
+	if err == nil {
+		req.AddressFamily, err = parseAddressFamily(req.AddressFamily)
+	}
+	if err == nil && req.AddressFamily == nettest.FAMILY_COMPARE {
+		err = fmt.Errorf("address_family compare is not available for path MTU tests; run ipv4 and ipv6 separately")
+	}
+	if err == nil {
+		err = validateLockWait(&req)
+	}
+	if err == nil {
+		err = validateCallbackURL(req.CallbackURL)
+	}
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	lock, release, status, err := lockTest(TEST_TYPE_PMTU, req, false)
+	if err != nil {
+		return nil, status, err
+	}
+	defer release()
+
+	logf(req.ctx, "PMTU test: %s %s:%d (max_size=%d, family=%s)",
+		req.Protocol, req.ServerHost, req.ServerPort, req.MaxSize, req.AddressFamily)
+
+	started := time.Now()
+	var controlConn net.Conn
+	var dial *nettest.DialReport
+	if req.Protocol == PMTU_PROTOCOL_ICMP {
+		controlConn, err = dialRoute(req.ServerHost, req.AddressFamily)
+	} else {
+		controlConn, dial, err = nettest.DialControl(req.ServerHost, req.ServerPort, req.AddressFamily, PMTU_DIAL_TIMEOUT)
+	}
+	if err != nil {
+		return nil, http.StatusInternalServerError, fmt.Errorf("Connect failed: %v", err)
+	}
+	report, err := pmtuTest(req, controlConn)
+	if err != nil {
+		return nil, http.StatusInternalServerError, fmt.Errorf("PMTU test failed: %v", err)
+	}
+
+	data := map[string]interface{}{
+		"server":           req.ServerHost,
+		"address":          report.Address,
+		"protocol":         report.Protocol,
+		"family":           report.Family,
+		"route_mtu":        report.RouteMTU,
+		"max_size":         report.MaxSize,
+		"probes":           report.Probes,
+		"largest_passing":  report.LargestPassing,
+		"smallest_failing": report.SmallestFailing,
+		"icmp_feedback":    report.ICMPFeedback,
+		"reported_mtu":     report.ReportedMTU,
+		"blackhole":        report.Blackhole,
+		"tcp_mss":          report.TCPMSS,
+		"mss_mtu":          report.MSSMTU,
+		"mss_clamped":      report.MSSClamped,
+		"mss_exceeds_path": report.MSSExceedsPath,
+		"duration_sec":     time.Since(started).Seconds(),
+	}
+	if dial != nil {
+		data["port"] = req.ServerPort
+		data["dial"] = dial
+	}
+	if report.Bottleneck != nil {
+		data["bottleneck"] = report.Bottleneck
+	}
+	if profile != nil {
+		data["profile"] = profile.Name
+	}
+	data["lock"] = lock
+
+	recordResult(TEST_TYPE_PMTU, req, started, data)
+	notifyCallback(req.CallbackURL, data)
+
+	return data, http.StatusOK, nil
+}
+
+// dialRoute connects a UDP socket to host without sending anything, which
+// gives the kernel's route to it
+func dialRoute(host, family string) (net.Conn, error) {
+	dst, err := resolveUDP(host, 9, family)
+	if err != nil {
+		return nil, err
+	}
+	return net.DialUDP("udp", nil, dst)
+}
+
+// pmtuTest probes the path to the server controlConn is connected to, and closes it.
+// UDP mode opens a TWAMP session per size on a fresh control connection, since the
+// padding is fixed when the session is requested. TCP mode keeps controlConn as
+// the baseline connection whose MSS shows what the server and the path accept.
+// ICMP mode only reads the route MTU from controlConn, a connected UDP socket.
+func pmtuTest(req RunRequest, controlConn net.Conn) (*PMTUReport, error) {
+	address := controlConn.RemoteAddr().String()
+	host, _, _ := net.SplitHostPort(address)
+	ip := net.ParseIP(host)
+	ipHeader := nettest.IPHeaderSize(controlConn.RemoteAddr())
+	report := &PMTUReport{Protocol: req.Protocol, Family: nettest.FAMILY_IPV4, Address: ip.String(), MaxSize: req.MaxSize}
+	min := MIN_PMTU_SIZE_IPV4
+	if ipHeader == nettest.IPV6_HEADER_SIZE {
+		report.Family, min = nettest.FAMILY_IPV6, MIN_PMTU_SIZE_IPV6
+	}
+	if report.MaxSize < min {
+		_ = controlConn.Close()
+		return nil, fmt.Errorf("max_size must be at least %d bytes over %s", min, report.Family)
+	}
+	report.TCPMSS = nettest.TCPMSS(controlConn)
+	if report.TCPMSS > 0 {
+		report.MSSMTU = nettest.InferEffectiveMTU(0, report.TCPMSS, ipHeader)
+	}
+	report.RouteMTU = nettest.SocketPathMTU(controlConn)
+
+	// Sizes the local interface cannot send say nothing about the path
+	max := report.MaxSize
+	if report.RouteMTU > 0 && report.RouteMTU < max {
+		max = report.RouteMTU
+	}
+
+	var echo *pmtuEcho
+	var probe func(size int) (PMTUProbe, error)
+	switch req.Protocol {
+	case PMTU_PROTOCOL_TCP:
+		// Segments cannot be larger than the server's MSS allows
+		_ = controlConn.Close()
+		if report.MSSMTU > 0 && report.MSSMTU < max {
+			max = report.MSSMTU
+		}
+		probe = func(size int) (PMTUProbe, error) {
+			return pmtuProbeTCP(address, size, ipHeader)
+		}
+	case PMTU_PROTOCOL_ICMP:
+		_ = controlConn.Close()
+		var err error
+		if echo, err = openPMTUEcho(ip); err != nil {
+			return nil, fmt.Errorf("%v (protocol icmp needs root or CAP_NET_RAW)", err)
+		}
+		defer echo.close()
+		probe = func(size int) (PMTUProbe, error) {
+			a, err := echo.probe(size, PMTU_ECHO_TTL)
+			p := PMTUProbe{Size: size, Result: a.result, ReportedMTU: a.mtu}
+			if a.result == PMTU_RESULT_FRAG_NEEDED {
+				p.From = a.from
+			}
+			return p, err
+		}
+	default:
+		probe = func(size int) (PMTUProbe, error) {
+			conn := controlConn
+			controlConn = nil
+			if conn == nil {
+				var err error
+				if conn, err = net.DialTimeout("tcp", address, PMTU_DIAL_TIMEOUT); err != nil {
+					return PMTUProbe{}, fmt.Errorf("connect for size %d: %v", size, err)
+				}
+			}
+			return pmtuProbeUDP(conn, size, ipHeader, req.DSCP)
+		}
+	}
+	if max < min {
+		return nil, fmt.Errorf("route MTU %d is below the %s minimum of %d", max, report.Family, min)
+	}
+
+	probes, err := pmtuSearch(pmtuSizes(max, min), probe)
+	if controlConn != nil {
+		_ = controlConn.Close()
+	}
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(probes, func(i, j int) bool { return probes[i].Size > probes[j].Size })
+	report.Probes = probes
+	report.summarize()
+	if report.LargestPassing == 0 {
+		return nil, fmt.Errorf("no probe got through, down to %d bytes", min)
+	}
+	if report.ICMPFeedback {
+		if echo == nil {
+			if echo, err = openPMTUEcho(ip); err != nil {
+				// The probes themselves went through; only the router stays unknown
+				logf(req.ctx, "PMTU test: not locating the bottleneck: %v", err)
+				return report, nil
+			}
+			defer echo.close()
+		}
+		if report.Bottleneck, err = pmtuLocate(echo.probe, report.smallestFragNeeded()); err != nil {
+			warnf(req.ctx, "PMTU test: locating the bottleneck failed: %v", err)
+		}
+	}
+	return report, nil
+}
+
+// smallestFragNeeded returns the smallest probed size that drew fragmentation-needed
+func (r *PMTUReport) smallestFragNeeded() int {
+	size := 0
+	for _, p := range r.Probes {
+		if p.Result == PMTU_RESULT_FRAG_NEEDED && (size == 0 || p.Size < size) {
+			size = p.Size
+		}
+	}
+	return size
+}
+
+// pmtuLocate finds the router that reports an MTU below size, by sending DF-set
+// echo requests of that size with increasing TTLs until fragmentation-needed
+// comes back instead of time exceeded. It returns nil when no router claims the
+// size, as when the echo reply comes back or the hops stay silent.
+func pmtuLocate(probe func(size, ttl int) (pmtuAnswer, error), size int) (*PMTUBottleneck, error) {
+	prev := ""
+	for ttl := 1; ttl <= PMTU_MAX_HOPS; ttl++ {
+		a, err := probe(size, ttl)
+		if err != nil {
+			return nil, err
+		}
+		switch a.result {
+		case PMTU_RESULT_FRAG_NEEDED:
+			b := &PMTUBottleneck{Hop: ttl, Router: a.from, MTU: a.mtu, Size: size}
+			if a.from != "" && a.from == prev {
+				// Most routers expire the TTL before looking at the size, so the
+				// router that just reported time exceeded is the one
+				b.Hop = ttl - 1
+			}
+			return b, nil
+		case PMTU_RESULT_PASS:
+			return nil, nil
+		}
+		prev = a.from
+	}
+	return nil, nil
+}
+
+// pmtuAnswer is what came back for the echo requests of one probe
+type pmtuAnswer struct {
+	seq    int
+	result string // A probe result, or PING_STATUS_TTL_EXCEEDED
+	mtu    int    // Next-hop MTU of fragmentation-needed / packet-too-big
+	from   string
+}
+
+// parsePMTUAnswer matches an ICMP message to one of our echo requests: the echo
+// reply, or time exceeded or fragmentation-needed / packet-too-big quoting the
+// request. Other errors are ignored, leaving the probe without a reply.
+func parsePMTUAnswer(b []byte, v6 bool, id int) (pmtuAnswer, bool) {
+	if !v6 && len(b) > 0 && b[0]>>4 == 4 {
+		// Raw IPv4 sockets may deliver the IP header
+		ihl := int(b[0]&0x0f) * 4
+		if len(b) < ihl {
+			return pmtuAnswer{}, false
+		}
+		b = b[ihl:]
+	}
+	if len(b) < icmpEchoHeader {
+		return pmtuAnswer{}, false
+	}
+
+	var a pmtuAnswer
+	var q icmpQuote
+	var ok bool
+	switch {
+	case v6 && b[0] == icmpv6PacketTooBig:
+		a.result, a.mtu = PMTU_RESULT_FRAG_NEEDED, int(binary.BigEndian.Uint32(b[4:8]))
+		q, ok = parseQuotedProbe(PING_STATUS_UNREACHABLE, b[icmpEchoHeader:], v6)
+	case !v6 && b[0] == icmpv4Unreachable && b[1] == icmpv4FragNeeded:
+		// Routers predating RFC 1191 leave the MTU 0
+		a.result, a.mtu = PMTU_RESULT_FRAG_NEEDED, int(binary.BigEndian.Uint16(b[6:8]))
+		q, ok = parseQuotedProbe(PING_STATUS_UNREACHABLE, b[icmpEchoHeader:], v6)
+	default:
+		if q, ok = parseICMPQuote(b, v6); !ok {
+			return pmtuAnswer{}, false
+		}
+		switch q.status {
+		case PING_STATUS_REPLY:
+			a.result = PMTU_RESULT_PASS
+		case PING_STATUS_TTL_EXCEEDED:
+			a.result = PING_STATUS_TTL_EXCEEDED
+		default:
+			return pmtuAnswer{}, false
+		}
+	}
+	if !ok {
+		return pmtuAnswer{}, false
+	}
+	a.seq, ok = echoSeq(q, v6, id, true)
+	return a, ok
+}
+
+// pmtuEcho sends DF-set echo requests on a raw ICMP socket, which unlike a
+// datagram one also receives the errors routers send back
+type pmtuEcho struct {
+	conn net.PacketConn
+	p4   *ipv4.PacketConn // IPv4 only, for the TTL
+	dst  *net.IPAddr
+	v6   bool
+	id   int
+	seq  int
+	ttl  int
+}
+
+func openPMTUEcho(ip net.IP) (*pmtuEcho, error) {
+	e := &pmtuEcho{dst: &net.IPAddr{IP: ip}, v6: ip.To4() == nil, id: mathrand.Intn(0x10000)}
+	network, local := "ip4:icmp", "0.0.0.0"
+	if e.v6 {
+		network, local = "ip6:ipv6-icmp", "::"
+	}
+	conn, err := net.ListenPacket(network, local)
+	if err != nil {
+		return nil, fmt.Errorf("raw ICMP socket: %v", err)
+	}
+	if err := nettest.SetProbeDontFragment(conn.(syscall.Conn), e.v6); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("setting DF: %v", err)
+	}
+	e.conn = conn
+	if !e.v6 {
+		e.p4 = ipv4.NewPacketConn(conn)
+	}
+	return e, nil
+}
+
+func (e *pmtuEcho) close() { e.conn.Close() }
+
+// probe sends PMTU_UDP_PROBES echo requests of size bytes, IP header included,
+// and returns the first answer to any of them
+func (e *pmtuEcho) probe(size, ttl int) (pmtuAnswer, error) {
+	a := pmtuAnswer{result: PMTU_RESULT_NO_REPLY}
+	if ttl != e.ttl {
+		var err error
+		if e.v6 {
+			err = setIPv6HopLimit(e.conn.(syscall.Conn), ttl)
+		} else {
+			err = e.p4.SetTTL(ttl)
+		}
+		if err != nil {
+			return a, fmt.Errorf("setting ttl %d: %v", ttl, err)
+		}
+		e.ttl = ttl
+	}
+	payload := size - nettest.IPHeaderSize(&net.UDPAddr{IP: e.dst.IP}) - icmpEchoHeader
+	first := e.seq
+	for i := 0; i < PMTU_UDP_PROBES; i++ {
+		e.seq++
+		if _, err := e.conn.WriteTo(icmpEcho(e.v6, e.id, e.seq, payload), e.dst); err != nil {
+			if nettest.IsMessageTooBig(err) {
+				// Larger than the interface allows
+				a.result = PMTU_RESULT_FRAG_NEEDED
+				return a, nil
+			}
+			return a, fmt.Errorf("sending %d byte echo request: %v", size, err)
+		}
+	}
+
+	_ = e.conn.SetReadDeadline(time.Now().Add(PMTU_UDP_WAIT))
+	buf := make([]byte, size+1024)
+	for {
+		n, from, err := e.conn.ReadFrom(buf)
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				return a, nil
+			}
+			return a, fmt.Errorf("reading ICMP: %v", err)
+		}
+		answer, ok := parsePMTUAnswer(buf[:n], e.v6, e.id)
+		// Sequence numbers are 16 bits on the wire
+		if !ok || uint16(answer.seq-first-1) >= PMTU_UDP_PROBES {
+			continue // Another prober's, or an earlier probe's
+		}
+		answer.from = addrIP(from)
+		return answer, nil
+	}
+}
+
+// pmtuProbeUDP sends DF-set TWAMP test packets of size bytes over a session on
+// controlConn, which it closes. A reply means the size passed both ways, since
+// the reflector answers with a packet of about the same size.
+func pmtuProbeUDP(controlConn net.Conn, size, ipHeader, dscp int) (PMTUProbe, error) {
+	p := PMTUProbe{Size: size, Result: PMTU_RESULT_NO_REPLY}
+	conn, err := twamp.NewClient().ConnectConn(controlConn)
+	if err != nil {
+		_ = controlConn.Close()
+		return p, fmt.Errorf("TWAMP connect for size %d: %v", size, err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	session, err := conn.CreateSession(twamp.TwampSessionConfig{
+		ReceiverPort: nettest.TWAMP_RECEIVER_PORT,
+		SenderPort:   nettest.TWAMP_SENDER_PORT_MIN + mathrand.Intn(nettest.TWAMP_SENDER_PORT_MAX-nettest.TWAMP_SENDER_PORT_MIN),
+		Timeout:      5,
+		Padding:      size - ipHeader - nettest.UDP_WIRE_HEADER - TWAMP_BASE_PACKET_SIZE,
+		TOS:          dscp << 2,
+	})
+	if err != nil {
+		return p, fmt.Errorf("session for size %d: %v", size, err)
+	}
+	defer func() { _ = session.Stop() }()
+	test, err := session.CreateTest()
+	if err != nil {
+		return p, fmt.Errorf("test for size %d: %v", size, err)
+	}
+	udp := test.GetConnection()
+	if err := nettest.SetDontFragment(udp); err != nil {
+		return p, fmt.Errorf("setting DF: %v", err)
+	}
+
+	fragNeeded := func() PMTUProbe {
+		p.Result = PMTU_RESULT_FRAG_NEEDED
+		p.ReportedMTU = nettest.SocketPathMTU(udp)
+		return p
+	}
+	for i := 0; i < PMTU_UDP_PROBES; i++ {
+		if _, err := test.SendProbe(); err != nil {
+			if nettest.IsMessageTooBig(err) {
+				return fragNeeded(), nil
+			}
+			return p, fmt.Errorf("sending %d byte probe: %v", size, err)
+		}
+	}
+
+	_ = udp.SetReadDeadline(time.Now().Add(PMTU_UDP_WAIT))
+	buf := make([]byte, size)
+	for {
+		n, err := udp.Read(buf)
+		if err != nil {
+			var netErr net.Error
+			switch {
+			case nettest.IsMessageTooBig(err):
+				// The kernel reports ICMP feedback on the connected socket
+				return fragNeeded(), nil
+			case errors.As(err, &netErr) && netErr.Timeout():
+				return p, nil
+			}
+			continue
+		}
+		if _, err := twamp.ParseSenderSequence(buf[:n]); err == nil {
+			p.Result = PMTU_RESULT_PASS
+			return p, nil
+		}
+	}
+}
+
+// pmtuProbeTCP connects with the MSS of a size byte packet and writes a few full
+// segments. The size passes once they are acknowledged; a path MTU the kernel
+// lowered on ICMP feedback means it did not fit.
+func pmtuProbeTCP(address string, size, ipHeader int) (PMTUProbe, error) {
+	p := PMTUProbe{Size: size, Result: PMTU_RESULT_NO_REPLY}
+	conn, err := nettest.DialTCPProbe(address, size-ipHeader-nettest.TCP_WIRE_HEADER, PMTU_DIAL_TIMEOUT)
+	if err != nil {
+		return p, fmt.Errorf("connect for size %d: %v", size, err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	segment := nettest.TCPMSS(conn)
+	if segment <= 0 {
+		return p, fmt.Errorf("reading MSS for size %d", size)
+	}
+	payload := make([]byte, PMTU_TCP_SEGMENTS*segment)
+	_ = conn.SetWriteDeadline(time.Now().Add(PMTU_TCP_WAIT))
+	if _, err := conn.Write(payload); err != nil {
+		return p, fmt.Errorf("writing %d byte segments: %v", size, err)
+	}
+
+	deadline := time.Now().Add(PMTU_TCP_WAIT)
+	for {
+		acked, pmtu, err := nettest.TCPProbeState(conn, len(payload))
+		switch {
+		case err != nil:
+			return p, fmt.Errorf("reading TCP state for size %d: %v", size, err)
+		case pmtu > 0 && pmtu < size:
+			p.Result = PMTU_RESULT_FRAG_NEEDED
+			p.ReportedMTU = pmtu
+			return p, nil
+		case acked:
+			p.Result = PMTU_RESULT_PASS
+			return p, nil
+		case time.Now().After(deadline):
+			return p, nil
+		}
+		time.Sleep(PMTU_TCP_POLL)
+	}
+}
@@ -0,0 +1,180 @@
+package api
+
+import (
+	"encoding/binary"
+	"net"
+	"reflect"
+	"testing"
+)
+
+// routedPath answers TTL-limited echo requests like a path through routers,
+// where the router at hop bottleneck (1-based) cannot forward them. With
+// ttlFirst it expires the TTL before checking the size, as most routers do.
+func routedPath(routers []string, bottleneck int, ttlFirst bool) func(size, ttl int) (pmtuAnswer, error) {
+	return func(_, ttl int) (pmtuAnswer, error) {
+		for hop := 1; hop <= len(routers); hop++ {
+			if hop == bottleneck && !(ttlFirst && ttl == hop) {
+				return pmtuAnswer{result: PMTU_RESULT_FRAG_NEEDED, mtu: 1400, from: routers[hop-1]}, nil
+			}
+			if ttl == hop {
+				return pmtuAnswer{result: "ttl_exceeded", from: routers[hop-1]}, nil
+			}
+		}
+		return pmtuAnswer{result: PMTU_RESULT_PASS, from: "target"}, nil
+	}
+}
+
+// pathProbe answers like a path with the given MTU, with or without ICMP feedback
+func pathProbe(mtu int, icmp bool, sent *[]int) func(int) (PMTUProbe, error) {
+	return func(size int) (PMTUProbe, error) {
+		*sent = append(*sent, size)
+		switch {
+		case size <= mtu:
+			return PMTUProbe{Size: size, Result: PMTU_RESULT_PASS}, nil
+		case icmp:
+			return PMTUProbe{Size: size, Result: PMTU_RESULT_FRAG_NEEDED, ReportedMTU: mtu}, nil
+		}
+		return PMTUProbe{Size: size, Result: PMTU_RESULT_NO_REPLY}, nil
+	}
+}
+
+func TestPMTUSizes(t *testing.T) {
+	if sizes := pmtuSizes(1500, 576); !reflect.DeepEqual(sizes, pmtuStrategicSizes) {
+		t.Errorf("Expected the strategic sizes for 1500, got %v", sizes)
+	}
+
+	sizes := pmtuSizes(9000, 1280)
+	expected := []int{9000, 1500, 1492, 1480, 1476, 1450, 1440, 1420, 1400, 1380, 1360, 1280}
+	if !reflect.DeepEqual(sizes, expected) {
+		t.Errorf("Expected %v, got %v", expected, sizes)
+	}
+
+	sizes = pmtuSizes(1410, 576)
+	if sizes[0] != 1410 || sizes[1] != 1400 {
+		t.Errorf("Expected max_size first and larger strategic sizes dropped, got %v", sizes)
+	}
+}
+
+func TestPMTUSearchFullPath(t *testing.T) {
+	var sent []int
+	probes, _ := pmtuSearch(pmtuSizes(1500, 576), pathProbe(1500, false, &sent))
+	if len(probes) != 1 || len(sent) != 1 {
+		t.Errorf("Expected a single probe on a 1500 byte path, got %v", sent)
+	}
+}
+
+func TestPMTUSearchBisects(t *testing.T) {
+	var sent []int
+	probes, _ := pmtuSearch(pmtuSizes(1500, 576), pathProbe(1412, false, &sent))
+	r := &PMTUReport{MaxSize: 1500, RouteMTU: 1500, Probes: probes, MSSMTU: 1500}
+	r.summarize()
+
+	if r.LargestPassing != 1412 || r.SmallestFailing != 1413 {
+		t.Errorf("Expected 1412 passing and 1413 failing, got %d and %d", r.LargestPassing, r.SmallestFailing)
+	}
+	if !r.Blackhole || r.ICMPFeedback {
+		t.Errorf("Expected a blackhole without ICMP feedback, got blackhole=%v icmp=%v", r.Blackhole, r.ICMPFeedback)
+	}
+	// Full-sized TCP segments would vanish on this path
+	if !r.MSSExceedsPath || r.MSSClamped {
+		t.Errorf("Expected mss_exceeds_path without clamping, got exceeds=%v clamped=%v", r.MSSExceedsPath, r.MSSClamped)
+	}
+	if len(sent) > 12 {
+		t.Errorf("Expected the bisection to take few probes, got %d: %v", len(sent), sent)
+	}
+}
+
+func TestPMTUSummarizeICMP(t *testing.T) {
+	var sent []int
+	probes, _ := pmtuSearch(pmtuSizes(1500, 576), pathProbe(1420, true, &sent))
+	r := &PMTUReport{MaxSize: 1500, Probes: probes, MSSMTU: 1420}
+	r.summarize()
+
+	if r.LargestPassing != 1420 || !r.ICMPFeedback || r.ReportedMTU != 1420 {
+		t.Errorf("Expected 1420 passing with ICMP feedback reporting 1420, got %d, %v, %d", r.LargestPassing, r.ICMPFeedback, r.ReportedMTU)
+	}
+	if r.Blackhole || r.MSSExceedsPath {
+		t.Error("Expected no blackhole when the path sends ICMP")
+	}
+	if !r.MSSClamped {
+		t.Error("Expected mss_clamped for an MSS below max_size")
+	}
+}
+
+func TestPMTUSummarizeNothingFails(t *testing.T) {
+	r := &PMTUReport{MaxSize: 1500, RouteMTU: 65535, MSSMTU: 32793,
+		Probes: []PMTUProbe{{Size: 1500, Result: PMTU_RESULT_PASS}}}
+	r.summarize()
+	// Larger segments than max_size were never probed, so they are not known to fail
+	if r.MSSExceedsPath || r.Blackhole || r.SmallestFailing != 0 {
+		t.Errorf("Expected no verdicts when max_size passes, got exceeds=%v blackhole=%v failing=%d", r.MSSExceedsPath, r.Blackhole, r.SmallestFailing)
+	}
+}
+
+func TestParsePMTUAnswer(t *testing.T) {
+	// Fragmentation needed from a router, quoting echo request 7 of ID 0x1234
+	quoted := make([]byte, 28)
+	quoted[0], quoted[9] = 0x45, 1
+	copy(quoted[16:20], net.IPv4(198, 51, 100, 7).To4())
+	copy(quoted[20:], echo(8, 0x1234, 7))
+	msg := append([]byte{3, 4, 0, 0, 0, 0, 0x05, 0x78}, quoted...)
+
+	a, ok := parsePMTUAnswer(msg, false, 0x1234)
+	if !ok || a.result != PMTU_RESULT_FRAG_NEEDED || a.mtu != 1400 || a.seq != 7 {
+		t.Errorf("Expected frag_needed for seq 7 with MTU 1400, got %v %+v", ok, a)
+	}
+	if _, ok := parsePMTUAnswer(msg, false, 0x4321); ok {
+		t.Error("Expected an error quoting another ID to be ignored")
+	}
+	// Host unreachable is no answer to the size
+	msg[1] = 1
+	if _, ok := parsePMTUAnswer(msg, false, 0x1234); ok {
+		t.Error("Expected host unreachable to be ignored")
+	}
+
+	// With the IP header a raw IPv4 socket may deliver
+	msg[1] = 4
+	withHeader := append(make([]byte, 20), msg...)
+	withHeader[0] = 0x45
+	if a, ok := parsePMTUAnswer(withHeader, false, 0x1234); !ok || a.mtu != 1400 {
+		t.Errorf("Expected the IP header skipped, got %v %+v", ok, a)
+	}
+
+	if a, ok := parsePMTUAnswer(echo(0, 0x1234, 9), false, 0x1234); !ok || a.result != PMTU_RESULT_PASS || a.seq != 9 {
+		t.Errorf("Expected an echo reply to pass seq 9, got %v %+v", ok, a)
+	}
+
+	// ICMPv6 packet too big carries a 32-bit MTU
+	v6 := make([]byte, 8+48)
+	v6[0] = 2
+	binary.BigEndian.PutUint32(v6[4:8], 1280)
+	v6[8+6] = 58
+	copy(v6[8+24:8+40], net.ParseIP("2001:db8::7"))
+	copy(v6[48:], echo(128, 0x1234, 3))
+	if a, ok := parsePMTUAnswer(v6, true, 0x1234); !ok || a.result != PMTU_RESULT_FRAG_NEEDED || a.mtu != 1280 || a.seq != 3 {
+		t.Errorf("Expected packet too big for seq 3 with MTU 1280, got %v %+v", ok, a)
+	}
+}
+
+func TestPMTULocate(t *testing.T) {
+	routers := []string{"192.0.2.1", "198.51.100.1", "203.0.113.1", "203.0.113.9"}
+	for _, ttlFirst := range []bool{true, false} {
+		b, err := pmtuLocate(routedPath(routers, 3, ttlFirst), 1401)
+		if err != nil || b == nil {
+			t.Fatalf("Expected a bottleneck, got %+v, %v", b, err)
+		}
+		if b.Hop != 3 || b.Router != "203.0.113.1" || b.MTU != 1400 || b.Size != 1401 {
+			t.Errorf("Expected hop 3 at 203.0.113.1 reporting 1400 (ttl first: %v), got %+v", ttlFirst, b)
+		}
+	}
+
+	b, err := pmtuLocate(routedPath(routers, 1, true), 1401)
+	if err != nil || b == nil || b.Hop != 1 || b.Router != "192.0.2.1" {
+		t.Errorf("Expected the first hop, got %+v, %v", b, err)
+	}
+
+	// The echo reply comes back: no router on the way claims the size
+	if b, err := pmtuLocate(routedPath(routers, 0, true), 1401); b != nil || err != nil {
+		t.Errorf("Expected no bottleneck when the target answers, got %+v, %v", b, err)
+	}
+}
@@ -0,0 +1,103 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"time"
+
+	"network-test-api/pkg/nettest"
+)
+
+// Pre-flight reachability check before an iperf3 test
+const (
+	PREFLIGHT_PROBES   = 3
+	PREFLIGHT_TIMEOUT  = 2 * time.Second // Per probe, instead of the test's 10 s control dial
+	PREFLIGHT_INTERVAL = 100 * time.Millisecond
+
+	ERR_UNREACHABLE = "ERR_UNREACHABLE"
+)
+
+// codedError is a test error reported with a machine-readable ApiResponse.Code
+type codedError struct {
+	code string
+	err  error
+}
+
+func (e *codedError) Error() string { return e.err.Error() }
+func (e *codedError) Unwrap() error { return e.err }
+
+// errorCode returns the code of a codedError, or of a nettest.Error, anywhere in err's chain
+func errorCode(err error) string {
+	var ce *codedError
+	if errors.As(err, &ce) {
+		return ce.code
+	}
+	var ne *nettest.Error
+	if errors.As(err, &ne) {
+		return ne.Code
+	}
+	return ""
+}
+
+// PreflightResult is the idle baseline measured before the test, returned as data.preflight
+type PreflightResult struct {
+	Method   string  `json:"method"` // tcp_connect: handshake time to the control port
+	Address  string  `json:"address"`
+	Family   string  `json:"family"`
+	Probes   int     `json:"probes"`
+	Replies  int     `json:"replies"`
+	RttMinMs float64 `json:"rtt_min_ms"`
+	RttAvgMs float64 `json:"rtt_avg_ms"`
+	RttMaxMs float64 `json:"rtt_max_ms"`
+}
+
+// preflightCheck times TCP connects to the control port. The first probe goes
+// through the requested address family selection; the rest reuse its address.
+// An unreachable target fails with ERR_UNREACHABLE after a single probe timeout.
+func preflightCheck(host string, port int, family string, bind *nettest.SourceBinding) (*PreflightResult, error) {
+	conn, dial, err := nettest.DialControlFrom(context.Background(), host, port, family, PREFLIGHT_TIMEOUT, bind)
+	if err != nil {
+		return nil, &codedError{ERR_UNREACHABLE, fmt.Errorf("target unreachable: %s: %v", net.JoinHostPort(host, fmt.Sprintf("%d", port)), err)}
+	}
+	_ = conn.Close()
+
+	rtts := []float64{dial.ConnectMs}
+	for i := 1; i < PREFLIGHT_PROBES; i++ {
+		time.Sleep(PREFLIGHT_INTERVAL)
+		var rtt time.Duration
+		err := bind.InNamespace(func() error {
+			start := time.Now()
+			conn, err := bind.Dialer("tcp", PREFLIGHT_TIMEOUT).DialContext(nettest.WithDialedName(context.Background(), host), "tcp", dial.Address)
+			if err != nil {
+				return err
+			}
+			rtt = time.Since(start)
+			_ = conn.Close()
+			return nil
+		})
+		if err != nil {
+			continue
+		}
+		rtts = append(rtts, float64(rtt.Microseconds())/1000)
+	}
+
+	result := &PreflightResult{
+		Method:   "tcp_connect",
+		Address:  dial.Address,
+		Family:   dial.Family,
+		Probes:   PREFLIGHT_PROBES,
+		Replies:  len(rtts),
+		RttMinMs: math.Inf(1),
+	}
+	var sum float64
+	for _, rtt := range rtts {
+		sum += rtt
+		result.RttMinMs = math.Min(result.RttMinMs, rtt)
+		result.RttMaxMs = math.Max(result.RttMaxMs, rtt)
+	}
+	result.RttAvgMs = sum / float64(len(rtts))
+	return result, nil
+}
@@ -0,0 +1,57 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+)
+
+func TestErrorCodeThroughWrapping(t *testing.T) {
+	err := &codedError{"ERR_UNREACHABLE", errors.New("target unreachable: connection refused")}
+
+	if got := errorCode(err); got != "ERR_UNREACHABLE" {
+		t.Errorf("Expected ERR_UNREACHABLE, got %q", got)
+	}
+	if got := errorCode(fmt.Errorf("run: %w", err)); got != "ERR_UNREACHABLE" {
+		t.Errorf("Expected code through wrapping, got %q", got)
+	}
+	if got := errorCode(errors.New("Test run failed")); got != "" {
+		t.Errorf("Expected no code for plain errors, got %q", got)
+	}
+}
+
+func TestPreflightCheck(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			_ = conn.Close()
+		}
+	}()
+	port := ln.Addr().(*net.TCPAddr).Port
+
+	result, err := preflightCheck("127.0.0.1", port, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Probes != PREFLIGHT_PROBES || result.Replies != PREFLIGHT_PROBES {
+		t.Errorf("Expected %d replies to %d probes, got %d of %d", PREFLIGHT_PROBES, PREFLIGHT_PROBES, result.Replies, result.Probes)
+	}
+	if result.RttMinMs > result.RttAvgMs || result.RttAvgMs > result.RttMaxMs {
+		t.Errorf("Expected min <= avg <= max, got %v, %v and %v", result.RttMinMs, result.RttAvgMs, result.RttMaxMs)
+	}
+
+	// Nothing listens once the listener is closed
+	ln.Close()
+	if _, err := preflightCheck("127.0.0.1", port, "", nil); errorCode(err) != ERR_UNREACHABLE {
+		t.Errorf("Expected ERR_UNREACHABLE, got %v", err)
+	}
+}
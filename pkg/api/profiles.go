@@ -0,0 +1,249 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+)
+
+// ProfileLimits caps what requests against a profile's targets may ask for (0 = no limit)
+type ProfileLimits struct {
+	MaxDuration  int `json:"max_duration,omitempty"`  // Seconds
+	MaxParallel  int `json:"max_parallel,omitempty"`  // Streams
+	MaxBandwidth int `json:"max_bandwidth,omitempty"` // Mbit/s
+	MaxCount     int `json:"max_count,omitempty"`     // TWAMP probes
+}
+
+// Profile holds per-site request defaults and limits.
+//
+// Targets are host names, globs such as "*.example.net" or CIDR prefixes matched
+// against literal IP targets. Defaults uses the request body format; the request
+// is decoded on top of it, so fields the caller sets always win.
+type Profile struct {
+	Name     string          `json:"name"`
+	Targets  []string        `json:"targets"`
+	Defaults json.RawMessage `json:"defaults,omitempty"`
+	Limits   ProfileLimits   `json:"limits"`
+
+	networks []*net.IPNet
+}
+
+// ProfileSet is the ordered list of configured profiles
+type ProfileSet struct {
+	Profiles []*Profile `json:"profiles"`
+}
+
+var profileSet = &ProfileSet{Profiles: []*Profile{}}
+
+// configureProfiles loads PROFILES_FILE, or else the profiles inlined in PROFILES
+func configureProfiles() {
+	source := os.Getenv("PROFILES_FILE")
+	var set *ProfileSet
+	var err error
+	switch v := os.Getenv("PROFILES"); {
+	case source != "":
+		set, err = loadProfiles(source)
+	case v != "":
+		source = "PROFILES"
+		set, err = parseProfiles([]byte(v), source)
+	default:
+		return
+	}
+	if err != nil {
+		log.Fatalf("Loading profiles failed: %v", err)
+	}
+	profileSet = set
+	log.Printf("Loaded %d profiles from %s", len(set.Profiles), source)
+}
+
+// loadProfiles reads and validates a profiles file
+func loadProfiles(file string) (*ProfileSet, error) {
+	raw, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return parseProfiles(raw, file)
+}
+
+// parseProfiles validates the profiles of source, a file or PROFILES
+func parseProfiles(raw []byte, source string) (*ProfileSet, error) {
+	set := &ProfileSet{Profiles: []*Profile{}}
+	if err := json.Unmarshal(raw, set); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", source, err)
+	}
+
+	names := make(map[string]bool)
+	for i, p := range set.Profiles {
+		if p.Name == "" {
+			return nil, fmt.Errorf("profile %d: name is required", i)
+		}
+		if names[p.Name] {
+			return nil, fmt.Errorf("profile %s: duplicate name", p.Name)
+		}
+		names[p.Name] = true
+
+		for _, t := range p.Targets {
+			if strings.Contains(t, "/") {
+				_, network, err := net.ParseCIDR(t)
+				if err != nil {
+					return nil, fmt.Errorf("profile %s: invalid target %q: %w", p.Name, t, err)
+				}
+				p.networks = append(p.networks, network)
+			} else if _, err := path.Match(t, ""); err != nil {
+				return nil, fmt.Errorf("profile %s: invalid target %q: %w", p.Name, t, err)
+			}
+		}
+
+		if len(p.Defaults) > 0 {
+			dec := json.NewDecoder(bytes.NewReader(p.Defaults))
+			dec.DisallowUnknownFields()
+			var defaults RunRequest
+			if err := dec.Decode(&defaults); err != nil {
+				return nil, fmt.Errorf("profile %s: invalid defaults: %w", p.Name, err)
+			}
+		}
+	}
+	return set, nil
+}
+
+// matches reports whether the profile applies to host (exact reports an exact host name match)
+func (p *Profile) matches(host string) (matched, exact bool) {
+	ip := net.ParseIP(host)
+	for _, t := range p.Targets {
+		if strings.EqualFold(t, host) {
+			return true, true
+		}
+	}
+	for _, t := range p.Targets {
+		if ok, _ := path.Match(strings.ToLower(t), strings.ToLower(host)); ok {
+			return true, false
+		}
+	}
+	if ip != nil {
+		for _, n := range p.networks {
+			if n.Contains(ip) {
+				return true, false
+			}
+		}
+	}
+	return false, false
+}
+
+// Select returns the named profile, or the profile matching host when name is empty.
+// An exact host name match wins over globs and prefixes; otherwise file order decides.
+func (s *ProfileSet) Select(host, name string) (*Profile, error) {
+	if name != "" {
+		for _, p := range s.Profiles {
+			if p.Name == name {
+				return p, nil
+			}
+		}
+		return nil, fmt.Errorf("unknown profile %q", name)
+	}
+
+	var first *Profile
+	for _, p := range s.Profiles {
+		matched, exact := p.matches(host)
+		if exact {
+			return p, nil
+		}
+		if matched && first == nil {
+			first = p
+		}
+	}
+	return first, nil
+}
+
+// CheckLimits rejects requests that exceed the profile's limits
+func (p *Profile) CheckLimits(req RunRequest) error {
+	l := p.Limits
+	switch {
+	case l.MaxDuration > 0 && req.Duration > l.MaxDuration:
+		return fmt.Errorf("duration %d exceeds profile %s limit of %d", req.Duration, p.Name, l.MaxDuration)
+	case l.MaxDuration > 0 && req.Duration+req.Omit > l.MaxDuration:
+		return fmt.Errorf("duration %d plus omit %d exceeds profile %s limit of %d", req.Duration, req.Omit, p.Name, l.MaxDuration)
+	case l.MaxParallel > 0 && req.Parallel > l.MaxParallel:
+		return fmt.Errorf("parallel %d exceeds profile %s limit of %d", req.Parallel, p.Name, l.MaxParallel)
+	case l.MaxBandwidth > 0 && req.Bandwidth.exceeds(l.MaxBandwidth):
+		return fmt.Errorf("bandwidth %s exceeds profile %s limit of %d", req.Bandwidth, p.Name, l.MaxBandwidth)
+	case l.MaxCount > 0 && req.Count > l.MaxCount:
+		return fmt.Errorf("count %d exceeds profile %s limit of %d", req.Count, p.Name, l.MaxCount)
+	}
+	return nil
+}
+
+// decodeRunRequest decodes a test request over the defaults of its target's profile.
+// On failure it writes the error response and returns false.
+func decodeRunRequest(w http.ResponseWriter, r *http.Request) (RunRequest, *Profile, bool) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return RunRequest{}, nil, false
+	}
+	req, err := decodeRequestBody(body)
+	var profile *Profile
+	if err == nil {
+		req, profile, err = withProfileDefaults(req, body)
+	}
+	if err != nil {
+		writeTestResponse(w, nil, http.StatusBadRequest, err)
+		return req, nil, false
+	}
+	return req, profile, true
+}
+
+// requestHost is the host a request tests: server_host, or the host of url or endpoint
+func requestHost(req RunRequest) string {
+	host := req.ServerHost
+	if host == "" && req.URL != "" {
+		host = transferHost(req.URL)
+	}
+	if host == "" && req.Endpoint != "" {
+		host = transferHost(req.Endpoint)
+	}
+	return host
+}
+
+// withProfileDefaults selects the profile of a decoded request and, when it has
+// defaults, decodes the request body again over them. An ip_version is applied
+// to the result.
+func withProfileDefaults(req RunRequest, body []byte) (RunRequest, *Profile, error) {
+	profile, err := profileSet.Select(requestHost(req), req.Profile)
+	if err != nil {
+		return req, nil, &codedError{ERR_VALIDATION, &ValidationError{Fields: []FieldError{{Field: "profile", Value: req.Profile, Message: "is not a configured profile"}}}}
+	}
+	if profile != nil && len(profile.Defaults) > 0 {
+		// Both documents already decoded cleanly on their own (defaults at load time)
+		req = RunRequest{}
+		_ = json.Unmarshal(profile.Defaults, &req)
+		_ = json.Unmarshal(body, &req)
+	}
+	applyIPVersion(&req)
+	return req, profile, nil
+}
+
+// checkProfileLimits checks a defaulted request against its profile, if any,
+// and the client's API key
+func checkProfileLimits(req RunRequest, profile *Profile) error {
+	if err := req.apiKey.checkLimits(req); err != nil {
+		return err
+	}
+	if profile == nil {
+		return nil
+	}
+	return profile.CheckLimits(req)
+}
+
+func profilesList(w http.ResponseWriter, r *http.Request) {
+	jsonResponse(w, ApiResponse{
+		Status: "ok",
+		Data:   profileSet,
+	}, http.StatusOK)
+}
@@ -0,0 +1,90 @@
+package api
+
+import (
+	"testing"
+)
+
+// parseTestProfiles parses a profiles file as configureProfiles does
+func parseTestProfiles(t *testing.T, raw string) *ProfileSet {
+	t.Helper()
+	set, err := parseProfiles([]byte(raw), "PROFILES")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return set
+}
+
+func TestProfileMatches(t *testing.T) {
+	p := parseTestProfiles(t, `{"profiles": [{"name": "lab", "targets": ["*.lab.example.net", "10.20.0.0/16", "core1.example.net"]}]}`).Profiles[0]
+
+	tests := []struct {
+		host    string
+		matched bool
+		exact   bool
+	}{
+		{"core1.example.net", true, true},
+		{"CORE1.example.net", true, true},
+		{"edge2.lab.example.net", true, false},
+		{"EDGE2.Lab.Example.Net", true, false},
+		{"lab.example.net", false, false},
+		{"10.20.5.1", true, false},
+		{"10.21.0.1", false, false},
+		{"2001:db8::1", false, false},
+	}
+
+	for _, tt := range tests {
+		matched, exact := p.matches(tt.host)
+		if matched != tt.matched || exact != tt.exact {
+			t.Errorf("%s: expected matched=%v exact=%v, got matched=%v exact=%v", tt.host, tt.matched, tt.exact, matched, exact)
+		}
+	}
+}
+
+func TestProfileSelectionOrder(t *testing.T) {
+	set := parseTestProfiles(t, `{"profiles": [
+		{"name": "lab", "targets": ["*.example.net"]},
+		{"name": "core", "targets": ["core1.example.net"]},
+		{"name": "internet", "targets": ["*"]}
+	]}`)
+
+	tests := []struct {
+		host string
+		want string
+	}{
+		{"core1.example.net", "core"}, // Exact match beats an earlier glob
+		{"edge1.example.net", "lab"},  // First matching profile in file order
+		{"speedtest.example.org", "internet"},
+	}
+
+	for _, tt := range tests {
+		got, err := set.Select(tt.host, "")
+		if err != nil || got == nil || got.Name != tt.want {
+			t.Errorf("%s: expected profile %s, got %v (%v)", tt.host, tt.want, got, err)
+		}
+	}
+
+	set.Profiles = set.Profiles[:2]
+	if got, _ := set.Select("example.org", ""); got != nil {
+		t.Errorf("Expected no profile, got %s", got.Name)
+	}
+	if got, err := set.Select("example.org", "core"); err != nil || got.Name != "core" {
+		t.Errorf("Expected the named profile core, got %v (%v)", got, err)
+	}
+	if _, err := set.Select("example.org", "internet"); err == nil {
+		t.Error("Expected error for an unknown profile name")
+	}
+}
+
+func TestParseProfiles_Invalid(t *testing.T) {
+	for name, raw := range map[string]string{
+		"no name":          `{"profiles": [{"targets": ["*"]}]}`,
+		"duplicate name":   `{"profiles": [{"name": "lab"}, {"name": "lab"}]}`,
+		"bad prefix":       `{"profiles": [{"name": "lab", "targets": ["10.20.0.0/33"]}]}`,
+		"bad glob":         `{"profiles": [{"name": "lab", "targets": ["[a-"]}]}`,
+		"unknown defaults": `{"profiles": [{"name": "lab", "defaults": {"duraton": 10}}]}`,
+	} {
+		if _, err := parseProfiles([]byte(raw), "PROFILES"); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
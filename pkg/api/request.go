@@ -0,0 +1,156 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+)
+
+type RunRequest struct {
+	ServerHost string    `json:"server_host"`
+	ServerPort int       `json:"server_port"`
+	Duration   int       `json:"duration"`
+	Parallel   int       `json:"parallel"`
+	Count      int       `json:"count"`
+	Padding    int       `json:"padding"`
+	Protocol   string    `json:"protocol"`
+	Reverse    bool      `json:"reverse"`
+	Bandwidth  Bandwidth `json:"bandwidth"` // Bandwidth limit in Mbit/s or a rate like "2.5M", 0 for none over TCP (default: 100)
+	Payload    string    `json:"payload"`   // Payload entropy: random, compressible or zero (default: random)
+	Preflight  bool      `json:"preflight"` // TCP-probe the target first and abort with ERR_UNREACHABLE if it fails
+	ECN        bool      `json:"ecn"`       // Negotiate ECN on iperf3 TCP streams, mark TWAMP loss mode probes ECT(0)
+	Tunnel     string    `json:"tunnel"`    // TUNNELS_FILE tunnel iperf3 and TWAMP traffic must run through
+
+	// Transfer-limited iperf3 tests (iperf3 -n and -k); duration becomes a time limit (default: 60)
+	NumBytes    int64  `json:"num_bytes"`    // Stop once this many bytes moved on all streams
+	BlockCount  int    `json:"block_count"`  // Stop once this many blocks of the block size moved
+	Omit        int    `json:"omit"`         // Seconds of iperf3 TCP warm-up run before duration and left out of the results
+	Congestion  string `json:"congestion"`   // TCP congestion control algorithm for iperf3 streams, e.g. cubic or bbr
+	WindowSize  int    `json:"window_size"`  // SO_SNDBUF and SO_RCVBUF of iperf3 data streams in bytes
+	PacingTimer int    `json:"pacing_timer"` // Granularity of iperf3 pacing in microseconds (iperf3 --pacing-timer, default: 1000)
+	ZeroCopy    bool   `json:"zerocopy"`     // Send iperf3 TCP uploads with sendfile (iperf3 -Z), Linux only
+	TCPInfo     bool   `json:"tcp_info"`     // Report TCP_INFO of iperf3 upload streams each second and at the end, Linux only
+
+	// UDP rate searches
+	BandwidthMode string    `json:"bandwidth_mode"` // fixed, adaptive or ramp (default: fixed)
+	MaxLoss       float64   `json:"max_loss"`       // Loss target in percent for adaptive and ramp mode (default: 1.0)
+	RampStep      Bandwidth `json:"ramp_step"`      // Rate added after each clean ramp mode trial (default: bandwidth)
+
+	AddressFamily string          `json:"address_family"` // auto, ipv4, ipv6 or compare (default: auto)
+	IPVersion     json.RawMessage `json:"ip_version"`     // 4, 6 or auto, overriding address_family
+	SourceAddress string          `json:"source_address"` // Local address to send iperf3 and TWAMP tests from
+	Interface     string          `json:"interface"`      // Interface or VRF device to bind iperf3 and TWAMP tests to (Linux)
+	Netns         string          `json:"netns"`          // Network namespace to run iperf3, TWAMP and OWAMP tests in, and resolve server_host from: an ip netns name or /proc/<pid>/ns/net (Linux)
+
+	// Dual-stack comparison of iperf3 and TWAMP tests
+	DualStack          string  `json:"dual_stack"`           // Run over ipv4 and ipv6: sequential or concurrent (TWAMP full mode only)
+	DualStackThreshold float64 `json:"dual_stack_threshold"` // Percent change of a metric counted as an IPv6 regression (default: 10)
+
+	DSCP int    `json:"dscp"` // DSCP code point for TWAMP probes (0-63, default: 0)
+	TOS  int    `json:"tos"`  // TOS byte for TWAMP probes, overriding dscp (0-255, ECN bits clear)
+	Mode string `json:"mode"` // TWAMP mode: full, loss, capacity, available or sweep (default: full)
+	Rate int    `json:"rate"` // TWAMP loss mode probe rate in packets/s (default: 1000)
+
+	TrainLength       int                `json:"train_length"`        // Probes per train in TWAMP capacity mode (default: 2), per stream in available mode (default: 100)
+	HistogramBucketMs float64            `json:"histogram_bucket_ms"` // Bucket width of the TWAMP full mode latency histograms (default: no histograms)
+	IncludeRaw        bool               `json:"include_raw"`         // Return every TWAMP full mode probe with its timestamps
+	PaddingSizes      []int              `json:"padding_sizes"`       // Paddings swept in TWAMP sweep mode (default: 0, 500 and 1400 bytes)
+	TwampLight        bool               `json:"twamp_light"`         // Send TWAMP full mode probes straight to the reflector's UDP port at server_port, without TWAMP-Control
+	Sessions          []TwampSessionSpec `json:"sessions"`            // TWAMP full mode sessions run at once over one control connection, each with its own dscp and padding
+	Profile           string             `json:"profile"`             // Named profile to apply instead of the one matching server_host
+
+	// Coordination of bandwidth-heavy tests (iperf3, TWAMP loss mode)
+	Uplink   string `json:"uplink"`    // Shared uplink name locked in addition to the server
+	LockWait int    `json:"lock_wait"` // Seconds to wait for busy resources (default: 60)
+
+	AllowConcurrent bool `json:"allow_concurrent"` // Skip waiting for other tests to the same server_host:port on this agent
+
+	TimeoutSec int `json:"timeout_sec"` // Hard deadline of iperf3 and TWAMP tests, connect to results exchange (default and max: TEST_TIMEOUT_MAX)
+
+	CallbackURL string `json:"callback_url"` // POST the stored result here (retried, optionally HMAC-signed)
+
+	PredictionID string `json:"prediction_id"` // Stored TWAMP result whose tcp_prediction an iperf3 TCP result is checked against
+
+	// HTTP(S)/FTP file transfer tests
+	URL       string `json:"url"`       // File to download or upload to
+	Direction string `json:"direction"` // download or upload (default: download)
+	Size      int64  `json:"size"`      // Bytes to upload (default: 10 MiB), or to stop a download after (default: whole file)
+	Method    string `json:"method"`    // HTTP upload method: PUT or POST (default: PUT)
+
+	// Certificate checks of https transfer, S3, TLS and NDT7 wss tests
+	RootStore     string `json:"root_store"`      // system or a TLS_ROOT_STORES name to validate the chain against (default: system)
+	TLSSkipVerify bool   `json:"tls_skip_verify"` // Run the test even when the chain does not validate, reporting why
+
+	// S3-compatible object storage tests; size and parallel also apply
+	Endpoint    string `json:"endpoint"`     // http(s) URL of the S3 API
+	Bucket      string `json:"bucket"`       // Bucket to upload to
+	Key         string `json:"key"`          // Object key (default: a random key under network-test-api/)
+	Region      string `json:"region"`       // Signing region (default: the credentials' region, or us-east-1)
+	Credentials string `json:"credentials"`  // SECRETS_FILE entry with access_key_id and secret_access_key
+	PartSize    int64  `json:"part_size"`    // Multipart part size in bytes (default: 8 MiB)
+	VirtualHost bool   `json:"virtual_host"` // Address the bucket as a subdomain instead of the path
+	KeepObject  bool   `json:"keep_object"`  // Leave the object in the bucket after the test
+
+	// SSH file transfer tests; protocol (scp or sftp), direction, size and credentials also apply
+	RemotePath          string `json:"remote_path"`            // File to download or upload to (upload default: /dev/null)
+	HostKeyFingerprint  string `json:"host_key_fingerprint"`   // Expected SHA256 host key fingerprint, as ssh-keygen -l prints it
+	InsecureSkipHostKey bool   `json:"insecure_skip_host_key"` // Log in to a host whose key is neither pinned nor in SSH_KNOWN_HOSTS
+
+	// TLS handshake tests; server_port, root_store and tls_skip_verify also apply
+	ServerName  string   `json:"server_name"`  // SNI and the name the certificate is checked for (default: server_host)
+	ALPN        []string `json:"alpn"`         // Protocols offered with ALPN (default: h2 and http/1.1)
+	TLSVersions []string `json:"tls_versions"` // Versions to try one handshake each: 1.0, 1.1, 1.2 or 1.3
+
+	// NDT7 speed tests have no fields of their own: server_host is optional
+	// (default: the nearest M-Lab server), protocol is wss or ws and direction
+	// download, upload or both (default: both)
+
+	// Bufferbloat tests: iperf3 TCP load at server_host; duration, parallel,
+	// bandwidth, direction, interval (of the probes) and credentials also apply
+	Probe        string `json:"probe"`         // Latency probes: twamp or ping (default: twamp)
+	ProbeHost    string `json:"probe_host"`    // TWAMP server or ping target (default: server_host)
+	ProbePort    int    `json:"probe_port"`    // TWAMP-Control port (default: 862), or the UDP port to ping instead of ICMP
+	IdleDuration int    `json:"idle_duration"` // Seconds of probes without load before the first load (default: 5)
+
+	// RPM tests have no fields of their own: url is the networkQuality
+	// configuration (default: RPM_CONFIG_URL, else Apple's), direction download,
+	// upload or both at once (default: both), parallel the load-generating
+	// connections per direction to start with and interval that of the probes
+
+	// TCP connect tests; parallel (connects at a time, default: 16) also applies
+	Targets        []string `json:"targets"`         // host:port pairs to connect to, up to 256
+	ConnectTimeout float64  `json:"connect_timeout"` // Seconds per connect, name resolution included (default: 3)
+
+	// Path MTU tests; protocol (udp or tcp) and dscp also apply
+	MaxSize int `json:"max_size"` // Largest IP packet size probed in bytes (default: 1500)
+
+	// NAT tests against the STUN server at server_host
+	STUNServers []string `json:"stun_servers"` // Further STUN servers (host[:port]) whose mappings are compared
+
+	// Ping tests; protocol (icmp, udp or echo), count and server_port (udp and echo) also apply
+	Interval   float64 `json:"interval"`    // Seconds between probes (default: 1)
+	PacketSize int     `json:"packet_size"` // Payload bytes per probe (default: 56)
+	TTL        int     `json:"ttl"`         // TTL (hop limit) of the probes (default: 64)
+
+	// Traceroute tests; protocol (udp, icmp or tcp) and server_port also apply
+	MaxHops      int  `json:"max_hops"`       // Highest TTL probed (default: 30)
+	ProbesPerHop int  `json:"probes_per_hop"` // Probes sent at each TTL (default: 3)
+	NoDNS        bool `json:"no_dns"`         // Skip reverse DNS lookups of the hops
+
+	// Optional time series in the final response
+	Series           bool   `json:"series"`            // Include per-interval throughput / per-probe RTT
+	SeriesMaxPoints  int    `json:"series_max_points"` // Cap on returned points (default: 300)
+	SeriesDownsample string `json:"series_downsample"` // mean, min, max or none (truncate) when over the cap
+
+	progress *JobProgress    // Partial results of an asynchronous job, nil otherwise
+	ctx      context.Context // Ends the test early: the HTTP request's or the job's context
+	jobID    string          // Of an asynchronous test, for GET /status
+	apiKey   *APIKey         // Of the client, whose limits apply; nil without API keys
+}
+
+type ApiResponse struct {
+	Status    string      `json:"status"`
+	Data      interface{} `json:"data,omitempty"`
+	Error     string      `json:"error,omitempty"`
+	Code      string      `json:"code,omitempty"`       // Machine-readable error code, e.g. ERR_UNREACHABLE
+	RequestID string      `json:"request_id,omitempty"` // Of the request, as in X-Request-Id
+}
@@ -0,0 +1,56 @@
+package api
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"network-test-api/pkg/stats"
+)
+
+func TestParseWindow(t *testing.T) {
+	tests := []struct {
+		in   string
+		want time.Duration
+	}{
+		{"", 24 * time.Hour},
+		{"90m", 90 * time.Minute},
+		{"24h", 24 * time.Hour},
+		{"7d", 7 * 24 * time.Hour},
+	}
+	for _, tt := range tests {
+		got, err := parseWindow(tt.in)
+		if err != nil || got != tt.want {
+			t.Errorf("Expected %q to parse as %v, got %v (%v)", tt.in, tt.want, got, err)
+		}
+	}
+
+	for _, bad := range []string{"abc", "-1h", "0d", "xd"} {
+		if _, err := parseWindow(bad); err == nil {
+			t.Errorf("Expected error for window %q", bad)
+		}
+	}
+}
+
+func TestPercentile_Interpolates(t *testing.T) {
+	values := []float64{10, 20, 30, 40, 50}
+
+	if p := stats.Percentile(values, 50); p != 30 {
+		t.Errorf("Expected p50=30, got %v", p)
+	}
+	if p := stats.Percentile(values, 90); math.Abs(p-46) > 1e-9 {
+		t.Errorf("Expected p90=46, got %v", p)
+	}
+	if p := stats.Percentile(values, 100); p != 50 {
+		t.Errorf("Expected p100=50, got %v", p)
+	}
+	if p := stats.Percentile(values, 0); p != 10 {
+		t.Errorf("Expected p0=10, got %v", p)
+	}
+}
+
+func TestPercentile_SingleValue(t *testing.T) {
+	if p := stats.Percentile([]float64{7}, 99); p != 7 {
+		t.Errorf("Expected p99=7 for a single sample, got %v", p)
+	}
+}
@@ -0,0 +1,68 @@
+package api
+
+import (
+	"testing"
+)
+
+func TestCompareMetric_Regression(t *testing.T) {
+	bandwidth := resultMetric{Path: "bandwidth_mbps", Better: "higher"}
+	samples := []float64{92, 94, 95, 93, 96, 94}
+
+	got := compareMetric(bandwidth, 60, samples, 3, 10)
+	if got.Change != "regressed" || !got.Significant {
+		t.Errorf("Expected a drop to 60 from about 94 to regress, got %+v", got)
+	}
+	if *got.Median != 94 {
+		t.Errorf("Expected median 94, got %v", *got.Median)
+	}
+
+	rtt := resultMetric{Path: "rtt_avg_ms", Better: "lower"}
+	if got := compareMetric(rtt, 10, []float64{20, 21, 19, 20, 22}, 3, 10); got.Change != "improved" {
+		t.Errorf("Expected lower RTT to improve, got %q", got.Change)
+	}
+}
+
+func TestCompareMetric_NeedsBothSigmaAndThreshold(t *testing.T) {
+	bandwidth := resultMetric{Path: "bandwidth_mbps", Better: "higher"}
+
+	// Noisy baseline: 30% down but within 3 standard deviations
+	noisy := []float64{50, 100, 150, 60, 140, 100}
+	if got := compareMetric(bandwidth, 70, noisy, 3, 10); got.Significant {
+		t.Errorf("Expected a change within the noise to be normal, got %+v", got)
+	}
+
+	// Stable baseline: many standard deviations but under 10%
+	stable := []float64{100, 100.1, 99.9, 100, 100.1}
+	if got := compareMetric(bandwidth, 98, stable, 3, 10); got.Significant || got.Change != "normal" {
+		t.Errorf("Expected a 2%% change to be normal, got %+v", got)
+	}
+}
+
+func TestCompareMetric_FlatBaseline(t *testing.T) {
+	loss := resultMetric{Path: "loss_percent", Better: "lower"}
+	flat := []float64{0, 0, 0, 0, 0}
+
+	got := compareMetric(loss, 2, flat, 3, 10)
+	if got.Score != nil || got.DeltaPercent != nil {
+		t.Errorf("Expected no score or percentage against a flat zero baseline, got %+v", got)
+	}
+	if got.Change != "regressed" {
+		t.Errorf("Expected loss from none to regress, got %q", got.Change)
+	}
+	if got := compareMetric(loss, 0, flat, 3, 10); got.Significant {
+		t.Errorf("Expected an unchanged metric to be normal, got %+v", got)
+	}
+}
+
+func TestCompareMetric_Insufficient(t *testing.T) {
+	m := resultMetric{Path: "jitter_ms"}
+	if got := compareMetric(m, 5, nil, 3, 10); got.Change != "insufficient" || got.Median != nil {
+		t.Errorf("Expected no baseline to be insufficient, got %+v", got)
+	}
+	if got := compareMetric(m, 50, []float64{1, 1, 1, 1}, 3, 10); got.Change != "insufficient" || got.Significant {
+		t.Errorf("Expected 4 baseline runs to be insufficient, got %+v", got)
+	}
+	if got := compareMetric(m, 50, []float64{1, 1, 1, 1, 1}, 3, 10); got.Change != "changed" {
+		t.Errorf("Expected a metric with no better direction to change, got %q", got.Change)
+	}
+}
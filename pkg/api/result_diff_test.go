@@ -0,0 +1,72 @@
+package api
+
+import (
+	"testing"
+)
+
+func TestMetricValue_NestedPath(t *testing.T) {
+	data := map[string]interface{}{
+		"rtt_avg_ms":                 12.5,
+		"reflector_turnaround_ms":    map[string]interface{}{"avg": 0.08},
+		"server":                     "twamp.example.com",
+		"forward_delay_corrected_ms": nil,
+	}
+
+	if v, ok := metricValue(data, "rtt_avg_ms"); !ok || v != 12.5 {
+		t.Errorf("Expected 12.5, got %v (%v)", v, ok)
+	}
+	if v, ok := metricValue(data, "reflector_turnaround_ms.avg"); !ok || v != 0.08 {
+		t.Errorf("Expected 0.08, got %v (%v)", v, ok)
+	}
+	if _, ok := metricValue(data, "server"); ok {
+		t.Error("Expected non-numeric field to be skipped")
+	}
+	if _, ok := metricValue(data, "forward_delay_corrected_ms.avg"); ok {
+		t.Error("Expected missing nested field to be skipped")
+	}
+}
+
+func TestDiffMetric_HigherIsBetter(t *testing.T) {
+	d := diffMetric(resultMetric{"bandwidth_mbps", "higher"}, 100, 80, 10)
+
+	if d.Change != "regressed" {
+		t.Errorf("Expected regressed, got %s", d.Change)
+	}
+	if d.DeltaPercent == nil || *d.DeltaPercent != -20 {
+		t.Errorf("Expected -20%%, got %v", d.DeltaPercent)
+	}
+	if !d.ExceedsThreshold {
+		t.Error("Expected 20% drop to exceed a 10% threshold")
+	}
+}
+
+func TestDiffMetric_LowerIsBetter(t *testing.T) {
+	d := diffMetric(resultMetric{"rtt_avg_ms", "lower"}, 20, 19, 10)
+
+	if d.Change != "improved" {
+		t.Errorf("Expected improved, got %s", d.Change)
+	}
+	if d.ExceedsThreshold {
+		t.Error("Expected 5% change to stay below a 10% threshold")
+	}
+}
+
+func TestDiffMetric_ZeroBase(t *testing.T) {
+	d := diffMetric(resultMetric{"loss_percent", "lower"}, 0, 2, 10)
+
+	if d.DeltaPercent != nil {
+		t.Errorf("Expected no percentage for a zero base, got %v", *d.DeltaPercent)
+	}
+	if !d.ExceedsThreshold || d.Change != "regressed" {
+		t.Errorf("Expected highlighted regression, got %s (exceeds=%v)", d.Change, d.ExceedsThreshold)
+	}
+}
+
+func TestDiffMetric_NeutralAndUnchanged(t *testing.T) {
+	if d := diffMetric(resultMetric{"sent_bytes", ""}, 1000, 2000, 10); d.Change != "changed" {
+		t.Errorf("Expected changed, got %s", d.Change)
+	}
+	if d := diffMetric(resultMetric{"jitter_ms", "lower"}, 0.5, 0.5, 10); d.Change != "unchanged" || d.ExceedsThreshold {
+		t.Errorf("Expected unchanged without highlight, got %s (exceeds=%v)", d.Change, d.ExceedsThreshold)
+	}
+}
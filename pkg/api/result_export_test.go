@@ -0,0 +1,52 @@
+package api
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestResultOutput(t *testing.T) {
+	cases := []struct {
+		output, accept, want string
+	}{
+		{"", "", "json"},
+		{"", "*/*", "json"},
+		{"", "text/csv", "csv"},
+		{"", "application/junit+xml", "junit"},
+		{"", "text/html, application/xml;q=0.9, */*;q=0.8", "junit"},
+		{"", "application/json, text/csv", "json"},
+		{"CSV", "application/json", "csv"},
+		{"junit", "text/csv", "junit"},
+	}
+	for _, c := range cases {
+		r := httptest.NewRequest(http.MethodGet, "/results?output="+c.output, nil)
+		r.Header.Set("Accept", c.accept)
+		if got, err := resultOutput(r); err != nil || got != c.want {
+			t.Errorf("Expected output %q for ?output=%q and Accept %q, got %q (%v)", c.want, c.output, c.accept, got, err)
+		}
+	}
+	if _, err := resultOutput(httptest.NewRequest(http.MethodGet, "/results?output=xlsx", nil)); err == nil {
+		t.Errorf("Expected error for output xlsx")
+	}
+}
+
+func TestExportCSV_ColumnsOfAnyRow(t *testing.T) {
+	var b bytes.Buffer
+	err := writeCSV(&b, []exportCase{
+		{Type: "iperf3", Name: "a.example.net", ResultID: "a", Metrics: []exportMetric{{"bandwidth_mbps", 94.1}, {"retransmits", 3}}},
+		{Type: "iperf3", Name: "b.example.net", ResultID: "b", Metrics: []exportMetric{{"bandwidth_mbps", 88}, {"loss_percent", 0.5}}},
+		{Type: "iperf3", Name: "c.example.net", Error: "connection refused", Code: "ERR_UNREACHABLE"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "result_id,type,target,started_at,duration_sec,status,code,error,bandwidth_mbps,retransmits,loss_percent\n" +
+		"a,iperf3,a.example.net,,0,ok,,,94.1,3,\n" +
+		"b,iperf3,b.example.net,,0,ok,,,88,,0.5\n" +
+		",iperf3,c.example.net,,0,error,ERR_UNREACHABLE,connection refused,,,\n"
+	if got := b.String(); got != want {
+		t.Errorf("Expected\n%s\ngot\n%s", want, got)
+	}
+}
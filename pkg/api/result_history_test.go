@@ -0,0 +1,80 @@
+package api
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRequestParamsOmitsZeroValues(t *testing.T) {
+	params := requestParams(RunRequest{ServerHost: "iperf.example.net", ServerPort: 5201, STUNServers: []string{}, jobID: "af20ef46b0c8a787"})
+	if len(params) != 2 || params["server_host"] != "iperf.example.net" || params["server_port"] != 5201.0 {
+		t.Errorf("expected only server_host and server_port, got %v", params)
+	}
+
+	params = requestParams(RunRequest{Reverse: true, MaxLoss: 0.5, STUNServers: []string{"stun.example.net"}})
+	if params["reverse"] != true || params["max_loss"] != 0.5 || len(params["stun_servers"].([]interface{})) != 1 {
+		t.Errorf("expected reverse, max_loss and stun_servers, got %v", params)
+	}
+}
+
+// loadResults writes lines to a results file and loads it into a store of max results
+func loadResults(t *testing.T, lines []string, max int) (*ResultStore, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "results.jsonl")
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	s := NewResultStore(max)
+	if err := openResultFile(s, path); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.file.f.Close() })
+	return s, path
+}
+
+// fileIDs lists the IDs of the results in a results file
+func fileIDs(t *testing.T, path string) string {
+	t.Helper()
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, line := range strings.Split(strings.TrimSpace(string(raw)), "\n") {
+		var stored StoredResult
+		if err := json.Unmarshal([]byte(line), &stored); err != nil {
+			t.Fatalf("expected only readable lines after loading, got %q", line)
+		}
+		ids = append(ids, stored.ID)
+	}
+	return strings.Join(ids, ",")
+}
+
+func TestLoadResultsSkipsTornLines(t *testing.T) {
+	s, path := loadResults(t, []string{
+		`{"id":"a","type":"iperf3"}`,
+		`{"id":"b","type":"twamp"}`,
+		``,
+		`{"id":"c","type":"ping"}`,
+		`{"id":"d","ty`, // Cut short by a crash
+	}, 1000)
+	if got := strings.Join(s.order, ","); got != "a,b,c" {
+		t.Errorf("expected a,b,c, got %v", got)
+	}
+	if got := fileIDs(t, path); got != "a,b,c" {
+		t.Errorf("expected the file compacted to a,b,c, got %v", got)
+	}
+}
+
+func TestLoadResultsKeepsNewest(t *testing.T) {
+	s, path := loadResults(t, []string{`{"id":"a"}`, `{"id":"b"}`, `{"id":"c"}`}, 2)
+	if got := strings.Join(s.order, ","); got != "b,c" {
+		t.Errorf("expected b,c, got %v", got)
+	}
+	if got := fileIDs(t, path); got != "b,c" {
+		t.Errorf("expected the evicted result compacted away, got %v", got)
+	}
+}
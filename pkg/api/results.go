@@ -0,0 +1,193 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Completed test results kept in memory for later comparison, and with
+// RESULTS_FILE on disk across restarts (see results_history.go)
+const MAX_STORED_RESULTS = 1000
+
+// Test types recorded in the result store
+const (
+	TEST_TYPE_IPERF3      = "iperf3"
+	TEST_TYPE_TWAMP       = "twamp"
+	TEST_TYPE_TRANSFER    = "transfer"
+	TEST_TYPE_S3          = "s3"
+	TEST_TYPE_SSH         = "ssh"
+	TEST_TYPE_PMTU        = "pmtu"
+	TEST_TYPE_STUN        = "stun"
+	TEST_TYPE_NAT64       = "nat64"
+	TEST_TYPE_PING        = "ping"
+	TEST_TYPE_TRACEROUTE  = "traceroute"
+	TEST_TYPE_OWAMP       = "owamp"
+	TEST_TYPE_TLS         = "tls"
+	TEST_TYPE_NDT7        = "ndt7"
+	TEST_TYPE_BUFFERBLOAT = "bufferbloat"
+	TEST_TYPE_RPM         = "rpm"
+	TEST_TYPE_TCP_CONNECT = "tcp_connect"
+	TEST_TYPE_HTTP        = "http"
+)
+
+// StoredResult is a completed test with the data returned to the caller.
+// Data is a JSON round-tripped copy, so numbers are float64 and nested objects are maps.
+type StoredResult struct {
+	ID        string                 `json:"id"`
+	Type      string                 `json:"type"`
+	Target    string                 `json:"target"`
+	StartedAt time.Time              `json:"started_at"` // Origin of the result's time series
+	CreatedAt time.Time              `json:"created_at"`
+	Params    map[string]interface{} `json:"params,omitempty"` // Request fields the test ran with, zero values left out
+	Data      map[string]interface{} `json:"data"`
+}
+
+// ResultRef identifies a stored result without its data
+type ResultRef struct {
+	ID        string    `json:"id"`
+	Type      string    `json:"type"`
+	Target    string    `json:"target"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Ref returns the result's identifying fields
+func (r *StoredResult) Ref() ResultRef {
+	return ResultRef{ID: r.ID, Type: r.Type, Target: r.Target, CreatedAt: r.CreatedAt}
+}
+
+// ResultStore keeps the most recent results, evicting the oldest beyond max
+type ResultStore struct {
+	mu    sync.RWMutex
+	max   int
+	order []string
+	byID  map[string]*StoredResult
+	file  *resultFile // Persists the results, nil without RESULTS_FILE
+}
+
+// NewResultStore creates an empty store holding up to max results
+func NewResultStore(max int) *ResultStore {
+	return &ResultStore{max: max, byID: make(map[string]*StoredResult)}
+}
+
+var resultStore = NewResultStore(MAX_STORED_RESULTS)
+
+// newResultID returns a random 16 character hex ID
+func newResultID() string {
+	var b [8]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// Add assigns an ID to a completed test, sets data["id"] and stores a copy of data
+func (s *ResultStore) Add(testType, target string, params map[string]interface{}, startedAt time.Time, data map[string]interface{}) (*StoredResult, error) {
+	id := newResultID()
+	data["id"] = id
+
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("encode result: %w", err)
+	}
+	stored := &StoredResult{ID: id, Type: testType, Target: target, StartedAt: startedAt.UTC(), CreatedAt: time.Now().UTC(), Params: params}
+	if err := json.Unmarshal(raw, &stored.Data); err != nil {
+		return nil, fmt.Errorf("decode result: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.insert(stored)
+	if s.file != nil {
+		s.persist(stored)
+	}
+	return stored, nil
+}
+
+// insert keeps a result, evicting the oldest beyond max; the caller holds s.mu
+func (s *ResultStore) insert(stored *StoredResult) {
+	s.byID[stored.ID] = stored
+	s.order = append(s.order, stored.ID)
+	for len(s.order) > s.max {
+		delete(s.byID, s.order[0])
+		s.order = s.order[1:]
+	}
+}
+
+// Get returns a stored result by ID
+func (s *ResultStore) Get(id string) (*StoredResult, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	r, ok := s.byID[id]
+	return r, ok
+}
+
+// Query returns results created at or after from and, unless until is zero,
+// before until, oldest first, optionally filtered by target and type
+func (s *ResultStore) Query(target, testType string, from, until time.Time) []*StoredResult {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var matched []*StoredResult
+	for _, id := range s.order {
+		r := s.byID[id]
+		if r.CreatedAt.Before(from) || (!until.IsZero() && !r.CreatedAt.Before(until)) {
+			continue
+		}
+		if (target != "" && r.Target != target) || (testType != "" && r.Type != testType) {
+			continue
+		}
+		matched = append(matched, r)
+	}
+	return matched
+}
+
+// recordResult stores a completed test of req and exports its metrics; failures only cost the caller the ID
+func recordResult(testType string, req RunRequest, startedAt time.Time, data map[string]interface{}) {
+	stored, err := resultStore.Add(testType, req.ServerHost, requestParams(req), startedAt, data)
+	if err != nil {
+		delete(data, "id")
+		return
+	}
+	metricsRegistry.Observe(stored)
+	exportEsmond(stored)
+	exportInflux(stored)
+}
+
+// lookupResult fetches a result by ID, writing a 404 response when it is missing
+func lookupResult(w http.ResponseWriter, id string) (*StoredResult, bool) {
+	result, ok := resultStore.Get(id)
+	if !ok {
+		jsonResponse(w, ApiResponse{
+			Status: "error",
+			Error:  fmt.Sprintf("result %s not found", id),
+		}, http.StatusNotFound)
+	}
+	return result, ok
+}
+
+func resultGet(w http.ResponseWriter, r *http.Request) {
+	output, err := resultOutput(r)
+	if err != nil {
+		jsonResponse(w, ApiResponse{
+			Status: "error",
+			Error:  err.Error(),
+		}, http.StatusBadRequest)
+		return
+	}
+	result, ok := lookupResult(w, mux.Vars(r)["id"])
+	if !ok {
+		return
+	}
+	if output != OUTPUT_JSON {
+		writeExport(w, output, http.StatusOK, []exportCase{storedCase(result)})
+		return
+	}
+	jsonResponse(w, ApiResponse{
+		Status: "ok",
+		Data:   result,
+	}, http.StatusOK)
+}
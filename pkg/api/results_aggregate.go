@@ -0,0 +1,113 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"network-test-api/pkg/stats"
+)
+
+// Aggregation window used when none is given
+const DEFAULT_AGGREGATE_WINDOW = 24 * time.Hour
+
+// MetricAggregate summarises one metric over the runs in a window
+type MetricAggregate = stats.Summary
+
+// TypeAggregate holds the metric summaries for one test type
+type TypeAggregate struct {
+	Runs    int                         `json:"runs"`
+	First   time.Time                   `json:"first"`
+	Last    time.Time                   `json:"last"`
+	Metrics map[string]*MetricAggregate `json:"metrics"`
+}
+
+// parseWindow accepts Go durations (90m, 24h) plus whole days (7d)
+func parseWindow(s string) (time.Duration, error) {
+	if s == "" {
+		return DEFAULT_AGGREGATE_WINDOW, nil
+	}
+	var d time.Duration
+	var err error
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		var n int
+		n, err = strconv.Atoi(days)
+		d = time.Duration(n) * 24 * time.Hour
+	} else {
+		d, err = time.ParseDuration(s)
+	}
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid window %q (expected a positive duration such as 90m, 24h or 7d)", s)
+	}
+	return d, nil
+}
+
+// aggregateResults groups results by test type and summarises each known metric
+func aggregateResults(results []*StoredResult) map[string]*TypeAggregate {
+	samples := make(map[string]map[string][]float64)
+	types := make(map[string]*TypeAggregate)
+
+	for _, r := range results {
+		agg, ok := types[r.Type]
+		if !ok {
+			agg = &TypeAggregate{First: r.CreatedAt, Metrics: make(map[string]*MetricAggregate)}
+			types[r.Type] = agg
+			samples[r.Type] = make(map[string][]float64)
+		}
+		agg.Runs++
+		if r.CreatedAt.Before(agg.First) {
+			agg.First = r.CreatedAt
+		}
+		if r.CreatedAt.After(agg.Last) {
+			agg.Last = r.CreatedAt
+		}
+		for _, m := range resultMetrics[r.Type] {
+			if v, ok := metricValue(r.Data, m.Path); ok {
+				samples[r.Type][m.Path] = append(samples[r.Type][m.Path], v)
+			}
+		}
+	}
+
+	for testType, metrics := range samples {
+		for path, values := range metrics {
+			types[testType].Metrics[path] = stats.Summarize(values)
+		}
+	}
+	return types
+}
+
+func resultAggregate(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	target := q.Get("target")
+	testType := q.Get("type")
+
+	window, err := parseWindow(q.Get("window"))
+	if _, ok := lookupRunner(testType); err == nil && testType != "" && !ok {
+		err = invalidTestType(testType)
+	}
+	if err != nil {
+		jsonResponse(w, ApiResponse{
+			Status: "error",
+			Error:  err.Error(),
+		}, http.StatusBadRequest)
+		return
+	}
+
+	to := time.Now().UTC()
+	from := to.Add(-window)
+	results := resultStore.Query(target, testType, from, time.Time{})
+
+	jsonResponse(w, ApiResponse{
+		Status: "ok",
+		Data: map[string]interface{}{
+			"target": target,
+			"window": window.String(),
+			"from":   from,
+			"to":     to,
+			"runs":   len(results),
+			"types":  aggregateResults(results),
+		},
+	}, http.StatusOK)
+}
@@ -0,0 +1,189 @@
+package api
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"network-test-api/pkg/stats"
+)
+
+// Baseline comparison: the latest result of a target against the median and
+// standard deviation of its earlier results in a window. A metric is flagged
+// when it is both sigma standard deviations and threshold percent away from
+// the median, so neither a noisy metric nor a stable one alerts on noise.
+const (
+	DEFAULT_BASELINE_WINDOW = 7 * 24 * time.Hour
+	DEFAULT_BASELINE_SIGMA  = 3.0
+	MIN_BASELINE_RUNS       = 5 // Baseline samples a metric needs before it is judged
+)
+
+// BaselineMetric compares one metric of a result against its baseline
+type BaselineMetric struct {
+	Metric       string   `json:"metric"`
+	Better       string   `json:"better,omitempty"`
+	Value        float64  `json:"value"`                   // Of the compared result
+	Runs         int      `json:"runs"`                    // Baseline results with this metric
+	Median       *float64 `json:"median"`                  // Of the baseline; null without one
+	StdDev       *float64 `json:"stddev"`                  // Population standard deviation of the baseline
+	Delta        *float64 `json:"delta"`                   // Value minus median
+	DeltaPercent *float64 `json:"delta_percent,omitempty"` // Omitted when the median is 0
+	Score        *float64 `json:"score,omitempty"`         // Delta in standard deviations; omitted when the baseline does not vary
+	Change       string   `json:"change"`                  // improved, regressed, changed, normal or insufficient
+	Significant  bool     `json:"significant"`
+}
+
+// BaselineComparison is the data of GET /results/compare
+type BaselineComparison struct {
+	Result           ResultRef         `json:"result"`
+	Window           string            `json:"window"`
+	From             time.Time         `json:"from"` // Baseline window, up to the result
+	To               time.Time         `json:"to"`
+	BaselineRuns     int               `json:"baseline_runs"`
+	Sigma            float64           `json:"sigma"`
+	ThresholdPercent float64           `json:"threshold_percent"`
+	Metrics          []BaselineMetric  `json:"metrics"`
+	Summary          ResultDiffSummary `json:"summary"`
+	Regressed        bool              `json:"regressed"` // Some metric regressed significantly
+}
+
+// compareMetric judges one value against the baseline samples of its metric
+func compareMetric(m resultMetric, value float64, samples []float64, sigma, thresholdPercent float64) BaselineMetric {
+	bm := BaselineMetric{Metric: m.Path, Better: m.Better, Value: value, Runs: len(samples), Change: "insufficient"}
+	if len(samples) == 0 {
+		return bm
+	}
+	s := stats.Summarize(samples)
+	delta := value - s.P50
+	bm.Median, bm.StdDev, bm.Delta = &s.P50, &s.StdDev, &delta
+	if s.P50 != 0 {
+		pct := delta / math.Abs(s.P50) * 100
+		bm.DeltaPercent = &pct
+	}
+	if s.StdDev > 0 {
+		score := delta / s.StdDev
+		bm.Score = &score
+	}
+	if len(samples) < MIN_BASELINE_RUNS {
+		return bm
+	}
+
+	// Without variation in the baseline, any change beyond the threshold counts
+	outlier := bm.Score == nil || math.Abs(*bm.Score) >= sigma
+	large := delta != 0 && (bm.DeltaPercent == nil || math.Abs(*bm.DeltaPercent) >= thresholdPercent)
+	bm.Significant = outlier && large
+	switch {
+	case !bm.Significant:
+		bm.Change = "normal"
+	case m.Better == "":
+		bm.Change = "changed"
+	case (delta > 0) == (m.Better == "higher"):
+		bm.Change = "improved"
+	default:
+		bm.Change = "regressed"
+	}
+	return bm
+}
+
+// compareToBaseline compares every known metric of a result against the
+// earlier results in the baseline
+func compareToBaseline(result *StoredResult, baseline []*StoredResult, sigma, thresholdPercent float64) *BaselineComparison {
+	c := &BaselineComparison{Result: result.Ref(), BaselineRuns: len(baseline), Sigma: sigma, ThresholdPercent: thresholdPercent, Metrics: []BaselineMetric{}}
+	for _, m := range resultMetrics[result.Type] {
+		value, ok := metricValue(result.Data, m.Path)
+		if !ok {
+			continue
+		}
+		var samples []float64
+		for _, b := range baseline {
+			if v, ok := metricValue(b.Data, m.Path); ok {
+				samples = append(samples, v)
+			}
+		}
+		bm := compareMetric(m, value, samples, sigma, thresholdPercent)
+		switch bm.Change {
+		case "regressed":
+			c.Summary.Regressions++
+			c.Regressed = true
+		case "improved":
+			c.Summary.Improvements++
+		case "changed":
+			c.Summary.Changed++
+		}
+		c.Metrics = append(c.Metrics, bm)
+	}
+	return c
+}
+
+// parsePositiveParam reads an optional positive number query parameter
+func parsePositiveParam(name, value string, def float64) (float64, error) {
+	if value == "" {
+		return def, nil
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil || f <= 0 {
+		return 0, fmt.Errorf("invalid %s %q (expected a positive number)", name, value)
+	}
+	return f, nil
+}
+
+func resultCompare(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	target := q.Get("target")
+	testType := q.Get("type")
+
+	window := DEFAULT_BASELINE_WINDOW
+	var err error
+	if v := q.Get("window"); v != "" {
+		window, err = parseWindow(v)
+	}
+	sigma := DEFAULT_BASELINE_SIGMA
+	if err == nil {
+		sigma, err = parsePositiveParam("sigma", q.Get("sigma"), DEFAULT_BASELINE_SIGMA)
+	}
+	threshold := DEFAULT_DIFF_THRESHOLD
+	if err == nil {
+		threshold, err = parsePositiveParam("threshold", q.Get("threshold"), DEFAULT_DIFF_THRESHOLD)
+	}
+	if _, ok := lookupRunner(testType); err == nil && testType != "" && !ok {
+		err = invalidTestType(testType)
+	}
+	if err == nil && target == "" && q.Get("id") == "" {
+		err = fmt.Errorf("target or id is required")
+	}
+	if err != nil {
+		jsonResponse(w, ApiResponse{
+			Status: "error",
+			Error:  err.Error(),
+		}, http.StatusBadRequest)
+		return
+	}
+
+	// The result compared: the one named by id, or the latest of the target
+	var result *StoredResult
+	if id := q.Get("id"); id != "" {
+		var ok bool
+		if result, ok = lookupResult(w, id); !ok {
+			return
+		}
+	} else if results := resultStore.Query(target, testType, time.Time{}, time.Time{}); len(results) > 0 {
+		result = results[len(results)-1]
+	} else {
+		jsonResponse(w, ApiResponse{
+			Status: "error",
+			Error:  fmt.Sprintf("no stored results of %s", target),
+		}, http.StatusNotFound)
+		return
+	}
+
+	from := result.CreatedAt.Add(-window)
+	baseline := resultStore.Query(result.Target, result.Type, from, result.CreatedAt)
+	c := compareToBaseline(result, baseline, sigma, threshold)
+	c.Window, c.From, c.To = window.String(), from, result.CreatedAt
+	jsonResponse(w, ApiResponse{
+		Status: "ok",
+		Data:   c,
+	}, http.StatusOK)
+}
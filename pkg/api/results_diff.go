@@ -0,0 +1,329 @@
+package api
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// Percentage change beyond which a metric delta is highlighted
+const DEFAULT_DIFF_THRESHOLD = 10.0
+
+// resultMetric is a comparable numeric field of a stored result
+type resultMetric struct {
+	Path   string // Dotted path into the result data
+	Better string // "higher", "lower" or "" when neither direction is better
+}
+
+// Metrics compared and aggregated per test type
+var resultMetrics = map[string][]resultMetric{
+	TEST_TYPE_IPERF3: {
+		{"bandwidth_mbps", "higher"},
+		{"sent_bytes", ""},
+		{"received_bytes", ""},
+		{"retransmits", "lower"},
+		{"loss_percent", "lower"},
+		{"jitter_ms", "lower"},
+		{"dial.connect_ms", "lower"},
+	},
+	TEST_TYPE_TWAMP: {
+		{"rtt_min_ms", "lower"},
+		{"rtt_avg_ms", "lower"},
+		{"rtt_max_ms", "lower"},
+		{"rtt_stddev_ms", "lower"},
+		{"percentiles_ms.rtt.p50", "lower"},
+		{"percentiles_ms.rtt.p95", "lower"},
+		{"percentiles_ms.rtt.p99", "lower"},
+		{"percentiles_ms.rtt.p99_9", "lower"},
+		{"loss_percent", "lower"},
+		{"reordered_percent", "lower"},
+		{"reordering.max_distance", "lower"},
+		{"loss_bursts.max_length", "lower"},
+		{"loss_bursts.burst_ratio", "lower"},
+		{"forward_jitter_ms", "lower"},
+		{"reverse_jitter_ms", "lower"},
+		{"forward_delay_corrected_ms.avg", "lower"},
+		{"reverse_delay_corrected_ms.avg", "lower"},
+		{"forward_ipdv_ms.mean_abs", "lower"},
+		{"reverse_ipdv_ms.mean_abs", "lower"},
+		{"reflector_turnaround_ms.avg", "lower"},
+		{"tcp_prediction.predicted_mbps", "higher"},
+		{"hops.forward.avg", ""},
+		{"hops.reverse.avg", ""},
+		{"dial.connect_ms", "lower"},
+	},
+	TEST_TYPE_TRANSFER: {
+		{"goodput_mbps", "higher"},
+		{"bytes", ""},
+		{"timings.dial_ms", "lower"},
+		{"timings.dns_ms", "lower"},
+		{"timings.connect_ms", "lower"},
+		{"timings.tls_ms", "lower"},
+		{"timings.login_ms", "lower"},
+		{"timings.data_connect_ms", "lower"},
+		{"timings.request_ms", "lower"},
+		{"timings.ttfb_ms", "lower"},
+		{"timings.transfer_ms", "lower"},
+		{"timings.total_ms", "lower"},
+		{"dial.connect_ms", "lower"},
+	},
+	TEST_TYPE_HTTP: {
+		{"goodput_mbps", "higher"},
+		{"bytes", ""},
+		{"timings.dns_ms", "lower"},
+		{"timings.connect_ms", "lower"},
+		{"timings.tls_ms", "lower"},
+		{"timings.request_ms", "lower"},
+		{"timings.server_ms", "lower"},
+		{"timings.ttfb_ms", "lower"},
+		{"timings.transfer_ms", "lower"},
+		{"timings.total_ms", "lower"},
+	},
+	TEST_TYPE_S3: {
+		{"upload.throughput_mbps", "higher"},
+		{"download.throughput_mbps", "higher"},
+		{"upload.latency_ms.p50", "lower"},
+		{"upload.latency_ms.p95", "lower"},
+		{"download.latency_ms.p50", "lower"},
+		{"download.latency_ms.p95", "lower"},
+		{"requests.create_ms", "lower"},
+		{"requests.complete_ms", "lower"},
+		{"dial.connect_ms", "lower"},
+	},
+	TEST_TYPE_SSH: {
+		{"goodput_mbps", "higher"},
+		{"bytes", ""},
+		{"timings.dial_ms", "lower"},
+		{"timings.kex_ms", "lower"},
+		{"timings.auth_ms", "lower"},
+		{"timings.setup_ms", "lower"},
+		{"timings.channel_ms", "lower"},
+		{"timings.transfer_ms", "lower"},
+		{"timings.total_ms", "lower"},
+		{"ssh.rekeys", ""},
+		{"dial.connect_ms", "lower"},
+	},
+	TEST_TYPE_PMTU: {
+		{"largest_passing", "higher"},
+		{"reported_mtu", ""},
+		{"mss_mtu", ""},
+		{"dial.connect_ms", "lower"},
+	},
+	TEST_TYPE_STUN: {
+		{"rtt_ms", "lower"},
+	},
+	TEST_TYPE_NAT64: {
+		{"nat64_connect_ms", "lower"},
+		{"ipv4_connect_ms", "lower"},
+		{"dns64_lookup_ms", "lower"},
+		{"dial.connect_ms", "lower"},
+	},
+	TEST_TYPE_PING: {
+		{"rtt_avg_ms", "lower"},
+		{"rtt_min_ms", "lower"},
+		{"rtt_max_ms", "lower"},
+		{"rtt_stddev_ms", "lower"},
+		{"percentiles_ms.rtt.p50", "lower"},
+		{"percentiles_ms.rtt.p95", "lower"},
+		{"percentiles_ms.rtt.p99", "lower"},
+		{"percentiles_ms.rtt.p99_9", "lower"},
+		{"loss_percent", "lower"},
+	},
+	TEST_TYPE_TRACEROUTE: {
+		{"hop_count", ""},
+		{"rtt_avg_ms", "lower"},
+	},
+	TEST_TYPE_OWAMP: {
+		{"delay_avg_ms", "lower"},
+		{"delay_min_ms", "lower"},
+		{"delay_max_ms", "lower"},
+		{"percentiles_ms.p95", "lower"},
+		{"percentiles_ms.p99", "lower"},
+		{"jitter_ms", "lower"},
+		{"loss_percent", "lower"},
+		{"reordered_percent", "lower"},
+	},
+	TEST_TYPE_TLS: {
+		{"timings.handshake_ms", "lower"},
+		{"timings.connect_ms", "lower"},
+		{"timings.dns_ms", "lower"},
+		{"timings.total_ms", "lower"},
+		{"tls.days_to_expiry", ""},
+	},
+	TEST_TYPE_NDT7: {
+		{"download.throughput_mbps", "higher"},
+		{"upload.throughput_mbps", "higher"},
+		{"download.min_rtt_ms", "lower"},
+		{"upload.min_rtt_ms", "lower"},
+		{"download.retransmit_percent", "lower"},
+	},
+	TEST_TYPE_BUFFERBLOAT: {
+		{"latency_increase_ms", "lower"},
+		{"idle.rtt_avg_ms", "lower"},
+		{"download.latency.rtt_avg_ms", "lower"},
+		{"upload.latency.rtt_avg_ms", "lower"},
+		{"download.throughput_mbps", "higher"},
+		{"upload.throughput_mbps", "higher"},
+	},
+	TEST_TYPE_RPM: {
+		{"rpm", "higher"},
+		{"self.http_ms", "lower"},
+		{"foreign.http_ms", "lower"},
+		{"download.throughput_mbps", "higher"},
+		{"upload.throughput_mbps", "higher"},
+	},
+	TEST_TYPE_TCP_CONNECT: {
+		{"reachable_percent", "higher"},
+		{"reachable", "higher"},
+	},
+}
+
+// metricValue looks up a numeric field by dotted path
+func metricValue(data map[string]interface{}, path string) (float64, bool) {
+	var v interface{} = data
+	for _, key := range strings.Split(path, ".") {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return 0, false
+		}
+		if v, ok = m[key]; !ok {
+			return 0, false
+		}
+	}
+	f, ok := v.(float64)
+	return f, ok
+}
+
+// MetricDiff compares one metric between two results
+type MetricDiff struct {
+	Metric           string   `json:"metric"`
+	Better           string   `json:"better,omitempty"`
+	Base             *float64 `json:"base"`
+	Compare          *float64 `json:"compare"`
+	Delta            *float64 `json:"delta,omitempty"`
+	DeltaPercent     *float64 `json:"delta_percent,omitempty"` // Omitted when the base value is 0
+	Change           string   `json:"change"`                  // improved, regressed, changed, unchanged or missing
+	ExceedsThreshold bool     `json:"exceeds_threshold"`
+}
+
+// ResultDiffSummary counts highlighted metrics
+type ResultDiffSummary struct {
+	Regressions  int `json:"regressions"`  // Regressed beyond the threshold
+	Improvements int `json:"improvements"` // Improved beyond the threshold
+	Changed      int `json:"changed"`      // Beyond the threshold without a better direction
+}
+
+// ResultDiff is the structured comparison of two stored results
+type ResultDiff struct {
+	Base             ResultRef         `json:"base"`
+	Compare          ResultRef         `json:"compare"`
+	ThresholdPercent float64           `json:"threshold_percent"`
+	Metrics          []MetricDiff      `json:"metrics"`
+	Summary          ResultDiffSummary `json:"summary"`
+}
+
+// diffMetric classifies the change of a single metric from base to compare
+func diffMetric(m resultMetric, base, compare float64, thresholdPercent float64) MetricDiff {
+	d := MetricDiff{Metric: m.Path, Better: m.Better, Base: &base, Compare: &compare}
+	delta := compare - base
+	d.Delta = &delta
+
+	if base != 0 {
+		pct := delta / math.Abs(base) * 100
+		d.DeltaPercent = &pct
+		d.ExceedsThreshold = math.Abs(pct) >= thresholdPercent
+	} else {
+		d.ExceedsThreshold = delta != 0
+	}
+
+	switch {
+	case delta == 0:
+		d.Change = "unchanged"
+	case m.Better == "":
+		d.Change = "changed"
+	case (delta > 0) == (m.Better == "higher"):
+		d.Change = "improved"
+	default:
+		d.Change = "regressed"
+	}
+	return d
+}
+
+// diffResults compares every known metric of two results of the same type
+func diffResults(base, compare *StoredResult, thresholdPercent float64) *ResultDiff {
+	diff := &ResultDiff{Base: base.Ref(), Compare: compare.Ref(), ThresholdPercent: thresholdPercent, Metrics: []MetricDiff{}}
+
+	for _, m := range resultMetrics[base.Type] {
+		bv, bok := metricValue(base.Data, m.Path)
+		cv, cok := metricValue(compare.Data, m.Path)
+		switch {
+		case !bok && !cok:
+			continue
+		case !bok || !cok:
+			d := MetricDiff{Metric: m.Path, Better: m.Better, Change: "missing"}
+			if bok {
+				d.Base = &bv
+			} else {
+				d.Compare = &cv
+			}
+			diff.Metrics = append(diff.Metrics, d)
+			continue
+		}
+
+		d := diffMetric(m, bv, cv, thresholdPercent)
+		if d.ExceedsThreshold {
+			switch d.Change {
+			case "regressed":
+				diff.Summary.Regressions++
+			case "improved":
+				diff.Summary.Improvements++
+			case "changed":
+				diff.Summary.Changed++
+			}
+		}
+		diff.Metrics = append(diff.Metrics, d)
+	}
+	return diff
+}
+
+func resultDiff(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	threshold := DEFAULT_DIFF_THRESHOLD
+	if s := r.URL.Query().Get("threshold"); s != "" {
+		t, err := strconv.ParseFloat(s, 64)
+		if err != nil || t < 0 {
+			jsonResponse(w, ApiResponse{
+				Status: "error",
+				Error:  fmt.Sprintf("invalid threshold %q (expected a non-negative percentage)", s),
+			}, http.StatusBadRequest)
+			return
+		}
+		threshold = t
+	}
+
+	base, ok := lookupResult(w, vars["id1"])
+	if !ok {
+		return
+	}
+	compare, ok := lookupResult(w, vars["id2"])
+	if !ok {
+		return
+	}
+	if base.Type != compare.Type {
+		jsonResponse(w, ApiResponse{
+			Status: "error",
+			Error:  fmt.Sprintf("cannot diff %s result %s against %s result %s", base.Type, base.ID, compare.Type, compare.ID),
+		}, http.StatusBadRequest)
+		return
+	}
+
+	jsonResponse(w, ApiResponse{
+		Status: "ok",
+		Data:   diffResults(base, compare, threshold),
+	}, http.StatusOK)
+}
@@ -0,0 +1,368 @@
+package api
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CSV and JUnit output: test runs, GET /results and GET /results/{id} answer
+// in the format of ?output, or else the first of the Accept header's media
+// types they can write, JSON by default. CSV has a row per result for
+// spreadsheets; JUnit XML a test case per result, so CI systems report
+// network tests along with their own, failed ones included.
+const (
+	OUTPUT_JSON  = "json"
+	OUTPUT_CSV   = "csv"
+	OUTPUT_JUNIT = "junit"
+
+	CSV_CONTENT_TYPE   = "text/csv; charset=utf-8"
+	JUNIT_CONTENT_TYPE = "application/xml; charset=utf-8"
+
+	JUNIT_SUITES_NAME = "network-test-api"
+	JUNIT_TIME_FORMAT = "2006-01-02T15:04:05" // ISO 8601 without a zone, as the JUnit schema has it
+)
+
+// outputMediaTypes are the Accept media types of each output
+var outputMediaTypes = map[string]string{
+	"application/json":      OUTPUT_JSON,
+	"text/csv":              OUTPUT_CSV,
+	"application/junit+xml": OUTPUT_JUNIT,
+	"application/xml":       OUTPUT_JUNIT,
+	"text/xml":              OUTPUT_JUNIT,
+}
+
+// resultOutput picks the output of a response: ?output, or the first media
+// type of Accept that has one, or JSON
+func resultOutput(r *http.Request) (string, error) {
+	if v := r.URL.Query().Get("output"); v != "" {
+		switch output := strings.ToLower(v); output {
+		case OUTPUT_JSON, OUTPUT_CSV, OUTPUT_JUNIT:
+			return output, nil
+		}
+		return "", fmt.Errorf("invalid output %q (expected %s, %s or %s)", v, OUTPUT_JSON, OUTPUT_CSV, OUTPUT_JUNIT)
+	}
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, _ := strings.Cut(part, ";")
+		if output, ok := outputMediaTypes[strings.ToLower(strings.TrimSpace(mediaType))]; ok {
+			return output, nil
+		}
+	}
+	return OUTPUT_JSON, nil
+}
+
+// exportCase is one test as a CSV row and a JUnit test case
+type exportCase struct {
+	Type        string
+	Name        string // Target, or source -> destination of an agent mesh pair
+	ResultID    string
+	StartedAt   time.Time // Zero when unknown
+	DurationSec float64
+	Metrics     []exportMetric
+	Code        string
+	Error       string // The test failed when set
+	HTTPStatus  int
+}
+
+type exportMetric struct {
+	Path  string
+	Value float64
+}
+
+// storedCase is the case of a stored result, its metrics in the order of its type
+func storedCase(r *StoredResult) exportCase {
+	c := exportCase{
+		Type:        r.Type,
+		Name:        r.Target,
+		ResultID:    r.ID,
+		StartedAt:   r.StartedAt,
+		DurationSec: r.CreatedAt.Sub(r.StartedAt).Seconds(),
+	}
+	for _, m := range resultMetrics[r.Type] {
+		if v, ok := metricValue(r.Data, m.Path); ok {
+			c.Metrics = append(c.Metrics, exportMetric{m.Path, v})
+		}
+	}
+	return c
+}
+
+// rowCase is the case of a mesh row, from its stored result when this agent has it
+func rowCase(testType, name, resultID string, metrics map[string]float64, durationSec float64, errMsg, code string, status int) exportCase {
+	c := exportCase{Type: testType, Name: name, ResultID: resultID}
+	if stored, ok := resultStore.Get(resultID); ok {
+		c = storedCase(stored)
+		c.Name = name
+	} else {
+		found := make(map[string]bool, len(metrics))
+		for path := range metrics {
+			found[path] = true
+		}
+		for _, path := range meshColumns(testType, found) {
+			c.Metrics = append(c.Metrics, exportMetric{path, metrics[path]})
+		}
+	}
+	c.DurationSec = durationSec
+	c.Error, c.Code, c.HTTPStatus = errMsg, code, status
+	return c
+}
+
+// runCases are the cases of a test run's outcome: one per row of a mesh
+// run, or the test's own
+func runCases(testType, name string, data map[string]interface{}, status int, err error) []exportCase {
+	if err != nil {
+		if name == "" {
+			name = testType // A mesh run refused before it had targets
+		}
+		return []exportCase{{Type: testType, Name: name, Error: err.Error(), Code: errorCode(err), HTTPStatus: status}}
+	}
+	meshType, _ := data["type"].(string)
+	switch rows := data["results"].(type) {
+	case []*MeshResult:
+		cases := make([]exportCase, 0, len(rows))
+		for _, r := range rows {
+			cases = append(cases, rowCase(meshType, r.Target, r.ResultID, r.Metrics, r.DurationSec, r.Error, r.Code, r.HTTPStatus))
+		}
+		return cases
+	case []*PeerMeshResult:
+		cases := make([]exportCase, 0, len(rows))
+		for _, r := range rows {
+			cases = append(cases, rowCase(meshType, r.Source+" -> "+r.Destination, r.ResultID, r.Metrics, r.DurationSec, r.Error, r.Code, r.HTTPStatus))
+		}
+		return cases
+	}
+	id, _ := data["id"].(string)
+	if stored, ok := resultStore.Get(id); ok {
+		return []exportCase{storedCase(stored)}
+	}
+	// Not stored: the metrics of the data as it would have been
+	var normalized map[string]interface{}
+	if raw, err := json.Marshal(data); err == nil {
+		_ = json.Unmarshal(raw, &normalized)
+	}
+	now := time.Now().UTC()
+	return []exportCase{storedCase(&StoredResult{Type: testType, Target: name, StartedAt: now, CreatedAt: now, Data: normalized})}
+}
+
+// writeExport writes cases as CSV or JUnit XML with status
+func writeExport(w http.ResponseWriter, output string, status int, cases []exportCase) {
+	if output == OUTPUT_CSV {
+		w.Header().Set("Content-Type", CSV_CONTENT_TYPE)
+		w.WriteHeader(status)
+		_ = writeCSV(w, cases)
+		return
+	}
+	w.Header().Set("Content-Type", JUNIT_CONTENT_TYPE)
+	w.WriteHeader(status)
+	_ = writeJUnit(w, cases)
+}
+
+// writeRunResponse reports the outcome of a test run in output
+func writeRunResponse(w http.ResponseWriter, output, testType, name string, data map[string]interface{}, status int, err error) {
+	if output == OUTPUT_JSON {
+		writeTestResponse(w, data, status, err)
+		return
+	}
+	writeExport(w, output, status, runCases(testType, name, data, status, err))
+}
+
+// csvFloat formats a metric for a spreadsheet, without exponents
+func csvFloat(v float64) string {
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// writeCSV writes a header and a row per case. The metric columns are those
+// any case has, in the order of the first that has each.
+func writeCSV(w io.Writer, cases []exportCase) error {
+	var columns []string
+	column := make(map[string]int)
+	for _, c := range cases {
+		for _, m := range c.Metrics {
+			if _, ok := column[m.Path]; !ok {
+				column[m.Path] = len(columns)
+				columns = append(columns, m.Path)
+			}
+		}
+	}
+
+	cw := csv.NewWriter(w)
+	header := append([]string{"result_id", "type", "target", "started_at", "duration_sec", "status", "code", "error"}, columns...)
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+	for _, c := range cases {
+		row := make([]string, len(header))
+		row[0], row[1], row[2] = c.ResultID, c.Type, c.Name
+		if !c.StartedAt.IsZero() {
+			row[3] = c.StartedAt.UTC().Format(time.RFC3339)
+		}
+		row[4] = csvFloat(c.DurationSec)
+		row[5] = MESH_STATUS_OK
+		if c.Error != "" {
+			row[5], row[6], row[7] = MESH_STATUS_ERROR, c.Code, c.Error
+		}
+		for _, m := range c.Metrics {
+			row[8+column[m.Path]] = csvFloat(m.Value)
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// JUnit XML in the shape Jenkins, GitLab, GitHub Actions reporters and
+// other CI systems read
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Errors   int              `xml:"errors,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Errors    int             `xml:"errors,attr"`
+	Time      string          `xml:"time,attr"`
+	Timestamp string          `xml:"timestamp,attr,omitempty"`
+	Hostname  string          `xml:"hostname,attr,omitempty"`
+	Cases     []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name       string           `xml:"name,attr"`
+	Classname  string           `xml:"classname,attr"`
+	Time       string           `xml:"time,attr"`
+	Properties *junitProperties `xml:"properties,omitempty"`
+	Failure    *junitProblem    `xml:"failure,omitempty"`
+	Error      *junitProblem    `xml:"error,omitempty"`
+	SystemOut  string           `xml:"system-out,omitempty"`
+}
+
+type junitProperties struct {
+	Properties []junitProperty `xml:"property"`
+}
+
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type junitProblem struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// junitErrorCodes are the codes of tests that did not get to run, errors
+// rather than failures of the test case, as are 4xx errors without a code
+var junitErrorCodes = map[string]bool{
+	ERR_VALIDATION:     true,
+	ERR_BUSY:           true,
+	ERR_RATE_LIMITED:   true,
+	ERR_QUOTA_EXCEEDED: true,
+	ERR_SHUTTING_DOWN:  true,
+	ERR_CANCELED:       true,
+}
+
+func junitSeconds(sec float64) string {
+	return strconv.FormatFloat(sec, 'f', 3, 64)
+}
+
+// junitCase is the test case of c, its metrics its properties and its output
+func junitCase(c exportCase) junitTestCase {
+	tc := junitTestCase{Name: c.Name, Classname: c.Type, Time: junitSeconds(c.DurationSec)}
+	var props []junitProperty
+	if c.ResultID != "" {
+		props = append(props, junitProperty{"result_id", c.ResultID})
+	}
+	for _, m := range c.Metrics {
+		props = append(props, junitProperty{m.Path, csvFloat(m.Value)})
+	}
+	if len(props) > 0 {
+		// As properties for the reporters that read them, and as output for those that show it
+		tc.Properties = &junitProperties{props}
+		var out strings.Builder
+		for _, p := range props {
+			fmt.Fprintf(&out, "%s=%s\n", p.Name, p.Value)
+		}
+		tc.SystemOut = out.String()
+	}
+	if c.Error != "" {
+		problem := &junitProblem{Message: c.Error, Type: c.Code, Text: c.Error}
+		if problem.Type == "" {
+			problem.Type = strconv.Itoa(c.HTTPStatus)
+		}
+		if junitErrorCodes[c.Code] || (c.Code == "" && c.HTTPStatus >= 400 && c.HTTPStatus < 500) {
+			tc.Error = problem
+		} else {
+			tc.Failure = problem
+		}
+	}
+	return tc
+}
+
+// writeJUnit writes a test suite per test type, in the order of their first case
+func writeJUnit(w io.Writer, cases []exportCase) error {
+	doc := junitTestSuites{Name: JUNIT_SUITES_NAME}
+	index := make(map[string]int)
+	started := make(map[string]time.Time)
+	var total float64
+	suiteTime := make(map[string]float64)
+	for _, c := range cases {
+		i, ok := index[c.Type]
+		if !ok {
+			i = len(doc.Suites)
+			index[c.Type] = i
+			doc.Suites = append(doc.Suites, junitTestSuite{Name: c.Type, Hostname: agentID})
+		}
+		s := &doc.Suites[i]
+		tc := junitCase(c)
+		s.Cases = append(s.Cases, tc)
+		s.Tests++
+		switch {
+		case tc.Failure != nil:
+			s.Failures++
+		case tc.Error != nil:
+			s.Errors++
+		}
+		suiteTime[c.Type] += c.DurationSec
+		total += c.DurationSec
+		if t := started[c.Type]; !c.StartedAt.IsZero() && (t.IsZero() || c.StartedAt.Before(t)) {
+			started[c.Type] = c.StartedAt
+		}
+	}
+	for i := range doc.Suites {
+		s := &doc.Suites[i]
+		s.Time = junitSeconds(suiteTime[s.Name])
+		if t := started[s.Name]; !t.IsZero() {
+			s.Timestamp = t.UTC().Format(JUNIT_TIME_FORMAT)
+		}
+		doc.Tests += s.Tests
+		doc.Failures += s.Failures
+		doc.Errors += s.Errors
+	}
+	doc.Time = junitSeconds(total)
+
+	if _, err := fmt.Fprint(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintln(w)
+	return err
+}
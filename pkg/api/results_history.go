@@ -0,0 +1,271 @@
+package api
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// Result history: with RESULTS_FILE, every stored result is appended to a
+// JSON Lines file and reloaded from it at startup, so trends survive restarts.
+// RESULTS_MAX sets how many results are kept in memory and on disk.
+const (
+	DEFAULT_RESULT_LIST_LIMIT = 100
+	MAX_RESULT_LIST_LIMIT     = 1000
+)
+
+// resultFile is the append-only file of a ResultStore. It holds the live
+// results plus those evicted since the last compaction.
+type resultFile struct {
+	path  string
+	f     *os.File
+	lines int
+}
+
+// openResultFile loads the results in path into s, creating the file if needed
+func openResultFile(s *ResultStore, path string) error {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	rf := &resultFile{path: path, f: f}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 64<<20) // Results with long time series
+	skipped := 0
+	for scanner.Scan() {
+		rf.lines++
+		var stored StoredResult
+		if err := json.Unmarshal(scanner.Bytes(), &stored); err != nil || stored.ID == "" {
+			skipped++ // A line cut short when the agent died mid-write
+			continue
+		}
+		s.insert(&stored)
+	}
+	if err := scanner.Err(); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("read %s: %v", path, err)
+	}
+	if skipped > 0 {
+		warnf(nil, "Skipped %d unreadable lines of %s", skipped, path)
+	}
+	s.file = rf
+	if rf.lines > len(s.order) {
+		if err := s.compact(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// persist appends a new result to the file, compacting it once as many
+// evicted results as live ones have built up; the caller holds s.mu. Write
+// errors are logged: the result is still kept in memory.
+func (s *ResultStore) persist(stored *StoredResult) {
+	line, err := json.Marshal(stored)
+	if err == nil {
+		_, err = s.file.f.Write(append(line, '\n'))
+	}
+	if err != nil {
+		errorf(nil, "Persisting result %s to %s failed: %v", stored.ID, s.file.path, err)
+		return
+	}
+	s.file.lines++
+	if path := s.file.path; s.file.lines-len(s.order) >= s.max {
+		if err := s.compact(); err != nil {
+			errorf(nil, "Compacting %s failed: %v", path, err)
+		}
+	}
+}
+
+// compact rewrites the file with only the live results and swaps it in; the
+// caller holds s.mu. Persisting stops if the file cannot be reopened.
+func (s *ResultStore) compact() error {
+	tmp, err := os.CreateTemp(filepath.Dir(s.file.path), filepath.Base(s.file.path)+".*")
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(tmp)
+	enc := json.NewEncoder(w)
+	for _, id := range s.order {
+		if err = enc.Encode(s.byID[id]); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+
+	// Closed first, as Windows cannot replace an open file
+	_ = s.file.f.Close()
+	renameErr := os.Rename(tmp.Name(), s.file.path)
+	f, err := os.OpenFile(s.file.path, os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		s.file = nil
+		return fmt.Errorf("%v; results are no longer persisted", err)
+	}
+	s.file.f = f
+	if renameErr != nil {
+		_ = os.Remove(tmp.Name())
+		return renameErr
+	}
+	s.file.lines = len(s.order)
+	return nil
+}
+
+// configureResultHistory reads RESULTS_MAX and loads RESULTS_FILE, if set
+func configureResultHistory() {
+	if v := os.Getenv("RESULTS_MAX"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			log.Fatalf("Invalid RESULTS_MAX %q (expected a positive integer)", v)
+		}
+		resultStore = NewResultStore(n)
+	}
+	path := os.Getenv("RESULTS_FILE")
+	if path == "" {
+		return
+	}
+	if err := openResultFile(resultStore, path); err != nil {
+		log.Fatalf("Loading results failed: %v", err)
+	}
+	log.Printf("Loaded %d results from %s", len(resultStore.order), path)
+}
+
+// requestParams returns the fields req sets, JSON round-tripped like result data
+func requestParams(req RunRequest) map[string]interface{} {
+	raw, err := json.Marshal(req)
+	if err != nil {
+		return nil
+	}
+	var params map[string]interface{}
+	if err := json.Unmarshal(raw, &params); err != nil {
+		return nil
+	}
+	for name, v := range params {
+		switch v := v.(type) {
+		case nil:
+			delete(params, name)
+		case bool:
+			if !v {
+				delete(params, name)
+			}
+		case float64:
+			if v == 0 {
+				delete(params, name)
+			}
+		case string:
+			if v == "" {
+				delete(params, name)
+			}
+		case []interface{}:
+			if len(v) == 0 {
+				delete(params, name)
+			}
+		case map[string]interface{}:
+			if len(v) == 0 {
+				delete(params, name)
+			}
+		}
+	}
+	return params
+}
+
+// ResultSummary is a stored result as GET /results lists it: its parameters
+// and the metrics /results/aggregate and the diff compare, without the rest of its data
+type ResultSummary struct {
+	ResultRef
+	Params  map[string]interface{} `json:"params,omitempty"`
+	Metrics map[string]float64     `json:"metrics"`
+}
+
+// summarizeResult extracts the known metrics of a result
+func summarizeResult(r *StoredResult) *ResultSummary {
+	summary := &ResultSummary{ResultRef: r.Ref(), Params: r.Params, Metrics: make(map[string]float64)}
+	for _, m := range resultMetrics[r.Type] {
+		if v, ok := metricValue(r.Data, m.Path); ok {
+			summary.Metrics[m.Path] = v
+		}
+	}
+	return summary
+}
+
+// parseTimeParam reads an RFC 3339 query parameter, zero when unset
+func parseTimeParam(name, value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid %s %q (expected an RFC 3339 time such as 2026-01-15T10:30:00Z)", name, value)
+	}
+	return t, nil
+}
+
+func resultList(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	target := q.Get("target")
+	testType := q.Get("type")
+
+	from, err := parseTimeParam("from", q.Get("from"))
+	var until time.Time
+	if err == nil {
+		until, err = parseTimeParam("to", q.Get("to"))
+	}
+	if _, ok := lookupRunner(testType); err == nil && testType != "" && !ok {
+		err = invalidTestType(testType)
+	}
+	limit := DEFAULT_RESULT_LIST_LIMIT
+	if v := q.Get("limit"); v != "" && err == nil {
+		n, convErr := strconv.Atoi(v)
+		if convErr != nil || n < 1 || n > MAX_RESULT_LIST_LIMIT {
+			err = fmt.Errorf("limit must be between 1 and %d", MAX_RESULT_LIST_LIMIT)
+		}
+		limit = n
+	}
+	output := OUTPUT_JSON
+	if err == nil {
+		output, err = resultOutput(r)
+	}
+	if err != nil {
+		jsonResponse(w, ApiResponse{
+			Status: "error",
+			Error:  err.Error(),
+		}, http.StatusBadRequest)
+		return
+	}
+
+	results := resultStore.Query(target, testType, from, until)
+	total := len(results)
+	if output != OUTPUT_JSON {
+		cases := make([]exportCase, 0, limit)
+		for i := len(results) - 1; i >= 0 && len(cases) < limit; i-- {
+			cases = append(cases, storedCase(results[i]))
+		}
+		writeExport(w, output, http.StatusOK, cases)
+		return
+	}
+	summaries := make([]*ResultSummary, 0, limit)
+	for i := len(results) - 1; i >= 0 && len(summaries) < limit; i-- {
+		summaries = append(summaries, summarizeResult(results[i]))
+	}
+	jsonResponse(w, ApiResponse{
+		Status: "ok",
+		Data: map[string]interface{}{
+			"total":   total,
+			"results": summaries,
+		},
+	}, http.StatusOK)
+}
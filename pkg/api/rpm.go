@@ -0,0 +1,689 @@
+package api
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"network-test-api/pkg/nettest"
+)
+
+// RPM tests (responsiveness under working conditions, the IETF IPPM method
+// networkQuality implements): HTTP/2 load-generating connections saturate the
+// link, more of them added each second until the goodput stops growing. Under
+// that load, foreign probes time the TCP connect, TLS handshake and a small GET
+// on fresh connections and self probes a small GET on the loaded ones. The
+// round trips per minute their trimmed means give are the RPM score.
+const (
+	DEFAULT_RPM_CONFIG_URL = "https://mensura.cdn-apple.com/api/v1/gm/config"
+
+	DEFAULT_RPM_DURATION = 20 // Seconds of load, saturation included
+	MIN_RPM_DURATION     = 5
+	MAX_RPM_DURATION     = 60
+	DEFAULT_RPM_PARALLEL = 1 // Load-generating connections per direction to start with
+	MAX_RPM_CONNECTIONS  = 16
+	RPM_ADD_CONNECTIONS  = 4   // Added per direction each step the goodput still grew
+	DEFAULT_RPM_INTERVAL = 0.1 // Seconds between probes, foreign and self each
+	MAX_RPM_INTERVAL     = 1
+
+	RPM_STEP           = time.Second // Between goodput checks
+	RPM_MOVING_AVERAGE = 4           // Steps the goodput moving average covers
+	RPM_STABLE_PERCENT = 5           // Growth of the moving average below which the goodput is saturated
+	RPM_TRIM_PERCENT   = 95          // Trimmed means keep the fastest 95% of round trips
+	RPM_PROBE_WAIT     = 2 * time.Second
+	RPM_PROBE_TIMEOUT  = 10 * time.Second
+	RPM_DIAL_TIMEOUT   = 10 * time.Second
+	RPM_CONFIG_TIMEOUT = 10 * time.Second
+)
+
+// rpmConfigURL is the networkQuality configuration of requests without url
+var rpmConfigURL = DEFAULT_RPM_CONFIG_URL
+
+// configureRPM reads RPM_CONFIG_URL, if set
+func configureRPM() {
+	v := os.Getenv("RPM_CONFIG_URL")
+	if v == "" {
+		return
+	}
+	if u, err := url.Parse(v); err != nil || u.Scheme != "https" || u.Host == "" {
+		log.Fatalf("Invalid RPM_CONFIG_URL %q (expected an https URL)", v)
+	}
+	rpmConfigURL = v
+	log.Printf("RPM tests default to the configuration at %s", rpmConfigURL)
+}
+
+// RPMConfig is the networkQuality configuration of a responsiveness server
+type RPMConfig struct {
+	Version      int    `json:"version,omitempty"`
+	TestEndpoint string `json:"test_endpoint,omitempty"` // Host to connect to instead of the hosts of the URLs
+	URLs         struct {
+		SmallDownload string `json:"small_https_download_url"`
+		LargeDownload string `json:"large_https_download_url"`
+		Upload        string `json:"https_upload_url"`
+	} `json:"urls"`
+}
+
+// RPMLoad is the load of one direction of an RPM test
+type RPMLoad struct {
+	ThroughputMbps float64 `json:"throughput_mbps"` // Under working conditions
+	Bytes          int64   `json:"bytes"`           // Received (download) or written (upload) under working conditions
+	Connections    int     `json:"connections"`
+}
+
+// RPMProbes are the probes of one kind that completed under working
+// conditions, as trimmed means in milliseconds
+type RPMProbes struct {
+	Probes int     `json:"probes"`
+	Failed int     `json:"failed"`
+	TCPMs  float64 `json:"tcp_ms,omitempty"` // Foreign probes only
+	TLSMs  float64 `json:"tls_ms,omitempty"` // Foreign probes only
+	HTTPMs float64 `json:"http_ms"`
+}
+
+// rpmProbe is the round trips of one completed probe in milliseconds
+type rpmProbe struct {
+	tcpMs, tlsMs, httpMs float64
+}
+
+// rpmTarget is where the connections of an RPM test go
+type rpmTarget struct {
+	small, large, upload *url.URL
+	endpoint             string // Dialed instead of the URL's host, if set
+	family               string
+	checker              *tlsChecker
+}
+
+// dial connects to the host of u, or the test endpoint
+func (t *rpmTarget) dial(ctx context.Context, u *url.URL) (net.Conn, *nettest.DialReport, error) {
+	host := u.Hostname()
+	if t.endpoint != "" {
+		host = t.endpoint
+	}
+	port, _ := strconv.Atoi(u.Port())
+	if port == 0 {
+		port = 443
+	}
+	return nettest.DialControlFrom(ctx, host, port, t.family, RPM_DIAL_TIMEOUT, nil)
+}
+
+// transport is an HTTP/2 transport that keeps to one connection
+func (t *rpmTarget) transport(u *url.URL, dialed func(*nettest.DialReport)) *http.Transport {
+	return &http.Transport{
+		Proxy: nil, // Measure the path to the server itself
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			conn, dial, err := t.dial(ctx, u)
+			if dialed != nil {
+				dialed(dial)
+			}
+			return conn, err
+		},
+		TLSClientConfig:    t.checker.config(u.Hostname()),
+		ForceAttemptHTTP2:  true,
+		MaxConnsPerHost:    1,
+		DisableCompression: true, // Count the bytes on the wire
+	}
+}
+
+// rpmConn is a load-generating connection
+type rpmConn struct {
+	client    *http.Client
+	transport *http.Transport
+	dial      *nettest.DialReport
+}
+
+// rpmLoadGen runs the load-generating connections of one direction
+type rpmLoadGen struct {
+	direction string
+	target    *rpmTarget
+	bytes     atomic.Int64
+
+	mu    sync.Mutex
+	conns []*rpmConn
+	wg    sync.WaitGroup
+}
+
+// add opens a load-generating connection and returns once it is connected
+// over HTTP/2 or failed, leaving its transfers running until ctx ends
+func (g *rpmLoadGen) add(ctx context.Context) error {
+	u := g.target.large
+	if g.direction == TRANSFER_UPLOAD {
+		u = g.target.upload
+	}
+	c := &rpmConn{}
+	c.transport = g.target.transport(u, func(dial *nettest.DialReport) { c.dial = dial })
+	c.client = &http.Client{Transport: c.transport}
+	connCtx, cancel := context.WithCancel(ctx)
+	connected := make(chan error, 1)
+	var once sync.Once
+	report := func(err error) { once.Do(func() { connected <- err }) }
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			if tlsConn, ok := info.Conn.(*tls.Conn); !ok || tlsConn.ConnectionState().NegotiatedProtocol != "h2" {
+				report(fmt.Errorf("server did not negotiate HTTP/2, which the probes on loaded connections need"))
+				return
+			}
+			report(nil)
+		},
+	}
+
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		defer cancel()
+		defer c.transport.CloseIdleConnections()
+		for connCtx.Err() == nil {
+			if err := g.transfer(httptrace.WithClientTrace(connCtx, trace), c.client, u); err != nil {
+				report(err)
+				if connCtx.Err() == nil {
+					logf(ctx, "RPM test: %s connection ended: %v", g.direction, err)
+				}
+				return
+			}
+		}
+	}()
+	select {
+	case err := <-connected:
+		if err != nil {
+			cancel()
+			return err
+		}
+	case <-ctx.Done():
+		cancel()
+		return ctx.Err()
+	}
+	g.mu.Lock()
+	g.conns = append(g.conns, c)
+	g.mu.Unlock()
+	return nil
+}
+
+// transfer downloads the large file or uploads an endless body once
+func (g *rpmLoadGen) transfer(ctx context.Context, client *http.Client, u *url.URL) error {
+	method, body := http.MethodGet, io.Reader(nil)
+	if g.direction == TRANSFER_UPLOAD {
+		method, body = http.MethodPost, &countingReader{r: newPayloadReader(nettest.PayloadRandom, math.MaxInt64), n: &g.bytes}
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		httpReq.ContentLength = -1
+		httpReq.Header.Set("Content-Type", "application/octet-stream")
+	}
+	httpReq.Header.Set("User-Agent", "network-test-api/"+API_VERSION)
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("server returned %s", resp.Status)
+	}
+	if g.direction == TRANSFER_UPLOAD {
+		_, err = io.Copy(io.Discard, resp.Body)
+		return err
+	}
+	_, err = io.CopyBuffer(io.Discard, &countingReader{r: resp.Body, n: &g.bytes}, make([]byte, TRANSFER_BUFFER_SIZE))
+	return err
+}
+
+// count is the number of load-generating connections
+func (g *rpmLoadGen) count() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return len(g.conns)
+}
+
+// pick returns a random load-generating connection for a self probe
+func (g *rpmLoadGen) pick() *rpmConn {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.conns[rand.Intn(len(g.conns))]
+}
+
+// countingReader adds the bytes read through it to n
+type countingReader struct {
+	r io.Reader
+	n *atomic.Int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n.Add(int64(n))
+	return n, err
+}
+
+// rpmGet fetches u with client and returns the milliseconds from the request
+// to the end of the response
+func rpmGet(ctx context.Context, client *http.Client, u *url.URL) (float64, error) {
+	ctx, cancel := context.WithTimeout(ctx, RPM_PROBE_TIMEOUT)
+	defer cancel()
+	var start time.Time
+	trace := &httptrace.ClientTrace{GotConn: func(httptrace.GotConnInfo) { start = time.Now() }}
+	httpReq, err := http.NewRequestWithContext(httptrace.WithClientTrace(ctx, trace), http.MethodGet, u.String(), nil)
+	if err != nil {
+		return 0, err
+	}
+	httpReq.Header.Set("User-Agent", "network-test-api/"+API_VERSION)
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return 0, fmt.Errorf("server returned %s", resp.Status)
+	}
+	if _, err := io.Copy(io.Discard, resp.Body); err != nil {
+		return 0, err
+	}
+	return sinceMs(start, time.Now()), nil
+}
+
+// foreignProbe times the TCP connect, TLS handshake and a small GET on a
+// fresh connection
+func (t *rpmTarget) foreignProbe(ctx context.Context) (rpmProbe, error) {
+	var p rpmProbe
+	var dial *nettest.DialReport
+	var tlsStart, tlsDone time.Time
+	transport := t.transport(t.small, func(d *nettest.DialReport) { dial = d })
+	transport.DisableKeepAlives = true
+	defer transport.CloseIdleConnections()
+	ctx = httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		TLSHandshakeStart: func() { tlsStart = time.Now() },
+		TLSHandshakeDone:  func(tls.ConnectionState, error) { tlsDone = time.Now() },
+	})
+	httpMs, err := rpmGet(ctx, &http.Client{Transport: transport}, t.small)
+	if err != nil {
+		return p, err
+	}
+	if dial == nil || tlsStart.IsZero() {
+		return p, errors.New("probe reused a connection")
+	}
+	p.tcpMs, p.tlsMs, p.httpMs = dial.ConnectMs, sinceMs(tlsStart, tlsDone), httpMs
+	return p, nil
+}
+
+// rpmTrimmedMean is the mean of the fastest RPM_TRIM_PERCENT of values
+func rpmTrimmedMean(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	keep := int(math.Ceil(float64(len(sorted)) * RPM_TRIM_PERCENT / 100))
+	sum := 0.0
+	for _, v := range sorted[:keep] {
+		sum += v
+	}
+	return sum / float64(keep)
+}
+
+// rpmScore is the round trips per minute of the trimmed means: the foreign
+// probes' TCP, TLS and HTTP round trips weigh one sixth each, the self
+// probes' HTTP round trip one half
+func rpmScore(foreign, self RPMProbes) float64 {
+	ms := (foreign.TCPMs+foreign.TLSMs+foreign.HTTPMs)/6 + self.HTTPMs/2
+	if ms <= 0 {
+		return 0
+	}
+	return 60000 / ms
+}
+
+// rpmSaturated reports whether the moving average of the goodputs, one per
+// step, grew less than RPM_STABLE_PERCENT over the one a step earlier
+func rpmSaturated(goodputs []float64) bool {
+	n := len(goodputs)
+	if n <= RPM_MOVING_AVERAGE {
+		return false
+	}
+	average := func(v []float64) float64 {
+		sum := 0.0
+		for _, x := range v {
+			sum += x
+		}
+		return sum / float64(len(v))
+	}
+	now := average(goodputs[n-RPM_MOVING_AVERAGE:])
+	before := average(goodputs[n-RPM_MOVING_AVERAGE-1 : n-1])
+	return before > 0 && now < before*(1+RPM_STABLE_PERCENT/100.0)
+}
+
+// validateRPM checks the direction and bounds of an RPM request
+func validateRPM(req *RunRequest) error {
+	switch req.Direction = strings.ToLower(req.Direction); req.Direction {
+	case "":
+		req.Direction = NDT7_DIRECTION_BOTH
+	case TRANSFER_DOWNLOAD, TRANSFER_UPLOAD, NDT7_DIRECTION_BOTH:
+	default:
+		return fmt.Errorf("invalid direction %q (expected download, upload or both)", req.Direction)
+	}
+	switch {
+	case req.Duration < MIN_RPM_DURATION || req.Duration > MAX_RPM_DURATION:
+		return fmt.Errorf("duration must be between %d and %d seconds", MIN_RPM_DURATION, MAX_RPM_DURATION)
+	case req.Parallel < 1 || req.Parallel > MAX_RPM_CONNECTIONS:
+		return fmt.Errorf("parallel must be between 1 and %d", MAX_RPM_CONNECTIONS)
+	case req.Interval < MIN_PING_INTERVAL || req.Interval > MAX_RPM_INTERVAL:
+		return fmt.Errorf("interval must be between %g and %d seconds", MIN_PING_INTERVAL, MAX_RPM_INTERVAL)
+	}
+	return validateRootStore(req)
+}
+
+// runRPM applies defaults to a decoded request, runs the RPM test and records the result.
+// Errors come with the HTTP status to report them with.
+func runRPM(req RunRequest, profile *Profile) (map[string]interface{}, int, error) {
+	if req.URL == "" {
+		req.URL = rpmConfigURL
+	}
+	if req.Duration == 0 {
+		req.Duration = DEFAULT_RPM_DURATION
+	}
+	if req.Parallel == 0 {
+		req.Parallel = DEFAULT_RPM_PARALLEL
+	}
+	if req.Interval == 0 {
+		req.Interval = DEFAULT_RPM_INTERVAL
+	}
+	if err := checkProfileLimits(req, profile); err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	configURL, err := url.Parse(req.URL)
+	if err != nil || configURL.Scheme != "https" || configURL.Hostname() == "" {
+		err = fmt.Errorf("url must be an https URL of a networkQuality configuration")
+	}
+	if err == nil {
+		err = validateRPM(&req)
+	}
+	if err == nil {
+		req.AddressFamily, err = parseAddressFamily(req.AddressFamily)
+	}
+	if err == nil && req.AddressFamily == nettest.FAMILY_COMPARE {
+		err = fmt.Errorf("address_family compare is not available for RPM tests; run ipv4 and ipv6 separately")
+	}
+	if err == nil {
+		err = validateLockWait(&req)
+	}
+	if err == nil {
+		err = validateCallbackURL(req.CallbackURL)
+	}
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	cancel := withTestTimeout(&req)
+	defer cancel()
+	ctx := req.runContext()
+	started := time.Now()
+	checker := newTLSChecker(req)
+	target, err := rpmFetchConfig(ctx, configURL, checker)
+	if err != nil {
+		return nil, http.StatusInternalServerError, twampError(ctx, "Reading the RPM configuration failed", err)
+	}
+	target.family = req.AddressFamily
+	req.ServerHost, req.ServerPort = target.large.Hostname(), 443
+	if target.endpoint != "" {
+		req.ServerHost = target.endpoint
+	}
+	if port, _ := strconv.Atoi(target.large.Port()); port != 0 {
+		req.ServerPort = port
+	}
+	// Held to the same target checks as a server_host given
+	v := &requestValidator{}
+	for _, host := range []string{req.ServerHost, target.small.Hostname(), target.upload.Hostname()} {
+		v.host("url", host, host)
+	}
+	if len(v.fields) > 0 {
+		return nil, http.StatusForbidden, fmt.Errorf("RPM server %s", v.fields[0].Message)
+	}
+
+	releaseSlot, status, err := acquireTestSlot(TEST_TYPE_RPM, req)
+	if err != nil {
+		return nil, status, err
+	}
+	defer releaseSlot()
+
+	lock, release, status, err := lockTest(TEST_TYPE_RPM, req, true)
+	if err != nil {
+		return nil, status, err
+	}
+	defer release()
+
+	logf(req.ctx, "RPM test: %s (server=%s:%d, direction=%s, %ds, %d connections to start, interval=%gs, family=%s)",
+		configURL.Redacted(), req.ServerHost, req.ServerPort, req.Direction, req.Duration, req.Parallel, req.Interval, req.AddressFamily)
+
+	result, err := rpmTest(ctx, req, target)
+	if err != nil {
+		return nil, http.StatusInternalServerError, twampError(ctx, "RPM test failed", err)
+	}
+	result["config_url"] = configURL.Redacted()
+	result["server"] = req.ServerHost
+	result["port"] = req.ServerPort
+	result["direction"] = req.Direction
+	result["duration_sec"] = time.Since(started).Seconds()
+	if report := checker.Report(); report != nil {
+		result["tls"] = report
+	}
+	if profile != nil {
+		result["profile"] = profile.Name
+	}
+	result["lock"] = lock
+
+	recordResult(TEST_TYPE_RPM, req, started, result)
+	notifyCallback(req.CallbackURL, result)
+
+	return result, http.StatusOK, nil
+}
+
+// rpmFetchConfig reads the networkQuality configuration at u
+func rpmFetchConfig(ctx context.Context, u *url.URL, checker *tlsChecker) (*rpmTarget, error) {
+	ctx, cancel := context.WithTimeout(ctx, RPM_CONFIG_TIMEOUT)
+	defer cancel()
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("User-Agent", "network-test-api/"+API_VERSION)
+	var bind *nettest.SourceBinding
+	client := &http.Client{Transport: &http.Transport{Proxy: nil, DialContext: bind.DialContext(RPM_DIAL_TIMEOUT),
+		TLSClientConfig: checker.config(u.Hostname()), ForceAttemptHTTP2: true}}
+	defer client.CloseIdleConnections()
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("server answered %s", resp.Status)
+	}
+	var config RPMConfig
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&config); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %v", err)
+	}
+	target := &rpmTarget{endpoint: config.TestEndpoint, checker: checker}
+	for _, u := range []struct {
+		name string
+		raw  string
+		dst  **url.URL
+	}{
+		{"small_https_download_url", config.URLs.SmallDownload, &target.small},
+		{"large_https_download_url", config.URLs.LargeDownload, &target.large},
+		{"https_upload_url", config.URLs.Upload, &target.upload},
+	} {
+		parsed, err := url.Parse(u.raw)
+		if err != nil || parsed.Scheme != "https" || parsed.Hostname() == "" {
+			return nil, fmt.Errorf("configuration has no https %s", u.name)
+		}
+		*u.dst = parsed
+	}
+	return target, nil
+}
+
+// rpmTest saturates the link and probes it once the goodput stopped growing,
+// or from half the duration on if it did not
+func rpmTest(ctx context.Context, req RunRequest, target *rpmTarget) (map[string]interface{}, error) {
+	loadCtx, stopLoad := context.WithCancel(ctx)
+	var gens []*rpmLoadGen
+	defer func() {
+		stopLoad()
+		for _, g := range gens {
+			g.wg.Wait()
+		}
+	}()
+	for _, direction := range ndt7Directions(req.Direction) {
+		g := &rpmLoadGen{direction: direction, target: target}
+		gens = append(gens, g)
+		for i := 0; i < req.Parallel; i++ {
+			if err := g.add(loadCtx); err != nil {
+				return nil, fmt.Errorf("%s connection failed: %v", direction, err)
+			}
+		}
+	}
+
+	req.progress.start("mbps", req.Duration)
+	start := time.Now()
+	end := start.Add(time.Duration(req.Duration) * time.Second)
+	var goodputs []float64
+	var working time.Time
+	workingBytes := make([]int64, len(gens))
+	var last int64
+	saturated := false
+	for {
+		select {
+		case <-time.After(RPM_STEP):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		var total int64
+		for _, g := range gens {
+			total += g.bytes.Load()
+		}
+		goodput := goodputMbps(total-last, RPM_STEP)
+		last = total
+		goodputs = append(goodputs, goodput)
+		req.progress.add(SeriesPoint{T: time.Since(start).Seconds(), Value: goodput})
+
+		saturated = rpmSaturated(goodputs)
+		if saturated || time.Since(start) >= time.Duration(req.Duration)*time.Second/2 {
+			working = time.Now()
+			for i, g := range gens {
+				workingBytes[i] = g.bytes.Load()
+			}
+			break
+		}
+		for _, g := range gens {
+			for i := 0; i < RPM_ADD_CONNECTIONS && g.count() < MAX_RPM_CONNECTIONS; i++ {
+				if err := g.add(loadCtx); err != nil {
+					warnf(ctx, "RPM test: adding a %s connection failed: %v", g.direction, err)
+					break
+				}
+			}
+		}
+	}
+
+	foreign, self := rpmProbeUnderLoad(ctx, req, target, gens, end)
+	elapsed := time.Since(working)
+	data := map[string]interface{}{
+		"saturated":         saturated,
+		"working_after_sec": working.Sub(start).Seconds(),
+		"foreign":           foreign,
+		"self":              self,
+	}
+	for i, g := range gens {
+		bytes := g.bytes.Load() - workingBytes[i]
+		data[g.direction] = &RPMLoad{
+			ThroughputMbps: goodputMbps(bytes, elapsed),
+			Bytes:          bytes,
+			Connections:    g.count(),
+		}
+	}
+	data["dial"] = gens[0].conns[0].dial
+	if foreign.Probes == 0 || self.Probes == 0 {
+		return nil, fmt.Errorf("no probe completed under load (%d foreign and %d self probes failed)", foreign.Failed, self.Failed)
+	}
+	data["rpm"] = math.Round(rpmScore(*foreign, *self))
+	return data, nil
+}
+
+// rpmProbeUnderLoad sends a foreign and a self probe every interval until end,
+// then waits up to RPM_PROBE_WAIT for the last of them
+func rpmProbeUnderLoad(ctx context.Context, req RunRequest, target *rpmTarget, gens []*rpmLoadGen, end time.Time) (*RPMProbes, *RPMProbes) {
+	probeCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	var foreignProbes []rpmProbe
+	var selfMs []float64
+	foreign, self := &RPMProbes{}, &RPMProbes{}
+
+	interval := time.Duration(req.Interval * float64(time.Second))
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for n := 0; time.Now().Before(end); n++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			p, err := target.foreignProbe(probeCtx)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				foreign.Failed++
+				return
+			}
+			foreignProbes = append(foreignProbes, p)
+		}()
+		conn := gens[n%len(gens)].pick()
+		go func() {
+			defer wg.Done()
+			ms, err := rpmGet(probeCtx, conn.client, target.small)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				self.Failed++
+				return
+			}
+			selfMs = append(selfMs, ms)
+		}()
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			end = time.Now()
+		}
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(RPM_PROBE_WAIT):
+		cancel() // Probes still out count as failed
+		<-done
+	}
+
+	var tcp, tlsMs, httpMs []float64
+	for _, p := range foreignProbes {
+		tcp, tlsMs, httpMs = append(tcp, p.tcpMs), append(tlsMs, p.tlsMs), append(httpMs, p.httpMs)
+	}
+	foreign.Probes = len(foreignProbes)
+	foreign.TCPMs, foreign.TLSMs, foreign.HTTPMs = rpmTrimmedMean(tcp), rpmTrimmedMean(tlsMs), rpmTrimmedMean(httpMs)
+	self.Probes, self.HTTPMs = len(selfMs), rpmTrimmedMean(selfMs)
+	return foreign, self
+}
@@ -0,0 +1,64 @@
+package api
+
+import (
+	"math"
+	"testing"
+)
+
+func TestRPMTrimmedMean(t *testing.T) {
+	if got := rpmTrimmedMean(nil); got != 0 {
+		t.Errorf("Expected 0 without values, got %v", got)
+	}
+	// Of 20 values, the slowest one is left out
+	values := make([]float64, 0, 20)
+	for i := 0; i < 19; i++ {
+		values = append(values, 10)
+	}
+	values = append(values, 1000)
+	if got := rpmTrimmedMean(values); got != 10 {
+		t.Errorf("Expected the outlier to be trimmed to a mean of 10, got %v", got)
+	}
+	// Too few values to trim any
+	if got := rpmTrimmedMean([]float64{30, 10, 20}); got != 20 {
+		t.Errorf("Expected a mean of 20, got %v", got)
+	}
+	if values[19] != 1000 {
+		t.Error("Expected the values to be left in their order")
+	}
+}
+
+func TestRPMScore(t *testing.T) {
+	// 20 ms for every round trip: (60 / 6 + 20 / 2) = 20 ms, 3000 per minute
+	idle := rpmScore(RPMProbes{TCPMs: 20, TLSMs: 20, HTTPMs: 20}, RPMProbes{HTTPMs: 20})
+	if math.Abs(idle-3000) > 1e-9 {
+		t.Errorf("Expected 3000 RPM, got %v", idle)
+	}
+	// The example of the documentation
+	loaded := rpmScore(RPMProbes{TCPMs: 31.4, TLSMs: 36.2, HTTPMs: 34.9}, RPMProbes{HTTPMs: 104.1})
+	if math.Round(loaded) != 868 {
+		t.Errorf("Expected 868 RPM, got %v", loaded)
+	}
+	if got := rpmScore(RPMProbes{}, RPMProbes{}); got != 0 {
+		t.Errorf("Expected 0 without round trips, got %v", got)
+	}
+}
+
+func TestRPMSaturated(t *testing.T) {
+	tests := []struct {
+		name     string
+		goodputs []float64
+		expected bool
+	}{
+		{"too few steps", []float64{100, 100, 100, 100}, false},
+		{"still growing", []float64{100, 200, 300, 400, 500}, false},
+		{"flat", []float64{400, 400, 400, 400, 400}, true},
+		{"grew less than 5%", []float64{400, 410, 405, 415, 412}, true},
+		{"grew again", []float64{400, 400, 400, 400, 480}, false},
+		{"no traffic", []float64{0, 0, 0, 0, 0}, false},
+	}
+	for _, tt := range tests {
+		if got := rpmSaturated(tt.goodputs); got != tt.expected {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.expected, got)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// TestRunner is one test type. Every runner gets the same request handling:
+// profile defaults, validation, API key limits, ?async jobs, schedules, and
+// its results are stored and exported as metrics under Name.
+type TestRunner interface {
+	Name() string                                 // Result, job and schedule type
+	Validate(v *requestValidator, req RunRequest) // Checks the target and the type's own fields
+	Run(ctx context.Context, req RunRequest, profile *Profile) (map[string]interface{}, int, error)
+}
+
+// runnerFuncs is a TestRunner of a validate and a run function. run returns
+// the response data, or an error with the HTTP status to report it with.
+type runnerFuncs struct {
+	name     string
+	validate func(v *requestValidator, req RunRequest)
+	run      func(req RunRequest, profile *Profile) (map[string]interface{}, int, error)
+}
+
+func (r runnerFuncs) Name() string {
+	return r.name
+}
+
+func (r runnerFuncs) Validate(v *requestValidator, req RunRequest) {
+	r.validate(v, req)
+}
+
+func (r runnerFuncs) Run(ctx context.Context, req RunRequest, profile *Profile) (map[string]interface{}, int, error) {
+	testID := req.jobID
+	if testID == "" {
+		testID = newResultID()
+	}
+	ctx, end := startTest(withTestID(ctx, testID), r.name, req)
+	req.ctx = ctx
+	data, status, err := r.run(req, profile)
+	end(data, status, err)
+	return data, status, err
+}
+
+// testRunners are the registered test types, in the order error messages list them
+var testRunners []TestRunner
+
+// registerRunner adds a test type; names must be unique
+func registerRunner(r TestRunner) {
+	if _, ok := lookupRunner(r.Name()); ok {
+		panic(fmt.Sprintf("test runner %q registered twice", r.Name()))
+	}
+	testRunners = append(testRunners, r)
+}
+
+// registerRunners adds the built-in test types
+func registerRunners() {
+	registerRunner(runnerFuncs{TEST_TYPE_IPERF3, validateIperf3Request, runIperf3})
+	registerRunner(runnerFuncs{TEST_TYPE_TWAMP, validateTwampRequest, runTwamp})
+	registerRunner(runnerFuncs{TEST_TYPE_TRANSFER, validateTransferRequest, runTransfer})
+	registerRunner(runnerFuncs{TEST_TYPE_S3, validateS3Request, runS3})
+	registerRunner(runnerFuncs{TEST_TYPE_SSH, validateSSHRequest, runSSH})
+	registerRunner(runnerFuncs{TEST_TYPE_PMTU, validatePMTURequest, runPMTU})
+	registerRunner(runnerFuncs{TEST_TYPE_STUN, validateSTUNRequest, runSTUN})
+	registerRunner(runnerFuncs{TEST_TYPE_NAT64, validateNAT64Request, runNAT64})
+	registerRunner(runnerFuncs{TEST_TYPE_PING, validatePingRequest, runPing})
+	registerRunner(runnerFuncs{TEST_TYPE_TRACEROUTE, validateTracerouteRequest, runTraceroute})
+	registerRunner(runnerFuncs{TEST_TYPE_OWAMP, validateOwampRequest, runOwamp})
+	registerRunner(runnerFuncs{TEST_TYPE_TLS, validateTLSRequest, runTLS})
+	registerRunner(runnerFuncs{TEST_TYPE_NDT7, validateNDT7Request, runNDT7})
+	registerRunner(runnerFuncs{TEST_TYPE_BUFFERBLOAT, validateBufferbloatRequest, runBufferbloat})
+	registerRunner(runnerFuncs{TEST_TYPE_RPM, validateRPMRequest, runRPM})
+	registerRunner(runnerFuncs{TEST_TYPE_TCP_CONNECT, validateTCPConnectRequest, runTCPConnect})
+	registerRunner(runnerFuncs{TEST_TYPE_HTTP, validateHTTPRequest, runHTTP})
+}
+
+// lookupRunner returns the runner of a test type
+func lookupRunner(name string) (TestRunner, bool) {
+	for _, r := range testRunners {
+		if r.Name() == name {
+			return r, true
+		}
+	}
+	return nil, false
+}
+
+// runnerNames lists the test types for error messages, e.g. "iperf3, twamp or ping"
+func runnerNames() string {
+	names := make([]string, len(testRunners))
+	for i, r := range testRunners {
+		names[i] = r.Name()
+	}
+	if len(names) < 2 {
+		return strings.Join(names, "")
+	}
+	return strings.Join(names[:len(names)-1], ", ") + " or " + names[len(names)-1]
+}
+
+// invalidTestType is the error for a type no runner is registered for
+func invalidTestType(testType string) error {
+	return fmt.Errorf("invalid type %q (expected %s)", testType, runnerNames())
+}
+
+// clientRunHandler serves POST /<type>/client/run for a registered test type
+func clientRunHandler(name string) http.HandlerFunc {
+	runner, ok := lookupRunner(name)
+	if !ok {
+		panic(fmt.Sprintf("no test runner %q", name))
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		req, profile, ok := decodeRunRequest(w, r)
+		if !ok {
+			return
+		}
+		runTestRequest(w, r, runner, req, profile)
+	}
+}
@@ -0,0 +1,44 @@
+package api
+
+import (
+	"testing"
+)
+
+// withRunners registers runners of the given names only, for the test
+func withRunners(t *testing.T, names ...string) {
+	t.Helper()
+	saved := testRunners
+	testRunners = nil
+	for _, name := range names {
+		registerRunner(runnerFuncs{name: name})
+	}
+	t.Cleanup(func() { testRunners = saved })
+}
+
+func TestRunnerNames(t *testing.T) {
+	tests := []struct {
+		names []string
+		want  string
+	}{
+		{nil, ""},
+		{[]string{"ping"}, "ping"},
+		{[]string{"iperf3", "twamp"}, "iperf3 or twamp"},
+		{[]string{"iperf3", "twamp", "ping"}, "iperf3, twamp or ping"},
+	}
+	for _, tt := range tests {
+		withRunners(t, tt.names...)
+		if got := runnerNames(); got != tt.want {
+			t.Errorf("Expected %q for %v, got %q", tt.want, tt.names, got)
+		}
+	}
+}
+
+func TestRegisterRunnerTwice(t *testing.T) {
+	withRunners(t, "ping")
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected registering a test type twice to panic")
+		}
+	}()
+	registerRunner(runnerFuncs{name: "ping"})
+}
@@ -0,0 +1,720 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"network-test-api/pkg/nettest"
+	"network-test-api/pkg/stats"
+)
+
+// Multipart PUT/GET throughput against S3-compatible object storage
+const (
+	DEFAULT_S3_REGION    = "us-east-1"
+	DEFAULT_S3_SIZE      = 64 << 20 // Bytes
+	DEFAULT_S3_PART_SIZE = 8 << 20
+	MIN_S3_PART_SIZE     = 5 << 20 // S3 minimum for every part but the last
+	MAX_S3_PART_SIZE     = 1 << 30
+	MAX_S3_PARTS         = 10000
+	DEFAULT_S3_PARALLEL  = 4 // Parts in flight
+	MAX_S3_PARALLEL      = 16
+	DEFAULT_S3_DURATION  = 120 // Seconds the whole test may take
+	S3_KEY_PREFIX        = "network-test-api/"
+	S3_CLEANUP_TIMEOUT   = 10 * time.Second // Aborting or deleting after a failure
+
+	S3_UNSIGNED_PAYLOAD = "UNSIGNED-PAYLOAD"
+	S3_SIGV4_ALGORITHM  = "AWS4-HMAC-SHA256"
+	S3_AMZ_DATE_FORMAT  = "20060102T150405Z"
+)
+
+// S3 credential fields in the secrets store; session_token is optional
+var s3CredentialFields = []string{"access_key_id", "secret_access_key"}
+
+// s3Signer signs requests with AWS Signature Version 4
+type s3Signer struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	Region          string
+}
+
+// s3Escape percent-encodes everything but the unreserved characters, as SigV4 requires
+func s3Escape(s string, keepSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~', c == '/' && keepSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Sign adds the x-amz headers and Authorization to req. Host, Range and all
+// x-amz-* headers are signed; payloadHash is the body's SHA-256 or UNSIGNED-PAYLOAD.
+func (s *s3Signer) Sign(req *http.Request, payloadHash string, now time.Time) {
+	amzDate := now.UTC().Format(S3_AMZ_DATE_FORMAT)
+	scope := amzDate[:8] + "/" + s.Region + "/s3/aws4_request"
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if s.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.SessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		lower := strings.ToLower(name)
+		if lower == "range" || strings.HasPrefix(lower, "x-amz-") {
+			headers[lower] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	query := req.URL.Query()
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		for _, v := range query[k] {
+			pairs = append(pairs, s3Escape(k, false)+"="+s3Escape(v, false))
+		}
+	}
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		s3Escape(req.URL.Path, true),
+		strings.Join(pairs, "&"),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	stringToSign := strings.Join([]string{S3_SIGV4_ALGORITHM, amzDate, scope, sha256Hex([]byte(canonicalRequest))}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.SecretAccessKey), amzDate[:8])
+	key = hmacSHA256(key, s.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		S3_SIGV4_ALGORITHM, s.AccessKeyID, scope, signedHeaders, signature))
+}
+
+// S3PartResult is the timing of one part request
+type S3PartResult struct {
+	PartNumber     int     `json:"part_number"`
+	Bytes          int64   `json:"bytes"`
+	DurationMs     float64 `json:"duration_ms"`
+	LatencyMs      float64 `json:"latency_ms"` // PUT: body written to response; GET: request start to first byte
+	ThroughputMbps float64 `json:"throughput_mbps"`
+
+	etag string
+}
+
+// S3PhaseResult summarises the parts of an upload or download
+type S3PhaseResult struct {
+	Bytes          int64            `json:"bytes"`
+	DurationMs     float64          `json:"duration_ms"`     // First part started to last part done
+	ThroughputMbps float64          `json:"throughput_mbps"` // Aggregate over all parts in flight
+	Latency        *MetricAggregate `json:"latency_ms"`
+	Parts          []S3PartResult   `json:"parts"`
+}
+
+// S3Result is the outcome of an object storage test
+type S3Result struct {
+	Endpoint    string              `json:"endpoint"`
+	Bucket      string              `json:"bucket"`
+	Key         string              `json:"key"`
+	Region      string              `json:"region"`
+	Size        int64               `json:"size"`
+	PartSize    int64               `json:"part_size"`
+	PartCount   int                 `json:"part_count"`
+	Parallel    int                 `json:"parallel"`
+	Upload      *S3PhaseResult      `json:"upload"`
+	Download    *S3PhaseResult      `json:"download"`
+	Requests    S3RequestTiming     `json:"requests"`
+	Kept        bool                `json:"kept"` // The object was left in the bucket
+	TLSVersion  string              `json:"tls_version,omitempty"`
+	TLS         *TLSReport          `json:"tls,omitempty"` // Certificate check of the first connection (https only)
+	Dial        *nettest.DialReport `json:"dial"`
+	Connections int                 `json:"connections"`
+
+	startedAt time.Time
+}
+
+// S3RequestTiming are the latencies of the requests around the parts in milliseconds
+type S3RequestTiming struct {
+	CreateMs   float64 `json:"create_ms"`   // CreateMultipartUpload
+	CompleteMs float64 `json:"complete_ms"` // CompleteMultipartUpload
+	DeleteMs   float64 `json:"delete_ms,omitempty"`
+}
+
+// s3Error is the XML error body of a failed S3 request
+type s3Error struct {
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+// s3Client runs the requests of one test over a shared connection pool
+type s3Client struct {
+	http    *http.Client
+	signer  *s3Signer
+	base    *url.URL // Scheme and host the object lives at
+	path    string   // Unescaped path of the object
+	payload nettest.PayloadEntropy
+	tls     *tlsChecker
+
+	mu         sync.Mutex
+	deadline   time.Time           // For dialing, which the transport does without the request's deadline
+	dial       *nettest.DialReport // Of the first connection
+	conns      int
+	tlsVersion string
+}
+
+// objectURL builds the object URL, path-style unless virtualHost
+func objectURL(endpoint *url.URL, bucket, key string, virtualHost bool) (*url.URL, string) {
+	base := &url.URL{Scheme: endpoint.Scheme, Host: endpoint.Host}
+	prefix := strings.TrimSuffix(endpoint.Path, "/")
+	if virtualHost {
+		base.Host = bucket + "." + endpoint.Host
+		return base, prefix + "/" + key
+	}
+	return base, prefix + "/" + bucket + "/" + key
+}
+
+// newS3Client builds a client whose connections are dialed with the request's address family
+func newS3Client(ctx context.Context, base *url.URL, port int, req RunRequest, signer *s3Signer, payload nettest.PayloadEntropy) *s3Client {
+	c := &s3Client{signer: signer, base: base, payload: payload, tls: newTLSChecker(req)}
+	c.deadline, _ = ctx.Deadline()
+	transport := &http.Transport{
+		Proxy: nil, // Measure the path to the endpoint itself
+		DialContext: func(context.Context, string, string) (net.Conn, error) {
+			c.mu.Lock()
+			timeout := time.Until(c.deadline)
+			c.mu.Unlock()
+			conn, dial, err := nettest.DialControl(base.Hostname(), port, req.AddressFamily, timeout)
+			c.mu.Lock()
+			if c.dial == nil {
+				c.dial = dial
+			}
+			if err == nil {
+				c.conns++
+			}
+			c.mu.Unlock()
+			return conn, err
+		},
+		TLSClientConfig:     c.tls.config(base.Hostname()),
+		MaxConnsPerHost:     req.Parallel,
+		MaxIdleConnsPerHost: req.Parallel,
+		DisableCompression:  true, // Count the bytes on the wire
+	}
+	c.http = &http.Client{
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	return c
+}
+
+// do signs and sends a request for the object, returning the response with its
+// body still open. Non-2xx responses are turned into errors.
+func (c *s3Client) do(ctx context.Context, method string, query url.Values, header http.Header, body io.Reader, size int64, payloadHash string) (*http.Response, error) {
+	u := *c.base
+	u.Path = c.path
+	u.RawPath = s3Escape(c.path, true)
+	u.RawQuery = strings.ReplaceAll(query.Encode(), "+", "%20")
+	r, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		r.Header[k] = v
+	}
+	if body != nil {
+		r.ContentLength = size
+	}
+	r.Header.Set("User-Agent", "network-test-api/"+API_VERSION)
+	c.signer.Sign(r, payloadHash, time.Now())
+
+	resp, err := c.http.Do(r)
+	if err != nil {
+		return nil, err
+	}
+	if resp.TLS != nil {
+		c.mu.Lock()
+		c.tlsVersion = tls.VersionName(resp.TLS.Version)
+		c.mu.Unlock()
+	}
+	if resp.StatusCode/100 != 2 {
+		defer func() { _ = resp.Body.Close() }()
+		return nil, s3ResponseError(resp)
+	}
+	return resp, nil
+}
+
+// s3ResponseError describes a failed response from its XML error body, if any
+func s3ResponseError(resp *http.Response) error {
+	raw, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	var e s3Error
+	if xml.Unmarshal(raw, &e) == nil && e.Code != "" {
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(e.Code+" "+e.Message))
+	}
+	if loc := resp.Header.Get("Location"); loc != "" {
+		return fmt.Errorf("%s redirecting to %s; check region and addressing", resp.Status, loc)
+	}
+	return fmt.Errorf("%s", resp.Status)
+}
+
+// readXML decodes a 200 response body, which S3 may still use to report an error
+func readXML(resp *http.Response, v interface{}) error {
+	defer func() { _ = resp.Body.Close() }()
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	var e s3Error
+	if xml.Unmarshal(raw, &e) == nil && e.Code != "" {
+		return fmt.Errorf("%s %s", e.Code, e.Message)
+	}
+	return xml.Unmarshal(raw, v)
+}
+
+// createUpload starts a multipart upload and returns its ID
+func (c *s3Client) createUpload(ctx context.Context) (string, error) {
+	resp, err := c.do(ctx, http.MethodPost, url.Values{"uploads": {""}}, nil, nil, 0, sha256Hex(nil))
+	if err != nil {
+		return "", err
+	}
+	var result struct {
+		UploadID string `xml:"UploadId"`
+	}
+	if err := readXML(resp, &result); err != nil {
+		return "", err
+	}
+	if result.UploadID == "" {
+		return "", fmt.Errorf("no UploadId in response")
+	}
+	return result.UploadID, nil
+}
+
+// partRange is the byte range of part number n (from 1)
+func partRange(n int, size, partSize int64) (int64, int64) {
+	start := int64(n-1) * partSize
+	end := start + partSize
+	if end > size {
+		end = size
+	}
+	return start, end
+}
+
+// timedRequest runs one part request, reading the whole response body
+func (c *s3Client) timedRequest(ctx context.Context, n int, method string, query url.Values, header http.Header, body io.Reader, size int64) (S3PartResult, error) {
+	part := S3PartResult{PartNumber: n}
+	var wrote, firstByte time.Time
+	trace := &httptrace.ClientTrace{
+		WroteRequest:         func(httptrace.WroteRequestInfo) { wrote = time.Now() },
+		GotFirstResponseByte: func() { firstByte = time.Now() },
+	}
+	start := time.Now()
+	resp, err := c.do(httptrace.WithClientTrace(ctx, trace), method, query, header, body, size, S3_UNSIGNED_PAYLOAD)
+	if err != nil {
+		return part, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	part.etag = resp.Header.Get("ETag")
+	n64, _, err := readBody(resp.Body, 0)
+	if err != nil {
+		return part, fmt.Errorf("after %d bytes: %w", n64, err)
+	}
+	end := time.Now()
+
+	if method == http.MethodPut {
+		part.Bytes = size
+		part.LatencyMs = sinceMs(wrote, firstByte)
+	} else {
+		part.Bytes = n64
+		part.LatencyMs = sinceMs(start, firstByte)
+	}
+	part.DurationMs = sinceMs(start, end)
+	part.ThroughputMbps = goodputMbps(part.Bytes, end.Sub(start))
+	return part, nil
+}
+
+// runParts runs fn for every part with parallel parts in flight, stopping at the first error
+func runParts(ctx context.Context, count, parallel int, fn func(context.Context, int) (S3PartResult, error)) (*S3PhaseResult, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	parts := make([]S3PartResult, count)
+	next := make(chan int)
+	var wg sync.WaitGroup
+	var once sync.Once
+	var firstErr error
+
+	start := time.Now()
+	for i := 0; i < parallel && i < count; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := range next {
+				part, err := fn(ctx, n)
+				if err != nil {
+					once.Do(func() {
+						firstErr = fmt.Errorf("part %d: %w", n, err)
+						cancel()
+					})
+					continue
+				}
+				parts[n-1] = part
+			}
+		}()
+	}
+feed:
+	for n := 1; n <= count; n++ {
+		select {
+		case next <- n:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(next)
+	wg.Wait()
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	elapsed := time.Since(start)
+
+	phase := &S3PhaseResult{Parts: parts, DurationMs: float64(elapsed.Microseconds()) / 1000}
+	latencies := make([]float64, len(parts))
+	for i, p := range parts {
+		phase.Bytes += p.Bytes
+		latencies[i] = p.LatencyMs
+	}
+	phase.ThroughputMbps = goodputMbps(phase.Bytes, elapsed)
+	phase.Latency = stats.Summarize(latencies)
+	return phase, nil
+}
+
+// completeUpload assembles the uploaded parts into the object
+func (c *s3Client) completeUpload(ctx context.Context, uploadID string, parts []S3PartResult) error {
+	type completedPart struct {
+		PartNumber int    `xml:"PartNumber"`
+		ETag       string `xml:"ETag"`
+	}
+	body := struct {
+		XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+		Parts   []completedPart `xml:"Part"`
+	}{}
+	for _, p := range parts {
+		body.Parts = append(body.Parts, completedPart{p.PartNumber, p.etag})
+	}
+	raw, err := xml.Marshal(body)
+	if err != nil {
+		return err
+	}
+	header := http.Header{"Content-Type": {"application/xml"}}
+	resp, err := c.do(ctx, http.MethodPost, url.Values{"uploadId": {uploadID}}, header, bytes.NewReader(raw), int64(len(raw)), sha256Hex(raw))
+	if err != nil {
+		return err
+	}
+	var result struct {
+		ETag string `xml:"ETag"`
+	}
+	return readXML(resp, &result)
+}
+
+// cleanup deletes the object, or with an uploadId aborts the multipart upload,
+// on a context of its own since the test's may be what ran out
+func (c *s3Client) cleanup(query url.Values) {
+	ctx, cancel := context.WithTimeout(context.Background(), S3_CLEANUP_TIMEOUT)
+	defer cancel()
+	c.mu.Lock()
+	c.deadline, _ = ctx.Deadline()
+	c.mu.Unlock()
+	resp, err := c.do(ctx, http.MethodDelete, query, nil, nil, 0, sha256Hex(nil))
+	if err != nil {
+		log.Printf("S3 cleanup of %s failed: %v", c.path, err)
+		return
+	}
+	_ = resp.Body.Close()
+}
+
+// s3Test uploads the object in parts, downloads it again with ranged GETs and deletes it
+func s3Test(ctx context.Context, endpoint *url.URL, port int, req RunRequest, signer *s3Signer, payload nettest.PayloadEntropy) (*S3Result, error) {
+	base, path := objectURL(endpoint, req.Bucket, req.Key, req.VirtualHost)
+	c := newS3Client(ctx, base, port, req, signer, payload)
+	c.path = path
+	defer c.http.CloseIdleConnections()
+
+	count := int((req.Size + req.PartSize - 1) / req.PartSize)
+	result := &S3Result{
+		Endpoint:  endpoint.String(),
+		Bucket:    req.Bucket,
+		Key:       req.Key,
+		Region:    signer.Region,
+		Size:      req.Size,
+		PartSize:  req.PartSize,
+		PartCount: count,
+		Parallel:  req.Parallel,
+		Kept:      req.KeepObject,
+		startedAt: time.Now(),
+	}
+	start := time.Now()
+	uploadID, err := c.createUpload(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("CreateMultipartUpload: %w", err)
+	}
+	result.Requests.CreateMs = sinceMs(start, time.Now())
+
+	result.Upload, err = runParts(ctx, count, req.Parallel, func(ctx context.Context, n int) (S3PartResult, error) {
+		from, to := partRange(n, req.Size, req.PartSize)
+		query := url.Values{"partNumber": {strconv.Itoa(n)}, "uploadId": {uploadID}}
+		header := http.Header{"Content-Type": {"application/octet-stream"}}
+		return c.timedRequest(ctx, n, http.MethodPut, query, header, newPayloadReader(c.payload, to-from), to-from)
+	})
+	if err != nil {
+		c.cleanup(url.Values{"uploadId": {uploadID}})
+		return nil, fmt.Errorf("UploadPart %w", err)
+	}
+
+	start = time.Now()
+	if err := c.completeUpload(ctx, uploadID, result.Upload.Parts); err != nil {
+		c.cleanup(url.Values{"uploadId": {uploadID}})
+		return nil, fmt.Errorf("CompleteMultipartUpload: %w", err)
+	}
+	result.Requests.CompleteMs = sinceMs(start, time.Now())
+
+	result.Download, err = runParts(ctx, count, req.Parallel, func(ctx context.Context, n int) (S3PartResult, error) {
+		from, to := partRange(n, req.Size, req.PartSize)
+		header := http.Header{"Range": {fmt.Sprintf("bytes=%d-%d", from, to-1)}}
+		part, err := c.timedRequest(ctx, n, http.MethodGet, nil, header, nil, 0)
+		if err == nil && part.Bytes != to-from {
+			err = fmt.Errorf("expected %d bytes, got %d", to-from, part.Bytes)
+		}
+		return part, err
+	})
+	if err != nil {
+		if !req.KeepObject {
+			c.cleanup(nil)
+		}
+		return nil, fmt.Errorf("GetObject %w", err)
+	}
+
+	if !req.KeepObject {
+		start = time.Now()
+		resp, err := c.do(ctx, http.MethodDelete, nil, nil, nil, 0, sha256Hex(nil))
+		if err != nil {
+			return nil, fmt.Errorf("DeleteObject: %w", err)
+		}
+		_ = resp.Body.Close()
+		result.Requests.DeleteMs = sinceMs(start, time.Now())
+	}
+
+	c.mu.Lock()
+	result.Dial, result.Connections, result.TLSVersion = c.dial, c.conns, c.tlsVersion
+	c.mu.Unlock()
+	result.TLS = c.tls.Report()
+	return result, nil
+}
+
+// validateS3 checks and defaults the object storage fields of a request
+func validateS3(req *RunRequest) error {
+	if req.Bucket == "" {
+		return fmt.Errorf("bucket is required")
+	}
+	if req.Credentials == "" {
+		return fmt.Errorf("credentials is required (name of an entry in SECRETS_FILE)")
+	}
+	if req.Key == "" {
+		req.Key = S3_KEY_PREFIX + newResultID() + ".bin"
+	}
+	req.Key = strings.TrimPrefix(req.Key, "/")
+	if req.Size == 0 {
+		req.Size = DEFAULT_S3_SIZE
+	}
+	if req.PartSize == 0 {
+		req.PartSize = DEFAULT_S3_PART_SIZE
+	}
+	if req.Parallel == 0 {
+		req.Parallel = DEFAULT_S3_PARALLEL
+	}
+	switch {
+	case req.Size < 1 || req.Size > MAX_TRANSFER_SIZE:
+		return fmt.Errorf("size must be between 1 and %d bytes", int64(MAX_TRANSFER_SIZE))
+	case req.PartSize < MIN_S3_PART_SIZE || req.PartSize > MAX_S3_PART_SIZE:
+		return fmt.Errorf("part_size must be between %d and %d bytes", MIN_S3_PART_SIZE, MAX_S3_PART_SIZE)
+	case (req.Size+req.PartSize-1)/req.PartSize > MAX_S3_PARTS:
+		return fmt.Errorf("size needs more than %d parts of part_size", MAX_S3_PARTS)
+	case req.Parallel < 1 || req.Parallel > MAX_S3_PARALLEL:
+		return fmt.Errorf("parallel must be between 1 and %d", MAX_S3_PARALLEL)
+	case req.Duration < 1 || req.Duration > MAX_TRANSFER_DURATION:
+		return fmt.Errorf("duration must be between 1 and %d seconds", MAX_TRANSFER_DURATION)
+	case req.VirtualHost && strings.Contains(req.Bucket, "."):
+		return fmt.Errorf("virtual_host needs a bucket name without dots")
+	case req.Series:
+		return fmt.Errorf("series is not available for s3 tests")
+	}
+	return nil
+}
+
+// s3SignerFor looks up the request's credentials
+func s3SignerFor(req RunRequest) (*s3Signer, error) {
+	secret, err := secretStore.Lookup(req.Credentials, s3CredentialFields...)
+	if err != nil {
+		return nil, err
+	}
+	region := req.Region
+	if region == "" {
+		region = secret["region"]
+	}
+	if region == "" {
+		region = DEFAULT_S3_REGION
+	}
+	return &s3Signer{
+		AccessKeyID:     secret["access_key_id"],
+		SecretAccessKey: secret["secret_access_key"],
+		SessionToken:    secret["session_token"],
+		Region:          region,
+	}, nil
+}
+
+// runS3 applies defaults to a decoded request, runs the object storage test and records the result.
+// Errors come with the HTTP status to report them with.
+func runS3(req RunRequest, profile *Profile) (map[string]interface{}, int, error) {
+	endpoint, port, err := parseTransferURL(req.Endpoint)
+	if err != nil || endpoint.Scheme == "ftp" {
+		return nil, http.StatusBadRequest, fmt.Errorf("endpoint must be an absolute http or https URL")
+	}
+	endpoint.RawQuery, endpoint.Fragment, endpoint.User = "", "", nil
+	req.ServerHost, req.ServerPort = endpoint.Hostname(), port
+	if req.Duration == 0 {
+		req.Duration = DEFAULT_S3_DURATION
+	}
+	if err := checkProfileLimits(req, profile); err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	payload, err := nettest.ParsePayloadEntropy(req.Payload)
+	if err == nil {
+		err = validateS3(&req)
+	}
+	if err == nil {
+		err = validateRootStore(&req)
+	}
+	var signer *s3Signer
+	if err == nil {
+		signer, err = s3SignerFor(req)
+	}
+	if err == nil {
+		req.AddressFamily, err = parseAddressFamily(req.AddressFamily)
+	}
+	if err == nil {
+		err = validateLockWait(&req)
+	}
+	if err == nil {
+		err = validateCallbackURL(req.CallbackURL)
+	}
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	lock, release, status, err := lockTest(TEST_TYPE_S3, req, true)
+	if err != nil {
+		return nil, status, err
+	}
+	defer release()
+
+	logf(req.ctx, "S3 test: %s bucket=%s key=%s (size=%d, part_size=%d, parallel=%d, %ds limit)",
+		endpoint, req.Bucket, req.Key, req.Size, req.PartSize, req.Parallel, req.Duration)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(req.Duration)*time.Second)
+	defer cancel()
+	result, err := s3Test(ctx, endpoint, port, req, signer, payload)
+	if err != nil {
+		if ctx.Err() != nil {
+			err = fmt.Errorf("test did not finish within %ds: %v", req.Duration, err)
+		}
+		return nil, http.StatusInternalServerError, fmt.Errorf("S3 test failed: %v", err)
+	}
+
+	data := map[string]interface{}{
+		"server":       req.ServerHost,
+		"port":         req.ServerPort,
+		"endpoint":     result.Endpoint,
+		"bucket":       result.Bucket,
+		"key":          result.Key,
+		"region":       result.Region,
+		"size":         result.Size,
+		"part_size":    result.PartSize,
+		"part_count":   result.PartCount,
+		"parallel":     result.Parallel,
+		"upload":       result.Upload,
+		"download":     result.Download,
+		"requests":     result.Requests,
+		"kept":         result.Kept,
+		"connections":  result.Connections,
+		"duration_sec": time.Since(result.startedAt).Seconds(),
+		"dial":         result.Dial,
+	}
+	if result.TLSVersion != "" {
+		data["tls_version"] = result.TLSVersion
+	}
+	if result.TLS != nil {
+		data["tls"] = result.TLS
+	}
+	if profile != nil {
+		data["profile"] = profile.Name
+	}
+	data["lock"] = lock
+
+	recordResult(TEST_TYPE_S3, req, result.startedAt, data)
+	notifyCallback(req.CallbackURL, data)
+
+	return data, http.StatusOK, nil
+}
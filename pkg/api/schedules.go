@@ -0,0 +1,480 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Schedules re-run a stored test request at a fixed interval; they are how
+// recurring tests and background monitors of a target are set up
+const (
+	MIN_SCHEDULE_INTERVAL = time.Minute
+	SCHEDULE_TICK         = time.Second
+)
+
+// Schedule states surfaced in listings
+const (
+	SCHEDULE_STATE_ACTIVE = "active"
+	SCHEDULE_STATE_PAUSED = "paused"
+)
+
+// Schedule is a test request run every Interval until paused or deleted
+type Schedule struct {
+	ID          string          `json:"id"`
+	Type        string          `json:"type"`
+	Target      string          `json:"target"`
+	Interval    string          `json:"interval"`
+	Request     json.RawMessage `json:"request"`
+	State       string          `json:"state"`
+	PausedAt    *time.Time      `json:"paused_at,omitempty"`
+	PausedUntil *time.Time      `json:"paused_until,omitempty"` // Resumes on its own after this time
+	PauseReason string          `json:"pause_reason,omitempty"`
+	Running     bool            `json:"running"`
+	CreatedAt   time.Time       `json:"created_at"`
+	NextRun     *time.Time      `json:"next_run,omitempty"` // Omitted while paused
+	LastRun     *time.Time      `json:"last_run,omitempty"`
+	LastResult  string          `json:"last_result_id,omitempty"`
+	LastError   string          `json:"last_error,omitempty"`
+	Runs        int             `json:"runs"`
+	Failures    int             `json:"failures"`
+	APIKey      string          `json:"api_key,omitempty"` // Name of the key whose limits its runs count against
+	Alert       *Alert          `json:"alert,omitempty"`
+	AlertState  *AlertState     `json:"alert_state,omitempty"`
+
+	every  time.Duration
+	next   time.Time
+	apiKey *APIKey
+}
+
+// ScheduleRequest is the body of POST /schedules
+type ScheduleRequest struct {
+	Type     string          `json:"type"`
+	Interval string          `json:"interval"`
+	Request  json.RawMessage `json:"request"`
+	Alert    *Alert          `json:"alert"` // Thresholds to notify on breaches of (optional)
+}
+
+// PauseRequest is the optional body of POST /schedules/{id}/pause
+type PauseRequest struct {
+	Duration string `json:"duration"` // Resume automatically after this long; empty pauses until resumed
+	Reason   string `json:"reason"`
+}
+
+// parseScheduleInterval accepts Go durations of at least MIN_SCHEDULE_INTERVAL
+func parseScheduleInterval(s string) (time.Duration, error) {
+	d, err := time.ParseDuration(s)
+	if err != nil || d < MIN_SCHEDULE_INTERVAL {
+		return 0, fmt.Errorf("invalid interval %q (expected a duration of at least %s, such as 5m or 1h)", s, MIN_SCHEDULE_INTERVAL)
+	}
+	return d, nil
+}
+
+// paused reports whether the schedule is paused at now, resuming it once its pause expired
+func (s *Schedule) paused(now time.Time) bool {
+	if s.State != SCHEDULE_STATE_PAUSED {
+		return false
+	}
+	if s.PausedUntil != nil && !now.Before(*s.PausedUntil) {
+		s.resume(now)
+		return false
+	}
+	return true
+}
+
+// pause stops further runs; a run in progress still completes
+func (s *Schedule) pause(now time.Time, until *time.Time, reason string) {
+	s.State = SCHEDULE_STATE_PAUSED
+	s.PausedAt = &now
+	s.PausedUntil = until
+	s.PauseReason = reason
+}
+
+// resume re-activates the schedule. Runs missed while paused are not replayed:
+// an overdue schedule runs once at the next tick, then keeps its interval.
+func (s *Schedule) resume(now time.Time) {
+	s.State = SCHEDULE_STATE_ACTIVE
+	s.PausedAt = nil
+	s.PausedUntil = nil
+	s.PauseReason = ""
+	if s.next.Before(now) {
+		s.next = now
+	}
+}
+
+// snapshot returns a copy safe to encode outside the store lock
+func (s *Schedule) snapshot() *Schedule {
+	c := *s
+	if s.State == SCHEDULE_STATE_ACTIVE {
+		next := s.next
+		c.NextRun = &next
+	}
+	if s.AlertState != nil {
+		state := *s.AlertState
+		c.AlertState = &state
+	}
+	return &c
+}
+
+// ScheduleStore holds the schedules and runs them when due
+type ScheduleStore struct {
+	mu   sync.Mutex
+	byID map[string]*Schedule
+}
+
+// NewScheduleStore creates an empty store
+func NewScheduleStore() *ScheduleStore {
+	return &ScheduleStore{byID: make(map[string]*Schedule)}
+}
+
+var scheduleStore = NewScheduleStore()
+
+// Add stores a schedule whose first run is due immediately
+func (st *ScheduleStore) Add(s *Schedule) *Schedule {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	s.ID = newResultID()
+	s.State = SCHEDULE_STATE_ACTIVE
+	s.CreatedAt = time.Now().UTC()
+	s.next = s.CreatedAt
+	st.byID[s.ID] = s
+	return s.snapshot()
+}
+
+// Get returns a copy of a schedule by ID
+func (st *ScheduleStore) Get(id string) (*Schedule, bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	s, ok := st.byID[id]
+	if !ok {
+		return nil, false
+	}
+	s.paused(time.Now().UTC())
+	return s.snapshot(), true
+}
+
+// List returns copies of all schedules, oldest first
+func (st *ScheduleStore) List() []*Schedule {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	now := time.Now().UTC()
+	list := make([]*Schedule, 0, len(st.byID))
+	for _, s := range st.byID {
+		s.paused(now)
+		list = append(list, s.snapshot())
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.Before(list[j].CreatedAt) })
+	return list
+}
+
+// Delete removes a schedule; a run in progress still completes
+func (st *ScheduleStore) Delete(id string) bool {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	_, ok := st.byID[id]
+	delete(st.byID, id)
+	return ok
+}
+
+// Pause pauses a schedule, until the given time when it is not nil
+func (st *ScheduleStore) Pause(id string, until *time.Time, reason string) (*Schedule, bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	s, ok := st.byID[id]
+	if !ok {
+		return nil, false
+	}
+	s.pause(time.Now().UTC(), until, reason)
+	return s.snapshot(), true
+}
+
+// Resume re-activates a paused schedule
+func (st *ScheduleStore) Resume(id string) (*Schedule, bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	s, ok := st.byID[id]
+	if !ok {
+		return nil, false
+	}
+	s.resume(time.Now().UTC())
+	return s.snapshot(), true
+}
+
+// claimDue marks the schedules due at now as running and returns them
+func (st *ScheduleStore) claimDue(now time.Time) []*Schedule {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	var due []*Schedule
+	for _, s := range st.byID {
+		if s.Running || s.paused(now) || now.Before(s.next) {
+			continue
+		}
+		s.Running = true
+		due = append(due, s)
+	}
+	return due
+}
+
+// finish records the outcome of a run and sets the next one an interval after
+// it started. It returns the notice of the schedule's alert to send, if any.
+func (st *ScheduleStore) finish(s *Schedule, started time.Time, data map[string]interface{}, err error) *AlertNotice {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	s.Running = false
+	s.LastRun = &started
+	s.Runs++
+	s.next = started.Add(s.every)
+	if err != nil {
+		s.Failures++
+		s.LastError = err.Error()
+	} else {
+		s.LastError = ""
+		if id, ok := data["id"].(string); ok {
+			s.LastResult = id
+		}
+	}
+	return s.checkAlert(data, err)
+}
+
+// execute runs one scheduled request against the target's current profile
+func (s *Schedule) execute() (map[string]interface{}, error) {
+	var req RunRequest
+	if err := json.Unmarshal(s.Request, &req); err != nil {
+		return nil, err
+	}
+	req, profile, err := withProfileDefaults(req, s.Request)
+	if err != nil {
+		return nil, err
+	}
+	// The profile may have changed since the schedule was created
+	runner, _ := lookupRunner(s.Type)
+	if err := validateRunRequest(runner, req); err != nil {
+		return nil, err
+	}
+	end, err := drainer.begin()
+	if err != nil {
+		return nil, err
+	}
+	defer end()
+	if err := s.apiKey.takeTest(time.Now()); err != nil {
+		return nil, err
+	}
+	req.apiKey = s.apiKey
+	data, _, err := runner.Run(drainer.Context(), req, profile)
+	return data, err
+}
+
+// runScheduler starts due schedules every tick; a schedule never overlaps itself
+func runScheduler(st *ScheduleStore, tick time.Duration) {
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		if drainer.Draining() {
+			return
+		}
+		for _, s := range st.claimDue(now.UTC()) {
+			go func(s *Schedule, started time.Time) {
+				log.Printf("Schedule %s: %s test of %s", s.ID, s.Type, s.Target)
+				data, err := s.execute()
+				if err != nil {
+					log.Printf("Schedule %s failed: %v", s.ID, err)
+				}
+				if notice := st.finish(s, started, data, err); notice != nil {
+					notifyAlert(s.Alert, notice)
+				}
+			}(s, now.UTC())
+		}
+	}
+}
+
+func scheduleNotFound(w http.ResponseWriter, id string) {
+	jsonResponse(w, ApiResponse{
+		Status: "error",
+		Error:  fmt.Sprintf("schedule %s not found", id),
+	}, http.StatusNotFound)
+}
+
+// requestFieldErrors names the invalid fields of a ValidationError, if err is
+// one, as fields of the schedule's request
+func requestFieldErrors(err error) error {
+	var ve *ValidationError
+	if errors.As(err, &ve) {
+		for i := range ve.Fields {
+			ve.Fields[i].Field = "request." + ve.Fields[i].Field
+		}
+	}
+	return err
+}
+
+// newSchedule validates a schedule request; the test request is checked against the target's profile
+func newSchedule(sr ScheduleRequest) (*Schedule, error) {
+	testType := strings.ToLower(sr.Type)
+	runner, ok := lookupRunner(testType)
+	if !ok {
+		return nil, invalidTestType(sr.Type)
+	}
+	every, err := parseScheduleInterval(sr.Interval)
+	if err != nil {
+		return nil, err
+	}
+	if len(sr.Request) == 0 {
+		return nil, fmt.Errorf("request is required")
+	}
+	req, err := decodeRequestBody(sr.Request)
+	if err != nil {
+		return nil, requestFieldErrors(err)
+	}
+	switch testType {
+	case TEST_TYPE_TRANSFER, TEST_TYPE_HTTP, TEST_TYPE_RPM:
+		if req.ServerHost = transferHost(req.URL); req.ServerHost == "" {
+			return nil, fmt.Errorf("request.url is required")
+		}
+	case TEST_TYPE_S3:
+		if req.ServerHost = transferHost(req.Endpoint); req.ServerHost == "" {
+			return nil, fmt.Errorf("request.endpoint is required")
+		}
+	case TEST_TYPE_TCP_CONNECT:
+		if len(req.Targets) == 0 {
+			return nil, fmt.Errorf("request.targets is required")
+		}
+		if req.ServerHost = tcpConnectHost(req.Targets); req.ServerHost == "" {
+			req.ServerHost = req.Targets[0] // Several hosts: listed under the first target
+		}
+	}
+	if req.ServerHost == "" {
+		return nil, fmt.Errorf("request.server_host is required")
+	}
+	defaulted, _, err := withProfileDefaults(req, sr.Request)
+	if err != nil {
+		return nil, requestFieldErrors(err)
+	}
+	if err := validateRunRequest(runner, defaulted); err != nil {
+		return nil, requestFieldErrors(err)
+	}
+	s := &Schedule{
+		Type:     testType,
+		Target:   req.ServerHost,
+		Interval: every.String(),
+		Request:  sr.Request,
+		every:    every,
+	}
+	if sr.Alert != nil {
+		if err := validateAlert(testType, sr.Alert); err != nil {
+			return nil, err
+		}
+		s.Alert, s.AlertState = sr.Alert, &AlertState{State: ALERT_STATE_OK}
+	}
+	return s, nil
+}
+
+func scheduleCreate(w http.ResponseWriter, r *http.Request) {
+	var sr ScheduleRequest
+	if err := json.NewDecoder(r.Body).Decode(&sr); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s, err := newSchedule(sr)
+	if err != nil {
+		jsonResponse(w, ApiResponse{
+			Status: "error",
+			Data:   validationData(err),
+			Error:  err.Error(),
+			Code:   errorCode(err),
+		}, http.StatusBadRequest)
+		return
+	}
+	s.apiKey = apiKeyFrom(r)
+	s.APIKey = s.apiKey.Name()
+	jsonResponse(w, ApiResponse{
+		Status: "ok",
+		Data:   scheduleStore.Add(s),
+	}, http.StatusCreated)
+}
+
+func scheduleList(w http.ResponseWriter, r *http.Request) {
+	jsonResponse(w, ApiResponse{
+		Status: "ok",
+		Data:   scheduleStore.List(),
+	}, http.StatusOK)
+}
+
+func scheduleGet(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	s, ok := scheduleStore.Get(id)
+	if !ok {
+		scheduleNotFound(w, id)
+		return
+	}
+	jsonResponse(w, ApiResponse{
+		Status: "ok",
+		Data:   s,
+	}, http.StatusOK)
+}
+
+func scheduleDelete(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	if !scheduleStore.Delete(id) {
+		scheduleNotFound(w, id)
+		return
+	}
+	jsonResponse(w, ApiResponse{Status: "ok"}, http.StatusOK)
+}
+
+func schedulePause(w http.ResponseWriter, r *http.Request) {
+	var pr PauseRequest
+	body, err := io.ReadAll(r.Body)
+	if err == nil && len(body) > 0 {
+		err = json.Unmarshal(body, &pr)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var until *time.Time
+	if pr.Duration != "" {
+		d, err := time.ParseDuration(pr.Duration)
+		if err != nil || d <= 0 {
+			jsonResponse(w, ApiResponse{
+				Status: "error",
+				Error:  fmt.Sprintf("invalid duration %q (expected a positive duration such as 30m or 2h)", pr.Duration),
+			}, http.StatusBadRequest)
+			return
+		}
+		t := time.Now().UTC().Add(d)
+		until = &t
+	}
+
+	id := mux.Vars(r)["id"]
+	s, ok := scheduleStore.Pause(id, until, pr.Reason)
+	if !ok {
+		scheduleNotFound(w, id)
+		return
+	}
+	jsonResponse(w, ApiResponse{
+		Status: "ok",
+		Data:   s,
+	}, http.StatusOK)
+}
+
+func scheduleResume(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	s, ok := scheduleStore.Resume(id)
+	if !ok {
+		scheduleNotFound(w, id)
+		return
+	}
+	jsonResponse(w, ApiResponse{
+		Status: "ok",
+		Data:   s,
+	}, http.StatusOK)
+}
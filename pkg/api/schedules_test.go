@@ -0,0 +1,105 @@
+package api
+
+import (
+	"testing"
+	"time"
+)
+
+// scheduleDue reports whether claimDue runs s at now
+func scheduleDue(s *Schedule, now time.Time) bool {
+	st := NewScheduleStore()
+	st.byID["s1"] = s
+	return len(st.claimDue(now)) == 1
+}
+
+func TestSchedulePausedIsNotDue(t *testing.T) {
+	t0 := time.Date(2026, 1, 15, 10, 0, 0, 0, time.UTC)
+	s := &Schedule{State: SCHEDULE_STATE_ACTIVE, every: 5 * time.Minute, next: t0}
+
+	s.pause(t0, nil, "maintenance")
+	if scheduleDue(s, t0.Add(time.Hour)) {
+		t.Errorf("Expected a paused schedule never to be due")
+	}
+	if s.PauseReason != "maintenance" || s.PausedAt == nil || !s.PausedAt.Equal(t0) {
+		t.Errorf("Expected the pause to be recorded, got %+v", s)
+	}
+
+	s = &Schedule{State: SCHEDULE_STATE_ACTIVE, every: 5 * time.Minute, next: t0}
+	if !scheduleDue(s, t0) {
+		t.Errorf("Expected a new schedule to be due at once")
+	}
+	if !s.Running {
+		t.Errorf("Expected a claimed schedule to be marked running")
+	}
+}
+
+func TestScheduleResumeRunsOverdueOnce(t *testing.T) {
+	t0 := time.Date(2026, 1, 15, 10, 0, 0, 0, time.UTC)
+	s := &Schedule{State: SCHEDULE_STATE_ACTIVE, every: 5 * time.Minute, next: t0}
+	s.pause(t0, nil, "")
+
+	resumed := t0.Add(30 * time.Minute)
+	s.resume(resumed)
+	if !s.next.Equal(resumed) {
+		t.Errorf("Expected next run at resume time %v, got %v", resumed, s.next)
+	}
+	if s.State != SCHEDULE_STATE_ACTIVE || s.PausedAt != nil {
+		t.Errorf("Expected the pause to be cleared, got %+v", s)
+	}
+	if !scheduleDue(s, resumed) {
+		t.Errorf("Expected overdue schedule to run on resume")
+	}
+
+	// Not yet overdue: the original next run is kept
+	s = &Schedule{State: SCHEDULE_STATE_ACTIVE, every: 5 * time.Minute, next: t0}
+	s.pause(t0.Add(-2*time.Minute), nil, "")
+	s.resume(t0.Add(-time.Minute))
+	if !s.next.Equal(t0) {
+		t.Errorf("Expected next run %v to be kept, got %v", t0, s.next)
+	}
+}
+
+func TestScheduleTimedPauseExpires(t *testing.T) {
+	t0 := time.Date(2026, 1, 15, 10, 0, 0, 0, time.UTC)
+	until := t0.Add(2 * time.Hour)
+	s := &Schedule{State: SCHEDULE_STATE_ACTIVE, every: 5 * time.Minute, next: t0}
+	s.pause(t0, &until, "")
+
+	if scheduleDue(s, until.Add(-time.Second)) {
+		t.Errorf("Expected schedule to stay paused before paused_until")
+	}
+	if !scheduleDue(s, until) {
+		t.Errorf("Expected schedule to resume at paused_until")
+	}
+	if s.State != SCHEDULE_STATE_ACTIVE || s.PausedUntil != nil {
+		t.Errorf("Expected expired pause to be cleared")
+	}
+}
+
+func TestScheduleRunningIsNotDue(t *testing.T) {
+	t0 := time.Date(2026, 1, 15, 10, 0, 0, 0, time.UTC)
+	s := &Schedule{State: SCHEDULE_STATE_ACTIVE, every: time.Minute, next: t0, Running: true}
+
+	if scheduleDue(s, t0.Add(10*time.Minute)) {
+		t.Errorf("Expected a running schedule not to overlap itself")
+	}
+}
+
+func TestScheduleFinishSetsNextRun(t *testing.T) {
+	t0 := time.Date(2026, 1, 15, 10, 0, 0, 0, time.UTC)
+	st := NewScheduleStore()
+	s := &Schedule{State: SCHEDULE_STATE_ACTIVE, every: 5 * time.Minute, next: t0}
+	st.byID["s1"] = s
+
+	st.claimDue(t0)
+	st.finish(s, t0, map[string]interface{}{"id": "r1"}, nil)
+	if s.Running || s.Runs != 1 || s.LastResult != "r1" {
+		t.Errorf("Expected one finished run with result r1, got %+v", s)
+	}
+	if !s.next.Equal(t0.Add(5 * time.Minute)) {
+		t.Errorf("Expected the next run an interval after the start, got %v", s.next)
+	}
+	if len(st.claimDue(t0.Add(4*time.Minute))) != 0 {
+		t.Errorf("Expected no run before the interval passed")
+	}
+}
@@ -0,0 +1,68 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+)
+
+// SecretStore holds named credentials for tests against authenticated services.
+// Requests refer to an entry by name, so keys never appear in request bodies,
+// stored results or schedules.
+type SecretStore struct {
+	Secrets map[string]map[string]string `json:"secrets"`
+}
+
+var secretStore = &SecretStore{Secrets: map[string]map[string]string{}}
+
+// loadSecrets reads a secrets file of the form {"secrets": {"name": {"field": "value"}}}
+func loadSecrets(file string) (*SecretStore, error) {
+	info, err := os.Stat(file)
+	if err != nil {
+		return nil, err
+	}
+	if info.Mode().Perm()&0o077 != 0 {
+		log.Printf("Warning: secrets file %s is accessible by other users (mode %v)", file, info.Mode().Perm())
+	}
+	raw, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	store := &SecretStore{}
+	if err := json.Unmarshal(raw, store); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", file, err)
+	}
+	if store.Secrets == nil {
+		store.Secrets = map[string]map[string]string{}
+	}
+	return store, nil
+}
+
+// Lookup returns the named secret, checking that it has every required field
+func (s *SecretStore) Lookup(name string, required ...string) (map[string]string, error) {
+	secret, ok := s.Secrets[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown credentials %q (see SECRETS_FILE)", name)
+	}
+	for _, field := range required {
+		if secret[field] == "" {
+			return nil, fmt.Errorf("credentials %q have no %s", name, field)
+		}
+	}
+	return secret, nil
+}
+
+// configureSecrets loads SECRETS_FILE, if set
+func configureSecrets() {
+	file := os.Getenv("SECRETS_FILE")
+	if file == "" {
+		return
+	}
+	store, err := loadSecrets(file)
+	if err != nil {
+		log.Fatalf("Loading secrets failed: %v", err)
+	}
+	secretStore = store
+	log.Printf("Loaded %d credentials from %s", len(store.Secrets), file)
+}
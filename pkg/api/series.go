@@ -0,0 +1,101 @@
+package api
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"network-test-api/pkg/nettest"
+)
+
+// Time series defaults for the optional "series" section of test responses
+const (
+	DEFAULT_SERIES_MAX_POINTS = 300
+	MAX_SERIES_MAX_POINTS     = 10000
+)
+
+// SeriesPoint is a single sample of a test time series
+type SeriesPoint = nettest.SeriesPoint
+
+// Series is the time series returned alongside the aggregate results
+type Series struct {
+	Unit        string        `json:"unit"`
+	Points      []SeriesPoint `json:"points"`
+	TotalPoints int           `json:"total_points"` // Raw samples before capping
+	Downsampled bool          `json:"downsampled"`
+	Truncated   bool          `json:"truncated"`
+}
+
+// SeriesOptions controls whether and how a series is included in the response
+type SeriesOptions struct {
+	Enabled    bool
+	MaxPoints  int
+	Downsample string // mean, min, max or none (truncate)
+}
+
+// parseSeriesOptions applies defaults and validates the series request fields
+func parseSeriesOptions(enabled bool, maxPoints int, downsample string) (SeriesOptions, error) {
+	opts := SeriesOptions{Enabled: enabled, MaxPoints: maxPoints, Downsample: strings.ToLower(downsample)}
+	if opts.MaxPoints == 0 {
+		opts.MaxPoints = DEFAULT_SERIES_MAX_POINTS
+	}
+	if opts.MaxPoints < 1 || opts.MaxPoints > MAX_SERIES_MAX_POINTS {
+		return opts, fmt.Errorf("series_max_points must be between 1 and %d", MAX_SERIES_MAX_POINTS)
+	}
+	switch opts.Downsample {
+	case "":
+		opts.Downsample = "mean"
+	case "mean", "min", "max", "none":
+	default:
+		return opts, fmt.Errorf("invalid series_downsample %q (expected mean, min, max or none)", downsample)
+	}
+	return opts, nil
+}
+
+// buildSeries caps raw samples to opts.MaxPoints, either by merging
+// consecutive samples into buckets or, with downsample "none", by truncating.
+func buildSeries(unit string, raw []SeriesPoint, opts SeriesOptions) *Series {
+	s := &Series{Unit: unit, TotalPoints: len(raw), Points: raw}
+	if s.Points == nil {
+		s.Points = []SeriesPoint{}
+	}
+	if len(raw) <= opts.MaxPoints {
+		return s
+	}
+
+	if opts.Downsample == "none" {
+		s.Points = raw[:opts.MaxPoints]
+		s.Truncated = true
+		return s
+	}
+
+	points := make([]SeriesPoint, 0, opts.MaxPoints)
+	for b := 0; b < opts.MaxPoints; b++ {
+		lo := b * len(raw) / opts.MaxPoints
+		hi := (b + 1) * len(raw) / opts.MaxPoints
+		bucket := raw[lo:hi]
+
+		p := SeriesPoint{T: bucket[0].T, Count: len(bucket)}
+		switch opts.Downsample {
+		case "min":
+			p.Value = math.Inf(1)
+			for _, v := range bucket {
+				p.Value = math.Min(p.Value, v.Value)
+			}
+		case "max":
+			p.Value = math.Inf(-1)
+			for _, v := range bucket {
+				p.Value = math.Max(p.Value, v.Value)
+			}
+		default:
+			for _, v := range bucket {
+				p.Value += v.Value
+			}
+			p.Value /= float64(len(bucket))
+		}
+		points = append(points, p)
+	}
+	s.Points = points
+	s.Downsampled = true
+	return s
+}
@@ -0,0 +1,83 @@
+package api
+
+import (
+	"testing"
+)
+
+func makeSeries(values ...float64) []SeriesPoint {
+	points := make([]SeriesPoint, len(values))
+	for i, v := range values {
+		points[i] = SeriesPoint{T: float64(i), Value: v}
+	}
+	return points
+}
+
+func TestBuildSeries_UnderCap(t *testing.T) {
+	s := buildSeries("mbps", makeSeries(1, 2, 3), SeriesOptions{MaxPoints: 10, Downsample: "mean"})
+
+	if len(s.Points) != 3 || s.Downsampled || s.Truncated {
+		t.Errorf("Expected series unchanged, got %d points (downsampled=%v, truncated=%v)", len(s.Points), s.Downsampled, s.Truncated)
+	}
+}
+
+func TestBuildSeries_Empty(t *testing.T) {
+	s := buildSeries("rtt_ms", nil, SeriesOptions{MaxPoints: 10})
+
+	if s.Points == nil || len(s.Points) != 0 {
+		t.Errorf("Expected empty non-nil points, got %v", s.Points)
+	}
+}
+
+func TestBuildSeries_Mean(t *testing.T) {
+	s := buildSeries("mbps", makeSeries(1, 3, 5, 7), SeriesOptions{MaxPoints: 2, Downsample: "mean"})
+
+	if !s.Downsampled || len(s.Points) != 2 {
+		t.Fatalf("Expected 2 downsampled points, got %d", len(s.Points))
+	}
+	if s.Points[0].Value != 2 || s.Points[1].Value != 6 {
+		t.Errorf("Expected means [2 6], got [%v %v]", s.Points[0].Value, s.Points[1].Value)
+	}
+	if s.Points[1].T != 2 || s.Points[1].Count != 2 {
+		t.Errorf("Expected second bucket at t=2 with 2 samples, got t=%v count=%d", s.Points[1].T, s.Points[1].Count)
+	}
+	if s.TotalPoints != 4 {
+		t.Errorf("Expected TotalPoints=4, got %d", s.TotalPoints)
+	}
+}
+
+func TestBuildSeries_MinMax(t *testing.T) {
+	raw := makeSeries(4, 1, 9, 2, 8, 3)
+
+	minS := buildSeries("rtt_ms", raw, SeriesOptions{MaxPoints: 2, Downsample: "min"})
+	if minS.Points[0].Value != 1 || minS.Points[1].Value != 2 {
+		t.Errorf("Expected mins [1 2], got [%v %v]", minS.Points[0].Value, minS.Points[1].Value)
+	}
+
+	maxS := buildSeries("rtt_ms", raw, SeriesOptions{MaxPoints: 2, Downsample: "max"})
+	if maxS.Points[0].Value != 9 || maxS.Points[1].Value != 8 {
+		t.Errorf("Expected maxes [9 8], got [%v %v]", maxS.Points[0].Value, maxS.Points[1].Value)
+	}
+}
+
+func TestBuildSeries_UnevenBucketsCoverAllSamples(t *testing.T) {
+	s := buildSeries("mbps", makeSeries(1, 1, 1, 1, 1, 1, 1), SeriesOptions{MaxPoints: 3, Downsample: "mean"})
+
+	total := 0
+	for _, p := range s.Points {
+		total += p.Count
+	}
+	if total != 7 {
+		t.Errorf("Expected buckets to cover 7 samples, got %d", total)
+	}
+}
+
+func TestBuildSeries_Truncate(t *testing.T) {
+	s := buildSeries("mbps", makeSeries(1, 2, 3, 4, 5), SeriesOptions{MaxPoints: 2, Downsample: "none"})
+
+	if !s.Truncated || s.Downsampled {
+		t.Errorf("Expected truncated (not downsampled) series")
+	}
+	if len(s.Points) != 2 || s.Points[1].Value != 2 {
+		t.Errorf("Expected first 2 points kept, got %v", s.Points)
+	}
+}
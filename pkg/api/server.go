@@ -0,0 +1,459 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// API Version
+const API_VERSION = "2.2.0"
+
+// writeTestResponse reports the outcome of a test run
+func writeTestResponse(w http.ResponseWriter, data map[string]interface{}, status int, err error) {
+	if err != nil {
+		jsonResponse(w, ApiResponse{
+			Status: "error",
+			Data:   validationData(err),
+			Error:  err.Error(),
+			Code:   errorCode(err),
+		}, status)
+		return
+	}
+	jsonResponse(w, ApiResponse{
+		Status: "ok",
+		Data:   data,
+	}, status)
+}
+
+func jsonResponse(w http.ResponseWriter, resp ApiResponse, status int) {
+	resp.RequestID = w.Header().Get(REQUEST_ID_HEADER)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+func handleRoot(w http.ResponseWriter, r *http.Request) {
+	contentType := r.Header.Get("Content-Type")
+
+	if contentType == "application/json" {
+		jsonResponse(w, ApiResponse{
+			Status: "ok",
+			Data:   openAPI(),
+		}, http.StatusOK)
+		return
+	}
+
+	// HTML Documentation
+	htmlTemplate := `<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>Network Test API - Documentation</title>
+    <style>
+        * {
+            margin: 0;
+            padding: 0;
+            box-sizing: border-box;
+        }
+        body {
+            font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, Oxygen, Ubuntu, sans-serif;
+            background: #f5f7fa;
+            color: #333;
+            line-height: 1.6;
+        }
+        .container {
+            max-width: 1200px;
+            margin: 0 auto;
+            padding: 20px;
+        }
+        header {
+            background: linear-gradient(135deg, #667eea 0%, #764ba2 100%);
+            color: white;
+            padding: 60px 20px;
+            text-align: center;
+        }
+        header h1 {
+            font-size: 2.5rem;
+            margin-bottom: 10px;
+        }
+        header p {
+            font-size: 1.2rem;
+            opacity: 0.9;
+        }
+        .version {
+            display: inline-block;
+            background: rgba(255,255,255,0.2);
+            padding: 5px 15px;
+            border-radius: 20px;
+            margin-top: 15px;
+            font-size: 0.9rem;
+        }
+        nav {
+            background: white;
+            padding: 15px 20px;
+            box-shadow: 0 2px 4px rgba(0,0,0,0.1);
+            position: sticky;
+            top: 0;
+            z-index: 100;
+        }
+        nav ul {
+            list-style: none;
+            display: flex;
+            gap: 30px;
+            justify-content: center;
+        }
+        nav a {
+            color: #667eea;
+            text-decoration: none;
+            font-weight: 500;
+            transition: color 0.2s;
+        }
+        nav a:hover {
+            color: #764ba2;
+        }
+        .tag-title {
+            margin-top: 50px;
+            font-size: 1.5rem;
+            color: #333;
+        }
+        .tag-description {
+            margin-top: 10px;
+            color: #555;
+            line-height: 1.6;
+        }
+        .endpoint {
+            background: white;
+            border-radius: 12px;
+            margin: 30px 0;
+            box-shadow: 0 4px 6px rgba(0,0,0,0.07);
+            overflow: hidden;
+        }
+        .endpoint-header {
+            padding: 20px 25px;
+            border-bottom: 1px solid #eee;
+            display: flex;
+            align-items: center;
+            gap: 15px;
+        }
+        .method {
+            padding: 6px 14px;
+            border-radius: 6px;
+            font-weight: 700;
+            font-size: 0.85rem;
+            text-transform: uppercase;
+        }
+        .method-post {
+            background: #49cc90;
+            color: white;
+        }
+        .method-get {
+            background: #61affe;
+            color: white;
+        }
+        .method-put {
+            background: #fca130;
+            color: white;
+        }
+        .method-delete {
+            background: #f93e3e;
+            color: white;
+        }
+        .path {
+            font-family: 'Monaco', 'Menlo', monospace;
+            font-size: 1.1rem;
+            color: #333;
+        }
+        .endpoint-body {
+            padding: 25px;
+        }
+        .description {
+            color: #666;
+            margin-bottom: 25px;
+            font-size: 1.05rem;
+        }
+        .section-title {
+            font-size: 0.85rem;
+            text-transform: uppercase;
+            letter-spacing: 1px;
+            color: #999;
+            margin-bottom: 12px;
+            font-weight: 600;
+        }
+        .params-table {
+            width: 100%;
+            border-collapse: collapse;
+            margin-bottom: 25px;
+        }
+        .params-table th,
+        .params-table td {
+            padding: 12px 15px;
+            text-align: left;
+            border-bottom: 1px solid #eee;
+        }
+        .params-table th {
+            background: #f8f9fa;
+            font-weight: 600;
+            color: #555;
+            font-size: 0.9rem;
+        }
+        .param-name {
+            font-family: monospace;
+            color: #e83e8c;
+            font-weight: 500;
+        }
+        .param-type {
+            color: #6c757d;
+            font-size: 0.9rem;
+        }
+        .param-required {
+            color: #dc3545;
+            font-size: 0.8rem;
+            font-weight: 600;
+        }
+        .param-optional {
+            color: #28a745;
+            font-size: 0.8rem;
+        }
+        .param-default {
+            font-family: monospace;
+            background: #e9ecef;
+            padding: 2px 6px;
+            border-radius: 4px;
+            font-size: 0.85rem;
+        }
+        .code-block {
+            background: #2d3748;
+            color: #e2e8f0;
+            padding: 20px;
+            border-radius: 8px;
+            overflow-x: auto;
+            font-family: 'Monaco', 'Menlo', monospace;
+            font-size: 0.9rem;
+            margin-bottom: 20px;
+        }
+        .code-block pre {
+            margin: 0;
+            white-space: pre-wrap;
+            word-wrap: break-word;
+        }
+        .response-section {
+            margin-top: 25px;
+            padding-top: 25px;
+            border-top: 1px solid #eee;
+        }
+        footer {
+            text-align: center;
+            padding: 40px 20px;
+            color: #999;
+            font-size: 0.9rem;
+        }
+        .tip {
+            background: #fff3cd;
+            border-left: 4px solid #ffc107;
+            padding: 15px 20px;
+            margin: 20px 0;
+            border-radius: 0 8px 8px 0;
+        }
+        .tip-title {
+            font-weight: 600;
+            color: #856404;
+            margin-bottom: 5px;
+        }
+    </style>
+</head>
+<body>
+    <header>
+        <h1>Network Test API</h1>
+        <p>API for network performance testing (bandwidth and latency)</p>
+        <span class="version">v{{VERSION}}</span>
+    </header>
+
+    <nav>
+        <ul>{{NAV}}
+        </ul>
+    </nav>
+
+    <div class="container">
+        <div class="tip">
+            <div class="tip-title">API Tip</div>
+            This documentation is rendered from the OpenAPI 3.0 document at <a href="/openapi.json"><code>/openapi.json</code></a>, which client generators and request validators read. Request this endpoint with <code>Content-Type: application/json</code> header to get it wrapped in the response envelope.
+        </div>
+{{SECTIONS}}    </div>
+
+    <footer>
+        <p>Network Test API v{{VERSION}} - Native iperf3 Protocol Implementation</p>
+        <p style="margin-top: 15px;">
+            Created by <a href="https://github.com/CoreTex" style="color: #667eea; text-decoration: none;">CoreTex</a>
+        </p>
+        <p style="margin-top: 10px;">
+            <a href="https://www.buymeacoffee.com/networkcoder" target="_blank">
+                <img src="https://www.buymeacoffee.com/assets/img/custom_images/orange_img.png" alt="Buy Me A Coffee" style="height: 41px; width: 174px;">
+            </a>
+        </p>
+    </footer>
+</body>
+</html>`
+	nav, sections := openAPI().renderHTML()
+	html := strings.NewReplacer("{{VERSION}}", API_VERSION, "{{NAV}}", nav, "{{SECTIONS}}", sections).Replace(htmlTemplate)
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte(html))
+}
+
+// Main runs the agent: one test from the command line when the arguments
+// name one, the API server otherwise. It is all the network-test-api binary does.
+func Main() {
+	// network-test-api <test> runs one test from the command line (cli.go)
+	if isCLI(os.Args[1:]) {
+		os.Exit(runCLI(os.Args[1:], os.Stdout, os.Stderr))
+	}
+	registerRunners()
+	loadConfig()
+	configureLogging()
+	configureProfiles()
+	configureSecrets()
+	configureKnownHosts()
+	configureRootStores()
+	configureNDT7()
+	configureRPM()
+	configureCoordination()
+	configurePeers()
+	configureWebhooks()
+	configureAlerts()
+	configureEsmond()
+	configureInflux()
+	configureTelemetry()
+	configureImpairments()
+	configureTunnels()
+	configureTestTimeout()
+	configureTargetPolicy()
+	configureAPIKeys()
+	configureShutdown()
+	configureTestLimiter()
+	configureResultHistory()
+	configureLegacyAPI()
+
+	r := mux.NewRouter()
+	r.Use(requestIDs)
+	r.Use(traceRequests)
+	r.Use(apiKeyAuth)
+	mountAPI(r, registerRoutes)
+
+	go runScheduler(scheduleStore, SCHEDULE_TICK)
+
+	listener := configureListener()
+	log.Println("🚀 Network Test API listening on " + listener.String())
+	log.Println("📦 Pure Go implementation - Fastly Compute ready")
+	if err := listener.serve(r); err != nil {
+		log.Fatal(err)
+	}
+	log.Println("Shut down")
+}
+
+// registerRoutes registers the API's routes on r, which mountAPI serves
+// under API_PATH_PREFIX and unversioned
+func registerRoutes(r *mux.Router) {
+	// Client endpoints
+	r.HandleFunc("/iperf/client/run", clientRunHandler(TEST_TYPE_IPERF3)).Methods("POST")
+	r.HandleFunc("/twamp/client/run", clientRunHandler(TEST_TYPE_TWAMP)).Methods("POST")
+	r.HandleFunc("/transfer/client/run", clientRunHandler(TEST_TYPE_TRANSFER)).Methods("POST")
+	r.HandleFunc("/http/client/run", clientRunHandler(TEST_TYPE_HTTP)).Methods("POST")
+	r.HandleFunc("/s3/client/run", clientRunHandler(TEST_TYPE_S3)).Methods("POST")
+	r.HandleFunc("/ssh/client/run", clientRunHandler(TEST_TYPE_SSH)).Methods("POST")
+	r.HandleFunc("/pmtu/client/run", clientRunHandler(TEST_TYPE_PMTU)).Methods("POST")
+	r.HandleFunc("/mtu/client/run", clientRunHandler(TEST_TYPE_PMTU)).Methods("POST")
+	r.HandleFunc("/stun/client/run", clientRunHandler(TEST_TYPE_STUN)).Methods("POST")
+	r.HandleFunc("/nat64/client/run", clientRunHandler(TEST_TYPE_NAT64)).Methods("POST")
+	r.HandleFunc("/ping/client/run", clientRunHandler(TEST_TYPE_PING)).Methods("POST")
+	r.HandleFunc("/traceroute/client/run", clientRunHandler(TEST_TYPE_TRACEROUTE)).Methods("POST")
+	r.HandleFunc("/owamp/client/run", clientRunHandler(TEST_TYPE_OWAMP)).Methods("POST")
+	r.HandleFunc("/tls/client/run", clientRunHandler(TEST_TYPE_TLS)).Methods("POST")
+	r.HandleFunc("/ndt7/client/run", clientRunHandler(TEST_TYPE_NDT7)).Methods("POST")
+	r.HandleFunc("/bufferbloat/client/run", clientRunHandler(TEST_TYPE_BUFFERBLOAT)).Methods("POST")
+	r.HandleFunc("/rpm/client/run", clientRunHandler(TEST_TYPE_RPM)).Methods("POST")
+	r.HandleFunc("/tcp/connect/run", clientRunHandler(TEST_TYPE_TCP_CONNECT)).Methods("POST")
+
+	// One test template against many targets
+	r.HandleFunc("/mesh/run", meshRun).Methods("POST")
+
+	// Agent-to-agent mesh between the peers of this agent
+	r.HandleFunc("/peers", peerList).Methods("GET")
+	r.HandleFunc("/peers/mesh/run", peerMeshRun).Methods("POST")
+
+	// TWAMP Session-Reflector for other senders
+	r.HandleFunc("/twamp/server", reflectorStatus).Methods("GET")
+	r.HandleFunc("/twamp/server/start", reflectorStart).Methods("POST")
+	r.HandleFunc("/twamp/server/stop", reflectorStop).Methods("POST")
+	r.HandleFunc("/echo/server", echoServerStatus).Methods("GET")
+	r.HandleFunc("/echo/server/start", echoServerStart).Methods("POST")
+	r.HandleFunc("/echo/server/stop", echoServerStop).Methods("POST")
+
+	// Stored results
+	r.HandleFunc("/results", resultList).Methods("GET")
+	r.HandleFunc("/results/aggregate", resultAggregate).Methods("GET")
+	r.HandleFunc("/results/compare", resultCompare).Methods("GET")
+	r.HandleFunc("/results/flent", resultFlent).Methods("GET")
+	r.HandleFunc("/results/{id}", resultGet).Methods("GET")
+	r.HandleFunc("/results/{id1}/diff/{id2}", resultDiff).Methods("GET")
+
+	// Per-target profiles
+	r.HandleFunc("/profiles", profilesList).Methods("GET")
+
+	// Effective configuration, secrets redacted
+	r.HandleFunc("/config", configGet).Methods("GET")
+
+	// Recurring tests and monitors
+	r.HandleFunc("/jobs", jobList).Methods("GET")
+	r.HandleFunc("/jobs/{id}", jobGet).Methods("GET")
+	r.HandleFunc("/jobs/{id}/stream", jobStream).Methods("GET")
+	r.HandleFunc("/jobs/{id}/probes", jobProbes).Methods("GET")
+	r.HandleFunc("/jobs/{id}/cancel", jobCancel).Methods("POST")
+	r.HandleFunc("/schedules", scheduleCreate).Methods("POST")
+	r.HandleFunc("/schedules", scheduleList).Methods("GET")
+	r.HandleFunc("/schedules/{id}", scheduleGet).Methods("GET")
+	r.HandleFunc("/schedules/{id}", scheduleDelete).Methods("DELETE")
+	r.HandleFunc("/schedules/{id}/pause", schedulePause).Methods("POST")
+	r.HandleFunc("/schedules/{id}/resume", scheduleResume).Methods("POST")
+	r.HandleFunc("/alerts", alertList).Methods("GET")
+
+	// Heavy test coordination; any agent can act as the coordinator of others
+	r.HandleFunc("/locks", lockList).Methods("GET")
+	r.HandleFunc("/locks", lockAcquire).Methods("POST")
+	r.HandleFunc("/locks/{token}/renew", lockRenew).Methods("POST")
+	r.HandleFunc("/locks/{token}", lockRelease).Methods("DELETE")
+
+	// Result webhook deliveries
+	r.HandleFunc("/webhooks/deliveries", deliveryList).Methods("GET")
+	r.HandleFunc("/webhooks/deliveries/{id}", deliveryGet).Methods("GET")
+	r.HandleFunc("/webhooks/deliveries/{id}/redeliver", deliveryRedeliver).Methods("POST")
+	r.HandleFunc("/webhooks/dead-letter", deliveryDeadLetter).Methods("GET")
+
+	// Lab impairment emulation (tc/netem), behind ADMIN_TOKEN
+	r.HandleFunc("/admin/impairments", adminAuth(impairmentList)).Methods("GET")
+	r.HandleFunc("/admin/impairments/{interface}", adminAuth(impairmentApply)).Methods("PUT")
+	r.HandleFunc("/admin/impairments/{interface}", adminAuth(impairmentClear)).Methods("DELETE")
+
+	// Prometheus / OpenMetrics
+	r.HandleFunc("/metrics", metricsHandler).Methods("GET")
+
+	// Health/Info
+	r.HandleFunc("/status", limiterStatus).Methods("GET")
+	r.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		if drainer.Draining() {
+			jsonResponse(w, ApiResponse{Status: "draining"}, http.StatusServiceUnavailable)
+			return
+		}
+		jsonResponse(w, ApiResponse{Status: "healthy"}, http.StatusOK)
+	}).Methods("GET")
+
+	// Documentation
+	r.HandleFunc("/openapi.json", openAPIHandler).Methods("GET")
+	r.HandleFunc("/", handleRoot).Methods("GET")
+}
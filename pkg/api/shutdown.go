@@ -0,0 +1,145 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// Graceful shutdown: on SIGTERM or SIGINT the agent starts no more tests,
+// refusing new ones with 503 and code ERR_SHUTTING_DOWN, and waits up to
+// SHUTDOWN_GRACE_PERIOD for the running ones, asynchronous jobs and scheduled
+// runs included, to finish. Tests still running then are canceled, which
+// closes their iperf3 streams and TWAMP sessions; a second signal cancels
+// them at once.
+const (
+	ERR_SHUTTING_DOWN = "ERR_SHUTTING_DOWN"
+
+	DEFAULT_SHUTDOWN_GRACE_PERIOD = 25 * time.Second // Within the 30s Kubernetes waits before it kills a pod
+	SHUTDOWN_CANCEL_WAIT          = 5 * time.Second  // For canceled tests to close their connections and report
+	SHUTDOWN_HTTP_TIMEOUT         = 5 * time.Second  // For responses in flight once the tests ended
+)
+
+var errShuttingDown = errors.New("agent shutting down")
+
+// Drainer tracks the running tests, so that shutdown can wait for them
+type Drainer struct {
+	ctx    context.Context // Parent of every test's context, canceled once the grace period ends
+	cancel context.CancelCauseFunc
+	grace  time.Duration
+
+	mu       sync.Mutex
+	draining bool
+	running  int
+	idle     chan struct{} // Closed once draining with no test running
+}
+
+// NewDrainer creates a drainer that waits up to grace for running tests
+func NewDrainer(grace time.Duration) *Drainer {
+	d := &Drainer{grace: grace, idle: make(chan struct{})}
+	d.ctx, d.cancel = context.WithCancelCause(context.Background())
+	return d
+}
+
+var drainer = NewDrainer(DEFAULT_SHUTDOWN_GRACE_PERIOD)
+
+// configureShutdown reads SHUTDOWN_GRACE_PERIOD, if set
+func configureShutdown() {
+	v := os.Getenv("SHUTDOWN_GRACE_PERIOD")
+	if v == "" {
+		return
+	}
+	grace, err := time.ParseDuration(v)
+	if err != nil || grace < 0 {
+		log.Fatalf("Invalid SHUTDOWN_GRACE_PERIOD %q (expected a non-negative duration, e.g. 25s)", v)
+	}
+	drainer.grace = grace
+}
+
+// Context is the parent of every test's context, which ends tests still
+// running after the grace period
+func (d *Drainer) Context() context.Context {
+	return d.ctx
+}
+
+// Draining reports whether the agent is shutting down
+func (d *Drainer) Draining() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.draining
+}
+
+// begin counts a test as running until the returned func is called, or
+// refuses it with ERR_SHUTTING_DOWN
+func (d *Drainer) begin() (func(), error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.draining {
+		return nil, &codedError{ERR_SHUTTING_DOWN, fmt.Errorf("the agent is shutting down and starts no new tests")}
+	}
+	d.running++
+	var once sync.Once
+	return func() { once.Do(d.end) }, nil
+}
+
+func (d *Drainer) end() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.running--
+	if d.draining && d.running == 0 {
+		close(d.idle)
+	}
+}
+
+// drain refuses new tests from now on and returns how many still run;
+// d.idle closes once none do
+func (d *Drainer) drain() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.draining = true
+	if d.running == 0 {
+		close(d.idle)
+	}
+	return d.running
+}
+
+// shutdown drains the running tests, canceling them after the grace period
+// or on another signal, stops the TWAMP reflector and then srv
+func (d *Drainer) shutdown(srv *http.Server, signals <-chan os.Signal) {
+	if running := d.drain(); running > 0 {
+		log.Printf("Waiting up to %s for %d running tests", d.grace, running)
+	}
+	grace := time.NewTimer(d.grace)
+	defer grace.Stop()
+	select {
+	case <-d.idle:
+	case <-grace.C:
+		log.Printf("Grace period over, canceling the running tests")
+	case sig := <-signals:
+		log.Printf("Received %s again, canceling the running tests", sig)
+	}
+	d.cancel(errShuttingDown)
+	select {
+	case <-d.idle:
+	case <-time.After(SHUTDOWN_CANCEL_WAIT):
+		log.Printf("Tests still running %s after they were canceled", SHUTDOWN_CANCEL_WAIT)
+	}
+
+	twampServerStore.Stop()
+	echoServerStore.Stop()
+	ctx, cancel := context.WithTimeout(context.Background(), SHUTDOWN_HTTP_TIMEOUT)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Printf("Closing the remaining connections: %v", err)
+		srv.Close()
+	}
+
+	exportCtx, cancelExport := context.WithTimeout(context.Background(), OTEL_EXPORT_TIMEOUT)
+	defer cancelExport()
+	telemetry.Shutdown(exportCtx)
+}
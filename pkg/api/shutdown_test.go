@@ -0,0 +1,50 @@
+package api
+
+import (
+	"testing"
+	"time"
+)
+
+func idle(d *Drainer) bool {
+	select {
+	case <-d.idle:
+		return true
+	case <-time.After(10 * time.Millisecond):
+		return false
+	}
+}
+
+func TestDrainerWaitsForRunningTests(t *testing.T) {
+	d := NewDrainer(time.Minute)
+	end1, _ := d.begin()
+	end2, _ := d.begin()
+
+	if running := d.drain(); running != 2 {
+		t.Fatalf("expected 2 running tests, got %d", running)
+	}
+	if _, err := d.begin(); errorCode(err) != ERR_SHUTTING_DOWN {
+		t.Error("expected new tests to be refused while draining")
+	}
+
+	end1()
+	end1() // Ending twice counts once
+	if idle(d) {
+		t.Fatal("expected the drainer to wait for the second test")
+	}
+	end2()
+	if !idle(d) {
+		t.Error("expected the drainer to be idle once both tests ended")
+	}
+}
+
+func TestDrainerIdleWithoutTests(t *testing.T) {
+	d := NewDrainer(time.Minute)
+	end, _ := d.begin()
+	end()
+	if running := d.drain(); running != 0 {
+		t.Fatalf("expected no running tests, got %d", running)
+	}
+	if !idle(d) {
+		t.Error("expected the drainer to be idle at once")
+	}
+}
@@ -0,0 +1,817 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"network-test-api/pkg/nettest"
+)
+
+// File transfers over SSH with scp or sftp, for links that only allow SSH
+const (
+	SSH_PROTOCOL_SCP  = "scp"
+	SSH_PROTOCOL_SFTP = "sftp"
+
+	DEFAULT_SSH_PORT        = 22
+	DEFAULT_SSH_DURATION    = 60
+	DEFAULT_SSH_UPLOAD_PATH = "/dev/null"
+	SSH_UPLOAD_NAME         = "network-test-api.bin" // File name sent when remote_path is a directory
+
+	SSH_WINDOW_SIZE    = 16 << 20 // Receive window; bounds a download's throughput to window/RTT
+	SSH_CHANNEL_PACKET = 32 << 10 // Largest data packet sent or accepted
+	SSH_STDERR_LIMIT   = 4 << 10  // Remote stderr kept for error messages
+
+	sshMsgUserAuthRequest        = 50
+	sshMsgUserAuthFailure        = 51
+	sshMsgUserAuthSuccess        = 52
+	sshMsgUserAuthBanner         = 53
+	sshMsgUserAuthPasswdChange   = 60
+	sshMsgGlobalRequest          = 80
+	sshMsgRequestFailure         = 82
+	sshMsgChannelOpen            = 90
+	sshMsgChannelOpenConfirm     = 91
+	sshMsgChannelOpenFailure     = 92
+	sshMsgChannelWindowAdjust    = 93
+	sshMsgChannelData            = 94
+	sshMsgChannelExtendedData    = 95
+	sshMsgChannelEOF             = 96
+	sshMsgChannelClose           = 97
+	sshMsgChannelRequest         = 98
+	sshMsgChannelSuccess         = 99
+	sshMsgChannelFailure         = 100
+	sshDisconnectByApplication   = 11
+	sshCredentialsPassword       = "password"
+	sshCredentialsPrivateKey     = "private_key"
+	sshCredentialsHostKeyPinning = "host_key_fingerprint"
+)
+
+// SSHTimings are the phases of an SSH transfer in milliseconds
+type SSHTimings struct {
+	DialMs     float64 `json:"dial_ms"`     // Name resolution and TCP connect
+	KexMs      float64 `json:"kex_ms"`      // Version exchange and key exchange
+	AuthMs     float64 `json:"auth_ms"`     // User authentication
+	SetupMs    float64 `json:"setup_ms"`    // Dial, key exchange and authentication: the cost of each new connection
+	ChannelMs  float64 `json:"channel_ms"`  // Opening the session, starting scp or sftp and opening the file
+	TransferMs float64 `json:"transfer_ms"` // The phase goodput is measured over
+	TotalMs    float64 `json:"total_ms"`
+}
+
+// SSHInfo describes the negotiated connection
+type SSHInfo struct {
+	ServerVersion      string `json:"server_version"`
+	Kex                string `json:"kex"`
+	HostKeyType        string `json:"host_key_type"`
+	HostKeyFingerprint string `json:"host_key_fingerprint"` // SHA256, as ssh-keygen -l prints it
+	HostKeyVerified    bool   `json:"host_key_verified"`    // Matched host_key_fingerprint or SSH_KNOWN_HOSTS
+	Cipher             string `json:"cipher"`
+	MAC                string `json:"mac,omitempty"`
+	AuthMethod         string `json:"auth_method"` // publickey or password
+	Rekeys             int    `json:"rekeys"`
+}
+
+// SSHResult is the outcome of an SSH transfer test
+type SSHResult struct {
+	Protocol    string              `json:"protocol"`
+	Direction   string              `json:"direction"`
+	RemotePath  string              `json:"remote_path"`
+	Bytes       int64               `json:"bytes"`
+	Truncated   bool                `json:"truncated"` // Download stopped at size before the end of the file
+	GoodputMbps float64             `json:"goodput_mbps"`
+	SSH         SSHInfo             `json:"ssh"`
+	Timings     SSHTimings          `json:"timings"`
+	Dial        *nettest.DialReport `json:"dial"`
+
+	startedAt time.Time
+}
+
+// sshCredentials are the SECRETS_FILE fields of an SSH login
+type sshCredentials struct {
+	User        string
+	Password    string
+	Signer      *sshSigner
+	Fingerprint string
+}
+
+// sshCredentialsFor looks up the request's credentials and parses the private key
+func sshCredentialsFor(req RunRequest) (*sshCredentials, error) {
+	secret, err := secretStore.Lookup(req.Credentials, "username")
+	if err != nil {
+		return nil, err
+	}
+	creds := &sshCredentials{User: secret["username"], Password: secret[sshCredentialsPassword]}
+	if key := secret[sshCredentialsPrivateKey]; key != "" {
+		if creds.Signer, err = parseSSHPrivateKey(key); err != nil {
+			return nil, fmt.Errorf("credentials %q: %v", req.Credentials, err)
+		}
+	}
+	if creds.Signer == nil && creds.Password == "" {
+		return nil, fmt.Errorf("credentials %q have no %s or %s", req.Credentials, sshCredentialsPrivateKey, sshCredentialsPassword)
+	}
+	creds.Fingerprint = req.HostKeyFingerprint
+	if creds.Fingerprint == "" {
+		creds.Fingerprint = secret[sshCredentialsHostKeyPinning]
+	}
+	if creds.Fingerprint == "" && knownHosts == nil && !req.InsecureSkipHostKey {
+		return nil, fmt.Errorf("host_key_fingerprint is required unless SSH_KNOWN_HOSTS is set (or set insecure_skip_host_key to accept any host key)")
+	}
+	return creds, nil
+}
+
+// normalizeFingerprint accepts fingerprints with or without the SHA256: prefix and base64 padding
+func normalizeFingerprint(fp string) string {
+	return "SHA256:" + strings.TrimRight(strings.TrimPrefix(strings.TrimSpace(fp), "SHA256:"), "=")
+}
+
+// verifySSHHostKey decides whether credentials may be sent to the server that
+// presented blob: it must match the pinned fingerprint or, without one, a key
+// SSH_KNOWN_HOSTS lists for the server. An unknown key is accepted unverified
+// only with insecure_skip_host_key.
+func verifySSHHostKey(req RunRequest, creds *sshCredentials, keyType string, blob []byte) (bool, error) {
+	fp := sshFingerprint(blob)
+	if creds.Fingerprint != "" {
+		if normalizeFingerprint(creds.Fingerprint) != fp {
+			return false, fmt.Errorf("host key %s %s does not match host_key_fingerprint %s", keyType, fp, creds.Fingerprint)
+		}
+		return true, nil
+	}
+	if knownHosts != nil {
+		known, err := knownHosts.check(req.ServerHost, req.ServerPort, keyType, blob)
+		if known || err != nil {
+			return known, err
+		}
+	}
+	if req.InsecureSkipHostKey {
+		return false, nil
+	}
+	return false, fmt.Errorf("host key %s %s of %s is not verified: pin host_key_fingerprint, list it in SSH_KNOWN_HOSTS or set insecure_skip_host_key", keyType, fp, req.ServerHost)
+}
+
+// validateSSH checks and defaults the SSH fields of a request
+func validateSSH(req *RunRequest) error {
+	switch req.Protocol = strings.ToLower(req.Protocol); req.Protocol {
+	case "":
+		req.Protocol = SSH_PROTOCOL_SCP
+	case SSH_PROTOCOL_SCP, SSH_PROTOCOL_SFTP:
+	default:
+		return fmt.Errorf("invalid protocol %q (expected scp or sftp)", req.Protocol)
+	}
+	switch req.Direction = strings.ToLower(req.Direction); req.Direction {
+	case "":
+		req.Direction = TRANSFER_UPLOAD
+	case TRANSFER_DOWNLOAD, TRANSFER_UPLOAD:
+	default:
+		return fmt.Errorf("invalid direction %q (expected download or upload)", req.Direction)
+	}
+	if req.Direction == TRANSFER_UPLOAD {
+		if req.Size == 0 {
+			req.Size = DEFAULT_UPLOAD_SIZE
+		}
+		if req.RemotePath == "" {
+			req.RemotePath = DEFAULT_SSH_UPLOAD_PATH
+		}
+	}
+	switch {
+	case req.ServerHost == "":
+		return fmt.Errorf("server_host is required")
+	case req.ServerPort < 1 || req.ServerPort > 65535:
+		return fmt.Errorf("server_port must be between 1 and 65535")
+	case req.Credentials == "":
+		return fmt.Errorf("credentials is required")
+	case req.RemotePath == "":
+		return fmt.Errorf("remote_path is required for downloads")
+	case req.Size < 0 || req.Size > MAX_TRANSFER_SIZE:
+		return fmt.Errorf("size must be between 0 and %d bytes", int64(MAX_TRANSFER_SIZE))
+	case req.Duration < 1 || req.Duration > MAX_TRANSFER_DURATION:
+		return fmt.Errorf("duration must be between 1 and %d seconds", MAX_TRANSFER_DURATION)
+	case req.Series:
+		return fmt.Errorf("series is not available for ssh tests")
+	}
+	return nil
+}
+
+// sshClient is an authenticated connection with a single session channel
+type sshClient struct {
+	t *sshTransport
+
+	remoteID     uint32
+	remoteMax    uint32
+	mu           sync.Mutex
+	cond         *sync.Cond
+	remoteWindow uint32
+	buf          bytes.Buffer // Data received and not read yet
+	consumed     uint32       // Bytes read since the last window adjust
+	stderr       bytes.Buffer
+	eof, closed  bool
+	sentClose    bool
+	exitStatus   int // -1 until the server reports it
+	err          error
+	replies      chan bool // Answers to channel requests
+}
+
+// authenticate logs in with the private key, falling back to the password
+func (c *sshClient) authenticate(creds *sshCredentials) (string, error) {
+	t := c.t
+	if err := t.writePacket(newSSHMessage(sshMsgServiceRequest).string("ssh-userauth").b); err != nil {
+		return "", err
+	}
+	for {
+		msg, err := t.readPacket()
+		if err != nil {
+			return "", err
+		}
+		if msg[0] == sshMsgServiceAccept {
+			break
+		}
+		if msg[0] != sshMsgExtInfo {
+			return "", fmt.Errorf("ssh: expected SERVICE_ACCEPT, got message %d", msg[0])
+		}
+	}
+
+	var offered []string
+	if creds.Signer != nil {
+		s := creds.Signer
+		signed := new(sshWriter).bytes(t.sessionID).byte(sshMsgUserAuthRequest).string(creds.User).string("ssh-connection").
+			string("publickey").bool(true).string(s.Algorithm).bytes(s.PublicKey).b
+		sig, err := s.Sign(signed)
+		if err != nil {
+			return "", err
+		}
+		if err := t.writePacket(append(signed[4+len(t.sessionID):], new(sshWriter).bytes(sig).b...)); err != nil {
+			return "", err
+		}
+		ok, methods, err := c.authResult()
+		if err != nil || ok {
+			return "publickey", err
+		}
+		offered = methods
+	}
+	if creds.Password != "" {
+		msg := newSSHMessage(sshMsgUserAuthRequest).string(creds.User).string("ssh-connection").
+			string("password").bool(false).string(creds.Password)
+		if err := t.writePacket(msg.b); err != nil {
+			return "", err
+		}
+		ok, methods, err := c.authResult()
+		if err != nil || ok {
+			return "password", err
+		}
+		offered = methods
+	}
+	return "", fmt.Errorf("authentication failed for user %q (server accepts %s)", creds.User, strings.Join(offered, ", "))
+}
+
+// authResult waits for the answer to a USERAUTH_REQUEST, skipping banners
+func (c *sshClient) authResult() (bool, []string, error) {
+	for {
+		msg, err := c.t.readPacket()
+		if err != nil {
+			return false, nil, err
+		}
+		switch msg[0] {
+		case sshMsgUserAuthSuccess:
+			return true, nil, nil
+		case sshMsgUserAuthFailure:
+			r := &sshReader{b: msg[1:]}
+			return false, r.nameList(), nil
+		case sshMsgUserAuthPasswdChange:
+			return false, nil, fmt.Errorf("server requires a password change")
+		case sshMsgUserAuthBanner, sshMsgGlobalRequest:
+		default:
+			return false, nil, fmt.Errorf("ssh: unexpected message %d during authentication", msg[0])
+		}
+	}
+}
+
+// openSession opens the session channel and starts the dispatch loop
+func (c *sshClient) openSession() error {
+	open := newSSHMessage(sshMsgChannelOpen).string("session").uint32(0).uint32(SSH_WINDOW_SIZE).uint32(SSH_CHANNEL_PACKET)
+	if err := c.t.writePacket(open.b); err != nil {
+		return err
+	}
+	for {
+		msg, err := c.t.readPacket()
+		if err != nil {
+			return err
+		}
+		r := &sshReader{b: msg[1:]}
+		switch msg[0] {
+		case sshMsgChannelOpenConfirm:
+			r.uint32() // Our channel number
+			c.remoteID, c.remoteWindow, c.remoteMax = r.uint32(), r.uint32(), r.uint32()
+			if r.err != nil || c.remoteMax < 64 {
+				return fmt.Errorf("ssh: malformed channel confirmation")
+			}
+			c.cond = sync.NewCond(&c.mu)
+			c.exitStatus = -1
+			c.replies = make(chan bool, 1)
+			go c.loop()
+			return nil
+		case sshMsgChannelOpenFailure:
+			r.uint32()
+			code := r.uint32()
+			return fmt.Errorf("server refused the session channel: %s (code %d)", r.string(), code)
+		case sshMsgGlobalRequest:
+			if err := c.answerGlobalRequest(r); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (c *sshClient) answerGlobalRequest(r *sshReader) error {
+	r.string()
+	if r.bool() {
+		return c.t.writePacket([]byte{sshMsgRequestFailure})
+	}
+	return nil
+}
+
+// loop reads packets for the channel until the connection fails or the channel closes
+func (c *sshClient) loop() {
+	defer close(c.replies)
+	for {
+		msg, err := c.t.readPacket()
+		if err == nil && msg[0] == sshMsgKexInit {
+			err = c.t.rekey(msg)
+		}
+		if err != nil {
+			c.fail(err)
+			return
+		}
+		r := &sshReader{b: msg[1:]}
+		if msg[0] == sshMsgGlobalRequest {
+			if err := c.answerGlobalRequest(r); err != nil {
+				c.fail(err)
+				return
+			}
+			continue
+		}
+		r.uint32() // Our channel number; there is only one
+
+		c.mu.Lock()
+		switch msg[0] {
+		case sshMsgChannelWindowAdjust:
+			c.remoteWindow += r.uint32()
+		case sshMsgChannelData:
+			c.buf.Write(r.bytes())
+		case sshMsgChannelExtendedData:
+			r.uint32()
+			data := r.bytes()
+			if c.stderr.Len() < SSH_STDERR_LIMIT {
+				c.stderr.Write(data)
+			}
+			// Stderr counts against the window like data
+			c.consumed += uint32(len(data))
+		case sshMsgChannelEOF:
+			c.eof = true
+		case sshMsgChannelClose:
+			c.closed = true
+		case sshMsgChannelRequest:
+			name, wantReply := r.string(), r.bool()
+			if name == "exit-status" {
+				c.exitStatus = int(r.uint32())
+			}
+			if wantReply {
+				go func() { _ = c.t.writePacket(newSSHMessage(sshMsgChannelFailure).uint32(c.remoteID).b) }()
+			}
+		case sshMsgChannelSuccess, sshMsgChannelFailure:
+			select {
+			case c.replies <- msg[0] == sshMsgChannelSuccess:
+			default:
+			}
+		}
+		closed := c.closed
+		c.cond.Broadcast()
+		c.mu.Unlock()
+		if closed {
+			c.closeChannel()
+			return
+		}
+	}
+}
+
+func (c *sshClient) fail(err error) {
+	c.mu.Lock()
+	if c.err == nil {
+		c.err = err
+	}
+	c.cond.Broadcast()
+	c.mu.Unlock()
+}
+
+// request sends a channel request (exec or subsystem) and waits for the answer
+func (c *sshClient) request(name, arg string) error {
+	msg := newSSHMessage(sshMsgChannelRequest).uint32(c.remoteID).string(name).bool(true).string(arg)
+	if err := c.t.writePacket(msg.b); err != nil {
+		return err
+	}
+	ok, open := <-c.replies
+	if !open {
+		return c.remoteError(c.loopError())
+	}
+	if !ok {
+		return fmt.Errorf("server refused %s %q", name, arg)
+	}
+	return nil
+}
+
+// loopError is why the dispatch loop stopped
+func (c *sshClient) loopError() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return c.err
+	}
+	return errors.New("channel closed by server")
+}
+
+// Write sends data on the channel as the server's window allows
+func (c *sshClient) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		c.mu.Lock()
+		for c.remoteWindow == 0 && c.err == nil && !c.closed {
+			c.cond.Wait()
+		}
+		if c.err != nil || c.closed {
+			c.mu.Unlock()
+			return written, c.remoteError(c.loopError())
+		}
+		n := min(len(p), int(c.remoteWindow), int(c.remoteMax)-9, SSH_CHANNEL_PACKET)
+		c.remoteWindow -= uint32(n)
+		c.mu.Unlock()
+
+		if err := c.t.writePacket(newSSHMessage(sshMsgChannelData).uint32(c.remoteID).bytes(p[:n]).b); err != nil {
+			return written, err
+		}
+		written += n
+		p = p[n:]
+	}
+	return written, nil
+}
+
+// Read returns channel data, reopening the window as it is consumed
+func (c *sshClient) Read(p []byte) (int, error) {
+	c.mu.Lock()
+	for c.buf.Len() == 0 && !c.eof && !c.closed && c.err == nil {
+		c.cond.Wait()
+	}
+	if c.buf.Len() == 0 {
+		err := c.err
+		c.mu.Unlock()
+		if err == nil {
+			err = io.EOF
+		}
+		return 0, err
+	}
+	n, _ := c.buf.Read(p)
+	c.consumed += uint32(n)
+	var adjust uint32
+	if c.consumed >= SSH_WINDOW_SIZE/2 {
+		adjust, c.consumed = c.consumed, 0
+	}
+	c.mu.Unlock()
+
+	if adjust > 0 {
+		if err := c.t.writePacket(newSSHMessage(sshMsgChannelWindowAdjust).uint32(c.remoteID).uint32(adjust).b); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// CloseWrite sends EOF, telling scp or sftp there is no more input
+func (c *sshClient) CloseWrite() error {
+	return c.t.writePacket(newSSHMessage(sshMsgChannelEOF).uint32(c.remoteID).b)
+}
+
+func (c *sshClient) closeChannel() {
+	c.mu.Lock()
+	sent := c.sentClose
+	c.sentClose = true
+	c.mu.Unlock()
+	if !sent {
+		_ = c.t.writePacket(newSSHMessage(sshMsgChannelClose).uint32(c.remoteID).b)
+	}
+}
+
+// wait blocks until the server closes the channel and returns an error for a
+// failed remote command
+func (c *sshClient) wait() error {
+	c.mu.Lock()
+	for !c.closed && c.err == nil {
+		c.cond.Wait()
+	}
+	err, status := c.err, c.exitStatus
+	c.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	if status > 0 {
+		return c.remoteError(fmt.Errorf("remote command exited with status %d", status))
+	}
+	return nil
+}
+
+// remoteError adds what the remote command printed on stderr to err
+func (c *sshClient) remoteError(err error) error {
+	c.mu.Lock()
+	stderr := strings.TrimSpace(c.stderr.String())
+	c.mu.Unlock()
+	if stderr == "" {
+		return err
+	}
+	return fmt.Errorf("%v: %s", err, stderr)
+}
+
+// Close ends the connection politely
+func (c *sshClient) Close() {
+	_ = c.t.writePacket(newSSHMessage(sshMsgDisconnect).uint32(sshDisconnectByApplication).string("test finished").string("").b)
+	_ = c.t.conn.Close()
+}
+
+// shellQuote quotes s for the remote user's shell
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// scpStatus reads an scp acknowledgement: 0, or 1 (warning) and 2 (error) with a message line
+func scpStatus(r *bufio.Reader) error {
+	b, err := r.ReadByte()
+	if err != nil {
+		return err
+	}
+	if b == 0 {
+		return nil
+	}
+	msg, _ := r.ReadString('\n')
+	if b == 1 || b == 2 {
+		return scpError(msg)
+	}
+	return fmt.Errorf("unexpected reply %q", string(b)+msg)
+}
+
+// scpError is the message of a failed scp, which OpenSSH prefixes with "scp: "
+func scpError(msg string) error {
+	return errors.New(strings.TrimPrefix(strings.TrimSpace(msg), "scp: "))
+}
+
+// parseSCPHeader parses the "C<mode> <size> <name>" line starting a file
+func parseSCPHeader(line string) (int64, string, error) {
+	fields := strings.SplitN(strings.TrimSuffix(line, "\n"), " ", 3)
+	if len(fields) != 3 || len(fields[0]) != 5 || fields[0][0] != 'C' {
+		return 0, "", fmt.Errorf("unexpected header %q", strings.TrimSpace(line))
+	}
+	size, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil || size < 0 {
+		return 0, "", fmt.Errorf("invalid file size %q", fields[1])
+	}
+	return size, fields[2], nil
+}
+
+// scpTransfer runs scp -t or scp -f on the server and times the file data
+func scpTransfer(c *sshClient, req RunRequest, payload nettest.PayloadEntropy, result *SSHResult) (time.Time, time.Time, error) {
+	var start, end time.Time
+	flag := "-f"
+	if req.Direction == TRANSFER_UPLOAD {
+		flag = "-t"
+	}
+	if err := c.request("exec", "scp "+flag+" "+shellQuote(req.RemotePath)); err != nil {
+		return start, end, err
+	}
+	r := bufio.NewReaderSize(c, TRANSFER_BUFFER_SIZE)
+
+	if req.Direction == TRANSFER_UPLOAD {
+		if err := scpStatus(r); err != nil {
+			return start, end, c.remoteError(err)
+		}
+		if _, err := fmt.Fprintf(c, "C0644 %d %s\n", req.Size, SSH_UPLOAD_NAME); err != nil {
+			return start, end, err
+		}
+		if err := scpStatus(r); err != nil {
+			return start, end, c.remoteError(err)
+		}
+		start = time.Now()
+		n, err := io.CopyBuffer(c, newPayloadReader(payload, req.Size), make([]byte, SSH_CHANNEL_PACKET))
+		result.Bytes = n
+		if err == nil {
+			_, err = c.Write([]byte{0})
+		}
+		if err == nil {
+			// Acknowledged once the server has written the whole file
+			err = scpStatus(r)
+		}
+		if err != nil {
+			return start, end, c.remoteError(err)
+		}
+		end = time.Now()
+		if err := c.CloseWrite(); err != nil {
+			return start, end, err
+		}
+		return start, end, c.wait()
+	}
+
+	if _, err := c.Write([]byte{0}); err != nil {
+		return start, end, err
+	}
+	var size int64
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return start, end, c.remoteError(err)
+		}
+		switch line[0] {
+		case 1, 2:
+			return start, end, scpError(line[1:])
+		case 'D':
+			return start, end, fmt.Errorf("remote_path %s is a directory", req.RemotePath)
+		case 'T': // Times, sent only with -p
+			if _, err := c.Write([]byte{0}); err != nil {
+				return start, end, err
+			}
+			continue
+		}
+		if size, _, err = parseSCPHeader(line); err != nil {
+			return start, end, err
+		}
+		break
+	}
+	if _, err := c.Write([]byte{0}); err != nil {
+		return start, end, err
+	}
+
+	want := size
+	if req.Size > 0 && req.Size < size {
+		want, result.Truncated = req.Size, true
+	}
+	start = time.Now()
+	n, err := io.CopyN(io.Discard, r, want)
+	result.Bytes = n
+	if err != nil {
+		return start, end, c.remoteError(err)
+	}
+	end = time.Now()
+	if result.Truncated {
+		return start, end, nil
+	}
+	if err := scpStatus(r); err != nil {
+		return start, end, err
+	}
+	if _, err := c.Write([]byte{0}); err != nil {
+		return start, end, err
+	}
+	if err := c.CloseWrite(); err != nil {
+		return start, end, err
+	}
+	return start, end, c.wait()
+}
+
+// sshTest connects, authenticates and transfers a file, timing each phase
+func sshTest(ctx context.Context, req RunRequest, creds *sshCredentials, payload nettest.PayloadEntropy) (*SSHResult, error) {
+	result := &SSHResult{Protocol: req.Protocol, Direction: req.Direction, RemotePath: req.RemotePath, startedAt: time.Now()}
+	start := result.startedAt
+	deadline, _ := ctx.Deadline()
+
+	conn, dial, err := nettest.DialControl(req.ServerHost, req.ServerPort, req.AddressFamily, time.Until(deadline))
+	result.Dial = dial
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = conn.Close() }()
+	_ = conn.SetDeadline(deadline)
+	dialDone := time.Now()
+
+	info := &result.SSH
+	t := newSSHTransport(conn, func(keyType string, blob []byte) (err error) {
+		info.HostKeyFingerprint = sshFingerprint(blob)
+		info.HostKeyVerified, err = verifySSHHostKey(req, creds, keyType, blob)
+		return err
+	})
+	if err := t.handshake(); err != nil {
+		return nil, fmt.Errorf("key exchange: %w", err)
+	}
+	kexDone := time.Now()
+	info.ServerVersion, info.Kex, info.HostKeyType = t.ServerVersion, t.Algorithms.Kex, t.HostKeyType
+	info.Cipher, info.MAC = t.Algorithms.Cipher, t.Algorithms.MAC
+
+	c := &sshClient{t: t}
+	if info.AuthMethod, err = c.authenticate(creds); err != nil {
+		return nil, err
+	}
+	authDone := time.Now()
+	if err := c.openSession(); err != nil {
+		return nil, err
+	}
+	defer c.Close()
+
+	var phaseStart, phaseEnd time.Time
+	if req.Protocol == SSH_PROTOCOL_SFTP {
+		phaseStart, phaseEnd, err = sftpTransfer(c, req, payload, result)
+	} else {
+		phaseStart, phaseEnd, err = scpTransfer(c, req, payload, result)
+	}
+	if err != nil {
+		if result.Bytes > 0 {
+			return nil, fmt.Errorf("%s after %d bytes: %w", req.Protocol, result.Bytes, err)
+		}
+		return nil, fmt.Errorf("%s: %w", req.Protocol, err)
+	}
+	info.Rekeys = t.rekeyCount()
+
+	tm := &result.Timings
+	tm.DialMs = sinceMs(start, dialDone)
+	tm.KexMs = sinceMs(dialDone, kexDone)
+	tm.AuthMs = sinceMs(kexDone, authDone)
+	tm.SetupMs = sinceMs(start, authDone)
+	tm.ChannelMs = sinceMs(authDone, phaseStart)
+	tm.TransferMs = sinceMs(phaseStart, phaseEnd)
+	tm.TotalMs = sinceMs(start, time.Now())
+	result.GoodputMbps = goodputMbps(result.Bytes, phaseEnd.Sub(phaseStart))
+	return result, nil
+}
+
+// runSSH applies defaults to a decoded request, runs the SSH transfer test and records the result.
+// Errors come with the HTTP status to report them with.
+func runSSH(req RunRequest, profile *Profile) (map[string]interface{}, int, error) {
+	if req.ServerPort == 0 {
+		req.ServerPort = DEFAULT_SSH_PORT
+	}
+	if req.Duration == 0 {
+		req.Duration = DEFAULT_SSH_DURATION
+	}
+	if err := checkProfileLimits(req, profile); err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	payload, err := nettest.ParsePayloadEntropy(req.Payload)
+	if err == nil {
+		err = validateSSH(&req)
+	}
+	var creds *sshCredentials
+	if err == nil {
+		creds, err = sshCredentialsFor(req)
+	}
+	if err == nil {
+		req.AddressFamily, err = parseAddressFamily(req.AddressFamily)
+	}
+	if err == nil {
+		err = validateLockWait(&req)
+	}
+	if err == nil {
+		err = validateCallbackURL(req.CallbackURL)
+	}
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	lock, release, status, err := lockTest(TEST_TYPE_SSH, req, true)
+	if err != nil {
+		return nil, status, err
+	}
+	defer release()
+
+	logf(req.ctx, "SSH test: %s %s %s:%d %s (size=%d, %ds limit, family=%s)",
+		req.Protocol, req.Direction, req.ServerHost, req.ServerPort, req.RemotePath, req.Size, req.Duration, req.AddressFamily)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(req.Duration)*time.Second)
+	defer cancel()
+	result, err := sshTest(ctx, req, creds, payload)
+	if err != nil {
+		if ctx.Err() != nil {
+			err = fmt.Errorf("transfer did not finish within %ds: %v", req.Duration, err)
+		}
+		return nil, http.StatusInternalServerError, fmt.Errorf("SSH test failed: %v", err)
+	}
+
+	data := map[string]interface{}{
+		"server":       req.ServerHost,
+		"port":         req.ServerPort,
+		"protocol":     result.Protocol,
+		"direction":    result.Direction,
+		"remote_path":  result.RemotePath,
+		"bytes":        result.Bytes,
+		"truncated":    result.Truncated,
+		"goodput_mbps": result.GoodputMbps,
+		"duration_sec": result.Timings.TotalMs / 1000,
+		"timings":      result.Timings,
+		"ssh":          result.SSH,
+		"dial":         result.Dial,
+	}
+	if profile != nil {
+		data["profile"] = profile.Name
+	}
+	data["lock"] = lock
+
+	recordResult(TEST_TYPE_SSH, req, result.startedAt, data)
+	notifyCallback(req.CallbackURL, data)
+
+	return data, http.StatusOK, nil
+}
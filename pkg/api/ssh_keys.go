@@ -0,0 +1,229 @@
+package api
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// sshFingerprint formats a public key blob the way ssh-keygen -l does
+func sshFingerprint(blob []byte) string {
+	sum := sha256.Sum256(blob)
+	return "SHA256:" + base64.RawStdEncoding.EncodeToString(sum[:])
+}
+
+// verifyHostKeySignature checks the server's signature over the exchange hash
+// with the host key it presented (RFC 8709, RFC 5656, RFC 8332)
+func verifyHostKeySignature(algorithm string, blob, exchangeHash, signature []byte) error {
+	key := &sshReader{b: blob}
+	keyType := key.string()
+	sig := &sshReader{b: signature}
+	sigType, sigBlob := sig.string(), sig.bytes()
+	if sig.err != nil || sigType != algorithm {
+		return fmt.Errorf("ssh: malformed host key signature")
+	}
+
+	var ok bool
+	switch algorithm {
+	case "ssh-ed25519":
+		pub := key.bytes()
+		if key.err != nil || keyType != algorithm || len(pub) != ed25519.PublicKeySize {
+			return fmt.Errorf("ssh: malformed %s host key", algorithm)
+		}
+		ok = ed25519.Verify(pub, exchangeHash, sigBlob)
+	case "ecdsa-sha2-nistp256":
+		key.string() // Curve name
+		x, y := elliptic.Unmarshal(elliptic.P256(), key.bytes())
+		if key.err != nil || keyType != algorithm || x == nil {
+			return fmt.Errorf("ssh: malformed %s host key", algorithm)
+		}
+		rs := &sshReader{b: sigBlob}
+		r, s := rs.mpint(), rs.mpint()
+		if rs.err != nil {
+			return fmt.Errorf("ssh: malformed host key signature")
+		}
+		digest := sha256.Sum256(exchangeHash)
+		ok = ecdsa.Verify(&ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, digest[:], r, s)
+	case "rsa-sha2-256", "rsa-sha2-512":
+		e, n := key.mpint(), key.mpint()
+		if key.err != nil || keyType != "ssh-rsa" || !e.IsInt64() {
+			return fmt.Errorf("ssh: malformed %s host key", algorithm)
+		}
+		pub := &rsa.PublicKey{N: n, E: int(e.Int64())}
+		if algorithm == "rsa-sha2-256" {
+			digest := sha256.Sum256(exchangeHash)
+			ok = rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], sigBlob) == nil
+		} else {
+			digest := sha512.Sum512(exchangeHash)
+			ok = rsa.VerifyPKCS1v15(pub, crypto.SHA512, digest[:], sigBlob) == nil
+		}
+	default:
+		return fmt.Errorf("ssh: unsupported host key algorithm %s", algorithm)
+	}
+	if !ok {
+		return fmt.Errorf("ssh: host key signature does not verify")
+	}
+	return nil
+}
+
+// sshSigner is a client key for publickey authentication
+type sshSigner struct {
+	Algorithm string // Signature algorithm, e.g. rsa-sha2-256 for RSA keys
+	PublicKey []byte // Public key blob
+	key       crypto.Signer
+}
+
+// Sign returns an SSH signature blob over data
+func (s *sshSigner) Sign(data []byte) ([]byte, error) {
+	switch key := s.key.(type) {
+	case ed25519.PrivateKey:
+		return new(sshWriter).string(s.Algorithm).bytes(ed25519.Sign(key, data)).b, nil
+	case *rsa.PrivateKey:
+		digest := sha256.Sum256(data)
+		sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+		if err != nil {
+			return nil, err
+		}
+		return new(sshWriter).string(s.Algorithm).bytes(sig).b, nil
+	case *ecdsa.PrivateKey:
+		digest := sha256.Sum256(data)
+		r, sv, err := ecdsa.Sign(rand.Reader, key, digest[:])
+		if err != nil {
+			return nil, err
+		}
+		return new(sshWriter).string(s.Algorithm).bytes(new(sshWriter).mpint(r).mpint(sv).b).b, nil
+	}
+	return nil, fmt.Errorf("ssh: unsupported key type %T", s.key)
+}
+
+// newSSHSigner wraps an ed25519, RSA or P-256 ECDSA private key
+func newSSHSigner(key crypto.Signer) (*sshSigner, error) {
+	switch k := key.(type) {
+	case ed25519.PrivateKey:
+		pub := k.Public().(ed25519.PublicKey)
+		return &sshSigner{Algorithm: "ssh-ed25519", PublicKey: new(sshWriter).string("ssh-ed25519").bytes(pub).b, key: k}, nil
+	case *rsa.PrivateKey:
+		blob := new(sshWriter).string("ssh-rsa").mpint(big.NewInt(int64(k.E))).mpint(k.N).b
+		return &sshSigner{Algorithm: "rsa-sha2-256", PublicKey: blob, key: k}, nil
+	case *ecdsa.PrivateKey:
+		if k.Curve != elliptic.P256() {
+			return nil, fmt.Errorf("only P-256 ECDSA keys are supported")
+		}
+		point := elliptic.Marshal(k.Curve, k.X, k.Y)
+		blob := new(sshWriter).string("ecdsa-sha2-nistp256").string("nistp256").bytes(point).b
+		return &sshSigner{Algorithm: "ecdsa-sha2-nistp256", PublicKey: blob, key: k}, nil
+	}
+	return nil, fmt.Errorf("unsupported private key type %T", key)
+}
+
+// parseSSHPrivateKey reads an unencrypted private key in OpenSSH format or in
+// PEM PKCS#1, PKCS#8 or SEC 1 form
+func parseSSHPrivateKey(data string) (*sshSigner, error) {
+	block, _ := pem.Decode([]byte(strings.TrimSpace(data)))
+	if block == nil {
+		return nil, fmt.Errorf("private key is not PEM encoded")
+	}
+	if strings.Contains(block.Headers["Proc-Type"], "ENCRYPTED") {
+		return nil, fmt.Errorf("encrypted private keys are not supported")
+	}
+
+	var key interface{}
+	var err error
+	switch block.Type {
+	case "OPENSSH PRIVATE KEY":
+		key, err = parseOpenSSHPrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+		if k, ok := key.(*ed25519.PrivateKey); ok {
+			key = *k
+		}
+	default:
+		return nil, fmt.Errorf("unsupported private key type %q", block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid private key: %w", err)
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key type %T", key)
+	}
+	return newSSHSigner(signer)
+}
+
+// parseOpenSSHPrivateKey decodes the openssh-key-v1 format written by ssh-keygen
+func parseOpenSSHPrivateKey(data []byte) (crypto.Signer, error) {
+	const magic = "openssh-key-v1\x00"
+	if !strings.HasPrefix(string(data), magic) {
+		return nil, fmt.Errorf("not an openssh-key-v1 key")
+	}
+	r := &sshReader{b: data[len(magic):]}
+	cipherName, kdfName := r.string(), r.string()
+	r.bytes() // KDF options
+	if keys := r.uint32(); keys != 1 {
+		return nil, fmt.Errorf("expected one key, got %d", keys)
+	}
+	r.bytes() // Public key, repeated in the private section
+	private := &sshReader{b: r.bytes()}
+	if r.err != nil {
+		return nil, errSSHShort
+	}
+	if cipherName != "none" || kdfName != "none" {
+		return nil, errors.New("encrypted private keys are not supported")
+	}
+	if private.uint32() != private.uint32() {
+		return nil, errors.New("corrupt private section")
+	}
+
+	keyType := private.string()
+	var key crypto.Signer
+	switch keyType {
+	case "ssh-ed25519":
+		private.bytes() // Public key
+		seed := private.bytes()
+		if len(seed) != ed25519.PrivateKeySize {
+			return nil, errSSHShort
+		}
+		key = ed25519.PrivateKey(append([]byte(nil), seed...))
+	case "ssh-rsa":
+		n, e, d, _, p, q := private.mpint(), private.mpint(), private.mpint(), private.mpint(), private.mpint(), private.mpint()
+		if private.err != nil || !e.IsInt64() {
+			return nil, errSSHShort
+		}
+		rsaKey := &rsa.PrivateKey{PublicKey: rsa.PublicKey{N: n, E: int(e.Int64())}, D: d, Primes: []*big.Int{p, q}}
+		if err := rsaKey.Validate(); err != nil {
+			return nil, err
+		}
+		rsaKey.Precompute()
+		key = rsaKey
+	case "ecdsa-sha2-nistp256":
+		private.string() // Curve name
+		x, y := elliptic.Unmarshal(elliptic.P256(), private.bytes())
+		d := private.mpint()
+		if private.err != nil || x == nil {
+			return nil, errSSHShort
+		}
+		key = &ecdsa.PrivateKey{PublicKey: ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, D: d}
+	default:
+		return nil, fmt.Errorf("unsupported key type %s", keyType)
+	}
+	if private.err != nil {
+		return nil, errSSHShort
+	}
+	return key, nil
+}
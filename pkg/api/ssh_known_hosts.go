@@ -0,0 +1,196 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// knownHost is one key line of an OpenSSH known_hosts file
+type knownHost struct {
+	revoked  bool
+	patterns []string // Host patterns, possibly hashed (|1|salt|hash) or negated (!pattern)
+	blob     []byte   // Public key; the key type field is not kept since the blob names it
+}
+
+// sshKnownHosts are the host keys SSH tests accept without host_key_fingerprint
+type sshKnownHosts struct {
+	file  string
+	hosts []knownHost
+}
+
+// knownHosts is SSH_KNOWN_HOSTS, or nil when it is not set
+var knownHosts *sshKnownHosts
+
+// parseKnownHosts reads known_hosts lines as ssh(1) does. @cert-authority lines
+// are skipped since the agent does not accept host certificates.
+func parseKnownHosts(r io.Reader) ([]knownHost, error) {
+	var hosts []knownHost
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64<<10), 1<<20)
+	for n := 1; sc.Scan(); n++ {
+		fields := strings.Fields(sc.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		var h knownHost
+		if strings.HasPrefix(fields[0], "@") {
+			switch fields[0] {
+			case "@revoked":
+				h.revoked = true
+			case "@cert-authority":
+				continue
+			default:
+				return nil, fmt.Errorf("line %d: unknown marker %s", n, fields[0])
+			}
+			fields = fields[1:]
+		}
+		if len(fields) < 3 {
+			return nil, fmt.Errorf("line %d: expected hosts, key type and key", n)
+		}
+		blob, err := base64.StdEncoding.DecodeString(fields[2])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: key: %v", n, err)
+		}
+		h.patterns = strings.Split(fields[0], ",")
+		h.blob = blob
+		hosts = append(hosts, h)
+	}
+	return hosts, sc.Err()
+}
+
+// loadKnownHosts reads a known_hosts file
+func loadKnownHosts(file string) (*sshKnownHosts, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+	hosts, err := parseKnownHosts(f)
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %w", file, err)
+	}
+	return &sshKnownHosts{file: file, hosts: hosts}, nil
+}
+
+// configureKnownHosts loads SSH_KNOWN_HOSTS, if set
+func configureKnownHosts() {
+	file := os.Getenv("SSH_KNOWN_HOSTS")
+	if file == "" {
+		return
+	}
+	k, err := loadKnownHosts(file)
+	if err != nil {
+		log.Fatalf("Loading SSH known hosts failed: %v", err)
+	}
+	knownHosts = k
+	log.Printf("Loaded %d SSH host keys from %s", len(k.hosts), file)
+}
+
+// knownHostName is how known_hosts names a server: the bare host on port 22, [host]:port otherwise
+func knownHostName(host string, port int) string {
+	host = strings.ToLower(host)
+	if port == DEFAULT_SSH_PORT {
+		return host
+	}
+	return "[" + host + "]:" + strconv.Itoa(port)
+}
+
+// matches reports whether the line's patterns name host. A matching negated
+// pattern excludes the host whatever the other patterns say.
+func (h knownHost) matches(name string) bool {
+	matched := false
+	for _, p := range h.patterns {
+		negated := strings.HasPrefix(p, "!")
+		if negated {
+			p = p[1:]
+		}
+		if !knownHostPatternMatch(p, name) {
+			continue
+		}
+		if negated {
+			return false
+		}
+		matched = true
+	}
+	return matched
+}
+
+// knownHostPatternMatch matches one pattern: a hashed name, or a name with * and ? wildcards
+func knownHostPatternMatch(pattern, name string) bool {
+	if strings.HasPrefix(pattern, "|1|") {
+		parts := strings.Split(pattern[3:], "|")
+		if len(parts) != 2 {
+			return false
+		}
+		salt, err1 := base64.StdEncoding.DecodeString(parts[0])
+		want, err2 := base64.StdEncoding.DecodeString(parts[1])
+		if err1 != nil || err2 != nil {
+			return false
+		}
+		mac := hmac.New(sha1.New, salt)
+		mac.Write([]byte(name))
+		return hmac.Equal(mac.Sum(nil), want)
+	}
+	return wildcardMatch(strings.ToLower(pattern), name)
+}
+
+// wildcardMatch matches name against a pattern where * is any run of characters and ? any one
+func wildcardMatch(pattern, name string) bool {
+	for pattern != "" {
+		switch pattern[0] {
+		case '*':
+			for i := len(name); i >= 0; i-- {
+				if wildcardMatch(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if name == "" {
+				return false
+			}
+		default:
+			if name == "" || name[0] != pattern[0] {
+				return false
+			}
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return name == ""
+}
+
+// check looks up the key a server presented. It reports whether the key is
+// listed for the server, and fails when the key is revoked or the server is
+// listed only with other keys, as ssh(1) does.
+func (k *sshKnownHosts) check(host string, port int, keyType string, blob []byte) (bool, error) {
+	name := knownHostName(host, port)
+	listed, known := false, false
+	for _, h := range k.hosts {
+		if !h.matches(name) {
+			continue
+		}
+		// Blobs are compared alone: an rsa-sha2-512 host key is listed as ssh-rsa
+		switch {
+		case h.revoked && bytes.Equal(h.blob, blob):
+			return false, fmt.Errorf("host key %s %s is revoked in %s", keyType, sshFingerprint(blob), k.file)
+		case h.revoked:
+		case bytes.Equal(h.blob, blob):
+			listed, known = true, true
+		default:
+			listed = true
+		}
+	}
+	if listed && !known {
+		return false, fmt.Errorf("host key %s %s of %s does not match %s", keyType, sshFingerprint(blob), name, k.file)
+	}
+	return known, nil
+}
@@ -0,0 +1,325 @@
+package api
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
+
+	"network-test-api/pkg/nettest"
+)
+
+// SFTP version 3 (draft-ietf-secsh-filexfer-02), the version OpenSSH speaks
+const (
+	SFTP_VERSION      = 3
+	SFTP_CHUNK_SIZE   = 32 << 10 // Bytes per READ or WRITE, the size every server accepts
+	SFTP_MAX_REQUESTS = 64       // Requests in flight, as the OpenSSH sftp client
+
+	sftpInit    = 1
+	sftpVersion = 2
+	sftpOpen    = 3
+	sftpClose   = 4
+	sftpRead    = 5
+	sftpWrite   = 6
+	sftpFstat   = 8
+	sftpStatus  = 101
+	sftpHandle  = 102
+	sftpData    = 103
+	sftpAttrs   = 105
+
+	sftpFlagRead   = 0x01
+	sftpFlagWrite  = 0x02
+	sftpFlagCreate = 0x08
+	sftpFlagTrunc  = 0x10
+	sftpAttrSize   = 0x01
+
+	sftpStatusOK  = 0
+	sftpStatusEOF = 1
+)
+
+// sftpStatusNames are the status codes of SFTP version 3
+var sftpStatusNames = []string{"ok", "end of file", "no such file", "permission denied", "failure", "bad message", "no connection", "connection lost", "operation unsupported"}
+
+// sftpSession sends requests and reads responses on an sftp subsystem channel
+type sftpSession struct {
+	c      *sshClient
+	nextID uint32
+}
+
+// send writes one request packet; the id is assigned here for all but INIT
+func (s *sftpSession) send(kind byte, body *sshWriter) (uint32, error) {
+	id := s.nextID
+	s.nextID++
+	w := &sshWriter{b: make([]byte, 4, 9+len(body.b))}
+	w.byte(kind)
+	if kind != sftpInit {
+		w.uint32(id)
+	}
+	w.b = append(w.b, body.b...)
+	binary.BigEndian.PutUint32(w.b, uint32(len(w.b)-4))
+	_, err := s.c.Write(w.b)
+	return id, err
+}
+
+// recv reads one response packet, returning its type, request id and the rest
+func (s *sftpSession) recv() (byte, uint32, *sshReader, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(s.c, header[:]); err != nil {
+		return 0, 0, nil, err
+	}
+	length := binary.BigEndian.Uint32(header[:])
+	if length < 1 || length > SSH_MAX_PACKET {
+		return 0, 0, nil, fmt.Errorf("invalid sftp packet length %d", length)
+	}
+	packet := make([]byte, length)
+	if _, err := io.ReadFull(s.c, packet); err != nil {
+		return 0, 0, nil, err
+	}
+	r := &sshReader{b: packet[1:]}
+	if packet[0] == sftpVersion {
+		return packet[0], 0, r, nil
+	}
+	id := r.uint32()
+	return packet[0], id, r, r.err
+}
+
+// readStatus parses a STATUS response, returning its code and an error unless it is ok
+func readStatus(r *sshReader) (uint32, error) {
+	code := r.uint32()
+	msg := r.string()
+	if code == sftpStatusOK {
+		return code, nil
+	}
+	if msg == "" && int(code) < len(sftpStatusNames) {
+		msg = sftpStatusNames[code]
+	}
+	return code, fmt.Errorf("%s (status %d)", msg, code)
+}
+
+func statusError(r *sshReader) error {
+	_, err := readStatus(r)
+	return err
+}
+
+// call sends a request and waits for its response
+func (s *sftpSession) call(kind byte, body *sshWriter) (byte, *sshReader, error) {
+	id, err := s.send(kind, body)
+	if err != nil {
+		return 0, nil, err
+	}
+	typ, got, r, err := s.recv()
+	if err == nil && got != id {
+		err = fmt.Errorf("sftp response for request %d, expected %d", got, id)
+	}
+	return typ, r, err
+}
+
+// open opens the remote file and returns its handle
+func (s *sftpSession) open(path string, flags uint32) (string, error) {
+	typ, r, err := s.call(sftpOpen, new(sshWriter).string(path).uint32(flags).uint32(0))
+	if err != nil {
+		return "", err
+	}
+	switch typ {
+	case sftpHandle:
+		return r.string(), r.err
+	case sftpStatus:
+		if err := statusError(r); err != nil {
+			return "", fmt.Errorf("open %s: %w", path, err)
+		}
+	}
+	return "", fmt.Errorf("open %s: unexpected response %d", path, typ)
+}
+
+// size returns the size of an open file, or 0 if the server does not report one
+func (s *sftpSession) size(handle string) (int64, error) {
+	typ, r, err := s.call(sftpFstat, new(sshWriter).string(handle))
+	if err != nil {
+		return 0, err
+	}
+	if typ != sftpAttrs {
+		return 0, nil
+	}
+	if r.uint32()&sftpAttrSize == 0 {
+		return 0, nil
+	}
+	return int64(r.uint32())<<32 | int64(r.uint32()), r.err
+}
+
+func (s *sftpSession) close(handle string) error {
+	typ, r, err := s.call(sftpClose, new(sshWriter).string(handle))
+	if err != nil {
+		return err
+	}
+	if typ != sftpStatus {
+		return fmt.Errorf("close: unexpected response %d", typ)
+	}
+	return statusError(r)
+}
+
+func appendUint64(w *sshWriter, v int64) *sshWriter {
+	return w.uint32(uint32(v >> 32)).uint32(uint32(v))
+}
+
+// upload writes size bytes with up to SFTP_MAX_REQUESTS writes in flight
+func (s *sftpSession) upload(handle string, size int64, payload nettest.PayloadEntropy) (int64, error) {
+	source := newPayloadReader(payload, size)
+	chunk := make([]byte, SFTP_CHUNK_SIZE)
+	var offset, acked int64
+	pending := make(map[uint32]int64)
+	for acked < size {
+		for offset < size && len(pending) < SFTP_MAX_REQUESTS {
+			n, _ := io.ReadFull(source, chunk[:min(int64(len(chunk)), size-offset)])
+			id, err := s.send(sftpWrite, appendUint64(new(sshWriter).string(handle), offset).bytes(chunk[:n]))
+			if err != nil {
+				return acked, err
+			}
+			pending[id] = int64(n)
+			offset += int64(n)
+		}
+		typ, id, r, err := s.recv()
+		if err != nil {
+			return acked, err
+		}
+		n, ok := pending[id]
+		if !ok || typ != sftpStatus {
+			return acked, fmt.Errorf("unexpected response %d to request %d", typ, id)
+		}
+		if err := statusError(r); err != nil {
+			return acked, fmt.Errorf("write: %w", err)
+		}
+		delete(pending, id)
+		acked += n
+	}
+	return acked, nil
+}
+
+// download reads up to limit bytes (0 for the whole file) with up to
+// SFTP_MAX_REQUESTS reads in flight. Reads past the end of file end in an EOF
+// status, and short reads have the rest requested again.
+func (s *sftpSession) download(handle string, limit int64) (int64, error) {
+	type span struct{ offset, length int64 }
+	var offset, received int64
+	var retry []span
+	pending := make(map[uint32]span)
+	eof := false
+	for {
+		for len(pending) < SFTP_MAX_REQUESTS {
+			var next span
+			switch {
+			case len(retry) > 0:
+				next, retry = retry[0], retry[1:]
+			case !eof && (limit == 0 || offset < limit):
+				next = span{offset, SFTP_CHUNK_SIZE}
+				if limit > 0 {
+					next.length = min(next.length, limit-offset)
+				}
+				offset += next.length
+			}
+			if next.length == 0 {
+				break
+			}
+			id, err := s.send(sftpRead, appendUint64(new(sshWriter).string(handle), next.offset).uint32(uint32(next.length)))
+			if err != nil {
+				return received, err
+			}
+			pending[id] = next
+		}
+		if len(pending) == 0 {
+			return received, nil
+		}
+
+		typ, id, r, err := s.recv()
+		if err != nil {
+			return received, err
+		}
+		req, ok := pending[id]
+		if !ok {
+			return received, fmt.Errorf("response to unknown request %d", id)
+		}
+		delete(pending, id)
+		switch typ {
+		case sftpData:
+			data := r.bytes()
+			if r.err != nil || int64(len(data)) > req.length {
+				return received, fmt.Errorf("malformed read response")
+			}
+			received += int64(len(data))
+			if n := int64(len(data)); n < req.length {
+				retry = append(retry, span{req.offset + n, req.length - n})
+			}
+		case sftpStatus:
+			if code, err := readStatus(r); code != sftpStatusEOF {
+				if err == nil {
+					err = fmt.Errorf("unexpected ok status")
+				}
+				return received, fmt.Errorf("read: %w", err)
+			}
+			eof = true
+			if req.offset < offset {
+				offset = req.offset // Nothing past the end to request again
+			}
+			kept := retry[:0]
+			for _, sp := range retry {
+				if sp.offset < req.offset {
+					kept = append(kept, sp)
+				}
+			}
+			retry = kept
+		default:
+			return received, fmt.Errorf("unexpected response %d to read", typ)
+		}
+	}
+}
+
+// sftpTransfer starts the sftp subsystem and uploads or downloads remote_path
+func sftpTransfer(c *sshClient, req RunRequest, payload nettest.PayloadEntropy, result *SSHResult) (time.Time, time.Time, error) {
+	var start, end time.Time
+	if err := c.request("subsystem", "sftp"); err != nil {
+		return start, end, err
+	}
+	s := &sftpSession{c: c}
+	if _, err := s.send(sftpInit, new(sshWriter).uint32(SFTP_VERSION)); err != nil {
+		return start, end, err
+	}
+	if typ, _, _, err := s.recv(); err != nil {
+		return start, end, c.remoteError(err)
+	} else if typ != sftpVersion {
+		return start, end, fmt.Errorf("expected VERSION, got message %d", typ)
+	}
+
+	flags := uint32(sftpFlagRead)
+	if req.Direction == TRANSFER_UPLOAD {
+		flags = sftpFlagWrite | sftpFlagCreate | sftpFlagTrunc
+	}
+	handle, err := s.open(req.RemotePath, flags)
+	if err != nil {
+		return start, end, err
+	}
+
+	if req.Direction == TRANSFER_UPLOAD {
+		start = time.Now()
+		result.Bytes, err = s.upload(handle, req.Size, payload)
+		end = time.Now()
+	} else {
+		var size int64
+		if size, err = s.size(handle); err != nil {
+			return start, end, err
+		}
+		limit := req.Size
+		if size > 0 && (limit == 0 || limit > size) {
+			limit = size
+		}
+		result.Truncated = size > 0 && req.Size > 0 && req.Size < size
+		start = time.Now()
+		result.Bytes, err = s.download(handle, limit)
+		end = time.Now()
+	}
+	if err != nil {
+		return start, end, err
+	}
+	if err := s.close(handle); err != nil {
+		return start, end, fmt.Errorf("close: %w", err)
+	}
+	return start, end, nil
+}
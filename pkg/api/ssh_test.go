@@ -0,0 +1,215 @@
+package api
+
+import (
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+func TestSSHMpint(t *testing.T) {
+	// Examples from RFC 4251 section 5
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"0", "00000000"},
+		{"9a378f9b2e332a7", "0000000809a378f9b2e332a7"},
+		{"80", "000000020080"},
+	}
+
+	for _, tt := range tests {
+		v, _ := new(big.Int).SetString(tt.value, 16)
+		if got := fmt.Sprintf("%x", (&sshWriter{}).mpint(v).b); got != tt.want {
+			t.Errorf("%s: expected %s, got %s", tt.value, tt.want, got)
+		}
+	}
+}
+
+func TestSSHFingerprint(t *testing.T) {
+	// ssh-keygen -lf on this public key prints the fingerprint below
+	blob, _ := base64.StdEncoding.DecodeString("AAAAC3NzaC1lZDI1NTE5AAAAIOdodUiokjNschgVz3YXXmxlZpYzMsR8hxD9FIWkOltk")
+	want := "SHA256:S0mjhkX2UH1S2xj+URIrScwXoc3nudKkX0aeD6T74Hs"
+	if got := sshFingerprint(blob); got != want {
+		t.Errorf("Expected fingerprint %s, got %s", want, got)
+	}
+
+	for _, in := range []string{want, " " + want + " ", strings.TrimPrefix(want, "SHA256:"), want + "="} {
+		if got := normalizeFingerprint(in); got != want {
+			t.Errorf("%q: expected %s, got %s", in, want, got)
+		}
+	}
+}
+
+func TestChooseAlgorithm(t *testing.T) {
+	client := []string{"aes128-gcm@openssh.com", "aes256-gcm@openssh.com", "aes128-ctr"}
+
+	// The client's preference wins over the server's order
+	got, err := chooseAlgorithm("cipher", client, []string{"chacha20-poly1305@openssh.com", "aes128-ctr", "aes256-gcm@openssh.com"})
+	if err != nil || got != "aes256-gcm@openssh.com" {
+		t.Errorf("Expected aes256-gcm@openssh.com, got %q (%v)", got, err)
+	}
+
+	if _, err := chooseAlgorithm("cipher", client, []string{"aes128-cbc", "3des-cbc"}); err == nil {
+		t.Errorf("Expected an error without a common cipher")
+	} else if !strings.Contains(err.Error(), "aes128-cbc,3des-cbc") {
+		t.Errorf("Expected the error to list the server's ciphers, got %q", err)
+	}
+}
+
+func TestShellQuote(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"/dev/null", `'/dev/null'`},
+		{"/tmp/a b", `'/tmp/a b'`},
+		{"it's; rm -rf /", `'it'\''s; rm -rf /'`},
+	}
+
+	for _, tt := range tests {
+		if got := shellQuote(tt.in); got != tt.want {
+			t.Errorf("%q: expected %s, got %s", tt.in, tt.want, got)
+		}
+	}
+}
+
+func TestParseSCPHeader(t *testing.T) {
+	size, name, err := parseSCPHeader("C0644 1048576 sample file.bin\n")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if size != 1048576 || name != "sample file.bin" {
+		t.Errorf("Expected 1048576 bytes of sample file.bin, got %d bytes of %q", size, name)
+	}
+
+	for _, line := range []string{"D0755 0 dir\n", "T1700000000 0 1700000000 0\n", "C0644 -1 x\n", "C0644 big x\n", "C0644 12\n"} {
+		if _, _, err := parseSCPHeader(line); err == nil {
+			t.Errorf("%q: expected an error", line)
+		}
+	}
+}
+
+// knownHostsKey is the key of TestSSHFingerprint, otherKnownHostsKey another ed25519 key
+const (
+	knownHostsKey      = "AAAAC3NzaC1lZDI1NTE5AAAAIOdodUiokjNschgVz3YXXmxlZpYzMsR8hxD9FIWkOltk"
+	otherKnownHostsKey = "AAAAC3NzaC1lZDI1NTE5AAAAIAABAgMEBQYHCAkKCwwNDg8QERITFBUWFxgZGhscHR4f"
+)
+
+func TestKnownHosts(t *testing.T) {
+	file := strings.Join([]string{
+		"# ssh-keyscan output",
+		"backup.example.com,192.0.2.10 ssh-ed25519 " + knownHostsKey,
+		"[backup.example.com]:2222 ssh-ed25519 " + otherKnownHostsKey,
+		"*.lab.example,!printer.lab.example ssh-ed25519 " + knownHostsKey,
+		"|1|ZGVmZ2hpamtsbW5vcHFyc3R1dnc=|Wasu82fNQ/r4zCw5XFyXKZ1QP6E= ssh-ed25519 " + knownHostsKey,
+		"@cert-authority *.example.com ssh-ed25519 " + otherKnownHostsKey,
+		"@revoked old.example.com ssh-ed25519 " + knownHostsKey,
+		"",
+	}, "\n")
+	hosts, err := parseKnownHosts(strings.NewReader(file))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	k := &sshKnownHosts{file: "known_hosts", hosts: hosts}
+	blob, _ := base64.StdEncoding.DecodeString(knownHostsKey)
+
+	tests := []struct {
+		host    string
+		port    int
+		known   bool
+		wantErr string
+	}{
+		{"backup.example.com", 22, true, ""},
+		{"BACKUP.example.com", 22, true, ""},
+		{"192.0.2.10", 22, true, ""},
+		{"backup.example.com", 2222, false, "does not match known_hosts"},
+		{"sw1.lab.example", 22, true, ""},
+		{"printer.lab.example", 22, false, ""},
+		{"hashed.example", 2222, true, ""},
+		{"hashed.example", 22, false, ""},
+		{"old.example.com", 22, false, "is revoked"},
+		{"new.example.com", 22, false, ""},
+	}
+
+	for _, tt := range tests {
+		known, err := k.check(tt.host, tt.port, "ssh-ed25519", blob)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%s:%d: expected error %q, got %v", tt.host, tt.port, tt.wantErr, err)
+			}
+			continue
+		}
+		if err != nil || known != tt.known {
+			t.Errorf("%s:%d: expected known=%v, got %v (%v)", tt.host, tt.port, tt.known, known, err)
+		}
+	}
+
+	for _, line := range []string{"@marker host ssh-ed25519 " + knownHostsKey, "host ssh-ed25519", "host ssh-ed25519 !!!"} {
+		if _, err := parseKnownHosts(strings.NewReader(line)); err == nil {
+			t.Errorf("%q: expected an error", line)
+		}
+	}
+}
+
+func TestVerifySSHHostKey(t *testing.T) {
+	defer func(k *sshKnownHosts) { knownHosts = k }(knownHosts)
+	hosts, _ := parseKnownHosts(strings.NewReader("backup.example.com ssh-ed25519 " + knownHostsKey))
+	blob, _ := base64.StdEncoding.DecodeString(knownHostsKey)
+	fp := sshFingerprint(blob)
+
+	tests := []struct {
+		name        string
+		knownHosts  bool
+		host        string
+		fingerprint string
+		insecure    bool
+		verified    bool
+		wantErr     string
+	}{
+		{"pinned", false, "new.example.com", fp, false, true, ""},
+		{"pin mismatch", true, "backup.example.com", "SHA256:uNiVztksCsDhcc0u9e8BujQXVUpKZIDTMczCvj3tD2s", true, false, "does not match host_key_fingerprint"},
+		{"known host", true, "backup.example.com", "", false, true, ""},
+		{"unknown host", true, "new.example.com", "", false, false, "is not verified"},
+		{"no known_hosts", false, "backup.example.com", "", false, false, "is not verified"},
+		{"insecure", true, "new.example.com", "", true, false, ""},
+	}
+
+	for _, tt := range tests {
+		knownHosts = nil
+		if tt.knownHosts {
+			knownHosts = &sshKnownHosts{file: "known_hosts", hosts: hosts}
+		}
+		req := RunRequest{ServerHost: tt.host, ServerPort: DEFAULT_SSH_PORT, InsecureSkipHostKey: tt.insecure}
+		verified, err := verifySSHHostKey(req, &sshCredentials{Fingerprint: tt.fingerprint}, "ssh-ed25519", blob)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%s: expected error %q, got %v", tt.name, tt.wantErr, err)
+			}
+			continue
+		}
+		if err != nil || verified != tt.verified {
+			t.Errorf("%s: expected verified=%v, got %v (%v)", tt.name, tt.verified, verified, err)
+		}
+	}
+}
+
+func TestSSHCredentialsRequireHostKey(t *testing.T) {
+	defer func(s *SecretStore, k *sshKnownHosts) { secretStore, knownHosts = s, k }(secretStore, knownHosts)
+	secretStore = &SecretStore{Secrets: map[string]map[string]string{"lab": {"username": "nettest", "password": "x"}}}
+	knownHosts = nil
+
+	req := RunRequest{Credentials: "lab"}
+	if _, err := sshCredentialsFor(req); err == nil || !strings.Contains(err.Error(), "host_key_fingerprint is required") {
+		t.Errorf("Expected a missing host key to be refused, got %v", err)
+	}
+	req.InsecureSkipHostKey = true
+	if _, err := sshCredentialsFor(req); err != nil {
+		t.Errorf("Expected insecure_skip_host_key to be accepted, got %v", err)
+	}
+	req = RunRequest{Credentials: "lab", HostKeyFingerprint: "SHA256:uNiVztksCsDhcc0u9e8BujQXVUpKZIDTMczCvj3tD2s"}
+	if _, err := sshCredentialsFor(req); err != nil {
+		t.Errorf("Expected a pinned host key to be accepted, got %v", err)
+	}
+}
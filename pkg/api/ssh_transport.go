@@ -0,0 +1,599 @@
+package api
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"math/big"
+	"net"
+	"strings"
+	"sync"
+)
+
+// Minimal SSH-2 client transport (RFC 4253) with the algorithms OpenSSH and
+// Dropbear servers offer by default
+const (
+	SSH_CLIENT_VERSION = "SSH-2.0-network-test-api"
+	SSH_MAX_PACKET     = 256 << 10 // Largest packet accepted from the server
+	SSH_MAX_VERSION    = 255
+
+	sshMsgDisconnect     = 1
+	sshMsgIgnore         = 2
+	sshMsgUnimplemented  = 3
+	sshMsgDebug          = 4
+	sshMsgServiceRequest = 5
+	sshMsgServiceAccept  = 6
+	sshMsgExtInfo        = 7
+	sshMsgKexInit        = 20
+	sshMsgNewKeys        = 21
+	sshMsgKexECDHInit    = 30
+	sshMsgKexECDHReply   = 31
+)
+
+// Algorithms in order of preference
+var (
+	sshKexAlgorithms     = []string{"curve25519-sha256", "curve25519-sha256@libssh.org", "ecdh-sha2-nistp256"}
+	sshHostKeyAlgorithms = []string{"ssh-ed25519", "ecdsa-sha2-nistp256", "rsa-sha2-512", "rsa-sha2-256"}
+	sshCiphers           = []string{"aes128-gcm@openssh.com", "aes256-gcm@openssh.com", "aes128-ctr", "aes192-ctr", "aes256-ctr"}
+	sshMACs              = []string{"hmac-sha2-256", "hmac-sha2-512"}
+)
+
+// sshAlgorithms are the algorithms negotiated in a key exchange
+type sshAlgorithms struct {
+	Kex     string `json:"kex"`
+	HostKey string `json:"host_key"`
+	Cipher  string `json:"cipher"`
+	MAC     string `json:"mac,omitempty"` // Omitted for AEAD ciphers, which authenticate themselves
+}
+
+// sshWriter builds SSH wire format messages (RFC 4251 section 5)
+type sshWriter struct {
+	b []byte
+}
+
+func newSSHMessage(msg byte) *sshWriter { return &sshWriter{b: []byte{msg}} }
+
+func (w *sshWriter) byte(v byte) *sshWriter { w.b = append(w.b, v); return w }
+
+func (w *sshWriter) bool(v bool) *sshWriter {
+	if v {
+		return w.byte(1)
+	}
+	return w.byte(0)
+}
+
+func (w *sshWriter) uint32(v uint32) *sshWriter {
+	w.b = binary.BigEndian.AppendUint32(w.b, v)
+	return w
+}
+
+func (w *sshWriter) bytes(v []byte) *sshWriter {
+	w.uint32(uint32(len(v)))
+	w.b = append(w.b, v...)
+	return w
+}
+
+func (w *sshWriter) string(v string) *sshWriter { return w.bytes([]byte(v)) }
+
+func (w *sshWriter) nameList(v []string) *sshWriter { return w.string(strings.Join(v, ",")) }
+
+// mpint writes a non-negative integer in two's complement
+func (w *sshWriter) mpint(v *big.Int) *sshWriter {
+	b := v.Bytes()
+	if len(b) > 0 && b[0]&0x80 != 0 {
+		b = append([]byte{0}, b...)
+	}
+	return w.bytes(b)
+}
+
+// sshReader parses SSH wire format, remembering the first short read
+type sshReader struct {
+	b   []byte
+	err error
+}
+
+var errSSHShort = errors.New("ssh: malformed message")
+
+func (r *sshReader) byte() byte {
+	if len(r.b) < 1 {
+		r.err = errSSHShort
+		return 0
+	}
+	v := r.b[0]
+	r.b = r.b[1:]
+	return v
+}
+
+func (r *sshReader) bool() bool { return r.byte() != 0 }
+
+func (r *sshReader) uint32() uint32 {
+	if len(r.b) < 4 {
+		r.err = errSSHShort
+		return 0
+	}
+	v := binary.BigEndian.Uint32(r.b)
+	r.b = r.b[4:]
+	return v
+}
+
+func (r *sshReader) bytes() []byte {
+	n := r.uint32()
+	if r.err != nil || uint32(len(r.b)) < n {
+		r.err = errSSHShort
+		return nil
+	}
+	v := r.b[:n]
+	r.b = r.b[n:]
+	return v
+}
+
+func (r *sshReader) string() string { return string(r.bytes()) }
+
+func (r *sshReader) nameList() []string {
+	s := r.string()
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
+}
+
+func (r *sshReader) mpint() *big.Int { return new(big.Int).SetBytes(r.bytes()) }
+
+// sshDirection is the packet protection of one direction of the connection
+type sshDirection struct {
+	seq uint32 // Counts every packet, across key exchanges
+
+	aead   cipher.AEAD // aes-gcm; the packet length stays in the clear as additional data
+	nonce  []byte
+	stream cipher.Stream // aes-ctr with mac
+	mac    hash.Hash
+}
+
+func (d *sshDirection) blockSize() int {
+	if d.aead != nil || d.stream != nil {
+		return aes.BlockSize
+	}
+	return 8
+}
+
+// nextNonce increments the invocation counter of the GCM nonce (RFC 5647 section 7.1)
+func (d *sshDirection) nextNonce() {
+	counter := binary.BigEndian.Uint64(d.nonce[4:])
+	binary.BigEndian.PutUint64(d.nonce[4:], counter+1)
+}
+
+// sshTransport is the encrypted packet layer of a client connection
+type sshTransport struct {
+	conn   net.Conn
+	r      *bufio.Reader
+	in     *sshDirection
+	out    *sshDirection
+	wmu    sync.Mutex // Held for every packet written, and for a whole key exchange
+	macBuf []byte
+
+	ServerVersion string
+	Algorithms    sshAlgorithms
+	HostKey       []byte // Server host key blob
+	HostKeyType   string
+	Rekeys        int // Key exchanges after the first, started by the server
+
+	sessionID     []byte
+	verifyHostKey func(keyType string, blob []byte) error
+}
+
+func newSSHTransport(conn net.Conn, verifyHostKey func(string, []byte) error) *sshTransport {
+	return &sshTransport{
+		conn:          conn,
+		r:             bufio.NewReaderSize(conn, 64<<10),
+		in:            &sshDirection{},
+		out:           &sshDirection{},
+		verifyHostKey: verifyHostKey,
+	}
+}
+
+// exchangeVersions sends the client version and reads the server's, skipping
+// any lines the server sends before it (RFC 4253 section 4.2)
+func (t *sshTransport) exchangeVersions() error {
+	if _, err := io.WriteString(t.conn, SSH_CLIENT_VERSION+"\r\n"); err != nil {
+		return err
+	}
+	for lines := 0; lines < 50; lines++ {
+		line, err := t.r.ReadString('\n')
+		if err != nil {
+			return fmt.Errorf("reading server version: %w", err)
+		}
+		if len(line) > SSH_MAX_VERSION {
+			return fmt.Errorf("server version line too long")
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if strings.HasPrefix(line, "SSH-") {
+			if !strings.HasPrefix(line, "SSH-2.0-") && !strings.HasPrefix(line, "SSH-1.99-") {
+				return fmt.Errorf("unsupported protocol version %q", line)
+			}
+			t.ServerVersion = line
+			return nil
+		}
+	}
+	return fmt.Errorf("no SSH version line from server")
+}
+
+// writePacket sends one message, padded and protected for the current keys
+func (t *sshTransport) writePacket(payload []byte) error {
+	t.wmu.Lock()
+	defer t.wmu.Unlock()
+	return t.writePacketLocked(payload)
+}
+
+func (t *sshTransport) writePacketLocked(payload []byte) error {
+	d := t.out
+	bs := d.blockSize()
+	// The length field is outside the padded area for AEAD, inside it otherwise
+	covered := 5 + len(payload)
+	if d.aead != nil {
+		covered = 1 + len(payload)
+	}
+	padding := bs - covered%bs
+	if padding < 4 {
+		padding += bs
+	}
+	length := 1 + len(payload) + padding
+
+	packet := make([]byte, 4+length, 4+length+aes.BlockSize+sha512.Size)
+	binary.BigEndian.PutUint32(packet, uint32(length))
+	packet[4] = byte(padding)
+	copy(packet[5:], payload)
+	if _, err := rand.Read(packet[5+len(payload):]); err != nil {
+		return err
+	}
+
+	switch {
+	case d.aead != nil:
+		packet = d.aead.Seal(packet[:4], d.nonce, packet[4:], packet[:4])
+		d.nextNonce()
+	case d.stream != nil:
+		d.mac.Reset()
+		var seq [4]byte
+		binary.BigEndian.PutUint32(seq[:], d.seq)
+		d.mac.Write(seq[:])
+		d.mac.Write(packet)
+		sum := d.mac.Sum(t.macBuf[:0])
+		d.stream.XORKeyStream(packet, packet)
+		packet = append(packet, sum...)
+	}
+	d.seq++
+	_, err := t.conn.Write(packet)
+	return err
+}
+
+// readPacket returns the payload of the next packet, skipping ignore and debug messages
+func (t *sshTransport) readPacket() ([]byte, error) {
+	for {
+		payload, err := t.readOnePacket()
+		if err != nil {
+			return nil, err
+		}
+		if len(payload) == 0 {
+			return nil, errSSHShort
+		}
+		switch payload[0] {
+		case sshMsgIgnore, sshMsgDebug, sshMsgUnimplemented:
+			continue
+		case sshMsgDisconnect:
+			r := &sshReader{b: payload[1:]}
+			code := r.uint32()
+			return nil, fmt.Errorf("server disconnected: %s (code %d)", r.string(), code)
+		}
+		return payload, nil
+	}
+}
+
+func (t *sshTransport) readOnePacket() ([]byte, error) {
+	d := t.in
+	var first [aes.BlockSize]byte
+	header := first[:4]
+	if d.stream != nil {
+		header = first[:]
+	}
+	if _, err := io.ReadFull(t.r, header); err != nil {
+		return nil, err
+	}
+	if d.stream != nil {
+		d.stream.XORKeyStream(header, header)
+	}
+	length := binary.BigEndian.Uint32(header)
+	if length < 5 || length > SSH_MAX_PACKET {
+		return nil, fmt.Errorf("ssh: invalid packet length %d", length)
+	}
+
+	var packet []byte
+	switch {
+	case d.aead != nil:
+		sealed := make([]byte, int(length)+d.aead.Overhead())
+		if _, err := io.ReadFull(t.r, sealed); err != nil {
+			return nil, err
+		}
+		plain, err := d.aead.Open(sealed[:0], d.nonce, sealed, header)
+		if err != nil {
+			return nil, fmt.Errorf("ssh: packet authentication failed")
+		}
+		d.nextNonce()
+		packet = plain
+	case d.stream != nil:
+		if (4+length)%aes.BlockSize != 0 {
+			return nil, fmt.Errorf("ssh: invalid packet length %d", length)
+		}
+		full := make([]byte, 4+int(length)+d.mac.Size())
+		copy(full, header)
+		if _, err := io.ReadFull(t.r, full[len(header):]); err != nil {
+			return nil, err
+		}
+		body := full[len(header) : 4+length]
+		d.stream.XORKeyStream(body, body)
+		d.mac.Reset()
+		var seq [4]byte
+		binary.BigEndian.PutUint32(seq[:], d.seq)
+		d.mac.Write(seq[:])
+		d.mac.Write(full[:4+length])
+		if subtle.ConstantTimeCompare(d.mac.Sum(nil), full[4+length:]) != 1 {
+			return nil, fmt.Errorf("ssh: packet authentication failed")
+		}
+		packet = full[4 : 4+length]
+	default:
+		packet = make([]byte, length)
+		if _, err := io.ReadFull(t.r, packet); err != nil {
+			return nil, err
+		}
+	}
+	d.seq++
+
+	padding := int(packet[0])
+	if padding+1 > len(packet) {
+		return nil, fmt.Errorf("ssh: invalid padding length %d", padding)
+	}
+	return packet[1 : len(packet)-padding], nil
+}
+
+// kexInit builds our KEXINIT message
+func kexInit() []byte {
+	w := newSSHMessage(sshMsgKexInit)
+	cookie := make([]byte, 16)
+	_, _ = rand.Read(cookie)
+	w.b = append(w.b, cookie...)
+	w.nameList(sshKexAlgorithms).nameList(sshHostKeyAlgorithms)
+	w.nameList(sshCiphers).nameList(sshCiphers)
+	w.nameList(sshMACs).nameList(sshMACs)
+	w.string("none").string("none").string("").string("")
+	w.bool(false).uint32(0)
+	return w.b
+}
+
+// chooseAlgorithm picks the first client algorithm the server also supports
+func chooseAlgorithm(what string, client, server []string) (string, error) {
+	for _, c := range client {
+		for _, s := range server {
+			if c == s {
+				return c, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("no common %s algorithm (server offers %s)", what, strings.Join(server, ","))
+}
+
+// handshake exchanges versions and runs the first key exchange
+func (t *sshTransport) handshake() error {
+	if err := t.exchangeVersions(); err != nil {
+		return err
+	}
+	t.wmu.Lock()
+	defer t.wmu.Unlock()
+	ours := kexInit()
+	if err := t.writePacketLocked(ours); err != nil {
+		return err
+	}
+	theirs, err := t.readPacket()
+	if err != nil {
+		return err
+	}
+	if theirs[0] != sshMsgKexInit {
+		return fmt.Errorf("ssh: expected KEXINIT, got message %d", theirs[0])
+	}
+	return t.keyExchange(ours, theirs)
+}
+
+// rekey answers a KEXINIT the server sends on an established connection.
+// Writers are held off until the new keys are in use.
+func (t *sshTransport) rekey(theirs []byte) error {
+	t.wmu.Lock()
+	defer t.wmu.Unlock()
+	ours := kexInit()
+	if err := t.writePacketLocked(ours); err != nil {
+		return err
+	}
+	t.Rekeys++
+	return t.keyExchange(ours, theirs)
+}
+
+// rekeyCount returns Rekeys, which the dispatch loop updates
+func (t *sshTransport) rekeyCount() int {
+	t.wmu.Lock()
+	defer t.wmu.Unlock()
+	return t.Rekeys
+}
+
+// keyExchange negotiates algorithms from both KEXINITs, runs ECDH and switches
+// to the derived keys (RFC 4253 section 7, RFC 5656, RFC 8731). The caller holds wmu.
+func (t *sshTransport) keyExchange(ours, theirs []byte) error {
+	r := &sshReader{b: theirs[17:]}
+	serverKex, serverHostKey := r.nameList(), r.nameList()
+	encC2S, encS2C := r.nameList(), r.nameList()
+	macC2S, macS2C := r.nameList(), r.nameList()
+	r.nameList() // Compression, which is always none
+	r.nameList()
+	r.nameList() // Languages
+	r.nameList()
+	guessFollows := r.bool()
+	if r.err != nil {
+		return fmt.Errorf("ssh: malformed KEXINIT")
+	}
+
+	var algs sshAlgorithms
+	var err error
+	if algs.Kex, err = chooseAlgorithm("key exchange", sshKexAlgorithms, serverKex); err != nil {
+		return err
+	}
+	if algs.HostKey, err = chooseAlgorithm("host key", sshHostKeyAlgorithms, serverHostKey); err != nil {
+		return err
+	}
+	if algs.Cipher, err = chooseAlgorithm("cipher", sshCiphers, encC2S); err != nil {
+		return err
+	}
+	if cipherS2C, err := chooseAlgorithm("cipher", sshCiphers, encS2C); err != nil || cipherS2C != algs.Cipher {
+		return fmt.Errorf("ssh: asymmetric ciphers are not supported")
+	}
+	if !strings.HasSuffix(algs.Cipher, "@openssh.com") {
+		if algs.MAC, err = chooseAlgorithm("MAC", sshMACs, macC2S); err != nil {
+			return err
+		}
+		if macS2C, err := chooseAlgorithm("MAC", sshMACs, macS2C); err != nil || macS2C != algs.MAC {
+			return fmt.Errorf("ssh: asymmetric MACs are not supported")
+		}
+	}
+	if guessFollows && (serverKex[0] != algs.Kex || serverHostKey[0] != algs.HostKey) {
+		if _, err := t.readPacket(); err != nil { // The server's wrong guess
+			return err
+		}
+	}
+
+	curve := ecdh.X25519()
+	if algs.Kex == "ecdh-sha2-nistp256" {
+		curve = ecdh.P256()
+	}
+	priv, err := curve.GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+	clientPub := priv.PublicKey().Bytes()
+	if err := t.writePacketLocked(newSSHMessage(sshMsgKexECDHInit).bytes(clientPub).b); err != nil {
+		return err
+	}
+	reply, err := t.readPacket()
+	if err != nil {
+		return err
+	}
+	if reply[0] != sshMsgKexECDHReply {
+		return fmt.Errorf("ssh: expected KEX_ECDH_REPLY, got message %d", reply[0])
+	}
+	r = &sshReader{b: reply[1:]}
+	hostKey, serverPubBytes, signature := r.bytes(), r.bytes(), r.bytes()
+	if r.err != nil {
+		return fmt.Errorf("ssh: malformed KEX_ECDH_REPLY")
+	}
+	serverPub, err := curve.NewPublicKey(serverPubBytes)
+	if err != nil {
+		return fmt.Errorf("ssh: invalid server ECDH key: %w", err)
+	}
+	secret, err := priv.ECDH(serverPub)
+	if err != nil {
+		return err
+	}
+	k := new(big.Int).SetBytes(secret)
+
+	h := sha256.New()
+	h.Write(new(sshWriter).string(SSH_CLIENT_VERSION).string(t.ServerVersion).bytes(ours).bytes(theirs).
+		bytes(hostKey).bytes(clientPub).bytes(serverPubBytes).mpint(k).b)
+	exchangeHash := h.Sum(nil)
+
+	keyType := (&sshReader{b: hostKey}).string()
+	if t.HostKey != nil && string(t.HostKey) != string(hostKey) {
+		return fmt.Errorf("ssh: host key changed during rekey")
+	}
+	if err := verifyHostKeySignature(algs.HostKey, hostKey, exchangeHash, signature); err != nil {
+		return err
+	}
+	if t.HostKey == nil && t.verifyHostKey != nil {
+		if err := t.verifyHostKey(keyType, hostKey); err != nil {
+			return err
+		}
+	}
+	t.HostKey, t.HostKeyType = hostKey, keyType
+	if t.sessionID == nil {
+		t.sessionID = exchangeHash
+	}
+
+	if err := t.writePacketLocked([]byte{sshMsgNewKeys}); err != nil {
+		return err
+	}
+	out, err := newSSHDirection(algs, k, exchangeHash, t.sessionID, 'A', 'C', 'E', t.out.seq)
+	if err != nil {
+		return err
+	}
+	t.out = out
+	if msg, err := t.readPacket(); err != nil {
+		return err
+	} else if msg[0] != sshMsgNewKeys {
+		return fmt.Errorf("ssh: expected NEWKEYS, got message %d", msg[0])
+	}
+	if t.in, err = newSSHDirection(algs, k, exchangeHash, t.sessionID, 'B', 'D', 'F', t.in.seq); err != nil {
+		return err
+	}
+	t.Algorithms = algs
+	return nil
+}
+
+// deriveKey computes key material for letter x (RFC 4253 section 7.2)
+func deriveKey(k *big.Int, h, sessionID []byte, x byte, n int) []byte {
+	kBytes := new(sshWriter).mpint(k).b
+	digest := sha256.New()
+	digest.Write(kBytes)
+	digest.Write(h)
+	digest.Write([]byte{x})
+	digest.Write(sessionID)
+	key := digest.Sum(nil)
+	for len(key) < n {
+		digest.Reset()
+		digest.Write(kBytes)
+		digest.Write(h)
+		digest.Write(key)
+		key = digest.Sum(key)
+	}
+	return key[:n]
+}
+
+// newSSHDirection sets up the cipher state of one direction from the derived keys
+func newSSHDirection(algs sshAlgorithms, k *big.Int, h, sessionID []byte, ivLetter, keyLetter, macLetter byte, seq uint32) (*sshDirection, error) {
+	keySize := map[string]int{
+		"aes128-gcm@openssh.com": 16, "aes256-gcm@openssh.com": 32,
+		"aes128-ctr": 16, "aes192-ctr": 24, "aes256-ctr": 32,
+	}[algs.Cipher]
+	block, err := aes.NewCipher(deriveKey(k, h, sessionID, keyLetter, keySize))
+	if err != nil {
+		return nil, err
+	}
+	d := &sshDirection{seq: seq}
+	if strings.HasSuffix(algs.Cipher, "-gcm@openssh.com") {
+		if d.aead, err = cipher.NewGCM(block); err != nil {
+			return nil, err
+		}
+		d.nonce = deriveKey(k, h, sessionID, ivLetter, 12)
+		return d, nil
+	}
+	d.stream = cipher.NewCTR(block, deriveKey(k, h, sessionID, ivLetter, aes.BlockSize))
+	switch algs.MAC {
+	case "hmac-sha2-256":
+		d.mac = hmac.New(sha256.New, deriveKey(k, h, sessionID, macLetter, sha256.Size))
+	case "hmac-sha2-512":
+		d.mac = hmac.New(sha512.New, deriveKey(k, h, sessionID, macLetter, sha512.Size))
+	}
+	return d, nil
+}
@@ -0,0 +1,616 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"network-test-api/pkg/nettest"
+)
+
+// STUN (RFC 5389) Binding tests of the agent's NAT, with the behavior discovery of RFC 5780
+const (
+	DEFAULT_STUN_PORT = 3478
+	MAX_STUN_SERVERS  = 4 // Additional stun_servers compared with server_host
+
+	STUN_RTO      = 250 * time.Millisecond // First retransmission timeout, doubled per attempt
+	STUN_ATTEMPTS = 3                      // Requests per transaction; a filtered test waits 1.75s in all
+
+	stunMagicCookie    = 0x2112A442
+	stunHeaderSize     = 20
+	stunBindingRequest = 0x0001
+	stunBindingSuccess = 0x0101
+	stunBindingError   = 0x0111
+
+	stunAttrMappedAddress    = 0x0001
+	stunAttrChangeRequest    = 0x0003
+	stunAttrChangedAddress   = 0x0005 // RFC 3489 predecessor of OTHER-ADDRESS
+	stunAttrErrorCode        = 0x0009
+	stunAttrXORMappedAddress = 0x0020
+	stunAttrOtherAddress     = 0x802C
+
+	stunChangeIP   = 0x04
+	stunChangePort = 0x02
+)
+
+// NAT mapping and filtering behaviors (RFC 4787)
+const (
+	NAT_BEHAVIOR_ENDPOINT_INDEPENDENT   = "endpoint_independent"
+	NAT_BEHAVIOR_ADDRESS_DEPENDENT      = "address_dependent"
+	NAT_BEHAVIOR_ADDRESS_PORT_DEPENDENT = "address_and_port_dependent"
+	NAT_BEHAVIOR_DEPENDENT              = "dependent" // Differs per server, without an RFC 5780 server to tell how
+	NAT_BEHAVIOR_UNKNOWN                = "unknown"
+)
+
+// Classic NAT types (RFC 3489), for people who think in those terms
+const (
+	NAT_TYPE_OPEN_INTERNET   = "open_internet"
+	NAT_TYPE_UDP_FIREWALL    = "udp_firewall" // Public address, but only replies get in
+	NAT_TYPE_FULL_CONE       = "full_cone"
+	NAT_TYPE_RESTRICTED_CONE = "restricted_cone"
+	NAT_TYPE_PORT_RESTRICTED = "port_restricted_cone"
+	NAT_TYPE_CONE            = "cone" // Endpoint-independent mapping, filtering not known
+	NAT_TYPE_SYMMETRIC       = "symmetric"
+	NAT_TYPE_UDP_BLOCKED     = "udp_blocked"
+	NAT_TYPE_UNKNOWN         = "unknown"
+)
+
+// STUNServerMapping is the public address one STUN server saw
+type STUNServerMapping struct {
+	Server        string  `json:"server"`
+	Address       string  `json:"address,omitempty"`
+	PublicAddress string  `json:"public_address,omitempty"`
+	RTTMs         float64 `json:"rtt_ms,omitempty"`
+	Error         string  `json:"error,omitempty"`
+}
+
+// STUNReport is the outcome of a NAT test
+type STUNReport struct {
+	Family        string              `json:"family"`
+	ServerAddress string              `json:"server_address"`
+	LocalAddress  string              `json:"local_address"`
+	PublicAddress string              `json:"public_address,omitempty"`
+	RTTMs         float64             `json:"rtt_ms,omitempty"`
+	UDPBlocked    bool                `json:"udp_blocked"` // No Binding response at all
+	BehindNAT     bool                `json:"behind_nat"`
+	PortPreserved bool                `json:"port_preserved"` // The NAT kept the local port
+	Mapping       string              `json:"mapping"`
+	Filtering     string              `json:"filtering"`
+	NATType       string              `json:"nat_type"`
+	Hairpinning   *bool               `json:"hairpinning,omitempty"` // Behind a NAT only
+	RFC5780       bool                `json:"rfc5780"`               // The server has an alternate address for behavior tests
+	OtherAddress  string              `json:"other_address,omitempty"`
+	Servers       []STUNServerMapping `json:"servers,omitempty"` // Mappings seen by stun_servers
+}
+
+// stunResponse is a parsed Binding success response
+type stunResponse struct {
+	mapped *net.UDPAddr
+	other  *net.UDPAddr
+	from   *net.UDPAddr // Source of the response packet
+	rtt    time.Duration
+}
+
+// newStunRequest encodes a Binding request, with CHANGE-REQUEST when change is set
+func newStunRequest(change byte) ([12]byte, []byte) {
+	var txid [12]byte
+	_, _ = rand.Read(txid[:])
+	length := 0
+	if change != 0 {
+		length = 8
+	}
+	msg := make([]byte, stunHeaderSize+length)
+	binary.BigEndian.PutUint16(msg[0:], stunBindingRequest)
+	binary.BigEndian.PutUint16(msg[2:], uint16(length))
+	binary.BigEndian.PutUint32(msg[4:], stunMagicCookie)
+	copy(msg[8:20], txid[:])
+	if change != 0 {
+		binary.BigEndian.PutUint16(msg[20:], stunAttrChangeRequest)
+		binary.BigEndian.PutUint16(msg[22:], 4)
+		msg[27] = change
+	}
+	return txid, msg
+}
+
+// stunHeader returns the type of a STUN message and whether it belongs to txid
+func stunHeader(b []byte, txid [12]byte) (uint16, bool) {
+	if len(b) < stunHeaderSize || binary.BigEndian.Uint32(b[4:]) != stunMagicCookie {
+		return 0, false
+	}
+	return binary.BigEndian.Uint16(b[0:]), string(b[8:20]) == string(txid[:])
+}
+
+// parseStunAddress decodes a (XOR-)MAPPED-ADDRESS style attribute value
+func parseStunAddress(v []byte, xor bool, txid [12]byte) (*net.UDPAddr, error) {
+	if len(v) < 8 {
+		return nil, errors.New("short address attribute")
+	}
+	port := binary.BigEndian.Uint16(v[2:])
+	var ip net.IP
+	switch v[1] {
+	case 0x01:
+		ip = net.IP(append([]byte(nil), v[4:8]...))
+	case 0x02:
+		if len(v) < 20 {
+			return nil, errors.New("short IPv6 address attribute")
+		}
+		ip = net.IP(append([]byte(nil), v[4:20]...))
+	default:
+		return nil, fmt.Errorf("unknown address family %d", v[1])
+	}
+	if xor {
+		var key [16]byte
+		binary.BigEndian.PutUint32(key[0:], stunMagicCookie)
+		copy(key[4:], txid[:])
+		port ^= stunMagicCookie >> 16
+		for i := range ip {
+			ip[i] ^= key[i]
+		}
+	}
+	return &net.UDPAddr{IP: ip, Port: int(port)}, nil
+}
+
+// parseStunResponse decodes a Binding response to txid. Error responses, such as
+// 420 from servers without CHANGE-REQUEST support, are returned as errors.
+func parseStunResponse(b []byte, txid [12]byte) (*stunResponse, error) {
+	msgType, ours := stunHeader(b, txid)
+	if !ours {
+		return nil, errors.New("not a response to this request")
+	}
+	length := int(binary.BigEndian.Uint16(b[2:]))
+	if stunHeaderSize+length > len(b) {
+		return nil, errors.New("truncated STUN message")
+	}
+	r := &stunResponse{}
+	var mapped *net.UDPAddr
+	for attrs := b[stunHeaderSize : stunHeaderSize+length]; len(attrs) >= 4; {
+		attrType := binary.BigEndian.Uint16(attrs[0:])
+		attrLen := int(binary.BigEndian.Uint16(attrs[2:]))
+		if 4+attrLen > len(attrs) {
+			return nil, errors.New("truncated STUN attribute")
+		}
+		v := attrs[4 : 4+attrLen]
+		var err error
+		switch attrType {
+		case stunAttrXORMappedAddress:
+			r.mapped, err = parseStunAddress(v, true, txid)
+		case stunAttrMappedAddress:
+			mapped, err = parseStunAddress(v, false, txid)
+		case stunAttrOtherAddress, stunAttrChangedAddress:
+			r.other, err = parseStunAddress(v, false, txid)
+		case stunAttrErrorCode:
+			if msgType == stunBindingError && len(v) >= 4 {
+				return nil, fmt.Errorf("STUN error %d: %s", int(v[2]&0x07)*100+int(v[3]), v[4:])
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		next := 4 + (attrLen+3)&^3 // Values are padded to 4 bytes
+		if next > len(attrs) {
+			break
+		}
+		attrs = attrs[next:]
+	}
+	switch {
+	case msgType == stunBindingError:
+		return nil, errors.New("STUN error response")
+	case msgType != stunBindingSuccess:
+		return nil, fmt.Errorf("unexpected STUN message type 0x%04x", msgType)
+	}
+	// RFC 3489 servers only send MAPPED-ADDRESS
+	if r.mapped == nil {
+		r.mapped = mapped
+	}
+	if r.mapped == nil {
+		return nil, errors.New("response has no mapped address")
+	}
+	return r, nil
+}
+
+// stunTransact sends a Binding request to addr, retransmitting with a doubling
+// timeout, and returns the response; nil without an error means none came back
+func stunTransact(conn *net.UDPConn, addr *net.UDPAddr, change byte) (*stunResponse, error) {
+	txid, msg := newStunRequest(change)
+	buf := make([]byte, 1500)
+	start := time.Now()
+	wait := STUN_RTO
+	for attempt := 0; attempt < STUN_ATTEMPTS; attempt++ {
+		if _, err := conn.WriteToUDP(msg, addr); err != nil {
+			return nil, err
+		}
+		_ = conn.SetReadDeadline(time.Now().Add(wait))
+		for {
+			n, from, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				var netErr net.Error
+				if errors.As(err, &netErr) && netErr.Timeout() {
+					break
+				}
+				return nil, err
+			}
+			if _, ours := stunHeader(buf[:n], txid); !ours {
+				continue
+			}
+			r, err := parseStunResponse(buf[:n], txid)
+			if err != nil {
+				return nil, err
+			}
+			r.from = from
+			r.rtt = time.Since(start)
+			return r, nil
+		}
+		wait *= 2
+	}
+	return nil, nil
+}
+
+// stunHairpin sends a Binding request to the socket's own public address and
+// reports whether the NAT looped it back (RFC 5780 section 4.6)
+func stunHairpin(conn *net.UDPConn, public *net.UDPAddr) (bool, error) {
+	txid, msg := newStunRequest(0)
+	buf := make([]byte, 1500)
+	wait := STUN_RTO
+	for attempt := 0; attempt < STUN_ATTEMPTS; attempt++ {
+		if _, err := conn.WriteToUDP(msg, public); err != nil {
+			return false, err
+		}
+		_ = conn.SetReadDeadline(time.Now().Add(wait))
+		for {
+			n, _, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				var netErr net.Error
+				if errors.As(err, &netErr) && netErr.Timeout() {
+					break
+				}
+				return false, err
+			}
+			if msgType, ours := stunHeader(buf[:n], txid); ours && msgType == stunBindingRequest {
+				return true, nil
+			}
+		}
+		wait *= 2
+	}
+	return false, nil
+}
+
+func sameUDPAddr(a, b *net.UDPAddr) bool {
+	return a != nil && b != nil && a.IP.Equal(b.IP) && a.Port == b.Port
+}
+
+// stunMappingFromServers compares the public addresses other servers saw with
+// the primary one: a change means the mapping depends on the destination
+func stunMappingFromServers(public *net.UDPAddr, servers []STUNServerMapping) string {
+	mapping := NAT_BEHAVIOR_UNKNOWN
+	for _, s := range servers {
+		if s.PublicAddress == "" {
+			continue
+		}
+		if s.PublicAddress != public.String() {
+			return NAT_BEHAVIOR_DEPENDENT
+		}
+		mapping = NAT_BEHAVIOR_ENDPOINT_INDEPENDENT
+	}
+	return mapping
+}
+
+// classifyNAT names the RFC 3489 NAT type of a mapping and filtering behavior
+func classifyNAT(behindNAT bool, mapping, filtering string) string {
+	if !behindNAT {
+		switch filtering {
+		case NAT_BEHAVIOR_ENDPOINT_INDEPENDENT:
+			return NAT_TYPE_OPEN_INTERNET
+		case NAT_BEHAVIOR_ADDRESS_DEPENDENT, NAT_BEHAVIOR_ADDRESS_PORT_DEPENDENT:
+			return NAT_TYPE_UDP_FIREWALL
+		}
+		return NAT_TYPE_UNKNOWN
+	}
+	switch mapping {
+	case NAT_BEHAVIOR_ADDRESS_DEPENDENT, NAT_BEHAVIOR_ADDRESS_PORT_DEPENDENT, NAT_BEHAVIOR_DEPENDENT:
+		return NAT_TYPE_SYMMETRIC
+	case NAT_BEHAVIOR_ENDPOINT_INDEPENDENT:
+		switch filtering {
+		case NAT_BEHAVIOR_ENDPOINT_INDEPENDENT:
+			return NAT_TYPE_FULL_CONE
+		case NAT_BEHAVIOR_ADDRESS_DEPENDENT:
+			return NAT_TYPE_RESTRICTED_CONE
+		case NAT_BEHAVIOR_ADDRESS_PORT_DEPENDENT:
+			return NAT_TYPE_PORT_RESTRICTED
+		}
+		return NAT_TYPE_CONE
+	}
+	return NAT_TYPE_UNKNOWN
+}
+
+// validateSTUN checks the server list of a NAT test request
+func validateSTUN(req RunRequest) error {
+	switch {
+	case req.ServerHost == "":
+		return fmt.Errorf("server_host is required")
+	case len(req.STUNServers) > MAX_STUN_SERVERS:
+		return fmt.Errorf("at most %d stun_servers", MAX_STUN_SERVERS)
+	}
+	for _, s := range req.STUNServers {
+		if _, _, err := splitHostPortDefault(s, DEFAULT_STUN_PORT); err != nil {
+			return fmt.Errorf("invalid stun_servers entry %q: %v", s, err)
+		}
+	}
+	return nil
+}
+
+// splitHostPortDefault splits host[:port], defaulting the port
+func splitHostPortDefault(s string, port int) (string, int, error) {
+	host, p, err := net.SplitHostPort(s)
+	if err != nil {
+		// No port, possibly a bare IPv6 address
+		if net.ParseIP(s) != nil || !strings.Contains(s, ":") {
+			return s, port, nil
+		}
+		return "", 0, err
+	}
+	n, err := strconv.Atoi(p)
+	if err != nil || n < 1 || n > 65535 {
+		return "", 0, fmt.Errorf("invalid port %q", p)
+	}
+	return host, n, nil
+}
+
+// resolveUDP picks the address of host to send to, the first of the requested family
+func resolveUDP(host string, port int, family string) (*net.UDPAddr, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	v6, v4, err := nettest.ResolveFamilies(ctx, host, family)
+	if err != nil {
+		return nil, err
+	}
+	addrs := nettest.InterleaveFamilies(v6, v4)
+	return &net.UDPAddr{IP: addrs[0], Port: port}, nil
+}
+
+// runSTUN applies defaults to a decoded request, runs the NAT test and records the result.
+// Errors come with the HTTP status to report them with.
+func runSTUN(req RunRequest, profile *Profile) (map[string]interface{}, int, error) {
+	if req.ServerPort == 0 {
+		req.ServerPort = DEFAULT_STUN_PORT
+	}
+	if err := checkProfileLimits(req, profile); err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	err := validateSTUN(req)
+	if err == nil {
+		req.AddressFamily, err = parseAddressFamily(req.AddressFamily)
+	}
+	if err == nil && req.AddressFamily == nettest.FAMILY_COMPARE {
+		err = fmt.Errorf("address_family compare is not available for NAT tests; run ipv4 and ipv6 separately")
+	}
+	if err == nil {
+		err = validateLockWait(&req)
+	}
+	if err == nil {
+		err = validateCallbackURL(req.CallbackURL)
+	}
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	lock, release, status, err := lockTest(TEST_TYPE_STUN, req, false)
+	if err != nil {
+		return nil, status, err
+	}
+	defer release()
+
+	logf(req.ctx, "STUN test: %s:%d (%d more servers, family=%s)", req.ServerHost, req.ServerPort, len(req.STUNServers), req.AddressFamily)
+
+	started := time.Now()
+	report, err := stunTest(req)
+	if err != nil {
+		return nil, http.StatusInternalServerError, fmt.Errorf("STUN test failed: %v", err)
+	}
+
+	data := map[string]interface{}{
+		"server":         req.ServerHost,
+		"port":           req.ServerPort,
+		"family":         report.Family,
+		"server_address": report.ServerAddress,
+		"local_address":  report.LocalAddress,
+		"public_address": report.PublicAddress,
+		"rtt_ms":         report.RTTMs,
+		"udp_blocked":    report.UDPBlocked,
+		"behind_nat":     report.BehindNAT,
+		"port_preserved": report.PortPreserved,
+		"mapping":        report.Mapping,
+		"filtering":      report.Filtering,
+		"nat_type":       report.NATType,
+		"rfc5780":        report.RFC5780,
+		"duration_sec":   time.Since(started).Seconds(),
+	}
+	if report.Hairpinning != nil {
+		data["hairpinning"] = *report.Hairpinning
+	}
+	if report.OtherAddress != "" {
+		data["other_address"] = report.OtherAddress
+	}
+	if len(report.Servers) > 0 {
+		data["servers"] = report.Servers
+	}
+	if profile != nil {
+		data["profile"] = profile.Name
+	}
+	data["lock"] = lock
+
+	recordResult(TEST_TYPE_STUN, req, started, data)
+	notifyCallback(req.CallbackURL, data)
+
+	return data, http.StatusOK, nil
+}
+
+// stunTest runs the RFC 5780 mapping, filtering and hairpinning tests from one
+// socket, so every test shares the NAT binding of the first
+func stunTest(req RunRequest) (*STUNReport, error) {
+	server, err := resolveUDP(req.ServerHost, req.ServerPort, req.AddressFamily)
+	if err != nil {
+		return nil, err
+	}
+	report := &STUNReport{Family: nettest.IPFamily(server.IP), ServerAddress: server.String(),
+		Mapping: NAT_BEHAVIOR_UNKNOWN, Filtering: NAT_BEHAVIOR_UNKNOWN, NATType: NAT_TYPE_UNKNOWN}
+	network := "udp4"
+	if report.Family == nettest.FAMILY_IPV6 {
+		network = "udp6"
+	}
+
+	// The source address the kernel picks towards the server, to tell a NAT from none
+	probe, err := net.DialUDP(network, nil, server)
+	if err != nil {
+		return nil, err
+	}
+	localIP := probe.LocalAddr().(*net.UDPAddr).IP
+	_ = probe.Close()
+
+	conn, err := net.ListenUDP(network, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = conn.Close() }()
+	local := &net.UDPAddr{IP: localIP, Port: conn.LocalAddr().(*net.UDPAddr).Port}
+	report.LocalAddress = local.String()
+
+	first, err := stunTransact(conn, server, 0)
+	if err != nil {
+		return nil, err
+	}
+	if first == nil {
+		report.UDPBlocked = true
+		report.NATType = NAT_TYPE_UDP_BLOCKED
+		return report, nil
+	}
+	public := first.mapped
+	report.PublicAddress = public.String()
+	report.RTTMs = float64(first.rtt.Microseconds()) / 1000
+	report.BehindNAT = !sameUDPAddr(public, local)
+	report.PortPreserved = public.Port == local.Port
+
+	other := first.other
+	if other != nil && !other.IP.Equal(server.IP) && other.Port != server.Port {
+		report.RFC5780 = true
+		report.OtherAddress = other.String()
+	} else {
+		other = nil
+	}
+
+	for _, s := range req.STUNServers {
+		report.Servers = append(report.Servers, stunServerMapping(conn, s, report.Family))
+	}
+
+	// Mapping: does the public address change with the destination?
+	switch {
+	case !report.BehindNAT:
+		report.Mapping = NAT_BEHAVIOR_ENDPOINT_INDEPENDENT
+	case other != nil:
+		report.Mapping, err = stunMappingBehavior(conn, public, server, other)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		report.Mapping = stunMappingFromServers(public, report.Servers)
+	}
+
+	// Filtering: which sources may send to the public address?
+	if other != nil {
+		report.Filtering = stunFilteringBehavior(conn, server)
+	}
+
+	if report.BehindNAT {
+		hairpin, err := stunHairpin(conn, public)
+		if err != nil {
+			return nil, err
+		}
+		report.Hairpinning = &hairpin
+	}
+	report.NATType = classifyNAT(report.BehindNAT, report.Mapping, report.Filtering)
+	return report, nil
+}
+
+// stunMappingBehavior sends from the same socket to the server's alternate IP and then its
+// alternate IP and port (RFC 5780 section 4.3)
+func stunMappingBehavior(conn *net.UDPConn, public, server, other *net.UDPAddr) (string, error) {
+	second, err := stunTransact(conn, &net.UDPAddr{IP: other.IP, Port: server.Port}, 0)
+	if err != nil || second == nil {
+		return NAT_BEHAVIOR_UNKNOWN, err
+	}
+	if sameUDPAddr(second.mapped, public) {
+		return NAT_BEHAVIOR_ENDPOINT_INDEPENDENT, nil
+	}
+	third, err := stunTransact(conn, other, 0)
+	if err != nil || third == nil {
+		return NAT_BEHAVIOR_UNKNOWN, err
+	}
+	if sameUDPAddr(third.mapped, second.mapped) {
+		return NAT_BEHAVIOR_ADDRESS_DEPENDENT, nil
+	}
+	return NAT_BEHAVIOR_ADDRESS_PORT_DEPENDENT, nil
+}
+
+// stunFilteringBehavior asks the server to answer from its alternate IP and port,
+// then from its alternate port only (RFC 5780 section 4.4). Servers that refuse
+// CHANGE-REQUEST, or answer from the primary address anyway, leave it unknown.
+func stunFilteringBehavior(conn *net.UDPConn, server *net.UDPAddr) string {
+	received, ok := stunChangedResponse(conn, server, stunChangeIP|stunChangePort)
+	switch {
+	case !ok:
+		return NAT_BEHAVIOR_UNKNOWN
+	case received:
+		return NAT_BEHAVIOR_ENDPOINT_INDEPENDENT
+	}
+	received, ok = stunChangedResponse(conn, server, stunChangePort)
+	switch {
+	case !ok:
+		return NAT_BEHAVIOR_UNKNOWN
+	case received:
+		return NAT_BEHAVIOR_ADDRESS_DEPENDENT
+	}
+	return NAT_BEHAVIOR_ADDRESS_PORT_DEPENDENT
+}
+
+// stunChangedResponse reports whether a response to a CHANGE-REQUEST got through;
+// ok is false when the server could not run the test
+func stunChangedResponse(conn *net.UDPConn, server *net.UDPAddr, change byte) (bool, bool) {
+	r, err := stunTransact(conn, server, change)
+	switch {
+	case err != nil:
+		return false, false
+	case r == nil:
+		return false, true
+	case sameUDPAddr(r.from, server):
+		return false, false // CHANGE-REQUEST ignored
+	}
+	return true, true
+}
+
+// stunServerMapping asks one of stun_servers for the public address of conn
+func stunServerMapping(conn *net.UDPConn, s, family string) STUNServerMapping {
+	m := STUNServerMapping{Server: s}
+	host, port, _ := splitHostPortDefault(s, DEFAULT_STUN_PORT)
+	addr, err := resolveUDP(host, port, family)
+	if err == nil {
+		m.Address = addr.String()
+		var r *stunResponse
+		if r, err = stunTransact(conn, addr, 0); err == nil && r == nil {
+			err = errors.New("no response")
+		}
+		if err == nil {
+			m.PublicAddress = r.mapped.String()
+			m.RTTMs = float64(r.rtt.Microseconds()) / 1000
+		}
+	}
+	if err != nil {
+		m.Error = err.Error()
+	}
+	return m
+}
@@ -0,0 +1,77 @@
+package api
+
+import (
+	"net"
+	"testing"
+)
+
+func TestParseStunXORMappedAddress(t *testing.T) {
+	// RFC 5769 section 2.2 sample response: 192.0.2.1 port 32853
+	var txid [12]byte
+	copy(txid[:], []byte{0xb7, 0xe7, 0xa7, 0x01, 0xbc, 0x34, 0xd6, 0x86, 0xfa, 0x87, 0xdf, 0xae})
+	v := []byte{0x00, 0x01, 0xa1, 0x47, 0xe1, 0x12, 0xa6, 0x43}
+	addr, err := parseStunAddress(v, true, txid)
+	if err != nil {
+		t.Fatalf("Expected the sample to parse, got %v", err)
+	}
+	if addr.String() != "192.0.2.1:32853" {
+		t.Errorf("Expected 192.0.2.1:32853, got %s", addr)
+	}
+
+	// RFC 5769 section 2.3: 2001:db8:1234:5678:11:2233:4455:6677 port 32853
+	v6 := []byte{0x00, 0x02, 0xa1, 0x47,
+		0x01, 0x13, 0xa9, 0xfa, 0xa5, 0xd3, 0xf1, 0x79, 0xbc, 0x25, 0xf4, 0xb5, 0xbe, 0xd2, 0xb9, 0xd9}
+	addr, err = parseStunAddress(v6, true, txid)
+	if err != nil || addr.String() != "[2001:db8:1234:5678:11:2233:4455:6677]:32853" {
+		t.Errorf("Expected the IPv6 sample address, got %v (%v)", addr, err)
+	}
+}
+
+func TestParseStunMappedAddress(t *testing.T) {
+	v := []byte{0x00, 0x01, 0x0d, 0x96, 198, 51, 100, 7}
+	addr, err := parseStunAddress(v, false, [12]byte{})
+	if err != nil || addr.String() != "198.51.100.7:3478" {
+		t.Errorf("Expected 198.51.100.7:3478, got %v (%v)", addr, err)
+	}
+	if _, err := parseStunAddress([]byte{0x00, 0x03, 0, 0, 0, 0, 0, 0}, false, [12]byte{}); err == nil {
+		t.Error("Expected error for an unknown address family")
+	}
+}
+
+func TestStunMappingFromServers(t *testing.T) {
+	public := &net.UDPAddr{IP: net.ParseIP("203.0.113.5"), Port: 40000}
+	if m := stunMappingFromServers(public, nil); m != NAT_BEHAVIOR_UNKNOWN {
+		t.Errorf("Expected unknown without other servers, got %s", m)
+	}
+	same := []STUNServerMapping{{Server: "a", PublicAddress: "203.0.113.5:40000"}, {Server: "b"}}
+	if m := stunMappingFromServers(public, same); m != NAT_BEHAVIOR_ENDPOINT_INDEPENDENT {
+		t.Errorf("Expected endpoint_independent when every server saw the same address, got %s", m)
+	}
+	changed := append(same, STUNServerMapping{Server: "c", PublicAddress: "203.0.113.5:40012"})
+	if m := stunMappingFromServers(public, changed); m != NAT_BEHAVIOR_DEPENDENT {
+		t.Errorf("Expected dependent when a server saw another port, got %s", m)
+	}
+}
+
+func TestClassifyNAT(t *testing.T) {
+	cases := []struct {
+		behindNAT          bool
+		mapping, filtering string
+		expected           string
+	}{
+		{false, NAT_BEHAVIOR_ENDPOINT_INDEPENDENT, NAT_BEHAVIOR_ENDPOINT_INDEPENDENT, NAT_TYPE_OPEN_INTERNET},
+		{false, NAT_BEHAVIOR_ENDPOINT_INDEPENDENT, NAT_BEHAVIOR_ADDRESS_PORT_DEPENDENT, NAT_TYPE_UDP_FIREWALL},
+		{true, NAT_BEHAVIOR_ENDPOINT_INDEPENDENT, NAT_BEHAVIOR_ENDPOINT_INDEPENDENT, NAT_TYPE_FULL_CONE},
+		{true, NAT_BEHAVIOR_ENDPOINT_INDEPENDENT, NAT_BEHAVIOR_ADDRESS_DEPENDENT, NAT_TYPE_RESTRICTED_CONE},
+		{true, NAT_BEHAVIOR_ENDPOINT_INDEPENDENT, NAT_BEHAVIOR_ADDRESS_PORT_DEPENDENT, NAT_TYPE_PORT_RESTRICTED},
+		{true, NAT_BEHAVIOR_ENDPOINT_INDEPENDENT, NAT_BEHAVIOR_UNKNOWN, NAT_TYPE_CONE},
+		{true, NAT_BEHAVIOR_ADDRESS_PORT_DEPENDENT, NAT_BEHAVIOR_ADDRESS_PORT_DEPENDENT, NAT_TYPE_SYMMETRIC},
+		{true, NAT_BEHAVIOR_DEPENDENT, NAT_BEHAVIOR_UNKNOWN, NAT_TYPE_SYMMETRIC},
+		{true, NAT_BEHAVIOR_UNKNOWN, NAT_BEHAVIOR_UNKNOWN, NAT_TYPE_UNKNOWN},
+	}
+	for _, c := range cases {
+		if got := classifyNAT(c.behindNAT, c.mapping, c.filtering); got != c.expected {
+			t.Errorf("Expected %s for nat=%v mapping=%s filtering=%s, got %s", c.expected, c.behindNAT, c.mapping, c.filtering, got)
+		}
+	}
+}
@@ -0,0 +1,233 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path"
+	"strings"
+)
+
+// TargetPolicy restricts the hosts tests may run towards, by CIDR and by
+// hostname pattern. Blocked entries always win; with any allowed entries,
+// a target must also match one of them. CIDRs are matched against every
+// address a hostname resolves to, at validation time, and again against the
+// addresses tests connect to.
+type TargetPolicy struct {
+	Allowed []string `json:"allowed"`
+	Blocked []string `json:"blocked"`
+
+	allowed, blocked targetRules
+}
+
+// targetRules are the parsed entries of one side of a TargetPolicy
+type targetRules struct {
+	nets  []*net.IPNet
+	names []string // Lowercase path.Match patterns, e.g. *.example.net
+}
+
+var targetPolicy *TargetPolicy
+
+// loadTargetPolicy reads a policy file of the form {"allowed": ["203.0.113.0/24"], "blocked": ["*.internal"]}
+func loadTargetPolicy(file string) (*TargetPolicy, error) {
+	raw, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	policy := &TargetPolicy{}
+	if err := json.Unmarshal(raw, policy); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", file, err)
+	}
+	return policy, nil
+}
+
+// parse checks the policy's entries and sorts them into CIDRs and patterns
+func (p *TargetPolicy) parse() error {
+	var err error
+	if p.allowed, err = parseTargetRules(p.Allowed); err != nil {
+		return fmt.Errorf("allowed: %w", err)
+	}
+	if p.blocked, err = parseTargetRules(p.Blocked); err != nil {
+		return fmt.Errorf("blocked: %w", err)
+	}
+	return nil
+}
+
+// parseTargetRules parses CIDRs, single addresses and hostname patterns
+func parseTargetRules(entries []string) (targetRules, error) {
+	var rules targetRules
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if _, ipNet, err := net.ParseCIDR(entry); err == nil {
+			rules.nets = append(rules.nets, ipNet)
+			continue
+		}
+		if ip := net.ParseIP(entry); ip != nil {
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			rules.nets = append(rules.nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		pattern := strings.ToLower(strings.TrimSuffix(entry, "."))
+		if _, err := path.Match(pattern, ""); err != nil || pattern == "" || strings.ContainsAny(pattern, "/ ") {
+			return rules, fmt.Errorf("%q is neither a CIDR, an address nor a hostname pattern", entry)
+		}
+		rules.names = append(rules.names, pattern)
+	}
+	return rules, nil
+}
+
+// empty reports whether the rules have no entries
+func (r targetRules) empty() bool {
+	return len(r.nets) == 0 && len(r.names) == 0
+}
+
+// matchName returns the pattern that matches a lowercase hostname, if any
+func (r targetRules) matchName(name string) string {
+	for _, pattern := range r.names {
+		if ok, _ := path.Match(pattern, name); ok {
+			return pattern
+		}
+	}
+	return ""
+}
+
+// matchIP returns the CIDR that contains ip, if any
+func (r targetRules) matchIP(ip net.IP) *net.IPNet {
+	for _, n := range r.nets {
+		if n.Contains(ip) {
+			return n
+		}
+	}
+	return nil
+}
+
+// enabled reports whether the policy restricts any target
+func (p *TargetPolicy) enabled() bool {
+	return p != nil && !(p.allowed.empty() && p.blocked.empty())
+}
+
+// check returns why host is not an allowed target, as a field message, or
+// nil. Hostnames are looked up only when a CIDR may match them; a hostname
+// that does not resolve passes the blocked CIDRs, as its test fails anyway,
+// but not the allowed ones.
+func (p *TargetPolicy) check(host string) error {
+	if !p.enabled() {
+		return nil
+	}
+	addr, _, _ := strings.Cut(host, "%")
+	ip := net.ParseIP(addr)
+	name := strings.ToLower(strings.TrimSuffix(host, "."))
+	if ip == nil {
+		if pattern := p.blocked.matchName(name); pattern != "" {
+			return fmt.Errorf("is a blocked target: matches %s", pattern)
+		}
+	}
+
+	var addrs []net.IP
+	var lookupErr error
+	switch {
+	case ip != nil:
+		addrs = []net.IP{ip}
+	case len(p.blocked.nets) > 0 || len(p.allowed.nets) > 0:
+		addrs, lookupErr = targetAddresses(host)
+	}
+	for _, a := range addrs {
+		if n := p.blocked.matchIP(a); n != nil {
+			if ip != nil {
+				return fmt.Errorf("is a blocked target: in %s", n)
+			}
+			return fmt.Errorf("is a blocked target: resolves to %s in %s", a, n)
+		}
+	}
+
+	if p.allowed.empty() || (ip == nil && p.allowed.matchName(name) != "") {
+		return nil
+	}
+	if ip == nil && len(p.allowed.nets) == 0 {
+		return fmt.Errorf("is not an allowed target: matches no allowed hostname pattern")
+	}
+	if lookupErr != nil {
+		return fmt.Errorf("is not an allowed target: cannot be resolved to check it (%v)", lookupErr)
+	}
+	for _, a := range addrs {
+		if p.allowed.matchIP(a) == nil {
+			if ip != nil {
+				return fmt.Errorf("is not an allowed target: in no allowed CIDR")
+			}
+			return fmt.Errorf("is not an allowed target: resolves to %s, in no allowed CIDR", a)
+		}
+	}
+	return nil
+}
+
+// checkAddress returns why ip, an address a test is about to connect to, is
+// not an allowed target, or nil. name is the hostname ip was resolved from,
+// or "" when it was dialed as an address. A name allowed by pattern admits
+// the addresses it resolves to outside the blocked CIDRs; any other address
+// must be in an allowed CIDR. A policy with only allowed patterns cannot
+// check an address dialed without its name, and lets it pass.
+func (p *TargetPolicy) checkAddress(name string, ip net.IP) error {
+	if !p.enabled() {
+		return nil
+	}
+	if n := p.blocked.matchIP(ip); n != nil {
+		return fmt.Errorf("is a blocked target: in %s", n)
+	}
+	if addr, _, _ := strings.Cut(name, "%"); net.ParseIP(addr) != nil {
+		name = ""
+	}
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+	if name != "" {
+		if pattern := p.blocked.matchName(name); pattern != "" {
+			return fmt.Errorf("is a blocked target: matches %s", pattern)
+		}
+		if p.allowed.matchName(name) != "" {
+			return nil
+		}
+	}
+	switch {
+	case p.allowed.empty():
+		return nil
+	case len(p.allowed.nets) > 0 && p.allowed.matchIP(ip) == nil:
+		return fmt.Errorf("is not an allowed target: in no allowed CIDR")
+	case len(p.allowed.nets) == 0 && name != "":
+		return fmt.Errorf("is not an allowed target: matches no allowed hostname pattern")
+	}
+	return nil
+}
+
+// configureTargetRules loads TARGET_POLICY_FILE and the comma-separated
+// entries of ALLOWED_TARGETS and BLOCKED_TARGETS, if set
+func configureTargetRules() {
+	policy := &TargetPolicy{}
+	if file := os.Getenv("TARGET_POLICY_FILE"); file != "" {
+		loaded, err := loadTargetPolicy(file)
+		if err != nil {
+			log.Fatalf("Loading target policy failed: %v", err)
+		}
+		policy = loaded
+	}
+	for _, entry := range strings.Split(os.Getenv("ALLOWED_TARGETS"), ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			policy.Allowed = append(policy.Allowed, entry)
+		}
+	}
+	for _, entry := range strings.Split(os.Getenv("BLOCKED_TARGETS"), ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			policy.Blocked = append(policy.Blocked, entry)
+		}
+	}
+	if err := policy.parse(); err != nil {
+		log.Fatalf("Invalid target policy: %v", err)
+	}
+	if !policy.enabled() {
+		return
+	}
+	targetPolicy = policy
+	logf(nil, "Target policy: %d allowed and %d blocked targets", len(policy.Allowed), len(policy.Blocked))
+}
@@ -0,0 +1,313 @@
+package api
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"network-test-api/pkg/nettest"
+)
+
+func newTargetPolicy(t *testing.T, allowed, blocked []string) *TargetPolicy {
+	t.Helper()
+	p := &TargetPolicy{Allowed: allowed, Blocked: blocked}
+	if err := p.parse(); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+// rebindingResolver points net.DefaultResolver at a name server that answers
+// A queries with answers in turn, repeating the last one
+func rebindingResolver(t *testing.T, answers ...string) {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var mu sync.Mutex
+	queries := 0
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			n, from, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			// The question ends 4 bytes (type, class) after the name's root label
+			end := 12
+			for end < n && buf[end] != 0 {
+				end += int(buf[end]) + 1
+			}
+			end += 5
+			if end > n {
+				continue
+			}
+			qtype := binary.BigEndian.Uint16(buf[end-4:])
+			reply := append([]byte{buf[0], buf[1], 0x81, 0x80, 0, 1, 0, 0, 0, 0, 0, 0}, buf[12:end]...)
+			if qtype == 1 {
+				mu.Lock()
+				answer := answers[min(queries, len(answers)-1)]
+				queries++
+				mu.Unlock()
+				reply[7] = 1
+				reply = append(reply, 0xc0, 12, 0, 1, 0, 1, 0, 0, 0, 0, 0, 4)
+				reply = append(reply, net.ParseIP(answer).To4()...)
+			}
+			_, _ = conn.WriteTo(reply, from)
+		}
+	}()
+
+	resolver := net.DefaultResolver
+	net.DefaultResolver = &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "udp", conn.LocalAddr().String())
+		},
+	}
+	t.Cleanup(func() {
+		net.DefaultResolver = resolver
+		conn.Close()
+	})
+}
+
+// acceptCount counts the connections a local listener accepts
+func acceptCount(t *testing.T) (int, func() int) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	var mu sync.Mutex
+	accepted := 0
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			mu.Lock()
+			accepted++
+			mu.Unlock()
+			conn.Close()
+		}
+	}()
+	return ln.Addr().(*net.TCPAddr).Port, func() int {
+		time.Sleep(50 * time.Millisecond)
+		mu.Lock()
+		defer mu.Unlock()
+		return accepted
+	}
+}
+
+func TestParseTargetRules(t *testing.T) {
+	rules, err := parseTargetRules([]string{"10.0.0.0/8", " 192.0.2.7 ", "2001:db8::/32", "*.Internal.", "iperf-?.example.net"})
+	if err != nil {
+		t.Fatalf("expected valid rules, got %v", err)
+	}
+	if len(rules.nets) != 3 || len(rules.names) != 2 {
+		t.Fatalf("expected 3 CIDRs and 2 patterns, got %+v", rules)
+	}
+	if got := rules.nets[1].String(); got != "192.0.2.7/32" {
+		t.Errorf("expected a single address to become a /32, got %s", got)
+	}
+	if rules.names[0] != "*.internal" {
+		t.Errorf("expected patterns to be lowercased without the trailing dot, got %q", rules.names[0])
+	}
+
+	for _, entry := range []string{"10.0.0.0/33", "[a-", "http://example.net", ""} {
+		if _, err := parseTargetRules([]string{entry}); err == nil {
+			t.Errorf("expected %q to be rejected", entry)
+		}
+	}
+}
+
+func TestTargetRulesMatch(t *testing.T) {
+	rules, _ := parseTargetRules([]string{"10.0.0.0/8", "192.0.2.7", "2001:db8::/32", "*.internal", "iperf-?.example.net"})
+
+	names := map[string]bool{
+		"db.internal":          true,
+		"a.b.internal":         true, // * also matches dots
+		"internal":             false,
+		"iperf-1.example.net":  true,
+		"iperf-12.example.net": false,
+		"example.net":          false,
+	}
+	for name, want := range names {
+		if got := rules.matchName(name) != ""; got != want {
+			t.Errorf("matchName(%s): expected %v, got %v", name, want, got)
+		}
+	}
+
+	ips := map[string]bool{
+		"10.255.0.1":      true,
+		"::ffff:10.0.0.1": true, // IPv4-mapped
+		"192.0.2.7":       true,
+		"192.0.2.8":       false,
+		"2001:db8::1":     true,
+		"2001:db9::1":     false,
+		"8.8.8.8":         false,
+	}
+	for addr, want := range ips {
+		if got := rules.matchIP(net.ParseIP(addr)) != nil; got != want {
+			t.Errorf("matchIP(%s): expected %v, got %v", addr, want, got)
+		}
+	}
+}
+
+func TestTargetPolicyCheckAddress(t *testing.T) {
+	blocked := newTargetPolicy(t, nil, []string{"10.0.0.0/8", "*.internal"})
+	if err := blocked.checkAddress("", net.ParseIP("10.1.2.3")); err == nil || !strings.Contains(err.Error(), "10.0.0.0/8") {
+		t.Errorf("expected a blocked address to fail with its CIDR, got %v", err)
+	}
+	if err := blocked.checkAddress("", net.ParseIP("198.51.100.7")); err != nil {
+		t.Errorf("expected an address outside the blocked CIDRs to pass, got %v", err)
+	}
+	if err := blocked.checkAddress("DB.internal.", net.ParseIP("198.51.100.7")); err == nil || !strings.Contains(err.Error(), "*.internal") {
+		t.Errorf("expected an address dialed by a blocked name to fail with its pattern, got %v", err)
+	}
+
+	allowed := newTargetPolicy(t, []string{"198.51.100.0/24"}, nil)
+	if err := allowed.checkAddress("", net.ParseIP("203.0.113.9")); err == nil {
+		t.Error("expected an address outside the allowed CIDRs to fail")
+	}
+	if err := allowed.checkAddress("iperf.example.net", net.ParseIP("198.51.100.7")); err != nil {
+		t.Errorf("expected an allowed address to pass, got %v", err)
+	}
+
+	// Allowed CIDRs bind every address not dialed by an allowed name
+	mixed := newTargetPolicy(t, []string{"198.51.100.0/24", "*.example.net"}, nil)
+	tests := []struct {
+		name string
+		ip   string
+		pass bool
+	}{
+		{"iperf.example.net", "203.0.113.9", true},
+		{"", "203.0.113.9", false},
+		{"203.0.113.9", "203.0.113.9", false},
+		{"iperf.example.org", "203.0.113.9", false},
+		{"iperf.example.org", "198.51.100.7", true},
+		{"", "198.51.100.7", true},
+	}
+	for _, tt := range tests {
+		if err := mixed.checkAddress(tt.name, net.ParseIP(tt.ip)); (err == nil) != tt.pass {
+			t.Errorf("%q %s: expected pass=%v, got %v", tt.name, tt.ip, tt.pass, err)
+		}
+	}
+
+	// Patterns alone cannot check an address dialed without its name
+	patterns := newTargetPolicy(t, []string{"*.example.net"}, nil)
+	if err := patterns.checkAddress("", net.ParseIP("203.0.113.9")); err != nil {
+		t.Errorf("expected an address without a name to pass allowed patterns, got %v", err)
+	}
+	if err := patterns.checkAddress("iperf.example.org", net.ParseIP("203.0.113.9")); err == nil {
+		t.Error("expected a name matching no allowed pattern to fail")
+	}
+}
+
+func TestTargetCheck_RebindingAfterValidation(t *testing.T) {
+	policy := newTargetPolicy(t, nil, []string{"127.0.0.0/8"})
+	nettest.SetTargetCheck(policy.checkAddress)
+	t.Cleanup(func() { nettest.SetTargetCheck(nil) })
+	rebindingResolver(t, "198.51.100.7", "127.0.0.1")
+	port, accepted := acceptCount(t)
+
+	// Validation sees the public address
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	ips, err := net.DefaultResolver.LookupIP(ctx, "ip4", "rebind.test.")
+	if err != nil || len(ips) != 1 {
+		t.Fatalf("expected one address, got %v (%v)", ips, err)
+	}
+	if err := policy.checkAddress("rebind.test.", ips[0]); err != nil {
+		t.Fatalf("expected %s to pass validation, got %v", ips[0], err)
+	}
+
+	// The test resolves the name again and gets a blocked one
+	_, _, err = nettest.DialControl("rebind.test.", port, nettest.FAMILY_IPV4, 2*time.Second)
+	if err == nil || !strings.Contains(err.Error(), "resolves to 127.0.0.1, which is a blocked target") {
+		t.Errorf("expected the rebound address to be refused, got %v", err)
+	}
+	if n := accepted(); n != 0 {
+		t.Errorf("expected no connection to the rebound address, got %d", n)
+	}
+}
+
+func TestTargetCheck_DialerControl(t *testing.T) {
+	port, accepted := acceptCount(t)
+	address := net.JoinHostPort("127.0.0.1", fmt.Sprint(port))
+	var bind *nettest.SourceBinding
+
+	nettest.SetTargetCheck(newTargetPolicy(t, nil, []string{"127.0.0.0/8"}).checkAddress)
+	t.Cleanup(func() { nettest.SetTargetCheck(nil) })
+	if conn, err := bind.Dialer("tcp", time.Second).Dial("tcp", address); err == nil {
+		conn.Close()
+		t.Fatal("expected the dialer to refuse a blocked address")
+	}
+	if n := accepted(); n != 0 {
+		t.Errorf("expected no connection to a blocked address, got %d", n)
+	}
+
+	nettest.SetTargetCheck(nil)
+	conn, err := bind.Dialer("tcp", time.Second).Dial("tcp", address)
+	if err != nil {
+		t.Fatalf("expected the dialer to connect without a check, got %v", err)
+	}
+	conn.Close()
+	if n := accepted(); n != 1 {
+		t.Errorf("expected one connection, got %d", n)
+	}
+}
+
+func TestTargetCheck_DialedName(t *testing.T) {
+	port, accepted := acceptCount(t)
+	address := net.JoinHostPort("127.0.0.1", fmt.Sprint(port))
+	var bind *nettest.SourceBinding
+
+	// 127.0.0.1 is only allowed as an address of a name matching the pattern
+	nettest.SetTargetCheck(newTargetPolicy(t, []string{"198.51.100.0/24", "*.example.net"}, nil).checkAddress)
+	t.Cleanup(func() { nettest.SetTargetCheck(nil) })
+	if conn, err := bind.Dialer("tcp", time.Second).Dial("tcp", address); err == nil {
+		conn.Close()
+		t.Fatal("expected the dialer to refuse an address outside the allowed CIDRs")
+	}
+	ctx := nettest.WithDialedName(context.Background(), "iperf.example.net")
+	conn, err := bind.Dialer("tcp", time.Second).DialContext(ctx, "tcp", address)
+	if err != nil {
+		t.Fatalf("expected an address dialed by an allowed name to connect, got %v", err)
+	}
+	conn.Close()
+	if n := accepted(); n != 1 {
+		t.Errorf("expected one connection, got %d", n)
+	}
+}
+
+func TestCheckedHTTPClient(t *testing.T) {
+	hits := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { hits++ }))
+	defer srv.Close()
+
+	nettest.SetTargetCheck(newTargetPolicy(t, nil, []string{"127.0.0.0/8"}).checkAddress)
+	t.Cleanup(func() { nettest.SetTargetCheck(nil) })
+	if _, err := checkedHTTPClient(time.Second).Get(srv.URL); err == nil || !strings.Contains(err.Error(), "is a blocked target") {
+		t.Errorf("expected the client to refuse a blocked address, got %v", err)
+	}
+	if hits != 0 {
+		t.Errorf("expected no request to reach a blocked address, got %d", hits)
+	}
+
+	nettest.SetTargetCheck(nil)
+	resp, err := checkedHTTPClient(time.Second).Get(srv.URL)
+	if err != nil {
+		t.Fatalf("expected the client to connect without a check, got %v", err)
+	}
+	resp.Body.Close()
+}
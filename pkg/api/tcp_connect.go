@@ -0,0 +1,222 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"network-test-api/pkg/nettest"
+)
+
+// TCP connect tests: one connect to each of a list of host:port targets, a
+// few at a time, to tell whether a service is reachable at all before heavier
+// tests run against it. A connection is closed as soon as it is up; nothing
+// is sent on it.
+const (
+	TCP_CONNECT_OPEN        = "open"
+	TCP_CONNECT_REFUSED     = "refused"     // The host answered with a reset
+	TCP_CONNECT_TIMEOUT     = "timeout"     // No answer within connect_timeout, as behind a dropping firewall
+	TCP_CONNECT_UNREACHABLE = "unreachable" // A router answered host or network unreachable
+	TCP_CONNECT_RESOLVE     = "resolve_failed"
+	TCP_CONNECT_ERROR       = "error"
+
+	MAX_TCP_CONNECT_TARGETS      = 256
+	DEFAULT_TCP_CONNECT_PARALLEL = 16
+	MAX_TCP_CONNECT_PARALLEL     = 64
+	DEFAULT_TCP_CONNECT_TIMEOUT  = 3 // Seconds per target, name resolution included
+	MIN_TCP_CONNECT_TIMEOUT      = 0.1
+	MAX_TCP_CONNECT_TIMEOUT      = 30
+)
+
+// TCPConnectResult is the connect to one target of a TCP connect test
+type TCPConnectResult struct {
+	Target    string              `json:"target"` // As requested
+	Host      string              `json:"host"`
+	Port      int                 `json:"port"`
+	Status    string              `json:"status"` // open, refused, timeout, unreachable, resolve_failed or error
+	Reachable bool                `json:"reachable"`
+	ConnectMs float64             `json:"connect_ms,omitempty"` // Of the attempt that connected
+	Dial      *nettest.DialReport `json:"dial,omitempty"`       // Every address tried, unless the name did not resolve
+	Error     string              `json:"error,omitempty"`
+}
+
+// tcpConnectStatus classifies a failed connect
+func tcpConnectStatus(err error) string {
+	var netErr net.Error
+	var dnsErr *net.DNSError
+	switch {
+	case errors.As(err, &dnsErr):
+		return TCP_CONNECT_RESOLVE
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return TCP_CONNECT_REFUSED
+	case errors.Is(err, syscall.EHOSTUNREACH), errors.Is(err, syscall.ENETUNREACH):
+		return TCP_CONNECT_UNREACHABLE
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return TCP_CONNECT_TIMEOUT
+	}
+	return TCP_CONNECT_ERROR
+}
+
+// tcpConnectHost is the host all targets share, which the result is stored
+// under, or "" when they name several
+func tcpConnectHost(targets []string) string {
+	host := ""
+	for _, t := range targets {
+		h, _, err := net.SplitHostPort(t)
+		if err != nil || (host != "" && h != host) {
+			return ""
+		}
+		host = h
+	}
+	return host
+}
+
+// parseTCPConnectTarget splits a host:port target; the port is required
+func parseTCPConnectTarget(target string) (string, int, error) {
+	host, p, err := net.SplitHostPort(target)
+	if err != nil {
+		return "", 0, fmt.Errorf("must be host:port")
+	}
+	port, err := strconv.Atoi(p)
+	if err != nil || port < 1 || port > 65535 {
+		return "", 0, fmt.Errorf("invalid port %q", p)
+	}
+	if host == "" {
+		return "", 0, fmt.Errorf("host is required")
+	}
+	return host, port, nil
+}
+
+// validateTCPConnect checks the targets and bounds of a TCP connect request
+func validateTCPConnect(req *RunRequest) error {
+	switch {
+	case len(req.Targets) == 0:
+		return fmt.Errorf("targets is required")
+	case len(req.Targets) > MAX_TCP_CONNECT_TARGETS:
+		return fmt.Errorf("targets must list at most %d host:port pairs", MAX_TCP_CONNECT_TARGETS)
+	case req.Parallel < 1 || req.Parallel > MAX_TCP_CONNECT_PARALLEL:
+		return fmt.Errorf("parallel must be between 1 and %d", MAX_TCP_CONNECT_PARALLEL)
+	case req.ConnectTimeout < MIN_TCP_CONNECT_TIMEOUT || req.ConnectTimeout > MAX_TCP_CONNECT_TIMEOUT:
+		return fmt.Errorf("connect_timeout must be between %g and %d seconds", MIN_TCP_CONNECT_TIMEOUT, MAX_TCP_CONNECT_TIMEOUT)
+	}
+	for _, t := range req.Targets {
+		if _, _, err := parseTCPConnectTarget(t); err != nil {
+			return fmt.Errorf("target %q %v", t, err)
+		}
+	}
+	return nil
+}
+
+// runTCPConnect applies defaults to a decoded request, runs the TCP connect test and records the result.
+// Errors come with the HTTP status to report them with.
+func runTCPConnect(req RunRequest, profile *Profile) (map[string]interface{}, int, error) {
+	if req.Parallel == 0 {
+		req.Parallel = DEFAULT_TCP_CONNECT_PARALLEL
+	}
+	if req.ConnectTimeout == 0 {
+		req.ConnectTimeout = DEFAULT_TCP_CONNECT_TIMEOUT
+	}
+	req.ServerHost = tcpConnectHost(req.Targets)
+	if err := checkProfileLimits(req, profile); err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	err := validateTCPConnect(&req)
+	if err == nil {
+		req.AddressFamily, err = parseAddressFamily(req.AddressFamily)
+	}
+	if err == nil && req.AddressFamily == nettest.FAMILY_COMPARE {
+		err = fmt.Errorf("address_family compare is not available for TCP connect tests; run ipv4 and ipv6 separately")
+	}
+	if err == nil {
+		err = validateCallbackURL(req.CallbackURL)
+	}
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	logf(req.ctx, "TCP connect test: %d targets (parallel=%d, timeout=%gs, family=%s)",
+		len(req.Targets), req.Parallel, req.ConnectTimeout, req.AddressFamily)
+
+	cancel := withTestTimeout(&req)
+	defer cancel()
+	ctx := req.runContext()
+	started := time.Now()
+	req.progress.start("connect_ms", len(req.Targets))
+	results := tcpConnectTest(ctx, req, started)
+	if ctx.Err() != nil {
+		return nil, http.StatusInternalServerError, canceledError(ctx)
+	}
+
+	reachable := 0
+	for _, r := range results {
+		if r.Reachable {
+			reachable++
+		}
+	}
+	data := map[string]interface{}{
+		"targets":           len(results),
+		"reachable":         reachable,
+		"unreachable":       len(results) - reachable,
+		"reachable_percent": 100 * float64(reachable) / float64(len(results)),
+		"parallel":          req.Parallel,
+		"connect_timeout":   req.ConnectTimeout,
+		"results":           results,
+		"duration_sec":      time.Since(started).Seconds(),
+	}
+	if req.ServerHost != "" {
+		data["server"] = req.ServerHost
+	}
+	if profile != nil {
+		data["profile"] = profile.Name
+	}
+
+	recordResult(TEST_TYPE_TCP_CONNECT, req, started, data)
+	notifyCallback(req.CallbackURL, data)
+
+	return data, http.StatusOK, nil
+}
+
+// tcpConnectTest connects to every target, parallel at a time, and returns
+// the results in the order of the targets
+func tcpConnectTest(ctx context.Context, req RunRequest, started time.Time) []*TCPConnectResult {
+	results := make([]*TCPConnectResult, len(req.Targets))
+	timeout := time.Duration(req.ConnectTimeout * float64(time.Second))
+	slots := make(chan struct{}, req.Parallel)
+	var wg sync.WaitGroup
+	for i, target := range req.Targets {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			wg.Wait()
+			return results
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+			host, port, _ := parseTCPConnectTarget(target)
+			r := &TCPConnectResult{Target: target, Host: host, Port: port}
+			conn, dial, err := nettest.DialControlFrom(ctx, host, port, req.AddressFamily, timeout, nil)
+			r.Dial = dial
+			if err != nil {
+				r.Status, r.Error = tcpConnectStatus(err), err.Error()
+				if dial == nil && r.Status != TCP_CONNECT_TIMEOUT {
+					r.Status = TCP_CONNECT_RESOLVE // Name resolution failed before any attempt
+				}
+			} else {
+				_ = conn.Close()
+				r.Status, r.Reachable, r.ConnectMs = TCP_CONNECT_OPEN, true, dial.ConnectMs
+				req.progress.add(SeriesPoint{T: time.Since(started).Seconds(), Value: dial.ConnectMs})
+			}
+			results[i] = r
+		}()
+	}
+	wg.Wait()
+	return results
+}
@@ -0,0 +1,67 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+)
+
+// dialError is the error a failed connect returns
+func dialError(errno syscall.Errno) error {
+	return &net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", errno)}
+}
+
+func TestTCPConnectStatus(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected string
+	}{
+		{"reset", dialError(syscall.ECONNREFUSED), TCP_CONNECT_REFUSED},
+		{"host unreachable", dialError(syscall.EHOSTUNREACH), TCP_CONNECT_UNREACHABLE},
+		{"network unreachable", dialError(syscall.ENETUNREACH), TCP_CONNECT_UNREACHABLE},
+		{"deadline", fmt.Errorf("dial: %w", context.DeadlineExceeded), TCP_CONNECT_TIMEOUT},
+		{"i/o timeout", &net.OpError{Op: "dial", Net: "tcp", Err: os.ErrDeadlineExceeded}, TCP_CONNECT_TIMEOUT},
+		{"no such host", &net.DNSError{Err: "no such host", Name: "nonexistent.invalid", IsNotFound: true}, TCP_CONNECT_RESOLVE},
+		{"resolver timeout", &net.DNSError{Err: "i/o timeout", Name: "example.net", IsTimeout: true}, TCP_CONNECT_RESOLVE},
+		{"other", dialError(syscall.EACCES), TCP_CONNECT_ERROR},
+	}
+	for _, tt := range tests {
+		if got := tcpConnectStatus(tt.err); got != tt.expected {
+			t.Errorf("%s: expected %s, got %s", tt.name, tt.expected, got)
+		}
+	}
+}
+
+func TestTCPConnectHost(t *testing.T) {
+	tests := []struct {
+		targets  []string
+		expected string
+	}{
+		{[]string{"iperf.example.net:5201", "iperf.example.net:862"}, "iperf.example.net"},
+		{[]string{"[2001:db8::1]:443"}, "2001:db8::1"},
+		{[]string{"iperf.example.net:5201", "198.51.100.7:443"}, ""},
+		{[]string{"iperf.example.net"}, ""},
+		{nil, ""},
+	}
+	for _, tt := range tests {
+		if got := tcpConnectHost(tt.targets); got != tt.expected {
+			t.Errorf("tcpConnectHost(%v): expected %q, got %q", tt.targets, tt.expected, got)
+		}
+	}
+}
+
+func TestParseTCPConnectTarget(t *testing.T) {
+	host, port, err := parseTCPConnectTarget("[2001:db8::1]:8443")
+	if err != nil || host != "2001:db8::1" || port != 8443 {
+		t.Errorf("Expected 2001:db8::1 port 8443, got %q %d (%v)", host, port, err)
+	}
+	for _, target := range []string{"example.net", "example.net:0", "example.net:65536", "example.net:http", ":80", "2001:db8::1:443"} {
+		if _, _, err := parseTCPConnectTarget(target); err == nil {
+			t.Errorf("Expected %q to be rejected", target)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package api
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"time"
+
+	"network-test-api/pkg/nettest"
+	"network-test-api/pkg/stats"
+)
+
+// Single-flow TCP throughput predicted from TWAMP RTT and loss, with the
+// Mathis and Padhye models of pkg/stats
+const (
+	// Without observed loss, p is bounded by the rule of three (95%), so the
+	// prediction is the lowest throughput the path must still support
+	ZERO_LOSS_BOUND = 3.0
+
+	// An iperf3 TCP result below this share of the prediction is flagged
+	PREDICTION_SHORTFALL_PERCENT = 50.0
+)
+
+// TCPPrediction is the single-flow TCP throughput a TWAMP full mode run predicts,
+// returned as data.tcp_prediction
+type TCPPrediction struct {
+	MSSBytes         int     `json:"mss_bytes"` // Of the TWAMP control connection, or the default for the address family
+	MSSMeasured      bool    `json:"mss_measured"`
+	RTTMs            float64 `json:"rtt_ms"`
+	RTOMs            float64 `json:"rto_ms"`
+	LossPercent      float64 `json:"loss_percent"`     // Loss the models were evaluated at
+	LossUpperBound   bool    `json:"loss_upper_bound"` // No probe was lost; the prediction is a lower bound
+	MathisMbps       float64 `json:"mathis_mbps"`      // MSS / RTT * C / sqrt(p)
+	PadhyeMbps       float64 `json:"padhye_mbps"`      // Including retransmission timeouts
+	PredictedMbps    float64 `json:"predicted_mbps"`   // The lower of both models
+	ProbesConsidered int     `json:"probes_considered"`
+}
+
+// defaultMSS is the MSS of a 1500-byte MTU path with TCP timestamps
+func defaultMSS(addr net.Addr) int {
+	return 1500 - nettest.IPHeaderSize(addr) - nettest.TCP_WIRE_HEADER - nettest.TCP_TIMESTAMPS
+}
+
+// predictTCP evaluates both models for a TWAMP run of probes probes with received replies
+func predictTCP(mss int, mssMeasured bool, rtt, stddev time.Duration, probes, received int) *TCPPrediction {
+	if probes == 0 || received == 0 || rtt <= 0 {
+		return nil
+	}
+	pred := &TCPPrediction{
+		MSSBytes:         mss,
+		MSSMeasured:      mssMeasured,
+		RTTMs:            float64(rtt.Microseconds()) / 1000,
+		ProbesConsidered: probes,
+	}
+	p := float64(probes-received) / float64(probes)
+	if p == 0 {
+		p = ZERO_LOSS_BOUND / float64(probes)
+		pred.LossUpperBound = true
+	}
+	rto := stats.TCPRTO(rtt, stddev)
+	pred.RTOMs = float64(rto.Microseconds()) / 1000
+	pred.LossPercent = p * 100
+	pred.MathisMbps = stats.MathisMbps(mss, rtt, p)
+	pred.PadhyeMbps = stats.PadhyeMbps(mss, rtt, rto, p)
+	pred.PredictedMbps = math.Min(pred.MathisMbps, pred.PadhyeMbps)
+	return pred
+}
+
+// PredictionCheck compares an iperf3 TCP result with a stored TCP prediction,
+// returned as data.prediction
+type PredictionCheck struct {
+	ResultID        string  `json:"result_id"`      // TWAMP result the prediction came from
+	PredictedMbps   float64 `json:"predicted_mbps"` // Per-flow prediction times the parallel streams
+	ActualMbps      float64 `json:"actual_mbps"`
+	AchievedPercent float64 `json:"achieved_percent"`
+	LowerBound      bool    `json:"lower_bound"`      // The prediction assumed the worst loss consistent with no loss seen
+	BelowPrediction bool    `json:"below_prediction"` // Achieved less than PREDICTION_SHORTFALL_PERCENT of the prediction
+}
+
+// storedPrediction loads the per-flow prediction of a stored TWAMP result for an iperf3 request
+func storedPrediction(req RunRequest) (float64, bool, int, error) {
+	result, ok := resultStore.Get(req.PredictionID)
+	if !ok {
+		return 0, false, http.StatusNotFound, fmt.Errorf("result %s not found", req.PredictionID)
+	}
+	predicted, ok := metricValue(result.Data, "tcp_prediction.predicted_mbps")
+	if result.Type != TEST_TYPE_TWAMP || !ok {
+		return 0, false, http.StatusBadRequest, fmt.Errorf("result %s has no tcp_prediction (TWAMP full mode results only)", req.PredictionID)
+	}
+	prediction, _ := result.Data["tcp_prediction"].(map[string]interface{})
+	lowerBound, _ := prediction["loss_upper_bound"].(bool)
+	return predicted, lowerBound, http.StatusOK, nil
+}
+
+// checkPrediction flags an actual rate far below the prediction for parallel flows
+func checkPrediction(id string, perFlowMbps float64, lowerBound bool, parallel int, actualMbps float64) *PredictionCheck {
+	c := &PredictionCheck{
+		ResultID:      id,
+		PredictedMbps: perFlowMbps * float64(parallel),
+		ActualMbps:    actualMbps,
+		LowerBound:    lowerBound,
+	}
+	if c.PredictedMbps > 0 {
+		c.AchievedPercent = actualMbps / c.PredictedMbps * 100
+		c.BelowPrediction = c.AchievedPercent < PREDICTION_SHORTFALL_PERCENT
+	}
+	return c
+}
@@ -0,0 +1,78 @@
+package api
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"network-test-api/pkg/stats"
+)
+
+func TestMathisMbps(t *testing.T) {
+	// 1448-byte MSS, 50 ms RTT, 0.01% loss: the classic ~28 Mbit/s
+	got := stats.MathisMbps(1448, 50*time.Millisecond, 0.0001)
+	if math.Abs(got-28.26) > 0.01 {
+		t.Errorf("Expected 28.26 Mbit/s, got %f", got)
+	}
+	// Four times the loss halves the throughput
+	if quarter := stats.MathisMbps(1448, 50*time.Millisecond, 0.0004); math.Abs(quarter-got/2) > 1e-9 {
+		t.Errorf("Expected %f Mbit/s at 4x loss, got %f", got/2, quarter)
+	}
+	if got := stats.MathisMbps(1448, 50*time.Millisecond, 0); got != 0 {
+		t.Errorf("Expected 0 without loss, got %f", got)
+	}
+}
+
+func TestPadhyeBelowMathis(t *testing.T) {
+	rtt, rto := 50*time.Millisecond, 250*time.Millisecond
+	for _, p := range []float64{0.0001, 0.001, 0.01, 0.1} {
+		mathis, padhye := stats.MathisMbps(1448, rtt, p), stats.PadhyeMbps(1448, rtt, rto, p)
+		if padhye <= 0 || padhye >= mathis {
+			t.Errorf("p=%g: expected Padhye below Mathis (%f), got %f", p, mathis, padhye)
+		}
+	}
+	// Timeouts widen the gap at high loss
+	low := stats.PadhyeMbps(1448, rtt, rto, 0.0001) / stats.MathisMbps(1448, rtt, 0.0001)
+	high := stats.PadhyeMbps(1448, rtt, rto, 0.1) / stats.MathisMbps(1448, rtt, 0.1)
+	if high >= low/2 {
+		t.Errorf("Expected timeouts to cut throughput at 10%% loss, got %.2f of Mathis (%.2f at 0.01%%)", high, low)
+	}
+}
+
+func TestLossProbability(t *testing.T) {
+	rtt := 50 * time.Millisecond
+	if pred := predictTCP(1448, false, rtt, 0, 1000, 990); math.Abs(pred.LossPercent-1) > 1e-9 || pred.LossUpperBound {
+		t.Errorf("Expected measured loss of 1%%, got %g (bound=%v)", pred.LossPercent, pred.LossUpperBound)
+	}
+	pred := predictTCP(1448, false, rtt, 0, 1000, 1000)
+	if math.Abs(pred.LossPercent-0.3) > 1e-9 || !pred.LossUpperBound {
+		t.Errorf("Expected rule of three bound of 0.3%%, got %g (bound=%v)", pred.LossPercent, pred.LossUpperBound)
+	}
+	if pred.PredictedMbps != math.Min(pred.MathisMbps, pred.PadhyeMbps) {
+		t.Errorf("Expected the lower of Mathis and Padhye, got %+v", pred)
+	}
+	if predictTCP(1448, false, rtt, 0, 1000, 0) != nil {
+		t.Error("Expected no prediction without replies")
+	}
+}
+
+func TestBelowPrediction(t *testing.T) {
+	tests := []struct {
+		perFlow  float64
+		parallel int
+		actual   float64
+		want     bool
+	}{
+		{100, 1, 80, false},
+		{100, 1, 40, true},
+		{100, 4, 150, true}, // Four flows should reach 400
+		{100, 4, 250, false},
+		{0, 1, 10, false}, // No prediction
+	}
+
+	for _, tt := range tests {
+		if got := checkPrediction("r1", tt.perFlow, false, tt.parallel, tt.actual).BelowPrediction; got != tt.want {
+			t.Errorf("%.0f Mbit/s x %d, actual %.0f: expected %v, got %v", tt.perFlow, tt.parallel, tt.actual, tt.want, got)
+		}
+	}
+}
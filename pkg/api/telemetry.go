@@ -0,0 +1,737 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// OpenTelemetry: with OTEL_EXPORTER_OTLP_ENDPOINT set, every HTTP request,
+// every test and each phase of a test (connect, parameter exchange, stream
+// creation, run, results exchange) is a span, and their durations histograms,
+// exported over OTLP/HTTP in its JSON encoding. Incoming W3C traceparent
+// headers are continued, so a test started by a traced caller shows up in its
+// trace. The exporter is built in; only the standard OTEL_* variables the
+// OpenTelemetry SDKs read are needed.
+const (
+	DEFAULT_OTEL_SERVICE_NAME    = "network-test-api"
+	DEFAULT_OTEL_METRIC_INTERVAL = 60 * time.Second
+	OTEL_TRACE_FLUSH_INTERVAL    = 5 * time.Second
+	OTEL_EXPORT_TIMEOUT          = 10 * time.Second
+	OTEL_BATCH_SPANS             = 512  // Spans queued before an export is started early
+	MAX_OTEL_QUEUED_SPANS        = 2048 // Spans beyond this are dropped until the next export
+)
+
+// Span kinds and status codes of OTLP
+const (
+	OTEL_SPAN_KIND_INTERNAL = 1
+	OTEL_SPAN_KIND_SERVER   = 2
+	OTEL_STATUS_ERROR       = 2
+)
+
+// Histograms exported, in seconds
+const (
+	OTEL_METRIC_HTTP_DURATION  = "http.server.request.duration"
+	OTEL_METRIC_TEST_DURATION  = "network_test.test.duration"
+	OTEL_METRIC_PHASE_DURATION = "network_test.phase.duration"
+)
+
+var otelMetricDescriptions = map[string]string{
+	OTEL_METRIC_HTTP_DURATION:  "Duration of HTTP server requests",
+	OTEL_METRIC_TEST_DURATION:  "Duration of tests by type and outcome",
+	OTEL_METRIC_PHASE_DURATION: "Duration of test phases by type and phase",
+}
+
+// otelBounds are the histogram bucket bounds, from HTTP requests to long tests
+var otelBounds = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300, 600}
+
+// TelemetryConfig is the OTLP collector spans and metrics are exported to,
+// from OTEL_* environment variables
+type TelemetryConfig struct {
+	TracesURL      string // Nothing is traced without it
+	MetricsURL     string // No metrics are exported without it
+	Headers        map[string]string
+	Resource       []otlpKeyValue
+	MetricInterval time.Duration
+}
+
+// loadTelemetryConfig reads OTEL_SDK_DISABLED, OTEL_EXPORTER_OTLP_ENDPOINT,
+// OTEL_EXPORTER_OTLP_TRACES_ENDPOINT, OTEL_EXPORTER_OTLP_METRICS_ENDPOINT,
+// OTEL_EXPORTER_OTLP_PROTOCOL, OTEL_EXPORTER_OTLP_HEADERS, OTEL_SERVICE_NAME,
+// OTEL_RESOURCE_ATTRIBUTES and OTEL_METRIC_EXPORT_INTERVAL
+func loadTelemetryConfig(getenv func(string) string) (TelemetryConfig, error) {
+	cfg := TelemetryConfig{MetricInterval: DEFAULT_OTEL_METRIC_INTERVAL}
+	if strings.EqualFold(getenv("OTEL_SDK_DISABLED"), "true") {
+		return cfg, nil
+	}
+	base := strings.TrimRight(getenv("OTEL_EXPORTER_OTLP_ENDPOINT"), "/")
+	cfg.TracesURL, cfg.MetricsURL = getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"), getenv("OTEL_EXPORTER_OTLP_METRICS_ENDPOINT")
+	if base != "" && cfg.TracesURL == "" {
+		cfg.TracesURL = base + "/v1/traces"
+	}
+	if base != "" && cfg.MetricsURL == "" {
+		cfg.MetricsURL = base + "/v1/metrics"
+	}
+	if cfg.TracesURL == "" && cfg.MetricsURL == "" {
+		return cfg, nil
+	}
+	for _, s := range []string{cfg.TracesURL, cfg.MetricsURL} {
+		if u, err := url.Parse(s); s != "" && (err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "") {
+			return cfg, fmt.Errorf("invalid OTLP endpoint %q (expected an http or https URL, e.g. http://otel-collector:4318)", s)
+		}
+	}
+	if p := getenv("OTEL_EXPORTER_OTLP_PROTOCOL"); p != "" && p != "http/json" {
+		return cfg, fmt.Errorf("OTEL_EXPORTER_OTLP_PROTOCOL %q is not supported (only http/json)", p)
+	}
+
+	var err error
+	if cfg.Headers, err = parseOtelList(getenv("OTEL_EXPORTER_OTLP_HEADERS")); err != nil {
+		return cfg, fmt.Errorf("invalid OTEL_EXPORTER_OTLP_HEADERS: %w", err)
+	}
+	resource, err := parseOtelList(getenv("OTEL_RESOURCE_ATTRIBUTES"))
+	if err != nil {
+		return cfg, fmt.Errorf("invalid OTEL_RESOURCE_ATTRIBUTES: %w", err)
+	}
+	if name := getenv("OTEL_SERVICE_NAME"); name != "" {
+		resource["service.name"] = name
+	}
+	defaults := map[string]string{"service.name": DEFAULT_OTEL_SERVICE_NAME, "service.version": API_VERSION, "service.instance.id": agentID}
+	for k, v := range defaults {
+		if _, ok := resource[k]; !ok {
+			resource[k] = v
+		}
+	}
+	keys := make([]string, 0, len(resource))
+	for k := range resource {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		cfg.Resource = append(cfg.Resource, otelString(k, resource[k]))
+	}
+
+	if v := getenv("OTEL_METRIC_EXPORT_INTERVAL"); v != "" {
+		ms, err := strconv.Atoi(v)
+		if err != nil || ms <= 0 {
+			return cfg, fmt.Errorf("invalid OTEL_METRIC_EXPORT_INTERVAL %q (expected milliseconds)", v)
+		}
+		cfg.MetricInterval = time.Duration(ms) * time.Millisecond
+	}
+	return cfg, nil
+}
+
+// parseOtelList parses the key=value,key=value lists of OTEL_* variables,
+// whose keys and values are percent-encoded
+func parseOtelList(s string) (map[string]string, error) {
+	list := make(map[string]string)
+	for _, item := range strings.Split(s, ",") {
+		if strings.TrimSpace(item) == "" {
+			continue
+		}
+		k, v, ok := strings.Cut(item, "=")
+		key, kerr := url.PathUnescape(strings.TrimSpace(k))
+		value, verr := url.PathUnescape(strings.TrimSpace(v))
+		if !ok || key == "" || kerr != nil || verr != nil {
+			return nil, fmt.Errorf("%q is not a key=value pair", item)
+		}
+		list[key] = value
+	}
+	return list, nil
+}
+
+// configureTelemetry applies OTEL_* settings at startup and starts the exporter
+func configureTelemetry() {
+	cfg, err := loadTelemetryConfig(os.Getenv)
+	if err != nil {
+		log.Fatalf("OpenTelemetry configuration failed: %v", err)
+	}
+	if cfg.TracesURL == "" && cfg.MetricsURL == "" {
+		return
+	}
+	telemetry = newTelemetry(cfg)
+	go telemetry.loop()
+	log.Printf("OpenTelemetry: exporting traces to %q and metrics to %q", cfg.TracesURL, cfg.MetricsURL)
+}
+
+// OTLP JSON encoding: IDs are hex, 64-bit integers strings
+type otlpAnyValue struct {
+	StringValue *string `json:"stringValue,omitempty"`
+	IntValue    *string `json:"intValue,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+func otelString(key, value string) otlpKeyValue {
+	return otlpKeyValue{Key: key, Value: otlpAnyValue{StringValue: &value}}
+}
+
+func otelInt(key string, value int64) otlpKeyValue {
+	s := strconv.FormatInt(value, 10)
+	return otlpKeyValue{Key: key, Value: otlpAnyValue{IntValue: &s}}
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              int            `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Status            otlpStatus     `json:"status"`
+}
+
+type otlpHistogramPoint struct {
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	TimeUnixNano      string         `json:"timeUnixNano"`
+	Count             string         `json:"count"`
+	Sum               float64        `json:"sum"`
+	BucketCounts      []string       `json:"bucketCounts"`
+	ExplicitBounds    []float64      `json:"explicitBounds"`
+	Min               float64        `json:"min"`
+	Max               float64        `json:"max"`
+}
+
+// otelSeries is one histogram by name and attributes, cumulative since startup
+type otelSeries struct {
+	name   string
+	attrs  []otlpKeyValue
+	counts []uint64
+	count  uint64
+	sum    float64
+	min    float64
+	max    float64
+}
+
+// Telemetry queues finished spans and aggregates the histograms until they are exported
+type Telemetry struct {
+	cfg    TelemetryConfig
+	client *http.Client
+	start  time.Time
+
+	mu      sync.Mutex
+	spans   []otlpSpan
+	dropped int
+	series  map[string]*otelSeries
+	keys    []string // Of series, in the order they were first observed
+
+	flush chan struct{}
+	stop  chan struct{}
+	done  chan struct{}
+}
+
+// telemetry is nil when OpenTelemetry is not configured, which makes every span a no-op
+var telemetry *Telemetry
+
+func newTelemetry(cfg TelemetryConfig) *Telemetry {
+	return &Telemetry{
+		cfg:    cfg,
+		client: checkedHTTPClient(OTEL_EXPORT_TIMEOUT),
+		start:  time.Now(),
+		series: make(map[string]*otelSeries),
+		flush:  make(chan struct{}, 1),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+}
+
+// record adds a duration to the histogram of name with attrs
+func (t *Telemetry) record(name string, d time.Duration, attrs ...otlpKeyValue) {
+	if t == nil || t.cfg.MetricsURL == "" {
+		return
+	}
+	var key strings.Builder
+	key.WriteString(name)
+	for _, a := range attrs {
+		b, _ := json.Marshal(a.Value)
+		fmt.Fprintf(&key, "\x00%s=%s", a.Key, b)
+	}
+	v := d.Seconds()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s, ok := t.series[key.String()]
+	if !ok {
+		s = &otelSeries{name: name, attrs: attrs, counts: make([]uint64, len(otelBounds)+1), min: v, max: v}
+		t.series[key.String()] = s
+		t.keys = append(t.keys, key.String())
+	}
+	s.counts[sort.SearchFloat64s(otelBounds, v)]++
+	s.count++
+	s.sum += v
+	s.min = math.Min(s.min, v)
+	s.max = math.Max(s.max, v)
+}
+
+// queue adds a finished span to the next export
+func (t *Telemetry) queue(span otlpSpan) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.spans) >= MAX_OTEL_QUEUED_SPANS {
+		t.dropped++
+		return
+	}
+	t.spans = append(t.spans, span)
+	if len(t.spans) >= OTEL_BATCH_SPANS {
+		select {
+		case t.flush <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (t *Telemetry) loop() {
+	traces := time.NewTicker(OTEL_TRACE_FLUSH_INTERVAL)
+	defer traces.Stop()
+	metrics := time.NewTicker(t.cfg.MetricInterval)
+	defer metrics.Stop()
+	for {
+		select {
+		case <-traces.C:
+			t.exportSpans()
+		case <-t.flush:
+			t.exportSpans()
+		case <-metrics.C:
+			t.exportMetrics()
+		case <-t.stop:
+			t.exportSpans()
+			t.exportMetrics()
+			close(t.done)
+			return
+		}
+	}
+}
+
+// Shutdown exports what is left, waiting until ctx ends at most
+func (t *Telemetry) Shutdown(ctx context.Context) {
+	if t == nil {
+		return
+	}
+	close(t.stop)
+	select {
+	case <-t.done:
+	case <-ctx.Done():
+		warnf(ctx, "OpenTelemetry: export at shutdown did not finish: %v", ctx.Err())
+	}
+}
+
+func (t *Telemetry) resource() map[string]interface{} {
+	return map[string]interface{}{"attributes": t.cfg.Resource}
+}
+
+func (t *Telemetry) scope() map[string]interface{} {
+	return map[string]interface{}{"name": DEFAULT_OTEL_SERVICE_NAME, "version": API_VERSION}
+}
+
+func (t *Telemetry) exportSpans() {
+	t.mu.Lock()
+	spans, dropped := t.spans, t.dropped
+	t.spans, t.dropped = nil, 0
+	t.mu.Unlock()
+	if dropped > 0 {
+		warnf(nil, "OpenTelemetry: %d spans dropped, more than %d were queued", dropped, MAX_OTEL_QUEUED_SPANS)
+	}
+	if len(spans) == 0 || t.cfg.TracesURL == "" {
+		return
+	}
+	t.post(t.cfg.TracesURL, map[string]interface{}{
+		"resourceSpans": []map[string]interface{}{{
+			"resource":   t.resource(),
+			"scopeSpans": []map[string]interface{}{{"scope": t.scope(), "spans": spans}},
+		}},
+	})
+}
+
+func (t *Telemetry) exportMetrics() {
+	if t.cfg.MetricsURL == "" {
+		return
+	}
+	now := strconv.FormatInt(time.Now().UnixNano(), 10)
+	start := strconv.FormatInt(t.start.UnixNano(), 10)
+	points := make(map[string][]otlpHistogramPoint)
+	var names []string
+	t.mu.Lock()
+	for _, key := range t.keys {
+		s := t.series[key]
+		counts := make([]string, len(s.counts))
+		for i, n := range s.counts {
+			counts[i] = strconv.FormatUint(n, 10)
+		}
+		if _, ok := points[s.name]; !ok {
+			names = append(names, s.name)
+		}
+		points[s.name] = append(points[s.name], otlpHistogramPoint{
+			Attributes:        s.attrs,
+			StartTimeUnixNano: start,
+			TimeUnixNano:      now,
+			Count:             strconv.FormatUint(s.count, 10),
+			Sum:               s.sum,
+			BucketCounts:      counts,
+			ExplicitBounds:    otelBounds,
+			Min:               s.min,
+			Max:               s.max,
+		})
+	}
+	t.mu.Unlock()
+	if len(names) == 0 {
+		return
+	}
+
+	metrics := make([]map[string]interface{}, 0, len(names))
+	for _, name := range names {
+		metrics = append(metrics, map[string]interface{}{
+			"name":        name,
+			"description": otelMetricDescriptions[name],
+			"unit":        "s",
+			"histogram": map[string]interface{}{
+				"aggregationTemporality": 2, // Cumulative
+				"dataPoints":             points[name],
+			},
+		})
+	}
+	t.post(t.cfg.MetricsURL, map[string]interface{}{
+		"resourceMetrics": []map[string]interface{}{{
+			"resource":     t.resource(),
+			"scopeMetrics": []map[string]interface{}{{"scope": t.scope(), "metrics": metrics}},
+		}},
+	})
+}
+
+func (t *Telemetry) post(target string, payload interface{}) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		errorf(nil, "OpenTelemetry: encode export: %v", err)
+		return
+	}
+	req, err := http.NewRequest(http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		warnf(nil, "OpenTelemetry: export to %s failed: %v", target, err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "network-test-api/"+API_VERSION)
+	for k, v := range t.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := t.client.Do(req)
+	if err != nil {
+		warnf(nil, "OpenTelemetry: export to %s failed: %v", target, err)
+		return
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		warnf(nil, "OpenTelemetry: export to %s failed: collector returned %s", target, resp.Status)
+	}
+}
+
+// Span is one traced operation; a nil Span, as untraced requests have, ignores every call
+type Span struct {
+	traceID  [16]byte
+	spanID   [8]byte
+	parentID [8]byte // Zero for a root span
+	name     string
+	kind     int
+	start    time.Time
+
+	mu    sync.Mutex
+	attrs []otlpKeyValue
+	ended bool
+}
+
+type spanKey struct{}
+
+// spanFromContext is the span a context was started under, nil without one
+func spanFromContext(ctx context.Context) *Span {
+	if ctx == nil {
+		return nil
+	}
+	s, _ := ctx.Value(spanKey{}).(*Span)
+	return s
+}
+
+// startSpan starts a span as a child of the span of ctx, or of a new trace
+func startSpan(ctx context.Context, name string, attrs ...otlpKeyValue) (context.Context, *Span) {
+	if telemetry == nil {
+		return ctx, nil
+	}
+	s := &Span{name: name, kind: OTEL_SPAN_KIND_INTERNAL, start: time.Now(), attrs: attrs}
+	if parent := spanFromContext(ctx); parent != nil {
+		s.traceID, s.parentID = parent.traceID, parent.spanID
+	} else {
+		_, _ = rand.Read(s.traceID[:])
+	}
+	_, _ = rand.Read(s.spanID[:])
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+// SetAttributes adds attributes to a span that has not ended
+func (s *Span) SetAttributes(attrs ...otlpKeyValue) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attrs = append(s.attrs, attrs...)
+}
+
+// End finishes a span, failed when err is not nil, and returns its duration;
+// only the first call counts
+func (s *Span) End(err error) time.Duration {
+	if s == nil {
+		return 0
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ended {
+		return 0
+	}
+	s.ended = true
+	end := time.Now()
+	span := otlpSpan{
+		TraceID:           hex.EncodeToString(s.traceID[:]),
+		SpanID:            hex.EncodeToString(s.spanID[:]),
+		Name:              s.name,
+		Kind:              s.kind,
+		StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(end.UnixNano(), 10),
+		Attributes:        s.attrs,
+	}
+	if s.parentID != [8]byte{} {
+		span.ParentSpanID = hex.EncodeToString(s.parentID[:])
+	}
+	if err != nil {
+		span.Status = otlpStatus{Code: OTEL_STATUS_ERROR, Message: err.Error()}
+	}
+	if telemetry.cfg.TracesURL != "" {
+		telemetry.queue(span)
+	}
+	return end.Sub(s.start)
+}
+
+// parseTraceparent reads a W3C traceparent header: version 00, a trace ID, a
+// parent span ID and the sampled flag
+func parseTraceparent(h string) (traceID [16]byte, spanID [8]byte, sampled bool, ok bool) {
+	parts := strings.Split(strings.TrimSpace(h), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return traceID, spanID, false, false
+	}
+	if parts[0] == "00" && len(parts) != 4 {
+		return traceID, spanID, false, false
+	}
+	flags, err := hex.DecodeString(parts[3])
+	if err == nil {
+		_, err = hex.Decode(traceID[:], []byte(parts[1]))
+	}
+	if err == nil {
+		_, err = hex.Decode(spanID[:], []byte(parts[2]))
+	}
+	if err != nil || traceID == [16]byte{} || spanID == [8]byte{} {
+		return traceID, spanID, false, false
+	}
+	return traceID, spanID, flags[0]&1 == 1, true
+}
+
+// statusRecorder keeps the status of a response, passing flushes and
+// hijacks through for the job streams and WebSockets
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusRecorder) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusRecorder) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *statusRecorder) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("response does not support hijacking")
+	}
+	w.status = http.StatusSwitchingProtocols
+	return h.Hijack()
+}
+
+func (w *statusRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// traceRequests makes every request a server span named by its route,
+// continuing the trace of its traceparent header; sampled-out traces are not
+// recorded
+func traceRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if telemetry == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		route := r.URL.Path
+		if cr := mux.CurrentRoute(r); cr != nil {
+			if tpl, err := cr.GetPathTemplate(); err == nil {
+				route = tpl
+			}
+		}
+		traceID, parentID, sampled, remote := parseTraceparent(r.Header.Get("traceparent"))
+		if remote && !sampled {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ctx, span := startSpan(r.Context(), r.Method+" "+route,
+			otelString("http.request.method", r.Method),
+			otelString("http.route", route),
+			otelString("url.path", r.URL.Path),
+		)
+		span.kind = OTEL_SPAN_KIND_SERVER
+		if remote {
+			span.traceID, span.parentID = traceID, parentID
+		}
+
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r.WithContext(ctx))
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		var err error
+		if rec.status >= 500 {
+			err = fmt.Errorf("%d %s", rec.status, http.StatusText(rec.status))
+		}
+		span.SetAttributes(otelInt("http.response.status_code", int64(rec.status)))
+		telemetry.record(OTEL_METRIC_HTTP_DURATION, span.End(err),
+			otelString("http.request.method", r.Method),
+			otelString("http.route", route),
+			otelInt("http.response.status_code", int64(rec.status)),
+		)
+	})
+}
+
+// testPhases times the consecutive phases of a test, each a child span of the test's
+type testPhases struct {
+	mu       sync.Mutex
+	ctx      context.Context
+	testType string
+	current  *Span
+	name     string
+}
+
+type phasesKey struct{}
+
+// next ends the running phase, failed when err is not nil, and starts phase,
+// or none when it is empty
+func (p *testPhases) next(phase string, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.current != nil {
+		telemetry.record(OTEL_METRIC_PHASE_DURATION, p.current.End(err),
+			otelString("test.type", p.testType),
+			otelString("test.phase", p.name),
+		)
+		p.current = nil
+	}
+	if phase != "" {
+		_, p.current = startSpan(p.ctx, p.testType+" "+phase, otelString("test.phase", phase))
+		p.name = phase
+	}
+}
+
+// testPhase moves the test of ctx on to its next phase; it does nothing for
+// untraced tests
+func testPhase(ctx context.Context, phase string) {
+	if p, ok := ctx.Value(phasesKey{}).(*testPhases); ok {
+		p.next(phase, nil)
+	}
+}
+
+// startTest starts the span of a test run; the returned func ends it and its
+// last phase with the outcome of the run
+func startTest(ctx context.Context, testType string, req RunRequest) (context.Context, func(data map[string]interface{}, status int, err error)) {
+	attrs := []otlpKeyValue{otelString("test.type", testType)}
+	if host := requestHost(req); host != "" {
+		attrs = append(attrs, otelString("server.address", host))
+	}
+	if req.ServerPort > 0 {
+		attrs = append(attrs, otelInt("server.port", int64(req.ServerPort)))
+	}
+	if req.jobID != "" {
+		attrs = append(attrs, otelString("test.job_id", req.jobID))
+	}
+	if id := logIDsFrom(ctx).testID; id != "" {
+		attrs = append(attrs, otelString("test.id", id))
+	}
+	ctx, span := startSpan(ctx, "test "+testType, attrs...)
+	if span == nil {
+		return ctx, func(map[string]interface{}, int, error) {}
+	}
+	phases := &testPhases{ctx: ctx, testType: testType}
+	ctx = context.WithValue(ctx, phasesKey{}, phases)
+
+	return ctx, func(data map[string]interface{}, status int, err error) {
+		phases.next("", err)
+		outcome := "ok"
+		if err != nil {
+			outcome = "error"
+			code := errorCode(err)
+			if code == "" {
+				code = strconv.Itoa(status)
+			}
+			span.SetAttributes(otelString("error.type", code))
+		}
+		if id, ok := data["id"].(string); ok {
+			span.SetAttributes(otelString("test.result_id", id))
+		}
+		telemetry.record(OTEL_METRIC_TEST_DURATION, span.End(err),
+			otelString("test.type", testType),
+			otelString("test.outcome", outcome),
+		)
+	}
+}
+
+// linkTrace gives ctx the span of from, so a job started by a traced request
+// continues its trace
+func linkTrace(ctx, from context.Context) context.Context {
+	if span := spanFromContext(from); span != nil {
+		return context.WithValue(ctx, spanKey{}, span)
+	}
+	return ctx
+}
@@ -0,0 +1,58 @@
+package api
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	traceID, spanID, sampled, ok := parseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	if !ok || !sampled {
+		t.Fatalf("Expected a sampled traceparent, got ok=%v sampled=%v", ok, sampled)
+	}
+	if hex.EncodeToString(traceID[:]) != "4bf92f3577b34da6a3ce929d0e0e4736" || hex.EncodeToString(spanID[:]) != "00f067aa0ba902b7" {
+		t.Errorf("Expected the IDs of the header, got %x and %x", traceID, spanID)
+	}
+
+	if _, _, sampled, ok := parseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00"); !ok || sampled {
+		t.Errorf("Expected a traceparent that is not sampled, got ok=%v sampled=%v", ok, sampled)
+	}
+	// Later versions may add fields
+	if _, _, _, ok := parseTraceparent("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra"); !ok {
+		t.Errorf("Expected a later version with more fields to parse")
+	}
+}
+
+func TestParseTraceparent_Invalid(t *testing.T) {
+	for _, bad := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e473g-00f067aa0ba902b7-01",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+	} {
+		if _, _, _, ok := parseTraceparent(bad); ok {
+			t.Errorf("Expected traceparent %q to be rejected", bad)
+		}
+	}
+}
+
+func TestParseOtelList(t *testing.T) {
+	got, err := parseOtelList("Authorization=Bearer%20abc, x-tenant = lab ,")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got["Authorization"] != "Bearer abc" || got["x-tenant"] != "lab" || len(got) != 2 {
+		t.Errorf("Expected the decoded pairs, got %v", got)
+	}
+	if got, err := parseOtelList(""); err != nil || len(got) != 0 {
+		t.Errorf("Expected an empty list, got %v (%v)", got, err)
+	}
+	for _, bad := range []string{"novalue", "=value", "key=%zz"} {
+		if _, err := parseOtelList(bad); err == nil {
+			t.Errorf("Expected error for %q", bad)
+		}
+	}
+}
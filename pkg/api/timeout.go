@@ -0,0 +1,68 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+// Hard deadline of iperf3 and TWAMP tests, over every phase from the connect
+// to the results exchange, so a server that stops answering cannot hold a
+// handler. timeout_sec sets it per request, up to TEST_TIMEOUT_MAX.
+const (
+	DEFAULT_TEST_TIMEOUT_MAX = time.Hour
+
+	ERR_TIMEOUT = "ERR_TIMEOUT"
+)
+
+var testTimeoutMax = DEFAULT_TEST_TIMEOUT_MAX
+
+// testTimeoutError is the cause of a test context that timed out
+type testTimeoutError struct {
+	timeout time.Duration
+}
+
+func (e *testTimeoutError) Error() string {
+	return fmt.Sprintf("test timed out after %s", e.timeout)
+}
+
+// configureTestTimeout reads TEST_TIMEOUT_MAX, if set
+func configureTestTimeout() {
+	v := os.Getenv("TEST_TIMEOUT_MAX")
+	if v == "" {
+		return
+	}
+	parsed, err := time.ParseDuration(v)
+	if err != nil || parsed < time.Second {
+		log.Fatalf("Invalid TEST_TIMEOUT_MAX %q (expected a duration of at least 1s, such as 90s or 2h)", v)
+	}
+	testTimeoutMax = parsed
+	log.Printf("Tests time out after at most %s", testTimeoutMax)
+}
+
+// timeoutSec checks a timeout_sec against the server's maximum
+func (v *requestValidator) timeoutSec(timeoutSec int) {
+	v.between("timeout_sec", int64(timeoutSec), 1, int64(testTimeoutMax/time.Second), " seconds (TEST_TIMEOUT_MAX)")
+}
+
+// testTimeout checks a timeout_sec against expected, the seconds the test is
+// set to run once defaults apply, if known
+func (v *requestValidator) testTimeout(timeoutSec, expected int) {
+	if timeoutSec > 0 && timeoutSec <= expected {
+		v.fail("timeout_sec", timeoutSec, "must exceed the %d seconds the test runs", expected)
+	}
+}
+
+// withTestTimeout bounds the request's test by timeout_sec, or by the
+// server's maximum without one; the returned func releases the timer
+func withTestTimeout(req *RunRequest) context.CancelFunc {
+	timeout := testTimeoutMax
+	if req.TimeoutSec > 0 {
+		timeout = time.Duration(req.TimeoutSec) * time.Second
+	}
+	ctx, cancel := context.WithTimeoutCause(req.runContext(), timeout, &testTimeoutError{timeout})
+	req.ctx = ctx
+	return cancel
+}
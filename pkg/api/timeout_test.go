@@ -0,0 +1,35 @@
+package api
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTestTimeout(t *testing.T) {
+	tests := []struct {
+		timeoutSec, expected int
+		max                  time.Duration
+		wantErr              bool
+	}{
+		{0, 10, time.Hour, false}, // Not set: TEST_TIMEOUT_MAX applies
+		{30, 10, time.Hour, false},
+		{3600, 10, time.Hour, false},
+		{3601, 10, time.Hour, true},
+		{-5, 0, time.Hour, true},
+		{10, 10, time.Hour, true}, // No time left for the connect and results exchange
+		{5, 10, time.Hour, true},
+		{1, 0, time.Hour, false}, // num_bytes, block_count or a TWAMP mode without a set length
+		{150, 10, 2 * time.Minute, true},
+		{90, 60, 90 * time.Second, false},
+	}
+	defer func(max time.Duration) { testTimeoutMax = max }(testTimeoutMax)
+	for _, tt := range tests {
+		testTimeoutMax = tt.max
+		v := &requestValidator{}
+		v.timeoutSec(tt.timeoutSec)
+		v.testTimeout(tt.timeoutSec, tt.expected)
+		if (len(v.fields) > 0) != tt.wantErr {
+			t.Errorf("timeout_sec %d, expected %d, max %s: expected error %v, got %+v", tt.timeoutSec, tt.expected, tt.max, tt.wantErr, v.fields)
+		}
+	}
+}
@@ -0,0 +1,295 @@
+package api
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+	"time"
+
+	"network-test-api/pkg/nettest"
+)
+
+// TLS handshake tests: a handshake with any TLS server, timed apart from the
+// name lookup and the TCP connect, with the negotiated version, cipher suite
+// and ALPN protocol and the certificate chain. tls_versions repeats it pinned
+// to each of several versions; how a refused version fails tells a server's
+// alert from a middlebox that resets or drops the ClientHello.
+const (
+	DEFAULT_TLS_PORT      = 443
+	TLS_DIAL_TIMEOUT      = 10 * time.Second
+	TLS_HANDSHAKE_TIMEOUT = 10 * time.Second
+	MAX_TLS_ALPN          = 8 // Protocols offered with ALPN
+
+	TLS_FAILURE_ALERT   = "alert"   // The server answered with a TLS alert, e.g. protocol_version
+	TLS_FAILURE_VERSION = "version" // The server chose a version other than the one offered
+	TLS_FAILURE_RESET   = "reset"   // The connection was reset during the handshake
+	TLS_FAILURE_CLOSED  = "closed"  // The connection was closed without an alert
+	TLS_FAILURE_TIMEOUT = "timeout" // No answer within TLS_HANDSHAKE_TIMEOUT
+	TLS_FAILURE_ERROR   = "error"   // Any other failure, e.g. no cipher suite in common
+
+	tlsAlertProtocolVersion = 70 // RFC 8446 section 6.2
+)
+
+// defaultALPN is offered without alpn, as a browser would
+var defaultALPN = []string{"h2", "http/1.1"}
+
+// tlsVersions are the tls_versions names, oldest first
+var tlsVersions = []struct {
+	name    string
+	version uint16
+}{
+	{"1.0", tls.VersionTLS10},
+	{"1.1", tls.VersionTLS11},
+	{"1.2", tls.VersionTLS12},
+	{"1.3", tls.VersionTLS13},
+}
+
+// TLSTimings splits the time to an established TLS connection
+type TLSTimings struct {
+	DNSMs       float64 `json:"dns_ms"`
+	ConnectMs   float64 `json:"connect_ms"`   // TCP handshake of the connection that won
+	HandshakeMs float64 `json:"handshake_ms"` // ClientHello to the server's Finished
+	TotalMs     float64 `json:"total_ms"`
+}
+
+// TLSVersionProbe is the outcome of a handshake pinned to one TLS version
+type TLSVersionProbe struct {
+	Version     string  `json:"version"`   // As tls_versions names it, e.g. 1.2
+	Supported   bool    `json:"supported"` // The handshake completed at this version
+	CipherSuite string  `json:"cipher_suite,omitempty"`
+	ALPN        string  `json:"alpn,omitempty"`
+	ConnectMs   float64 `json:"connect_ms"`
+	HandshakeMs float64 `json:"handshake_ms,omitempty"`
+	Failure     string  `json:"failure,omitempty"` // alert, version, reset, closed, timeout or error
+	Error       string  `json:"error,omitempty"`
+}
+
+// parseTLSVersions maps tls_versions names to protocol versions, in the order given
+func parseTLSVersions(names []string) ([]uint16, error) {
+	versions := make([]uint16, 0, len(names))
+	seen := make(map[uint16]bool, len(names))
+	for _, name := range names {
+		version, ok := uint16(0), false
+		for _, v := range tlsVersions {
+			if strings.EqualFold(strings.TrimSpace(name), v.name) {
+				version, ok = v.version, true
+			}
+		}
+		switch {
+		case !ok:
+			return nil, fmt.Errorf("invalid tls_versions entry %q (expected 1.0, 1.1, 1.2 or 1.3)", name)
+		case seen[version]:
+			return nil, fmt.Errorf("tls_versions lists %s twice", name)
+		}
+		seen[version] = true
+		versions = append(versions, version)
+	}
+	return versions, nil
+}
+
+// tlsVersionName is the tls_versions name of a protocol version
+func tlsVersionName(version uint16) string {
+	for _, v := range tlsVersions {
+		if v.version == version {
+			return v.name
+		}
+	}
+	return fmt.Sprintf("0x%04x", version)
+}
+
+// validateTLS checks the server name, the ALPN protocols and the versions of a TLS request
+func validateTLS(req *RunRequest) error {
+	if req.ServerHost == "" {
+		return fmt.Errorf("server_host is required")
+	}
+	if req.ServerName != "" {
+		if err := checkHostname(req.ServerName); err != nil {
+			return fmt.Errorf("server_name %v", err)
+		}
+	}
+	if len(req.ALPN) > MAX_TLS_ALPN {
+		return fmt.Errorf("alpn takes at most %d protocols", MAX_TLS_ALPN)
+	}
+	for _, p := range req.ALPN {
+		if p == "" || len(p) > 255 {
+			return fmt.Errorf("alpn protocols must be 1 to 255 bytes")
+		}
+	}
+	if _, err := parseTLSVersions(req.TLSVersions); err != nil {
+		return err
+	}
+	return validateRootStore(req)
+}
+
+// runTLS applies defaults to a decoded request, runs the TLS handshake test and records the result.
+// Errors come with the HTTP status to report them with.
+func runTLS(req RunRequest, profile *Profile) (map[string]interface{}, int, error) {
+	if req.ServerPort == 0 {
+		req.ServerPort = DEFAULT_TLS_PORT
+	}
+	if req.ServerName == "" {
+		req.ServerName = req.ServerHost
+	}
+	if len(req.ALPN) == 0 {
+		req.ALPN = defaultALPN
+	}
+	if err := checkProfileLimits(req, profile); err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	err := validateTLS(&req)
+	if err == nil {
+		req.AddressFamily, err = parseAddressFamily(req.AddressFamily)
+	}
+	if err == nil && req.AddressFamily == nettest.FAMILY_COMPARE {
+		err = fmt.Errorf("address_family compare is not available for TLS tests; run ipv4 and ipv6 separately")
+	}
+	if err == nil {
+		err = validateLockWait(&req)
+	}
+	if err == nil {
+		err = validateCallbackURL(req.CallbackURL)
+	}
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	versions, _ := parseTLSVersions(req.TLSVersions)
+
+	lock, release, status, err := lockTest(TEST_TYPE_TLS, req, false)
+	if err != nil {
+		return nil, status, err
+	}
+	defer release()
+
+	logf(req.ctx, "TLS test: %s:%d (server_name=%s, alpn=%s, versions=%s, family=%s)",
+		req.ServerHost, req.ServerPort, req.ServerName, strings.Join(req.ALPN, ","), strings.Join(req.TLSVersions, ","), req.AddressFamily)
+
+	ctx := req.runContext()
+	checker := newTLSChecker(req)
+	started := time.Now()
+	conn, dial, err := nettest.DialControlFrom(ctx, req.ServerHost, req.ServerPort, req.AddressFamily, TLS_DIAL_TIMEOUT, nil)
+	if err != nil {
+		return nil, http.StatusInternalServerError, twampError(ctx, "Connect failed", err)
+	}
+	state, handshake, err := tlsHandshake(ctx, conn, tlsConfig(checker, req, 0))
+	if err != nil {
+		return nil, http.StatusInternalServerError, twampError(ctx, "TLS handshake failed", err)
+	}
+	timings := TLSTimings{
+		DNSMs:       dial.ResolveMs,
+		ConnectMs:   dial.ConnectMs,
+		HandshakeMs: float64(handshake.Microseconds()) / 1000,
+		TotalMs:     float64(time.Since(started).Microseconds()) / 1000,
+	}
+
+	probes := make([]TLSVersionProbe, 0, len(versions))
+	for _, version := range versions {
+		probe := tlsProbeVersion(ctx, dial.Address, tlsConfig(checker, req, version))
+		if ctx.Err() != nil {
+			return nil, http.StatusInternalServerError, canceledError(ctx)
+		}
+		probe.Version = tlsVersionName(version)
+		probes = append(probes, probe)
+	}
+
+	data := map[string]interface{}{
+		"server":       req.ServerHost,
+		"port":         req.ServerPort,
+		"server_name":  req.ServerName,
+		"dial":         dial,
+		"version":      tls.VersionName(state.Version),
+		"cipher_suite": tls.CipherSuiteName(state.CipherSuite),
+		"alpn":         state.NegotiatedProtocol,
+		"alpn_offered": req.ALPN,
+		"timings":      timings,
+		"tls":          checker.Report(),
+		"duration_sec": time.Since(started).Seconds(),
+	}
+	if len(probes) > 0 {
+		data["versions"] = probes
+	}
+	if profile != nil {
+		data["profile"] = profile.Name
+	}
+	data["lock"] = lock
+
+	recordResult(TEST_TYPE_TLS, req, started, data)
+	notifyCallback(req.CallbackURL, data)
+
+	return data, http.StatusOK, nil
+}
+
+// tlsConfig is the checker's configuration for the request's server name and
+// ALPN protocols, pinned to version unless it is 0. Pinning also allows TLS
+// 1.0 and 1.1, which Go leaves out by default.
+func tlsConfig(checker *tlsChecker, req RunRequest, version uint16) *tls.Config {
+	config := checker.config(req.ServerName)
+	config.NextProtos = req.ALPN
+	if version != 0 {
+		config.MinVersion, config.MaxVersion = version, version
+	}
+	return config
+}
+
+// tlsHandshake runs the client handshake on conn within TLS_HANDSHAKE_TIMEOUT
+// and closes the connection
+func tlsHandshake(ctx context.Context, conn net.Conn, config *tls.Config) (tls.ConnectionState, time.Duration, error) {
+	ctx, cancel := context.WithTimeout(ctx, TLS_HANDSHAKE_TIMEOUT)
+	defer cancel()
+	client := tls.Client(conn, config)
+	defer client.Close()
+	start := time.Now()
+	err := client.HandshakeContext(ctx)
+	return client.ConnectionState(), time.Since(start), err
+}
+
+// tlsProbeVersion shakes hands over a new connection to address, the one the
+// first handshake used, so every version is tried on the same path
+func tlsProbeVersion(ctx context.Context, address string, config *tls.Config) TLSVersionProbe {
+	var probe TLSVersionProbe
+	dialer := &net.Dialer{Timeout: TLS_DIAL_TIMEOUT}
+	start := time.Now()
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		probe.Failure, probe.Error = TLS_FAILURE_ERROR, fmt.Sprintf("connect failed: %v", err)
+		return probe
+	}
+	probe.ConnectMs = float64(time.Since(start).Microseconds()) / 1000
+	state, handshake, err := tlsHandshake(ctx, conn, config)
+	if err != nil {
+		probe.Failure, probe.Error = tlsFailure(err), err.Error()
+		return probe
+	}
+	probe.Supported = true
+	probe.CipherSuite = tls.CipherSuiteName(state.CipherSuite)
+	probe.ALPN = state.NegotiatedProtocol
+	probe.HandshakeMs = float64(handshake.Microseconds()) / 1000
+	return probe
+}
+
+// tlsFailure classifies a failed handshake. A server that does not speak a
+// version answers with an alert or a ServerHello of another version; a reset,
+// a close without an alert or silence point to something on the path.
+func tlsFailure(err error) string {
+	var opErr *net.OpError
+	var alert tls.AlertError
+	var netErr net.Error
+	switch {
+	case errors.As(err, &opErr) && opErr.Op == "remote error":
+		return TLS_FAILURE_ALERT
+	case errors.As(err, &alert) && alert == tlsAlertProtocolVersion:
+		return TLS_FAILURE_VERSION // Sent by the client, which refuses the server's choice
+	case errors.Is(err, syscall.ECONNRESET):
+		return TLS_FAILURE_RESET
+	case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return TLS_FAILURE_CLOSED
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return TLS_FAILURE_TIMEOUT
+	}
+	return TLS_FAILURE_ERROR
+}
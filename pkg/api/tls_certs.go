@@ -0,0 +1,486 @@
+package api
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"log"
+	"math"
+	"math/big"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Certificate checks of the TLS tests (https transfers, S3, TLS handshake and NDT7 wss tests)
+const (
+	ROOT_STORE_SYSTEM = "system" // The operating system's trust store
+
+	OCSP_GOOD    = "good"
+	OCSP_REVOKED = "revoked"
+	OCSP_UNKNOWN = "unknown"
+)
+
+// TLSCertificate describes one certificate of the chain the server presented
+type TLSCertificate struct {
+	Subject            string    `json:"subject"`
+	Issuer             string    `json:"issuer"`
+	SerialNumber       string    `json:"serial_number"` // Hex
+	NotBefore          time.Time `json:"not_before"`
+	NotAfter           time.Time `json:"not_after"`
+	DaysToExpiry       int       `json:"days_to_expiry"` // Negative once expired
+	DNSNames           []string  `json:"dns_names,omitempty"`
+	IsCA               bool      `json:"is_ca"`
+	KeyType            string    `json:"key_type"` // e.g. RSA 2048, ECDSA P-256, Ed25519
+	SignatureAlgorithm string    `json:"signature_algorithm"`
+	SHA256Fingerprint  string    `json:"sha256_fingerprint"` // Hex, of the DER certificate
+}
+
+// OCSPStaple is the OCSP response the server stapled to the handshake, if any
+type OCSPStaple struct {
+	Stapled    bool       `json:"stapled"`
+	Status     string     `json:"status,omitempty"` // good, revoked or unknown
+	ProducedAt *time.Time `json:"produced_at,omitempty"`
+	ThisUpdate *time.Time `json:"this_update,omitempty"`
+	NextUpdate *time.Time `json:"next_update,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	Error      string     `json:"error,omitempty"` // Why the response was not usable
+}
+
+// TLSReport is the handshake and certificate check of a TLS connection
+type TLSReport struct {
+	Version      string           `json:"version"`
+	CipherSuite  string           `json:"cipher_suite"`
+	ServerName   string           `json:"server_name"`
+	RootStore    string           `json:"root_store"`
+	Verified     bool             `json:"verified"` // The chain validates for server_name and is not revoked
+	VerifyError  string           `json:"verify_error,omitempty"`
+	TrustAnchor  string           `json:"trust_anchor,omitempty"` // Root the chain validated to
+	DaysToExpiry int              `json:"days_to_expiry"`         // Of the presented certificate expiring first
+	Chain        []TLSCertificate `json:"chain"`                  // As presented, leaf first
+	OCSP         OCSPStaple       `json:"ocsp"`
+}
+
+// rootStores are the CA bundles of TLS_ROOT_STORES by name, next to the system store
+var rootStores = map[string]*x509.CertPool{}
+
+// loadRootStore reads a PEM bundle of CA certificates
+func loadRootStore(file string) (*x509.CertPool, int, error) {
+	raw, err := os.ReadFile(file)
+	if err != nil {
+		return nil, 0, err
+	}
+	pool := x509.NewCertPool()
+	count := 0
+	for rest := raw; ; {
+		var block *pem.Block
+		if block, rest = pem.Decode(rest); block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, 0, fmt.Errorf("%s: %w", file, err)
+		}
+		pool.AddCert(cert)
+		count++
+	}
+	if count == 0 {
+		return nil, 0, fmt.Errorf("%s: no certificates found", file)
+	}
+	return pool, count, nil
+}
+
+// configureRootStores loads the named CA bundles of TLS_ROOT_STORES ("name=file,...")
+func configureRootStores() {
+	for _, entry := range strings.Split(os.Getenv("TLS_ROOT_STORES"), ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		name, file, ok := strings.Cut(entry, "=")
+		name, file = strings.TrimSpace(name), strings.TrimSpace(file)
+		if !ok || name == "" || file == "" || name == ROOT_STORE_SYSTEM {
+			log.Fatalf("Invalid TLS_ROOT_STORES entry %q (expected name=file, name not %q)", entry, ROOT_STORE_SYSTEM)
+		}
+		pool, count, err := loadRootStore(file)
+		if err != nil {
+			log.Fatalf("Loading root store %s failed: %v", name, err)
+		}
+		rootStores[name] = pool
+		log.Printf("Loaded root store %s with %d certificates from %s", name, count, file)
+	}
+}
+
+// validateRootStore defaults root_store to the system store and checks that it is configured
+func validateRootStore(req *RunRequest) error {
+	if req.RootStore == "" {
+		req.RootStore = ROOT_STORE_SYSTEM
+	}
+	if req.RootStore == ROOT_STORE_SYSTEM || rootStores[req.RootStore] != nil {
+		return nil
+	}
+	names := []string{ROOT_STORE_SYSTEM}
+	for name := range rootStores {
+		names = append(names, name)
+	}
+	sort.Strings(names[1:])
+	return fmt.Errorf("unknown root_store %q (expected %s; see TLS_ROOT_STORES)", req.RootStore, strings.Join(names, ", "))
+}
+
+// tlsChecker verifies the certificates of each handshake against the request's
+// root store and keeps the report of the first one. Go's own verification is
+// skipped so that a chain which does not validate can still be reported.
+type tlsChecker struct {
+	store      string
+	roots      *x509.CertPool // nil for the system store
+	skipVerify bool
+
+	mu     sync.Mutex
+	report *TLSReport
+}
+
+func newTLSChecker(req RunRequest) *tlsChecker {
+	return &tlsChecker{store: req.RootStore, roots: rootStores[req.RootStore], skipVerify: req.TLSSkipVerify}
+}
+
+// config returns the client TLS configuration for serverName
+func (c *tlsChecker) config(serverName string) *tls.Config {
+	return &tls.Config{
+		ServerName:         serverName,
+		InsecureSkipVerify: true, // Checked in VerifyConnection instead
+		VerifyConnection: func(cs tls.ConnectionState) error {
+			report := checkCertificates(cs, serverName, c.store, c.roots, time.Now())
+			c.mu.Lock()
+			if c.report == nil {
+				c.report = report
+			}
+			c.mu.Unlock()
+			if !report.Verified && !c.skipVerify {
+				return fmt.Errorf("certificate of %s does not validate against the %s root store: %s (set tls_skip_verify to test anyway)",
+					serverName, c.store, report.VerifyError)
+			}
+			return nil
+		},
+	}
+}
+
+// Report returns the report of the first handshake, or nil if there was none
+func (c *tlsChecker) Report() *TLSReport {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.report
+}
+
+// checkCertificates validates the presented chain, reads the stapled OCSP
+// response and describes both
+func checkCertificates(cs tls.ConnectionState, serverName, store string, roots *x509.CertPool, now time.Time) *TLSReport {
+	report := &TLSReport{
+		Version:     tls.VersionName(cs.Version),
+		CipherSuite: tls.CipherSuiteName(cs.CipherSuite),
+		ServerName:  serverName,
+		RootStore:   store,
+		Chain:       []TLSCertificate{},
+	}
+	if len(cs.PeerCertificates) == 0 {
+		report.VerifyError = "server presented no certificate"
+		return report
+	}
+	for i, cert := range cs.PeerCertificates {
+		info := describeCertificate(cert, now)
+		if i == 0 || info.DaysToExpiry < report.DaysToExpiry {
+			report.DaysToExpiry = info.DaysToExpiry
+		}
+		report.Chain = append(report.Chain, info)
+	}
+
+	leaf := cs.PeerCertificates[0]
+	intermediates := x509.NewCertPool()
+	for _, cert := range cs.PeerCertificates[1:] {
+		intermediates.AddCert(cert)
+	}
+	chains, err := leaf.Verify(x509.VerifyOptions{
+		DNSName:       serverName,
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   now,
+	})
+	var issuer *x509.Certificate
+	if err != nil {
+		report.VerifyError = err.Error()
+		if len(cs.PeerCertificates) > 1 {
+			issuer = cs.PeerCertificates[1]
+		}
+	} else {
+		report.Verified = true
+		chain := chains[0]
+		report.TrustAnchor = chain[len(chain)-1].Subject.String()
+		if len(chain) > 1 {
+			issuer = chain[1]
+		}
+	}
+
+	report.OCSP = checkOCSPStaple(cs.OCSPResponse, leaf, issuer, now)
+	if report.OCSP.Status == OCSP_REVOKED && report.OCSP.Error == "" {
+		report.Verified = false
+		report.VerifyError = fmt.Sprintf("certificate revoked at %s (stapled OCSP response)", report.OCSP.RevokedAt.Format(time.RFC3339))
+	}
+	return report
+}
+
+// daysUntil counts whole days from now to t, negative once t has passed
+func daysUntil(t, now time.Time) int {
+	return int(math.Floor(t.Sub(now).Hours() / 24))
+}
+
+func describeCertificate(cert *x509.Certificate, now time.Time) TLSCertificate {
+	sum := sha256.Sum256(cert.Raw)
+	return TLSCertificate{
+		Subject:            cert.Subject.String(),
+		Issuer:             cert.Issuer.String(),
+		SerialNumber:       hex.EncodeToString(cert.SerialNumber.Bytes()),
+		NotBefore:          cert.NotBefore.UTC(),
+		NotAfter:           cert.NotAfter.UTC(),
+		DaysToExpiry:       daysUntil(cert.NotAfter, now),
+		DNSNames:           cert.DNSNames,
+		IsCA:               cert.IsCA,
+		KeyType:            certificateKeyType(cert),
+		SignatureAlgorithm: cert.SignatureAlgorithm.String(),
+		SHA256Fingerprint:  hex.EncodeToString(sum[:]),
+	}
+}
+
+// certificateKeyType names the key algorithm and size of a certificate
+func certificateKeyType(cert *x509.Certificate) string {
+	switch key := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		return fmt.Sprintf("RSA %d", key.N.BitLen())
+	case *ecdsa.PublicKey:
+		return "ECDSA " + key.Curve.Params().Name
+	case ed25519.PublicKey:
+		return "Ed25519"
+	}
+	return cert.PublicKeyAlgorithm.String()
+}
+
+// OCSP response structures (RFC 6960 section 4.2.1)
+type ocspResponse struct {
+	Status   asn1.Enumerated
+	Response ocspResponseBytes `asn1:"explicit,tag:0,optional"`
+}
+
+type ocspResponseBytes struct {
+	Type     asn1.ObjectIdentifier
+	Response []byte
+}
+
+type ocspBasicResponse struct {
+	TBSResponseData    asn1.RawValue
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          asn1.BitString
+	Certificates       []asn1.RawValue `asn1:"explicit,tag:0,optional"`
+}
+
+type ocspResponseData struct {
+	Version     int `asn1:"optional,default:0,explicit,tag:0"`
+	ResponderID asn1.RawValue
+	ProducedAt  time.Time `asn1:"generalized"`
+	Responses   []ocspSingleResponse
+	Extensions  []pkix.Extension `asn1:"explicit,tag:1,optional"`
+}
+
+type ocspSingleResponse struct {
+	CertID     ocspCertID
+	Good       asn1.Flag        `asn1:"tag:0,optional"`
+	Revoked    ocspRevokedInfo  `asn1:"tag:1,optional"`
+	Unknown    asn1.Flag        `asn1:"tag:2,optional"`
+	ThisUpdate time.Time        `asn1:"generalized"`
+	NextUpdate time.Time        `asn1:"generalized,explicit,tag:0,optional"`
+	Extensions []pkix.Extension `asn1:"explicit,tag:1,optional"`
+}
+
+type ocspRevokedInfo struct {
+	RevocationTime time.Time       `asn1:"generalized"`
+	Reason         asn1.Enumerated `asn1:"explicit,tag:0,optional"`
+}
+
+type ocspCertID struct {
+	HashAlgorithm  pkix.AlgorithmIdentifier
+	IssuerNameHash []byte
+	IssuerKeyHash  []byte
+	SerialNumber   *big.Int
+}
+
+var (
+	oidOCSPBasic = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 48, 1, 1}
+
+	// ocspSignatureAlgorithms are the signature algorithms OCSP responders use
+	ocspSignatureAlgorithms = map[string]x509.SignatureAlgorithm{
+		"1.2.840.113549.1.1.5":  x509.SHA1WithRSA,
+		"1.2.840.113549.1.1.11": x509.SHA256WithRSA,
+		"1.2.840.113549.1.1.12": x509.SHA384WithRSA,
+		"1.2.840.113549.1.1.13": x509.SHA512WithRSA,
+		"1.2.840.10045.4.3.2":   x509.ECDSAWithSHA256,
+		"1.2.840.10045.4.3.3":   x509.ECDSAWithSHA384,
+		"1.2.840.10045.4.3.4":   x509.ECDSAWithSHA512,
+		"1.3.101.112":           x509.PureEd25519,
+	}
+
+	// ocspHashes are the CertID hash algorithms
+	ocspHashes = map[string]crypto.Hash{
+		"1.3.14.3.2.26":          crypto.SHA1,
+		"2.16.840.1.101.3.4.2.1": crypto.SHA256,
+		"2.16.840.1.101.3.4.2.2": crypto.SHA384,
+		"2.16.840.1.101.3.4.2.3": crypto.SHA512,
+	}
+)
+
+// checkOCSPStaple parses a stapled OCSP response for leaf and checks its
+// signature with issuer, directly or through a delegated responder certificate.
+// Without the issuer the status is reported unchecked, with an error saying so.
+func checkOCSPStaple(raw []byte, leaf, issuer *x509.Certificate, now time.Time) OCSPStaple {
+	var staple OCSPStaple
+	if len(raw) == 0 {
+		return staple
+	}
+	staple.Stapled = true
+
+	var resp ocspResponse
+	if rest, err := asn1.Unmarshal(raw, &resp); err != nil || len(rest) > 0 {
+		staple.Error = "malformed OCSP response"
+		return staple
+	}
+	if resp.Status != 0 {
+		staple.Error = fmt.Sprintf("OCSP responder status %d", resp.Status)
+		return staple
+	}
+	if !resp.Response.Type.Equal(oidOCSPBasic) {
+		staple.Error = fmt.Sprintf("unsupported OCSP response type %s", resp.Response.Type)
+		return staple
+	}
+	var basic ocspBasicResponse
+	var data ocspResponseData
+	if _, err := asn1.Unmarshal(resp.Response.Response, &basic); err != nil {
+		staple.Error = "malformed OCSP response"
+		return staple
+	}
+	if _, err := asn1.Unmarshal(basic.TBSResponseData.FullBytes, &data); err != nil {
+		staple.Error = "malformed OCSP response"
+		return staple
+	}
+
+	var single *ocspSingleResponse
+	for i := range data.Responses {
+		if data.Responses[i].CertID.SerialNumber.Cmp(leaf.SerialNumber) == 0 {
+			single = &data.Responses[i]
+			break
+		}
+	}
+	if single == nil {
+		staple.Error = "OCSP response is not for the server certificate"
+		return staple
+	}
+	produced, thisUpdate := data.ProducedAt.UTC(), single.ThisUpdate.UTC()
+	staple.ProducedAt, staple.ThisUpdate = &produced, &thisUpdate
+	if !single.NextUpdate.IsZero() {
+		next := single.NextUpdate.UTC()
+		staple.NextUpdate = &next
+	}
+	switch {
+	case bool(single.Good):
+		staple.Status = OCSP_GOOD
+	case bool(single.Unknown):
+		staple.Status = OCSP_UNKNOWN
+	default:
+		staple.Status = OCSP_REVOKED
+		revoked := single.Revoked.RevocationTime.UTC()
+		staple.RevokedAt = &revoked
+	}
+
+	if issuer == nil {
+		staple.Error = "issuer certificate not available to check the OCSP signature"
+		return staple
+	}
+	if err := checkOCSPIssuer(single.CertID, issuer); err != nil {
+		staple.Error = err.Error()
+		return staple
+	}
+	if err := checkOCSPSignature(basic, issuer, now); err != nil {
+		staple.Error = err.Error()
+		return staple
+	}
+	if staple.NextUpdate != nil && now.After(*staple.NextUpdate) {
+		staple.Error = "OCSP response expired at " + staple.NextUpdate.Format(time.RFC3339)
+	}
+	return staple
+}
+
+// checkOCSPIssuer checks that the response's CertID names issuer
+func checkOCSPIssuer(id ocspCertID, issuer *x509.Certificate) error {
+	hash, ok := ocspHashes[id.HashAlgorithm.Algorithm.String()]
+	if !ok || !hash.Available() {
+		return fmt.Errorf("unsupported OCSP CertID hash %s", id.HashAlgorithm.Algorithm)
+	}
+	var spki struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}
+	if _, err := asn1.Unmarshal(issuer.RawSubjectPublicKeyInfo, &spki); err != nil {
+		return fmt.Errorf("malformed issuer public key")
+	}
+	h := hash.New()
+	h.Write(issuer.RawSubject)
+	nameHash := h.Sum(nil)
+	h.Reset()
+	h.Write(spki.PublicKey.RightAlign())
+	if !bytes.Equal(nameHash, id.IssuerNameHash) || !bytes.Equal(h.Sum(nil), id.IssuerKeyHash) {
+		return fmt.Errorf("OCSP response is for a different issuer")
+	}
+	return nil
+}
+
+// checkOCSPSignature verifies the response signature with issuer, or with an
+// embedded responder certificate that issuer delegated OCSP signing to
+func checkOCSPSignature(basic ocspBasicResponse, issuer *x509.Certificate, now time.Time) error {
+	algorithm, ok := ocspSignatureAlgorithms[basic.SignatureAlgorithm.Algorithm.String()]
+	if !ok {
+		return fmt.Errorf("unsupported OCSP signature algorithm %s", basic.SignatureAlgorithm.Algorithm)
+	}
+	signer := issuer
+	if len(basic.Certificates) > 0 {
+		responder, err := x509.ParseCertificate(basic.Certificates[0].FullBytes)
+		if err != nil {
+			return fmt.Errorf("malformed OCSP responder certificate")
+		}
+		if !bytes.Equal(responder.Raw, issuer.Raw) {
+			if err := responder.CheckSignatureFrom(issuer); err != nil {
+				return fmt.Errorf("OCSP responder certificate not issued by the certificate's issuer")
+			}
+			delegated := false
+			for _, usage := range responder.ExtKeyUsage {
+				delegated = delegated || usage == x509.ExtKeyUsageOCSPSigning
+			}
+			if !delegated || now.After(responder.NotAfter) || now.Before(responder.NotBefore) {
+				return fmt.Errorf("OCSP responder certificate not valid for OCSP signing")
+			}
+			signer = responder
+		}
+	}
+	if err := signer.CheckSignature(algorithm, basic.TBSResponseData.FullBytes, basic.Signature.RightAlign()); err != nil {
+		return fmt.Errorf("OCSP signature does not verify: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package api
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func TestDaysUntil(t *testing.T) {
+	now := time.Date(2026, 10, 14, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		notAfter time.Time
+		want     int
+	}{
+		{now.AddDate(0, 0, 90), 90},
+		{now.Add(47 * time.Hour), 1},
+		{now.Add(time.Hour), 0},
+		{now.Add(-time.Hour), -1}, // Expired, even if by less than a day
+		{now.AddDate(0, 0, -3).Add(time.Hour), -3},
+	}
+
+	for _, tt := range tests {
+		if got := daysUntil(tt.notAfter, now); got != tt.want {
+			t.Errorf("%s: expected %d days, got %d", tt.notAfter, tt.want, got)
+		}
+	}
+}
+
+func TestCertificateKeyType(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	edPub, _, _ := ed25519.GenerateKey(rand.Reader)
+	tests := []struct {
+		key  interface{}
+		want string
+	}{
+		{&rsaKey.PublicKey, "RSA 2048"},
+		{&ecKey.PublicKey, "ECDSA P-384"},
+		{edPub, "Ed25519"},
+	}
+
+	for _, tt := range tests {
+		if got := certificateKeyType(&x509.Certificate{PublicKey: tt.key}); got != tt.want {
+			t.Errorf("Expected %s, got %s", tt.want, got)
+		}
+	}
+}
+
+func TestOCSPCertStatus(t *testing.T) {
+	now := time.Date(2026, 10, 14, 12, 0, 0, 0, time.UTC)
+	id := ocspCertID{
+		HashAlgorithm:  pkix.AlgorithmIdentifier{Algorithm: asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}, Parameters: asn1.NullRawValue},
+		IssuerNameHash: make([]byte, 20),
+		IssuerKeyHash:  make([]byte, 20),
+		SerialNumber:   big.NewInt(4242),
+	}
+
+	good, err := asn1.Marshal(ocspSingleResponse{CertID: id, Good: true, ThisUpdate: now, NextUpdate: now.Add(72 * time.Hour)})
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	var single ocspSingleResponse
+	if _, err := asn1.Unmarshal(good, &single); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if !bool(single.Good) || bool(single.Unknown) || !single.Revoked.RevocationTime.IsZero() {
+		t.Errorf("Expected a good status, got %+v", single)
+	}
+	if !single.NextUpdate.Equal(now.Add(72*time.Hour)) || single.CertID.SerialNumber.Int64() != 4242 {
+		t.Errorf("Expected next_update %s for serial 4242, got %s for %s", now.Add(72*time.Hour), single.NextUpdate, single.CertID.SerialNumber)
+	}
+
+	revoked, err := asn1.Marshal(ocspSingleResponse{CertID: id, Revoked: ocspRevokedInfo{RevocationTime: now.Add(-time.Hour)}, ThisUpdate: now})
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	single = ocspSingleResponse{}
+	if _, err := asn1.Unmarshal(revoked, &single); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if bool(single.Good) || bool(single.Unknown) || !single.Revoked.RevocationTime.Equal(now.Add(-time.Hour)) {
+		t.Errorf("Expected revoked at %s, got %+v", now.Add(-time.Hour), single)
+	}
+	if !single.NextUpdate.IsZero() {
+		t.Errorf("Expected no next_update, got %s", single.NextUpdate)
+	}
+}
@@ -0,0 +1,147 @@
+package api
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// tlsTestCertificate is a self-signed certificate for 127.0.0.1
+func tlsTestCertificate(t *testing.T) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "tls.test"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// tlsHandshakeWith shakes hands as a client pinned to version with a server
+// that handles each accepted connection with serve
+func tlsHandshakeWith(t *testing.T, version uint16, serve func(net.Conn)) error {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err == nil {
+			serve(conn)
+		}
+	}()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	client := tls.Client(conn, &tls.Config{InsecureSkipVerify: true, MinVersion: version, MaxVersion: version})
+	defer client.Close()
+	return client.HandshakeContext(ctx)
+}
+
+func TestParseTLSVersions(t *testing.T) {
+	versions, err := parseTLSVersions([]string{"1.3", " 1.0", "1.2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []uint16{tls.VersionTLS13, tls.VersionTLS10, tls.VersionTLS12}
+	if fmt.Sprint(versions) != fmt.Sprint(expected) {
+		t.Errorf("Expected %v in the order given, got %v", expected, versions)
+	}
+
+	for _, names := range [][]string{{"1.4"}, {"TLS 1.2"}, {"1.2", "1.2"}} {
+		if _, err := parseTLSVersions(names); err == nil {
+			t.Errorf("Expected %q to be rejected", names)
+		}
+	}
+}
+
+func TestTLSFailureErrors(t *testing.T) {
+	tests := []struct {
+		err      error
+		expected string
+	}{
+		{&net.OpError{Op: "remote error", Err: errors.New("tls: protocol version not supported")}, TLS_FAILURE_ALERT},
+		{fmt.Errorf("%w%.0w", errors.New("tls: server selected unsupported protocol version 303"), tls.AlertError(tlsAlertProtocolVersion)), TLS_FAILURE_VERSION},
+		{&net.OpError{Op: "read", Err: os.NewSyscallError("read", syscall.ECONNRESET)}, TLS_FAILURE_RESET},
+		{io.EOF, TLS_FAILURE_CLOSED},
+		{context.DeadlineExceeded, TLS_FAILURE_TIMEOUT},
+		{errors.New("tls: no cipher suite supported by both client and server"), TLS_FAILURE_ERROR},
+	}
+	for _, tt := range tests {
+		if got := tlsFailure(tt.err); got != tt.expected {
+			t.Errorf("tlsFailure(%v) = %q, expected %q", tt.err, got, tt.expected)
+		}
+	}
+}
+
+func TestTLSFailureHandshakes(t *testing.T) {
+	cert := tlsTestCertificate(t)
+	server := func(max uint16) func(net.Conn) {
+		return func(conn net.Conn) {
+			s := tls.Server(conn, &tls.Config{Certificates: []tls.Certificate{cert}, MaxVersion: max})
+			_ = s.Handshake()
+			s.Close()
+		}
+	}
+
+	if err := tlsHandshakeWith(t, tls.VersionTLS13, server(tls.VersionTLS13)); err != nil {
+		t.Fatalf("Expected the TLS 1.3 handshake to complete, got %v", err)
+	}
+	if err := tlsHandshakeWith(t, tls.VersionTLS13, server(tls.VersionTLS12)); tlsFailure(err) != TLS_FAILURE_ALERT {
+		t.Errorf("Expected a server without TLS 1.3 to refuse it with an alert, got %v", err)
+	}
+
+	closeAfterHello := func(conn net.Conn) {
+		_, _ = conn.Read(make([]byte, 1024))
+		conn.Close()
+	}
+	if err := tlsHandshakeWith(t, tls.VersionTLS12, closeAfterHello); tlsFailure(err) != TLS_FAILURE_CLOSED {
+		t.Errorf("Expected a close after the ClientHello to count as closed, got %v", err)
+	}
+
+	resetAfterHello := func(conn net.Conn) {
+		_, _ = conn.Read(make([]byte, 1024))
+		_ = conn.(*net.TCPConn).SetLinger(0)
+		conn.Close()
+	}
+	if err := tlsHandshakeWith(t, tls.VersionTLS12, resetAfterHello); tlsFailure(err) != TLS_FAILURE_RESET {
+		t.Errorf("Expected a reset after the ClientHello to count as reset, got %v", err)
+	}
+
+	silent := func(conn net.Conn) {
+		time.Sleep(time.Second)
+		conn.Close()
+	}
+	if err := tlsHandshakeWith(t, tls.VersionTLS12, silent); tlsFailure(err) != TLS_FAILURE_TIMEOUT {
+		t.Errorf("Expected a server that never answers to time out, got %v", err)
+	}
+}
@@ -0,0 +1,583 @@
+package api
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	mathrand "math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"golang.org/x/net/ipv4"
+
+	"network-test-api/pkg/nettest"
+)
+
+// Traceroute tests: probes with increasing TTL, answered with time exceeded by
+// each router on the way and by the target itself at the end
+const (
+	TRACEROUTE_PROTOCOL_UDP  = "udp"  // Datagrams to port server_port + probe number, answered with port unreachable
+	TRACEROUTE_PROTOCOL_ICMP = "icmp" // Echo requests, answered with an echo reply
+	TRACEROUTE_PROTOCOL_TCP  = "tcp"  // SYNs to server_port, answered with SYN-ACK or RST; passes most firewalls
+
+	TRACEROUTE_SOCKET_RECVERR = "recverr" // Unprivileged UDP sockets reading ICMP errors with IP_RECVERR (Linux)
+
+	DEFAULT_TRACEROUTE_MAX_HOPS = 30
+	MAX_TRACEROUTE_MAX_HOPS     = 64
+	DEFAULT_TRACEROUTE_PROBES   = 3
+	MAX_TRACEROUTE_PROBES       = 10
+	DEFAULT_TRACEROUTE_TCP_PORT = 80
+	TRACEROUTE_PAYLOAD          = 32 // Payload bytes of UDP and ICMP probes
+
+	TRACEROUTE_WAIT        = 2 * time.Second        // Per hop, for answers to its probes
+	TRACEROUTE_TCP_CONNECT = 950 * time.Millisecond // Gives up before the kernel resends the SYN after 1 s, whose answers would look like a slow first one
+	TRACEROUTE_DNS_TIMEOUT = 2 * time.Second
+)
+
+// TraceHop is one TTL of a traceroute
+type TraceHop struct {
+	TTL         int         `json:"ttl"`
+	Address     string      `json:"address,omitempty"`   // Responder that answered most probes
+	Name        string      `json:"name,omitempty"`      // Its reverse DNS name
+	Addresses   []string    `json:"addresses,omitempty"` // All responders, when probes were answered by several (ECMP)
+	Sent        int         `json:"sent"`
+	Received    int         `json:"received"`
+	LossPercent float64     `json:"loss_percent"`
+	RTTMinMs    float64     `json:"rtt_min_ms"`
+	RTTAvgMs    float64     `json:"rtt_avg_ms"`
+	RTTMaxMs    float64     `json:"rtt_max_ms"`
+	RTTStddevMs float64     `json:"rtt_stddev_ms"`
+	Probes      []PingProbe `json:"probes"`
+}
+
+// summarize computes the hop statistics and reports whether the target answered,
+// or every answer was an unreachable error, either of which ends the trace
+func (h *TraceHop) summarize() (reached, unreachable bool) {
+	h.Sent = len(h.Probes)
+	answers := make(map[string]int)
+	var rtts []float64
+	unreachables := 0
+	for _, p := range h.Probes {
+		if p.Status == PING_STATUS_TIMEOUT {
+			continue
+		}
+		h.Received++
+		rtts = append(rtts, p.RTTMs)
+		if answers[p.From] == 0 {
+			h.Addresses = append(h.Addresses, p.From)
+		}
+		answers[p.From]++
+		switch p.Status {
+		case PING_STATUS_REPLY, PING_STATUS_PORT_UNREACHABLE:
+			reached = true
+		case PING_STATUS_UNREACHABLE:
+			unreachables++
+		}
+	}
+	if h.Sent > 0 {
+		h.LossPercent = 100 * float64(h.Sent-h.Received) / float64(h.Sent)
+	}
+	h.RTTMinMs, h.RTTAvgMs, h.RTTMaxMs, h.RTTStddevMs = rttStats(rtts)
+	for _, addr := range h.Addresses {
+		if answers[addr] > answers[h.Address] {
+			h.Address = addr
+		}
+	}
+	if len(h.Addresses) < 2 {
+		h.Addresses = nil
+	}
+	return reached, h.Received > 0 && unreachables == h.Received
+}
+
+// TracerouteReport is the outcome of a traceroute test
+type TracerouteReport struct {
+	Protocol       string     `json:"protocol"`
+	Socket         string     `json:"socket"`
+	FallbackReason string     `json:"fallback_reason,omitempty"` // Why no raw ICMP socket was used
+	Family         string     `json:"family"`
+	Address        string     `json:"address"`
+	Port           int        `json:"port,omitempty"`
+	MaxHops        int        `json:"max_hops"`
+	ProbesPerHop   int        `json:"probes_per_hop"`
+	Reached        bool       `json:"reached"`
+	Hops           []TraceHop `json:"hops"`
+}
+
+// traceAnswer is a reply or error matched to a probe
+type traceAnswer struct {
+	probe  int
+	status string
+	from   string
+	at     time.Time
+}
+
+// traceProber sends probes, numbered across the whole trace, at a TTL and
+// delivers what comes back
+type traceProber interface {
+	send(probe, ttl int) error
+	answers() <-chan traceAnswer
+	close()
+}
+
+// traceAnswers hands answers from reading goroutines to the hop loop until the
+// trace is over
+type traceAnswers struct {
+	results chan traceAnswer
+	done    chan struct{}
+}
+
+func newTraceAnswers() traceAnswers {
+	return traceAnswers{results: make(chan traceAnswer, 64), done: make(chan struct{})}
+}
+
+func (a traceAnswers) deliver(answer traceAnswer) {
+	select {
+	case a.results <- answer:
+	case <-a.done:
+	}
+}
+
+func (a traceAnswers) answers() <-chan traceAnswer { return a.results }
+
+// rawTracer sends probes of any protocol and reads the answers from a raw ICMP socket
+type rawTracer struct {
+	traceAnswers
+	protocol string
+	conn     net.PacketConn
+	p4       *ipv4.PacketConn // IPv4 only, for the TTL of ICMP probes
+	dst      net.IP
+	v6       bool
+	port     int
+	id       int
+
+	mu       sync.Mutex
+	tcpPorts map[int]int // Probe number by local port of the TCP probes
+}
+
+func openRawTracer(protocol string, dst net.IP, port int) (*rawTracer, error) {
+	v6 := dst.To4() == nil
+	network, local := "ip4:icmp", "0.0.0.0"
+	if v6 {
+		network, local = "ip6:ipv6-icmp", "::"
+	}
+	conn, err := net.ListenPacket(network, local)
+	if err != nil {
+		return nil, err
+	}
+	t := &rawTracer{
+		traceAnswers: newTraceAnswers(),
+		protocol:     protocol,
+		conn:         conn,
+		dst:          dst,
+		v6:           v6,
+		port:         port,
+		id:           mathrand.Intn(0x10000),
+		tcpPorts:     make(map[int]int),
+	}
+	if !v6 {
+		t.p4 = ipv4.NewPacketConn(conn)
+	}
+	go t.read()
+	return t, nil
+}
+
+func (t *rawTracer) send(probe, ttl int) error {
+	switch t.protocol {
+	case TRACEROUTE_PROTOCOL_ICMP:
+		var err error
+		if t.v6 {
+			err = setIPv6HopLimit(t.conn.(syscall.Conn), ttl)
+		} else {
+			err = t.p4.SetTTL(ttl)
+		}
+		if err != nil {
+			return fmt.Errorf("setting ttl: %v", err)
+		}
+		_, err = t.conn.WriteTo(icmpEcho(t.v6, t.id, probe, TRACEROUTE_PAYLOAD), &net.IPAddr{IP: t.dst})
+		return err
+	case TRACEROUTE_PROTOCOL_UDP:
+		conn, err := dialUDPProbe(&net.UDPAddr{IP: t.dst, Port: t.port + probe}, ttl)
+		if err != nil {
+			return err
+		}
+		defer conn.Close() // The raw socket sees the answers either way
+		_, err = conn.Write(make([]byte, TRACEROUTE_PAYLOAD))
+		return err
+	}
+	return t.sendTCP(probe, ttl)
+}
+
+// sendTCP starts a connection with the given TTL; routers answer its SYN on the
+// raw socket, the target by accepting or refusing it
+func (t *rawTracer) sendTCP(probe, ttl int) error {
+	control, err := tcpProbeControl(ttl, func(port int) {
+		t.mu.Lock()
+		t.tcpPorts[port] = probe
+		t.mu.Unlock()
+	})
+	if err != nil {
+		return err
+	}
+	network := "tcp4"
+	if t.v6 {
+		network = "tcp6"
+	}
+	dialer := net.Dialer{Timeout: TRACEROUTE_TCP_CONNECT, Control: control}
+	go func() {
+		conn, err := dialer.Dial(network, net.JoinHostPort(t.dst.String(), strconv.Itoa(t.port)))
+		at := time.Now()
+		if err == nil {
+			conn.Close()
+		} else if !errors.Is(err, syscall.ECONNREFUSED) {
+			return // Timed out, or a router's error the raw socket reports
+		}
+		t.deliver(traceAnswer{probe: probe, status: PING_STATUS_REPLY, from: t.dst.String(), at: at})
+	}()
+	return nil
+}
+
+func (t *rawTracer) close() {
+	close(t.done)
+	t.conn.Close()
+}
+
+// read delivers the answers to our probes until the socket is closed
+func (t *rawTracer) read() {
+	buf := make([]byte, 1500)
+	for {
+		n, from, err := t.conn.ReadFrom(buf)
+		at := time.Now()
+		if err != nil {
+			return
+		}
+		q, ok := parseICMPQuote(buf[:n], t.v6)
+		if !ok {
+			continue
+		}
+		if probe, ok := t.match(q); ok {
+			t.deliver(traceAnswer{probe: probe, status: q.status, from: addrIP(from), at: at})
+		}
+	}
+}
+
+// match finds the probe an ICMP message is about
+func (t *rawTracer) match(q icmpQuote) (int, bool) {
+	if q.dst != nil && !q.dst.Equal(t.dst) {
+		return 0, false
+	}
+	switch t.protocol {
+	case TRACEROUTE_PROTOCOL_ICMP:
+		return echoSeq(q, t.v6, t.id, true)
+	case TRACEROUTE_PROTOCOL_UDP:
+		if q.proto != ipProtoUDP {
+			return 0, false
+		}
+		probe := int(binary.BigEndian.Uint16(q.header[2:4])) - t.port
+		return probe, probe >= 0
+	}
+	if q.proto != ipProtoTCP {
+		return 0, false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	probe, ok := t.tcpPorts[int(binary.BigEndian.Uint16(q.header[0:2]))]
+	return probe, ok
+}
+
+// recvErrTracer sends each UDP probe from its own socket and reads the ICMP error
+// the kernel queues on it, which needs no privileges
+type recvErrTracer struct {
+	traceAnswers
+	dst  net.IP
+	port int
+}
+
+func newRecvErrTracer(dst net.IP, port int) *recvErrTracer {
+	return &recvErrTracer{traceAnswers: newTraceAnswers(), dst: dst, port: port}
+}
+
+func (t *recvErrTracer) send(probe, ttl int) error {
+	conn, err := dialUDPProbe(&net.UDPAddr{IP: t.dst, Port: t.port + probe}, ttl)
+	if err != nil {
+		return err
+	}
+	if err := enableRecvErr(conn); err != nil {
+		conn.Close()
+		return err
+	}
+	if _, err := conn.Write(make([]byte, TRACEROUTE_PAYLOAD)); err != nil {
+		conn.Close()
+		return err
+	}
+	go func() {
+		defer conn.Close()
+		_ = conn.SetReadDeadline(time.Now().Add(TRACEROUTE_WAIT))
+		status, from, err := readRecvErr(conn)
+		if err != nil {
+			return
+		}
+		t.deliver(traceAnswer{probe: probe, status: status, from: from, at: time.Now()})
+	}()
+	return nil
+}
+
+func (t *recvErrTracer) close() { close(t.done) }
+
+// dialUDPProbe opens a UDP socket to dst sending with the given TTL
+func dialUDPProbe(dst *net.UDPAddr, ttl int) (*net.UDPConn, error) {
+	network := "udp4"
+	if dst.IP.To4() == nil {
+		network = "udp6"
+	}
+	conn, err := net.DialUDP(network, nil, dst)
+	if err != nil {
+		return nil, err
+	}
+	if network == "udp4" {
+		err = ipv4.NewConn(conn).SetTTL(ttl)
+	} else {
+		err = setIPv6HopLimit(conn, ttl)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("setting ttl: %v", err)
+	}
+	return conn, nil
+}
+
+// traceHops probes TTL 1 up to maxHops until the target answers or a hop reports
+// it unreachable
+func traceHops(t traceProber, maxHops, probesPerHop int, progress *JobProgress) ([]TraceHop, bool, error) {
+	start := time.Now()
+	var hops []TraceHop
+	for ttl := 1; ttl <= maxHops; ttl++ {
+		first := (ttl - 1) * probesPerHop
+		hop := TraceHop{TTL: ttl, Probes: make([]PingProbe, probesPerHop)}
+		sent := make([]time.Time, probesPerHop)
+		for i := range hop.Probes {
+			hop.Probes[i] = PingProbe{Seq: i, Status: PING_STATUS_TIMEOUT}
+			sent[i] = time.Now()
+			if err := t.send(first+i, ttl); err != nil {
+				return hops, false, fmt.Errorf("sending probe %d at ttl %d: %v", i, ttl, err)
+			}
+		}
+
+		wait := time.NewTimer(TRACEROUTE_WAIT)
+	collect:
+		for answered := 0; answered < probesPerHop; {
+			select {
+			case a := <-t.answers():
+				i := a.probe - first
+				if i < 0 || i >= probesPerHop || hop.Probes[i].Status != PING_STATUS_TIMEOUT {
+					continue // A late answer from an earlier hop, or a duplicate
+				}
+				hop.Probes[i] = PingProbe{Seq: i, Status: a.status, From: a.from, RTTMs: float64(a.at.Sub(sent[i]).Nanoseconds()) / 1e6}
+				answered++
+			case <-wait.C:
+				break collect
+			}
+		}
+		wait.Stop()
+
+		reached, unreachable := hop.summarize()
+		hops = append(hops, hop)
+		if hop.Received > 0 {
+			progress.add(SeriesPoint{T: time.Since(start).Seconds(), Value: hop.RTTAvgMs})
+		}
+		if reached || unreachable {
+			return hops, reached, nil
+		}
+	}
+	return hops, false, nil
+}
+
+// lookupHopNames fills in the reverse DNS names of the hops, leaving out those
+// that do not resolve in time
+func lookupHopNames(hops []TraceHop) {
+	ctx, cancel := context.WithTimeout(context.Background(), TRACEROUTE_DNS_TIMEOUT)
+	defer cancel()
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	names := make(map[string]string)
+	for _, hop := range hops {
+		if _, ok := names[hop.Address]; ok || hop.Address == "" {
+			continue
+		}
+		names[hop.Address] = ""
+		wg.Add(1)
+		go func(addr string) {
+			defer wg.Done()
+			if ptrs, err := net.DefaultResolver.LookupAddr(ctx, addr); err == nil && len(ptrs) > 0 {
+				mu.Lock()
+				names[addr] = strings.TrimSuffix(ptrs[0], ".")
+				mu.Unlock()
+			}
+		}(hop.Address)
+	}
+	wg.Wait()
+	for i := range hops {
+		hops[i].Name = names[hops[i].Address]
+	}
+}
+
+// validateTraceroute checks the protocol and bounds of a traceroute request
+func validateTraceroute(req *RunRequest) error {
+	switch req.Protocol = strings.ToLower(req.Protocol); req.Protocol {
+	case TRACEROUTE_PROTOCOL_UDP, TRACEROUTE_PROTOCOL_ICMP, TRACEROUTE_PROTOCOL_TCP:
+	default:
+		return fmt.Errorf("invalid protocol %q (expected udp, icmp or tcp)", req.Protocol)
+	}
+	switch {
+	case req.ServerHost == "":
+		return fmt.Errorf("server_host is required")
+	case req.MaxHops < 1 || req.MaxHops > MAX_TRACEROUTE_MAX_HOPS:
+		return fmt.Errorf("max_hops must be between 1 and %d", MAX_TRACEROUTE_MAX_HOPS)
+	case req.ProbesPerHop < 1 || req.ProbesPerHop > MAX_TRACEROUTE_PROBES:
+		return fmt.Errorf("probes_per_hop must be between 1 and %d", MAX_TRACEROUTE_PROBES)
+	case req.Protocol == TRACEROUTE_PROTOCOL_ICMP && req.ServerPort != 0:
+		return fmt.Errorf("server_port is not used with protocol icmp")
+	case req.ServerPort < 0 || req.ServerPort > 65535:
+		return fmt.Errorf("server_port must be between 1 and 65535")
+	case req.Protocol == TRACEROUTE_PROTOCOL_UDP && req.ServerPort+req.MaxHops*req.ProbesPerHop-1 > 65535:
+		return fmt.Errorf("server_port leaves no room for %d probes: UDP probes go to consecutive ports", req.MaxHops*req.ProbesPerHop)
+	}
+	return nil
+}
+
+// runTraceroute applies defaults to a decoded request, runs the traceroute and records the result.
+// Errors come with the HTTP status to report them with.
+func runTraceroute(req RunRequest, profile *Profile) (map[string]interface{}, int, error) {
+	if req.Protocol == "" {
+		req.Protocol = TRACEROUTE_PROTOCOL_UDP
+	}
+	if req.MaxHops == 0 {
+		req.MaxHops = DEFAULT_TRACEROUTE_MAX_HOPS
+	}
+	if req.ProbesPerHop == 0 {
+		req.ProbesPerHop = DEFAULT_TRACEROUTE_PROBES
+	}
+	if err := checkProfileLimits(req, profile); err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	err := validateTraceroute(&req)
+	if err == nil {
+		req.AddressFamily, err = parseAddressFamily(req.AddressFamily)
+	}
+	if err == nil && req.AddressFamily == nettest.FAMILY_COMPARE {
+		err = fmt.Errorf("address_family compare is not available for traceroute tests; run ipv4 and ipv6 separately")
+	}
+	if err == nil {
+		err = validateLockWait(&req)
+	}
+	if err == nil {
+		err = validateCallbackURL(req.CallbackURL)
+	}
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	switch {
+	case req.ServerPort != 0:
+	case req.Protocol == TRACEROUTE_PROTOCOL_UDP:
+		req.ServerPort = DEFAULT_UDP_PING_PORT
+	case req.Protocol == TRACEROUTE_PROTOCOL_TCP:
+		req.ServerPort = DEFAULT_TRACEROUTE_TCP_PORT
+	}
+
+	lock, release, status, err := lockTest(TEST_TYPE_TRACEROUTE, req, false)
+	if err != nil {
+		return nil, status, err
+	}
+	defer release()
+
+	logf(req.ctx, "Traceroute test: %s %s (max_hops=%d, probes_per_hop=%d, family=%s)",
+		req.Protocol, req.ServerHost, req.MaxHops, req.ProbesPerHop, req.AddressFamily)
+
+	started := time.Now()
+	req.progress.start("rtt_ms", 0)
+	report, err := tracerouteTest(req)
+	if err != nil {
+		return nil, http.StatusInternalServerError, fmt.Errorf("Traceroute test failed: %v", err)
+	}
+
+	data := map[string]interface{}{
+		"server":         req.ServerHost,
+		"protocol":       report.Protocol,
+		"socket":         report.Socket,
+		"family":         report.Family,
+		"address":        report.Address,
+		"max_hops":       report.MaxHops,
+		"probes_per_hop": report.ProbesPerHop,
+		"reached":        report.Reached,
+		"hop_count":      len(report.Hops),
+		"hops":           report.Hops,
+		"duration_sec":   time.Since(started).Seconds(),
+	}
+	if report.Reached {
+		// The last hop is the target
+		data["rtt_avg_ms"] = report.Hops[len(report.Hops)-1].RTTAvgMs
+	}
+	if report.Port != 0 {
+		data["port"] = report.Port
+	}
+	if report.FallbackReason != "" {
+		data["fallback_reason"] = report.FallbackReason
+	}
+	if profile != nil {
+		data["profile"] = profile.Name
+	}
+	data["lock"] = lock
+
+	recordResult(TEST_TYPE_TRACEROUTE, req, started, data)
+	notifyCallback(req.CallbackURL, data)
+
+	return data, http.StatusOK, nil
+}
+
+// tracerouteTest resolves the target and traces the path to it, reading ICMP
+// answers from a raw socket, or for UDP without privileges from the probe sockets
+func tracerouteTest(req RunRequest) (*TracerouteReport, error) {
+	dst, err := resolveUDP(req.ServerHost, req.ServerPort, req.AddressFamily)
+	if err != nil {
+		return nil, err
+	}
+	report := &TracerouteReport{
+		Protocol:     req.Protocol,
+		Socket:       PING_SOCKET_RAW,
+		Family:       nettest.IPFamily(dst.IP),
+		Address:      dst.IP.String(),
+		Port:         req.ServerPort,
+		MaxHops:      req.MaxHops,
+		ProbesPerHop: req.ProbesPerHop,
+	}
+
+	var prober traceProber
+	raw, err := openRawTracer(req.Protocol, dst.IP, req.ServerPort)
+	switch {
+	case err == nil:
+		prober = raw
+	case req.Protocol == TRACEROUTE_PROTOCOL_UDP:
+		logf(req.ctx, "Traceroute test: no raw ICMP socket, reading errors of the UDP probes: %v", err)
+		prober = newRecvErrTracer(dst.IP, req.ServerPort)
+		report.Socket, report.FallbackReason = TRACEROUTE_SOCKET_RECVERR, err.Error()
+	default:
+		return nil, fmt.Errorf("%v (%s traceroute needs root or CAP_NET_RAW; protocol udp works without on Linux)", err, req.Protocol)
+	}
+
+	hops, reached, err := traceHops(prober, req.MaxHops, req.ProbesPerHop, req.progress)
+	prober.close()
+	if err != nil {
+		return nil, err
+	}
+	if !req.NoDNS {
+		lookupHopNames(hops)
+	}
+	report.Hops, report.Reached = hops, reached
+	return report, nil
+}
@@ -0,0 +1,131 @@
+//go:build linux
+
+package api
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+
+	"network-test-api/pkg/nettest"
+)
+
+// enableRecvErr has the kernel queue ICMP errors about a UDP socket's datagrams,
+// with the address of the router that sent them, as tracepath reads them
+func enableRecvErr(conn *net.UDPConn) error {
+	return nettest.ControlSocket(conn, func(fd int, v6 bool) error {
+		if v6 {
+			return unix.SetsockoptInt(fd, unix.IPPROTO_IPV6, unix.IPV6_RECVERR, 1)
+		}
+		return unix.SetsockoptInt(fd, unix.IPPROTO_IP, unix.IP_RECVERR, 1)
+	})
+}
+
+// readRecvErr waits for a queued ICMP error or a reply on a UDP probe socket until
+// its read deadline, returning the probe status and who answered
+func readRecvErr(conn *net.UDPConn) (string, string, error) {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return "", "", err
+	}
+	buf := make([]byte, 512)
+	oob := make([]byte, 512)
+	var status, from string
+	var rerr error
+	err = raw.Read(func(fd uintptr) bool {
+		_, oobn, _, _, err := unix.Recvmsg(int(fd), buf, oob, unix.MSG_ERRQUEUE)
+		if err == nil {
+			status, from, rerr = parseRecvErr(oob[:oobn])
+			return true
+		}
+		// A service listening on the port replied
+		if _, _, err = unix.Recvfrom(int(fd), buf, unix.MSG_DONTWAIT); err == nil {
+			status, from = PING_STATUS_REPLY, conn.RemoteAddr().(*net.UDPAddr).IP.String()
+			return true
+		}
+		if err == unix.EAGAIN {
+			return false
+		}
+		rerr = err
+		return true
+	})
+	if err != nil {
+		return "", "", err
+	}
+	return status, from, rerr
+}
+
+// parseRecvErr decodes the sock_extended_err of an IP_RECVERR control message
+// and the offender address that follows it
+func parseRecvErr(oob []byte) (string, string, error) {
+	msgs, err := unix.ParseSocketControlMessage(oob)
+	if err != nil {
+		return "", "", err
+	}
+	for _, m := range msgs {
+		if !(m.Header.Level == unix.SOL_IP && m.Header.Type == unix.IP_RECVERR) &&
+			!(m.Header.Level == unix.SOL_IPV6 && m.Header.Type == unix.IPV6_RECVERR) {
+			continue
+		}
+		if len(m.Data) < 16 {
+			continue
+		}
+		origin, typ, code := m.Data[4], m.Data[5], m.Data[6]
+		if origin != unix.SO_EE_ORIGIN_ICMP && origin != unix.SO_EE_ORIGIN_ICMP6 {
+			return "", "", fmt.Errorf("local error: %v", syscall.Errno(binary.NativeEndian.Uint32(m.Data)))
+		}
+		status, ok := icmpStatus(typ, code, origin == unix.SO_EE_ORIGIN_ICMP6)
+		if !ok {
+			return "", "", fmt.Errorf("unexpected ICMP type %d", typ)
+		}
+		offender := m.Data[16:]
+		var from net.IP
+		switch {
+		case len(offender) >= 8 && binary.NativeEndian.Uint16(offender) == unix.AF_INET:
+			from = net.IP(offender[4:8])
+		case len(offender) >= 24 && binary.NativeEndian.Uint16(offender) == unix.AF_INET6:
+			from = net.IP(offender[8:24])
+		}
+		return status, from.String(), nil
+	}
+	return "", "", fmt.Errorf("no extended error")
+}
+
+// tcpProbeControl sets the TTL of a TCP probe socket and binds it before the
+// SYN goes out, reporting the local port ICMP errors quote
+func tcpProbeControl(ttl int, bound func(port int)) (func(network, address string, c syscall.RawConn) error, error) {
+	return func(network, address string, c syscall.RawConn) error {
+		var serr error
+		err := c.Control(func(fd uintptr) {
+			level, opt := unix.IPPROTO_IP, unix.IP_TTL
+			var addr unix.Sockaddr = &unix.SockaddrInet4{}
+			if network == "tcp6" {
+				level, opt = unix.IPPROTO_IPV6, unix.IPV6_UNICAST_HOPS
+				addr = &unix.SockaddrInet6{}
+			}
+			if serr = unix.SetsockoptInt(int(fd), level, opt, ttl); serr != nil {
+				return
+			}
+			if serr = unix.Bind(int(fd), addr); serr != nil {
+				return
+			}
+			var local unix.Sockaddr
+			if local, serr = unix.Getsockname(int(fd)); serr != nil {
+				return
+			}
+			switch sa := local.(type) {
+			case *unix.SockaddrInet4:
+				bound(sa.Port)
+			case *unix.SockaddrInet6:
+				bound(sa.Port)
+			}
+		})
+		if err != nil {
+			return err
+		}
+		return serr
+	}, nil
+}
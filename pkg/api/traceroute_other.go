@@ -0,0 +1,25 @@
+//go:build !linux
+
+package api
+
+import (
+	"errors"
+	"net"
+	"syscall"
+)
+
+// Reading ICMP errors on unprivileged sockets and binding TCP probes before they
+// connect are only done on Linux; elsewhere traceroute runs over raw ICMP sockets
+// with the UDP and ICMP protocols.
+
+func enableRecvErr(conn *net.UDPConn) error {
+	return errors.New("traceroute without a raw ICMP socket is only supported on Linux")
+}
+
+func readRecvErr(conn *net.UDPConn) (string, string, error) {
+	return "", "", errors.New("traceroute without a raw ICMP socket is only supported on Linux")
+}
+
+func tcpProbeControl(ttl int, bound func(port int)) (func(network, address string, c syscall.RawConn) error, error) {
+	return nil, errors.New("tcp traceroute is only supported on Linux")
+}
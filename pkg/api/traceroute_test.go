@@ -0,0 +1,88 @@
+package api
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+)
+
+func TestTraceHopSummarize(t *testing.T) {
+	h := &TraceHop{Probes: []PingProbe{
+		{Status: "ttl_exceeded", RTTMs: 4, From: "192.0.2.1"},
+		{Status: "ttl_exceeded", RTTMs: 6, From: "192.0.2.9"},
+		{Status: "ttl_exceeded", RTTMs: 8, From: "192.0.2.9"},
+		{Status: "timeout"},
+	}}
+	reached, unreachable := h.summarize()
+	if reached || unreachable {
+		t.Errorf("Expected a router hop, got reached %v, unreachable %v", reached, unreachable)
+	}
+	if h.Address != "192.0.2.9" {
+		t.Errorf("Expected the address answering most probes, got %q", h.Address)
+	}
+	if len(h.Addresses) != 2 {
+		t.Errorf("Expected both ECMP responders, got %v", h.Addresses)
+	}
+	if h.Received != 3 || h.LossPercent != 25 || h.RTTAvgMs != 6 {
+		t.Errorf("Expected 3 received, 25%% loss and 6 ms average, got %d, %v and %v", h.Received, h.LossPercent, h.RTTAvgMs)
+	}
+}
+
+func TestTraceHopEnds(t *testing.T) {
+	h := &TraceHop{Probes: []PingProbe{{Status: "port_unreachable", RTTMs: 10, From: "198.51.100.7"}, {Status: "timeout"}}}
+	if reached, _ := h.summarize(); !reached || h.Addresses != nil {
+		t.Errorf("Expected the target reached with a single address, got %v, %v", reached, h.Addresses)
+	}
+
+	h = &TraceHop{Probes: []PingProbe{{Status: "unreachable", RTTMs: 3, From: "192.0.2.1"}, {Status: "unreachable", RTTMs: 3, From: "192.0.2.1"}}}
+	if _, unreachable := h.summarize(); !unreachable {
+		t.Errorf("Expected a hop of unreachable errors to end the trace")
+	}
+
+	h = &TraceHop{Probes: []PingProbe{{Status: "timeout"}}}
+	if reached, unreachable := h.summarize(); reached || unreachable || h.Address != "" {
+		t.Errorf("Expected a silent hop to continue the trace, got %v, %v, %q", reached, unreachable, h.Address)
+	}
+}
+
+func TestParseICMPQuoteTransport(t *testing.T) {
+	// Time exceeded quoting a UDP probe from port 40000 to 33440
+	inner := make([]byte, 28)
+	inner[0], inner[9] = 0x45, 17
+	copy(inner[16:20], net.IPv4(198, 51, 100, 7).To4())
+	binary.BigEndian.PutUint16(inner[20:22], 40000)
+	binary.BigEndian.PutUint16(inner[22:24], 33440)
+	msg := append([]byte{11, 0, 0, 0, 0, 0, 0, 0}, inner...)
+
+	q, ok := parseICMPQuote(msg, false)
+	if !ok || q.status != "ttl_exceeded" || q.proto != 17 {
+		t.Fatalf("Expected a time exceeded quoting UDP, got %v %+v", ok, q)
+	}
+	if !q.dst.Equal(net.IPv4(198, 51, 100, 7)) {
+		t.Errorf("Expected destination 198.51.100.7, got %v", q.dst)
+	}
+	if port := binary.BigEndian.Uint16(q.header[2:4]); port != 33440 {
+		t.Errorf("Expected destination port 33440, got %d", port)
+	}
+
+	// Port unreachable from the target: code 3
+	msg[0], msg[1] = 3, 3
+	if q, _ := parseICMPQuote(msg, false); q.status != "port_unreachable" {
+		t.Errorf("Expected port_unreachable, got %q", q.status)
+	}
+	msg[1] = 1
+	if q, _ := parseICMPQuote(msg, false); q.status != "unreachable" {
+		t.Errorf("Expected unreachable for a host unreachable code, got %q", q.status)
+	}
+
+	// ICMPv6 destination unreachable, port unreachable code 4, quoting TCP
+	v6 := make([]byte, 8+48)
+	v6[0], v6[1] = 1, 4
+	v6[8+6] = 6
+	copy(v6[8+24:8+40], net.ParseIP("2001:db8::7"))
+	binary.BigEndian.PutUint16(v6[48:50], 51000)
+	q, ok = parseICMPQuote(v6, true)
+	if !ok || q.status != "port_unreachable" || q.proto != 6 || binary.BigEndian.Uint16(q.header[0:2]) != 51000 {
+		t.Errorf("Expected an ICMPv6 port unreachable quoting TCP from port 51000, got %v %+v", ok, q)
+	}
+}
@@ -0,0 +1,371 @@
+package api
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"network-test-api/pkg/nettest"
+)
+
+// Bulk file transfers over HTTP(S) and FTP, for servers that do not run iperf3
+const (
+	TRANSFER_DOWNLOAD = "download"
+	TRANSFER_UPLOAD   = "upload"
+
+	DEFAULT_TRANSFER_DURATION = 60 // Seconds the whole transfer may take
+	MAX_TRANSFER_DURATION     = 600
+	DEFAULT_UPLOAD_SIZE       = 10 << 20 // Bytes
+	MAX_TRANSFER_SIZE         = 10 << 30
+
+	TRANSFER_BUFFER_SIZE = 128 << 10
+)
+
+// TransferTimings are the phases of a transfer in milliseconds from its start
+type TransferTimings struct {
+	DialMs        float64 `json:"dial_ms"`                   // Name resolution and TCP connect
+	DNSMs         float64 `json:"dns_ms"`                    // Name resolution part of dial_ms
+	ConnectMs     float64 `json:"connect_ms"`                // TCP connect of the connection used
+	TLSMs         float64 `json:"tls_ms,omitempty"`          // HTTPS handshake
+	LoginMs       float64 `json:"login_ms,omitempty"`        // FTP greeting and login
+	DataConnectMs float64 `json:"data_connect_ms,omitempty"` // FTP passive data connection
+	RequestMs     float64 `json:"request_ms"`                // Writing the request, including an upload body
+	TTFBMs        float64 `json:"ttfb_ms"`                   // From the start to the first response byte
+	TransferMs    float64 `json:"transfer_ms"`               // The phase goodput is measured over
+	TotalMs       float64 `json:"total_ms"`
+}
+
+// TransferResult is the outcome of a file transfer test
+type TransferResult struct {
+	URL         string              `json:"url"` // Without password
+	Scheme      string              `json:"scheme"`
+	Direction   string              `json:"direction"`
+	Protocol    string              `json:"protocol"` // HTTP version, or FTP
+	StatusCode  int                 `json:"status_code"`
+	Bytes       int64               `json:"bytes"`
+	Truncated   bool                `json:"truncated"` // Download stopped at size before the end of the file
+	GoodputMbps float64             `json:"goodput_mbps"`
+	TLSVersion  string              `json:"tls_version,omitempty"`
+	TLS         *TLSReport          `json:"tls,omitempty"` // Certificate check (HTTPS only)
+	Timings     TransferTimings     `json:"timings"`
+	Dial        *nettest.DialReport `json:"dial"`
+
+	startedAt time.Time
+}
+
+// splitDial breaks dial_ms down into name resolution and the connect of the
+// attempt that won
+func (t *TransferTimings) splitDial(dial *nettest.DialReport) {
+	if dial != nil {
+		t.DNSMs, t.ConnectMs = dial.ResolveMs, dial.ConnectMs
+	}
+}
+
+// parseTransferURL checks the scheme of a transfer URL and fills in its default port
+func parseTransferURL(raw string) (*url.URL, int, error) {
+	u, err := url.Parse(raw)
+	if err != nil || u.Hostname() == "" {
+		return nil, 0, fmt.Errorf("url must be an absolute http, https or ftp URL")
+	}
+	defaultPort := map[string]int{"http": 80, "https": 443, "ftp": 21}[strings.ToLower(u.Scheme)]
+	if defaultPort == 0 {
+		return nil, 0, fmt.Errorf("unsupported url scheme %q (expected http, https or ftp)", u.Scheme)
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	port := defaultPort
+	if p := u.Port(); p != "" {
+		if port, err = strconv.Atoi(p); err != nil || port < 1 || port > 65535 {
+			return nil, 0, fmt.Errorf("invalid port %q in url", p)
+		}
+	}
+	return u, port, nil
+}
+
+// transferHost is the host a transfer request targets, for profile selection
+func transferHost(raw string) string {
+	if u, err := url.Parse(raw); err == nil {
+		return u.Hostname()
+	}
+	return ""
+}
+
+// validateTransfer checks and defaults the transfer fields of a request
+func validateTransfer(req *RunRequest) error {
+	switch req.Direction = strings.ToLower(req.Direction); req.Direction {
+	case "":
+		req.Direction = TRANSFER_DOWNLOAD
+	case TRANSFER_DOWNLOAD, TRANSFER_UPLOAD:
+	default:
+		return fmt.Errorf("invalid direction %q (expected download or upload)", req.Direction)
+	}
+	if req.Size == 0 && req.Direction == TRANSFER_UPLOAD {
+		req.Size = DEFAULT_UPLOAD_SIZE
+	}
+	if req.Method == "" {
+		req.Method = http.MethodPut
+	}
+	req.Method = strings.ToUpper(req.Method)
+	switch {
+	case req.Size < 0 || req.Size > MAX_TRANSFER_SIZE:
+		return fmt.Errorf("size must be between 0 and %d bytes", int64(MAX_TRANSFER_SIZE))
+	case req.Duration < 1 || req.Duration > MAX_TRANSFER_DURATION:
+		return fmt.Errorf("duration must be between 1 and %d seconds", MAX_TRANSFER_DURATION)
+	case req.Method != http.MethodPut && req.Method != http.MethodPost:
+		return fmt.Errorf("invalid method %q (expected PUT or POST)", req.Method)
+	case req.Series:
+		return fmt.Errorf("series is not available for transfer tests")
+	}
+	return nil
+}
+
+// payloadReader yields size bytes by cycling over a generated buffer
+type payloadReader struct {
+	buf       []byte
+	off       int
+	remaining int64
+}
+
+func newPayloadReader(entropy nettest.PayloadEntropy, size int64) *payloadReader {
+	buf := make([]byte, TRANSFER_BUFFER_SIZE)
+	nettest.NewPayloadGenerator(entropy).Fill(buf)
+	return &payloadReader{buf: buf, remaining: size}
+}
+
+func (r *payloadReader) Read(p []byte) (int, error) {
+	if r.remaining == 0 {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > r.remaining {
+		p = p[:r.remaining]
+	}
+	n := copy(p, r.buf[r.off:])
+	r.off = (r.off + n) % len(r.buf)
+	r.remaining -= int64(n)
+	return n, nil
+}
+
+func sinceMs(start, t time.Time) float64 {
+	if t.IsZero() {
+		return 0
+	}
+	return float64(t.Sub(start).Microseconds()) / 1000
+}
+
+// goodputMbps converts bytes moved in d to Mbit/s
+func goodputMbps(bytes int64, d time.Duration) float64 {
+	if d <= 0 {
+		return 0
+	}
+	return float64(bytes*8) / d.Seconds() / 1e6
+}
+
+// readBody drains up to limit bytes (0 for all), reporting whether more remained
+func readBody(r io.Reader, limit int64) (int64, bool, error) {
+	buf := nettest.AcquireBuffer(TRANSFER_BUFFER_SIZE)
+	defer nettest.ReleaseBuffer(buf)
+	if limit == 0 {
+		n, err := io.CopyBuffer(io.Discard, r, buf)
+		return n, false, err
+	}
+	n, err := io.CopyBuffer(io.Discard, io.LimitReader(r, limit), buf)
+	if err != nil || n < limit {
+		return n, false, err
+	}
+	more, _ := r.Read(buf[:1])
+	return n, more > 0, nil
+}
+
+// httpTransfer downloads or uploads a file with a single HTTP/1.1 request on a
+// fresh connection, timing each phase with httptrace
+func httpTransfer(ctx context.Context, u *url.URL, port int, req RunRequest, payload nettest.PayloadEntropy) (*TransferResult, error) {
+	result := &TransferResult{URL: u.Redacted(), Scheme: u.Scheme, Direction: req.Direction, startedAt: time.Now()}
+	start := result.startedAt
+	var dialDone, tlsStart, tlsDone, gotConn, wroteRequest, firstByte time.Time
+	deadline, _ := ctx.Deadline()
+	checker := newTLSChecker(req)
+
+	transport := &http.Transport{
+		Proxy: nil, // Measure the path to the server itself
+		// The transport dials without the request's deadline, so take the transfer's
+		DialContext: func(context.Context, string, string) (net.Conn, error) {
+			conn, dial, err := nettest.DialControl(u.Hostname(), port, req.AddressFamily, time.Until(deadline))
+			result.Dial, dialDone = dial, time.Now()
+			return conn, err
+		},
+		TLSClientConfig:    checker.config(u.Hostname()),
+		DisableKeepAlives:  true,
+		DisableCompression: true, // Count the bytes on the wire
+	}
+	defer transport.CloseIdleConnections()
+	client := &http.Client{
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse // A redirect would time a second connection
+		},
+	}
+
+	trace := &httptrace.ClientTrace{
+		TLSHandshakeStart:    func() { tlsStart = time.Now() },
+		TLSHandshakeDone:     func(tls.ConnectionState, error) { tlsDone = time.Now() },
+		GotConn:              func(httptrace.GotConnInfo) { gotConn = time.Now() },
+		WroteRequest:         func(httptrace.WroteRequestInfo) { wroteRequest = time.Now() },
+		GotFirstResponseByte: func() { firstByte = time.Now() },
+	}
+	method, body := http.MethodGet, io.Reader(nil)
+	if req.Direction == TRANSFER_UPLOAD {
+		method, body = req.Method, newPayloadReader(payload, req.Size)
+	}
+	httpReq, err := http.NewRequestWithContext(httptrace.WithClientTrace(ctx, trace), method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		httpReq.ContentLength = req.Size
+		httpReq.Header.Set("Content-Type", "application/octet-stream")
+	}
+	httpReq.Header.Set("User-Agent", "network-test-api/"+API_VERSION)
+
+	resp, err := client.Do(httpReq)
+	result.TLS = checker.Report()
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	result.Protocol = resp.Proto
+	result.StatusCode = resp.StatusCode
+	if resp.TLS != nil {
+		result.TLSVersion = tls.VersionName(resp.TLS.Version)
+	}
+	if resp.StatusCode >= 300 {
+		if loc := resp.Header.Get("Location"); loc != "" {
+			return nil, fmt.Errorf("server returned %s redirecting to %s; request that URL directly", resp.Status, loc)
+		}
+		return nil, fmt.Errorf("server returned %s", resp.Status)
+	}
+
+	var phaseStart, phaseEnd time.Time
+	if req.Direction == TRANSFER_UPLOAD {
+		// The server answers once it has the whole body, so the response bounds
+		// the upload rather than the local socket buffer draining
+		result.Bytes, phaseStart, phaseEnd = req.Size, gotConn, firstByte
+		if _, _, err := readBody(resp.Body, 0); err != nil {
+			return nil, fmt.Errorf("reading response: %w", err)
+		}
+	} else {
+		result.Bytes, result.Truncated, err = readBody(resp.Body, req.Size)
+		if err != nil {
+			return nil, fmt.Errorf("download failed after %d bytes: %w", result.Bytes, err)
+		}
+		phaseStart, phaseEnd = firstByte, time.Now()
+	}
+
+	t := &result.Timings
+	t.DialMs = sinceMs(start, dialDone)
+	t.splitDial(result.Dial)
+	if !tlsStart.IsZero() {
+		t.TLSMs = sinceMs(tlsStart, tlsDone)
+	}
+	t.RequestMs = sinceMs(gotConn, wroteRequest)
+	t.TTFBMs = sinceMs(start, firstByte)
+	t.TransferMs = sinceMs(phaseStart, phaseEnd)
+	t.TotalMs = sinceMs(start, time.Now())
+	result.GoodputMbps = goodputMbps(result.Bytes, phaseEnd.Sub(phaseStart))
+	return result, nil
+}
+
+// runTransfer applies defaults to a decoded request, runs the transfer and records the result.
+// Errors come with the HTTP status to report them with.
+func runTransfer(req RunRequest, profile *Profile) (map[string]interface{}, int, error) {
+	u, port, err := parseTransferURL(req.URL)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	req.ServerHost, req.ServerPort = u.Hostname(), port
+	if req.Duration == 0 {
+		req.Duration = DEFAULT_TRANSFER_DURATION
+	}
+	if err := checkProfileLimits(req, profile); err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	payload, err := nettest.ParsePayloadEntropy(req.Payload)
+	if err == nil {
+		err = validateTransfer(&req)
+	}
+	if err == nil {
+		err = validateRootStore(&req)
+	}
+	if err == nil {
+		req.AddressFamily, err = parseAddressFamily(req.AddressFamily)
+	}
+	if err == nil {
+		err = validateLockWait(&req)
+	}
+	if err == nil {
+		err = validateCallbackURL(req.CallbackURL)
+	}
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	lock, release, status, err := lockTest(TEST_TYPE_TRANSFER, req, true)
+	if err != nil {
+		return nil, status, err
+	}
+	defer release()
+
+	logf(req.ctx, "Transfer test: %s %s (size=%d, %ds limit, family=%s)", req.Direction, u.Redacted(), req.Size, req.Duration, req.AddressFamily)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(req.Duration)*time.Second)
+	defer cancel()
+	var result *TransferResult
+	if u.Scheme == "ftp" {
+		result, err = ftpTransfer(ctx, u, port, req, payload)
+	} else {
+		result, err = httpTransfer(ctx, u, port, req, payload)
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			err = fmt.Errorf("transfer did not finish within %ds: %v", req.Duration, err)
+		}
+		return nil, http.StatusInternalServerError, fmt.Errorf("Transfer failed: %v", err)
+	}
+
+	data := map[string]interface{}{
+		"server":       req.ServerHost,
+		"port":         req.ServerPort,
+		"url":          result.URL,
+		"scheme":       result.Scheme,
+		"direction":    result.Direction,
+		"protocol":     result.Protocol,
+		"status_code":  result.StatusCode,
+		"bytes":        result.Bytes,
+		"truncated":    result.Truncated,
+		"goodput_mbps": result.GoodputMbps,
+		"duration_sec": result.Timings.TotalMs / 1000,
+		"timings":      result.Timings,
+		"dial":         result.Dial,
+	}
+	if result.TLSVersion != "" {
+		data["tls_version"] = result.TLSVersion
+	}
+	if result.TLS != nil {
+		data["tls"] = result.TLS
+	}
+	if profile != nil {
+		data["profile"] = profile.Name
+	}
+	data["lock"] = lock
+
+	recordResult(TEST_TYPE_TRANSFER, req, result.startedAt, data)
+	notifyCallback(req.CallbackURL, data)
+
+	return data, http.StatusOK, nil
+}
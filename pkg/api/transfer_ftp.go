@@ -0,0 +1,189 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"network-test-api/pkg/nettest"
+)
+
+// ftpConn is the control connection of a minimal passive-mode FTP client (RFC 959, RFC 2428)
+type ftpConn struct {
+	text *textproto.Conn
+}
+
+// cmd sends a command and reads its reply, expecting a code in the class of expect (e.g. 2 for 2xx)
+func (c *ftpConn) cmd(expect int, format string, args ...interface{}) (int, string, error) {
+	if err := c.text.PrintfLine(format, args...); err != nil {
+		return 0, "", err
+	}
+	return c.text.ReadResponse(expect)
+}
+
+// login authenticates with the URL's credentials, anonymously without any
+func (c *ftpConn) login(u *url.URL) error {
+	user, pass := "anonymous", "anonymous@"
+	if u.User != nil {
+		user = u.User.Username()
+		if p, ok := u.User.Password(); ok {
+			pass = p
+		}
+	}
+	code, msg, err := c.cmd(0, "USER %s", user)
+	if err != nil {
+		return fmt.Errorf("USER: %w", err)
+	}
+	if code == 331 {
+		code, msg, err = c.cmd(0, "PASS %s", pass)
+		if err != nil {
+			return fmt.Errorf("PASS: %w", err)
+		}
+	}
+	if code != 230 {
+		return fmt.Errorf("login failed: %d %s", code, msg)
+	}
+	if _, _, err := c.cmd(2, "TYPE I"); err != nil {
+		return fmt.Errorf("TYPE I: %w", err)
+	}
+	return nil
+}
+
+// passivePort asks for a passive data port with EPSV, falling back to PASV.
+// The data connection always goes to the control connection's address, so a
+// server behind NAT announcing its private address still works.
+func (c *ftpConn) passivePort() (int, error) {
+	if _, msg, err := c.cmd(2, "EPSV"); err == nil {
+		// 229 Entering Extended Passive Mode (|||port|)
+		if open, end := strings.Index(msg, "(|||"), strings.LastIndex(msg, "|)"); open >= 0 && end > open+4 {
+			return strconv.Atoi(msg[open+4 : end])
+		}
+		return 0, fmt.Errorf("malformed EPSV reply %q", msg)
+	}
+	_, msg, err := c.cmd(2, "PASV")
+	if err != nil {
+		return 0, fmt.Errorf("PASV: %w", err)
+	}
+	// 227 Entering Passive Mode (h1,h2,h3,h4,p1,p2)
+	open, end := strings.Index(msg, "("), strings.LastIndex(msg, ")")
+	if open < 0 || end < open {
+		return 0, fmt.Errorf("malformed PASV reply %q", msg)
+	}
+	fields := strings.Split(msg[open+1:end], ",")
+	if len(fields) != 6 {
+		return 0, fmt.Errorf("malformed PASV reply %q", msg)
+	}
+	p1, err1 := strconv.Atoi(strings.TrimSpace(fields[4]))
+	p2, err2 := strconv.Atoi(strings.TrimSpace(fields[5]))
+	if err1 != nil || err2 != nil {
+		return 0, fmt.Errorf("malformed PASV reply %q", msg)
+	}
+	return p1<<8 | p2, nil
+}
+
+// ftpTransfer retrieves or stores the URL's path over a passive data connection
+func ftpTransfer(ctx context.Context, u *url.URL, port int, req RunRequest, payload nettest.PayloadEntropy) (*TransferResult, error) {
+	result := &TransferResult{URL: u.Redacted(), Scheme: u.Scheme, Direction: req.Direction, Protocol: "FTP", startedAt: time.Now()}
+	start := result.startedAt
+	deadline, _ := ctx.Deadline()
+	path := strings.TrimPrefix(u.Path, "/")
+	if path == "" {
+		return nil, fmt.Errorf("url has no file path")
+	}
+
+	conn, dial, err := nettest.DialControl(u.Hostname(), port, req.AddressFamily, time.Until(deadline))
+	result.Dial = dial
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = conn.Close() }()
+	_ = conn.SetDeadline(deadline)
+	dialDone := time.Now()
+
+	c := &ftpConn{text: textproto.NewConn(conn)}
+	if _, _, err := c.text.ReadResponse(2); err != nil {
+		return nil, fmt.Errorf("greeting: %w", err)
+	}
+	if err := c.login(u); err != nil {
+		return nil, err
+	}
+	loggedIn := time.Now()
+
+	dataPort, err := c.passivePort()
+	if err != nil {
+		return nil, err
+	}
+	host, _, _ := net.SplitHostPort(conn.RemoteAddr().String())
+	var dialer net.Dialer
+	data, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(host, strconv.Itoa(dataPort)))
+	if err != nil {
+		return nil, fmt.Errorf("data connection: %w", err)
+	}
+	defer func() { _ = data.Close() }()
+	_ = data.SetDeadline(deadline)
+	dataConnected := time.Now()
+
+	verb := "RETR"
+	if req.Direction == TRANSFER_UPLOAD {
+		verb = "STOR"
+	}
+	if _, _, err := c.cmd(1, "%s %s", verb, path); err != nil {
+		return nil, fmt.Errorf("%s: %w", verb, err)
+	}
+	requested := time.Now()
+
+	var firstByte, phaseEnd time.Time
+	if req.Direction == TRANSFER_UPLOAD {
+		firstByte = requested
+		result.Bytes, err = io.CopyBuffer(data, newPayloadReader(payload, req.Size), make([]byte, TRANSFER_BUFFER_SIZE))
+		if err == nil {
+			err = data.Close() // End of file for the server
+		}
+	} else {
+		r := bufio.NewReaderSize(data, TRANSFER_BUFFER_SIZE)
+		if _, err = r.Peek(1); err == nil {
+			firstByte = time.Now()
+			result.Bytes, result.Truncated, err = readBody(r, req.Size)
+		} else if err == io.EOF {
+			firstByte, err = time.Now(), nil // Empty file
+		}
+		_ = data.Close()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s failed after %d bytes: %w", verb, result.Bytes, err)
+	}
+	phaseEnd = time.Now()
+
+	// 226 after a complete transfer; a truncated download draws 426 or 451 instead
+	code, msg, err := c.text.ReadResponse(0)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", verb, err)
+	}
+	if code/100 != 2 && !result.Truncated {
+		return nil, fmt.Errorf("%s failed: %d %s", verb, code, msg)
+	}
+	if req.Direction == TRANSFER_UPLOAD {
+		phaseEnd = time.Now() // Bytes are only safe once the server confirms them
+	}
+	result.StatusCode = code
+	_, _, _ = c.cmd(0, "QUIT")
+
+	t := &result.Timings
+	t.DialMs = sinceMs(start, dialDone)
+	t.splitDial(result.Dial)
+	t.LoginMs = sinceMs(dialDone, loggedIn)
+	t.DataConnectMs = sinceMs(loggedIn, dataConnected)
+	t.RequestMs = sinceMs(dataConnected, requested)
+	t.TTFBMs = sinceMs(start, firstByte)
+	t.TransferMs = sinceMs(firstByte, phaseEnd)
+	t.TotalMs = sinceMs(start, time.Now())
+	result.GoodputMbps = goodputMbps(result.Bytes, phaseEnd.Sub(firstByte))
+	return result, nil
+}
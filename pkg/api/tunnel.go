@@ -0,0 +1,468 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"network-test-api/pkg/nettest"
+)
+
+// Overlay tunnels iperf3 and TWAMP tests can run through, configured in TUNNELS_FILE.
+// The agent either builds the tunnel for the test or uses an existing interface.
+const (
+	TUNNEL_TYPE_VXLAN  = "vxlan"
+	TUNNEL_TYPE_GENEVE = "geneve"
+	TUNNEL_TYPE_GRE    = "gre"
+
+	DEFAULT_VXLAN_PORT  = 4789
+	DEFAULT_GENEVE_PORT = 6081
+	MAX_TUNNEL_VNI      = 1<<24 - 1
+	MIN_TUNNEL_MTU      = 576
+	TUNNEL_IFNAME_MAX   = 15 // IFNAMSIZ without the terminator
+	TUNNEL_IFNAME_PREF  = "nt-"
+
+	IP_CMD_TIMEOUT = 5 * time.Second
+)
+
+// Tunnel is a TUNNELS_FILE entry
+type Tunnel struct {
+	Type      string `json:"type"`      // vxlan, geneve or gre to build; empty to use interface as it is
+	Interface string `json:"interface"` // Existing tunnel, or the name of the built one (default: nt-<name>)
+	Remote    string `json:"remote"`    // Outer destination address
+	Local     string `json:"local"`     // Outer source address (default: the route's)
+	VNI       int    `json:"vni"`       // VXLAN/Geneve network identifier
+	Key       uint32 `json:"key"`       // GRE key (0: none)
+	Port      int    `json:"port"`      // VXLAN/Geneve UDP port (default: 4789 / 6081)
+	Address   string `json:"address"`   // Inner address with prefix length, e.g. 10.99.0.1/30
+	MTU       int    `json:"mtu"`       // Inner MTU (default: the kernel's for the type)
+}
+
+// TunnelReport describes the tunnel a test ran through and what the encapsulation cost
+type TunnelReport struct {
+	Name          string `json:"name"`
+	Type          string `json:"type"` // Kernel link kind
+	Interface     string `json:"interface"`
+	Created       bool   `json:"created"` // Built by the agent for the test
+	Remote        string `json:"remote,omitempty"`
+	MTU           int    `json:"mtu"`
+	OverheadBytes int    `json:"overhead_bytes"` // Outer headers added to every inner packet
+
+	InnerPacketBytes  int     `json:"inner_packet_bytes,omitempty"` // Full-sized test packet inside the tunnel
+	OuterPacketBytes  int     `json:"outer_packet_bytes,omitempty"` // The same packet on the underlay
+	PayloadMbps       float64 `json:"payload_mbps,omitempty"`       // What the test measured
+	InnerMbps         float64 `json:"inner_mbps,omitempty"`         // With inner IP and transport headers
+	OuterMbps         float64 `json:"outer_mbps,omitempty"`         // With the encapsulation, as the underlay carries it
+	EfficiencyPercent float64 `json:"efficiency_percent,omitempty"` // Payload share of the outer bytes
+
+	key uint32
+}
+
+// tunnelOverhead is the outer header size a link kind adds to each packet
+func tunnelOverhead(kind string, outerIPv6 bool, key uint32) (int, bool) {
+	ip := 20
+	if outerIPv6 {
+		ip = 40
+	}
+	gre := 4
+	if key != 0 {
+		gre += 4
+	}
+	switch kind {
+	case "vxlan", "geneve": // UDP, 8 byte header, inner Ethernet frame (Geneve without options)
+		return ip + 8 + 8 + 14, true
+	case "gretap", "ip6gretap":
+		return ip + gre + 14, true
+	case "gre", "ip6gre":
+		return ip + gre, true
+	case "ipip", "sit", "ip6tnl":
+		return ip, true
+	case "wireguard": // UDP, message header and authentication tag
+		return ip + 8 + 16 + 16, true
+	}
+	return 0, false
+}
+
+// account fills in the throughput of payloadMbps carried in packets of payloadBytes
+// behind headerBytes of inner IP and transport headers
+func (t *TunnelReport) account(payloadMbps float64, payloadBytes, headerBytes int) {
+	if payloadBytes <= 0 {
+		return
+	}
+	t.InnerPacketBytes = payloadBytes + headerBytes
+	t.OuterPacketBytes = t.InnerPacketBytes + t.OverheadBytes
+	t.PayloadMbps = payloadMbps
+	t.InnerMbps = payloadMbps * float64(t.InnerPacketBytes) / float64(payloadBytes)
+	t.OuterMbps = payloadMbps * float64(t.OuterPacketBytes) / float64(payloadBytes)
+	t.EfficiencyPercent = 100 * float64(payloadBytes) / float64(t.OuterPacketBytes)
+}
+
+// innerIPHeader is the IP header size of the inner family
+func innerIPHeader(family string) int {
+	if family == nettest.FAMILY_IPV6 {
+		return 40
+	}
+	return 20
+}
+
+// iperf3 accounts an iperf3 result: full-sized TCP segments with timestamps, or the UDP datagrams sent
+func (t *TunnelReport) iperf3(result *nettest.Iperf3Result) *TunnelReport {
+	family := nettest.FAMILY_IPV4
+	if result.Dial != nil {
+		family = result.Dial.Family
+	}
+	if strings.ToUpper(result.Protocol) == "UDP" {
+		datagram := 0
+		if result.MTU != nil {
+			datagram = result.MTU.DatagramBytes
+			if result.MTU.ClampedBytes > 0 {
+				datagram = result.MTU.ClampedBytes
+			}
+		}
+		return t.udp(result.BandwidthMbps, family, datagram)
+	}
+	headers := innerIPHeader(family) + 32
+	t.account(result.BandwidthMbps, t.MTU-headers, headers)
+	return t
+}
+
+// udp accounts UDP datagrams of the given size (0: the iperf3 default), capped at what fits the tunnel
+func (t *TunnelReport) udp(mbps float64, family string, datagram int) *TunnelReport {
+	if datagram == 0 {
+		datagram = nettest.DEFAULT_UDP_BLKSIZE
+	}
+	headers := innerIPHeader(family) + 8
+	if t.MTU > 0 && datagram > t.MTU-headers {
+		datagram = t.MTU - headers
+	}
+	t.account(mbps, datagram, headers)
+	return t
+}
+
+// twamp accounts TWAMP test packets of the given padding, sent at ratePps (0 if not rate-based)
+func (t *TunnelReport) twamp(family string, padding int, ratePps float64) *TunnelReport {
+	payload := 14 + padding // Unauthenticated sender packet
+	t.account(ratePps*float64(payload)*8/1e6, payload, innerIPHeader(family)+8)
+	if ratePps == 0 {
+		t.PayloadMbps, t.InnerMbps, t.OuterMbps = 0, 0, 0
+	}
+	return t
+}
+
+// TunnelStore holds the configured tunnels and counts the tests using each, so a
+// tunnel the agent built is removed when the last of them ends
+type TunnelStore struct {
+	mu      sync.Mutex
+	Tunnels map[string]*Tunnel `json:"tunnels"`
+	users   map[string]int
+}
+
+var tunnelStore = &TunnelStore{Tunnels: map[string]*Tunnel{}, users: map[string]int{}}
+
+// loadTunnels reads a tunnels file of the form {"tunnels": {"name": {...}}}
+func loadTunnels(file string) (*TunnelStore, error) {
+	raw, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	store := &TunnelStore{}
+	if err := json.Unmarshal(raw, store); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", file, err)
+	}
+	if store.Tunnels == nil {
+		store.Tunnels = map[string]*Tunnel{}
+	}
+	store.users = map[string]int{}
+	for name, t := range store.Tunnels {
+		if err := t.validate(name); err != nil {
+			return nil, fmt.Errorf("tunnel %s: %w", name, err)
+		}
+	}
+	return store, nil
+}
+
+// validate checks a tunnel entry, defaulting the name and port of built tunnels
+func (t *Tunnel) validate(name string) error {
+	t.Type = strings.ToLower(t.Type)
+	if t.Type == "" {
+		if t.Interface == "" {
+			return fmt.Errorf("type or interface is required")
+		}
+		return nil
+	}
+	if t.Interface == "" {
+		t.Interface = TUNNEL_IFNAME_PREF + name
+	}
+	switch {
+	case len(t.Interface) > TUNNEL_IFNAME_MAX:
+		return fmt.Errorf("interface name %q is longer than %d characters", t.Interface, TUNNEL_IFNAME_MAX)
+	case net.ParseIP(t.Remote) == nil:
+		return fmt.Errorf("remote must be an IP address")
+	case t.Local != "" && net.ParseIP(t.Local) == nil:
+		return fmt.Errorf("local must be an IP address")
+	case t.MTU != 0 && (t.MTU < MIN_TUNNEL_MTU || t.MTU > MAX_PMTU_SIZE):
+		return fmt.Errorf("mtu must be between %d and %d", MIN_TUNNEL_MTU, MAX_PMTU_SIZE)
+	}
+	if _, _, err := net.ParseCIDR(t.Address); err != nil {
+		return fmt.Errorf("address must be an inner address with prefix length: %v", err)
+	}
+	switch t.Type {
+	case TUNNEL_TYPE_VXLAN, TUNNEL_TYPE_GENEVE:
+		if t.VNI < 1 || t.VNI > MAX_TUNNEL_VNI {
+			return fmt.Errorf("vni must be between 1 and %d", MAX_TUNNEL_VNI)
+		}
+		if t.Port == 0 {
+			t.Port = DEFAULT_VXLAN_PORT
+			if t.Type == TUNNEL_TYPE_GENEVE {
+				t.Port = DEFAULT_GENEVE_PORT
+			}
+		}
+	case TUNNEL_TYPE_GRE:
+	default:
+		return fmt.Errorf("invalid type %q (expected %s, %s or %s)", t.Type, TUNNEL_TYPE_VXLAN, TUNNEL_TYPE_GENEVE, TUNNEL_TYPE_GRE)
+	}
+	return nil
+}
+
+// linkArgs builds the ip arguments creating the tunnel interface
+func (t *Tunnel) linkArgs() []string {
+	outerIPv6 := net.ParseIP(t.Remote).To4() == nil
+	kind := t.Type
+	if kind == TUNNEL_TYPE_GRE && outerIPv6 {
+		kind = "ip6gre"
+	}
+	args := []string{"link", "add", t.Interface, "type", kind}
+	switch t.Type {
+	case TUNNEL_TYPE_VXLAN, TUNNEL_TYPE_GENEVE:
+		args = append(args, "id", strconv.Itoa(t.VNI), "remote", t.Remote, "dstport", strconv.Itoa(t.Port))
+	case TUNNEL_TYPE_GRE:
+		args = append(args, "remote", t.Remote)
+		if t.Key != 0 {
+			args = append(args, "key", strconv.FormatUint(uint64(t.Key), 10))
+		}
+	}
+	if t.Local != "" && t.Type != TUNNEL_TYPE_GENEVE { // Geneve takes no local address
+		args = append(args, "local", t.Local)
+	}
+	return args
+}
+
+// runIP executes ip with a hard timeout, returning its output
+func runIP(args ...string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), IP_CMD_TIMEOUT)
+	defer cancel()
+
+	out, err := exec.CommandContext(ctx, "ip", args...).CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("ip %s: %v: %s", strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+	return out, nil
+}
+
+// linkInfo is the part of "ip -d -j link show" describing a tunnel
+type linkInfo struct {
+	MTU      int `json:"mtu"`
+	LinkInfo struct {
+		Kind string `json:"info_kind"`
+		Data struct {
+			Remote string `json:"remote"`
+			OKey   string `json:"okey"`
+		} `json:"info_data"`
+	} `json:"linkinfo"`
+}
+
+// inspectLink reads kind, remote and GRE key of an existing interface
+func inspectLink(dev string) (*TunnelReport, error) {
+	out, err := runIP("-d", "-j", "link", "show", "dev", dev)
+	if err != nil {
+		return nil, err
+	}
+	var links []linkInfo
+	if err := json.Unmarshal(out, &links); err != nil || len(links) != 1 {
+		return nil, fmt.Errorf("unexpected ip link output for %s", dev)
+	}
+	link := links[0]
+	report := &TunnelReport{Type: link.LinkInfo.Kind, Interface: dev, Remote: link.LinkInfo.Data.Remote, MTU: link.MTU}
+	if key := net.ParseIP(link.LinkInfo.Data.OKey).To4(); key != nil {
+		report.key = uint32(key[0])<<24 | uint32(key[1])<<16 | uint32(key[2])<<8 | uint32(key[3])
+	}
+	return report, nil
+}
+
+// Acquire brings up the named tunnel for a test, building it if this is the first
+// test to use it, and returns its report and the function releasing it
+func (s *TunnelStore) Acquire(name string) (*TunnelReport, func(), error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t := s.Tunnels[name]
+	if t == nil {
+		return nil, nil, fmt.Errorf("unknown tunnel %q (see TUNNELS_FILE)", name)
+	}
+	if t.Type != "" && s.users[name] == 0 {
+		if err := t.create(); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	report, err := inspectLink(t.Interface)
+	if err == nil {
+		overhead, ok := tunnelOverhead(report.Type, net.ParseIP(report.Remote).To4() == nil && report.Remote != "", report.key)
+		if !ok {
+			err = fmt.Errorf("interface %s is a %q link, not a supported tunnel", t.Interface, report.Type)
+		}
+		report.OverheadBytes = overhead
+	}
+	if err != nil {
+		if t.Type != "" && s.users[name] == 0 {
+			t.remove()
+		}
+		return nil, nil, err
+	}
+	report.Name = name
+	report.Created = t.Type != ""
+	s.users[name]++
+
+	var once sync.Once
+	release := func() {
+		once.Do(func() {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			if s.users[name]--; s.users[name] == 0 && t.Type != "" {
+				t.remove()
+			}
+		})
+	}
+	return report, release, nil
+}
+
+// create builds the tunnel interface, addresses it and brings it up
+func (t *Tunnel) create() error {
+	if _, err := net.InterfaceByName(t.Interface); err == nil {
+		return fmt.Errorf("interface %s already exists; remove it or set a different interface name", t.Interface)
+	}
+	steps := [][]string{t.linkArgs(), {"addr", "add", t.Address, "dev", t.Interface}}
+	up := []string{"link", "set", t.Interface, "up"}
+	if t.MTU > 0 {
+		up = append(up, "mtu", strconv.Itoa(t.MTU))
+	}
+	for i, args := range append(steps, up) {
+		if _, err := runIP(args...); err != nil {
+			if i > 0 {
+				t.remove()
+			}
+			return err
+		}
+	}
+	log.Printf("Tunnel %s created: ip %s", t.Interface, strings.Join(t.linkArgs(), " "))
+	return nil
+}
+
+func (t *Tunnel) remove() {
+	if _, err := runIP("link", "del", t.Interface); err != nil {
+		log.Printf("Removing tunnel %s failed: %v", t.Interface, err)
+		return
+	}
+	log.Printf("Tunnel %s removed", t.Interface)
+}
+
+// Names lists the configured tunnels
+func (s *TunnelStore) Names() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	names := make([]string, 0, len(s.Tunnels))
+	for name := range s.Tunnels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// configureTunnels loads TUNNELS_FILE, if set
+func configureTunnels() {
+	file := os.Getenv("TUNNELS_FILE")
+	if file == "" {
+		return
+	}
+	store, err := loadTunnels(file)
+	if err != nil {
+		log.Fatalf("Loading tunnels failed: %v", err)
+	}
+	tunnelStore = store
+	log.Printf("Loaded %d tunnels from %s", len(store.Tunnels), file)
+}
+
+// validateTunnel checks that a request's tunnel is configured
+func validateTunnel(req RunRequest) error {
+	switch {
+	case req.Tunnel == "":
+		return nil
+	case req.DualStack != "":
+		return fmt.Errorf("tunnel is not available with dual_stack")
+	}
+	for _, name := range tunnelStore.Names() {
+		if name == req.Tunnel {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown tunnel %q (see TUNNELS_FILE)", req.Tunnel)
+}
+
+// openTunnel acquires the request's tunnel and checks that every address of
+// server_host is routed through it, so the test traffic is encapsulated.
+// Errors come with the HTTP status to report them with.
+func openTunnel(req RunRequest, family string) (*TunnelReport, func(), int, error) {
+	tunnel, release, err := tunnelStore.Acquire(req.Tunnel)
+	if err != nil {
+		return nil, nil, http.StatusInternalServerError, fmt.Errorf("Tunnel failed: %v", err)
+	}
+	if err := checkTunnelRoute(tunnel.Interface, req.ServerHost, family); err != nil {
+		release()
+		return nil, nil, http.StatusBadRequest, err
+	}
+	return tunnel, release, http.StatusOK, nil
+}
+
+// checkTunnelRoute compares the source address the kernel picks for each address
+// of host with those of the tunnel interface
+func checkTunnelRoute(dev, host, family string) error {
+	iface, err := net.InterfaceByName(dev)
+	if err != nil {
+		return err
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if family == nettest.FAMILY_COMPARE {
+		family = nettest.FAMILY_AUTO
+	}
+	v6, v4, err := nettest.ResolveFamilies(ctx, host, family)
+	if err != nil {
+		return err
+	}
+	for _, ip := range nettest.InterleaveFamilies(v6, v4) {
+		src, _ := localRoute("udp", net.JoinHostPort(ip.String(), "9"))
+		routed := false
+		for _, a := range addrs {
+			if n, ok := a.(*net.IPNet); ok && src != nil && n.IP.Equal(src) {
+				routed = true
+			}
+		}
+		if !routed {
+			return fmt.Errorf("%s is not routed through tunnel interface %s (source address %v); use the far end's inner address as server_host", ip, dev, src)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package api
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestTunnelOverhead(t *testing.T) {
+	tests := []struct {
+		kind      string
+		outerIPv6 bool
+		key       uint32
+		want      int
+	}{
+		{"vxlan", false, 0, 50},
+		{"vxlan", true, 0, 70},
+		{"geneve", false, 0, 50},
+		{"gre", false, 0, 24},
+		{"gre", false, 42, 28},
+		{"ip6gre", true, 0, 44},
+		{"gretap", false, 0, 38},
+		{"ipip", false, 0, 20},
+		{"wireguard", false, 0, 60},
+		{"wireguard", true, 0, 80},
+	}
+	for _, tt := range tests {
+		got, ok := tunnelOverhead(tt.kind, tt.outerIPv6, tt.key)
+		if !ok || got != tt.want {
+			t.Errorf("Expected %d bytes for %s (ipv6=%v, key=%d), got %d", tt.want, tt.kind, tt.outerIPv6, tt.key, got)
+		}
+	}
+	if _, ok := tunnelOverhead("veth", false, 0); ok {
+		t.Errorf("Expected veth to be rejected as a tunnel")
+	}
+}
+
+func TestTunnelAccount(t *testing.T) {
+	// TCP through VXLAN at a 1450 byte inner MTU: 1398 bytes of payload per segment
+	report := &TunnelReport{OverheadBytes: 50}
+	report.account(1398, 1450-52, 52)
+	if report.InnerPacketBytes != 1450 || report.OuterPacketBytes != 1500 {
+		t.Errorf("Expected 1450/1500 byte packets, got %d/%d", report.InnerPacketBytes, report.OuterPacketBytes)
+	}
+	if math.Abs(report.InnerMbps-1450) > 1e-9 || math.Abs(report.OuterMbps-1500) > 1e-9 {
+		t.Errorf("Expected 1450/1500 Mbit/s, got %.3f/%.3f", report.InnerMbps, report.OuterMbps)
+	}
+	if math.Abs(report.EfficiencyPercent-93.2) > 1e-9 {
+		t.Errorf("Expected 93.2%% efficiency, got %.3f", report.EfficiencyPercent)
+	}
+
+	// No payload leaves the report empty instead of dividing by zero
+	empty := &TunnelReport{OverheadBytes: 50}
+	empty.account(100, 0, 28)
+	if empty.OuterPacketBytes != 0 || empty.OuterMbps != 0 {
+		t.Errorf("Expected no accounting without payload, got %+v", empty)
+	}
+}
+
+func TestTunnelLinkArgs(t *testing.T) {
+	tests := []struct {
+		tunnel Tunnel
+		want   string
+	}{
+		{Tunnel{Type: TUNNEL_TYPE_VXLAN, Interface: "nt-fab", Remote: "192.0.2.10", VNI: 5001, Port: 4789, Local: "192.0.2.1"},
+			"link add nt-fab type vxlan id 5001 remote 192.0.2.10 dstport 4789 local 192.0.2.1"},
+		{Tunnel{Type: TUNNEL_TYPE_GENEVE, Interface: "nt-gen", Remote: "192.0.2.10", VNI: 7, Port: 6081, Local: "192.0.2.1"},
+			"link add nt-gen type geneve id 7 remote 192.0.2.10 dstport 6081"},
+		{Tunnel{Type: TUNNEL_TYPE_GRE, Interface: "nt-gre", Remote: "198.51.100.7", Key: 42},
+			"link add nt-gre type gre remote 198.51.100.7 key 42"},
+		{Tunnel{Type: TUNNEL_TYPE_GRE, Interface: "nt-gre6", Remote: "2001:db8::7"},
+			"link add nt-gre6 type ip6gre remote 2001:db8::7"},
+	}
+	for _, tt := range tests {
+		if got := strings.Join(tt.tunnel.linkArgs(), " "); got != tt.want {
+			t.Errorf("Expected %q, got %q", tt.want, got)
+		}
+	}
+}
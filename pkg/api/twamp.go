@@ -0,0 +1,633 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/tcaine/twamp"
+
+	"network-test-api/pkg/nettest"
+	"network-test-api/pkg/twampstats"
+)
+
+// runTwamp applies defaults to a decoded request, runs the test and records the result.
+// Errors come with the HTTP status to report them with.
+func runTwamp(req RunRequest, profile *Profile) (map[string]interface{}, int, error) {
+	// Defaults
+	if req.ServerPort == 0 {
+		req.ServerPort = 862
+	}
+	mode, err := parseTwampMode(req.Mode)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	if err := validateTunnel(req); err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	if mode == TWAMP_MODE_SWEEP {
+		return runPaddingSweep(req, profile)
+	}
+	if req.DualStack != "" {
+		return runDualStack(TEST_TYPE_TWAMP, runTwamp, req, profile, mode == TWAMP_MODE_FULL)
+	}
+	if req.Count == 0 {
+		req.Count = DEFAULT_FULL_MODE_COUNT
+		switch mode {
+		case TWAMP_MODE_LOSS:
+			req.Count = DEFAULT_LOSS_MODE_COUNT
+		case TWAMP_MODE_CAPACITY:
+			req.Count = DEFAULT_CAPACITY_TRAINS
+		case TWAMP_MODE_AVAILABLE:
+			req.Count = DEFAULT_AVAILABLE_STREAMS
+		}
+	}
+	if req.Rate == 0 && mode == TWAMP_MODE_LOSS {
+		req.Rate = DEFAULT_LOSS_MODE_RATE
+	}
+	if mode == TWAMP_MODE_CAPACITY || mode == TWAMP_MODE_AVAILABLE {
+		if req.TrainLength == 0 {
+			req.TrainLength = DEFAULT_TRAIN_LENGTH
+			if mode == TWAMP_MODE_AVAILABLE {
+				req.TrainLength = DEFAULT_STREAM_LENGTH
+			}
+		}
+		if req.Padding == 0 {
+			req.Padding = DEFAULT_CAPACITY_PADDING
+		}
+	}
+	// Streams never exceed the profile's bandwidth limit
+	if mode == TWAMP_MODE_AVAILABLE && req.Bandwidth.Mbps == 0 && profile != nil && profile.Limits.MaxBandwidth > 0 {
+		req.Bandwidth = mbps(profile.Limits.MaxBandwidth)
+	}
+	if err := checkProfileLimits(req, profile); err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	// Note: padding defaults to 0 outside capacity mode, which matches server's 41-byte response
+	seriesOpts, err := parseSeriesOptions(req.Series, req.SeriesMaxPoints, req.SeriesDownsample)
+	if err == nil {
+		req.AddressFamily, err = parseAddressFamily(req.AddressFamily)
+	}
+	var bind *nettest.SourceBinding
+	if err == nil {
+		bind, req.AddressFamily, err = nettest.ParseSourceBindingIn(req.Netns, req.SourceAddress, req.Interface, req.AddressFamily)
+	}
+	applyTOS(&req)
+	if err == nil && mode == TWAMP_MODE_LOSS {
+		err = validateLossMode(req)
+	}
+	if err == nil && mode == TWAMP_MODE_CAPACITY {
+		err = validateCapacityMode(req)
+	}
+	if err == nil && mode == TWAMP_MODE_AVAILABLE {
+		err = validateAvailableMode(req)
+	}
+	if err == nil {
+		err = validateHistogramBucket(req, mode)
+	}
+	if err == nil {
+		err = validateIncludeRaw(req, mode)
+	}
+	if err == nil {
+		err = validateTwampLight(req, mode)
+	}
+	if err == nil {
+		err = validateTwampSessions(req, mode)
+	}
+	if err == nil {
+		err = validateLockWait(&req)
+	}
+	if err == nil {
+		err = validateCallbackURL(req.CallbackURL)
+	}
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	releaseSlot, status, err := acquireTestSlot(TEST_TYPE_TWAMP, req)
+	if err != nil {
+		return nil, status, err
+	}
+	defer releaseSlot()
+
+	// Loss mode is rate-heavy; full mode probes once a second and the capacity
+	// and available modes send short trains, so they only wait for their target
+	lock, release, status, err := lockTest(TEST_TYPE_TWAMP, req, mode == TWAMP_MODE_LOSS)
+	if err != nil {
+		return nil, status, err
+	}
+	defer release()
+
+	var tunnel *TunnelReport
+	if req.Tunnel != "" {
+		var closeTunnel func()
+		tunnel, closeTunnel, status, err = openTunnel(req, req.AddressFamily)
+		if err != nil {
+			return nil, status, err
+		}
+		defer closeTunnel()
+	}
+
+	target := net.JoinHostPort(req.ServerHost, fmt.Sprintf("%d", req.ServerPort))
+	logf(req.ctx, "TWAMP test: %s (%d probes, mode=%s, family=%s)", target, req.Count, mode, req.AddressFamily)
+
+	cancel := withTestTimeout(&req)
+	defer cancel()
+	ctx := req.runContext()
+	// TWAMP Light goes straight to the reflector's UDP port; otherwise a test
+	// session is negotiated over TWAMP-Control
+	var controlConn net.Conn
+	var dial *nettest.DialReport
+	var test *twamp.TwampTest
+	var tests []*twamp.TwampTest // With sessions, one per session; test is the first
+	var probes twampProbeTest    // Full mode runs on either
+	if req.TwampLight {
+		testPhase(ctx, "connect")
+		var light *twampLightTest
+		light, dial, err = dialTwampLight(ctx, req.ServerHost, req.ServerPort, req.AddressFamily, req.Padding, 5*time.Second, bind)
+		if err != nil {
+			return nil, http.StatusInternalServerError, twampError(ctx, "Connect failed", err)
+		}
+		defer func() { _ = light.conn.Close() }()
+		probes = light
+	} else {
+		specs := twampSessionSpecs(req)
+		configs := make([]nettest.TwampSessionConfig, len(specs))
+		for i, spec := range specs {
+			configs[i] = nettest.TwampSessionConfig{Padding: spec.Padding, DSCP: spec.DSCP}
+		}
+		runner := nettest.NewTwampRunner(req.ServerHost,
+			nettest.WithPort(req.ServerPort),
+			nettest.WithFamily(req.AddressFamily),
+			nettest.WithSource(bind),
+			nettest.WithPhaseFunc(func(phase string) { testPhase(ctx, phase) }),
+		)
+		session, err := runner.Start(ctx, configs...)
+		if err != nil {
+			if ctx.Err() != nil {
+				err = canceledError(ctx)
+			}
+			return nil, http.StatusInternalServerError, err
+		}
+		defer func() { _ = session.Close() }()
+		controlConn, dial, tests = session.Control, session.Dial, session.Tests
+		test = tests[0]
+		probes = test
+	}
+
+	// Capture test port information
+	testPhase(ctx, "run")
+	localAddr := probes.GetConnection().LocalAddr().String()
+	remoteAddr := probes.GetConnection().RemoteAddr().String()
+	logf(req.ctx, "TWAMP test created, remote: %s, local: %s", remoteAddr, localAddr)
+
+	// From here ending the test closes the test socket, which ends any mode's
+	// probing; the session is still stopped over the control connection
+	stopCancel := context.AfterFunc(ctx, func() { _ = probes.GetConnection().Close() })
+	defer stopCancel()
+
+	// The library binds the test socket to the control connection's address only
+	if err := bind.BindConn(probes.GetConnection()); err != nil {
+		return nil, http.StatusInternalServerError, fmt.Errorf("Binding to interface %s failed: %v", req.Interface, err)
+	}
+
+	tos, err := nettest.SetProbeTOS(probes.GetConnection(), req.DSCP<<2)
+	if err != nil {
+		return nil, http.StatusInternalServerError, fmt.Errorf("Setting DSCP %d failed: %v", req.DSCP, err)
+	}
+	// The DSCP the probes leave with, as the kernel applied it
+	dscp := tos >> 2
+
+	if len(req.Sessions) > 0 {
+		started := time.Now()
+		sessions, err := runTwampSessions(ctx, req, seriesOpts, controlConn, bind, tests)
+		if err := twampError(ctx, "Test run failed", err); err != nil {
+			return nil, http.StatusInternalServerError, err
+		}
+
+		data := map[string]interface{}{
+			"server":   req.ServerHost,
+			"dial":     dial,
+			"mode":     mode,
+			"probes":   req.Count,
+			"sessions": sessions,
+		}
+		if tunnel != nil {
+			data["tunnel"] = tunnel.twamp(dial.Family, maxSessionPadding(req.Sessions), 0)
+		}
+		if bind != nil {
+			data["source"] = bind
+		}
+		if profile != nil {
+			data["profile"] = profile.Name
+		}
+		if lock != nil {
+			data["lock"] = lock
+		}
+
+		recordResult(TEST_TYPE_TWAMP, req, started, data)
+		notifyCallback(req.CallbackURL, data)
+
+		return data, http.StatusOK, nil
+	}
+
+	if mode == TWAMP_MODE_LOSS {
+		started := time.Now()
+		loss, err := twampLossTest(test, req.Count, req.Rate, req.ECN)
+		if err := twampError(ctx, "Test run failed", err); err != nil {
+			return nil, http.StatusInternalServerError, err
+		}
+
+		data := map[string]interface{}{
+			"server":            req.ServerHost,
+			"local_endpoint":    localAddr,
+			"remote_endpoint":   remoteAddr,
+			"dial":              dial,
+			"mode":              mode,
+			"dscp":              dscp,
+			"probes":            req.Count,
+			"sent":              loss.Sent,
+			"received":          loss.Received,
+			"lost":              loss.Lost,
+			"loss_percent":      loss.LossPercent,
+			"duplicates":        loss.Duplicates,
+			"reordered":         loss.Reordered,
+			"reordered_percent": loss.ReorderedPercent,
+			"reordering":        loss.Reordering,
+			"loss_bursts":       loss.LossBursts,
+			"rate_pps":          loss.RatePps,
+			"achieved_rate_pps": loss.AchievedRatePps,
+			"duration_sec":      loss.DurationSec,
+		}
+		if loss.ECN != nil {
+			data["ecn"] = loss.ECN
+		}
+		if tunnel != nil {
+			data["tunnel"] = tunnel.twamp(dial.Family, req.Padding, loss.AchievedRatePps)
+		}
+		if bind != nil {
+			data["source"] = bind
+		}
+		if profile != nil {
+			data["profile"] = profile.Name
+		}
+		data["lock"] = lock
+
+		recordResult(TEST_TYPE_TWAMP, req, started, data)
+		notifyCallback(req.CallbackURL, data)
+
+		return data, http.StatusOK, nil
+	}
+
+	if mode == TWAMP_MODE_CAPACITY {
+		started := time.Now()
+		capacity, err := twampCapacityTest(test, req.Count, req.TrainLength)
+		if err := twampError(ctx, "Test run failed", err); err != nil {
+			return nil, http.StatusInternalServerError, err
+		}
+
+		data := map[string]interface{}{
+			"server":          req.ServerHost,
+			"local_endpoint":  localAddr,
+			"remote_endpoint": remoteAddr,
+			"dial":            dial,
+			"mode":            mode,
+			"dscp":            dscp,
+			"capacity":        capacity,
+		}
+		if tunnel != nil {
+			data["tunnel"] = tunnel.twamp(dial.Family, req.Padding, 0)
+		}
+		if bind != nil {
+			data["source"] = bind
+		}
+		if profile != nil {
+			data["profile"] = profile.Name
+		}
+		if lock != nil {
+			data["lock"] = lock
+		}
+
+		recordResult(TEST_TYPE_TWAMP, req, started, data)
+		notifyCallback(req.CallbackURL, data)
+
+		return data, http.StatusOK, nil
+	}
+
+	if mode == TWAMP_MODE_AVAILABLE {
+		started := time.Now()
+		available, err := twampAvailableTest(test, req.Count, req.TrainLength, req.Bandwidth.Mbps)
+		if err := twampError(ctx, "Test run failed", err); err != nil {
+			return nil, http.StatusInternalServerError, err
+		}
+
+		data := map[string]interface{}{
+			"server":          req.ServerHost,
+			"local_endpoint":  localAddr,
+			"remote_endpoint": remoteAddr,
+			"dial":            dial,
+			"mode":            mode,
+			"dscp":            dscp,
+			"available":       available,
+		}
+		if tunnel != nil {
+			data["tunnel"] = tunnel.twamp(dial.Family, req.Padding, 0)
+		}
+		if bind != nil {
+			data["source"] = bind
+		}
+		if profile != nil {
+			data["profile"] = profile.Name
+		}
+		if lock != nil {
+			data["lock"] = lock
+		}
+
+		recordResult(TEST_TYPE_TWAMP, req, started, data)
+		notifyCallback(req.CallbackURL, data)
+
+		return data, http.StatusOK, nil
+	}
+
+	// Reference point for detecting wall-clock steps against the monotonic clock
+	testStart := time.Now()
+	req.progress.start("rtt_ms", req.Count)
+	results, err := probes.RunMultiple(uint64(req.Count), probeProgress(req.progress, testStart), time.Second, nil)
+	if err := twampError(ctx, "Test run failed", err); err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	data := twampFullData(req, seriesOpts, testStart, results, controlConn, probes.GetConnection())
+	data["server"] = req.ServerHost
+	data["local_endpoint"] = localAddr
+	data["remote_endpoint"] = remoteAddr
+	data["dial"] = dial
+	data["mode"] = mode
+	data["dscp"] = dscp
+	if profile != nil {
+		data["profile"] = profile.Name
+	}
+	if lock != nil {
+		data["lock"] = lock
+	}
+	if tunnel != nil {
+		data["tunnel"] = tunnel.twamp(dial.Family, req.Padding, 0)
+	}
+	if bind != nil {
+		data["source"] = bind
+	}
+
+	recordResult(TEST_TYPE_TWAMP, req, testStart, data)
+	notifyCallback(req.CallbackURL, data)
+
+	return data, http.StatusOK, nil
+}
+
+// twampFullData analyses the replies of a full mode run into the delay,
+// jitter, hop, clock sync and loss fields of its result. controlConn is nil
+// for TWAMP Light.
+func twampFullData(req RunRequest, seriesOpts SeriesOptions, testStart time.Time, results *twamp.PingResults, controlConn net.Conn, probeConn *net.UDPConn) map[string]interface{} {
+	stat := results.Stat
+
+	// Raw forward = T2 - T1 = actual_forward + clock_offset
+	// Raw reverse = T4 - T3 = actual_reverse - clock_offset
+	// One-way values are wall-clock derived; RTT comes from the sender's monotonic clock.
+	// Probes during which either clock stepped are flagged and excluded from all statistics,
+	// see pkg/twampstats.
+	packets := twampPacketResults(testStart, results.Results)
+	summary := twampstats.ProcessResults(packets)
+
+	// Check local clock synchronization via adjtimex syscall
+	senderSynced := nettest.CheckNTPSync()
+
+	// Parse Error Estimate fields from both sender and reflector
+	var senderErrorInfo, reflectorErrorInfo nettest.ErrorEstimateInfo
+	var senderErrorRaw, reflectorErrorRaw uint16
+	reflectorSynced := false
+
+	// Per-probe network RTT for the optional series
+	var rttSeries []SeriesPoint
+
+	// Per-probe delays for the percentiles and histograms
+	var latency latencySamples
+
+	errorEstimateParsed := false
+	for i, r := range results.Results {
+		p := packets[i]
+		if p.Lost {
+			continue
+		}
+
+		// Parse full Error Estimate fields (only need to do this once, values should be consistent)
+		if !errorEstimateParsed {
+			errorEstimateParsed = true
+			senderErrorRaw = r.SenderErrorEstimate
+			reflectorErrorRaw = r.ErrorEstimate
+			senderErrorInfo = nettest.ParseErrorEstimate(senderErrorRaw)
+			reflectorErrorInfo = nettest.ParseErrorEstimate(reflectorErrorRaw)
+			reflectorSynced = reflectorErrorInfo.Synced
+
+			debugf(req.ctx, "TWAMP Error Estimates - Sender: 0x%04X (S=%v, Z=%v, Scale=%d, Mult=%d, Err=%.9fs), Reflector: 0x%04X (S=%v, Z=%v, Scale=%d, Mult=%d, Err=%.9fs)",
+				senderErrorRaw, senderErrorInfo.Synced, senderErrorInfo.Unavailable, senderErrorInfo.Scale, senderErrorInfo.Multiplier, senderErrorInfo.ErrorSeconds,
+				reflectorErrorRaw, reflectorErrorInfo.Synced, reflectorErrorInfo.Unavailable, reflectorErrorInfo.Scale, reflectorErrorInfo.Multiplier, reflectorErrorInfo.ErrorSeconds)
+		}
+
+		if p.Stepped() {
+			logf(req.ctx, "TWAMP probe %d excluded: clock step detected (sender=%v, reflector=%v, turnaround=%v, rtt=%v)",
+				p.Seq, p.SenderStep, p.ReflectorStep, p.Turnaround, p.NetworkRTT+p.Turnaround)
+			continue
+		}
+
+		if seriesOpts.Enabled {
+			sentAt := r.SentTimestamp
+			if sentAt.IsZero() {
+				sentAt = r.SenderTimestamp
+			}
+			rttSeries = append(rttSeries, SeriesPoint{
+				T:     sentAt.Sub(testStart).Seconds(),
+				Value: float64(p.NetworkRTT.Nanoseconds()) / 1e6,
+			})
+		}
+		latency.add(p.NetworkRTT, p.RawForward, p.RawReverse)
+	}
+
+	// Determine sync status
+	bothSynced := senderSynced && reflectorSynced
+
+	data := map[string]interface{}{
+		"probes":       req.Count,
+		"loss_percent": stat.Loss,
+		// Corrected network RTT: (T4-T1) - (T3-T2) = pure network delay without reflector processing
+		"rtt_min_ms":    float64(summary.NetworkRTT.Min.Nanoseconds()) / 1e6,
+		"rtt_max_ms":    float64(summary.NetworkRTT.Max.Nanoseconds()) / 1e6,
+		"rtt_avg_ms":    float64(summary.NetworkRTT.Avg.Nanoseconds()) / 1e6,
+		"rtt_stddev_ms": float64(summary.NetworkRTTStdDev.Nanoseconds()) / 1e6,
+		"rtt_median_ms": float64(summary.NetworkRTT.Median.Nanoseconds()) / 1e6,
+		"rtt_mad_ms":    float64(summary.NetworkRTT.MAD.Nanoseconds()) / 1e6,
+		// Raw RTT from library for reference: T4-T1 (includes reflector processing time)
+		"rtt_raw_ms": map[string]float64{
+			"min":    float64(stat.Min.Nanoseconds()) / 1e6,
+			"max":    float64(stat.Max.Nanoseconds()) / 1e6,
+			"avg":    float64(stat.Avg.Nanoseconds()) / 1e6,
+			"stddev": float64(stat.StdDev.Nanoseconds()) / 1e6,
+		},
+		"reflector_turnaround_ms": map[string]float64{
+			"min":    float64(summary.Turnaround.Min.Nanoseconds()) / 1e6,
+			"max":    float64(summary.Turnaround.Max.Nanoseconds()) / 1e6,
+			"avg":    float64(summary.Turnaround.Avg.Nanoseconds()) / 1e6,
+			"median": float64(summary.Turnaround.Median.Nanoseconds()) / 1e6,
+			"mad":    float64(summary.Turnaround.MAD.Nanoseconds()) / 1e6,
+		},
+		"estimated_clock_offset_ms": float64(summary.ClockOffset.Nanoseconds()) / 1e6,
+		// Probes excluded because the sender or reflector clock stepped mid-test
+		"clock_steps": map[string]interface{}{
+			"sender_step_probes":    summary.SenderStepProbes,
+			"reflector_step_probes": summary.ReflectorStepProbes,
+			"excluded_probes":       summary.ExcludedProbes,
+			"max_step_ms":           float64(summary.MaxClockStep.Nanoseconds()) / 1e6,
+		},
+		"sync_status": map[string]interface{}{
+			"sender_synced":    senderSynced,
+			"reflector_synced": reflectorSynced,
+			"both_synced":      bothSynced,
+			"sender_error_estimate": map[string]interface{}{
+				"synced":        senderErrorInfo.Synced,
+				"unavailable":   senderErrorInfo.Unavailable,
+				"scale":         senderErrorInfo.Scale,
+				"multiplier":    senderErrorInfo.Multiplier,
+				"error_seconds": senderErrorInfo.ErrorSeconds,
+				"error_ms":      senderErrorInfo.ErrorSeconds * 1000,
+				"raw_value_hex": fmt.Sprintf("0x%04X", senderErrorRaw),
+			},
+			"reflector_error_estimate": map[string]interface{}{
+				"synced":        reflectorErrorInfo.Synced,
+				"unavailable":   reflectorErrorInfo.Unavailable,
+				"scale":         reflectorErrorInfo.Scale,
+				"multiplier":    reflectorErrorInfo.Multiplier,
+				"error_seconds": reflectorErrorInfo.ErrorSeconds,
+				"error_ms":      reflectorErrorInfo.ErrorSeconds * 1000,
+				"raw_value_hex": fmt.Sprintf("0x%04X", reflectorErrorRaw),
+			},
+		},
+		"forward_delay_raw_ms": map[string]float64{
+			"min":    float64(summary.ForwardRaw.Min.Nanoseconds()) / 1e6,
+			"max":    float64(summary.ForwardRaw.Max.Nanoseconds()) / 1e6,
+			"avg":    float64(summary.ForwardRaw.Avg.Nanoseconds()) / 1e6,
+			"median": float64(summary.ForwardRaw.Median.Nanoseconds()) / 1e6,
+			"mad":    float64(summary.ForwardRaw.MAD.Nanoseconds()) / 1e6,
+		},
+		"forward_delay_corrected_ms": map[string]float64{
+			"min":    float64(summary.ForwardCorrected.Min.Nanoseconds()) / 1e6,
+			"max":    float64(summary.ForwardCorrected.Max.Nanoseconds()) / 1e6,
+			"avg":    float64(summary.ForwardCorrected.Avg.Nanoseconds()) / 1e6,
+			"median": float64(summary.ForwardCorrected.Median.Nanoseconds()) / 1e6,
+			"mad":    float64(summary.ForwardCorrected.MAD.Nanoseconds()) / 1e6,
+		},
+		// RFC 3393 IPDV (IP Packet Delay Variation) - difference between consecutive packet delays
+		// Clock offset cancels out, so this is true one-way delay variation
+		"forward_ipdv_ms": map[string]float64{
+			"min":      float64(summary.ForwardIPDV.Min.Nanoseconds()) / 1e6,
+			"max":      float64(summary.ForwardIPDV.Max.Nanoseconds()) / 1e6,
+			"avg":      float64(summary.ForwardIPDV.Avg.Nanoseconds()) / 1e6,
+			"mean_abs": float64(summary.ForwardIPDV.MeanAbs.Nanoseconds()) / 1e6, // Mean Absolute Deviation
+		},
+		// RFC 3550 Jitter - exponentially smoothed mean absolute IPDV
+		"forward_jitter_ms": summary.ForwardJitter / 1e6,
+		"reverse_delay_raw_ms": map[string]float64{
+			"min":    float64(summary.ReverseRaw.Min.Nanoseconds()) / 1e6,
+			"max":    float64(summary.ReverseRaw.Max.Nanoseconds()) / 1e6,
+			"avg":    float64(summary.ReverseRaw.Avg.Nanoseconds()) / 1e6,
+			"median": float64(summary.ReverseRaw.Median.Nanoseconds()) / 1e6,
+			"mad":    float64(summary.ReverseRaw.MAD.Nanoseconds()) / 1e6,
+		},
+		"reverse_delay_corrected_ms": map[string]float64{
+			"min":    float64(summary.ReverseCorrected.Min.Nanoseconds()) / 1e6,
+			"max":    float64(summary.ReverseCorrected.Max.Nanoseconds()) / 1e6,
+			"avg":    float64(summary.ReverseCorrected.Avg.Nanoseconds()) / 1e6,
+			"median": float64(summary.ReverseCorrected.Median.Nanoseconds()) / 1e6,
+			"mad":    float64(summary.ReverseCorrected.MAD.Nanoseconds()) / 1e6,
+		},
+		// RFC 3393 IPDV for reverse direction
+		"reverse_ipdv_ms": map[string]float64{
+			"min":      float64(summary.ReverseIPDV.Min.Nanoseconds()) / 1e6,
+			"max":      float64(summary.ReverseIPDV.Max.Nanoseconds()) / 1e6,
+			"avg":      float64(summary.ReverseIPDV.Avg.Nanoseconds()) / 1e6,
+			"mean_abs": float64(summary.ReverseIPDV.MeanAbs.Nanoseconds()) / 1e6,
+		},
+		// RFC 3550 Jitter for reverse direction
+		"reverse_jitter_ms": summary.ReverseJitter / 1e6,
+		// Hop counts derived from TTL values
+		// Forward: 255 - SenderTTL (sender uses TTL=255)
+		// Reverse: EstimatedInitialTTL - ReceivedTTL (initial TTL estimated from received value)
+		"hops": map[string]interface{}{
+			"forward": map[string]interface{}{
+				"min": summary.ForwardHops.Min,
+				"max": summary.ForwardHops.Max,
+				"avg": summary.ForwardHops.Avg,
+			},
+			"reverse": map[string]interface{}{
+				"min": summary.ReverseHops.Min,
+				"max": summary.ReverseHops.Max,
+				"avg": summary.ReverseHops.Avg,
+			},
+		},
+	}
+
+	mss, mssMeasured := nettest.TCPMSS(controlConn), true
+	if mss == 0 {
+		mss, mssMeasured = defaultMSS(probeConn.RemoteAddr()), false
+	}
+	if prediction := predictTCP(mss, mssMeasured, summary.NetworkRTT.Avg, summary.NetworkRTTStdDev, int(stat.Transmitted), int(stat.Received)); prediction != nil {
+		data["tcp_prediction"] = prediction
+	}
+
+	if summary.Usable > 0 {
+		data["percentiles_ms"] = latency.percentiles()
+		if req.HistogramBucketMs > 0 {
+			data["histogram_ms"] = latency.histograms(req.HistogramBucketMs)
+		}
+	}
+	sequences := replySequences(results.Results, stat.Transmitted)
+	data["duplicates"] = sequences.Duplicates()
+	data["reordered"] = sequences.Reordered()
+	data["reordered_percent"] = reorderedPercent(sequences)
+	data["reordering"] = sequences.Reordering()
+	data["loss_bursts"] = sequences.Bursts(uint32(stat.Transmitted))
+	if req.IncludeRaw {
+		data["raw"] = rawProbes(testStart, results.Results, stat.Transmitted)
+	}
+	if req.TwampLight {
+		data["twamp_light"] = true
+	}
+	if seriesOpts.Enabled {
+		data["series"] = buildSeries("rtt_ms", rttSeries, seriesOpts)
+	}
+
+	return data
+}
+
+// twampPacketResults returns the probes of a full mode run for twampstats,
+// their timing taken apart by ComputeProbeTiming
+func twampPacketResults(testStart time.Time, results []*twamp.TwampResults) []twampstats.PacketResult {
+	packets := make([]twampstats.PacketResult, len(results))
+	for i, r := range results {
+		packets[i] = twampstats.PacketResult{Seq: r.SenderSeqNum, Lost: r.FinishedTimestamp.IsZero()}
+		if packets[i].Lost {
+			continue
+		}
+		timing := nettest.ComputeProbeTiming(testStart, r)
+		packets[i].RawForward = timing.RawForward
+		packets[i].RawReverse = timing.RawReverse
+		packets[i].Turnaround = timing.Turnaround
+		packets[i].NetworkRTT = timing.NetworkRTT
+		packets[i].SendSkew = timing.SendSkew
+		packets[i].ReceiveSkew = timing.ReceiveSkew
+		packets[i].SenderStep = timing.SenderStep
+		packets[i].ReflectorStep = timing.ReflectorStep
+		packets[i].SenderTTL = int(r.SenderTTL)
+		packets[i].ReceivedTTL = r.ReceivedTTL
+	}
+	return packets
+}
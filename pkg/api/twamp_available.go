@@ -0,0 +1,230 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	"github.com/tcaine/twamp"
+
+	"network-test-api/pkg/stats"
+)
+
+// Available bandwidth mode: periodic streams at a probe rate R load the path
+// only briefly. If R exceeds the available bandwidth the bottleneck queue grows
+// for the length of the stream and one-way delays trend upwards; otherwise they
+// do not. A binary search over R between 0 and the measured capacity narrows
+// down the rate where the trend appears. (Pathload's SLoPS.)
+const (
+	TWAMP_MODE_AVAILABLE = "available"
+
+	DEFAULT_AVAILABLE_STREAMS = 12
+	MAX_AVAILABLE_STREAMS     = 50
+	DEFAULT_STREAM_LENGTH     = 100
+	MIN_STREAM_LENGTH         = 25 // Enough for a trend over 5 groups of 5
+	MAX_STREAM_LENGTH         = 500
+	AVAILABLE_CAPACITY_TRAINS = 20 // Packet pairs bounding the search
+	STREAM_WAIT               = time.Second
+	MIN_STREAM_GAP            = 20 * time.Millisecond // Idle time between streams, at least the stream's length
+
+	// Pathload's thresholds for the pairwise comparison (PCT) and
+	// pairwise difference (PDT) trend tests
+	PCT_INCREASING     = 0.66
+	PCT_NON_INCREASING = 0.54
+	PDT_INCREASING     = 0.55
+	PDT_NON_INCREASING = 0.45
+
+	STREAM_OVERLOAD_LOSS   = 10.0 // Percent; a stream losing more overloaded the path
+	AVAILABLE_RESOLUTION   = 0.02 // Of the capacity; the search stops once the range is narrower
+	MIN_AVAILABLE_RANGE    = 1.0  // Mbit/s
+	SENDER_RATE_TOLERANCE  = 0.9  // Achieved below this fraction of the target rate is reported
+	STREAM_SPIN_BEFORE_DUE = time.Millisecond
+)
+
+// Trends of one-way delay within a stream
+const (
+	TREND_INCREASING     = "increasing"
+	TREND_NON_INCREASING = "non_increasing"
+	TREND_GREY           = "grey" // Neither test is conclusive
+)
+
+// validateAvailableMode checks the stream count, stream length and rate cap of an available mode request
+func validateAvailableMode(req RunRequest) error {
+	switch {
+	case req.Count < 1 || req.Count > MAX_AVAILABLE_STREAMS:
+		return fmt.Errorf("count must be between 1 and %d streams in available mode", MAX_AVAILABLE_STREAMS)
+	case req.TrainLength < MIN_STREAM_LENGTH || req.TrainLength > MAX_STREAM_LENGTH:
+		return fmt.Errorf("train_length must be between %d and %d in available mode", MIN_STREAM_LENGTH, MAX_STREAM_LENGTH)
+	case req.Bandwidth.Mbps < 0:
+		return fmt.Errorf("bandwidth must not be negative")
+	case req.Series:
+		return fmt.Errorf("series is not available in available mode")
+	}
+	return nil
+}
+
+// AvailableStream is one probe stream of the search
+type AvailableStream struct {
+	RateMbps      float64 `json:"rate_mbps"`     // Target rate
+	AchievedMbps  float64 `json:"achieved_mbps"` // Rate the probes actually left at
+	LossPercent   float64 `json:"loss_percent"`
+	PCT           float64 `json:"pct"`
+	PDT           float64 `json:"pdt"`
+	OWDIncreaseMs float64 `json:"owd_increase_ms"` // Median one-way delay of the last group minus the first
+	Trend         string  `json:"trend"`
+}
+
+// AvailableResult is the outcome of an available mode TWAMP run
+type AvailableResult struct {
+	CapacityMbps       float64 `json:"capacity_mbps"`   // Forward capacity from packet pairs
+	BaselineRTTMs      float64 `json:"baseline_rtt_ms"` // Lowest RTT of the idle packet pairs
+	AvailableMbps      float64 `json:"available_mbps"`  // Middle of the final range
+	AvailableLowMbps   float64 `json:"available_low_mbps"`
+	AvailableHighMbps  float64 `json:"available_high_mbps"`
+	GreyLowMbps        float64 `json:"grey_low_mbps,omitempty"` // Rates with inconclusive trends
+	GreyHighMbps       float64 `json:"grey_high_mbps,omitempty"`
+	HeadroomPercent    float64 `json:"headroom_percent"` // Available bandwidth as a share of the capacity
+	UtilizationPercent float64 `json:"utilization_percent"`
+	MaxRateMbps        float64 `json:"max_rate_mbps"` // Upper end of the search: the capacity, or bandwidth if lower
+
+	StreamLength  int               `json:"stream_length"`
+	PacketBytes   int               `json:"packet_bytes"`
+	Streams       []AvailableStream `json:"streams"`
+	SenderLimited bool              `json:"sender_limited"` // Some stream left well below its target rate
+	DurationSec   float64           `json:"duration_sec"`
+}
+
+// classifyTrend combines the two tests: one conclusive test is enough unless
+// the other contradicts it, and heavy loss always means overload
+func classifyTrend(pct, pdt, lossPercent float64) string {
+	if lossPercent > STREAM_OVERLOAD_LOSS {
+		return TREND_INCREASING
+	}
+	pctUp, pctFlat := pct >= PCT_INCREASING, pct <= PCT_NON_INCREASING
+	pdtUp, pdtFlat := pdt >= PDT_INCREASING, pdt <= PDT_NON_INCREASING
+	switch {
+	case (pctUp && !pdtFlat) || (pdtUp && !pctFlat):
+		return TREND_INCREASING
+	case (pctFlat && !pdtUp) || (pdtFlat && !pctUp):
+		return TREND_NON_INCREASING
+	}
+	return TREND_GREY
+}
+
+// sendStream sends length probes paced at rateMbps and analyzes their one-way delays
+func sendStream(test *twamp.TwampTest, length, packetBytes int, rateMbps float64) (*AvailableStream, time.Duration, error) {
+	gap := time.Duration(float64(packetBytes*8) / rateMbps * float64(time.Microsecond))
+	burst, err := startProbeBurst(test, length)
+	if err != nil {
+		return nil, 0, err
+	}
+	for i := 1; i < length && err == nil; i++ {
+		due := time.Duration(i) * gap
+		if wait := due - time.Since(burst.start) - STREAM_SPIN_BEFORE_DUE; wait > 0 {
+			time.Sleep(wait)
+		}
+		for time.Since(burst.start) < due {
+			// Spin the last stretch; sleeps overshoot by more than a probe gap
+		}
+		err = burst.send()
+	}
+	length = burst.next
+	elapsed := burst.sent[length-1]
+	burst.wait(STREAM_WAIT)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// Offsets between the clocks cancel out of the trend
+	owd := make([]float64, 0, length)
+	for i := 0; i < length; i++ {
+		if r := burst.replies[i]; r.received {
+			owd = append(owd, r.reflector.Sub(burst.sentAt(i)).Seconds()*1000)
+		}
+	}
+	s := &AvailableStream{
+		RateMbps:    rateMbps,
+		LossPercent: float64(length-len(owd)) / float64(length) * 100,
+	}
+	if elapsed > 0 {
+		s.AchievedMbps = float64((length-1)*packetBytes*8) / elapsed.Seconds() / 1e6
+	}
+	s.PCT, s.PDT, s.OWDIncreaseMs = stats.DelayTrend(owd)
+	s.Trend = classifyTrend(s.PCT, s.PDT, s.LossPercent)
+	return s, elapsed, nil
+}
+
+// Measure the capacity with packet pairs, then binary-search the available
+// bandwidth below it (or below maxRateMbps, if set) with up to streams streams.
+func twampAvailableTest(test *twamp.TwampTest, streams, streamLength int, maxRateMbps float64) (*AvailableResult, error) {
+	start := time.Now()
+	capacity, err := twampCapacityTest(test, AVAILABLE_CAPACITY_TRAINS, DEFAULT_TRAIN_LENGTH)
+	if err != nil {
+		return nil, err
+	}
+	if capacity.Forward == nil || capacity.Forward.CapacityMbps <= 0 {
+		return nil, fmt.Errorf("no valid packet pairs to estimate the capacity from (%d sent)", AVAILABLE_CAPACITY_TRAINS)
+	}
+
+	result := &AvailableResult{
+		CapacityMbps:  capacity.Forward.CapacityMbps,
+		BaselineRTTMs: capacity.MinRTTMs,
+		MaxRateMbps:   capacity.Forward.CapacityMbps,
+		StreamLength:  streamLength,
+		PacketBytes:   capacity.PacketBytes,
+	}
+	if maxRateMbps > 0 && maxRateMbps < result.MaxRateMbps {
+		result.MaxRateMbps = maxRateMbps
+	}
+
+	lo, hi := 0.0, result.MaxRateMbps
+	resolution := math.Max(MIN_AVAILABLE_RANGE, AVAILABLE_RESOLUTION*result.CapacityMbps)
+	for n := 0; n < streams && hi-lo > resolution; n++ {
+		stream, elapsed, err := sendStream(test, streamLength, result.PacketBytes, (lo+hi)/2)
+		if err != nil {
+			return nil, err
+		}
+		result.Streams = append(result.Streams, *stream)
+
+		// Bounds move to the rate the probes actually left at
+		rate := stream.RateMbps
+		if stream.AchievedMbps > 0 && stream.AchievedMbps < rate {
+			rate = stream.AchievedMbps
+		}
+		if stream.AchievedMbps < SENDER_RATE_TOLERANCE*stream.RateMbps {
+			result.SenderLimited = true
+		}
+		switch stream.Trend {
+		case TREND_NON_INCREASING:
+			lo = math.Max(lo, rate)
+		case TREND_GREY:
+			if result.GreyLowMbps == 0 || rate < result.GreyLowMbps {
+				result.GreyLowMbps = rate
+			}
+			result.GreyHighMbps = math.Max(result.GreyHighMbps, rate)
+			hi = rate // Conservatively, as if increasing
+		default:
+			hi = rate
+		}
+		if hi < lo {
+			hi = lo
+		}
+
+		// Let the queue built by an overloading stream drain before the next
+		gap := elapsed
+		if gap < MIN_STREAM_GAP {
+			gap = MIN_STREAM_GAP
+		}
+		time.Sleep(gap)
+	}
+
+	result.AvailableLowMbps, result.AvailableHighMbps = lo, hi
+	result.AvailableMbps = (lo + hi) / 2
+	result.HeadroomPercent = result.AvailableMbps / result.CapacityMbps * 100
+	result.UtilizationPercent = 100 - result.HeadroomPercent
+	result.DurationSec = time.Since(start).Seconds()
+	log.Printf("TWAMP available bandwidth: %.1f-%.1f Mbit/s of %.1f Mbit/s capacity after %d streams",
+		lo, hi, result.CapacityMbps, len(result.Streams))
+	return result, nil
+}
@@ -0,0 +1,58 @@
+package api
+
+import (
+	"math"
+	"testing"
+
+	"network-test-api/pkg/stats"
+)
+
+func TestDelayTrendGrowingQueue(t *testing.T) {
+	// 100 probes into a queue growing 20us per probe, with +-0.3 ms noise
+	owd := make([]float64, 100)
+	for i := range owd {
+		owd[i] = 10 + float64(i)*0.02 + 0.3*math.Sin(float64(i)*1.7)
+	}
+
+	pct, pdt, increase := stats.DelayTrend(owd)
+	if pct < 0.66 || pdt < 0.55 {
+		t.Errorf("Expected an increasing trend, got PCT %.2f, PDT %.2f", pct, pdt)
+	}
+	if increase < 1.5 || increase > 2.1 {
+		t.Errorf("Expected about 1.8 ms of queue growth, got %.2f", increase)
+	}
+	if got := classifyTrend(pct, pdt, 0); got != "increasing" {
+		t.Errorf("Expected increasing, got %s", got)
+	}
+}
+
+func TestDelayTrendFlat(t *testing.T) {
+	owd := make([]float64, 100)
+	for i := range owd {
+		owd[i] = 10 + 0.3*math.Sin(float64(i)*1.7)
+	}
+
+	pct, pdt, _ := stats.DelayTrend(owd)
+	if got := classifyTrend(pct, pdt, 0); got != "non_increasing" {
+		t.Errorf("Expected non_increasing, got %s (PCT %.2f, PDT %.2f)", got, pct, pdt)
+	}
+}
+
+func TestClassifyTrend(t *testing.T) {
+	tests := []struct {
+		pct, pdt, loss float64
+		want           string
+	}{
+		{0.8, 0.5, 0, "increasing"},     // PDT inconclusive, PCT decides
+		{0.8, 0.2, 0, "grey"},           // Contradicting tests
+		{0.6, 0.5, 0, "grey"},           // Both inconclusive
+		{0.3, 0.5, 0, "non_increasing"}, // PCT decides
+		{0.3, 0.1, 25, "increasing"},    // Heavy loss is overload
+	}
+
+	for _, tt := range tests {
+		if got := classifyTrend(tt.pct, tt.pdt, tt.loss); got != tt.want {
+			t.Errorf("PCT %.2f, PDT %.2f, loss %.0f%%: expected %s, got %s", tt.pct, tt.pdt, tt.loss, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package api
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/tcaine/twamp"
+)
+
+// probeReply is what dispersion and delay trend analysis need of one reflected probe
+type probeReply struct {
+	received  bool
+	reflector time.Time     // T2
+	arrival   time.Duration // Since the burst started, on the monotonic clock
+}
+
+// probeBurst sends a fixed number of probes on a TWAMP test and collects their
+// replies by sequence number, for modes that time the probes themselves
+type probeBurst struct {
+	test    *twamp.TwampTest
+	start   time.Time
+	base    uint32
+	next    int
+	sent    []time.Duration // Send offsets, written by the sender only
+	replies []probeReply    // Written by the reader until done is closed
+	done    chan struct{}
+}
+
+// startProbeBurst sends the first of n probes and starts reading replies. As in
+// loss mode, the first probe fixes the sequence base before the reader starts.
+func startProbeBurst(test *twamp.TwampTest, n int) (*probeBurst, error) {
+	b := &probeBurst{
+		test:    test,
+		sent:    make([]time.Duration, n),
+		replies: make([]probeReply, n),
+		done:    make(chan struct{}),
+	}
+	b.start = time.Now()
+	base, err := test.SendProbe()
+	if err != nil {
+		return nil, fmt.Errorf("sending probe 0: %w", err)
+	}
+	b.base, b.next = base, 1
+
+	conn := test.GetConnection()
+	_ = conn.SetReadDeadline(time.Time{})
+	go b.read(conn)
+	return b, nil
+}
+
+func (b *probeBurst) read(conn *net.UDPConn) {
+	defer close(b.done)
+	received := 0
+	buf := make([]byte, TWAMP_BASE_PACKET_SIZE+b.test.GetSession().GetConfig().Padding+64)
+	for {
+		n, err := conn.Read(buf)
+		arrival := time.Since(b.start)
+		if err != nil {
+			var netErr net.Error
+			if (errors.As(err, &netErr) && netErr.Timeout()) || errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
+		var pkt twamp.MeasurementPacket
+		if binary.Read(bytes.NewReader(buf[:n]), binary.BigEndian, &pkt) != nil {
+			continue
+		}
+		i := int(pkt.SenderSequence - b.base)
+		if i < 0 || i >= len(b.replies) || b.replies[i].received {
+			continue
+		}
+		b.replies[i] = probeReply{received: true, reflector: ntpTime(pkt.ReceiveTimeStamp), arrival: arrival}
+		if received++; received == len(b.replies) {
+			return
+		}
+	}
+}
+
+// send sends the next probe of the burst
+func (b *probeBurst) send() error {
+	sentAt := time.Since(b.start)
+	if _, err := b.test.SendProbe(); err != nil {
+		return fmt.Errorf("sending probe %d: %w", b.next, err)
+	}
+	b.sent[b.next] = sentAt
+	b.next++
+	return nil
+}
+
+// wait gives late replies until timeout after the last probe; replies and sent
+// may be read once it returns
+func (b *probeBurst) wait(timeout time.Duration) {
+	_ = b.test.GetConnection().SetReadDeadline(time.Now().Add(timeout))
+	<-b.done
+}
+
+// sentAt returns the wall-clock send time of probe i
+func (b *probeBurst) sentAt(i int) time.Time {
+	return b.start.Add(b.sent[i])
+}
+
+// ntpTime decodes an RFC 5357 timestamp. twamp.NewTimestamp reads the fraction
+// as nanoseconds, which is off by a factor of 4.3 within the second and would
+// scale every dispersion by it.
+func ntpTime(ts twamp.TwampTimestamp) time.Time {
+	const ntpToUnix = 2208988800
+	nanos := int64((uint64(ts.Fraction) * 1e9) >> 32)
+	return time.Unix(int64(ts.Integer)-ntpToUnix, nanos)
+}
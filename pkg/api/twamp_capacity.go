@@ -0,0 +1,175 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/tcaine/twamp"
+
+	"network-test-api/pkg/nettest"
+	"network-test-api/pkg/stats"
+)
+
+// Capacity mode: trains of back-to-back TWAMP probes, spaced out by the
+// narrowest link of the path. (Pathrate-style dispersion, no saturation.)
+const (
+	TWAMP_MODE_CAPACITY = "capacity"
+
+	DEFAULT_CAPACITY_TRAINS  = 50
+	MAX_CAPACITY_TRAINS      = 1000
+	DEFAULT_TRAIN_LENGTH     = 2 // Packet pairs
+	MAX_TRAIN_LENGTH         = 32
+	DEFAULT_CAPACITY_PADDING = 1400 // Large probes spread out most on the bottleneck
+	CAPACITY_TRAIN_GAP       = 20 * time.Millisecond
+	CAPACITY_WAIT            = 2 * time.Second // Wait for late replies after the last train
+
+	// Estimates are binned at 5% relative width; the fullest bin is the capacity mode
+	CAPACITY_BIN_WIDTH = 0.05
+
+	// Arrival dispersion below this multiple of the send dispersion means the
+	// sender could not emit the train faster than the path forwards it
+	SENDER_LIMIT_FACTOR = 1.5
+)
+
+// validateCapacityMode checks the train count and length of a capacity mode request
+func validateCapacityMode(req RunRequest) error {
+	switch {
+	case req.Count < 1 || req.Count > MAX_CAPACITY_TRAINS:
+		return fmt.Errorf("count must be between 1 and %d trains in capacity mode", MAX_CAPACITY_TRAINS)
+	case req.TrainLength < 2 || req.TrainLength > MAX_TRAIN_LENGTH:
+		return fmt.Errorf("train_length must be between 2 and %d", MAX_TRAIN_LENGTH)
+	case req.Series:
+		return fmt.Errorf("series is not available in capacity mode")
+	}
+	return nil
+}
+
+// CapacityEstimate summarizes the per-train capacity samples of one direction
+type CapacityEstimate struct {
+	CapacityMbps float64 `json:"capacity_mbps"` // Mode of the samples
+	MedianMbps   float64 `json:"median_mbps"`
+	P25Mbps      float64 `json:"p25_mbps"`
+	P75Mbps      float64 `json:"p75_mbps"`
+	ModeSamples  int     `json:"mode_samples"` // Samples in the modal bin
+}
+
+// CapacityResult is the outcome of a capacity mode TWAMP run
+type CapacityResult struct {
+	Trains      int `json:"trains"`
+	TrainLength int `json:"train_length"`
+	PacketBytes int `json:"packet_bytes"` // IP packet size the dispersion is computed with
+	ValidTrains int `json:"valid_trains"` // Complete, in order and with increasing timestamps
+
+	Forward   *CapacityEstimate `json:"forward,omitempty"`    // From the reflector's receive timestamps
+	RoundTrip *CapacityEstimate `json:"round_trip,omitempty"` // From local reply arrival, the narrower of both directions
+
+	MinRTTMs         float64 `json:"min_rtt_ms"`         // Lowest RTT of a train's first probe, sent into an idle path
+	SendDispersionUs float64 `json:"send_dispersion_us"` // Median time to put one train on the wire
+	SenderLimited    bool    `json:"sender_limited"`     // Capacity may be higher than measured
+	DurationSec      float64 `json:"duration_sec"`
+}
+
+func estimateCapacity(samples []float64) *CapacityEstimate {
+	if len(samples) == 0 {
+		return nil
+	}
+	sorted := append([]float64(nil), samples...)
+	sort.Float64s(sorted)
+	mode, n := stats.CapacityMode(sorted, CAPACITY_BIN_WIDTH)
+	return &CapacityEstimate{
+		CapacityMbps: mode,
+		MedianMbps:   stats.Percentile(sorted, 50),
+		P25Mbps:      stats.Percentile(sorted, 25),
+		P75Mbps:      stats.Percentile(sorted, 75),
+		ModeSamples:  n,
+	}
+}
+
+// Send trains of trainLength back-to-back probes, CAPACITY_TRAIN_GAP apart, and
+// estimate the path capacity from how far apart the probes of each train arrive.
+func twampCapacityTest(test *twamp.TwampTest, trains, trainLength int) (*CapacityResult, error) {
+	padding := test.GetSession().GetConfig().Padding
+	packetBytes := TWAMP_BASE_PACKET_SIZE + padding + nettest.UDP_WIRE_HEADER + nettest.IPHeaderSize(test.GetConnection().RemoteAddr())
+	sendDispersion := make([]float64, 0, trains)
+
+	burst, err := startProbeBurst(test, trains*trainLength)
+	if err != nil {
+		return nil, err
+	}
+	for train := 0; train < trains && err == nil; train++ {
+		if train > 0 {
+			time.Sleep(CAPACITY_TRAIN_GAP)
+		}
+		first := time.Now()
+		for k := 0; k < trainLength && err == nil; k++ {
+			if train > 0 || k > 0 { // Probe 0 went out with the start of the burst
+				err = burst.send()
+			}
+		}
+		if train > 0 {
+			sendDispersion = append(sendDispersion, float64(time.Since(first).Microseconds()))
+		}
+	}
+	burst.wait(CAPACITY_WAIT)
+	if err != nil {
+		return nil, err
+	}
+
+	var forward, roundTrip []float64
+	minRTT := time.Duration(-1)
+	for train := 0; train < trains; train++ {
+		head := train * trainLength
+		if r := burst.replies[head]; r.received && (minRTT < 0 || r.arrival-burst.sent[head] < minRTT) {
+			minRTT = r.arrival - burst.sent[head]
+		}
+		probes := burst.replies[head : head+trainLength]
+		if !trainValid(probes) {
+			continue
+		}
+		last := probes[trainLength-1]
+		forward = append(forward, stats.DispersionMbps(trainLength, packetBytes, last.reflector.Sub(probes[0].reflector)))
+		roundTrip = append(roundTrip, stats.DispersionMbps(trainLength, packetBytes, last.arrival-probes[0].arrival))
+	}
+
+	result := &CapacityResult{
+		Trains:      trains,
+		TrainLength: trainLength,
+		PacketBytes: packetBytes,
+		ValidTrains: len(forward),
+		Forward:     estimateCapacity(forward),
+		RoundTrip:   estimateCapacity(roundTrip),
+		DurationSec: time.Since(burst.start).Seconds(),
+	}
+	if minRTT >= 0 {
+		result.MinRTTMs = float64(minRTT.Microseconds()) / 1000
+	}
+	if len(sendDispersion) > 0 {
+		sort.Float64s(sendDispersion)
+		result.SendDispersionUs = stats.Percentile(sendDispersion, 50)
+		if est := result.Forward; est != nil && est.CapacityMbps > 0 {
+			arrivalUs := float64((trainLength-1)*packetBytes*8) / est.CapacityMbps
+			result.SenderLimited = arrivalUs < SENDER_LIMIT_FACTOR*result.SendDispersionUs
+		}
+	}
+	if result.Forward != nil {
+		log.Printf("TWAMP capacity: %d/%d valid trains, forward %.1f Mbit/s, round trip %.1f Mbit/s",
+			result.ValidTrains, trains, result.Forward.CapacityMbps, result.RoundTrip.CapacityMbps)
+	}
+	return result, nil
+}
+
+// trainValid reports whether every probe of a train came back, in order, with
+// increasing reflector timestamps; anything else says nothing about dispersion
+func trainValid(probes []probeReply) bool {
+	for k, p := range probes {
+		if !p.received {
+			return false
+		}
+		if k > 0 && (!p.reflector.After(probes[k-1].reflector) || p.arrival <= probes[k-1].arrival) {
+			return false
+		}
+	}
+	return true
+}
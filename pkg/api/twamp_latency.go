@@ -0,0 +1,85 @@
+package api
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"network-test-api/pkg/stats"
+)
+
+// Tail latency of TWAMP full mode: percentiles of the network RTT and both
+// one-way delays, and on request a histogram of each. The one-way delays are
+// raw (T2-T1 and T4-T3), so their absolute values include the clock offset
+// and only mean something when both clocks are synced; their spread does not
+// depend on it.
+const (
+	MIN_HISTOGRAM_BUCKET_MS = 0.001 // One microsecond
+	MAX_HISTOGRAM_BUCKET_MS = 10000
+)
+
+// The percentiles and histograms of pkg/stats, as responses carry them
+type (
+	Percentiles     = stats.Percentiles
+	Histogram       = stats.Histogram
+	HistogramBucket = stats.HistogramBucket
+)
+
+// LatencyPercentiles are the tail percentiles of a full mode run in milliseconds
+type LatencyPercentiles struct {
+	RTT          Percentiles `json:"rtt"`
+	ForwardDelay Percentiles `json:"forward_delay"` // Raw, offset by the clock difference
+	ReverseDelay Percentiles `json:"reverse_delay"` // Raw, offset by the clock difference
+}
+
+// LatencyHistograms bin the probes of a full mode run by delay in milliseconds
+type LatencyHistograms struct {
+	RTT          *Histogram `json:"rtt"`
+	ForwardDelay *Histogram `json:"forward_delay"`
+	ReverseDelay *Histogram `json:"reverse_delay"`
+}
+
+// latencySamples collects the delays of the usable probes of a full mode run
+type latencySamples struct {
+	rtt, forward, reverse []float64 // Milliseconds
+}
+
+func (s *latencySamples) add(rtt, forward, reverse time.Duration) {
+	s.rtt = append(s.rtt, float64(rtt.Nanoseconds())/1e6)
+	s.forward = append(s.forward, float64(forward.Nanoseconds())/1e6)
+	s.reverse = append(s.reverse, float64(reverse.Nanoseconds())/1e6)
+}
+
+// percentiles sorts the samples and computes their tail percentiles
+func (s *latencySamples) percentiles() LatencyPercentiles {
+	for _, values := range [][]float64{s.rtt, s.forward, s.reverse} {
+		sort.Float64s(values)
+	}
+	return LatencyPercentiles{
+		RTT:          stats.TailPercentiles(s.rtt),
+		ForwardDelay: stats.TailPercentiles(s.forward),
+		ReverseDelay: stats.TailPercentiles(s.reverse),
+	}
+}
+
+// histograms bins the samples into buckets of bucketMs
+func (s *latencySamples) histograms(bucketMs float64) LatencyHistograms {
+	return LatencyHistograms{
+		RTT:          stats.NewHistogram(s.rtt, bucketMs),
+		ForwardDelay: stats.NewHistogram(s.forward, bucketMs),
+		ReverseDelay: stats.NewHistogram(s.reverse, bucketMs),
+	}
+}
+
+// validateHistogramBucket checks histogram_bucket_ms, which only full mode supports
+func validateHistogramBucket(req RunRequest, mode string) error {
+	switch {
+	case req.HistogramBucketMs == 0:
+		return nil
+	case mode != TWAMP_MODE_FULL:
+		return fmt.Errorf("histogram_bucket_ms is only available in full mode")
+	case req.HistogramBucketMs < MIN_HISTOGRAM_BUCKET_MS || req.HistogramBucketMs > MAX_HISTOGRAM_BUCKET_MS:
+		return fmt.Errorf("histogram_bucket_ms must be between %g and %d", MIN_HISTOGRAM_BUCKET_MS, MAX_HISTOGRAM_BUCKET_MS)
+	}
+	return nil
+}
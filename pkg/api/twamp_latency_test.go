@@ -0,0 +1,90 @@
+package api
+
+import (
+	"math"
+	"testing"
+
+	"network-test-api/pkg/stats"
+)
+
+func TestTailPercentiles(t *testing.T) {
+	sorted := make([]float64, 1001)
+	for i := range sorted {
+		sorted[i] = float64(i) / 10 // 0 to 100 ms in 0.1 ms steps
+	}
+
+	p := stats.TailPercentiles(sorted)
+	for _, c := range []struct {
+		name      string
+		got, want float64
+	}{
+		{"p50", p.P50, 50},
+		{"p90", p.P90, 90},
+		{"p95", p.P95, 95},
+		{"p99", p.P99, 99},
+		{"p99_9", p.P999, 99.9},
+	} {
+		if math.Abs(c.got-c.want) > 1e-9 {
+			t.Errorf("Expected %s of %v, got %v", c.name, c.want, c.got)
+		}
+	}
+}
+
+func TestTailPercentilesSingleProbe(t *testing.T) {
+	p := stats.TailPercentiles([]float64{12.5})
+	if p.P50 != 12.5 || p.P999 != 12.5 {
+		t.Errorf("Expected every percentile of one probe to be its delay, got %+v", p)
+	}
+}
+
+func TestHistogramBuckets(t *testing.T) {
+	h := stats.NewHistogram([]float64{35.2, 28.6, 29.1, 29.4, 28.5, 35.0}, 0.5)
+
+	if h.BucketWidth != 0.5 {
+		t.Errorf("Expected bucket width 0.5, got %v", h.BucketWidth)
+	}
+	want := []stats.HistogramBucket{{Lower: 28.5, Count: 2}, {Lower: 29, Count: 2}, {Lower: 35, Count: 2}}
+	if len(h.Buckets) != len(want) {
+		t.Fatalf("Expected %d non-empty buckets, got %+v", len(want), h.Buckets)
+	}
+	for i, b := range h.Buckets {
+		if b != want[i] {
+			t.Errorf("Expected bucket %d to be %+v, got %+v", i, want[i], b)
+		}
+	}
+}
+
+func TestHistogramNegativeDelays(t *testing.T) {
+	// Raw one-way delays go negative when the reflector's clock is behind
+	h := stats.NewHistogram([]float64{-0.2, -1.5, 0.3}, 1)
+
+	want := []stats.HistogramBucket{{Lower: -2, Count: 1}, {Lower: -1, Count: 1}, {Lower: 0, Count: 1}}
+	for i, b := range h.Buckets {
+		if b != want[i] {
+			t.Errorf("Expected bucket %d to be %+v, got %+v", i, want[i], b)
+		}
+	}
+}
+
+func TestValidateHistogramBucket(t *testing.T) {
+	for _, c := range []struct {
+		bucketMs float64
+		mode     string
+		ok       bool
+	}{
+		{0, "loss", true},
+		{0.5, "full", true},
+		{0.001, "full", true},
+		{10000, "full", true},
+		{0.5, "loss", false},
+		{0.5, "capacity", false},
+		{0.0001, "full", false},
+		{-1, "full", false},
+		{20000, "full", false},
+	} {
+		err := validateHistogramBucket(RunRequest{HistogramBucketMs: c.bucketMs}, c.mode)
+		if (err == nil) != c.ok {
+			t.Errorf("histogram_bucket_ms %v in %s mode: expected ok=%v, got %v", c.bucketMs, c.mode, c.ok, err)
+		}
+	}
+}
@@ -0,0 +1,278 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/tcaine/twamp"
+
+	"network-test-api/pkg/nettest"
+	"network-test-api/pkg/stats"
+)
+
+// TWAMP Light (RFC 5357 Appendix I): test packets go straight to the UDP port of
+// a reflector, without TWAMP-Control, as routers and SLA responders that only
+// implement the light mode expect. The packets are encoded and decoded here;
+// replies become the library's results, so full mode analyses them as those of
+// a negotiated test.
+const (
+	TWAMP_LIGHT_WAIT = 5 * time.Second // Wait for late replies after the last probe, the session timeout of negotiated tests
+)
+
+// twampProbeTest is what full mode needs of a test, negotiated or TWAMP Light
+type twampProbeTest interface {
+	GetConnection() *net.UDPConn
+	RunMultiple(count uint64, callback twamp.TwampTestCallbackFunction, interval time.Duration, done <-chan bool) (*twamp.PingResults, error)
+}
+
+// validateTwampLight checks twamp_light, which only full mode supports
+func validateTwampLight(req RunRequest, mode string) error {
+	switch {
+	case !req.TwampLight:
+		return nil
+	case mode != TWAMP_MODE_FULL:
+		return fmt.Errorf("twamp_light is only available in full mode")
+	case req.AddressFamily == nettest.FAMILY_COMPARE:
+		return fmt.Errorf("address_family compare is not available with twamp_light")
+	}
+	return nil
+}
+
+// twampLightTest sends the test packets of a TWAMP Light run from a socket
+// connected to the reflector
+type twampLightTest struct {
+	conn *net.UDPConn
+	pkt  []byte // Test packet, rewritten per probe
+
+	mu   sync.Mutex
+	sent []time.Time // Send times by sequence number
+}
+
+// dialTwampLight resolves host and connects a test socket to the reflector's
+// UDP port through the source binding, trying the addresses in Happy Eyeballs
+// order until one is routable
+func dialTwampLight(ctx context.Context, host string, port int, family string, padding int, timeout time.Duration, bind *nettest.SourceBinding) (*twampLightTest, *nettest.DialReport, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	resolveStart := time.Now()
+	v6, v4, err := nettest.ResolveFamiliesFrom(ctx, host, family, bind)
+	if err != nil {
+		return nil, nil, err
+	}
+	addrs := nettest.InterleaveFamilies(v6, v4)
+	report := &nettest.DialReport{Mode: family, ResolveMs: float64(time.Since(resolveStart).Microseconds()) / 1000, Attempts: make([]nettest.DialAttempt, 0, len(addrs))}
+	dialer := bind.Dialer("udp", 0)
+	dialCtx := nettest.WithDialedName(ctx, host)
+	var conn net.Conn
+	for _, ip := range addrs {
+		address := net.JoinHostPort(ip.String(), strconv.Itoa(port))
+		t0 := time.Now()
+		err = bind.InNamespace(func() error {
+			var err error
+			conn, err = dialer.DialContext(dialCtx, "udp", address)
+			return err
+		})
+		attempt := nettest.DialAttempt{Family: nettest.IPFamily(ip), Address: address, ConnectMs: float64(time.Since(t0).Microseconds()) / 1000}
+		if err != nil {
+			attempt.Error = err.Error()
+			report.Attempts = append(report.Attempts, attempt)
+			continue
+		}
+		attempt.Won = true
+		report.Attempts = append(report.Attempts, attempt)
+		report.Family, report.Address, report.ConnectMs = attempt.Family, address, attempt.ConnectMs
+		if v4 := nettest.NAT64Embedded(ip); v4 != nil {
+			report.NAT64 = true
+			report.IPv4Address = v4.String()
+		}
+		break
+	}
+	if conn == nil {
+		if err == nil {
+			err = fmt.Errorf("no addresses to dial")
+		}
+		return nil, report, err
+	}
+
+	udp := conn.(*net.UDPConn)
+	// The reflector's socket options suit the sender as well: TTL 255, so the
+	// reflector's TTL tells the forward hops, and the TTL of replies reported
+	if err := prepareReflector(udp, 0); err != nil {
+		_ = udp.Close()
+		return nil, report, fmt.Errorf("preparing the test socket: %w", err)
+	}
+	t := &twampLightTest{conn: udp, pkt: make([]byte, TWAMP_BASE_PACKET_SIZE+padding)}
+	if _, err := rand.Read(t.pkt[TWAMP_BASE_PACKET_SIZE:]); err != nil {
+		_ = udp.Close()
+		return nil, report, fmt.Errorf("generating padding: %w", err)
+	}
+	return t, report, nil
+}
+
+// GetConnection returns the test socket
+func (t *twampLightTest) GetConnection() *net.UDPConn {
+	return t.conn
+}
+
+// encodeLightProbe writes the sequence number, send time and error estimate of
+// an unauthenticated test packet (RFC 5357 section 4.1.2). The packet is sent
+// 41 bytes long and more, the size of the reply header, so reflectors that
+// truncate the padding by 27 bytes reply with packets as long as the probes.
+func encodeLightProbe(pkt []byte, seq uint32, sent time.Time, errorEstimate uint16) {
+	binary.BigEndian.PutUint32(pkt[0:4], seq)
+	putNTPTime(pkt[4:12], sent)
+	binary.BigEndian.PutUint16(pkt[12:14], errorEstimate)
+}
+
+// getNTPTime decodes an RFC 5357 timestamp, the inverse of putNTPTime
+func getNTPTime(b []byte) time.Time {
+	return ntpTime(twamp.TwampTimestamp{Integer: binary.BigEndian.Uint32(b[0:4]), Fraction: binary.BigEndian.Uint32(b[4:8])})
+}
+
+// decodeLightReply reads a reflected unauthenticated test packet (RFC 5357
+// section 4.2.1) into the fields of a result the reflector sets
+func decodeLightReply(pkt []byte, r *twamp.TwampResults) error {
+	if len(pkt) < twampReflectedHeader {
+		return fmt.Errorf("expected at least %d bytes, got %d", twampReflectedHeader, len(pkt))
+	}
+	r.SeqNum = binary.BigEndian.Uint32(pkt[0:4])
+	r.Timestamp = getNTPTime(pkt[4:12])
+	r.ErrorEstimate = binary.BigEndian.Uint16(pkt[12:14])
+	r.ReceiveTimestamp = getNTPTime(pkt[16:24])
+	r.SenderSeqNum = binary.BigEndian.Uint32(pkt[24:28])
+	r.SenderTimestamp = getNTPTime(pkt[28:36])
+	r.SenderErrorEstimate = binary.BigEndian.Uint16(pkt[36:38])
+	r.SenderTTL = pkt[40]
+	return nil
+}
+
+// RunMultiple sends count probes interval apart and collects their replies as
+// the library does for negotiated tests: lost probes have no result, further
+// replies to a probe are flagged duplicate. done is not used; the run ends
+// when the socket is closed.
+func (t *twampLightTest) RunMultiple(count uint64, callback twamp.TwampTestCallbackFunction, interval time.Duration, done <-chan bool) (*twamp.PingResults, error) {
+	t.sent = make([]time.Time, count)
+	results := &twamp.PingResults{Stat: &twamp.PingResultStats{}}
+	readDone := make(chan struct{})
+	_ = t.conn.SetReadDeadline(time.Time{})
+	go func() {
+		defer close(readDone)
+		results.Results = t.readReplies(count, callback)
+	}()
+
+	errorEstimate := nettest.CalculateErrorEstimate()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	var sendErr error
+	var transmitted uint64
+	for ; transmitted < count; transmitted++ {
+		if transmitted > 0 {
+			<-ticker.C
+		}
+		if sendErr = t.send(uint32(transmitted), errorEstimate); sendErr != nil {
+			break
+		}
+	}
+
+	_ = t.conn.SetReadDeadline(time.Now().Add(TWAMP_LIGHT_WAIT))
+	<-readDone
+	if sendErr != nil {
+		return nil, fmt.Errorf("sending probe %d: %w", transmitted, sendErr)
+	}
+	lightStats(results, transmitted)
+	return results, nil
+}
+
+// send sends probe seq, stamped with the time it leaves
+func (t *twampLightTest) send(seq uint32, errorEstimate uint16) error {
+	now := time.Now()
+	t.mu.Lock()
+	t.sent[seq] = now
+	t.mu.Unlock()
+	encodeLightProbe(t.pkt, seq, now, errorEstimate)
+	_, err := t.conn.Write(t.pkt)
+	return err
+}
+
+// readReplies reads replies until each of count probes got one or the read
+// deadline passes
+func (t *twampLightTest) readReplies(count uint64, callback twamp.TwampTestCallbackFunction) []*twamp.TwampResults {
+	var replies []*twamp.TwampResults
+	replied := make([]bool, count)
+	var received uint64
+	buf := make([]byte, len(t.pkt)+64)
+	oob := make([]byte, 128)
+	for received < count {
+		n, _, ttl, err := readWithTTL(t.conn, buf, oob)
+		finished := time.Now()
+		if err != nil {
+			var netErr net.Error
+			if (errors.As(err, &netErr) && netErr.Timeout()) || errors.Is(err, net.ErrClosed) {
+				break
+			}
+			continue
+		}
+		r := &twamp.TwampResults{ReceivedTTL: ttl, FinishedTimestamp: finished}
+		if decodeLightReply(buf[:n], r) != nil || uint64(r.SenderSeqNum) >= count {
+			continue
+		}
+		t.mu.Lock()
+		r.SentTimestamp = t.sent[r.SenderSeqNum]
+		t.mu.Unlock()
+		if r.SentTimestamp.IsZero() {
+			continue // Not sent by this run
+		}
+		r.SenderSize, r.SenderPaddingSize = len(t.pkt), len(t.pkt)-TWAMP_BASE_PACKET_SIZE
+		if replied[r.SenderSeqNum] {
+			r.IsDuplicate = true
+		} else {
+			replied[r.SenderSeqNum] = true
+			received++
+		}
+		replies = append(replies, r)
+		if callback != nil {
+			callback(r)
+		}
+	}
+	return replies
+}
+
+// lightStats fills in the RTT and loss summary of a run from its replies,
+// timed on the monotonic clock. The standard deviation is the population one
+// of pkg/twampstats, accumulated in one pass.
+func lightStats(results *twamp.PingResults, transmitted uint64) {
+	stat := results.Stat
+	stat.Transmitted = transmitted
+	var rtts stats.Welford
+	for _, r := range results.Results {
+		if r.IsDuplicate {
+			stat.Duplicates++
+			continue
+		}
+		rtt := r.FinishedTimestamp.Sub(r.SentTimestamp)
+		if rtts.Count() == 0 || rtt < stat.Min {
+			stat.Min = rtt
+		}
+		if rtt > stat.Max {
+			stat.Max = rtt
+		}
+		rtts.Add(float64(rtt))
+	}
+	stat.Received = uint64(rtts.Count())
+	if transmitted > 0 {
+		stat.Loss = float64(transmitted-stat.Received) / float64(transmitted) * 100
+	}
+	if rtts.Count() == 0 {
+		return
+	}
+	stat.Avg = time.Duration(rtts.Mean())
+	stat.StdDev = time.Duration(rtts.StdDev())
+}
@@ -0,0 +1,116 @@
+package api
+
+import (
+	"testing"
+	"time"
+
+	"github.com/tcaine/twamp"
+
+	"network-test-api/pkg/twampstats"
+)
+
+func TestLightProbeReflected(t *testing.T) {
+	sent := time.Date(2026, 10, 14, 9, 0, 0, 250000000, time.UTC)
+	received := sent.Add(12 * time.Millisecond)
+	reflected := received.Add(40 * time.Microsecond)
+
+	pkt := make([]byte, 41+100)
+	encodeLightProbe(pkt, 7, sent, 0x8001)
+	out := make([]byte, 65536)
+	reply := reflectPacket(out, pkt, 3, 0x8002, received, 250)
+	putNTPTime(reply[4:12], reflected)
+
+	if len(reply) != len(pkt) {
+		t.Errorf("Expected a reply as long as the %d byte probe, got %d bytes", len(pkt), len(reply))
+	}
+	r := &twamp.TwampResults{}
+	if err := decodeLightReply(reply, r); err != nil {
+		t.Fatal(err)
+	}
+	if r.SeqNum != 3 || r.SenderSeqNum != 7 {
+		t.Errorf("Expected reflector seq 3 and sender seq 7, got %d and %d", r.SeqNum, r.SenderSeqNum)
+	}
+	if r.ErrorEstimate != 0x8002 || r.SenderErrorEstimate != 0x8001 {
+		t.Errorf("Expected error estimates 0x8002 and 0x8001, got 0x%04X and 0x%04X", r.ErrorEstimate, r.SenderErrorEstimate)
+	}
+	if r.SenderTTL != 250 {
+		t.Errorf("Expected sender TTL 250, got %d", r.SenderTTL)
+	}
+	for _, c := range []struct {
+		name      string
+		got, want time.Time
+	}{
+		{"T1", r.SenderTimestamp, sent},
+		{"T2", r.ReceiveTimestamp, received},
+		{"T3", r.Timestamp, reflected},
+	} {
+		if d := c.got.Sub(c.want); d < -time.Microsecond || d > time.Microsecond {
+			t.Errorf("Expected %s %v, got %v", c.name, c.want, c.got)
+		}
+	}
+}
+
+func TestLightReplyTooShort(t *testing.T) {
+	if err := decodeLightReply(make([]byte, 40), &twamp.TwampResults{}); err == nil {
+		t.Error("Expected a 40 byte reply to be rejected")
+	}
+}
+
+func TestValidateTwampLight(t *testing.T) {
+	for _, c := range []struct {
+		light        bool
+		mode, family string
+		ok           bool
+	}{
+		{false, "loss", "compare", true},
+		{true, "full", "auto", true},
+		{true, "full", "ipv6", true},
+		{true, "loss", "auto", false},
+		{true, "capacity", "auto", false},
+		{true, "full", "compare", false},
+	} {
+		err := validateTwampLight(RunRequest{TwampLight: c.light, AddressFamily: c.family}, c.mode)
+		if (err == nil) != c.ok {
+			t.Errorf("twamp_light=%v in %s mode over %s: expected ok=%v, got %v", c.light, c.mode, c.family, c.ok, err)
+		}
+	}
+}
+
+func TestLightStats_MatchesTwampstats(t *testing.T) {
+	// Long RTTs with a spread of microseconds, where E[X²] - E[X]² loses precision
+	start := time.Now()
+	results := &twamp.PingResults{Stat: &twamp.PingResultStats{}}
+	var probes []twampstats.PacketResult
+	for i, jitter := range []time.Duration{0, 3, 7, 2, 9, 4, 6, 1} {
+		rtt := 2*time.Second + jitter*time.Microsecond
+		sent := start.Add(time.Duration(i) * 10 * time.Millisecond)
+		results.Results = append(results.Results, &twamp.TwampResults{SentTimestamp: sent, FinishedTimestamp: sent.Add(rtt)})
+		probes = append(probes, twampstats.PacketResult{Seq: uint32(i), NetworkRTT: rtt})
+	}
+	results.Results = append(results.Results, &twamp.TwampResults{SentTimestamp: start, FinishedTimestamp: start.Add(time.Hour), IsDuplicate: true})
+
+	lightStats(results, 10)
+	stat := results.Stat
+	summary := twampstats.ProcessResults(probes)
+	if stat.StdDev != summary.NetworkRTTStdDev {
+		t.Errorf("Expected the stddev of twampstats, %v, got %v", summary.NetworkRTTStdDev, stat.StdDev)
+	}
+	if d := stat.Avg - summary.NetworkRTT.Avg; d < -time.Nanosecond || d > time.Nanosecond {
+		t.Errorf("Expected the mean of twampstats, %v, got %v", summary.NetworkRTT.Avg, stat.Avg)
+	}
+	if stat.Min != summary.NetworkRTT.Min || stat.Max != summary.NetworkRTT.Max {
+		t.Errorf("Expected min and max %v and %v, got %v and %v", summary.NetworkRTT.Min, summary.NetworkRTT.Max, stat.Min, stat.Max)
+	}
+	if stat.Received != 8 || stat.Duplicates != 1 || stat.Loss != 20 {
+		t.Errorf("Expected 8 received, 1 duplicate and 20%% loss, got %d, %d and %v", stat.Received, stat.Duplicates, stat.Loss)
+	}
+}
+
+func TestLightStats_NoReplies(t *testing.T) {
+	results := &twamp.PingResults{Stat: &twamp.PingResultStats{}}
+	lightStats(results, 5)
+	stat := results.Stat
+	if stat.Received != 0 || stat.Loss != 100 || stat.StdDev != 0 || stat.Avg != 0 {
+		t.Errorf("Expected all probes lost and no RTTs, got %+v", stat)
+	}
+}
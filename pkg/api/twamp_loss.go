@@ -0,0 +1,215 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/tcaine/twamp"
+
+	"network-test-api/pkg/nettest"
+	"network-test-api/pkg/stats"
+)
+
+// TWAMP measurement modes
+const (
+	TWAMP_MODE_FULL = "full" // Per-probe delay, jitter and clock analysis
+	TWAMP_MODE_LOSS = "loss" // Loss and reordering counters only, for high probe rates
+
+	DEFAULT_FULL_MODE_COUNT = 10 // One probe a second
+	DEFAULT_LOSS_MODE_COUNT = 10000
+	DEFAULT_LOSS_MODE_RATE  = 1000    // Packets per second
+	MAX_LOSS_MODE_RATE      = 20000   // Packets per second
+	MAX_LOSS_MODE_COUNT     = 1000000 // 125 KB of sequence bitmap
+
+	LOSS_MODE_TICK = time.Millisecond // Pacing granularity; probes due within a tick are sent back to back
+	LOSS_MODE_WAIT = 2 * time.Second  // Wait for late replies after the last probe
+
+	TWAMP_BASE_PACKET_SIZE = 41 // Unauthenticated test packet without padding
+)
+
+// parseTwampMode validates the request's TWAMP mode, defaulting to full
+func parseTwampMode(s string) (string, error) {
+	switch mode := strings.ToLower(s); mode {
+	case "":
+		return TWAMP_MODE_FULL, nil
+	case TWAMP_MODE_FULL, TWAMP_MODE_LOSS, TWAMP_MODE_CAPACITY, TWAMP_MODE_AVAILABLE, TWAMP_MODE_SWEEP:
+		return mode, nil
+	}
+	return "", fmt.Errorf("invalid mode %q (expected full, loss, capacity, available or sweep)", s)
+}
+
+// validateLossMode checks the probe rate and count of a loss mode request
+func validateLossMode(req RunRequest) error {
+	switch {
+	case req.Rate < 1 || req.Rate > MAX_LOSS_MODE_RATE:
+		return fmt.Errorf("rate must be between 1 and %d packets/s", MAX_LOSS_MODE_RATE)
+	case req.Count < 1 || req.Count > MAX_LOSS_MODE_COUNT:
+		return fmt.Errorf("count must be between 1 and %d in loss mode", MAX_LOSS_MODE_COUNT)
+	case req.Series:
+		return fmt.Errorf("series is not available in loss mode")
+	}
+	return nil
+}
+
+// LossBursts describes runs of consecutive lost probes and the loss model
+// fitted to them
+type (
+	LossBursts     = stats.LossBursts
+	GilbertElliott = stats.GilbertElliott
+)
+
+// Reordering is the distribution of how far behind reordered replies arrived
+type (
+	Reordering      = stats.Reordering
+	ReorderDistance = stats.ReorderDistance
+)
+
+// LossResult is the outcome of a loss-only TWAMP run
+type LossResult struct {
+	Sent             uint64     `json:"sent"`
+	Received         uint64     `json:"received"`
+	Lost             uint64     `json:"lost"`
+	LossPercent      float64    `json:"loss_percent"`
+	Duplicates       uint64     `json:"duplicates"`
+	Reordered        uint64     `json:"reordered"`
+	ReorderedPercent float64    `json:"reordered_percent"`
+	Reordering       Reordering `json:"reordering"`
+	LossBursts       LossBursts `json:"loss_bursts"`
+	RatePps          int        `json:"rate_pps"`
+	AchievedRatePps  float64    `json:"achieved_rate_pps"`
+	DurationSec      float64    `json:"duration_sec"`
+
+	ECN *nettest.UDPECNReport `json:"ecn,omitempty"` // Codepoints of the replies when probes were sent ECT(0)
+}
+
+// replySequences counts the replies of a full mode run by sequence number in
+// the order they arrived, for the duplicate and reordering counters loss mode has
+func replySequences(replies []*twamp.TwampResults, sent uint64) *stats.LossCounter {
+	counter := stats.NewLossCounter(int(sent))
+	for _, r := range replies {
+		if !r.FinishedTimestamp.IsZero() {
+			counter.Observe(r.SenderSeqNum)
+		}
+	}
+	return counter
+}
+
+// reorderedPercent is the share of distinct replies that arrived reordered
+func reorderedPercent(counter *stats.LossCounter) float64 {
+	if counter.Received() == 0 {
+		return 0
+	}
+	return float64(counter.Reordered()) / float64(counter.Received()) * 100
+}
+
+// Send count probes at rate packets/s and count the reflected sequence numbers.
+// No per-probe state is kept beyond the sequence bitmap. With ecn the probes are
+// marked ECT(0) and the codepoints of the replies are counted as well.
+func twampLossTest(test *twamp.TwampTest, count, rate int, ecn bool) (*LossResult, error) {
+	conn := test.GetConnection()
+	counter := stats.NewLossCounter(count)
+
+	var ecnReport *nettest.UDPECNReport
+	if ecn {
+		if err := nettest.SetECT(conn, test.GetSession().GetConfig().TOS); err != nil {
+			return nil, fmt.Errorf("marking probes ECT(0): %w", err)
+		}
+		ecnReport = nettest.NewUDPECNReport()
+	}
+
+	// Probe sequence numbers continue from any earlier test on the session,
+	// so the first probe goes out before the reader starts and fixes the base
+	start := time.Now()
+	base, err := test.SendProbe()
+	if err != nil {
+		return nil, fmt.Errorf("sending probe 0: %w", err)
+	}
+	sent := 1
+
+	// Reply reader, stopped by the read deadline set once sending is done
+	readDone := make(chan struct{})
+	_ = conn.SetReadDeadline(time.Time{})
+	go func() {
+		defer close(readDone)
+		buf := make([]byte, TWAMP_BASE_PACKET_SIZE+test.GetSession().GetConfig().Padding+64)
+		oob := make([]byte, 64)
+		for {
+			var n, codepoint int
+			var err error
+			if ecnReport != nil {
+				n, codepoint, err = nettest.ReadWithECN(conn, buf, oob)
+			} else {
+				n, err = conn.Read(buf)
+			}
+			if err != nil {
+				var netErr net.Error
+				if (errors.As(err, &netErr) && netErr.Timeout()) || errors.Is(err, net.ErrClosed) {
+					return
+				}
+				continue
+			}
+			seq, err := twamp.ParseSenderSequence(buf[:n])
+			if err != nil {
+				continue
+			}
+			counter.Observe(seq - base)
+			if ecnReport != nil {
+				ecnReport.Observe(codepoint)
+			}
+			if counter.Complete() {
+				return
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(LOSS_MODE_TICK)
+	defer ticker.Stop()
+	var sendErr error
+	for sent < count && sendErr == nil {
+		<-ticker.C
+		due := int(time.Since(start).Seconds()*float64(rate)) + 1
+		if due > count {
+			due = count
+		}
+		for ; sent < due; sent++ {
+			if _, sendErr = test.SendProbe(); sendErr != nil {
+				break
+			}
+		}
+	}
+	sendDuration := time.Since(start)
+
+	_ = conn.SetReadDeadline(time.Now().Add(LOSS_MODE_WAIT))
+	<-readDone
+	if sendErr != nil {
+		return nil, fmt.Errorf("sending probe %d: %w", sent, sendErr)
+	}
+
+	result := &LossResult{
+		Sent:        uint64(sent),
+		Received:    counter.Received(),
+		Lost:        uint64(sent) - counter.Received(),
+		Duplicates:  counter.Duplicates(),
+		Reordered:   counter.Reordered(),
+		Reordering:  counter.Reordering(),
+		LossBursts:  counter.Bursts(uint32(sent)),
+		LossPercent: float64(uint64(sent)-counter.Received()) / float64(sent) * 100,
+		RatePps:     rate,
+		DurationSec: time.Since(start).Seconds(),
+	}
+	result.ReorderedPercent = reorderedPercent(counter)
+	if s := sendDuration.Seconds(); s > 0 && sent > 1 {
+		result.AchievedRatePps = float64(sent-1) / s
+	}
+	if ecnReport != nil {
+		ecnReport.Finish()
+		result.ECN = ecnReport
+		log.Printf("TWAMP loss: ECN replies %d ECT(0), %d ECT(1), %d CE, %d Not-ECT", ecnReport.ECT0, ecnReport.ECT1, ecnReport.CE, ecnReport.NotECT)
+	}
+	log.Printf("TWAMP loss: %d sent, %d received, %.3f%% loss, %d reordered", result.Sent, result.Received, result.LossPercent, result.Reordered)
+	return result, nil
+}
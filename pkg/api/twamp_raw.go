@@ -0,0 +1,84 @@
+package api
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/tcaine/twamp"
+
+	"network-test-api/pkg/nettest"
+)
+
+// TwampRawProbe is one probe of a full mode run as include_raw returns it,
+// for tools that compute their own statistics
+type TwampRawProbe struct {
+	Seq  uint32 `json:"seq"`
+	Lost bool   `json:"lost"`
+	*TwampRawReply
+}
+
+// TwampRawReply holds the timestamps and delays of a reply, nil for a lost probe
+type TwampRawReply struct {
+	SentAt              time.Time `json:"sent_at"`               // T1, sender clock
+	ReflectorReceivedAt time.Time `json:"reflector_received_at"` // T2, reflector clock
+	ReflectorSentAt     time.Time `json:"reflector_sent_at"`     // T3, reflector clock
+	ReceivedAt          time.Time `json:"received_at"`           // T4, sender clock
+
+	RTTMs        float64 `json:"rtt_ms"`               // T4-T1 on the monotonic clock
+	NetworkRTTMs float64 `json:"network_rtt_ms"`       // RTT without the reflector's turnaround
+	ForwardRawMs float64 `json:"forward_delay_raw_ms"` // T2-T1, includes the clock offset
+	ReverseRawMs float64 `json:"reverse_delay_raw_ms"` // T4-T3
+	SenderTTL    int     `json:"sender_ttl"`           // TTL the probe reached the reflector with, sent as 255
+	ReceivedTTL  int     `json:"received_ttl"`         // TTL the reply arrived with
+	ClockStep    bool    `json:"clock_step,omitempty"` // A clock stepped: excluded from the statistics
+	Duplicate    bool    `json:"duplicate,omitempty"`  // A further reply to an answered probe
+}
+
+// validateIncludeRaw checks include_raw, which only full mode supports
+func validateIncludeRaw(req RunRequest, mode string) error {
+	if req.IncludeRaw && mode != TWAMP_MODE_FULL {
+		return fmt.Errorf("include_raw is only available in full mode")
+	}
+	return nil
+}
+
+// rawProbes lists the sent probes by sequence number, the replies of a
+// run with their timings and the others as lost. Duplicate replies follow
+// the first.
+func rawProbes(start time.Time, replies []*twamp.TwampResults, sent uint64) []TwampRawProbe {
+	probes := make([]TwampRawProbe, 0, sent)
+	replied := make(map[uint32]bool, len(replies))
+	for _, r := range replies {
+		if r.FinishedTimestamp.IsZero() {
+			continue
+		}
+		timing := nettest.ComputeProbeTiming(start, r)
+		sentAt := r.SentTimestamp
+		if sentAt.IsZero() {
+			sentAt = r.SenderTimestamp
+		}
+		probes = append(probes, TwampRawProbe{Seq: r.SenderSeqNum, TwampRawReply: &TwampRawReply{
+			SentAt:              sentAt.UTC(),
+			ReflectorReceivedAt: r.ReceiveTimestamp.UTC(),
+			ReflectorSentAt:     r.Timestamp.UTC(),
+			ReceivedAt:          r.FinishedTimestamp.UTC(),
+			RTTMs:               durationMs(timing.RTT),
+			NetworkRTTMs:        durationMs(timing.NetworkRTT),
+			ForwardRawMs:        durationMs(timing.RawForward),
+			ReverseRawMs:        durationMs(timing.RawReverse),
+			SenderTTL:           int(r.SenderTTL),
+			ReceivedTTL:         r.ReceivedTTL,
+			ClockStep:           timing.Stepped(),
+			Duplicate:           r.IsDuplicate,
+		}})
+		replied[r.SenderSeqNum] = true
+	}
+	for seq := uint32(0); uint64(seq) < sent; seq++ {
+		if !replied[seq] {
+			probes = append(probes, TwampRawProbe{Seq: seq, Lost: true})
+		}
+	}
+	sort.SliceStable(probes, func(i, j int) bool { return probes[i].Seq < probes[j].Seq })
+	return probes
+}
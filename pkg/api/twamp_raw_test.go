@@ -0,0 +1,81 @@
+package api
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tcaine/twamp"
+)
+
+type testReply struct {
+	seq       uint32
+	rtt       float64
+	duplicate bool
+}
+
+// rawReplies builds the results of replies to probes sent 100ms apart from start
+func rawReplies(start time.Time, replies []testReply) []*twamp.TwampResults {
+	results := make([]*twamp.TwampResults, 0, len(replies))
+	for _, r := range replies {
+		sent := start.Add(time.Duration(r.seq) * 100 * time.Millisecond)
+		results = append(results, &twamp.TwampResults{
+			SenderSeqNum:      r.seq,
+			SentTimestamp:     sent,
+			FinishedTimestamp: sent.Add(time.Duration(r.rtt * float64(time.Millisecond))),
+			IsDuplicate:       r.duplicate,
+		})
+	}
+	return results
+}
+
+func TestRawProbesOrderAndLoss(t *testing.T) {
+	replies := []testReply{{0, 10, false}, {3, 13, false}, {2, 12, false}, {3, 14, true}}
+	start := time.Now()
+	probes := rawProbes(start, rawReplies(start, replies), 5)
+
+	want := []struct {
+		seq       uint32
+		lost      bool
+		duplicate bool
+	}{
+		{0, false, false},
+		{1, true, false},
+		{2, false, false},
+		{3, false, false},
+		{3, false, true},
+		{4, true, false},
+	}
+	if len(probes) != len(want) {
+		t.Fatalf("Expected %d records, got %d", len(want), len(probes))
+	}
+	for i, w := range want {
+		p := probes[i]
+		if p.Seq != w.seq || p.Lost != w.lost {
+			t.Errorf("Record %d: expected seq %d lost=%v, got seq %d lost=%v", i, w.seq, w.lost, p.Seq, p.Lost)
+		}
+		if p.Lost != (p.TwampRawReply == nil) {
+			t.Errorf("Record %d: expected timings only on replies", i)
+		}
+		if !p.Lost && p.Duplicate != w.duplicate {
+			t.Errorf("Record %d: expected duplicate=%v, got %v", i, w.duplicate, p.Duplicate)
+		}
+	}
+}
+
+func TestRawProbeLostJSON(t *testing.T) {
+	start := time.Now()
+	raw, err := json.Marshal(rawProbes(start, nil, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(raw); got != `[{"seq":0,"lost":true}]` {
+		t.Errorf("Expected a lost probe to have only seq and lost, got %s", got)
+	}
+
+	raw, _ = json.Marshal(rawProbes(start, rawReplies(start, []testReply{{0, 12.5, false}}), 1))
+	if !strings.Contains(string(raw), `"rtt_ms":12.5`) {
+		t.Errorf("Expected the reply's fields inline, got %s", raw)
+	}
+}
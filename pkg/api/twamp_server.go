@@ -0,0 +1,738 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"network-test-api/pkg/nettest"
+)
+
+// TWAMP Session-Reflector (RFC 5357): the responder side, so perfSONAR or another
+// instance of this API can measure towards this agent. Only unauthenticated mode
+// is offered.
+const (
+	DEFAULT_TWAMP_SERVER_PORT  = 862
+	DEFAULT_TWAMP_MAX_SESSIONS = 16
+	MAX_TWAMP_SESSIONS         = 256
+	DEFAULT_TWAMP_SERVWAIT     = 900  // Seconds a control connection may stay idle (RFC 5357 SERVWAIT)
+	DEFAULT_TWAMP_REFWAIT      = 900  // Seconds a test session may go without packets (RFC 5357 REFWAIT)
+	MAX_TWAMP_WAIT             = 3600 // Seconds
+	MAX_TWAMP_REFLECT_PADDING  = 65000
+)
+
+// TWAMP-Control messages (RFC 4656 section 3, RFC 5357 section 3)
+const (
+	twampModeUnauthenticated = 1
+
+	twampCmdStartSessions  = 2
+	twampCmdStopSessions   = 3
+	twampCmdRequestSession = 5
+
+	twampAcceptOK             = 0
+	twampAcceptFailure        = 1
+	twampAcceptNotSupported   = 3
+	twampAcceptTemporaryLimit = 5
+
+	twampGreetingBytes   = 64
+	twampSetupBytes      = 164
+	twampCommandBytes    = 32 // Start-Sessions and Stop-Sessions; Request-TW-Session is longer
+	twampRequestBytes    = 112
+	twampSenderHeader    = 14 // Sequence, timestamp and error estimate of an unauthenticated test packet
+	twampReflectedHeader = 41
+)
+
+// Reflector session states
+const (
+	REFLECTOR_STATE_NEGOTIATED = "negotiated" // Accepted, waiting for Start-Sessions
+	REFLECTOR_STATE_REFLECTING = "reflecting"
+)
+
+// TwampServerConfig is the body of POST /twamp/server/start
+type TwampServerConfig struct {
+	Address     string `json:"address"`      // Listen address (default: all)
+	Port        int    `json:"port"`         // TWAMP-Control port (default: 862)
+	MaxSessions int    `json:"max_sessions"` // Concurrent test sessions, and control connections (default: 16)
+	ServwaitSec int    `json:"servwait_sec"` // Idle control connection timeout (default: 900)
+	RefwaitSec  int    `json:"refwait_sec"`  // Test session inactivity timeout (default: 900)
+}
+
+// validate checks the bounds of a reflector configuration, filling in defaults
+func (c *TwampServerConfig) validate() error {
+	if c.Port == 0 {
+		c.Port = DEFAULT_TWAMP_SERVER_PORT
+	}
+	if c.MaxSessions == 0 {
+		c.MaxSessions = DEFAULT_TWAMP_MAX_SESSIONS
+	}
+	if c.ServwaitSec == 0 {
+		c.ServwaitSec = DEFAULT_TWAMP_SERVWAIT
+	}
+	if c.RefwaitSec == 0 {
+		c.RefwaitSec = DEFAULT_TWAMP_REFWAIT
+	}
+	switch {
+	case c.Address != "" && net.ParseIP(c.Address) == nil:
+		return fmt.Errorf("address must be an IP address")
+	case c.Port < 1 || c.Port > 65535:
+		return fmt.Errorf("port must be between 1 and 65535")
+	case c.MaxSessions < 1 || c.MaxSessions > MAX_TWAMP_SESSIONS:
+		return fmt.Errorf("max_sessions must be between 1 and %d", MAX_TWAMP_SESSIONS)
+	case c.ServwaitSec < 1 || c.ServwaitSec > MAX_TWAMP_WAIT:
+		return fmt.Errorf("servwait_sec must be between 1 and %d", MAX_TWAMP_WAIT)
+	case c.RefwaitSec < 1 || c.RefwaitSec > MAX_TWAMP_WAIT:
+		return fmt.Errorf("refwait_sec must be between 1 and %d", MAX_TWAMP_WAIT)
+	}
+	return nil
+}
+
+// TwampServerStatus is the state of the reflector in GET /twamp/server
+type TwampServerStatus struct {
+	Running            bool                    `json:"running"`
+	Listen             string                  `json:"listen,omitempty"`
+	Config             *TwampServerConfig      `json:"config,omitempty"`
+	StartedAt          *time.Time              `json:"started_at,omitempty"`
+	StoppedAt          *time.Time              `json:"stopped_at,omitempty"`
+	ControlConnections int                     `json:"control_connections"`
+	ConnectionsTotal   uint64                  `json:"connections_total"`
+	SessionsTotal      uint64                  `json:"sessions_total"`
+	SessionsRejected   uint64                  `json:"sessions_rejected"` // Refused at max_sessions
+	PacketsReflected   uint64                  `json:"packets_reflected"`
+	Sessions           []*ReflectorSessionInfo `json:"sessions"`
+}
+
+// ReflectorSessionInfo describes one test session negotiated with the reflector
+type ReflectorSessionInfo struct {
+	SID              string     `json:"sid"`
+	Client           string     `json:"client"` // TWAMP-Control peer
+	SenderPort       int        `json:"sender_port"`
+	ReceiverPort     int        `json:"receiver_port"` // Port the reflector listens on
+	PaddingBytes     int        `json:"padding_bytes"`
+	DSCP             int        `json:"dscp"`
+	State            string     `json:"state"`
+	CreatedAt        time.Time  `json:"created_at"`
+	LastPacketAt     *time.Time `json:"last_packet_at,omitempty"`
+	PacketsReflected uint64     `json:"packets_reflected"`
+	PacketsDiscarded uint64     `json:"packets_discarded"` // Too short, or from another host than the client
+}
+
+// twampSessionRequest holds the fields of a Request-TW-Session the reflector uses
+type twampSessionRequest struct {
+	ipVersion    int
+	senderPort   int
+	receiverPort int
+	padding      int
+	typeP        uint32
+}
+
+// parseTwampSessionRequest decodes a 112 byte Request-TW-Session (RFC 5357 section 3.5)
+func parseTwampSessionRequest(b []byte) twampSessionRequest {
+	return twampSessionRequest{
+		ipVersion:    int(b[1] & 0x0f),
+		senderPort:   int(binary.BigEndian.Uint16(b[12:14])),
+		receiverPort: int(binary.BigEndian.Uint16(b[14:16])),
+		padding:      int(binary.BigEndian.Uint32(b[64:68])),
+		typeP:        binary.BigEndian.Uint32(b[84:88]),
+	}
+}
+
+// typePDSCP reads the DSCP of a Type-P Descriptor, which RFC 4656 puts in its low
+// six bits. Values above 63 are read as a TOS byte, which is how this API's client
+// (and the library it uses) fills the descriptor.
+func typePDSCP(desc uint32) int {
+	if desc > 63 && desc <= 255 {
+		return int(desc >> 2)
+	}
+	return int(desc & 0x3f)
+}
+
+// putNTPTime encodes t as an RFC 5357 timestamp, the inverse of ntpTime
+func putNTPTime(b []byte, t time.Time) {
+	const ntpToUnix = 2208988800
+	binary.BigEndian.PutUint32(b, uint32(t.Unix()+ntpToUnix))
+	binary.BigEndian.PutUint32(b[4:], uint32((uint64(t.Nanosecond())<<32)/1e9))
+}
+
+// reflectPacket builds the reply to an unauthenticated test packet (RFC 5357
+// section 4.2.1) in out, except for the transmit timestamp the caller adds right
+// before sending. The reply is at least 41 bytes and otherwise as long as the
+// packet, with the packet's padding past byte 41 echoed, so senders with a 14
+// byte header get back the truncated padding RFC 5357 describes and senders with
+// the 41 byte header a reply of their own size.
+func reflectPacket(out, pkt []byte, seq uint32, errorEstimate uint16, received time.Time, ttl int) []byte {
+	size := len(pkt)
+	if size < twampReflectedHeader {
+		size = twampReflectedHeader
+	}
+	out = out[:size]
+	binary.BigEndian.PutUint32(out[0:4], seq)
+	binary.BigEndian.PutUint16(out[12:14], errorEstimate)
+	out[14], out[15] = 0, 0
+	putNTPTime(out[16:24], received)
+	copy(out[24:38], pkt[:twampSenderHeader]) // Sender sequence, timestamp and error estimate
+	out[38], out[39] = 0, 0
+	out[40] = 0
+	if ttl > 0 && ttl <= 255 {
+		out[40] = byte(ttl)
+	}
+	if len(pkt) > twampReflectedHeader {
+		copy(out[twampReflectedHeader:], pkt[twampReflectedHeader:])
+	}
+	return out
+}
+
+// twampGreeting builds the Server Greeting offering unauthenticated mode
+func twampGreeting() []byte {
+	b := make([]byte, twampGreetingBytes)
+	binary.BigEndian.PutUint32(b[12:16], twampModeUnauthenticated)
+	_, _ = rand.Read(b[16:48]) // Challenge and salt, unused without authentication
+	binary.BigEndian.PutUint32(b[48:52], 1024)
+	return b
+}
+
+// twampServerStartMessage builds the Server-Start message
+func twampServerStartMessage(accept byte, start time.Time) []byte {
+	b := make([]byte, 48)
+	b[15] = accept
+	putNTPTime(b[32:40], start)
+	return b
+}
+
+// twampAcceptSession builds the Accept-Session reply to a Request-TW-Session
+func twampAcceptSession(accept byte, port int, sid []byte) []byte {
+	b := make([]byte, 48)
+	b[0] = accept
+	binary.BigEndian.PutUint16(b[2:4], uint16(port))
+	copy(b[4:20], sid)
+	return b
+}
+
+// newTwampSID builds a session identifier from the receiver address, the time
+// and random bits (RFC 4656 section 3.5)
+func newTwampSID(receiver net.IP, now time.Time) []byte {
+	sid := make([]byte, 16)
+	if v4 := receiver.To4(); v4 != nil {
+		copy(sid[0:4], v4)
+	} else if len(receiver) == net.IPv6len {
+		copy(sid[0:4], receiver[12:16])
+	}
+	putNTPTime(sid[4:12], now)
+	_, _ = rand.Read(sid[12:16])
+	return sid
+}
+
+// reflectorSession is one negotiated test session and its UDP socket
+type reflectorSession struct {
+	mu        sync.Mutex
+	info      ReflectorSessionInfo
+	control   net.Conn
+	clientIP  net.IP
+	conn      *net.UDPConn
+	started   bool
+	closed    bool
+	lastReply time.Time
+}
+
+func (sess *reflectorSession) snapshot() *ReflectorSessionInfo {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	c := sess.info
+	if !sess.lastReply.IsZero() {
+		last := sess.lastReply
+		c.LastPacketAt = &last
+	}
+	return &c
+}
+
+// active reports whether a started session reflected a packet within refwait
+func (sess *reflectorSession) active(now time.Time, refwait time.Duration) bool {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	return sess.started && !sess.closed && now.Sub(sess.lastReply) < refwait
+}
+
+// TwampServer is one run of the TWAMP-Control listener and its Session-Reflectors
+type TwampServer struct {
+	mu        sync.Mutex
+	config    TwampServerConfig
+	listener  net.Listener
+	startedAt time.Time
+	stoppedAt time.Time
+	stopped   bool
+	controls  map[net.Conn]bool
+	sessions  map[string]*reflectorSession // By SID
+
+	connectionsTotal uint64
+	sessionsTotal    uint64
+	sessionsRejected uint64
+	packetsReflected uint64
+}
+
+// TwampServerStore holds the reflector started with POST /twamp/server/start
+type TwampServerStore struct {
+	mu     sync.Mutex
+	server *TwampServer // The running or last stopped reflector
+}
+
+var twampServerStore = &TwampServerStore{}
+
+var errTwampServerRunning = errors.New("TWAMP server is already running")
+
+// Start opens the TWAMP-Control listener of a new reflector
+func (st *TwampServerStore) Start(config TwampServerConfig) (*TwampServerStatus, error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.server != nil && !st.server.isStopped() {
+		return nil, errTwampServerRunning
+	}
+	ln, err := net.Listen("tcp", net.JoinHostPort(config.Address, strconv.Itoa(config.Port)))
+	if err != nil {
+		return nil, fmt.Errorf("TWAMP-Control listener: %v", err)
+	}
+	s := &TwampServer{
+		config:    config,
+		listener:  ln,
+		startedAt: time.Now().UTC(),
+		controls:  make(map[net.Conn]bool),
+		sessions:  make(map[string]*reflectorSession),
+	}
+	st.server = s
+	logf(nil, "TWAMP server listening on %s", ln.Addr())
+	go s.serve()
+	return s.status(), nil
+}
+
+// Stop closes the running reflector with its control connections and sessions
+func (st *TwampServerStore) Stop() (*TwampServerStatus, bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.server == nil || st.server.isStopped() {
+		return nil, false
+	}
+	st.server.stop()
+	return st.server.status(), true
+}
+
+// Status reports the running reflector, or the counters of the last one
+func (st *TwampServerStore) Status() *TwampServerStatus {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.server == nil {
+		return &TwampServerStatus{Sessions: []*ReflectorSessionInfo{}}
+	}
+	return st.server.status()
+}
+
+func (s *TwampServer) isStopped() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stopped
+}
+
+func (s *TwampServer) stop() {
+	s.mu.Lock()
+	s.stopped = true
+	s.stoppedAt = time.Now().UTC()
+	controls := make([]net.Conn, 0, len(s.controls))
+	for conn := range s.controls {
+		controls = append(controls, conn)
+	}
+	sessions := make([]*reflectorSession, 0, len(s.sessions))
+	for _, sess := range s.sessions {
+		sessions = append(sessions, sess)
+	}
+	s.mu.Unlock()
+
+	s.listener.Close()
+	for _, conn := range controls {
+		conn.Close()
+	}
+	for _, sess := range sessions {
+		s.endSession(sess)
+	}
+	logf(nil, "TWAMP server on %s stopped", s.listener.Addr())
+}
+
+func (s *TwampServer) status() *TwampServerStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	config := s.config
+	startedAt := s.startedAt
+	st := &TwampServerStatus{
+		Running:            !s.stopped,
+		Listen:             s.listener.Addr().String(),
+		Config:             &config,
+		StartedAt:          &startedAt,
+		ControlConnections: len(s.controls),
+		ConnectionsTotal:   s.connectionsTotal,
+		SessionsTotal:      s.sessionsTotal,
+		SessionsRejected:   s.sessionsRejected,
+		PacketsReflected:   s.packetsReflected,
+		Sessions:           make([]*ReflectorSessionInfo, 0, len(s.sessions)),
+	}
+	if s.stopped {
+		stoppedAt := s.stoppedAt
+		st.StoppedAt = &stoppedAt
+	}
+	for _, sess := range s.sessions {
+		st.Sessions = append(st.Sessions, sess.snapshot())
+	}
+	sort.Slice(st.Sessions, func(i, j int) bool { return st.Sessions[i].CreatedAt.Before(st.Sessions[j].CreatedAt) })
+	return st
+}
+
+func (s *TwampServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			if !s.isStopped() {
+				warnf(nil, "TWAMP server: accept: %v", err)
+			}
+			return
+		}
+		if !s.addControl(conn) {
+			conn.Close()
+			continue
+		}
+		go s.control(conn)
+	}
+}
+
+// addControl registers a control connection, refusing it beyond max_sessions
+func (s *TwampServer) addControl(conn net.Conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stopped {
+		return false
+	}
+	if len(s.controls) >= s.config.MaxSessions {
+		warnf(nil, "TWAMP server: refusing control connection from %s, %d already open", conn.RemoteAddr(), len(s.controls))
+		return false
+	}
+	s.controls[conn] = true
+	s.connectionsTotal++
+	return true
+}
+
+// closeControl drops a control connection and ends the sessions it negotiated
+func (s *TwampServer) closeControl(conn net.Conn) {
+	conn.Close()
+	s.mu.Lock()
+	delete(s.controls, conn)
+	var sessions []*reflectorSession
+	for _, sess := range s.sessions {
+		if sess.control == conn {
+			sessions = append(sessions, sess)
+		}
+	}
+	s.mu.Unlock()
+	for _, sess := range sessions {
+		s.endSession(sess)
+	}
+}
+
+// controlSessions returns the sessions negotiated on a control connection
+func (s *TwampServer) controlSessions(conn net.Conn) []*reflectorSession {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var sessions []*reflectorSession
+	for _, sess := range s.sessions {
+		if sess.control == conn {
+			sessions = append(sessions, sess)
+		}
+	}
+	return sessions
+}
+
+// control runs one TWAMP-Control connection: greeting, mode negotiation, then
+// Request-TW-Session, Start-Sessions and Stop-Sessions commands until the client
+// closes it or it stays idle for servwait without a session reflecting
+func (s *TwampServer) control(conn net.Conn) {
+	defer s.closeControl(conn)
+	client := conn.RemoteAddr().String()
+	servwait := time.Duration(s.config.ServwaitSec) * time.Second
+	refwait := time.Duration(s.config.RefwaitSec) * time.Second
+
+	conn.SetDeadline(time.Now().Add(servwait))
+	if _, err := conn.Write(twampGreeting()); err != nil {
+		return
+	}
+	setup := make([]byte, twampSetupBytes)
+	if _, err := io.ReadFull(conn, setup); err != nil {
+		return
+	}
+	if mode := binary.BigEndian.Uint32(setup[0:4]); mode != twampModeUnauthenticated {
+		// Mode 0 is the client giving up; the others were not offered
+		warnf(nil, "TWAMP server: %s asked for mode %d, closing", client, mode)
+		return
+	}
+	if _, err := conn.Write(twampServerStartMessage(twampAcceptOK, time.Now())); err != nil {
+		return
+	}
+
+	cmd := make([]byte, twampRequestBytes)
+	for {
+		conn.SetDeadline(time.Now().Add(servwait))
+		if _, err := io.ReadFull(conn, cmd[:twampCommandBytes]); err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() && s.reflecting(conn, refwait) {
+				continue
+			}
+			if err != io.EOF && !s.isStopped() {
+				warnf(nil, "TWAMP server: control connection from %s: %v", client, err)
+			}
+			return
+		}
+		switch cmd[0] {
+		case twampCmdRequestSession:
+			if _, err := io.ReadFull(conn, cmd[twampCommandBytes:]); err != nil {
+				return
+			}
+			accept, port, sid := s.openSession(conn, parseTwampSessionRequest(cmd))
+			if _, err := conn.Write(twampAcceptSession(accept, port, sid)); err != nil {
+				return
+			}
+		case twampCmdStartSessions:
+			accept := byte(twampAcceptOK)
+			sessions := s.controlSessions(conn)
+			if len(sessions) == 0 {
+				accept = twampAcceptFailure
+			}
+			for _, sess := range sessions {
+				s.startSession(sess)
+			}
+			ack := make([]byte, twampCommandBytes)
+			ack[0] = accept
+			if _, err := conn.Write(ack); err != nil {
+				return
+			}
+		case twampCmdStopSessions:
+			for _, sess := range s.controlSessions(conn) {
+				s.endSession(sess)
+			}
+		default:
+			warnf(nil, "TWAMP server: unsupported command %d from %s, closing", cmd[0], client)
+			return
+		}
+	}
+}
+
+// reflecting reports whether a session of the control connection is still in use
+func (s *TwampServer) reflecting(conn net.Conn, refwait time.Duration) bool {
+	now := time.Now()
+	for _, sess := range s.controlSessions(conn) {
+		if sess.active(now, refwait) {
+			return true
+		}
+	}
+	return false
+}
+
+// openSession binds the UDP socket of a requested test session on the control
+// connection's local address, at the requested receiver port when it is free
+// and an ephemeral one otherwise
+func (s *TwampServer) openSession(control net.Conn, req twampSessionRequest) (byte, int, []byte) {
+	client := control.RemoteAddr().(*net.TCPAddr)
+	local := control.LocalAddr().(*net.TCPAddr)
+	switch {
+	case req.ipVersion != 4 && req.ipVersion != 6:
+		return twampAcceptNotSupported, 0, nil
+	case req.padding < 0 || req.padding > MAX_TWAMP_REFLECT_PADDING:
+		return twampAcceptNotSupported, 0, nil
+	}
+
+	s.mu.Lock()
+	if s.stopped || len(s.sessions) >= s.config.MaxSessions {
+		s.sessionsRejected++
+		s.mu.Unlock()
+		warnf(nil, "TWAMP server: refusing session from %s, %d sessions open", client, s.config.MaxSessions)
+		return twampAcceptTemporaryLimit, 0, nil
+	}
+	s.mu.Unlock()
+
+	udp, err := net.ListenUDP("udp", &net.UDPAddr{IP: local.IP, Port: req.receiverPort})
+	if err != nil && req.receiverPort != 0 {
+		udp, err = net.ListenUDP("udp", &net.UDPAddr{IP: local.IP})
+	}
+	if err != nil {
+		errorf(nil, "TWAMP server: session socket for %s: %v", client, err)
+		return twampAcceptFailure, 0, nil
+	}
+	dscp := typePDSCP(req.typeP)
+	if err := prepareReflector(udp, dscp<<2); err != nil {
+		warnf(nil, "TWAMP server: reflector socket options: %v", err)
+	}
+	port := udp.LocalAddr().(*net.UDPAddr).Port
+	now := time.Now().UTC()
+	sid := newTwampSID(local.IP, now)
+	sess := &reflectorSession{
+		info: ReflectorSessionInfo{
+			SID:          hex.EncodeToString(sid),
+			Client:       client.String(),
+			SenderPort:   req.senderPort,
+			ReceiverPort: port,
+			PaddingBytes: req.padding,
+			DSCP:         dscp,
+			State:        REFLECTOR_STATE_NEGOTIATED,
+			CreatedAt:    now,
+		},
+		control:  control,
+		clientIP: client.IP,
+		conn:     udp,
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stopped {
+		udp.Close()
+		return twampAcceptFailure, 0, nil
+	}
+	s.sessions[sess.info.SID] = sess
+	s.sessionsTotal++
+	logf(nil, "TWAMP server: session %s from %s reflecting on port %d", sess.info.SID, client, port)
+	return twampAcceptOK, port, sid
+}
+
+// startSession starts reflecting a negotiated session's packets
+func (s *TwampServer) startSession(sess *reflectorSession) {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	if sess.started || sess.closed {
+		return
+	}
+	sess.started = true
+	sess.lastReply = time.Now()
+	sess.info.State = REFLECTOR_STATE_REFLECTING
+	go s.reflect(sess)
+}
+
+// endSession closes a session's socket and forgets it
+func (s *TwampServer) endSession(sess *reflectorSession) {
+	sess.mu.Lock()
+	if sess.closed {
+		sess.mu.Unlock()
+		return
+	}
+	sess.closed = true
+	sess.conn.Close()
+	reflected := sess.info.PacketsReflected
+	sess.mu.Unlock()
+
+	s.mu.Lock()
+	delete(s.sessions, sess.info.SID)
+	s.mu.Unlock()
+	logf(nil, "TWAMP server: session %s ended after %d packets", sess.info.SID, reflected)
+}
+
+// reflect answers the test packets of a session from the client's address until
+// the session ends or receives nothing for refwait
+func (s *TwampServer) reflect(sess *reflectorSession) {
+	defer s.endSession(sess)
+	refwait := time.Duration(s.config.RefwaitSec) * time.Second
+	errorEstimate := nettest.CalculateErrorEstimate()
+	buf := make([]byte, 65536)
+	out := make([]byte, 65536)
+	oob := make([]byte, 128)
+	var seq uint32
+
+	for {
+		sess.conn.SetReadDeadline(time.Now().Add(refwait))
+		n, addr, ttl, err := readWithTTL(sess.conn, buf, oob)
+		received := time.Now()
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				warnf(nil, "TWAMP server: session %s idle for %ds", sess.info.SID, s.config.RefwaitSec)
+			}
+			return
+		}
+		if n < twampSenderHeader || !addr.IP.Equal(sess.clientIP) {
+			sess.mu.Lock()
+			sess.info.PacketsDiscarded++
+			sess.mu.Unlock()
+			continue
+		}
+
+		reply := reflectPacket(out, buf[:n], seq, errorEstimate, received, ttl)
+		putNTPTime(reply[4:12], time.Now())
+		if _, err := sess.conn.WriteToUDP(reply, addr); err != nil {
+			sess.mu.Lock()
+			sess.info.PacketsDiscarded++
+			sess.mu.Unlock()
+			continue
+		}
+		seq++
+
+		sess.mu.Lock()
+		sess.info.PacketsReflected++
+		sess.lastReply = received
+		sess.mu.Unlock()
+		s.mu.Lock()
+		s.packetsReflected++
+		s.mu.Unlock()
+	}
+}
+
+func reflectorStart(w http.ResponseWriter, r *http.Request) {
+	var config TwampServerConfig
+	if err := json.NewDecoder(r.Body).Decode(&config); err != nil && err != io.EOF {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := config.validate(); err != nil {
+		jsonResponse(w, ApiResponse{
+			Status: "error",
+			Error:  err.Error(),
+		}, http.StatusBadRequest)
+		return
+	}
+
+	status, err := twampServerStore.Start(config)
+	if err != nil {
+		code := http.StatusInternalServerError
+		if errors.Is(err, errTwampServerRunning) {
+			code = http.StatusConflict
+		}
+		jsonResponse(w, ApiResponse{
+			Status: "error",
+			Error:  err.Error(),
+		}, code)
+		return
+	}
+	jsonResponse(w, ApiResponse{
+		Status: "ok",
+		Data:   status,
+	}, http.StatusOK)
+}
+
+func reflectorStop(w http.ResponseWriter, r *http.Request) {
+	status, ok := twampServerStore.Stop()
+	if !ok {
+		jsonResponse(w, ApiResponse{
+			Status: "error",
+			Error:  "TWAMP server is not running",
+		}, http.StatusConflict)
+		return
+	}
+	jsonResponse(w, ApiResponse{
+		Status: "ok",
+		Data:   status,
+	}, http.StatusOK)
+}
+
+func reflectorStatus(w http.ResponseWriter, r *http.Request) {
+	jsonResponse(w, ApiResponse{
+		Status: "ok",
+		Data:   twampServerStore.Status(),
+	}, http.StatusOK)
+}
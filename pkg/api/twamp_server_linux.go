@@ -0,0 +1,60 @@
+//go:build linux
+
+package api
+
+import (
+	"errors"
+	"net"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+
+	"network-test-api/pkg/nettest"
+)
+
+// prepareReflector makes a reflector socket send with TTL 255 and tos, as RFC
+// 5357 asks of a Session-Reflector, and report the TTL of received packets
+func prepareReflector(conn *net.UDPConn, tos int) error {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+	v6 := nettest.IsIPv6Addr(conn.LocalAddr())
+	var opErr error
+	err = raw.Control(func(fd uintptr) {
+		level, opts := unix.IPPROTO_IP, [][2]int{{unix.IP_TTL, 255}, {unix.IP_TOS, tos}, {unix.IP_RECVTTL, 1}}
+		if v6 {
+			level, opts = unix.IPPROTO_IPV6, [][2]int{{unix.IPV6_UNICAST_HOPS, 255}, {unix.IPV6_TCLASS, tos}, {unix.IPV6_RECVHOPLIMIT, 1}}
+		}
+		for _, opt := range opts {
+			opErr = errors.Join(opErr, unix.SetsockoptInt(int(fd), level, opt[0], opt[1]))
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return opErr
+}
+
+// readWithTTL reads a datagram from a socket prepared by prepareReflector and
+// returns the TTL or hop limit it arrived with, -1 if the kernel did not report one
+func readWithTTL(conn *net.UDPConn, buf, oob []byte) (int, *net.UDPAddr, int, error) {
+	n, oobn, _, addr, err := conn.ReadMsgUDP(buf, oob)
+	if err != nil {
+		return n, addr, -1, err
+	}
+	msgs, err := unix.ParseSocketControlMessage(oob[:oobn])
+	if err != nil {
+		return n, addr, -1, nil
+	}
+	for _, m := range msgs {
+		if len(m.Data) < 4 {
+			continue
+		}
+		if (m.Header.Level == unix.IPPROTO_IP && m.Header.Type == unix.IP_TTL) ||
+			(m.Header.Level == unix.IPPROTO_IPV6 && m.Header.Type == unix.IPV6_HOPLIMIT) {
+			return n, addr, int(*(*int32)(unsafe.Pointer(&m.Data[0]))), nil
+		}
+	}
+	return n, addr, -1, nil
+}
@@ -0,0 +1,15 @@
+//go:build !linux
+
+package api
+
+import "net"
+
+// The TTL of received test packets is only read on Linux; elsewhere the reflector
+// reports it as 0 (unknown) and replies with the system's default TTL and class.
+
+func prepareReflector(conn *net.UDPConn, tos int) error { return nil }
+
+func readWithTTL(conn *net.UDPConn, buf, oob []byte) (int, *net.UDPAddr, int, error) {
+	n, addr, err := conn.ReadFromUDP(buf)
+	return n, addr, -1, err
+}
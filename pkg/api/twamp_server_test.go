@@ -0,0 +1,67 @@
+package api
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+func TestPutNTPTimeRoundTrip(t *testing.T) {
+	want := time.Date(2026, 3, 1, 12, 0, 0, 750000000, time.UTC)
+	b := make([]byte, 8)
+	putNTPTime(b, want)
+	if frac := binary.BigEndian.Uint32(b[4:]); frac != 3<<30 {
+		t.Errorf("Expected a fraction of 0x%08X for 0.75 s, got 0x%08X", uint32(3<<30), frac)
+	}
+	if got := getNTPTime(b); got.Sub(want).Abs() > time.Nanosecond {
+		t.Errorf("Expected %v, got %v", want, got.UTC())
+	}
+}
+
+func TestTypePDSCP(t *testing.T) {
+	tests := []struct {
+		desc uint32
+		want int
+	}{
+		{0, 0},
+		{46, 46},  // RFC 4656: DSCP in the low six bits
+		{184, 46}, // A TOS byte, as this API's client sends it
+		{40, 40},
+	}
+	for _, tt := range tests {
+		if got := typePDSCP(tt.desc); got != tt.want {
+			t.Errorf("Expected DSCP %d for descriptor %d, got %d", tt.want, tt.desc, got)
+		}
+	}
+}
+
+func TestReflectPacket(t *testing.T) {
+	received := time.Unix(1770000000, 0)
+	out := make([]byte, 2048)
+
+	// 14 byte sender header with 50 bytes of padding: reflected as 64 bytes
+	pkt := append([]byte{0, 0, 0, 7, 1, 2, 3, 4, 5, 6, 7, 8, 0x80, 0x01}, bytes.Repeat([]byte{'P'}, 50)...)
+	reply := reflectPacket(out, pkt, 3, 0x0010, received, 61)
+	if len(reply) != 64 {
+		t.Errorf("Expected a 64 byte reply, got %d", len(reply))
+	}
+	if seq := binary.BigEndian.Uint32(reply[0:4]); seq != 3 {
+		t.Errorf("Expected reflector sequence 3, got %d", seq)
+	}
+	if !bytes.Equal(reply[24:38], pkt[:14]) {
+		t.Errorf("Expected the sender header echoed at byte 24, got %x", reply[24:38])
+	}
+	if reply[40] != 61 {
+		t.Errorf("Expected sender TTL 61, got %d", reply[40])
+	}
+	if got := getNTPTime(reply[16:24]); !got.Equal(received) {
+		t.Errorf("Expected receive timestamp %v, got %v", received, got)
+	}
+
+	// A bare header is answered with the 41 byte reflected header and unknown TTL
+	reply = reflectPacket(out, pkt[:14], 4, 0, received, -1)
+	if len(reply) != 41 || reply[40] != 0 {
+		t.Errorf("Expected 41 bytes with TTL 0, got %d bytes with TTL %d", len(reply), reply[40])
+	}
+}
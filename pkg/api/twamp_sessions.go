@@ -0,0 +1,132 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/tcaine/twamp"
+
+	"network-test-api/pkg/nettest"
+)
+
+// Concurrent sessions: one full mode run of several test sessions, requested
+// over a single TWAMP-Control connection and started by one Start-Sessions
+// command, so their probes cross the path at the same time. Each session has
+// its own DSCP and padding and its own result; side by side they show how the
+// path treats QoS classes or packet sizes under identical conditions.
+const (
+	MAX_CONCURRENT_SESSIONS = 8
+)
+
+// TwampSessionSpec is one test session of a sessions request
+type TwampSessionSpec struct {
+	Name    string `json:"name"`    // Label returned with the session's result
+	DSCP    int    `json:"dscp"`    // DSCP code point of the session's probes, also sent as its Type-P Descriptor (default: 0)
+	Padding int    `json:"padding"` // Padding of the session's probes in bytes (default: 0)
+}
+
+// validateTwampSessions checks sessions, which only full mode over
+// TWAMP-Control supports
+func validateTwampSessions(req RunRequest, mode string) error {
+	switch {
+	case len(req.Sessions) == 0:
+		return nil
+	case mode != TWAMP_MODE_FULL:
+		return fmt.Errorf("sessions is only available in full mode")
+	case len(req.Sessions) > MAX_CONCURRENT_SESSIONS:
+		return fmt.Errorf("sessions takes at most %d sessions", MAX_CONCURRENT_SESSIONS)
+	case req.TwampLight:
+		return fmt.Errorf("sessions is not available with twamp_light")
+	}
+	names := make(map[string]bool, len(req.Sessions))
+	for i, s := range req.Sessions {
+		switch {
+		case s.DSCP < 0 || s.DSCP > 63:
+			return fmt.Errorf("sessions[%d]: dscp must be between 0 and 63", i)
+		case s.Padding < 0 || s.Padding > MAX_TWAMP_PADDING:
+			return fmt.Errorf("sessions[%d]: padding must be between 0 and %d bytes", i, MAX_TWAMP_PADDING)
+		case s.Name != "" && names[s.Name]:
+			return fmt.Errorf("sessions lists the name %q twice", s.Name)
+		}
+		names[s.Name] = true
+	}
+	return nil
+}
+
+// twampSessionSpecs lists the sessions to request: those of sessions, whose
+// DSCP and padding replace the request's, or one with the request's
+func twampSessionSpecs(req RunRequest) []TwampSessionSpec {
+	if len(req.Sessions) > 0 {
+		return req.Sessions
+	}
+	return []TwampSessionSpec{{DSCP: req.DSCP, Padding: req.Padding}}
+}
+
+// runTwampSessions runs the started tests of a sessions request at once, one
+// full mode run each, and returns their results in the order requested. A
+// session that fails reports its error in its place; the run fails when all
+// of them do.
+func runTwampSessions(ctx context.Context, req RunRequest, seriesOpts SeriesOptions, controlConn net.Conn, bind *nettest.SourceBinding, tests []*twamp.TwampTest) ([]map[string]interface{}, error) {
+	// Prepare every socket first so the sessions start probing together
+	dscps := make([]int, len(tests))
+	for i, test := range tests {
+		spec := req.Sessions[i]
+		if err := bind.BindConn(test.GetConnection()); err != nil {
+			return nil, fmt.Errorf("Binding to interface %s failed: %v", req.Interface, err)
+		}
+		tos, err := nettest.SetProbeTOS(test.GetConnection(), spec.DSCP<<2)
+		if err != nil {
+			return nil, fmt.Errorf("Setting DSCP %d failed: %v", spec.DSCP, err)
+		}
+		dscps[i] = tos >> 2
+		stop := context.AfterFunc(ctx, func() { _ = test.GetConnection().Close() })
+		defer stop()
+	}
+
+	results := make([]map[string]interface{}, len(tests))
+	errs := make([]error, len(tests))
+	var wg sync.WaitGroup
+	for i, test := range tests {
+		wg.Add(1)
+		go func(i int, test *twamp.TwampTest) {
+			defer wg.Done()
+			spec := req.Sessions[i]
+			localAddr := test.GetConnection().LocalAddr().String()
+			remoteAddr := test.GetConnection().RemoteAddr().String()
+			testStart := time.Now()
+			run, err := test.RunMultiple(uint64(req.Count), nil, time.Second, nil)
+			if errs[i] = twampError(ctx, "Test run failed", err); errs[i] != nil {
+				results[i] = map[string]interface{}{"error": errs[i].Error(), "code": errorCode(errs[i])}
+			} else {
+				results[i] = twampFullData(req, seriesOpts, testStart, run, controlConn, test.GetConnection())
+				results[i]["local_endpoint"] = localAddr
+				results[i]["remote_endpoint"] = remoteAddr
+			}
+			results[i]["dscp"] = dscps[i]
+			results[i]["padding"] = spec.Padding
+			if spec.Name != "" {
+				results[i]["name"] = spec.Name
+			}
+		}(i, test)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err == nil {
+			return results, nil
+		}
+	}
+	return nil, errs[0]
+}
+
+// maxSessionPadding returns the largest padding of the sessions
+func maxSessionPadding(specs []TwampSessionSpec) int {
+	padding := 0
+	for _, spec := range specs {
+		padding = max(padding, spec.Padding)
+	}
+	return padding
+}
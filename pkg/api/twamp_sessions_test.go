@@ -0,0 +1,33 @@
+package api
+
+import (
+	"testing"
+)
+
+func TestValidateTwampSessions(t *testing.T) {
+	classes := []TwampSessionSpec{{Name: "be"}, {Name: "voice", DSCP: 46}, {Name: "video", DSCP: 34, Padding: 1000}}
+	nine := make([]TwampSessionSpec, 9)
+	for _, c := range []struct {
+		name     string
+		sessions []TwampSessionSpec
+		mode     string
+		light    bool
+		ok       bool
+	}{
+		{"none", nil, "loss", false, true},
+		{"classes", classes, "full", false, true},
+		{"unnamed twins", []TwampSessionSpec{{DSCP: 46}, {DSCP: 46}}, "full", false, true},
+		{"loss mode", classes, "loss", false, false},
+		{"sweep mode", classes, "sweep", false, false},
+		{"too many", nine, "full", false, false},
+		{"twamp light", classes, "full", true, false},
+		{"dscp out of range", []TwampSessionSpec{{DSCP: 64}}, "full", false, false},
+		{"negative padding", []TwampSessionSpec{{Padding: -1}}, "full", false, false},
+		{"duplicate name", []TwampSessionSpec{{Name: "ef", DSCP: 46}, {Name: "ef"}}, "full", false, false},
+	} {
+		err := validateTwampSessions(RunRequest{Sessions: c.sessions, TwampLight: c.light}, c.mode)
+		if (err == nil) != c.ok {
+			t.Errorf("%s: expected ok=%v, got %v", c.name, c.ok, err)
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"network-test-api/pkg/nettest"
+	"network-test-api/pkg/stats"
+)
+
+// Sweep mode: one full mode run per padding size, back to back under the
+// same target lock, compared by size. Loss that appears only above some
+// size points at an MTU problem; the growth of the minimum RTT with the
+// packet size is the serialization delay of the path's links.
+const (
+	TWAMP_MODE_SWEEP = "sweep"
+
+	MAX_SWEEP_SIZES = 16
+
+	// Loss this many percentage points above the smallest size's is size dependent
+	SWEEP_LOSS_THRESHOLD = 5.0
+)
+
+// defaultSweepPaddings are swept without padding_sizes: a bare probe, a
+// medium one and one near a 1500-byte MTU
+var defaultSweepPaddings = []int{0, 500, 1400}
+
+// validateSweepMode checks the padding sizes of a sweep mode request
+func validateSweepMode(req RunRequest) error {
+	if len(req.PaddingSizes) > MAX_SWEEP_SIZES {
+		return fmt.Errorf("padding_sizes takes at most %d sizes", MAX_SWEEP_SIZES)
+	}
+	seen := make(map[int]bool, len(req.PaddingSizes))
+	for _, p := range req.PaddingSizes {
+		switch {
+		case p < 0 || p > MAX_TWAMP_PADDING:
+			return fmt.Errorf("padding_sizes must be between 0 and %d bytes", MAX_TWAMP_PADDING)
+		case seen[p]:
+			return fmt.Errorf("padding_sizes lists %d twice", p)
+		}
+		seen[p] = true
+	}
+	if req.DualStack != "" {
+		return fmt.Errorf("dual_stack is not available in sweep mode")
+	}
+	return validateLockWait(&req)
+}
+
+// SweepStep is the run of one padding size
+type SweepStep struct {
+	Padding     int     `json:"padding"`
+	PacketBytes int     `json:"packet_bytes"` // IP packet size of the probes
+	ID          string  `json:"id,omitempty"` // Stored full mode result of the run
+	LossPercent float64 `json:"loss_percent"`
+	RTTMinMs    float64 `json:"rtt_min_ms"`
+	RTTAvgMs    float64 `json:"rtt_avg_ms"`
+	RTTMaxMs    float64 `json:"rtt_max_ms"`
+	RTTP95Ms    float64 `json:"rtt_p95_ms"`
+	Error       string  `json:"error,omitempty"` // The run failed
+	Code        string  `json:"code,omitempty"`
+}
+
+// SweepSummary compares the steps of a sweep
+type SweepSummary struct {
+	SizeDependentLoss      bool    `json:"size_dependent_loss"`                // A larger size lost SWEEP_LOSS_THRESHOLD points more than the smallest
+	FirstLossyPacketBytes  int     `json:"first_lossy_packet_bytes,omitempty"` // Smallest packet size with size dependent loss
+	RTTIncreaseMs          float64 `json:"rtt_increase_ms"`                    // Minimum RTT of the largest size over that of the smallest
+	SerializationUsPerByte float64 `json:"serialization_us_per_byte"`          // Least-squares slope of the minimum RTT over the packet size
+}
+
+// newSweepStep summarises the result data of a step's run
+func newSweepStep(padding int, data map[string]interface{}, err error) SweepStep {
+	step := SweepStep{Padding: padding, PacketBytes: TWAMP_BASE_PACKET_SIZE + padding + nettest.UDP_WIRE_HEADER + nettest.IPV4_HEADER_SIZE}
+	if err != nil {
+		step.Error, step.Code = err.Error(), errorCode(err)
+		return step
+	}
+	if dial, ok := data["dial"].(*nettest.DialReport); ok && dial.Family == nettest.FAMILY_IPV6 {
+		step.PacketBytes += nettest.IPV6_HEADER_SIZE - nettest.IPV4_HEADER_SIZE
+	}
+	step.ID, _ = data["id"].(string)
+	step.LossPercent, _ = metricValue(data, "loss_percent")
+	step.RTTMinMs, _ = metricValue(data, "rtt_min_ms")
+	step.RTTAvgMs, _ = metricValue(data, "rtt_avg_ms")
+	step.RTTMaxMs, _ = metricValue(data, "rtt_max_ms")
+	if p, ok := data["percentiles_ms"].(LatencyPercentiles); ok {
+		step.RTTP95Ms = p.RTT.P95
+	}
+	return step
+}
+
+// summarizeSweep compares the steps that ran: loss against the smallest
+// size's, and the minimum RTT of those that got replies
+func summarizeSweep(steps []SweepStep) SweepSummary {
+	var s SweepSummary
+	var ran, replied []SweepStep
+	for _, step := range steps {
+		if step.Error != "" {
+			continue
+		}
+		ran = append(ran, step)
+		if step.LossPercent < 100 {
+			replied = append(replied, step)
+		}
+	}
+	if len(ran) == 0 {
+		return s
+	}
+
+	smallest := sweepSmallest(ran)
+	for _, step := range ran {
+		if step.PacketBytes > smallest.PacketBytes && step.LossPercent-smallest.LossPercent >= SWEEP_LOSS_THRESHOLD {
+			s.SizeDependentLoss = true
+			if s.FirstLossyPacketBytes == 0 || step.PacketBytes < s.FirstLossyPacketBytes {
+				s.FirstLossyPacketBytes = step.PacketBytes
+			}
+		}
+	}
+
+	if len(replied) == 0 {
+		return s
+	}
+	sizes := make([]float64, len(replied))
+	rtts := make([]float64, len(replied))
+	largest := replied[0]
+	for i, step := range replied {
+		sizes[i], rtts[i] = float64(step.PacketBytes), step.RTTMinMs
+		if step.PacketBytes > largest.PacketBytes {
+			largest = step
+		}
+	}
+	s.RTTIncreaseMs = largest.RTTMinMs - sweepSmallest(replied).RTTMinMs
+	if slope, ok := stats.Slope(sizes, rtts); ok {
+		s.SerializationUsPerByte = slope * 1000
+	}
+	return s
+}
+
+// sweepSmallest returns the step of the smallest packet size
+func sweepSmallest(steps []SweepStep) SweepStep {
+	smallest := steps[0]
+	for _, step := range steps[1:] {
+		if step.PacketBytes < smallest.PacketBytes {
+			smallest = step
+		}
+	}
+	return smallest
+}
+
+// runPaddingSweep runs an already defaulted sweep mode request as one full
+// mode run per padding size. Each run is stored on its own; the target stays
+// locked from the first run to the last, as for dual-stack runs.
+func runPaddingSweep(req RunRequest, profile *Profile) (map[string]interface{}, int, error) {
+	if err := validateSweepMode(req); err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	paddings := req.PaddingSizes
+	if len(paddings) == 0 {
+		paddings = defaultSweepPaddings
+	}
+
+	lock, release, status, err := lockTest(TEST_TYPE_TWAMP, req, false)
+	if err != nil {
+		return nil, status, err
+	}
+	defer release()
+
+	logf(req.ctx, "TWAMP padding sweep: %s:%d (%v bytes)", req.ServerHost, req.ServerPort, paddings)
+
+	start := time.Now()
+	steps := make([]SweepStep, 0, len(paddings))
+	var firstErr error
+	firstStatus, failed := 0, 0
+	for _, padding := range paddings {
+		r := req
+		r.Mode, r.Padding, r.PaddingSizes, r.AllowConcurrent = TWAMP_MODE_FULL, padding, nil, true
+		r.progress = nil // Samples of the runs would interleave
+		data, status, err := runTwamp(r, profile)
+		if status == http.StatusBadRequest {
+			// The other sizes would be rejected alike
+			return nil, status, fmt.Errorf("padding %d: %w", padding, err)
+		}
+		if err != nil {
+			if failed == 0 {
+				firstErr, firstStatus = err, status
+			}
+			failed++
+		}
+		steps = append(steps, newSweepStep(padding, data, err))
+		if req.runContext().Err() != nil {
+			break // Ended early: the remaining sizes would fail alike
+		}
+	}
+	if failed == len(steps) {
+		return nil, firstStatus, firstErr
+	}
+
+	data := map[string]interface{}{
+		"server":       req.ServerHost,
+		"port":         req.ServerPort,
+		"mode":         TWAMP_MODE_SWEEP,
+		"duration_sec": time.Since(start).Seconds(),
+		"steps":        steps,
+		"summary":      summarizeSweep(steps),
+		"lock":         lock,
+	}
+	if profile != nil {
+		data["profile"] = profile.Name
+	}
+	return data, http.StatusOK, nil
+}
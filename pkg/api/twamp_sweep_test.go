@@ -0,0 +1,64 @@
+package api
+
+import (
+	"math"
+	"testing"
+
+	"network-test-api/pkg/stats"
+)
+
+func TestSlope(t *testing.T) {
+	// 0.16 µs per byte on top of a 28.4 ms base RTT
+	xs := []float64{69, 569, 1469}
+	ys := make([]float64, len(xs))
+	for i, x := range xs {
+		ys[i] = 28.4 + x*0.00016
+	}
+	slope, ok := stats.Slope(xs, ys)
+	if !ok || math.Abs(slope-0.00016) > 1e-12 {
+		t.Errorf("Expected a slope of 0.00016 ms per byte, got %v (ok=%v)", slope, ok)
+	}
+}
+
+func TestSlopeNeedsDistinctX(t *testing.T) {
+	for _, c := range []struct {
+		name   string
+		xs, ys []float64
+	}{
+		{"one point", []float64{69}, []float64{28}},
+		{"same size", []float64{69, 69}, []float64{28, 29}},
+		{"length mismatch", []float64{69, 569}, []float64{28}},
+	} {
+		if _, ok := stats.Slope(c.xs, c.ys); ok {
+			t.Errorf("%s: expected no slope", c.name)
+		}
+	}
+}
+
+// sweepStep is a step of packetBytes that lost lossPercent, or failed
+func sweepStep(packetBytes int, lossPercent float64, failed bool) SweepStep {
+	step := SweepStep{PacketBytes: packetBytes, LossPercent: lossPercent}
+	if failed {
+		step.Error = "target unreachable"
+	}
+	return step
+}
+
+func TestSweepSizeDependentLoss(t *testing.T) {
+	for _, c := range []struct {
+		name  string
+		steps []SweepStep
+		want  int
+	}{
+		{"no loss", []SweepStep{sweepStep(69, 0, false), sweepStep(569, 0, false), sweepStep(1469, 0, false)}, 0},
+		{"loss on every size", []SweepStep{sweepStep(69, 20, false), sweepStep(569, 22, false), sweepStep(1469, 21, false)}, 0},
+		{"large sizes lost", []SweepStep{sweepStep(1469, 100, false), sweepStep(69, 0, false), sweepStep(1069, 100, false), sweepStep(569, 1, false)}, 1069},
+		{"failed step ignored", []SweepStep{sweepStep(69, 0, false), sweepStep(569, 0, true), sweepStep(1469, 100, false)}, 1469},
+		{"below threshold", []SweepStep{sweepStep(69, 1, false), sweepStep(1469, 5.5, false)}, 0},
+	} {
+		summary := summarizeSweep(c.steps)
+		if summary.FirstLossyPacketBytes != c.want || summary.SizeDependentLoss != (c.want != 0) {
+			t.Errorf("%s: expected first lossy size %d, got %d", c.name, c.want, summary.FirstLossyPacketBytes)
+		}
+	}
+}
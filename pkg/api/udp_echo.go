@@ -0,0 +1,377 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"golang.org/x/net/ipv4"
+)
+
+// UDP echo probes: ping tests with protocol echo send sequence-numbered,
+// timestamped datagrams of their own to a UDP echo responder, for paths that
+// carry neither TWAMP nor ICMP. The responder is the agent's own, started with
+// POST /echo/server/start, or any RFC 862 echo server.
+//
+// A probe is a 24-byte header, padded with zeros to packet_size:
+//
+//	0  magic "NTAE"
+//	4  kind: 0 request, 1 reply
+//	5  reserved (3 bytes)
+//	8  token, random per test
+//	12 sequence number
+//	16 send time, Unix nanoseconds
+const (
+	DEFAULT_ECHO_PORT = 7 // RFC 862
+	ECHO_HEADER_SIZE  = 24
+
+	echoKindRequest = 0
+	echoKindReply   = 1
+)
+
+var echoMagic = []byte("NTAE")
+
+// echoProbe encodes the probe seq of a test with a payload of size bytes
+func echoProbe(token uint32, seq, size int, sent time.Time) []byte {
+	b := make([]byte, max(size, ECHO_HEADER_SIZE))
+	copy(b[0:4], echoMagic)
+	b[4] = echoKindRequest
+	binary.BigEndian.PutUint32(b[8:12], token)
+	binary.BigEndian.PutUint32(b[12:16], uint32(seq))
+	binary.BigEndian.PutUint64(b[16:24], uint64(sent.UnixNano()))
+	return b
+}
+
+// parseEchoReply returns the sequence number of a probe of the test with token
+// that came back, from the agent's responder or verbatim from an RFC 862 one
+func parseEchoReply(b []byte, token uint32) (int, bool) {
+	if len(b) < ECHO_HEADER_SIZE || string(b[0:4]) != string(echoMagic) || b[4] > echoKindReply {
+		return 0, false
+	}
+	if binary.BigEndian.Uint32(b[8:12]) != token {
+		return 0, false // Another test's, or a late reply to an earlier one
+	}
+	return int(binary.BigEndian.Uint32(b[12:16])), true
+}
+
+// echoReply marks a probe request as a reply in place, and reports false for
+// any other datagram, replies included
+func echoReply(pkt []byte) bool {
+	if len(pkt) < ECHO_HEADER_SIZE || string(pkt[0:4]) != string(echoMagic) || pkt[4] != echoKindRequest {
+		return false
+	}
+	pkt[4] = echoKindReply
+	return true
+}
+
+// echoProber sends every probe from one connected socket and reads the ones
+// that come back
+type echoProber struct {
+	conn    *net.UDPConn
+	token   uint32
+	size    int
+	refused atomic.Int64 // Port unreachable errors the socket reported
+	results chan pingAnswer
+	done    chan struct{}
+}
+
+func newEchoProber(dst *net.UDPAddr, ttl, size int) (*echoProber, error) {
+	network := "udp4"
+	if dst.IP.To4() == nil {
+		network = "udp6"
+	}
+	conn, err := net.DialUDP(network, nil, dst)
+	if err != nil {
+		return nil, err
+	}
+	if network == "udp4" {
+		err = ipv4.NewConn(conn).SetTTL(ttl)
+	} else {
+		err = setIPv6HopLimit(conn, ttl)
+	}
+	if err != nil && ttl != DEFAULT_PING_TTL {
+		conn.Close()
+		return nil, fmt.Errorf("setting ttl: %v", err)
+	}
+	var token [4]byte
+	_, _ = rand.Read(token[:])
+	p := &echoProber{
+		conn:    conn,
+		token:   binary.BigEndian.Uint32(token[:]),
+		size:    size,
+		results: make(chan pingAnswer, 64),
+		done:    make(chan struct{}),
+	}
+	go p.read()
+	return p, nil
+}
+
+func (p *echoProber) send(seq int) error {
+	_, err := p.conn.Write(echoProbe(p.token, seq, p.size, time.Now()))
+	if errors.Is(err, syscall.ECONNREFUSED) {
+		p.refused.Add(1) // An earlier probe's port unreachable, reported on this write
+		return nil
+	}
+	return err
+}
+
+func (p *echoProber) read() {
+	buf := make([]byte, max(p.size, ECHO_HEADER_SIZE)+1024)
+	for {
+		n, err := p.conn.Read(buf)
+		at := time.Now()
+		switch {
+		case errors.Is(err, syscall.ECONNREFUSED):
+			p.refused.Add(1)
+			continue
+		case err != nil:
+			return // Closed
+		}
+		seq, ok := parseEchoReply(buf[:n], p.token)
+		if !ok {
+			continue
+		}
+		select {
+		case p.results <- pingAnswer{seq: seq, status: PING_STATUS_REPLY, at: at}:
+		case <-p.done:
+			return
+		}
+	}
+}
+
+func (p *echoProber) answers() <-chan pingAnswer { return p.results }
+
+func (p *echoProber) close() {
+	close(p.done)
+	p.conn.Close()
+}
+
+// EchoServerConfig is the body of POST /echo/server/start
+type EchoServerConfig struct {
+	Address string `json:"address"` // Listen address (default: all)
+	Port    int    `json:"port"`    // UDP port (default: 7)
+}
+
+// validate checks a responder configuration, filling in defaults
+func (c *EchoServerConfig) validate() error {
+	if c.Port == 0 {
+		c.Port = DEFAULT_ECHO_PORT
+	}
+	switch {
+	case c.Address != "" && net.ParseIP(c.Address) == nil:
+		return fmt.Errorf("address must be an IP address")
+	case c.Port < 1 || c.Port > 65535:
+		return fmt.Errorf("port must be between 1 and 65535")
+	}
+	return nil
+}
+
+// EchoServerStatus is the state of the responder in GET /echo/server
+type EchoServerStatus struct {
+	Running          bool              `json:"running"`
+	Listen           string            `json:"listen,omitempty"`
+	Config           *EchoServerConfig `json:"config,omitempty"`
+	StartedAt        *time.Time        `json:"started_at,omitempty"`
+	StoppedAt        *time.Time        `json:"stopped_at,omitempty"`
+	LastPacketAt     *time.Time        `json:"last_packet_at,omitempty"`
+	PacketsEchoed    uint64            `json:"packets_echoed"`
+	PacketsDiscarded uint64            `json:"packets_discarded"` // Not an echo probe request, so replies never bounce between two responders
+}
+
+// EchoServer is one run of the UDP echo responder
+type EchoServer struct {
+	mu           sync.Mutex
+	config       EchoServerConfig
+	conn         *net.UDPConn
+	startedAt    time.Time
+	stoppedAt    time.Time
+	lastPacketAt time.Time
+	stopped      bool
+
+	packetsEchoed    uint64
+	packetsDiscarded uint64
+}
+
+// EchoServerStore holds the responder started with POST /echo/server/start
+type EchoServerStore struct {
+	mu     sync.Mutex
+	server *EchoServer // The running or last stopped responder
+}
+
+var echoServerStore = &EchoServerStore{}
+
+var errEchoServerRunning = errors.New("UDP echo responder is already running")
+
+// Start opens the socket of a new responder
+func (st *EchoServerStore) Start(config EchoServerConfig) (*EchoServerStatus, error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.server != nil && !st.server.isStopped() {
+		return nil, errEchoServerRunning
+	}
+	addr, err := net.ResolveUDPAddr("udp", net.JoinHostPort(config.Address, strconv.Itoa(config.Port)))
+	var conn *net.UDPConn
+	if err == nil {
+		conn, err = net.ListenUDP("udp", addr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("UDP echo listener: %v", err)
+	}
+	s := &EchoServer{config: config, conn: conn, startedAt: time.Now().UTC()}
+	st.server = s
+	log.Printf("UDP echo responder listening on %s", conn.LocalAddr())
+	go s.serve()
+	return s.status(), nil
+}
+
+// Stop closes the running responder
+func (st *EchoServerStore) Stop() (*EchoServerStatus, bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.server == nil || st.server.isStopped() {
+		return nil, false
+	}
+	st.server.stop()
+	return st.server.status(), true
+}
+
+// Status reports the running responder, or the counters of the last one
+func (st *EchoServerStore) Status() *EchoServerStatus {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.server == nil {
+		return &EchoServerStatus{}
+	}
+	return st.server.status()
+}
+
+func (s *EchoServer) isStopped() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stopped
+}
+
+func (s *EchoServer) stop() {
+	s.mu.Lock()
+	s.stopped = true
+	s.stoppedAt = time.Now().UTC()
+	s.mu.Unlock()
+	s.conn.Close()
+	log.Printf("UDP echo responder on %s stopped", s.conn.LocalAddr())
+}
+
+func (s *EchoServer) status() *EchoServerStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	config := s.config
+	startedAt := s.startedAt
+	st := &EchoServerStatus{
+		Running:          !s.stopped,
+		Listen:           s.conn.LocalAddr().String(),
+		Config:           &config,
+		StartedAt:        &startedAt,
+		PacketsEchoed:    s.packetsEchoed,
+		PacketsDiscarded: s.packetsDiscarded,
+	}
+	if s.stopped {
+		stoppedAt := s.stoppedAt
+		st.StoppedAt = &stoppedAt
+	}
+	if !s.lastPacketAt.IsZero() {
+		lastPacketAt := s.lastPacketAt
+		st.LastPacketAt = &lastPacketAt
+	}
+	return st
+}
+
+// serve sends every probe request back to where it came from, marked as a reply
+func (s *EchoServer) serve() {
+	buf := make([]byte, 65536)
+	for {
+		n, addr, err := s.conn.ReadFromUDP(buf)
+		if err != nil {
+			if !s.isStopped() {
+				warnf(nil, "UDP echo responder: %v", err)
+			}
+			return
+		}
+		echoed := echoReply(buf[:n])
+		if echoed {
+			_, err = s.conn.WriteToUDP(buf[:n], addr)
+			echoed = err == nil
+		}
+		s.mu.Lock()
+		if echoed {
+			s.packetsEchoed++
+			s.lastPacketAt = time.Now().UTC()
+		} else {
+			s.packetsDiscarded++
+		}
+		s.mu.Unlock()
+	}
+}
+
+func echoServerStart(w http.ResponseWriter, r *http.Request) {
+	var config EchoServerConfig
+	if err := json.NewDecoder(r.Body).Decode(&config); err != nil && err != io.EOF {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := config.validate(); err != nil {
+		jsonResponse(w, ApiResponse{
+			Status: "error",
+			Error:  err.Error(),
+		}, http.StatusBadRequest)
+		return
+	}
+
+	status, err := echoServerStore.Start(config)
+	if err != nil {
+		code := http.StatusInternalServerError
+		if errors.Is(err, errEchoServerRunning) {
+			code = http.StatusConflict
+		}
+		jsonResponse(w, ApiResponse{
+			Status: "error",
+			Error:  err.Error(),
+		}, code)
+		return
+	}
+	jsonResponse(w, ApiResponse{
+		Status: "ok",
+		Data:   status,
+	}, http.StatusOK)
+}
+
+func echoServerStop(w http.ResponseWriter, r *http.Request) {
+	status, ok := echoServerStore.Stop()
+	if !ok {
+		jsonResponse(w, ApiResponse{
+			Status: "error",
+			Error:  "UDP echo responder is not running",
+		}, http.StatusConflict)
+		return
+	}
+	jsonResponse(w, ApiResponse{
+		Status: "ok",
+		Data:   status,
+	}, http.StatusOK)
+}
+
+func echoServerStatus(w http.ResponseWriter, r *http.Request) {
+	jsonResponse(w, ApiResponse{
+		Status: "ok",
+		Data:   echoServerStore.Status(),
+	}, http.StatusOK)
+}
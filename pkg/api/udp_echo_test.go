@@ -0,0 +1,79 @@
+package api
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+func TestEchoProbe(t *testing.T) {
+	sent := time.Date(2026, 1, 15, 10, 0, 0, 123456789, time.UTC)
+	b := echoProbe(0xdeadbeef, 42, 56, sent)
+	if len(b) != 56 {
+		t.Fatalf("Expected a 56-byte probe, got %d bytes", len(b))
+	}
+	if string(b[0:4]) != "NTAE" || b[4] != echoKindRequest {
+		t.Errorf("Expected the magic and kind request, got % x", b[0:5])
+	}
+	if got := int64(binary.BigEndian.Uint64(b[16:24])); got != sent.UnixNano() {
+		t.Errorf("Expected send time %d, got %d", sent.UnixNano(), got)
+	}
+	for i := ECHO_HEADER_SIZE; i < len(b); i++ {
+		if b[i] != 0 {
+			t.Fatalf("Expected zero padding, got %#x at %d", b[i], i)
+		}
+	}
+	// A smaller packet_size still carries the whole header
+	if got := len(echoProbe(1, 0, 0, sent)); got != ECHO_HEADER_SIZE {
+		t.Errorf("Expected a %d-byte probe, got %d bytes", ECHO_HEADER_SIZE, got)
+	}
+}
+
+func TestParseEchoReply(t *testing.T) {
+	probe := echoProbe(7, 3, 64, time.Now())
+
+	// An RFC 862 server sends the probe back unchanged
+	if seq, ok := parseEchoReply(probe, 7); !ok || seq != 3 {
+		t.Errorf("Expected the verbatim echo of probe 3, got %d (%v)", seq, ok)
+	}
+	reply := append([]byte(nil), probe...)
+	if !echoReply(reply) {
+		t.Fatal("Expected the responder to echo a probe request")
+	}
+	if seq, ok := parseEchoReply(reply, 7); !ok || seq != 3 {
+		t.Errorf("Expected the reply to probe 3, got %d (%v)", seq, ok)
+	}
+
+	if _, ok := parseEchoReply(reply, 8); ok {
+		t.Error("Expected the reply of another test to be ignored")
+	}
+	if _, ok := parseEchoReply(reply[:ECHO_HEADER_SIZE-1], 7); ok {
+		t.Error("Expected a truncated reply to be ignored")
+	}
+	unknown := append([]byte(nil), probe...)
+	unknown[4] = 2
+	if _, ok := parseEchoReply(unknown, 7); ok {
+		t.Error("Expected an unknown kind to be ignored")
+	}
+	garbage := make([]byte, 64)
+	if _, ok := parseEchoReply(garbage, 0); ok {
+		t.Error("Expected a datagram without the magic to be ignored")
+	}
+}
+
+func TestEchoReplyDiscards(t *testing.T) {
+	reply := echoProbe(7, 0, 32, time.Now())
+	if !echoReply(reply) || reply[4] != echoKindReply {
+		t.Fatal("Expected the probe to be marked as a reply")
+	}
+	// Two responders would otherwise bounce a reply between them forever
+	if echoReply(reply) {
+		t.Error("Expected a reply not to be echoed again")
+	}
+	if echoReply(make([]byte, 64)) {
+		t.Error("Expected a datagram without the magic not to be echoed")
+	}
+	if echoReply([]byte("NTAE")) {
+		t.Error("Expected a datagram shorter than the header not to be echoed")
+	}
+}
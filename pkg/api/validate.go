@@ -0,0 +1,683 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"network-test-api/pkg/nettest"
+)
+
+// Field-level checks of test requests, before any test starts. Every invalid
+// field is reported at once, as data.fields of a 400 response with code
+// ERR_VALIDATION. Zero values select a test's default and always pass; fields
+// checked together, such as timeout_sec against the duration, are checked
+// with those defaults.
+const (
+	ERR_VALIDATION = "ERR_VALIDATION"
+
+	MAX_IPERF3_PARALLEL = 128   // iperf3's own -P limit
+	MAX_TWAMP_PADDING   = 65000 // Test packets stay within a UDP datagram
+	MAX_HOSTNAME_LENGTH = 253
+
+	TARGET_RESOLVE_TIMEOUT = 2 * time.Second // Lookup of hostnames under BLOCK_PRIVATE_TARGETS and the target policy
+)
+
+// blockPrivateTargets rejects tests towards private, loopback, link-local and
+// other non-global addresses, for agents reachable by untrusted clients
+var blockPrivateTargets bool
+
+// sharedAddressSpace is the carrier-grade NAT range of RFC 6598, which
+// net.IP.IsPrivate leaves out
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// configureTargetPolicy reads BLOCK_PRIVATE_TARGETS and the allowed and
+// blocked targets, if set
+func configureTargetPolicy() {
+	configureTargetRules()
+	if v := os.Getenv("BLOCK_PRIVATE_TARGETS"); v != "" {
+		block, err := strconv.ParseBool(v)
+		if err != nil {
+			log.Fatalf("Invalid BLOCK_PRIVATE_TARGETS %q (expected true or false)", v)
+		}
+		blockPrivateTargets = block
+		if block {
+			log.Printf("Tests towards private and other non-global addresses are refused")
+		}
+	}
+	if blockPrivateTargets || targetPolicy.enabled() {
+		nettest.SetTargetCheck(checkTargetAddress)
+	}
+}
+
+// checkTargetAddress re-checks an address a test is about to connect to, as
+// its hostname may resolve differently than when the request was validated
+func checkTargetAddress(name string, ip net.IP) error {
+	if err := targetPolicy.checkAddress(name, ip); err != nil {
+		return err
+	}
+	if blockPrivateTargets && !isGlobalIP(ip) {
+		return fmt.Errorf("is not a global address (BLOCK_PRIVATE_TARGETS)")
+	}
+	return nil
+}
+
+// checkedDialContext dials the services the agent calls on its own, such as
+// webhooks, exporters, peers and the coordinator, with every address it
+// connects to held to checkTargetAddress like those of tests
+func checkedDialContext(timeout time.Duration) func(ctx context.Context, network, address string) (net.Conn, error) {
+	var bind *nettest.SourceBinding
+	return bind.DialContext(timeout)
+}
+
+// checkedHTTPClient is an http.Client that dials with checkedDialContext. A
+// timeout of 0 leaves each call to be bounded by its context.
+func checkedHTTPClient(timeout time.Duration) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = checkedDialContext(30 * time.Second) // As http.DefaultTransport
+	return &http.Client{Timeout: timeout, Transport: transport}
+}
+
+// FieldError is one invalid field of a request
+type FieldError struct {
+	Field   string      `json:"field"` // JSON name, e.g. stun_servers[1]
+	Value   interface{} `json:"value,omitempty"`
+	Message string      `json:"message"`
+}
+
+// ValidationError lists every invalid field of a request
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		messages[i] = f.Field + " " + f.Message
+	}
+	return "invalid request: " + strings.Join(messages, "; ")
+}
+
+// validationData is the data of an error response: the invalid fields of a
+// ValidationError anywhere in err's chain, nil for other errors
+func validationData(err error) interface{} {
+	var ve *ValidationError
+	if errors.As(err, &ve) {
+		return map[string]interface{}{"fields": ve.Fields}
+	}
+	return nil
+}
+
+// decodeRequestBody decodes a test request. A body that is not a JSON object
+// fails as a whole; otherwise every field that does not decode is listed, not
+// only the first, in a ValidationError coded ERR_VALIDATION.
+func decodeRequestBody(body []byte) (RunRequest, error) {
+	var req RunRequest
+	err := json.Unmarshal(body, &req)
+	if err == nil {
+		return req, nil
+	}
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return req, &codedError{ERR_VALIDATION, &ValidationError{Fields: []FieldError{{Field: "body", Message: "must be a JSON object: " + err.Error()}}}}
+	}
+
+	names := make([]string, 0, len(raw))
+	for name := range raw {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	v := &requestValidator{}
+	for _, name := range names {
+		one, _ := json.Marshal(map[string]json.RawMessage{name: raw[name]})
+		var field RunRequest
+		if err := json.Unmarshal(one, &field); err != nil {
+			v.decodeFailed(name, raw[name], err)
+		}
+	}
+	if len(v.fields) == 0 {
+		v.fail("body", nil, "is invalid: %v", err)
+	}
+	return req, &codedError{ERR_VALIDATION, &ValidationError{Fields: v.fields}}
+}
+
+// decodeFailed records a field whose JSON value does not decode, under the
+// path of the nested field a type mismatch is in
+func (v *requestValidator) decodeFailed(name string, value json.RawMessage, err error) {
+	var te *json.UnmarshalTypeError
+	if !errors.As(err, &te) {
+		v.fail(name, value, "%v", err)
+		return
+	}
+	if te.Field != "" {
+		name = jsonPath(te.Field)
+	}
+	v.fail(name, value, "must be %s, not %s", jsonKind(te.Type), te.Value)
+}
+
+// jsonPath writes the dotted path of a decoding error, e.g. sessions.1.dscp,
+// the way field errors name elements: sessions[1].dscp
+func jsonPath(field string) string {
+	var b strings.Builder
+	for i, part := range strings.Split(field, ".") {
+		if _, err := strconv.Atoi(part); err == nil {
+			b.WriteString("[" + part + "]")
+			continue
+		}
+		if i > 0 {
+			b.WriteByte('.')
+		}
+		b.WriteString(part)
+	}
+	return b.String()
+}
+
+// jsonKind names the JSON values a Go type decodes from
+func jsonKind(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "an integer"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "true or false"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	case reflect.Map, reflect.Struct:
+		return "an object"
+	}
+	return t.String()
+}
+
+// requestValidator collects the invalid fields of a request
+type requestValidator struct {
+	fields []FieldError
+}
+
+func (v *requestValidator) fail(field string, value interface{}, format string, args ...interface{}) {
+	v.fields = append(v.fields, FieldError{Field: field, Value: value, Message: fmt.Sprintf(format, args...)})
+}
+
+// between checks that a set value lies within min and max
+func (v *requestValidator) between(field string, value, min, max int64, unit string) {
+	if value != 0 && (value < min || value > max) {
+		v.fail(field, value, "must be between %d and %d%s", min, max, unit)
+	}
+}
+
+// nonNegative checks a value without an upper bound of its own
+func (v *requestValidator) nonNegative(field string, value int64) {
+	if value < 0 {
+		v.fail(field, value, "must not be negative")
+	}
+}
+
+// bandwidth checks a rate in Mbit/s, which may be fractional
+func (v *requestValidator) bandwidth(field string, b Bandwidth) {
+	if b.Mbps < 0 {
+		v.fail(field, b, "must not be negative")
+	}
+}
+
+// oneOf checks a value against the allowed ones, ignoring case
+func (v *requestValidator) oneOf(field, value string, allowed ...string) {
+	if value == "" {
+		return
+	}
+	for _, a := range allowed {
+		if strings.EqualFold(value, a) {
+			return
+		}
+	}
+	expected := strings.Join(allowed, ", ")
+	if n := len(allowed); n > 1 {
+		expected = strings.Join(allowed[:n-1], ", ") + " or " + allowed[n-1]
+	}
+	v.fail(field, value, "must be %s", expected)
+}
+
+// host checks the hostname or IP address of a field's value, that it is
+// a global one when private targets are blocked, and the target policy
+func (v *requestValidator) host(field string, value interface{}, host string) {
+	if err := checkHostname(host); err != nil {
+		v.fail(field, value, "%v", err)
+		return
+	}
+	if err := targetPolicy.check(host); err != nil {
+		v.fail(field, value, "%v", err)
+		return
+	}
+	if !blockPrivateTargets {
+		return
+	}
+	if addr := nonGlobalAddress(host); addr != nil {
+		v.fail(field, value, "is not a global address: %s is private, loopback or link-local (BLOCK_PRIVATE_TARGETS)", addr)
+	}
+}
+
+// checkHostname checks that host is an IP address or a hostname of valid
+// labels (RFC 1123, with underscores as some internal zones use them)
+func checkHostname(host string) error {
+	if addr, _, _ := strings.Cut(host, "%"); net.ParseIP(addr) != nil {
+		return nil // With a zone for link-local IPv6
+	}
+	if len(host) > MAX_HOSTNAME_LENGTH {
+		return fmt.Errorf("is longer than %d characters", MAX_HOSTNAME_LENGTH)
+	}
+	if strings.HasPrefix(host, "[") {
+		return fmt.Errorf("must be an IPv6 address without brackets")
+	}
+	for _, label := range strings.Split(strings.TrimSuffix(host, "."), ".") {
+		if label == "" || len(label) > 63 {
+			return fmt.Errorf("is not a valid hostname: labels must be 1 to 63 characters")
+		}
+		if label[0] == '-' || label[len(label)-1] == '-' {
+			return fmt.Errorf("is not a valid hostname: labels cannot start or end with a hyphen")
+		}
+		for _, c := range label {
+			if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+				return fmt.Errorf("is not a valid hostname: invalid character %q", c)
+			}
+		}
+	}
+	return nil
+}
+
+// isGlobalIP reports whether ip is routable on the internet
+func isGlobalIP(ip net.IP) bool {
+	return !(ip.IsPrivate() || ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsUnspecified() || ip.IsMulticast() || sharedAddressSpace.Contains(ip))
+}
+
+// nonGlobalAddress returns host's first address that is not global, looking
+// hostnames up. Hostnames that do not resolve pass; their test fails later.
+func nonGlobalAddress(host string) net.IP {
+	addr, _, _ := strings.Cut(host, "%")
+	if ip := net.ParseIP(addr); ip != nil {
+		if isGlobalIP(ip) {
+			return nil
+		}
+		return ip
+	}
+	addrs, err := targetAddresses(host)
+	if err != nil {
+		return nil
+	}
+	for _, ip := range addrs {
+		if !isGlobalIP(ip) {
+			return ip
+		}
+	}
+	return nil
+}
+
+// targetAddresses looks up the addresses of a hostname, within TARGET_RESOLVE_TIMEOUT
+func targetAddresses(host string) ([]net.IP, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), TARGET_RESOLVE_TIMEOUT)
+	defer cancel()
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	ips := make([]net.IP, len(addrs))
+	for i, a := range addrs {
+		ips[i] = a.IP
+	}
+	return ips, nil
+}
+
+// validateRunRequest checks the fields of a request of runner's type, after
+// its profile's defaults, and returns a ValidationError coded ERR_VALIDATION
+// listing every invalid one
+func validateRunRequest(runner TestRunner, req RunRequest) error {
+	v := &requestValidator{}
+	runner.Validate(v, req)
+	v.between("server_port", int64(req.ServerPort), 1, 65535, "")
+	v.between("dscp", int64(req.DSCP), 0, 63, "")
+	v.between("tos", int64(req.TOS), 0, 255, "")
+	v.timeoutSec(req.TimeoutSec)
+	v.between("lock_wait", int64(req.LockWait), 1, MAX_LOCK_WAIT, " seconds")
+	v.between("series_max_points", int64(req.SeriesMaxPoints), 1, MAX_SERIES_MAX_POINTS, "")
+	v.ipVersion(req.IPVersion)
+	v.netns(runner.Name(), req)
+
+	if len(v.fields) == 0 {
+		return nil
+	}
+	return &codedError{ERR_VALIDATION, &ValidationError{Fields: v.fields}}
+}
+
+// ipVersion checks an ip_version, which withProfileDefaults has already
+// applied over address_family when valid
+func (v *requestValidator) ipVersion(version json.RawMessage) {
+	if _, err := ipVersionFamily(version); err != nil {
+		v.fail("ip_version", version, "must be 4, 6 or auto")
+	}
+}
+
+// netns checks that a network namespace is only asked of the test types that
+// open their sockets in it, and not together with a tunnel of the agent's own
+func (v *requestValidator) netns(testType string, req RunRequest) {
+	switch {
+	case req.Netns == "":
+	case testType != TEST_TYPE_IPERF3 && testType != TEST_TYPE_TWAMP && testType != TEST_TYPE_OWAMP:
+		v.fail("netns", req.Netns, "only applies to iperf3, TWAMP and OWAMP tests")
+	case req.Tunnel != "":
+		v.fail("netns", req.Netns, "cannot be combined with tunnel")
+	}
+}
+
+// serverHost checks server_host, the target of most test types
+func (v *requestValidator) serverHost(req RunRequest) {
+	if req.ServerHost == "" {
+		v.fail("server_host", nil, "is required")
+	} else {
+		v.host("server_host", req.ServerHost, req.ServerHost)
+	}
+}
+
+// url checks a field holding the URL of the target
+func (v *requestValidator) url(field, value string) {
+	if value == "" {
+		v.fail(field, nil, "is required")
+	} else if host := transferHost(value); host == "" {
+		v.fail(field, value, "must be an absolute URL with a host")
+	} else {
+		v.host(field, value, host)
+	}
+}
+
+func validateIperf3Request(v *requestValidator, req RunRequest) {
+	v.serverHost(req)
+	v.between("duration", int64(req.Duration), 1, int64(testTimeoutMax/time.Second), " seconds (TEST_TIMEOUT_MAX)")
+	v.between("parallel", int64(req.Parallel), 1, MAX_IPERF3_PARALLEL, "")
+	v.oneOf("protocol", req.Protocol, "TCP", "UDP")
+	v.bandwidth("bandwidth", req.Bandwidth)
+	v.bandwidth("ramp_step", req.RampStep)
+	v.nonNegative("num_bytes", req.NumBytes)
+	v.nonNegative("block_count", int64(req.BlockCount))
+	v.between("pacing_timer", int64(req.PacingTimer), 1, MAX_PACING_TIMER, " microseconds")
+	if req.MaxLoss < 0 || req.MaxLoss >= 100 {
+		v.fail("max_loss", req.MaxLoss, "must be between 0 and 100 percent")
+	}
+
+	if req.Protocol == "" {
+		req.Protocol = "TCP"
+	}
+	v.iperf3Transfer(req)
+	v.iperf3Omit(req)
+	v.iperf3Congestion(req)
+	v.iperf3Window(req)
+	v.iperf3Bandwidth(req)
+	v.iperf3BandwidthMode(req)
+	v.iperf3ZeroCopy(req)
+	v.iperf3TCPInfo(req)
+	v.iperf3ECN(req)
+	if req.PredictionID != "" && !strings.EqualFold(req.Protocol, "TCP") {
+		v.fail("prediction_id", req.PredictionID, "requires protocol TCP")
+	}
+	expected := req.Duration + req.Omit
+	switch {
+	case req.NumBytes > 0 || req.BlockCount > 0:
+		expected = 0 // Duration is only a limit
+	case req.Duration == 0:
+		expected += DEFAULT_IPERF3_DURATION
+	}
+	v.testTimeout(req.TimeoutSec, expected)
+}
+
+func validateTwampRequest(v *requestValidator, req RunRequest) {
+	v.serverHost(req)
+	mode, err := parseTwampMode(req.Mode)
+	if err != nil {
+		v.fail("mode", req.Mode, "must be full, loss, capacity, available or sweep")
+	}
+	v.between("count", int64(req.Count), 1, MAX_LOSS_MODE_COUNT, "")
+	v.between("padding", int64(req.Padding), 0, MAX_TWAMP_PADDING, " bytes")
+	for _, padding := range req.PaddingSizes {
+		v.between("padding_sizes", int64(padding), 0, MAX_TWAMP_PADDING, " bytes")
+	}
+	if len(req.Sessions) > MAX_CONCURRENT_SESSIONS {
+		v.fail("sessions", len(req.Sessions), "takes at most %d sessions", MAX_CONCURRENT_SESSIONS)
+	}
+	for _, s := range req.Sessions {
+		v.between("sessions.dscp", int64(s.DSCP), 0, 63, "")
+		v.between("sessions.padding", int64(s.Padding), 0, MAX_TWAMP_PADDING, " bytes")
+	}
+	v.between("rate", int64(req.Rate), 1, MAX_LOSS_MODE_RATE, " packets/s")
+	v.between("train_length", int64(req.TrainLength), 1, MAX_STREAM_LENGTH, "")
+	v.bandwidth("bandwidth", req.Bandwidth)
+	if req.HistogramBucketMs != 0 && (req.HistogramBucketMs < MIN_HISTOGRAM_BUCKET_MS || req.HistogramBucketMs > MAX_HISTOGRAM_BUCKET_MS) {
+		v.fail("histogram_bucket_ms", req.HistogramBucketMs, "must be between %g and %d", MIN_HISTOGRAM_BUCKET_MS, MAX_HISTOGRAM_BUCKET_MS)
+	}
+
+	v.twampTOS(req.TOS)
+	if err == nil {
+		v.twampECN(req, mode)
+	}
+	if mode == TWAMP_MODE_FULL {
+		count := req.Count
+		if count == 0 {
+			count = DEFAULT_FULL_MODE_COUNT
+		}
+		v.testTimeout(req.TimeoutSec, count)
+	}
+}
+
+func validateTransferRequest(v *requestValidator, req RunRequest) {
+	v.url("url", req.URL)
+	v.oneOf("direction", req.Direction, TRANSFER_DOWNLOAD, TRANSFER_UPLOAD)
+	v.oneOf("method", req.Method, http.MethodPut, http.MethodPost)
+	v.between("duration", int64(req.Duration), 1, MAX_TRANSFER_DURATION, " seconds")
+	v.between("size", req.Size, 1, MAX_TRANSFER_SIZE, " bytes")
+}
+
+func validateHTTPRequest(v *requestValidator, req RunRequest) {
+	if u, err := url.Parse(req.URL); err == nil && u.Host != "" && !strings.EqualFold(u.Scheme, "http") && !strings.EqualFold(u.Scheme, "https") {
+		v.fail("url", req.URL, "must be an http or https URL")
+	} else {
+		v.url("url", req.URL)
+	}
+	v.oneOf("direction", req.Direction, TRANSFER_DOWNLOAD, TRANSFER_UPLOAD)
+	v.oneOf("method", req.Method, http.MethodPut, http.MethodPost)
+	v.between("duration", int64(req.Duration), 1, MAX_TRANSFER_DURATION, " seconds")
+	v.between("size", req.Size, 1, MAX_TRANSFER_SIZE, " bytes")
+}
+
+func validateS3Request(v *requestValidator, req RunRequest) {
+	v.url("endpoint", req.Endpoint)
+	v.between("duration", int64(req.Duration), 1, MAX_TRANSFER_DURATION, " seconds")
+	v.between("size", req.Size, 1, MAX_TRANSFER_SIZE, " bytes")
+	v.between("part_size", req.PartSize, MIN_S3_PART_SIZE, MAX_S3_PART_SIZE, " bytes")
+	v.between("parallel", int64(req.Parallel), 1, MAX_S3_PARALLEL, "")
+}
+
+func validateSSHRequest(v *requestValidator, req RunRequest) {
+	v.serverHost(req)
+	v.oneOf("protocol", req.Protocol, SSH_PROTOCOL_SCP, SSH_PROTOCOL_SFTP)
+	v.oneOf("direction", req.Direction, TRANSFER_DOWNLOAD, TRANSFER_UPLOAD)
+	v.between("duration", int64(req.Duration), 1, MAX_TRANSFER_DURATION, " seconds")
+	v.nonNegative("size", req.Size)
+}
+
+func validatePMTURequest(v *requestValidator, req RunRequest) {
+	v.serverHost(req)
+	v.oneOf("protocol", req.Protocol, PMTU_PROTOCOL_UDP, PMTU_PROTOCOL_TCP, PMTU_PROTOCOL_ICMP)
+	v.between("max_size", int64(req.MaxSize), MIN_PMTU_SIZE_IPV4, MAX_PMTU_SIZE, " bytes")
+}
+
+func validateSTUNRequest(v *requestValidator, req RunRequest) {
+	v.serverHost(req)
+	if len(req.STUNServers) > MAX_STUN_SERVERS {
+		v.fail("stun_servers", len(req.STUNServers), "must list at most %d servers", MAX_STUN_SERVERS)
+	}
+	for i, s := range req.STUNServers {
+		field := fmt.Sprintf("stun_servers[%d]", i)
+		if host, _, err := splitHostPortDefault(s, DEFAULT_STUN_PORT); err != nil {
+			v.fail(field, s, "must be host or host:port: %v", err)
+		} else {
+			v.host(field, s, host)
+		}
+	}
+}
+
+func validateNAT64Request(v *requestValidator, req RunRequest) {
+	v.serverHost(req)
+}
+
+func validatePingRequest(v *requestValidator, req RunRequest) {
+	v.serverHost(req)
+	v.oneOf("protocol", req.Protocol, PING_PROTOCOL_ICMP, PING_PROTOCOL_UDP, PING_PROTOCOL_ECHO)
+	v.between("count", int64(req.Count), 1, MAX_PING_COUNT, "")
+	v.between("packet_size", int64(req.PacketSize), 0, MAX_PING_SIZE, " bytes")
+	if strings.EqualFold(req.Protocol, PING_PROTOCOL_ECHO) && req.PacketSize != 0 && req.PacketSize < ECHO_HEADER_SIZE {
+		v.fail("packet_size", req.PacketSize, "must be at least %d bytes with protocol echo", ECHO_HEADER_SIZE)
+	}
+	v.between("ttl", int64(req.TTL), 1, 255, "")
+	if req.Interval != 0 && (req.Interval < MIN_PING_INTERVAL || req.Interval > MAX_PING_INTERVAL) {
+		v.fail("interval", req.Interval, "must be between %g and %d seconds", MIN_PING_INTERVAL, MAX_PING_INTERVAL)
+	}
+}
+
+func validateOwampRequest(v *requestValidator, req RunRequest) {
+	v.serverHost(req)
+	v.between("count", int64(req.Count), 1, MAX_OWAMP_COUNT, "")
+	v.between("padding", int64(req.Padding), 0, MAX_TWAMP_PADDING, " bytes")
+	v.between("dscp", int64(req.DSCP), 0, 63, "")
+	v.between("tos", int64(req.TOS), 0, 255, "")
+	if req.Interval != 0 && (req.Interval < MIN_OWAMP_INTERVAL || req.Interval > MAX_OWAMP_INTERVAL) {
+		v.fail("interval", req.Interval, "must be between %g and %d seconds", MIN_OWAMP_INTERVAL, MAX_OWAMP_INTERVAL)
+	}
+
+	v.twampTOS(req.TOS)
+	count, interval := float64(req.Count), req.Interval
+	if count == 0 {
+		count = DEFAULT_OWAMP_COUNT
+	}
+	if interval == 0 {
+		interval = DEFAULT_OWAMP_INTERVAL
+	}
+	v.testTimeout(req.TimeoutSec, int(count*interval+(OWAMP_START_DELAY+OWAMP_LOSS_TIMEOUT).Seconds()))
+}
+
+func validateTLSRequest(v *requestValidator, req RunRequest) {
+	v.serverHost(req)
+	if req.ServerName != "" {
+		v.host("server_name", req.ServerName, req.ServerName)
+	}
+	if len(req.ALPN) > MAX_TLS_ALPN {
+		v.fail("alpn", len(req.ALPN), "must list at most %d protocols", MAX_TLS_ALPN)
+	}
+	for i, p := range req.ALPN {
+		if p == "" || len(p) > 255 {
+			v.fail(fmt.Sprintf("alpn[%d]", i), p, "must be 1 to 255 bytes")
+		}
+	}
+	for i, name := range req.TLSVersions {
+		v.oneOf(fmt.Sprintf("tls_versions[%d]", i), name, "1.0", "1.1", "1.2", "1.3")
+	}
+}
+
+func validateNDT7Request(v *requestValidator, req RunRequest) {
+	if req.ServerHost != "" {
+		v.host("server_host", req.ServerHost, req.ServerHost)
+	}
+	v.oneOf("protocol", req.Protocol, NDT7_PROTOCOL_WSS, NDT7_PROTOCOL_WS)
+	v.oneOf("direction", req.Direction, TRANSFER_DOWNLOAD, TRANSFER_UPLOAD, NDT7_DIRECTION_BOTH)
+}
+
+func validateBufferbloatRequest(v *requestValidator, req RunRequest) {
+	v.serverHost(req)
+	if req.ProbeHost != "" {
+		v.host("probe_host", req.ProbeHost, req.ProbeHost)
+	}
+	v.oneOf("probe", req.Probe, BUFFERBLOAT_PROBE_TWAMP, BUFFERBLOAT_PROBE_PING)
+	v.oneOf("direction", req.Direction, TRANSFER_DOWNLOAD, TRANSFER_UPLOAD, NDT7_DIRECTION_BOTH)
+	v.between("probe_port", int64(req.ProbePort), 1, 65535, "")
+	v.between("duration", int64(req.Duration), MIN_BUFFERBLOAT_DURATION, MAX_BUFFERBLOAT_DURATION, " seconds")
+	v.between("idle_duration", int64(req.IdleDuration), 1, MAX_BUFFERBLOAT_IDLE, " seconds")
+	v.between("parallel", int64(req.Parallel), 1, MAX_IPERF3_PARALLEL, "")
+	v.bandwidth("bandwidth", req.Bandwidth)
+	if req.Interval != 0 && (req.Interval < MIN_PING_INTERVAL || req.Interval > MAX_BUFFERBLOAT_INTERVAL) {
+		v.fail("interval", req.Interval, "must be between %g and %d seconds", MIN_PING_INTERVAL, MAX_BUFFERBLOAT_INTERVAL)
+	}
+
+	idle, duration := req.IdleDuration, req.Duration
+	if idle == 0 {
+		idle = DEFAULT_BUFFERBLOAT_IDLE
+	}
+	if duration == 0 {
+		duration = DEFAULT_BUFFERBLOAT_DURATION
+	}
+	directions := ndt7Directions(strings.ToLower(req.Direction))
+	v.testTimeout(req.TimeoutSec, idle+len(directions)*(duration+int(BUFFERBLOAT_SETTLE/time.Second))+int(PING_TIMEOUT/time.Second))
+}
+
+func validateRPMRequest(v *requestValidator, req RunRequest) {
+	if req.URL != "" {
+		v.url("url", req.URL)
+	}
+	v.oneOf("direction", req.Direction, TRANSFER_DOWNLOAD, TRANSFER_UPLOAD, NDT7_DIRECTION_BOTH)
+	v.between("duration", int64(req.Duration), MIN_RPM_DURATION, MAX_RPM_DURATION, " seconds")
+	v.between("parallel", int64(req.Parallel), 1, MAX_RPM_CONNECTIONS, "")
+	if req.Interval != 0 && (req.Interval < MIN_PING_INTERVAL || req.Interval > MAX_RPM_INTERVAL) {
+		v.fail("interval", req.Interval, "must be between %g and %d seconds", MIN_PING_INTERVAL, MAX_RPM_INTERVAL)
+	}
+
+	duration := req.Duration
+	if duration == 0 {
+		duration = DEFAULT_RPM_DURATION
+	}
+	v.testTimeout(req.TimeoutSec, duration+int((RPM_CONFIG_TIMEOUT+RPM_PROBE_WAIT)/time.Second))
+}
+
+func validateTCPConnectRequest(v *requestValidator, req RunRequest) {
+	if len(req.Targets) == 0 {
+		v.fail("targets", nil, "is required")
+	} else if len(req.Targets) > MAX_TCP_CONNECT_TARGETS {
+		v.fail("targets", len(req.Targets), "must list at most %d host:port pairs", MAX_TCP_CONNECT_TARGETS)
+	}
+	for i, target := range req.Targets {
+		field := fmt.Sprintf("targets[%d]", i)
+		if host, _, err := parseTCPConnectTarget(target); err != nil {
+			v.fail(field, target, "%v", err)
+		} else {
+			v.host(field, target, host)
+		}
+	}
+	v.between("parallel", int64(req.Parallel), 1, MAX_TCP_CONNECT_PARALLEL, "")
+	if req.ConnectTimeout != 0 && (req.ConnectTimeout < MIN_TCP_CONNECT_TIMEOUT || req.ConnectTimeout > MAX_TCP_CONNECT_TIMEOUT) {
+		v.fail("connect_timeout", req.ConnectTimeout, "must be between %g and %d seconds", MIN_TCP_CONNECT_TIMEOUT, MAX_TCP_CONNECT_TIMEOUT)
+	}
+
+	parallel, connectTimeout := req.Parallel, req.ConnectTimeout
+	if parallel <= 0 {
+		parallel = DEFAULT_TCP_CONNECT_PARALLEL
+	}
+	if connectTimeout == 0 {
+		connectTimeout = DEFAULT_TCP_CONNECT_TIMEOUT
+	}
+	rounds := (len(req.Targets) + parallel - 1) / parallel
+	v.testTimeout(req.TimeoutSec, int(float64(rounds)*connectTimeout))
+}
+
+func validateTracerouteRequest(v *requestValidator, req RunRequest) {
+	v.serverHost(req)
+	v.oneOf("protocol", req.Protocol, TRACEROUTE_PROTOCOL_UDP, TRACEROUTE_PROTOCOL_ICMP, TRACEROUTE_PROTOCOL_TCP)
+	v.between("max_hops", int64(req.MaxHops), 1, MAX_TRACEROUTE_MAX_HOPS, "")
+	v.between("probes_per_hop", int64(req.ProbesPerHop), 1, MAX_TRACEROUTE_PROBES, "")
+}
@@ -0,0 +1,105 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestCheckHostname(t *testing.T) {
+	valid := []string{"iperf.he.net", "iperf.he.net.", "192.0.2.1", "2001:db8::1", "fe80::1%eth0", "_twamp._udp.example.com", "localhost"}
+	for _, host := range valid {
+		if err := checkHostname(host); err != nil {
+			t.Errorf("expected %q to be valid, got %v", host, err)
+		}
+	}
+
+	invalid := []string{"a..b", "-iperf.example.com", "iperf-.example.com", "[2001:db8::1]", "iperf example.com", "iperf.example.com:5201", strings.Repeat("a", 64) + ".com", strings.Repeat("a.", 127) + "com"}
+	for _, host := range invalid {
+		if err := checkHostname(host); err == nil {
+			t.Errorf("expected %q to be invalid", host)
+		}
+	}
+}
+
+func TestIsGlobalIP(t *testing.T) {
+	tests := map[string]bool{
+		"8.8.8.8":              true,
+		"2001:4860:4860::8888": true,
+		"10.1.2.3":             false,
+		"172.16.0.1":           false,
+		"192.168.1.1":          false,
+		"127.0.0.1":            false,
+		"169.254.169.254":      false, // Cloud metadata services
+		"100.64.0.1":           false,
+		"100.128.0.1":          true, // Just past the shared address space
+		"0.0.0.0":              false,
+		"224.0.0.1":            false,
+		"::1":                  false,
+		"fd00::1":              false,
+		"fe80::1":              false,
+		"::ffff:10.0.0.1":      false, // IPv4-mapped
+	}
+	for addr, want := range tests {
+		if got := isGlobalIP(net.ParseIP(addr)); got != want {
+			t.Errorf("isGlobalIP(%s): expected %v, got %v", addr, want, got)
+		}
+	}
+}
+
+func TestDecodeRequestBody_ListsEveryBadField(t *testing.T) {
+	body := `{"server_host": "iperf.he.net", "bandwidth": "abc", "duration": "ten", "reverse": 1, "sessions": [{"dscp": "ef"}]}`
+	_, err := decodeRequestBody([]byte(body))
+	if errorCode(err) != ERR_VALIDATION {
+		t.Fatalf("Expected ERR_VALIDATION, got %v", err)
+	}
+	var ve *ValidationError
+	if !errors.As(err, &ve) {
+		t.Fatalf("Expected a ValidationError, got %v", err)
+	}
+
+	want := map[string]string{
+		"bandwidth":        `"abc" is not Mbit/s or a rate such as 500K or 2.5M`,
+		"duration":         "must be an integer, not string",
+		"reverse":          "must be true or false, not number",
+		"sessions[0].dscp": "must be an integer, not string",
+	}
+	if len(ve.Fields) != len(want) {
+		t.Fatalf("Expected %d invalid fields, got %+v", len(want), ve.Fields)
+	}
+	for _, f := range ve.Fields {
+		if msg, ok := want[f.Field]; !ok || f.Message != msg {
+			t.Errorf("Unexpected field error %s: %q", f.Field, f.Message)
+		}
+	}
+	if value, _ := json.Marshal(ve.Fields[0].Value); string(value) != `"abc"` {
+		t.Errorf("Expected the bandwidth value as sent, got %s", value)
+	}
+}
+
+func TestJSONPath(t *testing.T) {
+	for field, want := range map[string]string{"duration": "duration", "sessions.1.dscp": "sessions[1].dscp", "sessions.dscp": "sessions.dscp", "stun_servers.0": "stun_servers[0]"} {
+		if got := jsonPath(field); got != want {
+			t.Errorf("jsonPath(%q) = %q, want %q", field, got, want)
+		}
+	}
+}
+
+func TestDecodeRequestBody_NotAnObject(t *testing.T) {
+	for _, body := range []string{`{"server_host": `, `[1, 2]`, `"iperf3"`} {
+		_, err := decodeRequestBody([]byte(body))
+		var ve *ValidationError
+		if errorCode(err) != ERR_VALIDATION || !errors.As(err, &ve) || len(ve.Fields) != 1 || ve.Fields[0].Field != "body" {
+			t.Errorf("%s: expected a single body field error, got %v", body, err)
+		}
+	}
+}
+
+func TestDecodeRequestBody_Valid(t *testing.T) {
+	req, err := decodeRequestBody([]byte(`{"server_host": "iperf.he.net", "bandwidth": "2.5M", "duration": 10}`))
+	if err != nil || req.ServerHost != "iperf.he.net" || req.Duration != 10 || req.Bandwidth.Mbps != 2.5 {
+		t.Errorf("Expected a clean decode, got %+v, %v", req, err)
+	}
+}
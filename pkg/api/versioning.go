@@ -0,0 +1,119 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// API versions. Every route is served under API_PATH_PREFIX, and at the
+// unversioned path it had before, as a deprecated alias of the same handler:
+// its responses carry a Deprecation header, a Link to their /v2 successor and,
+// once LEGACY_API_SUNSET is set, the Sunset date after which the aliases may
+// go (RFC 9745, RFC 8594). A breaking change to a response schema comes with
+// a new version mounted next to /v2, which keeps answering as it does.
+const (
+	API_PATH_VERSION = "v2"
+	API_PATH_PREFIX  = "/" + API_PATH_VERSION
+
+	// When the unversioned paths were deprecated, sent in Deprecation
+	LEGACY_API_DEPRECATED = "2026-10-14"
+)
+
+var (
+	legacyAPISunset time.Time // LEGACY_API_SUNSET, zero for no date
+	legacyAPILogged sync.Map  // Route templates whose legacy use was logged
+)
+
+// configureLegacyAPI reads LEGACY_API_SUNSET, the date or RFC 3339 time after
+// which the unversioned paths may be removed
+func configureLegacyAPI() {
+	v := os.Getenv("LEGACY_API_SUNSET")
+	if v == "" {
+		return
+	}
+	sunset, err := parseSunset(v)
+	if err != nil {
+		log.Fatalf("Invalid LEGACY_API_SUNSET %q (expected a date such as 2027-06-30 or an RFC 3339 time)", v)
+	}
+	legacyAPISunset = sunset
+	log.Printf("Unversioned API paths are deprecated until %s; use %s", sunset.Format(time.RFC3339), API_PATH_PREFIX)
+}
+
+// parseSunset parses a date, as midnight UTC, or an RFC 3339 time
+func parseSunset(v string) (time.Time, error) {
+	if t, err := time.Parse(time.DateOnly, v); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, v)
+}
+
+// mountAPI serves the routes of register under API_PATH_PREFIX and, as
+// deprecated aliases, at their unversioned paths
+func mountAPI(r *mux.Router, register func(*mux.Router)) {
+	register(r.PathPrefix(API_PATH_PREFIX).Subrouter())
+	r.Handle(API_PATH_PREFIX, http.RedirectHandler(API_PATH_PREFIX+"/", http.StatusMovedPermanently))
+	legacy := r.NewRoute().Subrouter()
+	legacy.Use(legacyRoutes)
+	register(legacy)
+}
+
+// legacyRoutes marks the responses of unversioned paths as deprecated, with
+// their successor under API_PATH_PREFIX, and logs the first use of each route
+func legacyRoutes(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		successor := API_PATH_PREFIX + r.URL.Path
+		setDeprecation(w.Header(), successor, legacyAPISunset)
+		route := r.URL.Path
+		if cr := mux.CurrentRoute(r); cr != nil {
+			if tpl, err := cr.GetPathTemplate(); err == nil {
+				route = tpl
+			}
+		}
+		if _, logged := legacyAPILogged.LoadOrStore(r.Method+" "+route, true); !logged {
+			warnf(r.Context(), "Deprecated unversioned path %s %s requested; use %s%s", r.Method, route, API_PATH_PREFIX, route)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// setDeprecation sets the headers of a deprecated route: Deprecation, a Link
+// to the successor and, unless sunset is zero, Sunset
+func setDeprecation(h http.Header, successor string, sunset time.Time) {
+	deprecated, _ := time.Parse(time.DateOnly, LEGACY_API_DEPRECATED)
+	h.Set("Deprecation", "@"+strconv.FormatInt(deprecated.Unix(), 10))
+	h.Add("Link", "<"+successor+`>; rel="successor-version"`)
+	if !sunset.IsZero() {
+		h.Set("Sunset", sunset.UTC().Format(http.TimeFormat))
+	}
+}
+
+// versionedPath returns p, an unversioned path of this API, as r requested
+// its own: under API_PATH_PREFIX or not
+func versionedPath(r *http.Request, p string) string {
+	if isVersionedPath(r.URL.Path) {
+		return API_PATH_PREFIX + p
+	}
+	return p
+}
+
+// isVersionedPath reports whether p is under API_PATH_PREFIX
+func isVersionedPath(p string) bool {
+	return p == API_PATH_PREFIX || strings.HasPrefix(p, API_PATH_PREFIX+"/")
+}
+
+// unversionedPath returns p without API_PATH_PREFIX
+func unversionedPath(p string) string {
+	if isVersionedPath(p) {
+		if p = strings.TrimPrefix(p, API_PATH_PREFIX); p == "" {
+			return "/"
+		}
+	}
+	return p
+}
@@ -0,0 +1,88 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestMountAPI(t *testing.T) {
+	saved := legacyAPISunset
+	defer func() { legacyAPISunset = saved }()
+	legacyAPISunset, _ = parseSunset("2027-06-30")
+
+	r := mux.NewRouter()
+	mountAPI(r, func(r *mux.Router) {
+		r.HandleFunc("/jobs/{id}", func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(mux.Vars(r)["id"]))
+		}).Methods("GET")
+		r.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {}).Methods("GET")
+	})
+
+	tests := []struct {
+		path       string
+		status     int
+		deprecated bool
+	}{
+		{"/v2/jobs/af20", http.StatusOK, false},
+		{"/jobs/af20", http.StatusOK, true},
+		{"/v2/", http.StatusOK, false},
+		{"/", http.StatusOK, true},
+		{"/v2/unknown", http.StatusNotFound, false},
+		{"/v3/jobs/af20", http.StatusNotFound, false},
+	}
+	for _, tt := range tests {
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, httptest.NewRequest("GET", tt.path, nil))
+		if rr.Code != tt.status {
+			t.Errorf("%s: expected status %d, got %d", tt.path, tt.status, rr.Code)
+		}
+		if got := rr.Header().Get("Deprecation") != ""; got != tt.deprecated {
+			t.Errorf("%s: expected deprecated %v, got %v", tt.path, tt.deprecated, got)
+		}
+		if tt.status == http.StatusOK && strings.HasSuffix(tt.path, "af20") && rr.Body.String() != "af20" {
+			t.Errorf("%s: expected the path variable af20, got %q", tt.path, rr.Body.String())
+		}
+	}
+
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest("GET", "/jobs/af20", nil))
+	if got := rr.Header().Get("Link"); got != `</v2/jobs/af20>; rel="successor-version"` {
+		t.Errorf("Expected a successor-version Link to /v2/jobs/af20, got %q", got)
+	}
+	if got := rr.Header().Get("Deprecation"); got != "@1791936000" {
+		t.Errorf("Expected Deprecation @1791936000, got %q", got)
+	}
+	if got := rr.Header().Get("Sunset"); got != "Wed, 30 Jun 2027 00:00:00 GMT" {
+		t.Errorf("Expected Sunset Wed, 30 Jun 2027 00:00:00 GMT, got %q", got)
+	}
+}
+
+func TestUnversionedPath(t *testing.T) {
+	tests := map[string]string{
+		"/v2/health":       "/health",
+		"/v2":              "/",
+		"/v2/":             "/",
+		"/health":          "/health",
+		"/v2x/health":      "/v2x/health",
+		"/openapi.json":    "/openapi.json",
+		"/v2/openapi.json": "/openapi.json",
+	}
+	for in, want := range tests {
+		if got := unversionedPath(in); got != want {
+			t.Errorf("unversionedPath(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestParseSunset(t *testing.T) {
+	if _, err := parseSunset("2027-06-30T12:00:00+02:00"); err != nil {
+		t.Errorf("Expected an RFC 3339 time to parse, got %v", err)
+	}
+	if _, err := parseSunset("next year"); err == nil {
+		t.Error("Expected an error for a sunset that is no date")
+	}
+}
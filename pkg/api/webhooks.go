@@ -0,0 +1,440 @@
+package api
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Result webhooks: every stored result of a request with callback_url is POSTed
+// there, retried with exponential backoff and dead-lettered once retries run out
+const (
+	WEBHOOK_EVENT_RESULT = "result.created"
+
+	DEFAULT_WEBHOOK_MAX_ATTEMPTS = 5
+	DEFAULT_WEBHOOK_BACKOFF      = 2 * time.Second // Before the second attempt, doubling after each failure
+	DEFAULT_WEBHOOK_MAX_BACKOFF  = 5 * time.Minute
+	DEFAULT_WEBHOOK_TIMEOUT      = 10 * time.Second
+	MAX_STORED_DELIVERIES        = 1000
+)
+
+// Delivery states
+const (
+	DELIVERY_PENDING   = "pending"
+	DELIVERY_DELIVERED = "delivered"
+	DELIVERY_DEAD      = "dead" // Retries exhausted; in the dead-letter list until redelivered
+)
+
+// WebhookConfig controls retries and signing, from WEBHOOK_* environment variables
+type WebhookConfig struct {
+	MaxAttempts int
+	Backoff     time.Duration
+	MaxBackoff  time.Duration
+	Timeout     time.Duration
+	Secret      []byte // HMAC-SHA256 key; payloads are unsigned without it
+}
+
+var webhookConfig = WebhookConfig{
+	MaxAttempts: DEFAULT_WEBHOOK_MAX_ATTEMPTS,
+	Backoff:     DEFAULT_WEBHOOK_BACKOFF,
+	MaxBackoff:  DEFAULT_WEBHOOK_MAX_BACKOFF,
+	Timeout:     DEFAULT_WEBHOOK_TIMEOUT,
+}
+
+// loadWebhookConfig reads WEBHOOK_MAX_ATTEMPTS, WEBHOOK_BACKOFF, WEBHOOK_MAX_BACKOFF,
+// WEBHOOK_TIMEOUT and WEBHOOK_SECRET over the defaults
+func loadWebhookConfig(getenv func(string) string) (WebhookConfig, error) {
+	cfg := webhookConfig
+	if v := getenv("WEBHOOK_MAX_ATTEMPTS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return cfg, fmt.Errorf("invalid WEBHOOK_MAX_ATTEMPTS %q (expected a positive integer)", v)
+		}
+		cfg.MaxAttempts = n
+	}
+	for _, d := range []struct {
+		name string
+		dst  *time.Duration
+	}{
+		{"WEBHOOK_BACKOFF", &cfg.Backoff},
+		{"WEBHOOK_MAX_BACKOFF", &cfg.MaxBackoff},
+		{"WEBHOOK_TIMEOUT", &cfg.Timeout},
+	} {
+		v := getenv(d.name)
+		if v == "" {
+			continue
+		}
+		parsed, err := time.ParseDuration(v)
+		if err != nil || parsed <= 0 {
+			return cfg, fmt.Errorf("invalid %s %q (expected a positive duration such as 2s or 5m)", d.name, v)
+		}
+		*d.dst = parsed
+	}
+	if v := getenv("WEBHOOK_SECRET"); v != "" {
+		cfg.Secret = []byte(v)
+	}
+	return cfg, nil
+}
+
+// retryDelay is the wait before attempt n+1 after n failed attempts
+func (c WebhookConfig) retryDelay(failed int) time.Duration {
+	d := c.Backoff
+	for i := 1; i < failed && d < c.MaxBackoff; i++ {
+		d *= 2
+	}
+	if d > c.MaxBackoff {
+		d = c.MaxBackoff
+	}
+	return d
+}
+
+// signPayload returns the X-Webhook-Signature value for a payload sent at timestamp:
+// HMAC-SHA256 over "<timestamp>.<body>", so a captured request cannot be replayed later
+func signPayload(secret []byte, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// validateCallbackURL accepts absolute http and https URLs
+func validateCallbackURL(s string) error {
+	if s == "" {
+		return nil
+	}
+	u, err := url.Parse(s)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid callback_url %q (expected an absolute http or https URL)", s)
+	}
+	return nil
+}
+
+// DeliveryAttempt is one POST of a webhook payload
+type DeliveryAttempt struct {
+	At         time.Time `json:"at"`
+	StatusCode int       `json:"status_code,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	DurationMs float64   `json:"duration_ms"`
+}
+
+// Delivery tracks one event sent to one callback URL
+type Delivery struct {
+	ID          string            `json:"id"`
+	URL         string            `json:"url"`
+	Event       string            `json:"event"`
+	ResultID    string            `json:"result_id,omitempty"`
+	ScheduleID  string            `json:"schedule_id,omitempty"` // Of alert notices
+	Status      string            `json:"status"`
+	Attempts    []DeliveryAttempt `json:"attempts"`
+	NextAttempt *time.Time        `json:"next_attempt,omitempty"`
+	CreatedAt   time.Time         `json:"created_at"`
+	DeliveredAt *time.Time        `json:"delivered_at,omitempty"`
+
+	payload []byte
+	cycle   int // Attempts in the current cycle; redelivery starts a new one
+}
+
+// WebhookPayload is the JSON body POSTed to callback URLs
+type WebhookPayload struct {
+	Event      string        `json:"event"`
+	DeliveryID string        `json:"delivery_id"`
+	Result     *StoredResult `json:"result"`
+}
+
+// DeliveryStore keeps the most recent deliveries, evicting the oldest finished ones beyond max
+type DeliveryStore struct {
+	mu    sync.Mutex
+	max   int
+	order []string
+	byID  map[string]*Delivery
+}
+
+// NewDeliveryStore creates an empty store holding up to max deliveries
+func NewDeliveryStore(max int) *DeliveryStore {
+	return &DeliveryStore{max: max, byID: make(map[string]*Delivery)}
+}
+
+var deliveryStore = NewDeliveryStore(MAX_STORED_DELIVERIES)
+
+// evict drops the oldest deliveries beyond max, keeping pending and dead ones
+func (s *DeliveryStore) evict() {
+	for i := 0; len(s.byID) > s.max && i < len(s.order); {
+		d := s.byID[s.order[i]]
+		if d.Status != DELIVERY_DELIVERED {
+			i++
+			continue
+		}
+		delete(s.byID, d.ID)
+		s.order = append(s.order[:i], s.order[i+1:]...)
+	}
+}
+
+// Enqueue stores a delivery of a result to url and starts sending it
+func (s *DeliveryStore) Enqueue(callbackURL string, result *StoredResult) (*Delivery, error) {
+	d := &Delivery{URL: callbackURL, Event: WEBHOOK_EVENT_RESULT, ResultID: result.ID}
+	return s.enqueue(d, func(d *Delivery) ([]byte, error) {
+		return json.Marshal(WebhookPayload{Event: d.Event, DeliveryID: d.ID, Result: result})
+	})
+}
+
+// enqueue stores a delivery with the payload built for its ID and starts sending it
+func (s *DeliveryStore) enqueue(d *Delivery, payload func(*Delivery) ([]byte, error)) (*Delivery, error) {
+	d.ID = newResultID()
+	d.Status = DELIVERY_PENDING
+	d.Attempts = []DeliveryAttempt{}
+	d.CreatedAt = time.Now().UTC()
+	body, err := payload(d)
+	if err != nil {
+		return nil, fmt.Errorf("encode webhook payload: %w", err)
+	}
+	d.payload = body
+
+	s.mu.Lock()
+	s.byID[d.ID] = d
+	s.order = append(s.order, d.ID)
+	s.evict()
+	s.mu.Unlock()
+
+	go s.deliver(d)
+	return d.snapshot(), nil
+}
+
+func (d *Delivery) snapshot() *Delivery {
+	c := *d
+	c.Attempts = append([]DeliveryAttempt(nil), d.Attempts...)
+	return &c
+}
+
+// post makes one attempt; mailto: deliveries of alert notices are mailed
+// instead, archive exports written to esmond and InfluxDB writes sent as
+// line protocol
+func (s *DeliveryStore) post(d *Delivery) DeliveryAttempt {
+	if strings.HasPrefix(d.URL, "mailto:") {
+		return mailAttempt(d)
+	}
+	switch d.Event {
+	case ESMOND_EVENT_ARCHIVE:
+		return esmondAttempt(d)
+	case INFLUX_EVENT_WRITE:
+		return influxAttempt(d)
+	}
+	attempt := DeliveryAttempt{At: time.Now().UTC()}
+	req, err := http.NewRequest(http.MethodPost, d.URL, bytes.NewReader(d.payload))
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	timestamp := strconv.FormatInt(attempt.At.Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "network-test-api/"+API_VERSION)
+	req.Header.Set("X-Webhook-Id", d.ID)
+	req.Header.Set("X-Webhook-Event", d.Event)
+	req.Header.Set("X-Webhook-Timestamp", timestamp)
+	if len(webhookConfig.Secret) > 0 {
+		req.Header.Set("X-Webhook-Signature", signPayload(webhookConfig.Secret, timestamp, d.payload))
+	}
+
+	client := checkedHTTPClient(webhookConfig.Timeout)
+	resp, err := client.Do(req)
+	attempt.DurationMs = float64(time.Since(attempt.At).Microseconds()) / 1000
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	_ = resp.Body.Close()
+	attempt.StatusCode = resp.StatusCode
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		attempt.Error = fmt.Sprintf("callback returned %s", resp.Status)
+	}
+	return attempt
+}
+
+// deliver attempts a delivery until it succeeds or the current cycle runs out of attempts
+func (s *DeliveryStore) deliver(d *Delivery) {
+	for {
+		attempt := s.post(d)
+
+		s.mu.Lock()
+		d.Attempts = append(d.Attempts, attempt)
+		d.cycle++
+		var wait time.Duration
+		switch {
+		case attempt.Error == "":
+			d.Status = DELIVERY_DELIVERED
+			d.DeliveredAt = &attempt.At
+			d.NextAttempt = nil
+		case d.cycle >= webhookConfig.MaxAttempts:
+			d.Status = DELIVERY_DEAD
+			d.NextAttempt = nil
+			errorf(nil, "Webhook %s to %s dead-lettered after %d attempts: %s", d.ID, d.URL, d.cycle, attempt.Error)
+		default:
+			wait = webhookConfig.retryDelay(d.cycle)
+			next := time.Now().UTC().Add(wait)
+			d.NextAttempt = &next
+		}
+		status := d.Status
+		s.mu.Unlock()
+
+		if status != DELIVERY_PENDING {
+			return
+		}
+		time.Sleep(wait)
+	}
+}
+
+// Get returns a copy of a delivery by ID
+func (s *DeliveryStore) Get(id string) (*Delivery, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d, ok := s.byID[id]
+	if !ok {
+		return nil, false
+	}
+	return d.snapshot(), true
+}
+
+// List returns deliveries oldest first, optionally filtered by status and result ID
+func (s *DeliveryStore) List(status, resultID string) []*Delivery {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := []*Delivery{}
+	for _, id := range s.order {
+		d := s.byID[id]
+		if (status != "" && d.Status != status) || (resultID != "" && d.ResultID != resultID) {
+			continue
+		}
+		list = append(list, d.snapshot())
+	}
+	return list
+}
+
+// Redeliver starts a new cycle of attempts for a dead-lettered delivery
+func (s *DeliveryStore) Redeliver(id string) (*Delivery, bool, error) {
+	s.mu.Lock()
+	d, ok := s.byID[id]
+	if !ok {
+		s.mu.Unlock()
+		return nil, false, nil
+	}
+	if d.Status != DELIVERY_DEAD {
+		s.mu.Unlock()
+		return nil, true, fmt.Errorf("delivery %s is %s; only dead deliveries can be redelivered", id, d.Status)
+	}
+	d.Status = DELIVERY_PENDING
+	d.cycle = 0
+	now := time.Now().UTC()
+	d.NextAttempt = &now
+	c := d.snapshot()
+	s.mu.Unlock()
+
+	go s.deliver(d)
+	return c, true, nil
+}
+
+// notifyCallback queues a webhook for a recorded result; data["id"] is missing when storing failed
+func notifyCallback(callbackURL string, data map[string]interface{}) {
+	if callbackURL == "" {
+		return
+	}
+	id, _ := data["id"].(string)
+	result, ok := resultStore.Get(id)
+	if !ok {
+		return
+	}
+	d, err := deliveryStore.Enqueue(callbackURL, result)
+	if err != nil {
+		warnf(nil, "Webhook for result %s not queued: %v", id, err)
+		return
+	}
+	data["callback"] = map[string]interface{}{
+		"url":         callbackURL,
+		"delivery_id": d.ID,
+	}
+}
+
+// configureWebhooks applies WEBHOOK_* settings at startup
+func configureWebhooks() {
+	cfg, err := loadWebhookConfig(os.Getenv)
+	if err != nil {
+		log.Fatalf("Webhook configuration failed: %v", err)
+	}
+	webhookConfig = cfg
+}
+
+func deliveryNotFound(w http.ResponseWriter, id string) {
+	jsonResponse(w, ApiResponse{
+		Status: "error",
+		Error:  fmt.Sprintf("delivery %s not found", id),
+	}, http.StatusNotFound)
+}
+
+func deliveryList(w http.ResponseWriter, r *http.Request) {
+	status := strings.ToLower(r.URL.Query().Get("status"))
+	switch status {
+	case "", DELIVERY_PENDING, DELIVERY_DELIVERED, DELIVERY_DEAD:
+	default:
+		jsonResponse(w, ApiResponse{
+			Status: "error",
+			Error:  fmt.Sprintf("invalid status %q (expected pending, delivered or dead)", status),
+		}, http.StatusBadRequest)
+		return
+	}
+	jsonResponse(w, ApiResponse{
+		Status: "ok",
+		Data:   deliveryStore.List(status, r.URL.Query().Get("result_id")),
+	}, http.StatusOK)
+}
+
+func deliveryDeadLetter(w http.ResponseWriter, r *http.Request) {
+	jsonResponse(w, ApiResponse{
+		Status: "ok",
+		Data:   deliveryStore.List(DELIVERY_DEAD, ""),
+	}, http.StatusOK)
+}
+
+func deliveryGet(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	d, ok := deliveryStore.Get(id)
+	if !ok {
+		deliveryNotFound(w, id)
+		return
+	}
+	jsonResponse(w, ApiResponse{
+		Status: "ok",
+		Data:   d,
+	}, http.StatusOK)
+}
+
+func deliveryRedeliver(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	d, found, err := deliveryStore.Redeliver(id)
+	if !found {
+		deliveryNotFound(w, id)
+		return
+	}
+	if err != nil {
+		jsonResponse(w, ApiResponse{
+			Status: "error",
+			Error:  err.Error(),
+		}, http.StatusConflict)
+		return
+	}
+	jsonResponse(w, ApiResponse{
+		Status: "ok",
+		Data:   d,
+	}, http.StatusOK)
+}
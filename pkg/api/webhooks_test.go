@@ -0,0 +1,65 @@
+package api
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWebhookRetryDelay(t *testing.T) {
+	tests := []struct {
+		failed int
+		want   time.Duration
+	}{
+		{1, 2 * time.Second},
+		{2, 4 * time.Second},
+		{3, 8 * time.Second},
+		{8, 256 * time.Second},
+		{9, 5 * time.Minute},
+		{50, 5 * time.Minute},
+	}
+
+	cfg := WebhookConfig{Backoff: 2 * time.Second, MaxBackoff: 5 * time.Minute}
+	for _, tt := range tests {
+		if got := cfg.retryDelay(tt.failed); got != tt.want {
+			t.Errorf("After %d failures: expected %v, got %v", tt.failed, tt.want, got)
+		}
+	}
+}
+
+func TestWebhookSignature(t *testing.T) {
+	body := []byte(`{"event":"result.created"}`)
+	secret := []byte("s3cret")
+
+	sig := signPayload(secret, "1700000000", body)
+	if len(sig) != len("sha256=")+64 || sig[:7] != "sha256=" {
+		t.Errorf("Expected sha256= and 64 hex digits, got %s", sig)
+	}
+	if sig != signPayload(secret, "1700000000", body) {
+		t.Errorf("Expected the signature to be deterministic")
+	}
+	if sig == signPayload(secret, "1700000001", body) {
+		t.Errorf("Expected the timestamp to be covered by the signature")
+	}
+	if sig == signPayload([]byte("other"), "1700000000", body) {
+		t.Errorf("Expected the signature to depend on the secret")
+	}
+}
+
+func TestLoadWebhookConfig(t *testing.T) {
+	cfg, err := loadWebhookConfig(testEnv(map[string]string{"WEBHOOK_MAX_ATTEMPTS": "3", "WEBHOOK_BACKOFF": "1s", "WEBHOOK_SECRET": "s3cret"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.MaxAttempts != 3 || cfg.Backoff != time.Second || string(cfg.Secret) != "s3cret" {
+		t.Errorf("Expected 3 attempts, a 1s backoff and the secret, got %+v", cfg)
+	}
+	if cfg.MaxBackoff != DEFAULT_WEBHOOK_MAX_BACKOFF {
+		t.Errorf("Expected the default maximum backoff, got %v", cfg.MaxBackoff)
+	}
+
+	for name, v := range map[string]string{"WEBHOOK_MAX_ATTEMPTS": "0", "WEBHOOK_BACKOFF": "-2s", "WEBHOOK_TIMEOUT": "ten"} {
+		if _, err := loadWebhookConfig(testEnv(map[string]string{name: v})); err == nil {
+			t.Errorf("Expected error for %s=%s", name, v)
+		}
+	}
+}
@@ -0,0 +1,252 @@
+package api
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Minimal RFC 6455 WebSocket server side, for pushing live results: text
+// messages both ways, ping/pong and the closing handshake, no extensions
+const (
+	WS_GUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11" // Of the Sec-WebSocket-Accept key
+
+	WS_OP_CONTINUATION = 0x0
+	WS_OP_TEXT         = 0x1
+	WS_OP_BINARY       = 0x2
+	WS_OP_CLOSE        = 0x8
+	WS_OP_PING         = 0x9
+	WS_OP_PONG         = 0xA
+
+	WS_CLOSE_NORMAL       = 1000
+	WS_CLOSE_PROTOCOL     = 1002
+	WS_CLOSE_UNSUPPORTED  = 1003
+	WS_CLOSE_TOO_BIG      = 1009
+	WS_MAX_MESSAGE        = 64 << 10 // Largest client message accepted
+	WS_WRITE_TIMEOUT      = 10 * time.Second
+	WS_CLOSE_WAIT_TIMEOUT = 2 * time.Second
+)
+
+var errWSClosed = errors.New("websocket closed")
+
+// wsConn is an upgraded connection. Writes may come from several goroutines;
+// reads from one.
+type wsConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+	wmu  sync.Mutex
+}
+
+// headerHasToken reports whether a comma-separated header lists token
+func headerHasToken(h http.Header, name, token string) bool {
+	for _, v := range h.Values(name) {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// wsAcceptKey is the Sec-WebSocket-Accept value answering key
+func wsAcceptKey(key string) string {
+	sum := sha1.Sum([]byte(key + WS_GUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// wsUpgrade checks the opening handshake of r and switches the connection to
+// WebSocket. Errors come with the HTTP status to refuse the handshake with,
+// before anything was written.
+func wsUpgrade(w http.ResponseWriter, r *http.Request) (*wsConn, int, error) {
+	key := r.Header.Get("Sec-WebSocket-Key")
+	switch {
+	case r.Method != http.MethodGet:
+		return nil, http.StatusMethodNotAllowed, fmt.Errorf("websocket handshake must be a GET request")
+	case !headerHasToken(r.Header, "Connection", "upgrade") || !headerHasToken(r.Header, "Upgrade", "websocket"):
+		return nil, http.StatusUpgradeRequired, fmt.Errorf("websocket endpoint: send Connection: Upgrade and Upgrade: websocket")
+	case r.Header.Get("Sec-WebSocket-Version") != "13":
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		return nil, http.StatusUpgradeRequired, fmt.Errorf("unsupported Sec-WebSocket-Version %q (expected 13)", r.Header.Get("Sec-WebSocket-Version"))
+	case key == "":
+		return nil, http.StatusBadRequest, fmt.Errorf("Sec-WebSocket-Key is required")
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		return nil, http.StatusInternalServerError, fmt.Errorf("websockets not supported")
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	_ = conn.SetDeadline(time.Time{})
+	response := "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: " + wsAcceptKey(key) + "\r\n\r\n"
+	if _, err := conn.Write([]byte(response)); err != nil {
+		_ = conn.Close()
+		return nil, http.StatusInternalServerError, err
+	}
+	return &wsConn{conn: conn, r: rw.Reader}, http.StatusSwitchingProtocols, nil
+}
+
+// writeFrame sends one unmasked, unfragmented frame
+func (c *wsConn) writeFrame(opcode byte, payload []byte) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	header := make([]byte, 2, 10)
+	header[0] = 0x80 | opcode // FIN
+	switch n := len(payload); {
+	case n < 126:
+		header[1] = byte(n)
+	case n <= 0xFFFF:
+		header[1] = 126
+		header = binary.BigEndian.AppendUint16(header, uint16(n))
+	default:
+		header[1] = 127
+		header = binary.BigEndian.AppendUint64(header, uint64(n))
+	}
+	_ = c.conn.SetWriteDeadline(time.Now().Add(WS_WRITE_TIMEOUT))
+	if _, err := c.conn.Write(append(header, payload...)); err != nil {
+		return err
+	}
+	return nil
+}
+
+// WriteText sends a text message
+func (c *wsConn) WriteText(data []byte) error {
+	return c.writeFrame(WS_OP_TEXT, data)
+}
+
+// Ping sends a ping, which the client answers with a pong
+func (c *wsConn) Ping() error {
+	return c.writeFrame(WS_OP_PING, nil)
+}
+
+// Close starts the closing handshake, waits briefly for the client's close
+// frame if no reader does, and closes the connection
+func (c *wsConn) Close(code int, reason string) {
+	payload := binary.BigEndian.AppendUint16(nil, uint16(code))
+	_ = c.writeFrame(WS_OP_CLOSE, append(payload, reason...))
+	_ = c.conn.SetReadDeadline(time.Now().Add(WS_CLOSE_WAIT_TIMEOUT))
+	time.AfterFunc(WS_CLOSE_WAIT_TIMEOUT, func() { _ = c.conn.Close() })
+}
+
+// readFrame reads one masked client frame; the caller holds the read side
+func (c *wsConn) readFrame() (fin bool, opcode byte, payload []byte, err error) {
+	var head [2]byte
+	if _, err = io.ReadFull(c.r, head[:]); err != nil {
+		return
+	}
+	fin, opcode = head[0]&0x80 != 0, head[0]&0x0F
+	if head[0]&0x70 != 0 {
+		return false, 0, nil, &wsCloseError{WS_CLOSE_PROTOCOL, "reserved bits set"}
+	}
+	if head[1]&0x80 == 0 {
+		return false, 0, nil, &wsCloseError{WS_CLOSE_PROTOCOL, "client frames must be masked"}
+	}
+	n := uint64(head[1] & 0x7F)
+	switch n {
+	case 126:
+		var ext [2]byte
+		if _, err = io.ReadFull(c.r, ext[:]); err != nil {
+			return
+		}
+		n = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err = io.ReadFull(c.r, ext[:]); err != nil {
+			return
+		}
+		n = binary.BigEndian.Uint64(ext[:])
+	}
+	if n > WS_MAX_MESSAGE {
+		return false, 0, nil, &wsCloseError{WS_CLOSE_TOO_BIG, "message too big"}
+	}
+	var mask [4]byte
+	if _, err = io.ReadFull(c.r, mask[:]); err != nil {
+		return
+	}
+	payload = make([]byte, n)
+	if _, err = io.ReadFull(c.r, payload); err != nil {
+		return
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return fin, opcode, payload, nil
+}
+
+// wsCloseError is a protocol violation the connection is closed with
+type wsCloseError struct {
+	code   int
+	reason string
+}
+
+func (e *wsCloseError) Error() string {
+	return fmt.Sprintf("websocket: %s", e.reason)
+}
+
+// ReadMessage returns the next text message, answering pings and joining
+// fragments on the way. A close frame from the client is answered and
+// returns errWSClosed; protocol violations close the connection.
+func (c *wsConn) ReadMessage() ([]byte, error) {
+	var message []byte
+	fragmented := false
+	for {
+		fin, opcode, payload, err := c.readFrame()
+		var closeErr *wsCloseError
+		if errors.As(err, &closeErr) {
+			c.Close(closeErr.code, closeErr.reason)
+			return nil, err
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch opcode {
+		case WS_OP_PING:
+			if err := c.writeFrame(WS_OP_PONG, payload); err != nil {
+				return nil, err
+			}
+			continue
+		case WS_OP_PONG:
+			continue
+		case WS_OP_CLOSE:
+			_ = c.writeFrame(WS_OP_CLOSE, payload)
+			_ = c.conn.Close()
+			return nil, errWSClosed
+		case WS_OP_BINARY:
+			c.Close(WS_CLOSE_UNSUPPORTED, "binary messages are not supported")
+			return nil, errWSClosed
+		case WS_OP_TEXT:
+			if fragmented {
+				c.Close(WS_CLOSE_PROTOCOL, "new message inside a fragmented one")
+				return nil, errWSClosed
+			}
+		case WS_OP_CONTINUATION:
+			if !fragmented {
+				c.Close(WS_CLOSE_PROTOCOL, "continuation without a message")
+				return nil, errWSClosed
+			}
+		default:
+			c.Close(WS_CLOSE_PROTOCOL, fmt.Sprintf("unknown opcode %d", opcode))
+			return nil, errWSClosed
+		}
+		message = append(message, payload...)
+		if len(message) > WS_MAX_MESSAGE {
+			c.Close(WS_CLOSE_TOO_BIG, "message too big")
+			return nil, errWSClosed
+		}
+		if fin {
+			return message, nil
+		}
+		fragmented = true
+	}
+}
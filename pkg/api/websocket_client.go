@@ -0,0 +1,208 @@
+package api
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+)
+
+// Minimal RFC 6455 WebSocket client side, for the NDT7 tests: the opening
+// handshake with one subprotocol, masked unfragmented writes and reads of
+// messages larger than the server side takes, no extensions
+const (
+	WS_MAX_CONTROL        = 125 // Payload limit of control frames
+	WS_CLIENT_READ_BUFFER = 64 << 10
+)
+
+// wsClient is a client connection. Writes may come from several goroutines;
+// reads from one.
+type wsClient struct {
+	conn net.Conn
+	br   *bufio.Reader
+
+	wmu  sync.Mutex // Serializes frames of the writer and the reader's replies
+	wbuf []byte
+}
+
+// wsHandshake upgrades conn, already connected to u's host, to a WebSocket
+// speaking subprotocol
+func wsHandshake(conn net.Conn, u *url.URL, subprotocol string) (*wsClient, error) {
+	nonce := make([]byte, 16)
+	_, _ = rand.Read(nonce)
+	key := base64.StdEncoding.EncodeToString(nonce)
+
+	req := &http.Request{
+		Method:     http.MethodGet,
+		URL:        u,
+		Host:       u.Host,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header: http.Header{
+			"Upgrade":                {"websocket"},
+			"Connection":             {"Upgrade"},
+			"Sec-WebSocket-Key":      {key},
+			"Sec-WebSocket-Version":  {"13"},
+			"Sec-WebSocket-Protocol": {subprotocol},
+			"User-Agent":             {"network-test-api/" + API_VERSION},
+		},
+	}
+	if err := req.Write(conn); err != nil {
+		return nil, err
+	}
+	br := bufio.NewReaderSize(conn, WS_CLIENT_READ_BUFFER)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	switch {
+	case resp.StatusCode != http.StatusSwitchingProtocols:
+		return nil, fmt.Errorf("server answered the upgrade with %s", resp.Status)
+	case !headerHasToken(resp.Header, "Upgrade", "websocket"):
+		return nil, fmt.Errorf("server upgraded to %q instead of websocket", resp.Header.Get("Upgrade"))
+	case resp.Header.Get("Sec-WebSocket-Accept") != wsAcceptKey(key):
+		return nil, fmt.Errorf("server answered with a wrong Sec-WebSocket-Accept")
+	case resp.Header.Get("Sec-WebSocket-Protocol") != subprotocol:
+		return nil, fmt.Errorf("server did not accept subprotocol %s", subprotocol)
+	}
+	return &wsClient{conn: conn, br: br}, nil
+}
+
+// writeMessage sends payload as a single masked frame
+func (c *wsClient) writeMessage(op byte, payload []byte) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+
+	header := make([]byte, 2, 14)
+	header[0] = 0x80 | op // FIN
+	switch n := len(payload); {
+	case n <= WS_MAX_CONTROL:
+		header[1] = 0x80 | byte(n)
+	case n <= 0xffff:
+		header[1] = 0x80 | 126
+		header = binary.BigEndian.AppendUint16(header, uint16(n))
+	default:
+		header[1] = 0x80 | 127
+		header = binary.BigEndian.AppendUint64(header, uint64(n))
+	}
+	var key [4]byte
+	_, _ = rand.Read(key[:])
+	header = append(header, key[:]...)
+
+	c.wbuf = append(append(c.wbuf[:0], header...), payload...)
+	wsMask(c.wbuf[len(header):], key)
+	_, err := c.conn.Write(c.wbuf)
+	return err
+}
+
+// wsMask applies the masking key to b in place
+func wsMask(b []byte, key [4]byte) {
+	for i := range b {
+		b[i] ^= key[i&3]
+	}
+}
+
+// close starts the closing handshake with the normal closure code
+func (c *wsClient) close() error {
+	return c.writeMessage(WS_OP_CLOSE, binary.BigEndian.AppendUint16(nil, WS_CLOSE_NORMAL))
+}
+
+// readMessage reads the next data message, of at most limit bytes, and returns
+// its opcode and size. Text payloads are returned; binary ones are counted and
+// discarded, as the tests only measure them. A close frame is answered and
+// returns errWSClosed.
+func (c *wsClient) readMessage(limit int64) (byte, int64, []byte, error) {
+	var op byte
+	var size int64
+	var text []byte
+	for {
+		fin, frameOp, length, err := c.readHeader()
+		if err != nil {
+			return 0, 0, nil, err
+		}
+		if frameOp >= WS_OP_CLOSE {
+			if !fin || length > WS_MAX_CONTROL {
+				return 0, 0, nil, fmt.Errorf("websocket: malformed control frame")
+			}
+			payload := make([]byte, length)
+			if _, err := io.ReadFull(c.br, payload); err != nil {
+				return 0, 0, nil, err
+			}
+			switch frameOp {
+			case WS_OP_CLOSE:
+				_ = c.writeMessage(WS_OP_CLOSE, payload[:min(len(payload), 2)])
+				return 0, 0, nil, errWSClosed
+			case WS_OP_PING:
+				if err := c.writeMessage(WS_OP_PONG, payload); err != nil {
+					return 0, 0, nil, err
+				}
+			}
+			continue
+		}
+
+		switch {
+		case frameOp == WS_OP_CONTINUATION && op == 0:
+			return 0, 0, nil, fmt.Errorf("websocket: continuation frame without a message")
+		case frameOp != WS_OP_CONTINUATION && op != 0:
+			return 0, 0, nil, fmt.Errorf("websocket: new message inside a fragmented one")
+		case frameOp != WS_OP_CONTINUATION:
+			op = frameOp
+		}
+		if size += length; size > limit {
+			return 0, 0, nil, fmt.Errorf("websocket: message exceeds %d bytes", limit)
+		}
+		if op == WS_OP_TEXT {
+			start := len(text)
+			text = append(text, make([]byte, length)...)
+			_, err = io.ReadFull(c.br, text[start:])
+		} else {
+			_, err = io.CopyN(io.Discard, c.br, length)
+		}
+		if err != nil {
+			return 0, 0, nil, err
+		}
+		if fin {
+			return op, size, text, nil
+		}
+	}
+}
+
+// readHeader reads a frame header; servers must not mask their frames
+func (c *wsClient) readHeader() (bool, byte, int64, error) {
+	var b [8]byte
+	if _, err := io.ReadFull(c.br, b[:2]); err != nil {
+		return false, 0, 0, err
+	}
+	fin, op := b[0]&0x80 != 0, b[0]&0x0f
+	if b[0]&0x70 != 0 {
+		return false, 0, 0, errors.New("websocket: reserved bits set without an extension")
+	}
+	if b[1]&0x80 != 0 {
+		return false, 0, 0, errors.New("websocket: masked frame from the server")
+	}
+	length := int64(b[1] & 0x7f)
+	switch length {
+	case 126:
+		if _, err := io.ReadFull(c.br, b[:2]); err != nil {
+			return false, 0, 0, err
+		}
+		length = int64(binary.BigEndian.Uint16(b[:2]))
+	case 127:
+		if _, err := io.ReadFull(c.br, b[:8]); err != nil {
+			return false, 0, 0, err
+		}
+		if length = int64(binary.BigEndian.Uint64(b[:8])); length < 0 {
+			return false, 0, 0, errors.New("websocket: frame length out of range")
+		}
+	}
+	return fin, op, length, nil
+}
@@ -0,0 +1,239 @@
+package nettest
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// SourceBinding pins a test's connections to a source address and/or an
+// interface, so multi-homed agents control the egress path, and opens them
+// in a network namespace, so one agent can test from several tenants' networks
+type SourceBinding struct {
+	Address   string `json:"address,omitempty"`   // source_address
+	Interface string `json:"interface,omitempty"` // interface, bound with SO_BINDTODEVICE
+	Namespace string `json:"namespace,omitempty"` // netns
+
+	ip     net.IP
+	nsPath string
+}
+
+// Directory in which ip netns add names network namespaces
+const NETNS_RUN_DIR = "/var/run/netns"
+
+var (
+	netnsNamePattern = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]{0,63}$`)
+	netnsProcPattern = regexp.MustCompile(`^/proc/[0-9]+/ns/net$`)
+)
+
+// ParseSourceBinding validates a request's source_address and interface. With a
+// source address the family follows it: auto becomes that address's family and
+// the other family is rejected.
+func ParseSourceBinding(address, iface, family string) (*SourceBinding, string, error) {
+	return ParseSourceBindingIn("", address, iface, family)
+}
+
+// ParseSourceBindingIn is ParseSourceBinding for a test run in the network
+// namespace netns, a name of ip netns or /proc/<pid>/ns/net of a process in
+// it; the interface and source address are looked up in that namespace
+func ParseSourceBindingIn(netns, address, iface, family string) (*SourceBinding, string, error) {
+	if netns == "" && address == "" && iface == "" {
+		return nil, family, nil
+	}
+	b := &SourceBinding{Address: address, Interface: iface, Namespace: netns}
+	if netns != "" {
+		if !namespaceSupported {
+			return nil, family, fmt.Errorf("netns is only available on Linux agents")
+		}
+		path, err := namespacePath(netns)
+		if err != nil {
+			return nil, family, err
+		}
+		if _, err := os.Stat(path); err != nil {
+			return nil, family, fmt.Errorf("unknown netns %q", netns)
+		}
+		b.nsPath = path
+	}
+	err := b.InNamespace(func() error {
+		var err error
+		family, err = b.parse(family)
+		return err
+	})
+	if err != nil {
+		return nil, family, err
+	}
+	return b, family, nil
+}
+
+// namespacePath is the file of a network namespace named by ip netns, or
+// given as /proc/<pid>/ns/net of a process running in it
+func namespacePath(netns string) (string, error) {
+	switch {
+	case netnsProcPattern.MatchString(netns):
+		return netns, nil
+	case netnsNamePattern.MatchString(netns):
+		return filepath.Join(NETNS_RUN_DIR, netns), nil
+	}
+	return "", fmt.Errorf("invalid netns %q (expected a name of ip netns or /proc/<pid>/ns/net)", netns)
+}
+
+// parse checks the interface and source address, in the namespace of the test
+func (b *SourceBinding) parse(family string) (string, error) {
+	if b.Interface != "" {
+		if !bindToDeviceSupported {
+			return family, fmt.Errorf("interface is only available on Linux agents")
+		}
+		if _, err := net.InterfaceByName(b.Interface); err != nil {
+			return family, fmt.Errorf("unknown interface %q", b.Interface)
+		}
+	}
+	if b.Address != "" {
+		if b.ip = net.ParseIP(b.Address); b.ip == nil {
+			return family, fmt.Errorf("source_address %q is not an IP address", b.Address)
+		}
+		if !isLocalAddress(b.ip) {
+			return family, fmt.Errorf("source_address %s is not configured on this agent", b.Address)
+		}
+		return sourceFamily(b.ip, family)
+	}
+	return family, nil
+}
+
+// InNamespace runs fn in the test's network namespace, on a thread of its
+// own, or as is without one. Sockets opened by fn belong to the namespace.
+func (b *SourceBinding) InNamespace(fn func() error) error {
+	if b == nil || b.nsPath == "" {
+		return fn()
+	}
+	return inNamespace(b.nsPath, fn)
+}
+
+// Resolver returns the resolver for the test's hostnames. With a namespace
+// its DNS queries go out from within it, to the name servers of the agent's
+// own /etc/resolv.conf; without one it is the default resolver.
+func (b *SourceBinding) Resolver() *net.Resolver {
+	if b == nil || b.nsPath == "" {
+		return net.DefaultResolver
+	}
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			var conn net.Conn
+			err := b.InNamespace(func() error {
+				var err error
+				conn, err = (&net.Dialer{}).DialContext(ctx, network, address)
+				return err
+			})
+			return conn, err
+		},
+	}
+}
+
+// sourceFamily is the address family of a test sent from ip: auto narrows to
+// ip's family, which any other choice must match
+func sourceFamily(ip net.IP, family string) (string, error) {
+	switch own := IPFamily(ip); family {
+	case FAMILY_AUTO, own:
+		return own, nil
+	case FAMILY_COMPARE:
+		return family, fmt.Errorf("address_family compare connects over both families and cannot use source_address")
+	default:
+		return family, fmt.Errorf("source_address %s is not an %s address", ip, family)
+	}
+}
+
+// isLocalAddress reports whether ip is assigned to one of the agent's interfaces
+func isLocalAddress(ip net.IP) bool {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return false
+	}
+	for _, a := range addrs {
+		if n, ok := a.(*net.IPNet); ok && n.IP.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Dialer returns a dialer for network (tcp or udp) that binds its sockets as
+// requested; a nil binding dials from the kernel's choice of source. With a
+// namespace, dial it within InNamespace. Each address it connects to passes
+// CheckTarget first, as resolved from the name WithDialedName recorded in the
+// dial's context.
+func (b *SourceBinding) Dialer(network string, timeout time.Duration) *net.Dialer {
+	d := &net.Dialer{Timeout: timeout, ControlContext: checkTargetControl}
+	if b == nil {
+		return d
+	}
+	if b.ip != nil {
+		if network == "udp" {
+			d.LocalAddr = &net.UDPAddr{IP: b.ip}
+		} else {
+			d.LocalAddr = &net.TCPAddr{IP: b.ip}
+		}
+	}
+	if b.Interface != "" {
+		d.ControlContext = func(ctx context.Context, network, address string, c syscall.RawConn) error {
+			if err := checkTargetControl(ctx, network, address, c); err != nil {
+				return err
+			}
+			return bindToDevice(c, b.Interface)
+		}
+	}
+	return d
+}
+
+// DialContext returns a dial function for clients such as http.Transport that
+// dial host:port: it dials through Dialer, with the host recorded as the name
+// the addresses it connects to were resolved from
+func (b *SourceBinding) DialContext(timeout time.Duration) func(ctx context.Context, network, address string) (net.Conn, error) {
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			return nil, err
+		}
+		return b.Dialer(network, timeout).DialContext(WithDialedName(ctx, host), network, address)
+	}
+}
+
+// checkTargetControl refuses to connect a socket to an address CheckTarget
+// rejects, whatever name it was dialed by
+func checkTargetControl(ctx context.Context, _, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil
+	}
+	host, _, _ = strings.Cut(host, "%")
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return nil
+	}
+	if err := CheckTarget(dialedName(ctx), ip); err != nil {
+		return fmt.Errorf("%s %v", ip, err)
+	}
+	return nil
+}
+
+// BindConn binds an already open socket to the interface, for sockets created
+// by libraries. Its source address follows the control connection.
+func (b *SourceBinding) BindConn(conn net.Conn) error {
+	if b == nil || b.Interface == "" {
+		return nil
+	}
+	sc, ok := conn.(syscall.Conn)
+	if !ok {
+		return fmt.Errorf("connection has no socket")
+	}
+	raw, err := sc.SyscallConn()
+	if err != nil {
+		return err
+	}
+	return bindToDevice(raw, b.Interface)
+}
@@ -0,0 +1,21 @@
+//go:build linux
+
+package nettest
+
+import (
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+const bindToDeviceSupported = true
+
+// bindToDevice sets SO_BINDTODEVICE; binding to a VRF device runs the socket in
+// that VRF
+func bindToDevice(c syscall.RawConn, iface string) error {
+	var opErr error
+	if err := c.Control(func(fd uintptr) { opErr = unix.BindToDevice(int(fd), iface) }); err != nil {
+		return err
+	}
+	return opErr
+}
@@ -0,0 +1,16 @@
+//go:build !linux
+
+package nettest
+
+import (
+	"errors"
+	"syscall"
+)
+
+// SO_BINDTODEVICE is Linux only; requests with interface set are rejected elsewhere.
+
+const bindToDeviceSupported = false
+
+func bindToDevice(c syscall.RawConn, iface string) error {
+	return errors.New("binding to an interface is only available on Linux")
+}
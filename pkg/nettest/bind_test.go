@@ -0,0 +1,100 @@
+package nettest
+
+import (
+	"context"
+	"net"
+	"testing"
+)
+
+func TestSourceFamily(t *testing.T) {
+	tests := []struct {
+		address string
+		family  string
+		want    string
+		wantErr bool
+	}{
+		{"198.51.100.20", FAMILY_AUTO, FAMILY_IPV4, false},
+		{"2001:db8::20", FAMILY_AUTO, FAMILY_IPV6, false},
+		{"198.51.100.20", FAMILY_IPV4, FAMILY_IPV4, false},
+		{"::ffff:198.51.100.20", FAMILY_AUTO, FAMILY_IPV4, false}, // Mapped addresses are IPv4
+		{"198.51.100.20", FAMILY_IPV6, "", true},
+		{"2001:db8::20", FAMILY_IPV4, "", true},
+		{"2001:db8::20", FAMILY_COMPARE, "", true},
+	}
+	for _, tt := range tests {
+		got, err := sourceFamily(net.ParseIP(tt.address), tt.family)
+		switch {
+		case tt.wantErr && err == nil:
+			t.Errorf("Expected an error for %s with %s, got %s", tt.address, tt.family, got)
+		case !tt.wantErr && err != nil:
+			t.Errorf("Expected %s with %s to be valid, got %v", tt.address, tt.family, err)
+		case !tt.wantErr && got != tt.want:
+			t.Errorf("Expected family %s for %s with %s, got %s", tt.want, tt.address, tt.family, got)
+		}
+	}
+}
+
+func TestNamespacePath(t *testing.T) {
+	tests := []struct {
+		netns   string
+		want    string
+		wantErr bool
+	}{
+		{"blue", "/var/run/netns/blue", false},
+		{"cust-42.prod", "/var/run/netns/cust-42.prod", false},
+		{"/proc/4242/ns/net", "/proc/4242/ns/net", false},
+		{"..", "", true},
+		{"../../etc/passwd", "", true},
+		{"/proc/self/ns/net", "", true},
+		{"/var/run/netns/blue", "", true},
+		{"", "", true},
+	}
+	for _, tt := range tests {
+		got, err := namespacePath(tt.netns)
+		switch {
+		case tt.wantErr && err == nil:
+			t.Errorf("Expected an error for %q, got %s", tt.netns, got)
+		case !tt.wantErr && err != nil:
+			t.Errorf("Expected %q to be valid, got %v", tt.netns, err)
+		case !tt.wantErr && got != tt.want:
+			t.Errorf("Expected %q to be %s, got %s", tt.netns, tt.want, got)
+		}
+	}
+}
+
+func TestParseSourceBindingIn_UnknownNamespace(t *testing.T) {
+	if _, _, err := ParseSourceBindingIn("network-test-api-missing", "", "", FAMILY_AUTO); err == nil {
+		t.Error("Expected an error for a namespace that does not exist")
+	}
+	b, family, err := ParseSourceBindingIn("", "", "", FAMILY_AUTO)
+	if b != nil || family != FAMILY_AUTO || err != nil {
+		t.Errorf("Expected no binding without netns, address or interface, got %v, %s, %v", b, family, err)
+	}
+}
+
+func TestSourceBinding_InNamespaceWithout(t *testing.T) {
+	var b *SourceBinding
+	ran := false
+	if err := b.InNamespace(func() error { ran = true; return nil }); err != nil || !ran {
+		t.Errorf("Expected a nil binding to run fn as is, got ran=%v, %v", ran, err)
+	}
+}
+
+func TestSourceBinding_ResolverWithout(t *testing.T) {
+	var b *SourceBinding
+	if b.Resolver() != net.DefaultResolver {
+		t.Error("Expected a nil binding to resolve with the default resolver")
+	}
+	bound, _, err := ParseSourceBindingIn("", "127.0.0.1", "", FAMILY_AUTO)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bound.Resolver() != net.DefaultResolver {
+		t.Error("Expected a binding without a namespace to resolve with the default resolver")
+	}
+
+	v6, v4, err := ResolveFamiliesFrom(context.Background(), "192.0.2.7", FAMILY_AUTO, bound)
+	if err != nil || len(v6) != 0 || len(v4) != 1 || !v4[0].Equal(net.ParseIP("192.0.2.7")) {
+		t.Errorf("Expected an address target as is, got %v %v, %v", v6, v4, err)
+	}
+}
@@ -0,0 +1,334 @@
+package nettest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+// Address family selection for control connections
+const (
+	FAMILY_AUTO    = "auto"    // RFC 8305 Happy Eyeballs across IPv6 and IPv4
+	FAMILY_IPV4    = "ipv4"    // IPv4 only
+	FAMILY_IPV6    = "ipv6"    // IPv6 only
+	FAMILY_COMPARE = "compare" // Connect over both families in full and keep the faster one
+
+	// RFC 8305 recommended timings
+	HAPPY_EYEBALLS_RESOLUTION_DELAY = 50 * time.Millisecond  // Wait for AAAA after A arrives first
+	HAPPY_EYEBALLS_ATTEMPT_DELAY    = 250 * time.Millisecond // Stagger between connection attempts
+)
+
+// DialAttempt is one connection attempt made while dialing a control connection
+type DialAttempt struct {
+	Family    string  `json:"family"`
+	Address   string  `json:"address"`
+	ConnectMs float64 `json:"connect_ms,omitempty"` // Time to connect or fail (omitted when canceled)
+	Error     string  `json:"error,omitempty"`
+	Won       bool    `json:"won"`
+}
+
+// DialReport describes how a control connection was established
+type DialReport struct {
+	Mode      string        `json:"mode"`   // Requested address_family
+	Family    string        `json:"family"` // Winning family (ipv4 or ipv6)
+	Address   string        `json:"address"`
+	ResolveMs float64       `json:"resolve_ms"` // Name resolution before the first attempt
+	ConnectMs float64       `json:"connect_ms"`
+	Attempts  []DialAttempt `json:"attempts"`
+
+	NAT64       bool   `json:"nat64,omitempty"`        // Address lies in a NAT64 prefix: the target is reached over IPv4 through a translator
+	IPv4Address string `json:"ipv4_address,omitempty"` // The IPv4 address it translates to
+}
+
+// targetCheck vets the addresses tests connect to, see SetTargetCheck
+var targetCheck func(name string, ip net.IP) error
+
+// SetTargetCheck has every address a test connects to vetted by check: the
+// addresses ResolveFamilies returns, and the peer of each socket a
+// SourceBinding's dialer connects, as it connects. A hostname that resolves
+// to other addresses when the test runs than when its request was checked
+// then cannot lead the test elsewhere. check also gets the name the address
+// was resolved from, or "" when it was dialed as an address or the name is
+// not known (see WithDialedName). nil removes the check.
+func SetTargetCheck(check func(name string, ip net.IP) error) {
+	targetCheck = check
+}
+
+// CheckTarget returns why ip, resolved from name, may not be connected to, or nil
+func CheckTarget(name string, ip net.IP) error {
+	if targetCheck == nil {
+		return nil
+	}
+	return targetCheck(name, ip)
+}
+
+// dialedNameKey is the context key of WithDialedName
+type dialedNameKey struct{}
+
+// WithDialedName returns ctx recording that the addresses a SourceBinding's
+// dialer connects to with it were resolved from host, for the target check
+func WithDialedName(ctx context.Context, host string) context.Context {
+	return context.WithValue(ctx, dialedNameKey{}, host)
+}
+
+// dialedName is the host WithDialedName recorded in ctx, or ""
+func dialedName(ctx context.Context) string {
+	name, _ := ctx.Value(dialedNameKey{}).(string)
+	return name
+}
+
+// checkResolved vets the addresses host resolved to
+func checkResolved(host string, ips ...[]net.IP) error {
+	for _, family := range ips {
+		for _, ip := range family {
+			if err := CheckTarget(host, ip); err != nil {
+				if ip.String() == host {
+					return fmt.Errorf("%s %v", host, err)
+				}
+				return fmt.Errorf("%s resolves to %s, which %v", host, ip, err)
+			}
+		}
+	}
+	return nil
+}
+
+type dialResult struct {
+	index   int
+	conn    net.Conn
+	err     error
+	elapsed time.Duration
+}
+
+func IPFamily(ip net.IP) string {
+	if ip.To4() != nil {
+		return FAMILY_IPV4
+	}
+	return FAMILY_IPV6
+}
+
+// ResolveFamilies looks up AAAA and A records concurrently (RFC 8305 section 3).
+// Once A records arrive, AAAA answers are only waited for up to the resolution delay.
+func ResolveFamilies(ctx context.Context, host, family string) ([]net.IP, []net.IP, error) {
+	return ResolveFamiliesFrom(ctx, host, family, nil)
+}
+
+// ResolveFamiliesFrom is ResolveFamilies with the lookups made through a
+// source binding's resolver, from within its namespace
+func ResolveFamiliesFrom(ctx context.Context, host, family string, bind *SourceBinding) ([]net.IP, []net.IP, error) {
+	if ip := net.ParseIP(host); ip != nil {
+		if err := checkResolved(host, []net.IP{ip}); err != nil {
+			return nil, nil, err
+		}
+		if IPFamily(ip) == FAMILY_IPV4 {
+			return nil, []net.IP{ip}, nil
+		}
+		return []net.IP{ip}, nil, nil
+	}
+
+	type lookup struct {
+		ips []net.IP
+		err error
+	}
+	resolver := bind.Resolver()
+	lookupFamily := func(network string) chan lookup {
+		ch := make(chan lookup, 1)
+		go func() {
+			ips, err := resolver.LookupIP(ctx, network, host)
+			ch <- lookup{ips, err}
+		}()
+		return ch
+	}
+
+	var v6ch, v4ch chan lookup
+	if family != FAMILY_IPV4 {
+		v6ch = lookupFamily("ip6")
+	}
+	if family != FAMILY_IPV6 {
+		v4ch = lookupFamily("ip4")
+	}
+
+	var v6, v4 []net.IP
+	var lastErr error
+	var grace <-chan time.Time
+	for v6ch != nil || v4ch != nil {
+		select {
+		case r := <-v6ch:
+			v6, v6ch = r.ips, nil
+			if r.err != nil {
+				lastErr = r.err
+			}
+		case r := <-v4ch:
+			v4, v4ch = r.ips, nil
+			if r.err != nil {
+				lastErr = r.err
+			}
+			if len(v4) > 0 && v6ch != nil {
+				grace = time.After(HAPPY_EYEBALLS_RESOLUTION_DELAY)
+			}
+		case <-grace:
+			// AAAA is late, go ahead with IPv4 only
+			v6ch = nil
+		}
+	}
+
+	if len(v6) == 0 && len(v4) == 0 {
+		if lastErr == nil {
+			lastErr = fmt.Errorf("no %s addresses for %s", family, host)
+		}
+		return nil, nil, lastErr
+	}
+	if err := checkResolved(host, v6, v4); err != nil {
+		return nil, nil, err
+	}
+	return v6, v4, nil
+}
+
+// InterleaveFamilies orders addresses IPv6 first, alternating families (RFC 8305 section 4)
+func InterleaveFamilies(v6, v4 []net.IP) []net.IP {
+	addrs := make([]net.IP, 0, len(v6)+len(v4))
+	for i := 0; i < len(v6) || i < len(v4); i++ {
+		if i < len(v6) {
+			addrs = append(addrs, v6[i])
+		}
+		if i < len(v4) {
+			addrs = append(addrs, v4[i])
+		}
+	}
+	return addrs
+}
+
+// DialControl opens a TCP control connection to host:port using the requested address family.
+//
+// auto races the resolved addresses Happy Eyeballs style, while ipv4 and ipv6 restrict the
+// candidates to one family. compare connects to the first address of each family at the
+// same time, waits for both and keeps the faster connection, so both connect times are reported.
+func DialControl(host string, port int, family string, timeout time.Duration) (net.Conn, *DialReport, error) {
+	return DialControlFrom(context.Background(), host, port, family, timeout, nil)
+}
+
+// DialControlFrom is DialControl with every attempt made through a source
+// binding, given up when ctx ends
+func DialControlFrom(ctx context.Context, host string, port int, family string, timeout time.Duration, bind *SourceBinding) (net.Conn, *DialReport, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	resolveStart := time.Now()
+	v6, v4, err := ResolveFamiliesFrom(ctx, host, family, bind)
+	if err != nil {
+		return nil, nil, err
+	}
+	resolved := time.Since(resolveStart)
+
+	var addrs []net.IP
+	if family == FAMILY_COMPARE {
+		if len(v6) > 0 {
+			addrs = append(addrs, v6[0])
+		}
+		if len(v4) > 0 {
+			addrs = append(addrs, v4[0])
+		}
+	} else {
+		addrs = InterleaveFamilies(v6, v4)
+	}
+
+	report := &DialReport{Mode: family, ResolveMs: float64(resolved.Microseconds()) / 1000, Attempts: make([]DialAttempt, 0, len(addrs))}
+	attemptCtx, cancelAttempts := context.WithCancel(WithDialedName(ctx, host))
+	defer cancelAttempts()
+
+	results := make(chan dialResult, len(addrs))
+	dialer := bind.Dialer("tcp", 0)
+	start := func(i int) {
+		address := net.JoinHostPort(addrs[i].String(), fmt.Sprintf("%d", port))
+		report.Attempts = append(report.Attempts, DialAttempt{Family: IPFamily(addrs[i]), Address: address})
+		go func() {
+			var conn net.Conn
+			var elapsed time.Duration
+			err := bind.InNamespace(func() error {
+				t0 := time.Now()
+				var err error
+				conn, err = dialer.DialContext(attemptCtx, "tcp", address)
+				elapsed = time.Since(t0)
+				return err
+			})
+			results <- dialResult{index: i, conn: conn, err: err, elapsed: elapsed}
+		}()
+	}
+
+	next, pending := 0, 0
+	stagger := time.NewTimer(HAPPY_EYEBALLS_ATTEMPT_DELAY)
+	defer stagger.Stop()
+	startNext := func() {
+		if next < len(addrs) {
+			start(next)
+			next++
+			pending++
+			stagger.Reset(HAPPY_EYEBALLS_ATTEMPT_DELAY)
+		}
+	}
+
+	if family == FAMILY_COMPARE {
+		for next < len(addrs) {
+			startNext()
+		}
+	} else {
+		startNext()
+	}
+
+	var winner *dialResult
+	var lastErr error
+	for pending > 0 {
+		select {
+		case r := <-results:
+			pending--
+			attempt := &report.Attempts[r.index]
+			switch {
+			case r.err == nil && (winner == nil || r.elapsed < winner.elapsed):
+				if winner != nil {
+					_ = winner.conn.Close()
+				}
+				winner = &r
+				attempt.ConnectMs = float64(r.elapsed.Microseconds()) / 1000
+				if family != FAMILY_COMPARE {
+					cancelAttempts()
+				}
+			case r.err == nil:
+				_ = r.conn.Close()
+				attempt.ConnectMs = float64(r.elapsed.Microseconds()) / 1000
+			case errors.Is(r.err, context.Canceled) && winner != nil:
+				attempt.Error = "canceled"
+			default:
+				lastErr = r.err
+				attempt.ConnectMs = float64(r.elapsed.Microseconds()) / 1000
+				attempt.Error = r.err.Error()
+				// A failed attempt starts the next one straight away
+				if winner == nil {
+					startNext()
+				}
+			}
+		case <-stagger.C:
+			if winner == nil {
+				startNext()
+			}
+		}
+	}
+
+	if winner == nil {
+		if lastErr == nil {
+			lastErr = fmt.Errorf("no addresses to dial")
+		}
+		return nil, report, lastErr
+	}
+
+	won := &report.Attempts[winner.index]
+	won.Won = true
+	report.Family = won.Family
+	report.Address = won.Address
+	report.ConnectMs = won.ConnectMs
+	if v4 := NAT64Embedded(addrs[winner.index]); v4 != nil {
+		report.NAT64 = true
+		report.IPv4Address = v4.String()
+	}
+	return winner.conn, report, nil
+}
@@ -0,0 +1,36 @@
+package nettest
+
+import (
+	"net"
+	"testing"
+)
+
+func ips(addrs ...string) []net.IP {
+	out := make([]net.IP, len(addrs))
+	for i, a := range addrs {
+		out[i] = net.ParseIP(a)
+	}
+	return out
+}
+
+func TestInterleaveFamilies_IPv6First(t *testing.T) {
+	got := InterleaveFamilies(ips("2001:db8::1", "2001:db8::2"), ips("192.0.2.1", "192.0.2.2", "192.0.2.3"))
+	want := []string{"2001:db8::1", "192.0.2.1", "2001:db8::2", "192.0.2.2", "192.0.2.3"}
+
+	if len(got) != len(want) {
+		t.Fatalf("Expected %d addresses, got %d", len(want), len(got))
+	}
+	for i := range want {
+		if got[i].String() != want[i] {
+			t.Errorf("Expected %s at position %d, got %s", want[i], i, got[i])
+		}
+	}
+}
+
+func TestInterleaveFamilies_SingleFamily(t *testing.T) {
+	got := InterleaveFamilies(nil, ips("192.0.2.1", "192.0.2.2"))
+
+	if len(got) != 2 || got[0].String() != "192.0.2.1" {
+		t.Errorf("Expected IPv4 addresses in order, got %v", got)
+	}
+}
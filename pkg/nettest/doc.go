@@ -0,0 +1,19 @@
+// Package nettest holds the measurement clients of the network test API: an
+// iperf3 client that speaks iperf3's control protocol itself, and a TWAMP
+// sender (RFC 5357), with the socket layer they share, Happy Eyeballs dials,
+// source binding, ECN, path MTU and socket buffers. Other Go programs can
+// import it to run the tests the API runs without going over HTTP:
+//
+//	client := nettest.NewIperf3Client("iperf.example.net",
+//		nettest.WithDuration(10*time.Second),
+//		nettest.WithProtocol("UDP"),
+//		nettest.WithBandwidth(50e6))
+//	defer client.Close()
+//	result, err := client.Run(ctx)
+//
+//	runner := nettest.NewTwampRunner("twamp.example.net", nettest.WithCount(20), nettest.WithDSCP(46))
+//	result, err := runner.Run(ctx)
+//
+// Run returns once the test completes; ending ctx ends it at once with an
+// Error of code ERR_CANCELED.
+package nettest
@@ -0,0 +1,126 @@
+package nettest
+
+import ()
+
+// ECN codepoints in the two low bits of the IPv4 TOS / IPv6 traffic class byte (RFC 3168)
+const (
+	ECN_NOT_ECT = 0
+	ECN_ECT1    = 1
+	ECN_ECT0    = 2
+	ECN_CE      = 3
+	ECN_MASK    = 3
+)
+
+// tcpStreamECN is the kernel's view of ECN on one TCP data stream
+type tcpStreamECN struct {
+	negotiated  bool   // The handshake agreed on ECN
+	ectSeen     bool   // A received segment carried ECT or CE
+	delivered   uint64 // Segments the peer acknowledged
+	deliveredCE uint64 // Of which the peer echoed a CE mark with ECE
+	ceCounted   bool   // The kernel reports deliveredCE (Linux 4.18 and later)
+	retransmits uint64
+}
+
+// TCPECNReport describes ECN on the data streams of an iperf3 TCP test
+type TCPECNReport struct {
+	Streams           int      `json:"streams"`
+	NegotiatedStreams int      `json:"negotiated_streams"`
+	Negotiated        bool     `json:"negotiated"`                  // Every stream negotiated ECN
+	CEMarks           *uint64  `json:"ce_marks,omitempty"`          // Segments the server echoed a CE mark for (uploads)
+	CEPercent         *float64 `json:"ce_percent,omitempty"`        // CE marks per acknowledged segment
+	CEObserved        *bool    `json:"ce_observed,omitempty"`       // ECE feedback came back (uploads)
+	MarkingsSurvived  *bool    `json:"markings_survived,omitempty"` // ECT reached the far end, if that can be told
+	Retransmits       uint64   `json:"retransmits"`
+}
+
+// summarizeTCPECN combines the streams of a test. Uploads see the server's ECE
+// feedback, downloads see the ECT codepoints of the segments they receive, so
+// each direction answers a different half of the question.
+func summarizeTCPECN(streams []tcpStreamECN, reverse bool) *TCPECNReport {
+	report := &TCPECNReport{Streams: len(streams)}
+	var delivered, marks uint64
+	ceCounted, ectSeen := true, true
+	for _, s := range streams {
+		report.Retransmits += s.retransmits
+		if !s.negotiated {
+			continue
+		}
+		report.NegotiatedStreams++
+		delivered += s.delivered
+		marks += s.deliveredCE
+		ceCounted = ceCounted && s.ceCounted
+		ectSeen = ectSeen && s.ectSeen
+	}
+	report.Negotiated = report.Streams > 0 && report.NegotiatedStreams == report.Streams
+	if report.NegotiatedStreams == 0 {
+		return report
+	}
+
+	if reverse {
+		report.MarkingsSurvived = &ectSeen
+		return report
+	}
+	if !ceCounted {
+		return report
+	}
+	observed := marks > 0
+	report.CEMarks = &marks
+	report.CEObserved = &observed
+	if delivered > 0 {
+		percent := float64(marks) / float64(delivered) * 100
+		report.CEPercent = &percent
+	}
+	// A CE mark can only be set on a packet that still carried ECT at the
+	// bottleneck; without one, bleaching and an unmarked path look the same
+	if observed {
+		report.MarkingsSurvived = &observed
+	}
+	return report
+}
+
+// UDPECNReport counts the ECN codepoints of reflected TWAMP probes, all sent as ECT(0)
+type UDPECNReport struct {
+	SentCodepoint    string  `json:"sent_codepoint"`
+	Replies          uint64  `json:"replies"` // Replies whose codepoint could be read
+	NotECT           uint64  `json:"not_ect"`
+	ECT0             uint64  `json:"ect0"`
+	ECT1             uint64  `json:"ect1"`
+	CE               uint64  `json:"ce"`
+	CEPercent        float64 `json:"ce_percent"`
+	BleachedPercent  float64 `json:"bleached_percent"` // Replies arriving as Not-ECT
+	CEObserved       bool    `json:"ce_observed"`
+	MarkingsSurvived bool    `json:"markings_survived"` // Every reply still carried ECT or CE
+}
+
+func NewUDPECNReport() *UDPECNReport {
+	return &UDPECNReport{SentCodepoint: "ect0"}
+}
+
+// Observe counts the codepoint of one reply; negative means it was not available
+func (r *UDPECNReport) Observe(codepoint int) {
+	if codepoint < 0 {
+		return
+	}
+	r.Replies++
+	switch codepoint & ECN_MASK {
+	case ECN_NOT_ECT:
+		r.NotECT++
+	case ECN_ECT0:
+		r.ECT0++
+	case ECN_ECT1:
+		r.ECT1++
+	case ECN_CE:
+		r.CE++
+	}
+}
+
+// Finish derives the shares and verdicts once all replies are counted
+func (r *UDPECNReport) Finish() {
+	if r.Replies == 0 {
+		return
+	}
+	r.CEPercent = float64(r.CE) / float64(r.Replies) * 100
+	r.BleachedPercent = float64(r.NotECT) / float64(r.Replies) * 100
+	r.CEObserved = r.CE > 0
+	r.MarkingsSurvived = r.NotECT == 0
+}
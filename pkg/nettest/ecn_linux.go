@@ -0,0 +1,125 @@
+//go:build linux
+
+package nettest
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+const ECNSupported = true
+
+// tcpi_options bits of struct tcp_info (linux/tcp.h)
+const (
+	TCPI_OPT_ECN      = 8  // ECN was negotiated at the handshake
+	TCPI_OPT_ECN_SEEN = 16 // At least one received segment carried ECT or CE
+)
+
+// TCPECNSetting returns net.ipv4.tcp_ecn, which also applies to IPv6: 1 requests
+// ECN on outgoing connections, 2 (the default) only accepts it on incoming ones,
+// 3 and 4 request it with AccECN
+func TCPECNSetting() (int, bool) {
+	b, err := os.ReadFile("/proc/sys/net/ipv4/tcp_ecn")
+	if err != nil {
+		return 0, false
+	}
+	setting, err := strconv.Atoi(strings.TrimSpace(string(b)))
+	if err != nil {
+		return 0, false
+	}
+	return setting, true
+}
+
+// TCPECNRequests reports whether a tcp_ecn setting puts ECN in the SYN
+func TCPECNRequests(setting int) bool {
+	return setting == 1 || setting == 3 || setting == 4
+}
+
+// streamECN reads the ECN state of a TCP stream from TCP_INFO
+func streamECN(conn net.Conn) (tcpStreamECN, error) {
+	var s tcpStreamECN
+	err := ControlSocket(conn, func(fd int, _ bool) error {
+		var info unix.TCPInfo
+		size := uint32(unsafe.Sizeof(info))
+		// Raw getsockopt, since the returned length tells whether the kernel knows delivered_ce
+		_, _, errno := unix.Syscall6(unix.SYS_GETSOCKOPT, uintptr(fd), unix.IPPROTO_TCP, unix.TCP_INFO,
+			uintptr(unsafe.Pointer(&info)), uintptr(unsafe.Pointer(&size)), 0)
+		if errno != 0 {
+			return errno
+		}
+		s = tcpStreamECN{
+			negotiated:  info.Options&TCPI_OPT_ECN != 0,
+			ectSeen:     info.Options&TCPI_OPT_ECN_SEEN != 0,
+			delivered:   uint64(info.Delivered),
+			deliveredCE: uint64(info.Delivered_ce),
+			ceCounted:   uintptr(size) >= unsafe.Offsetof(info.Delivered_ce)+unsafe.Sizeof(info.Delivered_ce),
+			retransmits: uint64(info.Total_retrans),
+		}
+		return nil
+	})
+	return s, err
+}
+
+// SetECT marks a UDP socket's datagrams ECT(0) on top of the DSCP in tos, and asks
+// for the codepoint of received datagrams
+func SetECT(conn net.Conn, tos int) error {
+	return ControlSocket(conn, func(fd int, v6 bool) error {
+		if v6 {
+			if err := unix.SetsockoptInt(fd, unix.IPPROTO_IPV6, unix.IPV6_TCLASS, tos|ECN_ECT0); err != nil {
+				return err
+			}
+			return unix.SetsockoptInt(fd, unix.IPPROTO_IPV6, unix.IPV6_RECVTCLASS, 1)
+		}
+		if err := unix.SetsockoptInt(fd, unix.IPPROTO_IP, unix.IP_TOS, tos|ECN_ECT0); err != nil {
+			return err
+		}
+		return unix.SetsockoptInt(fd, unix.IPPROTO_IP, unix.IP_RECVTOS, 1)
+	})
+}
+
+// SetProbeTOS sets the TOS byte, or on IPv6 the traffic class, of a UDP socket
+// and reads back the value the kernel applied. The twamp library sets it on
+// IPv4 only.
+func SetProbeTOS(conn net.Conn, tos int) (int, error) {
+	var applied int
+	err := ControlSocket(conn, func(fd int, v6 bool) error {
+		level, opt := unix.IPPROTO_IP, unix.IP_TOS
+		if v6 {
+			level, opt = unix.IPPROTO_IPV6, unix.IPV6_TCLASS
+		}
+		if err := unix.SetsockoptInt(fd, level, opt, tos); err != nil {
+			return err
+		}
+		var err error
+		applied, err = unix.GetsockoptInt(fd, level, opt)
+		return err
+	})
+	return applied, err
+}
+
+// ReadWithECN reads a datagram from a socket prepared by SetECT and returns the
+// ECN codepoint it arrived with, -1 if the kernel did not report one
+func ReadWithECN(conn *net.UDPConn, buf, oob []byte) (int, int, error) {
+	n, oobn, _, _, err := conn.ReadMsgUDP(buf, oob)
+	if err != nil {
+		return n, -1, err
+	}
+	msgs, err := unix.ParseSocketControlMessage(oob[:oobn])
+	if err != nil {
+		return n, -1, nil
+	}
+	for _, m := range msgs {
+		switch {
+		case m.Header.Level == unix.IPPROTO_IP && m.Header.Type == unix.IP_TOS && len(m.Data) >= 1:
+			return n, int(m.Data[0]) & ECN_MASK, nil
+		case m.Header.Level == unix.IPPROTO_IPV6 && m.Header.Type == unix.IPV6_TCLASS && len(m.Data) >= 4:
+			return n, int(*(*int32)(unsafe.Pointer(&m.Data[0]))) & ECN_MASK, nil
+		}
+	}
+	return n, -1, nil
+}
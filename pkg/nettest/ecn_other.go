@@ -0,0 +1,32 @@
+//go:build !linux
+
+package nettest
+
+import (
+	"errors"
+	"net"
+)
+
+// ECN state is only read on Linux; requests with ecn set are rejected elsewhere.
+
+const ECNSupported = false
+
+func TCPECNSetting() (int, bool) { return 0, false }
+
+func TCPECNRequests(setting int) bool { return false }
+
+func streamECN(conn net.Conn) (tcpStreamECN, error) {
+	return tcpStreamECN{}, errors.New("ECN state is only available on Linux")
+}
+
+func SetECT(conn net.Conn, tos int) error {
+	return errors.New("ECN marking is only available on Linux")
+}
+
+// The twamp library has set the TOS byte on IPv4; it cannot be read back here
+func SetProbeTOS(conn net.Conn, tos int) (int, error) { return tos, nil }
+
+func ReadWithECN(conn *net.UDPConn, buf, oob []byte) (int, int, error) {
+	n, err := conn.Read(buf)
+	return n, -1, err
+}
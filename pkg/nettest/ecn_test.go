@@ -0,0 +1,104 @@
+package nettest
+
+import (
+	"math"
+	"testing"
+)
+
+func TestSummarizeTCPECNUpload(t *testing.T) {
+	report := summarizeTCPECN([]tcpStreamECN{
+		{negotiated: true, delivered: 1000, deliveredCE: 10, ceCounted: true, retransmits: 1},
+		{negotiated: true, delivered: 1000, deliveredCE: 30, ceCounted: true, retransmits: 2},
+	}, false)
+
+	if !report.Negotiated || report.NegotiatedStreams != 2 {
+		t.Errorf("Expected both streams negotiated, got %d of %d", report.NegotiatedStreams, report.Streams)
+	}
+	if report.CEMarks == nil || *report.CEMarks != 40 {
+		t.Fatalf("Expected 40 CE marks, got %v", report.CEMarks)
+	}
+	if math.Abs(*report.CEPercent-2) > 1e-9 {
+		t.Errorf("Expected 2%% CE, got %.3f", *report.CEPercent)
+	}
+	if report.CEObserved == nil || !*report.CEObserved {
+		t.Error("Expected ce_observed")
+	}
+	// A mark proves ECT reached the bottleneck
+	if report.MarkingsSurvived == nil || !*report.MarkingsSurvived {
+		t.Error("Expected markings_survived when marks came back")
+	}
+	if report.Retransmits != 3 {
+		t.Errorf("Expected 3 retransmits, got %d", report.Retransmits)
+	}
+}
+
+func TestSummarizeTCPECNUnmarkedUpload(t *testing.T) {
+	report := summarizeTCPECN([]tcpStreamECN{{negotiated: true, delivered: 500, ceCounted: true}}, false)
+	if report.CEObserved == nil || *report.CEObserved {
+		t.Error("Expected ce_observed false")
+	}
+	// Bleaching and an unmarked path look the same on an upload
+	if report.MarkingsSurvived != nil {
+		t.Errorf("Expected markings_survived unset, got %v", *report.MarkingsSurvived)
+	}
+
+	report = summarizeTCPECN([]tcpStreamECN{{negotiated: true, delivered: 500}}, false)
+	if report.CEMarks != nil {
+		t.Error("Expected no ce_marks from a kernel without delivered_ce")
+	}
+}
+
+func TestSummarizeTCPECNDownload(t *testing.T) {
+	report := summarizeTCPECN([]tcpStreamECN{
+		{negotiated: true, ectSeen: true},
+		{negotiated: true, ectSeen: false},
+	}, true)
+	if report.MarkingsSurvived == nil || *report.MarkingsSurvived {
+		t.Error("Expected markings_survived false when a stream saw no ECT")
+	}
+	if report.CEMarks != nil || report.CEObserved != nil {
+		t.Error("Expected no CE fields on downloads")
+	}
+}
+
+func TestSummarizeTCPECNNotNegotiated(t *testing.T) {
+	report := summarizeTCPECN([]tcpStreamECN{{negotiated: false, retransmits: 4}, {negotiated: true, ceCounted: true}}, false)
+	if report.Negotiated {
+		t.Error("Expected negotiated false when a stream refused ECN")
+	}
+	if report.NegotiatedStreams != 1 || report.Retransmits != 4 {
+		t.Errorf("Expected 1 negotiated stream and 4 retransmits, got %d and %d", report.NegotiatedStreams, report.Retransmits)
+	}
+
+	report = summarizeTCPECN([]tcpStreamECN{{negotiated: false}}, false)
+	if report.CEObserved != nil || report.MarkingsSurvived != nil {
+		t.Error("Expected no verdicts without a negotiated stream")
+	}
+}
+
+func TestUDPECNReport(t *testing.T) {
+	r := NewUDPECNReport()
+	for i := 0; i < 90; i++ {
+		r.Observe(0xb8 | ECN_ECT0) // DSCP bits are ignored
+	}
+	for i := 0; i < 10; i++ {
+		r.Observe(ECN_CE)
+	}
+	r.Observe(-1)
+	r.Finish()
+
+	if r.Replies != 100 || r.ECT0 != 90 || r.CE != 10 {
+		t.Errorf("Expected 100 replies, 90 ECT(0) and 10 CE, got %d, %d and %d", r.Replies, r.ECT0, r.CE)
+	}
+	if math.Abs(r.CEPercent-10) > 1e-9 || !r.CEObserved || !r.MarkingsSurvived {
+		t.Errorf("Expected 10%% CE with markings intact, got %.1f%% (%v, %v)", r.CEPercent, r.CEObserved, r.MarkingsSurvived)
+	}
+
+	bleached := NewUDPECNReport()
+	bleached.Observe(ECN_NOT_ECT)
+	bleached.Observe(ECN_ECT0)
+	bleached.Finish()
+	if bleached.MarkingsSurvived || bleached.BleachedPercent != 50 {
+		t.Errorf("Expected 50%% bleached, got %.1f%% (survived=%v)", bleached.BleachedPercent, bleached.MarkingsSurvived)
+	}
+}
@@ -1,41 +1,14 @@
-package unit
+package nettest
 
 import (
 	"math"
 	"testing"
 )
 
-// ErrorEstimateInfo represents parsed Error Estimate field (RFC 4656/5357)
-type ErrorEstimateInfo struct {
-	Synced       bool
-	Unavailable  bool
-	Scale        uint8
-	Multiplier   uint8
-	ErrorSeconds float64
-}
-
-// parseErrorEstimate extracts S, Z, Scale, and Multiplier from the 16-bit Error Estimate field
-func parseErrorEstimate(ee uint16) ErrorEstimateInfo {
-	info := ErrorEstimateInfo{
-		Synced:      (ee>>15)&1 == 1,
-		Unavailable: (ee>>14)&1 == 1,
-		Scale:       uint8((ee >> 8) & 0x3F),
-		Multiplier:  uint8(ee & 0xFF),
-	}
-
-	if info.Unavailable || info.Multiplier == 0 {
-		info.ErrorSeconds = -1
-	} else {
-		info.ErrorSeconds = float64(info.Multiplier) * math.Pow(2, -float64(info.Scale))
-	}
-
-	return info
-}
-
 func TestParseErrorEstimate_SyncedClock(t *testing.T) {
 	// S-bit set (bit 15), Scale=10, Multiplier=1 -> 0x8A01
 	ee := uint16(0x8A01)
-	info := parseErrorEstimate(ee)
+	info := ParseErrorEstimate(ee)
 
 	if !info.Synced {
 		t.Errorf("Expected Synced=true, got false")
@@ -60,7 +33,7 @@ func TestParseErrorEstimate_SyncedClock(t *testing.T) {
 func TestParseErrorEstimate_UnsyncedClock(t *testing.T) {
 	// S-bit not set, Scale=5, Multiplier=135 -> 0x0587
 	ee := uint16(0x0587)
-	info := parseErrorEstimate(ee)
+	info := ParseErrorEstimate(ee)
 
 	if info.Synced {
 		t.Errorf("Expected Synced=false, got true")
@@ -85,7 +58,7 @@ func TestParseErrorEstimate_UnsyncedClock(t *testing.T) {
 func TestParseErrorEstimate_Unavailable(t *testing.T) {
 	// Z-bit set (bit 14) -> timestamp unavailable
 	ee := uint16(0x4001)
-	info := parseErrorEstimate(ee)
+	info := ParseErrorEstimate(ee)
 
 	if info.Synced {
 		t.Errorf("Expected Synced=false, got true")
@@ -101,7 +74,7 @@ func TestParseErrorEstimate_Unavailable(t *testing.T) {
 func TestParseErrorEstimate_ZeroMultiplier(t *testing.T) {
 	// Multiplier=0 means unavailable regardless of Z-bit
 	ee := uint16(0x8A00)
-	info := parseErrorEstimate(ee)
+	info := ParseErrorEstimate(ee)
 
 	if !info.Synced {
 		t.Errorf("Expected Synced=true, got false")
@@ -117,7 +90,7 @@ func TestParseErrorEstimate_ZeroMultiplier(t *testing.T) {
 func TestParseErrorEstimate_MaxScale(t *testing.T) {
 	// Max scale = 63 (6 bits), Multiplier=1 -> very small error
 	ee := uint16(0x3F01)
-	info := parseErrorEstimate(ee)
+	info := ParseErrorEstimate(ee)
 
 	if info.Scale != 63 {
 		t.Errorf("Expected Scale=63, got %d", info.Scale)
@@ -133,7 +106,7 @@ func TestParseErrorEstimate_MaxScale(t *testing.T) {
 func TestParseErrorEstimate_ReflectorExample(t *testing.T) {
 	// Real-world example from perfSONAR: 0x8587
 	ee := uint16(0x8587)
-	info := parseErrorEstimate(ee)
+	info := ParseErrorEstimate(ee)
 
 	if !info.Synced {
 		t.Errorf("Expected Synced=true, got false")
@@ -149,7 +122,7 @@ func TestParseErrorEstimate_ReflectorExample(t *testing.T) {
 func TestParseErrorEstimate_BothFlags(t *testing.T) {
 	// Both S and Z bits set -> 0xC001
 	ee := uint16(0xC001)
-	info := parseErrorEstimate(ee)
+	info := ParseErrorEstimate(ee)
 
 	if !info.Synced {
 		t.Errorf("Expected Synced=true, got false")
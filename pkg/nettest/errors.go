@@ -0,0 +1,23 @@
+package nettest
+
+import (
+	"context"
+	"fmt"
+)
+
+// Code of the error Run returns when its context ends the test
+const ERR_CANCELED = "ERR_CANCELED"
+
+// Error is a test error with a machine-readable code, such as ERR_AUTH_FAILED
+type Error struct {
+	Code string
+	Err  error
+}
+
+func (e *Error) Error() string { return e.Err.Error() }
+func (e *Error) Unwrap() error { return e.Err }
+
+// canceledError reports a test ended by ctx; its cause stays in the chain
+func canceledError(ctx context.Context) error {
+	return &Error{ERR_CANCELED, fmt.Errorf("test canceled: %w", context.Cause(ctx))}
+}
@@ -0,0 +1,1440 @@
+package nettest
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// iperf3 Protocol Constants
+const (
+	// Protocol States
+	TEST_START       = 1
+	TEST_RUNNING     = 2
+	TEST_END         = 4
+	PARAM_EXCHANGE   = 9
+	CREATE_STREAMS   = 10
+	EXCHANGE_RESULTS = 13
+	DISPLAY_RESULTS  = 14
+	IPERF_START      = 15
+	IPERF_DONE       = 16
+	ACCESS_DENIED    = -1
+	SERVER_ERROR     = -2
+
+	// Protocol Constants
+	COOKIE_SIZE         = 37
+	DEFAULT_TCP_BLKSIZE = 128 * 1024 // 128KB
+	DEFAULT_UDP_BLKSIZE = 1460
+	UDP_HEADER_SIZE     = 12 // sec, usec, packet count (32-bit each, big endian)
+
+	// UDP stream setup: the client announces each stream with a datagram and waits
+	// for the server's reply before opening the next (iperf3 does not check either value)
+	UDP_CONNECT_MSG     = 0x36373839
+	UDP_CONNECT_TIMEOUT = 5 * time.Second
+)
+
+// iperf3 Client
+type Iperf3Client struct {
+	Host        string
+	Port        int
+	Duration    int
+	Parallel    int
+	Protocol    string
+	Reverse     bool
+	BlockSize   int
+	Bandwidth   int64         // Bandwidth limit in bits per second, 0 for none
+	PacingTimer time.Duration // Granularity of the sending streams' pacing (iperf3 --pacing-timer)
+	Payload     *PayloadGenerator
+	Family      string         // Address family for the control connection (auto, ipv4, ipv6, compare)
+	Bind        *SourceBinding // Source address and interface of all connections, nil for the defaults
+	Dial        *DialReport    // How the control connection was established
+	ECN         bool           // Report the ECN state of TCP streams
+	NumBytes    int64          // Stop after this many bytes on all streams (iperf3 -n)
+	BlockCount  int            // Stop after this many blocks of BlockSize (iperf3 -k)
+	Omit        int            // Seconds run before Duration and left out of the results (iperf3 -O)
+	Congestion  string         // TCP congestion control algorithm of both ends (iperf3 -C), empty for the defaults
+	Window      int            // SO_SNDBUF and SO_RCVBUF of the data streams in bytes (iperf3 -w), 0 for the kernel's autotuning
+	ZeroCopy    bool           // Send TCP uploads with sendfile (iperf3 -Z), Linux only
+	TCPInfo     bool           // Sample TCP_INFO of the streams of TCP uploads, Linux only
+	Auth        *Iperf3Auth    // Login for authenticated servers (iperf3 --username), nil for none
+
+	OnPhase    func(phase string)   // Called as the test enters connect, param_exchange, create_streams, run and exchange_results
+	OnInterval func(Iperf3Interval) // Called with each reporting interval past the omit period, as it is taken
+
+	ctx               context.Context // Of the running test, see Run
+	connMu            sync.Mutex      // Guards controlConn and streams while they are opened, for abort
+	aborted           bool
+	controlConn       net.Conn
+	cookie            []byte
+	streams           []net.Conn
+	streamTransferred []int64 // Bytes moved on each stream so far (atomic), sampled for the intervals
+	transferred       int64   // Bytes moved on all streams so far (atomic), checked against targetBytes
+	endStreams        sync.Once
+
+	streamBytes       []int64 // Per-stream totals reported to the server at EXCHANGE_RESULTS
+	streamPackets     []int64
+	streamRetransmits []int                // Per-stream TCP_INFO retransmits, nil when unknown
+	streamRTTs        []tcpStreamRTT       // Per-stream TCP_INFO RTT at the end of the transfer, nil when unknown
+	streamUDP         []udpReceiveStats    // Per-stream loss and jitter of received datagrams (reverse UDP tests only)
+	mtu               *mtuTracker          // Path MTU feedback (forward UDP tests only)
+	congestionUsed    string               // Algorithm our TCP streams ran, read back after the test
+	socketBuffers     *Iperf3SocketBuffers // Buffer sizes granted to the first stream, nil when unknown
+	zeroCopyStreams   int64                // Streams that sent with sendfile (atomic)
+	tcpInfo           *TCPInfoReport       // TCP_INFO samples of the streams, with TCPInfo
+}
+
+// Defaults of NewIperf3Client
+const (
+	DEFAULT_IPERF3_PORT     = 5201
+	DEFAULT_IPERF3_DURATION = 5                 // Seconds
+	DEFAULT_BANDWIDTH       = 100 * 1000 * 1000 // 100 Mbit/s default
+)
+
+// iperf3 Test Parameters (sent to server)
+type Iperf3Params struct {
+	TCP         bool   `json:"tcp"`
+	UDP         bool   `json:"udp,omitempty"`
+	Omit        int    `json:"omit"`
+	Time        int    `json:"time"`
+	Num         int64  `json:"num"`
+	BlockCount  int    `json:"blockcount"`
+	Parallel    int    `json:"parallel"`
+	Len         int    `json:"len"`
+	PacingTimer int    `json:"pacing_timer"`
+	ClientVer   string `json:"client_version"`
+	Reverse     int    `json:"reverse,omitempty"`
+	Congestion  string `json:"congestion,omitempty"`
+	Window      int    `json:"window,omitempty"`
+	AuthToken   string `json:"authtoken,omitempty"`
+}
+
+// iperf3 Test Results
+type Iperf3Result struct {
+	Server        string  `json:"server"`
+	Port          int     `json:"port"`
+	Protocol      string  `json:"protocol"`
+	Duration      float64 `json:"duration_sec"`
+	SentBytes     int64   `json:"sent_bytes"`
+	ReceivedBytes int64   `json:"received_bytes,omitempty"`
+	BandwidthMbps float64 `json:"bandwidth_mbps"`
+	Retransmits   int     `json:"retransmits,omitempty"`
+
+	// Transfer-limited tests (num_bytes or block_count)
+	TargetBytes   int64 `json:"-"`
+	TargetReached bool  `json:"-"` // The amount was moved before the duration ran out
+
+	// Omitted warm-up, excluded from the bytes, duration and bandwidth above
+	OmitSec      int   `json:"-"`
+	OmittedBytes int64 `json:"-"`
+
+	// TCP congestion control of the sending and receiving end, empty where unknown
+	SenderCongestion   string `json:"-"`
+	ReceiverCongestion string `json:"-"`
+
+	SocketBuffers *Iperf3SocketBuffers `json:"-"` // Effective SO_SNDBUF and SO_RCVBUF of the data streams
+	ZeroCopy      bool                 `json:"-"` // Every stream sent with sendfile
+
+	// TCP retransmits, read from TCP_INFO on forward tests and taken from the server on reverse ones
+	HasRetransmits    bool          `json:"-"`
+	StreamRetransmits []int         `json:"-"` // Per stream, in stream order
+	RetransmitSeries  []SeriesPoint `json:"-"` // Retransmits per interval (forward tests only)
+
+	// Receiver-side UDP statistics, reported by the server on uploads and measured by the client on downloads
+	ReceiverReport bool    `json:"-"`
+	Packets        int64   `json:"packets,omitempty"`
+	LostPackets    int64   `json:"lost_packets,omitempty"`
+	LossPercent    float64 `json:"loss_percent,omitempty"`
+	JitterMs       float64 `json:"jitter_ms,omitempty"`
+	OutOfOrder     int64   `json:"out_of_order_packets,omitempty"` // UDP downloads, where the client receives
+	PacketsSent    int64   `json:"packets_sent,omitempty"`         // UDP uploads
+
+	ServerResults *Iperf3ServerReport `json:"-"` // The server's own measurement, from EXCHANGE_RESULTS
+
+	Dial      *DialReport      `json:"-"` // Control connection family and connect times
+	MTU       *MTUReport       `json:"-"` // Path MTU seen by forward UDP tests
+	ECN       *TCPECNReport    `json:"-"` // ECN negotiation and marks of TCP streams
+	StartedAt time.Time        `json:"-"` // Start of data transfer, the origin of Series
+	Intervals []Iperf3Interval `json:"-"` // Per-second bytes, throughput and retransmits
+	Pacing    *PacingReport    `json:"-"` // Achieved against requested rate (forward tests only)
+	TCPInfo   *TCPInfoReport   `json:"-"` // TCP_INFO of the sending streams over the test, with TCPInfo
+	Streams   []Iperf3Stream   `json:"-"` // Per-stream totals, in stream order
+	Series    []SeriesPoint    `json:"-"` // Per-interval throughput in Mbps
+}
+
+// One reporting interval of an iperf3 test, like the intervals of iperf3's JSON output
+type Iperf3Interval struct {
+	Start         float64                `json:"start"` // Seconds from the start of data transfer
+	End           float64                `json:"end"`
+	Bytes         int64                  `json:"bytes"`
+	BandwidthMbps float64                `json:"bandwidth_mbps"`
+	Retransmits   *int                   `json:"retransmits,omitempty"` // TCP uploads, from TCP_INFO
+	Streams       []Iperf3IntervalStream `json:"streams,omitempty"`     // Per stream, with parallel streams
+	Omitted       bool                   `json:"omitted,omitempty"`     // Within the omit period, left out of the results
+}
+
+// One stream's share of an interval
+type Iperf3IntervalStream struct {
+	Bytes         int64   `json:"bytes"`
+	BandwidthMbps float64 `json:"bandwidth_mbps"`
+	Retransmits   *int    `json:"retransmits,omitempty"`
+}
+
+// One stream's totals over the test. Parallel streams differ only by their
+// local port, so unequal shares point at ECMP hashing them onto different paths.
+type Iperf3Stream struct {
+	ID            int      `json:"id"`    // iperf3 stream ID, as in the server's report
+	Local         string   `json:"local"` // Local address and port of the stream
+	Bytes         int64    `json:"bytes"`
+	BandwidthMbps float64  `json:"bandwidth_mbps"`
+	Retransmits   *int     `json:"retransmits,omitempty"` // TCP, when known
+	RTTMs         *float64 `json:"rtt_ms,omitempty"`      // TCP on Linux: smoothed RTT from TCP_INFO at the end of the transfer
+	RTTVarMs      *float64 `json:"rttvar_ms,omitempty"`   // Its variation, on uploads
+}
+
+// TCP_INFO of each sending stream over a test, sampled every interval and
+// once more at the end of the transfer, for the congestion behavior ss -ti shows
+type TCPInfoReport struct {
+	Streams []TCPInfoStream `json:"streams"`
+}
+
+// One stream's TCP_INFO samples
+type TCPInfoStream struct {
+	ID      int               `json:"id"` // iperf3 stream ID, as in streams
+	Samples []TCPInfoSnapshot `json:"samples"`
+	Final   *TCPInfoSnapshot  `json:"final,omitempty"` // At the end of the transfer, before the streams close
+}
+
+// A TCP stream's state as TCP_INFO reported it at one moment
+type TCPInfoSnapshot struct {
+	T                float64  `json:"t"`                          // Seconds from the start of data transfer, including the omit period
+	Cwnd             uint32   `json:"cwnd"`                       // Congestion window in segments
+	Ssthresh         *uint32  `json:"ssthresh,omitempty"`         // Slow start threshold in segments, once the stream has left slow start
+	MSS              uint32   `json:"mss"`                        // Sender MSS in bytes
+	RTTMs            float64  `json:"rtt_ms"`                     // Smoothed RTT
+	RTTVarMs         float64  `json:"rttvar_ms"`                  // Its variation
+	MinRTTMs         float64  `json:"min_rtt_ms,omitempty"`       // Lowest RTT seen, on kernels that report it
+	PacingRateMbps   *float64 `json:"pacing_rate_mbps,omitempty"` // Rate the kernel paces the stream to, unset while unlimited
+	DeliveryRateMbps float64  `json:"delivery_rate_mbps"`         // Most recent delivery rate estimate, as BBR uses
+	Unacked          uint32   `json:"unacked"`                    // Segments in flight
+	BytesRetrans     uint64   `json:"bytes_retrans"`              // Bytes retransmitted so far
+	Retransmits      uint32   `json:"retransmits"`                // Segments retransmitted so far
+}
+
+// iperf3 per-stream results as exchanged at EXCHANGE_RESULTS
+type Iperf3StreamResults struct {
+	ID          int     `json:"id"`
+	Bytes       int64   `json:"bytes"`
+	Retransmits int     `json:"retransmits"`
+	Jitter      float64 `json:"jitter"`  // Seconds
+	Errors      int64   `json:"errors"`  // Lost datagrams (UDP receiver)
+	Packets     int64   `json:"packets"` // Datagrams sent / highest sequence seen
+	StartTime   float64 `json:"start_time"`
+	EndTime     float64 `json:"end_time"`
+}
+
+// iperf3 results message; the server rejects the exchange if any field is missing
+type Iperf3Results struct {
+	CPUUtilTotal         float64               `json:"cpu_util_total"`
+	CPUUtilUser          float64               `json:"cpu_util_user"`
+	CPUUtilSystem        float64               `json:"cpu_util_system"`
+	SenderHasRetransmits int                   `json:"sender_has_retransmits"`
+	CongestionUsed       string                `json:"congestion_used,omitempty"` // TCP congestion control of the reporting end
+	Streams              []Iperf3StreamResults `json:"streams"`
+}
+
+// The server's side of a test as it reported it at EXCHANGE_RESULTS: the
+// receiver of an upload, the sender of a download
+type Iperf3ServerReport struct {
+	Role           string               `json:"role"` // receiver or sender
+	Bytes          int64                `json:"bytes"`
+	BandwidthMbps  float64              `json:"bandwidth_mbps"`
+	CPUUtilPercent float64              `json:"cpu_util_percent"`
+	Retransmits    *int                 `json:"retransmits,omitempty"`  // TCP sender that could read TCP_INFO
+	Packets        int64                `json:"packets,omitempty"`      // UDP: datagrams sent, or highest sequence seen by a receiver
+	LostPackets    *int64               `json:"lost_packets,omitempty"` // UDP receiver only, as are loss_percent and jitter_ms
+	LossPercent    *float64             `json:"loss_percent,omitempty"`
+	JitterMs       *float64             `json:"jitter_ms,omitempty"`
+	Streams        []Iperf3ServerStream `json:"streams"`
+}
+
+// One stream of the server's report, matched to ours by iperf3 stream ID
+type Iperf3ServerStream struct {
+	ID            int      `json:"id"`
+	Bytes         int64    `json:"bytes"`
+	BandwidthMbps float64  `json:"bandwidth_mbps"`
+	Retransmits   *int     `json:"retransmits,omitempty"`
+	Packets       int64    `json:"packets,omitempty"`
+	LostPackets   *int64   `json:"lost_packets,omitempty"`
+	JitterMs      *float64 `json:"jitter_ms,omitempty"`
+}
+
+// NewIperf3Client creates a client for an iperf3 server; Run runs the test
+func NewIperf3Client(host string, opts ...Option) *Iperf3Client {
+	o := newOptions(opts)
+	c := &Iperf3Client{
+		Host:        host,
+		Port:        DEFAULT_IPERF3_PORT,
+		Duration:    DEFAULT_IPERF3_DURATION,
+		Parallel:    1,
+		Protocol:    "TCP",
+		Reverse:     o.reverse,
+		Bandwidth:   DEFAULT_BANDWIDTH,
+		PacingTimer: DEFAULT_PACING_TIMER,
+		Payload:     NewPayloadGenerator(PayloadRandom),
+		Family:      FAMILY_AUTO,
+		Bind:        o.bind,
+		ECN:         o.ecn,
+		NumBytes:    o.numBytes,
+		BlockCount:  o.blockCount,
+		Congestion:  o.congestion,
+		Window:      o.window,
+		ZeroCopy:    o.zeroCopy,
+		TCPInfo:     o.tcpInfo,
+		Auth:        o.auth,
+		OnPhase:     o.onPhase,
+		OnInterval:  o.onInterval,
+		cookie:      generateCookie(),
+		streams:     make([]net.Conn, 0),
+	}
+	if o.port > 0 {
+		c.Port = o.port
+	}
+	if o.duration > 0 {
+		c.Duration = seconds(o.duration)
+	}
+	if o.parallel > 1 {
+		c.Parallel = o.parallel
+	}
+	if o.protocol != "" {
+		c.Protocol = strings.ToUpper(o.protocol)
+	}
+	if o.bandwidthSet && o.bandwidth >= 0 {
+		c.Bandwidth = o.bandwidth
+	}
+	if o.pacingTimer > 0 {
+		c.PacingTimer = o.pacingTimer
+	}
+	c.BlockSize = DEFAULT_TCP_BLKSIZE
+	if c.Protocol == "UDP" {
+		c.BlockSize = DEFAULT_UDP_BLKSIZE
+	}
+	if o.blockSize > 0 {
+		c.BlockSize = o.blockSize
+	}
+	if o.payload != "" {
+		c.Payload.Entropy = o.payload
+	}
+	if o.family != "" {
+		c.Family = o.family
+	}
+	if o.omit > 0 {
+		c.Omit = seconds(o.omit)
+	}
+	return c
+}
+
+// Read state byte from control connection
+func (c *Iperf3Client) readState() (int8, error) {
+	buf := make([]byte, 1)
+	_, err := io.ReadFull(c.controlConn, buf)
+	if err != nil {
+		return 0, err
+	}
+	return int8(buf[0]), nil
+}
+
+// Write state byte to control connection
+func (c *Iperf3Client) writeState(state int8) error {
+	_, err := c.controlConn.Write([]byte{byte(state)})
+	return err
+}
+
+// Read JSON message from control connection
+func (c *Iperf3Client) readJSON(v interface{}) error {
+	// Read 4-byte length (big endian)
+	lenBuf := make([]byte, 4)
+	_, err := io.ReadFull(c.controlConn, lenBuf)
+	if err != nil {
+		return fmt.Errorf("read length: %w", err)
+	}
+	length := binary.BigEndian.Uint32(lenBuf)
+
+	if length == 0 || length > 1024*1024 {
+		return fmt.Errorf("invalid JSON length: %d", length)
+	}
+
+	// Read JSON data
+	jsonBuf := make([]byte, length)
+	_, err = io.ReadFull(c.controlConn, jsonBuf)
+	if err != nil {
+		return fmt.Errorf("read JSON: %w", err)
+	}
+
+	return json.Unmarshal(jsonBuf, v)
+}
+
+// Write JSON message to control connection
+func (c *Iperf3Client) writeJSON(v interface{}) error {
+	jsonData, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	// Write 4-byte length (big endian)
+	lenBuf := make([]byte, 4)
+	binary.BigEndian.PutUint32(lenBuf, uint32(len(jsonData)))
+
+	_, err = c.controlConn.Write(lenBuf)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.controlConn.Write(jsonData)
+	return err
+}
+
+// Connect to iperf3 server
+func (c *Iperf3Client) Connect() error {
+	target := net.JoinHostPort(c.Host, fmt.Sprintf("%d", c.Port))
+
+	conn, dial, err := DialControlFrom(c.ctx, c.Host, c.Port, c.Family, 10*time.Second, c.Bind)
+	if err == nil {
+		err = c.keepConn(conn, false)
+	}
+	if err != nil {
+		return fmt.Errorf("connect to %s failed: %w", target, err)
+	}
+	c.Dial = dial
+
+	// Set TCP_NODELAY for control connection
+	if tcpConn, ok := conn.(*net.TCPConn); ok {
+		_ = tcpConn.SetNoDelay(true)
+	}
+
+	// Send cookie (37 bytes including null terminator)
+	_, err = c.controlConn.Write(c.cookie)
+	if err != nil {
+		_ = c.controlConn.Close()
+		return fmt.Errorf("send cookie failed: %w", err)
+	}
+
+	logf(c.ctx, "iperf3: Connected to %s via %s (%.1f ms), cookie sent (%d bytes)", target, dial.Address, dial.ConnectMs, len(c.cookie))
+	return nil
+}
+
+// Exchange parameters with server
+func (c *Iperf3Client) ExchangeParams() error {
+	// Wait for PARAM_EXCHANGE state
+	state, err := c.readState()
+	if err != nil {
+		return fmt.Errorf("read initial state: %w", err)
+	}
+
+	if state == ACCESS_DENIED {
+		return fmt.Errorf("server denied access")
+	}
+	if state == SERVER_ERROR {
+		return c.serverError()
+	}
+	if state != PARAM_EXCHANGE {
+		return fmt.Errorf("unexpected state %d, expected PARAM_EXCHANGE(%d)", state, PARAM_EXCHANGE)
+	}
+
+	// Send test parameters
+	params := Iperf3Params{
+		TCP:         c.Protocol == "TCP",
+		UDP:         c.Protocol == "UDP",
+		Omit:        c.Omit,
+		Congestion:  c.Congestion,
+		Window:      c.Window,
+		Time:        c.Duration,
+		Num:         c.NumBytes,
+		BlockCount:  c.BlockCount,
+		Parallel:    c.Parallel,
+		Len:         c.BlockSize,
+		PacingTimer: int(c.PacingTimer.Microseconds()),
+		ClientVer:   "3.16",
+	}
+	if c.Reverse {
+		params.Reverse = 1
+	}
+	if c.Auth != nil {
+		if params.AuthToken, err = c.Auth.token(time.Now()); err != nil {
+			return err
+		}
+	}
+
+	err = c.writeJSON(params)
+	if err != nil {
+		return fmt.Errorf("send params: %w", err)
+	}
+
+	logf(c.ctx, "iperf3: Parameters exchanged (duration=%ds, parallel=%d, blksize=%d, target_bytes=%d)",
+		c.Duration, c.Parallel, c.BlockSize, c.targetBytes())
+	return nil
+}
+
+// Create data streams
+func (c *Iperf3Client) CreateStreams() error {
+	// Wait for CREATE_STREAMS state
+	state, err := c.readState()
+	if err != nil {
+		return fmt.Errorf("read state: %w", err)
+	}
+	if state == SERVER_ERROR {
+		return c.serverError()
+	}
+	if state != CREATE_STREAMS {
+		return fmt.Errorf("unexpected state %d, expected CREATE_STREAMS(%d)", state, CREATE_STREAMS)
+	}
+
+	// Data streams follow the address the control connection settled on
+	target := c.controlConn.RemoteAddr().String()
+	ctx := WithDialedName(c.ctx, c.Host)
+
+	for i := 0; i < c.Parallel; i++ {
+		var conn net.Conn
+		err := c.Bind.InNamespace(func() error {
+			var err error
+			if c.Protocol == "UDP" {
+				conn, err = c.streamDialer("udp").DialContext(ctx, "udp", target)
+			} else {
+				conn, err = c.streamDialer("tcp").DialContext(ctx, "tcp", target)
+			}
+			return err
+		})
+		if err == nil {
+			err = c.keepConn(conn, true)
+		}
+		if err != nil {
+			return fmt.Errorf("create stream %d: %w", i, err)
+		}
+		if c.Protocol == "TCP" && c.Congestion != "" {
+			if err := setStreamCongestion(conn, c.Congestion); err != nil {
+				_ = conn.Close()
+				return fmt.Errorf("create stream %d: %w", i, congestionError(c.Congestion, err))
+			}
+		}
+		if i == 0 && c.Window > 0 {
+			c.socketBuffers = readSocketBuffers(conn, c.Window)
+		}
+
+		if c.Protocol == "UDP" && !c.Reverse {
+			if c.mtu == nil {
+				c.mtu = &mtuTracker{}
+			}
+			if err := SetDontFragment(conn); err != nil {
+				warnf(c.ctx, "iperf3: Warning - could not set DF on stream %d: %v", i, err)
+			}
+		}
+
+		if c.Protocol == "UDP" {
+			if err := udpConnect(conn, UDP_CONNECT_TIMEOUT); err != nil {
+				_ = conn.Close()
+				return fmt.Errorf("connect UDP stream %d: %w", i, err)
+			}
+			continue
+		}
+
+		// Send cookie to identify this stream
+		_, err = conn.Write(c.cookie)
+		if err != nil {
+			_ = conn.Close()
+			return fmt.Errorf("send cookie on stream %d: %w", i, err)
+		}
+	}
+
+	logf(c.ctx, "iperf3: Created %d data streams", len(c.streams))
+	return nil
+}
+
+// Announce a UDP stream and wait for the server to accept it. The server
+// connects its socket to the sender of the first datagram, so streams must be
+// announced one at a time. iperf3 writes the values in host byte order.
+func udpConnect(conn net.Conn, timeout time.Duration) error {
+	msg := make([]byte, 4)
+	binary.LittleEndian.PutUint32(msg, UDP_CONNECT_MSG)
+	if _, err := conn.Write(msg); err != nil {
+		return err
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(timeout))
+	defer func() { _ = conn.SetReadDeadline(time.Time{}) }()
+	reply := make([]byte, 64)
+	if _, err := conn.Read(reply); err != nil {
+		return fmt.Errorf("no reply from server: %w", err)
+	}
+	return nil
+}
+
+// Run the bandwidth test
+func (c *Iperf3Client) RunTest() (*Iperf3Result, error) {
+	c.phase("run")
+	// Wait for TEST_START
+	state, err := c.readState()
+	if err != nil {
+		return nil, fmt.Errorf("read state: %w", err)
+	}
+	if state != TEST_START {
+		return nil, fmt.Errorf("unexpected state %d, expected TEST_START(%d)", state, TEST_START)
+	}
+
+	// Wait for TEST_RUNNING
+	state, err = c.readState()
+	if err != nil {
+		return nil, fmt.Errorf("read state: %w", err)
+	}
+	if state != TEST_RUNNING {
+		return nil, fmt.Errorf("unexpected state %d, expected TEST_RUNNING(%d)", state, TEST_RUNNING)
+	}
+
+	logf(c.ctx, "iperf3: Test running for %d seconds (%d omitted)...", c.Duration+c.Omit, c.Omit)
+
+	result := &Iperf3Result{
+		Server:        c.Host,
+		Port:          c.Port,
+		Protocol:      c.Protocol,
+		Dial:          c.Dial,
+		SocketBuffers: c.socketBuffers,
+	}
+
+	start := time.Now()
+	deadline := start.Add(time.Duration(c.Duration+c.Omit) * time.Second)
+	result.StartedAt = start
+
+	c.streamTransferred = make([]int64, len(c.streams))
+	var endOmit func() *omitSnapshot
+	if c.Omit > 0 {
+		endOmit = c.startOmit(start)
+	}
+	if c.TCPInfo && c.Protocol == "TCP" && !c.Reverse && TCPInfoSupported {
+		c.tcpInfo = newTCPInfoReport(len(c.streams))
+	}
+	stopSampling := make(chan struct{})
+	sampled := make(chan struct{})
+	go func() {
+		result.Intervals = c.sampleIntervals(start, time.Second, stopSampling)
+		close(sampled)
+	}()
+
+	if c.Reverse {
+		// Receive mode: read data from streams
+		result.ReceivedBytes = c.receiveData(deadline)
+	} else {
+		// Send mode: write data to streams
+		result.SentBytes = c.sendData(deadline)
+		if c.Protocol == "UDP" {
+			result.PacketsSent = sumCounts(c.streamPackets)
+		}
+		result.ZeroCopy = len(c.streams) > 0 && c.zeroCopyStreams == int64(len(c.streams))
+	}
+
+	result.Duration = time.Since(start).Seconds()
+	var omitted *omitSnapshot
+	if endOmit != nil {
+		omitted = endOmit()
+		c.applyOmit(result, omitted, result.Duration)
+	}
+	if target := c.targetBytes(); target > 0 {
+		result.TargetBytes = target
+		result.TargetReached = atomic.LoadInt64(&c.transferred) >= target
+	}
+	close(stopSampling)
+	<-sampled
+	result.Series, result.RetransmitSeries = intervalSeries(result.Intervals)
+
+	if c.Protocol == "TCP" && !c.Reverse {
+		c.streamRetransmits = c.readRetransmits()
+		if c.streamRetransmits != nil && omitted != nil && omitted.retransmits != nil {
+			for i := range c.streamRetransmits {
+				c.streamRetransmits[i] -= omitted.retransmits[i]
+			}
+		}
+		if c.streamRetransmits != nil {
+			setRetransmits(result, c.streamRetransmits)
+		}
+	}
+	if c.ECN && c.Protocol == "TCP" {
+		result.ECN = c.streamsECN()
+	}
+	if c.Protocol == "TCP" && TCPInfoSupported && len(c.streams) > 0 {
+		c.congestionUsed, _ = streamCongestion(c.streams[0])
+		c.streamRTTs = c.readRTTs()
+		c.sampleTCPInfo(time.Since(start).Seconds(), true)
+		result.TCPInfo = c.tcpInfo
+	}
+
+	// Calculate bandwidth
+	totalBytes := result.SentBytes
+	if c.Reverse {
+		totalBytes = result.ReceivedBytes
+	}
+	if result.Duration > 0 {
+		result.BandwidthMbps = (float64(totalBytes) * 8) / (result.Duration * 1e6)
+	}
+	if !c.Reverse && c.Bandwidth > 0 {
+		result.Pacing = pacingReport(c.Bandwidth, c.PacingTimer, result.BandwidthMbps, result.Intervals)
+	}
+
+	// Signal TEST_END
+	_ = c.writeState(TEST_END)
+	c.phase("exchange_results")
+
+	// Wait for EXCHANGE_RESULTS
+	state, err = c.readState()
+	if err != nil {
+		warnf(c.ctx, "iperf3: Warning - could not read EXCHANGE_RESULTS state: %v", err)
+	}
+
+	// Exchange results: report our streams, then read the server's view
+	serverCongestion := ""
+	if state == EXCHANGE_RESULTS {
+		_ = c.writeJSON(c.clientResults(result.Duration))
+
+		var serverResults Iperf3Results
+		if err := c.readJSON(&serverResults); err != nil {
+			warnf(c.ctx, "iperf3: Warning - could not read server results: %v", err)
+		} else {
+			result.ServerResults = serverReport(&serverResults, c.Protocol, c.Reverse, result.Duration)
+			serverCongestion = serverResults.CongestionUsed
+			if c.Protocol == "UDP" && !c.Reverse {
+				applyServerUDPResults(result, &serverResults)
+			} else if c.Protocol == "TCP" && c.Reverse {
+				applyServerRetransmits(result, &serverResults)
+			}
+		}
+	}
+	if c.Protocol == "UDP" && c.Reverse {
+		applyClientUDPResults(result, c.streamUDP)
+	}
+	c.setCongestionUsed(result, serverCongestion)
+	result.Streams = buildStreams(c.streamLocals(), c.streamBytes, result.StreamRetransmits, c.streamRTTs, result.Duration)
+	if c.mtu != nil && len(c.streams) > 0 {
+		result.MTU = c.mtu.report(c.streams[0], c.controlConn, c.BlockSize, result.LossPercent)
+	}
+
+	// Wait for DISPLAY_RESULTS
+	state, _ = c.readState()
+	if state == DISPLAY_RESULTS {
+		_ = c.writeState(IPERF_DONE)
+	}
+
+	logf(c.ctx, "iperf3: Test completed - %.2f Mbps", result.BandwidthMbps)
+	return result, nil
+}
+
+// Read the ECN state of all streams while they are still open
+func (c *Iperf3Client) streamsECN() *TCPECNReport {
+	streams := make([]tcpStreamECN, 0, len(c.streams))
+	for i, stream := range c.streams {
+		s, err := streamECN(stream)
+		if err != nil {
+			warnf(c.ctx, "iperf3: Warning - could not read ECN state of stream %d: %v", i, err)
+			continue
+		}
+		streams = append(streams, s)
+	}
+	return summarizeTCPECN(streams, c.Reverse)
+}
+
+// Read the retransmits of all streams from TCP_INFO, or nil when any is unavailable
+func (c *Iperf3Client) readRetransmits() []int {
+	if !TCPInfoSupported {
+		return nil
+	}
+	retransmits := make([]int, len(c.streams))
+	for i, stream := range c.streams {
+		n, err := streamRetransmits(stream)
+		if err != nil {
+			warnf(c.ctx, "iperf3: Warning - could not read TCP_INFO of stream %d: %v", i, err)
+			return nil
+		}
+		retransmits[i] = n
+	}
+	return retransmits
+}
+
+// A TCP stream's RTT as TCP_INFO reports it
+type tcpStreamRTT struct {
+	rtt    time.Duration
+	rttvar time.Duration
+}
+
+// Read the RTT of all streams from TCP_INFO, or nil when any is unavailable
+func (c *Iperf3Client) readRTTs() []tcpStreamRTT {
+	rtts := make([]tcpStreamRTT, len(c.streams))
+	for i, stream := range c.streams {
+		rtt, err := streamRTT(stream, c.Reverse)
+		if err != nil {
+			warnf(c.ctx, "iperf3: Warning - could not read TCP_INFO of stream %d: %v", i, err)
+			return nil
+		}
+		rtts[i] = rtt
+	}
+	return rtts
+}
+
+func newTCPInfoReport(streams int) *TCPInfoReport {
+	report := &TCPInfoReport{Streams: make([]TCPInfoStream, streams)}
+	for i := range report.Streams {
+		report.Streams[i] = TCPInfoStream{ID: streamID(i), Samples: []TCPInfoSnapshot{}}
+	}
+	return report
+}
+
+// Read TCP_INFO of all streams at t seconds into the transfer, as a sample
+// or as the final snapshot. A stream that cannot be read drops the report,
+// as it drops the retransmits.
+func (c *Iperf3Client) sampleTCPInfo(t float64, final bool) {
+	if c.tcpInfo == nil {
+		return
+	}
+	snapshots := make([]TCPInfoSnapshot, len(c.streams))
+	for i, stream := range c.streams {
+		s, err := streamTCPInfo(stream)
+		if err != nil {
+			warnf(c.ctx, "iperf3: Warning - could not read TCP_INFO of stream %d: %v", i, err)
+			c.tcpInfo = nil
+			return
+		}
+		s.T = t
+		snapshots[i] = s
+	}
+	for i := range snapshots {
+		if final {
+			c.tcpInfo.Streams[i].Final = &snapshots[i]
+		} else {
+			c.tcpInfo.Streams[i].Samples = append(c.tcpInfo.Streams[i].Samples, snapshots[i])
+		}
+	}
+}
+
+// Local addresses of all streams
+func (c *Iperf3Client) streamLocals() []string {
+	locals := make([]string, len(c.streams))
+	for i, stream := range c.streams {
+		locals[i] = stream.LocalAddr().String()
+	}
+	return locals
+}
+
+// Build the per-stream totals from each stream's bytes, and retransmits and
+// RTT when known, over the test's duration
+func buildStreams(locals []string, bytes []int64, retransmits []int, rtts []tcpStreamRTT, duration float64) []Iperf3Stream {
+	streams := make([]Iperf3Stream, len(bytes))
+	for i, n := range bytes {
+		s := Iperf3Stream{ID: streamID(i), Bytes: n}
+		if i < len(locals) {
+			s.Local = locals[i]
+		}
+		if duration > 0 {
+			s.BandwidthMbps = float64(n) * 8 / (duration * 1e6)
+		}
+		if i < len(retransmits) {
+			s.Retransmits = &retransmits[i]
+		}
+		if i < len(rtts) && rtts[i].rtt > 0 {
+			rtt := float64(rtts[i].rtt.Microseconds()) / 1000
+			s.RTTMs = &rtt
+			if rtts[i].rttvar > 0 {
+				rttvar := float64(rtts[i].rttvar.Microseconds()) / 1000
+				s.RTTVarMs = &rttvar
+			}
+		}
+		streams[i] = s
+	}
+	return streams
+}
+
+// Record per-stream retransmits and their total in the result
+func setRetransmits(result *Iperf3Result, streams []int) {
+	result.HasRetransmits = true
+	result.StreamRetransmits = streams
+	result.Retransmits = 0
+	for _, n := range streams {
+		result.Retransmits += n
+	}
+}
+
+// Send data on all streams
+func (c *Iperf3Client) sendData(deadline time.Time) int64 {
+	var totalBytes int64
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+
+	// Every write is a block, as iperf3 writes them
+	udp := c.Protocol == "UDP" && c.BlockSize >= UDP_HEADER_SIZE
+	target := c.targetBytes()
+	c.streamBytes = make([]int64, len(c.streams))
+	c.streamPackets = make([]int64, len(c.streams))
+
+	for i, stream := range c.streams {
+		wg.Add(1)
+		go func(i int, conn net.Conn) {
+			defer wg.Done()
+
+			// Each stream writes its own uniquely filled buffer, from a
+			// pool so back-to-back tests do not allocate them again
+			buffer := c.Payload.StreamBuffer(c.BlockSize)
+			defer ReleaseBuffer(buffer)
+			var zeroCopy *zeroCopySender
+			if c.ZeroCopy && !udp {
+				var err error
+				if zeroCopy, err = newZeroCopySender(conn, buffer); err != nil {
+					logf(c.ctx, "iperf3: Stream %d sends without zero-copy: %v", i, err)
+				} else {
+					defer zeroCopy.Close()
+					atomic.AddInt64(&c.zeroCopyStreams, 1)
+				}
+			}
+
+			var streamBytes, packets int64
+			pacer := NewPacer(c.Bandwidth/int64(c.Parallel), c.PacingTimer)
+			timer := time.NewTimer(0)
+			timer.Stop()
+			_ = conn.SetWriteDeadline(deadline)
+
+			for time.Now().Before(deadline) && (target == 0 || atomic.LoadInt64(&c.transferred) < target) {
+				// Wait for the packet's tokens, unless that takes past the deadline
+				if wait := pacer.Reserve(len(buffer), time.Now()); wait > 0 {
+					if time.Now().Add(wait).After(deadline) || !c.sleep(timer, wait) {
+						break
+					}
+				}
+				if udp {
+					// iperf3 datagram header, used by the server for loss and jitter
+					now := time.Now()
+					binary.BigEndian.PutUint32(buffer[0:], uint32(now.Unix()))
+					binary.BigEndian.PutUint32(buffer[4:], uint32(now.Nanosecond()/1000))
+					binary.BigEndian.PutUint32(buffer[8:], uint32(packets+1))
+				}
+				var n int
+				var err error
+				if zeroCopy != nil {
+					n, err = zeroCopy.Send()
+				} else {
+					n, err = conn.Write(buffer)
+				}
+				if err != nil {
+					// Clamp to the path MTU learned from ICMP feedback and carry on
+					if udp && c.mtu != nil && IsMessageTooBig(err) {
+						if size := c.mtu.clamp(conn, len(buffer)); size > 0 {
+							buffer = buffer[:size]
+							continue
+						}
+					}
+					break
+				}
+				packets++
+				streamBytes += int64(n)
+				atomic.AddInt64(&c.streamTransferred[i], int64(n))
+				atomic.AddInt64(&c.transferred, int64(n))
+			}
+
+			c.streamBytes[i] = streamBytes
+			c.streamPackets[i] = packets
+
+			mu.Lock()
+			totalBytes += streamBytes
+			mu.Unlock()
+		}(i, stream)
+	}
+
+	wg.Wait()
+	return totalBytes
+}
+
+// Wait d for pacing on a stream's stopped timer, or until the test is
+// canceled, reporting whether the time passed
+func (c *Iperf3Client) sleep(timer *time.Timer, d time.Duration) bool {
+	timer.Reset(d)
+	var canceled <-chan struct{}
+	if c.ctx != nil {
+		canceled = c.ctx.Done()
+	}
+	select {
+	case <-timer.C:
+		return true
+	case <-canceled:
+		timer.Stop()
+		return false
+	}
+}
+
+// Unblock the reads of all streams once a transfer-limited download has its bytes
+func (c *Iperf3Client) stopReceiving() {
+	c.endStreams.Do(func() {
+		for _, stream := range c.streams {
+			_ = stream.SetReadDeadline(time.Now())
+		}
+	})
+}
+
+// Loss and jitter of the datagrams a stream received, counted the way an
+// iperf3 receiver does from the sequence number and send time in each header
+type udpReceiveStats struct {
+	packets     int64   // Highest sequence number seen
+	lost        int64   // Sequence numbers skipped, less late arrivals
+	outOfOrder  int64   // Datagrams older than the highest seen
+	jitter      float64 // RFC 3550 interarrival jitter in seconds
+	lastTransit float64
+}
+
+func (s *udpReceiveStats) add(seq uint32, sent, arrived time.Time) {
+	transit := arrived.Sub(sent).Seconds()
+	if s.packets > 0 {
+		d := math.Abs(transit - s.lastTransit)
+		s.jitter += (d - s.jitter) / 16
+	}
+	s.lastTransit = transit
+
+	switch n := int64(seq); {
+	case n > s.packets:
+		s.lost += n - s.packets - 1
+		s.packets = n
+	default:
+		// A late datagram was counted lost when a later one arrived
+		s.outOfOrder++
+		if s.lost > 0 {
+			s.lost--
+		}
+	}
+}
+
+// Receive data from all streams
+func (c *Iperf3Client) receiveData(deadline time.Time) int64 {
+	var totalBytes int64
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+
+	udp := c.Protocol == "UDP"
+	target := c.targetBytes()
+	c.streamBytes = make([]int64, len(c.streams))
+	c.streamPackets = make([]int64, len(c.streams))
+	if udp {
+		c.streamUDP = make([]udpReceiveStats, len(c.streams))
+	}
+
+	for i, stream := range c.streams {
+		wg.Add(1)
+		go func(i int, conn net.Conn) {
+			defer wg.Done()
+
+			// Concurrent reads need a buffer per stream
+			buffer := AcquireBuffer(c.BlockSize)
+			defer ReleaseBuffer(buffer)
+
+			var streamBytes int64
+			var stats udpReceiveStats
+			_ = conn.SetReadDeadline(deadline)
+
+			for time.Now().Before(deadline) {
+				n, err := conn.Read(buffer)
+				if err != nil {
+					break
+				}
+				if udp && n >= UDP_HEADER_SIZE {
+					sent := time.Unix(int64(binary.BigEndian.Uint32(buffer[0:])), int64(binary.BigEndian.Uint32(buffer[4:]))*1000)
+					stats.add(binary.BigEndian.Uint32(buffer[8:]), sent, time.Now())
+				}
+				streamBytes += int64(n)
+				atomic.AddInt64(&c.streamTransferred[i], int64(n))
+				c.streamPackets[i]++
+				if moved := atomic.AddInt64(&c.transferred, int64(n)); target > 0 && moved >= target {
+					c.stopReceiving()
+				}
+			}
+			c.streamBytes[i] = streamBytes
+			if udp {
+				c.streamUDP[i] = stats
+			}
+
+			mu.Lock()
+			totalBytes += streamBytes
+			mu.Unlock()
+		}(i, stream)
+	}
+
+	wg.Wait()
+	return totalBytes
+}
+
+// Sample every stream's bytes, and on forward TCP tests its retransmits from
+// TCP_INFO, every interval until stop is closed, as iperf3 reports intervals.
+// The final, usually shorter, interval is included when it contains data.
+func (c *Iperf3Client) sampleIntervals(start time.Time, interval time.Duration, stop <-chan struct{}) []Iperf3Interval {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	intervals := []Iperf3Interval{}
+	lastBytes := make([]int64, len(c.streamTransferred))
+	var lastRetransmits []int
+	lastTime := start
+	sampleRetransmits := c.Protocol == "TCP" && !c.Reverse && TCPInfoSupported
+	if sampleRetransmits {
+		lastRetransmits = make([]int, len(c.streams))
+	}
+
+	sample := func(now time.Time) {
+		bytes := make([]int64, len(lastBytes))
+		for i := range bytes {
+			total := atomic.LoadInt64(&c.streamTransferred[i])
+			bytes[i], lastBytes[i] = total-lastBytes[i], total
+		}
+		var retransmits []int
+		if sampleRetransmits {
+			if streams := c.readRetransmits(); streams != nil {
+				retransmits = make([]int, len(streams))
+				for i, n := range streams {
+					retransmits[i], lastRetransmits[i] = n-lastRetransmits[i], n
+				}
+			} else {
+				sampleRetransmits = false
+			}
+		}
+		if now.After(lastTime) {
+			c.sampleTCPInfo(now.Sub(start).Seconds(), false)
+			interval := buildInterval(lastTime.Sub(start).Seconds(), now.Sub(start).Seconds(), bytes, retransmits)
+			interval.Omitted = intervalOmitted(interval.Start, c.Omit)
+			intervals = append(intervals, interval)
+			if !interval.Omitted {
+				if c.OnInterval != nil {
+					c.OnInterval(interval)
+				}
+			}
+		}
+		lastTime = now
+	}
+
+	for {
+		select {
+		case now := <-ticker.C:
+			sample(now)
+		case <-stop:
+			if c.bytesTransferred() > sumCounts(lastBytes) {
+				sample(time.Now())
+			}
+			return intervals
+		}
+	}
+}
+
+// Bytes moved on all streams so far
+func (c *Iperf3Client) bytesTransferred() int64 {
+	var total int64
+	for i := range c.streamTransferred {
+		total += atomic.LoadInt64(&c.streamTransferred[i])
+	}
+	return total
+}
+
+func sumCounts(counts []int64) int64 {
+	var total int64
+	for _, n := range counts {
+		total += n
+	}
+	return total
+}
+
+// Build an interval from the bytes, and retransmits when known, each stream
+// moved in it. Streams are listed only when there is more than one.
+func buildInterval(start, end float64, bytes []int64, retransmits []int) Iperf3Interval {
+	elapsed := end - start
+	interval := Iperf3Interval{Start: start, End: end, Bytes: sumCounts(bytes)}
+	interval.BandwidthMbps = float64(interval.Bytes) * 8 / (elapsed * 1e6)
+	if retransmits != nil {
+		sum := 0
+		for _, n := range retransmits {
+			sum += n
+		}
+		interval.Retransmits = &sum
+	}
+	if len(bytes) > 1 {
+		interval.Streams = make([]Iperf3IntervalStream, len(bytes))
+		for i, n := range bytes {
+			interval.Streams[i] = Iperf3IntervalStream{Bytes: n, BandwidthMbps: float64(n) * 8 / (elapsed * 1e6)}
+			if i < len(retransmits) {
+				interval.Streams[i].Retransmits = &retransmits[i]
+			}
+		}
+	}
+	return interval
+}
+
+// intervalOmitted tells whether the interval starting at start falls within
+// the omit period. Ticks and the omit timer fire microseconds apart, so it
+// goes by the start.
+func intervalOmitted(start float64, omit int) bool {
+	return start < float64(omit)-0.5
+}
+
+// Throughput and, when sampled, retransmit series of the intervals after the omit period
+func intervalSeries(intervals []Iperf3Interval) ([]SeriesPoint, []SeriesPoint) {
+	var throughput, retransmits []SeriesPoint
+	for _, interval := range intervals {
+		if interval.Omitted {
+			continue
+		}
+		throughput = append(throughput, SeriesPoint{T: interval.Start, Value: interval.BandwidthMbps})
+		if interval.Retransmits != nil {
+			retransmits = append(retransmits, SeriesPoint{T: interval.Start, Value: float64(*interval.Retransmits)})
+		}
+	}
+	return throughput, retransmits
+}
+
+// ID of the i-th stream: iperf3 numbers streams 1, 3, 4, ...
+func streamID(i int) int {
+	if i == 0 {
+		return 1
+	}
+	return i + 2
+}
+
+// Build the results message for EXCHANGE_RESULTS.
+// iperf3 matches results to streams by ID.
+// Like iperf3, a receiving client reports sender_has_retransmits -1.
+func (c *Iperf3Client) clientResults(duration float64) Iperf3Results {
+	results := Iperf3Results{
+		Streams:              make([]Iperf3StreamResults, len(c.streams)),
+		SenderHasRetransmits: senderHasRetransmits(c.Reverse, c.streamRetransmits),
+		CongestionUsed:       c.congestionUsed,
+	}
+	for i := range c.streams {
+		results.Streams[i] = Iperf3StreamResults{ID: streamID(i), EndTime: duration}
+		if i < len(c.streamBytes) {
+			results.Streams[i].Bytes = c.streamBytes[i]
+			results.Streams[i].Packets = c.streamPackets[i]
+		}
+		if i < len(c.streamRetransmits) {
+			results.Streams[i].Retransmits = c.streamRetransmits[i]
+		}
+		if i < len(c.streamUDP) {
+			// As a receiver, report datagrams by the highest sequence seen
+			results.Streams[i].Packets = c.streamUDP[i].packets
+			results.Streams[i].Errors = c.streamUDP[i].lost
+			results.Streams[i].Jitter = c.streamUDP[i].jitter
+		}
+	}
+	return results
+}
+
+// sender_has_retransmits of the client's results: -1 as a receiver, 1 with
+// TCP_INFO retransmits, 0 without
+func senderHasRetransmits(reverse bool, streamRetransmits []int) int {
+	switch {
+	case reverse:
+		return -1
+	case streamRetransmits != nil:
+		return 1
+	}
+	return 0
+}
+
+// Copy the client's own receiver-side UDP loss and jitter into the result (UDP downloads)
+func applyClientUDPResults(result *Iperf3Result, streams []udpReceiveStats) {
+	if len(streams) == 0 {
+		return
+	}
+	var jitter float64
+	for _, s := range streams {
+		result.Packets += s.packets
+		result.LostPackets += s.lost
+		result.OutOfOrder += s.outOfOrder
+		jitter += s.jitter
+	}
+	if result.Packets > 0 {
+		result.LossPercent = float64(result.LostPackets) * 100 / float64(result.Packets)
+	}
+	result.JitterMs = jitter / float64(len(streams)) * 1000
+	result.ReceiverReport = true
+}
+
+// Copy the server's receiver-side UDP loss and jitter into the result
+func applyServerUDPResults(result *Iperf3Result, server *Iperf3Results) {
+	if len(server.Streams) == 0 {
+		return
+	}
+	var jitter float64
+	for _, s := range server.Streams {
+		result.Packets += s.Packets
+		result.LostPackets += s.Errors
+		jitter += s.Jitter
+	}
+	if result.Packets > 0 {
+		result.LossPercent = float64(result.LostPackets) * 100 / float64(result.Packets)
+	}
+	result.JitterMs = jitter / float64(len(server.Streams)) * 1000
+	result.ReceiverReport = true
+}
+
+// Summarize the server's results message. Streams are timed by their own
+// start and end times, falling back to the client's duration when unset.
+func serverReport(server *Iperf3Results, protocol string, reverse bool, duration float64) *Iperf3ServerReport {
+	report := &Iperf3ServerReport{
+		Role:           "receiver",
+		CPUUtilPercent: server.CPUUtilTotal,
+		Streams:        make([]Iperf3ServerStream, len(server.Streams)),
+	}
+	if reverse {
+		report.Role = "sender"
+	}
+	udpReceiver := protocol == "UDP" && !reverse
+	hasRetransmits := protocol == "TCP" && reverse && server.SenderHasRetransmits == 1
+
+	var span, jitter float64
+	var retransmits int
+	var lost int64
+	for i, s := range server.Streams {
+		elapsed := s.EndTime - s.StartTime
+		if elapsed <= 0 {
+			elapsed = duration
+		}
+		span = math.Max(span, elapsed)
+		stream := Iperf3ServerStream{ID: s.ID, Bytes: s.Bytes}
+		if elapsed > 0 {
+			stream.BandwidthMbps = float64(s.Bytes) * 8 / (elapsed * 1e6)
+		}
+		if hasRetransmits {
+			stream.Retransmits = &server.Streams[i].Retransmits
+			retransmits += s.Retransmits
+		}
+		if protocol == "UDP" {
+			stream.Packets = s.Packets
+		}
+		if udpReceiver {
+			stream.LostPackets = &server.Streams[i].Errors
+			streamJitter := s.Jitter * 1000
+			stream.JitterMs = &streamJitter
+			lost += s.Errors
+			jitter += streamJitter
+		}
+		report.Bytes += s.Bytes
+		report.Packets += stream.Packets
+		report.Streams[i] = stream
+	}
+	if span > 0 {
+		report.BandwidthMbps = float64(report.Bytes) * 8 / (span * 1e6)
+	}
+	if hasRetransmits {
+		report.Retransmits = &retransmits
+	}
+	if udpReceiver && len(server.Streams) > 0 {
+		lossPercent := 0.0
+		if report.Packets > 0 {
+			lossPercent = float64(lost) * 100 / float64(report.Packets)
+		}
+		jitter /= float64(len(server.Streams))
+		report.LostPackets, report.LossPercent, report.JitterMs = &lost, &lossPercent, &jitter
+	}
+	return report
+}
+
+// Copy the retransmits of the server's sending streams into the result (TCP downloads)
+func applyServerRetransmits(result *Iperf3Result, server *Iperf3Results) {
+	if server.SenderHasRetransmits != 1 {
+		return
+	}
+	retransmits := make([]int, len(server.Streams))
+	for i, s := range server.Streams {
+		retransmits[i] = s.Retransmits
+	}
+	setRetransmits(result, retransmits)
+}
+
+// Run runs the test until it completes or ctx ends it; a canceled test closes
+// its connections at once and returns an ERR_CANCELED error
+func (c *Iperf3Client) Run(ctx context.Context) (*Iperf3Result, error) {
+	c.ctx = ctx
+	stop := context.AfterFunc(ctx, c.abort)
+	defer stop()
+
+	result, err := c.run()
+	if ctx.Err() != nil {
+		logf(ctx, "iperf3: Test canceled: %v", context.Cause(ctx))
+		return nil, canceledError(ctx)
+	}
+	return result, err
+}
+
+// phase reports the step the test enters to OnPhase
+func (c *Iperf3Client) phase(name string) {
+	if c.OnPhase != nil {
+		c.OnPhase(name)
+	}
+}
+
+func (c *Iperf3Client) run() (*Iperf3Result, error) {
+	c.phase("connect")
+	if err := c.Connect(); err != nil {
+		return nil, err
+	}
+
+	c.phase("param_exchange")
+	if err := c.ExchangeParams(); err != nil {
+		return nil, err
+	}
+
+	c.phase("create_streams")
+	if err := c.CreateStreams(); err != nil {
+		return nil, err
+	}
+
+	return c.RunTest()
+}
+
+// abort closes the control connection and every stream of a test, now and
+// as they are opened, which unblocks whichever step the test is in
+func (c *Iperf3Client) abort() {
+	c.connMu.Lock()
+	defer c.connMu.Unlock()
+	c.aborted = true
+	if c.controlConn != nil {
+		_ = c.controlConn.Close()
+	}
+	for _, stream := range c.streams {
+		_ = stream.Close()
+	}
+}
+
+// keepConn records a new connection so abort closes it, or closes it at once
+// when the test was aborted meanwhile
+func (c *Iperf3Client) keepConn(conn net.Conn, stream bool) error {
+	c.connMu.Lock()
+	defer c.connMu.Unlock()
+	if c.aborted {
+		_ = conn.Close()
+		return context.Canceled
+	}
+	if stream {
+		c.streams = append(c.streams, conn)
+	} else {
+		c.controlConn = conn
+	}
+	return nil
+}
+
+// RunTest runs one iperf3 test against host:port with opts and closes its
+// connections
+func RunTest(ctx context.Context, host string, port int, opts ...Option) (*Iperf3Result, error) {
+	client := NewIperf3Client(host, append([]Option{WithPort(port)}, opts...)...)
+	defer client.Close()
+	return client.Run(ctx)
+}
+
+// Close all connections
+func (c *Iperf3Client) Close() {
+	for _, stream := range c.streams {
+		_ = stream.Close()
+	}
+	if c.controlConn != nil {
+		_ = c.controlConn.Close()
+	}
+}
@@ -0,0 +1,100 @@
+package nettest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"time"
+)
+
+// iperf3 authentication (--username, --rsa-public-key-path)
+const (
+	IPERF3_IEAUTHTEST = 142 // iperf3 i_errno: test authorization failed
+
+	ERR_AUTH_FAILED = "ERR_AUTH_FAILED"
+)
+
+// Iperf3Auth is the login sent in the test parameters of an authenticated test
+type Iperf3Auth struct {
+	Username string
+	password string
+	key      *rsa.PublicKey
+	pkcs1    bool
+}
+
+// NewIperf3Auth reads the server's PEM public key, with which the login is
+// encrypted; pkcs1 matches a server run with --use-pkcs1-padding
+func NewIperf3Auth(username, password, publicKey string, pkcs1 bool) (*Iperf3Auth, error) {
+	key, err := parseRSAPublicKey(publicKey)
+	if err != nil {
+		return nil, err
+	}
+	return &Iperf3Auth{Username: username, password: password, key: key, pkcs1: pkcs1}, nil
+}
+
+// parseRSAPublicKey reads a PEM public key, as iperf3 -m or openssl rsa -pubout write it
+func parseRSAPublicKey(data string) (*rsa.PublicKey, error) {
+	block, _ := pem.Decode([]byte(data))
+	if block == nil {
+		return nil, fmt.Errorf("public key is not PEM encoded")
+	}
+	if block.Type == "RSA PUBLIC KEY" {
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	}
+	parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parse public key: %v", err)
+	}
+	key, ok := parsed.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("public key is not an RSA key")
+	}
+	return key, nil
+}
+
+// token encrypts the login for PARAM_EXCHANGE as iperf3's encode_auth_setting
+// does. The server rejects tokens whose timestamp is more than its skew
+// threshold (10 s by default) away from its own clock.
+func (a *Iperf3Auth) token(now time.Time) (string, error) {
+	text := fmt.Sprintf("user: %s\npwd:  %s\nts:   %d", a.Username, a.password, now.Unix())
+	var encrypted []byte
+	var err error
+	if a.pkcs1 {
+		encrypted, err = rsa.EncryptPKCS1v15(rand.Reader, a.key, []byte(text))
+	} else {
+		encrypted, err = rsa.EncryptOAEP(sha1.New(), rand.Reader, a.key, []byte(text), nil)
+	}
+	if err != nil {
+		return "", fmt.Errorf("encrypt credentials: %w", err)
+	}
+	return base64.StdEncoding.EncodeToString(encrypted), nil
+}
+
+// serverError reads the error a server sends after SERVER_ERROR: its i_errno
+// and, for most errors, the errno behind it
+func (c *Iperf3Client) serverError() error {
+	buf := make([]byte, 8)
+	if _, err := io.ReadFull(c.controlConn, buf[:4]); err != nil {
+		return fmt.Errorf("server error")
+	}
+	ierrno := int32(binary.BigEndian.Uint32(buf[:4]))
+	if ierrno == IPERF3_IEAUTHTEST {
+		if c.Auth == nil {
+			return &Error{ERR_AUTH_FAILED, fmt.Errorf("server requires authentication (set credentials)")}
+		}
+		return &Error{ERR_AUTH_FAILED, fmt.Errorf("server rejected the credentials of user %q", c.Auth.Username)}
+	}
+	_ = c.controlConn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := io.ReadFull(c.controlConn, buf[4:]); err == nil {
+		if errno := binary.BigEndian.Uint32(buf[4:]); errno != 0 {
+			return fmt.Errorf("server error (iperf3 error %d, errno %d)", ierrno, errno)
+		}
+	}
+	return fmt.Errorf("server error (iperf3 error %d)", ierrno)
+}
@@ -0,0 +1,61 @@
+package nettest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"testing"
+	"time"
+)
+
+func TestParseRSAPublicKey(t *testing.T) {
+	priv, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkix, _ := x509.MarshalPKIXPublicKey(&priv.PublicKey)
+	for _, block := range []*pem.Block{
+		{Type: "PUBLIC KEY", Bytes: pkix},
+		{Type: "RSA PUBLIC KEY", Bytes: x509.MarshalPKCS1PublicKey(&priv.PublicKey)},
+	} {
+		key, err := parseRSAPublicKey(string(pem.EncodeToMemory(block)))
+		if err != nil || !key.Equal(&priv.PublicKey) {
+			t.Errorf("%s: expected the public key, got %v", block.Type, err)
+		}
+	}
+	if _, err := parseRSAPublicKey("not a key"); err == nil {
+		t.Error("Expected an error for a value that is not PEM")
+	}
+}
+
+func TestIperf3AuthTokenDecrypts(t *testing.T) {
+	priv, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1770000000, 0)
+	want := "user: mario\npwd:  rossi\nts:   1770000000"
+	for _, pkcs1 := range []bool{false, true} {
+		auth := &Iperf3Auth{Username: "mario", password: "rossi", key: &priv.PublicKey, pkcs1: pkcs1}
+		token, err := auth.token(now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		encrypted, err := base64.StdEncoding.DecodeString(token)
+		if err != nil {
+			t.Fatalf("Expected standard base64, got %v", err)
+		}
+		var plain []byte
+		if pkcs1 {
+			plain, err = rsa.DecryptPKCS1v15(nil, priv, encrypted)
+		} else {
+			plain, err = rsa.DecryptOAEP(sha1.New(), nil, priv, encrypted, nil)
+		}
+		if err != nil || string(plain) != want {
+			t.Errorf("pkcs1 %v: expected %q, got %q (%v)", pkcs1, want, plain, err)
+		}
+	}
+}
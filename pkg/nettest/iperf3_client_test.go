@@ -0,0 +1,98 @@
+package nettest
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGenerateCookie_Size(t *testing.T) {
+	cookie := generateCookie()
+
+	if len(cookie) != COOKIE_SIZE {
+		t.Errorf("Expected cookie size %d, got %d", COOKIE_SIZE, len(cookie))
+	}
+}
+
+func TestGenerateCookie_NullTerminated(t *testing.T) {
+	cookie := generateCookie()
+
+	if cookie[COOKIE_SIZE-1] != 0 {
+		t.Errorf("Expected null terminator at end, got %d", cookie[COOKIE_SIZE-1])
+	}
+}
+
+func TestGenerateCookie_Base32Chars(t *testing.T) {
+	cookie := generateCookie()
+	validChars := "abcdefghijklmnopqrstuvwxyz234567"
+
+	for i := 0; i < COOKIE_SIZE-1; i++ {
+		if !strings.ContainsRune(validChars, rune(cookie[i])) {
+			t.Errorf("Invalid character at position %d: %c", i, cookie[i])
+		}
+	}
+}
+
+func TestNewIperf3Client_ProtocolCaseInsensitive(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected string
+	}{
+		{"tcp", "TCP"},
+		{"TCP", "TCP"},
+		{"Tcp", "TCP"},
+		{"udp", "UDP"},
+		{"UDP", "UDP"},
+		{"Udp", "UDP"},
+	}
+
+	for _, tc := range testCases {
+		c := NewIperf3Client("test.host", WithProtocol(tc.input))
+		if c.Protocol != tc.expected {
+			t.Errorf("Input %s: expected protocol=%s, got %s", tc.input, tc.expected, c.Protocol)
+		}
+	}
+}
+
+func TestNewIperf3Client_ParallelValidation(t *testing.T) {
+	testCases := []struct {
+		input    int
+		expected int
+	}{
+		{0, 1},  // 0 should become 1
+		{-1, 1}, // negative should become 1
+		{1, 1},
+		{4, 4},
+		{8, 8},
+	}
+
+	for _, tc := range testCases {
+		c := NewIperf3Client("test.host", WithParallel(tc.input))
+		if c.Parallel != tc.expected {
+			t.Errorf("Input parallel=%d: expected %d, got %d", tc.input, tc.expected, c.Parallel)
+		}
+	}
+}
+
+func TestNewIperf3Client_HostAndPort(t *testing.T) {
+	c := NewIperf3Client("iperf.example.com", WithPort(5202), WithDuration(30*time.Second))
+
+	if c.Host != "iperf.example.com" {
+		t.Errorf("Expected Host=iperf.example.com, got %s", c.Host)
+	}
+	if c.Port != 5202 {
+		t.Errorf("Expected Port=5202, got %d", c.Port)
+	}
+	if c.Duration != 30 {
+		t.Errorf("Expected Duration=30, got %d", c.Duration)
+	}
+}
+
+func TestNewIperf3Client_BlockSize(t *testing.T) {
+	if c := NewIperf3Client("test.host", WithProtocol("udp"), WithBlockSize(1200)); c.BlockSize != 1200 {
+		t.Errorf("Expected the requested block size 1200, got %d", c.BlockSize)
+	}
+	if len(NewIperf3Client("test.host").cookie) != COOKIE_SIZE {
+		t.Error("Expected a client to get a cookie")
+	}
+}
@@ -0,0 +1,34 @@
+package nettest
+
+import (
+	"fmt"
+	"strings"
+)
+
+// congestionError explains a stream that could not select its algorithm
+func congestionError(algorithm string, err error) error {
+	return fmt.Errorf("congestion control %s: %v", algorithm, withAvailableCongestion(err))
+}
+
+// withAvailableCongestion adds the algorithms the kernel has loaded to a
+// failed selection, where it lists them
+func withAvailableCongestion(err error) error {
+	if available := availableCongestion(); len(available) > 0 {
+		return fmt.Errorf("%v (available: %s)", err, strings.Join(available, ", "))
+	}
+	return err
+}
+
+// setCongestionUsed reports the algorithms of both ends: ours from the first
+// stream, the server's from its results, each as sender or receiver
+func (c *Iperf3Client) setCongestionUsed(result *Iperf3Result, server string) {
+	if c.Protocol != "TCP" {
+		return
+	}
+	local := c.congestionUsed
+	if c.Reverse {
+		result.SenderCongestion, result.ReceiverCongestion = server, local
+	} else {
+		result.SenderCongestion, result.ReceiverCongestion = local, server
+	}
+}
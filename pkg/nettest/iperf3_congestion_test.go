@@ -0,0 +1,23 @@
+package nettest
+
+import "testing"
+
+func TestSetCongestionUsed(t *testing.T) {
+	congestionUsed := func(protocol string, reverse bool, local, server string) (string, string) {
+		var result Iperf3Result
+		c := &Iperf3Client{Protocol: protocol, Reverse: reverse, congestionUsed: local}
+		c.setCongestionUsed(&result, server)
+		return result.SenderCongestion, result.ReceiverCongestion
+	}
+	// Uploads: the agent sends
+	if sender, receiver := congestionUsed("TCP", false, "bbr", "cubic"); sender != "bbr" || receiver != "cubic" {
+		t.Errorf("Expected sender bbr and receiver cubic on an upload, got %q and %q", sender, receiver)
+	}
+	// Downloads: the server sends
+	if sender, receiver := congestionUsed("TCP", true, "bbr", "cubic"); sender != "cubic" || receiver != "bbr" {
+		t.Errorf("Expected sender cubic and receiver bbr on a download, got %q and %q", sender, receiver)
+	}
+	if sender, receiver := congestionUsed("UDP", false, "", ""); sender != "" || receiver != "" {
+		t.Errorf("Expected nothing for UDP, got %q and %q", sender, receiver)
+	}
+}
@@ -0,0 +1,66 @@
+package nettest
+
+import (
+	"math"
+	"sync/atomic"
+	"time"
+)
+
+// targetBytes is the amount a transfer-limited test stops at: num_bytes, or
+// block_count blocks of the block size. Zero means the test runs for its duration.
+func (c *Iperf3Client) targetBytes() int64 {
+	if c.BlockCount > 0 {
+		return int64(c.BlockCount) * int64(c.BlockSize)
+	}
+	return c.NumBytes
+}
+
+// Stream counters at the end of the omitted period, subtracted from the totals
+type omitSnapshot struct {
+	bytes       []int64
+	retransmits []int // Forward tests on Linux only
+}
+
+// startOmit takes the omit snapshot c.Omit seconds after start. The returned
+// function waits for it, or when the test ended sooner takes it right away,
+// so that everything moved counts as omitted.
+func (c *Iperf3Client) startOmit(start time.Time) func() *omitSnapshot {
+	var snapshot *omitSnapshot
+	taken := make(chan struct{})
+	take := func() {
+		s := &omitSnapshot{bytes: make([]int64, len(c.streamTransferred))}
+		for i := range s.bytes {
+			s.bytes[i] = atomic.LoadInt64(&c.streamTransferred[i])
+		}
+		if c.Protocol == "TCP" && !c.Reverse {
+			s.retransmits = c.readRetransmits()
+		}
+		snapshot = s
+		close(taken)
+	}
+	timer := time.AfterFunc(time.Until(start.Add(time.Duration(c.Omit)*time.Second)), take)
+	return func() *omitSnapshot {
+		if timer.Stop() {
+			take()
+		}
+		<-taken
+		return snapshot
+	}
+}
+
+// applyOmit takes the omitted period out of a test's bytes and duration
+func (c *Iperf3Client) applyOmit(result *Iperf3Result, omitted *omitSnapshot, elapsed float64) {
+	result.OmitSec = c.Omit
+	for i, n := range omitted.bytes {
+		if i < len(c.streamBytes) {
+			c.streamBytes[i] -= n
+		}
+		result.OmittedBytes += n
+	}
+	if c.Reverse {
+		result.ReceivedBytes -= result.OmittedBytes
+	} else {
+		result.SentBytes -= result.OmittedBytes
+	}
+	result.Duration = math.Max(elapsed-float64(c.Omit), 0)
+}
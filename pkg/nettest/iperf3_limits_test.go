@@ -0,0 +1,15 @@
+package nettest
+
+import "testing"
+
+func TestTargetBytes(t *testing.T) {
+	if got := (&Iperf3Client{BlockSize: 131072}).targetBytes(); got != 0 {
+		t.Errorf("Expected no target, got %d", got)
+	}
+	if got := (&Iperf3Client{NumBytes: 5000000, BlockSize: 131072}).targetBytes(); got != 5000000 {
+		t.Errorf("Expected 5000000 bytes, got %d", got)
+	}
+	if got := (&Iperf3Client{BlockCount: 1000, BlockSize: 1460}).targetBytes(); got != 1460000 {
+		t.Errorf("Expected 1000 datagrams of 1460 bytes, got %d", got)
+	}
+}
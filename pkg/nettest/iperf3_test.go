@@ -0,0 +1,290 @@
+package nettest
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"math"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestUDPReceiveStats_LossAndReordering(t *testing.T) {
+	var s udpReceiveStats
+	sent := time.Unix(1770000000, 0)
+	// 1, 2, 4, 5, then 3 arrives late, then 7 after a loss of 6
+	for _, seq := range []uint32{1, 2, 4, 5, 3, 7} {
+		s.add(seq, sent, sent.Add(10*time.Millisecond))
+	}
+	if s.packets != 7 {
+		t.Errorf("Expected highest sequence 7, got %d", s.packets)
+	}
+	if s.lost != 1 || s.outOfOrder != 1 {
+		t.Errorf("Expected 1 lost and 1 out of order, got %d and %d", s.lost, s.outOfOrder)
+	}
+	if s.jitter != 0 {
+		t.Errorf("Expected no jitter at a constant transit time, got %f", s.jitter)
+	}
+}
+
+func TestUDPReceiveStats_Jitter(t *testing.T) {
+	var s udpReceiveStats
+	sent := time.Unix(1770000000, 0)
+	s.add(1, sent, sent.Add(10*time.Millisecond))
+	s.add(2, sent, sent.Add(26*time.Millisecond))
+	// RFC 3550: J += (|D| - J) / 16 with D = 16 ms
+	if math.Abs(s.jitter-0.001) > 1e-9 {
+		t.Errorf("Expected jitter of 1 ms, got %f s", s.jitter)
+	}
+}
+
+func TestServerReport_UDPUpload(t *testing.T) {
+	server := &Iperf3Results{CPUUtilTotal: 4.5, Streams: []Iperf3StreamResults{
+		{ID: 1, Bytes: 1250000, Packets: 1000, Errors: 10, Jitter: 0.0002, EndTime: 1},
+		{ID: 3, Bytes: 1250000, Packets: 1000, Errors: 30, Jitter: 0.0004, EndTime: 1},
+	}}
+	report := serverReport(server, "UDP", false, 1)
+	if report.Role != "receiver" || report.Bytes != 2500000 || math.Abs(report.BandwidthMbps-20) > 1e-9 {
+		t.Errorf("Expected a receiver at 20 Mbps, got %+v", report)
+	}
+	if report.LostPackets == nil || *report.LostPackets != 40 || math.Abs(*report.LossPercent-2) > 1e-9 {
+		t.Errorf("Expected 40 lost datagrams (2%%), got %v and %v", report.LostPackets, report.LossPercent)
+	}
+	if math.Abs(*report.JitterMs-0.3) > 1e-9 || math.Abs(*report.Streams[1].JitterMs-0.4) > 1e-9 {
+		t.Errorf("Expected 0.3 ms mean jitter and 0.4 ms on stream 3, got %v and %v", *report.JitterMs, *report.Streams[1].JitterMs)
+	}
+	if report.Retransmits != nil {
+		t.Errorf("Expected no retransmits for UDP, got %d", *report.Retransmits)
+	}
+}
+
+func TestServerReport_TCPDownload(t *testing.T) {
+	// No stream times: the client's duration is used
+	server := &Iperf3Results{SenderHasRetransmits: 1, Streams: []Iperf3StreamResults{
+		{ID: 1, Bytes: 5000000, Retransmits: 2},
+		{ID: 3, Bytes: 5000000, Retransmits: 5},
+	}}
+	report := serverReport(server, "TCP", true, 2)
+	if report.Role != "sender" || math.Abs(report.BandwidthMbps-40) > 1e-9 {
+		t.Errorf("Expected a sender at 40 Mbps, got %s at %.3f", report.Role, report.BandwidthMbps)
+	}
+	if report.Retransmits == nil || *report.Retransmits != 7 || *report.Streams[1].Retransmits != 5 {
+		t.Errorf("Expected 7 retransmits with 5 on stream 3, got %v", report.Retransmits)
+	}
+	if report.LostPackets != nil || report.Packets != 0 {
+		t.Errorf("Expected no UDP counters for TCP, got %+v", report)
+	}
+
+	// A TCP upload's receiver has no retransmits to report
+	if r := serverReport(server, "TCP", false, 2); r.Retransmits != nil || r.Streams[0].Retransmits != nil {
+		t.Errorf("Expected no retransmits from a receiving server")
+	}
+}
+
+func TestUDPConnect(t *testing.T) {
+	server, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	go func() {
+		buf := make([]byte, 64)
+		n, addr, err := server.ReadFrom(buf)
+		if err != nil || n != 4 || binary.LittleEndian.Uint32(buf) != UDP_CONNECT_MSG {
+			return
+		}
+		_, _ = server.WriteTo([]byte{0x36, 0x37, 0x38, 0x39}, addr)
+	}()
+
+	conn, err := net.Dial("udp", server.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if err := udpConnect(conn, UDP_CONNECT_TIMEOUT); err != nil {
+		t.Errorf("Expected the server's reply, got %v", err)
+	}
+
+	// A server that never answers fails the stream
+	if err := udpConnect(conn, 50*time.Millisecond); err == nil {
+		t.Error("Expected an error without a reply")
+	}
+}
+
+func TestStreamID(t *testing.T) {
+	for i, want := range []int{1, 3, 4, 5} {
+		if got := streamID(i); got != want {
+			t.Errorf("streamID(%d) = %d, want %d", i, got, want)
+		}
+	}
+}
+
+func TestBuildStreams_TCPUpload(t *testing.T) {
+	locals := []string{"192.0.2.10:40112", "192.0.2.10:40114", "192.0.2.10:40116"}
+	rtts := []tcpStreamRTT{
+		{12100 * time.Microsecond, 800 * time.Microsecond},
+		{12300 * time.Microsecond, 900 * time.Microsecond},
+		{31700 * time.Microsecond, 4200 * time.Microsecond},
+	}
+	streams := buildStreams(locals, []int64{12500000, 12500000, 2500000}, []int{3, 2, 19}, rtts, 10)
+	if len(streams) != 3 {
+		t.Fatalf("Expected 3 streams, got %d", len(streams))
+	}
+	if s := streams[2]; s.ID != 4 || s.Local != locals[2] || s.BandwidthMbps != 2 {
+		t.Errorf("Expected stream 4 from %s at 2 Mbps, got %d from %s at %v", locals[2], s.ID, s.Local, s.BandwidthMbps)
+	}
+	if s := streams[2]; s.Retransmits == nil || *s.Retransmits != 19 || s.RTTMs == nil || *s.RTTMs != 31.7 || s.RTTVarMs == nil || *s.RTTVarMs != 4.2 {
+		t.Errorf("Expected 19 retransmits and an RTT of 31.7 ± 4.2 ms on the slow stream, got %+v", s)
+	}
+	if streams[0].BandwidthMbps != 10 {
+		t.Errorf("Expected 10 Mbps on stream 1, got %v", streams[0].BandwidthMbps)
+	}
+}
+
+func TestBuildStreams_Unknown(t *testing.T) {
+	// UDP, or TCP without TCP_INFO: bytes and bandwidth only
+	streams := buildStreams([]string{"192.0.2.10:40112"}, []int64{1000}, nil, nil, 0)
+	if s := streams[0]; s.Retransmits != nil || s.RTTMs != nil || s.RTTVarMs != nil || s.BandwidthMbps != 0 {
+		t.Errorf("Expected no retransmits, RTT or bandwidth, got %+v", s)
+	}
+
+	// A receiver's estimate has no variation, and no estimate yet is left out
+	streams = buildStreams(nil, []int64{1000, 1000}, nil, []tcpStreamRTT{{rtt: 15 * time.Millisecond}, {}}, 1)
+	if s := streams[0]; s.RTTMs == nil || *s.RTTMs != 15 || s.RTTVarMs != nil {
+		t.Errorf("Expected an RTT of 15 ms without variation, got %+v", s)
+	}
+	if streams[1].RTTMs != nil {
+		t.Errorf("Expected no RTT without an estimate, got %v", *streams[1].RTTMs)
+	}
+}
+
+func TestBuildInterval_SingleStream(t *testing.T) {
+	interval := buildInterval(1, 2, []int64{12500000}, nil)
+	if interval.Bytes != 12500000 || math.Abs(interval.BandwidthMbps-100) > 1e-9 {
+		t.Errorf("Expected 12500000 bytes at 100 Mbps, got %d at %.3f", interval.Bytes, interval.BandwidthMbps)
+	}
+	if interval.Retransmits != nil || interval.Streams != nil {
+		t.Errorf("Expected no retransmits or streams, got %+v", interval)
+	}
+}
+
+func TestBuildInterval_ParallelStreams(t *testing.T) {
+	// A short final interval of half a second
+	interval := buildInterval(4, 4.5, []int64{1250000, 3750000}, []int{2, 5})
+	if math.Abs(interval.BandwidthMbps-80) > 1e-9 {
+		t.Errorf("Expected 80 Mbps, got %.3f", interval.BandwidthMbps)
+	}
+	if interval.Retransmits == nil || *interval.Retransmits != 7 {
+		t.Errorf("Expected 7 retransmits, got %v", interval.Retransmits)
+	}
+	if len(interval.Streams) != 2 {
+		t.Fatalf("Expected 2 streams, got %d", len(interval.Streams))
+	}
+	if s := interval.Streams[1]; math.Abs(s.BandwidthMbps-60) > 1e-9 || s.Retransmits == nil || *s.Retransmits != 5 {
+		t.Errorf("Expected stream 2 at 60 Mbps with 5 retransmits, got %+v", s)
+	}
+}
+
+func TestIntervalSeries(t *testing.T) {
+	intervals := []Iperf3Interval{
+		buildInterval(0, 1, []int64{1000000}, []int{0}),
+		buildInterval(1, 2, []int64{2000000}, []int{3}),
+	}
+	throughput, retransmits := intervalSeries(intervals)
+	if len(throughput) != 2 || throughput[1].T != 1 || math.Abs(throughput[1].Value-16) > 1e-9 {
+		t.Errorf("Expected 2 throughput points ending at 16 Mbps, got %+v", throughput)
+	}
+	if len(retransmits) != 2 || retransmits[1].Value != 3 {
+		t.Errorf("Expected 2 retransmit points ending at 3, got %+v", retransmits)
+	}
+
+	// Downloads and UDP tests have no retransmit series
+	_, retransmits = intervalSeries([]Iperf3Interval{buildInterval(0, 1, []int64{1000000}, nil)})
+	if retransmits != nil {
+		t.Errorf("Expected no retransmit series, got %+v", retransmits)
+	}
+
+	// Intervals within the omit period are left out
+	intervals[0].Omitted = true
+	throughput, retransmits = intervalSeries(intervals)
+	if len(throughput) != 1 || throughput[0].T != 1 || len(retransmits) != 1 {
+		t.Errorf("Expected only the interval past the omit period, got %+v and %+v", throughput, retransmits)
+	}
+}
+
+func TestSetRetransmits(t *testing.T) {
+	var result Iperf3Result
+	setRetransmits(&result, []int{3, 0, 11})
+	if !result.HasRetransmits || result.Retransmits != 14 || len(result.StreamRetransmits) != 3 {
+		t.Errorf("Expected 14 retransmits over 3 streams, got %+v", result)
+	}
+
+	// Zero is a measurement, not an absent count
+	result = Iperf3Result{}
+	setRetransmits(&result, []int{0})
+	if !result.HasRetransmits || result.Retransmits != 0 {
+		t.Errorf("Expected 0 retransmits reported, got %+v", result)
+	}
+}
+
+func TestApplyServerRetransmits(t *testing.T) {
+	// Results of an iperf3 server that sent on a download
+	raw := `{"cpu_util_total": 1.5, "sender_has_retransmits": 1, "streams": [
+		{"id": 1, "bytes": 1000, "retransmits": 9, "jitter": 0, "errors": 0, "packets": 0},
+		{"id": 3, "bytes": 1000, "retransmits": 4, "jitter": 0, "errors": 0, "packets": 0}]}`
+	var server Iperf3Results
+	if err := json.Unmarshal([]byte(raw), &server); err != nil {
+		t.Fatal(err)
+	}
+	var result Iperf3Result
+	applyServerRetransmits(&result, &server)
+	if result.Retransmits != 13 || len(result.StreamRetransmits) != 2 || result.StreamRetransmits[1] != 4 {
+		t.Errorf("Expected 13 retransmits as [9 4], got %+v", result)
+	}
+
+	// A server that could not read TCP_INFO leaves the count unknown
+	server.SenderHasRetransmits = 0
+	result = Iperf3Result{}
+	applyServerRetransmits(&result, &server)
+	if result.HasRetransmits {
+		t.Errorf("Expected no retransmits from a server without them, got %+v", result)
+	}
+}
+
+func TestSenderHasRetransmits(t *testing.T) {
+	tests := []struct {
+		reverse bool
+		streams []int
+		want    int
+	}{
+		{false, []int{2}, 1},
+		{false, nil, 0}, // TCP_INFO unavailable
+		{true, nil, -1}, // Receiving client, as in iperf3
+	}
+	for _, tt := range tests {
+		if got := senderHasRetransmits(tt.reverse, tt.streams); got != tt.want {
+			t.Errorf("Expected %d for reverse=%v streams=%v, got %d", tt.want, tt.reverse, tt.streams, got)
+		}
+	}
+}
+
+func TestIntervalOmitted(t *testing.T) {
+	// Ticks land a little after each second, so the interval starting at
+	// 1.0002 is the first one counted with omit 1
+	tests := []struct {
+		start float64
+		omit  int
+		want  bool
+	}{
+		{0, 0, false},
+		{0, 1, true},
+		{1.0002, 1, false},
+		{1.0002, 2, true},
+		{1.9998, 2, false},
+	}
+	for _, tt := range tests {
+		if got := intervalOmitted(tt.start, tt.omit); got != tt.want {
+			t.Errorf("Expected omitted=%v for the interval at %.4f with omit %d, got %v", tt.want, tt.start, tt.omit, got)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package nettest
+
+import (
+	"context"
+	"net"
+	"syscall"
+	"time"
+)
+
+// Buffer sizes of the data streams as the kernel granted them
+type Iperf3SocketBuffers struct {
+	Requested    int  `json:"requested,omitempty"` // window_size
+	SndbufActual int  `json:"sndbuf_actual"`       // SO_SNDBUF
+	RcvbufActual int  `json:"rcvbuf_actual"`       // SO_RCVBUF
+	Limited      bool `json:"limited,omitempty"`   // Granted less than requested, capped by net.core.wmem_max or rmem_max
+}
+
+// streamDialer dials a data stream through the source binding, with the
+// socket buffers set before the connection is made
+func (c *Iperf3Client) streamDialer(network string) *net.Dialer {
+	d := c.Bind.Dialer(network, 5*time.Second)
+	if c.Window == 0 {
+		return d
+	}
+	bind := d.ControlContext
+	d.ControlContext = func(ctx context.Context, network, address string, rc syscall.RawConn) error {
+		if bind != nil {
+			if err := bind(ctx, network, address, rc); err != nil {
+				return err
+			}
+		}
+		return setSocketBuffers(rc, c.Window)
+	}
+	return d
+}
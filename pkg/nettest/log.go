@@ -0,0 +1,29 @@
+package nettest
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+)
+
+// logf logs a line of the test of ctx through slog.Default, whose handler may
+// add what ctx carries, such as request IDs
+func logf(ctx context.Context, format string, args ...interface{}) {
+	logAt(ctx, slog.LevelInfo, format, args...)
+}
+
+// warnf logs a warning of the test of ctx
+func warnf(ctx context.Context, format string, args ...interface{}) {
+	logAt(ctx, slog.LevelWarn, format, args...)
+}
+
+func logAt(ctx context.Context, level slog.Level, format string, args ...interface{}) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	logger := slog.Default()
+	if !logger.Enabled(ctx, level) {
+		return
+	}
+	logger.Log(ctx, level, fmt.Sprintf(format, args...))
+}
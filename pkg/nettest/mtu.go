@@ -0,0 +1,108 @@
+package nettest
+
+import (
+	"net"
+	"sync"
+)
+
+// Path MTU inference for forward UDP tests
+const (
+	IPV4_HEADER_SIZE = 20
+	IPV6_HEADER_SIZE = 40
+	UDP_WIRE_HEADER  = 8
+	TCP_WIRE_HEADER  = 20
+	TCP_TIMESTAMPS   = 12 // Option space the MSS excludes; timestamps are negotiated by default on common stacks
+
+	// Loss at which datagrams above the inferred MTU, without any ICMP feedback,
+	// are taken as silently dropped rather than congested
+	SILENT_DROP_LOSS_PERCENT = 50.0
+)
+
+// MTUReport is the path MTU seen by a forward UDP test, returned as data.mtu
+type MTUReport struct {
+	DatagramBytes   int   `json:"datagram_bytes"`    // UDP payload size the test started with
+	DatagramIPBytes int   `json:"datagram_ip_bytes"` // Including IP and UDP headers
+	ClampedBytes    int   `json:"clamped_datagram_bytes,omitempty"`
+	FragNeeded      int64 `json:"frag_needed"` // Sends refused after ICMP fragmentation-needed / packet-too-big
+	RouteMTU        int   `json:"route_mtu,omitempty"`
+	TCPMSS          int   `json:"tcp_mss,omitempty"` // Of the control connection, lowered by MSS clamping
+	EffectiveMTU    int   `json:"effective_mtu,omitempty"`
+
+	SilentDropSuspected bool `json:"silent_drop_suspected"`
+}
+
+// mtuTracker collects path MTU feedback from the streams of one test
+type mtuTracker struct {
+	mu         sync.Mutex
+	fragNeeded int64
+	clamped    int // Smallest clamped datagram size, 0 if never clamped
+}
+
+func IsIPv6Addr(addr net.Addr) bool {
+	udp, ok := addr.(*net.UDPAddr)
+	if ok {
+		return udp.IP.To4() == nil
+	}
+	tcp, ok := addr.(*net.TCPAddr)
+	return ok && tcp.IP.To4() == nil
+}
+
+func IPHeaderSize(addr net.Addr) int {
+	if IsIPv6Addr(addr) {
+		return IPV6_HEADER_SIZE
+	}
+	return IPV4_HEADER_SIZE
+}
+
+// clamp handles a send refused for exceeding the path MTU, returning the datagram
+// size that fits the MTU the kernel learned, or 0 if it cannot shrink further
+func (t *mtuTracker) clamp(conn net.Conn, size int) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.fragNeeded++
+	fit := SocketPathMTU(conn) - IPHeaderSize(conn.RemoteAddr()) - UDP_WIRE_HEADER
+	if fit < UDP_HEADER_SIZE || fit >= size {
+		return 0
+	}
+	if t.clamped == 0 || fit < t.clamped {
+		t.clamped = fit
+	}
+	return fit
+}
+
+// InferEffectiveMTU takes the lower of the kernel's path MTU and the MTU implied
+// by the control connection's MSS (which reflects MSS clamping on the path);
+// either may be unknown (0)
+func InferEffectiveMTU(routeMTU, mss, ipHeader int) int {
+	mtu := routeMTU
+	if mss > 0 {
+		if fromMSS := mss + ipHeader + TCP_WIRE_HEADER + TCP_TIMESTAMPS; mtu == 0 || fromMSS < mtu {
+			mtu = fromMSS
+		}
+	}
+	return mtu
+}
+
+// silentDropSuspected reports datagrams above the inferred MTU that drew no ICMP
+// feedback yet were mostly lost: a path dropping them without telling the sender
+func silentDropSuspected(r *MTUReport, lossPercent float64) bool {
+	return r.FragNeeded == 0 && r.EffectiveMTU > 0 && r.DatagramIPBytes > r.EffectiveMTU && lossPercent >= SILENT_DROP_LOSS_PERCENT
+}
+
+// report builds the MTU report once the server's loss is known
+func (t *mtuTracker) report(stream, control net.Conn, datagramBytes int, lossPercent float64) *MTUReport {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	ipHeader := IPHeaderSize(stream.RemoteAddr())
+	r := &MTUReport{
+		DatagramBytes:   datagramBytes,
+		DatagramIPBytes: datagramBytes + ipHeader + UDP_WIRE_HEADER,
+		ClampedBytes:    t.clamped,
+		FragNeeded:      t.fragNeeded,
+		RouteMTU:        SocketPathMTU(stream),
+		TCPMSS:          TCPMSS(control),
+	}
+	r.EffectiveMTU = InferEffectiveMTU(r.RouteMTU, r.TCPMSS, ipHeader)
+	r.SilentDropSuspected = silentDropSuspected(r, lossPercent)
+	return r
+}
@@ -0,0 +1,135 @@
+//go:build linux
+
+package nettest
+
+import (
+	"errors"
+	"net"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// SetDontFragment sets DF on a UDP data socket and stops local fragmentation, so
+// ICMP fragmentation-needed / packet-too-big feedback surfaces as EMSGSIZE on send
+func SetDontFragment(conn net.Conn) error {
+	return ControlSocket(conn, func(fd int, v6 bool) error {
+		if v6 {
+			return syscall.SetsockoptInt(fd, syscall.IPPROTO_IPV6, syscall.IPV6_MTU_DISCOVER, syscall.IPV6_PMTUDISC_DO)
+		}
+		return syscall.SetsockoptInt(fd, syscall.IPPROTO_IP, syscall.IP_MTU_DISCOVER, syscall.IP_PMTUDISC_DO)
+	})
+}
+
+// SetProbeDontFragment sets DF on a raw socket but ignores the path MTU the kernel
+// learned, so packets above it still leave and draw fresh ICMP feedback
+func SetProbeDontFragment(conn syscall.Conn, v6 bool) error {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var opErr error
+	if err := raw.Control(func(fd uintptr) {
+		if v6 {
+			opErr = unix.SetsockoptInt(int(fd), unix.IPPROTO_IPV6, unix.IPV6_MTU_DISCOVER, unix.IPV6_PMTUDISC_PROBE)
+		} else {
+			opErr = unix.SetsockoptInt(int(fd), unix.IPPROTO_IP, unix.IP_MTU_DISCOVER, unix.IP_PMTUDISC_PROBE)
+		}
+	}); err != nil {
+		return err
+	}
+	return opErr
+}
+
+// SocketPathMTU returns the kernel's path MTU for a connected UDP socket, 0 if unknown
+func SocketPathMTU(conn net.Conn) int {
+	var mtu int
+	_ = ControlSocket(conn, func(fd int, v6 bool) error {
+		var err error
+		if v6 {
+			mtu, err = syscall.GetsockoptInt(fd, syscall.IPPROTO_IPV6, syscall.IPV6_MTU)
+		} else {
+			mtu, err = syscall.GetsockoptInt(fd, syscall.IPPROTO_IP, syscall.IP_MTU)
+		}
+		return err
+	})
+	return mtu
+}
+
+// TCPMSS returns the maximum segment size of a TCP connection, 0 if unknown
+func TCPMSS(conn net.Conn) int {
+	var mss int
+	_ = ControlSocket(conn, func(fd int, _ bool) error {
+		var err error
+		mss, err = syscall.GetsockoptInt(fd, syscall.IPPROTO_TCP, syscall.TCP_MAXSEG)
+		return err
+	})
+	return mss
+}
+
+// IsMessageTooBig reports whether a send failed because the datagram exceeds the path MTU
+func IsMessageTooBig(err error) bool {
+	return errors.Is(err, syscall.EMSGSIZE)
+}
+
+func ControlSocket(conn net.Conn, fn func(fd int, v6 bool) error) error {
+	sc, ok := conn.(syscall.Conn)
+	if !ok {
+		return errors.New("connection has no socket")
+	}
+	raw, err := sc.SyscallConn()
+	if err != nil {
+		return err
+	}
+	v6 := IsIPv6Addr(conn.RemoteAddr())
+	var opErr error
+	if err := raw.Control(func(fd uintptr) { opErr = fn(int(fd), v6) }); err != nil {
+		return err
+	}
+	return opErr
+}
+
+const PMTUSupported = true
+
+// DialTCPProbe connects with TCP_MAXSEG set before the handshake and DF set, so
+// every full segment leaves as a packet of mss plus headers
+func DialTCPProbe(address string, mss int, timeout time.Duration) (net.Conn, error) {
+	d := net.Dialer{Timeout: timeout, Control: func(network, _ string, c syscall.RawConn) error {
+		var opErr error
+		err := c.Control(func(fd uintptr) {
+			if opErr = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_TCP, syscall.TCP_MAXSEG, mss); opErr != nil {
+				return
+			}
+			if network == "tcp6" {
+				opErr = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IPV6, syscall.IPV6_MTU_DISCOVER, syscall.IPV6_PMTUDISC_DO)
+			} else {
+				opErr = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IP, syscall.IP_MTU_DISCOVER, syscall.IP_PMTUDISC_DO)
+			}
+		})
+		if err != nil {
+			return err
+		}
+		return opErr
+	}}
+	return d.Dial("tcp", address)
+}
+
+// TCPProbeState reports whether written bytes of a probe connection were
+// acknowledged, and the path MTU the kernel holds for it
+func TCPProbeState(conn net.Conn, written int) (bool, int, error) {
+	var acked bool
+	var pmtu int
+	err := ControlSocket(conn, func(fd int, _ bool) error {
+		info, err := unix.GetsockoptTCPInfo(fd, unix.IPPROTO_TCP, unix.TCP_INFO)
+		if err != nil {
+			return err
+		}
+		// bytes_acked counts the SYN as well; kernels before 4.1 leave it 0, where
+		// nothing outstanding means the same
+		acked = info.Bytes_acked > uint64(written) || (info.Bytes_acked == 0 && info.Unacked == 0)
+		pmtu = int(info.Pmtu)
+		return nil
+	})
+	return acked, pmtu, err
+}
@@ -0,0 +1,33 @@
+//go:build !linux
+
+package nettest
+
+import (
+	"errors"
+	"net"
+	"syscall"
+	"time"
+)
+
+// Path MTU feedback is only read on Linux; elsewhere the kernel keeps its default
+// fragmentation behaviour and the MTU report relies on loss and the TCP MSS alone.
+
+func SetDontFragment(conn net.Conn) error { return nil }
+
+func SetProbeDontFragment(conn syscall.Conn, v6 bool) error { return nil }
+
+func SocketPathMTU(conn net.Conn) int { return 0 }
+
+func TCPMSS(conn net.Conn) int { return 0 }
+
+func IsMessageTooBig(err error) bool { return false }
+
+const PMTUSupported = false
+
+func DialTCPProbe(address string, mss int, timeout time.Duration) (net.Conn, error) {
+	return nil, errors.New("path MTU probes are only available on Linux")
+}
+
+func TCPProbeState(conn net.Conn, written int) (bool, int, error) {
+	return false, 0, errors.New("TCP state is only available on Linux")
+}
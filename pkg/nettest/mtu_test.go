@@ -0,0 +1,47 @@
+package nettest
+
+import "testing"
+
+func TestInferEffectiveMTU(t *testing.T) {
+	tests := []struct {
+		name     string
+		routeMTU int
+		mss      int
+		want     int
+	}{
+		{"route and MSS agree", 1400, 1348, 1400},
+		{"MSS clamped to PPPoE", 1500, 1440, 1492},
+		{"route MTU only", 1500, 0, 1500},
+		{"MSS only", 0, 1448, 1500},
+		{"unknown", 0, 0, 0},
+	}
+
+	for _, tt := range tests {
+		if got := InferEffectiveMTU(tt.routeMTU, tt.mss, IPV4_HEADER_SIZE); got != tt.want {
+			t.Errorf("%s: expected %d, got %d", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestSilentDropSuspected(t *testing.T) {
+	datagram := 1460 + IPV4_HEADER_SIZE + UDP_WIRE_HEADER // 1488
+	report := func(effectiveMTU int, fragNeeded int64) *MTUReport {
+		return &MTUReport{DatagramIPBytes: datagram, EffectiveMTU: effectiveMTU, FragNeeded: fragNeeded}
+	}
+
+	if !silentDropSuspected(report(1400, 0), 100) {
+		t.Errorf("Expected oversized, fully lost datagrams without ICMP feedback to be suspected")
+	}
+	if silentDropSuspected(report(1400, 1), 100) {
+		t.Errorf("Expected no suspicion once fragmentation-needed feedback arrived")
+	}
+	if silentDropSuspected(report(1500, 0), 100) {
+		t.Errorf("Expected no suspicion for datagrams within the MTU (congestion loss)")
+	}
+	if silentDropSuspected(report(0, 0), 100) {
+		t.Errorf("Expected no suspicion without an inferred MTU")
+	}
+	if silentDropSuspected(report(1400, 0), 5) {
+		t.Errorf("Expected no suspicion at low loss")
+	}
+}
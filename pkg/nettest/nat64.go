@@ -0,0 +1,158 @@
+package nettest
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+// NAT64 prefix detection (RFC 7050). Dials to addresses in a detected or the
+// well-known prefix are reported as NAT64 in their DialReport.
+const (
+	NAT64_DETECT_NAME    = "ipv4only.arpa"
+	NAT64_LOOKUP_TIMEOUT = 3 * time.Second
+	NAT64_PREFIX_TTL     = 10 * time.Minute // How long detected prefixes annotate dials
+)
+
+var (
+	// The addresses ipv4only.arpa resolves to (RFC 7050 section 2.2)
+	nat64WellKnownIPv4 = []net.IP{net.IPv4(192, 0, 0, 170), net.IPv4(192, 0, 0, 171)}
+	// RFC 6052 well-known prefix
+	NAT64WellKnownPrefix = &net.IPNet{IP: net.ParseIP("64:ff9b::"), Mask: net.CIDRMask(96, 128)}
+)
+
+// Prefixes of the last DNS64 detection, read when annotating dials of other tests
+var (
+	nat64PrefixMu      sync.Mutex
+	nat64PrefixCached  []*net.IPNet
+	nat64PrefixExpires time.Time
+)
+
+// nat64Positions returns the address bytes holding the IPv4 address behind a
+// prefix of the given length; bits 64-71 are skipped (RFC 6052 section 2.2)
+func nat64Positions(bits int) []int {
+	var pos []int
+	for i := bits / 8; len(pos) < 4; i++ {
+		if i != 8 {
+			pos = append(pos, i)
+		}
+	}
+	return pos
+}
+
+// NAT64Synthesize embeds an IPv4 address in a NAT64 prefix
+func NAT64Synthesize(prefix *net.IPNet, v4 net.IP) net.IP {
+	bits, _ := prefix.Mask.Size()
+	ip := make(net.IP, net.IPv6len)
+	copy(ip, prefix.IP.Mask(prefix.Mask))
+	for i, p := range nat64Positions(bits) {
+		ip[p] = v4.To4()[i]
+	}
+	return ip
+}
+
+// nat64Extract returns the IPv4 address an IPv6 address embeds behind a prefix of the given length
+func nat64Extract(ip net.IP, bits int) net.IP {
+	ip = ip.To16()
+	if ip == nil || (bits != 96 && ip[8] != 0) {
+		return nil
+	}
+	v4 := make(net.IP, net.IPv4len)
+	for i, p := range nat64Positions(bits) {
+		v4[i] = ip[p]
+	}
+	return v4
+}
+
+// nat64PrefixOf finds the prefix a synthesized address of ipv4only.arpa was built
+// from, by the position of the well-known IPv4 address in it (RFC 7050 section 3)
+func nat64PrefixOf(ip net.IP) *net.IPNet {
+	if ip.To4() != nil {
+		return nil
+	}
+	for _, bits := range []int{96, 64, 56, 48, 40, 32} {
+		v4 := nat64Extract(ip, bits)
+		for _, wka := range nat64WellKnownIPv4 {
+			if v4 != nil && v4.Equal(wka) {
+				mask := net.CIDRMask(bits, 128)
+				return &net.IPNet{IP: ip.Mask(mask), Mask: mask}
+			}
+		}
+	}
+	return nil
+}
+
+// DetectNAT64Prefixes resolves ipv4only.arpa over AAAA: any answer is synthesized by DNS64
+func DetectNAT64Prefixes(ctx context.Context) ([]*net.IPNet, time.Duration, error) {
+	start := time.Now()
+	ips, err := net.DefaultResolver.LookupIP(ctx, "ip6", NAT64_DETECT_NAME)
+	elapsed := time.Since(start)
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+		return nil, elapsed, nil
+	}
+	if err != nil {
+		return nil, elapsed, err
+	}
+	var prefixes []*net.IPNet
+	for _, ip := range ips {
+		prefix := nat64PrefixOf(ip)
+		if prefix == nil {
+			continue
+		}
+		seen := false
+		for _, p := range prefixes {
+			seen = seen || p.String() == prefix.String()
+		}
+		if !seen {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	return prefixes, elapsed, nil
+}
+
+// refreshNAT64Prefixes detects the resolver's NAT64 prefixes and caches them for dial annotations
+func refreshNAT64Prefixes() {
+	ctx, cancel := context.WithTimeout(context.Background(), NAT64_LOOKUP_TIMEOUT)
+	defer cancel()
+	prefixes, _, err := DetectNAT64Prefixes(ctx)
+	if err != nil {
+		warnf(nil, "NAT64 prefix detection failed: %v", err)
+	}
+	SetNAT64Prefixes(prefixes)
+}
+
+// SetNAT64Prefixes replaces the cached prefixes, as a NAT64 test that ran
+// its own detection does
+func SetNAT64Prefixes(prefixes []*net.IPNet) {
+	nat64PrefixMu.Lock()
+	defer nat64PrefixMu.Unlock()
+	nat64PrefixCached = prefixes
+	nat64PrefixExpires = time.Now().Add(NAT64_PREFIX_TTL)
+}
+
+// NAT64Embedded returns the IPv4 address a dialed IPv6 address translates to, if it
+// lies in a detected or the well-known NAT64 prefix. Stale prefixes are refreshed in
+// the background, so dials never wait on the lookup.
+func NAT64Embedded(ip net.IP) net.IP {
+	if ip.To4() != nil {
+		return nil
+	}
+	nat64PrefixMu.Lock()
+	prefixes := nat64PrefixCached
+	if time.Now().After(nat64PrefixExpires) {
+		nat64PrefixExpires = time.Now().Add(NAT64_PREFIX_TTL)
+		go refreshNAT64Prefixes()
+	}
+	nat64PrefixMu.Unlock()
+
+	for _, prefix := range append([]*net.IPNet{NAT64WellKnownPrefix}, prefixes...) {
+		if prefix.Contains(ip) {
+			bits, _ := prefix.Mask.Size()
+			return nat64Extract(ip, bits)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package nettest
+
+import (
+	"net"
+	"testing"
+)
+
+// RFC 6052 section 2.4: 192.0.2.33 embedded behind each prefix length
+var rfc6052Examples = []struct {
+	prefix, address string
+}{
+	{"2001:db8::/32", "2001:db8:c000:221::"},
+	{"2001:db8:100::/40", "2001:db8:1c0:2:21::"},
+	{"2001:db8:122::/48", "2001:db8:122:c000:2:2100::"},
+	{"2001:db8:122:300::/56", "2001:db8:122:3c0:0:221::"},
+	{"2001:db8:122:344::/64", "2001:db8:122:344:c0:2:2100:0"},
+	{"2001:db8:122:344::/96", "2001:db8:122:344::c000:221"},
+	{"64:ff9b::/96", "64:ff9b::c000:221"},
+}
+
+func TestNAT64Synthesize(t *testing.T) {
+	v4 := net.ParseIP("192.0.2.33")
+	for _, e := range rfc6052Examples {
+		_, prefix, _ := net.ParseCIDR(e.prefix)
+		if got := NAT64Synthesize(prefix, v4); !got.Equal(net.ParseIP(e.address)) {
+			t.Errorf("Expected %s for %s, got %s", e.address, e.prefix, got)
+		}
+	}
+}
+
+func TestNAT64Extract(t *testing.T) {
+	for _, e := range rfc6052Examples {
+		_, prefix, _ := net.ParseCIDR(e.prefix)
+		bits, _ := prefix.Mask.Size()
+		if got := nat64Extract(net.ParseIP(e.address), bits); got.String() != "192.0.2.33" {
+			t.Errorf("Expected 192.0.2.33 from %s, got %v", e.address, got)
+		}
+	}
+	// The u octet (bits 64-71) must be zero outside /96
+	if got := nat64Extract(net.ParseIP("2001:db8:122:344:ff00::"), 64); got != nil {
+		t.Errorf("Expected no address with a non-zero u octet, got %s", got)
+	}
+}
+
+func TestNAT64PrefixOf(t *testing.T) {
+	cases := map[string]string{
+		"64:ff9b::c000:aa":             "64:ff9b::/96",
+		"64:ff9b::192.0.0.171":         "64:ff9b::/96",
+		"2001:db8:122:344:c0:0:aa00:0": "2001:db8:122:344::/64",
+		"2001:db8:c000:ab::":           "2001:db8::/32",
+	}
+	for address, expected := range cases {
+		prefix := nat64PrefixOf(net.ParseIP(address))
+		if prefix == nil || prefix.String() != expected {
+			t.Errorf("Expected prefix %s for %s, got %v", expected, address, prefix)
+		}
+	}
+	for _, address := range []string{"2001:db8::1", "192.0.0.170"} {
+		if prefix := nat64PrefixOf(net.ParseIP(address)); prefix != nil {
+			t.Errorf("Expected no prefix for %s, got %s", address, prefix)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+//go:build linux
+
+package nettest
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+
+	"golang.org/x/sys/unix"
+)
+
+const namespaceSupported = true
+
+// inNamespace runs fn on a thread of its own that has entered the network
+// namespace at path. A socket stays in the namespace it was created in, so fn
+// only needs to open the test's sockets there; their I/O may run on any thread.
+func inNamespace(path string, fn func() error) error {
+	runtime.LockOSThread()
+	own, err := os.Open("/proc/thread-self/ns/net")
+	if err != nil {
+		runtime.UnlockOSThread()
+		return fmt.Errorf("reading the agent's network namespace: %w", err)
+	}
+	defer own.Close()
+	target, err := os.Open(path)
+	if err != nil {
+		runtime.UnlockOSThread()
+		return fmt.Errorf("opening network namespace: %w", err)
+	}
+	defer target.Close()
+	if err := unix.Setns(int(target.Fd()), unix.CLONE_NEWNET); err != nil {
+		runtime.UnlockOSThread()
+		return fmt.Errorf("entering network namespace %s: %w", path, err)
+	}
+	defer func() {
+		// A thread that cannot return stays locked, and the runtime ends it
+		// with the goroutine rather than run others in the wrong namespace
+		if unix.Setns(int(own.Fd()), unix.CLONE_NEWNET) == nil {
+			runtime.UnlockOSThread()
+		}
+	}()
+	return fn()
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package nettest
+
+import "errors"
+
+// Network namespaces are Linux only; requests with netns set are rejected elsewhere.
+
+const namespaceSupported = false
+
+func inNamespace(path string, fn func() error) error {
+	return errors.New("network namespaces are only available on Linux")
+}
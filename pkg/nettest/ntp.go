@@ -0,0 +1,122 @@
+package nettest
+
+import (
+	"math"
+)
+
+// NTPStatus contains NTP synchronization information from the platform clock source
+type NTPStatus struct {
+	Synced       bool    // Clock is synchronized
+	ErrorMicros  int64   // Estimated error in microseconds
+	ErrorSeconds float64 // Estimated error in seconds
+}
+
+// CheckNTPSync checks if the local system clock is synchronized via NTP/PTP
+func CheckNTPSync() bool {
+	return getNTPStatus().Synced
+}
+
+// CalculateErrorEstimate creates the 16-bit TWAMP Error Estimate field
+// Format (RFC 4656 Section 4.1.2):
+//
+//	Bit 15: S (Synchronized) - 1 if clock is synced to UTC via external source
+//	Bit 14: Z (Zero) - 1 if timestamp is not available
+//	Bits 8-13: Scale (6-bit unsigned)
+//	Bits 0-7: Multiplier (8-bit unsigned)
+//
+// Error in seconds = Multiplier × 2^(-Scale)
+func CalculateErrorEstimate() uint16 {
+	ntpStatus := getNTPStatus()
+
+	// Calculate Scale and Multiplier from error
+	// We want: errorSeconds ≈ Multiplier × 2^(-Scale)
+	// Rearranging: Multiplier ≈ errorSeconds × 2^Scale
+	//
+	// Choose Scale to get a reasonable Multiplier (1-255)
+	// Higher Scale = finer resolution
+
+	errorSeconds := ntpStatus.ErrorSeconds
+
+	// Limit error to reasonable range
+	if errorSeconds < 0.000001 { // < 1 microsecond
+		errorSeconds = 0.000001
+	}
+	if errorSeconds > 100 { // > 100 seconds
+		errorSeconds = 100
+	}
+
+	// Find best Scale (0-63) that gives Multiplier in range 1-255
+	var bestScale uint8 = 1
+	var bestMultiplier uint8 = 1
+
+	for scale := uint8(0); scale <= 63; scale++ {
+		// Multiplier = errorSeconds × 2^Scale
+		multiplier := errorSeconds * math.Pow(2, float64(scale))
+
+		if multiplier >= 1 && multiplier <= 255 {
+			bestScale = scale
+			bestMultiplier = uint8(math.Round(multiplier))
+			break
+		}
+	}
+
+	// Build the Error Estimate field
+	var errorEstimate uint16 = 0
+
+	// Set S-bit if synchronized
+	if ntpStatus.Synced {
+		errorEstimate |= (1 << 15)
+	}
+
+	// Z-bit is 0 (timestamp is available)
+
+	// Set Scale (bits 8-13)
+	errorEstimate |= uint16(bestScale&0x3F) << 8
+
+	// Set Multiplier (bits 0-7)
+	errorEstimate |= uint16(bestMultiplier)
+
+	// Calculate actual error for logging
+	actualError := float64(bestMultiplier) * math.Pow(2, -float64(bestScale))
+
+	logf(nil, "TWAMP ErrorEstimate: synced=%v, targetError=%.6fs, scale=%d, mult=%d, actualError=%.6fs, value=0x%04X",
+		ntpStatus.Synced, errorSeconds, bestScale, bestMultiplier, actualError, errorEstimate)
+
+	return errorEstimate
+}
+
+// ErrorEstimateInfo contains parsed Error Estimate field information (RFC 4656/5357)
+type ErrorEstimateInfo struct {
+	Synced       bool    // S-bit: clock is synchronized to UTC
+	Unavailable  bool    // Z-bit: timestamp not available (error is infinite)
+	Scale        uint8   // 6-bit scale factor
+	Multiplier   uint8   // 8-bit multiplier
+	ErrorSeconds float64 // Calculated error: Multiplier × 2^(-Scale)
+}
+
+// ParseErrorEstimate extracts S, Z, Scale, and Multiplier from the 16-bit Error Estimate field
+// Format (RFC 4656 Section 4.1.2):
+//
+//	Bit 15: S (Synchronized) - 1 if clock is synced to UTC via external source
+//	Bit 14: Z (Zero) - 1 if timestamp is not available
+//	Bits 8-13: Scale (6-bit unsigned)
+//	Bits 0-7: Multiplier (8-bit unsigned)
+//
+// Error in seconds = Multiplier × 2^(-Scale)
+func ParseErrorEstimate(ee uint16) ErrorEstimateInfo {
+	info := ErrorEstimateInfo{
+		Synced:      (ee>>15)&1 == 1,
+		Unavailable: (ee>>14)&1 == 1,
+		Scale:       uint8((ee >> 8) & 0x3F), // bits 8-13 (6 bits)
+		Multiplier:  uint8(ee & 0xFF),        // bits 0-7 (8 bits)
+	}
+
+	if info.Unavailable || info.Multiplier == 0 {
+		info.ErrorSeconds = -1 // Infinite/unavailable
+	} else {
+		// Error = Multiplier × 2^(-Scale)
+		info.ErrorSeconds = float64(info.Multiplier) * math.Pow(2, -float64(info.Scale))
+	}
+
+	return info
+}
@@ -0,0 +1,135 @@
+//go:build darwin
+
+package nettest
+
+import (
+	"bufio"
+	"math"
+	"os"
+	"strings"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// Offset beyond which the clock is treated as unsynchronized (ntpd's step threshold)
+const darwinSyncedOffsetMax = 0.128
+
+// timex is struct timex of <sys/timex.h> on 64-bit macOS
+type timex struct {
+	Modes     uint32
+	Offset    int64
+	Freq      int64
+	Maxerror  int64
+	Esterror  int64
+	Status    int32
+	Constant  int64
+	Precision int64
+	Tolerance int64
+	Ppsfreq   int64
+	Jitter    int64
+	Shift     int32
+	Stabil    int64
+	Jitcnt    int64
+	Calcnt    int64
+	Errcnt    int64
+	Stbcnt    int64
+}
+
+// queryNTPStatus reads the kernel clock state timed maintains, like adjtimex
+// on Linux. Only where ntp_adjtime is missing, before macOS 10.13, is the
+// clock measured against the configured time server instead.
+func queryNTPStatus() NTPStatus {
+	if status, ok := kernelNTPStatus(); ok {
+		return status
+	}
+	return sntpNTPStatus()
+}
+
+// kernelNTPStatus reads the clock state with ntp_adjtime without changing it.
+// The clock is synchronized when the state is not TIME_ERROR and STA_UNSYNC
+// is clear; the error estimate is esterror.
+func kernelNTPStatus() (NTPStatus, bool) {
+	const timeError = 5
+	const staUnsync = 0x40
+
+	var tx timex
+	r1, _, errno := unix.Syscall(unix.SYS_NTP_ADJTIME, uintptr(unsafe.Pointer(&tx)), 0, 0)
+	if errno != 0 {
+		warnf(nil, "ntp_adjtime failed: %v", errno)
+		return NTPStatus{}, false
+	}
+
+	state := int(r1)
+	isSynced := state != timeError && tx.Status&staUnsync == 0
+	errorMicros := tx.Esterror
+	if errorMicros <= 0 {
+		errorMicros = 1000000 // Default to 1 second if not available
+	}
+	errorSeconds := float64(errorMicros) / 1e6
+
+	logf(nil, "NTP sync check (ntp_adjtime): state=%d, status=0x%x, synced=%v, esterror=%d µs (%.6f s)",
+		state, tx.Status, isSynced, errorMicros, errorSeconds)
+
+	return NTPStatus{
+		Synced:       isSynced,
+		ErrorMicros:  errorMicros,
+		ErrorSeconds: errorSeconds,
+	}, true
+}
+
+// sntpNTPStatus measures the local clock against the configured time server.
+//
+// The server configured in /etc/ntp.conf (time.apple.com by default) is probed
+// with `sntp`, which prints "+offset +/- error server address". The clock is
+// considered synchronized when the measured offset is within 128 ms.
+func sntpNTPStatus() NTPStatus {
+	server := darwinNTPServer()
+
+	out, err := runTimeCommand(5*time.Second, "sntp", "-t", "2", server)
+	if err != nil {
+		warnf(nil, "sntp query to %s failed: %v", server, err)
+		return unsyncedNTPStatus()
+	}
+
+	offset, bound, ok := parseSntpOutput(out)
+	if !ok {
+		warnf(nil, "sntp query to %s: could not parse output %q", server, strings.TrimSpace(out))
+		return unsyncedNTPStatus()
+	}
+
+	isSynced := math.Abs(offset) <= darwinSyncedOffsetMax
+	errorSeconds := math.Abs(offset) + bound
+	if errorSeconds <= 0 {
+		errorSeconds = 0.000001
+	}
+	errorMicros := int64(errorSeconds * 1e6)
+
+	logf(nil, "NTP sync check (sntp %s): offset=%.6fs, bound=%.6fs, synced=%v, error=%d µs (%.6f s)",
+		server, offset, bound, isSynced, errorMicros, errorSeconds)
+
+	return NTPStatus{
+		Synced:       isSynced,
+		ErrorMicros:  errorMicros,
+		ErrorSeconds: errorSeconds,
+	}
+}
+
+// darwinNTPServer returns the first server from /etc/ntp.conf, or time.apple.com
+func darwinNTPServer() string {
+	f, err := os.Open("/etc/ntp.conf")
+	if err != nil {
+		return "time.apple.com"
+	}
+	defer func() { _ = f.Close() }()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "server" {
+			return strings.TrimSuffix(fields[1], ".")
+		}
+	}
+	return "time.apple.com"
+}
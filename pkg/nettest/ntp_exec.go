@@ -0,0 +1,48 @@
+//go:build windows || darwin
+
+package nettest
+
+import (
+	"context"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// Querying the OS time service spawns a process on Windows (and a network
+// round-trip on macOS before 10.13), so results are cached briefly rather than
+// run per TWAMP request.
+const ntpStatusCacheTTL = 30 * time.Second
+
+var (
+	ntpStatusMu      sync.Mutex
+	ntpStatusCached  NTPStatus
+	ntpStatusExpires time.Time
+)
+
+// getNTPStatus returns the cached platform NTP status, refreshing it via queryNTPStatus when stale
+func getNTPStatus() NTPStatus {
+	ntpStatusMu.Lock()
+	defer ntpStatusMu.Unlock()
+
+	if time.Now().Before(ntpStatusExpires) {
+		return ntpStatusCached
+	}
+	ntpStatusCached = queryNTPStatus()
+	ntpStatusExpires = time.Now().Add(ntpStatusCacheTTL)
+	return ntpStatusCached
+}
+
+// runTimeCommand executes an OS time utility with a hard timeout and returns its combined output
+func runTimeCommand(timeout time.Duration, name string, args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	out, err := exec.CommandContext(ctx, name, args...).CombinedOutput()
+	return string(out), err
+}
+
+// unsyncedNTPStatus is the fallback used when the time service cannot be queried
+func unsyncedNTPStatus() NTPStatus {
+	return NTPStatus{Synced: false, ErrorMicros: 1000000, ErrorSeconds: 1.0} // 1 second default error
+}
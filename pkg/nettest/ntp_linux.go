@@ -0,0 +1,72 @@
+//go:build linux
+
+package nettest
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// timex struct for adjtimex syscall
+type timex struct {
+	Modes     uint32
+	Offset    int64
+	Freq      int64
+	Maxerror  int64
+	Esterror  int64
+	Status    int32
+	Constant  int64
+	Precision int64
+	Tolerance int64
+	Time      syscall.Timeval
+	Tick      int64
+	Ppsfreq   int64
+	Jitter    int64
+	Shift     int32
+	Stabil    int64
+	Jitcnt    int64
+	Calcnt    int64
+	Errcnt    int64
+	Stbcnt    int64
+	Tai       int32
+	_         [44]byte // padding
+}
+
+// getNTPStatus returns detailed NTP synchronization status using adjtimex syscall
+func getNTPStatus() NTPStatus {
+	var tx timex
+
+	r1, _, errno := syscall.Syscall(syscall.SYS_ADJTIMEX, uintptr(unsafe.Pointer(&tx)), 0, 0)
+	if errno != 0 {
+		warnf(nil, "adjtimex syscall failed: %v", errno)
+		return NTPStatus{Synced: false, ErrorMicros: 1000000, ErrorSeconds: 1.0} // 1 second default error
+	}
+
+	status := int(r1)
+
+	// TIME_ERROR (5) means clock is not synchronized
+	const timeError = 5
+	// STA_UNSYNC flag (bit 6) indicates unsynchronized state
+	const staUnsync = 0x40
+
+	// Clock is synchronized if:
+	// 1. Return value is not TIME_ERROR (5)
+	// 2. STA_UNSYNC flag is not set in tx.Status
+	isSynced := status != timeError && (tx.Status&staUnsync) == 0
+
+	// Esterror is in microseconds
+	errorMicros := tx.Esterror
+	if errorMicros <= 0 {
+		errorMicros = 1000000 // Default to 1 second if not available
+	}
+	errorSeconds := float64(errorMicros) / 1e6
+
+	logf(nil, "NTP sync check: status=%d, tx.Status=0x%x, synced=%v, esterror=%d µs (%.6f s)",
+		status, tx.Status, isSynced, errorMicros, errorSeconds)
+
+	return NTPStatus{
+		Synced:       isSynced,
+		ErrorMicros:  errorMicros,
+		ErrorSeconds: errorSeconds,
+	}
+}
@@ -0,0 +1,119 @@
+package nettest
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Parsers of the time tools queried on Windows and macOS, built on every
+// platform so they are tested everywhere
+
+// Lines of `w32tm /query /status /verbose` by position. The labels are
+// translated with the display language; their order and the numbers leading
+// each value are not.
+const (
+	w32tmLeapIndicator  = 0  // "0(no warning)"
+	w32tmStratum        = 1  // "3 (secondary reference - syncd by (S)NTP)"
+	w32tmRootDelay      = 3  // "0.0312500s"
+	w32tmRootDispersion = 4  // "7.7756000s"
+	w32tmReferenceID    = 5  // "0x14655A4E (source IP:  20.101.57.78)"
+	w32tmStateMachine   = 11 // "2 (Sync)", verbose only
+
+	w32tmStateSync      = 2
+	w32tmLocalClockRef  = 0x4C4F434C // ReferenceId "LOCL" of the local CMOS clock
+	w32tmMaxSyncStratum = 15
+)
+
+// w32tmNumber is the number a w32tm value starts with; some locales write a
+// decimal comma
+var w32tmNumber = regexp.MustCompile(`^[-+]?(0x[0-9A-Fa-f]+|[0-9]+([.,][0-9]+)?)`)
+
+// w32tmStatus holds the values queryNTPStatus reads from w32tm on Windows
+type w32tmStatus struct {
+	Leap           int
+	Stratum        int
+	RootDelay      float64 // Seconds
+	RootDispersion float64 // Seconds
+	ReferenceID    uint64
+	State          int // Time service state machine, -1 without /verbose
+}
+
+// synced is the sync check of queryNTPStatus on Windows
+func (s w32tmStatus) synced() bool {
+	return s.Leap != 3 &&
+		s.Stratum >= 1 && s.Stratum <= w32tmMaxSyncStratum &&
+		s.ReferenceID != 0 && s.ReferenceID != w32tmLocalClockRef &&
+		(s.State < 0 || s.State == w32tmStateSync)
+}
+
+// parseW32tmStatus reads the values of "Label: value" lines by position,
+// whatever the language of the labels
+func parseW32tmStatus(out string) (w32tmStatus, bool) {
+	var values []string
+	for _, line := range strings.Split(out, "\n") {
+		line = strings.Replace(line, "：", ":", 1) // Full-width colon of CJK locales
+		_, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		values = append(values, strings.TrimSpace(value))
+	}
+	if len(values) <= w32tmReferenceID {
+		return w32tmStatus{}, false
+	}
+
+	status := w32tmStatus{State: -1}
+	leap, ok1 := parseW32tmNumber(values[w32tmLeapIndicator])
+	stratum, ok2 := parseW32tmNumber(values[w32tmStratum])
+	rootDelay, ok3 := parseW32tmNumber(values[w32tmRootDelay])
+	rootDispersion, ok4 := parseW32tmNumber(values[w32tmRootDispersion])
+	refID, ok5 := parseW32tmNumber(values[w32tmReferenceID])
+	if !ok1 || !ok2 || !ok3 || !ok4 || !ok5 {
+		return w32tmStatus{}, false
+	}
+	status.Leap, status.Stratum = int(leap), int(stratum)
+	status.RootDelay, status.RootDispersion = rootDelay, rootDispersion
+	status.ReferenceID = uint64(refID)
+	if len(values) > w32tmStateMachine {
+		if state, ok := parseW32tmNumber(values[w32tmStateMachine]); ok {
+			status.State = int(state)
+		}
+	}
+	return status, true
+}
+
+// parseW32tmNumber parses the number a value starts with: "0(no warning)",
+// "0.0312500s", "0,0312500s" or "0x4C4F434C (...)"
+func parseW32tmNumber(v string) (float64, bool) {
+	n := w32tmNumber.FindString(v)
+	if n == "" {
+		return 0, false
+	}
+	if hex, ok := strings.CutPrefix(n, "0x"); ok {
+		u, err := strconv.ParseUint(hex, 16, 64)
+		return float64(u), err == nil
+	}
+	f, err := strconv.ParseFloat(strings.Replace(n, ",", ".", 1), 64)
+	return f, err == nil
+}
+
+// parseSntpOutput extracts offset and error bound from a line like
+// "+0.001234 +/- 0.012345 time.apple.com 17.253.34.253", which older sntp
+// versions prefix with the local date and time
+func parseSntpOutput(out string) (offset, bound float64, ok bool) {
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		for i := 1; i+1 < len(fields); i++ {
+			if fields[i] != "+/-" {
+				continue
+			}
+			o, err1 := strconv.ParseFloat(fields[i-1], 64)
+			b, err2 := strconv.ParseFloat(fields[i+1], 64)
+			if err1 == nil && err2 == nil {
+				return o, b, true
+			}
+		}
+	}
+	return 0, 0, false
+}
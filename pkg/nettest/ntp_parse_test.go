@@ -0,0 +1,136 @@
+package nettest
+
+import (
+	"strings"
+	"testing"
+)
+
+const w32tmVerboseEnglish = "Leap Indicator: 0(no warning)\r\n" +
+	"Stratum: 3 (secondary reference - syncd by (S)NTP)\r\n" +
+	"Precision: -23 (119.209ns per tick)\r\n" +
+	"Root Delay: 0.0404274s\r\n" +
+	"Root Dispersion: 0.0420634s\r\n" +
+	"ReferenceId: 0x14655A4E (source IP:  20.101.57.78)\r\n" +
+	"Last Successful Sync Time: 10/14/2026 9:12:11 AM\r\n" +
+	"Source: time.windows.com,0x9\r\n" +
+	"Poll Interval: 10 (1024s)\r\n" +
+	"\r\n" +
+	"Phase Offset: 0.0004371s\r\n" +
+	"ClockRate: 0.0156250s\r\n" +
+	"State Machine: 2 (Sync)\r\n" +
+	"Time Source Flags: 0 (None)\r\n" +
+	"Server Role: 0 (None)\r\n" +
+	"Last Sync Error: 0 (The command completed successfully.)\r\n" +
+	"Time since Last Good Sync Time: 293.7823151s\r\n"
+
+const w32tmVerboseGerman = "Sprungindikator: 0(keine Warnung)\r\n" +
+	"Stratum: 4 (Sekundärreferenz - synchr. über (S)NTP)\r\n" +
+	"Präzision: -23 (119.209ns pro Tick)\r\n" +
+	"Stammverzögerung: 0,0312500s\r\n" +
+	"Stammabweichung: 7,7756000s\r\n" +
+	"Referenz-ID: 0xC0A80001 (Quell-IP:  192.168.0.1)\r\n" +
+	"Letzte erfolgr. Synchronisierungszeit: 14.10.2026 09:12:11\r\n" +
+	"Quelle: dc01.example.local\r\n" +
+	"Abrufintervall: 10 (1024s)\r\n" +
+	"\r\n" +
+	"Phasenoffset: 0,0001230s\r\n" +
+	"Taktrate: 0,0156250s\r\n" +
+	"Zustandsautomat: 2 (Synchronisierung)\r\n"
+
+const w32tmLocalCMOS = "Leap Indicator: 0(no warning)\r\n" +
+	"Stratum: 1 (primary reference - syncd by radio clock)\r\n" +
+	"Precision: -23 (119.209ns per tick)\r\n" +
+	"Root Delay: 0.0000000s\r\n" +
+	"Root Dispersion: 10.0000000s\r\n" +
+	"ReferenceId: 0x4C4F434C (source name:  \"LOCL\")\r\n" +
+	"Last Successful Sync Time: 10/14/2026 9:12:11 AM\r\n" +
+	"Source: Local CMOS Clock\r\n" +
+	"Poll Interval: 6 (64s)\r\n"
+
+const w32tmFreeRunning = "Leap Indicator: 3(not synchronized)\r\n" +
+	"Stratum: 0 (unspecified)\r\n" +
+	"Precision: -23 (119.209ns per tick)\r\n" +
+	"Root Delay: 0.0000000s\r\n" +
+	"Root Dispersion: 0.0000000s\r\n" +
+	"ReferenceId: 0x00000000 (unspecified)\r\n" +
+	"Last Successful Sync Time: unspecified\r\n" +
+	"Source: Free-running System Clock\r\n" +
+	"Poll Interval: 10 (1024s)\r\n"
+
+const w32tmHoldJapanese = "うるう秒インジケーター： 0(警告なし)\r\n" +
+	"階層： 3 (二次参照 - (S)NTP で同期)\r\n" +
+	"精度： -23 (ティックごとに 119.209ns)\r\n" +
+	"ルート遅延： 0.0156250s\r\n" +
+	"ルート分散： 0.5312500s\r\n" +
+	"参照 ID： 0x14655A4E (ソース IP:  20.101.57.78)\r\n" +
+	"最終正常同期時刻： 2026/10/14 9:12:11\r\n" +
+	"ソース： time.windows.com,0x9\r\n" +
+	"ポーリング間隔： 10 (1024s)\r\n" +
+	"\r\n" +
+	"フェーズ オフセット： 0.0004371s\r\n" +
+	"ClockRate： 0.0156250s\r\n" +
+	"状態マシン： 1 (保留)\r\n"
+
+func TestParseW32tmStatus(t *testing.T) {
+	tests := []struct {
+		name   string
+		out    string
+		want   w32tmStatus
+		synced bool
+	}{
+		{"english verbose", w32tmVerboseEnglish, w32tmStatus{0, 3, 0.0404274, 0.0420634, 0x14655A4E, 2}, true},
+		{"german decimal comma", w32tmVerboseGerman, w32tmStatus{0, 4, 0.03125, 7.7756, 0xC0A80001, 2}, true},
+		{"local CMOS clock", w32tmLocalCMOS, w32tmStatus{0, 1, 0, 10, w32tmLocalClockRef, -1}, false},
+		{"free-running", w32tmFreeRunning, w32tmStatus{3, 0, 0, 0, 0, -1}, false},
+		{"japanese hold state", w32tmHoldJapanese, w32tmStatus{0, 3, 0.015625, 0.53125, 0x14655A4E, 1}, false},
+	}
+	for _, tt := range tests {
+		status, ok := parseW32tmStatus(tt.out)
+		if !ok {
+			t.Errorf("%s: expected the output to parse", tt.name)
+			continue
+		}
+		if status != tt.want {
+			t.Errorf("%s: expected %+v, got %+v", tt.name, tt.want, status)
+		}
+		if status.synced() != tt.synced {
+			t.Errorf("%s: expected synced=%v", tt.name, tt.synced)
+		}
+	}
+}
+
+func TestParseW32tmStatus_Unparseable(t *testing.T) {
+	for _, out := range []string{
+		"",
+		"The following error occurred: The service has not been started. (0x80070426)\r\n",
+		"Leap Indicator: 0(no warning)\r\nStratum: 3 (secondary reference - syncd by (S)NTP)\r\n",
+		strings.Replace(w32tmVerboseEnglish, "0.0404274s", "unknown", 1),
+	} {
+		if status, ok := parseW32tmStatus(out); ok {
+			t.Errorf("Expected %q not to parse, got %+v", out, status)
+		}
+	}
+}
+
+func TestParseSntpOutput(t *testing.T) {
+	tests := []struct {
+		name          string
+		out           string
+		offset, bound float64
+		ok            bool
+	}{
+		{"macOS", "+0.005409 +/- 0.030884 time.apple.com 17.253.14.125\n", 0.005409, 0.030884, true},
+		{"negative offset", "-0.128731 +/- 0.042113 time.euro.apple.com 17.253.52.125\n", -0.128731, 0.042113, true},
+		{"ntp 4.2.8 sntp", "sntp 4.2.8p10@1.3728-o Tue Mar 21 14:36:42 UTC 2017 (136.200.1~2533)\n" +
+			"2026-10-14 09:12:11.482913 (+0200) +0.001234 +/- 0.012345 time.apple.com 17.253.34.253 s1 no-leap\n", 0.001234, 0.012345, true},
+		{"timeout", "sntp: Exchange failed: Timeout\n", 0, 0, false},
+		{"unresolvable", "sntp: getaddrinfo: nodename nor servname provided, or not known\n", 0, 0, false},
+		{"empty", "", 0, 0, false},
+	}
+	for _, tt := range tests {
+		offset, bound, ok := parseSntpOutput(tt.out)
+		if ok != tt.ok || offset != tt.offset || bound != tt.bound {
+			t.Errorf("%s: expected %v +/- %v (%v), got %v +/- %v (%v)", tt.name, tt.offset, tt.bound, tt.ok, offset, bound, ok)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+//go:build windows
+
+package nettest
+
+import (
+	"strings"
+	"time"
+)
+
+// queryNTPStatus derives sync state from `w32tm /query /status /verbose`.
+//
+// The clock is considered synchronized when the leap indicator is not 3
+// (alarm/unsynchronized), the stratum is that of a time server's client, the
+// reference is not the local CMOS clock and the time service is in its Sync
+// state. The error estimate follows the NTP synchronization distance: Root
+// Dispersion + Root Delay / 2.
+func queryNTPStatus() NTPStatus {
+	out, err := runTimeCommand(5*time.Second, "w32tm", "/query", "/status", "/verbose")
+	if err != nil {
+		warnf(nil, "w32tm query failed: %v", err)
+		return unsyncedNTPStatus()
+	}
+
+	status, ok := parseW32tmStatus(out)
+	if !ok {
+		warnf(nil, "w32tm query: could not parse output %q", strings.TrimSpace(out))
+		return unsyncedNTPStatus()
+	}
+
+	isSynced := status.synced()
+
+	errorSeconds := status.RootDispersion + status.RootDelay/2
+	if errorSeconds <= 0 {
+		errorSeconds = 1.0 // Default to 1 second if not available
+	}
+	errorMicros := int64(errorSeconds * 1e6)
+
+	logf(nil, "NTP sync check (w32tm): leap=%d, stratum=%d, refid=0x%08X, state=%d, synced=%v, error=%d µs (%.6f s)",
+		status.Leap, status.Stratum, status.ReferenceID, status.State, isSynced, errorMicros, errorSeconds)
+
+	return NTPStatus{
+		Synced:       isSynced,
+		ErrorMicros:  errorMicros,
+		ErrorSeconds: errorSeconds,
+	}
+}
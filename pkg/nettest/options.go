@@ -0,0 +1,164 @@
+package nettest
+
+import "time"
+
+// Option configures an Iperf3Client or a TwampRunner as it is created. Each
+// ignores the options that do not apply to it.
+type Option func(*options)
+
+type options struct {
+	port    int
+	family  string
+	bind    *SourceBinding
+	onPhase func(phase string)
+
+	// iperf3
+	duration     time.Duration
+	parallel     int
+	protocol     string
+	reverse      bool
+	bandwidth    int64
+	bandwidthSet bool
+	pacingTimer  time.Duration
+	blockSize    int
+	payload      PayloadEntropy
+	ecn          bool
+	numBytes     int64
+	blockCount   int
+	omit         time.Duration
+	congestion   string
+	window       int
+	zeroCopy     bool
+	tcpInfo      bool
+	auth         *Iperf3Auth
+	onInterval   func(Iperf3Interval)
+
+	// TWAMP
+	count         int
+	padding       int
+	dscp          int
+	interval      time.Duration
+	timeout       time.Duration
+	errorEstimate uint16
+	onReply       func(TwampReply)
+}
+
+func newOptions(opts []Option) options {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// seconds rounds a duration to whole seconds, at least one
+func seconds(d time.Duration) int {
+	if s := int(d.Round(time.Second) / time.Second); s > 0 {
+		return s
+	}
+	return 1
+}
+
+// WithPort sets the server's port: iperf3's 5201 or TWAMP-Control's 862 by default
+func WithPort(port int) Option { return func(o *options) { o.port = port } }
+
+// WithFamily sets the address family of the connections: FAMILY_AUTO (the
+// default, Happy Eyeballs), FAMILY_IPV4 or FAMILY_IPV6
+func WithFamily(family string) Option { return func(o *options) { o.family = family } }
+
+// WithSource binds all connections to a source address or interface, see ParseSourceBinding
+func WithSource(bind *SourceBinding) Option { return func(o *options) { o.bind = bind } }
+
+// WithPhaseFunc has fn called with each step the test enters
+func WithPhaseFunc(fn func(phase string)) Option { return func(o *options) { o.onPhase = fn } }
+
+// WithDuration sets how long an iperf3 test sends, in whole seconds (default 5 s)
+func WithDuration(d time.Duration) Option { return func(o *options) { o.duration = d } }
+
+// WithParallel sets the number of iperf3 data streams (default 1)
+func WithParallel(streams int) Option { return func(o *options) { o.parallel = streams } }
+
+// WithProtocol sets the iperf3 protocol, TCP (the default) or UDP
+func WithProtocol(protocol string) Option { return func(o *options) { o.protocol = protocol } }
+
+// WithReverse has the iperf3 server send and the client receive (iperf3 -R)
+func WithReverse(reverse bool) Option { return func(o *options) { o.reverse = reverse } }
+
+// WithBandwidth sets the target rate of iperf3 tests in bits per second
+// across all streams (default DEFAULT_BANDWIDTH), 0 for no limit (iperf3 -b 0)
+func WithBandwidth(bps int64) Option {
+	return func(o *options) { o.bandwidth, o.bandwidthSet = bps, true }
+}
+
+// WithPacingTimer sets how finely iperf3 sending streams are paced to the
+// bandwidth, the ticks a packet short of tokens waits in (default 1 ms, like
+// iperf3 --pacing-timer); also sent to the server for reverse tests
+func WithPacingTimer(d time.Duration) Option { return func(o *options) { o.pacingTimer = d } }
+
+// WithBlockSize sets the size of iperf3 writes: DEFAULT_TCP_BLKSIZE or
+// DEFAULT_UDP_BLKSIZE by default
+func WithBlockSize(bytes int) Option { return func(o *options) { o.blockSize = bytes } }
+
+// WithPayload sets what iperf3 data streams carry (default PayloadRandom)
+func WithPayload(entropy PayloadEntropy) Option { return func(o *options) { o.payload = entropy } }
+
+// WithECN reports the ECN state of iperf3 TCP streams in Iperf3Result.ECN
+func WithECN(ecn bool) Option { return func(o *options) { o.ecn = ecn } }
+
+// WithBytes ends an iperf3 test once all streams moved this many bytes (iperf3 -n);
+// the duration then bounds how long that may take
+func WithBytes(n int64) Option { return func(o *options) { o.numBytes = n } }
+
+// WithBlockCount ends an iperf3 test after this many blocks (iperf3 -k)
+func WithBlockCount(n int) Option { return func(o *options) { o.blockCount = n } }
+
+// WithOmit runs an iperf3 TCP test for d in whole seconds before its duration
+// and leaves that warm-up out of the results (iperf3 -O)
+func WithOmit(d time.Duration) Option { return func(o *options) { o.omit = d } }
+
+// WithCongestion selects the TCP congestion control algorithm of both ends of
+// an iperf3 test (iperf3 -C), Linux only
+func WithCongestion(algorithm string) Option { return func(o *options) { o.congestion = algorithm } }
+
+// WithWindow sets SO_SNDBUF and SO_RCVBUF of the iperf3 data streams (iperf3 -w), Linux only
+func WithWindow(bytes int) Option { return func(o *options) { o.window = bytes } }
+
+// WithZeroCopy sends iperf3 TCP uploads with sendfile (iperf3 -Z), Linux only;
+// streams that cannot fall back to plain writes
+func WithZeroCopy(zeroCopy bool) Option { return func(o *options) { o.zeroCopy = zeroCopy } }
+
+// WithTCPInfo samples TCP_INFO of the streams of TCP uploads every interval
+// and at the end of the transfer into TCPInfo, Linux only
+func WithTCPInfo(tcpInfo bool) Option { return func(o *options) { o.tcpInfo = tcpInfo } }
+
+// WithAuth logs in to an iperf3 server that requires it, see NewIperf3Auth
+func WithAuth(auth *Iperf3Auth) Option { return func(o *options) { o.auth = auth } }
+
+// WithIntervalFunc has fn called with each per-second iperf3 interval as it is taken
+func WithIntervalFunc(fn func(Iperf3Interval)) Option {
+	return func(o *options) { o.onInterval = fn }
+}
+
+// WithCount sets the number of TWAMP probes (default 10)
+func WithCount(probes int) Option { return func(o *options) { o.count = probes } }
+
+// WithPadding adds bytes of padding to each TWAMP probe (default 0)
+func WithPadding(bytes int) Option { return func(o *options) { o.padding = bytes } }
+
+// WithDSCP marks the TWAMP probes with a DSCP code point, 0 to 63, also sent
+// as the session's Type-P Descriptor (default 0, best effort)
+func WithDSCP(dscp int) Option { return func(o *options) { o.dscp = dscp } }
+
+// WithInterval sets the time between TWAMP probes (default 1 s)
+func WithInterval(d time.Duration) Option { return func(o *options) { o.interval = d } }
+
+// WithTimeout sets how long the reflector keeps the session after the last
+// probe, in whole seconds (default 5 s)
+func WithTimeout(d time.Duration) Option { return func(o *options) { o.timeout = d } }
+
+// WithErrorEstimate sets the Error Estimate sent with the probes (RFC 4656
+// section 4.1.2); by default it is derived from the host's NTP state
+func WithErrorEstimate(ee uint16) Option { return func(o *options) { o.errorEstimate = ee } }
+
+// WithReplyFunc has fn called with each TWAMP reply as it arrives
+func WithReplyFunc(fn func(TwampReply)) Option { return func(o *options) { o.onReply = fn } }
@@ -0,0 +1,91 @@
+package nettest
+
+import (
+	"math"
+	"time"
+)
+
+// Pacing of iperf3 sending streams, like iperf3's --pacing-timer
+const (
+	DEFAULT_PACING_TIMER = time.Millisecond
+	PACING_BURST_TIMERS  = 4 // Timer ticks of tokens the bucket holds, so oversleeping a tick loses no rate
+)
+
+// Pacer is a token bucket that holds a stream to a rate. Tokens accrue at
+// the rate up to a few timer ticks' worth, each packet takes its size in
+// tokens, and a packet short of tokens waits whole ticks for them. Unlike
+// pacing by the average since the start, a stall is not made up in a burst
+// and a slow rate never sends ahead of time.
+type Pacer struct {
+	rate   float64       // Bytes per second
+	timer  time.Duration // Granularity of the waits
+	burst  float64       // Bucket depth in bytes
+	tokens float64       // Negative while a packet waits for its tokens
+	last   time.Time
+}
+
+// NewPacer creates a pacer for a rate in bits per second that waits in
+// multiples of timer, DEFAULT_PACING_TIMER when 0. A rate of 0 never waits.
+func NewPacer(bps int64, timer time.Duration) *Pacer {
+	if timer <= 0 {
+		timer = DEFAULT_PACING_TIMER
+	}
+	rate := float64(bps) / 8
+	return &Pacer{rate: rate, timer: timer, burst: rate * timer.Seconds() * PACING_BURST_TIMERS}
+}
+
+// Reserve takes the tokens of an n-byte packet at now and returns how long to
+// wait before sending it. The first packet goes at once.
+func (p *Pacer) Reserve(n int, now time.Time) time.Duration {
+	if p.rate <= 0 {
+		return 0
+	}
+	size := float64(n)
+	if p.last.IsZero() {
+		p.tokens, p.last = size, now
+	}
+	p.tokens = math.Min(p.tokens+now.Sub(p.last).Seconds()*p.rate, math.Max(p.burst, size))
+	p.last = now
+	p.tokens -= size
+	if p.tokens >= 0 {
+		return 0
+	}
+	wait := time.Duration(math.Ceil(-p.tokens / p.rate * float64(time.Second)))
+	return (wait + p.timer - 1) / p.timer * p.timer
+}
+
+// PacingReport tells how closely the sending streams of a forward test kept
+// to the bandwidth asked for
+type PacingReport struct {
+	TimerUs              int     `json:"timer_us"` // Granularity of the pacing
+	RequestedMbps        float64 `json:"requested_mbps"`
+	AchievedMbps         float64 `json:"achieved_mbps"`
+	AccuracyPercent      float64 `json:"accuracy_percent"`       // achieved_mbps as a percentage of requested_mbps
+	IntervalErrorPercent float64 `json:"interval_error_percent"` // Mean deviation of the per-second rates from requested_mbps, in percent of it
+}
+
+// pacingReport compares a forward test's sending rate, overall and in each
+// interval past the omit period, with the rate asked for
+func pacingReport(bps int64, timer time.Duration, achievedMbps float64, intervals []Iperf3Interval) *PacingReport {
+	requested := float64(bps) / 1e6
+	report := &PacingReport{
+		TimerUs:         int(timer.Microseconds()),
+		RequestedMbps:   requested,
+		AchievedMbps:    achievedMbps,
+		AccuracyPercent: achievedMbps / requested * 100,
+	}
+	var deviation float64
+	var counted int
+	for _, interval := range intervals {
+		// The final interval is usually shorter, too short to judge the rate by
+		if interval.Omitted || interval.End-interval.Start < 0.5 {
+			continue
+		}
+		deviation += math.Abs(interval.BandwidthMbps - requested)
+		counted++
+	}
+	if counted > 0 {
+		report.IntervalErrorPercent = deviation / float64(counted) / requested * 100
+	}
+	return report
+}
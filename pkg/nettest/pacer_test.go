@@ -0,0 +1,101 @@
+package nettest
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// pace sends packets of size through p for d of simulated time, returning
+// the bytes sent and the waits it took
+func pace(p *Pacer, size int, d time.Duration) (int64, []time.Duration) {
+	start := time.Unix(1700000000, 0)
+	now := start
+	var sent int64
+	var waits []time.Duration
+	for {
+		wait := p.Reserve(size, now)
+		if now.Add(wait).Sub(start) > d {
+			return sent, waits
+		}
+		now = now.Add(wait)
+		waits = append(waits, wait)
+		sent += int64(size)
+	}
+}
+
+func TestPacer_HoldsRate(t *testing.T) {
+	for _, tc := range []struct {
+		bps  int64
+		size int
+	}{
+		{1000000, 1460},          // 1 Mbit/s UDP
+		{1000000, 128 * 1024},    // 1 Mbit/s in TCP blocks, a wait of over a second each
+		{1000000000, 1460},       // 1 Gbit/s UDP
+		{10000000000, 64 * 1024}, // 10 Gbit/s
+	} {
+		sent, _ := pace(NewPacer(tc.bps, time.Millisecond), tc.size, 10*time.Second)
+		got := float64(sent) * 8 / 10
+		// Within one packet of the rate over the 10 seconds
+		if math.Abs(got-float64(tc.bps)) > float64(tc.size)*8/10 {
+			t.Errorf("%d bit/s in %d-byte packets: sent %.0f bit/s", tc.bps, tc.size, got)
+		}
+	}
+}
+
+func TestPacer_WaitsInTimerTicks(t *testing.T) {
+	timer := 5 * time.Millisecond
+	_, waits := pace(NewPacer(10000000, timer), 1460, time.Second)
+	if waits[0] != 0 {
+		t.Errorf("Expected the first packet to go at once, waited %v", waits[0])
+	}
+	for _, wait := range waits {
+		if wait%timer != 0 {
+			t.Fatalf("Expected waits in multiples of %v, got %v", timer, wait)
+		}
+	}
+}
+
+func TestPacer_NoBurstAfterStall(t *testing.T) {
+	// 100 Mbit/s: a 1 ms tick holds 12500 bytes, the bucket 4 ticks
+	p := NewPacer(100000000, time.Millisecond)
+	now := time.Unix(1700000000, 0)
+	p.Reserve(1460, now)
+
+	// A second without sending earns no more than the bucket holds
+	now = now.Add(time.Second)
+	burst := 0
+	for p.Reserve(1460, now) == 0 {
+		burst++
+	}
+	if burst > 50000/1460+1 {
+		t.Errorf("Expected at most %d packets at once after a stall, sent %d", 50000/1460+1, burst)
+	}
+}
+
+func TestPacer_Unlimited(t *testing.T) {
+	p := NewPacer(0, 0)
+	now := time.Unix(1700000000, 0)
+	for i := 0; i < 1000; i++ {
+		if wait := p.Reserve(64*1024, now); wait != 0 {
+			t.Fatalf("Expected a rate of 0 never to wait, waited %v", wait)
+		}
+	}
+}
+
+func TestPacingReport(t *testing.T) {
+	intervals := []Iperf3Interval{
+		{Start: 0, End: 1, BandwidthMbps: 300, Omitted: true},
+		{Start: 1, End: 2, BandwidthMbps: 95},
+		{Start: 2, End: 3, BandwidthMbps: 105},
+		{Start: 3, End: 4, BandwidthMbps: 98},
+		{Start: 4, End: 4.01, BandwidthMbps: 10}, // Too short to judge
+	}
+	r := pacingReport(100000000, time.Millisecond, 99, intervals)
+	if r.TimerUs != 1000 || r.RequestedMbps != 100 || r.AccuracyPercent != 99 {
+		t.Errorf("Expected a 1000 µs timer and 99 of 100 Mbit/s, got %+v", r)
+	}
+	if math.Abs(r.IntervalErrorPercent-4) > 1e-9 {
+		t.Errorf("Expected a mean interval error of 4%%, got %v", r.IntervalErrorPercent)
+	}
+}
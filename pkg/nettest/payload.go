@@ -0,0 +1,132 @@
+package nettest
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	mathrand "math/rand/v2"
+	"strings"
+	"sync"
+)
+
+// PayloadEntropy controls how compressible generated test payloads are
+type PayloadEntropy string
+
+const (
+	PayloadRandom       PayloadEntropy = "random"       // Incompressible pseudo-random bytes (default)
+	PayloadCompressible PayloadEntropy = "compressible" // Short random pattern repeated across the buffer
+	PayloadZero         PayloadEntropy = "zero"         // All zero bytes
+
+	// Length of the repeated pattern in compressible payloads
+	compressiblePatternSize = 64
+)
+
+// ParsePayloadEntropy validates a request's payload mode, defaulting to random
+func ParsePayloadEntropy(s string) (PayloadEntropy, error) {
+	switch PayloadEntropy(strings.ToLower(s)) {
+	case "", PayloadRandom:
+		return PayloadRandom, nil
+	case PayloadCompressible:
+		return PayloadCompressible, nil
+	case PayloadZero:
+		return PayloadZero, nil
+	}
+	return "", fmt.Errorf("invalid payload %q (expected random, compressible or zero)", s)
+}
+
+// Generate random cookie (iperf3 format: 36 chars from base32 + null terminator)
+func generateCookie() []byte {
+	const chars = "abcdefghijklmnopqrstuvwxyz234567"
+	cookie := make([]byte, COOKIE_SIZE)
+	// One read for all characters; 256 is a multiple of 32 so the mapping is unbiased
+	_, _ = rand.Read(cookie[:COOKIE_SIZE-1])
+	for i := 0; i < COOKIE_SIZE-1; i++ {
+		cookie[i] = chars[int(cookie[i])%len(chars)]
+	}
+	cookie[COOKIE_SIZE-1] = 0 // null terminator
+	return cookie
+}
+
+// PayloadGenerator produces per-stream test buffers from a single seed.
+//
+// The seed is drawn once from crypto/rand; each stream derives its own ChaCha8
+// generator from it, so buffers are unique per stream without further syscalls
+// and no buffer is ever shared between goroutines.
+type PayloadGenerator struct {
+	Entropy PayloadEntropy
+	Seed    [32]byte
+
+	mu      sync.Mutex
+	streams uint64
+}
+
+// NewPayloadGenerator creates a generator with a fresh random seed
+func NewPayloadGenerator(entropy PayloadEntropy) *PayloadGenerator {
+	g := &PayloadGenerator{Entropy: entropy}
+	_, _ = rand.Read(g.Seed[:])
+	return g
+}
+
+// nextStreamRNG returns a generator unique to the next stream
+func (g *PayloadGenerator) nextStreamRNG() *mathrand.ChaCha8 {
+	g.mu.Lock()
+	stream := g.streams
+	g.streams++
+	g.mu.Unlock()
+
+	seed := g.Seed
+	// Mix the stream index into the seed so every stream gets an independent sequence
+	binary.LittleEndian.PutUint64(seed[24:], binary.LittleEndian.Uint64(seed[24:])^stream)
+	return mathrand.NewChaCha8(seed)
+}
+
+// StreamBuffer returns a pooled buffer of the given size filled for a new stream.
+// The caller owns the buffer until it is handed back with ReleaseBuffer.
+func (g *PayloadGenerator) StreamBuffer(size int) []byte {
+	buf := AcquireBuffer(size)
+	g.Fill(buf)
+	return buf
+}
+
+// Fill writes payload bytes into buf according to the generator's entropy
+func (g *PayloadGenerator) Fill(buf []byte) {
+	switch g.Entropy {
+	case PayloadZero:
+		clear(buf)
+	case PayloadCompressible:
+		rng := g.nextStreamRNG()
+		var pattern [compressiblePatternSize]byte
+		_, _ = rng.Read(pattern[:])
+		for i := 0; i < len(buf); i += len(pattern) {
+			copy(buf[i:], pattern[:])
+		}
+	default:
+		rng := g.nextStreamRNG()
+		_, _ = rng.Read(buf)
+	}
+}
+
+// Buffers are pooled per size; stored as *[]byte to avoid an allocation on Put
+var bufferPools sync.Map // map[int]*sync.Pool
+
+// AcquireBuffer returns a buffer of exactly size bytes from the pool (contents undefined)
+func AcquireBuffer(size int) []byte {
+	p, ok := bufferPools.Load(size)
+	if !ok {
+		// Only the first buffer of a size creates its pool
+		p, _ = bufferPools.LoadOrStore(size, &sync.Pool{
+			New: func() interface{} {
+				b := make([]byte, size)
+				return &b
+			},
+		})
+	}
+	return *(p.(*sync.Pool).Get().(*[]byte))
+}
+
+// ReleaseBuffer returns a buffer obtained from AcquireBuffer or StreamBuffer to its pool
+func ReleaseBuffer(buf []byte) {
+	if p, ok := bufferPools.Load(len(buf)); ok {
+		p.(*sync.Pool).Put(&buf)
+	}
+}
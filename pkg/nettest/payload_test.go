@@ -0,0 +1,85 @@
+package nettest
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestParsePayloadEntropy_Default(t *testing.T) {
+	e, err := ParsePayloadEntropy("")
+	if err != nil || e != PayloadRandom {
+		t.Errorf("Expected default random, got %q (err=%v)", e, err)
+	}
+}
+
+func TestParsePayloadEntropy_CaseInsensitive(t *testing.T) {
+	e, err := ParsePayloadEntropy("ZERO")
+	if err != nil || e != PayloadZero {
+		t.Errorf("Expected zero, got %q (err=%v)", e, err)
+	}
+}
+
+func TestParsePayloadEntropy_Invalid(t *testing.T) {
+	if _, err := ParsePayloadEntropy("pink-noise"); err == nil {
+		t.Error("Expected error for invalid payload mode")
+	}
+}
+
+func TestPayloadGenerator_UniquePerStream(t *testing.T) {
+	g := NewPayloadGenerator(PayloadRandom)
+	a := make([]byte, 1460)
+	b := make([]byte, 1460)
+	g.Fill(a)
+	g.Fill(b)
+
+	if bytes.Equal(a, b) {
+		t.Error("Expected different buffers for different streams")
+	}
+}
+
+func TestPayloadGenerator_SameSeedReproducible(t *testing.T) {
+	g1 := NewPayloadGenerator(PayloadRandom)
+	g2 := &PayloadGenerator{Entropy: PayloadRandom, Seed: g1.Seed}
+	a := make([]byte, 1024)
+	b := make([]byte, 1024)
+	g1.Fill(a)
+	g2.Fill(b)
+
+	if !bytes.Equal(a, b) {
+		t.Error("Expected identical buffers for identical seed and stream index")
+	}
+}
+
+func TestPayloadGenerator_Zero(t *testing.T) {
+	g := NewPayloadGenerator(PayloadZero)
+	buf := bytes.Repeat([]byte{0xFF}, 512)
+	g.Fill(buf)
+
+	if !bytes.Equal(buf, make([]byte, 512)) {
+		t.Error("Expected all-zero buffer")
+	}
+}
+
+func TestPayloadGenerator_CompressibleRepeats(t *testing.T) {
+	g := NewPayloadGenerator(PayloadCompressible)
+	buf := make([]byte, 1000) // Not a multiple of the pattern size
+	g.Fill(buf)
+
+	for i := compressiblePatternSize; i < len(buf); i++ {
+		if buf[i] != buf[i%compressiblePatternSize] {
+			t.Fatalf("Expected repeating %d-byte pattern, mismatch at offset %d", compressiblePatternSize, i)
+		}
+	}
+}
+
+func TestPayloadGenerator_StreamBufferPooled(t *testing.T) {
+	g := NewPayloadGenerator(PayloadZero)
+	buf := g.StreamBuffer(2048)
+	if len(buf) != 2048 || !bytes.Equal(buf, make([]byte, 2048)) {
+		t.Fatalf("Expected a filled 2048-byte buffer, got %d bytes", len(buf))
+	}
+	ReleaseBuffer(buf)
+	if got := AcquireBuffer(2048); len(got) != 2048 {
+		t.Errorf("Expected a 2048-byte buffer from the pool, got %d bytes", len(got))
+	}
+}
@@ -0,0 +1,8 @@
+package nettest
+
+// SeriesPoint is a single sample of a test time series
+type SeriesPoint struct {
+	T     float64 `json:"t_sec"`           // Offset from test start in seconds
+	Value float64 `json:"value"`           // Sample value in the series unit
+	Count int     `json:"count,omitempty"` // Raw samples merged into this point when downsampled
+}
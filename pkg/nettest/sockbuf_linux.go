@@ -0,0 +1,53 @@
+//go:build linux
+
+package nettest
+
+import (
+	"net"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+const SocketBuffersSupported = true
+
+// setSocketBuffers sets SO_SNDBUF and SO_RCVBUF, like iperf3 -w. Set before
+// connecting, the receive buffer also sizes the TCP window scale.
+func setSocketBuffers(c syscall.RawConn, size int) error {
+	var opErr error
+	err := c.Control(func(fd uintptr) {
+		if opErr = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_SNDBUF, size); opErr == nil {
+			opErr = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_RCVBUF, size)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return opErr
+}
+
+// readSocketBuffers reads the buffer sizes the kernel granted a stream. Linux
+// doubles a requested size for its own bookkeeping, after capping it at
+// net.core.wmem_max and rmem_max, so a grant below twice the request was capped.
+func readSocketBuffers(conn net.Conn, requested int) *Iperf3SocketBuffers {
+	b := &Iperf3SocketBuffers{Requested: requested}
+	err := ControlSocket(conn, func(fd int, _ bool) error {
+		var err error
+		if b.SndbufActual, err = unix.GetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_SNDBUF); err != nil {
+			return err
+		}
+		b.RcvbufActual, err = unix.GetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_RCVBUF)
+		return err
+	})
+	if err != nil {
+		return nil
+	}
+	b.Limited = socketBuffersLimited(requested, b.SndbufActual, b.RcvbufActual)
+	return b
+}
+
+// socketBuffersLimited reports whether the kernel granted less than the
+// requested buffer sizes, which it doubles when granted in full
+func socketBuffersLimited(requested, sndbuf, rcvbuf int) bool {
+	return requested > 0 && (sndbuf < 2*requested || rcvbuf < 2*requested)
+}
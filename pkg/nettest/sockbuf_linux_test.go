@@ -0,0 +1,20 @@
+package nettest
+
+import "testing"
+
+func TestSocketBuffersLimited(t *testing.T) {
+	tests := []struct {
+		requested, sndbuf, rcvbuf int
+		want                      bool
+	}{
+		{65536, 131072, 131072, false},   // Granted in full, doubled by the kernel
+		{16 << 20, 425984, 425984, true}, // Capped at a wmem_max and rmem_max of 212992
+		{1 << 20, 2 << 20, 425984, true}, // Only the receive buffer capped
+		{0, 16384, 131072, false},        // Autotuned
+	}
+	for _, tt := range tests {
+		if got := socketBuffersLimited(tt.requested, tt.sndbuf, tt.rcvbuf); got != tt.want {
+			t.Errorf("requested %d, granted %d/%d: expected limited %v, got %v", tt.requested, tt.sndbuf, tt.rcvbuf, tt.want, got)
+		}
+	}
+}
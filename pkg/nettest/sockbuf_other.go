@@ -0,0 +1,20 @@
+//go:build !linux
+
+package nettest
+
+import (
+	"errors"
+	"net"
+	"syscall"
+)
+
+// Socket buffers are only set and read on Linux; requests with window_size set
+// are rejected elsewhere.
+
+const SocketBuffersSupported = false
+
+func setSocketBuffers(c syscall.RawConn, size int) error {
+	return errors.New("socket buffer sizes are only set on Linux")
+}
+
+func readSocketBuffers(conn net.Conn, requested int) *Iperf3SocketBuffers { return nil }
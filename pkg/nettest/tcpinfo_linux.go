@@ -0,0 +1,133 @@
+//go:build linux
+
+package nettest
+
+import (
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+const TCPInfoSupported = true
+
+// streamRetransmits reads the segments a TCP stream has retransmitted so far
+// from TCP_INFO, the count stock iperf3 reports for its sending streams
+func streamRetransmits(conn net.Conn) (int, error) {
+	var retransmits int
+	err := ControlSocket(conn, func(fd int, _ bool) error {
+		info, err := unix.GetsockoptTCPInfo(fd, unix.IPPROTO_TCP, unix.TCP_INFO)
+		if err != nil {
+			return err
+		}
+		retransmits = int(info.Total_retrans)
+		return nil
+	})
+	return retransmits, err
+}
+
+// streamRTT reads a TCP stream's smoothed RTT and its variation from TCP_INFO.
+// A receiver sends no data to time, so it reports the kernel's receive-side
+// estimate (tcpi_rcv_rtt), which has no variation, once it has one.
+func streamRTT(conn net.Conn, receiver bool) (tcpStreamRTT, error) {
+	var rtt tcpStreamRTT
+	err := ControlSocket(conn, func(fd int, _ bool) error {
+		info, err := unix.GetsockoptTCPInfo(fd, unix.IPPROTO_TCP, unix.TCP_INFO)
+		if err != nil {
+			return err
+		}
+		rtt.rtt, rtt.rttvar = time.Duration(info.Rtt)*time.Microsecond, time.Duration(info.Rttvar)*time.Microsecond
+		if receiver && info.Rcv_rtt > 0 {
+			rtt.rtt, rtt.rttvar = time.Duration(info.Rcv_rtt)*time.Microsecond, 0
+		}
+		return nil
+	})
+	return rtt, err
+}
+
+// Slow start threshold TCP_INFO reports before the first loss
+const tcpInfiniteSsthresh = 0x7fffffff
+
+// streamTCPInfo reads a snapshot of a sending TCP stream's congestion state
+// from TCP_INFO; fields older kernels lack are left zero
+func streamTCPInfo(conn net.Conn) (TCPInfoSnapshot, error) {
+	var s TCPInfoSnapshot
+	err := ControlSocket(conn, func(fd int, _ bool) error {
+		info, err := unix.GetsockoptTCPInfo(fd, unix.IPPROTO_TCP, unix.TCP_INFO)
+		if err != nil {
+			return err
+		}
+		s = tcpInfoSnapshot(info)
+		return nil
+	})
+	return s, err
+}
+
+func tcpInfoSnapshot(info *unix.TCPInfo) TCPInfoSnapshot {
+	s := TCPInfoSnapshot{
+		Cwnd:             info.Snd_cwnd,
+		MSS:              info.Snd_mss,
+		RTTMs:            float64(info.Rtt) / 1000,
+		RTTVarMs:         float64(info.Rttvar) / 1000,
+		MinRTTMs:         float64(info.Min_rtt) / 1000,
+		DeliveryRateMbps: float64(info.Delivery_rate) * 8 / 1e6,
+		Unacked:          info.Unacked,
+		BytesRetrans:     info.Bytes_retrans,
+		Retransmits:      info.Total_retrans,
+	}
+	if info.Snd_ssthresh < tcpInfiniteSsthresh {
+		ssthresh := info.Snd_ssthresh
+		s.Ssthresh = &ssthresh
+	}
+	// ^0 is the kernel's unlimited rate
+	if info.Pacing_rate > 0 && info.Pacing_rate != ^uint64(0) {
+		pacing := float64(info.Pacing_rate) * 8 / 1e6
+		s.PacingRateMbps = &pacing
+	}
+	return s
+}
+
+// setStreamCongestion selects a TCP stream's congestion control algorithm
+// (TCP_CONGESTION), as iperf3 -C does
+func setStreamCongestion(conn net.Conn, algorithm string) error {
+	return ControlSocket(conn, func(fd int, _ bool) error {
+		return unix.SetsockoptString(fd, unix.IPPROTO_TCP, unix.TCP_CONGESTION, algorithm)
+	})
+}
+
+// streamCongestion reads the congestion control algorithm a TCP stream runs
+func streamCongestion(conn net.Conn) (string, error) {
+	var algorithm string
+	err := ControlSocket(conn, func(fd int, _ bool) error {
+		name, err := unix.GetsockoptString(fd, unix.IPPROTO_TCP, unix.TCP_CONGESTION)
+		algorithm = strings.TrimRight(name, "\x00")
+		return err
+	})
+	return algorithm, err
+}
+
+// CheckCongestion reports whether the streams of this process can select a
+// congestion control algorithm, by asking for it on a socket that never connects
+func CheckCongestion(algorithm string) error {
+	fd, err := unix.Socket(unix.AF_INET, unix.SOCK_STREAM|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return err
+	}
+	defer unix.Close(fd)
+	if err := unix.SetsockoptString(fd, unix.IPPROTO_TCP, unix.TCP_CONGESTION, algorithm); err != nil {
+		return withAvailableCongestion(err)
+	}
+	return nil
+}
+
+// availableCongestion lists the congestion control algorithms the kernel has
+// loaded; others may still load on demand for privileged processes
+func availableCongestion() []string {
+	b, err := os.ReadFile("/proc/sys/net/ipv4/tcp_available_congestion_control")
+	if err != nil {
+		return nil
+	}
+	return strings.Fields(string(b))
+}
@@ -0,0 +1,46 @@
+package nettest
+
+import (
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestTCPInfoSnapshot(t *testing.T) {
+	s := tcpInfoSnapshot(&unix.TCPInfo{
+		Snd_cwnd: 198, Snd_ssthresh: 186, Snd_mss: 1448,
+		Rtt: 24900, Rttvar: 3200, Min_rtt: 18200,
+		Pacing_rate: 23025000, Delivery_rate: 14062500,
+		Unacked: 190, Bytes_retrans: 289600, Total_retrans: 200,
+	})
+	if s.Cwnd != 198 || s.MSS != 1448 || s.Unacked != 190 || s.Retransmits != 200 || s.BytesRetrans != 289600 {
+		t.Errorf("Expected the counters as read, got %+v", s)
+	}
+	if s.RTTMs != 24.9 || s.RTTVarMs != 3.2 || s.MinRTTMs != 18.2 {
+		t.Errorf("Expected RTTs 24.9, 3.2 and 18.2 ms, got %v, %v and %v", s.RTTMs, s.RTTVarMs, s.MinRTTMs)
+	}
+	if s.Ssthresh == nil || *s.Ssthresh != 186 {
+		t.Errorf("Expected ssthresh 186, got %v", s.Ssthresh)
+	}
+	if s.PacingRateMbps == nil || *s.PacingRateMbps != 184.2 || s.DeliveryRateMbps != 112.5 {
+		t.Errorf("Expected pacing 184.2 and delivery 112.5 Mbps, got %v and %v", s.PacingRateMbps, s.DeliveryRateMbps)
+	}
+}
+
+func TestTCPInfoSnapshot_SlowStartUnpaced(t *testing.T) {
+	// A stream still in its first slow start, without a pacing limit
+	s := tcpInfoSnapshot(&unix.TCPInfo{Snd_cwnd: 10, Snd_ssthresh: tcpInfiniteSsthresh, Pacing_rate: ^uint64(0)})
+	if s.Ssthresh != nil || s.PacingRateMbps != nil {
+		t.Errorf("Expected no ssthresh or pacing rate, got %v and %v", s.Ssthresh, s.PacingRateMbps)
+	}
+}
+
+func TestCheckCongestion(t *testing.T) {
+	// Reno is built into every kernel
+	if err := CheckCongestion("reno"); err != nil {
+		t.Errorf("Expected reno to be selectable, got %v", err)
+	}
+	if err := CheckCongestion("nope"); err == nil {
+		t.Error("Expected an unknown algorithm to be refused")
+	}
+}
@@ -0,0 +1,39 @@
+//go:build !linux
+
+package nettest
+
+import (
+	"errors"
+	"net"
+)
+
+// TCP_INFO is only read on Linux; elsewhere retransmits are left unreported, as
+// stock iperf3 does on platforms without it, and congestion is rejected.
+
+const TCPInfoSupported = false
+
+func streamRetransmits(conn net.Conn) (int, error) {
+	return 0, errors.New("TCP_INFO is only available on Linux")
+}
+
+func streamRTT(conn net.Conn, receiver bool) (tcpStreamRTT, error) {
+	return tcpStreamRTT{}, errors.New("TCP_INFO is only available on Linux")
+}
+
+func streamTCPInfo(conn net.Conn) (TCPInfoSnapshot, error) {
+	return TCPInfoSnapshot{}, errors.New("TCP_INFO is only available on Linux")
+}
+
+func setStreamCongestion(conn net.Conn, algorithm string) error {
+	return errors.New("TCP_CONGESTION is only available on Linux")
+}
+
+func streamCongestion(conn net.Conn) (string, error) {
+	return "", errors.New("TCP_CONGESTION is only available on Linux")
+}
+
+func CheckCongestion(algorithm string) error {
+	return errors.New("TCP_CONGESTION is only available on Linux")
+}
+
+func availableCongestion() []string { return nil }
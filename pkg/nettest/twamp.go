@@ -0,0 +1,326 @@
+package nettest
+
+import (
+	"context"
+	"fmt"
+	"math"
+	mathrand "math/rand"
+	"net"
+	"time"
+
+	"github.com/tcaine/twamp"
+
+	"network-test-api/pkg/stats"
+)
+
+// TWAMP tests (RFC 5357): test sessions requested over TWAMP-Control, then
+// probes the reflector returns with its receive and send timestamps
+const (
+	DEFAULT_TWAMP_PORT     = 862
+	DEFAULT_TWAMP_COUNT    = 10
+	DEFAULT_TWAMP_INTERVAL = time.Second
+	DEFAULT_TWAMP_TIMEOUT  = 5 // Seconds
+
+	// Test ports in perfSONAR's allowed range
+	TWAMP_RECEIVER_PORT   = 18760
+	TWAMP_SENDER_PORT_MIN = 18762 // Leave 18760-18761 for receiver
+	TWAMP_SENDER_PORT_MAX = 19960
+
+	TWAMP_CONNECT_TIMEOUT = 5 * time.Second
+)
+
+// TwampRunner runs full mode TWAMP tests against a reflector. Start only
+// negotiates the sessions, for callers that drive the probes themselves.
+type TwampRunner struct {
+	Host          string
+	Port          int
+	Family        string         // Address family of the control connection (auto, ipv4, ipv6)
+	Bind          *SourceBinding // Source address and interface of all connections, nil for the defaults
+	Count         int            // Probes to send
+	Padding       int            // Bytes of padding in each probe
+	DSCP          int            // DSCP code point of the probes, also their Type-P Descriptor
+	Interval      time.Duration  // Time between probes
+	Timeout       int            // Seconds the reflector keeps the session after the last probe
+	ErrorEstimate uint16         // Error Estimate of the probes, 0 to derive it from the NTP state
+
+	OnPhase func(phase string) // Called as the test enters connect, session and run
+	OnReply func(TwampReply)   // Called with each reply as it arrives
+}
+
+// TwampSessionConfig is one test session of Start
+type TwampSessionConfig struct {
+	Padding int
+	DSCP    int
+}
+
+// TwampSession is a TWAMP-Control connection whose test sessions are
+// started; Close stops them
+type TwampSession struct {
+	Dial    *DialReport        // How the control connection was established
+	Control net.Conn           // The control connection
+	Tests   []*twamp.TwampTest // One per session, in the order requested
+
+	conn *twamp.TwampConnection
+}
+
+// TwampReply is one probe that came back
+type TwampReply struct {
+	Seq         uint32
+	SentAt      time.Time   // T1 on the sender's clock
+	Timing      ProbeTiming // Delays between T1 to T4
+	SenderTTL   int         // TTL of the probe as the reflector received it
+	ReceivedTTL int         // TTL of the reply, 0 where the platform does not report it
+	Duplicate   bool        // A second reply to the same probe
+}
+
+// TwampResult is the outcome of a full mode TWAMP test. Delays are network
+// round trips, the reflector's turnaround taken out, over the replies during
+// which neither clock stepped.
+type TwampResult struct {
+	Server      string       `json:"server"`
+	Local       string       `json:"local_endpoint"`
+	Remote      string       `json:"remote_endpoint"`
+	Dial        *DialReport  `json:"dial"`
+	DSCP        int          `json:"dscp"` // As the kernel applied it
+	Sent        int          `json:"sent"`
+	Received    int          `json:"received"`
+	Duplicates  int          `json:"duplicates,omitempty"`
+	LossPercent float64      `json:"loss_percent"`
+	RTTMinMs    float64      `json:"rtt_min_ms"`
+	RTTAvgMs    float64      `json:"rtt_avg_ms"`
+	RTTMaxMs    float64      `json:"rtt_max_ms"`
+	RTTStdDevMs float64      `json:"rtt_stddev_ms"`
+	RTTMedianMs float64      `json:"rtt_median_ms"`
+	RTTMADMs    float64      `json:"rtt_mad_ms"`  // Median absolute deviation
+	JitterMs    float64      `json:"jitter_ms"`   // Mean difference between consecutive round trips
+	ClockSteps  int          `json:"clock_steps"` // Replies left out because a clock stepped
+	StartedAt   time.Time    `json:"-"`           // Before the first probe, the origin of ProbeTiming's skews
+	Replies     []TwampReply `json:"-"`           // In the order they arrived
+}
+
+// NewTwampRunner creates a runner for a TWAMP reflector; Run runs the test
+func NewTwampRunner(host string, opts ...Option) *TwampRunner {
+	o := newOptions(opts)
+	r := &TwampRunner{
+		Host:          host,
+		Port:          DEFAULT_TWAMP_PORT,
+		Family:        FAMILY_AUTO,
+		Bind:          o.bind,
+		Count:         DEFAULT_TWAMP_COUNT,
+		Padding:       o.padding,
+		DSCP:          o.dscp,
+		Interval:      DEFAULT_TWAMP_INTERVAL,
+		Timeout:       DEFAULT_TWAMP_TIMEOUT,
+		ErrorEstimate: o.errorEstimate,
+		OnPhase:       o.onPhase,
+		OnReply:       o.onReply,
+	}
+	if o.port > 0 {
+		r.Port = o.port
+	}
+	if o.family != "" {
+		r.Family = o.family
+	}
+	if o.count > 0 {
+		r.Count = o.count
+	}
+	if o.interval > 0 {
+		r.Interval = o.interval
+	}
+	if o.timeout > 0 {
+		r.Timeout = seconds(o.timeout)
+	}
+	return r
+}
+
+func (r *TwampRunner) phase(name string) {
+	if r.OnPhase != nil {
+		r.OnPhase(name)
+	}
+}
+
+// Start connects to the reflector and starts one test session per config,
+// or one with the runner's padding and DSCP, with a single Start-Sessions
+// command. Until it returns, ending ctx closes the control connection.
+func (r *TwampRunner) Start(ctx context.Context, sessions ...TwampSessionConfig) (*TwampSession, error) {
+	if len(sessions) == 0 {
+		sessions = []TwampSessionConfig{{Padding: r.Padding, DSCP: r.DSCP}}
+	}
+	r.phase("connect")
+	controlConn, dial, err := DialControlFrom(ctx, r.Host, r.Port, r.Family, TWAMP_CONNECT_TIMEOUT, r.Bind)
+	if err != nil {
+		return nil, twampStepError(ctx, "Connect failed", err)
+	}
+	stopSetup := context.AfterFunc(ctx, func() { _ = controlConn.Close() })
+	conn, err := twamp.NewClient().ConnectConn(controlConn)
+	if err != nil {
+		stopSetup()
+		_ = controlConn.Close()
+		return nil, twampStepError(ctx, "Connect failed", err)
+	}
+
+	// Random ports avoid conflicts, consecutive ones for several sessions
+	r.phase("session")
+	senderPort := TWAMP_SENDER_PORT_MIN + mathrand.Intn(TWAMP_SENDER_PORT_MAX-TWAMP_SENDER_PORT_MIN-len(sessions)+1)
+	errorEstimate := r.ErrorEstimate
+	if errorEstimate == 0 {
+		errorEstimate = CalculateErrorEstimate()
+	}
+	requested := make([]*twamp.TwampSession, 0, len(sessions))
+	for i, s := range sessions {
+		session, err := conn.CreateSession(twamp.TwampSessionConfig{
+			ReceiverPort:  TWAMP_RECEIVER_PORT,
+			SenderPort:    senderPort + i,
+			Timeout:       r.Timeout,
+			Padding:       s.Padding,
+			TOS:           s.DSCP << 2,
+			ErrorEstimate: errorEstimate,
+		})
+		if err != nil {
+			stopSetup()
+			_ = conn.Close()
+			return nil, twampStepError(ctx, "Session failed", err)
+		}
+		requested = append(requested, session)
+	}
+	// The library opens the test sockets as the sessions start
+	var tests []*twamp.TwampTest
+	err = r.Bind.InNamespace(func() error {
+		var err error
+		tests, err = conn.StartSessions(requested...)
+		return err
+	})
+	if err != nil {
+		stopSetup()
+		_ = conn.StopSessions(len(requested))
+		_ = conn.Close()
+		return nil, twampStepError(ctx, "Test creation failed", err)
+	}
+	session := &TwampSession{Dial: dial, Control: controlConn, Tests: tests, conn: conn}
+	if !stopSetup() {
+		_ = session.Close()
+		return nil, canceledError(ctx)
+	}
+	return session, nil
+}
+
+// Close stops the sessions and closes the control connection
+func (s *TwampSession) Close() error {
+	_ = s.conn.StopSessions(len(s.Tests))
+	return s.conn.Close()
+}
+
+// twampStepError is the error of a step: a cancellation, of which the step
+// only saw the closed connection, or the step's own error
+func twampStepError(ctx context.Context, step string, err error) error {
+	if ctx.Err() != nil {
+		return canceledError(ctx)
+	}
+	return fmt.Errorf("%s: %w", step, err)
+}
+
+// Run runs the test until all probes are answered or timed out, or ctx ends
+// it, which closes the test socket at once
+func (r *TwampRunner) Run(ctx context.Context) (*TwampResult, error) {
+	session, err := r.Start(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = session.Close() }()
+
+	r.phase("run")
+	test := session.Tests[0]
+	udp := test.GetConnection()
+	stop := context.AfterFunc(ctx, func() { _ = udp.Close() })
+	defer stop()
+
+	// The library binds the test socket to the control connection's address only
+	if err := r.Bind.BindConn(udp); err != nil {
+		return nil, fmt.Errorf("binding the test socket: %w", err)
+	}
+	tos, err := SetProbeTOS(udp, r.DSCP<<2)
+	if err != nil {
+		return nil, fmt.Errorf("setting DSCP %d: %w", r.DSCP, err)
+	}
+	result := &TwampResult{
+		Server: r.Host,
+		Local:  udp.LocalAddr().String(),
+		Remote: udp.RemoteAddr().String(),
+		Dial:   session.Dial,
+		DSCP:   tos >> 2,
+	}
+	logf(ctx, "TWAMP test created, remote: %s, local: %s", result.Remote, result.Local)
+
+	result.StartedAt = time.Now()
+	probes, err := test.RunMultiple(uint64(r.Count), func(reply *twamp.TwampResults) {
+		if r.OnReply != nil {
+			r.OnReply(newTwampReply(result.StartedAt, reply))
+		}
+	}, r.Interval, nil)
+	if ctx.Err() != nil {
+		logf(ctx, "TWAMP: Test canceled: %v", context.Cause(ctx))
+		return nil, canceledError(ctx)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Test run failed: %w", err)
+	}
+	result.Sent = int(probes.Stat.Transmitted)
+	result.Duplicates = int(probes.Stat.Duplicates)
+	result.LossPercent = probes.Stat.Loss
+	for _, reply := range probes.Results {
+		result.Replies = append(result.Replies, newTwampReply(result.StartedAt, reply))
+	}
+	summarizeTwamp(result)
+	return result, nil
+}
+
+func newTwampReply(start time.Time, r *twamp.TwampResults) TwampReply {
+	sent := r.SentTimestamp
+	if sent.IsZero() {
+		sent = r.SenderTimestamp
+	}
+	return TwampReply{
+		Seq:         r.SenderSeqNum,
+		SentAt:      sent,
+		Timing:      ComputeProbeTiming(start, r),
+		SenderTTL:   int(r.SenderTTL),
+		ReceivedTTL: r.ReceivedTTL,
+		Duplicate:   r.IsDuplicate,
+	}
+}
+
+// summarizeTwamp derives the counts and round trip statistics of a result
+// from its replies
+func summarizeTwamp(result *TwampResult) {
+	var rtts []float64
+	for _, reply := range result.Replies {
+		if reply.Duplicate {
+			continue
+		}
+		result.Received++
+		if reply.Timing.Stepped() {
+			result.ClockSteps++
+			continue
+		}
+		rtts = append(rtts, float64(reply.Timing.NetworkRTT.Nanoseconds())/1e6)
+	}
+	if len(rtts) == 0 {
+		return
+	}
+	result.RTTMinMs, result.RTTMaxMs = rtts[0], rtts[0]
+	var w stats.Welford
+	var diffs float64
+	for i, rtt := range rtts {
+		w.Add(rtt)
+		result.RTTMinMs = math.Min(result.RTTMinMs, rtt)
+		result.RTTMaxMs = math.Max(result.RTTMaxMs, rtt)
+		if i > 0 {
+			diffs += math.Abs(rtt - rtts[i-1])
+		}
+	}
+	result.RTTAvgMs, result.RTTStdDevMs = w.Mean(), w.SampleStdDev()
+	result.RTTMedianMs, result.RTTMADMs = stats.Median(rtts), stats.MAD(rtts)
+	if len(rtts) > 1 {
+		result.JitterMs = diffs / float64(len(rtts)-1)
+	}
+}
@@ -0,0 +1,77 @@
+package nettest
+
+import (
+	"time"
+
+	"github.com/tcaine/twamp"
+
+	"network-test-api/pkg/twampstats"
+)
+
+// Wall-clock vs monotonic divergence beyond which a clock step is assumed
+const ClockStepThreshold = twampstats.ClockStepThreshold
+
+// ProbeTiming separates the clock domains that contribute to a single TWAMP probe:
+//
+//	T1 (sent) and T4 (finished) come from the sender, T2 (received) and T3 (reflected) from the reflector.
+//
+// One-way values mix both wall clocks and are only meaningful while neither clock steps.
+// RTT is taken from the sender's monotonic clock, so it is immune to local NTP steps.
+type ProbeTiming struct {
+	RawForward time.Duration // T2 - T1 (wall clocks, includes clock offset)
+	RawReverse time.Duration // T4 - T3 (wall clocks, includes clock offset)
+	Turnaround time.Duration // T3 - T2 (reflector clock only)
+	RTT        time.Duration // T4 - T1 (sender monotonic clock)
+	NetworkRTT time.Duration // RTT - Turnaround
+
+	// Sender wall-clock minus monotonic elapsed time since the test started, at T1 and T4.
+	// A change between the two is a local clock step during the probe; a change relative
+	// to the previous probe is a step between probes.
+	SendSkew    time.Duration
+	ReceiveSkew time.Duration
+
+	SenderStep    bool // Local clock stepped while the probe was in flight
+	ReflectorStep bool // Reflector timestamps are inconsistent (T3 < T2 or turnaround exceeds RTT)
+}
+
+// Stepped reports whether any wall-clock-derived value of the probe is unreliable
+func (p ProbeTiming) Stepped() bool {
+	return p.SenderStep || p.ReflectorStep
+}
+
+// wallMonoSkew returns how far the wall clock has drifted from the monotonic clock since start
+func wallMonoSkew(start, t time.Time) time.Duration {
+	return t.Round(0).Sub(start.Round(0)) - t.Sub(start)
+}
+
+// ComputeProbeTiming derives the per-probe delays for a reflected TWAMP packet.
+// start must be a time.Now() reading (with monotonic component) taken before the first probe was sent.
+func ComputeProbeTiming(start time.Time, r *twamp.TwampResults) ProbeTiming {
+	p := ProbeTiming{
+		RawForward: r.ReceiveTimestamp.Sub(r.SenderTimestamp),
+		RawReverse: r.FinishedTimestamp.Sub(r.Timestamp),
+		Turnaround: r.Timestamp.Sub(r.ReceiveTimestamp),
+	}
+
+	sent := r.SentTimestamp
+	if sent.IsZero() {
+		// No local send time recorded, fall back to the wall-clock T1 echoed by the reflector
+		sent = r.SenderTimestamp
+	}
+	p.RTT = r.FinishedTimestamp.Sub(sent)
+	p.NetworkRTT = p.RTT - p.Turnaround
+
+	p.SendSkew = wallMonoSkew(start, sent)
+	p.ReceiveSkew = wallMonoSkew(start, r.FinishedTimestamp)
+	p.SenderStep = absDuration(p.ReceiveSkew-p.SendSkew) > ClockStepThreshold
+	p.ReflectorStep = p.Turnaround < 0 || p.Turnaround > p.RTT
+
+	return p
+}
+
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
@@ -0,0 +1,86 @@
+//go:build linux
+
+package nettest
+
+import (
+	"errors"
+	"io"
+	"net"
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+const ZeroCopySupported = true
+
+// zeroCopySender sends a stream's block from an unlinked temporary file with
+// sendfile, like iperf3 -Z, so the kernel reads it from the page cache instead
+// of copying it from user space on every write
+type zeroCopySender struct {
+	raw    syscall.RawConn
+	file   *os.File
+	fd     int
+	size   int64
+	offset int64 // Of the write in progress, advanced by sendfile
+	err    error
+	write  func(fd uintptr) bool // s.sendfile, bound once so Send does not allocate
+}
+
+// newZeroCopySender writes block to a file for sending on conn, which must
+// have a socket of its own
+func newZeroCopySender(conn net.Conn, block []byte) (*zeroCopySender, error) {
+	sc, ok := conn.(syscall.Conn)
+	if !ok {
+		return nil, errors.New("connection has no socket")
+	}
+	raw, err := sc.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.CreateTemp("", "nettest-zerocopy-")
+	if err != nil {
+		return nil, err
+	}
+	_ = os.Remove(f.Name()) // Freed once the file is closed
+	if _, err := f.Write(block); err != nil {
+		f.Close()
+		return nil, err
+	}
+	s := &zeroCopySender{raw: raw, file: f, fd: int(f.Fd()), size: int64(len(block))}
+	s.write = s.sendfile
+	return s, nil
+}
+
+// sendfile sends what is left of the block, returning false to wait for the
+// socket to take more
+func (s *zeroCopySender) sendfile(fd uintptr) bool {
+	for s.offset < s.size {
+		n, err := unix.Sendfile(int(fd), s.fd, &s.offset, int(s.size-s.offset))
+		switch {
+		case err == unix.EAGAIN:
+			return false
+		case err == unix.EINTR:
+		case err != nil:
+			s.err = err
+			return true
+		case n == 0:
+			s.err = io.ErrUnexpectedEOF // The file was truncated
+			return true
+		}
+	}
+	return true
+}
+
+// Send writes the block once, stopping at the connection's write deadline
+func (s *zeroCopySender) Send() (int, error) {
+	s.offset, s.err = 0, nil
+	if err := s.raw.Write(s.write); err != nil {
+		return int(s.offset), err
+	}
+	return int(s.offset), s.err
+}
+
+func (s *zeroCopySender) Close() error {
+	return s.file.Close()
+}
@@ -0,0 +1,25 @@
+//go:build !linux
+
+package nettest
+
+import (
+	"errors"
+	"net"
+)
+
+// sendfile is only used on Linux; elsewhere requests with zerocopy set are
+// rejected and the library falls back to plain writes.
+
+const ZeroCopySupported = false
+
+type zeroCopySender struct{}
+
+func newZeroCopySender(conn net.Conn, block []byte) (*zeroCopySender, error) {
+	return nil, errors.New("zero-copy sending is only available on Linux")
+}
+
+func (s *zeroCopySender) Send() (int, error) {
+	return 0, errors.ErrUnsupported
+}
+
+func (s *zeroCopySender) Close() error { return nil }
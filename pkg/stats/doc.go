@@ -0,0 +1,6 @@
+// Package stats holds the measurement analysis of the network test API that
+// needs no connection: summary statistics, the single-flow TCP throughput
+// models, loss counting by sequence number and the delay and dispersion
+// analysis of TWAMP probe trains. Other tools can import it to analyse their
+// own samples the way the API does.
+package stats
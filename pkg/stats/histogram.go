@@ -0,0 +1,58 @@
+package stats
+
+import (
+	"math"
+	"sort"
+)
+
+// Percentiles are the tail percentiles latency SLAs are written against
+type Percentiles struct {
+	P50  float64 `json:"p50"`
+	P90  float64 `json:"p90"`
+	P95  float64 `json:"p95"`
+	P99  float64 `json:"p99"`
+	P999 float64 `json:"p99_9"`
+}
+
+// TailPercentiles computes the percentiles of sorted values
+func TailPercentiles(sorted []float64) Percentiles {
+	return Percentiles{
+		P50:  Percentile(sorted, 50),
+		P90:  Percentile(sorted, 90),
+		P95:  Percentile(sorted, 95),
+		P99:  Percentile(sorted, 99),
+		P999: Percentile(sorted, 99.9),
+	}
+}
+
+// HistogramBucket counts the samples from Lower up to Lower plus the bucket width
+type HistogramBucket struct {
+	Lower float64 `json:"lower"`
+	Count int     `json:"count"`
+}
+
+// Histogram is a sparse fixed-width histogram: only buckets holding samples
+// are listed, in ascending order
+type Histogram struct {
+	BucketWidth float64           `json:"bucket_width"`
+	Buckets     []HistogramBucket `json:"buckets"`
+}
+
+// NewHistogram bins values into buckets of width, aligned to multiples of it
+func NewHistogram(values []float64, width float64) *Histogram {
+	counts := make(map[int64]int)
+	for _, v := range values {
+		counts[int64(math.Floor(v/width))]++
+	}
+	bins := make([]int64, 0, len(counts))
+	for bin := range counts {
+		bins = append(bins, bin)
+	}
+	sort.Slice(bins, func(i, j int) bool { return bins[i] < bins[j] })
+
+	h := &Histogram{BucketWidth: width, Buckets: make([]HistogramBucket, len(bins))}
+	for i, bin := range bins {
+		h.Buckets[i] = HistogramBucket{Lower: float64(bin) * width, Count: counts[bin]}
+	}
+	return h
+}
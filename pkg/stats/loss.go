@@ -0,0 +1,201 @@
+package stats
+
+import "sort"
+
+// LossCounter tracks replies by sequence number in a bitmap, so memory stays
+// at one bit per packet regardless of rate
+type LossCounter struct {
+	seen       []uint64
+	count      uint32
+	received   uint64
+	duplicates uint64
+	reordered  uint64 // Replies arriving after a higher sequence number (RFC 4737)
+	maxSeq     int64  // Highest sequence number received so far (-1 = none)
+	distances  map[uint32]uint64
+}
+
+// NewLossCounter counts replies to sequence numbers 0 to count-1
+func NewLossCounter(count int) *LossCounter {
+	return &LossCounter{seen: make([]uint64, (count+63)/64), count: uint32(count), maxSeq: -1, distances: make(map[uint32]uint64)}
+}
+
+// Observe records a reply; sequence numbers outside the test are ignored
+func (c *LossCounter) Observe(seq uint32) {
+	if seq >= c.count {
+		return
+	}
+	word, bit := seq/64, uint64(1)<<(seq%64)
+	if c.seen[word]&bit != 0 {
+		c.duplicates++
+		return
+	}
+	c.seen[word] |= bit
+	c.received++
+	if int64(seq) < c.maxSeq {
+		c.reordered++
+		c.distances[uint32(c.maxSeq)-seq]++
+	} else {
+		c.maxSeq = int64(seq)
+	}
+}
+
+// Complete reports whether every sequence number has been answered
+func (c *LossCounter) Complete() bool {
+	return c.received == uint64(c.count)
+}
+
+// Received is the number of distinct sequence numbers answered
+func (c *LossCounter) Received() uint64 {
+	return c.received
+}
+
+// Duplicates is the number of replies to sequence numbers already answered
+func (c *LossCounter) Duplicates() uint64 {
+	return c.duplicates
+}
+
+// Reordered is the number of replies after one with a higher sequence number
+func (c *LossCounter) Reordered() uint64 {
+	return c.reordered
+}
+
+// ReorderDistance counts the reordered packets that arrived Distance sequence
+// numbers behind the highest one received before them
+type ReorderDistance struct {
+	Distance int    `json:"distance"`
+	Count    uint64 `json:"count"`
+}
+
+// Reordering is the distribution of reordering distances. Without loss the
+// distance of a packet is its RFC 4737 reordering extent, the number of
+// packets that overtook it.
+type Reordering struct {
+	MaxDistance int               `json:"max_distance"`
+	Distances   []ReorderDistance `json:"distances"` // Ascending, distances seen only
+}
+
+// Reordering returns the distances the reordered replies arrived at
+func (c *LossCounter) Reordering() Reordering {
+	r := Reordering{Distances: make([]ReorderDistance, 0, len(c.distances))}
+	for d, n := range c.distances {
+		r.Distances = append(r.Distances, ReorderDistance{Distance: int(d), Count: n})
+		if int(d) > r.MaxDistance {
+			r.MaxDistance = int(d)
+		}
+	}
+	sort.Slice(r.Distances, func(i, j int) bool { return r.Distances[i].Distance < r.Distances[j].Distance })
+	return r
+}
+
+// BurstGapMin is the Gmin of RFC 3611: this many packets received in a row
+// end a loss burst
+const BurstGapMin = 16
+
+// LossBursts describes runs of consecutive lost packets and the loss pattern
+// they form
+type LossBursts struct {
+	Count      int     `json:"count"`       // Runs of consecutive lost packets, the loss episodes
+	MaxLength  int     `json:"max_length"`  // Longest run
+	MeanLength float64 `json:"mean_length"` // Lost packets per run
+	// Mean run length over that of random loss at the same rate (ITU-T G.113
+	// Appendix I): 1 for random loss, above 1 for bursty loss, 0 without loss
+	// or when every packet was lost
+	BurstRatio     float64        `json:"burst_ratio"`
+	GilbertElliott GilbertElliott `json:"gilbert_elliott"`
+}
+
+// GilbertElliott is the two-state loss model fitted to a loss pattern by the
+// burst and gap split of RFC 3611 section 4.7.2. A burst runs from a loss to
+// a loss with fewer than BurstGapMin packets received between any two and
+// holds at least two losses; the packets outside bursts form the gaps, whose
+// losses are isolated. Without bursts everything is the good state.
+type GilbertElliott struct {
+	P        float64 `json:"p"`         // Per packet probability of moving from the good (gap) to the bad (burst) state
+	R        float64 `json:"r"`         // Per packet probability of moving from the bad to the good state
+	LossGood float64 `json:"loss_good"` // Loss probability in the good state (1-k), the gap density
+	LossBad  float64 `json:"loss_bad"`  // Loss probability in the bad state (1-h), the burst density
+	Bursts   int     `json:"bursts"`
+}
+
+// lossPattern splits a loss pattern into bursts and gaps as it is scanned
+type lossPattern struct {
+	bursts, burstPackets, burstLosses, gapLosses int
+
+	open            bool   // A burst candidate is open
+	start, last     uint32 // Its first and latest loss
+	candidateLosses int
+}
+
+// lost adds the loss of seq
+func (p *lossPattern) lost(seq uint32) {
+	if p.open && int(seq-p.last)-1 < BurstGapMin {
+		p.last = seq
+		p.candidateLosses++
+		return
+	}
+	p.close()
+	p.open, p.start, p.last, p.candidateLosses = true, seq, seq, 1
+}
+
+// close ends the burst candidate, a gap's isolated loss unless it lost two
+func (p *lossPattern) close() {
+	if !p.open {
+		return
+	}
+	if p.candidateLosses >= 2 {
+		p.bursts++
+		p.burstPackets += int(p.last-p.start) + 1
+		p.burstLosses += p.candidateLosses
+	} else {
+		p.gapLosses += p.candidateLosses
+	}
+	p.open = false
+}
+
+// model fits the Gilbert-Elliott parameters to a pattern of sent packets
+func (p *lossPattern) model(sent uint32) GilbertElliott {
+	p.close()
+	m := GilbertElliott{Bursts: p.bursts}
+	if gap := int(sent) - p.burstPackets; gap > 0 {
+		m.LossGood = float64(p.gapLosses) / float64(gap)
+		m.P = float64(p.bursts) / float64(gap)
+	}
+	if p.burstPackets > 0 {
+		m.LossBad = float64(p.burstLosses) / float64(p.burstPackets)
+		m.R = float64(p.bursts) / float64(p.burstPackets)
+	}
+	return m
+}
+
+// Bursts scans the first sent sequence numbers for runs of missing replies
+// and fits the loss model to them
+func (c *LossCounter) Bursts(sent uint32) LossBursts {
+	var b LossBursts
+	var pattern lossPattern
+	run, lost := 0, 0
+	for seq := uint32(0); seq < sent; seq++ {
+		if c.seen[seq/64]&(uint64(1)<<(seq%64)) != 0 {
+			run = 0
+			continue
+		}
+		if run == 0 {
+			b.Count++
+		}
+		run++
+		lost++
+		if run > b.MaxLength {
+			b.MaxLength = run
+		}
+		pattern.lost(seq)
+	}
+	b.GilbertElliott = pattern.model(sent)
+	if b.Count == 0 {
+		return b
+	}
+	b.MeanLength = float64(lost) / float64(b.Count)
+	// Runs of random loss at rate l average 1/(1-l) packets
+	if rate := float64(lost) / float64(sent); rate < 1 {
+		b.BurstRatio = b.MeanLength * (1 - rate)
+	}
+	return b
+}
@@ -0,0 +1,71 @@
+package stats
+
+import (
+	"math"
+	"sort"
+)
+
+// Welford accumulates the mean and variance of samples in one pass with
+// Welford's online algorithm, which unlike E[X²] - E[X]² loses no precision
+// when the spread is small against the values, such as delays of a few
+// microseconds around milliseconds counted in nanoseconds
+type Welford struct {
+	n    int
+	mean float64
+	m2   float64 // Sum of squared differences from the current mean
+}
+
+// Add adds a sample
+func (w *Welford) Add(x float64) {
+	w.n++
+	delta := x - w.mean
+	w.mean += delta / float64(w.n)
+	w.m2 += delta * (x - w.mean)
+}
+
+// Count returns the number of samples
+func (w *Welford) Count() int { return w.n }
+
+// Mean returns the mean of the samples, 0 without any
+func (w *Welford) Mean() float64 { return w.mean }
+
+// Variance returns the population variance of the samples
+func (w *Welford) Variance() float64 {
+	if w.n == 0 {
+		return 0
+	}
+	return w.m2 / float64(w.n)
+}
+
+// SampleVariance returns the sample variance, with Bessel's correction, of at
+// least two samples, otherwise 0
+func (w *Welford) SampleVariance() float64 {
+	if w.n < 2 {
+		return 0
+	}
+	return w.m2 / float64(w.n-1)
+}
+
+// StdDev returns the population standard deviation of the samples
+func (w *Welford) StdDev() float64 { return math.Sqrt(w.Variance()) }
+
+// SampleStdDev returns the sample standard deviation of the samples
+func (w *Welford) SampleStdDev() float64 { return math.Sqrt(w.SampleVariance()) }
+
+// Median returns the median of values, which it leaves unsorted, 0 without any
+func Median(values []float64) float64 {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	return Percentile(sorted, 50)
+}
+
+// MAD returns the median absolute deviation of values from their median, a
+// spread that, unlike the standard deviation, a few outliers barely move
+func MAD(values []float64) float64 {
+	median := Median(values)
+	deviations := make([]float64, len(values))
+	for i, v := range values {
+		deviations[i] = math.Abs(v - median)
+	}
+	return Median(deviations)
+}
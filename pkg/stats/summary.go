@@ -0,0 +1,52 @@
+package stats
+
+import (
+	"math"
+	"sort"
+)
+
+// Summary summarises one metric's samples
+type Summary struct {
+	Count  int     `json:"count"`
+	Mean   float64 `json:"mean"`
+	Min    float64 `json:"min"`
+	Max    float64 `json:"max"`
+	StdDev float64 `json:"stddev"`
+	MAD    float64 `json:"mad"` // Median absolute deviation from P50
+	P50    float64 `json:"p50"`
+	P90    float64 `json:"p90"`
+	P95    float64 `json:"p95"`
+	P99    float64 `json:"p99"`
+}
+
+// Percentile interpolates linearly between the closest ranks of sorted values
+func Percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := p / 100 * float64(len(sorted)-1)
+	lo := int(math.Floor(rank))
+	hi := int(math.Ceil(rank))
+	return sorted[lo] + (sorted[hi]-sorted[lo])*(rank-float64(lo))
+}
+
+// Summarize computes the summary statistics of at least one sample
+func Summarize(values []float64) *Summary {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+
+	a := &Summary{Count: len(sorted), Min: sorted[0], Max: sorted[len(sorted)-1]}
+	var w Welford
+	for _, v := range sorted {
+		w.Add(v)
+	}
+	a.Mean = w.Mean()
+	a.StdDev = w.StdDev()
+	a.MAD = MAD(sorted)
+
+	a.P50 = Percentile(sorted, 50)
+	a.P90 = Percentile(sorted, 90)
+	a.P95 = Percentile(sorted, 95)
+	a.P99 = Percentile(sorted, 99)
+	return a
+}
@@ -0,0 +1,44 @@
+package stats
+
+import (
+	"math"
+	"time"
+)
+
+// Single-flow TCP throughput from RTT and loss, with the Mathis (steady-state
+// congestion avoidance) and Padhye (with timeouts) models
+const (
+	MATHIS_C           = 1.22 // sqrt(3/2), periodic loss with ACK-every-segment
+	PADHYE_ACKED       = 2    // Segments per ACK with delayed ACKs
+	TCP_MIN_RTO        = 200 * time.Millisecond
+	TCP_RTO_RTT_STDDEV = 4 // RTO = SRTT + 4 * RTTVAR (RFC 6298)
+)
+
+// MathisMbps is the Mathis et al. throughput for segment size mss in bytes, rtt and loss probability p
+func MathisMbps(mss int, rtt time.Duration, p float64) float64 {
+	if rtt <= 0 || p <= 0 {
+		return 0
+	}
+	return float64(mss*8) / rtt.Seconds() * MATHIS_C / math.Sqrt(p) / 1e6
+}
+
+// PadhyeMbps is the Padhye et al. approximation, which adds retransmission
+// timeouts and dominates Mathis at high loss
+func PadhyeMbps(mss int, rtt, rto time.Duration, p float64) float64 {
+	if rtt <= 0 || p <= 0 {
+		return 0
+	}
+	b := float64(PADHYE_ACKED)
+	denom := rtt.Seconds()*math.Sqrt(2*b*p/3) +
+		rto.Seconds()*math.Min(1, 3*math.Sqrt(3*b*p/8))*p*(1+32*p*p)
+	return float64(mss*8) / denom / 1e6
+}
+
+// TCPRTO estimates the retransmission timeout from an RTT distribution
+func TCPRTO(rtt, stddev time.Duration) time.Duration {
+	rto := rtt + TCP_RTO_RTT_STDDEV*stddev
+	if rto < TCP_MIN_RTO {
+		rto = TCP_MIN_RTO
+	}
+	return rto
+}
@@ -0,0 +1,73 @@
+package stats
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// DispersionMbps converts the dispersion of a train of trainLength packets of
+// packetBytes to a capacity sample in Mbit/s
+func DispersionMbps(trainLength, packetBytes int, dispersion time.Duration) float64 {
+	if dispersion <= 0 {
+		return 0
+	}
+	return float64((trainLength-1)*packetBytes*8) / dispersion.Seconds() / 1e6
+}
+
+// CapacityMode bins samples by binWidth relative width and returns the median
+// of the fullest bin (ties go to the higher capacity) with the number of
+// samples in it
+func CapacityMode(samples []float64, binWidth float64) (float64, int) {
+	bins := make(map[int][]float64)
+	for _, s := range samples {
+		if s <= 0 {
+			continue
+		}
+		bin := int(math.Floor(math.Log(s) / math.Log1p(binWidth)))
+		bins[bin] = append(bins[bin], s)
+	}
+	best, bestN := 0, 0
+	for bin, members := range bins {
+		if len(members) > bestN || (len(members) == bestN && bin > best) {
+			best, bestN = bin, len(members)
+		}
+	}
+	if bestN == 0 {
+		return 0, 0
+	}
+	members := bins[best]
+	sort.Float64s(members)
+	return Percentile(members, 50), bestN
+}
+
+// DelayTrend runs the PCT and PDT tests over one-way delays split into
+// sqrt(n) groups, comparing group medians to be robust against outliers
+func DelayTrend(owd []float64) (pct, pdt, increase float64) {
+	groups := int(math.Sqrt(float64(len(owd))))
+	if groups < 2 {
+		return 0, 0, 0
+	}
+	size := len(owd) / groups
+	medians := make([]float64, groups)
+	for g := range medians {
+		group := append([]float64(nil), owd[g*size:(g+1)*size]...)
+		sort.Float64s(group)
+		medians[g] = Percentile(group, 50)
+	}
+
+	var rising int
+	var absSum float64
+	for g := 1; g < groups; g++ {
+		if medians[g] > medians[g-1] {
+			rising++
+		}
+		absSum += math.Abs(medians[g] - medians[g-1])
+	}
+	pct = float64(rising) / float64(groups-1)
+	increase = medians[groups-1] - medians[0]
+	if absSum > 0 {
+		pdt = increase / absSum
+	}
+	return pct, pdt, increase
+}
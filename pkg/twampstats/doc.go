@@ -0,0 +1,8 @@
+// Package twampstats holds the per-packet math of full mode TWAMP tests: the
+// one-way delays raw and corrected for the clock offset, the reflector's
+// turnaround, network round trips, RFC 3393 IPDV, RFC 3550 jitter and hop
+// counts from TTLs, leaving out the probes during which a clock stepped.
+// ProcessResults turns the probes of a test into their Summary; it needs no
+// connection, so other tools can summarise their own timestamps the way the
+// API does.
+package twampstats
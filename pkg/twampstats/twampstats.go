@@ -0,0 +1,335 @@
+package twampstats
+
+import (
+	"math"
+	"time"
+
+	"network-test-api/pkg/stats"
+)
+
+// Wall-clock vs monotonic divergence beyond which a clock step is assumed.
+// NTP slewing at the 500 ppm kernel limit contributes well under this over a probe's lifetime.
+const ClockStepThreshold = time.Millisecond
+
+// TTL the sender's probes leave with, the start of the forward hop count
+const SENDER_TTL = 255
+
+// PacketResult is one probe of a test. One-way values mix both wall clocks
+// and are only meaningful while neither clock steps; NetworkRTT comes from
+// the sender's monotonic clock.
+type PacketResult struct {
+	Seq  uint32
+	Lost bool // No reply came back
+
+	RawForward time.Duration // T2 - T1 (wall clocks, includes clock offset)
+	RawReverse time.Duration // T4 - T3 (wall clocks, includes clock offset)
+	Turnaround time.Duration // T3 - T2 (reflector clock only)
+	NetworkRTT time.Duration // T4 - T1 on the sender's monotonic clock, less Turnaround
+
+	// Sender wall-clock minus monotonic elapsed time since the test started, at T1 and T4
+	SendSkew    time.Duration
+	ReceiveSkew time.Duration
+
+	SenderStep    bool // Local clock stepped while the probe was in flight
+	ReflectorStep bool // Reflector timestamps are inconsistent
+
+	SenderTTL   int // TTL of the probe as the reflector received it, 0 if unknown
+	ReceivedTTL int // TTL of the reply, 0 if unknown
+}
+
+// Stepped reports whether any wall-clock-derived value of the probe is unreliable
+func (p PacketResult) Stepped() bool {
+	return p.SenderStep || p.ReflectorStep
+}
+
+// Usable reports whether the probe came back with delays the statistics count
+func (p PacketResult) Usable() bool {
+	return !p.Lost && !p.Stepped()
+}
+
+// DelayStats are the minimum, maximum, mean, median and median absolute
+// deviation of a delay
+type DelayStats struct {
+	Min    time.Duration
+	Max    time.Duration
+	Avg    time.Duration
+	Median time.Duration
+	MAD    time.Duration // Median absolute deviation from Median
+}
+
+// IPDVStats summarise the delay variation between consecutive probes (RFC 3393)
+type IPDVStats struct {
+	Min     time.Duration
+	Max     time.Duration
+	Avg     time.Duration // Can be negative
+	MeanAbs time.Duration // Mean absolute IPDV
+}
+
+// HopStats summarise the hop counts of the probes that reported a TTL
+type HopStats struct {
+	Min int
+	Max int
+	Avg float64
+}
+
+// Summary is the outcome of ProcessResults. Delays, IPDV and jitter are over
+// the usable probes; hop counts over all that came back.
+type Summary struct {
+	Received  int // Probes that came back
+	Usable    int // Of those, the ones during which neither clock stepped
+	IPDVPairs int // Consecutive usable probes without a clock step between them
+
+	NetworkRTT       DelayStats    // (T4-T1) - (T3-T2): the network round trip without the reflector's processing
+	NetworkRTTStdDev time.Duration // Population standard deviation, by Welford's algorithm
+	ForwardRaw       DelayStats
+	ReverseRaw       DelayStats
+	ForwardCorrected DelayStats    // Per-probe clock offset taken out: half the round trip
+	ReverseCorrected DelayStats    // Likewise
+	Turnaround       DelayStats    // The reflector's processing time
+	ClockOffset      time.Duration // Mean per-probe offset of the reflector's clock, (raw forward - raw reverse) / 2
+
+	ForwardIPDV   IPDVStats
+	ReverseIPDV   IPDVStats
+	ForwardJitter float64 // RFC 3550 jitter in nanoseconds
+	ReverseJitter float64
+
+	ForwardHops HopStats // SENDER_TTL - SenderTTL
+	ReverseHops HopStats // Estimated initial TTL - ReceivedTTL
+
+	SenderStepProbes    int
+	ReflectorStepProbes int
+	ExcludedProbes      int           // Probes left out because a clock stepped
+	MaxClockStep        time.Duration // Largest step seen, during or between probes
+}
+
+// ProcessResults summarises the probes of a test in the order they were sent
+func ProcessResults(results []PacketResult) Summary {
+	var s Summary
+	var fwdRaw, revRaw, fwdCorr, revCorr, turnaround, rtt delayAcc
+	var fwdIPDV, revIPDV ipdvAcc
+	var fwdHops, revHops hopAcc
+	var offsetTotal time.Duration
+	var rttVariance stats.Welford
+
+	var prevFwd, prevRev, prevReceiveSkew time.Duration
+	havePrev := false // Whether prevFwd/prevRev belong to the directly preceding usable probe
+
+	for _, p := range results {
+		if p.Lost {
+			continue
+		}
+		s.Received++
+		if hops := ForwardHops(p.SenderTTL); hops >= 0 {
+			fwdHops.add(hops)
+		}
+		if hops := ReverseHops(p.ReceivedTTL); hops >= 0 {
+			revHops.add(hops)
+		}
+
+		// Skip probes whose wall-clock timestamps straddle a clock step
+		if p.Stepped() {
+			if p.SenderStep {
+				s.SenderStepProbes++
+				s.MaxClockStep = max(s.MaxClockStep, absDuration(p.ReceiveSkew-p.SendSkew))
+			}
+			if p.ReflectorStep {
+				s.ReflectorStepProbes++
+			}
+			s.ExcludedProbes++
+			havePrev = false
+			prevReceiveSkew = p.ReceiveSkew
+			continue
+		}
+
+		// A step between two probes shifts the raw one-way delays, so IPDV must not span it
+		if havePrev {
+			if step := absDuration(p.SendSkew - prevReceiveSkew); step > ClockStepThreshold {
+				s.MaxClockStep = max(s.MaxClockStep, step)
+				havePrev = false
+			}
+		}
+		prevReceiveSkew = p.ReceiveSkew
+
+		// IPDV of consecutive probes, in which the clock offset cancels out
+		if havePrev {
+			fwdIPDV.add(p.RawForward - prevFwd) // (T2[i]-T1[i]) - (T2[i-1]-T1[i-1])
+			revIPDV.add(p.RawReverse - prevRev) // (T4[i]-T3[i]) - (T4[i-1]-T3[i-1])
+			s.IPDVPairs++
+		}
+		prevFwd, prevRev, havePrev = p.RawForward, p.RawReverse, true
+
+		// Per-packet offset correction (removes clock drift from jitter)
+		offset := (p.RawForward - p.RawReverse) / 2
+		fwdRaw.add(p.RawForward)
+		revRaw.add(p.RawReverse)
+		fwdCorr.add(p.RawForward - offset) // = (rawFwd + rawRev) / 2 = RTT / 2
+		revCorr.add(p.RawReverse + offset)
+		turnaround.add(p.Turnaround)
+		rtt.add(p.NetworkRTT)
+		offsetTotal += offset
+		rttVariance.Add(float64(p.NetworkRTT.Nanoseconds()))
+		s.Usable++
+	}
+
+	s.NetworkRTT = rtt.stats()
+	s.ForwardRaw = fwdRaw.stats()
+	s.ReverseRaw = revRaw.stats()
+	s.ForwardCorrected = fwdCorr.stats()
+	s.ReverseCorrected = revCorr.stats()
+	s.Turnaround = turnaround.stats()
+	if s.Usable > 0 {
+		s.ClockOffset = offsetTotal / time.Duration(s.Usable)
+		s.NetworkRTTStdDev = time.Duration(rttVariance.StdDev())
+	}
+	s.ForwardIPDV, s.ForwardJitter = fwdIPDV.stats(), fwdIPDV.jitter
+	s.ReverseIPDV, s.ReverseJitter = revIPDV.stats(), revIPDV.jitter
+	s.ForwardHops = fwdHops.stats()
+	s.ReverseHops = revHops.stats()
+	return s
+}
+
+// IPDV returns the delay variation of consecutive one-way delays (RFC 3393):
+// IPDV(i) = D(i) - D(i-1)
+func IPDV(delays []time.Duration) []time.Duration {
+	if len(delays) < 2 {
+		return nil
+	}
+	ipdv := make([]time.Duration, len(delays)-1)
+	for i := 1; i < len(delays); i++ {
+		ipdv[i-1] = delays[i] - delays[i-1]
+	}
+	return ipdv
+}
+
+// Jitter returns the RFC 3550 jitter of a sequence of IPDVs in nanoseconds,
+// the exponentially smoothed mean absolute IPDV
+func Jitter(ipdv []time.Duration) float64 {
+	var j float64
+	for _, d := range ipdv {
+		j = smoothJitter(j, d)
+	}
+	return j
+}
+
+// smoothJitter adds an IPDV to an RFC 3550 jitter: J = J + (|D| - J) / 16
+func smoothJitter(j float64, d time.Duration) float64 {
+	return j + (math.Abs(float64(d.Nanoseconds()))-j)/16.0
+}
+
+// ForwardHops returns the hops a probe took to the reflector from the TTL it
+// arrived with, or -1 for a TTL out of range
+func ForwardHops(senderTTL int) int {
+	if senderTTL <= 0 || senderTTL > SENDER_TTL {
+		return -1
+	}
+	return SENDER_TTL - senderTTL
+}
+
+// ReverseHops returns the hops a reply took back from the TTL it arrived
+// with, or -1 for a TTL out of range
+func ReverseHops(receivedTTL int) int {
+	if receivedTTL <= 0 || receivedTTL > 255 {
+		return -1
+	}
+	return InitialTTL(receivedTTL) - receivedTTL
+}
+
+// InitialTTL estimates the TTL a reply was sent with from the one it arrived
+// with: the common initial TTLs are 64 (Linux), 128 (Windows) and 255
+// (Cisco and other network devices)
+func InitialTTL(receivedTTL int) int {
+	switch {
+	case receivedTTL > 128:
+		return 255
+	case receivedTTL > 64:
+		return 128
+	}
+	return 64
+}
+
+// delayAcc accumulates a DelayStats
+type delayAcc struct {
+	min, max, total time.Duration
+	n               int
+	values          []float64 // Nanoseconds, for the median and MAD
+}
+
+func (a *delayAcc) add(d time.Duration) {
+	if a.n == 0 || d < a.min {
+		a.min = d
+	}
+	if a.n == 0 || d > a.max {
+		a.max = d
+	}
+	a.total += d
+	a.n++
+	a.values = append(a.values, float64(d))
+}
+
+func (a *delayAcc) stats() DelayStats {
+	if a.n == 0 {
+		return DelayStats{}
+	}
+	return DelayStats{
+		Min:    a.min,
+		Max:    a.max,
+		Avg:    a.total / time.Duration(a.n),
+		Median: time.Duration(math.Round(stats.Median(a.values))),
+		MAD:    time.Duration(math.Round(stats.MAD(a.values))),
+	}
+}
+
+// ipdvAcc accumulates an IPDVStats and the RFC 3550 jitter of the same IPDVs
+type ipdvAcc struct {
+	delay    delayAcc
+	absTotal time.Duration
+	jitter   float64
+}
+
+func (a *ipdvAcc) add(d time.Duration) {
+	a.delay.add(d)
+	a.absTotal += absDuration(d)
+	a.jitter = smoothJitter(a.jitter, d)
+}
+
+func (a *ipdvAcc) stats() IPDVStats {
+	if a.delay.n == 0 {
+		return IPDVStats{}
+	}
+	return IPDVStats{
+		Min:     a.delay.min,
+		Max:     a.delay.max,
+		Avg:     a.delay.total / time.Duration(a.delay.n),
+		MeanAbs: a.absTotal / time.Duration(a.delay.n),
+	}
+}
+
+// hopAcc accumulates a HopStats
+type hopAcc struct {
+	min, max, total, n int
+}
+
+func (a *hopAcc) add(hops int) {
+	if a.n == 0 || hops < a.min {
+		a.min = hops
+	}
+	if a.n == 0 || hops > a.max {
+		a.max = hops
+	}
+	a.total += hops
+	a.n++
+}
+
+func (a *hopAcc) stats() HopStats {
+	if a.n == 0 {
+		return HopStats{}
+	}
+	return HopStats{Min: a.min, Max: a.max, Avg: float64(a.total) / float64(a.n)}
+}
+
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
@@ -4,60 +4,9 @@ import (
 	"math"
 	"testing"
 	"time"
-)
-
-// RFC 3393 IPDV (IP Packet Delay Variation) calculation
-// IPDV(i) = D(i) - D(i-1) where D is one-way delay
-func calculateIPDV(delays []time.Duration) []time.Duration {
-	if len(delays) < 2 {
-		return nil
-	}
-	ipdv := make([]time.Duration, len(delays)-1)
-	for i := 1; i < len(delays); i++ {
-		ipdv[i-1] = delays[i] - delays[i-1]
-	}
-	return ipdv
-}
-
-// RFC 3550 Jitter: exponentially smoothed mean absolute IPDV
-// J(i) = J(i-1) + (|D(i,i-1)| - J(i-1)) / 16
-func calculateRFC3550Jitter(ipdv []time.Duration) float64 {
-	if len(ipdv) == 0 {
-		return 0
-	}
-	jitter := float64(0)
-	for _, d := range ipdv {
-		absD := math.Abs(float64(d.Nanoseconds()))
-		jitter = jitter + (absD-jitter)/16.0
-	}
-	return jitter
-}
-
-// Calculate hop count from TTL (forward direction)
-// Sender uses TTL=255, forward hops = 255 - SenderTTL
-func calculateForwardHops(senderTTL int) int {
-	if senderTTL <= 0 || senderTTL > 255 {
-		return -1
-	}
-	return 255 - senderTTL
-}
 
-// Calculate hop count from TTL (reverse direction)
-// Estimate initial TTL based on received TTL
-func calculateReverseHops(receivedTTL int) int {
-	if receivedTTL <= 0 {
-		return -1
-	}
-	var initialTTL int
-	if receivedTTL > 128 {
-		initialTTL = 255
-	} else if receivedTTL > 64 {
-		initialTTL = 128
-	} else {
-		initialTTL = 64
-	}
-	return initialTTL - receivedTTL
-}
+	"network-test-api/pkg/twampstats"
+)
 
 func TestCalculateIPDV_BasicSequence(t *testing.T) {
 	delays := []time.Duration{
@@ -67,7 +16,7 @@ func TestCalculateIPDV_BasicSequence(t *testing.T) {
 		15 * time.Millisecond,
 	}
 
-	ipdv := calculateIPDV(delays)
+	ipdv := twampstats.IPDV(delays)
 
 	if len(ipdv) != 3 {
 		t.Fatalf("Expected 3 IPDV values, got %d", len(ipdv))
@@ -87,14 +36,14 @@ func TestCalculateIPDV_BasicSequence(t *testing.T) {
 }
 
 func TestCalculateIPDV_EmptyInput(t *testing.T) {
-	ipdv := calculateIPDV([]time.Duration{})
+	ipdv := twampstats.IPDV([]time.Duration{})
 	if ipdv != nil {
 		t.Errorf("Expected nil for empty input, got %v", ipdv)
 	}
 }
 
 func TestCalculateIPDV_SingleDelay(t *testing.T) {
-	ipdv := calculateIPDV([]time.Duration{10 * time.Millisecond})
+	ipdv := twampstats.IPDV([]time.Duration{10 * time.Millisecond})
 	if ipdv != nil {
 		t.Errorf("Expected nil for single delay, got %v", ipdv)
 	}
@@ -116,8 +65,8 @@ func TestCalculateIPDV_ClockOffsetCancellation(t *testing.T) {
 		rawDelays[i] = d + clockOffset
 	}
 
-	ipdvActual := calculateIPDV(actualDelays)
-	ipdvRaw := calculateIPDV(rawDelays)
+	ipdvActual := twampstats.IPDV(actualDelays)
+	ipdvRaw := twampstats.IPDV(rawDelays)
 
 	// IPDV should be identical - clock offset cancels out!
 	for i := range ipdvActual {
@@ -136,7 +85,7 @@ func TestCalculateRFC3550Jitter_BasicSequence(t *testing.T) {
 		-2 * time.Millisecond,
 	}
 
-	jitter := calculateRFC3550Jitter(ipdv)
+	jitter := twampstats.Jitter(ipdv)
 
 	// Verify jitter is positive (exponentially smoothed absolute IPDV)
 	if jitter <= 0 {
@@ -151,7 +100,7 @@ func TestCalculateRFC3550Jitter_BasicSequence(t *testing.T) {
 }
 
 func TestCalculateRFC3550Jitter_EmptyInput(t *testing.T) {
-	jitter := calculateRFC3550Jitter([]time.Duration{})
+	jitter := twampstats.Jitter([]time.Duration{})
 	if jitter != 0 {
 		t.Errorf("Expected 0 jitter for empty input, got %v", jitter)
 	}
@@ -160,7 +109,7 @@ func TestCalculateRFC3550Jitter_EmptyInput(t *testing.T) {
 func TestCalculateRFC3550Jitter_ConstantDelay(t *testing.T) {
 	// Constant delay = zero IPDV = zero jitter
 	ipdv := []time.Duration{0, 0, 0, 0, 0}
-	jitter := calculateRFC3550Jitter(ipdv)
+	jitter := twampstats.Jitter(ipdv)
 
 	if jitter != 0 {
 		t.Errorf("Expected 0 jitter for constant delay, got %v", jitter)
@@ -171,15 +120,15 @@ func TestCalculateRFC3550Jitter_ExponentialSmoothing(t *testing.T) {
 	// Initial large IPDV followed by zeros
 	// Jitter should decay exponentially
 	ipdv := []time.Duration{
-		16 * time.Millisecond, // Large initial value
+		16 * time.Millisecond,                       // Large initial value
 		0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, // 15 zeros
 	}
 
-	jitter := calculateRFC3550Jitter(ipdv)
+	jitter := twampstats.Jitter(ipdv)
 
 	// After 16 iterations with zeros, jitter should decay significantly
 	// J(n) = J(0) * (15/16)^n for zeros
-	initialJitter := float64(16 * time.Millisecond.Nanoseconds()) / 16.0
+	initialJitter := float64(16*time.Millisecond.Nanoseconds()) / 16.0
 	expectedDecay := initialJitter * math.Pow(15.0/16.0, 15)
 
 	// Allow some tolerance
@@ -202,7 +151,7 @@ func TestCalculateForwardHops_ValidTTL(t *testing.T) {
 	}
 
 	for _, tc := range testCases {
-		hops := calculateForwardHops(tc.ttl)
+		hops := twampstats.ForwardHops(tc.ttl)
 		if hops != tc.expected {
 			t.Errorf("TTL=%d: expected %d hops, got %d", tc.ttl, tc.expected, hops)
 		}
@@ -213,7 +162,7 @@ func TestCalculateForwardHops_InvalidTTL(t *testing.T) {
 	testCases := []int{0, -1, 256, 1000}
 
 	for _, ttl := range testCases {
-		hops := calculateForwardHops(ttl)
+		hops := twampstats.ForwardHops(ttl)
 		if hops != -1 {
 			t.Errorf("TTL=%d: expected -1 (invalid), got %d", ttl, hops)
 		}
@@ -226,13 +175,13 @@ func TestCalculateReverseHops_LinuxDevice(t *testing.T) {
 		ttl      int
 		expected int
 	}{
-		{64, 0},   // No hops
-		{54, 10},  // 10 hops
-		{32, 32},  // Half gone
+		{64, 0},  // No hops
+		{54, 10}, // 10 hops
+		{32, 32}, // Half gone
 	}
 
 	for _, tc := range testCases {
-		hops := calculateReverseHops(tc.ttl)
+		hops := twampstats.ReverseHops(tc.ttl)
 		if hops != tc.expected {
 			t.Errorf("TTL=%d: expected %d hops, got %d", tc.ttl, tc.expected, hops)
 		}
@@ -251,7 +200,7 @@ func TestCalculateReverseHops_WindowsDevice(t *testing.T) {
 	}
 
 	for _, tc := range testCases {
-		hops := calculateReverseHops(tc.ttl)
+		hops := twampstats.ReverseHops(tc.ttl)
 		if hops != tc.expected {
 			t.Errorf("TTL=%d: expected %d hops, got %d", tc.ttl, tc.expected, hops)
 		}
@@ -270,7 +219,7 @@ func TestCalculateReverseHops_NetworkDevice(t *testing.T) {
 	}
 
 	for _, tc := range testCases {
-		hops := calculateReverseHops(tc.ttl)
+		hops := twampstats.ReverseHops(tc.ttl)
 		if hops != tc.expected {
 			t.Errorf("TTL=%d: expected %d hops, got %d", tc.ttl, tc.expected, hops)
 		}
@@ -281,7 +230,7 @@ func TestCalculateReverseHops_InvalidTTL(t *testing.T) {
 	testCases := []int{0, -1}
 
 	for _, ttl := range testCases {
-		hops := calculateReverseHops(ttl)
+		hops := twampstats.ReverseHops(ttl)
 		if hops != -1 {
 			t.Errorf("TTL=%d: expected -1 (invalid), got %d", ttl, hops)
 		}
@@ -302,7 +251,7 @@ func TestCalculateReverseHops_InitialTTLEstimation(t *testing.T) {
 	}
 
 	for _, tc := range testCases {
-		hops := calculateReverseHops(tc.ttl)
+		hops := twampstats.ReverseHops(tc.ttl)
 		expectedHops := tc.expectedTTL - tc.ttl
 		if hops != expectedHops {
 			t.Errorf("TTL=%d: expected initial TTL=%d, hops=%d, got hops=%d",
@@ -0,0 +1,155 @@
+package unit
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"network-test-api/pkg/nettest"
+)
+
+func TestNewIperf3Client_Defaults(t *testing.T) {
+	c := nettest.NewIperf3Client("iperf.example.net")
+	if c.Port != 5201 || c.Duration != 5 || c.Parallel != 1 || c.Protocol != "TCP" {
+		t.Errorf("Expected port 5201, 5 s, 1 stream over TCP, got %d, %d s, %d over %s", c.Port, c.Duration, c.Parallel, c.Protocol)
+	}
+	if c.BlockSize != nettest.DEFAULT_TCP_BLKSIZE || c.Bandwidth != nettest.DEFAULT_BANDWIDTH {
+		t.Errorf("Expected the TCP block size and default bandwidth, got %d and %d", c.BlockSize, c.Bandwidth)
+	}
+	if c.Family != nettest.FAMILY_AUTO || c.Payload.Entropy != nettest.PayloadRandom {
+		t.Errorf("Expected family auto and a random payload, got %s and %s", c.Family, c.Payload.Entropy)
+	}
+}
+
+func TestNewIperf3Client_Options(t *testing.T) {
+	var intervals int
+	c := nettest.NewIperf3Client("iperf.example.net",
+		nettest.WithPort(5202),
+		nettest.WithDuration(1500*time.Millisecond),
+		nettest.WithParallel(4),
+		nettest.WithProtocol("udp"),
+		nettest.WithReverse(true),
+		nettest.WithBandwidth(2500000),
+		nettest.WithPayload(nettest.PayloadZero),
+		nettest.WithFamily(nettest.FAMILY_IPV6),
+		nettest.WithOmit(2*time.Second),
+		nettest.WithTCPInfo(true),
+		nettest.WithIntervalFunc(func(nettest.Iperf3Interval) { intervals++ }),
+	)
+	if c.Port != 5202 || c.Duration != 2 || c.Parallel != 4 || c.Protocol != "UDP" || !c.Reverse {
+		t.Errorf("Expected port 5202, 2 s, 4 streams, reverse UDP, got %+v", c)
+	}
+	if c.BlockSize != nettest.DEFAULT_UDP_BLKSIZE {
+		t.Errorf("Expected the UDP block size for UDP, got %d", c.BlockSize)
+	}
+	if c.Bandwidth != 2500000 || c.Payload.Entropy != nettest.PayloadZero || c.Family != nettest.FAMILY_IPV6 || c.Omit != 2 {
+		t.Errorf("Expected 2.5 Mbit/s, zero payload, ipv6 and 2 s omitted, got %d, %s, %s and %d", c.Bandwidth, c.Payload.Entropy, c.Family, c.Omit)
+	}
+	if c.OnInterval == nil {
+		t.Error("Expected WithIntervalFunc to set OnInterval")
+	}
+	if !c.TCPInfo {
+		t.Error("Expected WithTCPInfo to set TCPInfo")
+	}
+}
+
+func TestNewIperf3Client_Unlimited(t *testing.T) {
+	if c := nettest.NewIperf3Client("iperf.example.net", nettest.WithBandwidth(0)); c.Bandwidth != 0 {
+		t.Errorf("Expected WithBandwidth(0) to lift the limit, got %d", c.Bandwidth)
+	}
+	if c := nettest.NewIperf3Client("iperf.example.net", nettest.WithBandwidth(-1)); c.Bandwidth != nettest.DEFAULT_BANDWIDTH {
+		t.Errorf("Expected a negative bandwidth to keep the default, got %d", c.Bandwidth)
+	}
+}
+
+func TestAcquireBuffer_Pooled(t *testing.T) {
+	nettest.ReleaseBuffer(nettest.AcquireBuffer(128 * 1024))
+	// Only the slice header handed back to the pool is allocated
+	allocs := testing.AllocsPerRun(100, func() {
+		buf := nettest.AcquireBuffer(128 * 1024)
+		if len(buf) != 128*1024 {
+			t.Fatalf("Expected a 128 KiB buffer, got %d bytes", len(buf))
+		}
+		nettest.ReleaseBuffer(buf)
+	})
+	if allocs > 1 {
+		t.Errorf("Expected at most 1 allocation per buffer, got %v", allocs)
+	}
+}
+
+func TestNewTwampRunner_Options(t *testing.T) {
+	r := nettest.NewTwampRunner("twamp.example.net")
+	if r.Port != 862 || r.Count != 10 || r.Interval != time.Second || r.Timeout != 5 || r.DSCP != 0 {
+		t.Errorf("Expected port 862, 10 probes 1 s apart, 5 s timeout, DSCP 0, got %+v", r)
+	}
+
+	r = nettest.NewTwampRunner("twamp.example.net",
+		nettest.WithPort(8862),
+		nettest.WithCount(50),
+		nettest.WithPadding(1400),
+		nettest.WithDSCP(46),
+		nettest.WithInterval(100*time.Millisecond),
+		nettest.WithTimeout(3*time.Second),
+		nettest.WithErrorEstimate(0x8001),
+		// Options that only apply to iperf3 are ignored
+		nettest.WithDuration(time.Minute),
+	)
+	if r.Port != 8862 || r.Count != 50 || r.Padding != 1400 || r.DSCP != 46 {
+		t.Errorf("Expected port 8862, 50 probes, 1400 bytes padding, DSCP 46, got %+v", r)
+	}
+	if r.Interval != 100*time.Millisecond || r.Timeout != 3 || r.ErrorEstimate != 0x8001 {
+		t.Errorf("Expected 100 ms apart, 3 s timeout, error estimate 0x8001, got %v, %d and 0x%04X", r.Interval, r.Timeout, r.ErrorEstimate)
+	}
+}
+
+func TestNettestRun_Canceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	client := nettest.NewIperf3Client("127.0.0.1", nettest.WithPort(1))
+	defer client.Close()
+	_, err := client.Run(ctx)
+	var ne *nettest.Error
+	if !errors.As(err, &ne) || ne.Code != nettest.ERR_CANCELED || !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected an ERR_CANCELED error of iperf3, got %v", err)
+	}
+
+	_, err = nettest.NewTwampRunner("127.0.0.1", nettest.WithPort(1)).Run(ctx)
+	if !errors.As(err, &ne) || ne.Code != nettest.ERR_CANCELED {
+		t.Errorf("Expected an ERR_CANCELED error of TWAMP, got %v", err)
+	}
+}
+
+func TestRunTest_DialsPort(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	accepted := make(chan struct{})
+	go func() {
+		if conn, err := ln.Accept(); err == nil {
+			close(accepted)
+			_ = conn.Close() // No iperf3 server: the test fails after connecting
+		}
+	}()
+
+	port := ln.Addr().(*net.TCPAddr).Port
+	_, err = nettest.RunTest(context.Background(), "127.0.0.1", port, nettest.WithDuration(time.Second))
+	if err == nil {
+		t.Error("Expected an error from a server that closes the control connection")
+	}
+	select {
+	case <-accepted:
+	case <-time.After(time.Second):
+		t.Errorf("Expected RunTest to connect to port %d", port)
+	}
+}
+
+func TestNewIperf3Auth_InvalidKey(t *testing.T) {
+	if _, err := nettest.NewIperf3Auth("user", "secret", "not a key", false); err == nil {
+		t.Error("Expected an error for a public key that is not PEM")
+	}
+}
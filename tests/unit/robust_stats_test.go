@@ -0,0 +1,68 @@
+package unit
+
+import (
+	"math"
+	"testing"
+
+	"network-test-api/pkg/stats"
+)
+
+func TestWelford_MatchesTwoPass(t *testing.T) {
+	values := []float64{2, 4, 4, 4, 5, 5, 7, 9}
+	var w stats.Welford
+	for _, v := range values {
+		w.Add(v)
+	}
+	if w.Count() != 8 || w.Mean() != 5 {
+		t.Errorf("Expected 8 samples with mean 5, got %d and %v", w.Count(), w.Mean())
+	}
+	if math.Abs(w.StdDev()-2) > 1e-12 {
+		t.Errorf("Expected a population stddev of 2, got %v", w.StdDev())
+	}
+	if math.Abs(w.SampleVariance()-32.0/7) > 1e-12 {
+		t.Errorf("Expected a sample variance of 32/7, got %v", w.SampleVariance())
+	}
+}
+
+func TestWelford_LargeMeanSmallSpread(t *testing.T) {
+	// Round trips near 100 s in nanoseconds, 1 ns apart, where E[X²] - E[X]²
+	// cancels to rounding noise
+	var w stats.Welford
+	for i := 0; i < 1000; i++ {
+		w.Add(1e11 + float64(i%2))
+	}
+	if math.Abs(w.StdDev()-0.5) > 1e-6 {
+		t.Errorf("Expected a stddev of 0.5 ns, got %v", w.StdDev())
+	}
+}
+
+func TestWelford_Empty(t *testing.T) {
+	var w stats.Welford
+	if w.Mean() != 0 || w.StdDev() != 0 || w.SampleStdDev() != 0 {
+		t.Errorf("Expected zeros without samples, got %v, %v and %v", w.Mean(), w.StdDev(), w.SampleStdDev())
+	}
+	w.Add(3)
+	if w.SampleVariance() != 0 || w.Variance() != 0 {
+		t.Errorf("Expected no variance of one sample, got %v and %v", w.SampleVariance(), w.Variance())
+	}
+}
+
+func TestMedianAndMAD(t *testing.T) {
+	values := []float64{1, 1, 2, 2, 4, 6, 9}
+	if got := stats.Median(values); got != 2 {
+		t.Errorf("Expected a median of 2, got %v", got)
+	}
+	// Deviations from 2: 1, 1, 0, 0, 2, 4, 7
+	if got := stats.MAD(values); got != 1 {
+		t.Errorf("Expected a MAD of 1, got %v", got)
+	}
+	if values[6] != 9 {
+		t.Error("Expected Median to leave its input unsorted")
+	}
+	if got := stats.Median([]float64{4, 1, 3, 2}); got != 2.5 {
+		t.Errorf("Expected the median of an even count to interpolate to 2.5, got %v", got)
+	}
+	if stats.Median(nil) != 0 || stats.MAD(nil) != 0 {
+		t.Error("Expected 0 without values")
+	}
+}
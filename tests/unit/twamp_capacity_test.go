@@ -0,0 +1,49 @@
+package unit
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"network-test-api/pkg/stats"
+)
+
+const capacityBinWidth = 0.05
+
+func TestDispersionMbps(t *testing.T) {
+	// 1500-byte pair 120us apart: 100 Mbit/s bottleneck
+	if got := stats.DispersionMbps(2, 1500, 120*time.Microsecond); math.Abs(got-100) > 1e-9 {
+		t.Errorf("Expected 100 Mbit/s, got %f", got)
+	}
+	// A train of 5 spans 4 transmission times
+	if got := stats.DispersionMbps(5, 1500, 48*time.Microsecond); math.Abs(got-1000) > 1e-9 {
+		t.Errorf("Expected 1000 Mbit/s, got %f", got)
+	}
+	if got := stats.DispersionMbps(2, 1500, 0); got != 0 {
+		t.Errorf("Expected 0 for zero dispersion, got %f", got)
+	}
+}
+
+func TestCapacityModeIgnoresCrossTraffic(t *testing.T) {
+	// Most pairs see the 100 Mbit/s bottleneck; cross traffic expands some
+	// (lower samples) and compresses a few (higher samples)
+	samples := []float64{99, 100, 100.5, 101, 99.5, 100, 42, 55, 61, 38, 180, 240}
+
+	mode, n := stats.CapacityMode(samples, capacityBinWidth)
+	if mode < 99 || mode > 101 {
+		t.Errorf("Expected capacity near 100 Mbit/s, got %f", mode)
+	}
+	if n != 6 {
+		t.Errorf("Expected 6 samples in the modal bin, got %d", n)
+	}
+}
+
+func TestCapacityModeTiesPreferHigher(t *testing.T) {
+	mode, _ := stats.CapacityMode([]float64{50, 50.5, 100, 100.5}, capacityBinWidth)
+	if mode < 100 {
+		t.Errorf("Expected the tie to go to the higher capacity, got %f", mode)
+	}
+	if mode, n := stats.CapacityMode(nil, capacityBinWidth); mode != 0 || n != 0 {
+		t.Errorf("Expected no mode without samples, got %f (%d)", mode, n)
+	}
+}
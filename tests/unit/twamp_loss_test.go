@@ -0,0 +1,183 @@
+package unit
+
+import (
+	"math"
+	"testing"
+
+	"network-test-api/pkg/stats"
+)
+
+func TestLossCounterInOrder(t *testing.T) {
+	c := stats.NewLossCounter(200)
+	for seq := uint32(0); seq < 200; seq++ {
+		c.Observe(seq)
+	}
+
+	if c.Received() != 200 {
+		t.Errorf("Expected 200 received, got %d", c.Received())
+	}
+	if c.Reordered() != 0 || c.Duplicates() != 0 {
+		t.Errorf("Expected no reordering or duplicates, got %d and %d", c.Reordered(), c.Duplicates())
+	}
+	if b := c.Bursts(200); b.Count != 0 {
+		t.Errorf("Expected no loss bursts, got %d", b.Count)
+	}
+}
+
+func TestLossCounterReorderAndDuplicates(t *testing.T) {
+	c := stats.NewLossCounter(10)
+	for _, seq := range []uint32{0, 2, 1, 3, 3, 5, 4, 9, 42} {
+		c.Observe(seq)
+	}
+
+	if c.Received() != 7 {
+		t.Errorf("Expected 7 received, got %d", c.Received())
+	}
+	if c.Reordered() != 2 {
+		t.Errorf("Expected 2 reordered (1 and 4), got %d", c.Reordered())
+	}
+	if c.Duplicates() != 1 {
+		t.Errorf("Expected 1 duplicate, got %d", c.Duplicates())
+	}
+}
+
+func TestLossCounterBursts(t *testing.T) {
+	c := stats.NewLossCounter(130)
+	for seq := uint32(0); seq < 130; seq++ {
+		// Lose 10, 63-66 (across a bitmap word) and the last probe
+		if seq == 10 || (seq >= 63 && seq <= 66) || seq == 129 {
+			continue
+		}
+		c.Observe(seq)
+	}
+
+	b := c.Bursts(130)
+	if b.Count != 3 {
+		t.Errorf("Expected 3 loss bursts, got %d", b.Count)
+	}
+	if b.MaxLength != 4 {
+		t.Errorf("Expected longest burst of 4, got %d", b.MaxLength)
+	}
+	if lost := 130 - c.Received(); lost != 6 {
+		t.Errorf("Expected 6 lost, got %d", lost)
+	}
+}
+
+func TestLossCounterReorderingDistances(t *testing.T) {
+	c := stats.NewLossCounter(10)
+	// 1 is overtaken by 2 and 3, 5 by 6, 4 by 5 and 6; 6 again is a duplicate
+	for _, seq := range []uint32{0, 2, 3, 1, 6, 5, 4, 6, 7} {
+		c.Observe(seq)
+	}
+
+	r := c.Reordering()
+	if r.MaxDistance != 2 {
+		t.Errorf("Expected a max distance of 2, got %d", r.MaxDistance)
+	}
+	want := []stats.ReorderDistance{{Distance: 1, Count: 1}, {Distance: 2, Count: 2}}
+	if len(r.Distances) != len(want) {
+		t.Fatalf("Expected %d distances, got %+v", len(want), r.Distances)
+	}
+	for i, d := range r.Distances {
+		if d != want[i] {
+			t.Errorf("Expected distance %d to be %+v, got %+v", i, want[i], d)
+		}
+	}
+	if c.Reordered() != 3 || c.Duplicates() != 1 {
+		t.Errorf("Expected 3 reordered and 1 duplicate, got %d and %d", c.Reordered(), c.Duplicates())
+	}
+}
+
+func TestLossCounterNoReordering(t *testing.T) {
+	c := stats.NewLossCounter(3)
+	for seq := uint32(0); seq < 3; seq++ {
+		c.Observe(seq)
+	}
+	if r := c.Reordering(); r.MaxDistance != 0 || len(r.Distances) != 0 {
+		t.Errorf("Expected no reordering distances, got %+v", r)
+	}
+}
+
+// lossPattern returns a counter of sent probes that observed all but lost
+func lossPattern(sent uint32, lost func(seq uint32) bool) *stats.LossCounter {
+	c := stats.NewLossCounter(int(sent))
+	for seq := uint32(0); seq < sent; seq++ {
+		if !lost(seq) {
+			c.Observe(seq)
+		}
+	}
+	return c
+}
+
+func TestLossBurstsRandomLoss(t *testing.T) {
+	// Every 50th probe lost: 2% isolated loss
+	b := lossPattern(1000, func(seq uint32) bool { return seq%50 == 0 }).Bursts(1000)
+
+	if b.Count != 20 || b.MeanLength != 1 {
+		t.Errorf("Expected 20 runs of 1, got %d of %v", b.Count, b.MeanLength)
+	}
+	if math.Abs(b.BurstRatio-0.98) > 1e-9 {
+		t.Errorf("Expected a burst ratio of 0.98 for random loss, got %v", b.BurstRatio)
+	}
+	ge := b.GilbertElliott
+	if ge.Bursts != 0 || ge.P != 0 || ge.R != 0 || ge.LossBad != 0 {
+		t.Errorf("Expected isolated losses to form no bursts, got %+v", ge)
+	}
+	if math.Abs(ge.LossGood-0.02) > 1e-9 {
+		t.Errorf("Expected a gap density of 0.02, got %v", ge.LossGood)
+	}
+}
+
+func TestLossBurstsOutage(t *testing.T) {
+	// The same 2% lost in one outage
+	b := lossPattern(1000, func(seq uint32) bool { return seq >= 100 && seq < 120 }).Bursts(1000)
+
+	if b.Count != 1 || b.MaxLength != 20 || b.MeanLength != 20 {
+		t.Errorf("Expected one run of 20, got %+v", b)
+	}
+	if math.Abs(b.BurstRatio-19.6) > 1e-9 {
+		t.Errorf("Expected a burst ratio of 19.6, got %v", b.BurstRatio)
+	}
+	ge := b.GilbertElliott
+	if ge.Bursts != 1 || ge.LossBad != 1 || ge.LossGood != 0 {
+		t.Errorf("Expected one burst of only losses, got %+v", ge)
+	}
+	if math.Abs(ge.R-1.0/20) > 1e-9 || math.Abs(ge.P-1.0/980) > 1e-9 {
+		t.Errorf("Expected p of 1/980 and r of 1/20, got %v and %v", ge.P, ge.R)
+	}
+}
+
+func TestLossBurstsGilbertElliott(t *testing.T) {
+	// 100-101 and 105-106 form one burst of 7 probes (3 received between,
+	// fewer than Gmin); 500 is an isolated loss of the gap
+	lost := map[uint32]bool{100: true, 101: true, 105: true, 106: true, 500: true}
+	b := lossPattern(1000, func(seq uint32) bool { return lost[seq] }).Bursts(1000)
+
+	if b.Count != 3 || b.MaxLength != 2 {
+		t.Errorf("Expected 3 runs of at most 2, got %d of at most %d", b.Count, b.MaxLength)
+	}
+	ge := b.GilbertElliott
+	for _, c := range []struct {
+		name      string
+		got, want float64
+	}{
+		{"p", ge.P, 1.0 / 993},
+		{"r", ge.R, 1.0 / 7},
+		{"loss_good", ge.LossGood, 1.0 / 993},
+		{"loss_bad", ge.LossBad, 4.0 / 7},
+	} {
+		if math.Abs(c.got-c.want) > 1e-9 {
+			t.Errorf("Expected %s of %v, got %v", c.name, c.want, c.got)
+		}
+	}
+	if ge.Bursts != 1 {
+		t.Errorf("Expected 1 burst, got %d", ge.Bursts)
+	}
+}
+
+func TestLossBurstsTotalLoss(t *testing.T) {
+	b := lossPattern(10, func(uint32) bool { return true }).Bursts(10)
+	if b.MaxLength != 10 || b.BurstRatio != 0 {
+		t.Errorf("Expected one run of 10 and no burst ratio, got %+v", b)
+	}
+}
@@ -0,0 +1,164 @@
+package unit
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"network-test-api/pkg/twampstats"
+)
+
+// probe is a usable probe over a path of forward and reverse delays, the
+// reflector's clock offset from the sender's and its turnaround
+func probe(seq uint32, forward, reverse, offset, turnaround time.Duration) twampstats.PacketResult {
+	return twampstats.PacketResult{
+		Seq:         seq,
+		RawForward:  forward + offset,
+		RawReverse:  reverse - offset,
+		Turnaround:  turnaround,
+		NetworkRTT:  forward + reverse,
+		SenderTTL:   250,
+		ReceivedTTL: 60,
+	}
+}
+
+func TestProcessResults_OffsetCorrection(t *testing.T) {
+	const offset = 40 * time.Millisecond
+	results := []twampstats.PacketResult{
+		probe(0, 10*time.Millisecond, 10*time.Millisecond, offset, 100*time.Microsecond),
+		probe(1, 12*time.Millisecond, 12*time.Millisecond, offset, 300*time.Microsecond),
+		probe(2, 11*time.Millisecond, 11*time.Millisecond, offset, 200*time.Microsecond),
+	}
+	s := twampstats.ProcessResults(results)
+
+	if s.Received != 3 || s.Usable != 3 || s.IPDVPairs != 2 {
+		t.Errorf("Expected 3 received and usable, 2 IPDV pairs, got %d, %d and %d", s.Received, s.Usable, s.IPDVPairs)
+	}
+	if s.ClockOffset != offset {
+		t.Errorf("Expected the clock offset %v, got %v", offset, s.ClockOffset)
+	}
+	if s.ForwardRaw.Min != 50*time.Millisecond || s.ReverseRaw.Max != -28*time.Millisecond {
+		t.Errorf("Expected raw forward min 50ms and reverse max -28ms, got %v and %v", s.ForwardRaw.Min, s.ReverseRaw.Max)
+	}
+	want := twampstats.DelayStats{Min: 10 * time.Millisecond, Max: 12 * time.Millisecond, Avg: 11 * time.Millisecond, Median: 11 * time.Millisecond, MAD: time.Millisecond}
+	if s.ForwardCorrected != want || s.ReverseCorrected != want {
+		t.Errorf("Expected corrected delays %+v, got %+v and %+v", want, s.ForwardCorrected, s.ReverseCorrected)
+	}
+	if s.NetworkRTT.Min != 20*time.Millisecond || s.NetworkRTT.Max != 24*time.Millisecond || s.NetworkRTT.Avg != 22*time.Millisecond {
+		t.Errorf("Expected network RTT 20/22/24 ms, got %+v", s.NetworkRTT)
+	}
+	if s.Turnaround.Avg != 200*time.Microsecond {
+		t.Errorf("Expected an average turnaround of 200µs, got %v", s.Turnaround.Avg)
+	}
+	// Population stddev of 20, 24, 22 ms
+	wantStdDev := time.Duration(math.Sqrt(8.0/3) * 1e6)
+	if d := s.NetworkRTTStdDev - wantStdDev; d < -time.Microsecond || d > time.Microsecond {
+		t.Errorf("Expected an RTT stddev of %v, got %v", wantStdDev, s.NetworkRTTStdDev)
+	}
+}
+
+func TestProcessResults_IPDVAndJitter(t *testing.T) {
+	var results []twampstats.PacketResult
+	for i, d := range []time.Duration{10, 12, 11, 15} {
+		results = append(results, probe(uint32(i), d*time.Millisecond, 5*time.Millisecond, 100*time.Millisecond, 0))
+	}
+	s := twampstats.ProcessResults(results)
+
+	// IPDV of 10, 12, 11, 15 ms: +2, -1, +4, the offset cancelling out
+	want := twampstats.IPDVStats{Min: -time.Millisecond, Max: 4 * time.Millisecond, Avg: 5 * time.Millisecond / 3, MeanAbs: 7 * time.Millisecond / 3}
+	if s.ForwardIPDV != want {
+		t.Errorf("Expected forward IPDV %+v, got %+v", want, s.ForwardIPDV)
+	}
+	jitter := twampstats.Jitter([]time.Duration{2 * time.Millisecond, -time.Millisecond, 4 * time.Millisecond})
+	if s.ForwardJitter != jitter {
+		t.Errorf("Expected the RFC 3550 jitter of the IPDVs, %v, got %v", jitter, s.ForwardJitter)
+	}
+	if s.ReverseIPDV != (twampstats.IPDVStats{}) || s.ReverseJitter != 0 {
+		t.Errorf("Expected no reverse IPDV for a constant reverse delay, got %+v and %v", s.ReverseIPDV, s.ReverseJitter)
+	}
+}
+
+func TestProcessResults_LostAndSteppedProbes(t *testing.T) {
+	step := probe(2, 50*time.Millisecond, 50*time.Millisecond, 0, 0)
+	step.SenderStep = true
+	step.ReceiveSkew = 5 * time.Millisecond
+	reflector := probe(3, 10*time.Millisecond, 10*time.Millisecond, 0, 0)
+	reflector.ReflectorStep = true
+	reflector.ReceiveSkew = 5 * time.Millisecond
+
+	after := probe(5, 14*time.Millisecond, 10*time.Millisecond, 0, 0)
+	after.SendSkew, after.ReceiveSkew = 5*time.Millisecond, 5*time.Millisecond
+
+	results := []twampstats.PacketResult{
+		probe(0, 10*time.Millisecond, 10*time.Millisecond, 0, 0),
+		{Seq: 1, Lost: true},
+		step,
+		reflector,
+		{Seq: 4, Lost: true},
+		after,
+	}
+	s := twampstats.ProcessResults(results)
+
+	if s.Received != 4 || s.Usable != 2 || s.ExcludedProbes != 2 {
+		t.Errorf("Expected 4 received, 2 usable and 2 excluded, got %d, %d and %d", s.Received, s.Usable, s.ExcludedProbes)
+	}
+	if s.SenderStepProbes != 1 || s.ReflectorStepProbes != 1 || s.MaxClockStep != 5*time.Millisecond {
+		t.Errorf("Expected a sender and a reflector step of at most 5ms, got %d, %d and %v", s.SenderStepProbes, s.ReflectorStepProbes, s.MaxClockStep)
+	}
+	// The steps in between keep the first and last probe from forming a pair
+	if s.IPDVPairs != 0 {
+		t.Errorf("Expected no IPDV across the clock steps, got %d pairs", s.IPDVPairs)
+	}
+	if s.NetworkRTT.Max != 24*time.Millisecond {
+		t.Errorf("Expected the stepped probes left out of the RTT, got a maximum of %v", s.NetworkRTT.Max)
+	}
+	if s.ForwardHops != (twampstats.HopStats{Min: 5, Max: 5, Avg: 5}) || s.ReverseHops != (twampstats.HopStats{Min: 4, Max: 4, Avg: 4}) {
+		t.Errorf("Expected 5 hops forward and 4 back on all received probes, got %+v and %+v", s.ForwardHops, s.ReverseHops)
+	}
+}
+
+func TestProcessResults_StepBetweenProbes(t *testing.T) {
+	second := probe(1, 30*time.Millisecond, 10*time.Millisecond, 0, 0)
+	second.SendSkew, second.ReceiveSkew = 20*time.Millisecond, 20*time.Millisecond
+	third := probe(2, 32*time.Millisecond, 10*time.Millisecond, 0, 0)
+	third.SendSkew, third.ReceiveSkew = 20*time.Millisecond, 20*time.Millisecond
+
+	s := twampstats.ProcessResults([]twampstats.PacketResult{probe(0, 10*time.Millisecond, 10*time.Millisecond, 0, 0), second, third})
+	if s.Usable != 3 || s.ExcludedProbes != 0 {
+		t.Errorf("Expected a step between probes to leave them usable, got %d usable and %d excluded", s.Usable, s.ExcludedProbes)
+	}
+	if s.IPDVPairs != 1 || s.ForwardIPDV.Max != 2*time.Millisecond || s.MaxClockStep != 20*time.Millisecond {
+		t.Errorf("Expected only the pair after the 20ms step, IPDV 2ms, got %d pairs, %v and a step of %v", s.IPDVPairs, s.ForwardIPDV.Max, s.MaxClockStep)
+	}
+}
+
+func TestProcessResults_NoReplies(t *testing.T) {
+	s := twampstats.ProcessResults([]twampstats.PacketResult{{Seq: 0, Lost: true}, {Seq: 1, Lost: true}})
+	if s != (twampstats.Summary{}) {
+		t.Errorf("Expected an empty summary without replies, got %+v", s)
+	}
+}
+
+func TestInitialTTL(t *testing.T) {
+	for ttl, want := range map[int]int{1: 64, 64: 64, 65: 128, 128: 128, 129: 255, 255: 255} {
+		if got := twampstats.InitialTTL(ttl); got != want {
+			t.Errorf("InitialTTL(%d) = %d, want %d", ttl, got, want)
+		}
+	}
+}
+
+func TestProcessResults_RobustRTT(t *testing.T) {
+	var results []twampstats.PacketResult
+	for i, rtt := range []time.Duration{20, 21, 20, 22, 21, 400} {
+		results = append(results, probe(uint32(i), rtt*time.Millisecond/2, rtt*time.Millisecond/2, 0, 0))
+	}
+	s := twampstats.ProcessResults(results)
+
+	// The 400ms outlier pulls the mean, not the median and MAD
+	if s.NetworkRTT.Median != 21*time.Millisecond || s.NetworkRTT.MAD != 1*time.Millisecond {
+		t.Errorf("Expected a median RTT of 21ms and MAD of 1ms, got %v and %v", s.NetworkRTT.Median, s.NetworkRTT.MAD)
+	}
+	if s.NetworkRTT.Avg < 80*time.Millisecond {
+		t.Errorf("Expected the outlier in the mean, got %v", s.NetworkRTT.Avg)
+	}
+}